@@ -0,0 +1,22 @@
+package kivik
+
+import (
+	"context"
+
+	"github.com/flimzy/kivik/driver"
+	"github.com/flimzy/kivik/errors"
+)
+
+// AdminParty returns true if the server grants admin rights to
+// unauthenticated requests, the so-called "admin party" of a freshly
+// installed CouchDB server, regardless of the client's own credentials.
+// Deployment tooling may use this to refuse to run against insecure servers.
+// An error with status StatusNotImplemented is returned if the driver cannot
+// tell.
+func (c *Client) AdminParty(ctx context.Context) (bool, error) {
+	checker, ok := c.driverClient.(driver.AdminPartyChecker)
+	if !ok {
+		return false, errors.Status(StatusNotImplemented, "kivik: driver does not support admin party detection")
+	}
+	return checker.AdminParty(ctx)
+}
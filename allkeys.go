@@ -0,0 +1,217 @@
+package kivik
+
+import (
+	"context"
+	"io"
+	"strconv"
+
+	"github.com/flimzy/kivik/driver"
+	"github.com/flimzy/kivik/errors"
+)
+
+// DefaultKeysBatchSize is the maximum number of keys sent in each request by
+// AllDocsByKeys, unless set otherwise with KeysBatchSize.
+const DefaultKeysBatchSize = 1000
+
+const keysBatchSizeOption = "kivik_keys_batch_size"
+
+// KeysBatchSize returns options for AllDocsByKeys, which set the maximum number
+// of keys sent in each request.
+func KeysBatchSize(n int) Options {
+	return Options{keysBatchSizeOption: n}
+}
+
+// AllDocsByKeys returns the documents with the IDs keys, in the order given,
+// as AllDocs with the keys option. Drivers which support it, such as the
+// CouchDB driver, send the keys in the request body, rather than the URL. Key
+// lists longer than DefaultKeysBatchSize, or the size set with KeysBatchSize,
+// are split across several requests, and the results merged into a single
+// stream of rows, to avoid request size limits. Only the first request is
+// made before AllDocsByKeys returns; each subsequent one is made once the
+// rows of the previous have been read. The skip and limit options apply to
+// the merged rows.
+func (db *DB) AllDocsByKeys(ctx context.Context, keys []string, options ...Options) (*Rows, error) {
+	opts, err := db.options(ctx, "AllDocs", options...)
+	if err != nil {
+		return nil, err
+	}
+	reuse := reuseBuffers(opts)
+	n := prefetch(opts)
+	size := DefaultKeysBatchSize
+	if s, ok := opts[keysBatchSizeOption].(int); ok && s > 0 {
+		size = s
+	}
+	delete(opts, keysBatchSizeOption)
+	skip, err := intOption(opts, "skip", 0)
+	if err != nil {
+		return nil, err
+	}
+	limit, err := intOption(opts, "limit", -1)
+	if err != nil {
+		return nil, err
+	}
+	delete(opts, "skip")
+	delete(opts, "limit")
+	if opts, err = encodeKeyOptions(opts); err != nil {
+		return nil, errors.WrapStatus(StatusBadRequest, err)
+	}
+	batches := make([][]string, 0, len(keys)/size+1)
+	for len(keys) > size {
+		batches = append(batches, keys[:size])
+		keys = keys[size:]
+	}
+	batches = append(batches, keys)
+
+	ctx, cancel := withTimeout(ctx, db.timeouts.Query)
+	rowsi := &keyBatchRows{
+		ctx:     ctx,
+		db:      db.driverDB,
+		opts:    opts,
+		batches: batches,
+		skip:    skip,
+		limit:   limit,
+	}
+	if err := rowsi.query(); err != nil {
+		cancel()
+		return nil, err
+	}
+	var rows *Rows
+	if n > 0 {
+		rows = newPrefetchRows(ctx, rowsi, n)
+	} else {
+		rows = newRows(ctx, rowsi, reuse)
+	}
+	rows.releaseOnClose(cancel)
+	return rows, nil
+}
+
+// intOption returns the named integer option, or def if it is unset.
+func intOption(opts Options, name string, def int) (int, error) {
+	switch t := opts[name].(type) {
+	case nil:
+		return def, nil
+	case int:
+		return t, nil
+	case int64:
+		return int(t), nil
+	case float64:
+		if t == float64(int(t)) {
+			return int(t), nil
+		}
+	case string:
+		if n, err := strconv.Atoi(t); err == nil {
+			return n, nil
+		}
+	}
+	return 0, errors.Statusf(StatusBadRequest, "kivik: invalid value for %s: %v", name, opts[name])
+}
+
+// keyBatchRows queries AllDocs for each batch of keys in turn, and returns
+// their rows as one result set, applying skip and limit across them.
+type keyBatchRows struct {
+	ctx     context.Context
+	db      driver.DB
+	opts    Options
+	batches [][]string
+	skip    int
+	limit   int // -1 for no limit
+
+	rows      driver.Rows
+	started   bool
+	offset    int64
+	totalRows int64
+	updateSeq string
+}
+
+var _ driver.Rows = &keyBatchRows{}
+
+// query queries AllDocs for the next batch of keys.
+func (r *keyBatchRows) query() error {
+	opts := make(Options, len(r.opts)+1)
+	for k, v := range r.opts {
+		opts[k] = v
+	}
+	opts["keys"] = r.batches[0]
+	r.batches = r.batches[1:]
+	rows, err := r.db.AllDocs(r.ctx, opts)
+	if err != nil {
+		return err
+	}
+	r.rows = rows
+	return nil
+}
+
+// finish records the metadata of the current batch, and closes it.
+func (r *keyBatchRows) finish() error {
+	if !r.started {
+		r.offset = r.rows.Offset()
+		r.started = true
+	}
+	r.totalRows = r.rows.TotalRows()
+	r.updateSeq = r.rows.UpdateSeq()
+	err := r.rows.Close()
+	r.rows = nil
+	return err
+}
+
+func (r *keyBatchRows) Next(row *driver.Row) error {
+	for {
+		if r.limit == 0 {
+			return io.EOF
+		}
+		if r.rows == nil {
+			if len(r.batches) == 0 {
+				return io.EOF
+			}
+			if err := r.query(); err != nil {
+				return err
+			}
+		}
+		err := r.rows.Next(row)
+		if err == io.EOF {
+			if err := r.finish(); err != nil {
+				return err
+			}
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		if r.skip > 0 {
+			r.skip--
+			continue
+		}
+		if r.limit > 0 {
+			r.limit--
+		}
+		return nil
+	}
+}
+
+func (r *keyBatchRows) Close() error {
+	if r.rows == nil {
+		return nil
+	}
+	return r.finish()
+}
+
+func (r *keyBatchRows) Offset() int64 {
+	if !r.started && r.rows != nil {
+		return r.rows.Offset()
+	}
+	return r.offset
+}
+
+func (r *keyBatchRows) TotalRows() int64 {
+	if r.rows != nil {
+		return r.rows.TotalRows()
+	}
+	return r.totalRows
+}
+
+func (r *keyBatchRows) UpdateSeq() string {
+	if r.rows != nil {
+		return r.rows.UpdateSeq()
+	}
+	return r.updateSeq
+}
@@ -0,0 +1,132 @@
+package kivik
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"testing"
+
+	"github.com/flimzy/diff"
+	"github.com/flimzy/kivik/driver"
+)
+
+// keysDB returns a row for each of the keys requested from AllDocs, and
+// records each batch of keys.
+type keysDB struct {
+	driver.DB
+	batches [][]string
+}
+
+func (db *keysDB) AllDocs(_ context.Context, opts map[string]interface{}) (driver.Rows, error) {
+	keys, _ := opts["keys"].([]string)
+	db.batches = append(db.batches, keys)
+	return &keysRows{keys: keys}, nil
+}
+
+type keysRows struct {
+	driver.Rows
+	keys []string
+}
+
+func (r *keysRows) Next(row *driver.Row) error {
+	if len(r.keys) == 0 {
+		return io.EOF
+	}
+	row.ID = r.keys[0]
+	row.Key = json.RawMessage(`"` + r.keys[0] + `"`)
+	r.keys = r.keys[1:]
+	return nil
+}
+
+func (r *keysRows) Close() error      { return nil }
+func (r *keysRows) Offset() int64     { return 0 }
+func (r *keysRows) TotalRows() int64  { return 100 }
+func (r *keysRows) UpdateSeq() string { return "" }
+
+type keysDriver struct {
+	db *keysDB
+}
+
+func (d *keysDriver) NewClient(_ context.Context, _ string) (driver.Client, error) {
+	return &keysClient{db: d.db}, nil
+}
+
+type keysClient struct {
+	driver.Client
+	db *keysDB
+}
+
+func (c *keysClient) DB(_ context.Context, _ string, _ map[string]interface{}) (driver.DB, error) {
+	return c.db, nil
+}
+
+func TestAllDocsByKeys(t *testing.T) {
+	keys := []string{"a", "b", "c", "d", "e"}
+	tests := []struct {
+		name     string
+		keys     []string
+		options  Options
+		batches  [][]string
+		expected []string
+	}{
+		{
+			name:     "OneBatch",
+			keys:     keys,
+			batches:  [][]string{keys},
+			expected: keys,
+		},
+		{
+			name:     "Split",
+			keys:     keys,
+			options:  KeysBatchSize(2),
+			batches:  [][]string{{"a", "b"}, {"c", "d"}, {"e"}},
+			expected: keys,
+		},
+		{
+			name:     "SkipAndLimit",
+			keys:     keys,
+			options:  Options{keysBatchSizeOption: 2, "skip": 1, "limit": 3},
+			batches:  [][]string{{"a", "b"}, {"c", "d"}},
+			expected: []string{"b", "c", "d"},
+		},
+		{
+			name:     "NoKeys",
+			keys:     []string{},
+			batches:  [][]string{{}},
+			expected: []string{},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			driverDB := &keysDB{}
+			client, err := NewClientFromDriver(context.Background(), &keysDriver{db: driverDB}, "")
+			if err != nil {
+				t.Fatal(err)
+			}
+			db, err := client.DB(context.Background(), "foo")
+			if err != nil {
+				t.Fatal(err)
+			}
+			rows, err := db.AllDocsByKeys(context.Background(), test.keys, test.options)
+			if err != nil {
+				t.Fatal(err)
+			}
+			ids := []string{}
+			for rows.Next() {
+				ids = append(ids, rows.ID())
+			}
+			if err := rows.Err(); err != nil {
+				t.Fatal(err)
+			}
+			if d := diff.Interface(test.expected, ids); d != "" {
+				t.Errorf("Rows:\n%s", d)
+			}
+			if d := diff.Interface(test.batches, driverDB.batches); d != "" {
+				t.Errorf("Batches:\n%s", d)
+			}
+			if total := rows.TotalRows(); total != 100 {
+				t.Errorf("Expected 100 total rows, got %d", total)
+			}
+		})
+	}
+}
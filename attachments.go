@@ -2,7 +2,15 @@ package kivik
 
 import (
 	"bytes"
+	"crypto/md5"
+	"encoding/base64"
+	"encoding/json"
+	"hash"
 	"io"
+	"net/http"
+	"strings"
+
+	"github.com/flimzy/kivik/errors"
 )
 
 // MD5sum is a 128-bit MD5 checksum.
@@ -14,6 +22,9 @@ type Attachment struct {
 	Filename    string
 	ContentType string
 	MD5         [16]byte
+	// Length is the size of the content, in bytes, or 0 if unknown. It is
+	// sent by PutMultipart, if set.
+	Length int64
 }
 
 // bufCloser wraps a *bytes.Buffer to create an io.ReadCloser
@@ -47,3 +58,130 @@ func NewAttachment(filename, contentType string, body io.ReadCloser) *Attachment
 		ContentType: contentType,
 	}
 }
+
+// detectContentType detects the content type of the content of r, and returns
+// it with a reader of the full content.
+func detectContentType(r io.Reader) (string, io.Reader, error) {
+	head := make([]byte, 512)
+	n, err := io.ReadFull(r, head)
+	if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+		return "", nil, err
+	}
+	head = head[:n]
+	return http.DetectContentType(head), io.MultiReader(bytes.NewReader(head), r), nil
+}
+
+// VerifyMD5 wraps the attachment's content, so that once it has been read to
+// the end, the MD5 digest of the content is compared with MD5, and an error
+// with status StatusBadResponse is returned by Read in place of io.EOF if they
+// differ. VerifyMD5 does nothing if MD5 is unset, as when the driver does not
+// report digests.
+func (a *Attachment) VerifyMD5() {
+	if a.MD5 == ([16]byte{}) {
+		return
+	}
+	a.ReadCloser = &md5Verifier{
+		ReadCloser: a.ReadCloser,
+		hash:       md5.New(),
+		expected:   a.MD5,
+	}
+}
+
+type md5Verifier struct {
+	io.ReadCloser
+	hash     hash.Hash
+	expected [16]byte
+}
+
+var _ io.ReadCloser = &md5Verifier{}
+
+func (v *md5Verifier) Read(p []byte) (int, error) {
+	n, err := v.ReadCloser.Read(p)
+	_, _ = v.hash.Write(p[:n])
+	if err == io.EOF {
+		var sum [16]byte
+		copy(sum[:], v.hash.Sum(nil))
+		if sum != v.expected {
+			return n, errors.Statusf(StatusBadResponse, "kivik: attachment MD5 digest mismatch: expected %x, got %x", v.expected, sum)
+		}
+	}
+	return n, err
+}
+
+// Attachments is a document's _attachments field, keyed by filename, with the
+// content of each attachment read from or written to the inline base64 form.
+// It may be used in place of AttachmentStubs, for small attachments which
+// are saved and fetched along with the document, without separate requests:
+//
+//	type Photo struct {
+//	    kivik.Document
+//	    Attachments kivik.Attachments `json:"_attachments,omitempty"`
+//	}
+//
+// When marshaled, the content of each attachment is read in full. An
+// Attachment with a nil ReadCloser is marshaled as a stub, which keeps the
+// existing attachment of the same name. When unmarshaled, stubs, as returned
+// when the document is fetched without the attachments option, have a nil
+// ReadCloser.
+type Attachments map[string]*Attachment
+
+var _ json.Marshaler = Attachments{}
+var _ json.Unmarshaler = &Attachments{}
+
+// MarshalJSON satisfies the json.Marshaler interface.
+func (a Attachments) MarshalJSON() ([]byte, error) {
+	stubs := make(AttachmentStubs, len(a))
+	for filename, att := range a {
+		if att.ReadCloser == nil {
+			stubs[filename] = AttachmentStub{ContentType: att.ContentType, Stub: true}
+			continue
+		}
+		data, err := att.Bytes()
+		if err != nil {
+			return nil, err
+		}
+		contentType := att.ContentType
+		if contentType == "" {
+			contentType = http.DetectContentType(data)
+		}
+		stubs[filename] = AttachmentStub{ContentType: contentType, Data: data}
+	}
+	return json.Marshal(stubs)
+}
+
+// UnmarshalJSON satisfies the json.Unmarshaler interface.
+func (a *Attachments) UnmarshalJSON(data []byte) error {
+	var stubs AttachmentStubs
+	if err := json.Unmarshal(data, &stubs); err != nil {
+		return err
+	}
+	atts := make(Attachments, len(stubs))
+	for filename, stub := range stubs {
+		att := &Attachment{
+			Filename:    filename,
+			ContentType: stub.ContentType,
+			MD5:         digestMD5(stub.Digest),
+		}
+		if !stub.Stub {
+			att.ReadCloser = &bufCloser{bytes.NewBuffer(stub.Data)}
+		}
+		atts[filename] = att
+	}
+	*a = atts
+	return nil
+}
+
+// digestMD5 returns the MD5 sum of an attachment digest of the form
+// md5-<base64>, or the zero value for other digests.
+func digestMD5(digest string) [16]byte {
+	var sum [16]byte
+	if !strings.HasPrefix(digest, "md5-") {
+		return sum
+	}
+	decoded, err := base64.StdEncoding.DecodeString(strings.TrimPrefix(digest, "md5-"))
+	if err != nil || len(decoded) != len(sum) {
+		return sum
+	}
+	copy(sum[:], decoded)
+	return sum
+}
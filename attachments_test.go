@@ -1,9 +1,15 @@
 package kivik
 
 import (
+	"context"
+	"crypto/md5"
+	"encoding/json"
+	"io"
 	"io/ioutil"
 	"strings"
 	"testing"
+
+	"github.com/flimzy/diff"
 )
 
 func TestAttachmentBytes(t *testing.T) {
@@ -25,3 +31,184 @@ func TestAttachmentBytes(t *testing.T) {
 		t.Errorf("Second read unexpected.\nExpected: %s\n  Actual: %s\n", content, result2)
 	}
 }
+
+type attGrabber struct {
+	dummyDB
+	contentType string
+	content     string
+}
+
+func (db *attGrabber) PutAttachment(_ context.Context, _, _, _, contentType string, body io.Reader) (string, error) {
+	content, err := ioutil.ReadAll(body)
+	db.contentType = contentType
+	db.content = string(content)
+	return "2-x", err
+}
+
+func TestPutAttachmentDetectContentType(t *testing.T) {
+	tests := []struct {
+		name        string
+		contentType string
+		content     string
+		expected    string
+	}{
+		{name: "Explicit", contentType: "application/x-foo", content: "foo", expected: "application/x-foo"},
+		{name: "Text", content: "plain text", expected: "text/plain; charset=utf-8"},
+		{name: "HTML", content: "<html><body>hi</body></html>", expected: "text/html; charset=utf-8"},
+		{name: "PNG", content: "\x89PNG\x0D\x0A\x1A\x0A" + strings.Repeat("x", 1000), expected: "image/png"},
+		{name: "Empty", content: "", expected: "text/plain; charset=utf-8"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			driverDB := &attGrabber{}
+			db := &DB{driverDB: driverDB}
+			att := NewAttachment("file", test.contentType, ioutil.NopCloser(strings.NewReader(test.content)))
+			if _, err := db.PutAttachment(context.Background(), "doc", "1-x", att); err != nil {
+				t.Fatal(err)
+			}
+			if driverDB.contentType != test.expected {
+				t.Errorf("Expected content type %s, got %s", test.expected, driverDB.contentType)
+			}
+			if driverDB.content != test.content {
+				t.Errorf("Content was altered")
+			}
+		})
+	}
+}
+
+func TestAttachmentVerifyMD5(t *testing.T) {
+	content := "test content"
+	sum := md5.Sum([]byte(content))
+	tests := []struct {
+		name   string
+		md5    [16]byte
+		status int
+	}{
+		{name: "Match", md5: sum},
+		{name: "Unset"},
+		{name: "Mismatch", md5: md5.Sum([]byte("other")), status: StatusBadResponse},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			att := NewAttachment("test.txt", "text/plain", ioutil.NopCloser(strings.NewReader(content)))
+			att.MD5 = test.md5
+			att.VerifyMD5()
+			result, err := att.Bytes()
+			if status := StatusCode(err); status != test.status {
+				t.Fatalf("Expected status %d, got %d (%v)", test.status, status, err)
+			}
+			if err == nil && string(result) != content {
+				t.Errorf("Unexpected content: %s", result)
+			}
+		})
+	}
+}
+
+func TestAttachmentsJSON(t *testing.T) {
+	type doc struct {
+		ID          string      `json:"_id"`
+		Attachments Attachments `json:"_attachments"`
+	}
+	in := doc{
+		ID: "foo",
+		Attachments: Attachments{
+			"a.txt": NewAttachment("a.txt", "text/plain", ioutil.NopCloser(strings.NewReader("hello"))),
+			"b.bin": NewAttachment("b.bin", "", ioutil.NopCloser(strings.NewReader("<html></html>"))),
+			"c.jpg": {ContentType: "image/jpeg"},
+		},
+	}
+	body, err := json.Marshal(in)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := `{"_id":"foo","_attachments":{` +
+		`"a.txt":{"content_type":"text/plain","data":"aGVsbG8="},` +
+		`"b.bin":{"content_type":"text/html; charset=utf-8","data":"PGh0bWw+PC9odG1sPg=="},` +
+		`"c.jpg":{"content_type":"image/jpeg","stub":true}}}`
+	if d := diff.JSON([]byte(expected), body); d != "" {
+		t.Error(d)
+	}
+
+	var out doc
+	if err := json.Unmarshal([]byte(`{"_id":"foo","_attachments":{`+
+		`"a.txt":{"content_type":"text/plain","digest":"md5-XUFAKrxLKna5cZ2REBfFkg==","data":"aGVsbG8="},`+
+		`"c.jpg":{"content_type":"image/jpeg","digest":"md5-AAAA","length":100,"stub":true}}}`), &out); err != nil {
+		t.Fatal(err)
+	}
+	a := out.Attachments["a.txt"]
+	if a.Filename != "a.txt" || a.ContentType != "text/plain" {
+		t.Errorf("Unexpected attachment: %+v", a)
+	}
+	if a.MD5 != md5.Sum([]byte("hello")) {
+		t.Errorf("Unexpected MD5: %x", a.MD5)
+	}
+	a.VerifyMD5()
+	content, err := a.Bytes()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(content) != "hello" {
+		t.Errorf("Unexpected content: %s", content)
+	}
+	if c := out.Attachments["c.jpg"]; c.ReadCloser != nil || c.MD5 != ([16]byte{}) {
+		t.Errorf("Expected a stub without MD5, got %+v", c)
+	}
+}
+
+type stubsDB struct {
+	dummyDB
+	opts map[string]interface{}
+}
+
+func (db *stubsDB) Get(_ context.Context, docID string, opts map[string]interface{}) (json.RawMessage, error) {
+	db.opts = opts
+	if docID == "bare" {
+		return json.RawMessage(`{"_id":"bare","_rev":"1-xxx"}`), nil
+	}
+	return json.RawMessage(`{"_id":"foo","_rev":"2-xxx","_attachments":{` +
+		`"a.txt":{"content_type":"text/plain","digest":"md5-XUFAKrxLKna5cZ2REBfFkg==","length":5,"revpos":2,"stub":true}}}`), nil
+}
+
+func TestDBAttachments(t *testing.T) {
+	tests := []struct {
+		name     string
+		docID    string
+		rev      string
+		opts     map[string]interface{}
+		expected AttachmentStubs
+	}{
+		{
+			name:  "Current",
+			docID: "foo",
+			expected: AttachmentStubs{
+				"a.txt": {ContentType: "text/plain", Digest: "md5-XUFAKrxLKna5cZ2REBfFkg==", Length: 5, RevPos: 2, Stub: true},
+			},
+		},
+		{
+			name:  "Rev",
+			docID: "foo",
+			rev:   "2-xxx",
+			opts:  map[string]interface{}{"rev": "2-xxx"},
+			expected: AttachmentStubs{
+				"a.txt": {ContentType: "text/plain", Digest: "md5-XUFAKrxLKna5cZ2REBfFkg==", Length: 5, RevPos: 2, Stub: true},
+			},
+		},
+		{name: "NoAttachments", docID: "bare", expected: AttachmentStubs{}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			driverDB := &stubsDB{}
+			db := &DB{driverDB: driverDB}
+			stubs, err := db.Attachments(context.Background(), test.docID, test.rev)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if d := diff.Interface(test.expected, stubs); d != "" {
+				t.Error(d)
+			}
+			if d := diff.Interface(test.opts, driverDB.opts); d != "" {
+				t.Errorf("Unexpected options:\n%s", d)
+			}
+		})
+	}
+}
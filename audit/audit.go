@@ -0,0 +1,204 @@
+// Package audit provides a Kivik driver which wraps another driver, and
+// records every successful operation which modifies data, with the user who
+// performed it, the time, and the fields of the document which changed, as a
+// document in an audit database.
+//
+//	audit.Register("couch-audited", "couch", audit.Options{AuditDB: "audit"})
+//	client, err := kivik.New(context.TODO(), "couch-audited", "http://localhost:5984/")
+//
+// The user is read from the context of each operation, with
+// authdb.FromContext, as set by the serve package for each request. To
+// compute the changes, the current version of each document is read before
+// it is written, which adds a read to every write.
+//
+// The audit database must exist, and is written with the same client as the
+// audited databases. Writes to the audit database itself are not audited.
+package audit
+
+import (
+	"context"
+	"encoding/json"
+	"reflect"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/flimzy/kivik"
+	"github.com/flimzy/kivik/authdb"
+	"github.com/flimzy/kivik/driver"
+	"github.com/flimzy/kivik/errors"
+)
+
+// DefaultAuditDB is the name of the audit database, if none is given in
+// Options.
+const DefaultAuditDB = "audit"
+
+// Options configures an auditing driver.
+type Options struct {
+	// AuditDB is the name of the database in which audit entries are
+	// written. The default is DefaultAuditDB.
+	AuditDB string
+	// Databases, if not empty, limits auditing to the named databases.
+	// Otherwise, writes to all databases, other than AuditDB, are audited.
+	Databases []string
+	// OnError, if set, is called when an audit entry cannot be written, and
+	// the tracked operation returns normally. If OnError is nil, the error is
+	// returned by the operation, although the operation itself succeeded.
+	OnError func(Entry, error)
+}
+
+// Entry is an audit record, as stored in the audit database.
+type Entry struct {
+	Time time.Time `json:"time"`
+	// User and Roles identify the user who performed the operation, if known.
+	User  string   `json:"user,omitempty"`
+	Roles []string `json:"roles,omitempty"`
+	// Op is the name of the driver method, such as "Put" or "DestroyDB".
+	Op string `json:"op"`
+	// DB is the name of the database, or empty for server-level operations,
+	// such as configuration changes.
+	DB    string `json:"db,omitempty"`
+	DocID string `json:"doc_id,omitempty"`
+	// Rev is the revision created by the operation, if any.
+	Rev string `json:"rev,omitempty"`
+	// Changes lists the fields of the document which were added, modified or
+	// removed.
+	Changes []Change `json:"changes,omitempty"`
+	// Detail holds any other information about the operation, such as the
+	// name of an attachment, or a configuration key.
+	Detail string `json:"detail,omitempty"`
+}
+
+// Change describes a single modified field of a document.
+type Change struct {
+	// Path is the JSON Pointer to the field, such as "/address/city".
+	Path string `json:"path"`
+	// Old is the previous value, or nil if the field was added.
+	Old interface{} `json:"old,omitempty"`
+	// New is the new value, or nil if the field was removed.
+	New interface{} `json:"new,omitempty"`
+}
+
+type auditDriver struct {
+	drv  driver.Driver
+	opts Options
+}
+
+var _ driver.Driver = &auditDriver{}
+
+// New returns a driver which wraps drv, to audit writes.
+func New(drv driver.Driver, opts Options) driver.Driver {
+	if opts.AuditDB == "" {
+		opts.AuditDB = DefaultAuditDB
+	}
+	return &auditDriver{drv: drv, opts: opts}
+}
+
+// Register registers an auditing version of the driver registered as
+// wrapped, under the new name name.
+func Register(name, wrapped string, opts Options) error {
+	drv, ok := kivik.LookupDriver(wrapped)
+	if !ok {
+		return errors.Statusf(kivik.StatusBadRequest, "audit: unknown driver %q (forgotten import?)", wrapped)
+	}
+	kivik.Register(name, New(drv, opts))
+	return nil
+}
+
+func (d *auditDriver) NewClient(ctx context.Context, dsn string) (driver.Client, error) {
+	c, err := d.drv.NewClient(ctx, dsn)
+	if err != nil {
+		return nil, err
+	}
+	return &client{client: c, opts: d.opts}, nil
+}
+
+// audited returns true if writes to dbName are audited.
+func (o Options) audited(dbName string) bool {
+	if dbName == o.AuditDB {
+		return false
+	}
+	if len(o.Databases) == 0 {
+		return true
+	}
+	for _, name := range o.Databases {
+		if name == dbName {
+			return true
+		}
+	}
+	return false
+}
+
+// record writes entry to the audit database, with the time and the user from
+// ctx.
+func (c *client) record(ctx context.Context, entry Entry) error {
+	entry.Time = time.Now().UTC()
+	if user, ok := authdb.FromContext(ctx); ok {
+		entry.User = user.Name
+		entry.Roles = user.Roles
+	}
+	err := c.write(ctx, entry)
+	if err != nil && c.opts.OnError != nil {
+		c.opts.OnError(entry, err)
+		return nil
+	}
+	return err
+}
+
+func (c *client) write(ctx context.Context, entry Entry) error {
+	auditDB, err := c.client.DB(ctx, c.opts.AuditDB, nil)
+	if err != nil {
+		return err
+	}
+	_, _, err = auditDB.CreateDoc(ctx, entry)
+	return err
+}
+
+// toMap converts a document, as passed to a driver, to a map of the values
+// decoded from its JSON, so that it may be compared with a stored document.
+func toMap(doc interface{}) (map[string]interface{}, error) {
+	body, err := kivik.JSON().Marshal(doc)
+	if err != nil {
+		return nil, err
+	}
+	var m map[string]interface{}
+	err = json.Unmarshal(body, &m)
+	return m, err
+}
+
+// diffDocs returns the changes between the documents old and new, either of
+// which may be nil. The special fields _id, _rev and _revisions are ignored.
+func diffDocs(old, new map[string]interface{}) []Change {
+	var changes []Change
+	diffMaps("", old, new, &changes)
+	return changes
+}
+
+func diffMaps(path string, old, new map[string]interface{}, changes *[]Change) {
+	names := make([]string, 0, len(old)+len(new))
+	for name := range old {
+		names = append(names, name)
+	}
+	for name := range new {
+		if _, ok := old[name]; !ok {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		if path == "" && (name == "_id" || name == "_rev" || name == "_revisions") {
+			continue
+		}
+		fieldPath := path + "/" + strings.Replace(strings.Replace(name, "~", "~0", -1), "/", "~1", -1)
+		oldValue, newValue := old[name], new[name]
+		oldMap, oldIsMap := oldValue.(map[string]interface{})
+		newMap, newIsMap := newValue.(map[string]interface{})
+		if oldIsMap && newIsMap {
+			diffMaps(fieldPath, oldMap, newMap, changes)
+			continue
+		}
+		if !reflect.DeepEqual(oldValue, newValue) {
+			*changes = append(*changes, Change{Path: fieldPath, Old: oldValue, New: newValue})
+		}
+	}
+}
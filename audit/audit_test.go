@@ -0,0 +1,201 @@
+package audit
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/flimzy/diff"
+	"github.com/flimzy/kivik"
+	"github.com/flimzy/kivik/authdb"
+	"github.com/flimzy/kivik/driver"
+	_ "github.com/flimzy/kivik/driver/memory"
+	"github.com/flimzy/kivik/kiviktest"
+)
+
+func newTestClient(t *testing.T, opts Options) *kivik.Client {
+	memDriver, _ := kivik.LookupDriver("memory")
+	client := kiviktest.NewClient(t, New(memDriver, opts), "")
+	for _, name := range []string{DefaultAuditDB, "foo", "bar"} {
+		if err := client.CreateDB(context.Background(), name); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return client
+}
+
+// entries returns the audit entries, in the order written, with their times
+// cleared.
+func entries(t *testing.T, client *kivik.Client) []Entry {
+	db, err := client.DB(context.Background(), DefaultAuditDB)
+	if err != nil {
+		t.Fatal(err)
+	}
+	changes, err := db.Changes(context.Background(), kivik.Options{"include_docs": true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var result []Entry
+	for changes.Next() {
+		var entry Entry
+		if err := changes.ScanDoc(&entry); err != nil {
+			t.Fatal(err)
+		}
+		if entry.Time.IsZero() {
+			t.Errorf("No time recorded for %s", entry.Op)
+		}
+		entry.Time = time.Time{}
+		result = append(result, entry)
+	}
+	if err := changes.Err(); err != nil {
+		t.Fatal(err)
+	}
+	return result
+}
+
+func TestAudit(t *testing.T) {
+	client := newTestClient(t, Options{})
+	ctx := authdb.NewContext(context.Background(), &authdb.UserContext{Name: "bob", Roles: []string{"editor"}})
+	db, err := client.DB(ctx, "foo")
+	if err != nil {
+		t.Fatal(err)
+	}
+	rev, err := db.Put(ctx, "doc", map[string]interface{}{
+		"name":    "Bob",
+		"address": map[string]interface{}{"city": "Paris", "zip": "75001"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	rev, err = db.Put(ctx, "doc", map[string]interface{}{
+		"_rev":    rev,
+		"name":    "Bob",
+		"age":     42,
+		"address": map[string]interface{}{"city": "Lyon", "zip": "75001"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = db.Delete(ctx, "doc", rev); err != nil {
+		t.Fatal(err)
+	}
+	got := entries(t, client)
+	for i := range got {
+		got[i].Rev = ""
+	}
+	expected := []Entry{
+		{Op: "CreateDB", DB: "foo"},
+		{Op: "CreateDB", DB: "bar"},
+		{User: "bob", Roles: []string{"editor"}, Op: "Put", DB: "foo", DocID: "doc", Changes: []Change{
+			{Path: "/address", New: map[string]interface{}{"city": "Paris", "zip": "75001"}},
+			{Path: "/name", New: "Bob"},
+		}},
+		{User: "bob", Roles: []string{"editor"}, Op: "Put", DB: "foo", DocID: "doc", Changes: []Change{
+			{Path: "/address/city", Old: "Paris", New: "Lyon"},
+			{Path: "/age", New: float64(42)},
+		}},
+		{User: "bob", Roles: []string{"editor"}, Op: "Delete", DB: "foo", DocID: "doc", Changes: []Change{
+			{Path: "/address", Old: map[string]interface{}{"city": "Lyon", "zip": "75001"}},
+			{Path: "/age", Old: float64(42)},
+			{Path: "/name", Old: "Bob"},
+		}},
+	}
+	if d := diff.AsJSON(expected, got); d != "" {
+		t.Error(d)
+	}
+}
+
+func TestDatabases(t *testing.T) {
+	client := newTestClient(t, Options{Databases: []string{"bar"}})
+	ctx := context.Background()
+	for _, name := range []string{"foo", "bar"} {
+		db, err := client.DB(ctx, name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := db.Put(ctx, "doc", map[string]interface{}{"x": 1}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	expected := []Entry{
+		{Op: "CreateDB", DB: "bar"},
+		{Op: "Put", DB: "bar", DocID: "doc", Changes: []Change{{Path: "/x", New: float64(1)}}},
+	}
+	got := entries(t, client)
+	for i := range got {
+		got[i].Rev = ""
+	}
+	if d := diff.AsJSON(expected, got); d != "" {
+		t.Error(d)
+	}
+}
+
+func TestOnError(t *testing.T) {
+	var failed []Entry
+	memDriver, _ := kivik.LookupDriver("memory")
+	client := kiviktest.NewClient(t, New(memDriver, Options{
+		AuditDB: "missing",
+		OnError: func(entry Entry, err error) {
+			failed = append(failed, entry)
+		},
+	}), "")
+	if err := client.CreateDB(context.Background(), "foo"); err != nil {
+		t.Errorf("Expected the audit error to be handled, got %s", err)
+	}
+	if len(failed) != 1 || failed[0].Op != "CreateDB" {
+		t.Errorf("Unexpected failed entries: %v", failed)
+	}
+}
+
+func TestDiff(t *testing.T) {
+	tests := []struct {
+		name     string
+		old, new map[string]interface{}
+		expected []Change
+	}{
+		{
+			name: "SpecialFields",
+			old:  map[string]interface{}{"_id": "foo", "_rev": "1-xxx"},
+			new:  map[string]interface{}{"_id": "foo", "_rev": "2-xxx"},
+		},
+		{
+			name:     "EscapedPath",
+			new:      map[string]interface{}{"a/b": map[string]interface{}{"c~d": true}},
+			expected: []Change{{Path: "/a~1b", New: map[string]interface{}{"c~d": true}}},
+		},
+		{
+			name:     "Array",
+			old:      map[string]interface{}{"tags": []interface{}{"a"}},
+			new:      map[string]interface{}{"tags": []interface{}{"a", "b"}},
+			expected: []Change{{Path: "/tags", Old: []interface{}{"a"}, New: []interface{}{"a", "b"}}},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if d := diff.Interface(test.expected, diffDocs(test.old, test.new)); d != "" {
+				t.Error(d)
+			}
+		})
+	}
+}
+
+// designInfoDB reports the status of any design document's index.
+type designInfoDB struct {
+	driver.DB
+}
+
+func (d *designInfoDB) DesignInfo(_ context.Context, ddoc string) (*driver.DesignInfo, error) {
+	return &driver.DesignInfo{Name: ddoc}, nil
+}
+
+func TestDesignInfo(t *testing.T) {
+	// DesignInfo is not recorded, so the DB is not attached to a client.
+	d := &db{db: &designInfoDB{}, name: "foo"}
+	info, err := d.DesignInfo(context.Background(), "bar")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Name != "bar" {
+		t.Errorf("Unexpected name: %s", info.Name)
+	}
+}
@@ -0,0 +1,243 @@
+package audit
+
+import (
+	"context"
+
+	"github.com/flimzy/kivik"
+	"github.com/flimzy/kivik/driver"
+	"github.com/flimzy/kivik/errors"
+)
+
+type client struct {
+	client driver.Client
+	opts   Options
+}
+
+var _ driver.Client = &client{}
+var _ driver.ClientReplicator = &client{}
+var _ driver.Authenticator = &client{}
+var _ driver.DBUpdater = &client{}
+var _ driver.PoolStatser = &client{}
+var _ driver.AdminPartyChecker = &client{}
+var _ driver.DiskUsager = &client{}
+var _ driver.Configer = &client{}
+var _ driver.Clusterer = &client{}
+var _ driver.OptionValidator = &client{}
+
+func notImplemented(iface string) error {
+	return errors.Statusf(kivik.StatusNotImplemented, "kivik: driver does not implement %s", iface)
+}
+
+func (c *client) Version(ctx context.Context) (*driver.Version, error) {
+	return c.client.Version(ctx)
+}
+
+func (c *client) AllDBs(ctx context.Context, opts map[string]interface{}) ([]string, error) {
+	return c.client.AllDBs(ctx, opts)
+}
+
+func (c *client) DBExists(ctx context.Context, dbName string, opts map[string]interface{}) (bool, error) {
+	return c.client.DBExists(ctx, dbName, opts)
+}
+
+func (c *client) CreateDB(ctx context.Context, dbName string, opts map[string]interface{}) error {
+	if err := c.client.CreateDB(ctx, dbName, opts); err != nil {
+		return err
+	}
+	if !c.opts.audited(dbName) {
+		return nil
+	}
+	return c.record(ctx, Entry{Op: "CreateDB", DB: dbName})
+}
+
+func (c *client) DestroyDB(ctx context.Context, dbName string, opts map[string]interface{}) error {
+	if err := c.client.DestroyDB(ctx, dbName, opts); err != nil {
+		return err
+	}
+	if !c.opts.audited(dbName) {
+		return nil
+	}
+	return c.record(ctx, Entry{Op: "DestroyDB", DB: dbName})
+}
+
+func (c *client) DB(ctx context.Context, dbName string, opts map[string]interface{}) (driver.DB, error) {
+	d, err := c.client.DB(ctx, dbName, opts)
+	if err != nil {
+		return nil, err
+	}
+	if !c.opts.audited(dbName) {
+		return d, nil
+	}
+	return &db{db: d, client: c, name: dbName}, nil
+}
+
+func (c *client) Replicate(ctx context.Context, targetDSN, sourceDSN string, opts map[string]interface{}) (driver.Replication, error) {
+	r, ok := c.client.(driver.ClientReplicator)
+	if !ok {
+		return nil, notImplemented("ClientReplicator")
+	}
+	rep, err := r.Replicate(ctx, targetDSN, sourceDSN, opts)
+	if err != nil {
+		return nil, err
+	}
+	return rep, c.record(ctx, Entry{Op: "Replicate", Detail: redact(sourceDSN) + " -> " + redact(targetDSN)})
+}
+
+// redact removes any password from dsn, so that it is not stored in the audit
+// database.
+func redact(dsn string) string {
+	parsed, err := kivik.ParseDSN(dsn)
+	if err != nil {
+		return dsn
+	}
+	return parsed.Redacted()
+}
+
+func (c *client) GetReplications(ctx context.Context, opts map[string]interface{}) ([]driver.Replication, error) {
+	r, ok := c.client.(driver.ClientReplicator)
+	if !ok {
+		return nil, notImplemented("ClientReplicator")
+	}
+	return r.GetReplications(ctx, opts)
+}
+
+func (c *client) Authenticate(ctx context.Context, authenticator interface{}) error {
+	a, ok := c.client.(driver.Authenticator)
+	if !ok {
+		return notImplemented("Authenticator")
+	}
+	return a.Authenticate(ctx, authenticator)
+}
+
+func (c *client) DBUpdates() (driver.DBUpdates, error) {
+	u, ok := c.client.(driver.DBUpdater)
+	if !ok {
+		return nil, notImplemented("DBUpdater")
+	}
+	return u.DBUpdates()
+}
+
+func (c *client) PoolStats() (driver.PoolStats, error) {
+	s, ok := c.client.(driver.PoolStatser)
+	if !ok {
+		return driver.PoolStats{}, notImplemented("PoolStatser")
+	}
+	return s.PoolStats()
+}
+
+func (c *client) AdminParty(ctx context.Context) (bool, error) {
+	a, ok := c.client.(driver.AdminPartyChecker)
+	if !ok {
+		return false, notImplemented("AdminPartyChecker")
+	}
+	return a.AdminParty(ctx)
+}
+
+func (c *client) DiskUsage(ctx context.Context) (*driver.DiskUsage, error) {
+	u, ok := c.client.(driver.DiskUsager)
+	if !ok {
+		return nil, notImplemented("DiskUsager")
+	}
+	return u.DiskUsage(ctx)
+}
+
+func (c *client) configer() (driver.Configer, error) {
+	if configer, ok := c.client.(driver.Configer); ok {
+		return configer, nil
+	}
+	return nil, notImplemented("Configer")
+}
+
+func (c *client) Config(ctx context.Context, node string) (driver.Config, error) {
+	configer, err := c.configer()
+	if err != nil {
+		return nil, err
+	}
+	return configer.Config(ctx, node)
+}
+
+func (c *client) ConfigSection(ctx context.Context, node, section string) (driver.ConfigSection, error) {
+	configer, err := c.configer()
+	if err != nil {
+		return nil, err
+	}
+	return configer.ConfigSection(ctx, node, section)
+}
+
+func (c *client) ConfigValue(ctx context.Context, node, section, key string) (string, error) {
+	configer, err := c.configer()
+	if err != nil {
+		return "", err
+	}
+	return configer.ConfigValue(ctx, node, section, key)
+}
+
+// SetConfigValue records the key which was set, but not the values, which
+// may be secrets.
+func (c *client) SetConfigValue(ctx context.Context, node, section, key, value string) (string, error) {
+	configer, err := c.configer()
+	if err != nil {
+		return "", err
+	}
+	old, err := configer.SetConfigValue(ctx, node, section, key, value)
+	if err != nil {
+		return "", err
+	}
+	return old, c.record(ctx, Entry{Op: "SetConfigValue", Detail: node + "/" + section + "/" + key})
+}
+
+func (c *client) DeleteConfigKey(ctx context.Context, node, section, key string) (string, error) {
+	configer, err := c.configer()
+	if err != nil {
+		return "", err
+	}
+	old, err := configer.DeleteConfigKey(ctx, node, section, key)
+	if err != nil {
+		return "", err
+	}
+	return old, c.record(ctx, Entry{Op: "DeleteConfigKey", Detail: node + "/" + section + "/" + key})
+}
+
+func (c *client) clusterer() (driver.Clusterer, error) {
+	if clusterer, ok := c.client.(driver.Clusterer); ok {
+		return clusterer, nil
+	}
+	return nil, notImplemented("Clusterer")
+}
+
+func (c *client) Membership(ctx context.Context) (*driver.Membership, error) {
+	clusterer, err := c.clusterer()
+	if err != nil {
+		return nil, err
+	}
+	return clusterer.Membership(ctx)
+}
+
+func (c *client) AddNode(ctx context.Context, node string) error {
+	clusterer, err := c.clusterer()
+	if err != nil {
+		return err
+	}
+	if err := clusterer.AddNode(ctx, node); err != nil {
+		return err
+	}
+	return c.record(ctx, Entry{Op: "AddNode", Detail: node})
+}
+
+func (c *client) RemoveNode(ctx context.Context, node string) error {
+	clusterer, err := c.clusterer()
+	if err != nil {
+		return err
+	}
+	if err := clusterer.RemoveNode(ctx, node); err != nil {
+		return err
+	}
+	return c.record(ctx, Entry{Op: "RemoveNode", Detail: node})
+}
+
+func (c *client) SupportedOptions(method string) (map[string]driver.OptionType, bool) {
+	if v, ok := c.client.(driver.OptionValidator); ok {
+		return v.SupportedOptions(method)
+	}
+	return nil, false
+}
@@ -0,0 +1,443 @@
+package audit
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+
+	"github.com/flimzy/kivik/driver"
+)
+
+type db struct {
+	db     driver.DB
+	client *client
+	name   string
+}
+
+var _ driver.DB = &db{}
+var _ driver.Finder = &db{}
+var _ driver.Explainer = &db{}
+var _ driver.AttachmentMetaer = &db{}
+var _ driver.AttachmentCombiner = &db{}
+var _ driver.Rever = &db{}
+var _ driver.DBFlusher = &db{}
+var _ driver.Copier = &db{}
+var _ driver.OptsBulkDocer = &db{}
+var _ driver.OptsPutter = &db{}
+var _ driver.OptsDeleter = &db{}
+var _ driver.Quorumer = &db{}
+var _ driver.OpenRevsGetter = &db{}
+var _ driver.OptsDocCreator = &db{}
+var _ driver.BodyGetter = &db{}
+var _ driver.DesignInfoer = &db{}
+var _ driver.MultipartPutter = &db{}
+var _ driver.OptionValidator = &db{}
+
+func (d *db) record(ctx context.Context, entry Entry) error {
+	entry.DB = d.name
+	return d.client.record(ctx, entry)
+}
+
+// current returns the current version of the document, or nil if it does
+// not exist, or cannot be read.
+func (d *db) current(ctx context.Context, docID string) map[string]interface{} {
+	if docID == "" {
+		return nil
+	}
+	body, err := d.db.Get(ctx, docID, nil)
+	if err != nil {
+		return nil
+	}
+	var doc map[string]interface{}
+	if err := json.Unmarshal(body, &doc); err != nil {
+		return nil
+	}
+	return doc
+}
+
+// recordWrite records the write of doc, which replaced old. A doc with
+// _deleted set is recorded as the removal of all of the fields of old.
+func (d *db) recordWrite(ctx context.Context, op, docID, rev string, old map[string]interface{}, doc interface{}) error {
+	var new map[string]interface{}
+	if doc != nil {
+		new, _ = toMap(doc)
+		if deleted, _ := new["_deleted"].(bool); deleted {
+			new = nil
+		}
+	}
+	return d.record(ctx, Entry{
+		Op:      op,
+		DocID:   docID,
+		Rev:     rev,
+		Changes: diffDocs(old, new),
+	})
+}
+
+func (d *db) AllDocs(ctx context.Context, opts map[string]interface{}) (driver.Rows, error) {
+	return d.db.AllDocs(ctx, opts)
+}
+
+func (d *db) Query(ctx context.Context, ddoc, view string, opts map[string]interface{}) (driver.Rows, error) {
+	return d.db.Query(ctx, ddoc, view, opts)
+}
+
+func (d *db) Get(ctx context.Context, docID string, opts map[string]interface{}) (json.RawMessage, error) {
+	return d.db.Get(ctx, docID, opts)
+}
+
+func (d *db) CreateDoc(ctx context.Context, doc interface{}) (string, string, error) {
+	docID, rev, err := d.db.CreateDoc(ctx, doc)
+	if err != nil {
+		return "", "", err
+	}
+	return docID, rev, d.recordWrite(ctx, "CreateDoc", docID, rev, nil, doc)
+}
+
+func (d *db) CreateDocOpts(ctx context.Context, doc interface{}, opts map[string]interface{}) (string, string, error) {
+	c, ok := d.db.(driver.OptsDocCreator)
+	if !ok {
+		return "", "", notImplemented("OptsDocCreator")
+	}
+	docID, rev, err := c.CreateDocOpts(ctx, doc, opts)
+	if err != nil {
+		return "", "", err
+	}
+	return docID, rev, d.recordWrite(ctx, "CreateDoc", docID, rev, nil, doc)
+}
+
+func (d *db) Put(ctx context.Context, docID string, doc interface{}) (string, error) {
+	old := d.current(ctx, docID)
+	rev, err := d.db.Put(ctx, docID, doc)
+	if err != nil {
+		return "", err
+	}
+	return rev, d.recordWrite(ctx, "Put", docID, rev, old, doc)
+}
+
+func (d *db) PutOpts(ctx context.Context, docID string, doc interface{}, opts map[string]interface{}) (string, error) {
+	p, ok := d.db.(driver.OptsPutter)
+	if !ok {
+		return "", notImplemented("OptsPutter")
+	}
+	old := d.current(ctx, docID)
+	rev, err := p.PutOpts(ctx, docID, doc, opts)
+	if err != nil {
+		return "", err
+	}
+	return rev, d.recordWrite(ctx, "Put", docID, rev, old, doc)
+}
+
+func (d *db) Delete(ctx context.Context, docID, rev string) (string, error) {
+	old := d.current(ctx, docID)
+	newRev, err := d.db.Delete(ctx, docID, rev)
+	if err != nil {
+		return "", err
+	}
+	return newRev, d.recordWrite(ctx, "Delete", docID, newRev, old, nil)
+}
+
+func (d *db) DeleteOpts(ctx context.Context, docID, rev string, opts map[string]interface{}) (string, error) {
+	del, ok := d.db.(driver.OptsDeleter)
+	if !ok {
+		return "", notImplemented("OptsDeleter")
+	}
+	old := d.current(ctx, docID)
+	newRev, err := del.DeleteOpts(ctx, docID, rev, opts)
+	if err != nil {
+		return "", err
+	}
+	return newRev, d.recordWrite(ctx, "Delete", docID, newRev, old, nil)
+}
+
+func (d *db) BulkDocs(ctx context.Context, docs []interface{}) (driver.BulkResults, error) {
+	return d.bulkDocs(ctx, docs, func() (driver.BulkResults, error) {
+		return d.db.BulkDocs(ctx, docs)
+	})
+}
+
+func (d *db) BulkDocsOpts(ctx context.Context, docs []interface{}, opts map[string]interface{}) (driver.BulkResults, error) {
+	b, ok := d.db.(driver.OptsBulkDocer)
+	if !ok {
+		return nil, notImplemented("OptsBulkDocer")
+	}
+	return d.bulkDocs(ctx, docs, func() (driver.BulkResults, error) {
+		return b.BulkDocsOpts(ctx, docs, opts)
+	})
+}
+
+// bulkDocs reads the current versions of docs, calls fn, and records each
+// successful write. The results are read in full, and returned from memory.
+func (d *db) bulkDocs(ctx context.Context, docs []interface{}, fn func() (driver.BulkResults, error)) (driver.BulkResults, error) {
+	olds := make([]map[string]interface{}, len(docs))
+	for i, doc := range docs {
+		if m, err := toMap(doc); err == nil {
+			docID, _ := m["_id"].(string)
+			olds[i] = d.current(ctx, docID)
+		}
+	}
+	br, err := fn()
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = br.Close() }()
+	var results []driver.BulkResult
+	for i := 0; ; i++ {
+		var result driver.BulkResult
+		if err := br.Next(&result); err != nil {
+			if err == io.EOF {
+				break
+			}
+			return nil, err
+		}
+		results = append(results, result)
+		if result.Error != nil || i >= len(docs) {
+			continue
+		}
+		if err := d.recordWrite(ctx, "BulkDocs", result.ID, result.Rev, olds[i], docs[i]); err != nil {
+			return nil, err
+		}
+	}
+	return &bulkResults{results: results}, nil
+}
+
+type bulkResults struct {
+	results []driver.BulkResult
+}
+
+var _ driver.BulkResults = &bulkResults{}
+
+func (r *bulkResults) Next(result *driver.BulkResult) error {
+	if len(r.results) == 0 {
+		return io.EOF
+	}
+	*result, r.results = r.results[0], r.results[1:]
+	return nil
+}
+
+func (r *bulkResults) Close() error {
+	r.results = nil
+	return nil
+}
+
+// Copy records the copy as a write of the source document to the target.
+func (d *db) Copy(ctx context.Context, targetID, sourceID string, opts map[string]interface{}) (string, error) {
+	c, ok := d.db.(driver.Copier)
+	if !ok {
+		return "", notImplemented("Copier")
+	}
+	old := d.current(ctx, targetID)
+	rev, err := c.Copy(ctx, targetID, sourceID, opts)
+	if err != nil {
+		return "", err
+	}
+	return rev, d.record(ctx, Entry{
+		Op:      "Copy",
+		DocID:   targetID,
+		Rev:     rev,
+		Changes: diffDocs(old, d.current(ctx, sourceID)),
+		Detail:  sourceID,
+	})
+}
+
+// toMapOrNil is as toMap, but returns nil for a nil doc, or on error.
+func toMapOrNil(doc interface{}) map[string]interface{} {
+	if doc == nil {
+		return nil
+	}
+	m, _ := toMap(doc)
+	return m
+}
+
+func (d *db) PutAttachment(ctx context.Context, docID, rev, filename, contentType string, body io.Reader) (string, error) {
+	newRev, err := d.db.PutAttachment(ctx, docID, rev, filename, contentType, body)
+	if err != nil {
+		return "", err
+	}
+	return newRev, d.record(ctx, Entry{Op: "PutAttachment", DocID: docID, Rev: newRev, Detail: filename})
+}
+
+func (d *db) GetAttachment(ctx context.Context, docID, rev, filename string) (string, driver.MD5sum, io.ReadCloser, error) {
+	return d.db.GetAttachment(ctx, docID, rev, filename)
+}
+
+func (d *db) DeleteAttachment(ctx context.Context, docID, rev, filename string) (string, error) {
+	newRev, err := d.db.DeleteAttachment(ctx, docID, rev, filename)
+	if err != nil {
+		return "", err
+	}
+	return newRev, d.record(ctx, Entry{Op: "DeleteAttachment", DocID: docID, Rev: newRev, Detail: filename})
+}
+
+func (d *db) Stats(ctx context.Context) (*driver.DBStats, error) {
+	return d.db.Stats(ctx)
+}
+
+func (d *db) Compact(ctx context.Context) error {
+	return d.db.Compact(ctx)
+}
+
+func (d *db) CompactView(ctx context.Context, ddocID string) error {
+	return d.db.CompactView(ctx, ddocID)
+}
+
+func (d *db) ViewCleanup(ctx context.Context) error {
+	return d.db.ViewCleanup(ctx)
+}
+
+func (d *db) Security(ctx context.Context) (*driver.Security, error) {
+	return d.db.Security(ctx)
+}
+
+// SetSecurity records the changes to the security document.
+func (d *db) SetSecurity(ctx context.Context, security *driver.Security) error {
+	var old map[string]interface{}
+	if sec, err := d.db.Security(ctx); err == nil {
+		old = toMapOrNil(sec)
+	}
+	if err := d.db.SetSecurity(ctx, security); err != nil {
+		return err
+	}
+	return d.record(ctx, Entry{Op: "SetSecurity", Changes: diffDocs(old, toMapOrNil(security))})
+}
+
+func (d *db) Changes(ctx context.Context, opts map[string]interface{}) (driver.Changes, error) {
+	return d.db.Changes(ctx, opts)
+}
+
+func (d *db) finder() (driver.Finder, error) {
+	if f, ok := d.db.(driver.Finder); ok {
+		return f, nil
+	}
+	return nil, notImplemented("Finder")
+}
+
+func (d *db) Find(ctx context.Context, query interface{}) (driver.Rows, error) {
+	f, err := d.finder()
+	if err != nil {
+		return nil, err
+	}
+	return f.Find(ctx, query)
+}
+
+func (d *db) CreateIndex(ctx context.Context, ddoc, name string, index interface{}) error {
+	f, err := d.finder()
+	if err != nil {
+		return err
+	}
+	if err := f.CreateIndex(ctx, ddoc, name, index); err != nil {
+		return err
+	}
+	return d.record(ctx, Entry{Op: "CreateIndex", DocID: ddoc, Detail: name})
+}
+
+func (d *db) GetIndexes(ctx context.Context) ([]driver.Index, error) {
+	f, err := d.finder()
+	if err != nil {
+		return nil, err
+	}
+	return f.GetIndexes(ctx)
+}
+
+func (d *db) DeleteIndex(ctx context.Context, ddoc, name string) error {
+	f, err := d.finder()
+	if err != nil {
+		return err
+	}
+	if err := f.DeleteIndex(ctx, ddoc, name); err != nil {
+		return err
+	}
+	return d.record(ctx, Entry{Op: "DeleteIndex", DocID: ddoc, Detail: name})
+}
+
+func (d *db) GetAttachmentMeta(ctx context.Context, docID, rev, filename string) (string, driver.MD5sum, error) {
+	m, ok := d.db.(driver.AttachmentMetaer)
+	if !ok {
+		return "", driver.MD5sum{}, notImplemented("AttachmentMetaer")
+	}
+	return m.GetAttachmentMeta(ctx, docID, rev, filename)
+}
+
+func (d *db) Rev(ctx context.Context, docID string) (string, error) {
+	r, ok := d.db.(driver.Rever)
+	if !ok {
+		return "", notImplemented("Rever")
+	}
+	return r.Rev(ctx, docID)
+}
+
+func (d *db) Flush(ctx context.Context) error {
+	f, ok := d.db.(driver.DBFlusher)
+	if !ok {
+		return notImplemented("DBFlusher")
+	}
+	return f.Flush(ctx)
+}
+
+func (d *db) GetOpenRevs(ctx context.Context, docID string, revs []string, opts map[string]interface{}) ([]driver.OpenRev, error) {
+	g, ok := d.db.(driver.OpenRevsGetter)
+	if !ok {
+		return nil, notImplemented("OpenRevsGetter")
+	}
+	return g.GetOpenRevs(ctx, docID, revs, opts)
+}
+
+func (d *db) GetBody(ctx context.Context, docID string, opts map[string]interface{}) (io.ReadCloser, error) {
+	g, ok := d.db.(driver.BodyGetter)
+	if !ok {
+		return nil, notImplemented("BodyGetter")
+	}
+	return g.GetBody(ctx, docID, opts)
+}
+
+func (d *db) SupportsQuorum() bool {
+	q, ok := d.db.(driver.Quorumer)
+	return ok && q.SupportsQuorum()
+}
+
+func (d *db) SupportedOptions(method string) (map[string]driver.OptionType, bool) {
+	if v, ok := d.db.(driver.OptionValidator); ok {
+		return v.SupportedOptions(method)
+	}
+	return nil, false
+}
+
+func (d *db) PutMultipart(ctx context.Context, docID string, doc interface{}, atts []driver.MultipartAttachment, opts map[string]interface{}) (string, error) {
+	p, ok := d.db.(driver.MultipartPutter)
+	if !ok {
+		return "", notImplemented("MultipartPutter")
+	}
+	old := d.current(ctx, docID)
+	rev, err := p.PutMultipart(ctx, docID, doc, atts, opts)
+	if err != nil {
+		return "", err
+	}
+	return rev, d.recordWrite(ctx, "PutMultipart", docID, rev, old, doc)
+}
+
+func (d *db) Explain(ctx context.Context, query interface{}) (*driver.QueryPlan, error) {
+	e, ok := d.db.(driver.Explainer)
+	if !ok {
+		return nil, notImplemented("Explainer")
+	}
+	return e.Explain(ctx, query)
+}
+
+func (d *db) DesignInfo(ctx context.Context, ddoc string) (*driver.DesignInfo, error) {
+	i, ok := d.db.(driver.DesignInfoer)
+	if !ok {
+		return nil, notImplemented("DesignInfoer")
+	}
+	return i.DesignInfo(ctx, ddoc)
+}
+
+func (d *db) CombineAttachments(ctx context.Context, docID, rev, filename, contentType string, parts []string) (string, error) {
+	c, ok := d.db.(driver.AttachmentCombiner)
+	if !ok {
+		return "", notImplemented("AttachmentCombiner")
+	}
+	newRev, err := c.CombineAttachments(ctx, docID, rev, filename, contentType, parts)
+	if err != nil {
+		return "", err
+	}
+	return newRev, d.record(ctx, Entry{Op: "CombineAttachments", DocID: docID, Rev: newRev, Detail: filename})
+}
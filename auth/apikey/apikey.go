@@ -0,0 +1,212 @@
+// Package apikey provides API key authentication. Keys are bound to a user
+// name and a set of roles, and may be presented either in an
+// `Authorization: ApiKey <key>` header, or as a query parameter.
+package apikey
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/flimzy/kivik"
+	"github.com/flimzy/kivik/auth"
+	"github.com/flimzy/kivik/authdb"
+	"github.com/flimzy/kivik/errors"
+)
+
+// AuthScheme is the scheme expected in the Authorization header.
+const AuthScheme = "ApiKey"
+
+// DefaultQueryParam is the query parameter checked for an API key, if
+// Auth.QueryParam is unset.
+const DefaultQueryParam = "api_key"
+
+// Key represents an API key. The secret token is never stored, and is only
+// returned once, by Store.Create.
+type Key struct {
+	// ID uniquely identifies the key, and is used to revoke it.
+	ID string `json:"id"`
+	// Name is the name of the user to which the key is bound.
+	Name string `json:"name"`
+	// Roles is the list of roles granted to requests authenticated with this
+	// key.
+	Roles []string `json:"roles"`
+	// Created is the time the key was created.
+	Created time.Time `json:"created"`
+}
+
+// A Store manages API keys.
+type Store interface {
+	// Create creates a new key bound to the user name and roles. The returned
+	// token is the secret to be presented by clients.
+	Create(ctx context.Context, name string, roles []string) (token string, key *Key, err error)
+	// Lookup returns the key matching token. A Not Found error must be
+	// returned if no such key exists.
+	Lookup(ctx context.Context, token string) (*Key, error)
+	// Revoke invalidates the key with the given ID.
+	Revoke(ctx context.Context, id string) error
+	// List returns all keys known to the store.
+	List(ctx context.Context) ([]*Key, error)
+}
+
+// tokenLength is the number of random bytes in a generated token.
+const tokenLength = 24
+
+func newToken() (string, error) {
+	buf := make([]byte, tokenLength)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(buf), nil
+}
+
+// hashToken returns the hex-encoded SHA-256 hash of a token.
+func hashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+type memStore struct {
+	mu   sync.RWMutex
+	keys map[string]*Key // Indexed by the token hash
+}
+
+var _ Store = &memStore{}
+
+// NewMemoryStore returns a new, empty, memory-backed key store.
+func NewMemoryStore() Store {
+	return &memStore{keys: make(map[string]*Key)}
+}
+
+func copyKey(k *Key) *Key {
+	c := *k
+	c.Roles = append([]string{}, k.Roles...)
+	return &c
+}
+
+func (s *memStore) Create(_ context.Context, name string, roles []string) (string, *Key, error) {
+	if name == "" {
+		return "", nil, errors.Status(kivik.StatusBadRequest, "api key must be bound to a user name")
+	}
+	token, err := newToken()
+	if err != nil {
+		return "", nil, err
+	}
+	hash := hashToken(token)
+	key := &Key{
+		ID:      hash[:16],
+		Name:    name,
+		Roles:   append([]string{}, roles...),
+		Created: time.Now().UTC(),
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.keys[hash] = key
+	return token, copyKey(key), nil
+}
+
+func (s *memStore) Lookup(_ context.Context, token string) (*Key, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	key, ok := s.keys[hashToken(token)]
+	if !ok {
+		return nil, errors.Status(kivik.StatusNotFound, "api key not found")
+	}
+	return copyKey(key), nil
+}
+
+func (s *memStore) Revoke(_ context.Context, id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for hash, key := range s.keys {
+		if key.ID == id {
+			delete(s.keys, hash)
+			return nil
+		}
+	}
+	return errors.Status(kivik.StatusNotFound, "api key not found")
+}
+
+func (s *memStore) List(_ context.Context) ([]*Key, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	keys := make([]*Key, 0, len(s.keys))
+	for _, key := range s.keys {
+		keys = append(keys, copyKey(key))
+	}
+	sort.Sort(keyList(keys))
+	return keys, nil
+}
+
+type keyList []*Key
+
+func (l keyList) Len() int           { return len(l) }
+func (l keyList) Less(i, j int) bool { return l[i].ID < l[j].ID }
+func (l keyList) Swap(i, j int)      { l[i], l[j] = l[j], l[i] }
+
+// Auth provides API key authentication.
+type Auth struct {
+	// Store is the key store against which keys are validated.
+	Store Store
+	// QueryParam is the name of the query parameter which may carry an API
+	// key. Defaults to DefaultQueryParam. Set to "-" to disable query
+	// parameter authentication.
+	QueryParam string
+}
+
+var _ auth.Handler = &Auth{}
+
+// MethodName returns "apikey".
+func (a *Auth) MethodName() string {
+	return "apikey"
+}
+
+func (a *Auth) queryParam() string {
+	if a.QueryParam == "" {
+		return DefaultQueryParam
+	}
+	return a.QueryParam
+}
+
+// token extracts the API key from the request, if any.
+func (a *Auth) token(r *http.Request) (string, bool) {
+	if h := r.Header.Get("Authorization"); h != "" {
+		parts := strings.SplitN(h, " ", 2)
+		if len(parts) == 2 && strings.EqualFold(parts[0], AuthScheme) {
+			return strings.TrimSpace(parts[1]), true
+		}
+	}
+	if param := a.queryParam(); param != "-" {
+		if values, ok := r.URL.Query()[param]; ok && len(values) > 0 {
+			return values[0], true
+		}
+	}
+	return "", false
+}
+
+// Authenticate authenticates a request bearing an API key. Requests without a
+// key fall through to the next handler. A key which is presented, but which
+// is unknown to the store, results in an unauthorized error.
+func (a *Auth) Authenticate(w http.ResponseWriter, r *http.Request) (*authdb.UserContext, error) {
+	token, ok := a.token(r)
+	if !ok {
+		return nil, nil
+	}
+	key, err := a.Store.Lookup(r.Context(), token)
+	if err != nil {
+		if errors.StatusCode(err) == kivik.StatusNotFound {
+			return nil, errors.Status(kivik.StatusUnauthorized, "invalid api key")
+		}
+		return nil, err
+	}
+	return &authdb.UserContext{
+		Name:  key.Name,
+		Roles: key.Roles,
+	}, nil
+}
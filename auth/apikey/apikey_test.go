@@ -0,0 +1,127 @@
+package apikey
+
+import (
+	"context"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/flimzy/diff"
+	"github.com/flimzy/kivik/authdb"
+	"github.com/flimzy/kivik/errors"
+)
+
+func TestMemoryStore(t *testing.T) {
+	ctx := context.Background()
+	s := NewMemoryStore()
+	if _, _, err := s.Create(ctx, "", nil); errors.StatusCode(err) != 400 {
+		t.Errorf("Expected 400 for missing name, got %v", err)
+	}
+	token, key, err := s.Create(ctx, "bob", []string{"foo"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(token) != tokenLength*2 {
+		t.Errorf("Unexpected token length %d", len(token))
+	}
+	found, err := s.Lookup(ctx, token)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if d := diff.Interface(key, found); d != "" {
+		t.Error(d)
+	}
+	if _, err := s.Lookup(ctx, "bogus"); errors.StatusCode(err) != 404 {
+		t.Errorf("Expected 404 for unknown token, got %v", err)
+	}
+	keys, err := s.List(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if d := diff.Interface([]*Key{key}, keys); d != "" {
+		t.Error(d)
+	}
+	if err := s.Revoke(ctx, key.ID); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Revoke(ctx, key.ID); errors.StatusCode(err) != 404 {
+		t.Errorf("Expected 404 for second revocation, got %v", err)
+	}
+	if _, err := s.Lookup(ctx, token); errors.StatusCode(err) != 404 {
+		t.Errorf("Expected 404 for revoked token, got %v", err)
+	}
+}
+
+func TestAuthenticate(t *testing.T) {
+	store := NewMemoryStore()
+	token, _, err := store.Create(context.Background(), "bob", []string{"foo"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := &authdb.UserContext{Name: "bob", Roles: []string{"foo"}}
+	tests := []struct {
+		name     string
+		auth     *Auth
+		header   string
+		url      string
+		expected *authdb.UserContext
+		status   int
+	}{
+		{
+			name: "NoKey",
+			auth: &Auth{Store: store},
+			url:  "/",
+		},
+		{
+			name:   "OtherScheme",
+			auth:   &Auth{Store: store},
+			header: "Basic Ym9iOmFiYzEyMw==",
+			url:    "/",
+		},
+		{
+			name:     "Header",
+			auth:     &Auth{Store: store},
+			header:   "ApiKey " + token,
+			url:      "/",
+			expected: expected,
+		},
+		{
+			name:     "DefaultQueryParam",
+			auth:     &Auth{Store: store},
+			url:      "/?api_key=" + token,
+			expected: expected,
+		},
+		{
+			name:     "CustomQueryParam",
+			auth:     &Auth{Store: store, QueryParam: "key"},
+			url:      "/?key=" + token,
+			expected: expected,
+		},
+		{
+			name: "QueryParamDisabled",
+			auth: &Auth{Store: store, QueryParam: "-"},
+			url:  "/?api_key=" + token,
+		},
+		{
+			name:   "InvalidKey",
+			auth:   &Auth{Store: store},
+			header: "ApiKey bogus",
+			url:    "/",
+			status: 401,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			req := httptest.NewRequest("GET", test.url, nil)
+			if test.header != "" {
+				req.Header.Set("Authorization", test.header)
+			}
+			uCtx, err := test.auth.Authenticate(httptest.NewRecorder(), req)
+			if status := errors.StatusCode(err); status != test.status {
+				t.Errorf("Unexpected status %d: %s", status, err)
+			}
+			if d := diff.Interface(test.expected, uCtx); d != "" {
+				t.Error(d)
+			}
+		})
+	}
+}
@@ -20,23 +20,50 @@ import (
 const typeJSON = "application/json"
 
 // Auth provides CouchDB Cookie authentication.
-type Auth struct{}
+type Auth struct {
+	// Sessions, if set, stores sessions server-side, and the cookie value
+	// becomes an opaque session ID. If unset, sessions are encoded in the
+	// cookie itself, as CouchDB does.
+	Sessions SessionStore
+}
 
 var _ auth.Handler = &Auth{}
+var _ serve.IdleSessionCloser = &Auth{}
+var _ serve.ExpiredSessionPurger = &Auth{}
 
 // MethodName returns "cookie"
 func (a *Auth) MethodName() string {
 	return "cookie" // For compatibility with the name used by CouchDB
 }
 
+// CloseIdleSessions closes the sessions last used before the given time, if
+// Sessions is an IdleSessionStore. Otherwise, no sessions are closed.
+func (a *Auth) CloseIdleSessions(ctx context.Context, before time.Time) (int, error) {
+	store, ok := a.Sessions.(IdleSessionStore)
+	if !ok {
+		return 0, nil
+	}
+	return store.DeleteIdle(ctx, before)
+}
+
+// PurgeExpiredSessions removes the sessions which expired before now, if
+// Sessions is an ExpiredSessionStore. Otherwise, none are removed.
+func (a *Auth) PurgeExpiredSessions(ctx context.Context, now time.Time) (int, error) {
+	store, ok := a.Sessions.(ExpiredSessionStore)
+	if !ok {
+		return 0, nil
+	}
+	return store.DeleteExpired(ctx, now)
+}
+
 // Authenticate authenticates a request with cookie auth against the user store.
 func (a *Auth) Authenticate(w http.ResponseWriter, r *http.Request) (*authdb.UserContext, error) {
 	if r.URL.Path == "/_session" {
 		switch r.Method {
 		case kivik.MethodPost:
-			return nil, postSession(w, r)
+			return nil, a.postSession(w, r)
 		case kivik.MethodDelete:
-			return nil, deleteSession(w, r)
+			return nil, a.deleteSession(w, r)
 		}
 	}
 	return a.validateCookie(w, r)
@@ -48,6 +75,9 @@ func (a *Auth) validateCookie(w http.ResponseWriter, r *http.Request) (*authdb.U
 	if err != nil {
 		return nil, nil
 	}
+	if a.Sessions != nil {
+		return a.validateSession(r, cookie.Value)
+	}
 	name, _, err := serve.DecodeCookie(cookie.Value)
 	if err != nil {
 		return nil, nil
@@ -65,7 +95,45 @@ func (a *Auth) validateCookie(w http.ResponseWriter, r *http.Request) (*authdb.U
 	return user, nil
 }
 
-func postSession(w http.ResponseWriter, r *http.Request) error {
+func (a *Auth) validateSession(r *http.Request, id string) (*authdb.UserContext, error) {
+	session, err := a.Sessions.Get(r.Context(), id)
+	if err != nil {
+		if errors.StatusCode(err) == kivik.StatusNotFound {
+			return nil, nil
+		}
+		return nil, err
+	}
+	user, err := serve.GetService(r).UserStore.UserCtx(r.Context(), session.Name)
+	if err != nil {
+		// Failed to look up the user
+		return nil, nil
+	}
+	return user, nil
+}
+
+// createToken returns a new cookie value for the user.
+func (a *Auth) createToken(ctx context.Context, s *serve.Service, name string, user *authdb.UserContext) (string, error) {
+	if a.Sessions == nil {
+		return s.CreateAuthToken(name, user.Salt, s.Now().Unix())
+	}
+	id, err := newSessionID(s)
+	if err != nil {
+		return "", err
+	}
+	now := s.Now()
+	session := &SessionData{
+		ID:      id,
+		Name:    name,
+		Created: now,
+		Expires: now.Add(time.Duration(getSessionTimeout(ctx, s)) * time.Second),
+	}
+	if err := a.Sessions.Put(ctx, session); err != nil {
+		return "", err
+	}
+	return id, nil
+}
+
+func (a *Auth) postSession(w http.ResponseWriter, r *http.Request) error {
 	authData := struct {
 		Name     *string `form:"name" json:"name"`
 		Password string  `form:"password" json:"password"`
@@ -77,7 +145,7 @@ func postSession(w http.ResponseWriter, r *http.Request) error {
 		return errors.Status(kivik.StatusBadRequest, "request body must contain a username")
 	}
 	s := serve.GetService(r)
-	user, err := s.UserStore.Validate(r.Context(), *authData.Name, authData.Password)
+	user, err := s.ValidateUser(r, *authData.Name, authData.Password)
 	if err != nil {
 		return err
 	}
@@ -87,7 +155,7 @@ func postSession(w http.ResponseWriter, r *http.Request) error {
 	}
 
 	// Success, so create a cookie
-	token, err := s.CreateAuthToken(*authData.Name, user.Salt, time.Now().Unix())
+	token, err := a.createToken(r.Context(), s, *authData.Name, user)
 	if err != nil {
 		return err
 	}
@@ -95,7 +163,7 @@ func postSession(w http.ResponseWriter, r *http.Request) error {
 	http.SetCookie(w, &http.Cookie{
 		Name:     kivik.SessionCookieName,
 		Value:    token,
-		Path:     "/",
+		Path:     serve.MountPath(r),
 		MaxAge:   getSessionTimeout(r.Context(), s),
 		HttpOnly: true,
 	})
@@ -130,11 +198,18 @@ func redirectURL(r *http.Request) (string, error) {
 	return parsed.String(), nil
 }
 
-func deleteSession(w http.ResponseWriter, r *http.Request) error {
+func (a *Auth) deleteSession(w http.ResponseWriter, r *http.Request) error {
+	if a.Sessions != nil {
+		if cookie, err := r.Cookie(kivik.SessionCookieName); err == nil {
+			if err := a.Sessions.Delete(r.Context(), cookie.Value); err != nil {
+				return err
+			}
+		}
+	}
 	http.SetCookie(w, &http.Cookie{
 		Name:     kivik.SessionCookieName,
 		Value:    "",
-		Path:     "/",
+		Path:     serve.MountPath(r),
 		MaxAge:   -1,
 		HttpOnly: true,
 	})
@@ -0,0 +1,261 @@
+package cookie
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/flimzy/kivik"
+	"github.com/flimzy/kivik/errors"
+	"github.com/flimzy/kivik/serve"
+)
+
+// SessionData is a server-side session record.
+type SessionData struct {
+	// ID is the session ID, which is sent to the client as the cookie value.
+	ID string `json:"-"`
+	// Name is the name of the authenticated user.
+	Name string `json:"name"`
+	// Created is the time the session was created.
+	Created time.Time `json:"created"`
+	// Expires is the time after which the session is no longer valid.
+	Expires time.Time `json:"expires"`
+}
+
+func (s *SessionData) expired(now time.Time) bool {
+	return !s.Expires.IsZero() && now.After(s.Expires)
+}
+
+// A SessionStore persists cookie sessions, so that they may survive server
+// restarts, or be shared between multiple server instances.
+type SessionStore interface {
+	// Put stores the session.
+	Put(ctx context.Context, session *SessionData) error
+	// Get returns the session with the given ID. A Not Found error must be
+	// returned if the session does not exist, or has expired.
+	Get(ctx context.Context, id string) (*SessionData, error)
+	// Delete removes the session. Deleting a non-existent session is not an
+	// error.
+	Delete(ctx context.Context, id string) error
+}
+
+// An IdleSessionStore is a SessionStore which records when each session was
+// last used, so that idle sessions may be closed.
+type IdleSessionStore interface {
+	SessionStore
+	// DeleteIdle removes the sessions last used before the given time, and
+	// returns the number removed.
+	DeleteIdle(ctx context.Context, before time.Time) (int, error)
+}
+
+// An ExpiredSessionStore is a SessionStore which can remove its expired
+// sessions in bulk, so that those never used again after expiry do not
+// accumulate.
+type ExpiredSessionStore interface {
+	SessionStore
+	// DeleteExpired removes the sessions which expired before now, and
+	// returns the number removed.
+	DeleteExpired(ctx context.Context, now time.Time) (int, error)
+}
+
+// sessionIDLength is the number of random bytes in a session ID.
+const sessionIDLength = 32
+
+// newSessionID returns a new session ID, generated by the service's
+// IDGenerator, if set.
+func newSessionID(s *serve.Service) (string, error) {
+	if s.IDGenerator != nil {
+		return s.IDGenerator.NewID()
+	}
+	buf := make([]byte, sessionIDLength)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(buf), nil
+}
+
+// currentTime returns the current time, according to the clock of the service
+// serving the request with context ctx, if any.
+func currentTime(ctx context.Context) time.Time {
+	if s := serve.ServiceFromContext(ctx); s != nil {
+		return s.Now()
+	}
+	return time.Now()
+}
+
+var errSessionNotFound = errors.Status(kivik.StatusNotFound, "session not found")
+
+type memStore struct {
+	mu       sync.Mutex
+	sessions map[string]*SessionData
+	// lastUsed is the time each session was last read or stored.
+	lastUsed map[string]time.Time
+}
+
+var _ IdleSessionStore = &memStore{}
+var _ ExpiredSessionStore = &memStore{}
+
+// NewMemorySessionStore returns a new memory-backed session store. Expired
+// sessions are discarded as they are encountered.
+func NewMemorySessionStore() SessionStore {
+	return &memStore{
+		sessions: make(map[string]*SessionData),
+		lastUsed: make(map[string]time.Time),
+	}
+}
+
+func (s *memStore) Put(ctx context.Context, session *SessionData) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	t := currentTime(ctx)
+	for id, sess := range s.sessions {
+		if sess.expired(t) {
+			delete(s.sessions, id)
+			delete(s.lastUsed, id)
+		}
+	}
+	c := *session
+	s.sessions[session.ID] = &c
+	s.lastUsed[session.ID] = t
+	return nil
+}
+
+func (s *memStore) Get(ctx context.Context, id string) (*SessionData, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	session, ok := s.sessions[id]
+	if !ok {
+		return nil, errSessionNotFound
+	}
+	t := currentTime(ctx)
+	if session.expired(t) {
+		delete(s.sessions, id)
+		delete(s.lastUsed, id)
+		return nil, errSessionNotFound
+	}
+	s.lastUsed[id] = t
+	c := *session
+	return &c, nil
+}
+
+func (s *memStore) Delete(_ context.Context, id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.sessions, id)
+	delete(s.lastUsed, id)
+	return nil
+}
+
+func (s *memStore) DeleteIdle(_ context.Context, before time.Time) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var deleted int
+	for id := range s.sessions {
+		if s.lastUsed[id].Before(before) {
+			delete(s.sessions, id)
+			delete(s.lastUsed, id)
+			deleted++
+		}
+	}
+	return deleted, nil
+}
+
+func (s *memStore) DeleteExpired(_ context.Context, now time.Time) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var deleted int
+	for id, session := range s.sessions {
+		if session.expired(now) {
+			delete(s.sessions, id)
+			delete(s.lastUsed, id)
+			deleted++
+		}
+	}
+	return deleted, nil
+}
+
+type dbStore struct {
+	db *kivik.DB
+}
+
+var _ ExpiredSessionStore = &dbStore{}
+
+// NewDBSessionStore returns a session store which stores each session as a
+// document in db, keyed by the session ID.
+func NewDBSessionStore(db *kivik.DB) SessionStore {
+	return &dbStore{db: db}
+}
+
+type sessionDoc struct {
+	ID  string `json:"_id"`
+	Rev string `json:"_rev,omitempty"`
+	*SessionData
+}
+
+func (s *dbStore) Put(ctx context.Context, session *SessionData) error {
+	_, err := s.db.Put(ctx, session.ID, sessionDoc{ID: session.ID, SessionData: session})
+	return err
+}
+
+func (s *dbStore) Get(ctx context.Context, id string) (*SessionData, error) {
+	row, err := s.db.Get(ctx, id)
+	if err != nil {
+		if kivik.StatusCode(err) == kivik.StatusNotFound {
+			return nil, errSessionNotFound
+		}
+		return nil, err
+	}
+	doc := sessionDoc{SessionData: &SessionData{}}
+	if err := row.ScanDoc(&doc); err != nil {
+		return nil, err
+	}
+	doc.SessionData.ID = doc.ID
+	if doc.expired(currentTime(ctx)) {
+		_ = s.Delete(ctx, id)
+		return nil, errSessionNotFound
+	}
+	return doc.SessionData, nil
+}
+
+func (s *dbStore) Delete(ctx context.Context, id string) error {
+	rev, err := s.db.Rev(ctx, id)
+	if err != nil {
+		if kivik.StatusCode(err) == kivik.StatusNotFound {
+			return nil
+		}
+		return err
+	}
+	_, err = s.db.Delete(ctx, id, rev)
+	return err
+}
+
+func (s *dbStore) DeleteExpired(ctx context.Context, now time.Time) (int, error) {
+	rows, err := s.db.AllDocs(ctx, kivik.Options{"include_docs": true})
+	if err != nil {
+		return 0, err
+	}
+	defer func() { _ = rows.Close() }()
+	var deleted int
+	for rows.Next() {
+		doc := sessionDoc{SessionData: &SessionData{}}
+		if err := rows.ScanDoc(&doc); err != nil {
+			return deleted, err
+		}
+		if strings.HasPrefix(doc.ID, "_design/") || !doc.expired(now) {
+			continue
+		}
+		_, err := s.db.Delete(ctx, doc.ID, doc.Rev)
+		if kivik.StatusCode(err) == kivik.StatusConflict {
+			// The session was stored again since it was read.
+			continue
+		}
+		if err != nil {
+			return deleted, err
+		}
+		deleted++
+	}
+	return deleted, rows.Err()
+}
@@ -0,0 +1,164 @@
+package cookie
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/flimzy/diff"
+	"github.com/flimzy/kivik"
+	_ "github.com/flimzy/kivik/driver/memory"
+	"github.com/flimzy/kivik/errors"
+	"github.com/flimzy/kivik/serve"
+)
+
+func testSessionStore(t *testing.T, store SessionStore) {
+	ctx := context.Background()
+	now := time.Now().UTC().Truncate(time.Second)
+	session := &SessionData{
+		ID:      "abc",
+		Name:    "bob",
+		Created: now,
+		Expires: now.Add(time.Hour),
+	}
+	if err := store.Put(ctx, session); err != nil {
+		t.Fatal(err)
+	}
+	result, err := store.Get(ctx, "abc")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if d := diff.Interface(session, result); d != "" {
+		t.Error(d)
+	}
+	if _, err := store.Get(ctx, "xyz"); errors.StatusCode(err) != kivik.StatusNotFound {
+		t.Errorf("Expected 404 for unknown session, got %v", err)
+	}
+	expired := &SessionData{
+		ID:      "old",
+		Name:    "bob",
+		Created: now.Add(-2 * time.Hour),
+		Expires: now.Add(-time.Hour),
+	}
+	if err := store.Put(ctx, expired); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := store.Get(ctx, "old"); errors.StatusCode(err) != kivik.StatusNotFound {
+		t.Errorf("Expected 404 for expired session, got %v", err)
+	}
+	if err := store.Delete(ctx, "abc"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := store.Get(ctx, "abc"); errors.StatusCode(err) != kivik.StatusNotFound {
+		t.Errorf("Expected 404 for deleted session, got %v", err)
+	}
+	if err := store.Delete(ctx, "abc"); err != nil {
+		t.Errorf("Deleting a missing session should succeed: %s", err)
+	}
+}
+
+func TestMemorySessionStore(t *testing.T) {
+	testSessionStore(t, NewMemorySessionStore())
+}
+
+func TestDBSessionStore(t *testing.T) {
+	ctx := context.Background()
+	client, err := kivik.New(ctx, "memory", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := client.CreateDB(ctx, "sessions"); err != nil {
+		t.Fatal(err)
+	}
+	db, err := client.DB(ctx, "sessions")
+	if err != nil {
+		t.Fatal(err)
+	}
+	testSessionStore(t, NewDBSessionStore(db))
+}
+
+func TestServiceClock(t *testing.T) {
+	now := time.Date(2017, 1, 1, 0, 0, 0, 0, time.UTC)
+	s := &serve.Service{
+		Clock: func() time.Time { return now },
+		IDGenerator: kivik.IDGeneratorFunc(func() (string, error) {
+			return "session1", nil
+		}),
+	}
+	ctx := context.WithValue(context.Background(), serve.ServiceContextKey, s)
+	id, err := newSessionID(s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if id != "session1" {
+		t.Errorf("Unexpected session ID: %s", id)
+	}
+	store := NewMemorySessionStore()
+	// The session expired long ago, but not according to the service's clock.
+	session := &SessionData{ID: id, Name: "bob", Created: now, Expires: now.Add(time.Hour)}
+	if err := store.Put(ctx, session); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := store.Get(ctx, id); err != nil {
+		t.Errorf("Expected the session to be valid, got %v", err)
+	}
+	now = now.Add(2 * time.Hour)
+	if _, err := store.Get(ctx, id); errors.StatusCode(err) != kivik.StatusNotFound {
+		t.Errorf("Expected 404 for expired session, got %v", err)
+	}
+}
+
+func TestCloseIdleSessions(t *testing.T) {
+	now := time.Date(2017, 1, 1, 0, 0, 0, 0, time.UTC)
+	s := &serve.Service{Clock: func() time.Time { return now }}
+	ctx := context.WithValue(context.Background(), serve.ServiceContextKey, s)
+	a := &Auth{Sessions: NewMemorySessionStore()}
+	for _, id := range []string{"idle", "active"} {
+		if err := a.Sessions.Put(ctx, &SessionData{ID: id, Name: "bob", Expires: now.Add(time.Hour)}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	now = now.Add(20 * time.Minute)
+	if _, err := a.Sessions.Get(ctx, "active"); err != nil {
+		t.Fatal(err)
+	}
+	closed, err := a.CloseIdleSessions(ctx, now.Add(-10*time.Minute))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if closed != 1 {
+		t.Errorf("Expected 1 session closed, got %d", closed)
+	}
+	if _, err := a.Sessions.Get(ctx, "idle"); errors.StatusCode(err) != kivik.StatusNotFound {
+		t.Errorf("Expected the idle session to be closed, got %v", err)
+	}
+	if _, err := a.Sessions.Get(ctx, "active"); err != nil {
+		t.Errorf("Expected the active session to remain, got %v", err)
+	}
+}
+
+func TestPurgeExpiredSessions(t *testing.T) {
+	now := time.Now()
+	ctx := context.Background()
+	a := &Auth{Sessions: NewMemorySessionStore()}
+	sessions := map[string]time.Time{"expired": now.Add(time.Minute), "valid": now.Add(time.Hour)}
+	for id, expires := range sessions {
+		if err := a.Sessions.Put(ctx, &SessionData{ID: id, Name: "bob", Created: now.Add(-2 * time.Hour), Expires: expires}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	purged, err := a.PurgeExpiredSessions(ctx, now.Add(30*time.Minute))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if purged != 1 {
+		t.Errorf("Expected 1 session purged, got %d", purged)
+	}
+	store := a.Sessions.(*memStore)
+	if _, ok := store.sessions["expired"]; ok {
+		t.Error("Expected the expired session to be purged")
+	}
+	if _, ok := store.sessions["valid"]; !ok {
+		t.Error("Expected the valid session to remain")
+	}
+}
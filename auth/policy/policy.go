@@ -0,0 +1,182 @@
+// Package policy provides a rule-based authorization layer, evaluated after
+// authentication.
+//
+// A rule is expressed as a string of four space-separated fields:
+//
+//	<allow|deny> <subject> <methods> <path>
+//
+// Subject is one of `*` (anybody, including anonymous users), `user:<name>`
+// or `role:<name>`, where name may be `*` to match any authenticated user, or
+// any role. Methods is a comma-separated list of HTTP methods, or `*` to match
+// any method. Path is a pattern as understood by path.Match, with the
+// addition that a trailing `/*` matches the path prefix itself, and anything
+// below it.
+//
+// For example, to permit users with the `reporting` role to read, but not
+// write, the analytics database:
+//
+//	allow role:reporting GET,HEAD /analytics/*
+//	deny  role:reporting *        /analytics/*
+//
+// Rules are evaluated in order, and the first matching rule applies. If no
+// rule matches, the request is allowed. Server admins are always allowed.
+package policy
+
+import (
+	"path"
+	"strings"
+
+	"github.com/flimzy/kivik/authdb"
+	"github.com/flimzy/kivik/errors"
+)
+
+// Effect is the result of a matching rule.
+type Effect int
+
+// The possible rule effects.
+const (
+	Allow Effect = iota
+	Deny
+)
+
+// Rule is a single authorization rule.
+type Rule struct {
+	Effect Effect
+	// Subject is `*`, `user:<name>` or `role:<name>`.
+	Subject string
+	// Methods is the list of HTTP methods to which the rule applies. An empty
+	// list matches any method.
+	Methods []string
+	// Path is the request path pattern.
+	Path string
+}
+
+// ParseRule parses a rule from its string representation.
+func ParseRule(rule string) (*Rule, error) {
+	fields := strings.Fields(rule)
+	if len(fields) != 4 {
+		return nil, errors.Errorf("invalid rule '%s': expected 4 fields", rule)
+	}
+	r := &Rule{}
+	switch strings.ToLower(fields[0]) {
+	case "allow":
+		r.Effect = Allow
+	case "deny":
+		r.Effect = Deny
+	default:
+		return nil, errors.Errorf("invalid rule '%s': unknown effect '%s'", rule, fields[0])
+	}
+	subject := fields[1]
+	if subject != "*" && !strings.HasPrefix(subject, "user:") && !strings.HasPrefix(subject, "role:") {
+		return nil, errors.Errorf("invalid rule '%s': unknown subject '%s'", rule, subject)
+	}
+	r.Subject = subject
+	if fields[2] != "*" {
+		for _, method := range strings.Split(fields[2], ",") {
+			if method == "" {
+				return nil, errors.Errorf("invalid rule '%s': empty method", rule)
+			}
+			r.Methods = append(r.Methods, strings.ToUpper(method))
+		}
+	}
+	if !strings.HasPrefix(fields[3], "/") {
+		return nil, errors.Errorf("invalid rule '%s': path must begin with '/'", rule)
+	}
+	if _, err := path.Match(fields[3], ""); err != nil {
+		return nil, errors.Errorf("invalid rule '%s': %s", rule, err)
+	}
+	r.Path = fields[3]
+	return r, nil
+}
+
+func hasRole(user *authdb.UserContext, role string) bool {
+	if user == nil {
+		return false
+	}
+	for _, r := range user.Roles {
+		if role == "*" || r == role {
+			return true
+		}
+	}
+	return false
+}
+
+func (r *Rule) matchSubject(user *authdb.UserContext) bool {
+	switch {
+	case r.Subject == "*":
+		return true
+	case strings.HasPrefix(r.Subject, "user:"):
+		name := strings.TrimPrefix(r.Subject, "user:")
+		return user != nil && user.Name != "" && (name == "*" || user.Name == name)
+	case strings.HasPrefix(r.Subject, "role:"):
+		return hasRole(user, strings.TrimPrefix(r.Subject, "role:"))
+	}
+	return false
+}
+
+func (r *Rule) matchMethod(method string) bool {
+	if len(r.Methods) == 0 {
+		return true
+	}
+	for _, m := range r.Methods {
+		if m == method {
+			return true
+		}
+	}
+	return false
+}
+
+func (r *Rule) matchPath(p string) bool {
+	if strings.HasSuffix(r.Path, "/*") {
+		prefix := strings.TrimSuffix(r.Path, "/*")
+		parts := strings.Split(strings.TrimPrefix(p, "/"), "/")
+		prefixParts := strings.Split(strings.TrimPrefix(prefix, "/"), "/")
+		if prefix == "" {
+			return true
+		}
+		if len(parts) < len(prefixParts) {
+			return false
+		}
+		ok, _ := path.Match(prefix, "/"+strings.Join(parts[:len(prefixParts)], "/"))
+		return ok
+	}
+	ok, _ := path.Match(r.Path, p)
+	return ok
+}
+
+// Match returns true if the rule applies to the request.
+func (r *Rule) Match(user *authdb.UserContext, method, path string) bool {
+	return r.matchSubject(user) && r.matchMethod(method) && r.matchPath(path)
+}
+
+// Policy is an ordered list of rules.
+type Policy struct {
+	Rules []*Rule
+}
+
+// Parse parses a list of rules into a Policy.
+func Parse(rules []string) (*Policy, error) {
+	p := &Policy{Rules: make([]*Rule, 0, len(rules))}
+	for _, rule := range rules {
+		r, err := ParseRule(rule)
+		if err != nil {
+			return nil, err
+		}
+		p.Rules = append(p.Rules, r)
+	}
+	return p, nil
+}
+
+// Allowed returns true if the policy permits user to perform the request.
+// A nil user represents an anonymous request.
+func (p *Policy) Allowed(user *authdb.UserContext, method, path string) bool {
+	if hasRole(user, "_admin") {
+		return true
+	}
+	for _, rule := range p.Rules {
+		if rule.Match(user, method, path) {
+			return rule.Effect == Allow
+		}
+	}
+	return true
+}
@@ -0,0 +1,77 @@
+package policy
+
+import (
+	"testing"
+
+	"github.com/flimzy/kivik/authdb"
+)
+
+func TestParseRule(t *testing.T) {
+	tests := []struct {
+		name  string
+		input string
+		err   string
+	}{
+		{name: "Valid", input: "allow role:reporting GET,HEAD /analytics/*"},
+		{name: "TooFewFields", input: "allow role:reporting GET", err: "invalid rule 'allow role:reporting GET': expected 4 fields"},
+		{name: "BadEffect", input: "permit * * /", err: "invalid rule 'permit * * /': unknown effect 'permit'"},
+		{name: "BadSubject", input: "allow group:foo * /", err: "invalid rule 'allow group:foo * /': unknown subject 'group:foo'"},
+		{name: "EmptyMethod", input: "allow * GET,,PUT /", err: "invalid rule 'allow * GET,,PUT /': empty method"},
+		{name: "RelativePath", input: "allow * * foo", err: "invalid rule 'allow * * foo': path must begin with '/'"},
+		{name: "BadPattern", input: "allow * * /[", err: "invalid rule 'allow * * /[': syntax error in pattern"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			_, err := ParseRule(test.input)
+			var msg string
+			if err != nil {
+				msg = err.Error()
+			}
+			if msg != test.err {
+				t.Errorf("Unexpected error: %s", msg)
+			}
+		})
+	}
+}
+
+func TestAllowed(t *testing.T) {
+	p, err := Parse([]string{
+		"allow role:reporting GET,HEAD /analytics/*",
+		"deny  role:reporting *        /analytics/*",
+		"deny  *              PUT      /",
+		"deny  user:bob       *        /_config*",
+		"deny  *              *        /private",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	reporter := &authdb.UserContext{Name: "rita", Roles: []string{"reporting"}}
+	bob := &authdb.UserContext{Name: "bob"}
+	admin := &authdb.UserContext{Name: "admin", Roles: []string{"_admin"}}
+	tests := []struct {
+		name     string
+		user     *authdb.UserContext
+		method   string
+		path     string
+		expected bool
+	}{
+		{name: "ReporterGetDB", user: reporter, method: "GET", path: "/analytics", expected: true},
+		{name: "ReporterGetDoc", user: reporter, method: "GET", path: "/analytics/foo", expected: true},
+		{name: "ReporterPutDoc", user: reporter, method: "PUT", path: "/analytics/foo", expected: false},
+		{name: "ReporterOtherDB", user: reporter, method: "PUT", path: "/other/foo", expected: true},
+		{name: "SimilarPrefix", user: reporter, method: "PUT", path: "/analyticsx/foo", expected: true},
+		{name: "AnonPutRoot", method: "PUT", path: "/", expected: false},
+		{name: "AnonGetRoot", method: "GET", path: "/", expected: true},
+		{name: "BobConfig", user: bob, method: "GET", path: "/_config", expected: false},
+		{name: "BobPrivate", user: bob, method: "GET", path: "/private", expected: false},
+		{name: "BobPrivateDoc", user: bob, method: "GET", path: "/private/doc", expected: true},
+		{name: "Admin", user: admin, method: "GET", path: "/private", expected: true},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if result := p.Allowed(test.user, test.method, test.path); result != test.expected {
+				t.Errorf("Expected %t, got %t", test.expected, result)
+			}
+		})
+	}
+}
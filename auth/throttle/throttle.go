@@ -0,0 +1,202 @@
+// Package throttle provides brute-force protection for authentication, by
+// tracking failed login attempts per user name and client address.
+package throttle
+
+import (
+	"sync"
+	"time"
+
+	"github.com/flimzy/kivik"
+	"github.com/flimzy/kivik/errors"
+)
+
+// Default values used when the corresponding Throttle field is unset.
+const (
+	DefaultMaxAttempts     = 10
+	DefaultWindow          = 5 * time.Minute
+	DefaultLockoutDuration = 5 * time.Minute
+)
+
+// maxEntries is the number of tracked entries above which expired entries are
+// swept.
+const maxEntries = 10000
+
+// Throttle tracks failed authentication attempts. Once the number of failures
+// for a user name or client address reaches MaxAttempts within Window, further
+// attempts are refused until LockoutDuration has elapsed. The zero value is
+// ready to use.
+type Throttle struct {
+	// MaxAttempts is the number of failed attempts which triggers a lockout.
+	// Defaults to DefaultMaxAttempts.
+	MaxAttempts int
+	// Window is the period over which failed attempts are counted. Defaults
+	// to DefaultWindow.
+	Window time.Duration
+	// LockoutDuration is the length of a lockout. Defaults to
+	// DefaultLockoutDuration.
+	LockoutDuration time.Duration
+	// Delay is the delay added to the response of a failed attempt, for each
+	// previous consecutive failure. If zero, no delay is added.
+	Delay time.Duration
+	// MaxDelay caps the delay introduced after a failure. If zero, the delay
+	// is not capped.
+	MaxDelay time.Duration
+
+	mu       sync.Mutex
+	entries  map[string]*entry
+	failures int64
+	lockouts int64
+	rejected int64
+
+	now func() time.Time
+}
+
+type entry struct {
+	failures    int
+	first       time.Time
+	lockedUntil time.Time
+}
+
+// Stats holds the counters maintained by a Throttle.
+type Stats struct {
+	// Failures is the total number of failed attempts recorded.
+	Failures int64 `json:"failures"`
+	// Lockouts is the total number of lockouts triggered.
+	Lockouts int64 `json:"lockouts"`
+	// Rejected is the total number of attempts refused due to a lockout.
+	Rejected int64 `json:"rejected"`
+	// Locked is the number of user names and addresses currently locked.
+	Locked int `json:"locked"`
+}
+
+func (t *Throttle) maxAttempts() int {
+	if t.MaxAttempts <= 0 {
+		return DefaultMaxAttempts
+	}
+	return t.MaxAttempts
+}
+
+func (t *Throttle) window() time.Duration {
+	if t.Window <= 0 {
+		return DefaultWindow
+	}
+	return t.Window
+}
+
+func (t *Throttle) lockoutDuration() time.Duration {
+	if t.LockoutDuration <= 0 {
+		return DefaultLockoutDuration
+	}
+	return t.LockoutDuration
+}
+
+func (t *Throttle) time() time.Time {
+	if t.now != nil {
+		return t.now()
+	}
+	return time.Now()
+}
+
+func keys(username, addr string) []string {
+	k := make([]string, 0, 2)
+	if username != "" {
+		k = append(k, "user:"+username)
+	}
+	if addr != "" {
+		k = append(k, "addr:"+addr)
+	}
+	return k
+}
+
+// expired returns true if the entry holds no state relevant at time now.
+func (t *Throttle) expired(e *entry, now time.Time) bool {
+	return now.After(e.lockedUntil) && now.Sub(e.first) > t.window()
+}
+
+// Check returns a Forbidden error if either username or addr is currently
+// locked out.
+func (t *Throttle) Check(username, addr string) error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	now := t.time()
+	for _, key := range keys(username, addr) {
+		if e, ok := t.entries[key]; ok && now.Before(e.lockedUntil) {
+			t.rejected++
+			return errors.Status(kivik.StatusForbidden, "Account is temporarily locked due to multiple authentication failures")
+		}
+	}
+	return nil
+}
+
+// Failure records a failed attempt for username and addr, and returns the
+// delay which should be introduced before responding.
+func (t *Throttle) Failure(username, addr string) time.Duration {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	now := t.time()
+	if t.entries == nil {
+		t.entries = make(map[string]*entry)
+	}
+	if len(t.entries) > maxEntries {
+		t.sweep(now)
+	}
+	t.failures++
+	var count int
+	for _, key := range keys(username, addr) {
+		e, ok := t.entries[key]
+		if !ok || t.expired(e, now) {
+			e = &entry{first: now}
+			t.entries[key] = e
+		}
+		e.failures++
+		if e.failures >= t.maxAttempts() && now.After(e.lockedUntil) {
+			e.lockedUntil = now.Add(t.lockoutDuration())
+			t.lockouts++
+		}
+		if e.failures > count {
+			count = e.failures
+		}
+	}
+	delay := t.Delay * time.Duration(count-1)
+	if t.MaxDelay > 0 && delay > t.MaxDelay {
+		delay = t.MaxDelay
+	}
+	return delay
+}
+
+// Success clears the failure count for username and addr.
+func (t *Throttle) Success(username, addr string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	for _, key := range keys(username, addr) {
+		delete(t.entries, key)
+	}
+}
+
+// sweep removes expired entries. The lock must be held by the caller.
+func (t *Throttle) sweep(now time.Time) {
+	for key, e := range t.entries {
+		if t.expired(e, now) {
+			delete(t.entries, key)
+		}
+	}
+}
+
+// Stats returns the current counters.
+func (t *Throttle) Stats() Stats {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	now := t.time()
+	var locked int
+	for _, e := range t.entries {
+		if now.Before(e.lockedUntil) {
+			locked++
+		}
+	}
+	return Stats{
+		Failures: t.failures,
+		Lockouts: t.lockouts,
+		Rejected: t.rejected,
+		Locked:   locked,
+	}
+}
@@ -0,0 +1,90 @@
+package throttle
+
+import (
+	"testing"
+	"time"
+
+	"github.com/flimzy/diff"
+	"github.com/flimzy/kivik/errors"
+)
+
+type clock struct {
+	t time.Time
+}
+
+func (c *clock) now() time.Time          { return c.t }
+func (c *clock) advance(d time.Duration) { c.t = c.t.Add(d) }
+
+func newTestThrottle() (*Throttle, *clock) {
+	c := &clock{t: time.Date(2017, 1, 1, 0, 0, 0, 0, time.UTC)}
+	return &Throttle{
+		MaxAttempts:     3,
+		Window:          time.Minute,
+		LockoutDuration: 10 * time.Minute,
+		Delay:           time.Second,
+		MaxDelay:        time.Second,
+		now:             c.now,
+	}, c
+}
+
+func TestLockout(t *testing.T) {
+	th, c := newTestThrottle()
+	for i := 0; i < 3; i++ {
+		if err := th.Check("bob", "1.2.3.4"); err != nil {
+			t.Fatalf("Unexpected lockout after %d failures: %s", i, err)
+		}
+		th.Failure("bob", "1.2.3.4")
+	}
+	if err := th.Check("bob", "5.6.7.8"); errors.StatusCode(err) != 403 {
+		t.Errorf("Expected user lockout, got %v", err)
+	}
+	if err := th.Check("alice", "1.2.3.4"); errors.StatusCode(err) != 403 {
+		t.Errorf("Expected address lockout, got %v", err)
+	}
+	if err := th.Check("alice", "5.6.7.8"); err != nil {
+		t.Errorf("Unexpected lockout: %s", err)
+	}
+	c.advance(11 * time.Minute)
+	if err := th.Check("bob", "1.2.3.4"); err != nil {
+		t.Errorf("Lockout should have expired: %s", err)
+	}
+	expected := Stats{Failures: 3, Lockouts: 2, Rejected: 2}
+	if d := diff.Interface(expected, th.Stats()); d != "" {
+		t.Error(d)
+	}
+}
+
+func TestWindow(t *testing.T) {
+	th, c := newTestThrottle()
+	th.Failure("bob", "")
+	th.Failure("bob", "")
+	c.advance(2 * time.Minute)
+	th.Failure("bob", "")
+	if err := th.Check("bob", ""); err != nil {
+		t.Errorf("Failures outside the window should not count: %s", err)
+	}
+}
+
+func TestSuccess(t *testing.T) {
+	th, _ := newTestThrottle()
+	th.Failure("bob", "")
+	th.Failure("bob", "")
+	th.Success("bob", "")
+	th.Failure("bob", "")
+	if err := th.Check("bob", ""); err != nil {
+		t.Errorf("Success should reset the failure count: %s", err)
+	}
+}
+
+func TestDelay(t *testing.T) {
+	th, _ := newTestThrottle()
+	if d := th.Failure("bob", ""); d != 0 {
+		t.Errorf("Expected no delay after first failure, got %s", d)
+	}
+	if d := th.Failure("bob", ""); d != time.Second {
+		t.Errorf("Expected 1s delay, got %s", d)
+	}
+	if d := th.Failure("bob", ""); d != time.Second {
+		t.Errorf("Expected delay capped at 1s, got %s", d)
+	}
+}
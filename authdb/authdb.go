@@ -41,6 +41,22 @@ type UserContext struct {
 	Salt string `json:"-"`
 }
 
+type userContextKey struct{}
+
+// NewContext returns a copy of ctx carrying user, the user on whose behalf an
+// operation is performed. The serve package attaches the authenticated user to
+// the context of each request, so that drivers may enforce per-user validation,
+// or record the user who modified a document.
+func NewContext(ctx context.Context, user *UserContext) context.Context {
+	return context.WithValue(ctx, userContextKey{}, user)
+}
+
+// FromContext returns the user carried by ctx, if any.
+func FromContext(ctx context.Context) (*UserContext, bool) {
+	user, ok := ctx.Value(userContextKey{}).(*UserContext)
+	return user, ok && user != nil
+}
+
 // ValidatePBKDF2 returns true if the calculated hash matches the derivedKey.
 func ValidatePBKDF2(password, salt, derivedKey string, iterations int) bool {
 	hash := fmt.Sprintf("%x", pbkdf2.Key([]byte(password), []byte(salt), iterations, PBKDF2KeyLength, sha1.New))
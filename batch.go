@@ -0,0 +1,24 @@
+package kivik
+
+import "github.com/flimzy/kivik/errors"
+
+// BatchOK is the only valid value of the batch option.
+const BatchOK = "ok"
+
+// Batch returns options which enable batch mode for Put or CreateDoc. In batch
+// mode, the server acknowledges the write before it is committed, trading
+// durability for throughput: the write may be lost, and conflicts are not
+// reported. No revision is returned. Use Flush to commit the batched writes.
+//
+// See http://docs.couchdb.org/en/2.0.0/api/database/common.html#batch-mode-writes
+func Batch() Options {
+	return Options{"batch": BatchOK}
+}
+
+// checkBatch validates the batch option, if present.
+func checkBatch(opts Options) error {
+	if value, ok := opts["batch"]; ok && value != BatchOK {
+		return errors.Statusf(StatusBadRequest, "kivik: invalid batch option %v", value)
+	}
+	return nil
+}
@@ -0,0 +1,29 @@
+package kivik
+
+import (
+	"context"
+	"testing"
+)
+
+func TestBatchOptions(t *testing.T) {
+	ctx := context.Background()
+	db := &DB{driverDB: &dummyDB{}}
+	tests := []struct {
+		name   string
+		opts   Options
+		status int
+	}{
+		{name: "Invalid", opts: Options{"batch": true}, status: StatusBadRequest},
+		{name: "NotSupported", opts: Batch(), status: StatusNotImplemented},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if _, _, err := db.CreateDoc(ctx, map[string]string{}, test.opts); StatusCode(err) != test.status {
+				t.Errorf("CreateDoc: unexpected error: %v", err)
+			}
+			if _, err := db.Put(ctx, "foo", map[string]string{}, test.opts); StatusCode(err) != test.status {
+				t.Errorf("Put: unexpected error: %v", err)
+			}
+		})
+	}
+}
@@ -87,7 +87,11 @@ func (r *BulkResults) UpdateErr() error {
 //
 // As with Put, each individual document may be a JSON-marshable object, or a
 // raw JSON string in a []byte, json.RawMessage, or io.Reader.
-func (db *DB) BulkDocs(ctx context.Context, docs interface{}) (*BulkResults, error) {
+//
+// Options, such as new_edits, are included in the request body. If options are
+// given, and the driver does not support them, an error with status
+// StatusNotImplemented is returned.
+func (db *DB) BulkDocs(ctx context.Context, docs interface{}, options ...Options) (*BulkResults, error) {
 	docsi, err := docsInterfaceSlice(docs)
 	if err != nil {
 		if _, ok := err.(errNotSlice); ok {
@@ -95,11 +99,51 @@ func (db *DB) BulkDocs(ctx context.Context, docs interface{}) (*BulkResults, err
 		}
 		return nil, err
 	}
-	bulki, err := db.driverDB.BulkDocs(ctx, docsi)
+	opts, err := db.options(ctx, "BulkDocs", options...)
 	if err != nil {
 		return nil, err
 	}
-	return newBulkResults(ctx, bulki), nil
+	if err = checkQuorum(db.driverDB, opts); err != nil {
+		return nil, err
+	}
+	for i, doc := range docsi {
+		if docsi[i], err = db.beforePut(ctx, "", doc); err != nil {
+			return nil, err
+		}
+	}
+	ctx, cancel := withTimeout(ctx, db.timeouts.Write)
+	bulki, err := db.bulkDocs(ctx, docsi, opts)
+	if err != nil {
+		cancel()
+		return nil, err
+	}
+	if db.strict {
+		bulki = &strictBulkResults{bulki}
+	}
+	results := newBulkResults(ctx, bulki)
+	results.releaseOnClose(cancel)
+	return results, nil
+}
+
+func (db *DB) bulkDocs(ctx context.Context, docs []interface{}, opts Options) (driver.BulkResults, error) {
+	result, err := db.invoke(ctx, &Operation{Name: "BulkDocs", Options: opts}, func(ctx context.Context, op *Operation) (interface{}, error) {
+		if len(op.Options) > 0 {
+			bulkDocer, ok := db.driverDB.(driver.OptsBulkDocer)
+			if !ok {
+				return nil, errors.Status(StatusNotImplemented, "kivik: driver does not support BulkDocs options")
+			}
+			return bulkDocer.BulkDocsOpts(ctx, docs, op.Options)
+		}
+		return db.driverDB.BulkDocs(ctx, docs)
+	})
+	if err != nil {
+		return nil, err
+	}
+	bulki, ok := result.(driver.BulkResults)
+	if !ok {
+		return nil, unexpectedResult("BulkDocs", result)
+	}
+	return bulki, nil
 }
 
 type errNotSlice struct {
@@ -1,9 +1,11 @@
 package kivik
 
 import (
+	"context"
 	"testing"
 
 	"github.com/flimzy/diff"
+	"github.com/flimzy/kivik/driver"
 )
 
 func TestDocsInterfaceSlice(t *testing.T) {
@@ -103,3 +105,33 @@ func TestDocsInterfaceSlice(t *testing.T) {
 		}(test)
 	}
 }
+
+type optsBulkDocer struct {
+	dummyDB
+	opts map[string]interface{}
+}
+
+func (db *optsBulkDocer) BulkDocsOpts(_ context.Context, _ []interface{}, opts map[string]interface{}) (driver.BulkResults, error) {
+	db.opts = opts
+	return &dumpBulkResults{}, nil
+}
+
+func TestBulkDocsOptions(t *testing.T) {
+	docs := []interface{}{map[string]string{"_id": "foo"}}
+	t.Run("NotSupported", func(t *testing.T) {
+		db := &DB{driverDB: &dummyDB{}}
+		if _, err := db.BulkDocs(context.Background(), docs, Options{"new_edits": false}); StatusCode(err) != StatusNotImplemented {
+			t.Errorf("Expected NotImplemented, got %v", err)
+		}
+	})
+	t.Run("Supported", func(t *testing.T) {
+		driverDB := &optsBulkDocer{}
+		db := &DB{driverDB: driverDB}
+		if _, err := db.BulkDocs(context.Background(), docs, Options{"new_edits": false}); err != nil {
+			t.Fatal(err)
+		}
+		if d := diff.Interface(map[string]interface{}{"new_edits": false}, driverDB.opts); d != "" {
+			t.Error(d)
+		}
+	})
+}
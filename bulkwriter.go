@@ -0,0 +1,198 @@
+package kivik
+
+import (
+	"context"
+	"sync"
+
+	"github.com/flimzy/kivik/errors"
+)
+
+// Defaults for BulkWriterOptions.
+const (
+	DefaultBulkBatchSize   = 100
+	DefaultBulkConcurrency = 4
+)
+
+// BulkWriterOptions configures a BulkWriter.
+type BulkWriterOptions struct {
+	// BatchSize is the maximum number of documents sent in a single BulkDocs
+	// request. Defaults to DefaultBulkBatchSize.
+	BatchSize int
+	// Concurrency is the maximum number of BulkDocs requests in flight at
+	// once. Defaults to DefaultBulkConcurrency.
+	Concurrency int
+}
+
+// BulkWriteResult is the result of writing a single document with a
+// BulkWriter.
+type BulkWriteResult struct {
+	// Doc is the document, as passed to Add.
+	Doc interface{}
+	ID  string
+	Rev string
+	// Error is the error for this document, or for the request which included
+	// it, or nil on success.
+	Error error
+}
+
+// BulkWriter writes documents in batches with BulkDocs, with a bounded number
+// of concurrent requests. Documents are queued with Add or Feed, and the
+// result for each document is delivered on the Results channel. Results are
+// not necessarily delivered in the order the documents were added.
+//
+// The Results channel must be drained, or the writer will block once its
+// buffers are full. Call Close once all documents have been added; the Results
+// channel is closed when all pending writes have completed.
+type BulkWriter struct {
+	db      *DB
+	ctx     context.Context
+	opts    BulkWriterOptions
+	docs    chan interface{}
+	batches chan []interface{}
+	results chan BulkWriteResult
+	wg      sync.WaitGroup
+
+	mu     sync.RWMutex
+	closed bool
+}
+
+// NewBulkWriter returns a new BulkWriter for the database. Canceling ctx
+// aborts all pending writes.
+func (db *DB) NewBulkWriter(ctx context.Context, opts BulkWriterOptions) *BulkWriter {
+	if opts.BatchSize <= 0 {
+		opts.BatchSize = DefaultBulkBatchSize
+	}
+	if opts.Concurrency <= 0 {
+		opts.Concurrency = DefaultBulkConcurrency
+	}
+	w := &BulkWriter{
+		db:      db,
+		ctx:     ctx,
+		opts:    opts,
+		docs:    make(chan interface{}, opts.BatchSize),
+		batches: make(chan []interface{}),
+		results: make(chan BulkWriteResult, opts.BatchSize),
+	}
+	go w.batch()
+	w.wg.Add(opts.Concurrency)
+	for i := 0; i < opts.Concurrency; i++ {
+		go w.work()
+	}
+	go func() {
+		w.wg.Wait()
+		close(w.results)
+	}()
+	return w
+}
+
+var errBulkWriterClosed = errors.Status(StatusBadRequest, "kivik: BulkWriter is closed")
+
+// Add queues doc to be written. doc may be any value accepted by Put. Add
+// blocks while the writer's buffers are full.
+func (w *BulkWriter) Add(doc interface{}) error {
+	w.mu.RLock()
+	defer w.mu.RUnlock()
+	if w.closed {
+		return errBulkWriterClosed
+	}
+	select {
+	case w.docs <- doc:
+		return nil
+	case <-w.ctx.Done():
+		return w.ctx.Err()
+	}
+}
+
+// Feed adds each document received from docs, until docs is closed or an
+// error occurs. It does not close the writer.
+func (w *BulkWriter) Feed(docs <-chan interface{}) error {
+	for doc := range docs {
+		if err := w.Add(doc); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Results returns the channel on which the result of each write is
+// delivered.
+func (w *BulkWriter) Results() <-chan BulkWriteResult {
+	return w.results
+}
+
+// Close flushes any partial batch, and stops accepting documents. It does not
+// wait for pending writes to complete; the Results channel is closed when they
+// have. Calling Close more than once has no effect.
+func (w *BulkWriter) Close() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if !w.closed {
+		w.closed = true
+		close(w.docs)
+	}
+	return nil
+}
+
+// batch collects queued documents into batches, until the docs channel is
+// closed.
+func (w *BulkWriter) batch() {
+	defer close(w.batches)
+	batch := make([]interface{}, 0, w.opts.BatchSize)
+	for doc := range w.docs {
+		batch = append(batch, doc)
+		if len(batch) == w.opts.BatchSize {
+			w.batches <- batch
+			batch = make([]interface{}, 0, w.opts.BatchSize)
+		}
+	}
+	if len(batch) > 0 {
+		w.batches <- batch
+	}
+}
+
+func (w *BulkWriter) work() {
+	defer w.wg.Done()
+	for batch := range w.batches {
+		w.write(batch)
+	}
+}
+
+// write sends a single batch, and reports the result of each document. The
+// results of a BulkDocs request are in the same order as the documents.
+func (w *BulkWriter) write(batch []interface{}) {
+	var reported int
+	fail := func(err error) {
+		for _, doc := range batch[reported:] {
+			w.results <- BulkWriteResult{Doc: doc, Error: err}
+		}
+	}
+	if err := w.ctx.Err(); err != nil {
+		fail(err)
+		return
+	}
+	docs := make([]interface{}, len(batch))
+	copy(docs, batch)
+	results, err := w.db.BulkDocs(w.ctx, docs)
+	if err != nil {
+		fail(err)
+		return
+	}
+	defer results.Close()
+	for reported < len(batch) && results.Next() {
+		w.results <- BulkWriteResult{
+			Doc:   batch[reported],
+			ID:    results.ID(),
+			Rev:   results.Rev(),
+			Error: results.UpdateErr(),
+		}
+		reported++
+	}
+	if reported == len(batch) {
+		return
+	}
+	err = results.Err()
+	if err == nil {
+		err = errors.Status(StatusInternalServerError, "kivik: BulkDocs returned too few results")
+	}
+	fail(err)
+}
@@ -0,0 +1,132 @@
+package kivik
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"sync"
+	"testing"
+
+	"github.com/flimzy/diff"
+	"github.com/flimzy/kivik/driver"
+)
+
+// bulkDB records the size of each BulkDocs request, and returns a result for
+// each doc, with an error for docs with an "error" field.
+type bulkDB struct {
+	dummyDB
+	mu      sync.Mutex
+	batches []int
+	err     error
+}
+
+func (db *bulkDB) BulkDocs(_ context.Context, docs []interface{}) (driver.BulkResults, error) {
+	db.mu.Lock()
+	db.batches = append(db.batches, len(docs))
+	db.mu.Unlock()
+	if db.err != nil {
+		return nil, db.err
+	}
+	results := make([]driver.BulkResult, len(docs))
+	for i, doc := range docs {
+		d := doc.(map[string]string)
+		results[i] = driver.BulkResult{ID: d["_id"], Rev: "1-xxx"}
+		if msg, ok := d["error"]; ok {
+			results[i] = driver.BulkResult{ID: d["_id"], Error: errors.New(msg)}
+		}
+	}
+	return &bulkResultSet{results: results}, nil
+}
+
+type bulkResultSet struct {
+	results []driver.BulkResult
+}
+
+func (r *bulkResultSet) Next(result *driver.BulkResult) error {
+	if len(r.results) == 0 {
+		return io.EOF
+	}
+	*result = r.results[0]
+	r.results = r.results[1:]
+	return nil
+}
+
+func (r *bulkResultSet) Close() error { return nil }
+
+func collect(w *BulkWriter) (ids []string, errs map[string]string) {
+	errs = make(map[string]string)
+	for result := range w.Results() {
+		id := result.Doc.(map[string]string)["_id"]
+		if result.ID != id && result.Error == nil {
+			errs[id] = fmt.Sprintf("result ID %q does not match doc", result.ID)
+		}
+		if result.Error != nil {
+			errs[id] = result.Error.Error()
+		}
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	return ids, errs
+}
+
+func TestBulkWriter(t *testing.T) {
+	bdb := &bulkDB{}
+	db := &DB{driverDB: bdb}
+	w := db.NewBulkWriter(context.Background(), BulkWriterOptions{BatchSize: 3, Concurrency: 2})
+	docs := make(chan interface{})
+	go func() {
+		defer close(docs)
+		for i := 0; i < 5; i++ {
+			docs <- map[string]string{"_id": fmt.Sprintf("doc%d", i)}
+		}
+	}()
+	go func() {
+		if err := w.Feed(docs); err != nil {
+			t.Error(err)
+		}
+		if err := w.Add(map[string]string{"_id": "doc5", "error": "conflict"}); err != nil {
+			t.Error(err)
+		}
+		if err := w.Add(map[string]string{"_id": "doc6"}); err != nil {
+			t.Error(err)
+		}
+		_ = w.Close()
+	}()
+	ids, errs := collect(w)
+	expectedIDs := []string{"doc0", "doc1", "doc2", "doc3", "doc4", "doc5", "doc6"}
+	if d := diff.Interface(expectedIDs, ids); d != "" {
+		t.Errorf("Unexpected results:\n%s", d)
+	}
+	if d := diff.Interface(map[string]string{"doc5": "conflict"}, errs); d != "" {
+		t.Errorf("Unexpected errors:\n%s", d)
+	}
+	sort.Ints(bdb.batches)
+	if d := diff.Interface([]int{1, 3, 3}, bdb.batches); d != "" {
+		t.Errorf("Unexpected batches:\n%s", d)
+	}
+	if err := w.Add(map[string]string{}); StatusCode(err) != StatusBadRequest {
+		t.Errorf("Unexpected error adding to closed writer: %v", err)
+	}
+}
+
+func TestBulkWriterRequestError(t *testing.T) {
+	db := &DB{driverDB: &bulkDB{err: errors.New("connection refused")}}
+	w := db.NewBulkWriter(context.Background(), BulkWriterOptions{BatchSize: 2})
+	go func() {
+		for i := 0; i < 3; i++ {
+			_ = w.Add(map[string]string{"_id": fmt.Sprintf("doc%d", i)})
+		}
+		_ = w.Close()
+	}()
+	_, errs := collect(w)
+	expected := map[string]string{
+		"doc0": "connection refused",
+		"doc1": "connection refused",
+		"doc2": "connection refused",
+	}
+	if d := diff.Interface(expected, errs); d != "" {
+		t.Error(d)
+	}
+}
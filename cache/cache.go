@@ -0,0 +1,337 @@
+// Package cache provides a Kivik driver which wraps another driver, and caches
+// document reads in memory.
+//
+// Documents fetched with Get are cached by document ID and revision. As a
+// revision's content never changes, a request for a specific revision may
+// always be served from the cache. Requests for the current revision are
+// served from the cache until the document is invalidated, either by a write
+// through the same client, or, if Options.Watch is set, by a changes feed
+// event. Optionally, view results may be cached by the database's update
+// sequence.
+//
+//	cache.Register("couch-cached", "couch", cache.Options{Size: 10000, Watch: true})
+//	client, err := kivik.New(context.TODO(), "couch-cached", "http://localhost:5984/")
+//
+// The cache is not shared between clients. Writes made by other clients are
+// only noticed by way of the changes feed.
+package cache
+
+import (
+	"context"
+	"fmt"
+	"sync"
+
+	"github.com/flimzy/kivik"
+	"github.com/flimzy/kivik/driver"
+	"github.com/flimzy/kivik/errors"
+)
+
+// DefaultSize is the default maximum number of cached entries per client.
+const DefaultSize = 1000
+
+// Options configures a caching driver.
+type Options struct {
+	// Size is the maximum number of documents and view results cached by each
+	// client. The least recently used entries are evicted first. Defaults to
+	// DefaultSize.
+	Size int
+	// Views enables caching of view results, keyed by the database's update
+	// sequence. Each query then requires an additional request for the
+	// database's update sequence. Results are not cached for drivers which do
+	// not report an update sequence.
+	Views bool
+	// Watch enables invalidation of cached documents by following the changes
+	// feed of each database. Each client follows a single feed per database,
+	// from the first call to its DB method, until the feed ends or the
+	// database is destroyed through the client. Where the underlying driver
+	// does not support the changes feed, only writes through the same client
+	// invalidate the cache.
+	Watch bool
+}
+
+type cacheDriver struct {
+	drv  driver.Driver
+	opts Options
+}
+
+var _ driver.Driver = &cacheDriver{}
+
+// New returns a driver which wraps drv with a cache.
+func New(drv driver.Driver, opts Options) driver.Driver {
+	if opts.Size <= 0 {
+		opts.Size = DefaultSize
+	}
+	return &cacheDriver{drv: drv, opts: opts}
+}
+
+// Register registers a caching version of the driver registered as wrapped,
+// under the new name name.
+func Register(name, wrapped string, opts Options) error {
+	drv, ok := kivik.LookupDriver(wrapped)
+	if !ok {
+		return errors.Statusf(kivik.StatusBadRequest, "cache: unknown driver %q (forgotten import?)", wrapped)
+	}
+	kivik.Register(name, New(drv, opts))
+	return nil
+}
+
+func (d *cacheDriver) NewClient(ctx context.Context, dsn string) (driver.Client, error) {
+	c, err := d.drv.NewClient(ctx, dsn)
+	if err != nil {
+		return nil, err
+	}
+	return &client{
+		client:      c,
+		opts:        d.opts,
+		cache:       newLRU(d.opts.Size),
+		generations: make(map[string]int),
+		watchers:    make(map[string]*watcher),
+	}, nil
+}
+
+func notImplemented(iface string) error {
+	return errors.Statusf(kivik.StatusNotImplemented, "kivik: driver does not implement %s", iface)
+}
+
+type client struct {
+	client driver.Client
+	opts   Options
+	cache  *lru
+
+	mu sync.Mutex
+	// generations is incremented for a database to invalidate all of its
+	// cached entries at once, such as when it is destroyed.
+	generations map[string]int
+	// watchers are the changes feeds followed, by database, if Options.Watch
+	// is set.
+	watchers map[string]*watcher
+}
+
+// watcher follows the changes feed of a database.
+type watcher struct {
+	cancel context.CancelFunc
+}
+
+var _ driver.Client = &client{}
+var _ driver.ClientReplicator = &client{}
+var _ driver.Authenticator = &client{}
+var _ driver.DBUpdater = &client{}
+var _ driver.PoolStatser = &client{}
+var _ driver.AdminPartyChecker = &client{}
+var _ driver.DiskUsager = &client{}
+var _ driver.Configer = &client{}
+var _ driver.Clusterer = &client{}
+var _ driver.OptionValidator = &client{}
+
+// prefix returns the cache key prefix for the current generation of dbName.
+func (c *client) prefix(dbName string) string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return fmt.Sprintf("%d\x00%s\x00", c.generations[dbName], dbName)
+}
+
+// invalidateDB invalidates all cached entries for dbName.
+func (c *client) invalidateDB(dbName string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.generations[dbName]++
+}
+
+func (c *client) Version(ctx context.Context) (*driver.Version, error) {
+	return c.client.Version(ctx)
+}
+
+func (c *client) AllDBs(ctx context.Context, opts map[string]interface{}) ([]string, error) {
+	return c.client.AllDBs(ctx, opts)
+}
+
+func (c *client) DBExists(ctx context.Context, dbName string, opts map[string]interface{}) (bool, error) {
+	return c.client.DBExists(ctx, dbName, opts)
+}
+
+func (c *client) CreateDB(ctx context.Context, dbName string, opts map[string]interface{}) error {
+	c.invalidateDB(dbName)
+	return c.client.CreateDB(ctx, dbName, opts)
+}
+
+func (c *client) DestroyDB(ctx context.Context, dbName string, opts map[string]interface{}) error {
+	err := c.client.DestroyDB(ctx, dbName, opts)
+	c.invalidateDB(dbName)
+	c.mu.Lock()
+	if w, ok := c.watchers[dbName]; ok {
+		w.cancel()
+		delete(c.watchers, dbName)
+	}
+	c.mu.Unlock()
+	return err
+}
+
+func (c *client) DB(ctx context.Context, dbName string, opts map[string]interface{}) (driver.DB, error) {
+	d, err := c.client.DB(ctx, dbName, opts)
+	if err != nil {
+		return nil, err
+	}
+	cdb := &db{client: c, name: dbName, db: d}
+	if c.opts.Watch {
+		c.startWatch(cdb)
+	}
+	return cdb, nil
+}
+
+// startWatch follows the changes feed of d, unless that of the database is
+// already followed. The feed is owned by the client, rather than bound to the
+// context of any one DB call.
+func (c *client) startWatch(d *db) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if _, ok := c.watchers[d.name]; ok {
+		return
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	w := &watcher{cancel: cancel}
+	c.watchers[d.name] = w
+	go func() {
+		d.watch(ctx)
+		cancel()
+		c.mu.Lock()
+		if c.watchers[d.name] == w {
+			delete(c.watchers, d.name)
+		}
+		c.mu.Unlock()
+	}()
+}
+
+func (c *client) Replicate(ctx context.Context, targetDSN, sourceDSN string, opts map[string]interface{}) (driver.Replication, error) {
+	if r, ok := c.client.(driver.ClientReplicator); ok {
+		return r.Replicate(ctx, targetDSN, sourceDSN, opts)
+	}
+	return nil, notImplemented("ClientReplicator")
+}
+
+func (c *client) GetReplications(ctx context.Context, opts map[string]interface{}) ([]driver.Replication, error) {
+	if r, ok := c.client.(driver.ClientReplicator); ok {
+		return r.GetReplications(ctx, opts)
+	}
+	return nil, notImplemented("ClientReplicator")
+}
+
+func (c *client) Authenticate(ctx context.Context, authenticator interface{}) error {
+	if a, ok := c.client.(driver.Authenticator); ok {
+		return a.Authenticate(ctx, authenticator)
+	}
+	return notImplemented("Authenticator")
+}
+
+func (c *client) DBUpdates() (driver.DBUpdates, error) {
+	if u, ok := c.client.(driver.DBUpdater); ok {
+		return u.DBUpdates()
+	}
+	return nil, notImplemented("DBUpdater")
+}
+
+func (c *client) PoolStats() (driver.PoolStats, error) {
+	if s, ok := c.client.(driver.PoolStatser); ok {
+		return s.PoolStats()
+	}
+	return driver.PoolStats{}, notImplemented("PoolStatser")
+}
+
+func (c *client) AdminParty(ctx context.Context) (bool, error) {
+	if a, ok := c.client.(driver.AdminPartyChecker); ok {
+		return a.AdminParty(ctx)
+	}
+	return false, notImplemented("AdminPartyChecker")
+}
+
+func (c *client) DiskUsage(ctx context.Context) (*driver.DiskUsage, error) {
+	u, ok := c.client.(driver.DiskUsager)
+	if !ok {
+		return nil, notImplemented("DiskUsager")
+	}
+	return u.DiskUsage(ctx)
+}
+
+func (c *client) configer() (driver.Configer, error) {
+	if configer, ok := c.client.(driver.Configer); ok {
+		return configer, nil
+	}
+	return nil, notImplemented("Configer")
+}
+
+func (c *client) Config(ctx context.Context, node string) (driver.Config, error) {
+	configer, err := c.configer()
+	if err != nil {
+		return nil, err
+	}
+	return configer.Config(ctx, node)
+}
+
+func (c *client) ConfigSection(ctx context.Context, node, section string) (driver.ConfigSection, error) {
+	configer, err := c.configer()
+	if err != nil {
+		return nil, err
+	}
+	return configer.ConfigSection(ctx, node, section)
+}
+
+func (c *client) ConfigValue(ctx context.Context, node, section, key string) (string, error) {
+	configer, err := c.configer()
+	if err != nil {
+		return "", err
+	}
+	return configer.ConfigValue(ctx, node, section, key)
+}
+
+func (c *client) SetConfigValue(ctx context.Context, node, section, key, value string) (string, error) {
+	configer, err := c.configer()
+	if err != nil {
+		return "", err
+	}
+	return configer.SetConfigValue(ctx, node, section, key, value)
+}
+
+func (c *client) DeleteConfigKey(ctx context.Context, node, section, key string) (string, error) {
+	configer, err := c.configer()
+	if err != nil {
+		return "", err
+	}
+	return configer.DeleteConfigKey(ctx, node, section, key)
+}
+
+func (c *client) clusterer() (driver.Clusterer, error) {
+	if clusterer, ok := c.client.(driver.Clusterer); ok {
+		return clusterer, nil
+	}
+	return nil, notImplemented("Clusterer")
+}
+
+func (c *client) Membership(ctx context.Context) (*driver.Membership, error) {
+	clusterer, err := c.clusterer()
+	if err != nil {
+		return nil, err
+	}
+	return clusterer.Membership(ctx)
+}
+
+func (c *client) AddNode(ctx context.Context, node string) error {
+	clusterer, err := c.clusterer()
+	if err != nil {
+		return err
+	}
+	return clusterer.AddNode(ctx, node)
+}
+
+func (c *client) RemoveNode(ctx context.Context, node string) error {
+	clusterer, err := c.clusterer()
+	if err != nil {
+		return err
+	}
+	return clusterer.RemoveNode(ctx, node)
+}
+
+func (c *client) SupportedOptions(method string) (map[string]driver.OptionType, bool) {
+	if v, ok := c.client.(driver.OptionValidator); ok {
+		return v.SupportedOptions(method)
+	}
+	return nil, false
+}
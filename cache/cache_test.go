@@ -0,0 +1,309 @@
+package cache
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"sync"
+	"testing"
+
+	"github.com/flimzy/diff"
+	"github.com/flimzy/kivik"
+	"github.com/flimzy/kivik/driver"
+	_ "github.com/flimzy/kivik/driver/memory"
+)
+
+// countingDB counts calls to the underlying database.
+type countingDB struct {
+	driver.DB
+	mu      sync.Mutex
+	gets    int
+	queries int
+	seq     string
+	doc     string
+	changes chan string
+}
+
+func (d *countingDB) Get(_ context.Context, docID string, opts map[string]interface{}) (json.RawMessage, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.gets++
+	return json.RawMessage(d.doc), nil
+}
+
+func (d *countingDB) Put(_ context.Context, docID string, doc interface{}) (string, error) {
+	return "2-xxx", nil
+}
+
+func (d *countingDB) Stats(_ context.Context) (*driver.DBStats, error) {
+	return &driver.DBStats{UpdateSeq: d.seq}, nil
+}
+
+func (d *countingDB) Query(_ context.Context, ddoc, view string, opts map[string]interface{}) (driver.Rows, error) {
+	d.queries++
+	return &cachedRows{viewResult: &viewResult{
+		rows:      []driver.Row{{ID: "foo", Key: json.RawMessage(`"foo"`)}},
+		totalRows: 1,
+	}}, nil
+}
+
+func (d *countingDB) Changes(_ context.Context, _ map[string]interface{}) (driver.Changes, error) {
+	return &testChanges{ch: d.changes}, nil
+}
+
+type testChanges struct {
+	ch chan string
+}
+
+func (c *testChanges) Next(change *driver.Change) error {
+	id, ok := <-c.ch
+	if !ok {
+		return io.EOF
+	}
+	change.ID = id
+	return nil
+}
+
+func (c *testChanges) Close() error { return nil }
+
+func (d *countingDB) DesignInfo(_ context.Context, ddoc string) (*driver.DesignInfo, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return &driver.DesignInfo{Name: ddoc, UpdateSeq: d.seq}, nil
+}
+
+func newTestDB(opts Options) (*db, *countingDB) {
+	under := &countingDB{doc: `{"_id":"foo","_rev":"1-xxx"}`, seq: "1-aaa", changes: make(chan string)}
+	c := &client{opts: opts, cache: newLRU(10), generations: make(map[string]int), watchers: make(map[string]*watcher)}
+	return &db{client: c, name: "db", db: under}, under
+}
+
+func TestGet(t *testing.T) {
+	d, under := newTestDB(Options{})
+	ctx := context.Background()
+	type step struct {
+		name  string
+		do    func() error
+		calls int
+	}
+	get := func(opts map[string]interface{}) func() error {
+		return func() error {
+			doc, err := d.Get(ctx, "foo", opts)
+			if err == nil && string(doc) != under.doc {
+				t.Errorf("Unexpected doc: %s", doc)
+			}
+			return err
+		}
+	}
+	steps := []step{
+		{name: "Initial", do: get(nil), calls: 1},
+		{name: "Cached", do: get(nil), calls: 1},
+		{name: "CurrentRev", do: get(map[string]interface{}{"rev": "1-xxx"}), calls: 1},
+		{name: "OtherRev", do: get(map[string]interface{}{"rev": "1-yyy"}), calls: 2},
+		{name: "OtherOptions", do: get(map[string]interface{}{"attachments": true}), calls: 3},
+		{name: "Put", do: func() error {
+			_, err := d.Put(ctx, "foo", map[string]string{})
+			return err
+		}, calls: 3},
+		{name: "AfterPut", do: get(nil), calls: 4},
+		{name: "OldRevAfterPut", do: get(map[string]interface{}{"rev": "1-xxx"}), calls: 4},
+	}
+	for _, s := range steps {
+		if err := s.do(); err != nil {
+			t.Fatalf("%s: %s", s.name, err)
+		}
+		if under.gets != s.calls {
+			t.Errorf("%s: Expected %d calls, got %d", s.name, s.calls, under.gets)
+		}
+	}
+}
+
+func TestWatch(t *testing.T) {
+	d, under := newTestDB(Options{Watch: true})
+	ctx := context.Background()
+	done := make(chan struct{})
+	go func() {
+		d.watch(ctx)
+		close(done)
+	}()
+	if _, err := d.Get(ctx, "foo", nil); err != nil {
+		t.Fatal(err)
+	}
+	under.changes <- "foo"
+	close(under.changes)
+	<-done
+	if _, err := d.Get(ctx, "foo", nil); err != nil {
+		t.Fatal(err)
+	}
+	if under.gets != 2 {
+		t.Errorf("Expected 2 calls, got %d", under.gets)
+	}
+}
+
+// testClient returns the same database for every DB call.
+type testClient struct {
+	driver.Client
+	db driver.DB
+}
+
+func (c *testClient) DB(_ context.Context, _ string, _ map[string]interface{}) (driver.DB, error) {
+	return c.db, nil
+}
+
+func TestWatchPerDB(t *testing.T) {
+	d, under := newTestDB(Options{Watch: true})
+	c := d.client
+	c.client = &testClient{db: under}
+	defer close(under.changes)
+	ctx, cancel := context.WithCancel(context.Background())
+	if _, err := c.DB(ctx, "db", nil); err != nil {
+		t.Fatal(err)
+	}
+	cancel()
+	if _, err := c.DB(context.Background(), "db", nil); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := d.Get(context.Background(), "foo", nil); err != nil {
+		t.Fatal(err)
+	}
+	// The feed, which outlives the context of the first call, is read once.
+	under.changes <- "foo"
+	c.mu.Lock()
+	watchers := len(c.watchers)
+	c.mu.Unlock()
+	if watchers != 1 {
+		t.Errorf("Expected 1 watcher, got %d", watchers)
+	}
+}
+
+func TestQuery(t *testing.T) {
+	ctx := context.Background()
+	query := func(d *db) {
+		rows, err := d.Query(ctx, "ddoc", "view", map[string]interface{}{"limit": 1})
+		if err != nil {
+			t.Fatal(err)
+		}
+		result := readRows(rows)
+		if d := diff.Interface([]driver.Row{{ID: "foo", Key: json.RawMessage(`"foo"`)}}, result.rows); d != "" {
+			t.Error(d)
+		}
+	}
+	t.Run("Disabled", func(t *testing.T) {
+		d, under := newTestDB(Options{})
+		query(d)
+		query(d)
+		if under.queries != 2 {
+			t.Errorf("Expected 2 queries, got %d", under.queries)
+		}
+	})
+	t.Run("Enabled", func(t *testing.T) {
+		d, under := newTestDB(Options{Views: true})
+		query(d)
+		query(d)
+		if under.queries != 1 {
+			t.Errorf("Expected 1 query, got %d", under.queries)
+		}
+		under.seq = "2-bbb"
+		query(d)
+		if under.queries != 2 {
+			t.Errorf("Expected 2 queries after update, got %d", under.queries)
+		}
+	})
+	t.Run("NoUpdateSeq", func(t *testing.T) {
+		d, under := newTestDB(Options{Views: true})
+		under.seq = ""
+		query(d)
+		query(d)
+		if under.queries != 2 {
+			t.Errorf("Expected 2 queries, got %d", under.queries)
+		}
+	})
+}
+
+func TestDesignInfo(t *testing.T) {
+	d, under := newTestDB(Options{Views: true})
+	ctx := context.Background()
+	for _, seq := range []string{"1-aaa", "2-bbb"} {
+		under.mu.Lock()
+		under.seq = seq
+		under.mu.Unlock()
+		info, err := d.DesignInfo(ctx, "foo")
+		if err != nil {
+			t.Fatal(err)
+		}
+		// The status of the index changes as it is built, so is not cached.
+		if info.Name != "foo" || info.UpdateSeq != seq {
+			t.Errorf("Unexpected info: %+v", info)
+		}
+	}
+}
+
+func TestLRU(t *testing.T) {
+	c := newLRU(2)
+	c.add("a", 1)
+	c.add("b", 2)
+	c.get("a")
+	c.add("c", 3)
+	if _, ok := c.get("b"); ok {
+		t.Error("Expected b to be evicted")
+	}
+	for _, key := range []string{"a", "c"} {
+		if _, ok := c.get(key); !ok {
+			t.Errorf("Expected %s to be cached", key)
+		}
+	}
+	if c.len() != 2 {
+		t.Errorf("Unexpected length %d", c.len())
+	}
+}
+
+func TestRegister(t *testing.T) {
+	if err := Register("foo", "no such driver", Options{}); kivik.StatusCode(err) != kivik.StatusBadRequest {
+		t.Errorf("Unexpected error: %v", err)
+	}
+	if err := Register("memory-cache", "memory", Options{}); err != nil {
+		t.Fatal(err)
+	}
+	defer kivik.Unregister("memory-cache")
+	ctx := context.Background()
+	client, err := kivik.New(ctx, "memory-cache", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = client.CreateDB(ctx, "foo"); err != nil {
+		t.Fatal(err)
+	}
+	db, err := client.DB(ctx, "foo")
+	if err != nil {
+		t.Fatal(err)
+	}
+	type testDoc struct {
+		Rev   string `json:"_rev,omitempty"`
+		Value string `json:"value"`
+	}
+	get := func() testDoc {
+		var doc testDoc
+		row, e := db.Get(ctx, "bar")
+		if e != nil {
+			t.Fatal(e)
+		}
+		if e = row.ScanDoc(&doc); e != nil {
+			t.Fatal(e)
+		}
+		return doc
+	}
+	for _, value := range []string{"one", "two"} {
+		var doc testDoc
+		if value != "one" {
+			doc = get()
+		}
+		doc.Value = value
+		if _, err = db.Put(ctx, "bar", doc); err != nil {
+			t.Fatal(err)
+		}
+		doc = get()
+		if doc.Value != value {
+			t.Errorf("Expected %q, got %q", value, doc.Value)
+		}
+	}
+}
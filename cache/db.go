@@ -0,0 +1,432 @@
+package cache
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+
+	"github.com/flimzy/kivik/driver"
+)
+
+type db struct {
+	client *client
+	name   string
+	db     driver.DB
+}
+
+var _ driver.DB = &db{}
+var _ driver.Finder = &db{}
+var _ driver.Explainer = &db{}
+var _ driver.AttachmentMetaer = &db{}
+var _ driver.AttachmentCombiner = &db{}
+var _ driver.Rever = &db{}
+var _ driver.DBFlusher = &db{}
+var _ driver.Copier = &db{}
+var _ driver.OptsBulkDocer = &db{}
+var _ driver.OptsPutter = &db{}
+var _ driver.OptsDeleter = &db{}
+var _ driver.Quorumer = &db{}
+var _ driver.OpenRevsGetter = &db{}
+var _ driver.OptsDocCreator = &db{}
+var _ driver.BodyGetter = &db{}
+var _ driver.DesignInfoer = &db{}
+var _ driver.MultipartPutter = &db{}
+var _ driver.OptionValidator = &db{}
+
+// docKey returns the cache key for the given revision of a document. An empty
+// rev refers to the current revision.
+func (d *db) docKey(docID, rev string) string {
+	return d.client.prefix(d.name) + "doc\x00" + docID + "\x00" + rev
+}
+
+// invalidate removes the cached current revision of docID.
+func (d *db) invalidate(docID string) {
+	d.client.cache.remove(d.docKey(docID, ""))
+}
+
+// watch invalidates cached documents as they appear in the changes feed, until
+// ctx is canceled or the feed ends.
+func (d *db) watch(ctx context.Context) {
+	changes, err := d.db.Changes(ctx, map[string]interface{}{
+		"feed":  "continuous",
+		"since": "now",
+	})
+	if err != nil {
+		return
+	}
+	defer func() { _ = changes.Close() }()
+	var change driver.Change
+	for changes.Next(&change) == nil {
+		d.invalidate(change.ID)
+	}
+}
+
+// cacheableRev returns the requested revision, and whether a Get request with
+// opts may be cached. Other options, such as attachments or revs, alter the
+// response, so are not cached.
+func cacheableRev(opts map[string]interface{}) (string, bool) {
+	switch len(opts) {
+	case 0:
+		return "", true
+	case 1:
+		rev, ok := opts["rev"].(string)
+		return rev, ok
+	}
+	return "", false
+}
+
+func (d *db) Get(ctx context.Context, docID string, opts map[string]interface{}) (json.RawMessage, error) {
+	rev, ok := cacheableRev(opts)
+	if !ok {
+		return d.db.Get(ctx, docID, opts)
+	}
+	key := d.docKey(docID, rev)
+	if doc, ok := d.client.cache.get(key); ok {
+		return copyDoc(doc.(json.RawMessage)), nil
+	}
+	doc, err := d.db.Get(ctx, docID, opts)
+	if err != nil {
+		return nil, err
+	}
+	d.client.cache.add(key, copyDoc(doc))
+	if rev == "" {
+		var current struct {
+			Rev string `json:"_rev"`
+		}
+		if e := json.Unmarshal(doc, &current); e == nil && current.Rev != "" {
+			d.client.cache.add(d.docKey(docID, current.Rev), copyDoc(doc))
+		}
+	}
+	return doc, nil
+}
+
+func copyDoc(doc json.RawMessage) json.RawMessage {
+	return append(json.RawMessage(nil), doc...)
+}
+
+func (d *db) CreateDoc(ctx context.Context, doc interface{}) (docID, rev string, err error) {
+	docID, rev, err = d.db.CreateDoc(ctx, doc)
+	if err == nil {
+		d.invalidate(docID)
+	}
+	return docID, rev, err
+}
+
+func (d *db) CreateDocOpts(ctx context.Context, doc interface{}, opts map[string]interface{}) (docID, rev string, err error) {
+	c, ok := d.db.(driver.OptsDocCreator)
+	if !ok {
+		return "", "", notImplemented("OptsDocCreator")
+	}
+	docID, rev, err = c.CreateDocOpts(ctx, doc, opts)
+	if err == nil {
+		d.invalidate(docID)
+	}
+	return docID, rev, err
+}
+
+func (d *db) Put(ctx context.Context, docID string, doc interface{}) (rev string, err error) {
+	rev, err = d.db.Put(ctx, docID, doc)
+	d.invalidate(docID)
+	return rev, err
+}
+
+func (d *db) PutOpts(ctx context.Context, docID string, doc interface{}, opts map[string]interface{}) (rev string, err error) {
+	p, ok := d.db.(driver.OptsPutter)
+	if !ok {
+		return "", notImplemented("OptsPutter")
+	}
+	rev, err = p.PutOpts(ctx, docID, doc, opts)
+	d.invalidate(docID)
+	return rev, err
+}
+
+func (d *db) Delete(ctx context.Context, docID, rev string) (newRev string, err error) {
+	newRev, err = d.db.Delete(ctx, docID, rev)
+	d.invalidate(docID)
+	return newRev, err
+}
+
+func (d *db) DeleteOpts(ctx context.Context, docID, rev string, opts map[string]interface{}) (newRev string, err error) {
+	del, ok := d.db.(driver.OptsDeleter)
+	if !ok {
+		return "", notImplemented("OptsDeleter")
+	}
+	newRev, err = del.DeleteOpts(ctx, docID, rev, opts)
+	d.invalidate(docID)
+	return newRev, err
+}
+
+func (d *db) SupportsQuorum() bool {
+	q, ok := d.db.(driver.Quorumer)
+	return ok && q.SupportsQuorum()
+}
+
+func (d *db) BulkDocs(ctx context.Context, docs []interface{}) (driver.BulkResults, error) {
+	// Extracting the IDs would require marshaling every document, so the
+	// entire database is invalidated instead.
+	results, err := d.db.BulkDocs(ctx, docs)
+	d.client.invalidateDB(d.name)
+	return results, err
+}
+
+func (d *db) BulkDocsOpts(ctx context.Context, docs []interface{}, opts map[string]interface{}) (driver.BulkResults, error) {
+	b, ok := d.db.(driver.OptsBulkDocer)
+	if !ok {
+		return nil, notImplemented("OptsBulkDocer")
+	}
+	results, err := b.BulkDocsOpts(ctx, docs, opts)
+	d.client.invalidateDB(d.name)
+	return results, err
+}
+
+func (d *db) PutAttachment(ctx context.Context, docID, rev, filename, contentType string, body io.Reader) (newRev string, err error) {
+	newRev, err = d.db.PutAttachment(ctx, docID, rev, filename, contentType, body)
+	d.invalidate(docID)
+	return newRev, err
+}
+
+func (d *db) DeleteAttachment(ctx context.Context, docID, rev, filename string) (newRev string, err error) {
+	newRev, err = d.db.DeleteAttachment(ctx, docID, rev, filename)
+	d.invalidate(docID)
+	return newRev, err
+}
+
+func (d *db) Copy(ctx context.Context, targetID, sourceID string, opts map[string]interface{}) (targetRev string, err error) {
+	c, ok := d.db.(driver.Copier)
+	if !ok {
+		return "", notImplemented("Copier")
+	}
+	targetRev, err = c.Copy(ctx, targetID, sourceID, opts)
+	d.invalidate(targetID)
+	return targetRev, err
+}
+
+func (d *db) Query(ctx context.Context, ddoc, view string, opts map[string]interface{}) (driver.Rows, error) {
+	if !d.client.opts.Views {
+		return d.db.Query(ctx, ddoc, view, opts)
+	}
+	encodedOpts, err := json.Marshal(opts)
+	if err != nil {
+		return d.db.Query(ctx, ddoc, view, opts)
+	}
+	stats, err := d.db.Stats(ctx)
+	if err != nil || stats.UpdateSeq == "" {
+		return d.db.Query(ctx, ddoc, view, opts)
+	}
+	key := d.client.prefix(d.name) + "view\x00" + ddoc + "\x00" + view + "\x00" + string(encodedOpts) + "\x00" + stats.UpdateSeq
+	if result, ok := d.client.cache.get(key); ok {
+		return &cachedRows{viewResult: result.(*viewResult)}, nil
+	}
+	rows, err := d.db.Query(ctx, ddoc, view, opts)
+	if err != nil {
+		return nil, err
+	}
+	result := readRows(rows)
+	if result.err == nil {
+		d.client.cache.add(key, result)
+	}
+	return &cachedRows{viewResult: result}, nil
+}
+
+// viewResult is a complete, buffered result set.
+type viewResult struct {
+	rows      []driver.Row
+	updateSeq string
+	offset    int64
+	totalRows int64
+	// err is the error, if any, which interrupted reading the rows.
+	err error
+}
+
+// readRows reads and closes rows.
+func readRows(rows driver.Rows) *viewResult {
+	defer func() { _ = rows.Close() }()
+	result := &viewResult{}
+	for {
+		var row driver.Row
+		if err := rows.Next(&row); err != nil {
+			if err != io.EOF {
+				result.err = err
+			}
+			break
+		}
+		result.rows = append(result.rows, row)
+	}
+	result.updateSeq = rows.UpdateSeq()
+	result.offset = rows.Offset()
+	result.totalRows = rows.TotalRows()
+	return result
+}
+
+// cachedRows iterates over a viewResult.
+type cachedRows struct {
+	*viewResult
+	i int
+}
+
+var _ driver.Rows = &cachedRows{}
+
+func (r *cachedRows) Next(row *driver.Row) error {
+	if r.i >= len(r.rows) {
+		if r.err != nil {
+			return r.err
+		}
+		return io.EOF
+	}
+	*row = r.rows[r.i]
+	r.i++
+	return nil
+}
+
+func (r *cachedRows) Close() error {
+	r.i = len(r.rows)
+	return nil
+}
+
+func (r *cachedRows) UpdateSeq() string { return r.updateSeq }
+func (r *cachedRows) Offset() int64     { return r.offset }
+func (r *cachedRows) TotalRows() int64  { return r.totalRows }
+
+func (d *db) AllDocs(ctx context.Context, opts map[string]interface{}) (driver.Rows, error) {
+	return d.db.AllDocs(ctx, opts)
+}
+
+func (d *db) Stats(ctx context.Context) (*driver.DBStats, error) {
+	return d.db.Stats(ctx)
+}
+
+func (d *db) Compact(ctx context.Context) error {
+	return d.db.Compact(ctx)
+}
+
+func (d *db) CompactView(ctx context.Context, ddocID string) error {
+	return d.db.CompactView(ctx, ddocID)
+}
+
+func (d *db) ViewCleanup(ctx context.Context) error {
+	return d.db.ViewCleanup(ctx)
+}
+
+func (d *db) Security(ctx context.Context) (*driver.Security, error) {
+	return d.db.Security(ctx)
+}
+
+func (d *db) SetSecurity(ctx context.Context, security *driver.Security) error {
+	return d.db.SetSecurity(ctx, security)
+}
+
+func (d *db) Changes(ctx context.Context, opts map[string]interface{}) (driver.Changes, error) {
+	return d.db.Changes(ctx, opts)
+}
+
+func (d *db) GetAttachment(ctx context.Context, docID, rev, filename string) (contentType string, md5sum driver.MD5sum, body io.ReadCloser, err error) {
+	return d.db.GetAttachment(ctx, docID, rev, filename)
+}
+
+func (d *db) Find(ctx context.Context, query interface{}) (driver.Rows, error) {
+	if f, ok := d.db.(driver.Finder); ok {
+		return f.Find(ctx, query)
+	}
+	return nil, notImplemented("Finder")
+}
+
+func (d *db) CreateIndex(ctx context.Context, ddoc, name string, index interface{}) error {
+	if f, ok := d.db.(driver.Finder); ok {
+		return f.CreateIndex(ctx, ddoc, name, index)
+	}
+	return notImplemented("Finder")
+}
+
+func (d *db) GetIndexes(ctx context.Context) ([]driver.Index, error) {
+	if f, ok := d.db.(driver.Finder); ok {
+		return f.GetIndexes(ctx)
+	}
+	return nil, notImplemented("Finder")
+}
+
+func (d *db) DeleteIndex(ctx context.Context, ddoc, name string) error {
+	if f, ok := d.db.(driver.Finder); ok {
+		return f.DeleteIndex(ctx, ddoc, name)
+	}
+	return notImplemented("Finder")
+}
+
+func (d *db) GetAttachmentMeta(ctx context.Context, docID, rev, filename string) (contentType string, md5sum driver.MD5sum, err error) {
+	if m, ok := d.db.(driver.AttachmentMetaer); ok {
+		return m.GetAttachmentMeta(ctx, docID, rev, filename)
+	}
+	return "", driver.MD5sum{}, notImplemented("AttachmentMetaer")
+}
+
+func (d *db) Rev(ctx context.Context, docID string) (rev string, err error) {
+	if r, ok := d.db.(driver.Rever); ok {
+		return r.Rev(ctx, docID)
+	}
+	return "", notImplemented("Rever")
+}
+
+func (d *db) GetOpenRevs(ctx context.Context, docID string, revs []string, opts map[string]interface{}) ([]driver.OpenRev, error) {
+	if g, ok := d.db.(driver.OpenRevsGetter); ok {
+		return g.GetOpenRevs(ctx, docID, revs, opts)
+	}
+	return nil, notImplemented("OpenRevsGetter")
+}
+
+// GetBody streams the document from the underlying driver. Streamed documents
+// are not cached.
+func (d *db) GetBody(ctx context.Context, docID string, opts map[string]interface{}) (io.ReadCloser, error) {
+	if g, ok := d.db.(driver.BodyGetter); ok {
+		return g.GetBody(ctx, docID, opts)
+	}
+	return nil, notImplemented("BodyGetter")
+}
+
+func (d *db) SupportedOptions(method string) (map[string]driver.OptionType, bool) {
+	if v, ok := d.db.(driver.OptionValidator); ok {
+		return v.SupportedOptions(method)
+	}
+	return nil, false
+}
+
+func (d *db) Flush(ctx context.Context) error {
+	if f, ok := d.db.(driver.DBFlusher); ok {
+		return f.Flush(ctx)
+	}
+	return notImplemented("DBFlusher")
+}
+
+func (d *db) PutMultipart(ctx context.Context, docID string, doc interface{}, atts []driver.MultipartAttachment, opts map[string]interface{}) (rev string, err error) {
+	p, ok := d.db.(driver.MultipartPutter)
+	if !ok {
+		return "", notImplemented("MultipartPutter")
+	}
+	rev, err = p.PutMultipart(ctx, docID, doc, atts, opts)
+	d.invalidate(docID)
+	return rev, err
+}
+
+func (d *db) Explain(ctx context.Context, query interface{}) (*driver.QueryPlan, error) {
+	e, ok := d.db.(driver.Explainer)
+	if !ok {
+		return nil, notImplemented("Explainer")
+	}
+	return e.Explain(ctx, query)
+}
+
+func (d *db) DesignInfo(ctx context.Context, ddoc string) (*driver.DesignInfo, error) {
+	i, ok := d.db.(driver.DesignInfoer)
+	if !ok {
+		return nil, notImplemented("DesignInfoer")
+	}
+	return i.DesignInfo(ctx, ddoc)
+}
+
+func (d *db) CombineAttachments(ctx context.Context, docID, rev, filename, contentType string, parts []string) (newRev string, err error) {
+	c, ok := d.db.(driver.AttachmentCombiner)
+	if !ok {
+		return "", notImplemented("AttachmentCombiner")
+	}
+	newRev, err = c.CombineAttachments(ctx, docID, rev, filename, contentType, parts)
+	d.invalidate(docID)
+	return newRev, err
+}
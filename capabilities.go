@@ -0,0 +1,50 @@
+package kivik
+
+import (
+	"context"
+
+	"github.com/flimzy/kivik/driver"
+)
+
+// Capabilities maps the names of the optional driver interfaces, such as
+// "Finder" or "ClientReplicator", to whether they are implemented by a driver.
+type Capabilities map[string]bool
+
+// Capabilities reports which optional interfaces are implemented by the
+// client's driver. If dbName is not empty, the database is opened, and the
+// database-level interfaces are included as well.
+func (c *Client) Capabilities(ctx context.Context, dbName string) (Capabilities, error) {
+	caps := Capabilities{}
+	_, caps["ClientReplicator"] = c.driverClient.(driver.ClientReplicator)
+	_, caps["Authenticator"] = c.driverClient.(driver.Authenticator)
+	_, caps["DBUpdater"] = c.driverClient.(driver.DBUpdater)
+	_, caps["PoolStatser"] = c.driverClient.(driver.PoolStatser)
+	_, caps["AdminPartyChecker"] = c.driverClient.(driver.AdminPartyChecker)
+	_, caps["DiskUsager"] = c.driverClient.(driver.DiskUsager)
+	_, caps["Configer"] = c.driverClient.(driver.Configer)
+	_, caps["Clusterer"] = c.driverClient.(driver.Clusterer)
+	if dbName == "" {
+		return caps, nil
+	}
+	db, err := c.DB(ctx, dbName)
+	if err != nil {
+		return nil, err
+	}
+	_, caps["Finder"] = db.driverDB.(driver.Finder)
+	_, caps["Explainer"] = db.driverDB.(driver.Explainer)
+	_, caps["AttachmentMetaer"] = db.driverDB.(driver.AttachmentMetaer)
+	_, caps["AttachmentCombiner"] = db.driverDB.(driver.AttachmentCombiner)
+	_, caps["Rever"] = db.driverDB.(driver.Rever)
+	_, caps["DBFlusher"] = db.driverDB.(driver.DBFlusher)
+	_, caps["DesignInfoer"] = db.driverDB.(driver.DesignInfoer)
+	_, caps["Copier"] = db.driverDB.(driver.Copier)
+	_, caps["OptsBulkDocer"] = db.driverDB.(driver.OptsBulkDocer)
+	_, caps["OptsDocCreator"] = db.driverDB.(driver.OptsDocCreator)
+	_, caps["OptsPutter"] = db.driverDB.(driver.OptsPutter)
+	_, caps["OptsDeleter"] = db.driverDB.(driver.OptsDeleter)
+	_, caps["OpenRevsGetter"] = db.driverDB.(driver.OpenRevsGetter)
+	_, caps["BodyGetter"] = db.driverDB.(driver.BodyGetter)
+	_, caps["MultipartPutter"] = db.driverDB.(driver.MultipartPutter)
+	caps["Quorumer"] = supportsQuorum(db.driverDB)
+	return caps, nil
+}
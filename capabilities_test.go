@@ -0,0 +1,91 @@
+package kivik
+
+import (
+	"context"
+	"testing"
+
+	"github.com/flimzy/diff"
+	"github.com/flimzy/kivik/driver"
+)
+
+type capsClient struct {
+	driver.Client
+}
+
+var _ driver.Client = &capsClient{}
+
+func (c *capsClient) DB(_ context.Context, _ string, _ map[string]interface{}) (driver.DB, error) {
+	return &capsDB{}, nil
+}
+
+func (c *capsClient) DBUpdates() (driver.DBUpdates, error) { return nil, nil }
+
+type capsDB struct {
+	dummyDB
+}
+
+func (db *capsDB) Flush(_ context.Context) error { return nil }
+
+func TestCapabilities(t *testing.T) {
+	tests := []struct {
+		name     string
+		dbName   string
+		expected Capabilities
+	}{
+		{
+			name: "ClientOnly",
+			expected: Capabilities{
+				"ClientReplicator":  false,
+				"Authenticator":     false,
+				"DBUpdater":         true,
+				"PoolStatser":       false,
+				"AdminPartyChecker": false,
+				"DiskUsager":        false,
+				"Configer":          false,
+				"Clusterer":         false,
+			},
+		},
+		{
+			name:   "WithDB",
+			dbName: "foo",
+			expected: Capabilities{
+				"ClientReplicator":   false,
+				"Authenticator":      false,
+				"DBUpdater":          true,
+				"PoolStatser":        false,
+				"AdminPartyChecker":  false,
+				"DiskUsager":         false,
+				"Configer":           false,
+				"Clusterer":          false,
+				"Finder":             false,
+				"Explainer":          false,
+				"AttachmentMetaer":   false,
+				"AttachmentCombiner": false,
+				"Rever":              false,
+				"DBFlusher":          true,
+				"DesignInfoer":       false,
+				"Copier":             false,
+				"OptsBulkDocer":      false,
+				"OptsDocCreator":     false,
+				"OptsPutter":         false,
+				"OptsDeleter":        false,
+				"OpenRevsGetter":     false,
+				"BodyGetter":         false,
+				"MultipartPutter":    false,
+				"Quorumer":           false,
+			},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			client := &Client{driverClient: &capsClient{}}
+			caps, err := client.Capabilities(context.Background(), test.dbName)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if d := diff.Interface(test.expected, caps); d != "" {
+				t.Error(d)
+			}
+		})
+	}
+}
@@ -1,7 +1,10 @@
 package kivik
 
 import (
+	"encoding/json"
+
 	"github.com/flimzy/kivik/driver"
+	"github.com/flimzy/kivik/errors"
 	"golang.org/x/net/context"
 )
 
@@ -37,7 +40,13 @@ type changesIterator struct{ driver.Changes }
 
 var _ iterator = &changesIterator{}
 
-func (c *changesIterator) Next(i interface{}) error { return c.Changes.Next(i.(*driver.Change)) }
+// Next resets the change before reading the next, so that fields missing from
+// the next change, such as Doc, are not left over from the last.
+func (c *changesIterator) Next(i interface{}) error {
+	change := i.(*driver.Change)
+	*change = driver.Change{}
+	return c.Changes.Next(change)
+}
 
 func newChanges(ctx context.Context, changesi driver.Changes) *Changes {
 	return &Changes{
@@ -46,6 +55,16 @@ func newChanges(ctx context.Context, changesi driver.Changes) *Changes {
 	}
 }
 
+// newPrefetchChanges returns Changes which read up to n changes ahead from
+// changesi.
+func newPrefetchChanges(ctx context.Context, changesi driver.Changes, n int) *Changes {
+	feed := newPrefetcher(ctx, &changesIterator{changesi}, n, func() interface{} { return &driver.Change{} })
+	return &Changes{
+		iter:     newIterator(ctx, feed, &driver.Change{}),
+		changesi: changesi,
+	}
+}
+
 // Changes returns a list of changed revs.
 func (c *Changes) Changes() []string {
 	return c.curVal.(*driver.Change).Changes
@@ -58,12 +77,17 @@ func (c *Changes) Deleted() bool {
 
 // ID returns the ID of the current result.
 func (c *Changes) ID() string {
-	return c.curVal.(*driver.Row).ID
+	return c.curVal.(*driver.Change).ID
 }
 
 // Seq returns the SEQ of the current result
-func (c *Changes) Seq() driver.SequenceID {
-	return c.curVal.(*driver.Change).Seq
+func (c *Changes) Seq() SequenceID {
+	return SequenceID(c.curVal.(*driver.Change).Seq)
+}
+
+// Revs returns the changed revisions of the current result.
+func (c *Changes) Revs() []Rev {
+	return revs(c.curVal.(*driver.Change).Changes)
 }
 
 // ScanDoc works the same as ScanValue, but on the doc field of the result. It
@@ -74,20 +98,139 @@ func (c *Changes) ScanDoc(dest interface{}) error {
 		return err
 	}
 	defer runlock()
-	return scan(dest, c.curVal.(*driver.Change).Doc)
+	return scanChangeDoc(dest, c.curVal.(*driver.Change).Doc)
+}
+
+// Change returns the current result, or nil if there is none, as before the
+// first call to Next, or once the feed is closed.
+func (c *Changes) Change() *Change {
+	runlock, err := c.rlock()
+	if err != nil {
+		return nil
+	}
+	defer runlock()
+	change := c.curVal.(*driver.Change)
+	var doc json.RawMessage
+	if len(change.Doc) > 0 {
+		doc = make(json.RawMessage, len(change.Doc))
+		copy(doc, change.Doc)
+	}
+	return &Change{
+		ID:      change.ID,
+		Seq:     SequenceID(change.Seq),
+		Deleted: change.Deleted,
+		Changes: revs(change.Changes),
+		Doc:     doc,
+	}
+}
+
+// Rev is a revision of a document, as listed by a result of the changes feed.
+type Rev struct {
+	Rev string `json:"rev"`
+}
+
+// Change is a result of the changes feed, as returned by Changes.Change. It
+// marshals to JSON as CouchDB formats a result of the feed.
+type Change struct {
+	// ID is the ID of the changed document.
+	ID string `json:"id"`
+	// Seq is the update sequence of the change.
+	Seq SequenceID `json:"seq"`
+	// Deleted is true if the document was deleted.
+	Deleted bool `json:"deleted,omitempty"`
+	// Changes lists the leaf revisions of the document.
+	Changes []Rev `json:"changes"`
+	// Doc is the document, if the feed includes documents.
+	Doc json.RawMessage `json:"doc,omitempty"`
+}
+
+// ScanDoc unmarshals the document of the change into dest, as Changes.ScanDoc
+// does.
+func (c *Change) ScanDoc(dest interface{}) error {
+	return scanChangeDoc(dest, c.Doc)
+}
+
+func scanChangeDoc(dest interface{}, doc json.RawMessage) error {
+	if len(doc) == 0 {
+		return errors.Status(StatusBadRequest, "kivik: doc is nil; does the feed include docs?")
+	}
+	return scan(dest, doc)
+}
+
+func revs(changes driver.ChangedRevs) []Rev {
+	result := make([]Rev, len(changes))
+	for i, rev := range changes {
+		result[i] = Rev{Rev: rev}
+	}
+	return result
 }
 
 // Changes returns an iterator over the real-time changes feed. The feed remains
 // open until explicitly closed, or an error is encountered.
 // See http://couchdb.readthedocs.io/en/latest/api/database/changes.html#get--db-_changes
 func (db *DB) Changes(ctx context.Context, options ...Options) (*Changes, error) {
-	opts, err := mergeOptions(options...)
+	opts, err := db.options(ctx, "Changes", options...)
 	if err != nil {
 		return nil, err
 	}
-	changesi, err := db.driverDB.Changes(ctx, opts)
+	n := prefetch(opts)
+	ctx, cancel := withTimeout(ctx, db.timeouts.Changes)
+	result, err := db.invoke(ctx, &Operation{Name: "Changes", Options: opts}, func(ctx context.Context, op *Operation) (interface{}, error) {
+		return db.driverDB.Changes(ctx, op.Options)
+	})
 	if err != nil {
+		cancel()
 		return nil, err
 	}
-	return newChanges(ctx, changesi), nil
+	changesi, ok := result.(driver.Changes)
+	if !ok {
+		cancel()
+		return nil, unexpectedResult("Changes", result)
+	}
+	var changes *Changes
+	if n > 0 {
+		changes = newPrefetchChanges(ctx, changesi, n)
+	} else {
+		changes = newChanges(ctx, changesi)
+	}
+	changes.releaseOnClose(cancel)
+	return changes, nil
+}
+
+// UpdateSeq returns the current update sequence of the database, as reported
+// by Stats. If the driver does not report update sequences, an error with
+// status StatusNotImplemented is returned.
+func (db *DB) UpdateSeq(ctx context.Context) (SequenceID, error) {
+	stats, err := db.Stats(ctx)
+	if err != nil {
+		return "", err
+	}
+	if stats.UpdateSeq == "" {
+		return "", errors.Status(StatusNotImplemented, "kivik: driver does not report update sequences")
+	}
+	return stats.UpdateSeq, nil
+}
+
+// ChangesNow opens a changes feed from the current update sequence, which is
+// returned with the feed, so that it may be checkpointed before any change
+// is received, and no change is missed between the two. Unlike since=now, the
+// sequence is fetched first, and the feed opened from it, so that changes
+// made while the feed is opened are included.
+//
+// If the driver does not report update sequences, the feed is opened with
+// since=now, and SinceNow is returned. Any since option is overridden.
+func (db *DB) ChangesNow(ctx context.Context, options ...Options) (*Changes, SequenceID, error) {
+	seq, err := db.UpdateSeq(ctx)
+	switch {
+	case StatusCode(err) == StatusNotImplemented:
+		seq = SinceNow
+	case err != nil:
+		return nil, "", err
+	}
+	opts := append(append([]Options{}, options...), Since(seq))
+	changes, err := db.Changes(ctx, opts...)
+	if err != nil {
+		return nil, "", err
+	}
+	return changes, seq, nil
 }
@@ -0,0 +1,81 @@
+package kivik
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"testing"
+
+	"github.com/flimzy/diff"
+	"github.com/flimzy/kivik/driver"
+)
+
+// sliceChanges decodes each element of input as a change.
+type sliceChanges struct {
+	input []string
+}
+
+var _ driver.Changes = &sliceChanges{}
+
+func (c *sliceChanges) Next(change *driver.Change) error {
+	if len(c.input) == 0 {
+		return io.EOF
+	}
+	err := json.Unmarshal([]byte(c.input[0]), change)
+	c.input = c.input[1:]
+	return err
+}
+
+func (c *sliceChanges) Close() error { return nil }
+
+func TestChangesChange(t *testing.T) {
+	changes := newChanges(context.Background(), &sliceChanges{input: []string{
+		`{"seq":"1-x","id":"foo","changes":[{"rev":"1-a"},{"rev":"2-b"}],"doc":{"_id":"foo","name":"Bob"}}`,
+		`{"seq":"2-x","id":"bar","deleted":true,"changes":[{"rev":"3-c"}]}`,
+	}})
+	if change := changes.Change(); change != nil {
+		t.Errorf("Expected no change before calling Next, got %v", change)
+	}
+	var result []*Change
+	var names []string
+	for changes.Next() {
+		change := changes.Change()
+		result = append(result, change)
+		var doc struct {
+			Name string `json:"name"`
+		}
+		err := change.ScanDoc(&doc)
+		if change.ID == "bar" {
+			if StatusCode(err) != StatusBadRequest {
+				t.Errorf("Expected bad request for a change without a doc, got %v", err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		names = append(names, doc.Name)
+		if d := diff.Interface([]Rev{{Rev: "1-a"}, {Rev: "2-b"}}, changes.Revs()); d != "" {
+			t.Error(d)
+		}
+	}
+	if err := changes.Err(); err != nil {
+		t.Fatal(err)
+	}
+	expected := []*Change{
+		{ID: "foo", Seq: "1-x", Changes: []Rev{{Rev: "1-a"}, {Rev: "2-b"}}, Doc: json.RawMessage(`{"_id":"foo","name":"Bob"}`)},
+		{ID: "bar", Seq: "2-x", Deleted: true, Changes: []Rev{{Rev: "3-c"}}},
+	}
+	if d := diff.Interface(expected, result); d != "" {
+		t.Error(d)
+	}
+	if d := diff.Interface([]string{"Bob"}, names); d != "" {
+		t.Error(d)
+	}
+	if d := diff.AsJSON([]byte(`{"id":"bar","seq":"2-x","deleted":true,"changes":[{"rev":"3-c"}]}`), result[1]); d != "" {
+		t.Error(d)
+	}
+	if change := changes.Change(); change != nil {
+		t.Errorf("Expected no change once the feed is closed, got %v", change)
+	}
+}
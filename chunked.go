@@ -0,0 +1,290 @@
+package kivik
+
+import (
+	"context"
+	"crypto/md5"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"sort"
+	"strings"
+
+	"github.com/flimzy/kivik/driver"
+	"github.com/flimzy/kivik/errors"
+)
+
+// DefaultChunkSize is the size of the chunks in which PutChunkedAttachment
+// uploads an attachment, if no ChunkSize is given.
+const DefaultChunkSize = 8 << 20
+
+// partFormat is the format of the names of the attachments holding the
+// chunks of an attachment, from its name and the position of the chunk.
+const partFormat = "%s.part%06d"
+
+// ChunkedUpload describes an attachment to upload with PutChunkedAttachment.
+type ChunkedUpload struct {
+	DocID       string
+	Filename    string
+	ContentType string
+	// Content is the content of the attachment, of Size bytes. It is read at
+	// the offset of each chunk, so that an upload may be resumed, and must not
+	// change between attempts.
+	Content io.ReaderAt
+	Size    int64
+	// ChunkSize is the size of each chunk. Defaults to DefaultChunkSize. It
+	// must not change between attempts, or the upload is restarted.
+	ChunkSize int64
+	// Progress, if set, is called after each chunk is uploaded, or found to
+	// have been uploaded by a previous attempt, with the number of bytes
+	// uploaded so far.
+	Progress func(uploaded, size int64)
+}
+
+// uploadLog is the local document which records the chunks uploaded.
+type uploadLog struct {
+	Rev       string `json:"_rev,omitempty"`
+	Size      int64  `json:"size"`
+	ChunkSize int64  `json:"chunk_size"`
+	// Chunks are the hex-encoded MD5 digests of the chunks uploaded, in
+	// order.
+	Chunks []string `json:"chunks"`
+}
+
+// uploadLogID returns the ID of the local document which records the progress
+// of uploading filename to docID.
+func uploadLogID(docID, filename string) string {
+	sum := md5.Sum([]byte(docID + "\x00" + filename))
+	return "_local/kivik_upload_" + hex.EncodeToString(sum[:])
+}
+
+// PutChunkedAttachment uploads a large attachment in chunks, each of which is
+// stored as a separate attachment, and verified against the MD5 digest
+// reported by the server once uploaded. Progress is recorded in a local
+// document, so that, if the upload fails, calling PutChunkedAttachment again
+// with the same upload resumes it from the first chunk not uploaded.
+//
+// Once all chunks are uploaded, they are recombined on the server, if the
+// driver supports it, as the attachment upload.Filename. Otherwise, or if the
+// driver returns StatusNotImplemented, as a wrapper driver may, they remain as
+// attachments named for the filename and position of each chunk, which
+// GetChunkedAttachment reads as one. The new rev of the document is returned.
+func (db *DB) PutChunkedAttachment(ctx context.Context, upload *ChunkedUpload) (string, error) {
+	chunkSize := upload.ChunkSize
+	if chunkSize <= 0 {
+		chunkSize = DefaultChunkSize
+	}
+	contentType := upload.ContentType
+	if contentType == "" {
+		contentType = "application/octet-stream"
+	}
+	chunks := int((upload.Size + chunkSize - 1) / chunkSize)
+	if chunks == 0 {
+		chunks = 1
+	}
+	logID := uploadLogID(upload.DocID, upload.Filename)
+	log := &uploadLog{}
+	row, err := db.Get(ctx, logID)
+	switch {
+	case StatusCode(err) == StatusNotFound:
+	case err != nil:
+		return "", err
+	default:
+		if err := row.ScanDoc(log); err != nil {
+			return "", err
+		}
+	}
+	if log.Size != upload.Size || log.ChunkSize != chunkSize {
+		log.Chunks = nil
+	}
+	log.Size, log.ChunkSize = upload.Size, chunkSize
+
+	rev, err := db.Rev(ctx, upload.DocID)
+	if err != nil && StatusCode(err) != StatusNotFound {
+		return "", err
+	}
+	// Chunks recorded by a previous attempt are kept only so long as the
+	// content is unchanged, and the server has them.
+	for i, sum := range log.Chunks {
+		local, err := chunkMD5(upload.Content, int64(i)*chunkSize, chunkLen(upload.Size, chunkSize, i))
+		if err != nil {
+			return "", err
+		}
+		if local != sum || !db.hasPart(ctx, upload.DocID, rev, partName(upload.Filename, i), sum) {
+			log.Chunks = log.Chunks[:i]
+			break
+		}
+	}
+	parts := make([]string, chunks)
+	for i := range parts {
+		parts[i] = partName(upload.Filename, i)
+		if i < len(log.Chunks) {
+			upload.progress(int64(i+1) * chunkSize)
+			continue
+		}
+		hash := md5.New()
+		body := io.TeeReader(io.NewSectionReader(upload.Content, int64(i)*chunkSize, chunkLen(upload.Size, chunkSize, i)), hash)
+		att := NewAttachment(parts[i], contentType, ioutil.NopCloser(body))
+		if rev, err = db.PutAttachment(ctx, upload.DocID, rev, att); err != nil {
+			return "", err
+		}
+		sum := hex.EncodeToString(hash.Sum(nil))
+		if !db.hasPart(ctx, upload.DocID, rev, parts[i], sum) {
+			return "", errors.Statusf(StatusBadResponse, "kivik: chunk %d of %s failed verification", i, upload.Filename)
+		}
+		log.Chunks = append(log.Chunks, sum)
+		if log.Rev, err = db.Put(ctx, logID, log); err != nil {
+			return "", err
+		}
+		upload.progress(int64(i+1) * chunkSize)
+	}
+	if combiner, ok := db.driverDB.(driver.AttachmentCombiner); ok {
+		result, err := db.invoke(ctx, &Operation{Name: "CombineAttachments", DocID: upload.DocID}, func(ctx context.Context, _ *Operation) (interface{}, error) {
+			return combiner.CombineAttachments(ctx, upload.DocID, rev, upload.Filename, contentType, parts)
+		})
+		switch {
+		case StatusCode(err) == StatusNotImplemented:
+			// The chunks remain as separate attachments.
+		case err != nil:
+			return "", err
+		default:
+			rev, _ = result.(string)
+		}
+	}
+	if log.Rev != "" {
+		if _, err := db.Delete(ctx, logID, log.Rev); err != nil {
+			return "", err
+		}
+	}
+	return rev, nil
+}
+
+func (u *ChunkedUpload) progress(uploaded int64) {
+	if uploaded > u.Size {
+		uploaded = u.Size
+	}
+	if u.Progress != nil {
+		u.Progress(uploaded, u.Size)
+	}
+}
+
+func partName(filename string, i int) string {
+	return fmt.Sprintf(partFormat, filename, i)
+}
+
+// chunkLen returns the length of chunk i.
+func chunkLen(size, chunkSize int64, i int) int64 {
+	if rest := size - int64(i)*chunkSize; rest < chunkSize {
+		return rest
+	}
+	return chunkSize
+}
+
+func chunkMD5(content io.ReaderAt, off, n int64) (string, error) {
+	hash := md5.New()
+	if _, err := io.Copy(hash, io.NewSectionReader(content, off, n)); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(hash.Sum(nil)), nil
+}
+
+// hasPart returns true if the server has the attachment part of docID, with
+// the hex-encoded MD5 digest sum.
+func (db *DB) hasPart(ctx context.Context, docID, rev, part, sum string) bool {
+	if rev == "" {
+		return false
+	}
+	att, err := db.GetAttachmentMeta(ctx, docID, rev, part)
+	return err == nil && hex.EncodeToString(att.MD5[:]) == sum
+}
+
+// GetChunkedAttachment returns the attachment filename of docID, as for
+// GetAttachment at the current revision, or, if it was uploaded by
+// PutChunkedAttachment, and not recombined on the server, the concatenation
+// of its chunks, which are fetched as they are read. The MD5 of a
+// concatenation is not known.
+func (db *DB) GetChunkedAttachment(ctx context.Context, docID, filename string) (*Attachment, error) {
+	att, err := db.GetAttachment(ctx, docID, "", filename)
+	if StatusCode(err) != StatusNotFound {
+		return att, err
+	}
+	row, err2 := db.Get(ctx, docID)
+	if err2 != nil {
+		return nil, err
+	}
+	var doc struct {
+		Rev         string                 `json:"_rev"`
+		Attachments map[string]interface{} `json:"_attachments"`
+	}
+	if err2 = row.ScanDoc(&doc); err2 != nil {
+		return nil, err2
+	}
+	var parts []string
+	for name := range doc.Attachments {
+		if strings.HasPrefix(name, filename+".part") {
+			parts = append(parts, name)
+		}
+	}
+	sort.Strings(parts)
+	for i, part := range parts {
+		if part != partName(filename, i) {
+			return nil, errors.Statusf(StatusBadResponse, "kivik: chunk %d of %s is missing", i, filename)
+		}
+	}
+	if len(parts) == 0 {
+		return nil, err
+	}
+	first, err := db.GetAttachment(ctx, docID, doc.Rev, parts[0])
+	if err != nil {
+		return nil, err
+	}
+	return &Attachment{
+		ReadCloser:  &partsReader{ctx: ctx, db: db, docID: docID, rev: doc.Rev, parts: parts[1:], current: first},
+		Filename:    filename,
+		ContentType: first.ContentType,
+	}, nil
+}
+
+// partsReader reads the chunks of an attachment in turn.
+type partsReader struct {
+	ctx     context.Context
+	db      *DB
+	docID   string
+	rev     string
+	parts   []string
+	current io.ReadCloser
+}
+
+func (r *partsReader) Read(p []byte) (int, error) {
+	for {
+		if r.current == nil {
+			if len(r.parts) == 0 {
+				return 0, io.EOF
+			}
+			att, err := r.db.GetAttachment(r.ctx, r.docID, r.rev, r.parts[0])
+			if err != nil {
+				return 0, err
+			}
+			r.current, r.parts = att, r.parts[1:]
+		}
+		n, err := r.current.Read(p)
+		if err == io.EOF {
+			_ = r.current.Close()
+			r.current = nil
+			if n == 0 {
+				continue
+			}
+			err = nil
+		}
+		return n, err
+	}
+}
+
+func (r *partsReader) Close() error {
+	if r.current == nil {
+		return nil
+	}
+	err := r.current.Close()
+	r.current, r.parts = nil, nil
+	return err
+}
@@ -0,0 +1,268 @@
+package kivik
+
+import (
+	"bytes"
+	"context"
+	"crypto/md5"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"strings"
+	"testing"
+
+	"github.com/flimzy/diff"
+	"github.com/flimzy/kivik/driver"
+	"github.com/flimzy/kivik/errors"
+)
+
+// attachmentsDB stores the attachments of a single document, and local
+// documents, in memory.
+type attachmentsDB struct {
+	*dummyDB
+	rev    int
+	atts   map[string][]byte
+	types  map[string]string
+	locals map[string]json.RawMessage
+	// failAt, if > 0, causes the failAt'th call to PutAttachment to fail.
+	failAt int
+	puts   int
+}
+
+var _ driver.AttachmentMetaer = &attachmentsDB{}
+
+func newAttachmentsDB() *attachmentsDB {
+	return &attachmentsDB{
+		dummyDB: &dummyDB{},
+		atts:    make(map[string][]byte),
+		types:   make(map[string]string),
+		locals:  make(map[string]json.RawMessage),
+	}
+}
+
+func (db *attachmentsDB) currentRev() string {
+	return fmt.Sprintf("%d-x", db.rev)
+}
+
+func (db *attachmentsDB) Get(_ context.Context, docID string, _ map[string]interface{}) (json.RawMessage, error) {
+	if strings.HasPrefix(docID, "_local/") {
+		doc, ok := db.locals[docID]
+		if !ok {
+			return nil, errors.Status(StatusNotFound, "missing")
+		}
+		return doc, nil
+	}
+	if db.rev == 0 {
+		return nil, errors.Status(StatusNotFound, "missing")
+	}
+	atts := make(map[string]interface{}, len(db.atts))
+	for name := range db.atts {
+		atts[name] = map[string]interface{}{"stub": true}
+	}
+	return json.Marshal(map[string]interface{}{"_id": docID, "_rev": db.currentRev(), "_attachments": atts})
+}
+
+func (db *attachmentsDB) Put(_ context.Context, docID string, doc interface{}) (string, error) {
+	body, err := json.Marshal(doc)
+	if err != nil {
+		return "", err
+	}
+	db.locals[docID] = body
+	return "0-1", nil
+}
+
+func (db *attachmentsDB) Delete(_ context.Context, docID, _ string) (string, error) {
+	delete(db.locals, docID)
+	return "0-0", nil
+}
+
+func (db *attachmentsDB) PutAttachment(_ context.Context, _, rev, filename, contentType string, body io.Reader) (string, error) {
+	if db.puts++; db.puts == db.failAt {
+		return "", errors.Status(StatusRequestTimeout, "connection reset")
+	}
+	if rev != "" && rev != db.currentRev() || rev == "" && db.rev != 0 {
+		return "", errors.Status(StatusConflict, "conflict")
+	}
+	content, err := ioutil.ReadAll(body)
+	if err != nil {
+		return "", err
+	}
+	db.atts[filename], db.types[filename] = content, contentType
+	db.rev++
+	return db.currentRev(), nil
+}
+
+func (db *attachmentsDB) GetAttachment(_ context.Context, _, _, filename string) (string, driver.MD5sum, io.ReadCloser, error) {
+	content, ok := db.atts[filename]
+	if !ok {
+		return "", driver.MD5sum{}, nil, errors.Status(StatusNotFound, "missing")
+	}
+	return db.types[filename], md5.Sum(content), ioutil.NopCloser(bytes.NewReader(content)), nil
+}
+
+func (db *attachmentsDB) GetAttachmentMeta(ctx context.Context, docID, rev, filename string) (string, driver.MD5sum, error) {
+	cType, sum, _, err := db.GetAttachment(ctx, docID, rev, filename)
+	return cType, sum, err
+}
+
+// combiningDB recombines attachments uploaded in chunks.
+type combiningDB struct {
+	*attachmentsDB
+}
+
+var _ driver.AttachmentCombiner = &combiningDB{}
+
+func (db *combiningDB) CombineAttachments(_ context.Context, _, _, filename, contentType string, parts []string) (string, error) {
+	var content []byte
+	for _, part := range parts {
+		content = append(content, db.atts[part]...)
+		delete(db.atts, part)
+	}
+	db.atts[filename], db.types[filename] = content, contentType
+	db.rev++
+	return db.currentRev(), nil
+}
+
+func TestPutChunkedAttachment(t *testing.T) {
+	content := []byte("0123456789abcdefghij")
+	driverDB := newAttachmentsDB()
+	driverDB.failAt = 3
+	db := &DB{driverDB: driverDB}
+	var progress []int64
+	upload := &ChunkedUpload{
+		DocID:       "foo",
+		Filename:    "bar.txt",
+		ContentType: "text/plain",
+		Content:     bytes.NewReader(content),
+		Size:        int64(len(content)),
+		ChunkSize:   6,
+		Progress:    func(uploaded, _ int64) { progress = append(progress, uploaded) },
+	}
+	if _, err := db.PutChunkedAttachment(context.Background(), upload); StatusCode(err) != StatusRequestTimeout {
+		t.Fatalf("Expected the third chunk to fail, got %v", err)
+	}
+	logID := uploadLogID("foo", "bar.txt")
+	if _, ok := driverDB.locals[logID]; !ok {
+		t.Fatal("Expected the progress to be recorded")
+	}
+	rev, err := db.PutChunkedAttachment(context.Background(), upload)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rev != "4-x" {
+		t.Errorf("Unexpected rev %s", rev)
+	}
+	if driverDB.puts != 5 {
+		t.Errorf("Expected only the remaining chunks to be uploaded, got %d uploads", driverDB.puts)
+	}
+	if d := diff.Interface([]int64{6, 12, 6, 12, 18, 20}, progress); d != "" {
+		t.Errorf("Unexpected progress:\n%s", d)
+	}
+	if _, ok := driverDB.locals[logID]; ok {
+		t.Error("Expected the progress to be deleted once complete")
+	}
+	att, err := db.GetChunkedAttachment(context.Background(), "foo", "bar.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = att.Close() }()
+	if att.ContentType != "text/plain" {
+		t.Errorf("Unexpected content type %s", att.ContentType)
+	}
+	result, err := ioutil.ReadAll(att)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if d := diff.Text(string(content), string(result)); d != "" {
+		t.Error(d)
+	}
+}
+
+func TestPutChunkedAttachmentChanged(t *testing.T) {
+	content := []byte("0123456789abcdefghij")
+	driverDB := newAttachmentsDB()
+	driverDB.failAt = 3
+	db := &DB{driverDB: driverDB}
+	upload := &ChunkedUpload{
+		DocID:     "foo",
+		Filename:  "bar.txt",
+		Content:   bytes.NewReader(content),
+		Size:      int64(len(content)),
+		ChunkSize: 6,
+	}
+	_, _ = db.PutChunkedAttachment(context.Background(), upload)
+	changed := []byte("0123456789ABCDEFGHIJ")
+	upload.Content = bytes.NewReader(changed)
+	if _, err := db.PutChunkedAttachment(context.Background(), upload); err != nil {
+		t.Fatal(err)
+	}
+	if driverDB.puts != 6 {
+		t.Errorf("Expected the changed chunk to be uploaded again, got %d uploads", driverDB.puts)
+	}
+	if got := string(driverDB.atts["bar.txt.part000001"]); got != "6789AB" {
+		t.Errorf("Unexpected second chunk %s", got)
+	}
+}
+
+func TestPutChunkedAttachmentCombined(t *testing.T) {
+	content := []byte("0123456789abcdefghij")
+	driverDB := &combiningDB{attachmentsDB: newAttachmentsDB()}
+	db := &DB{driverDB: driverDB}
+	rev, err := db.PutChunkedAttachment(context.Background(), &ChunkedUpload{
+		DocID:     "foo",
+		Filename:  "bar.txt",
+		Content:   bytes.NewReader(content),
+		Size:      int64(len(content)),
+		ChunkSize: 8,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rev != "4-x" {
+		t.Errorf("Unexpected rev %s", rev)
+	}
+	expected := map[string][]byte{"bar.txt": content}
+	if d := diff.Interface(expected, driverDB.atts); d != "" {
+		t.Error(d)
+	}
+	if cType := driverDB.types["bar.txt"]; cType != "application/octet-stream" {
+		t.Errorf("Unexpected content type %s", cType)
+	}
+}
+
+// uncombinedDB implements AttachmentCombiner, as a wrapper driver does, for a
+// DB which does not support it.
+type uncombinedDB struct {
+	*attachmentsDB
+}
+
+func (db *uncombinedDB) CombineAttachments(_ context.Context, _, _, _, _ string, _ []string) (string, error) {
+	return "", errors.Status(StatusNotImplemented, "not supported")
+}
+
+func TestPutChunkedAttachmentNotCombined(t *testing.T) {
+	content := []byte("0123456789abcdefghij")
+	driverDB := &uncombinedDB{attachmentsDB: newAttachmentsDB()}
+	db := &DB{driverDB: driverDB}
+	rev, err := db.PutChunkedAttachment(context.Background(), &ChunkedUpload{
+		DocID:     "foo",
+		Filename:  "bar.txt",
+		Content:   bytes.NewReader(content),
+		Size:      int64(len(content)),
+		ChunkSize: 8,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rev != "3-x" {
+		t.Errorf("Unexpected rev %s", rev)
+	}
+	expected := map[string][]byte{
+		"bar.txt.part000000": content[:8],
+		"bar.txt.part000001": content[8:16],
+		"bar.txt.part000002": content[16:],
+	}
+	if d := diff.Interface(expected, driverDB.atts); d != "" {
+		t.Error(d)
+	}
+}
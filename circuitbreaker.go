@@ -0,0 +1,232 @@
+package kivik
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/flimzy/kivik/errors"
+)
+
+// Defaults for CircuitBreakerOptions.
+const (
+	DefaultCircuitThreshold = 5
+	DefaultCircuitCooldown  = 30 * time.Second
+)
+
+// CircuitState is the state of a circuit of a CircuitBreaker.
+type CircuitState int
+
+// The states of a circuit.
+const (
+	// CircuitClosed is the normal state, in which operations are passed to
+	// the driver.
+	CircuitClosed CircuitState = iota
+	// CircuitOpen is the state after consecutive failures, in which
+	// operations fail fast with a *CircuitOpenError.
+	CircuitOpen
+	// CircuitHalfOpen is the state after the cooldown, in which a single
+	// operation is passed to the driver as a probe, to close the circuit if it
+	// succeeds, or open it again if it fails.
+	CircuitHalfOpen
+)
+
+func (s CircuitState) String() string {
+	switch s {
+	case CircuitClosed:
+		return "closed"
+	case CircuitOpen:
+		return "open"
+	case CircuitHalfOpen:
+		return "half-open"
+	}
+	return fmt.Sprintf("CircuitState(%d)", int(s))
+}
+
+// CircuitOpenError is the error of an operation failed fast by a
+// CircuitBreaker, without calling the driver. It has status
+// StatusServiceUnavailable, and compares equal to ErrCircuitOpen with the
+// standard library's errors.Is.
+type CircuitOpenError struct {
+	// DB is the name of the database of the open circuit, or empty for the
+	// circuit of the server.
+	DB string
+	// Until is the time at which the circuit half-opens, to allow a probe.
+	Until time.Time
+}
+
+// ErrCircuitOpen compares equal to any *CircuitOpenError, with the standard
+// library's errors.Is.
+var ErrCircuitOpen error = &CircuitOpenError{}
+
+func (e *CircuitOpenError) Error() string {
+	if e.DB == "" {
+		return "kivik: circuit open for server"
+	}
+	return fmt.Sprintf("kivik: circuit open for database %s", e.DB)
+}
+
+// StatusCode returns StatusServiceUnavailable.
+func (e *CircuitOpenError) StatusCode() int {
+	return StatusServiceUnavailable
+}
+
+// Is returns true if target is a *CircuitOpenError.
+func (e *CircuitOpenError) Is(target error) bool {
+	_, ok := target.(*CircuitOpenError)
+	return ok
+}
+
+// CircuitBreakerOptions configures a CircuitBreaker.
+type CircuitBreakerOptions struct {
+	// Threshold is the number of consecutive failures after which a circuit
+	// opens. If zero, DefaultCircuitThreshold is used.
+	Threshold int
+	// Cooldown is the time for which a circuit stays open, before it
+	// half-opens. If zero, DefaultCircuitCooldown is used.
+	Cooldown time.Duration
+	// IsFailure returns true if err is a failure of the backend. If nil,
+	// errors.Retryable is used, so that network errors and 5xx statuses are
+	// failures, but errors such as 404 Not Found, or cancelled contexts, are
+	// not. Other errors count as successes, as the backend responded.
+	IsFailure func(err error) bool
+	// SharedCircuit, if true, uses a single circuit for every operation of
+	// the client, rather than one circuit per database, and another for the
+	// operations of the server, such as AllDBs.
+	SharedCircuit bool
+	// OnStateChange, if set, is called when a circuit changes state, with the
+	// name of its database, or empty for the server's or shared circuit.
+	OnStateChange func(db string, from, to CircuitState)
+}
+
+// CircuitBreaker returns middleware, for Client.Use, which protects the
+// backend from the operations of the client while it is failing. After
+// Threshold consecutive failures of the operations of a database, its circuit
+// opens, and its operations fail fast with a *CircuitOpenError, for Cooldown.
+// Then the circuit half-opens: the next operation is passed to the driver as
+// a probe, while others continue to fail fast, and the circuit closes if the
+// probe succeeds, or opens again if it fails. Each database has its own
+// circuit, as does the server, unless SharedCircuit is set.
+func CircuitBreaker(opts CircuitBreakerOptions) Middleware {
+	return newCircuitBreaker(opts, time.Now).middleware
+}
+
+func (cb *circuitBreaker) middleware(next Invoker) Invoker {
+	return func(ctx context.Context, op *Operation) (interface{}, error) {
+		key := op.DB
+		if cb.opts.SharedCircuit {
+			key = ""
+		}
+		probe, err := cb.allow(key)
+		if err != nil {
+			return nil, err
+		}
+		result, err := next(ctx, op)
+		cb.record(key, probe, err)
+		return result, err
+	}
+}
+
+type circuit struct {
+	state    CircuitState
+	failures int
+	openedAt time.Time
+	probing  bool
+}
+
+type circuitBreaker struct {
+	opts     CircuitBreakerOptions
+	now      func() time.Time
+	mu       sync.Mutex
+	circuits map[string]*circuit
+}
+
+func newCircuitBreaker(opts CircuitBreakerOptions, now func() time.Time) *circuitBreaker {
+	if opts.Threshold <= 0 {
+		opts.Threshold = DefaultCircuitThreshold
+	}
+	if opts.Cooldown <= 0 {
+		opts.Cooldown = DefaultCircuitCooldown
+	}
+	if opts.IsFailure == nil {
+		opts.IsFailure = errors.Retryable
+	}
+	return &circuitBreaker{
+		opts:     opts,
+		now:      now,
+		circuits: make(map[string]*circuit),
+	}
+}
+
+// allow returns an error if the circuit of key is open, or half-open with a
+// probe in progress. probe is true if the operation is the probe of a
+// half-open circuit.
+func (cb *circuitBreaker) allow(key string) (probe bool, err error) {
+	cb.mu.Lock()
+	c, ok := cb.circuits[key]
+	if !ok {
+		c = &circuit{}
+		cb.circuits[key] = c
+	}
+	var from CircuitState
+	changed := false
+	switch c.state {
+	case CircuitOpen:
+		if until := c.openedAt.Add(cb.opts.Cooldown); cb.now().Before(until) {
+			cb.mu.Unlock()
+			return false, &CircuitOpenError{DB: key, Until: until}
+		}
+		from, changed = c.state, true
+		c.state = CircuitHalfOpen
+		fallthrough
+	case CircuitHalfOpen:
+		if c.probing {
+			cb.mu.Unlock()
+			return false, &CircuitOpenError{DB: key, Until: c.openedAt.Add(cb.opts.Cooldown)}
+		}
+		c.probing, probe = true, true
+	}
+	cb.mu.Unlock()
+	if changed {
+		cb.changed(key, from, CircuitHalfOpen)
+	}
+	return probe, nil
+}
+
+// record records the outcome of an operation allowed by allow.
+func (cb *circuitBreaker) record(key string, probe bool, err error) {
+	failed := err != nil && cb.opts.IsFailure(err)
+	cb.mu.Lock()
+	c := cb.circuits[key]
+	from := c.state
+	switch {
+	case probe:
+		c.probing = false
+		if failed {
+			c.state, c.openedAt = CircuitOpen, cb.now()
+		} else {
+			c.state, c.failures = CircuitClosed, 0
+		}
+	case c.state != CircuitClosed:
+		// The outcome of an operation begun before the circuit opened.
+	case !failed:
+		c.failures = 0
+	default:
+		c.failures++
+		if c.failures >= cb.opts.Threshold {
+			c.state, c.openedAt = CircuitOpen, cb.now()
+		}
+	}
+	to := c.state
+	cb.mu.Unlock()
+	if from != to {
+		cb.changed(key, from, to)
+	}
+}
+
+func (cb *circuitBreaker) changed(key string, from, to CircuitState) {
+	if cb.opts.OnStateChange != nil {
+		cb.opts.OnStateChange(key, from, to)
+	}
+}
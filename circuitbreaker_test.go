@@ -0,0 +1,125 @@
+package kivik
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/flimzy/diff"
+	"github.com/flimzy/kivik/errors"
+)
+
+func TestCircuitBreaker(t *testing.T) {
+	now := time.Date(2017, 1, 1, 0, 0, 0, 0, time.UTC)
+	var transitions []string
+	cb := newCircuitBreaker(CircuitBreakerOptions{
+		Threshold: 2,
+		Cooldown:  time.Minute,
+		OnStateChange: func(db string, from, to CircuitState) {
+			transitions = append(transitions, db+":"+from.String()+"->"+to.String())
+		},
+	}, func() time.Time { return now })
+	var calls int
+	var fail error
+	invoke := cb.middleware(func(_ context.Context, _ *Operation) (interface{}, error) {
+		calls++
+		return nil, fail
+	})
+	call := func(db string) error {
+		_, err := invoke(context.Background(), &Operation{Name: "Get", DB: db})
+		return err
+	}
+	down := errors.Status(StatusBadResponse, "bad gateway")
+
+	fail = errors.Status(StatusNotFound, "missing")
+	for i := 0; i < 3; i++ {
+		if err := call("foo"); StatusCode(err) != StatusNotFound {
+			t.Fatalf("Expected not found, got %v", err)
+		}
+	}
+	fail = down
+	_ = call("foo")
+	fail = nil
+	_ = call("foo")
+	fail = down
+	_ = call("foo")
+	_ = call("foo")
+	if calls != 7 {
+		t.Fatalf("Expected 7 calls before the circuit opens, got %d", calls)
+	}
+	err := call("foo")
+	if StatusCode(err) != StatusServiceUnavailable {
+		t.Errorf("Expected status %d, got %d", StatusServiceUnavailable, StatusCode(err))
+	}
+	if open, ok := err.(*CircuitOpenError); !ok || !open.Is(ErrCircuitOpen) || open.DB != "foo" || !open.Until.Equal(now.Add(time.Minute)) {
+		t.Errorf("Unexpected error: %#v", err)
+	}
+	if calls != 7 {
+		t.Errorf("Expected the open circuit to fail fast")
+	}
+	fail = nil
+	if err := call("bar"); err != nil {
+		t.Errorf("Expected bar's circuit to be closed, got %s", err)
+	}
+
+	now = now.Add(time.Minute)
+	fail = down
+	_ = call("foo")
+	if err := call("foo"); StatusCode(err) != StatusServiceUnavailable {
+		t.Errorf("Expected the failed probe to open the circuit, got %v", err)
+	}
+	now = now.Add(time.Minute)
+	fail = nil
+	if err := call("foo"); err != nil {
+		t.Errorf("Expected the probe to succeed, got %s", err)
+	}
+	if err := call("foo"); err != nil {
+		t.Errorf("Expected the circuit to be closed, got %s", err)
+	}
+	expected := []string{
+		"foo:closed->open",
+		"foo:open->half-open",
+		"foo:half-open->open",
+		"foo:open->half-open",
+		"foo:half-open->closed",
+	}
+	if d := diff.Interface(expected, transitions); d != "" {
+		t.Error(d)
+	}
+}
+
+func TestCircuitBreakerProbe(t *testing.T) {
+	now := time.Date(2017, 1, 1, 0, 0, 0, 0, time.UTC)
+	cb := newCircuitBreaker(CircuitBreakerOptions{Threshold: 1, SharedCircuit: true}, func() time.Time { return now })
+	probing := make(chan struct{})
+	release := make(chan struct{})
+	invoke := cb.middleware(func(_ context.Context, op *Operation) (interface{}, error) {
+		if op.Name == "Probe" {
+			close(probing)
+			<-release
+			return nil, nil
+		}
+		if op.Name == "AllDocs" {
+			return nil, nil
+		}
+		return nil, errors.Status(StatusInternalServerError, "down")
+	})
+	_, _ = invoke(context.Background(), &Operation{Name: "Get", DB: "foo"})
+	now = now.Add(DefaultCircuitCooldown)
+	done := make(chan error)
+	go func() {
+		_, err := invoke(context.Background(), &Operation{Name: "Probe"})
+		done <- err
+	}()
+	<-probing
+	if _, err := invoke(context.Background(), &Operation{Name: "Get", DB: "bar"}); StatusCode(err) != StatusServiceUnavailable {
+		t.Errorf("Expected the shared circuit to fail fast during the probe, got %v", err)
+	}
+	close(release)
+	if err := <-done; err != nil {
+		t.Fatal(err)
+	}
+	if _, err := invoke(context.Background(), &Operation{Name: "AllDocs", DB: "bar"}); err != nil {
+		t.Errorf("Expected the circuit to close, got %s", err)
+	}
+}
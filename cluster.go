@@ -0,0 +1,63 @@
+package kivik
+
+import (
+	"context"
+
+	"github.com/flimzy/kivik/driver"
+	"github.com/flimzy/kivik/errors"
+)
+
+// Membership lists the nodes of a CouchDB 2.x cluster.
+type Membership struct {
+	// AllNodes are the nodes known to the node the client is connected to.
+	AllNodes []string `json:"all_nodes"`
+	// ClusterNodes are the nodes of the cluster.
+	ClusterNodes []string `json:"cluster_nodes"`
+}
+
+func (c *Client) clusterer() (driver.Clusterer, error) {
+	clusterer, ok := c.driverClient.(driver.Clusterer)
+	if !ok {
+		return nil, errors.Status(StatusNotImplemented, "kivik: driver does not support cluster membership")
+	}
+	return clusterer, nil
+}
+
+// Membership returns the nodes of the cluster.
+func (c *Client) Membership(ctx context.Context) (*Membership, error) {
+	clusterer, err := c.clusterer()
+	if err != nil {
+		return nil, err
+	}
+	membership, err := clusterer.Membership(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return &Membership{
+		AllNodes:     membership.AllNodes,
+		ClusterNodes: membership.ClusterNodes,
+	}, nil
+}
+
+// AddNode adds the named node, such as "couchdb@10.0.0.2", to the cluster,
+// by adding it to the _nodes database of the node the client is connected
+// to. The node must already be running, and share the cluster's Erlang
+// cookie.
+func (c *Client) AddNode(ctx context.Context, node string) error {
+	clusterer, err := c.clusterer()
+	if err != nil {
+		return err
+	}
+	return clusterer.AddNode(ctx, node)
+}
+
+// RemoveNode removes the named node from the cluster, by deleting it from the
+// _nodes database of the node the client is connected to. Any database
+// shards on the node should be moved first.
+func (c *Client) RemoveNode(ctx context.Context, node string) error {
+	clusterer, err := c.clusterer()
+	if err != nil {
+		return err
+	}
+	return clusterer.RemoveNode(ctx, node)
+}
@@ -9,10 +9,13 @@ import (
 	"github.com/spf13/pflag"
 
 	"github.com/flimzy/kivik"
+	_ "github.com/flimzy/kivik/driver/bolt"
 	_ "github.com/flimzy/kivik/driver/couchdb"
+	_ "github.com/flimzy/kivik/driver/leveldb"
 	_ "github.com/flimzy/kivik/driver/memory"
 	"github.com/flimzy/kivik/serve"
 	"github.com/flimzy/kivik/test"
+	"github.com/flimzy/kivik/test/bench"
 )
 
 func main() {
@@ -64,6 +67,8 @@ func main() {
 	cmdTest.Flags().BoolVarP(&rw, "write", "w", false, "Allow tests which write to the database")
 	var cleanup bool
 	cmdTest.Flags().BoolVarP(&cleanup, "cleanup", "c", false, "Clean up after previous test run, then exit")
+	var report string
+	cmdTest.Flags().StringVarP(&report, "report", "", "", "Write JSON and HTML conformance reports to this directory")
 	cmdTest.Run = func(cmd *cobra.Command, args []string) {
 		if listTests {
 			test.ListTests()
@@ -81,14 +86,61 @@ func main() {
 			Suites:  tests,
 			Match:   run,
 			Cleanup: cleanup,
+			Report:  report,
 		})
 	}
 
+	cmdBench := &cobra.Command{
+		Use:   "bench [DSN]",
+		Short: "Run the benchmark suite against the requested driver",
+	}
+	var benchDriver string
+	cmdBench.Flags().StringVarP(&benchDriver, "driver", "d", "couch", "Driver to benchmark")
+	var benchN int
+	cmdBench.Flags().IntVarP(&benchN, "count", "n", bench.DefaultN, "Number of iterations per benchmark")
+	var benchRun string
+	cmdBench.Flags().StringVarP(&benchRun, "run", "", "", "Run only those benchmarks matching the regular expression")
+	var benchJSON bool
+	cmdBench.Flags().BoolVarP(&benchJSON, "json", "", false, "Output results as JSON")
+	cmdBench.Run = func(cmd *cobra.Command, args []string) {
+		if len(args) > 1 {
+			cmd.Usage()
+			os.Exit(1)
+		}
+		var benchDSN string
+		if len(args) == 1 {
+			benchDSN = args[0]
+		}
+		client, err := kivik.New(context.Background(), benchDriver, benchDSN)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Failed to connect: %s\n", err)
+			os.Exit(1)
+		}
+		results, err := bench.Run(context.Background(), client, bench.Options{
+			N:     benchN,
+			Match: benchRun,
+		})
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Benchmarks failed: %s\n", err)
+			os.Exit(1)
+		}
+		if benchJSON {
+			err = bench.WriteJSON(os.Stdout, results)
+		} else {
+			err = bench.WriteText(os.Stdout, results)
+		}
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Failed to write results: %s\n", err)
+			os.Exit(1)
+		}
+	}
+
 	rootCmd := &cobra.Command{
 		Use:  "kivik",
-		Long: "Kivik is a tool for hosting and testing CouchDB services",
+		Long: "Kivik is a tool for hosting, testing and scripting CouchDB services",
 	}
-	rootCmd.AddCommand(cmdServe, cmdTest)
+	rootCmd.AddCommand(cmdServe, cmdTest, cmdBench)
+	rootCmd.AddCommand(shellCommands()...)
 	err := rootCmd.Execute()
 	if err != nil {
 		os.Exit(2)
@@ -0,0 +1,699 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/spf13/cobra"
+
+	"github.com/flimzy/kivik"
+	"github.com/flimzy/kivik/export"
+	"github.com/flimzy/kivik/maintain"
+	"github.com/flimzy/kivik/mango"
+)
+
+// shell holds the connection flags shared by the client subcommands.
+type shell struct {
+	driverName string
+	dsn        string
+	options    []string
+	out        io.Writer
+}
+
+// addFlags adds the connection flags to cmd.
+func (s *shell) addFlags(cmd *cobra.Command) {
+	cmd.Flags().StringVarP(&s.driverName, "driver", "d", "couch", "Driver to use")
+	cmd.Flags().StringVarP(&s.dsn, "dsn", "", os.Getenv("KIVIK_DSN"), "Data source name (default $KIVIK_DSN)")
+}
+
+// addOptions adds the -o flag, for passing options to the driver, to cmd.
+func (s *shell) addOptions(cmd *cobra.Command) {
+	cmd.Flags().StringSliceVarP(&s.options, "option", "o", nil, "Option to pass to the server, as key=value")
+}
+
+func (s *shell) client(ctx context.Context) (*kivik.Client, error) {
+	return kivik.New(ctx, s.driverName, s.dsn)
+}
+
+func (s *shell) db(ctx context.Context, dbName string) (*kivik.DB, error) {
+	client, err := s.client(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return client.DB(ctx, dbName)
+}
+
+// opts returns the options passed with -o.
+func (s *shell) opts() (kivik.Options, error) {
+	opts := kivik.Options{}
+	for _, opt := range s.options {
+		parts := strings.SplitN(opt, "=", 2)
+		if len(parts) != 2 {
+			return nil, fmt.Errorf("invalid option %q; expected key=value", opt)
+		}
+		opts[parts[0]] = parts[1]
+	}
+	return opts, nil
+}
+
+// print writes v to the output as a single line of JSON.
+func (s *shell) print(v interface{}) error {
+	return json.NewEncoder(s.out).Encode(v)
+}
+
+// run returns a cobra Run function which calls fn, and exits with an error
+// message if fn fails, or if the number of arguments is outside the range min
+// to max. A negative max allows any number of arguments.
+func run(min, max int, fn func(ctx context.Context, args []string) error) func(*cobra.Command, []string) {
+	return func(cmd *cobra.Command, args []string) {
+		if len(args) < min || (max >= 0 && len(args) > max) {
+			cmd.Usage()
+			os.Exit(1)
+		}
+		if err := fn(context.Background(), args); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %s\n", err)
+			os.Exit(1)
+		}
+	}
+}
+
+// readInput reads the named file, or standard input if name is empty or "-".
+func readInput(name string) ([]byte, error) {
+	if name == "" || name == "-" {
+		return ioutil.ReadAll(os.Stdin)
+	}
+	return ioutil.ReadFile(name)
+}
+
+func validJSON(data []byte) bool {
+	var v interface{}
+	return json.Unmarshal(data, &v) == nil
+}
+
+// shellCommands returns the client subcommands.
+func shellCommands() []*cobra.Command {
+	s := &shell{out: os.Stdout}
+	cmds := []*cobra.Command{
+		s.cmdGet(), s.cmdPut(), s.cmdDelete(),
+		s.cmdQuery(), s.cmdFind(), s.cmdIndexAdvice(),
+		s.cmdDBs(), s.cmdCreateDB(), s.cmdDestroyDB(),
+		s.cmdChanges(), s.cmdReplicate(),
+		s.cmdDump(), s.cmdRestore(), s.cmdExport(), s.cmdImport(), s.cmdMaintain(),
+	}
+	for _, cmd := range cmds {
+		s.addFlags(cmd)
+	}
+	return cmds
+}
+
+func (s *shell) cmdGet() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "get DB DOCID",
+		Short: "Fetch a document",
+	}
+	s.addOptions(cmd)
+	cmd.Run = run(2, 2, func(ctx context.Context, args []string) error {
+		db, err := s.db(ctx, args[0])
+		if err != nil {
+			return err
+		}
+		opts, err := s.opts()
+		if err != nil {
+			return err
+		}
+		row, err := db.Get(ctx, args[1], opts)
+		if err != nil {
+			return err
+		}
+		var doc json.RawMessage
+		if err = row.ScanDoc(&doc); err != nil {
+			return err
+		}
+		return s.print(doc)
+	})
+	return cmd
+}
+
+func (s *shell) cmdPut() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "put DB DOCID [FILE]",
+		Short: "Create or update a document, read from FILE or standard input",
+	}
+	cmd.Run = run(2, 3, func(ctx context.Context, args []string) error {
+		var filename string
+		if len(args) == 3 {
+			filename = args[2]
+		}
+		body, err := readInput(filename)
+		if err != nil {
+			return err
+		}
+		if !validJSON(body) {
+			return fmt.Errorf("document is not valid JSON")
+		}
+		db, err := s.db(ctx, args[0])
+		if err != nil {
+			return err
+		}
+		rev, err := db.Put(ctx, args[1], json.RawMessage(body))
+		if err != nil {
+			return err
+		}
+		return s.print(map[string]string{"id": args[1], "rev": rev})
+	})
+	return cmd
+}
+
+func (s *shell) cmdDelete() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "delete DB DOCID [REV]",
+		Short: "Delete a document, by default at its current revision",
+	}
+	cmd.Run = run(2, 3, func(ctx context.Context, args []string) error {
+		db, err := s.db(ctx, args[0])
+		if err != nil {
+			return err
+		}
+		var rev string
+		if len(args) == 3 {
+			rev = args[2]
+		} else if rev, err = db.Rev(ctx, args[1]); err != nil {
+			return err
+		}
+		newRev, err := db.Delete(ctx, args[1], rev)
+		if err != nil {
+			return err
+		}
+		return s.print(map[string]string{"id": args[1], "rev": newRev})
+	})
+	return cmd
+}
+
+// printRows prints each row as a line of JSON.
+func (s *shell) printRows(rows *kivik.Rows) error {
+	defer func() { _ = rows.Close() }()
+	for rows.Next() {
+		var row struct {
+			ID    string          `json:"id,omitempty"`
+			Key   json.RawMessage `json:"key,omitempty"`
+			Value json.RawMessage `json:"value,omitempty"`
+			Doc   json.RawMessage `json:"doc,omitempty"`
+		}
+		row.ID = rows.ID()
+		if key := rows.Key(); key != "" {
+			row.Key = json.RawMessage(key)
+		}
+		_ = rows.ScanValue(&row.Value)
+		_ = rows.ScanDoc(&row.Doc)
+		if err := s.print(row); err != nil {
+			return err
+		}
+	}
+	return rows.Err()
+}
+
+func (s *shell) cmdQuery() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "query DB DDOC VIEW",
+		Short: "Query a view, printing one row per line; use DDOC _all_docs to query all documents",
+	}
+	s.addOptions(cmd)
+	cmd.Run = run(2, 3, func(ctx context.Context, args []string) error {
+		db, err := s.db(ctx, args[0])
+		if err != nil {
+			return err
+		}
+		opts, err := s.opts()
+		if err != nil {
+			return err
+		}
+		var rows *kivik.Rows
+		if args[1] == "_all_docs" {
+			rows, err = db.AllDocs(ctx, opts)
+		} else if len(args) == 3 {
+			rows, err = db.Query(ctx, args[1], args[2], opts)
+		} else {
+			return fmt.Errorf("a view name is required")
+		}
+		if err != nil {
+			return err
+		}
+		return s.printRows(rows)
+	})
+	return cmd
+}
+
+func (s *shell) cmdFind() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "find DB [QUERY]",
+		Short: "Run a Mango query, read as JSON from QUERY or standard input, printing one document per line",
+	}
+	cmd.Run = run(1, 2, func(ctx context.Context, args []string) error {
+		var query []byte
+		if len(args) == 2 {
+			query = []byte(args[1])
+		} else {
+			var err error
+			if query, err = readInput(""); err != nil {
+				return err
+			}
+		}
+		if !validJSON(query) {
+			return fmt.Errorf("query is not valid JSON")
+		}
+		db, err := s.db(ctx, args[0])
+		if err != nil {
+			return err
+		}
+		rows, err := db.Find(ctx, json.RawMessage(query))
+		if err != nil {
+			return err
+		}
+		defer func() { _ = rows.Close() }()
+		for rows.Next() {
+			var doc json.RawMessage
+			if err = rows.ScanDoc(&doc); err != nil {
+				return err
+			}
+			if err = s.print(doc); err != nil {
+				return err
+			}
+		}
+		if warning := rows.Warning(); warning != "" {
+			fmt.Fprintf(os.Stderr, "Warning: %s\n", warning)
+		}
+		return rows.Err()
+	})
+	return cmd
+}
+
+func (s *shell) cmdIndexAdvice() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "index-advice DB [FILE]",
+		Short: "Explain the Mango queries read from FILE or standard input, one per line, reporting unused and missing indexes",
+	}
+	var check bool
+	cmd.Flags().BoolVarP(&check, "check", "", false, "Fail if any index is unused, or any query requires a full scan")
+	cmd.Run = run(1, 2, func(ctx context.Context, args []string) error {
+		var name string
+		if len(args) == 2 {
+			name = args[1]
+		}
+		input, err := readInput(name)
+		if err != nil {
+			return err
+		}
+		queries, err := mango.ReadQueries(bytes.NewReader(input))
+		if err != nil {
+			return err
+		}
+		db, err := s.db(ctx, args[0])
+		if err != nil {
+			return err
+		}
+		report, err := mango.Advise(ctx, db, queries)
+		if err != nil {
+			return err
+		}
+		if err = s.print(report); err != nil {
+			return err
+		}
+		if check && !report.OK() {
+			return fmt.Errorf("%d unused indexes, %d missing indexes", len(report.Unused), len(report.Suggestions))
+		}
+		return nil
+	})
+	return cmd
+}
+
+func (s *shell) cmdDBs() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "dbs",
+		Short: "List all databases",
+	}
+	cmd.Run = run(0, 0, func(ctx context.Context, _ []string) error {
+		client, err := s.client(ctx)
+		if err != nil {
+			return err
+		}
+		dbs, err := client.AllDBs(ctx)
+		if err != nil {
+			return err
+		}
+		for _, dbName := range dbs {
+			fmt.Fprintln(s.out, dbName)
+		}
+		return nil
+	})
+	return cmd
+}
+
+func (s *shell) cmdCreateDB() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "createdb DB",
+		Short: "Create a database",
+	}
+	cmd.Run = run(1, 1, func(ctx context.Context, args []string) error {
+		client, err := s.client(ctx)
+		if err != nil {
+			return err
+		}
+		return client.CreateDB(ctx, args[0])
+	})
+	return cmd
+}
+
+func (s *shell) cmdDestroyDB() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "destroydb DB",
+		Short: "Delete a database",
+	}
+	cmd.Run = run(1, 1, func(ctx context.Context, args []string) error {
+		client, err := s.client(ctx)
+		if err != nil {
+			return err
+		}
+		return client.DestroyDB(ctx, args[0])
+	})
+	return cmd
+}
+
+func (s *shell) cmdChanges() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "changes DB",
+		Short: "Print the changes feed, one change per line",
+	}
+	s.addOptions(cmd)
+	var follow, includeDocs bool
+	var since string
+	cmd.Flags().BoolVarP(&follow, "follow", "f", false, "Follow the feed, waiting for new changes")
+	cmd.Flags().BoolVarP(&includeDocs, "include-docs", "", false, "Include documents")
+	cmd.Flags().StringVarP(&since, "since", "", "", "Print changes after this sequence, or 'now'")
+	cmd.Run = run(1, 1, func(ctx context.Context, args []string) error {
+		db, err := s.db(ctx, args[0])
+		if err != nil {
+			return err
+		}
+		opts, err := s.opts()
+		if err != nil {
+			return err
+		}
+		opts["feed"] = "normal"
+		if follow {
+			opts["feed"] = "continuous"
+		}
+		if since != "" {
+			opts["since"] = since
+		} else if _, ok := opts["since"]; !ok {
+			opts["since"] = "0"
+		}
+		if includeDocs {
+			opts["include_docs"] = true
+		}
+		changes, err := db.Changes(ctx, opts)
+		if err != nil {
+			return err
+		}
+		defer func() { _ = changes.Close() }()
+		for changes.Next() {
+			change := struct {
+				ID      string          `json:"id"`
+				Seq     string          `json:"seq"`
+				Deleted bool            `json:"deleted,omitempty"`
+				Changes []string        `json:"changes"`
+				Doc     json.RawMessage `json:"doc,omitempty"`
+			}{
+				ID:      changes.ID(),
+				Seq:     string(changes.Seq()),
+				Deleted: changes.Deleted(),
+				Changes: changes.Changes(),
+			}
+			if includeDocs {
+				_ = changes.ScanDoc(&change.Doc)
+			}
+			if err = s.print(change); err != nil {
+				return err
+			}
+		}
+		return changes.Err()
+	})
+	return cmd
+}
+
+func (s *shell) cmdReplicate() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "replicate SOURCE TARGET",
+		Short: "Start a replication from SOURCE to TARGET, which may be database names or URLs",
+	}
+	doc := &kivik.ReplicationDoc{}
+	var selector string
+	cmd.Flags().StringVarP(&doc.ID, "id", "", "", "ID of the replication document")
+	cmd.Flags().BoolVarP(&doc.Continuous, "continuous", "", false, "Keep the replication running")
+	cmd.Flags().BoolVarP(&doc.CreateTarget, "create-target", "", false, "Create the target database")
+	cmd.Flags().StringVarP(&selector, "selector", "", "", "Replicate only the documents matching this Mango selector, as JSON")
+	cmd.Flags().StringVarP(&doc.Filter, "filter", "", "", "Replicate only the documents passed by this filter function")
+	cmd.Flags().StringSliceVarP(&doc.DocIDs, "doc-id", "", nil, "Replicate only the documents with these IDs")
+	cmd.Flags().StringVarP(&doc.SinceSeq, "since-seq", "", "", "Start from this sequence of the source")
+	cmd.Run = run(2, 2, func(ctx context.Context, args []string) error {
+		client, err := s.client(ctx)
+		if err != nil {
+			return err
+		}
+		doc.Source.URL, doc.Target.URL = args[0], args[1]
+		if selector != "" {
+			doc.Selector = json.RawMessage(selector)
+		}
+		rep, err := client.ReplicateDoc(ctx, doc)
+		if err != nil {
+			return err
+		}
+		return s.print(map[string]string{"id": rep.ReplicationID(), "state": string(rep.State())})
+	})
+	return cmd
+}
+
+func (s *shell) cmdDump() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "dump [DB...]",
+		Short: "Write the named databases, or all databases, to standard output as line-delimited JSON",
+	}
+	var output string
+	cmd.Flags().StringVarP(&output, "output", "", "", "Write to this file instead of standard output")
+	cmd.Run = run(0, -1, func(ctx context.Context, args []string) error {
+		client, err := s.client(ctx)
+		if err != nil {
+			return err
+		}
+		if output == "" {
+			return client.Dump(ctx, s.out, args...)
+		}
+		f, err := os.Create(output)
+		if err != nil {
+			return err
+		}
+		if err = client.Dump(ctx, f, args...); err != nil {
+			_ = f.Close()
+			return err
+		}
+		return f.Close()
+	})
+	return cmd
+}
+
+func (s *shell) cmdRestore() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "restore [FILE]",
+		Short: "Restore a dump from FILE or standard input",
+	}
+	cmd.Run = run(0, 1, func(ctx context.Context, args []string) error {
+		client, err := s.client(ctx)
+		if err != nil {
+			return err
+		}
+		in := os.Stdin
+		if len(args) == 1 && args[0] != "-" {
+			if in, err = os.Open(args[0]); err != nil {
+				return err
+			}
+			defer func() { _ = in.Close() }()
+		}
+		return client.Restore(ctx, in)
+	})
+	return cmd
+}
+
+func (s *shell) cmdExport() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "export DB [DDOC VIEW]",
+		Short: "Export the rows of a view, or the documents matched by --find, as CSV, NDJSON or flattened JSON",
+	}
+	s.addOptions(cmd)
+	var format, find, output, separator string
+	var fieldSpecs []string
+	var noHeader bool
+	cmd.Flags().StringVarP(&format, "format", "", string(export.NDJSON), "Output format: ndjson, csv or flat")
+	cmd.Flags().StringSliceVarP(&fieldSpecs, "field", "", nil, "Field to export, as name=path or path, such as total=doc.total")
+	cmd.Flags().StringVarP(&find, "find", "", "", "Export the documents matched by this Mango query, instead of a view")
+	cmd.Flags().StringVarP(&separator, "separator", "", export.DefaultSeparator, "Separator of the keys of flattened objects")
+	cmd.Flags().BoolVarP(&noHeader, "no-header", "", false, "Omit the CSV header")
+	cmd.Flags().StringVarP(&output, "output", "", "", "Write to this file instead of standard output")
+	cmd.Run = run(1, 3, func(ctx context.Context, args []string) error {
+		fields, err := export.ParseFields(fieldSpecs)
+		if err != nil {
+			return err
+		}
+		db, err := s.db(ctx, args[0])
+		if err != nil {
+			return err
+		}
+		var rows *kivik.Rows
+		switch {
+		case find != "":
+			if len(args) != 1 {
+				return fmt.Errorf("--find may not be used with a view")
+			}
+			if !validJSON([]byte(find)) {
+				return fmt.Errorf("query is not valid JSON")
+			}
+			rows, err = db.Find(ctx, json.RawMessage(find))
+		case len(args) == 3:
+			var opts kivik.Options
+			if opts, err = s.opts(); err != nil {
+				return err
+			}
+			rows, err = db.Query(ctx, args[1], args[2], opts)
+		default:
+			return fmt.Errorf("a design document and view, or --find, are required")
+		}
+		if err != nil {
+			return err
+		}
+		opts := export.Options{
+			Format:    export.Format(format),
+			Fields:    fields,
+			Separator: separator,
+			NoHeader:  noHeader,
+		}
+		if output == "" {
+			_, err = export.Rows(s.out, rows, opts)
+			return err
+		}
+		f, err := os.Create(output)
+		if err != nil {
+			_ = rows.Close()
+			return err
+		}
+		if _, err = export.Rows(f, rows, opts); err != nil {
+			_ = f.Close()
+			return err
+		}
+		return f.Close()
+	})
+	return cmd
+}
+
+func (s *shell) cmdImport() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "import DB [FILE]",
+		Short: "Import documents from CSV, NDJSON or flattened JSON, read from FILE or standard input",
+	}
+	var format, rejects string
+	var opts export.ImportOptions
+	cmd.Flags().StringVarP(&format, "format", "", string(export.NDJSON), "Input format: ndjson, csv or flat")
+	cmd.Flags().StringVarP(&opts.Separator, "separator", "", export.DefaultSeparator, "Separator of the keys of flattened objects")
+	cmd.Flags().BoolVarP(&opts.InferTypes, "infer-types", "", false, "Convert CSV values which are JSON numbers, booleans, objects or arrays")
+	cmd.Flags().StringSliceVarP(&opts.IDFields, "id-field", "", nil, "Field from which to derive the ID of documents without one")
+	cmd.Flags().StringVarP(&opts.IDSeparator, "id-separator", "", export.DefaultIDSeparator, "Separator of the fields of derived IDs")
+	cmd.Flags().StringVarP(&opts.IDPrefix, "id-prefix", "", "", "Prefix of derived IDs")
+	cmd.Flags().StringVarP(&rejects, "rejects", "", "", "Write rejected records to this file")
+	cmd.Flags().IntVarP(&opts.BulkWriter.BatchSize, "batch-size", "", kivik.DefaultBulkBatchSize, "Number of documents written in each request")
+	cmd.Run = run(1, 2, func(ctx context.Context, args []string) error {
+		opts.Format = export.Format(format)
+		opts.OnReject = func(r export.Reject) {
+			fmt.Fprintf(os.Stderr, "Rejected record %d: %s\n", r.Record, r.Err)
+		}
+		db, err := s.db(ctx, args[0])
+		if err != nil {
+			return err
+		}
+		in := os.Stdin
+		if len(args) == 2 && args[1] != "-" {
+			if in, err = os.Open(args[1]); err != nil {
+				return err
+			}
+			defer func() { _ = in.Close() }()
+		}
+		if rejects != "" {
+			f, err := os.Create(rejects)
+			if err != nil {
+				return err
+			}
+			defer func() { _ = f.Close() }()
+			opts.Rejects = f
+		}
+		result, err := export.Import(ctx, db, in, opts)
+		if err != nil {
+			return err
+		}
+		return s.print(result)
+	})
+	return cmd
+}
+
+func (s *shell) cmdMaintain() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "maintain [DB...]",
+		Short: "Compact the named databases, or all databases, whose disk size exceeds their active size by the threshold",
+	}
+	var opts maintain.Options
+	cmd.Flags().Float64VarP(&opts.Threshold, "threshold", "", maintain.DefaultThreshold, "Ratio of disk size to active size at which to compact")
+	cmd.Flags().Int64VarP(&opts.MinDiskSize, "min-size", "", 0, "Disk size, in bytes, below which databases are not compacted")
+	var windows []string
+	cmd.Flags().StringSliceVarP(&windows, "window", "", nil, "Maintenance window, as HH:MM-HH:MM local time, outside of which nothing is done")
+	cmd.Flags().BoolVarP(&opts.DryRun, "dry-run", "", false, "Report the databases which need compaction, without compacting them")
+	var watch bool
+	cmd.Flags().BoolVarP(&watch, "watch", "", false, "Keep running, checking the databases every interval")
+	cmd.Flags().DurationVarP(&opts.Interval, "interval", "", maintain.DefaultInterval, "Interval at which to check the databases, with --watch")
+	cmd.Run = run(0, -1, func(ctx context.Context, args []string) error {
+		for _, w := range windows {
+			window, err := maintain.ParseWindow(w)
+			if err != nil {
+				return err
+			}
+			opts.Windows = append(opts.Windows, window)
+		}
+		opts.DBs = args
+		client, err := s.client(ctx)
+		if err != nil {
+			return err
+		}
+		if watch {
+			opts.OnError = func(err error) {
+				fmt.Fprintf(os.Stderr, "Error: %s\n", err)
+			}
+			opts.OnCompact = func(action maintain.Action) {
+				_ = s.print(action)
+			}
+			return maintain.New(client, opts).Run(ctx)
+		}
+		m := maintain.New(client, opts)
+		if !m.InWindow(time.Now()) {
+			return nil
+		}
+		actions, err := m.Maintain(ctx)
+		for _, action := range actions {
+			if err := s.print(action); err != nil {
+				return err
+			}
+		}
+		return err
+	})
+	return cmd
+}
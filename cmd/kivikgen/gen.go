@@ -0,0 +1,205 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"go/format"
+	"sort"
+	"strings"
+	"text/template"
+	"unicode"
+)
+
+// ddoc is the part of a design document read by the generator.
+type ddoc struct {
+	ID    string                     `json:"_id"`
+	Views map[string]json.RawMessage `json:"views"`
+	// Gen holds optional annotations, which are ignored by the server.
+	Gen struct {
+		Views map[string]viewTypes `json:"views"`
+	} `json:"kivikgen"`
+}
+
+// viewTypes are the Go types of the keys and values of a view, as annotated
+// in the kivikgen field of the design document:
+//
+//	"kivikgen": {"views": {"by_email": {"key": "string", "value": "int"}}}
+type viewTypes struct {
+	Key   string `json:"key"`
+	Value string `json:"value"`
+}
+
+// Default Go types of view keys and values.
+const (
+	defaultKeyType   = "interface{}"
+	defaultValueType = "json.RawMessage"
+)
+
+type view struct {
+	// Name is the Go name of the query function.
+	Name      string
+	DDoc      string
+	View      string
+	KeyType   string
+	ValueType string
+}
+
+// goName converts a design document or view name, such as "by_email", to an
+// exported Go identifier, such as "ByEmail".
+func goName(name string) string {
+	var buf bytes.Buffer
+	upper := true
+	for _, r := range name {
+		if !unicode.IsLetter(r) && !unicode.IsDigit(r) {
+			upper = true
+			continue
+		}
+		if upper {
+			r = unicode.ToUpper(r)
+			upper = false
+		}
+		buf.WriteRune(r)
+	}
+	result := buf.String()
+	if result == "" || unicode.IsDigit(rune(result[0])) {
+		result = "V" + result
+	}
+	return result
+}
+
+// views returns the views of the design documents, sorted by name. Functions
+// are named after the view, or prefixed with the design document name, if
+// more than one design document has a view of that name.
+func views(docs []*ddoc) ([]view, error) {
+	counts := map[string]int{}
+	for _, doc := range docs {
+		for name := range doc.Views {
+			counts[goName(name)]++
+		}
+	}
+	var result []view
+	seen := map[string]string{}
+	for _, doc := range docs {
+		ddocName := strings.TrimPrefix(doc.ID, "_design/")
+		if ddocName == doc.ID || ddocName == "" {
+			return nil, fmt.Errorf("%q is not a design document ID", doc.ID)
+		}
+		for name := range doc.Views {
+			v := view{
+				Name:      goName(name),
+				DDoc:      ddocName,
+				View:      name,
+				KeyType:   defaultKeyType,
+				ValueType: defaultValueType,
+			}
+			if counts[v.Name] > 1 {
+				v.Name = goName(ddocName) + v.Name
+			}
+			if other, ok := seen[v.Name]; ok {
+				return nil, fmt.Errorf("views %s and %s/%s both map to %s", other, ddocName, name, v.Name)
+			}
+			seen[v.Name] = ddocName + "/" + name
+			if types, ok := doc.Gen.Views[name]; ok {
+				if types.Key != "" {
+					v.KeyType = types.Key
+				}
+				if types.Value != "" {
+					v.ValueType = types.Value
+				}
+			}
+			result = append(result, v)
+		}
+	}
+	sort.Sort(viewsByName(result))
+	return result, nil
+}
+
+type viewsByName []view
+
+func (v viewsByName) Len() int           { return len(v) }
+func (v viewsByName) Less(i, j int) bool { return v[i].Name < v[j].Name }
+func (v viewsByName) Swap(i, j int)      { v[i], v[j] = v[j], v[i] }
+
+var codeTemplate = template.Must(template.New("").Parse(`// Code generated by kivikgen. DO NOT EDIT.
+
+package {{ .Package }}
+
+import (
+	"context"
+	"encoding/json"
+
+	"github.com/flimzy/kivik"
+)
+
+var _ json.RawMessage
+{{ range .Views }}
+// {{ .Name }}Row is a row of the {{ .View }} view of _design/{{ .DDoc }}.
+type {{ .Name }}Row struct {
+	ID    string
+	Key   {{ .KeyType }}
+	Value {{ .ValueType }}
+}
+
+// {{ .Name }} queries the {{ .View }} view of _design/{{ .DDoc }} for the rows
+// with key.
+func {{ .Name }}(ctx context.Context, db *kivik.DB, key {{ .KeyType }}, options ...kivik.Options) ([]{{ .Name }}Row, error) {
+	opts, err := kivik.ViewOptions{Key: key}.Options()
+	if err != nil {
+		return nil, err
+	}
+	return query{{ .Name }}(ctx, db, append(options, opts))
+}
+
+// {{ .Name }}Range queries the {{ .View }} view of _design/{{ .DDoc }} for the
+// rows with keys from startKey to endKey, inclusive.
+func {{ .Name }}Range(ctx context.Context, db *kivik.DB, startKey, endKey {{ .KeyType }}, options ...kivik.Options) ([]{{ .Name }}Row, error) {
+	opts, err := kivik.ViewOptions{StartKey: startKey, EndKey: endKey}.Options()
+	if err != nil {
+		return nil, err
+	}
+	return query{{ .Name }}(ctx, db, append(options, opts))
+}
+
+func query{{ .Name }}(ctx context.Context, db *kivik.DB, options []kivik.Options) ([]{{ .Name }}Row, error) {
+	rows, err := db.Query(ctx, {{ printf "%q" .DDoc }}, {{ printf "%q" .View }}, options...)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = rows.Close() }()
+	var result []{{ .Name }}Row
+	for rows.Next() {
+		row := {{ .Name }}Row{ID: rows.ID()}
+		if err := rows.ScanKey(&row.Key); err != nil {
+			return nil, err
+		}
+		if err := rows.ScanValue(&row.Value); err != nil {
+			return nil, err
+		}
+		result = append(result, row)
+	}
+	return result, rows.Err()
+}
+{{ end }}`))
+
+// generate returns the formatted Go source of the typed query functions for
+// the views of docs.
+func generate(pkg string, docs []*ddoc) ([]byte, error) {
+	vs, err := views(docs)
+	if err != nil {
+		return nil, err
+	}
+	var buf bytes.Buffer
+	err = codeTemplate.Execute(&buf, map[string]interface{}{
+		"Package": pkg,
+		"Views":   vs,
+	})
+	if err != nil {
+		return nil, err
+	}
+	src, err := format.Source(buf.Bytes())
+	if err != nil {
+		return nil, fmt.Errorf("invalid generated code, check the kivikgen type annotations: %s", err)
+	}
+	return src, nil
+}
@@ -0,0 +1,88 @@
+package main
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/flimzy/diff"
+)
+
+func TestGoName(t *testing.T) {
+	tests := map[string]string{
+		"by_email":  "ByEmail",
+		"byEmail":   "ByEmail",
+		"by-age.v2": "ByAgeV2",
+		"2fa":       "V2fa",
+	}
+	for name, expected := range tests {
+		if result := goName(name); result != expected {
+			t.Errorf("%s: expected %s, got %s", name, expected, result)
+		}
+	}
+}
+
+func parseDDocs(t *testing.T, docs ...string) []*ddoc {
+	result := make([]*ddoc, len(docs))
+	for i, doc := range docs {
+		result[i] = &ddoc{}
+		if err := json.Unmarshal([]byte(doc), result[i]); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return result
+}
+
+func TestViews(t *testing.T) {
+	docs := parseDDocs(t,
+		`{"_id":"_design/users","views":{"by_email":{"map":"..."},"all":{"map":"..."}},
+			"kivikgen":{"views":{"by_email":{"key":"string","value":"int"}}}}`,
+		`{"_id":"_design/orders","views":{"all":{"map":"..."}}}`,
+	)
+	vs, err := views(docs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []view{
+		{Name: "ByEmail", DDoc: "users", View: "by_email", KeyType: "string", ValueType: "int"},
+		{Name: "OrdersAll", DDoc: "orders", View: "all", KeyType: defaultKeyType, ValueType: defaultValueType},
+		{Name: "UsersAll", DDoc: "users", View: "all", KeyType: defaultKeyType, ValueType: defaultValueType},
+	}
+	if d := diff.Interface(expected, vs); d != "" {
+		t.Error(d)
+	}
+}
+
+func TestViewsNotDesign(t *testing.T) {
+	if _, err := views(parseDDocs(t, `{"_id":"foo","views":{"a":{}}}`)); err == nil {
+		t.Error("Expected an error for a non-design document")
+	}
+}
+
+func TestGenerate(t *testing.T) {
+	docs := parseDDocs(t, `{"_id":"_design/users","views":{"by_email":{"map":"..."}},
+		"kivikgen":{"views":{"by_email":{"key":"string"}}}}`)
+	src, err := generate("queries", docs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, expected := range []string{
+		"package queries\n",
+		"type ByEmailRow struct {",
+		"func ByEmail(ctx context.Context, db *kivik.DB, key string, options ...kivik.Options) ([]ByEmailRow, error) {",
+		"func ByEmailRange(ctx context.Context, db *kivik.DB, startKey, endKey string, options ...kivik.Options) ([]ByEmailRow, error) {",
+		`db.Query(ctx, "users", "by_email", options...)`,
+	} {
+		if !strings.Contains(string(src), expected) {
+			t.Errorf("Generated code does not contain %q:\n%s", expected, src)
+		}
+	}
+}
+
+func TestGenerateInvalidType(t *testing.T) {
+	docs := parseDDocs(t, `{"_id":"_design/users","views":{"by_email":{"map":"..."}},
+		"kivikgen":{"views":{"by_email":{"key":"not a type"}}}}`)
+	if _, err := generate("queries", docs); err == nil {
+		t.Error("Expected an error for an invalid type")
+	}
+}
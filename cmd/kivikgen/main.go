@@ -0,0 +1,113 @@
+// Command kivikgen generates typed Go query functions and row structs for the
+// views of CouchDB design documents, so that applications need not refer to
+// design documents and views by name.
+//
+// Design documents are read from JSON files, or from a database:
+//
+//	kivikgen -p queries -o queries/views.go ddocs/users.json
+//	kivikgen -p queries -o queries/views.go --dsn http://localhost:5984/ --db users
+//
+// For a view by_email, the generated code includes a ByEmailRow struct, and
+// the functions ByEmail(ctx, db, key) and ByEmailRange(ctx, db, startKey,
+// endKey). The Go types of a view's keys and values default to interface{}
+// and json.RawMessage, and may be set by an annotation in the design
+// document, which the server ignores:
+//
+//	"kivikgen": {"views": {"by_email": {"key": "string", "value": "int"}}}
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+
+	"github.com/spf13/pflag"
+
+	"github.com/flimzy/kivik"
+	_ "github.com/flimzy/kivik/driver/couchdb"
+)
+
+func main() {
+	pkg := pflag.StringP("package", "p", "queries", "Package name of the generated code")
+	output := pflag.StringP("output", "o", "", "Output file (default stdout)")
+	driver := pflag.String("driver", "couch", "Driver used to read design documents from --db")
+	dsn := pflag.String("dsn", "", "Data source name used to read design documents from --db")
+	dbName := pflag.String("db", "", "Database from which to read design documents")
+	pflag.Parse()
+
+	docs, err := readFiles(pflag.Args())
+	if err == nil && *dbName != "" {
+		var dbDocs []*ddoc
+		dbDocs, err = readDB(context.Background(), *driver, *dsn, *dbName)
+		docs = append(docs, dbDocs...)
+	}
+	if err == nil && len(docs) == 0 {
+		err = fmt.Errorf("no design documents; give JSON files, or --db")
+	}
+	var src []byte
+	if err == nil {
+		src, err = generate(*pkg, docs)
+	}
+	if err == nil {
+		if *output == "" {
+			_, err = os.Stdout.Write(src)
+		} else {
+			err = ioutil.WriteFile(*output, src, 0644)
+		}
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "kivikgen: %s\n", err)
+		os.Exit(1)
+	}
+}
+
+func readFiles(files []string) ([]*ddoc, error) {
+	docs := make([]*ddoc, 0, len(files))
+	for _, file := range files {
+		body, err := ioutil.ReadFile(file)
+		if err != nil {
+			return nil, err
+		}
+		doc := &ddoc{}
+		if err := json.Unmarshal(body, doc); err != nil {
+			return nil, fmt.Errorf("%s: %s", file, err)
+		}
+		docs = append(docs, doc)
+	}
+	return docs, nil
+}
+
+func readDB(ctx context.Context, driver, dsn, dbName string) ([]*ddoc, error) {
+	client, err := kivik.New(ctx, driver, dsn)
+	if err != nil {
+		return nil, err
+	}
+	db, err := client.DB(ctx, dbName)
+	if err != nil {
+		return nil, err
+	}
+	opts, err := kivik.ViewOptions{
+		StartKey:    "_design/",
+		EndKey:      "_design0",
+		IncludeDocs: true,
+	}.Options()
+	if err != nil {
+		return nil, err
+	}
+	rows, err := db.AllDocs(ctx, opts)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = rows.Close() }()
+	var docs []*ddoc
+	for rows.Next() {
+		doc := &ddoc{}
+		if err := rows.ScanDoc(doc); err != nil {
+			return nil, err
+		}
+		docs = append(docs, doc)
+	}
+	return docs, rows.Err()
+}
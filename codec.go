@@ -0,0 +1,168 @@
+package kivik
+
+import (
+	"reflect"
+	"sync"
+	"time"
+)
+
+// KeyEncoder converts a value of a custom Go type to the value which
+// represents it in views and Mango queries, such as a string or an array,
+// which must be JSON-marshalable.
+type KeyEncoder func(v interface{}) (interface{}, error)
+
+var (
+	keyEncodersMu sync.RWMutex
+	keyEncoders   = make(map[reflect.Type]KeyEncoder)
+)
+
+// RegisterKeyEncoder registers enc to encode values of the same type as
+// example, whenever they are used as view keys, in the key, keys, startkey
+// and endkey options of Query and AllDocs, in ViewOptions and EncodeKey, or
+// as values in Find queries. This ensures a type is encoded the same way for
+// all drivers, and consistently with the way the type is emitted by views.
+// Registered types are found within maps, slices, arrays and pointers, but
+// not within struct fields, which are encoded only by encoding/json.
+//
+// To encode time.Time values as arrays:
+//
+//	kivik.RegisterKeyEncoder(time.Time{}, kivik.TimeArrayKey)
+//
+// If enc is nil, any encoder registered for the type is removed.
+func RegisterKeyEncoder(example interface{}, enc KeyEncoder) {
+	t := reflect.TypeOf(example)
+	keyEncodersMu.Lock()
+	defer keyEncodersMu.Unlock()
+	if enc == nil {
+		delete(keyEncoders, t)
+		return
+	}
+	keyEncoders[t] = enc
+}
+
+// TimeArrayKey is a KeyEncoder which encodes a time.Time or *time.Time as an
+// array of its UTC components, [year, month, day, hour, minute, second,
+// nanosecond], which collates in chronological order, and allows ranges of
+// keys to be selected by date, as with a view emitting
+// [d.getUTCFullYear(), d.getUTCMonth()+1, ...].
+func TimeArrayKey(v interface{}) (interface{}, error) {
+	var t time.Time
+	switch tv := v.(type) {
+	case time.Time:
+		t = tv
+	case *time.Time:
+		t = *tv
+	default:
+		return v, nil
+	}
+	t = t.UTC()
+	return []interface{}{t.Year(), int(t.Month()), t.Day(), t.Hour(), t.Minute(), t.Second(), t.Nanosecond()}, nil
+}
+
+// EncodeValue returns v, with the values of types registered with
+// RegisterKeyEncoder, within v, replaced by their encoded values. It is
+// intended for packages which build queries, and v is returned unaltered if
+// no encoders are registered.
+func EncodeValue(v interface{}) (interface{}, error) {
+	keyEncodersMu.RLock()
+	defer keyEncodersMu.RUnlock()
+	if len(keyEncoders) == 0 || v == nil {
+		return v, nil
+	}
+	return encodeValue(reflect.ValueOf(v))
+}
+
+func encodeValue(v reflect.Value) (interface{}, error) {
+	if enc, ok := keyEncoders[v.Type()]; ok {
+		return enc(v.Interface())
+	}
+	switch v.Kind() {
+	case reflect.Interface, reflect.Ptr:
+		if v.IsNil() {
+			return v.Interface(), nil
+		}
+		if v.Kind() == reflect.Ptr && !containsEncoded(v.Elem().Type()) {
+			return v.Interface(), nil
+		}
+		return encodeValue(v.Elem())
+	case reflect.Map:
+		if v.Type().Key().Kind() != reflect.String || v.IsNil() || !containsEncoded(v.Type().Elem()) {
+			return v.Interface(), nil
+		}
+		result := make(map[string]interface{}, v.Len())
+		for _, key := range v.MapKeys() {
+			value, err := encodeValue(v.MapIndex(key))
+			if err != nil {
+				return nil, err
+			}
+			result[key.String()] = value
+		}
+		return result, nil
+	case reflect.Slice, reflect.Array:
+		if (v.Kind() == reflect.Slice && v.IsNil()) || !containsEncoded(v.Type().Elem()) {
+			return v.Interface(), nil
+		}
+		result := make([]interface{}, v.Len())
+		for i := range result {
+			value, err := encodeValue(v.Index(i))
+			if err != nil {
+				return nil, err
+			}
+			result[i] = value
+		}
+		return result, nil
+	}
+	return v.Interface(), nil
+}
+
+// containsEncoded returns true if values of type t may hold a value of a
+// registered type, so must be walked.
+func containsEncoded(t reflect.Type) bool {
+	if _, ok := keyEncoders[t]; ok {
+		return true
+	}
+	switch t.Kind() {
+	case reflect.Interface:
+		return true
+	case reflect.Ptr, reflect.Slice, reflect.Array:
+		return containsEncoded(t.Elem())
+	case reflect.Map:
+		return t.Key().Kind() == reflect.String && containsEncoded(t.Elem())
+	}
+	return false
+}
+
+// keyOptions are the options which hold view keys.
+var keyOptions = []string{"key", "keys", "startkey", "endkey", "start_key", "end_key"}
+
+// encodeKeyOptions encodes values of registered types held by the key options
+// of opts. opts is not modified; a copy is returned if any key option is
+// encoded.
+func encodeKeyOptions(opts Options) (Options, error) {
+	var result Options
+	for _, name := range keyOptions {
+		value, ok := opts[name]
+		if !ok {
+			continue
+		}
+		if _, isString := value.(string); isString {
+			// Already JSON encoded, as by EncodeKey.
+			continue
+		}
+		encoded, err := EncodeValue(value)
+		if err != nil {
+			return nil, err
+		}
+		if result == nil {
+			result = make(Options, len(opts))
+			for k, v := range opts {
+				result[k] = v
+			}
+		}
+		result[name] = encoded
+	}
+	if result == nil {
+		return opts, nil
+	}
+	return result, nil
+}
@@ -0,0 +1,86 @@
+package kivik
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/flimzy/diff"
+	"github.com/flimzy/kivik/driver"
+)
+
+type keyQueryDB struct {
+	dummyDB
+	opts map[string]interface{}
+}
+
+func (db *keyQueryDB) Query(_ context.Context, _, _ string, opts map[string]interface{}) (driver.Rows, error) {
+	db.opts = opts
+	return &rows{}, nil
+}
+
+func TestKeyEncoder(t *testing.T) {
+	ts := time.Date(2017, 11, 5, 13, 4, 5, 0, time.FixedZone("EST", -5*3600))
+	encoded := []interface{}{2017, 11, 5, 18, 4, 5, 0}
+
+	key, err := EncodeKey([]interface{}{"foo", ts})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if key != `["foo","2017-11-05T13:04:05-05:00"]` {
+		t.Errorf("Expected the default encoding with no encoder registered, got %s", key)
+	}
+
+	RegisterKeyEncoder(time.Time{}, TimeArrayKey)
+	defer RegisterKeyEncoder(time.Time{}, nil)
+
+	t.Run("EncodeKey", func(t *testing.T) {
+		key, err := EncodeKey([]interface{}{"foo", ts, &ts})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if key != `["foo",[2017,11,5,18,4,5,0],[2017,11,5,18,4,5,0]]` {
+			t.Errorf("Unexpected key: %s", key)
+		}
+	})
+	t.Run("Query", func(t *testing.T) {
+		driverDB := &keyQueryDB{}
+		db := &DB{driverDB: driverDB}
+		opts := Options{"startkey": ts, "endkey": `"z"`, "limit": 3}
+		if _, err := db.Query(context.Background(), "foo", "bar", opts); err != nil {
+			t.Fatal(err)
+		}
+		expected := map[string]interface{}{
+			"startkey": encoded,
+			"endkey":   `"z"`,
+			"limit":    3,
+		}
+		if d := diff.Interface(expected, driverDB.opts); d != "" {
+			t.Error(d)
+		}
+		if _, ok := opts["startkey"].(time.Time); !ok {
+			t.Errorf("Caller's options were modified: %v", opts)
+		}
+	})
+	t.Run("Selector", func(t *testing.T) {
+		query := map[string]interface{}{
+			"selector": map[string]interface{}{
+				"created": map[string]time.Time{"$gt": ts},
+				"tags":    []string{"a"},
+			},
+		}
+		result, err := EncodeValue(query)
+		if err != nil {
+			t.Fatal(err)
+		}
+		expected := map[string]interface{}{
+			"selector": map[string]interface{}{
+				"created": map[string]interface{}{"$gt": encoded},
+				"tags":    []string{"a"},
+			},
+		}
+		if d := diff.Interface(expected, result); d != "" {
+			t.Error(d)
+		}
+	})
+}
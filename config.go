@@ -0,0 +1,87 @@
+package kivik
+
+import (
+	"context"
+
+	"github.com/flimzy/kivik/driver"
+	"github.com/flimzy/kivik/errors"
+)
+
+// Config represents all the config sections of a server, by section name.
+type Config map[string]ConfigSection
+
+// ConfigSection represents all key/value pairs of a config section.
+type ConfigSection map[string]string
+
+// LocalNode is the node name which refers to the node the client is connected
+// to. It is equivalent to an empty node name.
+const LocalNode = "_local"
+
+func (c *Client) configer() (driver.Configer, error) {
+	configer, ok := c.driverClient.(driver.Configer)
+	if !ok {
+		return nil, errors.Status(StatusNotImplemented, "kivik: driver does not support Config interface")
+	}
+	return configer, nil
+}
+
+// Config returns the entire server configuration of the named node. For
+// CouchDB 2.x clusters, node is the name of a cluster node, as listed by
+// /_membership. An empty node, or LocalNode, means the node the client is
+// connected to, and is required for CouchDB 1.x, which has no nodes.
+func (c *Client) Config(ctx context.Context, node string) (Config, error) {
+	configer, err := c.configer()
+	if err != nil {
+		return nil, err
+	}
+	config, err := configer.Config(ctx, node)
+	if err != nil {
+		return nil, err
+	}
+	result := make(Config, len(config))
+	for name, section := range config {
+		result[name] = ConfigSection(section)
+	}
+	return result, nil
+}
+
+// ConfigSection returns the named section of the server configuration of the
+// node. See Config for the meaning of node.
+func (c *Client) ConfigSection(ctx context.Context, node, section string) (ConfigSection, error) {
+	configer, err := c.configer()
+	if err != nil {
+		return nil, err
+	}
+	sec, err := configer.ConfigSection(ctx, node, section)
+	return ConfigSection(sec), err
+}
+
+// ConfigValue returns a single config value of the node. See Config for the
+// meaning of node.
+func (c *Client) ConfigValue(ctx context.Context, node, section, key string) (string, error) {
+	configer, err := c.configer()
+	if err != nil {
+		return "", err
+	}
+	return configer.ConfigValue(ctx, node, section, key)
+}
+
+// SetConfigValue sets a single config value of the node, and returns the old
+// value. See Config for the meaning of node.
+func (c *Client) SetConfigValue(ctx context.Context, node, section, key, value string) (string, error) {
+	configer, err := c.configer()
+	if err != nil {
+		return "", err
+	}
+	return configer.SetConfigValue(ctx, node, section, key, value)
+}
+
+// DeleteConfigKey deletes a config key of the node, and returns the old value.
+// See Config for the meaning of node.
+func (c *Client) DeleteConfigKey(ctx context.Context, node, section, key string) (string, error) {
+	configer, err := c.configer()
+	if err != nil {
+		return "", err
+	}
+	return configer.DeleteConfigKey(ctx, node, section, key)
+}
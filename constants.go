@@ -38,6 +38,7 @@ const (
 	StatusRequestTimeout               = 408
 	StatusConflict                     = 409
 	StatusPreconditionFailed           = 412
+	StatusRequestEntityTooLarge        = 413
 	StatusBadContentType               = 415
 	StatusRequestedRangeNotSatisfiable = 416
 	StatusExpectationFailed            = 417
@@ -45,4 +46,11 @@ const (
 	// StatusNotImplemented is not returned by CouchDB proper. It is used by
 	// Kivik for optional features which are not implemented by some drivers.
 	StatusNotImplemented = 501
+	// StatusBadResponse is not returned by CouchDB proper. It is used by Kivik
+	// when a response from the server is invalid, such as attachment content
+	// which does not match its digest.
+	StatusBadResponse = 502
+	// StatusServiceUnavailable is returned by CouchDB 2.x nodes in maintenance
+	// mode, and by Kivik when a circuit breaker fails an operation fast.
+	StatusServiceUnavailable = 503
 )
@@ -0,0 +1,214 @@
+// Package consumer processes a database's changes feed, with a durable
+// checkpoint of the last change processed, so that processing resumes where
+// it left off after a restart or crash.
+//
+//	c, err := consumer.New(db, consumer.Options{Name: "indexer", Continuous: true})
+//	err = c.Run(ctx, func(ctx context.Context, change *consumer.Change) error {
+//	    return index(change.ID, change.Doc)
+//	})
+//
+// Delivery is at-least-once: the checkpoint is written only after the handler
+// has returned successfully, so a change may be delivered again if the
+// process stops between the two, and handlers should be idempotent.
+//
+// By default, the checkpoint is stored as a _local document in the database
+// being consumed, which is neither replicated nor included in the changes
+// feed. It may instead be stored in another database, by setting
+// Options.CheckpointDB.
+package consumer
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+
+	"github.com/flimzy/kivik"
+	"github.com/flimzy/kivik/errors"
+)
+
+// Change is a single change to a document, as delivered to a Handler.
+type Change struct {
+	ID      string
+	Seq     string
+	Deleted bool
+	// Revs lists the leaf revisions of the document.
+	Revs []string
+	// Doc is the document, if Options.IncludeDocs is set.
+	Doc json.RawMessage
+}
+
+// Handler processes a change. If it returns an error, Run returns the error,
+// without checkpointing the change, so that it is delivered again when Run is
+// next called.
+type Handler func(ctx context.Context, change *Change) error
+
+// Options configures a Consumer.
+type Options struct {
+	// Name identifies the consumer, and so its checkpoint. It is required.
+	Name string
+	// CheckpointDB is the database in which the checkpoint is stored.
+	// Defaults to the database being consumed.
+	CheckpointDB *kivik.DB
+	// CheckpointID is the ID of the checkpoint document. Defaults to
+	// "_local/consumer-" followed by Name.
+	CheckpointID string
+	// CheckpointEvery is the number of changes processed between checkpoints.
+	// A checkpoint is also written when the feed ends. Defaults to 1, which
+	// checkpoints after every change.
+	CheckpointEvery int
+	// Since is the sequence from which to begin, if there is no checkpoint.
+	// Defaults to the start of the feed.
+	Since string
+	// Continuous follows a continuous feed, until the context passed to Run
+	// is canceled. Otherwise, Run returns once the current changes have been
+	// processed.
+	Continuous bool
+	// IncludeDocs includes the document with each change.
+	IncludeDocs bool
+	// ChangesOptions are any other options passed to Changes, such as a
+	// filter.
+	ChangesOptions kivik.Options
+}
+
+// Consumer delivers the changes of a database to a Handler, with
+// checkpointing.
+type Consumer struct {
+	db   *kivik.DB
+	opts Options
+	// rev is the revision of the checkpoint document, if it exists.
+	rev string
+}
+
+// checkpoint is the stored checkpoint document.
+type checkpoint struct {
+	Rev     string    `json:"_rev,omitempty"`
+	Seq     string    `json:"seq"`
+	Updated time.Time `json:"updated"`
+}
+
+// New returns a consumer of the changes of db.
+func New(db *kivik.DB, opts Options) (*Consumer, error) {
+	if opts.Name == "" {
+		return nil, errors.Status(kivik.StatusBadRequest, "consumer: Name is required")
+	}
+	if opts.CheckpointDB == nil {
+		opts.CheckpointDB = db
+	}
+	if opts.CheckpointID == "" {
+		opts.CheckpointID = "_local/consumer-" + opts.Name
+	}
+	if opts.CheckpointEvery <= 0 {
+		opts.CheckpointEvery = 1
+	}
+	return &Consumer{db: db, opts: opts}, nil
+}
+
+// Checkpoint returns the sequence of the last checkpointed change, or an
+// empty string if there is no checkpoint.
+func (c *Consumer) Checkpoint(ctx context.Context) (string, error) {
+	row, err := c.opts.CheckpointDB.Get(ctx, c.opts.CheckpointID)
+	if kivik.StatusCode(err) == kivik.StatusNotFound {
+		c.rev = ""
+		return "", nil
+	}
+	if err != nil {
+		return "", err
+	}
+	var cp checkpoint
+	if err := row.ScanDoc(&cp); err != nil {
+		return "", err
+	}
+	c.rev = cp.Rev
+	return cp.Seq, nil
+}
+
+// save writes seq as the checkpoint.
+func (c *Consumer) save(ctx context.Context, seq string) error {
+	rev, err := c.opts.CheckpointDB.Put(ctx, c.opts.CheckpointID, checkpoint{
+		Rev:     c.rev,
+		Seq:     seq,
+		Updated: time.Now().UTC(),
+	})
+	if err != nil {
+		return err
+	}
+	c.rev = rev
+	return nil
+}
+
+// Run delivers the changes since the last checkpoint to handler, in order,
+// checkpointing as it goes. It returns the first error returned by handler,
+// or encountered reading the feed or writing the checkpoint. Run must not be
+// called concurrently for the same checkpoint.
+func (c *Consumer) Run(ctx context.Context, handler Handler) error {
+	since, err := c.Checkpoint(ctx)
+	if err != nil {
+		return err
+	}
+	if since == "" {
+		since = c.opts.Since
+	}
+	opts := kivik.Options{}
+	for k, v := range c.opts.ChangesOptions {
+		opts[k] = v
+	}
+	if since != "" {
+		opts["since"] = since
+	}
+	if c.opts.Continuous {
+		opts["feed"] = "continuous"
+	}
+	if c.opts.IncludeDocs {
+		opts["include_docs"] = true
+	}
+	changes, err := c.db.Changes(ctx, opts)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = changes.Close() }()
+
+	var last string
+	var pending int
+	// flush saves the last processed change, if not yet checkpointed. The
+	// checkpoint is written with a fresh context, so that the progress made
+	// is not lost when ctx is canceled.
+	flush := func() error {
+		if pending == 0 {
+			return nil
+		}
+		pending = 0
+		return c.save(context.Background(), last)
+	}
+	for changes.Next() {
+		change := &Change{
+			ID:      changes.ID(),
+			Seq:     string(changes.Seq()),
+			Deleted: changes.Deleted(),
+			Revs:    changes.Changes(),
+		}
+		if c.opts.IncludeDocs {
+			if err := changes.ScanDoc(&change.Doc); err != nil {
+				_ = flush()
+				return err
+			}
+		}
+		if err := handler(ctx, change); err != nil {
+			_ = flush()
+			return err
+		}
+		last = change.Seq
+		pending++
+		if pending >= c.opts.CheckpointEvery {
+			if err := flush(); err != nil {
+				return err
+			}
+		}
+	}
+	if err := flush(); err != nil {
+		return err
+	}
+	if ctx.Err() != nil {
+		return ctx.Err()
+	}
+	return changes.Err()
+}
@@ -0,0 +1,133 @@
+package consumer
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/flimzy/diff"
+	"github.com/flimzy/kivik"
+	_ "github.com/flimzy/kivik/driver/memory"
+)
+
+func newTestDB(t *testing.T, name string) *kivik.DB {
+	client, err := kivik.New(context.Background(), "memory", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := client.CreateDB(context.Background(), name); err != nil {
+		t.Fatal(err)
+	}
+	db, err := client.DB(context.Background(), name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return db
+}
+
+func put(t *testing.T, db *kivik.DB, ids ...string) {
+	for _, id := range ids {
+		if _, err := db.Put(context.Background(), id, map[string]string{"name": id}); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+// collect returns a handler which records the IDs of the changes, and fails
+// on the change to failOn.
+func collect(ids *[]string, failOn string) Handler {
+	return func(_ context.Context, change *Change) error {
+		if change.ID == failOn {
+			return errors.New("failed")
+		}
+		*ids = append(*ids, change.ID)
+		return nil
+	}
+}
+
+func TestRun(t *testing.T) {
+	db := newTestDB(t, "foo")
+	put(t, db, "a", "b", "c")
+	c, err := New(db, Options{Name: "test"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var ids []string
+	if err := c.Run(context.Background(), collect(&ids, "c")); err == nil || err.Error() != "failed" {
+		t.Errorf("Expected the handler error, got %v", err)
+	}
+	if d := diff.Interface([]string{"a", "b"}, ids); d != "" {
+		t.Error(d)
+	}
+
+	// A new consumer resumes from the checkpoint, and redelivers the failed
+	// change.
+	put(t, db, "d")
+	c, err = New(db, Options{Name: "test"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	ids = nil
+	if err := c.Run(context.Background(), collect(&ids, "")); err != nil {
+		t.Fatal(err)
+	}
+	if d := diff.Interface([]string{"c", "d"}, ids); d != "" {
+		t.Error(d)
+	}
+
+	ids = nil
+	if err := c.Run(context.Background(), collect(&ids, "")); err != nil {
+		t.Fatal(err)
+	}
+	if len(ids) != 0 {
+		t.Errorf("Expected no changes after the checkpoint, got %v", ids)
+	}
+
+	// Another consumer has its own checkpoint.
+	other, err := New(db, Options{Name: "other", IncludeDocs: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var docs []string
+	err = other.Run(context.Background(), func(_ context.Context, change *Change) error {
+		docs = append(docs, string(change.Doc))
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(docs) != 4 {
+		t.Errorf("Expected 4 documents, got %v", docs)
+	}
+}
+
+func TestCheckpointDB(t *testing.T) {
+	db := newTestDB(t, "foo")
+	checkpoints := newTestDB(t, "checkpoints")
+	put(t, db, "a", "b", "c")
+	c, err := New(db, Options{Name: "test", CheckpointDB: checkpoints, CheckpointID: "test", CheckpointEvery: 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var ids []string
+	if err := c.Run(context.Background(), collect(&ids, "")); err != nil {
+		t.Fatal(err)
+	}
+	seq, err := c.Checkpoint(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if seq != "3" {
+		t.Errorf("Expected checkpoint 3, got %q", seq)
+	}
+	if _, err := checkpoints.Get(context.Background(), "test"); err != nil {
+		t.Errorf("Expected the checkpoint in the checkpoint database, got %s", err)
+	}
+}
+
+func TestNew(t *testing.T) {
+	if _, err := New(nil, Options{}); kivik.StatusCode(err) != kivik.StatusBadRequest {
+		t.Errorf("Expected a bad request error for a missing name, got %v", err)
+	}
+}
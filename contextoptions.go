@@ -0,0 +1,38 @@
+package kivik
+
+import "context"
+
+type optionsContextKey struct{}
+
+// WithOptions returns a copy of ctx carrying opts, which are merged into the
+// options of every method called with the returned context, or one derived
+// from it. This allows middleware to influence calls without changing each
+// call site, for example to pass stale=ok to every read made while serving a
+// request. Options passed to a method take precedence over those of the
+// context, which in turn take precedence over those set with DefaultOptions.
+// Options of nested calls to WithOptions are merged, with those of the
+// innermost call taking precedence. As with DefaultOptions, for drivers which
+// declare the options supported by a method, options which the method does
+// not support are not passed to it, and options are only passed to Put,
+// CreateDoc, Delete and BulkDocs if the driver declares or accepts options
+// for them.
+//
+//	ctx = kivik.WithOptions(ctx, kivik.Options{"stale": "ok"})
+func WithOptions(ctx context.Context, opts Options) context.Context {
+	merged, _ := mergeOptions(contextOptions(ctx), opts)
+	return context.WithValue(ctx, optionsContextKey{}, merged)
+}
+
+// ContextOptions returns the options attached to ctx with WithOptions, or nil
+// if there are none. The result must not be modified.
+func ContextOptions(ctx context.Context) Options {
+	return contextOptions(ctx)
+}
+
+func contextOptions(ctx context.Context) Options {
+	if ctx == nil {
+		return nil
+	}
+	opts, _ := ctx.Value(optionsContextKey{}).(Options)
+	return opts
+}
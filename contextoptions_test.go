@@ -0,0 +1,57 @@
+package kivik
+
+import (
+	"context"
+	"testing"
+
+	"github.com/flimzy/diff"
+)
+
+func TestWithOptions(t *testing.T) {
+	ctx := WithOptions(context.Background(), Options{"stale": "ok", "stable": true})
+	ctx = WithOptions(ctx, Options{"stable": false, "partition": "p1"})
+	expected := Options{"stale": "ok", "stable": false, "partition": "p1"}
+	if d := diff.Interface(expected, ContextOptions(ctx)); d != "" {
+		t.Error(d)
+	}
+	if opts := ContextOptions(context.Background()); opts != nil {
+		t.Errorf("Unexpected options for bare context: %v", opts)
+	}
+}
+
+func TestContextOptions(t *testing.T) {
+	driverDB := &defaultsDB{opts: make(map[string]map[string]interface{})}
+	driverClient := &defaultsClient{db: driverDB}
+	client := &Client{driverClient: driverClient}
+	ctx := WithOptions(context.Background(), Options{"partition": "p1", "latest": false, "stable": true})
+	db, err := client.DB(ctx, "foo", DefaultOptions(Options{"latest": true}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if d := diff.Interface(map[string]interface{}{"partition": "p1", "latest": false, "stable": true}, driverClient.dbOpts); d != "" {
+		t.Errorf("Unexpected DB options:\n%s", d)
+	}
+	if _, err := db.Get(context.Background(), "baz"); err != nil {
+		t.Fatal(err)
+	}
+	if d := diff.Interface(map[string]interface{}{"latest": true}, driverDB.opts["Get"]); d != "" {
+		t.Errorf("Unexpected options without context options:\n%s", d)
+	}
+	if _, err := db.Get(ctx, "bar", Options{"rev": "1-xxx"}); err != nil {
+		t.Fatal(err)
+	}
+	rows, err := db.Query(ctx, "ddoc", "view", Options{"stable": false})
+	if err != nil {
+		t.Fatal(err)
+	}
+	_ = rows.Close()
+	expected := map[string]map[string]interface{}{
+		// Context options take precedence over defaults, but not over the
+		// options of the call, and only those supported by Get are passed.
+		"Get":   {"rev": "1-xxx", "latest": false},
+		"Query": {"partition": "p1", "latest": false, "stable": false},
+	}
+	if d := diff.Interface(expected, driverDB.opts); d != "" {
+		t.Error(d)
+	}
+}
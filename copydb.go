@@ -0,0 +1,117 @@
+package kivik
+
+import (
+	"context"
+	"encoding/json"
+
+	"github.com/flimzy/kivik/errors"
+)
+
+const copyProgressOption = "kivik_copy_progress"
+
+// CopyProgress reports the progress of CopyDB or RenameDB.
+type CopyProgress struct {
+	// DocsRead is the number of documents read from the source.
+	DocsRead int64
+	// DocsWritten is the number of documents written to the target.
+	DocsWritten int64
+}
+
+// CopyProgressFunc returns an option for CopyDB and RenameDB, which calls fn
+// with the progress of the copy, after each batch of documents is written.
+func CopyProgressFunc(fn func(CopyProgress)) Options {
+	return Options{copyProgressOption: fn}
+}
+
+// CopyDB creates the database target, as a copy of source. The documents of
+// source are copied with their revision histories and attachments, as by
+// replication, along with its security object, if supported by the driver.
+// Deleted documents are not copied. Other options, such as the number of
+// shards, are passed to CreateDB for the target.
+//
+// target must not exist. If the copy fails, the partially copied target is
+// destroyed. As with Restore, drivers which do not support BulkDocs with
+// new_edits=false receive only the current revision of each document.
+func (c *Client) CopyDB(ctx context.Context, source, target string, options ...Options) error {
+	opts, err := mergeOptions(options...)
+	if err != nil {
+		return err
+	}
+	progress, _ := opts[copyProgressOption].(func(CopyProgress))
+	delete(opts, copyProgressOption)
+	if exists, err := c.DBExists(ctx, source); err != nil || !exists {
+		if err == nil {
+			err = errors.Statusf(StatusNotFound, "kivik: database %s does not exist", source)
+		}
+		return err
+	}
+	if exists, err := c.DBExists(ctx, target); err != nil || exists {
+		if err == nil {
+			err = errors.Statusf(StatusPreconditionFailed, "kivik: database %s already exists", target)
+		}
+		return err
+	}
+	if err := c.CreateDB(ctx, target, opts); err != nil {
+		return err
+	}
+	if err := c.copyDB(ctx, source, target, progress); err != nil {
+		_ = c.DestroyDB(ctx, target)
+		return err
+	}
+	return nil
+}
+
+func (c *Client) copyDB(ctx context.Context, source, target string, progress func(CopyProgress)) error {
+	src, err := c.DB(ctx, source)
+	if err != nil {
+		return err
+	}
+	security, err := src.Security(ctx)
+	if err != nil && StatusCode(err) != StatusNotImplemented {
+		return err
+	}
+	dst, err := c.restoreDB(ctx, dumpRecord{DB: target, Security: security})
+	if err != nil {
+		return err
+	}
+	var p CopyProgress
+	var batch []interface{}
+	write := func() error {
+		if err := restoreDocs(ctx, dst, batch); err != nil {
+			return err
+		}
+		p.DocsWritten += int64(len(batch))
+		batch = nil
+		if progress != nil {
+			progress(p)
+		}
+		return nil
+	}
+	err = eachDoc(ctx, src, func(doc json.RawMessage) error {
+		p.DocsRead++
+		batch = append(batch, doc)
+		if len(batch) == restoreBatchSize {
+			return write()
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	if len(batch) == 0 {
+		return nil
+	}
+	return write()
+}
+
+// RenameDB renames the database oldName to newName. As CouchDB cannot rename
+// databases, oldName is copied to newName, as with CopyDB, and then
+// destroyed. Options are as for CopyDB. newName must not exist, and oldName
+// is left unchanged if the copy fails. Changes made to oldName during the copy
+// may be lost, so writes to it should be stopped first.
+func (c *Client) RenameDB(ctx context.Context, oldName, newName string, options ...Options) error {
+	if err := c.CopyDB(ctx, oldName, newName, options...); err != nil {
+		return err
+	}
+	return c.DestroyDB(ctx, oldName)
+}
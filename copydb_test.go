@@ -0,0 +1,80 @@
+package kivik
+
+import (
+	"context"
+	"encoding/json"
+	"strconv"
+	"testing"
+
+	"github.com/flimzy/diff"
+	"github.com/flimzy/kivik/driver"
+)
+
+func TestCopyDB(t *testing.T) {
+	ctx := context.Background()
+	newClient := func() (*Client, *dumpClient) {
+		dc := newDumpClient(true)
+		dc.dbs["foo"] = map[string]json.RawMessage{}
+		for i := 0; i < restoreBatchSize+1; i++ {
+			id := strconv.Itoa(i)
+			dc.dbs["foo"][id] = json.RawMessage(`{"_id":"` + id + `","_rev":"1-aaa","_revisions":{"start":1,"ids":["aaa"]}}`)
+		}
+		dc.dbs["bar"] = map[string]json.RawMessage{}
+		dc.security["foo"] = &driver.Security{Admins: driver.Members{Names: []string{"bob"}}}
+		return &Client{driverClient: dc}, dc
+	}
+
+	t.Run("Copy", func(t *testing.T) {
+		client, dc := newClient()
+		var progress []CopyProgress
+		err := client.CopyDB(ctx, "foo", "baz", CopyProgressFunc(func(p CopyProgress) {
+			progress = append(progress, p)
+		}))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if d := diff.AsJSON(dc.dbs["foo"], dc.dbs["baz"]); d != "" {
+			t.Error(d)
+		}
+		if d := diff.Interface(dc.security["foo"], dc.security["baz"]); d != "" {
+			t.Error(d)
+		}
+		expected := []CopyProgress{
+			{DocsRead: restoreBatchSize, DocsWritten: restoreBatchSize},
+			{DocsRead: restoreBatchSize + 1, DocsWritten: restoreBatchSize + 1},
+		}
+		if d := diff.Interface(expected, progress); d != "" {
+			t.Error(d)
+		}
+	})
+	t.Run("Rename", func(t *testing.T) {
+		client, dc := newClient()
+		foo := dc.dbs["foo"]
+		if err := client.RenameDB(ctx, "foo", "baz"); err != nil {
+			t.Fatal(err)
+		}
+		if _, ok := dc.dbs["foo"]; ok {
+			t.Error("Expected foo to be destroyed")
+		}
+		if d := diff.AsJSON(foo, dc.dbs["baz"]); d != "" {
+			t.Error(d)
+		}
+	})
+	t.Run("TargetExists", func(t *testing.T) {
+		client, dc := newClient()
+		err := client.RenameDB(ctx, "foo", "bar")
+		if StatusCode(err) != StatusPreconditionFailed {
+			t.Errorf("Unexpected error: %v", err)
+		}
+		if _, ok := dc.dbs["foo"]; !ok {
+			t.Error("Expected foo to remain")
+		}
+	})
+	t.Run("SourceMissing", func(t *testing.T) {
+		client, _ := newClient()
+		err := client.CopyDB(ctx, "qux", "baz")
+		if StatusCode(err) != StatusNotFound {
+			t.Errorf("Unexpected error: %v", err)
+		}
+	})
+}
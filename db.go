@@ -11,39 +11,94 @@ import (
 	"github.com/flimzy/kivik/errors"
 )
 
-// DB is a handle to a specific database.
+// DB is a handle to a specific database. A DB is safe for concurrent use by
+// multiple goroutines, so a single handle may be opened once, and shared, with
+// the exception of AddHooks.
 type DB struct {
-	driverDB driver.DB
+	driverDB    driver.DB
+	name        string
+	idGenerator IDGenerator
+	hooks       []Hooks
+	middleware  []Middleware
+	defaults    *dbDefaults
+	timeouts    Timeouts
+	strict      bool
 }
 
 // AllDocs returns a list of all documents in the database.
 func (db *DB) AllDocs(ctx context.Context, options ...Options) (*Rows, error) {
-	opts, err := mergeOptions(options...)
+	opts, err := db.options(ctx, "AllDocs", options...)
 	if err != nil {
 		return nil, err
 	}
-	rowsi, err := db.driverDB.AllDocs(ctx, opts)
+	reuse := reuseBuffers(opts)
+	n := prefetch(opts)
+	fields := projection(opts)
+	if opts, err = encodeKeyOptions(opts); err != nil {
+		return nil, errors.WrapStatus(StatusBadRequest, err)
+	}
+	ctx, cancel := withTimeout(ctx, db.timeouts.Query)
+	result, err := db.invoke(ctx, &Operation{Name: "AllDocs", Options: opts}, func(ctx context.Context, op *Operation) (interface{}, error) {
+		return db.driverDB.AllDocs(ctx, op.Options)
+	})
 	if err != nil {
+		cancel()
 		return nil, err
 	}
-	return newRows(ctx, rowsi), nil
+	rowsi, ok := result.(driver.Rows)
+	if !ok {
+		cancel()
+		return nil, unexpectedResult("AllDocs", result)
+	}
+	rowsi = projectRows(rowsi, fields)
+	var rows *Rows
+	if n > 0 {
+		rows = newPrefetchRows(ctx, rowsi, n)
+	} else {
+		rows = newRows(ctx, rowsi, reuse)
+	}
+	rows.releaseOnClose(cancel)
+	return rows, nil
 }
 
 // Query executes the specified view function from the specified design
 // document. ddoc and view may or may not be be prefixed with '_design/'
 // and '_view/' respectively. No other
 func (db *DB) Query(ctx context.Context, ddoc, view string, options ...Options) (*Rows, error) {
-	opts, err := mergeOptions(options...)
+	opts, err := db.options(ctx, "Query", options...)
 	if err != nil {
 		return nil, err
 	}
+	reuse := reuseBuffers(opts)
+	n := prefetch(opts)
+	fields := projection(opts)
+	if opts, err = encodeKeyOptions(opts); err != nil {
+		return nil, errors.WrapStatus(StatusBadRequest, err)
+	}
 	ddoc = strings.TrimPrefix(ddoc, "_design/")
 	view = strings.TrimPrefix(view, "_view/")
-	rowsi, err := db.driverDB.Query(ctx, ddoc, view, opts)
+	ctx, cancel := withTimeout(ctx, db.timeouts.Query)
+	result, err := db.invoke(ctx, &Operation{Name: "Query", DocID: "_design/" + ddoc, Options: opts}, func(ctx context.Context, op *Operation) (interface{}, error) {
+		return db.driverDB.Query(ctx, ddoc, view, op.Options)
+	})
 	if err != nil {
+		cancel()
 		return nil, err
 	}
-	return newRows(ctx, rowsi), nil
+	rowsi, ok := result.(driver.Rows)
+	if !ok {
+		cancel()
+		return nil, unexpectedResult("Query", result)
+	}
+	rowsi = projectRows(rowsi, fields)
+	var rows *Rows
+	if n > 0 {
+		rows = newPrefetchRows(ctx, rowsi, n)
+	} else {
+		rows = newRows(ctx, rowsi, reuse)
+	}
+	rows.releaseOnClose(cancel)
+	return rows, nil
 }
 
 // Row is the result of calling Get for a single document.
@@ -59,21 +114,97 @@ func (r *Row) ScanDoc(dest interface{}) error {
 
 // Get fetches the requested document.
 func (db *DB) Get(ctx context.Context, docID string, options ...Options) (*Row, error) {
-	opts, err := mergeOptions(options...)
+	ctx, cancel := withTimeout(ctx, db.timeouts.Read)
+	defer cancel()
+	opts, err := db.options(ctx, "Get", options...)
 	if err != nil {
 		return nil, err
 	}
-	row, err := db.driverDB.Get(ctx, docID, opts)
+	if err = checkQuorum(db.driverDB, opts); err != nil {
+		return nil, err
+	}
+	fields := projection(opts)
+	if _, ok := opts["open_revs"]; ok && fields != nil {
+		return nil, errors.Status(StatusBadRequest, "kivik: Project is not supported with open_revs")
+	}
+	result, err := db.invoke(ctx, &Operation{Name: "Get", DocID: docID, Options: opts}, func(ctx context.Context, op *Operation) (interface{}, error) {
+		return db.driverDB.Get(ctx, docID, op.Options)
+	})
 	if err != nil {
 		return nil, err
 	}
+	row, ok := result.(json.RawMessage)
+	if !ok {
+		return nil, unexpectedResult("Get", result)
+	}
+	if err := db.checkDoc(docID, opts, row); err != nil {
+		return nil, err
+	}
+	if fields != nil {
+		if row, err = ProjectDoc(row, fields...); err != nil {
+			return nil, err
+		}
+	}
 	return &Row{doc: row}, nil
 }
 
-// CreateDoc creates a new doc with an auto-generated unique ID. The generated
-// docID and new rev are returned.
-func (db *DB) CreateDoc(ctx context.Context, doc interface{}) (docID, rev string, err error) {
-	return db.driverDB.CreateDoc(ctx, doc)
+// CreateDoc creates a new doc with an auto-generated unique ID, unless doc has
+// an _id. The ID is generated by the client's IDGenerator, if one was set with
+// Client.SetIDGenerator, or otherwise by the server. The docID and new rev are
+// returned. Options, such as Batch, are passed to the
+// driver, which must support them.
+func (db *DB) CreateDoc(ctx context.Context, doc interface{}, options ...Options) (docID, rev string, err error) {
+	ctx, cancel := withTimeout(ctx, db.timeouts.Write)
+	defer cancel()
+	opts, err := db.options(ctx, "CreateDoc", options...)
+	if err != nil {
+		return "", "", err
+	}
+	if err = checkBatch(opts); err != nil {
+		return "", "", err
+	}
+	if err = checkQuorum(db.driverDB, opts); err != nil {
+		return "", "", err
+	}
+	i, err := marshalTagged(doc)
+	if err != nil {
+		return "", "", err
+	}
+	if db.idGenerator != nil {
+		if i, err = withID(i, db.idGenerator); err != nil {
+			return "", "", err
+		}
+	}
+	if i, err = db.beforePut(ctx, "", i); err != nil {
+		return "", "", err
+	}
+	docID, rev, err = db.createDoc(ctx, i, opts)
+	if err == nil && db.strict && docID == "" {
+		err = strictErrorf("CreateDoc returned no document ID")
+	}
+	rev, err = db.checkRev("CreateDoc", docID, rev, err)
+	db.afterPut(ctx, docID, rev, err)
+	return docID, rev, err
+}
+
+func (db *DB) createDoc(ctx context.Context, doc interface{}, opts Options) (docID, rev string, err error) {
+	op := &Operation{Name: "CreateDoc", Options: opts}
+	result, err := db.invoke(ctx, op, func(ctx context.Context, op *Operation) (interface{}, error) {
+		var rev string
+		var err error
+		if len(op.Options) > 0 {
+			creator, ok := db.driverDB.(driver.OptsDocCreator)
+			if !ok {
+				return nil, errors.Status(StatusNotImplemented, "kivik: driver does not support CreateDoc options")
+			}
+			op.DocID, rev, err = creator.CreateDocOpts(ctx, doc, op.Options)
+		} else {
+			op.DocID, rev, err = db.driverDB.CreateDoc(ctx, doc)
+		}
+		return rev, err
+	})
+	rev, _ = result.(string)
+	return op.DocID, rev, err
 }
 
 // normalizeFromJSON unmarshals a []byte, json.RawMessage or io.Reader to a
@@ -97,7 +228,7 @@ func normalizeFromJSON(i interface{}) (interface{}, error) {
 		}
 	}
 	var x map[string]interface{}
-	if err := json.Unmarshal(body, &x); err != nil {
+	if err := JSON().Unmarshal(body, &x); err != nil {
 		return nil, errors.WrapStatus(StatusBadRequest, err)
 	}
 	return x, nil
@@ -111,29 +242,106 @@ func normalizeFromJSON(i interface{}) (interface{}, error) {
 // doc may be one of:
 //
 // - An object to be marshaled to JSON. The resulting JSON structure must
-//   conform to CouchDB standards.
+//   conform to CouchDB standards. Structs may use `kivik` struct tags; see
+//   MarshalDocument.
 // - A []byte value, containing a valid JSON document
 // - A json.RawMessage value containing a valid JSON document
 // - An io.Reader, from which a valid JSON document may be read.
-func (db *DB) Put(ctx context.Context, docID string, doc interface{}) (rev string, err error) {
+//
+// Options, such as the write quorum or Batch, are passed to the driver, which
+// must support them. In batch mode, no rev is returned.
+func (db *DB) Put(ctx context.Context, docID string, doc interface{}, options ...Options) (rev string, err error) {
+	ctx, cancel := withTimeout(ctx, db.timeouts.Write)
+	defer cancel()
+	opts, err := db.options(ctx, "Put", options...)
+	if err != nil {
+		return "", err
+	}
+	if err = checkBatch(opts); err != nil {
+		return "", err
+	}
+	if err = checkQuorum(db.driverDB, opts); err != nil {
+		return "", err
+	}
+	doc, err = marshalTagged(doc)
+	if err != nil {
+		return "", err
+	}
 	i, err := normalizeFromJSON(doc)
 	if err != nil {
 		return "", err
 	}
-	return db.driverDB.Put(ctx, docID, i)
+	if i, err = db.beforePut(ctx, docID, i); err != nil {
+		return "", err
+	}
+	rev, err = db.put(ctx, docID, i, opts)
+	rev, err = db.checkRev("Put", docID, rev, err)
+	db.afterPut(ctx, docID, rev, err)
+	return rev, err
+}
+
+func (db *DB) put(ctx context.Context, docID string, doc interface{}, opts Options) (rev string, err error) {
+	result, err := db.invoke(ctx, &Operation{Name: "Put", DocID: docID, Options: opts}, func(ctx context.Context, op *Operation) (interface{}, error) {
+		if len(op.Options) > 0 {
+			putter, ok := db.driverDB.(driver.OptsPutter)
+			if !ok {
+				return nil, errors.Status(StatusNotImplemented, "kivik: driver does not support Put options")
+			}
+			return putter.PutOpts(ctx, docID, doc, op.Options)
+		}
+		return db.driverDB.Put(ctx, docID, doc)
+	})
+	rev, _ = result.(string)
+	return rev, err
+}
+
+// Delete marks the specified document as deleted. Options, such as the write
+// quorum, are passed to the driver, which must support them.
+func (db *DB) Delete(ctx context.Context, docID, rev string, options ...Options) (newRev string, err error) {
+	ctx, cancel := withTimeout(ctx, db.timeouts.Write)
+	defer cancel()
+	opts, err := db.options(ctx, "Delete", options...)
+	if err != nil {
+		return "", err
+	}
+	if err = checkQuorum(db.driverDB, opts); err != nil {
+		return "", err
+	}
+	if err = db.beforeDelete(ctx, docID, rev); err != nil {
+		return "", err
+	}
+	newRev, err = db.delete(ctx, docID, rev, opts)
+	newRev, err = db.checkRev("Delete", docID, newRev, err)
+	db.afterDelete(ctx, docID, newRev, err)
+	return newRev, err
 }
 
-// Delete marks the specified document as deleted.
-func (db *DB) Delete(ctx context.Context, docID, rev string) (newRev string, err error) {
-	return db.driverDB.Delete(ctx, docID, rev)
+func (db *DB) delete(ctx context.Context, docID, rev string, opts Options) (newRev string, err error) {
+	result, err := db.invoke(ctx, &Operation{Name: "Delete", DocID: docID, Options: opts}, func(ctx context.Context, op *Operation) (interface{}, error) {
+		if len(op.Options) > 0 {
+			deleter, ok := db.driverDB.(driver.OptsDeleter)
+			if !ok {
+				return nil, errors.Status(StatusNotImplemented, "kivik: driver does not support Delete options")
+			}
+			return deleter.DeleteOpts(ctx, docID, rev, op.Options)
+		}
+		return db.driverDB.Delete(ctx, docID, rev)
+	})
+	newRev, _ = result.(string)
+	return newRev, err
 }
 
 // Flush requests a flush of disk cache to disk or other permanent storage.
 //
 // See http://docs.couchdb.org/en/2.0.0/api/database/compact.html#db-ensure-full-commit
 func (db *DB) Flush(ctx context.Context) error {
+	ctx, cancel := withTimeout(ctx, db.timeouts.Write)
+	defer cancel()
 	if flusher, ok := db.driverDB.(driver.DBFlusher); ok {
-		return flusher.Flush(ctx)
+		_, err := db.invoke(ctx, &Operation{Name: "Flush"}, func(ctx context.Context, _ *Operation) (interface{}, error) {
+			return nil, flusher.Flush(ctx)
+		})
+		return err
 	}
 	return errors.Status(StatusNotImplemented, "kivik: flush not supported by driver")
 }
@@ -150,7 +358,7 @@ type DBStats struct {
 	// database.
 	DeletedCount int64 `json:"doc_del_count"`
 	// UpdateSeq is the current update sequence for the database.
-	UpdateSeq string `json:"update_seq"`
+	UpdateSeq SequenceID `json:"update_seq"`
 	// DiskSize is the number of bytes used on-disk to store the database.
 	DiskSize int64 `json:"disk_size"`
 	// ActiveSize is the number of bytes used on-disk to store active documents.
@@ -164,61 +372,120 @@ type DBStats struct {
 
 // Stats returns database statistics.
 func (db *DB) Stats(ctx context.Context) (*DBStats, error) {
-	i, err := db.driverDB.Stats(ctx)
-	stats := DBStats(*i)
-	return &stats, err
+	ctx, cancel := withTimeout(ctx, db.timeouts.Read)
+	defer cancel()
+	result, err := db.invoke(ctx, &Operation{Name: "Stats"}, func(ctx context.Context, _ *Operation) (interface{}, error) {
+		return db.driverDB.Stats(ctx)
+	})
+	if err != nil {
+		return nil, err
+	}
+	i, ok := result.(*driver.DBStats)
+	if !ok {
+		return nil, unexpectedResult("Stats", result)
+	}
+	if err := db.checkStats(i); err != nil {
+		return nil, err
+	}
+	return &DBStats{
+		Name:           i.Name,
+		CompactRunning: i.CompactRunning,
+		DocCount:       i.DocCount,
+		DeletedCount:   i.DeletedCount,
+		UpdateSeq:      SequenceID(i.UpdateSeq),
+		DiskSize:       i.DiskSize,
+		ActiveSize:     i.ActiveSize,
+		ExternalSize:   i.ExternalSize,
+	}, nil
 }
 
 // Compact begins compaction of the database. Check the CompactRunning field
 // returned by Info() to see if the compaction has completed.
 // See http://docs.couchdb.org/en/2.0.0/api/database/compact.html#db-compact
 func (db *DB) Compact(ctx context.Context) error {
-	return db.driverDB.Compact(ctx)
+	ctx, cancel := withTimeout(ctx, db.timeouts.Write)
+	defer cancel()
+	_, err := db.invoke(ctx, &Operation{Name: "Compact"}, func(ctx context.Context, _ *Operation) (interface{}, error) {
+		return nil, db.driverDB.Compact(ctx)
+	})
+	return err
 }
 
 // CompactView compats the view indexes associated with the specified design
 // document.
 // See http://docs.couchdb.org/en/2.0.0/api/database/compact.html#db-compact-design-doc
 func (db *DB) CompactView(ctx context.Context, ddocID string) error {
-	return db.driverDB.CompactView(ctx, ddocID)
+	ctx, cancel := withTimeout(ctx, db.timeouts.Write)
+	defer cancel()
+	_, err := db.invoke(ctx, &Operation{Name: "CompactView", DocID: ddocID}, func(ctx context.Context, _ *Operation) (interface{}, error) {
+		return nil, db.driverDB.CompactView(ctx, ddocID)
+	})
+	return err
 }
 
 // ViewCleanup removes view index files that are no longer required as a result
 // of changed views within design documents.
 // See http://docs.couchdb.org/en/2.0.0/api/database/compact.html#db-view-cleanup
 func (db *DB) ViewCleanup(ctx context.Context) error {
-	return db.driverDB.ViewCleanup(ctx)
+	ctx, cancel := withTimeout(ctx, db.timeouts.Write)
+	defer cancel()
+	_, err := db.invoke(ctx, &Operation{Name: "ViewCleanup"}, func(ctx context.Context, _ *Operation) (interface{}, error) {
+		return nil, db.driverDB.ViewCleanup(ctx)
+	})
+	return err
 }
 
 // Security returns the database's security document.
 // See http://couchdb.readthedocs.io/en/latest/api/database/security.html#get--db-_security
 func (db *DB) Security(ctx context.Context) (*Security, error) {
-	s, err := db.driverDB.Security(ctx)
+	ctx, cancel := withTimeout(ctx, db.timeouts.Read)
+	defer cancel()
+	result, err := db.invoke(ctx, &Operation{Name: "Security"}, func(ctx context.Context, _ *Operation) (interface{}, error) {
+		return db.driverDB.Security(ctx)
+	})
 	if err != nil {
 		return nil, err
 	}
+	s, ok := result.(*driver.Security)
+	if !ok {
+		return nil, unexpectedResult("Security", result)
+	}
 	return &Security{
 		Admins:  Members(s.Admins),
 		Members: Members(s.Members),
-	}, err
+	}, nil
 }
 
 // SetSecurity sets the database's security document.
 // See http://couchdb.readthedocs.io/en/latest/api/database/security.html#put--db-_security
 func (db *DB) SetSecurity(ctx context.Context, security *Security) error {
+	ctx, cancel := withTimeout(ctx, db.timeouts.Write)
+	defer cancel()
 	sec := &driver.Security{
 		Admins:  driver.Members(security.Admins),
 		Members: driver.Members(security.Members),
 	}
-	return db.driverDB.SetSecurity(ctx, sec)
+	_, err := db.invoke(ctx, &Operation{Name: "SetSecurity"}, func(ctx context.Context, _ *Operation) (interface{}, error) {
+		return nil, db.driverDB.SetSecurity(ctx, sec)
+	})
+	return err
 }
 
 // Rev returns the most current rev of the requested document. This can
 // be more efficient than a full document fetch, because only the rev is
 // fetched from the server.
 func (db *DB) Rev(ctx context.Context, docID string) (rev string, err error) {
+	ctx, cancel := withTimeout(ctx, db.timeouts.Read)
+	defer cancel()
 	if r, ok := db.driverDB.(driver.Rever); ok {
-		return r.Rev(ctx, docID)
+		var result interface{}
+		result, err = db.invoke(ctx, &Operation{Name: "Rev", DocID: docID}, func(ctx context.Context, _ *Operation) (interface{}, error) {
+			return r.Rev(ctx, docID)
+		})
+		rev, _ = result.(string)
+		if errors.StatusCode(err) != StatusNotImplemented {
+			return db.checkRev("Rev", docID, rev, err)
+		}
 	}
 	// These last two lines cannot be combined for GopherJS due to a bug.
 	// See https://github.com/gopherjs/gopherjs/issues/608
@@ -242,14 +509,20 @@ func (db *DB) Rev(ctx context.Context, docID string) (rev string, err error) {
 //
 // See http://docs.couchdb.org/en/2.0.0/api/document/common.html#copy--db-docid
 func (db *DB) Copy(ctx context.Context, targetID, sourceID string, options ...Options) (targetRev string, err error) {
-	opts, err := mergeOptions(options...)
+	ctx, cancel := withTimeout(ctx, db.timeouts.Write)
+	defer cancel()
+	opts, err := db.options(ctx, "Copy", options...)
 	if err != nil {
 		return "", err
 	}
 	if copier, ok := db.driverDB.(driver.Copier); ok {
-		targetRev, err = copier.Copy(ctx, targetID, sourceID, opts)
+		var result interface{}
+		result, err = db.invoke(ctx, &Operation{Name: "Copy", DocID: targetID, Options: opts}, func(ctx context.Context, op *Operation) (interface{}, error) {
+			return copier.Copy(ctx, targetID, sourceID, op.Options)
+		})
+		targetRev, _ = result.(string)
 		if errors.StatusCode(err) != StatusNotImplemented {
-			return targetRev, err
+			return db.checkRev("Copy", targetID, targetRev, err)
 		}
 	}
 	row, err := db.Get(ctx, sourceID, opts)
@@ -266,38 +539,136 @@ func (db *DB) Copy(ctx context.Context, targetID, sourceID string, options ...Op
 }
 
 // PutAttachment uploads the supplied content as an attachment to the specified
-// document.
+// document. If att.ContentType is empty, the content type is detected from the
+// first 512 bytes of the content, with http.DetectContentType.
 func (db *DB) PutAttachment(ctx context.Context, docID, rev string, att *Attachment) (newRev string, err error) {
-	return db.driverDB.PutAttachment(ctx, docID, rev, att.Filename, att.ContentType, att)
+	ctx, cancel := withTimeout(ctx, db.timeouts.Write)
+	defer cancel()
+	contentType := att.ContentType
+	var body io.Reader = att
+	if contentType == "" {
+		if contentType, body, err = detectContentType(att); err != nil {
+			return "", err
+		}
+	}
+	result, err := db.invoke(ctx, &Operation{Name: "PutAttachment", DocID: docID}, func(ctx context.Context, _ *Operation) (interface{}, error) {
+		return db.driverDB.PutAttachment(ctx, docID, rev, att.Filename, contentType, body)
+	})
+	newRev, _ = result.(string)
+	return db.checkRev("PutAttachment", docID, newRev, err)
 }
 
-// GetAttachment returns a file attachment associated with the document.
-func (db *DB) GetAttachment(ctx context.Context, docID, rev, filename string) (*Attachment, error) {
-	cType, md5sum, body, err := db.driverDB.GetAttachment(ctx, docID, rev, filename)
+// PutMultipart stores a document with attachments whose content is streamed
+// from atts, rather than base64-encoded in the document, so that large
+// attachments need not be held in memory. The attachments replace any of the
+// same names in the document's _attachments field. Options such as
+// new_edits=false are passed to the driver. If the driver does not support
+// multipart requests, an error with status StatusNotImplemented is returned.
+// As with Put, the document is subject to the BeforePut and AfterPut hooks.
+//
+// See http://docs.couchdb.org/en/2.0.0/api/document/common.html#creating-multiple-attachments
+func (db *DB) PutMultipart(ctx context.Context, docID string, doc interface{}, atts []*Attachment, options ...Options) (rev string, err error) {
+	ctx, cancel := withTimeout(ctx, db.timeouts.Write)
+	defer cancel()
+	opts, err := db.options(ctx, "PutMultipart", options...)
 	if err != nil {
-		return nil, err
+		return "", err
 	}
-	return &Attachment{
-		ReadCloser:  body,
-		Filename:    filename,
-		ContentType: cType,
-		MD5:         MD5sum(md5sum),
-	}, nil
+	if err = checkQuorum(db.driverDB, opts); err != nil {
+		return "", err
+	}
+	doc, err = marshalTagged(doc)
+	if err != nil {
+		return "", err
+	}
+	i, err := normalizeFromJSON(doc)
+	if err != nil {
+		return "", err
+	}
+	if i, err = db.beforePut(ctx, docID, i); err != nil {
+		return "", err
+	}
+	parts := make([]driver.MultipartAttachment, len(atts))
+	for j, att := range atts {
+		parts[j] = driver.MultipartAttachment{
+			Filename:    att.Filename,
+			ContentType: att.ContentType,
+			Length:      att.Length,
+			Content:     att,
+		}
+	}
+	result, err := db.invoke(ctx, &Operation{Name: "PutMultipart", DocID: docID, Options: opts}, func(ctx context.Context, op *Operation) (interface{}, error) {
+		putter, ok := db.driverDB.(driver.MultipartPutter)
+		if !ok {
+			return nil, errors.Status(StatusNotImplemented, "kivik: driver does not support multipart requests")
+		}
+		return putter.PutMultipart(ctx, docID, i, parts, op.Options)
+	})
+	rev, _ = result.(string)
+	rev, err = db.checkRev("PutMultipart", docID, rev, err)
+	db.afterPut(ctx, docID, rev, err)
+	return rev, err
 }
 
-// GetAttachmentMeta returns meta data about an attachment. The attachment
-// content returned will be empty.
-func (db *DB) GetAttachmentMeta(ctx context.Context, docID, rev, filename string) (*Attachment, error) {
-	if metaer, ok := db.driverDB.(driver.AttachmentMetaer); ok {
-		cType, md5sum, err := metaer.GetAttachmentMeta(ctx, docID, rev, filename)
+// GetAttachment returns a file attachment associated with the document. To
+// verify the content against the attachment's MD5 digest as it is read, call
+// VerifyMD5 on the result.
+func (db *DB) GetAttachment(ctx context.Context, docID, rev, filename string) (*Attachment, error) {
+	ctx, cancel := withTimeout(ctx, db.timeouts.Read)
+	result, err := db.invoke(ctx, &Operation{Name: "GetAttachment", DocID: docID}, func(ctx context.Context, _ *Operation) (interface{}, error) {
+		cType, md5sum, body, err := db.driverDB.GetAttachment(ctx, docID, rev, filename)
 		if err != nil {
 			return nil, err
 		}
 		return &Attachment{
+			ReadCloser:  body,
 			Filename:    filename,
 			ContentType: cType,
 			MD5:         MD5sum(md5sum),
 		}, nil
+	})
+	if err != nil {
+		cancel()
+		return nil, err
+	}
+	att, ok := result.(*Attachment)
+	if !ok {
+		cancel()
+		return nil, unexpectedResult("GetAttachment", result)
+	}
+	att.ReadCloser = &cancelCloser{ReadCloser: att.ReadCloser, cancel: cancel}
+	return att, nil
+}
+
+// GetAttachmentMeta returns meta data about an attachment. The attachment
+// content returned will be empty.
+func (db *DB) GetAttachmentMeta(ctx context.Context, docID, rev, filename string) (*Attachment, error) {
+	ctx, cancel := withTimeout(ctx, db.timeouts.Read)
+	defer cancel()
+	if metaer, ok := db.driverDB.(driver.AttachmentMetaer); ok {
+		result, err := db.invoke(ctx, &Operation{Name: "GetAttachmentMeta", DocID: docID}, func(ctx context.Context, _ *Operation) (interface{}, error) {
+			cType, md5sum, err := metaer.GetAttachmentMeta(ctx, docID, rev, filename)
+			if err != nil {
+				return nil, err
+			}
+			return &Attachment{
+				Filename:    filename,
+				ContentType: cType,
+				MD5:         MD5sum(md5sum),
+			}, nil
+		})
+		switch {
+		case errors.StatusCode(err) == StatusNotImplemented:
+			// Fall back to GetAttachment below
+		case err != nil:
+			return nil, err
+		default:
+			att, ok := result.(*Attachment)
+			if !ok {
+				return nil, unexpectedResult("GetAttachmentMeta", result)
+			}
+			return att, nil
+		}
 	}
 	att, err := db.GetAttachment(ctx, docID, rev, filename)
 	if err != nil {
@@ -311,8 +682,38 @@ func (db *DB) GetAttachmentMeta(ctx context.Context, docID, rev, filename string
 	}, nil
 }
 
+// Attachments returns the stubs of the attachments of the document, keyed by
+// filename, without fetching their content. If rev is empty, the current
+// revision is read. A document with no attachments yields an empty map.
+func (db *DB) Attachments(ctx context.Context, docID, rev string) (AttachmentStubs, error) {
+	var opts Options
+	if rev != "" {
+		opts = Options{"rev": rev}
+	}
+	row, err := db.Get(ctx, docID, opts)
+	if err != nil {
+		return nil, err
+	}
+	var doc struct {
+		Attachments AttachmentStubs `json:"_attachments"`
+	}
+	if err := row.ScanDoc(&doc); err != nil {
+		return nil, err
+	}
+	if doc.Attachments == nil {
+		doc.Attachments = AttachmentStubs{}
+	}
+	return doc.Attachments, nil
+}
+
 // DeleteAttachment delets an attachment from a document, returning the
 // document's new revision.
 func (db *DB) DeleteAttachment(ctx context.Context, docID, rev, filename string) (newRev string, err error) {
-	return db.driverDB.DeleteAttachment(ctx, docID, rev, filename)
+	ctx, cancel := withTimeout(ctx, db.timeouts.Write)
+	defer cancel()
+	result, err := db.invoke(ctx, &Operation{Name: "DeleteAttachment", DocID: docID}, func(ctx context.Context, _ *Operation) (interface{}, error) {
+		return db.driverDB.DeleteAttachment(ctx, docID, rev, filename)
+	})
+	newRev, _ = result.(string)
+	return db.checkRev("DeleteAttachment", docID, newRev, err)
 }
@@ -17,13 +17,13 @@ type dummyDB struct{}
 var _ driver.DB = &dummyDB{}
 
 func (n *dummyDB) AllDocs(_ context.Context, _ map[string]interface{}) (driver.Rows, error) {
-	return nil, nil
+	return &dumpRows{}, nil
 }
 func (n *dummyDB) BulkDocs(_ context.Context, _ []interface{}) (driver.BulkResults, error) {
-	return nil, nil
+	return &dumpBulkResults{}, nil
 }
 func (n *dummyDB) Changes(_ context.Context, _ map[string]interface{}) (driver.Changes, error) {
-	return nil, nil
+	return &sliceChanges{}, nil
 }
 func (n *dummyDB) CreateDoc(_ context.Context, _ interface{}) (string, string, error) {
 	return "", "", nil
@@ -41,7 +41,7 @@ func (n *dummyDB) PutAttachment(_ context.Context, _, _, _, _ string, _ io.Reade
 	return "", nil
 }
 func (n *dummyDB) Query(_ context.Context, _, _ string, _ map[string]interface{}) (driver.Rows, error) {
-	return nil, nil
+	return &dumpRows{}, nil
 }
 func (n *dummyDB) Compact(_ context.Context) error                                { return nil }
 func (n *dummyDB) CompactView(_ context.Context, _ string) error                  { return nil }
@@ -62,6 +62,16 @@ func TestFlushNotSupported(t *testing.T) {
 	}
 }
 
+func TestPutMultipartNotSupported(t *testing.T) {
+	db := &DB{
+		driverDB: &dummyDB{},
+	}
+	_, err := db.PutMultipart(context.Background(), "foo", map[string]string{}, nil)
+	if StatusCode(err) != StatusNotImplemented {
+		t.Errorf("Expected NotImplemented, got %s", err)
+	}
+}
+
 type putGrabber struct {
 	*dummyDB
 	lastPut interface{}
@@ -189,6 +199,15 @@ func TestPutJSON(t *testing.T) {
 			Status: 500,
 			Error:  "errorReader",
 		},
+		{
+			Name: "TaggedStruct",
+			Input: struct {
+				ID   string `json:"-" kivik:"id"`
+				Rev  string `json:"-" kivik:"rev"`
+				Name string `json:"name"`
+			}{ID: "foo", Rev: "1-xxx", Name: "Bob"},
+			Expected: map[string]interface{}{"_id": "foo", "_rev": "1-xxx", "name": "Bob"},
+		},
 	}
 	for _, test := range tests {
 		func(test putTest) {
@@ -0,0 +1,31 @@
+package kivik
+
+import "regexp"
+
+// System databases of CouchDB 2.x. _replicator and _users also exist in
+// CouchDB 1.x.
+const (
+	UsersDB         = "_users"
+	ReplicatorDB    = "_replicator"
+	GlobalChangesDB = "_global_changes"
+)
+
+// SystemDBs are the names of the system databases, which are valid database
+// names despite their leading underscore.
+var SystemDBs = []string{UsersDB, ReplicatorDB, GlobalChangesDB}
+
+// As documented at http://docs.couchdb.org/en/2.0.0/api/database/common.html#put--db
+var validDBName = regexp.MustCompile("^[a-z][a-z0-9_$()+/-]*$")
+
+// ValidDBName returns true if name is a valid database name: either a system
+// database, or a name of lowercase letters, digits, and any of _$()+-/,
+// starting with a letter. A slash, as in "foo/bar", is part of the name, which
+// drivers escape as required.
+func ValidDBName(name string) bool {
+	for _, sys := range SystemDBs {
+		if name == sys {
+			return true
+		}
+	}
+	return validDBName.MatchString(name)
+}
@@ -0,0 +1,24 @@
+package kivik
+
+import "testing"
+
+func TestValidDBName(t *testing.T) {
+	tests := map[string]bool{
+		"foo":             true,
+		"foo/bar":         true,
+		"a0_$()+-/":       true,
+		"_users":          true,
+		"_replicator":     true,
+		"_global_changes": true,
+		"_chicken":        false,
+		"Foo":             false,
+		"0foo":            false,
+		"":                false,
+		"foo bar":         false,
+	}
+	for name, expected := range tests {
+		if valid := ValidDBName(name); valid != expected {
+			t.Errorf("ValidDBName(%q) = %t, expected %t", name, valid, expected)
+		}
+	}
+}
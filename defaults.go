@@ -0,0 +1,73 @@
+package kivik
+
+import (
+	"sync"
+
+	"github.com/flimzy/kivik/driver"
+)
+
+// clientOptionPrefix is the prefix of options which are consumed by kivik
+// itself, rather than passed to the driver.
+const clientOptionPrefix = "kivik_"
+
+const defaultOptionsOption = "kivik_default_options"
+
+// DefaultOptions returns options for Client.DB, which set opts as defaults for
+// every method of the DB which takes options, such as a partition, or r and w
+// quorum options. Options passed to a method take precedence over the
+// defaults. For drivers which declare the options supported by a method, as
+// with driver.OptionValidator, defaults which the method does not support are
+// not passed to it, so options need not be applicable to every method.
+// Likewise, defaults are only passed to Put, CreateDoc, Delete and BulkDocs if
+// the driver declares or accepts options for them.
+//
+//	db, err := client.DB(ctx, "orders", kivik.DefaultOptions(kivik.Options{
+//	    "w": 2,
+//	}))
+func DefaultOptions(opts Options) Options {
+	return Options{defaultOptionsOption: opts}
+}
+
+// dbDefaults holds the default options of a DB. The options applicable to
+// each method are computed once, so that they may be shared by concurrent
+// calls without locking on every call.
+type dbDefaults struct {
+	opts Options
+
+	mu        sync.RWMutex
+	byMethods map[string]Options
+}
+
+// takeDefaults removes the DefaultOptions from opts, and returns them, or nil
+// if there are none.
+func takeDefaults(opts Options) *dbDefaults {
+	value, ok := opts[defaultOptionsOption]
+	if !ok {
+		return nil
+	}
+	delete(opts, defaultOptionsOption)
+	defaults, _ := asMap(value)
+	if len(defaults) == 0 {
+		return nil
+	}
+	return &dbDefaults{
+		opts:      defaults,
+		byMethods: make(map[string]Options),
+	}
+}
+
+// forMethod returns the default options applicable to method. The result
+// must not be modified.
+func (d *dbDefaults) forMethod(db driver.DB, method string) Options {
+	d.mu.RLock()
+	opts, ok := d.byMethods[method]
+	d.mu.RUnlock()
+	if ok {
+		return opts
+	}
+	opts = applicableOptions(db, method, d.opts)
+	d.mu.Lock()
+	d.byMethods[method] = opts
+	d.mu.Unlock()
+	return opts
+}
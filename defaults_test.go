@@ -0,0 +1,102 @@
+package kivik
+
+import (
+	"context"
+	"encoding/json"
+	"sync"
+	"testing"
+
+	"github.com/flimzy/diff"
+	"github.com/flimzy/kivik/driver"
+)
+
+type defaultsClient struct {
+	driver.Client
+	dbOpts map[string]interface{}
+	db     *defaultsDB
+}
+
+func (c *defaultsClient) DB(_ context.Context, _ string, opts map[string]interface{}) (driver.DB, error) {
+	c.dbOpts = opts
+	return c.db, nil
+}
+
+type defaultsDB struct {
+	dummyDB
+	mu   sync.Mutex
+	opts map[string]map[string]interface{}
+}
+
+var _ driver.OptionValidator = &defaultsDB{}
+
+func (db *defaultsDB) SupportedOptions(method string) (map[string]driver.OptionType, bool) {
+	if method != "Get" {
+		return nil, false
+	}
+	return map[string]driver.OptionType{
+		"rev":    driver.OptionString,
+		"latest": driver.OptionBool,
+	}, true
+}
+
+func (db *defaultsDB) record(method string, opts map[string]interface{}) {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	db.opts[method] = opts
+}
+
+func (db *defaultsDB) Get(_ context.Context, _ string, opts map[string]interface{}) (json.RawMessage, error) {
+	db.record("Get", opts)
+	return json.RawMessage(`{}`), nil
+}
+
+func (db *defaultsDB) Query(_ context.Context, _, _ string, opts map[string]interface{}) (driver.Rows, error) {
+	db.record("Query", opts)
+	return &rows{}, nil
+}
+
+func TestDefaultOptions(t *testing.T) {
+	driverDB := &defaultsDB{opts: make(map[string]map[string]interface{})}
+	driverClient := &defaultsClient{db: driverDB}
+	client := &Client{driverClient: driverClient}
+	db, err := client.DB(context.Background(), "foo",
+		Options{"partition": "p1"},
+		DefaultOptions(Options{"latest": true, "stable": true}),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if d := diff.Interface(map[string]interface{}{"partition": "p1"}, driverClient.dbOpts); d != "" {
+		t.Errorf("Unexpected DB options:\n%s", d)
+	}
+
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			if _, err := db.Get(context.Background(), "bar", Options{"rev": "1-xxx"}); err != nil {
+				t.Error(err)
+			}
+		}()
+		go func() {
+			defer wg.Done()
+			rows, err := db.Query(context.Background(), "ddoc", "view", Options{"stable": false})
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			_ = rows.Close()
+		}()
+	}
+	wg.Wait()
+
+	expected := map[string]map[string]interface{}{
+		// Only the defaults supported by Get are passed.
+		"Get":   {"rev": "1-xxx", "latest": true},
+		"Query": {"latest": true, "stable": false},
+	}
+	if d := diff.Interface(expected, driverDB.opts); d != "" {
+		t.Error(d)
+	}
+}
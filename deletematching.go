@@ -0,0 +1,204 @@
+package kivik
+
+import "context"
+
+const (
+	deleteBatchSizeOption = "kivik_delete_batch_size"
+	deleteDryRunOption    = "kivik_delete_dry_run"
+	deleteProgressOption  = "kivik_delete_progress"
+)
+
+// DeleteProgress reports the progress of DeleteMatching or DeleteView.
+type DeleteProgress struct {
+	// Matched is the number of documents matched so far.
+	Matched int64
+	// Deleted is the number of documents deleted. It is zero for a dry run.
+	Deleted int64
+	// Failed is the number of matched documents which could not be deleted,
+	// such as because they were updated concurrently.
+	Failed int64
+}
+
+// DeleteBatchSize returns an option for DeleteMatching and DeleteView, which
+// sets the number of documents read and deleted in each batch. The default is
+// DefaultBulkBatchSize.
+func DeleteBatchSize(n int) Options {
+	return Options{deleteBatchSizeOption: n}
+}
+
+// DeleteDryRun returns an option for DeleteMatching and DeleteView, which
+// counts the matching documents without deleting them.
+func DeleteDryRun() Options {
+	return Options{deleteDryRunOption: true}
+}
+
+// DeleteProgressFunc returns an option for DeleteMatching and DeleteView,
+// which calls fn with the progress of the deletion, after each batch.
+func DeleteProgressFunc(fn func(DeleteProgress)) Options {
+	return Options{deleteProgressOption: fn}
+}
+
+// DeleteMatching deletes the documents which match the Mango selector, in
+// batches, with BulkDocs, and returns the number of documents matched,
+// deleted, and which failed to be deleted. Documents which fail to be deleted,
+// as when updated concurrently, are skipped. Options are DeleteBatchSize,
+// DeleteDryRun and DeleteProgressFunc. The driver must support Find.
+func (db *DB) DeleteMatching(ctx context.Context, selector interface{}, options ...Options) (*DeleteProgress, error) {
+	return db.deleteAll(ctx, options, func(skip, limit int) (*Rows, error) {
+		return db.Find(ctx, map[string]interface{}{
+			"selector": selector,
+			"fields":   []string{"_id", "_rev"},
+			"skip":     skip,
+			"limit":    limit,
+		})
+	})
+}
+
+// DeleteView deletes the documents of the rows of the view, as DeleteMatching
+// does for a selector. Other options, such as startkey and endkey, select the
+// rows of the view, and are passed to Query, with include_docs.
+func (db *DB) DeleteView(ctx context.Context, ddoc, view string, options ...Options) (*DeleteProgress, error) {
+	opts, err := mergeOptions(options...)
+	if err != nil {
+		return nil, err
+	}
+	deleteOpts := Options{}
+	for _, key := range []string{deleteBatchSizeOption, deleteDryRunOption, deleteProgressOption} {
+		if v, ok := opts[key]; ok {
+			deleteOpts[key] = v
+			delete(opts, key)
+		}
+	}
+	return db.deleteAll(ctx, []Options{deleteOpts}, func(skip, limit int) (*Rows, error) {
+		return db.Query(ctx, ddoc, view, opts, Options{
+			"include_docs": true,
+			"skip":         skip,
+			"limit":        limit,
+		})
+	})
+}
+
+// deleteAll deletes, in batches, the documents of the rows returned by read,
+// which must return limit rows after skipping skip. As the rows of deleted
+// documents no longer match, each batch skips only the rows which remain:
+// those of documents which failed to be deleted, or of all documents for a dry
+// run, and those without a document.
+func (db *DB) deleteAll(ctx context.Context, options []Options, read func(skip, limit int) (*Rows, error)) (*DeleteProgress, error) {
+	opts, err := mergeOptions(options...)
+	if err != nil {
+		return nil, err
+	}
+	batchSize, _ := opts[deleteBatchSizeOption].(int)
+	if batchSize <= 0 {
+		batchSize = DefaultBulkBatchSize
+	}
+	dryRun, _ := opts[deleteDryRunOption].(bool)
+	progress, _ := opts[deleteProgressOption].(func(DeleteProgress))
+	p := &DeleteProgress{}
+	// seen holds the IDs of the matched documents which remain, so that each
+	// is counted once, however many rows it has.
+	seen := make(map[string]bool)
+	var skip int
+	for {
+		rows, err := read(skip, batchSize)
+		if err != nil {
+			return p, err
+		}
+		batch, err := readDeletions(rows, seen)
+		if err != nil {
+			return p, err
+		}
+		p.Matched += int64(len(batch.docs))
+		skip += batch.remaining
+		if dryRun {
+			for _, doc := range batch.docs {
+				seen[doc.ID] = true
+				skip += doc.rows
+			}
+		} else if len(batch.docs) > 0 {
+			failed, err := db.deleteDocs(ctx, batch.docs)
+			if err != nil {
+				return p, err
+			}
+			for _, doc := range failed {
+				seen[doc.ID] = true
+				skip += doc.rows
+			}
+			p.Deleted += int64(len(batch.docs) - len(failed))
+			p.Failed += int64(len(failed))
+		}
+		if progress != nil {
+			progress(*p)
+		}
+		if batch.n < batchSize {
+			return p, nil
+		}
+	}
+}
+
+// deletion is a document to delete, with the number of rows of the batch
+// which it accounts for.
+type deletion struct {
+	ID   string `json:"_id"`
+	Rev  string `json:"_rev"`
+	rows int
+}
+
+type deletionBatch struct {
+	docs []*deletion
+	// n is the number of rows read.
+	n int
+	// remaining is the number of rows which remain regardless of the
+	// deletion of docs: those of documents already seen, or without a
+	// document.
+	remaining int
+}
+
+func readDeletions(rows *Rows, seen map[string]bool) (*deletionBatch, error) {
+	defer func() { _ = rows.Close() }()
+	batch := &deletionBatch{}
+	byID := make(map[string]*deletion)
+	for rows.Next() {
+		batch.n++
+		doc := &deletion{}
+		if err := rows.ScanDoc(doc); err != nil {
+			return nil, err
+		}
+		if doc.ID == "" || seen[doc.ID] {
+			batch.remaining++
+			continue
+		}
+		if existing, ok := byID[doc.ID]; ok {
+			existing.rows++
+			continue
+		}
+		doc.rows = 1
+		byID[doc.ID] = doc
+		batch.docs = append(batch.docs, doc)
+	}
+	return batch, rows.Err()
+}
+
+// deleteDocs deletes docs with BulkDocs, and returns those which failed.
+func (db *DB) deleteDocs(ctx context.Context, docs []*deletion) ([]*deletion, error) {
+	stubs := make([]interface{}, len(docs))
+	byID := make(map[string]*deletion, len(docs))
+	for i, doc := range docs {
+		stubs[i] = map[string]interface{}{"_id": doc.ID, "_rev": doc.Rev, "_deleted": true}
+		byID[doc.ID] = doc
+	}
+	results, err := db.BulkDocs(ctx, stubs)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = results.Close() }()
+	var failed []*deletion
+	for results.Next() {
+		if results.UpdateErr() != nil {
+			if doc, ok := byID[results.ID()]; ok {
+				failed = append(failed, doc)
+			}
+		}
+	}
+	return failed, results.Err()
+}
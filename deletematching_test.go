@@ -0,0 +1,209 @@
+package kivik
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"testing"
+
+	"github.com/flimzy/diff"
+	"github.com/flimzy/kivik/driver"
+	"github.com/flimzy/kivik/errors"
+)
+
+// deleteDB holds documents by ID, with their type. Find matches documents by
+// type, and the view emits a row for each document, and a second row for
+// documents of type "multi". Deletes of documents in conflicts fail.
+type deleteDB struct {
+	dummyDB
+	docs      map[string]string
+	conflicts map[string]bool
+	batches   []int
+}
+
+var _ driver.Finder = &deleteDB{}
+
+func newDeleteDB(n int, conflicts ...string) *deleteDB {
+	db := &deleteDB{docs: make(map[string]string), conflicts: make(map[string]bool)}
+	for i := 0; i < n; i++ {
+		docType := "keep"
+		switch i % 3 {
+		case 0:
+			docType = "match"
+		case 1:
+			docType = "multi"
+		}
+		db.docs[fmt.Sprintf("doc%02d", i)] = docType
+	}
+	for _, id := range conflicts {
+		db.conflicts[id] = true
+	}
+	return db
+}
+
+func (db *deleteDB) ids() []string {
+	ids := make([]string, 0, len(db.docs))
+	for id := range db.docs {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	return ids
+}
+
+func page(input []string, skip, limit int) []string {
+	if skip > len(input) {
+		skip = len(input)
+	}
+	input = input[skip:]
+	if limit < len(input) {
+		input = input[:limit]
+	}
+	return input
+}
+
+func (db *deleteDB) Find(_ context.Context, query interface{}) (driver.Rows, error) {
+	raw, _ := json.Marshal(query)
+	var q struct {
+		Selector struct {
+			Type string `json:"type"`
+		} `json:"selector"`
+		Skip  int `json:"skip"`
+		Limit int `json:"limit"`
+	}
+	if err := json.Unmarshal(raw, &q); err != nil {
+		return nil, err
+	}
+	var input []string
+	for _, id := range db.ids() {
+		if db.docs[id] == q.Selector.Type || (q.Selector.Type == "match" && db.docs[id] == "multi") {
+			input = append(input, fmt.Sprintf(`{"doc":{"_id":%q,"_rev":"1-x"}}`, id))
+		}
+	}
+	return &sliceRows{rows: &rows{}, input: page(input, q.Skip, q.Limit)}, nil
+}
+
+func (db *deleteDB) Query(_ context.Context, _, _ string, opts map[string]interface{}) (driver.Rows, error) {
+	var input []string
+	for _, id := range db.ids() {
+		if db.docs[id] == "keep" {
+			continue
+		}
+		input = append(input, fmt.Sprintf(`{"id":%q,"key":1,"doc":{"_id":%q,"_rev":"1-x"}}`, id, id))
+		if db.docs[id] == "multi" {
+			input = append(input, fmt.Sprintf(`{"id":%q,"key":2,"doc":{"_id":%q,"_rev":"1-x"}}`, id, id))
+		}
+	}
+	skip, _ := opts["skip"].(int)
+	limit, _ := opts["limit"].(int)
+	return &sliceRows{rows: &rows{}, input: page(input, skip, limit)}, nil
+}
+
+func (db *deleteDB) CreateIndex(_ context.Context, _, _ string, _ interface{}) error { return nil }
+func (db *deleteDB) GetIndexes(_ context.Context) ([]driver.Index, error)            { return nil, nil }
+func (db *deleteDB) DeleteIndex(_ context.Context, _, _ string) error                { return nil }
+
+func (db *deleteDB) BulkDocs(_ context.Context, docs []interface{}) (driver.BulkResults, error) {
+	db.batches = append(db.batches, len(docs))
+	results := make([]driver.BulkResult, len(docs))
+	for i, doc := range docs {
+		stub := doc.(map[string]interface{})
+		id := stub["_id"].(string)
+		if stub["_deleted"] != true || stub["_rev"] != "1-x" {
+			return nil, errors.Status(StatusBadRequest, "invalid deletion stub")
+		}
+		results[i] = driver.BulkResult{ID: id, Rev: "2-x"}
+		if db.conflicts[id] {
+			results[i].Error = errors.Status(StatusConflict, "conflict")
+			continue
+		}
+		delete(db.docs, id)
+	}
+	return &bulkResultSet{results: results}, nil
+}
+
+func TestDeleteMatching(t *testing.T) {
+	tests := []struct {
+		name      string
+		view      bool
+		conflicts []string
+		options   Options
+		expected  DeleteProgress
+		remaining int
+		progress  int
+	}{
+		{
+			name:      "Selector",
+			expected:  DeleteProgress{Matched: 20, Deleted: 20},
+			remaining: 10,
+			progress:  4,
+		},
+		{
+			name:      "SelectorConflicts",
+			conflicts: []string{"doc00", "doc04", "doc28"},
+			expected:  DeleteProgress{Matched: 20, Deleted: 17, Failed: 3},
+			remaining: 13,
+			progress:  4,
+		},
+		{
+			name:      "DryRun",
+			options:   DeleteDryRun(),
+			expected:  DeleteProgress{Matched: 20},
+			remaining: 30,
+			progress:  4,
+		},
+		{
+			name:      "View",
+			view:      true,
+			conflicts: []string{"doc01"},
+			expected:  DeleteProgress{Matched: 20, Deleted: 19, Failed: 1},
+			remaining: 11,
+			progress:  6,
+		},
+		{
+			name:      "ViewDryRun",
+			view:      true,
+			options:   DeleteDryRun(),
+			expected:  DeleteProgress{Matched: 20},
+			remaining: 30,
+			progress:  6,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			driverDB := newDeleteDB(30, test.conflicts...)
+			db := &DB{driverDB: driverDB}
+			var updates []DeleteProgress
+			opts := []Options{DeleteBatchSize(6), DeleteProgressFunc(func(p DeleteProgress) {
+				updates = append(updates, p)
+			}), test.options}
+			var result *DeleteProgress
+			var err error
+			if test.view {
+				result, err = db.DeleteView(context.Background(), "ddoc", "view", opts...)
+			} else {
+				result, err = db.DeleteMatching(context.Background(), map[string]string{"type": "match"}, opts...)
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if d := diff.Interface(test.expected, *result); d != "" {
+				t.Error(d)
+			}
+			if len(driverDB.docs) != test.remaining {
+				t.Errorf("Expected %d documents to remain, found %d", test.remaining, len(driverDB.docs))
+			}
+			if len(updates) != test.progress {
+				t.Errorf("Expected %d progress updates, got %d", test.progress, len(updates))
+			}
+			if len(updates) > 0 && updates[len(updates)-1] != *result {
+				t.Errorf("Unexpected final progress: %+v", updates[len(updates)-1])
+			}
+			for _, n := range driverDB.batches {
+				if n > 6 {
+					t.Errorf("Batch of %d exceeds the batch size", n)
+				}
+			}
+		})
+	}
+}
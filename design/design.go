@@ -0,0 +1,269 @@
+// Package design provides for defining CouchDB design documents and Mango
+// indexes in Go, and deploying them idempotently.
+//
+//	set := &design.Set{
+//	    Docs: []*design.Doc{
+//	        {
+//	            Name: "users",
+//	            Views: map[string]design.View{
+//	                "by_email": {Map: `function(doc) { emit(doc.email, null); }`},
+//	            },
+//	        },
+//	    },
+//	    Indexes: []design.Index{
+//	        {Name: "by-age", Definition: map[string]interface{}{"fields": []string{"age"}}},
+//	    },
+//	    Stage: true,
+//	}
+//	results, err := set.Sync(context.TODO(), db)
+//
+// After a deploy, Warm builds a design document's view indexes before they are
+// first queried.
+package design
+
+import (
+	"context"
+	"encoding/json"
+	"reflect"
+	"strings"
+
+	"github.com/flimzy/kivik"
+)
+
+const (
+	designPrefix  = "_design/"
+	stagingSuffix = "_staging"
+)
+
+// View is a map/reduce view.
+type View struct {
+	Map    string `json:"map"`
+	Reduce string `json:"reduce,omitempty"`
+}
+
+// Doc is a design document definition.
+type Doc struct {
+	// Name is the design document name, with or without the _design/ prefix.
+	Name string
+	// Language is the language of the design document's functions. If empty,
+	// the server default (normally javascript) is used.
+	Language string
+	Views    map[string]View
+	Filters  map[string]string
+	// ValidateDocUpdate is the validate_doc_update function.
+	ValidateDocUpdate string
+}
+
+// ID returns the design document's ID, including the _design/ prefix.
+func (d *Doc) ID() string {
+	return designPrefix + strings.TrimPrefix(d.Name, designPrefix)
+}
+
+// body returns the design document's content, exactly as it is expected to be
+// read back from the server.
+func (d *Doc) body() map[string]interface{} {
+	body := map[string]interface{}{}
+	if d.Language != "" {
+		body["language"] = d.Language
+	}
+	if len(d.Views) > 0 {
+		body["views"] = d.Views
+	}
+	if len(d.Filters) > 0 {
+		body["filters"] = d.Filters
+	}
+	if d.ValidateDocUpdate != "" {
+		body["validate_doc_update"] = d.ValidateDocUpdate
+	}
+	return body
+}
+
+// Index is a Mango index definition.
+type Index struct {
+	// DesignDoc is the design document in which the index is stored. If empty,
+	// one is generated by the server.
+	DesignDoc string
+	Name      string
+	// Definition is the index definition, as passed to kivik.DB.CreateIndex.
+	Definition interface{}
+}
+
+// Set is a collection of design documents and indexes, to be deployed to a
+// database together.
+type Set struct {
+	Docs    []*Doc
+	Indexes []Index
+	// Stage, if true, causes new or changed views to be built in a temporary
+	// staging design document before the live design document is updated.
+	// The live document then reuses the already-built view indexes, so queries
+	// against it are not blocked while the indexes are rebuilt. Staging
+	// requires that the driver support Query.
+	Stage bool
+}
+
+// Action is the action taken to synchronize a design document or index.
+type Action string
+
+// The actions that may be taken by Sync.
+const (
+	Created   Action = "created"
+	Updated   Action = "updated"
+	Unchanged Action = "unchanged"
+)
+
+// Result describes the outcome of synchronizing a single design document or
+// index.
+type Result struct {
+	// ID is the design document ID. It is empty for an index whose design
+	// document is generated by the server.
+	ID string
+	// Index is the index name, for index results.
+	Index  string
+	Action Action
+	// Rev is the new design document revision, for created or updated design
+	// documents.
+	Rev string
+}
+
+// Sync creates or updates each of the set's design documents and indexes
+// which differ from those in db. Design documents are compared by content,
+// so running Sync repeatedly for the same set is harmless. Indexes are
+// compared by design document and name only; to change the definition of an
+// existing index, give it a new name.
+func (s *Set) Sync(ctx context.Context, db *kivik.DB) ([]Result, error) {
+	results := make([]Result, 0, len(s.Docs)+len(s.Indexes))
+	for _, doc := range s.Docs {
+		result, err := s.syncDoc(ctx, db, doc)
+		if err != nil {
+			return results, err
+		}
+		results = append(results, result)
+	}
+	if len(s.Indexes) == 0 {
+		return results, nil
+	}
+	existing, err := db.GetIndexes(ctx)
+	if err != nil {
+		return results, err
+	}
+	for _, index := range s.Indexes {
+		result, err := syncIndex(ctx, db, index, existing)
+		if err != nil {
+			return results, err
+		}
+		results = append(results, result)
+	}
+	return results, nil
+}
+
+// currentDoc fetches the current version of the document docID, with the _id
+// and _rev fields removed. If the document does not exist, a nil map is
+// returned.
+func currentDoc(ctx context.Context, db *kivik.DB, docID string) (doc map[string]interface{}, rev string, err error) {
+	row, err := db.Get(ctx, docID)
+	if kivik.StatusCode(err) == kivik.StatusNotFound {
+		return nil, "", nil
+	}
+	if err != nil {
+		return nil, "", err
+	}
+	if err := row.ScanDoc(&doc); err != nil {
+		return nil, "", err
+	}
+	rev, _ = doc["_rev"].(string)
+	delete(doc, "_id")
+	delete(doc, "_rev")
+	return doc, rev, nil
+}
+
+// normalize converts i to the generic form produced by unmarshaling JSON, for
+// comparison.
+func normalize(i interface{}) (interface{}, error) {
+	body, err := json.Marshal(i)
+	if err != nil {
+		return nil, err
+	}
+	var x interface{}
+	err = json.Unmarshal(body, &x)
+	return x, err
+}
+
+func (s *Set) syncDoc(ctx context.Context, db *kivik.DB, doc *Doc) (Result, error) {
+	result := Result{ID: doc.ID()}
+	current, rev, err := currentDoc(ctx, db, result.ID)
+	if err != nil {
+		return result, err
+	}
+	body := doc.body()
+	if current != nil {
+		want, err := normalize(body)
+		if err != nil {
+			return result, err
+		}
+		if have, _ := normalize(current); reflect.DeepEqual(want, have) {
+			result.Action = Unchanged
+			return result, nil
+		}
+	}
+	if s.Stage && len(doc.Views) > 0 {
+		if err := stage(ctx, db, doc); err != nil {
+			return result, err
+		}
+	}
+	result.Action = Created
+	if rev != "" {
+		body["_rev"] = rev
+		result.Action = Updated
+	}
+	result.Rev, err = db.Put(ctx, result.ID, body)
+	return result, err
+}
+
+// stage builds the views of doc in a staging design document, which is then
+// deleted.
+func stage(ctx context.Context, db *kivik.DB, doc *Doc) (err error) {
+	stagingID := doc.ID() + stagingSuffix
+	body := doc.body()
+	// A staging document may be left behind by a previously interrupted run.
+	if _, oldRev, e := currentDoc(ctx, db, stagingID); e != nil {
+		return e
+	} else if oldRev != "" {
+		body["_rev"] = oldRev
+	}
+	rev, err := db.Put(ctx, stagingID, body)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if _, delErr := db.Delete(ctx, stagingID, rev); err == nil {
+			err = delErr
+		}
+	}()
+	for view := range doc.Views {
+		rows, err := db.Query(ctx, stagingID, view, kivik.Options{"limit": 0})
+		if err != nil {
+			return err
+		}
+		if err := rows.Close(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func syncIndex(ctx context.Context, db *kivik.DB, index Index, existing []kivik.Index) (Result, error) {
+	var ddoc string
+	if index.DesignDoc != "" {
+		ddoc = designPrefix + strings.TrimPrefix(index.DesignDoc, designPrefix)
+	}
+	result := Result{ID: ddoc, Index: index.Name}
+	for _, ex := range existing {
+		if ex.Name == index.Name && (ddoc == "" || ex.DesignDoc == ddoc) {
+			result.ID = ex.DesignDoc
+			result.Action = Unchanged
+			return result, nil
+		}
+	}
+	result.Action = Created
+	return result, db.CreateIndex(ctx, strings.TrimPrefix(ddoc, designPrefix), index.Name, index.Definition)
+}
@@ -0,0 +1,134 @@
+package design
+
+import (
+	"context"
+	"testing"
+
+	"github.com/flimzy/diff"
+	"github.com/flimzy/kivik"
+	_ "github.com/flimzy/kivik/driver/memory"
+)
+
+func newDB(t *testing.T) *kivik.DB {
+	client, err := kivik.New(context.Background(), "memory", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := client.CreateDB(context.Background(), "foo"); err != nil {
+		t.Fatal(err)
+	}
+	db, err := client.DB(context.Background(), "foo")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return db
+}
+
+func actions(results []Result) []string {
+	actions := make([]string, len(results))
+	for i, r := range results {
+		actions[i] = r.ID + ":" + string(r.Action)
+	}
+	return actions
+}
+
+func TestSync(t *testing.T) {
+	db := newDB(t)
+	set := &Set{
+		Docs: []*Doc{
+			{
+				Name: "users",
+				Views: map[string]View{
+					"by_email": {Map: "function(doc) { emit(doc.email, null); }"},
+				},
+			},
+			{
+				Name:              "_design/validation",
+				ValidateDocUpdate: "function(newDoc, oldDoc, userCtx) {}",
+			},
+		},
+	}
+	ctx := context.Background()
+	results, err := set.Sync(ctx, db)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []string{"_design/users:created", "_design/validation:created"}
+	if d := diff.Interface(expected, actions(results)); d != "" {
+		t.Errorf("First sync:\n%s", d)
+	}
+
+	results, err = set.Sync(ctx, db)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected = []string{"_design/users:unchanged", "_design/validation:unchanged"}
+	if d := diff.Interface(expected, actions(results)); d != "" {
+		t.Errorf("Repeated sync:\n%s", d)
+	}
+
+	set.Docs[0].Filters = map[string]string{"users": "function(doc, req) { return true; }"}
+	results, err = set.Sync(ctx, db)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected = []string{"_design/users:updated", "_design/validation:unchanged"}
+	if d := diff.Interface(expected, actions(results)); d != "" {
+		t.Errorf("Changed sync:\n%s", d)
+	}
+
+	row, err := db.Get(ctx, "_design/users")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var doc map[string]interface{}
+	if err := row.ScanDoc(&doc); err != nil {
+		t.Fatal(err)
+	}
+	delete(doc, "_rev")
+	expectedDoc := map[string]interface{}{
+		"_id": "_design/users",
+		"views": map[string]interface{}{
+			"by_email": map[string]interface{}{"map": "function(doc) { emit(doc.email, null); }"},
+		},
+		"filters": map[string]interface{}{"users": "function(doc, req) { return true; }"},
+	}
+	if d := diff.Interface(expectedDoc, doc); d != "" {
+		t.Error(d)
+	}
+}
+
+func TestSyncStageFailure(t *testing.T) {
+	db := newDB(t)
+	set := &Set{
+		Docs: []*Doc{
+			{
+				Name:  "users",
+				Views: map[string]View{"all": {Map: "function(doc) { emit(doc._id); }"}},
+			},
+		},
+		Stage: true,
+	}
+	ctx := context.Background()
+	// The memory driver does not yet support views, so staging must fail
+	// without touching the live design document.
+	_, err := set.Sync(ctx, db)
+	if status := kivik.StatusCode(err); status != kivik.StatusNotImplemented {
+		t.Errorf("Unexpected error: %v", err)
+	}
+	for _, docID := range []string{"_design/users", "_design/users_staging"} {
+		if _, err := db.Get(ctx, docID); kivik.StatusCode(err) != kivik.StatusNotFound {
+			t.Errorf("Expected %s not to exist, got: %v", docID, err)
+		}
+	}
+}
+
+func TestSyncIndexesUnsupported(t *testing.T) {
+	db := newDB(t)
+	set := &Set{
+		Indexes: []Index{{Name: "by-age", Definition: map[string]interface{}{"fields": []string{"age"}}}},
+	}
+	if _, err := set.Sync(context.Background(), db); kivik.StatusCode(err) != kivik.StatusNotImplemented {
+		t.Errorf("Unexpected error: %v", err)
+	}
+}
@@ -0,0 +1,133 @@
+package design
+
+import (
+	"context"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/flimzy/kivik"
+	"github.com/flimzy/kivik/errors"
+)
+
+// DefaultWarmInterval is the default interval between polls of the status of
+// the view index by Warm.
+const DefaultWarmInterval = time.Second
+
+// WarmOptions configures Warm.
+type WarmOptions struct {
+	// Interval is the interval between polls of the status of the view
+	// index. Defaults to DefaultWarmInterval.
+	Interval time.Duration
+	// Progress, if set, is called with each status of the view index polled.
+	Progress func(WarmProgress)
+}
+
+// WarmProgress reports the progress of Warm.
+type WarmProgress struct {
+	// ID is the design document ID.
+	ID string
+	// Views are the names of the design document's views, which were
+	// queried to start indexing.
+	Views []string
+	// TargetSeq is the update sequence of the database when warming began,
+	// which the index must reach. It is empty if the driver does not report
+	// update sequences.
+	TargetSeq kivik.SequenceID
+	// Info is the status of the view index.
+	Info *kivik.DesignInfo
+}
+
+// Warm builds the view index of the design document ddoc, which may or may
+// not be prefixed with '_design/', so that the first queries after a deploy
+// are not delayed by indexing. Each view is queried with limit=0 and
+// stale=update_after, which starts indexing without waiting for it, and the
+// status of the index is then polled with DesignInfo until it is no longer
+// being updated, and has reached the database's update sequence as of when
+// warming began. opts may be nil.
+//
+// If the driver does not support DesignInfo, each view is instead queried
+// with limit=0, which waits for indexing to complete.
+func Warm(ctx context.Context, db *kivik.DB, ddoc string, opts *WarmOptions) error {
+	if opts == nil {
+		opts = &WarmOptions{}
+	}
+	interval := opts.Interval
+	if interval <= 0 {
+		interval = DefaultWarmInterval
+	}
+	progress := WarmProgress{ID: designPrefix + strings.TrimPrefix(ddoc, designPrefix)}
+	doc, _, err := currentDoc(ctx, db, progress.ID)
+	if err != nil {
+		return err
+	}
+	if doc == nil {
+		return errors.Statusf(kivik.StatusNotFound, "design: %s not found", progress.ID)
+	}
+	views, _ := doc["views"].(map[string]interface{})
+	for view := range views {
+		progress.Views = append(progress.Views, view)
+	}
+	sort.Strings(progress.Views)
+	if len(progress.Views) == 0 {
+		return nil
+	}
+
+	info, err := db.DesignInfo(ctx, progress.ID)
+	if kivik.StatusCode(err) == kivik.StatusNotImplemented {
+		return queryViews(ctx, db, progress.ID, progress.Views, kivik.Options{"limit": 0})
+	}
+	if err != nil {
+		return err
+	}
+	seq, err := db.UpdateSeq(ctx)
+	if err != nil && kivik.StatusCode(err) != kivik.StatusNotImplemented {
+		return err
+	}
+	progress.TargetSeq = seq
+	if err := queryViews(ctx, db, progress.ID, progress.Views, kivik.Options{"limit": 0, "stale": "update_after"}); err != nil {
+		return err
+	}
+	for {
+		if info, err = db.DesignInfo(ctx, progress.ID); err != nil {
+			return err
+		}
+		progress.Info = info
+		if opts.Progress != nil {
+			opts.Progress(progress)
+		}
+		if warmed(info, progress.TargetSeq) {
+			return nil
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(interval):
+		}
+	}
+}
+
+// queryViews queries each of the views of the design document ddocID.
+func queryViews(ctx context.Context, db *kivik.DB, ddocID string, views []string, opts kivik.Options) error {
+	for _, view := range views {
+		rows, err := db.Query(ctx, ddocID, view, opts)
+		if err != nil {
+			return err
+		}
+		if err := rows.Close(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// warmed returns true if the index is not being updated, and has reached
+// target, if it is known and ordered.
+func warmed(info *kivik.DesignInfo, target kivik.SequenceID) bool {
+	if info.UpdaterRunning {
+		return false
+	}
+	have, okHave := info.UpdateSeq.Number()
+	want, okWant := target.Number()
+	return !okHave || !okWant || have >= want
+}
@@ -0,0 +1,130 @@
+package design
+
+import (
+	"context"
+	"io"
+	"testing"
+	"time"
+
+	"github.com/flimzy/diff"
+	"github.com/flimzy/kivik"
+	"github.com/flimzy/kivik/driver"
+)
+
+// warmDriver wraps the memory driver, with databases which record queries
+// and report a view index which is built after a number of polls.
+type warmDriver struct {
+	driver.Driver
+	db *warmDB
+}
+
+func (d *warmDriver) NewClient(ctx context.Context, dsn string) (driver.Client, error) {
+	c, err := d.Driver.NewClient(ctx, dsn)
+	return &warmClient{Client: c, db: d.db}, err
+}
+
+type warmClient struct {
+	driver.Client
+	db *warmDB
+}
+
+func (c *warmClient) DB(ctx context.Context, dbName string, opts map[string]interface{}) (driver.DB, error) {
+	db, err := c.Client.DB(ctx, dbName, opts)
+	c.db.DB = db
+	return c.db, err
+}
+
+type warmDB struct {
+	driver.DB
+	queries []string
+	polls   int
+	seq     int64
+}
+
+func (d *warmDB) Query(_ context.Context, ddoc, view string, opts map[string]interface{}) (driver.Rows, error) {
+	d.queries = append(d.queries, ddoc+"/"+view+" stale="+toString(opts["stale"]))
+	return &emptyRows{}, nil
+}
+
+func (d *warmDB) DesignInfo(_ context.Context, ddoc string) (*driver.DesignInfo, error) {
+	d.polls++
+	info := &driver.DesignInfo{Name: ddoc, UpdaterRunning: d.polls < 3}
+	if !info.UpdaterRunning {
+		info.UpdateSeq = "100"
+	}
+	return info, nil
+}
+
+func toString(i interface{}) string {
+	s, _ := i.(string)
+	return s
+}
+
+type emptyRows struct {
+	driver.Rows
+}
+
+func (r *emptyRows) Next(_ *driver.Row) error { return io.EOF }
+func (r *emptyRows) Close() error             { return nil }
+
+func TestWarm(t *testing.T) {
+	memory, _ := kivik.LookupDriver("memory")
+	ddb := &warmDB{}
+	client, err := kivik.NewClientFromDriver(context.Background(), &warmDriver{Driver: memory, db: ddb}, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+	if err = client.CreateDB(ctx, "foo"); err != nil {
+		t.Fatal(err)
+	}
+	db, err := client.DB(ctx, "foo")
+	if err != nil {
+		t.Fatal(err)
+	}
+	set := &Set{Docs: []*Doc{{
+		Name: "users",
+		Views: map[string]View{
+			"by_name":  {Map: "function(doc) { emit(doc.name, null); }"},
+			"by_email": {Map: "function(doc) { emit(doc.email, null); }"},
+		},
+	}}}
+	if _, err = set.Sync(ctx, db); err != nil {
+		t.Fatal(err)
+	}
+
+	if err = Warm(ctx, db, "missing", nil); kivik.StatusCode(err) != kivik.StatusNotFound {
+		t.Errorf("Expected not found for a missing design doc, got %v", err)
+	}
+
+	var updating []bool
+	err = Warm(ctx, db, "users", &WarmOptions{
+		Interval: time.Millisecond,
+		Progress: func(p WarmProgress) {
+			updating = append(updating, p.Info.UpdaterRunning)
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	expectedQueries := []string{"users/by_email stale=update_after", "users/by_name stale=update_after"}
+	if d := diff.Interface(expectedQueries, ddb.queries); d != "" {
+		t.Errorf("Unexpected queries:\n%s", d)
+	}
+	if d := diff.Interface([]bool{true, false}, updating); d != "" {
+		t.Errorf("Unexpected progress:\n%s", d)
+	}
+}
+
+func TestWarmWithoutDesignInfo(t *testing.T) {
+	db := newDB(t)
+	set := &Set{Docs: []*Doc{{Name: "users", Views: map[string]View{"by_name": {Map: "function(doc) {}"}}}}}
+	if _, err := set.Sync(context.Background(), db); err != nil {
+		t.Fatal(err)
+	}
+	// The memory driver supports neither DesignInfo nor Query, so warming
+	// falls back to a blocking query, which fails.
+	if err := Warm(context.Background(), db, "_design/users", nil); kivik.StatusCode(err) != kivik.StatusNotImplemented {
+		t.Errorf("Expected not implemented, got %v", err)
+	}
+}
@@ -0,0 +1,74 @@
+package kivik
+
+import (
+	"context"
+	"strings"
+
+	"github.com/flimzy/kivik/driver"
+	"github.com/flimzy/kivik/errors"
+)
+
+// DesignInfo is the status of a design document's view index.
+type DesignInfo struct {
+	// Name is the design document's name, without the _design/ prefix.
+	Name      string `json:"name"`
+	Language  string `json:"language"`
+	Signature string `json:"signature"`
+	// CompactRunning is true while the view index is being compacted.
+	CompactRunning bool `json:"compact_running"`
+	// UpdaterRunning is true while the view index is being updated.
+	UpdaterRunning bool `json:"updater_running"`
+	// WaitingClients is the number of clients waiting on the index to be
+	// updated.
+	WaitingClients int64      `json:"waiting_clients"`
+	WaitingCommit  bool       `json:"waiting_commit"`
+	UpdateSeq      SequenceID `json:"update_seq"`
+	PurgeSeq       SequenceID `json:"purge_seq"`
+	// DiskSize is the size of the view index on disk, in bytes.
+	DiskSize int64 `json:"disk_size"`
+	// ActiveSize is the size of the live data in the view index, in bytes.
+	ActiveSize int64 `json:"data_size"`
+	// ExternalSize is the size of the view index's data, before compression.
+	ExternalSize int64 `json:"-"`
+}
+
+// DesignInfo returns the status of the view index of the design document
+// ddoc, which may or may not be prefixed with '_design/'. An index is built
+// once UpdaterRunning is false and UpdateSeq has reached the database's
+// update sequence, so deployment tooling may poll DesignInfo, or Stats, to
+// wait for indexing to complete.
+//
+// See http://docs.couchdb.org/en/2.0.0/api/ddoc/common.html#db-design-design-doc-info
+func (db *DB) DesignInfo(ctx context.Context, ddoc string) (*DesignInfo, error) {
+	infoer, ok := db.driverDB.(driver.DesignInfoer)
+	if !ok {
+		return nil, errors.Status(StatusNotImplemented, "kivik: driver does not support design document info")
+	}
+	ctx, cancel := withTimeout(ctx, db.timeouts.Read)
+	defer cancel()
+	ddoc = strings.TrimPrefix(ddoc, "_design/")
+	result, err := db.invoke(ctx, &Operation{Name: "DesignInfo", DocID: "_design/" + ddoc}, func(ctx context.Context, _ *Operation) (interface{}, error) {
+		return infoer.DesignInfo(ctx, ddoc)
+	})
+	if err != nil {
+		return nil, err
+	}
+	info, ok := result.(*driver.DesignInfo)
+	if !ok {
+		return nil, unexpectedResult("DesignInfo", result)
+	}
+	return &DesignInfo{
+		Name:           info.Name,
+		Language:       info.Language,
+		Signature:      info.Signature,
+		CompactRunning: info.CompactRunning,
+		UpdaterRunning: info.UpdaterRunning,
+		WaitingClients: info.WaitingClients,
+		WaitingCommit:  info.WaitingCommit,
+		UpdateSeq:      SequenceID(info.UpdateSeq),
+		PurgeSeq:       SequenceID(info.PurgeSeq),
+		DiskSize:       info.DiskSize,
+		ActiveSize:     info.ActiveSize,
+		ExternalSize:   info.ExternalSize,
+	}, nil
+}
@@ -0,0 +1,43 @@
+package kivik
+
+import (
+	"context"
+	"testing"
+
+	"github.com/flimzy/diff"
+	"github.com/flimzy/kivik/driver"
+)
+
+type designInfoDB struct {
+	dummyDB
+	ddoc string
+}
+
+func (db *designInfoDB) DesignInfo(_ context.Context, ddoc string) (*driver.DesignInfo, error) {
+	db.ddoc = ddoc
+	return &driver.DesignInfo{Name: ddoc, UpdaterRunning: true, UpdateSeq: "12", DiskSize: 400}, nil
+}
+
+func TestDesignInfo(t *testing.T) {
+	t.Run("NotImplemented", func(t *testing.T) {
+		db := &DB{driverDB: &dummyDB{}}
+		if _, err := db.DesignInfo(context.Background(), "foo"); StatusCode(err) != StatusNotImplemented {
+			t.Errorf("Expected not implemented, got %v", err)
+		}
+	})
+	t.Run("Prefixed", func(t *testing.T) {
+		driverDB := &designInfoDB{}
+		db := &DB{driverDB: driverDB}
+		info, err := db.DesignInfo(context.Background(), "_design/foo")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if driverDB.ddoc != "foo" {
+			t.Errorf("Expected the _design/ prefix to be trimmed, got %s", driverDB.ddoc)
+		}
+		expected := &DesignInfo{Name: "foo", UpdaterRunning: true, UpdateSeq: "12", DiskSize: 400}
+		if d := diff.Interface(expected, info); d != "" {
+			t.Error(d)
+		}
+	})
+}
@@ -0,0 +1,264 @@
+// Package diff produces structured diffs of documents: between two revisions
+// of a document, or between the documents of the same ID in two databases,
+// which may be served by different drivers. A diff may be rendered by a
+// conflict resolution UI, or used to verify a migration.
+//
+//	d, err := diff.Databases(ctx, source, target, "bob")
+//	if err != nil {
+//	    return err
+//	}
+//	if !d.Equal() {
+//	    out, _ := json.Marshal(d)
+//	    fmt.Printf("%s\n", out)
+//	}
+//
+// Each change is identified by the JSON Pointer (RFC 6901) of the field which
+// differs. Objects are compared field by field, and arrays element by
+// element, so that appending to an array adds only its new elements. The _rev
+// field is not compared, as it differs between any two revisions, and is
+// reported instead as the revisions of the diff.
+package diff
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/flimzy/kivik"
+	"github.com/flimzy/kivik/errors"
+)
+
+// Op is the kind of a Change.
+type Op string
+
+// The kinds of changes.
+const (
+	// OpAdd is a value present only in the new document.
+	OpAdd Op = "add"
+	// OpRemove is a value present only in the old document.
+	OpRemove Op = "remove"
+	// OpReplace is a value which differs between the documents.
+	OpReplace Op = "replace"
+)
+
+// Change is a single difference between two documents.
+type Change struct {
+	Op Op `json:"op"`
+	// Path is the JSON Pointer of the value which differs. It is empty for the
+	// whole document, as when it exists in only one database.
+	Path string `json:"path"`
+	// Old is the value in the old document, unless Op is OpAdd.
+	Old interface{} `json:"old,omitempty"`
+	// New is the value in the new document, unless Op is OpRemove.
+	New interface{} `json:"new,omitempty"`
+}
+
+// Diff is the difference between two versions of a document.
+type Diff struct {
+	// ID is the ID of the document.
+	ID string `json:"id"`
+	// OldRev and NewRev are the revisions compared. One is empty if the
+	// document was missing from its database.
+	OldRev string `json:"old_rev,omitempty"`
+	NewRev string `json:"new_rev,omitempty"`
+	// Changes lists the differences, in order of path.
+	Changes []Change `json:"changes"`
+}
+
+// Equal returns true if the documents compared have the same content, other
+// than their revisions.
+func (d *Diff) Equal() bool {
+	return len(d.Changes) == 0
+}
+
+// Revisions returns the diff between two revisions of the document docID in
+// db. An error of status kivik.StatusNotFound is returned if either revision
+// is missing, as when it has been compacted.
+func Revisions(ctx context.Context, db *kivik.DB, docID, oldRev, newRev string) (*Diff, error) {
+	oldDoc, err := get(ctx, db, docID, kivik.Options{"rev": oldRev})
+	if err != nil {
+		return nil, err
+	}
+	newDoc, err := get(ctx, db, docID, kivik.Options{"rev": newRev})
+	if err != nil {
+		return nil, err
+	}
+	return diffDocs(docID, oldDoc, newDoc), nil
+}
+
+// Databases returns the diff between the current revisions of the document
+// docID in oldDB and newDB. A document missing from one database is reported
+// as a single change of the whole document. An error of status
+// kivik.StatusNotFound is returned only if it is missing from both.
+func Databases(ctx context.Context, oldDB, newDB *kivik.DB, docID string) (*Diff, error) {
+	oldDoc, err := get(ctx, oldDB, docID)
+	if err != nil && kivik.StatusCode(err) != kivik.StatusNotFound {
+		return nil, err
+	}
+	newDoc, err := get(ctx, newDB, docID)
+	if err != nil && kivik.StatusCode(err) != kivik.StatusNotFound {
+		return nil, err
+	}
+	if oldDoc == nil && newDoc == nil {
+		return nil, errors.Statusf(kivik.StatusNotFound, "document %s not found in either database", docID)
+	}
+	return diffDocs(docID, oldDoc, newDoc), nil
+}
+
+// Docs returns the changes between two documents, which may be any values
+// which marshal to JSON objects, such as json.RawMessage, maps or structs.
+// The _rev fields are not compared.
+func Docs(oldDoc, newDoc interface{}) ([]Change, error) {
+	a, err := decode(oldDoc)
+	if err != nil {
+		return nil, err
+	}
+	b, err := decode(newDoc)
+	if err != nil {
+		return nil, err
+	}
+	return diffDocs("", a, b).Changes, nil
+}
+
+// get fetches and decodes a document, returning a nil map and the error if it
+// cannot be fetched.
+func get(ctx context.Context, db *kivik.DB, docID string, options ...kivik.Options) (map[string]interface{}, error) {
+	row, err := db.Get(ctx, docID, options...)
+	if err != nil {
+		return nil, err
+	}
+	var raw json.RawMessage
+	if err := row.ScanDoc(&raw); err != nil {
+		return nil, err
+	}
+	return decode(raw)
+}
+
+// decode converts doc to a map, keeping numbers as json.Number, so that they
+// are compared without loss of precision.
+func decode(doc interface{}) (map[string]interface{}, error) {
+	raw, ok := doc.(json.RawMessage)
+	if !ok {
+		var err error
+		if raw, err = json.Marshal(doc); err != nil {
+			return nil, errors.WrapStatus(kivik.StatusBadRequest, err)
+		}
+	}
+	dec := json.NewDecoder(bytes.NewReader(raw))
+	dec.UseNumber()
+	var result map[string]interface{}
+	if err := dec.Decode(&result); err != nil {
+		return nil, errors.WrapStatus(kivik.StatusBadResponse, err)
+	}
+	return result, nil
+}
+
+func diffDocs(docID string, a, b map[string]interface{}) *Diff {
+	d := &Diff{ID: docID, Changes: []Change{}}
+	d.OldRev, _ = a["_rev"].(string)
+	d.NewRev, _ = b["_rev"].(string)
+	switch {
+	case a == nil:
+		d.Changes = append(d.Changes, Change{Op: OpAdd, New: withoutRev(b)})
+	case b == nil:
+		d.Changes = append(d.Changes, Change{Op: OpRemove, Old: withoutRev(a)})
+	default:
+		d.Changes = diffValues(d.Changes, "", withoutRev(a), withoutRev(b))
+	}
+	return d
+}
+
+func withoutRev(doc map[string]interface{}) map[string]interface{} {
+	result := make(map[string]interface{}, len(doc))
+	for k, v := range doc {
+		if k != "_rev" {
+			result[k] = v
+		}
+	}
+	return result
+}
+
+func diffValues(changes []Change, path string, a, b interface{}) []Change {
+	switch o := a.(type) {
+	case map[string]interface{}:
+		if n, ok := b.(map[string]interface{}); ok {
+			return diffObjects(changes, path, o, n)
+		}
+	case []interface{}:
+		if n, ok := b.([]interface{}); ok {
+			return diffArrays(changes, path, o, n)
+		}
+	case json.Number:
+		if n, ok := b.(json.Number); ok && numbersEqual(o, n) {
+			return changes
+		}
+	default:
+		if a == b {
+			return changes
+		}
+	}
+	return append(changes, Change{Op: OpReplace, Path: path, Old: a, New: b})
+}
+
+func diffObjects(changes []Change, path string, a, b map[string]interface{}) []Change {
+	keys := make([]string, 0, len(a)+len(b))
+	for k := range a {
+		keys = append(keys, k)
+	}
+	for k := range b {
+		if _, ok := a[k]; !ok {
+			keys = append(keys, k)
+		}
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		p := path + "/" + escape(k)
+		o, inOld := a[k]
+		n, inNew := b[k]
+		switch {
+		case !inOld:
+			changes = append(changes, Change{Op: OpAdd, Path: p, New: n})
+		case !inNew:
+			changes = append(changes, Change{Op: OpRemove, Path: p, Old: o})
+		default:
+			changes = diffValues(changes, p, o, n)
+		}
+	}
+	return changes
+}
+
+func diffArrays(changes []Change, path string, a, b []interface{}) []Change {
+	for i := 0; i < len(a) || i < len(b); i++ {
+		p := path + "/" + strconv.Itoa(i)
+		switch {
+		case i >= len(a):
+			changes = append(changes, Change{Op: OpAdd, Path: p, New: b[i]})
+		case i >= len(b):
+			changes = append(changes, Change{Op: OpRemove, Path: p, Old: a[i]})
+		default:
+			changes = diffValues(changes, p, a[i], b[i])
+		}
+	}
+	return changes
+}
+
+// numbersEqual returns true if a and b are the same number, even if formatted
+// differently, as 1 and 1.0.
+func numbersEqual(a, b json.Number) bool {
+	if a == b {
+		return true
+	}
+	x, errA := a.Float64()
+	y, errB := b.Float64()
+	return errA == nil && errB == nil && x == y
+}
+
+var pointerEscaper = strings.NewReplacer("~", "~0", "/", "~1")
+
+// escape escapes a key for a JSON Pointer.
+func escape(key string) string {
+	return pointerEscaper.Replace(key)
+}
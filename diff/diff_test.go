@@ -0,0 +1,186 @@
+package diff
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+
+	"github.com/flimzy/diff"
+	"github.com/flimzy/kivik"
+	_ "github.com/flimzy/kivik/driver/memory"
+)
+
+func TestDocs(t *testing.T) {
+	tests := []struct {
+		name     string
+		old, new interface{}
+		expected []Change
+		err      string
+	}{
+		{
+			name:     "Identical",
+			old:      map[string]interface{}{"_id": "foo", "_rev": "1-a", "n": 1},
+			new:      json.RawMessage(`{"_id":"foo","_rev":"2-b","n":1.0}`),
+			expected: []Change{},
+		},
+		{
+			name: "Fields",
+			old:  json.RawMessage(`{"_id":"foo","name":"bob","age":30,"a/b":1}`),
+			new:  json.RawMessage(`{"_id":"foo","name":"alice","email":"alice@example.com","a/b":1}`),
+			expected: []Change{
+				{Op: OpRemove, Path: "/age", Old: json.Number("30")},
+				{Op: OpAdd, Path: "/email", New: "alice@example.com"},
+				{Op: OpReplace, Path: "/name", Old: "bob", New: "alice"},
+			},
+		},
+		{
+			name: "Nested",
+			old:  json.RawMessage(`{"address":{"city":"Oslo","zip":"0150"},"tags":["a","b"],"a~b":{"c/d":true}}`),
+			new:  json.RawMessage(`{"address":{"city":"Bergen","zip":"0150"},"tags":["a","c","d"],"a~b":{"c/d":false}}`),
+			expected: []Change{
+				{Op: OpReplace, Path: "/address/city", Old: "Oslo", New: "Bergen"},
+				{Op: OpReplace, Path: "/a~0b/c~1d", Old: true, New: false},
+				{Op: OpReplace, Path: "/tags/1", Old: "b", New: "c"},
+				{Op: OpAdd, Path: "/tags/2", New: "d"},
+			},
+		},
+		{
+			name: "TypeChange",
+			old:  json.RawMessage(`{"value":{"x":1}}`),
+			new:  json.RawMessage(`{"value":[1]}`),
+			expected: []Change{
+				{Op: OpReplace, Path: "/value", Old: map[string]interface{}{"x": json.Number("1")}, New: []interface{}{json.Number("1")}},
+			},
+		},
+		{
+			name: "InvalidJSON",
+			old:  json.RawMessage(`{`),
+			new:  json.RawMessage(`{}`),
+			err:  "unexpected EOF",
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			changes, err := Docs(test.old, test.new)
+			var msg string
+			if err != nil {
+				msg = err.Error()
+			}
+			if msg != test.err {
+				t.Errorf("Unexpected error: %s", msg)
+			}
+			if err != nil {
+				return
+			}
+			if d := diff.Interface(test.expected, changes); d != "" {
+				t.Error(d)
+			}
+		})
+	}
+}
+
+func newDB(t *testing.T, client *kivik.Client, name string) *kivik.DB {
+	if err := client.CreateDB(context.Background(), name); err != nil {
+		t.Fatal(err)
+	}
+	db, err := client.DB(context.Background(), name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return db
+}
+
+func TestRevisions(t *testing.T) {
+	ctx := context.Background()
+	client, err := kivik.New(ctx, "memory", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	db := newDB(t, client, "revisions")
+	rev1, err := db.Put(ctx, "bob", map[string]interface{}{"name": "Bob", "age": 30})
+	if err != nil {
+		t.Fatal(err)
+	}
+	rev2, err := db.Put(ctx, "bob", map[string]interface{}{"_rev": rev1, "name": "Bob", "age": 31})
+	if err != nil {
+		t.Fatal(err)
+	}
+	d, err := Revisions(ctx, db, "bob", rev1, rev2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := &Diff{
+		ID:      "bob",
+		OldRev:  rev1,
+		NewRev:  rev2,
+		Changes: []Change{{Op: OpReplace, Path: "/age", Old: json.Number("30"), New: json.Number("31")}},
+	}
+	if d := diff.Interface(expected, d); d != "" {
+		t.Error(d)
+	}
+	if _, err := Revisions(ctx, db, "bob", rev1, "9-missing"); kivik.StatusCode(err) != kivik.StatusNotFound {
+		t.Errorf("Expected not found for a missing revision, got %v", err)
+	}
+}
+
+func TestDatabases(t *testing.T) {
+	ctx := context.Background()
+	client, err := kivik.New(ctx, "memory", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	source := newDB(t, client, "source")
+	target := newDB(t, client, "target")
+	for _, db := range []*kivik.DB{source, target} {
+		if _, err := db.Put(ctx, "same", map[string]interface{}{"value": 1}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, err := source.Put(ctx, "changed", map[string]interface{}{"value": 1}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := target.Put(ctx, "changed", map[string]interface{}{"value": 2}); err != nil {
+		t.Fatal(err)
+	}
+	sourceRev, err := source.Put(ctx, "missing", map[string]interface{}{"value": 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	d, err := Databases(ctx, source, target, "same")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !d.Equal() {
+		t.Errorf("Expected no changes, got %v", d.Changes)
+	}
+	d, err = Databases(ctx, source, target, "changed")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if d := diff.Interface([]Change{{Op: OpReplace, Path: "/value", Old: json.Number("1"), New: json.Number("2")}}, d.Changes); d != "" {
+		t.Error(d)
+	}
+	d, err = Databases(ctx, source, target, "missing")
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := &Diff{
+		ID:      "missing",
+		OldRev:  sourceRev,
+		Changes: []Change{{Op: OpRemove, Old: map[string]interface{}{"_id": "missing", "value": json.Number("1")}}},
+	}
+	if d := diff.Interface(expected, d); d != "" {
+		t.Error(d)
+	}
+	out, err := json.Marshal(d)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if d := diff.JSON([]byte(`{"id":"missing","old_rev":"`+sourceRev+`","changes":[{"op":"remove","path":"","old":{"_id":"missing","value":1}}]}`), out); d != "" {
+		t.Error(d)
+	}
+	if _, err := Databases(ctx, source, target, "nowhere"); kivik.StatusCode(err) != kivik.StatusNotFound {
+		t.Errorf("Expected not found, got %v", err)
+	}
+}
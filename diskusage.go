@@ -0,0 +1,48 @@
+package kivik
+
+import (
+	"context"
+
+	"github.com/flimzy/kivik/driver"
+	"github.com/flimzy/kivik/errors"
+)
+
+// DiskUsage reports the storage used by a client, and the storage available
+// to it.
+type DiskUsage struct {
+	// Usage is the number of bytes used.
+	Usage int64
+	// Quota is the number of bytes which may be used, or 0 if unknown.
+	Quota int64
+}
+
+// Available returns the number of bytes which may still be used, or -1 if the
+// quota is unknown.
+func (u *DiskUsage) Available() int64 {
+	if u.Quota == 0 {
+		return -1
+	}
+	if u.Usage > u.Quota {
+		return 0
+	}
+	return u.Quota - u.Usage
+}
+
+// DiskUsage returns the storage used by, and available to, the client, so that
+// offline-first applications, such as those storing data in a browser's
+// IndexedDB, can warn users before their quota is exhausted. An error with
+// status StatusNotImplemented is returned if the driver cannot tell.
+func (c *Client) DiskUsage(ctx context.Context) (*DiskUsage, error) {
+	usager, ok := c.driverClient.(driver.DiskUsager)
+	if !ok {
+		return nil, errors.Status(StatusNotImplemented, "kivik: driver does not support disk usage reporting")
+	}
+	usage, err := usager.DiskUsage(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return &DiskUsage{
+		Usage: usage.Usage,
+		Quota: usage.Quota,
+	}, nil
+}
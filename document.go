@@ -0,0 +1,215 @@
+package kivik
+
+import (
+	"encoding/json"
+	"reflect"
+	"strings"
+
+	"github.com/flimzy/kivik/errors"
+)
+
+// Document holds the special fields common to all CouchDB documents. It may be
+// embedded in a struct to provide them, without the need for struct tags:
+//
+//	type User struct {
+//	    kivik.Document
+//	    Name string `json:"name"`
+//	}
+type Document struct {
+	ID          string          `json:"_id,omitempty"`
+	Rev         string          `json:"_rev,omitempty"`
+	Deleted     bool            `json:"_deleted,omitempty"`
+	Attachments AttachmentStubs `json:"_attachments,omitempty"`
+}
+
+// AttachmentStub is an attachment entry, as found in a document's
+// _attachments field. For attachments fetched without their content, Stub is
+// true and Data is empty. To upload an inline attachment, set ContentType and
+// Data.
+type AttachmentStub struct {
+	ContentType string `json:"content_type"`
+	Digest      string `json:"digest,omitempty"`
+	Length      int64  `json:"length,omitempty"`
+	RevPos      int64  `json:"revpos,omitempty"`
+	Stub        bool   `json:"stub,omitempty"`
+	Data        []byte `json:"data,omitempty"`
+}
+
+// AttachmentStubs is a document's _attachments field, keyed by filename.
+type AttachmentStubs map[string]AttachmentStub
+
+// docFields maps the values of the `kivik` struct tag to the corresponding
+// CouchDB document fields.
+var docFields = map[string]string{
+	"id":          "_id",
+	"rev":         "_rev",
+	"deleted":     "_deleted",
+	"attachments": "_attachments",
+}
+
+// taggedField is a struct field with a `kivik` struct tag.
+type taggedField struct {
+	index   int
+	jsonKey string // The key used by encoding/json, or "" if none
+	docKey  string
+}
+
+// taggedFields returns the fields of the struct type t which have a `kivik`
+// struct tag.
+func taggedFields(t reflect.Type) ([]taggedField, error) {
+	var fields []taggedField
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		tag, ok := f.Tag.Lookup("kivik")
+		if !ok {
+			continue
+		}
+		docKey, ok := docFields[tag]
+		if !ok {
+			return nil, errors.Statusf(StatusBadRequest, "kivik: invalid struct tag '%s' on field %s", tag, f.Name)
+		}
+		if f.PkgPath != "" {
+			return nil, errors.Statusf(StatusBadRequest, "kivik: struct tag on unexported field %s", f.Name)
+		}
+		fields = append(fields, taggedField{index: i, jsonKey: jsonKey(f), docKey: docKey})
+	}
+	return fields, nil
+}
+
+// jsonKey returns the object key encoding/json uses for f, or "" if the field
+// is omitted.
+func jsonKey(f reflect.StructField) string {
+	name := strings.Split(f.Tag.Get("json"), ",")[0]
+	switch name {
+	case "-":
+		return ""
+	case "":
+		return f.Name
+	}
+	return name
+}
+
+// structValue returns the struct referenced by doc, or an invalid value if doc
+// is not a struct or a pointer to one.
+func structValue(doc interface{}) reflect.Value {
+	v := reflect.ValueOf(doc)
+	for v.Kind() == reflect.Ptr {
+		if v.IsNil() {
+			return reflect.Value{}
+		}
+		v = v.Elem()
+	}
+	if v.Kind() != reflect.Struct {
+		return reflect.Value{}
+	}
+	return v
+}
+
+func isEmptyValue(v reflect.Value) bool {
+	switch v.Kind() {
+	case reflect.Map, reflect.Slice, reflect.String:
+		return v.Len() == 0
+	case reflect.Bool:
+		return !v.Bool()
+	case reflect.Ptr, reflect.Interface:
+		return v.IsNil()
+	}
+	return false
+}
+
+// MarshalDocument returns the JSON encoding of doc, as a CouchDB document.
+// Fields of a struct tagged with `kivik:"id"`, `kivik:"rev"`,
+// `kivik:"deleted"` or `kivik:"attachments"` are marshaled as the _id, _rev,
+// _deleted and _attachments fields respectively, and are omitted when empty:
+//
+//	type User struct {
+//	    ID   string `json:"-" kivik:"id"`
+//	    Rev  string `json:"-" kivik:"rev"`
+//	    Name string `json:"name"`
+//	}
+//
+// Only the top-level fields of doc are inspected for tags. Other values are
+// marshaled with the JSONCodec. Put and CreateDoc marshal tagged structs with
+// MarshalDocument automatically.
+func MarshalDocument(doc interface{}) ([]byte, error) {
+	v := structValue(doc)
+	if !v.IsValid() {
+		return JSON().Marshal(doc)
+	}
+	fields, err := taggedFields(v.Type())
+	if err != nil {
+		return nil, err
+	}
+	body, err := JSON().Marshal(doc)
+	if err != nil || len(fields) == 0 {
+		return body, err
+	}
+	var obj map[string]json.RawMessage
+	if err := JSON().Unmarshal(body, &obj); err != nil {
+		return nil, errors.Wrap(err, "kivik: document must marshal to a JSON object")
+	}
+	for _, f := range fields {
+		if f.jsonKey != "" {
+			delete(obj, f.jsonKey)
+		}
+		fv := v.Field(f.index)
+		if isEmptyValue(fv) {
+			continue
+		}
+		value, err := JSON().Marshal(fv.Interface())
+		if err != nil {
+			return nil, err
+		}
+		obj[f.docKey] = value
+	}
+	return JSON().Marshal(obj)
+}
+
+// UnmarshalDocument parses the JSON-encoded CouchDB document data into doc. The
+// _id, _rev, _deleted and _attachments fields are stored in the correspondingly
+// tagged fields of doc, as described for MarshalDocument. ScanDoc uses
+// UnmarshalDocument, so tagged structs may be scanned directly.
+func UnmarshalDocument(data []byte, doc interface{}) error {
+	if err := JSON().Unmarshal(data, doc); err != nil {
+		return err
+	}
+	v := structValue(doc)
+	if !v.IsValid() {
+		return nil
+	}
+	fields, err := taggedFields(v.Type())
+	if err != nil || len(fields) == 0 {
+		return err
+	}
+	var obj map[string]json.RawMessage
+	if err := JSON().Unmarshal(data, &obj); err != nil {
+		return err
+	}
+	for _, f := range fields {
+		value, ok := obj[f.docKey]
+		if !ok {
+			continue
+		}
+		if err := JSON().Unmarshal(value, v.Field(f.index).Addr().Interface()); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// marshalTagged returns doc marshaled with MarshalDocument, if it is a struct
+// with `kivik` struct tags, or doc unaltered otherwise.
+func marshalTagged(doc interface{}) (interface{}, error) {
+	v := structValue(doc)
+	if !v.IsValid() {
+		return doc, nil
+	}
+	if fields, err := taggedFields(v.Type()); err != nil || len(fields) == 0 {
+		return doc, err
+	}
+	body, err := MarshalDocument(doc)
+	if err != nil {
+		return nil, err
+	}
+	return json.RawMessage(body), nil
+}
@@ -0,0 +1,162 @@
+package kivik
+
+import (
+	"testing"
+
+	"github.com/flimzy/diff"
+)
+
+type taggedDoc struct {
+	ID          string          `json:"id" kivik:"id"`
+	Rev         string          `json:"-" kivik:"rev"`
+	Deleted     bool            `json:"-" kivik:"deleted"`
+	Attachments AttachmentStubs `json:"-" kivik:"attachments"`
+	Name        string          `json:"name"`
+}
+
+type embeddedDoc struct {
+	Document
+	Name string `json:"name"`
+}
+
+func TestMarshalDocument(t *testing.T) {
+	tests := []struct {
+		name     string
+		doc      interface{}
+		expected string
+		err      string
+	}{
+		{
+			name:     "Map",
+			doc:      map[string]string{"_id": "foo"},
+			expected: `{"_id":"foo"}`,
+		},
+		{
+			name:     "UntaggedStruct",
+			doc:      struct{ Name string }{Name: "Bob"},
+			expected: `{"Name":"Bob"}`,
+		},
+		{
+			name:     "Tagged",
+			doc:      &taggedDoc{ID: "foo", Rev: "1-xxx", Name: "Bob"},
+			expected: `{"_id":"foo","_rev":"1-xxx","name":"Bob"}`,
+		},
+		{
+			name:     "EmptyTags",
+			doc:      taggedDoc{Name: "Bob"},
+			expected: `{"name":"Bob"}`,
+		},
+		{
+			name: "DeletedWithAttachments",
+			doc: taggedDoc{ID: "foo", Deleted: true, Attachments: AttachmentStubs{
+				"foo.txt": {ContentType: "text/plain", Data: []byte("Test")},
+			}},
+			expected: `{"_attachments":{"foo.txt":{"content_type":"text/plain","data":"VGVzdA=="}},"_deleted":true,"_id":"foo","name":""}`,
+		},
+		{
+			name:     "Embedded",
+			doc:      embeddedDoc{Document: Document{ID: "foo", Rev: "1-xxx"}, Name: "Bob"},
+			expected: `{"_id":"foo","_rev":"1-xxx","name":"Bob"}`,
+		},
+		{
+			name: "InvalidTag",
+			doc: struct {
+				ID string `kivik:"_id"`
+			}{},
+			err: "kivik: invalid struct tag '_id' on field ID",
+		},
+		{
+			name: "UnexportedTaggedField",
+			doc: struct {
+				id string `kivik:"id"`
+			}{},
+			err: "kivik: struct tag on unexported field id",
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			result, err := MarshalDocument(test.doc)
+			var msg string
+			if err != nil {
+				msg = err.Error()
+			}
+			if msg != test.err {
+				t.Errorf("Unexpected error: %s", msg)
+			}
+			if err != nil {
+				return
+			}
+			if d := diff.JSON([]byte(test.expected), result); d != "" {
+				t.Error(d)
+			}
+		})
+	}
+}
+
+func TestUnmarshalDocument(t *testing.T) {
+	tests := []struct {
+		name     string
+		data     string
+		doc      interface{}
+		expected interface{}
+		err      string
+	}{
+		{
+			name:     "Map",
+			data:     `{"_id":"foo"}`,
+			doc:      &map[string]string{},
+			expected: &map[string]string{"_id": "foo"},
+		},
+		{
+			name: "Tagged",
+			data: `{"_id":"foo","_rev":"1-xxx","_deleted":true,"name":"Bob",
+				"_attachments":{"foo.txt":{"content_type":"text/plain","digest":"md5-xxx","length":4,"revpos":1,"stub":true}}}`,
+			doc: &taggedDoc{},
+			expected: &taggedDoc{
+				ID:      "foo",
+				Rev:     "1-xxx",
+				Deleted: true,
+				Name:    "Bob",
+				Attachments: AttachmentStubs{
+					"foo.txt": {ContentType: "text/plain", Digest: "md5-xxx", Length: 4, RevPos: 1, Stub: true},
+				},
+			},
+		},
+		{
+			name:     "Embedded",
+			data:     `{"_id":"foo","_rev":"1-xxx","name":"Bob"}`,
+			doc:      &embeddedDoc{},
+			expected: &embeddedDoc{Document: Document{ID: "foo", Rev: "1-xxx"}, Name: "Bob"},
+		},
+		{
+			name: "WrongType",
+			data: `{"_id":123}`,
+			doc:  &taggedDoc{},
+			err:  "json: cannot unmarshal number into Go value of type string",
+		},
+		{
+			name: "InvalidJSON",
+			data: `{"_id":`,
+			doc:  &taggedDoc{},
+			err:  "unexpected end of JSON input",
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			err := UnmarshalDocument([]byte(test.data), test.doc)
+			var msg string
+			if err != nil {
+				msg = err.Error()
+			}
+			if msg != test.err {
+				t.Errorf("Unexpected error: %s", msg)
+			}
+			if err != nil {
+				return
+			}
+			if d := diff.Interface(test.expected, test.doc); d != "" {
+				t.Error(d)
+			}
+		})
+	}
+}
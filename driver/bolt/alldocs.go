@@ -0,0 +1,146 @@
+package bolt
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"strconv"
+
+	bbolt "github.com/coreos/bbolt"
+
+	"github.com/flimzy/kivik"
+	"github.com/flimzy/kivik/driver"
+	"github.com/flimzy/kivik/driver/internal/docstore"
+	"github.com/flimzy/kivik/errors"
+)
+
+// AllDocs returns the current revisions of the undeleted documents, in order
+// of document ID, or those named by the keys option, in the order given.
+func (d *db) AllDocs(ctx context.Context, options map[string]interface{}) (driver.Rows, error) {
+	opts, err := docstore.ParseAllDocsOptions(options)
+	if err != nil {
+		return nil, err
+	}
+	limit := -1
+	if _, ok := options["limit"]; ok {
+		limit = opts.Limit
+	}
+	var result []*driver.Row
+	var offset, totalRows int64
+	var updateSeq string
+	err = d.view(ctx, func(tx *bbolt.Tx) error {
+		if opts.UpdateSeq {
+			seq, err := d.updateSeq(tx)
+			if err != nil {
+				return err
+			}
+			updateSeq = strconv.FormatUint(seq, 10)
+		}
+		docs, err := d.bucket(tx, docsBucket)
+		if err != nil {
+			return err
+		}
+		// The first pass counts the documents, and those which precede the
+		// start key, in the requested order.
+		err = docs.ForEach(func(k, v []byte) error {
+			record := &docRecord{}
+			if err := json.Unmarshal(v, record); err != nil {
+				return errors.WrapStatus(kivik.StatusInternalServerError, err)
+			}
+			if record.Deleted {
+				return nil
+			}
+			totalRows++
+			if opts.StartKey != nil && opts.Keys == nil {
+				cmp := bytes.Compare(k, []byte(*opts.StartKey))
+				if !opts.Descending && cmp < 0 || opts.Descending && cmp > 0 {
+					offset++
+				}
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+		if opts.Keys != nil {
+			result, err = docstore.KeyRows(d.store(tx), opts)
+			return err
+		}
+		offset += int64(opts.Skip)
+		result, err = d.allDocsRange(tx, opts, limit)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return docstore.NewRows(result, offset, totalRows, updateSeq), nil
+}
+
+// allDocsRange scans the docs bucket from the start key to the end key.
+func (d *db) allDocsRange(tx *bbolt.Tx, opts *docstore.AllDocsOptions, limit int) ([]*driver.Row, error) {
+	c := tx.Bucket(d.dbName).Bucket(docsBucket).Cursor()
+	var k, v []byte
+	next := c.Next
+	switch {
+	case opts.Descending && opts.StartKey != nil:
+		if k, v = c.Seek([]byte(*opts.StartKey)); k == nil {
+			k, v = c.Last()
+		} else if bytes.Compare(k, []byte(*opts.StartKey)) > 0 {
+			k, v = c.Prev()
+		}
+		next = c.Prev
+	case opts.Descending:
+		k, v = c.Last()
+		next = c.Prev
+	case opts.StartKey != nil:
+		k, v = c.Seek([]byte(*opts.StartKey))
+	default:
+		k, v = c.First()
+	}
+	pastEnd := func(k []byte) bool {
+		if opts.EndKey == nil {
+			return false
+		}
+		cmp := bytes.Compare(k, []byte(*opts.EndKey))
+		if opts.Descending {
+			cmp = -cmp
+		}
+		return cmp > 0 || cmp == 0 && !opts.InclusiveEnd
+	}
+	var result []*driver.Row
+	skip := opts.Skip
+	for ; k != nil && !pastEnd(k); k, v = next() {
+		if limit >= 0 && len(result) >= limit {
+			break
+		}
+		record := &docRecord{}
+		if err := json.Unmarshal(v, record); err != nil {
+			return nil, errors.WrapStatus(kivik.StatusInternalServerError, err)
+		}
+		if record.Deleted {
+			continue
+		}
+		if skip > 0 {
+			skip--
+			continue
+		}
+		row, err := d.allDocsRow(tx, string(k), record, opts.IncludeDocs)
+		if err != nil {
+			return nil, err
+		}
+		result = append(result, row)
+	}
+	return result, nil
+}
+
+func (d *db) allDocsRow(tx *bbolt.Tx, id string, record *docRecord, includeDoc bool) (*driver.Row, error) {
+	row := docstore.AllDocsRow(id, record.Rev, record.Deleted, nil)
+	if includeDoc {
+		rev, err := d.revision(tx, id, record.Rev)
+		if err != nil {
+			return nil, err
+		}
+		row.Doc = rev.Body
+	}
+	return row, nil
+}
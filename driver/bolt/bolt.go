@@ -0,0 +1,184 @@
+// Package bolt provides a pure-Go, embedded Kivik driver, which stores its
+// databases in a single bbolt (BoltDB) file. It allows the serve package to be
+// deployed as a single binary with durable storage.
+//
+//	import _ "github.com/flimzy/kivik/driver/bolt"
+//
+//	client, err := kivik.New(ctx, "bolt", "/path/to/kivik.db")
+//
+// Each database is a top-level bucket, holding nested buckets for the current
+// revision of each document, the full revision history, the sequence index
+// which backs the changes feed, local documents and attachments. Views, Mango
+// queries and continuous changes feeds are not supported.
+//
+// A bbolt file may be open by only one process at a time. NewClient waits up
+// to OpenTimeout for another process to release it.
+package bolt
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+	"time"
+
+	bbolt "github.com/coreos/bbolt"
+
+	"github.com/flimzy/kivik"
+	"github.com/flimzy/kivik/driver"
+	"github.com/flimzy/kivik/driver/common"
+	"github.com/flimzy/kivik/errors"
+)
+
+// Identifying constants
+const (
+	Version = "0.0.1"
+	Vendor  = "Kivik Bolt Adaptor"
+)
+
+// OpenTimeout is the time NewClient waits to obtain the file lock.
+var OpenTimeout = time.Second
+
+type boltDriver struct{}
+
+var _ driver.Driver = &boltDriver{}
+
+func init() {
+	kivik.Register("bolt", &boltDriver{})
+}
+
+// Names of the buckets nested within each database bucket.
+var (
+	docsBucket  = []byte("docs")
+	revsBucket  = []byte("revs")
+	seqsBucket  = []byte("seqs")
+	localBucket = []byte("local")
+	attsBucket  = []byte("attachments")
+	metaBucket  = []byte("meta")
+)
+
+var (
+	dbBuckets   = [][]byte{docsBucket, revsBucket, seqsBucket, localBucket, attsBucket, metaBucket}
+	securityKey = []byte("security")
+)
+
+func (d *boltDriver) NewClient(_ context.Context, path string) (driver.Client, error) {
+	boltDB, err := bbolt.Open(path, 0600, &bbolt.Options{Timeout: OpenTimeout})
+	if err != nil {
+		return nil, errors.Wrap(err, "kivik: failed to open bolt database")
+	}
+	return &client{
+		Client: common.NewClient(Version, Vendor),
+		db:     boltDB,
+	}, nil
+}
+
+type client struct {
+	*common.Client
+	db *bbolt.DB
+}
+
+var _ driver.Client = &client{}
+
+func (c *client) AllDBs(ctx context.Context, _ map[string]interface{}) ([]string, error) {
+	dbs := []string{}
+	err := c.view(ctx, func(tx *bbolt.Tx) error {
+		return tx.ForEach(func(name []byte, _ *bbolt.Bucket) error {
+			dbs = append(dbs, string(name))
+			return nil
+		})
+	})
+	return dbs, err
+}
+
+func (c *client) DBExists(ctx context.Context, dbName string, _ map[string]interface{}) (bool, error) {
+	var exists bool
+	err := c.view(ctx, func(tx *bbolt.Tx) error {
+		exists = tx.Bucket([]byte(dbName)) != nil
+		return nil
+	})
+	return exists, err
+}
+
+func (c *client) CreateDB(ctx context.Context, dbName string, _ map[string]interface{}) error {
+	if !kivik.ValidDBName(dbName) {
+		return errors.NamedStatus(kivik.StatusBadRequest, "illegal_database_name", "invalid database name")
+	}
+	return c.update(ctx, func(tx *bbolt.Tx) error {
+		b, err := tx.CreateBucket([]byte(dbName))
+		if err == bbolt.ErrBucketExists {
+			return errors.Status(kivik.StatusPreconditionFailed, "database exists")
+		}
+		if err != nil {
+			return boltError(err)
+		}
+		for _, name := range dbBuckets {
+			if _, err := b.CreateBucket(name); err != nil {
+				return boltError(err)
+			}
+		}
+		sec, _ := json.Marshal(&driver.Security{})
+		return boltError(b.Bucket(metaBucket).Put(securityKey, sec))
+	})
+}
+
+func (c *client) DestroyDB(ctx context.Context, dbName string, _ map[string]interface{}) error {
+	return c.update(ctx, func(tx *bbolt.Tx) error {
+		err := tx.DeleteBucket([]byte(dbName))
+		if err == bbolt.ErrBucketNotFound {
+			return errors.Status(kivik.StatusNotFound, "database does not exist")
+		}
+		return boltError(err)
+	})
+}
+
+func (c *client) DB(ctx context.Context, dbName string, _ map[string]interface{}) (driver.DB, error) {
+	exists, err := c.DBExists(ctx, dbName, nil)
+	if err != nil {
+		return nil, err
+	}
+	if !exists {
+		return nil, errors.Status(kivik.StatusNotFound, "database does not exist")
+	}
+	return &db{
+		client: c,
+		dbName: []byte(dbName),
+	}, nil
+}
+
+// view calls fn within a read-only transaction, unless ctx is already done.
+// bbolt transactions cannot be interrupted once begun.
+func (c *client) view(ctx context.Context, fn func(*bbolt.Tx) error) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	return c.db.View(fn)
+}
+
+// update calls fn within a read-write transaction, which is committed if fn
+// returns nil, and rolled back otherwise.
+func (c *client) update(ctx context.Context, fn func(*bbolt.Tx) error) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	return c.db.Update(fn)
+}
+
+// boltError converts an error returned by bbolt to a kivik error.
+func boltError(err error) error {
+	if err == nil {
+		return nil
+	}
+	return errors.WrapStatus(kivik.StatusInternalServerError, err)
+}
+
+// revKey returns the key of a revision of docID, in the revisions bucket, or,
+// with a filename, of its attachment, in the attachments bucket. Keys sort by
+// document, then revision, so the entries for a document are contiguous.
+func revKey(docID, rev string, filename ...string) []byte {
+	return []byte(strings.Join(append([]string{docID, rev}, filename...), "\x00"))
+}
+
+// splitKey splits a key returned by revKey into its parts.
+func splitKey(key []byte) []string {
+	return strings.Split(string(key), "\x00")
+}
@@ -0,0 +1,47 @@
+package bolt
+
+import (
+	"context"
+
+	bbolt "github.com/coreos/bbolt"
+
+	"github.com/flimzy/kivik"
+	"github.com/flimzy/kivik/driver"
+	"github.com/flimzy/kivik/driver/internal/docstore"
+	"github.com/flimzy/kivik/errors"
+)
+
+// BulkDocs writes all of docs in a single transaction. A document which fails,
+// for instance with a conflict, is reported in its result, and does not
+// prevent the others from being written.
+func (d *db) BulkDocs(ctx context.Context, docs []interface{}) (driver.BulkResults, error) {
+	results := make([]*driver.BulkResult, len(docs))
+	err := d.update(ctx, func(tx *bbolt.Tx) error {
+		for i, doc := range docs {
+			result := &driver.BulkResult{}
+			results[i] = result
+			couchDoc, err := docstore.ToDoc(doc)
+			if err != nil {
+				result.Error = err
+				continue
+			}
+			docID, err := docstore.DocID(couchDoc)
+			if err != nil {
+				return err
+			}
+			result.ID = docID
+			result.Rev, result.Error = docstore.Put(d.store(tx), docID, couchDoc)
+			// put validates the document before writing anything, so only a
+			// storage failure can leave a partial write, which aborts the
+			// transaction.
+			if errors.StatusCode(result.Error) == kivik.StatusInternalServerError {
+				return result.Error
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return docstore.NewBulkResults(results), nil
+}
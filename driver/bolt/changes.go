@@ -0,0 +1,75 @@
+package bolt
+
+import (
+	"context"
+	"encoding/json"
+	"strconv"
+
+	bbolt "github.com/coreos/bbolt"
+
+	"github.com/flimzy/kivik"
+	"github.com/flimzy/kivik/driver"
+	"github.com/flimzy/kivik/driver/internal/docstore"
+	"github.com/flimzy/kivik/errors"
+)
+
+// Changes returns the changes since the requested sequence, as a normal feed,
+// read from the sequence index of the seqs bucket. The since, limit, include_docs
+// and filter options are supported. Continuous feeds are not.
+func (d *db) Changes(ctx context.Context, opts map[string]interface{}) (driver.Changes, error) {
+	o, err := docstore.ParseChangesOptions("bolt", opts)
+	if err != nil {
+		return nil, err
+	}
+	var changes []*driver.Change
+	err = d.view(ctx, func(tx *bbolt.Tx) error {
+		if o.Since < 0 {
+			seq, err := d.updateSeq(tx)
+			if err != nil {
+				return err
+			}
+			o.Since = int64(seq)
+		}
+		seqs, err := d.bucket(tx, seqsBucket)
+		if err != nil {
+			return err
+		}
+		c := seqs.Cursor()
+		for k, v := c.Seek(seqKey(uint64(o.Since) + 1)); k != nil; k, v = c.Next() {
+			if o.Limit > 0 && len(changes) >= o.Limit {
+				break
+			}
+			id := string(v)
+			record, err := d.current(tx, id)
+			if err != nil {
+				return err
+			}
+			rev, err := d.revision(tx, id, record.Rev)
+			if err != nil {
+				return err
+			}
+			var doc map[string]interface{}
+			if err := json.Unmarshal(rev.Body, &doc); err != nil {
+				return errors.WrapStatus(kivik.StatusInternalServerError, err)
+			}
+			if !o.Filter.Match(id, doc) {
+				continue
+			}
+			change := &driver.Change{
+				ID:      id,
+				Seq:     driver.SequenceID(strconv.FormatUint(record.Seq, 10)),
+				Deleted: record.Deleted,
+				Changes: driver.ChangedRevs{record.Rev},
+			}
+			if o.IncludeDocs {
+				change.Doc = rev.Body
+			}
+			changes = append(changes, change)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return docstore.NewChanges(ctx, changes), nil
+}
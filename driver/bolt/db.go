@@ -0,0 +1,492 @@
+package bolt
+
+import (
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"strconv"
+	"strings"
+
+	bbolt "github.com/coreos/bbolt"
+
+	"github.com/flimzy/kivik"
+	"github.com/flimzy/kivik/driver"
+	"github.com/flimzy/kivik/driver/internal/docstore"
+	"github.com/flimzy/kivik/errors"
+)
+
+var notImplemented = errors.Status(kivik.StatusNotImplemented, "kivik: not supported by bolt driver")
+
+type db struct {
+	*client
+	dbName []byte
+}
+
+var _ driver.DB = &db{}
+var _ driver.Rever = &db{}
+
+// docRecord is the entry for a document in the docs bucket, which points to
+// its current revision.
+type docRecord struct {
+	Rev     string `json:"rev"`
+	Seq     uint64 `json:"seq"`
+	Deleted bool   `json:"deleted,omitempty"`
+}
+
+// revRecord is the entry for a revision in the revs bucket. Body is nil for
+// revisions removed by compaction.
+type revRecord struct {
+	Parent  string          `json:"parent,omitempty"`
+	Seq     uint64          `json:"seq"`
+	Deleted bool            `json:"deleted,omitempty"`
+	Body    json.RawMessage `json:"body,omitempty"`
+}
+
+// seqKey encodes a sequence number as a key of the seqs bucket, which sorts
+// in numeric order.
+func seqKey(seq uint64) []byte {
+	key := make([]byte, 8)
+	binary.BigEndian.PutUint64(key, seq)
+	return key
+}
+
+// bucket returns the named bucket within the database's bucket, which is
+// absent if the database has been destroyed since the db was obtained.
+func (d *db) bucket(tx *bbolt.Tx, name []byte) (*bbolt.Bucket, error) {
+	b := tx.Bucket(d.dbName)
+	if b == nil {
+		return nil, errors.Status(kivik.StatusNotFound, "database does not exist")
+	}
+	return b.Bucket(name), nil
+}
+
+func getRecord(b *bbolt.Bucket, key []byte, record interface{}) error {
+	value := b.Get(key)
+	if value == nil {
+		return errors.Status(kivik.StatusNotFound, "missing")
+	}
+	if err := json.Unmarshal(value, record); err != nil {
+		return errors.WrapStatus(kivik.StatusInternalServerError, err)
+	}
+	return nil
+}
+
+func putRecord(b *bbolt.Bucket, key []byte, record interface{}) error {
+	value, err := json.Marshal(record)
+	if err != nil {
+		return errors.WrapStatus(kivik.StatusInternalServerError, err)
+	}
+	return boltError(b.Put(key, value))
+}
+
+// current returns the docs bucket entry for docID, within tx.
+func (d *db) current(tx *bbolt.Tx, docID string) (*docRecord, error) {
+	docs, err := d.bucket(tx, docsBucket)
+	if err != nil {
+		return nil, err
+	}
+	record := &docRecord{}
+	return record, getRecord(docs, []byte(docID), record)
+}
+
+// revision returns the revs bucket entry for rev of docID, within tx.
+func (d *db) revision(tx *bbolt.Tx, docID, rev string) (*revRecord, error) {
+	revs, err := d.bucket(tx, revsBucket)
+	if err != nil {
+		return nil, err
+	}
+	record := &revRecord{}
+	return record, getRecord(revs, revKey(docID, rev), record)
+}
+
+func (d *db) Get(ctx context.Context, docID string, opts map[string]interface{}) (json.RawMessage, error) {
+	var body json.RawMessage
+	err := d.view(ctx, func(tx *bbolt.Tx) error {
+		if strings.HasPrefix(docID, docstore.LocalPrefix) {
+			local, err := d.bucket(tx, localBucket)
+			if err != nil {
+				return err
+			}
+			if body = local.Get([]byte(docID)); body == nil {
+				return errors.Status(kivik.StatusNotFound, "missing")
+			}
+			body = append(json.RawMessage{}, body...)
+			return nil
+		}
+		rev, _ := opts["rev"].(string)
+		if rev == "" {
+			doc, err := d.current(tx, docID)
+			if err != nil {
+				return err
+			}
+			if doc.Deleted {
+				return errors.Status(kivik.StatusNotFound, "deleted")
+			}
+			rev = doc.Rev
+		}
+		record, err := d.revision(tx, docID, rev)
+		if err != nil {
+			return err
+		}
+		if record.Body == nil {
+			// Removed by compaction
+			return errors.Status(kivik.StatusNotFound, "missing")
+		}
+		body = record.Body
+		return nil
+	})
+	return body, err
+}
+
+// Rev returns the current revision of the document, without reading its body.
+func (d *db) Rev(ctx context.Context, docID string) (string, error) {
+	if strings.HasPrefix(docID, docstore.LocalPrefix) {
+		body, err := d.Get(ctx, docID, nil)
+		if err != nil {
+			return "", err
+		}
+		var doc docstore.Doc
+		if err := json.Unmarshal(body, &doc); err != nil {
+			return "", errors.WrapStatus(kivik.StatusInternalServerError, err)
+		}
+		return doc.Rev(), nil
+	}
+	var rev string
+	err := d.view(ctx, func(tx *bbolt.Tx) error {
+		doc, err := d.current(tx, docID)
+		if err != nil {
+			return err
+		}
+		if doc.Deleted {
+			return errors.Status(kivik.StatusNotFound, "deleted")
+		}
+		rev = doc.Rev
+		return nil
+	})
+	return rev, err
+}
+
+func (d *db) CreateDoc(ctx context.Context, doc interface{}) (docID, rev string, err error) {
+	couchDoc, err := docstore.ToDoc(doc)
+	if err != nil {
+		return "", "", err
+	}
+	if id, ok := couchDoc["_id"].(string); ok {
+		docID = id
+	} else if docID, err = docstore.RandomID(); err != nil {
+		return "", "", err
+	}
+	err = d.update(ctx, func(tx *bbolt.Tx) error {
+		rev, err = docstore.Put(d.store(tx), docID, couchDoc)
+		return err
+	})
+	return docID, rev, err
+}
+
+func (d *db) Put(ctx context.Context, docID string, doc interface{}) (rev string, err error) {
+	couchDoc, err := docstore.ToDoc(doc)
+	if err != nil {
+		return "", err
+	}
+	err = d.update(ctx, func(tx *bbolt.Tx) error {
+		rev, err = docstore.Put(d.store(tx), docID, couchDoc)
+		return err
+	})
+	return rev, err
+}
+
+func (d *db) Delete(ctx context.Context, docID, rev string) (newRev string, err error) {
+	if !strings.HasPrefix(docID, docstore.LocalPrefix) {
+		if _, _, err := docstore.ParseRev(rev); err != nil {
+			return "", err
+		}
+	}
+	err = d.update(ctx, func(tx *bbolt.Tx) error {
+		newRev, err = docstore.Put(d.store(tx), docID, docstore.Doc{"_rev": rev, "_deleted": true})
+		return err
+	})
+	return newRev, err
+}
+
+// store is the docstore.Store of the database, within tx.
+type store struct {
+	d  *db
+	tx *bbolt.Tx
+}
+
+var _ docstore.Store = &store{}
+
+func (d *db) store(tx *bbolt.Tx) *store {
+	return &store{d: d, tx: tx}
+}
+
+func (s *store) Current(docID string) (string, bool, error) {
+	record, err := s.d.current(s.tx, docID)
+	if errors.StatusCode(err) == kivik.StatusNotFound && s.tx.Bucket(s.d.dbName) != nil {
+		return "", false, nil
+	}
+	if err != nil {
+		return "", false, err
+	}
+	return record.Rev, record.Deleted, nil
+}
+
+func (s *store) Body(docID, rev string) (json.RawMessage, error) {
+	record, err := s.d.revision(s.tx, docID, rev)
+	if err != nil {
+		return nil, err
+	}
+	return record.Body, nil
+}
+
+func (s *store) Attachment(docID, rev, filename string) (*docstore.Attachment, error) {
+	return s.d.loadAttachment(s.tx, docID, rev, filename)
+}
+
+// WriteRevision stores the revision in the revs bucket, and its attachments in
+// the atts bucket, and moves the document's entry in the seqs bucket to the
+// new sequence.
+func (s *store) WriteRevision(docID string, r *docstore.Revision) error {
+	b := s.tx.Bucket(s.d.dbName)
+	if b == nil {
+		return errors.Status(kivik.StatusNotFound, "database does not exist")
+	}
+	current, err := s.d.current(s.tx, docID)
+	exists := err == nil
+	if err != nil && errors.StatusCode(err) != kivik.StatusNotFound {
+		return err
+	}
+	seq, err := b.NextSequence()
+	if err != nil {
+		return boltError(err)
+	}
+	if err := putRecord(b.Bucket(revsBucket), revKey(docID, r.Rev), &revRecord{
+		Parent:  r.Parent,
+		Seq:     seq,
+		Deleted: r.Deleted,
+		Body:    r.Body,
+	}); err != nil {
+		return err
+	}
+	if err := putRecord(b.Bucket(docsBucket), []byte(docID), &docRecord{
+		Rev:     r.Rev,
+		Seq:     seq,
+		Deleted: r.Deleted,
+	}); err != nil {
+		return err
+	}
+	seqs := b.Bucket(seqsBucket)
+	if exists {
+		// Only the latest change to each document appears in the changes feed.
+		if err := seqs.Delete(seqKey(current.Seq)); err != nil {
+			return boltError(err)
+		}
+	}
+	if err := seqs.Put(seqKey(seq), []byte(docID)); err != nil {
+		return boltError(err)
+	}
+	for _, att := range r.Attachments {
+		if err := putRecord(b.Bucket(attsBucket), revKey(docID, r.Rev, att.Filename), att); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *store) LocalRev(docID string) (string, error) {
+	local, err := s.d.bucket(s.tx, localBucket)
+	if err != nil {
+		return "", err
+	}
+	var current docstore.Doc
+	if err := getRecord(local, []byte(docID), &current); err != nil && errors.StatusCode(err) != kivik.StatusNotFound {
+		return "", err
+	}
+	return current.Rev(), nil
+}
+
+func (s *store) WriteLocal(docID string, _ int64, doc docstore.Doc) error {
+	local, err := s.d.bucket(s.tx, localBucket)
+	if err != nil {
+		return err
+	}
+	if doc.Deleted() {
+		return boltError(local.Delete([]byte(docID)))
+	}
+	return putRecord(local, []byte(docID), doc)
+}
+
+func (d *db) updateSeq(tx *bbolt.Tx) (uint64, error) {
+	b := tx.Bucket(d.dbName)
+	if b == nil {
+		return 0, errors.Status(kivik.StatusNotFound, "database does not exist")
+	}
+	return b.Sequence(), nil
+}
+
+// Stats walks the docs, revs and atts buckets. DiskSize is the size of every
+// stored revision body and attachment, and ActiveSize and ExternalSize that of
+// the current revisions of undeleted documents.
+func (d *db) Stats(ctx context.Context) (*driver.DBStats, error) {
+	stats := &driver.DBStats{Name: string(d.dbName)}
+	err := d.view(ctx, func(tx *bbolt.Tx) error {
+		seq, err := d.updateSeq(tx)
+		if err != nil {
+			return err
+		}
+		stats.UpdateSeq = strconv.FormatUint(seq, 10)
+		b := tx.Bucket(d.dbName)
+		current := make(map[string]bool)
+		err = b.Bucket(docsBucket).ForEach(func(k, v []byte) error {
+			record := &docRecord{}
+			if err := json.Unmarshal(v, record); err != nil {
+				return errors.WrapStatus(kivik.StatusInternalServerError, err)
+			}
+			if record.Deleted {
+				stats.DeletedCount++
+				return nil
+			}
+			stats.DocCount++
+			current[string(revKey(string(k), record.Rev))] = true
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+		err = b.Bucket(revsBucket).ForEach(func(k, v []byte) error {
+			record := &revRecord{}
+			if err := json.Unmarshal(v, record); err != nil {
+				return errors.WrapStatus(kivik.StatusInternalServerError, err)
+			}
+			stats.DiskSize += int64(len(record.Body))
+			if current[string(k)] {
+				stats.ActiveSize += int64(len(record.Body))
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+		return b.Bucket(attsBucket).ForEach(func(k, v []byte) error {
+			att := &docstore.Attachment{}
+			if err := json.Unmarshal(v, att); err != nil {
+				return errors.WrapStatus(kivik.StatusInternalServerError, err)
+			}
+			stats.DiskSize += int64(len(att.Data))
+			parts := splitKey(k)
+			if current[string(revKey(parts[0], parts[1]))] {
+				stats.ActiveSize += int64(len(att.Data))
+			}
+			return nil
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+	stats.ExternalSize = stats.ActiveSize
+	return stats, nil
+}
+
+// Compact removes the bodies of non-current revisions from the revs bucket,
+// keeping their records for the revision history, and deletes their entries
+// from the atts bucket.
+func (d *db) Compact(ctx context.Context) error {
+	return d.update(ctx, func(tx *bbolt.Tx) error {
+		docs, err := d.bucket(tx, docsBucket)
+		if err != nil {
+			return err
+		}
+		isCurrent := func(docID, rev string) (bool, error) {
+			record := &docRecord{}
+			if err := getRecord(docs, []byte(docID), record); err != nil {
+				return false, err
+			}
+			return record.Rev == rev, nil
+		}
+		b := tx.Bucket(d.dbName)
+		revs := b.Bucket(revsBucket)
+		var compacted [][]byte
+		err = revs.ForEach(func(k, v []byte) error {
+			parts := splitKey(k)
+			current, err := isCurrent(parts[0], parts[1])
+			if err != nil || current {
+				return err
+			}
+			compacted = append(compacted, append([]byte{}, k...))
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+		for _, k := range compacted {
+			record := &revRecord{}
+			if err := getRecord(revs, k, record); err != nil {
+				return err
+			}
+			if record.Body == nil {
+				continue
+			}
+			record.Body = nil
+			if err := putRecord(revs, k, record); err != nil {
+				return err
+			}
+		}
+		atts := b.Bucket(attsBucket)
+		var obsolete [][]byte
+		err = atts.ForEach(func(k, _ []byte) error {
+			parts := splitKey(k)
+			current, err := isCurrent(parts[0], parts[1])
+			if err != nil || current {
+				return err
+			}
+			obsolete = append(obsolete, append([]byte{}, k...))
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+		for _, k := range obsolete {
+			if err := atts.Delete(k); err != nil {
+				return boltError(err)
+			}
+		}
+		return nil
+	})
+}
+
+func (d *db) CompactView(_ context.Context, _ string) error {
+	return notImplemented
+}
+
+func (d *db) ViewCleanup(_ context.Context) error {
+	return notImplemented
+}
+
+func (d *db) Query(_ context.Context, _, _ string, _ map[string]interface{}) (driver.Rows, error) {
+	return nil, notImplemented
+}
+
+func (d *db) Security(ctx context.Context) (*driver.Security, error) {
+	sec := &driver.Security{}
+	err := d.view(ctx, func(tx *bbolt.Tx) error {
+		meta, err := d.bucket(tx, metaBucket)
+		if err != nil {
+			return err
+		}
+		return getRecord(meta, securityKey, sec)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return sec, nil
+}
+
+func (d *db) SetSecurity(ctx context.Context, sec *driver.Security) error {
+	return d.update(ctx, func(tx *bbolt.Tx) error {
+		meta, err := d.bucket(tx, metaBucket)
+		if err != nil {
+			return err
+		}
+		return putRecord(meta, securityKey, sec)
+	})
+}
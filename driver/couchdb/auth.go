@@ -4,6 +4,7 @@ import (
 	"context"
 	"errors"
 
+	"github.com/flimzy/kivik"
 	"github.com/flimzy/kivik/driver/couchdb/chttp"
 )
 
@@ -13,3 +14,21 @@ func (c *client) Authenticate(ctx context.Context, a interface{}) error {
 	}
 	return errors.New("invalid authenticator")
 }
+
+// AdminParty checks the roles of an unauthenticated session.
+func (c *client) AdminParty(ctx context.Context) (bool, error) {
+	var session struct {
+		UserCtx struct {
+			Roles []string `json:"roles"`
+		} `json:"userCtx"`
+	}
+	if _, err := c.Anonymous().DoJSON(ctx, kivik.MethodGet, "/_session", nil, &session); err != nil {
+		return false, err
+	}
+	for _, role := range session.UserCtx.Roles {
+		if role == "_admin" {
+			return true, nil
+		}
+	}
+	return false, nil
+}
@@ -0,0 +1,59 @@
+// +build !js
+
+package couchdb
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/flimzy/kivik/driver/couchdb/chttp"
+)
+
+func TestAdminParty(t *testing.T) {
+	tests := []struct {
+		name     string
+		party    bool
+		expected bool
+	}{
+		{name: "Secured", party: false, expected: false},
+		{name: "Party", party: true, expected: true},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Set("Content-Type", "application/json")
+				if r.URL.Path != "/_session" {
+					_, _ = w.Write([]byte(`{"couchdb":"Welcome","version":"2.0.0"}`))
+					return
+				}
+				// The client's own credentials must not be sent.
+				if _, _, ok := r.BasicAuth(); ok {
+					_, _ = w.Write([]byte(`{"ok":true,"userCtx":{"name":"admin","roles":["_admin"]}}`))
+					return
+				}
+				if test.party {
+					_, _ = w.Write([]byte(`{"ok":true,"userCtx":{"name":null,"roles":["_admin"]}}`))
+					return
+				}
+				_, _ = w.Write([]byte(`{"ok":true,"userCtx":{"name":null,"roles":[]}}`))
+			}))
+			defer s.Close()
+			c, err := (&Couch{}).NewClient(context.Background(), s.URL)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err = c.(*client).Authenticate(context.Background(), &chttp.BasicAuth{Username: "admin", Password: "abc123"}); err != nil {
+				t.Fatal(err)
+			}
+			party, err := c.(*client).AdminParty(context.Background())
+			if err != nil {
+				t.Fatal(err)
+			}
+			if party != test.expected {
+				t.Errorf("Expected %t, got %t", test.expected, party)
+			}
+		})
+	}
+}
@@ -59,13 +59,25 @@ func (r *bulkResults) Close() error {
 }
 
 func (d *db) BulkDocs(ctx context.Context, docs []interface{}) (driver.BulkResults, error) {
+	return d.BulkDocsOpts(ctx, docs, nil)
+}
+
+func (d *db) BulkDocsOpts(ctx context.Context, docs []interface{}, options map[string]interface{}) (driver.BulkResults, error) {
 	var cancel context.CancelFunc
 	ctx, cancel = context.WithCancel(ctx)
 	defer cancel()
-	body, errFunc := chttp.EncodeBody(map[string]interface{}{"docs": docs}, cancel)
+	request := make(map[string]interface{}, len(options)+1)
+	for key, value := range options {
+		request[key] = value
+	}
+	request["docs"] = docs
+	body, errFunc := chttp.EncodeBody(request, cancel)
 	opts := &chttp.Options{
 		Body:        body,
 		ForceCommit: d.forceCommit,
+		// With new_edits=false, as used by replication, documents are stored
+		// with the given revisions, so the request is safe to retry.
+		Idempotent: options["new_edits"] == false,
 	}
 	resp, err := d.Client.DoReq(ctx, kivik.MethodPost, d.path("_bulk_docs", nil), opts)
 	if jsonErr := errFunc(); jsonErr != nil {
@@ -82,8 +94,8 @@ func (d *db) BulkDocs(ctx context.Context, docs []interface{}) (driver.BulkResul
 		// Nothing to do
 	case kivik.StatusExpectationFailed:
 		err = &chttp.HTTPError{
-			Code:   kivik.StatusExpectationFailed,
-			Reason: "one or more document was rejected",
+			Code:    kivik.StatusExpectationFailed,
+			Message: "one or more document was rejected",
 		}
 	default:
 		if resp.StatusCode < 400 {
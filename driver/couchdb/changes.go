@@ -4,20 +4,37 @@ import (
 	"context"
 	"encoding/json"
 	"io"
+	"sync"
 
 	"github.com/flimzy/kivik"
 	"github.com/flimzy/kivik/driver"
 	"github.com/flimzy/kivik/driver/couchdb/chttp"
+	"github.com/flimzy/kivik/errors"
 )
 
-// Changes returns the changes stream for the database.
+// changesDefaults are the default options for the changes feed, which may be
+// overridden by the caller.
+var changesDefaults = map[string]interface{}{
+	"feed":      "continuous",
+	"since":     "now",
+	"heartbeat": 6000,
+}
+
+// Changes returns the changes stream for the database. With the option
+// feed=websocket, the changes are streamed over a WebSocket, as served by
+// kivik's serve package at /{db}/_changes/ws. This transport is experimental,
+// and is not supported by CouchDB.
 func (d *db) Changes(ctx context.Context, opts map[string]interface{}) (driver.Changes, error) {
-	overrideOpts := map[string]interface{}{
-		"feed":      "continuous",
-		"since":     "now",
-		"heartbeat": 6000,
+	if opts["feed"] == "websocket" {
+		return d.wsChanges(ctx, opts)
+	}
+	defaultOpts := make(map[string]interface{}, len(changesDefaults))
+	for k, v := range changesDefaults {
+		if _, ok := opts[k]; !ok {
+			defaultOpts[k] = v
+		}
 	}
-	options, err := optionsToParams(opts, overrideOpts)
+	options, err := optionsToParams(opts, defaultOpts)
 	if err != nil {
 		return nil, err
 	}
@@ -28,13 +45,71 @@ func (d *db) Changes(ctx context.Context, opts map[string]interface{}) (driver.C
 	if err = chttp.ResponseError(resp); err != nil {
 		return nil, err
 	}
+	if feed := opts["feed"]; feed == "normal" || feed == "longpoll" {
+		return newResultsChangesRows(resp.Body), nil
+	}
 	return newChangesRows(resp.Body), nil
 }
 
+func (d *db) wsChanges(ctx context.Context, opts map[string]interface{}) (driver.Changes, error) {
+	wsOpts := make(map[string]interface{}, len(opts))
+	for k, v := range opts {
+		if k != "feed" {
+			wsOpts[k] = v
+		}
+	}
+	if _, ok := wsOpts["since"]; !ok {
+		wsOpts["since"] = changesDefaults["since"]
+	}
+	options, err := optionsToParams(wsOpts)
+	if err != nil {
+		return nil, err
+	}
+	ws, err := d.Client.WebSocket(ctx, d.path("_changes/ws", options))
+	if err != nil {
+		return nil, err
+	}
+	return newChangesRows(newCtxCloser(ctx, ws)), nil
+}
+
+// ctxCloser closes rc when ctx is cancelled, to interrupt blocked reads.
+type ctxCloser struct {
+	io.ReadCloser
+	done chan struct{}
+	once sync.Once
+}
+
+func newCtxCloser(ctx context.Context, rc io.ReadCloser) *ctxCloser {
+	c := &ctxCloser{ReadCloser: rc, done: make(chan struct{})}
+	go func() {
+		select {
+		case <-ctx.Done():
+			_ = c.Close()
+		case <-c.done:
+		}
+	}()
+	return c
+}
+
+func (c *ctxCloser) Close() error {
+	var err error
+	c.once.Do(func() {
+		close(c.done)
+		err = c.ReadCloser.Close()
+	})
+	return err
+}
+
 type changesRows struct {
 	body   io.ReadCloser
 	dec    *json.Decoder
 	closed bool
+	// results is true for the normal and longpoll feeds, whose changes are
+	// the elements of the results array of a single object, rather than
+	// separate lines.
+	results bool
+	// inResults is true once the results array has been opened.
+	inResults bool
 }
 
 func newChangesRows(r io.ReadCloser) *changesRows {
@@ -43,6 +118,13 @@ func newChangesRows(r io.ReadCloser) *changesRows {
 	}
 }
 
+func newResultsChangesRows(r io.ReadCloser) *changesRows {
+	return &changesRows{
+		body:    r,
+		results: true,
+	}
+}
+
 var _ driver.Changes = &changesRows{}
 
 func (r *changesRows) Close() error {
@@ -56,9 +138,80 @@ func (r *changesRows) Next(row *driver.Change) error {
 	if r.dec == nil {
 		r.dec = json.NewDecoder(r.body)
 	}
+	if r.results {
+		return r.nextResult(row)
+	}
 	if !r.dec.More() {
 		return io.EOF
 	}
+	*row = driver.Change{}
+	ch := struct {
+		*driver.Change
+		LastSeq driver.SequenceID `json:"last_seq"`
+	}{Change: row}
+	if err := r.dec.Decode(&ch); err != nil {
+		return err
+	}
+	if ch.LastSeq != "" {
+		// The final line of a continuous feed, sent when the feed terminates
+		// due to a limit or timeout.
+		r.closed = true
+		return io.EOF
+	}
+	return nil
+}
 
+// nextResult reads the next element of the results array of a normal or
+// longpoll feed.
+func (r *changesRows) nextResult(row *driver.Change) error {
+	if !r.inResults {
+		if err := r.openResults(); err != nil {
+			return err
+		}
+	}
+	if !r.dec.More() {
+		r.closed = true
+		return io.EOF
+	}
+	*row = driver.Change{}
 	return r.dec.Decode(row)
 }
+
+// openResults reads up to the start of the results array, skipping other
+// fields, such as last_seq and pending. io.EOF is returned if the response
+// has no results.
+func (r *changesRows) openResults() error {
+	if err := r.expectDelim('{'); err != nil {
+		return err
+	}
+	for r.dec.More() {
+		tok, err := r.dec.Token()
+		if err != nil {
+			return err
+		}
+		if tok == "results" {
+			if err := r.expectDelim('['); err != nil {
+				return err
+			}
+			r.inResults = true
+			return nil
+		}
+		var value json.RawMessage
+		if err := r.dec.Decode(&value); err != nil {
+			return err
+		}
+	}
+	r.closed = true
+	return io.EOF
+}
+
+func (r *changesRows) expectDelim(delim json.Delim) error {
+	tok, err := r.dec.Token()
+	if err != nil {
+		return err
+	}
+	if tok != delim {
+		return errors.Statusf(kivik.StatusBadResponse, "unexpected token in changes feed: %v", tok)
+	}
+	return nil
+}
@@ -0,0 +1,87 @@
+package couchdb
+
+import (
+	"io"
+	"io/ioutil"
+	"strings"
+	"testing"
+
+	"github.com/flimzy/diff"
+	"github.com/flimzy/kivik/driver"
+)
+
+func TestChangesNext(t *testing.T) {
+	input := `{"seq":1,"id":"foo","changes":[{"rev":"1-abc"}],"deleted":true}
+
+{"seq":2,"id":"bar","changes":[{"rev":"1-def"}]}
+{"last_seq":2}
+`
+	rows := newChangesRows(ioutil.NopCloser(strings.NewReader(input)))
+	expected := []driver.Change{
+		{ID: "foo", Seq: "1", Deleted: true, Changes: driver.ChangedRevs{"1-abc"}},
+		{ID: "bar", Seq: "2", Changes: driver.ChangedRevs{"1-def"}},
+	}
+	result := []driver.Change{}
+	row := &driver.Change{}
+	for {
+		err := rows.Next(row)
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		result = append(result, *row)
+	}
+	if d := diff.Interface(expected, result); d != "" {
+		t.Error(d)
+	}
+}
+
+func TestResultsChangesNext(t *testing.T) {
+	tests := map[string]string{
+		"Normal": `{"results":[
+{"seq":"1-g1AAAA","id":"foo","changes":[{"rev":"1-abc"}],"deleted":true},
+{"seq":"2-g1AAAA","id":"bar","changes":[{"rev":"1-def"}],"doc":{"_id":"bar","_rev":"1-def"}}
+],
+"last_seq":"2-g1AAAA","pending":0}
+`,
+		"LastSeqFirst": `{"last_seq":"2-g1AAAA","pending":0,"results":[{"seq":"1-g1AAAA","id":"foo","changes":[{"rev":"1-abc"}],"deleted":true},{"seq":"2-g1AAAA","id":"bar","changes":[{"rev":"1-def"}],"doc":{"_id":"bar","_rev":"1-def"}}]}`,
+		// A longpoll feed sends heartbeats before the response.
+		"Longpoll": "\n\n" + `{"results":[{"seq":"1-g1AAAA","id":"foo","changes":[{"rev":"1-abc"}],"deleted":true},{"seq":"2-g1AAAA","id":"bar","changes":[{"rev":"1-def"}],"doc":{"_id":"bar","_rev":"1-def"}}],"last_seq":"2-g1AAAA"}`,
+	}
+	expected := []driver.Change{
+		{ID: "foo", Seq: "1-g1AAAA", Deleted: true, Changes: driver.ChangedRevs{"1-abc"}},
+		{ID: "bar", Seq: "2-g1AAAA", Changes: driver.ChangedRevs{"1-def"}, Doc: []byte(`{"_id":"bar","_rev":"1-def"}`)},
+	}
+	for name, input := range tests {
+		t.Run(name, func(t *testing.T) {
+			rows := newResultsChangesRows(ioutil.NopCloser(strings.NewReader(input)))
+			result := []driver.Change{}
+			row := &driver.Change{}
+			for {
+				err := rows.Next(row)
+				if err == io.EOF {
+					break
+				}
+				if err != nil {
+					t.Fatal(err)
+				}
+				result = append(result, *row)
+			}
+			if d := diff.Interface(expected, result); d != "" {
+				t.Error(d)
+			}
+			if err := rows.Next(row); err != io.EOF {
+				t.Errorf("Expected io.EOF once the feed is read, got %v", err)
+			}
+		})
+	}
+}
+
+func TestResultsChangesEmpty(t *testing.T) {
+	rows := newResultsChangesRows(ioutil.NopCloser(strings.NewReader(`{"results":[],"last_seq":"0","pending":0}`)))
+	if err := rows.Next(&driver.Change{}); err != io.EOF {
+		t.Errorf("Expected io.EOF, got %v", err)
+	}
+}
@@ -0,0 +1,74 @@
+// +build !js
+
+package couchdb
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/flimzy/diff"
+	"github.com/flimzy/kivik/driver"
+)
+
+func TestChangesFeeds(t *testing.T) {
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		switch r.URL.Query().Get("feed") {
+		case "continuous":
+			_, _ = w.Write([]byte(`{"seq":"1-x","id":"foo","changes":[{"rev":"1-abc"}]}
+{"last_seq":"1-x"}
+`))
+		case "normal", "longpoll":
+			_, _ = w.Write([]byte(`{"results":[
+{"seq":"1-x","id":"foo","changes":[{"rev":"1-abc"}]}
+],
+"last_seq":"1-x","pending":0}
+`))
+		default:
+			w.WriteHeader(http.StatusBadRequest)
+			_, _ = w.Write([]byte(`{"error":"bad_request","reason":"unexpected feed"}`))
+		}
+	}))
+	defer s.Close()
+	ctx := context.Background()
+	dc, err := (&Couch{}).NewClient(ctx, s.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	db, err := dc.DB(ctx, "foo", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []string{"foo"}
+	for _, feed := range []string{"", "continuous", "normal", "longpoll"} {
+		t.Run(feed, func(t *testing.T) {
+			opts := map[string]interface{}{}
+			if feed != "" {
+				opts["feed"] = feed
+			}
+			changes, err := db.Changes(ctx, opts)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer func() { _ = changes.Close() }()
+			var ids []string
+			change := &driver.Change{}
+			for {
+				err := changes.Next(change)
+				if err == io.EOF {
+					break
+				}
+				if err != nil {
+					t.Fatal(err)
+				}
+				ids = append(ids, change.ID)
+			}
+			if d := diff.Interface(expected, ids); d != "" {
+				t.Error(d)
+			}
+		})
+	}
+}
@@ -4,13 +4,16 @@ package chttp
 
 import (
 	"context"
-	"encoding/json"
 	"io"
+	"io/ioutil"
 	"net/http"
 	"net/url"
 	"strings"
 
 	"github.com/pkg/errors"
+
+	"github.com/flimzy/kivik"
+	"github.com/flimzy/kivik/trace"
 )
 
 const (
@@ -21,9 +24,16 @@ const (
 type Client struct {
 	*http.Client
 
-	rawDSN string
-	dsn    *url.URL
-	auth   Authenticator
+	rawDSN  string
+	dsn     *url.URL
+	auth    Authenticator
+	pool    *poolTransport
+	session *session
+
+	// Retry configures the retrying of failed requests.
+	Retry RetryOptions
+	// Sticky configures session affinity.
+	Sticky StickyOptions
 }
 
 // New returns a connection to a remote CouchDB server. If credentials are
@@ -32,16 +42,24 @@ type Client struct {
 // authentication mechanism, do not specify credentials in the URL, and instead
 // call the Auth() method later.
 func New(ctx context.Context, dsn string) (*Client, error) {
+	return NewWithPool(ctx, dsn, PoolOptions{})
+}
+
+// NewWithPool is as New, with the connection pool configured by pool.
+func NewWithPool(ctx context.Context, dsn string, pool PoolOptions) (*Client, error) {
 	dsnURL, err := url.Parse(dsn)
 	if err != nil {
 		return nil, err
 	}
 	user := dsnURL.User
 	dsnURL.User = nil
+	transport := newPoolTransport(pool)
 	c := &Client{
-		Client: &http.Client{},
-		dsn:    dsnURL,
-		rawDSN: dsn,
+		Client:  &http.Client{Transport: transport},
+		dsn:     dsnURL,
+		rawDSN:  dsn,
+		pool:    transport,
+		session: &session{},
 	}
 	if user != nil {
 		password, _ := user.Password()
@@ -52,6 +70,25 @@ func New(ctx context.Context, dsn string) (*Client, error) {
 	return c, nil
 }
 
+// Stats returns the state of the client's connection pool.
+func (c *Client) Stats() PoolStats {
+	return c.pool.stats()
+}
+
+// Anonymous returns a copy of the client which makes unauthenticated requests,
+// sharing the connection pool and session affinity of c.
+func (c *Client) Anonymous() *Client {
+	return &Client{
+		Client:  &http.Client{Transport: c.pool},
+		rawDSN:  c.rawDSN,
+		dsn:     c.dsn,
+		pool:    c.pool,
+		session: c.session,
+		Retry:   c.Retry,
+		Sticky:  c.Sticky,
+	}
+}
+
 // DSN returns the unparsed DSN used to connect.
 func (c *Client) DSN() string {
 	return c.rawDSN
@@ -102,6 +139,13 @@ type Options struct {
 	ContentType string
 	// Body sets the body of the request.
 	Body io.Reader
+	// GetBody, if set, is used instead of Body. It is called for each attempt
+	// of the request, and returns a new copy of the body, so that the request
+	// may be retried without buffering the body.
+	GetBody func() (io.Reader, error)
+	// Idempotent marks a POST request as safe to retry. Requests with other
+	// methods are always considered idempotent.
+	Idempotent bool
 	// JSON is an arbitrary data type which is marshaled to the request's body.
 	// It an error to set both Body and JSON on the same request. When this is
 	// set, ContentType is unconditionally set to 'application/json'. Note that
@@ -127,7 +171,11 @@ type Response struct {
 // closes the response body.
 func DecodeJSON(r *http.Response, i interface{}) error {
 	defer r.Body.Close()
-	return json.NewDecoder(r.Body).Decode(i)
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		return err
+	}
+	return kivik.JSON().Unmarshal(body, i)
 }
 
 // DoJSON combines DoReq() and, ResponseError(), and (*Response).DecodeJSON(), and
@@ -158,17 +206,42 @@ func (c *Client) NewRequest(ctx context.Context, method, path string, body io.Re
 	if err != nil {
 		return nil, err
 	}
+	trace.Inject(ctx, req)
 	return req.WithContext(ctx), nil
 }
 
 // DoReq does an HTTP request. An error is returned only if there was an error
 // processing the request. In particular, an error status code, such as 400
 // or 500, does _not_ cause an error to be returned.
+//
+// Failed requests are retried as configured by c.Retry.
 func (c *Client) DoReq(ctx context.Context, method, path string, opts *Options) (*http.Response, error) {
+	getBody, replayable, err := c.bodyFunc(opts)
+	if err != nil {
+		return nil, err
+	}
+	canRetry := replayable && idempotent(method, opts)
+	for retry := 0; ; retry++ {
+		res, err := c.doOnce(ctx, method, path, getBody, opts)
+		if !canRetry || retry >= c.Retry.MaxRetries || !retryable(res, err) {
+			return res, err
+		}
+		if res != nil {
+			_, _ = io.Copy(ioutil.Discard, res.Body)
+			_ = res.Body.Close()
+		}
+		if err := c.wait(ctx, retry); err != nil {
+			return nil, err
+		}
+	}
+}
+
+func (c *Client) doOnce(ctx context.Context, method, path string, getBody func() (io.Reader, error), opts *Options) (*http.Response, error) {
 	var body io.Reader
-	if opts != nil {
-		if opts.Body != nil {
-			body = opts.Body
+	if getBody != nil {
+		var err error
+		if body, err = getBody(); err != nil {
+			return nil, err
 		}
 	}
 	req, err := c.NewRequest(ctx, method, path, body)
@@ -177,8 +250,12 @@ func (c *Client) DoReq(ctx context.Context, method, path string, opts *Options)
 	}
 	fixPath(req, path)
 	setHeaders(req, opts)
+	c.session.apply(req, c.Sticky)
 
-	return c.Do(req)
+	res, err := c.Do(req)
+	c.session.update(res, c.Sticky)
+	kivik.RecordResponse(ctx, res)
+	return res, err
 }
 
 // fixPath sets the request's URL.RawPath to work with escaped characters in
@@ -196,7 +273,11 @@ func EncodeBody(i interface{}, cancel context.CancelFunc) (r io.Reader, errFunc
 	r, w := io.Pipe()
 	errChan := make(chan error, 1)
 	go func() {
-		if err := json.NewEncoder(w).Encode(i); err != nil {
+		body, err := kivik.JSON().Marshal(i)
+		if err == nil {
+			_, err = w.Write(body)
+		}
+		if err != nil {
 			cancel()
 			errChan <- err
 		}
@@ -23,3 +23,10 @@ func EncodeDocID(docID string) string {
 	}
 	return url.QueryEscape(docID)
 }
+
+// EncodeDBName encodes a database name for use as the first segment of a
+// path. Slashes, which are valid in database names, are encoded, so that a
+// name such as "foo/bar" is not mistaken for a database and document.
+func EncodeDBName(dbName string) string {
+	return strings.Replace(dbName, "/", "%2F", -1)
+}
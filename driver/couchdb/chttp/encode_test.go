@@ -24,3 +24,21 @@ func TestEncodeDocID(t *testing.T) {
 		}
 	}
 }
+
+func TestEncodeDBName(t *testing.T) {
+	tests := []struct {
+		Input    string
+		Expected string
+	}{
+		{Input: "foo", Expected: "foo"},
+		{Input: "_users", Expected: "_users"},
+		{Input: "foo/bar", Expected: "foo%2Fbar"},
+		{Input: "a/b/c$(x)+y-z", Expected: "a%2Fb%2Fc$(x)+y-z"},
+	}
+	for _, test := range tests {
+		result := EncodeDBName(test.Input)
+		if result != test.Expected {
+			t.Errorf("Unexpected encoded DB name from %s\n\tExpected: %s\n\t  Actual: %s\n", test.Input, test.Expected, result)
+		}
+	}
+}
@@ -3,21 +3,30 @@ package chttp
 import (
 	"encoding/json"
 	"fmt"
+	"io/ioutil"
 	"mime"
 	"net/http"
+
+	"github.com/flimzy/kivik/errors"
 )
 
 // HTTPError is an error that represents an HTTP transport error.
 type HTTPError struct {
-	Code   int
-	Reason string `json:"reason"`
+	Code int
+	// Name is the CouchDB error name, from the `error` field of the response.
+	Name string `json:"error"`
+	// Message is the CouchDB error reason, from the `reason` field of the
+	// response.
+	Message string `json:"reason"`
+	// Body is the raw response body.
+	Body []byte `json:"-"`
 }
 
 func (e *HTTPError) Error() string {
-	if e.Reason == "" {
+	if e.Message == "" {
 		return http.StatusText(e.Code)
 	}
-	return fmt.Sprintf("%s: %s", http.StatusText(e.Code), e.Reason)
+	return fmt.Sprintf("%s: %s", http.StatusText(e.Code), e.Message)
 }
 
 // StatusCode returns the embedded status code.
@@ -25,6 +34,27 @@ func (e *HTTPError) StatusCode() int {
 	return e.Code
 }
 
+// ErrorName returns the CouchDB error name.
+func (e *HTTPError) ErrorName() string {
+	return e.Name
+}
+
+// Reason returns the CouchDB error reason.
+func (e *HTTPError) Reason() string {
+	return e.Message
+}
+
+// Is returns true if target is a kivik sentinel error with the same status
+// code.
+func (e *HTTPError) Is(target error) bool {
+	return errors.MatchStatus(e.Code, target)
+}
+
+// RawResponse returns the raw response body.
+func (e *HTTPError) RawResponse() []byte {
+	return e.Body
+}
+
 // ResponseError returns an error from an *http.Response.
 func ResponseError(resp *http.Response) error {
 	if resp.StatusCode < 400 {
@@ -33,9 +63,14 @@ func ResponseError(resp *http.Response) error {
 	defer resp.Body.Close()
 	httpErr := &HTTPError{}
 	if resp.Request.Method != "HEAD" && resp.ContentLength != 0 {
-		if ct, _, _ := mime.ParseMediaType(resp.Header.Get("Content-Type")); ct == typeJSON {
-			if err := json.NewDecoder(resp.Body).Decode(httpErr); err != nil {
-				httpErr.Reason = fmt.Sprintf("unknown (failed to decode error response: %s)", err)
+		body, err := ioutil.ReadAll(resp.Body)
+		if err != nil {
+			httpErr.Message = fmt.Sprintf("unknown (failed to read error response: %s)", err)
+		}
+		httpErr.Body = body
+		if ct, _, _ := mime.ParseMediaType(resp.Header.Get("Content-Type")); err == nil && ct == typeJSON {
+			if err := json.Unmarshal(body, httpErr); err != nil {
+				httpErr.Message = fmt.Sprintf("unknown (failed to decode error response: %s)", err)
 			}
 		}
 	}
@@ -15,6 +15,9 @@ func TestErrors(t *testing.T) {
 		Func           func() error
 		ExpectedStatus int
 		ExpectedMsg    string
+		ExpectedName   string
+		ExpectedReason string
+		ExpectedBody   string
 	}
 	tests := []errTest{
 		{
@@ -51,6 +54,25 @@ func TestErrors(t *testing.T) {
 			ExpectedStatus: 404,
 			ExpectedMsg:    "Not Found: db_not_found",
 		},
+		{
+			Name: "WithErrorName",
+			Func: func() error {
+				return ResponseError(&http.Response{
+					StatusCode: 409,
+					Request: &http.Request{
+						Method: "PUT",
+					},
+					Header:        map[string][]string{"Content-Type": {"application/json"}},
+					ContentLength: 1, // Just non-zero for this test
+					Body:          ioutil.NopCloser(strings.NewReader(`{"error":"conflict","reason":"Document update conflict."}`)),
+				})
+			},
+			ExpectedStatus: 409,
+			ExpectedMsg:    "Conflict: Document update conflict.",
+			ExpectedName:   "conflict",
+			ExpectedReason: "Document update conflict.",
+			ExpectedBody:   `{"error":"conflict","reason":"Document update conflict."}`,
+		},
 		{
 			Name: "WithoutReason",
 			Func: func() error {
@@ -100,6 +122,18 @@ func TestErrors(t *testing.T) {
 				if msg := err.Error(); msg != test.ExpectedMsg {
 					t.Errorf("Error. Expected '%s', Actual '%s'", test.ExpectedMsg, msg)
 				}
+				if test.ExpectedName == "" {
+					return
+				}
+				if name := errors.ErrorName(err); name != test.ExpectedName {
+					t.Errorf("ErrorName. Expected '%s', Actual '%s'", test.ExpectedName, name)
+				}
+				if reason := errors.Reason(err); reason != test.ExpectedReason {
+					t.Errorf("Reason. Expected '%s', Actual '%s'", test.ExpectedReason, reason)
+				}
+				if body := string(errors.RawResponse(err)); body != test.ExpectedBody {
+					t.Errorf("RawResponse. Expected '%s', Actual '%s'", test.ExpectedBody, body)
+				}
 			})
 		}(test)
 	}
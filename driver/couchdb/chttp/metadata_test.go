@@ -0,0 +1,42 @@
+// +build !js
+
+package chttp
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/flimzy/kivik"
+)
+
+func TestResultMetadata(t *testing.T) {
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("ETag", `"1-abc"`)
+		w.Header().Set("X-Couch-Request-ID", "req123")
+		w.WriteHeader(http.StatusCreated)
+		_, _ = w.Write([]byte(`{"ok":true}`))
+	}))
+	defer s.Close()
+	client, err := New(context.Background(), s.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx, meta := kivik.WithResultMetadata(context.Background())
+	if _, err = client.DoError(ctx, http.MethodPut, "/foo/bar", nil); err != nil {
+		t.Fatal(err)
+	}
+	if meta.StatusCode != http.StatusCreated {
+		t.Errorf("Unexpected status: %d", meta.StatusCode)
+	}
+	if meta.ETag != "1-abc" {
+		t.Errorf("Unexpected ETag: %s", meta.ETag)
+	}
+	if meta.RequestID != "req123" {
+		t.Errorf("Unexpected request ID: %s", meta.RequestID)
+	}
+	if meta.ContentLength != 11 {
+		t.Errorf("Unexpected content length: %d", meta.ContentLength)
+	}
+}
@@ -0,0 +1,154 @@
+package chttp
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptrace"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// DefaultIdleTimeout is the IdleTimeout used when none is configured, as for
+// http.DefaultTransport.
+const DefaultIdleTimeout = 90 * time.Second
+
+// PoolOptions configures a client's connection pool.
+type PoolOptions struct {
+	// MaxIdleConns is the maximum number of idle connections kept open to the
+	// server. If zero, http.DefaultMaxIdleConnsPerHost is used.
+	MaxIdleConns int
+	// MaxConnsPerHost limits the number of concurrent requests, and so the
+	// number of open connections, to the server. Requests beyond the limit
+	// wait for an earlier request to complete, or for their context to be
+	// cancelled. If zero, there is no limit.
+	MaxConnsPerHost int
+	// IdleTimeout is how long an idle connection is kept open. If zero,
+	// DefaultIdleTimeout is used.
+	IdleTimeout time.Duration
+}
+
+// PoolStats reports the state of a client's connection pool.
+type PoolStats struct {
+	// OpenConnections is the number of open connections, including idle ones.
+	OpenConnections int
+	// IdleConnections is the number of open connections not in use by any
+	// request.
+	IdleConnections int
+	// InFlight is the number of requests which are waiting for a connection,
+	// awaiting a response, or reading a response body.
+	InFlight int
+}
+
+// poolTransport tracks the connections and requests of a client, and enforces
+// MaxConnsPerHost.
+type poolTransport struct {
+	base http.RoundTripper
+	// sem holds a token for each request in flight, if MaxConnsPerHost is set.
+	sem chan struct{}
+
+	open     int64
+	inUse    int64
+	inFlight int64
+}
+
+var _ http.RoundTripper = &poolTransport{}
+
+func newPoolTransport(opts PoolOptions) *poolTransport {
+	t := &poolTransport{}
+	if opts.MaxConnsPerHost > 0 {
+		t.sem = make(chan struct{}, opts.MaxConnsPerHost)
+	}
+	t.base = newBaseTransport(t, opts)
+	return t
+}
+
+// RoundTrip satisfies the http.RoundTripper interface.
+func (t *poolTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	atomic.AddInt64(&t.inFlight, 1)
+	if t.sem != nil {
+		select {
+		case t.sem <- struct{}{}:
+		case <-req.Context().Done():
+			atomic.AddInt64(&t.inFlight, -1)
+			return nil, req.Context().Err()
+		}
+	}
+	r := &poolRelease{t: t}
+	trace := &httptrace.ClientTrace{
+		GotConn: func(httptrace.GotConnInfo) {
+			r.mu.Lock()
+			defer r.mu.Unlock()
+			if !r.done && !r.gotConn {
+				r.gotConn = true
+				atomic.AddInt64(&t.inUse, 1)
+			}
+		},
+	}
+	req = req.WithContext(httptrace.WithClientTrace(req.Context(), trace))
+	res, err := t.base.RoundTrip(req)
+	if err != nil {
+		r.release()
+		return nil, err
+	}
+	res.Body = &poolBody{ReadCloser: res.Body, release: r}
+	return res, nil
+}
+
+// poolRelease releases the resources held by a single request, once.
+type poolRelease struct {
+	t       *poolTransport
+	mu      sync.Mutex
+	gotConn bool
+	done    bool
+}
+
+func (r *poolRelease) release() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.done {
+		return
+	}
+	r.done = true
+	if r.gotConn {
+		atomic.AddInt64(&r.t.inUse, -1)
+	}
+	if r.t.sem != nil {
+		<-r.t.sem
+	}
+	atomic.AddInt64(&r.t.inFlight, -1)
+}
+
+// poolBody releases the request when the response body is read to the end, or
+// closed.
+type poolBody struct {
+	io.ReadCloser
+	release *poolRelease
+}
+
+func (b *poolBody) Read(p []byte) (int, error) {
+	n, err := b.ReadCloser.Read(p)
+	if err == io.EOF {
+		b.release.release()
+	}
+	return n, err
+}
+
+func (b *poolBody) Close() error {
+	err := b.ReadCloser.Close()
+	b.release.release()
+	return err
+}
+
+func (t *poolTransport) stats() PoolStats {
+	open := int(atomic.LoadInt64(&t.open))
+	idle := open - int(atomic.LoadInt64(&t.inUse))
+	if idle < 0 {
+		idle = 0
+	}
+	return PoolStats{
+		OpenConnections: open,
+		IdleConnections: idle,
+		InFlight:        int(atomic.LoadInt64(&t.inFlight)),
+	}
+}
@@ -0,0 +1,12 @@
+// +build js
+
+package chttp
+
+import "net/http"
+
+// newBaseTransport returns the transport used by t. Connections are managed by
+// the browser or Node.js, so they are not counted, and only the InFlight
+// statistic is reported.
+func newBaseTransport(_ *poolTransport, _ PoolOptions) http.RoundTripper {
+	return http.DefaultTransport
+}
@@ -0,0 +1,80 @@
+// +build !js
+
+package chttp
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/flimzy/diff"
+)
+
+func TestPool(t *testing.T) {
+	var active, maxActive int32
+	release := make(chan struct{})
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n := atomic.AddInt32(&active, 1)
+		defer atomic.AddInt32(&active, -1)
+		for {
+			max := atomic.LoadInt32(&maxActive)
+			if n <= max || atomic.CompareAndSwapInt32(&maxActive, max, n) {
+				break
+			}
+		}
+		if r.URL.Path == "/slow" {
+			<-release
+		}
+		_, _ = w.Write([]byte(`{}`))
+	}))
+	defer s.Close()
+	c, err := NewWithPool(context.Background(), s.URL, PoolOptions{MaxIdleConns: 5, MaxConnsPerHost: 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			res, err := c.DoReq(context.Background(), "GET", "/slow", nil)
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			_, _ = ioutil.ReadAll(res.Body)
+			_ = res.Body.Close()
+		}()
+	}
+	for c.Stats().InFlight != 4 {
+		time.Sleep(time.Millisecond)
+	}
+	t.Run("Waiting", func(t *testing.T) {
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+		defer cancel()
+		if _, err := c.DoReq(ctx, "GET", "/", nil); err == nil {
+			t.Error("Expected request beyond MaxConnsPerHost to time out")
+		}
+	})
+	close(release)
+	wg.Wait()
+	if max := atomic.LoadInt32(&maxActive); max > 2 {
+		t.Errorf("%d concurrent requests exceeded MaxConnsPerHost", max)
+	}
+	stats := c.Stats()
+	if stats.OpenConnections == 0 {
+		t.Error("Expected open connections")
+	}
+	// A request may dial a new connection before an earlier one is returned to
+	// the idle pool, so
+	// the exact number of connections opened varies.
+	expected := PoolStats{OpenConnections: stats.OpenConnections, IdleConnections: stats.OpenConnections}
+	if d := diff.Interface(expected, stats); d != "" {
+		t.Error(d)
+	}
+}
@@ -0,0 +1,105 @@
+package chttp
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"time"
+
+	"github.com/flimzy/kivik"
+	"github.com/flimzy/kivik/errors"
+)
+
+// RetryOptions configures the retrying of failed requests.
+type RetryOptions struct {
+	// MaxRetries is the number of times a failed request is retried. Only
+	// failures for which errors.Retryable is true, such as network errors and
+	// 5xx responses, are retried. If zero, requests are not retried.
+	MaxRetries int
+	// Backoff is the delay before the first retry. It is doubled for each
+	// subsequent retry.
+	Backoff time.Duration
+	// BufferBodies buffers request bodies in memory, so that they may be
+	// resent. Without it, a request is retried only if its body is nil, an
+	// io.ReadSeeker, or provided by Options.GetBody.
+	BufferBodies bool
+}
+
+// idempotent returns true if a request may be resent without side effects.
+// POST requests are not, unless marked as such by Options.Idempotent.
+func idempotent(method string, opts *Options) bool {
+	if method != kivik.MethodPost {
+		return true
+	}
+	return opts != nil && opts.Idempotent
+}
+
+// bodyFunc returns a function which returns the request body for each
+// attempt, or nil if the request has no body. replayable is false if the body
+// cannot be resent.
+func (c *Client) bodyFunc(opts *Options) (getBody func() (io.Reader, error), replayable bool, err error) {
+	if opts == nil {
+		return nil, true, nil
+	}
+	if opts.GetBody != nil {
+		return opts.GetBody, true, nil
+	}
+	if opts.Body == nil {
+		return nil, true, nil
+	}
+	if seeker, ok := opts.Body.(io.ReadSeeker); ok {
+		start, err := seeker.Seek(0, io.SeekCurrent)
+		if err != nil {
+			return nil, false, err
+		}
+		var body io.Reader = seeker
+		if _, ok := seeker.(io.Closer); ok {
+			// Prevent the transport from closing the body after the first
+			// attempt.
+			body = struct{ io.Reader }{seeker}
+		}
+		return func() (io.Reader, error) {
+			_, err := seeker.Seek(start, io.SeekStart)
+			return body, err
+		}, true, nil
+	}
+	if c.Retry.MaxRetries > 0 && c.Retry.BufferBodies {
+		buf, err := ioutil.ReadAll(opts.Body)
+		if err != nil {
+			return nil, false, err
+		}
+		return func() (io.Reader, error) {
+			return bytes.NewReader(buf), nil
+		}, true, nil
+	}
+	body := opts.Body
+	return func() (io.Reader, error) {
+		return body, nil
+	}, false, nil
+}
+
+// retryable returns true if the result of a request warrants a retry.
+func retryable(res *http.Response, err error) bool {
+	if err != nil {
+		return errors.Retryable(err)
+	}
+	return errors.Retryable(&HTTPError{Code: res.StatusCode})
+}
+
+// wait waits before the given retry, or until ctx is done.
+func (c *Client) wait(ctx context.Context, retry int) error {
+	delay := c.Retry.Backoff << uint(retry)
+	if delay <= 0 {
+		return ctx.Err()
+	}
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
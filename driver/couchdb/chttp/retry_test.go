@@ -0,0 +1,116 @@
+// +build !js
+
+package chttp
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/flimzy/diff"
+)
+
+func TestRetry(t *testing.T) {
+	type tst struct {
+		method  string
+		opts    *Options
+		buffer  bool
+		retries int
+		// bodies are the request bodies received by the server
+		bodies []string
+		status int
+	}
+	tests := map[string]tst{
+		"NoBody": {
+			method: "GET",
+			bodies: []string{"", "", ""},
+			status: http.StatusOK,
+		},
+		"ReadSeeker": {
+			method: "PUT",
+			opts:   &Options{Body: bytes.NewReader([]byte("foo"))},
+			bodies: []string{"foo", "foo", "foo"},
+			status: http.StatusOK,
+		},
+		"GetBody": {
+			method: "PUT",
+			opts: &Options{GetBody: func() (io.Reader, error) {
+				return strings.NewReader("foo"), nil
+			}},
+			bodies: []string{"foo", "foo", "foo"},
+			status: http.StatusOK,
+		},
+		"Buffered": {
+			method: "PUT",
+			opts:   &Options{Body: struct{ io.Reader }{strings.NewReader("foo")}},
+			buffer: true,
+			bodies: []string{"foo", "foo", "foo"},
+			status: http.StatusOK,
+		},
+		"Unbuffered": {
+			method: "PUT",
+			opts:   &Options{Body: struct{ io.Reader }{strings.NewReader("foo")}},
+			bodies: []string{"foo"},
+			status: http.StatusServiceUnavailable,
+		},
+		"Post": {
+			method: "POST",
+			opts:   &Options{Body: strings.NewReader("foo")},
+			bodies: []string{"foo"},
+			status: http.StatusServiceUnavailable,
+		},
+		"IdempotentPost": {
+			method: "POST",
+			opts:   &Options{Body: strings.NewReader("foo"), Idempotent: true},
+			bodies: []string{"foo", "foo", "foo"},
+			status: http.StatusOK,
+		},
+		"TooManyFailures": {
+			method:  "GET",
+			retries: 1,
+			bodies:  []string{"", ""},
+			status:  http.StatusServiceUnavailable,
+		},
+	}
+	for name, test := range tests {
+		func(test tst) {
+			t.Run(name, func(t *testing.T) {
+				var bodies []string
+				s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+					body, _ := ioutil.ReadAll(r.Body)
+					bodies = append(bodies, string(body))
+					if len(bodies) < 3 {
+						w.WriteHeader(http.StatusServiceUnavailable)
+						return
+					}
+					_, _ = w.Write([]byte(`{}`))
+				}))
+				defer s.Close()
+				c, err := New(context.Background(), s.URL)
+				if err != nil {
+					t.Fatal(err)
+				}
+				c.Retry = RetryOptions{MaxRetries: 2, BufferBodies: test.buffer}
+				if test.retries > 0 {
+					c.Retry.MaxRetries = test.retries
+				}
+				res, err := c.DoReq(context.Background(), test.method, "/", test.opts)
+				if err != nil {
+					t.Fatal(err)
+				}
+				_ = res.Body.Close()
+				if res.StatusCode != test.status {
+					t.Errorf("Unexpected status: %d", res.StatusCode)
+				}
+				if d := diff.Interface(test.bodies, bodies); d != "" {
+					t.Error(d)
+				}
+			})
+		}(test)
+	}
+}
@@ -0,0 +1,116 @@
+package chttp
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// StickyOptions configures session affinity, which pins the requests of a
+// client to a single node of a cluster behind a load balancer, so that the
+// client reads its own writes, rather than those of a node to which they have
+// not yet propagated.
+type StickyOptions struct {
+	// Cookies are the names of the load balancer's affinity cookies, such as
+	// "SERVERID" for HAProxy, or "AWSALB" for an AWS load balancer. As set by
+	// responses, they are sent with each subsequent request, whether or not
+	// cookie auth is used. Under GopherJS, cookies are managed by the browser,
+	// and are not sent.
+	Cookies []string
+	// Header, if set, names a request header, such as "X-Couch-Session", sent
+	// with each request to identify the session, such that a load balancer may
+	// route by its value.
+	Header string
+	// Session is the value of Header. If empty, a random value unique to the
+	// client is used.
+	Session string
+}
+
+// session holds the affinity state of a client, shared by its anonymous
+// copies.
+type session struct {
+	mu      sync.Mutex
+	id      string
+	cookies map[string]*http.Cookie
+}
+
+// apply adds the affinity cookies and header of the session to req.
+func (s *session) apply(req *http.Request, opts StickyOptions) {
+	if len(opts.Cookies) == 0 && opts.Header == "" {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, name := range opts.Cookies {
+		if cookie, ok := s.cookies[name]; ok {
+			req.AddCookie(&http.Cookie{Name: cookie.Name, Value: cookie.Value})
+		}
+	}
+	if opts.Header == "" {
+		return
+	}
+	id := opts.Session
+	if id == "" {
+		if s.id == "" {
+			s.id = newSessionID()
+		}
+		id = s.id
+	}
+	req.Header.Set(opts.Header, id)
+}
+
+// update stores the affinity cookies set by res, and forgets those it expires.
+func (s *session) update(res *http.Response, opts StickyOptions) {
+	if res == nil || len(opts.Cookies) == 0 {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, cookie := range res.Cookies() {
+		if !contains(opts.Cookies, cookie.Name) {
+			continue
+		}
+		if cookie.MaxAge < 0 || (!cookie.Expires.IsZero() && cookie.Expires.Before(time.Now())) {
+			delete(s.cookies, cookie.Name)
+			continue
+		}
+		if s.cookies == nil {
+			s.cookies = make(map[string]*http.Cookie)
+		}
+		s.cookies[cookie.Name] = cookie
+	}
+}
+
+// reset forgets the affinity of the session.
+func (s *session) reset() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.id = ""
+	s.cookies = nil
+}
+
+// ResetSession forgets the node to which the client is pinned by c.Sticky,
+// such that the load balancer may choose another, for instance if the node
+// has failed. The random session header value, if used, is regenerated.
+func (c *Client) ResetSession() {
+	c.session.reset()
+}
+
+func newSessionID() string {
+	buf := make([]byte, 16)
+	if _, err := rand.Read(buf); err != nil {
+		panic(err)
+	}
+	return hex.EncodeToString(buf)
+}
+
+func contains(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,68 @@
+// +build !js
+
+package chttp
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/flimzy/diff"
+)
+
+func TestSticky(t *testing.T) {
+	var cookies, headers []string
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var cookie string
+		if c, err := r.Cookie("SERVERID"); err == nil {
+			cookie = c.Value
+		}
+		cookies = append(cookies, cookie)
+		headers = append(headers, r.Header.Get("X-Couch-Session"))
+		switch r.URL.Path {
+		case "/pin":
+			http.SetCookie(w, &http.Cookie{Name: "SERVERID", Value: "node1"})
+			http.SetCookie(w, &http.Cookie{Name: "other", Value: "x"})
+		case "/unpin":
+			http.SetCookie(w, &http.Cookie{Name: "SERVERID", MaxAge: -1})
+		}
+		_, _ = w.Write([]byte(`{}`))
+	}))
+	defer s.Close()
+	c, err := New(context.Background(), s.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c.Sticky = StickyOptions{Cookies: []string{"SERVERID"}, Header: "X-Couch-Session"}
+	do := func(c *Client, path string) {
+		res, err := c.DoReq(context.Background(), "GET", path, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		_ = res.Body.Close()
+	}
+	do(c, "/pin")
+	do(c, "/")
+	do(c.Anonymous(), "/")
+	do(c, "/unpin")
+	do(c, "/")
+	do(c, "/pin")
+	c.ResetSession()
+	do(c, "/")
+	if d := diff.Interface([]string{"", "node1", "node1", "node1", "", "", ""}, cookies); d != "" {
+		t.Error(d)
+	}
+	id := headers[0]
+	if len(id) != 32 {
+		t.Errorf("Unexpected session ID: %q", id)
+	}
+	for i, header := range headers[:6] {
+		if header != id {
+			t.Errorf("Request %d had session ID %q, expected %q", i, header, id)
+		}
+	}
+	if headers[6] == id || len(headers[6]) != 32 {
+		t.Errorf("Expected a new session ID after reset, got %q", headers[6])
+	}
+}
@@ -0,0 +1,183 @@
+// +build !js
+
+package chttp
+
+import (
+	"bufio"
+	"context"
+	"crypto/tls"
+	"encoding/base64"
+	"net"
+	"net/http"
+	"net/url"
+	"time"
+
+	"golang.org/x/net/websocket"
+
+	"github.com/flimzy/kivik"
+	"github.com/flimzy/kivik/errors"
+)
+
+// WebSocket opens a WebSocket connection to path on the server, with the
+// client's credentials. ctx applies to the opening handshake only; the caller
+// must close the connection when done with it. If the server refuses the
+// connection, the error is that of a plain GET request to path, if it fails,
+// so that, for example, a server which does not support WebSockets at path is
+// reported with its own status.
+func (c *Client) WebSocket(ctx context.Context, path string) (*websocket.Conn, error) {
+	req, err := c.NewRequest(ctx, kivik.MethodGet, path, nil)
+	if err != nil {
+		return nil, err
+	}
+	if c.Jar != nil {
+		for _, cookie := range c.Jar.Cookies(req.URL) {
+			req.AddCookie(cookie)
+		}
+	}
+	if a, ok := c.Transport.(*BasicAuth); ok {
+		req.SetBasicAuth(a.Username, a.Password)
+	}
+	location := *req.URL
+	origin := url.URL{Scheme: location.Scheme, Host: location.Host}
+	switch location.Scheme {
+	case "https":
+		location.Scheme = "wss"
+	default:
+		location.Scheme = "ws"
+	}
+	config, err := websocket.NewConfig(location.String(), origin.String())
+	if err != nil {
+		return nil, err
+	}
+	config.Header = req.Header
+	conn, err := dialWebSocket(ctx, httpTransport(c.Transport), req)
+	if err != nil {
+		return nil, err
+	}
+	if deadline, ok := ctx.Deadline(); ok {
+		_ = conn.SetDeadline(deadline)
+	}
+	ws, err := websocket.NewClient(config, conn)
+	if err != nil {
+		_ = conn.Close()
+		if _, reqErr := c.DoError(ctx, kivik.MethodGet, path, nil); reqErr != nil {
+			return nil, reqErr
+		}
+		return nil, errors.WrapStatus(kivik.StatusBadResponse, err)
+	}
+	_ = conn.SetDeadline(time.Time{})
+	return ws, nil
+}
+
+// httpTransport returns the *http.Transport beneath rt, through the transports
+// of the package which wrap it, or http.DefaultTransport, if rt is nil or some
+// other transport.
+func httpTransport(rt http.RoundTripper) *http.Transport {
+	for {
+		switch t := rt.(type) {
+		case *http.Transport:
+			return t
+		case *BasicAuth:
+			rt = t.transport
+		case *poolTransport:
+			rt = t.base
+		default:
+			if t, ok := http.DefaultTransport.(*http.Transport); ok {
+				return t
+			}
+			return &http.Transport{}
+		}
+	}
+}
+
+// dialWebSocket opens the connection of a WebSocket to the server of req, as
+// t would for req itself: through t's proxy, if any, with t's dialer, and with
+// a copy of t's TLS configuration, for https.
+func dialWebSocket(ctx context.Context, t *http.Transport, req *http.Request) (net.Conn, error) {
+	host, port, err := net.SplitHostPort(req.URL.Host)
+	if err != nil {
+		host, port = req.URL.Host, "80"
+		if req.URL.Scheme == "https" {
+			port = "443"
+		}
+	}
+	addr := net.JoinHostPort(host, port)
+	dial := t.DialContext
+	if dial == nil {
+		dial = (&net.Dialer{Timeout: 30 * time.Second}).DialContext
+	}
+	var proxyURL *url.URL
+	if t.Proxy != nil {
+		if proxyURL, err = t.Proxy(req); err != nil {
+			return nil, err
+		}
+	}
+	var conn net.Conn
+	if proxyURL != nil {
+		conn, err = dialProxy(ctx, dial, proxyURL, addr)
+	} else {
+		conn, err = dial(ctx, "tcp", addr)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if req.URL.Scheme != "https" {
+		return conn, nil
+	}
+	config := &tls.Config{}
+	if t.TLSClientConfig != nil {
+		config = t.TLSClientConfig.Clone()
+	}
+	if config.ServerName == "" {
+		config.ServerName = host
+	}
+	tlsConn := tls.Client(conn, config)
+	if err := tlsConn.Handshake(); err != nil {
+		_ = conn.Close()
+		return nil, err
+	}
+	return tlsConn, nil
+}
+
+// dialProxy opens a tunnel to addr through the HTTP proxy at proxyURL, with
+// the proxy credentials of proxyURL, if any.
+func dialProxy(ctx context.Context, dial func(context.Context, string, string) (net.Conn, error), proxyURL *url.URL, addr string) (net.Conn, error) {
+	if proxyURL.Scheme != "http" {
+		return nil, errors.Statusf(kivik.StatusNotImplemented, "unsupported proxy scheme %s", proxyURL.Scheme)
+	}
+	proxyAddr := proxyURL.Host
+	if _, _, err := net.SplitHostPort(proxyAddr); err != nil {
+		proxyAddr = net.JoinHostPort(proxyAddr, "80")
+	}
+	conn, err := dial(ctx, "tcp", proxyAddr)
+	if err != nil {
+		return nil, err
+	}
+	connect := &http.Request{
+		Method: "CONNECT",
+		URL:    &url.URL{Opaque: addr},
+		Host:   addr,
+		Header: make(http.Header),
+	}
+	if user := proxyURL.User; user != nil {
+		password, _ := user.Password()
+		credentials := base64.StdEncoding.EncodeToString([]byte(user.Username() + ":" + password))
+		connect.Header.Set("Proxy-Authorization", "Basic "+credentials)
+	}
+	if err := connect.Write(conn); err != nil {
+		_ = conn.Close()
+		return nil, err
+	}
+	res, err := http.ReadResponse(bufio.NewReader(conn), connect)
+	if err != nil {
+		_ = conn.Close()
+		return nil, err
+	}
+	// The body of a successful response is the tunnel itself, so it is left
+	// unread.
+	if res.StatusCode != http.StatusOK {
+		_ = conn.Close()
+		return nil, errors.Statusf(kivik.StatusBadResponse, "proxy refused the connection: %s", res.Status)
+	}
+	return conn, nil
+}
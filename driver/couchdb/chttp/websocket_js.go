@@ -0,0 +1,17 @@
+// +build js
+
+package chttp
+
+import (
+	"context"
+
+	"golang.org/x/net/websocket"
+
+	"github.com/flimzy/kivik"
+	"github.com/flimzy/kivik/errors"
+)
+
+// WebSocket is not supported by GopherJS.
+func (c *Client) WebSocket(_ context.Context, _ string) (*websocket.Conn, error) {
+	return nil, errors.Status(kivik.StatusNotImplemented, "kivik: WebSocket not supported by GopherJS")
+}
@@ -0,0 +1,127 @@
+// +build !js
+
+package chttp
+
+import (
+	"context"
+	"crypto/tls"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync/atomic"
+	"testing"
+
+	"golang.org/x/net/websocket"
+)
+
+func echoServer(tlsServer bool) *httptest.Server {
+	handler := websocket.Handler(func(ws *websocket.Conn) {
+		_, _ = io.Copy(ws, ws)
+	})
+	if tlsServer {
+		return httptest.NewTLSServer(handler)
+	}
+	return httptest.NewServer(handler)
+}
+
+func testEcho(t *testing.T, c *Client) {
+	ws, err := c.WebSocket(context.Background(), "/")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = ws.Close() }()
+	if err := websocket.Message.Send(ws, "foo"); err != nil {
+		t.Fatal(err)
+	}
+	var msg string
+	if err := websocket.Message.Receive(ws, &msg); err != nil {
+		t.Fatal(err)
+	}
+	if msg != "foo" {
+		t.Errorf("Unexpected message %q", msg)
+	}
+}
+
+func TestWebSocketTLS(t *testing.T) {
+	s := echoServer(true)
+	defer s.Close()
+	c, err := New(context.Background(), s.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Run("Untrusted", func(t *testing.T) {
+		if _, err := c.WebSocket(context.Background(), "/"); err == nil {
+			t.Error("Expected the server's certificate to be refused")
+		}
+	})
+	t.Run("InsecureSkipVerify", func(t *testing.T) {
+		var dials int32
+		c.Transport = &http.Transport{
+			TLSClientConfig: &tls.Config{InsecureSkipVerify: true},
+			DialContext: func(ctx context.Context, network, addr string) (net.Conn, error) {
+				atomic.AddInt32(&dials, 1)
+				return (&net.Dialer{}).DialContext(ctx, network, addr)
+			},
+		}
+		testEcho(t, c)
+		if atomic.LoadInt32(&dials) != 1 {
+			t.Errorf("Expected the transport's dialer to be used")
+		}
+	})
+}
+
+func TestWebSocketProxy(t *testing.T) {
+	s := echoServer(false)
+	defer s.Close()
+	var tunnels int32
+	proxy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != "CONNECT" || r.Header.Get("Proxy-Authorization") != "Basic Ym9iOmFiYzEyMw==" {
+			w.WriteHeader(http.StatusProxyAuthRequired)
+			return
+		}
+		upstream, err := net.Dial("tcp", r.Host)
+		if err != nil {
+			w.WriteHeader(http.StatusBadGateway)
+			return
+		}
+		atomic.AddInt32(&tunnels, 1)
+		w.WriteHeader(http.StatusOK)
+		conn, _, err := w.(http.Hijacker).Hijack()
+		if err != nil {
+			_ = upstream.Close()
+			return
+		}
+		go func() {
+			_, _ = io.Copy(upstream, conn)
+			_ = upstream.Close()
+		}()
+		_, _ = io.Copy(conn, upstream)
+		_ = conn.Close()
+	}))
+	defer proxy.Close()
+	proxyURL, err := url.Parse(proxy.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c, err := New(context.Background(), s.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Run("Refused", func(t *testing.T) {
+		c.Transport = &http.Transport{Proxy: http.ProxyURL(proxyURL)}
+		if _, err := c.WebSocket(context.Background(), "/"); err == nil {
+			t.Error("Expected the proxy to refuse the connection")
+		}
+	})
+	t.Run("Tunnel", func(t *testing.T) {
+		authURL := *proxyURL
+		authURL.User = url.UserPassword("bob", "abc123")
+		c.Transport = &http.Transport{Proxy: http.ProxyURL(&authURL)}
+		testEcho(t, c)
+		if atomic.LoadInt32(&tunnels) != 1 {
+			t.Errorf("Expected the connection to be made through the proxy")
+		}
+	})
+}
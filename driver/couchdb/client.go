@@ -4,6 +4,7 @@ import (
 	"context"
 
 	"github.com/flimzy/kivik"
+	"github.com/flimzy/kivik/driver/couchdb/chttp"
 	"github.com/flimzy/kivik/errors"
 )
 
@@ -14,7 +15,7 @@ func (c *client) AllDBs(ctx context.Context, _ map[string]interface{}) ([]string
 }
 
 func (c *client) DBExists(ctx context.Context, dbName string, _ map[string]interface{}) (bool, error) {
-	_, err := c.DoError(ctx, kivik.MethodHead, dbName, nil)
+	_, err := c.DoError(ctx, kivik.MethodHead, chttp.EncodeDBName(dbName), nil)
 	if errors.StatusCode(err) == kivik.StatusNotFound {
 		return false, nil
 	}
@@ -22,11 +23,11 @@ func (c *client) DBExists(ctx context.Context, dbName string, _ map[string]inter
 }
 
 func (c *client) CreateDB(ctx context.Context, dbName string, _ map[string]interface{}) error {
-	_, err := c.DoError(ctx, kivik.MethodPut, dbName, nil)
+	_, err := c.DoError(ctx, kivik.MethodPut, chttp.EncodeDBName(dbName), nil)
 	return err
 }
 
 func (c *client) DestroyDB(ctx context.Context, dbName string, _ map[string]interface{}) error {
-	_, err := c.DoError(ctx, kivik.MethodDelete, dbName, nil)
+	_, err := c.DoError(ctx, kivik.MethodDelete, chttp.EncodeDBName(dbName), nil)
 	return err
 }
@@ -0,0 +1,43 @@
+package couchdb
+
+import (
+	"context"
+	"net/url"
+	"strings"
+
+	"github.com/flimzy/kivik"
+	"github.com/flimzy/kivik/driver"
+	"github.com/flimzy/kivik/driver/couchdb/chttp"
+)
+
+var _ driver.Clusterer = &client{}
+
+func (c *client) Membership(ctx context.Context) (*driver.Membership, error) {
+	membership := &driver.Membership{}
+	_, err := c.DoJSON(ctx, kivik.MethodGet, "/_membership", nil, membership)
+	return membership, err
+}
+
+// nodePath returns the path of the node's document in the _nodes database of
+// the local node.
+func nodePath(node string) string {
+	return "/_node/" + kivik.LocalNode + "/_nodes/" + url.QueryEscape(node)
+}
+
+func (c *client) AddNode(ctx context.Context, node string) error {
+	opts := &chttp.Options{Body: strings.NewReader("{}")}
+	_, err := c.DoError(ctx, kivik.MethodPut, nodePath(node), opts)
+	return err
+}
+
+func (c *client) RemoveNode(ctx context.Context, node string) error {
+	var doc struct {
+		Rev string `json:"_rev"`
+	}
+	if _, err := c.DoJSON(ctx, kivik.MethodGet, nodePath(node), nil, &doc); err != nil {
+		return err
+	}
+	query := url.Values{"rev": []string{doc.Rev}}
+	_, err := c.DoError(ctx, kivik.MethodDelete, nodePath(node)+"?"+query.Encode(), nil)
+	return err
+}
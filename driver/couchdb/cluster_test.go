@@ -0,0 +1,63 @@
+// +build !js
+
+package couchdb
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/flimzy/diff"
+	"github.com/flimzy/kivik"
+	"github.com/flimzy/kivik/driver"
+)
+
+func TestCluster(t *testing.T) {
+	var requests []string
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests = append(requests, r.Method+" "+r.URL.String())
+		w.Header().Set("Content-Type", "application/json")
+		switch {
+		case r.URL.Path == "/_membership":
+			_, _ = w.Write([]byte(`{"all_nodes":["a@x","b@x"],"cluster_nodes":["a@x"]}`))
+		case r.Method == kivik.MethodGet && r.URL.Path == "/_node/_local/_nodes/b@x":
+			_, _ = w.Write([]byte(`{"_id":"b@x","_rev":"1-abc"}`))
+		case r.URL.Path == "/_node/_local/_nodes/b@x":
+			w.WriteHeader(http.StatusCreated)
+			_, _ = w.Write([]byte(`{"ok":true}`))
+		default:
+			_, _ = w.Write([]byte(`{"couchdb":"Welcome","version":"2.0.0"}`))
+		}
+	}))
+	defer s.Close()
+	dc, err := (&Couch{}).NewClient(context.Background(), s.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c := dc.(*client)
+	requests = nil
+	membership, err := c.Membership(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := &driver.Membership{AllNodes: []string{"a@x", "b@x"}, ClusterNodes: []string{"a@x"}}
+	if d := diff.Interface(expected, membership); d != "" {
+		t.Error(d)
+	}
+	if err = c.AddNode(context.Background(), "b@x"); err != nil {
+		t.Fatal(err)
+	}
+	if err = c.RemoveNode(context.Background(), "b@x"); err != nil {
+		t.Fatal(err)
+	}
+	expectedRequests := []string{
+		"GET /_membership",
+		"PUT /_node/_local/_nodes/b%40x",
+		"GET /_node/_local/_nodes/b%40x",
+		"DELETE /_node/_local/_nodes/b%40x?rev=1-abc",
+	}
+	if d := diff.Interface(expectedRequests, requests); d != "" {
+		t.Error(d)
+	}
+}
@@ -0,0 +1,69 @@
+package couchdb
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/url"
+
+	"github.com/flimzy/kivik"
+	"github.com/flimzy/kivik/driver"
+	"github.com/flimzy/kivik/driver/couchdb/chttp"
+)
+
+var _ driver.Configer = &client{}
+
+// configPath returns the path of the config endpoint of node, followed by the
+// escaped parts. CouchDB 1.x serves the config at /_config. CouchDB 2.x serves
+// it per node, at /_node/{node}/_config, where the node _local means the node
+// the client is connected to.
+func (c *client) configPath(node string, parts ...string) string {
+	var path string
+	if c.Compat == CompatCouch16 && (node == "" || node == kivik.LocalNode) {
+		path = "/_config"
+	} else {
+		if node == "" {
+			node = kivik.LocalNode
+		}
+		path = "/_node/" + url.QueryEscape(node) + "/_config"
+	}
+	for _, part := range parts {
+		path += "/" + url.QueryEscape(part)
+	}
+	return path
+}
+
+func (c *client) Config(ctx context.Context, node string) (driver.Config, error) {
+	var config driver.Config
+	_, err := c.DoJSON(ctx, kivik.MethodGet, c.configPath(node), nil, &config)
+	return config, err
+}
+
+func (c *client) ConfigSection(ctx context.Context, node, section string) (driver.ConfigSection, error) {
+	var sec driver.ConfigSection
+	_, err := c.DoJSON(ctx, kivik.MethodGet, c.configPath(node, section), nil, &sec)
+	return sec, err
+}
+
+func (c *client) ConfigValue(ctx context.Context, node, section, key string) (string, error) {
+	var value string
+	_, err := c.DoJSON(ctx, kivik.MethodGet, c.configPath(node, section, key), nil, &value)
+	return value, err
+}
+
+func (c *client) SetConfigValue(ctx context.Context, node, section, key, value string) (string, error) {
+	body, err := json.Marshal(value)
+	if err != nil {
+		return "", err
+	}
+	var old string
+	opts := &chttp.Options{Body: bytes.NewReader(body)}
+	_, err = c.DoJSON(ctx, kivik.MethodPut, c.configPath(node, section, key), opts, &old)
+	return old, err
+}
+
+func (c *client) DeleteConfigKey(ctx context.Context, node, section, key string) (string, error) {
+	var old string
+	_, err := c.DoJSON(ctx, kivik.MethodDelete, c.configPath(node, section, key), nil, &old)
+	return old, err
+}
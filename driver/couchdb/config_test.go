@@ -0,0 +1,53 @@
+package couchdb
+
+import "testing"
+
+func TestConfigPath(t *testing.T) {
+	tests := []struct {
+		name     string
+		compat   CompatMode
+		node     string
+		parts    []string
+		expected string
+	}{
+		{
+			name:     "Couch16",
+			compat:   CompatCouch16,
+			expected: "/_config",
+		},
+		{
+			name:     "Couch16Local",
+			compat:   CompatCouch16,
+			node:     "_local",
+			parts:    []string{"httpd", "port"},
+			expected: "/_config/httpd/port",
+		},
+		{
+			name:     "Couch20Default",
+			compat:   CompatCouch20,
+			parts:    []string{"httpd"},
+			expected: "/_node/_local/_config/httpd",
+		},
+		{
+			name:     "UnknownNamedNode",
+			node:     "couchdb@127.0.0.1",
+			parts:    []string{"log", "level"},
+			expected: "/_node/couchdb%40127.0.0.1/_config/log/level",
+		},
+		{
+			name:     "EscapedKey",
+			compat:   CompatCouch20,
+			node:     "_local",
+			parts:    []string{"admins", "some user"},
+			expected: "/_node/_local/_config/admins/some+user",
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			c := &client{Compat: test.compat}
+			if path := c.configPath(test.node, test.parts...); path != test.expected {
+				t.Errorf("Expected %s, got %s", test.expected, path)
+			}
+		})
+	}
+}
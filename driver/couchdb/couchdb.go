@@ -17,8 +17,25 @@ const (
 	typeMixed = "multipart/mixed"
 )
 
-// Couch represents the parent driver instance.
-type Couch struct{}
+// Couch represents the parent driver instance. The driver registered as
+// "couch" uses the default connection pool. To configure the pool, register
+// another instance:
+//
+//	kivik.Register("couch-pooled", &couchdb.Couch{
+//	    Pool: chttp.PoolOptions{MaxConnsPerHost: 10},
+//	})
+type Couch struct {
+	// Pool configures the connection pool of each client.
+	Pool chttp.PoolOptions
+	// Retry configures the retrying of failed requests. Document bodies are
+	// streamed as they are encoded, so Retry.BufferBodies must be set for
+	// writes to be retried.
+	Retry chttp.RetryOptions
+	// Sticky configures the session affinity of each client, which pins its
+	// requests to a single node of a cluster behind a load balancer, so that
+	// the client reads its own writes. Each client is its own session.
+	Sticky chttp.StickyOptions
+}
 
 var _ driver.Driver = &Couch{}
 
@@ -48,6 +65,8 @@ type client struct {
 }
 
 var _ driver.Client = &client{}
+var _ driver.PoolStatser = &client{}
+var _ driver.AdminPartyChecker = &client{}
 
 // NewClient establishes a new connection to a CouchDB server instance. If
 // auth credentials are included in the URL, they are used to authenticate using
@@ -55,10 +74,12 @@ var _ driver.Client = &client{}
 // different auth mechanism, do not specify credentials here, and instead call
 // Authenticate() later.
 func (d *Couch) NewClient(ctx context.Context, dsn string) (driver.Client, error) {
-	chttpClient, err := chttp.New(ctx, dsn)
+	chttpClient, err := chttp.NewWithPool(ctx, dsn, d.Pool)
 	if err != nil {
 		return nil, err
 	}
+	chttpClient.Retry = d.Retry
+	chttpClient.Sticky = d.Sticky
 	c := &client{
 		Client: chttpClient,
 	}
@@ -66,6 +87,16 @@ func (d *Couch) NewClient(ctx context.Context, dsn string) (driver.Client, error
 	return c, nil
 }
 
+// PoolStats returns the state of the client's connection pool.
+func (c *client) PoolStats() (driver.PoolStats, error) {
+	stats := c.Client.Stats()
+	return driver.PoolStats{
+		OpenConnections: stats.OpenConnections,
+		IdleConnections: stats.IdleConnections,
+		InFlight:        stats.InFlight,
+	}, nil
+}
+
 func (c *client) setCompatMode(ctx context.Context) {
 	info, err := c.Version(ctx)
 	if err != nil {
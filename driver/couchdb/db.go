@@ -13,6 +13,7 @@ import (
 	"github.com/flimzy/kivik"
 	"github.com/flimzy/kivik/driver"
 	"github.com/flimzy/kivik/driver/couchdb/chttp"
+	"github.com/flimzy/kivik/errors"
 )
 
 type db struct {
@@ -22,7 +23,7 @@ type db struct {
 }
 
 func (d *db) path(path string, query url.Values) string {
-	url, _ := url.Parse(d.dbName + "/" + strings.TrimPrefix(path, "/"))
+	url, _ := url.Parse(chttp.EncodeDBName(d.dbName) + "/" + strings.TrimPrefix(path, "/"))
 	if query != nil {
 		url.RawQuery = query.Encode()
 	}
@@ -39,6 +40,10 @@ func optionsToParams(opts ...map[string]interface{}) (url.Values, error) {
 				values = []string{v}
 			case []string:
 				values = v
+			case kivik.SequenceID:
+				values = []string{string(v)}
+			case driver.SequenceID:
+				values = []string{string(v)}
 			case bool:
 				values = []string{fmt.Sprintf("%t", v)}
 			case int, uint, uint8, uint16, uint32, uint64, int8, int16, int32, int64:
@@ -54,13 +59,32 @@ func optionsToParams(opts ...map[string]interface{}) (url.Values, error) {
 	return params, nil
 }
 
-// rowsQuery performs a query that returns a rows iterator.
+// rowsQuery performs a query that returns a rows iterator. A keys option is
+// sent in the body of a POST request, rather than in the URL, which would
+// otherwise limit the number of keys.
 func (d *db) rowsQuery(ctx context.Context, path string, opts map[string]interface{}) (driver.Rows, error) {
+	keys, hasKeys := opts["keys"]
+	if hasKeys {
+		params := make(map[string]interface{}, len(opts))
+		for k, v := range opts {
+			params[k] = v
+		}
+		delete(params, "keys")
+		opts = params
+	}
 	options, err := optionsToParams(opts)
 	if err != nil {
 		return nil, err
 	}
-	resp, err := d.Client.DoReq(ctx, kivik.MethodGet, d.path(path, options), nil)
+	method, reqOpts := kivik.MethodGet, (*chttp.Options)(nil)
+	if hasKeys {
+		body, err := keysBody(keys)
+		if err != nil {
+			return nil, err
+		}
+		method, reqOpts = kivik.MethodPost, &chttp.Options{Body: body, Idempotent: true}
+	}
+	resp, err := d.Client.DoReq(ctx, method, d.path(path, options), reqOpts)
 	if err != nil {
 		return nil, err
 	}
@@ -70,6 +94,24 @@ func (d *db) rowsQuery(ctx context.Context, path string, opts map[string]interfa
 	return newRows(resp.Body), nil
 }
 
+// keysBody returns the body of a POST request for keys, which may already be
+// JSON encoded, as by kivik.EncodeKey.
+func keysBody(keys interface{}) (io.Reader, error) {
+	encoded, ok := keys.(string)
+	if !ok {
+		raw, err := kivik.JSON().Marshal(keys)
+		if err != nil {
+			return nil, errors.WrapStatus(kivik.StatusBadRequest, err)
+		}
+		encoded = string(raw)
+	}
+	var array []json.RawMessage
+	if err := json.Unmarshal([]byte(encoded), &array); err != nil {
+		return nil, errors.Statusf(kivik.StatusBadRequest, "keys must be a JSON array: %s", encoded)
+	}
+	return strings.NewReader(`{"keys":` + encoded + `}`), nil
+}
+
 // jsonify converts a string, []byte, json.RawMessage, or an arbitrary type into
 // an io.Reader of JSON marshaled data.
 func jsonify(i interface{}) (io.Reader, error) {
@@ -81,9 +123,8 @@ func jsonify(i interface{}) (io.Reader, error) {
 	case json.RawMessage:
 		return bytes.NewReader(t), nil
 	default:
-		buf := &bytes.Buffer{}
-		err := json.NewEncoder(buf).Encode(i)
-		return buf, err
+		body, err := kivik.JSON().Marshal(i)
+		return bytes.NewReader(body), err
 	}
 }
 
@@ -116,7 +157,35 @@ func (d *db) Get(ctx context.Context, docID string, opts map[string]interface{})
 	return doc.Bytes(), nil
 }
 
+// GetBody streams the requested document.
+func (d *db) GetBody(ctx context.Context, docID string, opts map[string]interface{}) (io.ReadCloser, error) {
+	params, err := optionsToParams(opts)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := d.Client.DoReq(ctx, http.MethodGet, d.path(chttp.EncodeDocID(docID), params), &chttp.Options{Accept: typeJSON})
+	if err != nil {
+		return nil, err
+	}
+	if err = chttp.ResponseError(resp); err != nil {
+		return nil, err
+	}
+	return resp.Body, nil
+}
+
 func (d *db) CreateDoc(ctx context.Context, doc interface{}) (docID, rev string, err error) {
+	return d.CreateDocOpts(ctx, doc, nil)
+}
+
+func (d *db) CreateDocOpts(ctx context.Context, doc interface{}, options map[string]interface{}) (docID, rev string, err error) {
+	params, err := optionsToParams(options)
+	if err != nil {
+		return "", "", err
+	}
+	path := chttp.EncodeDBName(d.dbName)
+	if len(params) > 0 {
+		path += "?" + params.Encode()
+	}
 	result := struct {
 		ID  string `json:"id"`
 		Rev string `json:"rev"`
@@ -129,7 +198,7 @@ func (d *db) CreateDoc(ctx context.Context, doc interface{}) (docID, rev string,
 		Body:        body,
 		ForceCommit: d.forceCommit,
 	}
-	_, err = d.Client.DoJSON(ctx, kivik.MethodPost, d.dbName, opts, &result)
+	_, err = d.Client.DoJSON(ctx, kivik.MethodPost, path, opts, &result)
 	if jsonErr := errFunc(); jsonErr != nil {
 		return "", "", jsonErr
 	}
@@ -137,6 +206,14 @@ func (d *db) CreateDoc(ctx context.Context, doc interface{}) (docID, rev string,
 }
 
 func (d *db) Put(ctx context.Context, docID string, doc interface{}) (rev string, err error) {
+	return d.PutOpts(ctx, docID, doc, nil)
+}
+
+func (d *db) PutOpts(ctx context.Context, docID string, doc interface{}, options map[string]interface{}) (rev string, err error) {
+	params, err := optionsToParams(options)
+	if err != nil {
+		return "", err
+	}
 	var cancel context.CancelFunc
 	ctx, cancel = context.WithCancel(ctx)
 	defer cancel()
@@ -149,7 +226,7 @@ func (d *db) Put(ctx context.Context, docID string, doc interface{}) (rev string
 		ID  string `json:"id"`
 		Rev string `json:"rev"`
 	}
-	_, err = d.Client.DoJSON(ctx, kivik.MethodPut, d.path(chttp.EncodeDocID(docID), nil), opts, &result)
+	_, err = d.Client.DoJSON(ctx, kivik.MethodPut, d.path(chttp.EncodeDocID(docID), params), opts, &result)
 	if jsonErr := errFunc(); jsonErr != nil {
 		return "", jsonErr
 	}
@@ -164,7 +241,14 @@ func (d *db) Put(ctx context.Context, docID string, doc interface{}) (rev string
 }
 
 func (d *db) Delete(ctx context.Context, docID, rev string) (string, error) {
-	query := url.Values{}
+	return d.DeleteOpts(ctx, docID, rev, nil)
+}
+
+func (d *db) DeleteOpts(ctx context.Context, docID, rev string, options map[string]interface{}) (string, error) {
+	query, err := optionsToParams(options)
+	if err != nil {
+		return "", err
+	}
 	query.Add("rev", rev)
 	opts := &chttp.Options{
 		ForceCommit: d.forceCommit,
@@ -177,6 +261,12 @@ func (d *db) Delete(ctx context.Context, docID, rev string) (string, error) {
 	return chttp.GetRev(resp)
 }
 
+// SupportsQuorum returns true. CouchDB 1.x ignores the r and w options, as it
+// keeps only a single copy of each document.
+func (d *db) SupportsQuorum() bool {
+	return true
+}
+
 func (d *db) Flush(ctx context.Context) error {
 	_, err := d.Client.DoError(ctx, kivik.MethodPost, d.path("/_ensure_full_commit", nil), nil)
 	return err
@@ -192,7 +282,7 @@ func (d *db) Stats(ctx context.Context) (*driver.DBStats, error) {
 		} `json:"sizes"`
 		UpdateSeq json.RawMessage `json:"update_seq"`
 	}{}
-	_, err := d.Client.DoJSON(ctx, kivik.MethodGet, d.dbName, nil, &result)
+	_, err := d.Client.DoJSON(ctx, kivik.MethodGet, chttp.EncodeDBName(d.dbName), nil, &result)
 	stats := result.DBStats
 	if result.Sizes.File > 0 {
 		stats.DiskSize = result.Sizes.File
@@ -284,3 +374,43 @@ func (d *db) Copy(ctx context.Context, targetID, sourceID string, options map[st
 	defer resp.Body.Close()
 	return chttp.GetRev(resp)
 }
+
+func (d *db) GetOpenRevs(ctx context.Context, docID string, revs []string, opts map[string]interface{}) ([]driver.OpenRev, error) {
+	params, err := optionsToParams(opts)
+	if err != nil {
+		return nil, err
+	}
+	if revs == nil {
+		params.Set("open_revs", "all")
+	} else {
+		openRevs, e := json.Marshal(revs)
+		if e != nil {
+			return nil, e
+		}
+		params.Set("open_revs", string(openRevs))
+	}
+	var result []struct {
+		OK      json.RawMessage `json:"ok"`
+		Missing string          `json:"missing"`
+	}
+	// Without an explicit Accept header, CouchDB returns multipart/mixed.
+	chttpOpts := &chttp.Options{Accept: "application/json"}
+	if _, err = d.Client.DoJSON(ctx, kivik.MethodGet, d.path(chttp.EncodeDocID(docID), params), chttpOpts, &result); err != nil {
+		return nil, err
+	}
+	openRevs := make([]driver.OpenRev, len(result))
+	for i, r := range result {
+		if r.OK == nil {
+			openRevs[i].Rev = r.Missing
+			continue
+		}
+		var doc struct {
+			Rev string `json:"_rev"`
+		}
+		if err = json.Unmarshal(r.OK, &doc); err != nil {
+			return nil, err
+		}
+		openRevs[i] = driver.OpenRev{Rev: doc.Rev, Doc: r.OK}
+	}
+	return openRevs, nil
+}
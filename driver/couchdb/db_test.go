@@ -81,6 +81,11 @@ func TestOptionsToParams(t *testing.T) {
 			Input:    map[string]interface{}{"foo": 123},
 			Expected: map[string][]string{"foo": {"123"}},
 		},
+		{
+			Name:     "SequenceID",
+			Input:    map[string]interface{}{"since": kivik.SequenceID("1-abc")},
+			Expected: map[string][]string{"since": {"1-abc"}},
+		},
 		{
 			Name:  "Error",
 			Input: map[string]interface{}{"foo": []byte("foo")},
@@ -0,0 +1,65 @@
+// +build !js
+
+package couchdb
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/flimzy/diff"
+	"github.com/flimzy/kivik"
+)
+
+func TestDBNameEncoding(t *testing.T) {
+	var requests []string
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests = append(requests, r.Method+" "+r.URL.EscapedPath())
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(`{"ok":true,"id":"doc","rev":"1-abc","couchdb":"Welcome","version":"2.0.0"}`))
+	}))
+	defer s.Close()
+	ctx := context.Background()
+	dc, err := (&Couch{}).NewClient(ctx, s.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	requests = nil
+	for _, dbName := range []string{"foo/bar", "_users"} {
+		if err = dc.CreateDB(ctx, dbName, nil); err != nil {
+			t.Fatal(err)
+		}
+		if _, err = dc.DBExists(ctx, dbName, nil); err != nil {
+			t.Fatal(err)
+		}
+		db, err := dc.DB(ctx, dbName, kivik.Options{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err = db.Put(ctx, "doc", map[string]string{}); err != nil {
+			t.Fatal(err)
+		}
+		if _, _, err = db.CreateDoc(ctx, map[string]string{}); err != nil {
+			t.Fatal(err)
+		}
+		if err = dc.DestroyDB(ctx, dbName, nil); err != nil {
+			t.Fatal(err)
+		}
+	}
+	expected := []string{
+		"PUT /foo%2Fbar",
+		"HEAD /foo%2Fbar",
+		"PUT /foo%2Fbar/doc",
+		"POST /foo%2Fbar",
+		"DELETE /foo%2Fbar",
+		"PUT /_users",
+		"HEAD /_users",
+		"PUT /_users/doc",
+		"POST /_users",
+		"DELETE /_users",
+	}
+	if d := diff.Interface(expected, requests); d != "" {
+		t.Error(d)
+	}
+}
@@ -0,0 +1,60 @@
+package couchdb
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+
+	"github.com/flimzy/kivik"
+	"github.com/flimzy/kivik/driver"
+)
+
+var _ driver.DesignInfoer = &db{}
+
+func (d *db) DesignInfo(ctx context.Context, ddoc string) (*driver.DesignInfo, error) {
+	var result struct {
+		Name      string `json:"name"`
+		ViewIndex struct {
+			Language       string          `json:"language"`
+			Signature      string          `json:"signature"`
+			CompactRunning bool            `json:"compact_running"`
+			UpdaterRunning bool            `json:"updater_running"`
+			WaitingClients int64           `json:"waiting_clients"`
+			WaitingCommit  bool            `json:"waiting_commit"`
+			UpdateSeq      json.RawMessage `json:"update_seq"`
+			PurgeSeq       json.RawMessage `json:"purge_seq"`
+			DiskSize       int64           `json:"disk_size"`
+			DataSize       int64           `json:"data_size"`
+			Sizes          struct {
+				File     int64 `json:"file"`
+				External int64 `json:"external"`
+				Active   int64 `json:"active"`
+			} `json:"sizes"`
+		} `json:"view_index"`
+	}
+	if _, err := d.Client.DoJSON(ctx, kivik.MethodGet, d.path("/_design/"+ddoc+"/_info", nil), nil, &result); err != nil {
+		return nil, err
+	}
+	index := result.ViewIndex
+	info := &driver.DesignInfo{
+		Name:           result.Name,
+		Language:       index.Language,
+		Signature:      index.Signature,
+		CompactRunning: index.CompactRunning,
+		UpdaterRunning: index.UpdaterRunning,
+		WaitingClients: index.WaitingClients,
+		WaitingCommit:  index.WaitingCommit,
+		UpdateSeq:      string(bytes.Trim(index.UpdateSeq, `"`)),
+		PurgeSeq:       string(bytes.Trim(index.PurgeSeq, `"`)),
+		DiskSize:       index.DiskSize,
+		ActiveSize:     index.DataSize,
+	}
+	if index.Sizes.File > 0 {
+		info.DiskSize = index.Sizes.File
+	}
+	if index.Sizes.Active > 0 {
+		info.ActiveSize = index.Sizes.Active
+	}
+	info.ExternalSize = index.Sizes.External
+	return info, nil
+}
@@ -0,0 +1,85 @@
+// +build !js
+
+package couchdb
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/flimzy/diff"
+	"github.com/flimzy/kivik/driver"
+)
+
+func TestDesignInfo(t *testing.T) {
+	tests := []struct {
+		name     string
+		body     string
+		expected *driver.DesignInfo
+	}{
+		{
+			name: "CouchDB2",
+			body: `{"name":"foo","view_index":{"compact_running":false,"language":"javascript","purge_seq":0,` +
+				`"signature":"a1b2","sizes":{"active":100,"external":50,"file":400},"update_seq":"12-g1AAAA",` +
+				`"updater_running":true,"waiting_clients":2,"waiting_commit":false}}`,
+			expected: &driver.DesignInfo{
+				Name:           "foo",
+				Language:       "javascript",
+				Signature:      "a1b2",
+				UpdaterRunning: true,
+				WaitingClients: 2,
+				UpdateSeq:      "12-g1AAAA",
+				PurgeSeq:       "0",
+				DiskSize:       400,
+				ActiveSize:     100,
+				ExternalSize:   50,
+			},
+		},
+		{
+			name: "CouchDB1",
+			body: `{"name":"foo","view_index":{"compact_running":true,"data_size":100,"disk_size":400,` +
+				`"language":"javascript","purge_seq":0,"signature":"a1b2","update_seq":12,` +
+				`"updater_running":false,"waiting_clients":0,"waiting_commit":false}}`,
+			expected: &driver.DesignInfo{
+				Name:           "foo",
+				Language:       "javascript",
+				Signature:      "a1b2",
+				CompactRunning: true,
+				UpdateSeq:      "12",
+				PurgeSeq:       "0",
+				DiskSize:       400,
+				ActiveSize:     100,
+			},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var path string
+			s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				path = r.URL.Path
+				w.Header().Set("Content-Type", "application/json")
+				_, _ = w.Write([]byte(test.body))
+			}))
+			defer s.Close()
+			dc, err := (&Couch{}).NewClient(context.Background(), s.URL)
+			if err != nil {
+				t.Fatal(err)
+			}
+			db, err := dc.DB(context.Background(), "db", nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			info, err := db.(driver.DesignInfoer).DesignInfo(context.Background(), "foo")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if path != "/db/_design/foo/_info" {
+				t.Errorf("Unexpected path %s", path)
+			}
+			if d := diff.Interface(test.expected, info); d != "" {
+				t.Error(d)
+			}
+		})
+	}
+}
@@ -12,6 +12,8 @@ import (
 	"github.com/flimzy/kivik/errors"
 )
 
+var _ driver.Explainer = &db{}
+
 // deJSONify unmarshals a string, []byte, or json.RawMessage. All other types
 // are returned as-is.
 func deJSONify(i interface{}) (interface{}, error) {
@@ -83,7 +85,7 @@ func (d *db) Find(ctx context.Context, query interface{}) (driver.Rows, error) {
 	if err != nil {
 		return nil, err
 	}
-	resp, err := d.Client.DoReq(ctx, kivik.MethodPost, d.path("_find", nil), &chttp.Options{Body: body})
+	resp, err := d.Client.DoReq(ctx, kivik.MethodPost, d.path("_find", nil), &chttp.Options{Body: body, Idempotent: true})
 	if err != nil {
 		return nil, err
 	}
@@ -92,3 +94,16 @@ func (d *db) Find(ctx context.Context, query interface{}) (driver.Rows, error) {
 	}
 	return newRows(resp.Body), nil
 }
+
+func (d *db) Explain(ctx context.Context, query interface{}) (*driver.QueryPlan, error) {
+	if d.client.Compat == CompatCouch16 {
+		return nil, findNotImplemented
+	}
+	body, err := jsonify(query)
+	if err != nil {
+		return nil, err
+	}
+	var plan driver.QueryPlan
+	_, err = d.Client.DoJSON(ctx, kivik.MethodPost, d.path("_explain", nil), &chttp.Options{Body: body, Idempotent: true}, &plan)
+	return &plan, err
+}
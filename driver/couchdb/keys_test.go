@@ -0,0 +1,82 @@
+// +build !js
+
+package couchdb
+
+import (
+	"context"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/flimzy/kivik/driver"
+)
+
+func TestAllDocsKeys(t *testing.T) {
+	tests := []struct {
+		name   string
+		keys   interface{}
+		method string
+		body   string
+	}{
+		{
+			name:   "NoKeys",
+			method: http.MethodGet,
+		},
+		{
+			name:   "Encoded",
+			keys:   `["foo","bar"]`,
+			method: http.MethodPost,
+			body:   `{"keys":["foo","bar"]}`,
+		},
+		{
+			name:   "Slice",
+			keys:   []string{"foo", "bar"},
+			method: http.MethodPost,
+			body:   `{"keys":["foo","bar"]}`,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var method, query, body string
+			s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				method, query = r.Method, r.URL.RawQuery
+				b, _ := ioutil.ReadAll(r.Body)
+				body = string(b)
+				w.Header().Set("Content-Type", "application/json")
+				_, _ = w.Write([]byte(`{"total_rows":2,"offset":0,"rows":[]}`))
+			}))
+			defer s.Close()
+			dc, err := (&Couch{}).NewClient(context.Background(), s.URL)
+			if err != nil {
+				t.Fatal(err)
+			}
+			db, err := dc.DB(context.Background(), "db", nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			opts := map[string]interface{}{"include_docs": true}
+			if test.keys != nil {
+				opts["keys"] = test.keys
+			}
+			rows, err := db.AllDocs(context.Background(), opts)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := rows.Next(&driver.Row{}); err != io.EOF {
+				t.Errorf("Expected EOF, got %v", err)
+			}
+			_ = rows.Close()
+			if method != test.method {
+				t.Errorf("Expected method %s, got %s", test.method, method)
+			}
+			if query != "include_docs=true" {
+				t.Errorf("Unexpected query: %s", query)
+			}
+			if body != test.body {
+				t.Errorf("Unexpected body: %s", body)
+			}
+		})
+	}
+}
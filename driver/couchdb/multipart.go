@@ -0,0 +1,140 @@
+package couchdb
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"mime/multipart"
+	"net/textproto"
+	"sort"
+
+	"github.com/flimzy/kivik"
+	"github.com/flimzy/kivik/driver"
+	"github.com/flimzy/kivik/driver/couchdb/chttp"
+	"github.com/flimzy/kivik/errors"
+)
+
+const typeRelated = "multipart/related"
+
+var _ driver.MultipartPutter = &db{}
+
+// PutMultipart stores doc and atts with a multipart/related request, whose
+// first part is the document, and whose other parts are the content of the
+// attachments, which is streamed from atts.
+func (d *db) PutMultipart(ctx context.Context, docID string, doc interface{}, atts []driver.MultipartAttachment, options map[string]interface{}) (rev string, err error) {
+	params, err := optionsToParams(options)
+	if err != nil {
+		return "", err
+	}
+	body, err := multipartDoc(doc, atts)
+	if err != nil {
+		return "", err
+	}
+	var cancel context.CancelFunc
+	ctx, cancel = context.WithCancel(ctx)
+	defer cancel()
+	r, w := io.Pipe()
+	mw := multipart.NewWriter(w)
+	errChan := make(chan error, 1)
+	go func() {
+		err := writeMultipart(mw, body, atts)
+		if err != nil {
+			cancel()
+		}
+		errChan <- err
+		_ = w.CloseWithError(err)
+	}()
+	opts := &chttp.Options{
+		Body:        r,
+		ContentType: fmt.Sprintf("%s; boundary=%q", typeRelated, mw.Boundary()),
+		ForceCommit: d.forceCommit,
+	}
+	var result struct {
+		Rev string `json:"rev"`
+	}
+	_, err = d.Client.DoJSON(ctx, kivik.MethodPut, d.path(chttp.EncodeDocID(docID), params), opts, &result)
+	// Unblock the writer, if the request failed before the body was read.
+	_ = r.Close()
+	if writeErr := <-errChan; writeErr != nil && writeErr != io.ErrClosedPipe {
+		return "", writeErr
+	}
+	if err != nil {
+		return "", err
+	}
+	return result.Rev, nil
+}
+
+// multipartDoc returns the JSON of doc, with an _attachments entry for each of
+// atts which marks its content as following the document.
+func multipartDoc(doc interface{}, atts []driver.MultipartAttachment) ([]byte, error) {
+	raw, err := kivik.JSON().Marshal(doc)
+	if err != nil {
+		return nil, errors.WrapStatus(kivik.StatusBadRequest, err)
+	}
+	var fields map[string]json.RawMessage
+	if err = json.Unmarshal(raw, &fields); err != nil {
+		return nil, errors.WrapStatus(kivik.StatusBadRequest, err)
+	}
+	attachments := make(map[string]map[string]interface{})
+	if existing, ok := fields["_attachments"]; ok {
+		if err = json.Unmarshal(existing, &attachments); err != nil {
+			return nil, errors.WrapStatus(kivik.StatusBadRequest, err)
+		}
+	}
+	for _, att := range atts {
+		entry := attachments[att.Filename]
+		if entry == nil {
+			entry = make(map[string]interface{})
+		}
+		delete(entry, "stub")
+		delete(entry, "data")
+		delete(entry, "length")
+		entry["follows"] = true
+		entry["content_type"] = att.ContentType
+		if att.Length > 0 {
+			entry["length"] = att.Length
+		}
+		attachments[att.Filename] = entry
+	}
+	if fields["_attachments"], err = json.Marshal(attachments); err != nil {
+		return nil, err
+	}
+	return json.Marshal(fields)
+}
+
+// writeMultipart writes the document and the content of atts as the parts of
+// a multipart/related body. CouchDB matches the parts to the attachments in
+// the order of the _attachments field, which is sorted by name, as it was
+// encoded.
+func writeMultipart(mw *multipart.Writer, doc []byte, atts []driver.MultipartAttachment) error {
+	part, err := mw.CreatePart(textproto.MIMEHeader{"Content-Type": {typeJSON}})
+	if err != nil {
+		return err
+	}
+	if _, err = part.Write(doc); err != nil {
+		return err
+	}
+	sorted := make([]driver.MultipartAttachment, len(atts))
+	copy(sorted, atts)
+	sort.Sort(byFilename(sorted))
+	for _, att := range sorted {
+		header := textproto.MIMEHeader{
+			"Content-Type":        {att.ContentType},
+			"Content-Disposition": {fmt.Sprintf("attachment; filename=%q", att.Filename)},
+		}
+		if part, err = mw.CreatePart(header); err != nil {
+			return err
+		}
+		if _, err = io.Copy(part, att.Content); err != nil {
+			return err
+		}
+	}
+	return mw.Close()
+}
+
+type byFilename []driver.MultipartAttachment
+
+func (a byFilename) Len() int           { return len(a) }
+func (a byFilename) Less(i, j int) bool { return a[i].Filename < a[j].Filename }
+func (a byFilename) Swap(i, j int)      { a[i], a[j] = a[j], a[i] }
@@ -0,0 +1,63 @@
+package couchdb
+
+import (
+	"bytes"
+	"io/ioutil"
+	"mime/multipart"
+	"strings"
+	"testing"
+
+	"github.com/flimzy/diff"
+	"github.com/flimzy/kivik/driver"
+)
+
+func TestMultipartDoc(t *testing.T) {
+	doc := map[string]interface{}{
+		"_id": "foo",
+		"_attachments": map[string]interface{}{
+			"b.txt": map[string]interface{}{"stub": true, "length": 3, "revpos": 1, "digest": "md5-xxx"},
+			"c.txt": map[string]interface{}{"stub": true},
+		},
+	}
+	atts := []driver.MultipartAttachment{
+		{Filename: "b.txt", ContentType: "text/plain", Length: 5},
+		{Filename: "a.txt", ContentType: "text/plain"},
+	}
+	result, err := multipartDoc(doc, atts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := `{"_attachments":{"a.txt":{"content_type":"text/plain","follows":true},"b.txt":{"content_type":"text/plain","digest":"md5-xxx","follows":true,"length":5,"revpos":1},"c.txt":{"stub":true}},"_id":"foo"}`
+	if d := diff.JSON([]byte(expected), result); d != "" {
+		t.Error(d)
+	}
+}
+
+func TestWriteMultipart(t *testing.T) {
+	buf := &bytes.Buffer{}
+	mw := multipart.NewWriter(buf)
+	atts := []driver.MultipartAttachment{
+		{Filename: "b.txt", ContentType: "text/plain", Content: strings.NewReader("bbb")},
+		{Filename: "a.txt", ContentType: "text/html", Content: strings.NewReader("aaa")},
+	}
+	if err := writeMultipart(mw, []byte(`{}`), atts); err != nil {
+		t.Fatal(err)
+	}
+	mr := multipart.NewReader(buf, mw.Boundary())
+	var parts []string
+	for {
+		part, err := mr.NextPart()
+		if err != nil {
+			break
+		}
+		content, err := ioutil.ReadAll(part)
+		if err != nil {
+			t.Fatal(err)
+		}
+		parts = append(parts, part.Header.Get("Content-Type")+" "+string(content))
+	}
+	expected := []string{"application/json {}", "text/html aaa", "text/plain bbb"}
+	if d := diff.Interface(expected, parts); d != "" {
+		t.Error(d)
+	}
+}
@@ -6,6 +6,7 @@ import (
 	"fmt"
 	"io"
 
+	"github.com/flimzy/kivik"
 	"github.com/flimzy/kivik/driver"
 )
 
@@ -14,6 +15,7 @@ type rows struct {
 	totalRows int64
 	updateSeq string
 	warning   string
+	bookmark  string
 	body      io.ReadCloser
 	dec       *json.Decoder
 	// closed is true after all rows have been processed
@@ -42,6 +44,10 @@ func (r *rows) Warning() string {
 	return r.warning
 }
 
+func (r *rows) Bookmark() string {
+	return r.bookmark
+}
+
 func (r *rows) UpdateSeq() string {
 	return r.updateSeq
 }
@@ -135,6 +141,8 @@ func (r *rows) parseMeta(key string) error {
 		return r.dec.Decode(&r.totalRows)
 	case "warning":
 		return r.dec.Decode(&r.warning)
+	case "bookmark":
+		return r.dec.Decode(&r.bookmark)
 	}
 	return fmt.Errorf("Unexpected key: %s", key)
 }
@@ -155,10 +163,14 @@ func (r *rows) nextRow(row *driver.Row) error {
 		}
 		return io.EOF
 	}
+	if err := r.dec.Decode(&row.Raw); err != nil {
+		return err
+	}
 	if r.isFindRows {
-		return r.dec.Decode(&row.Doc)
+		row.Doc = row.Raw
+		return nil
 	}
-	return r.dec.Decode(row)
+	return kivik.JSON().Unmarshal(row.Raw, row)
 }
 
 // consumeDelim consumes the expected delimiter from the stream, or returns an
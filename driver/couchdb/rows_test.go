@@ -50,6 +50,9 @@ func TestRowsIterator(t *testing.T) {
 		if string(row.Key) != expectedKeys[count] {
 			t.Errorf("Expected key #%d to be %s, got %s", count, expectedKeys[count], string(row.Key))
 		}
+		if !strings.HasPrefix(string(row.Raw), "{") || !strings.Contains(string(row.Raw), expectedKeys[count]) {
+			t.Errorf("Unexpected raw row #%d: %s", count, row.Raw)
+		}
 		if count++; count > 10 {
 			t.Fatalf("Ran too many iterations.")
 		}
@@ -103,7 +106,8 @@ var findInput = `
 {"id":"SpaghettiWithMeatballs","key":"meatballs","value":1},
 {"id":"SpaghettiWithMeatballs","key":"spaghetti","value":1},
 {"id":"SpaghettiWithMeatballs","key":"tomato sauce","value":1}
-]}
+],
+"bookmark":"g1AAAABweJzLYWBgYMpgSmHgKy5JLCrJTq2MT8lPzkzJBYqzFhfnFxWkFpWmmDiBNDlxwDUlQnRkAQDd7BHi"}
 `
 
 func TestFindRowsIterator(t *testing.T) {
@@ -134,4 +138,7 @@ func TestFindRowsIterator(t *testing.T) {
 	if rows.Warning() != "no matching index found, create an index to optimize query time" {
 		t.Errorf("Unexpected warning: %s", rows.Warning())
 	}
+	if rows.Bookmark() != "g1AAAABweJzLYWBgYMpgSmHgKy5JLCrJTq2MT8lPzkzJBYqzFhfnFxWkFpWmmDiBNDlxwDUlQnRkAQDd7BHi" {
+		t.Errorf("Unexpected bookmark: %s", rows.Bookmark())
+	}
 }
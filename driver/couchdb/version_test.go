@@ -2,7 +2,10 @@ package couchdb
 
 import (
 	"context"
+	"encoding/json"
 	"testing"
+
+	"github.com/flimzy/diff"
 )
 
 func TestVersion(t *testing.T) {
@@ -12,3 +15,20 @@ func TestVersion(t *testing.T) {
 		t.Fatalf("Failed to get server info: %s", err)
 	}
 }
+
+func TestInfoUnmarshalJSON(t *testing.T) {
+	input := `{"couchdb":"Welcome","version":"2.1.0","features":["scheduler"],"vendor":{"name":"The Apache Software Foundation"}}`
+	i := &info{}
+	if err := json.Unmarshal([]byte(input), i); err != nil {
+		t.Fatal(err)
+	}
+	expected := &info{
+		Data:     json.RawMessage(input),
+		Version:  "2.1.0",
+		Features: []string{"scheduler"},
+	}
+	expected.Vendor.Name = "The Apache Software Foundation"
+	if d := diff.Interface(expected, i); d != "" {
+		t.Error(d)
+	}
+}
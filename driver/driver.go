@@ -20,6 +20,9 @@ type Version struct {
 	Version string
 	// Vendor is the vendor string reported by the server or backend.
 	Vendor string
+	// Features is the list of optional features reported by the server or
+	// backend, if any.
+	Features []string
 	// RawResponse is the raw response body as returned by the server.
 	RawResponse json.RawMessage
 }
@@ -90,6 +93,82 @@ type Authenticator interface {
 	Authenticate(ctx context.Context, authenticator interface{}) error
 }
 
+// PoolStats reports the state of a client's connection pool.
+type PoolStats struct {
+	OpenConnections int
+	IdleConnections int
+	InFlight        int
+}
+
+// PoolStatser is an optional interface that may be implemented by a Client
+// which maintains a pool of connections to the server.
+type PoolStatser interface {
+	// PoolStats returns the state of the connection pool.
+	PoolStats() (PoolStats, error)
+}
+
+// Config represents all the config sections of a server.
+type Config map[string]ConfigSection
+
+// ConfigSection represents all key/value pairs of a config section.
+type ConfigSection map[string]string
+
+// Configer is an optional interface that may be implemented by a Client to
+// read and modify the server configuration. node is the name of the cluster
+// node, as for CouchDB 2.x's /_node/{node}/_config endpoint. An empty node
+// means the node the client is connected to.
+type Configer interface {
+	Config(ctx context.Context, node string) (Config, error)
+	ConfigSection(ctx context.Context, node, section string) (ConfigSection, error)
+	ConfigValue(ctx context.Context, node, section, key string) (string, error)
+	// SetConfigValue sets the value of the key, and returns the old value.
+	SetConfigValue(ctx context.Context, node, section, key, value string) (string, error)
+	// DeleteConfigKey deletes the key, and returns the old value.
+	DeleteConfigKey(ctx context.Context, node, section, key string) (string, error)
+}
+
+// Membership lists the nodes of a CouchDB 2.x cluster.
+type Membership struct {
+	AllNodes     []string `json:"all_nodes"`
+	ClusterNodes []string `json:"cluster_nodes"`
+}
+
+// Clusterer is an optional interface that may be implemented by a Client
+// which connects to a cluster, to manage cluster membership.
+type Clusterer interface {
+	// Membership returns the nodes known to the node the client is
+	// connected to, and the nodes of the cluster.
+	Membership(ctx context.Context) (*Membership, error)
+	// AddNode adds the named node to the cluster.
+	AddNode(ctx context.Context, node string) error
+	// RemoveNode removes the named node from the cluster.
+	RemoveNode(ctx context.Context, node string) error
+}
+
+// AdminPartyChecker is an optional interface that may be implemented by a
+// Client which can determine whether the server grants admin rights to
+// unauthenticated requests.
+type AdminPartyChecker interface {
+	// AdminParty returns true if unauthenticated requests have admin rights.
+	AdminParty(ctx context.Context) (bool, error)
+}
+
+// DiskUsage reports the storage used by a client, and the storage available
+// to it.
+type DiskUsage struct {
+	// Usage is the number of bytes used.
+	Usage int64
+	// Quota is the number of bytes which may be used, or 0 if unknown.
+	Quota int64
+}
+
+// DiskUsager is an optional interface that may be implemented by a Client
+// whose storage is subject to a quota, such as a browser's IndexedDB storage.
+type DiskUsager interface {
+	// DiskUsage returns the storage used by, and available to, the client.
+	DiskUsage(ctx context.Context) (*DiskUsage, error)
+}
+
 // DBStats contains database statistics..
 type DBStats struct {
 	Name           string `json:"db_name"`
@@ -181,6 +260,26 @@ type Finder interface {
 	DeleteIndex(ctx context.Context, ddoc, name string) error
 }
 
+// Explainer is an optional interface which may be implemented by a database
+// which implements Finder, to describe how a query would be executed.
+type Explainer interface {
+	// Explain returns the query plan for query, which is as for Find, without
+	// executing it.
+	Explain(ctx context.Context, query interface{}) (*QueryPlan, error)
+}
+
+// QueryPlan is the query plan returned by Explain.
+type QueryPlan struct {
+	DBName   string                 `json:"dbname"`
+	Index    map[string]interface{} `json:"index"`
+	Selector map[string]interface{} `json:"selector"`
+	Options  map[string]interface{} `json:"opts"`
+	Limit    int64                  `json:"limit"`
+	Skip     int64                  `json:"skip"`
+	Fields   []interface{}          `json:"fields"`
+	Range    map[string]interface{} `json:"range"`
+}
+
 // Index is a MonboDB-style index definition.
 type Index struct {
 	DesignDoc  string      `json:"ddoc,omitempty"`
@@ -200,6 +299,16 @@ type AttachmentMetaer interface {
 	GetAttachmentMeta(ctx context.Context, docID, rev, filename string) (contentType string, md5sum MD5sum, err error)
 }
 
+// AttachmentCombiner is an optional interface which may be satisfied by a DB
+// which can concatenate attachments on the server, to recombine an attachment
+// uploaded in chunks.
+type AttachmentCombiner interface {
+	// CombineAttachments stores the concatenation of the attachments parts,
+	// in order, as the attachment filename, deletes parts, and returns the
+	// new rev of the document.
+	CombineAttachments(ctx context.Context, docID, rev, filename, contentType string, parts []string) (newRev string, err error)
+}
+
 // BulkResult is the result of a single doc update in a BulkDocs request.
 type BulkResult struct {
 	ID    string `json:"id"`
@@ -236,6 +345,32 @@ type DBFlusher interface {
 	Flush(ctx context.Context) error
 }
 
+// DesignInfo is the status of a design document's view index.
+type DesignInfo struct {
+	Name           string
+	Language       string
+	Signature      string
+	CompactRunning bool
+	UpdaterRunning bool
+	WaitingClients int64
+	WaitingCommit  bool
+	UpdateSeq      string
+	PurgeSeq       string
+	DiskSize       int64
+	ActiveSize     int64
+	ExternalSize   int64
+}
+
+// DesignInfoer is an optional interface that may be implemented by a DB, to
+// report the status of a design document's view index.
+type DesignInfoer interface {
+	// DesignInfo returns the status of the view index of the design document
+	// ddoc, without the _design/ prefix.
+	//
+	// See http://docs.couchdb.org/en/2.0.0/api/ddoc/common.html#db-design-design-doc-info
+	DesignInfo(ctx context.Context, ddoc string) (*DesignInfo, error)
+}
+
 // Copier is an optional interface that may be implemented by a DB.
 //
 // If a DB does implement Copier, Copy() functions will use it.  If a DB does
@@ -245,3 +380,128 @@ type DBFlusher interface {
 type Copier interface {
 	Copy(ctx context.Context, targetID, sourceID string, options map[string]interface{}) (targetRev string, err error)
 }
+
+// OptsBulkDocer is an optional interface that may be implemented by a DB, to
+// support options for BulkDocs, such as new_edits=false, which stores documents
+// with the revisions given, as is done by replication.
+//
+// See http://docs.couchdb.org/en/2.0.0/api/database/bulk-api.html#db-bulk-docs
+type OptsBulkDocer interface {
+	// BulkDocsOpts is as BulkDocs, with options which are included in the
+	// request body.
+	BulkDocsOpts(ctx context.Context, docs []interface{}, options map[string]interface{}) (BulkResults, error)
+}
+
+// OptsPutter is an optional interface that may be implemented by a DB, to
+// support options for Put, such as the write quorum, w.
+type OptsPutter interface {
+	// PutOpts is as Put, with options which are included in the request
+	// query string.
+	PutOpts(ctx context.Context, docID string, doc interface{}, options map[string]interface{}) (rev string, err error)
+}
+
+// OptsDeleter is an optional interface that may be implemented by a DB, to
+// support options for Delete, such as the write quorum, w.
+type OptsDeleter interface {
+	// DeleteOpts is as Delete, with options which are included in the request
+	// query string.
+	DeleteOpts(ctx context.Context, docID, rev string, options map[string]interface{}) (newRev string, err error)
+}
+
+// Quorumer is an optional interface that may be implemented by a DB which
+// honors the CouchDB 2.x read and write quorum options, r and w, for Get, Put,
+// Delete and BulkDocs. Kivik rejects these options for DBs which do not
+// implement Quorumer, or for which SupportsQuorum returns false, rather than
+// allowing them to be silently ignored.
+//
+// See http://docs.couchdb.org/en/2.0.0/cluster/theory.html
+type Quorumer interface {
+	// SupportsQuorum returns true if the r and w options are honored. This
+	// allows drivers which wrap other DBs to report the capability of the
+	// wrapped DB.
+	SupportsQuorum() bool
+}
+
+// OpenRev is a single revision of a document, as returned by GetOpenRevs.
+type OpenRev struct {
+	// Rev is the revision.
+	Rev string
+	// Doc is the document at Rev, or nil if the revision is missing.
+	Doc json.RawMessage
+}
+
+// OpenRevsGetter is an optional interface that may be implemented by a DB, to
+// fetch several revisions of a document in a single request. If not
+// implemented, GetOpenRevs is emulated with Get.
+//
+// See http://docs.couchdb.org/en/2.0.0/api/document/common.html#get--db-docid
+type OpenRevsGetter interface {
+	// GetOpenRevs returns the requested revisions of a document, in the order
+	// requested, or all leaf revisions if revs is nil.
+	GetOpenRevs(ctx context.Context, docID string, revs []string, options map[string]interface{}) ([]OpenRev, error)
+}
+
+// OptionType identifies the type of value accepted for an option.
+type OptionType int
+
+// Option types
+const (
+	// OptionAny accepts any value.
+	OptionAny OptionType = iota
+	OptionString
+	OptionBool
+	// OptionInt accepts any integer type, or an integral float64, as results
+	// from decoding JSON.
+	OptionInt
+	// OptionStringSlice accepts a []string.
+	OptionStringSlice
+)
+
+// OptionValidator is an optional interface that may be implemented by a
+// Client or DB, to declare the options it accepts. Kivik then rejects unknown
+// or mistyped options with StatusBadRequest, rather than passing them to the
+// driver to be silently ignored.
+type OptionValidator interface {
+	// SupportedOptions returns the options accepted by method, which is the
+	// name of the kivik.Client or kivik.DB method called, such as "AllDocs"
+	// or "Get". If ok is false, options to method are not validated.
+	SupportedOptions(method string) (options map[string]OptionType, ok bool)
+}
+
+// BodyGetter is an optional interface that may be implemented by a DB, to
+// stream the raw JSON of a document, rather than reading it into memory. If
+// not implemented, GetStream is emulated with Get.
+type BodyGetter interface {
+	// GetBody returns the raw JSON of the requested document. The caller must
+	// close the body.
+	GetBody(ctx context.Context, docID string, options map[string]interface{}) (io.ReadCloser, error)
+}
+
+// OptsDocCreator is an optional interface that may be implemented by a DB, to
+// support options for CreateDoc, such as batch=ok.
+type OptsDocCreator interface {
+	// CreateDocOpts is as CreateDoc, with options which are included in the
+	// request query string.
+	CreateDocOpts(ctx context.Context, doc interface{}, options map[string]interface{}) (docID, rev string, err error)
+}
+
+// MultipartAttachment is an attachment streamed by PutMultipart.
+type MultipartAttachment struct {
+	Filename    string
+	ContentType string
+	// Length is the size of the content, in bytes, or 0 if unknown.
+	Length  int64
+	Content io.Reader
+}
+
+// MultipartPutter is an optional interface that may be implemented by a DB, to
+// store a document with attachments whose content is streamed, rather than
+// base64-encoded in the document, as by a multipart/related request.
+//
+// See http://docs.couchdb.org/en/2.0.0/api/document/common.html#creating-multiple-attachments
+type MultipartPutter interface {
+	// PutMultipart stores doc, with atts, which replace any entries of the
+	// same names in its _attachments field. Options are included in the
+	// request query string.
+	PutMultipart(ctx context.Context, docID string, doc interface{}, atts []MultipartAttachment, options map[string]interface{}) (rev string, err error)
+}
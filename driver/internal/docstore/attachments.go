@@ -0,0 +1,104 @@
+package docstore
+
+import (
+	"crypto/md5"
+	"encoding/base64"
+	"encoding/json"
+
+	"github.com/flimzy/kivik"
+	"github.com/flimzy/kivik/driver"
+	"github.com/flimzy/kivik/errors"
+)
+
+// Attachment is an attachment of a revision. Its fields are tagged for
+// drivers which store it as JSON.
+type Attachment struct {
+	Filename    string `json:"filename"`
+	ContentType string `json:"content_type"`
+	Revpos      int64  `json:"revpos"`
+	Digest      []byte `json:"digest"`
+	Data        []byte `json:"data"`
+}
+
+// Stub returns the attachment's entry in the _attachments field of its
+// document.
+func (a *Attachment) Stub() map[string]interface{} {
+	return map[string]interface{}{
+		"content_type": a.ContentType,
+		"digest":       "md5-" + base64.StdEncoding.EncodeToString(a.Digest),
+		"length":       len(a.Data),
+		"revpos":       a.Revpos,
+		"stub":         true,
+	}
+}
+
+// MD5sum returns the attachment's digest.
+func (a *Attachment) MD5sum() driver.MD5sum {
+	var sum driver.MD5sum
+	copy(sum[:], a.Digest)
+	return sum
+}
+
+// AttachmentLoader reads the named attachment of the parent of a new
+// revision, with its data. It returns an error with status StatusNotFound if
+// there is no such attachment.
+type AttachmentLoader func(filename string) (*Attachment, error)
+
+// AttachmentField is an entry in a document's _attachments field, either a
+// stub, referring to an attachment of the previous revision, or inline data.
+type AttachmentField struct {
+	ContentType string `json:"content_type"`
+	Data        []byte `json:"data"`
+	Stub        bool   `json:"stub"`
+}
+
+// ParseAttachments decodes the _attachments field of doc.
+func ParseAttachments(doc Doc) (map[string]AttachmentField, error) {
+	field, ok := doc["_attachments"]
+	if !ok || field == nil {
+		return nil, nil
+	}
+	asJSON, err := json.Marshal(field)
+	if err != nil {
+		return nil, errors.WrapStatus(kivik.StatusBadRequest, err)
+	}
+	var atts map[string]AttachmentField
+	if err := json.Unmarshal(asJSON, &atts); err != nil {
+		return nil, errors.Status(kivik.StatusBadRequest, "kivik: invalid _attachments field")
+	}
+	return atts, nil
+}
+
+// attachments returns the attachments of the new revision revNum of doc:
+// those given inline, and those of the parent for which doc holds a stub.
+// Attachments of the parent which doc does not mention are dropped, as with
+// CouchDB.
+func attachments(doc Doc, revNum int64, load AttachmentLoader) ([]*Attachment, error) {
+	fields, err := ParseAttachments(doc)
+	if err != nil {
+		return nil, err
+	}
+	atts := make([]*Attachment, 0, len(fields))
+	for filename, field := range fields {
+		if !field.Stub {
+			digest := md5.Sum(field.Data)
+			atts = append(atts, &Attachment{
+				Filename:    filename,
+				ContentType: field.ContentType,
+				Revpos:      revNum,
+				Digest:      digest[:],
+				Data:        field.Data,
+			})
+			continue
+		}
+		att, err := load(filename)
+		if err != nil {
+			if errors.StatusCode(err) == kivik.StatusNotFound {
+				return nil, errors.Statusf(kivik.StatusPreconditionFailed, "kivik: invalid attachment stub for %s", filename)
+			}
+			return nil, err
+		}
+		atts = append(atts, att)
+	}
+	return atts, nil
+}
@@ -0,0 +1,219 @@
+// Package docstore contains the logic shared by the embedded storage drivers,
+// sqlite, bolt and leveldb: the writing of documents, local documents and
+// attachments through a Store, the lookup of AllDocs keys through a Reader,
+// and the parsing of options and results. Each driver implements Store over
+// its own storage, and keeps its own range scans, changes feed, Stats and
+// Compact, which depend on how it lays out its records.
+package docstore
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/flimzy/kivik"
+	"github.com/flimzy/kivik/errors"
+)
+
+// LocalPrefix is the prefix of the IDs of local documents, which have no
+// revision history, and are excluded from AllDocs and the changes feed.
+const LocalPrefix = "_local/"
+
+// Doc is a document, as written by the driver.
+type Doc map[string]interface{}
+
+// Rev returns the document's _rev field.
+func (d Doc) Rev() string {
+	rev, _ := d["_rev"].(string)
+	return rev
+}
+
+// Deleted returns true if the document is a deletion.
+func (d Doc) Deleted() bool {
+	deleted, _ := d["_deleted"].(bool)
+	return deleted
+}
+
+// ToDoc converts a document, as passed to the driver, to a Doc.
+func ToDoc(i interface{}) (Doc, error) {
+	if doc, ok := i.(Doc); ok {
+		return doc, nil
+	}
+	asJSON, err := json.Marshal(i)
+	if err != nil {
+		return nil, errors.WrapStatus(kivik.StatusBadRequest, err)
+	}
+	var doc Doc
+	if err := json.Unmarshal(asJSON, &doc); err != nil {
+		return nil, errors.Status(kivik.StatusBadRequest, "kivik: document must be a JSON object")
+	}
+	return doc, nil
+}
+
+// RandomID returns 32 random hexadecimal digits, as used for new document IDs
+// and revisions.
+func RandomID() (string, error) {
+	var buf [16]byte
+	if _, err := rand.Read(buf[:]); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(buf[:]), nil
+}
+
+// DocID returns the _id field of doc, or a random ID, if it is unset, as for
+// a new document of BulkDocs.
+func DocID(doc Doc) (string, error) {
+	if docID, _ := doc["_id"].(string); docID != "" {
+		return docID, nil
+	}
+	return RandomID()
+}
+
+// ParseRev splits a revision ID into its number and hash.
+func ParseRev(rev string) (int64, string, error) {
+	parts := strings.SplitN(rev, "-", 2)
+	if len(parts) != 2 || parts[1] == "" {
+		return 0, "", errors.Status(kivik.StatusBadRequest, "Invalid rev format")
+	}
+	n, err := strconv.ParseInt(parts[0], 10, 64)
+	if err != nil || n < 1 {
+		return 0, "", errors.Status(kivik.StatusBadRequest, "Invalid rev format")
+	}
+	return n, parts[1], nil
+}
+
+// ValidDocID returns an error if docID may not be written.
+func ValidDocID(docID string) error {
+	if docID == "" {
+		return errors.Status(kivik.StatusBadRequest, "kivik: docID required")
+	}
+	if docID[0] == '_' && !strings.HasPrefix(docID, LocalPrefix) && !strings.HasPrefix(docID, "_design/") {
+		return errors.Status(kivik.StatusBadRequest, "Only reserved document ids may start with underscore.")
+	}
+	return nil
+}
+
+// Revision is a new revision of a document, ready to be stored.
+type Revision struct {
+	// Rev is the revision ID, and Num its number.
+	Rev string
+	Num int64
+	// Parent is the revision it replaces, or empty for a new document.
+	Parent  string
+	Deleted bool
+	// Body is the JSON document, with its _id and _rev fields, and stubs for
+	// its attachments.
+	Body json.RawMessage
+	// Attachments are the attachments of the revision, to be stored with
+	// it.
+	Attachments []*Attachment
+}
+
+// Update checks that doc may replace current, the current revision of docID,
+// which is empty if docID does not exist, and deleted if it is a deletion, and
+// returns the new revision. load reads an attachment of current, for the stubs
+// in doc.
+func Update(docID string, doc Doc, current string, deleted bool, load AttachmentLoader) (*Revision, error) {
+	exists := current != ""
+	switch {
+	case doc.Deleted() && (!exists || deleted):
+		return nil, errors.Status(kivik.StatusNotFound, "missing")
+	case exists && !deleted && doc.Rev() != current:
+		return nil, errors.Status(kivik.StatusConflict, "document update conflict")
+	case !exists && doc.Rev() != "":
+		// Rev should not be set for a new document
+		return nil, errors.Status(kivik.StatusConflict, "document update conflict")
+	}
+	r := &Revision{Num: 1, Parent: current, Deleted: doc.Deleted()}
+	if exists {
+		n, _, err := ParseRev(current)
+		if err != nil {
+			return nil, err
+		}
+		r.Num = n + 1
+	}
+	hash, err := RandomID()
+	if err != nil {
+		return nil, err
+	}
+	r.Rev = fmt.Sprintf("%d-%s", r.Num, hash)
+	atts, err := attachments(doc, r.Num, load)
+	if err != nil {
+		return nil, err
+	}
+	doc["_id"] = docID
+	doc["_rev"] = r.Rev
+	if r.Deleted {
+		// Deleted documents retain no fields other than these.
+		doc = Doc{"_id": docID, "_rev": r.Rev, "_deleted": true}
+		atts = nil
+	} else if len(atts) > 0 {
+		stubs := make(map[string]interface{}, len(atts))
+		for _, att := range atts {
+			stubs[att.Filename] = att.Stub()
+		}
+		doc["_attachments"] = stubs
+	} else {
+		delete(doc, "_attachments")
+	}
+	if r.Body, err = json.Marshal(doc); err != nil {
+		return nil, errors.WrapStatus(kivik.StatusBadRequest, err)
+	}
+	r.Attachments = atts
+	return r, nil
+}
+
+// LocalRev returns the revision ID of revision n of a local document.
+func LocalRev(n int64) string {
+	return fmt.Sprintf("0-%d", n)
+}
+
+// updateLocal checks that doc may replace current, the current revision of a
+// local document, which is empty if it does not exist, and returns the number
+// of the new revision, which is 0 if doc is a deletion. Otherwise, the _rev
+// field of doc is set to the new revision.
+func updateLocal(doc Doc, current string) (int64, error) {
+	exists := current != ""
+	switch {
+	case !exists && doc.Deleted():
+		return 0, errors.Status(kivik.StatusNotFound, "missing")
+	case !exists && doc.Rev() != "", exists && doc.Rev() != current:
+		return 0, errors.Status(kivik.StatusConflict, "document update conflict")
+	}
+	if doc.Deleted() {
+		return 0, nil
+	}
+	var revNum int64
+	if exists {
+		revNum, _ = strconv.ParseInt(strings.TrimPrefix(current, "0-"), 10, 64)
+	}
+	doc["_rev"] = LocalRev(revNum + 1)
+	return revNum + 1, nil
+}
+
+// addAttachment adds an inline attachment to doc, replacing any of the same
+// name.
+func addAttachment(doc Doc, filename, contentType string, data []byte) {
+	atts, _ := doc["_attachments"].(map[string]interface{})
+	if atts == nil {
+		atts = make(map[string]interface{})
+	}
+	atts[filename] = map[string]interface{}{
+		"content_type": contentType,
+		"data":         data,
+	}
+	doc["_attachments"] = atts
+}
+
+// removeAttachment removes an attachment from doc.
+func removeAttachment(doc Doc, filename string) error {
+	atts, _ := doc["_attachments"].(map[string]interface{})
+	if _, ok := atts[filename]; !ok {
+		return errors.Status(kivik.StatusNotFound, "missing")
+	}
+	delete(atts, filename)
+	return nil
+}
@@ -0,0 +1,279 @@
+package docstore
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/flimzy/diff"
+	"github.com/flimzy/kivik"
+	"github.com/flimzy/kivik/errors"
+)
+
+func TestParseRev(t *testing.T) {
+	tests := []struct {
+		rev    string
+		num    int64
+		hash   string
+		status int
+	}{
+		{rev: "1-abc", num: 1, hash: "abc"},
+		{rev: "12-abc-def", num: 12, hash: "abc-def"},
+		{rev: "abc", status: kivik.StatusBadRequest},
+		{rev: "1-", status: kivik.StatusBadRequest},
+		{rev: "0-abc", status: kivik.StatusBadRequest},
+		{rev: "x-abc", status: kivik.StatusBadRequest},
+	}
+	for _, test := range tests {
+		t.Run(test.rev, func(t *testing.T) {
+			num, hash, err := ParseRev(test.rev)
+			if status := kivik.StatusCode(err); status != test.status {
+				t.Fatalf("Unexpected status %d: %v", status, err)
+			}
+			if num != test.num || hash != test.hash {
+				t.Errorf("Unexpected result: %d, %s", num, hash)
+			}
+		})
+	}
+}
+
+func TestValidDocID(t *testing.T) {
+	tests := []struct {
+		docID  string
+		status int
+	}{
+		{docID: "foo"},
+		{docID: "_design/foo"},
+		{docID: "_local/foo"},
+		{docID: "", status: kivik.StatusBadRequest},
+		{docID: "_foo", status: kivik.StatusBadRequest},
+	}
+	for _, test := range tests {
+		t.Run(test.docID, func(t *testing.T) {
+			if status := kivik.StatusCode(ValidDocID(test.docID)); status != test.status {
+				t.Errorf("Unexpected status %d", status)
+			}
+		})
+	}
+}
+
+func TestParseAllDocsOptions(t *testing.T) {
+	str := func(s string) *string { return &s }
+	tests := []struct {
+		name     string
+		opts     map[string]interface{}
+		expected *AllDocsOptions
+		status   int
+	}{
+		{
+			name:     "Defaults",
+			opts:     map[string]interface{}{},
+			expected: &AllDocsOptions{InclusiveEnd: true},
+		},
+		{
+			name: "Strings",
+			opts: map[string]interface{}{
+				"include_docs":  "true",
+				"inclusive_end": "false",
+				"limit":         "10",
+				"skip":          "2",
+				"startkey":      `"foo"`,
+				"end_key":       "bar",
+			},
+			expected: &AllDocsOptions{IncludeDocs: true, Limit: 10, Skip: 2, StartKey: str("foo"), EndKey: str("bar")},
+		},
+		{
+			name:     "Key",
+			opts:     map[string]interface{}{"key": "foo", "inclusive_end": false},
+			expected: &AllDocsOptions{InclusiveEnd: true, StartKey: str("foo"), EndKey: str("foo")},
+		},
+		{
+			name:     "Keys",
+			opts:     map[string]interface{}{"keys": `["foo","bar"]`},
+			expected: &AllDocsOptions{InclusiveEnd: true, Keys: []string{"foo", "bar"}},
+		},
+		{
+			name:   "NonStringKey",
+			opts:   map[string]interface{}{"startkey": 1},
+			status: kivik.StatusBadRequest,
+		},
+		{
+			name:   "InvalidKeys",
+			opts:   map[string]interface{}{"keys": `["foo",1]`},
+			status: kivik.StatusBadRequest,
+		},
+		{
+			name:   "InvalidLimit",
+			opts:   map[string]interface{}{"limit": "foo"},
+			status: kivik.StatusBadRequest,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			opts, err := ParseAllDocsOptions(test.opts)
+			if status := kivik.StatusCode(err); status != test.status {
+				t.Fatalf("Unexpected status %d: %v", status, err)
+			}
+			if err != nil {
+				return
+			}
+			if d := diff.Interface(test.expected, opts); d != "" {
+				t.Error(d)
+			}
+		})
+	}
+}
+
+func TestParseAttachments(t *testing.T) {
+	doc, err := ToDoc(map[string]interface{}{
+		"_attachments": map[string]interface{}{
+			"foo.txt": map[string]interface{}{"content_type": "text/plain", "data": "Zm9v"},
+			"bar.txt": map[string]interface{}{"stub": true},
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	atts, err := ParseAttachments(doc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := map[string]AttachmentField{
+		"foo.txt": {ContentType: "text/plain", Data: []byte("foo")},
+		"bar.txt": {Stub: true},
+	}
+	if d := diff.Interface(expected, atts); d != "" {
+		t.Error(d)
+	}
+	if _, err := ParseAttachments(Doc{"_attachments": "foo"}); kivik.StatusCode(err) != kivik.StatusBadRequest {
+		t.Errorf("Unexpected error: %v", err)
+	}
+}
+
+func TestAttachmentStub(t *testing.T) {
+	att := &Attachment{
+		ContentType: "text/plain",
+		Revpos:      2,
+		Digest:      []byte{0xac, 0xbd, 0x18, 0xdb, 0x4c, 0xc2, 0xf8, 0x5c, 0xed, 0xef, 0x65, 0x4f, 0xcc, 0xc4, 0xa4, 0xd8},
+		Data:        []byte("foo"),
+	}
+	expected := map[string]interface{}{
+		"content_type": "text/plain",
+		"digest":       "md5-rL0Y20zC+Fzt72VPzMSk2A==",
+		"length":       3,
+		"revpos":       int64(2),
+		"stub":         true,
+	}
+	if d := diff.Interface(expected, att.Stub()); d != "" {
+		t.Error(d)
+	}
+}
+
+func TestUpdate(t *testing.T) {
+	noAttachments := func(_ string) (*Attachment, error) {
+		return nil, errors.Status(kivik.StatusNotFound, "missing")
+	}
+	tests := []struct {
+		name    string
+		doc     Doc
+		current string
+		deleted bool
+		num     int64
+		status  int
+	}{
+		{name: "New", doc: Doc{"foo": "bar"}, num: 1},
+		{name: "NewWithRev", doc: Doc{"_rev": "1-abc"}, status: kivik.StatusConflict},
+		{name: "Update", doc: Doc{"_rev": "1-abc"}, current: "1-abc", num: 2},
+		{name: "Conflict", doc: Doc{"_rev": "1-xyz"}, current: "1-abc", status: kivik.StatusConflict},
+		{name: "Recreate", doc: Doc{}, current: "2-abc", deleted: true, num: 3},
+		{name: "DeleteMissing", doc: Doc{"_deleted": true}, status: kivik.StatusNotFound},
+		{name: "DeleteDeleted", doc: Doc{"_rev": "2-abc", "_deleted": true}, current: "2-abc", deleted: true, status: kivik.StatusNotFound},
+		{name: "InvalidStub", doc: Doc{"_attachments": map[string]interface{}{"foo.txt": map[string]interface{}{"stub": true}}}, status: kivik.StatusPreconditionFailed},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			r, err := Update("foo", test.doc, test.current, test.deleted, noAttachments)
+			if status := kivik.StatusCode(err); status != test.status {
+				t.Fatalf("Unexpected status %d: %v", status, err)
+			}
+			if err != nil {
+				return
+			}
+			if r.Num != test.num || r.Parent != test.current {
+				t.Errorf("Unexpected revision %d of %q", r.Num, r.Parent)
+			}
+			var doc Doc
+			if err := json.Unmarshal(r.Body, &doc); err != nil {
+				t.Fatal(err)
+			}
+			if doc["_id"] != "foo" || doc.Rev() != r.Rev {
+				t.Errorf("Unexpected body: %s", r.Body)
+			}
+		})
+	}
+	t.Run("Deletion", func(t *testing.T) {
+		r, err := Update("foo", Doc{"_rev": "1-abc", "_deleted": true, "foo": "bar"}, "1-abc", false, noAttachments)
+		if err != nil {
+			t.Fatal(err)
+		}
+		expected := `{"_deleted":true,"_id":"foo","_rev":"` + r.Rev + `"}`
+		if string(r.Body) != expected || !r.Deleted {
+			t.Errorf("Unexpected body: %s", r.Body)
+		}
+	})
+}
+
+func TestUpdateLocal(t *testing.T) {
+	tests := []struct {
+		name    string
+		doc     Doc
+		current string
+		num     int64
+		status  int
+	}{
+		{name: "New", doc: Doc{}, num: 1},
+		{name: "Update", doc: Doc{"_rev": "0-1"}, current: "0-1", num: 2},
+		{name: "Conflict", doc: Doc{"_rev": "0-1"}, current: "0-2", status: kivik.StatusConflict},
+		{name: "NewWithRev", doc: Doc{"_rev": "0-1"}, status: kivik.StatusConflict},
+		{name: "Delete", doc: Doc{"_rev": "0-1", "_deleted": true}, current: "0-1"},
+		{name: "DeleteMissing", doc: Doc{"_deleted": true}, status: kivik.StatusNotFound},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			num, err := updateLocal(test.doc, test.current)
+			if status := kivik.StatusCode(err); status != test.status {
+				t.Fatalf("Unexpected status %d: %v", status, err)
+			}
+			if num != test.num {
+				t.Errorf("Unexpected revision %d", num)
+			}
+			if err == nil && !test.doc.Deleted() && test.doc.Rev() != LocalRev(num) {
+				t.Errorf("Unexpected _rev: %s", test.doc.Rev())
+			}
+		})
+	}
+}
+
+func TestRequestedKeys(t *testing.T) {
+	opts := &AllDocsOptions{Keys: []string{"a", "b", "c"}, Descending: true, Skip: 1}
+	if d := diff.Interface([]string{"b", "a"}, opts.RequestedKeys()); d != "" {
+		t.Error(d)
+	}
+	opts.Skip = 3
+	if keys := opts.RequestedKeys(); keys != nil {
+		t.Errorf("Unexpected keys: %v", keys)
+	}
+}
+
+func TestParseChangesOptions(t *testing.T) {
+	_, err := ParseChangesOptions("bolt", map[string]interface{}{"feed": "continuous"})
+	if kivik.StatusCode(err) != kivik.StatusNotImplemented || err.Error() != "kivik: continuous feed not supported by bolt driver" {
+		t.Errorf("Unexpected error: %v", err)
+	}
+	opts, err := ParseChangesOptions("bolt", map[string]interface{}{"since": "now", "limit": 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if opts.Since != -1 || opts.Limit != 2 || opts.IncludeDocs {
+		t.Errorf("Unexpected options: %+v", opts)
+	}
+}
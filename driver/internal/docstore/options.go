@@ -0,0 +1,245 @@
+package docstore
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+
+	"github.com/flimzy/kivik"
+	"github.com/flimzy/kivik/driver"
+	"github.com/flimzy/kivik/errors"
+	"github.com/flimzy/kivik/filter"
+)
+
+// AllDocsOptions are the options supported by AllDocs.
+type AllDocsOptions struct {
+	IncludeDocs  bool
+	Descending   bool
+	InclusiveEnd bool
+	UpdateSeq    bool
+	Limit        int
+	Skip         int
+	StartKey     *string
+	EndKey       *string
+	Keys         []string
+}
+
+// BoolOption returns the named boolean option, or def if it is unset.
+func BoolOption(opts map[string]interface{}, name string, def bool) (bool, error) {
+	switch t := opts[name].(type) {
+	case nil:
+		return def, nil
+	case bool:
+		return t, nil
+	case string:
+		b, err := strconv.ParseBool(t)
+		if err != nil {
+			return false, errors.Statusf(kivik.StatusBadRequest, "kivik: invalid value for %s: %s", name, t)
+		}
+		return b, nil
+	}
+	return false, errors.Statusf(kivik.StatusBadRequest, "kivik: invalid value for %s: %v", name, opts[name])
+}
+
+// IntOption returns the named integer option, or 0 if it is unset.
+func IntOption(opts map[string]interface{}, name string) (int, error) {
+	switch t := opts[name].(type) {
+	case nil:
+		return 0, nil
+	case int:
+		return t, nil
+	case int64:
+		return int(t), nil
+	case float64:
+		return int(t), nil
+	case string:
+		n, err := strconv.Atoi(t)
+		if err != nil {
+			return 0, errors.Statusf(kivik.StatusBadRequest, "kivik: invalid value for %s: %s", name, t)
+		}
+		return n, nil
+	}
+	return 0, errors.Statusf(kivik.StatusBadRequest, "kivik: invalid value for %s: %v", name, opts[name])
+}
+
+// KeyOption decodes a key option, which must be a document ID. Keys passed as
+// strings are expected to be JSON encoded, as by kivik.EncodeKey, but a string
+// which is not valid JSON is taken as the ID itself.
+func KeyOption(value interface{}) (string, error) {
+	str, isString := value.(string)
+	if !isString {
+		asJSON, err := json.Marshal(value)
+		if err != nil {
+			return "", errors.WrapStatus(kivik.StatusBadRequest, err)
+		}
+		str = string(asJSON)
+	}
+	var key interface{}
+	if err := json.Unmarshal([]byte(str), &key); err != nil {
+		if isString {
+			return str, nil
+		}
+		return "", errors.WrapStatus(kivik.StatusBadRequest, err)
+	}
+	id, ok := key.(string)
+	if !ok {
+		return "", errors.Statusf(kivik.StatusBadRequest, "kivik: invalid document ID key: %s", str)
+	}
+	return id, nil
+}
+
+// KeysOption decodes the keys option, which must be an array of document IDs.
+func KeysOption(value interface{}) ([]string, error) {
+	var keys []interface{}
+	switch t := value.(type) {
+	case string:
+		if err := json.Unmarshal([]byte(t), &keys); err != nil {
+			return nil, errors.Status(kivik.StatusBadRequest, "kivik: keys must be a JSON array")
+		}
+	case []string:
+		ids := make([]string, len(t))
+		copy(ids, t)
+		return ids, nil
+	case []interface{}:
+		keys = t
+	default:
+		return nil, errors.Statusf(kivik.StatusBadRequest, "kivik: invalid keys: %v", value)
+	}
+	ids := make([]string, len(keys))
+	for i, key := range keys {
+		id, ok := key.(string)
+		if !ok {
+			return nil, errors.Statusf(kivik.StatusBadRequest, "kivik: invalid document ID key: %v", key)
+		}
+		ids[i] = id
+	}
+	return ids, nil
+}
+
+// ParseAllDocsOptions parses the options of AllDocs.
+func ParseAllDocsOptions(opts map[string]interface{}) (*AllDocsOptions, error) {
+	o := &AllDocsOptions{}
+	var err error
+	if o.IncludeDocs, err = BoolOption(opts, "include_docs", false); err != nil {
+		return nil, err
+	}
+	if o.Descending, err = BoolOption(opts, "descending", false); err != nil {
+		return nil, err
+	}
+	if o.InclusiveEnd, err = BoolOption(opts, "inclusive_end", true); err != nil {
+		return nil, err
+	}
+	if o.UpdateSeq, err = BoolOption(opts, "update_seq", false); err != nil {
+		return nil, err
+	}
+	if o.Limit, err = IntOption(opts, "limit"); err != nil {
+		return nil, err
+	}
+	if o.Skip, err = IntOption(opts, "skip"); err != nil {
+		return nil, err
+	}
+	for _, name := range []string{"startkey", "start_key", "endkey", "end_key", "key"} {
+		value, ok := opts[name]
+		if !ok {
+			continue
+		}
+		key, err := KeyOption(value)
+		if err != nil {
+			return nil, err
+		}
+		switch name {
+		case "startkey", "start_key":
+			o.StartKey = &key
+		case "endkey", "end_key":
+			o.EndKey = &key
+		case "key":
+			o.StartKey, o.EndKey, o.InclusiveEnd = &key, &key, true
+		}
+	}
+	if keys, ok := opts["keys"]; ok {
+		if o.Keys, err = KeysOption(keys); err != nil {
+			return nil, err
+		}
+	}
+	return o, nil
+}
+
+// RequestedKeys returns the keys of the keys option, in the requested order,
+// less those skipped.
+func (o *AllDocsOptions) RequestedKeys() []string {
+	keys := o.Keys
+	if o.Descending {
+		keys = make([]string, len(o.Keys))
+		for i, key := range o.Keys {
+			keys[len(keys)-1-i] = key
+		}
+	}
+	if o.Skip >= len(keys) {
+		return nil
+	}
+	return keys[o.Skip:]
+}
+
+// SinceOption parses the since option, which may be a number, a string, or
+// "now", which is returned as -1, to be resolved by the driver when it reads
+// the changes.
+func SinceOption(since interface{}) (int64, error) {
+	var s string
+	switch t := since.(type) {
+	case nil:
+		return 0, nil
+	case int:
+		return int64(t), nil
+	case int64:
+		return t, nil
+	case string:
+		s = t
+	case kivik.SequenceID:
+		s = string(t)
+	case driver.SequenceID:
+		s = string(t)
+	default:
+		return 0, errors.Statusf(kivik.StatusBadRequest, "kivik: invalid since value %v", since)
+	}
+	if s == "now" {
+		return -1, nil
+	}
+	n, ok := kivik.SequenceID(s).Number()
+	if !ok {
+		return 0, errors.Statusf(kivik.StatusBadRequest, "kivik: invalid since value %q", s)
+	}
+	return n, nil
+}
+
+// ChangesOptions are the options supported by Changes.
+type ChangesOptions struct {
+	Filter *filter.Filter
+	// Since is -1 for "now".
+	Since       int64
+	Limit       int
+	IncludeDocs bool
+}
+
+// ParseChangesOptions parses the options of Changes, for a normal feed.
+// Other feeds are not supported by the named driver.
+func ParseChangesOptions(driverName string, opts map[string]interface{}) (*ChangesOptions, error) {
+	switch feed := fmt.Sprint(opts["feed"]); feed {
+	case "continuous", "longpoll", "eventsource":
+		return nil, errors.Statusf(kivik.StatusNotImplemented, "kivik: %s feed not supported by %s driver", feed, driverName)
+	}
+	o := &ChangesOptions{}
+	var err error
+	if o.Filter, err = filter.New(opts); err != nil {
+		return nil, err
+	}
+	if o.Since, err = SinceOption(opts["since"]); err != nil {
+		return nil, err
+	}
+	if o.Limit, err = IntOption(opts, "limit"); err != nil {
+		return nil, err
+	}
+	if o.IncludeDocs, err = BoolOption(opts, "include_docs", false); err != nil {
+		return nil, err
+	}
+	return o, nil
+}
@@ -0,0 +1,112 @@
+package docstore
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+
+	"github.com/flimzy/kivik/driver"
+)
+
+// rows is a fully buffered result set, so that no transaction is held open
+// while the caller iterates.
+type rows struct {
+	rows      []*driver.Row
+	offset    int64
+	totalRows int64
+	updateSeq string
+}
+
+var _ driver.Rows = &rows{}
+
+// NewRows returns a result set of the rows of AllDocs.
+func NewRows(result []*driver.Row, offset, totalRows int64, updateSeq string) driver.Rows {
+	return &rows{rows: result, offset: offset, totalRows: totalRows, updateSeq: updateSeq}
+}
+
+func (r *rows) Next(row *driver.Row) error {
+	if len(r.rows) == 0 {
+		return io.EOF
+	}
+	*row, r.rows = *r.rows[0], r.rows[1:]
+	return nil
+}
+
+func (r *rows) Close() error {
+	r.rows = nil
+	return nil
+}
+
+func (r *rows) Offset() int64     { return r.offset }
+func (r *rows) TotalRows() int64  { return r.totalRows }
+func (r *rows) UpdateSeq() string { return r.updateSeq }
+
+// AllDocsRow returns the row of AllDocs for revision rev of id. doc is the
+// document, if it is to be included.
+func AllDocsRow(id, rev string, deleted bool, doc json.RawMessage) *driver.Row {
+	key, _ := json.Marshal(id)
+	value := map[string]interface{}{"rev": rev}
+	if deleted {
+		value["deleted"] = true
+	}
+	valueJSON, _ := json.Marshal(value)
+	return &driver.Row{
+		ID:    id,
+		Key:   key,
+		Value: valueJSON,
+		Doc:   doc,
+	}
+}
+
+type changesFeed struct {
+	ctx     context.Context
+	changes []*driver.Change
+}
+
+var _ driver.Changes = &changesFeed{}
+
+// NewChanges returns a normal changes feed of changes, which ends once ctx
+// is done.
+func NewChanges(ctx context.Context, changes []*driver.Change) driver.Changes {
+	return &changesFeed{ctx: ctx, changes: changes}
+}
+
+func (c *changesFeed) Next(change *driver.Change) error {
+	if err := c.ctx.Err(); err != nil {
+		return err
+	}
+	if len(c.changes) == 0 {
+		return io.EOF
+	}
+	*change, c.changes = *c.changes[0], c.changes[1:]
+	return nil
+}
+
+func (c *changesFeed) Close() error {
+	c.changes = nil
+	return nil
+}
+
+type bulkResults struct {
+	results []*driver.BulkResult
+}
+
+var _ driver.BulkResults = &bulkResults{}
+
+// NewBulkResults returns the results of BulkDocs.
+func NewBulkResults(results []*driver.BulkResult) driver.BulkResults {
+	return &bulkResults{results: results}
+}
+
+func (r *bulkResults) Next(result *driver.BulkResult) error {
+	if len(r.results) == 0 {
+		return io.EOF
+	}
+	*result, r.results = *r.results[0], r.results[1:]
+	return nil
+}
+
+func (r *bulkResults) Close() error {
+	r.results = nil
+	return nil
+}
@@ -0,0 +1,154 @@
+package docstore
+
+import (
+	"encoding/json"
+	"strings"
+
+	"github.com/flimzy/kivik"
+	"github.com/flimzy/kivik/driver"
+	"github.com/flimzy/kivik/errors"
+)
+
+// Reader reads the documents of a database, within a transaction or snapshot
+// of the driver.
+type Reader interface {
+	// Current returns the current revision of docID, and whether it is a
+	// deletion. rev is empty if docID does not exist.
+	Current(docID string) (rev string, deleted bool, err error)
+	// Body returns the JSON body of revision rev of docID.
+	Body(docID, rev string) (json.RawMessage, error)
+}
+
+// Store reads and writes the documents of a database, within a write
+// transaction of the driver.
+type Store interface {
+	Reader
+	// Attachment returns the named attachment of revision rev of docID.
+	Attachment(docID, rev, filename string) (*Attachment, error)
+	// WriteRevision stores r as the current revision of docID, with the next
+	// update sequence of the database, along with its attachments.
+	WriteRevision(docID string, r *Revision) error
+	// LocalRev returns the revision of the local document docID, which is
+	// empty if it does not exist.
+	LocalRev(docID string) (string, error)
+	// WriteLocal stores the local document docID, with the revision number
+	// revNum, or removes it, if doc is a deletion.
+	WriteLocal(docID string, revNum int64, doc Doc) error
+}
+
+// Put writes a new revision of docID to s, and returns its revision ID. Local
+// documents have no revision history, and are excluded from AllDocs and the
+// changes feed.
+func Put(s Store, docID string, doc Doc) (string, error) {
+	if err := ValidDocID(docID); err != nil {
+		return "", err
+	}
+	if strings.HasPrefix(docID, LocalPrefix) {
+		return putLocal(s, docID, doc)
+	}
+	current, deleted, err := s.Current(docID)
+	if err != nil {
+		return "", err
+	}
+	r, err := Update(docID, doc, current, deleted, func(filename string) (*Attachment, error) {
+		return s.Attachment(docID, current, filename)
+	})
+	if err != nil {
+		return "", err
+	}
+	if err := s.WriteRevision(docID, r); err != nil {
+		return "", err
+	}
+	return r.Rev, nil
+}
+
+func putLocal(s Store, docID string, doc Doc) (string, error) {
+	current, err := s.LocalRev(docID)
+	if err != nil {
+		return "", err
+	}
+	doc["_id"] = docID
+	revNum, err := updateLocal(doc, current)
+	if err != nil {
+		return "", err
+	}
+	if err := s.WriteLocal(docID, revNum, doc); err != nil {
+		return "", err
+	}
+	return LocalRev(revNum), nil
+}
+
+// currentDoc returns the current revision of docID, to which an attachment is
+// to be added or removed with rev as its parent. If docID does not exist, or
+// is deleted, an empty document is returned.
+func currentDoc(s Store, docID, rev string) (Doc, error) {
+	current, deleted, err := s.Current(docID)
+	if err != nil {
+		return nil, err
+	}
+	if current == "" || deleted {
+		return Doc{"_rev": rev}, nil
+	}
+	if current != rev {
+		return nil, errors.Status(kivik.StatusConflict, "document update conflict")
+	}
+	body, err := s.Body(docID, rev)
+	if err != nil {
+		return nil, err
+	}
+	var doc Doc
+	if err := json.Unmarshal(body, &doc); err != nil {
+		return nil, errors.WrapStatus(kivik.StatusInternalServerError, err)
+	}
+	return doc, nil
+}
+
+// PutAttachment adds an attachment to revision rev of docID, creating the
+// document if it does not exist, and returns the new revision ID.
+func PutAttachment(s Store, docID, rev, filename, contentType string, data []byte) (string, error) {
+	doc, err := currentDoc(s, docID, rev)
+	if err != nil {
+		return "", err
+	}
+	addAttachment(doc, filename, contentType, data)
+	return Put(s, docID, doc)
+}
+
+// DeleteAttachment removes an attachment from revision rev of docID, and
+// returns the new revision ID.
+func DeleteAttachment(s Store, docID, rev, filename string) (string, error) {
+	doc, err := currentDoc(s, docID, rev)
+	if err != nil {
+		return "", err
+	}
+	if err := removeAttachment(doc, filename); err != nil {
+		return "", err
+	}
+	return Put(s, docID, doc)
+}
+
+// KeyRows returns the AllDocs rows of the requested keys of opts which exist,
+// including deleted documents, as CouchDB does.
+func KeyRows(r Reader, opts *AllDocsOptions) ([]*driver.Row, error) {
+	var result []*driver.Row
+	for _, key := range opts.RequestedKeys() {
+		if opts.Limit > 0 && len(result) >= opts.Limit {
+			break
+		}
+		rev, deleted, err := r.Current(key)
+		if err != nil {
+			return nil, err
+		}
+		if rev == "" {
+			continue
+		}
+		row := AllDocsRow(key, rev, deleted, nil)
+		if opts.IncludeDocs && !deleted {
+			if row.Doc, err = r.Body(key, rev); err != nil {
+				return nil, err
+			}
+		}
+		result = append(result, row)
+	}
+	return result, nil
+}
@@ -0,0 +1,150 @@
+package leveldb
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"strconv"
+
+	"github.com/syndtr/goleveldb/leveldb"
+	"github.com/syndtr/goleveldb/leveldb/util"
+
+	"github.com/flimzy/kivik"
+	"github.com/flimzy/kivik/driver"
+	"github.com/flimzy/kivik/driver/internal/docstore"
+	"github.com/flimzy/kivik/errors"
+)
+
+// AllDocs returns the current revisions of the undeleted documents, in order
+// of document ID, or those named by the keys option, in the order given. All
+// rows are read from a single snapshot.
+func (d *db) AllDocs(ctx context.Context, options map[string]interface{}) (driver.Rows, error) {
+	opts, err := docstore.ParseAllDocsOptions(options)
+	if err != nil {
+		return nil, err
+	}
+	limit := -1
+	if _, ok := options["limit"]; ok {
+		limit = opts.Limit
+	}
+	var result []*driver.Row
+	var offset, totalRows int64
+	var updateSeq string
+	err = d.view(ctx, func(snap *leveldb.Snapshot) error {
+		dbRec, err := d.record(snap)
+		if err != nil {
+			return err
+		}
+		if opts.UpdateSeq {
+			updateSeq = strconv.FormatUint(dbRec.UpdateSeq, 10)
+		}
+		// The first pass counts the documents, and those which precede the
+		// start key, in the requested order.
+		prefix := key(docPrefix, d.dbName)
+		iter := snap.NewIterator(util.BytesPrefix(prefix), nil)
+		defer iter.Release()
+		for iter.Next() {
+			record := &docRecord{}
+			if err := json.Unmarshal(iter.Value(), record); err != nil {
+				return errors.WrapStatus(kivik.StatusInternalServerError, err)
+			}
+			if record.Deleted {
+				continue
+			}
+			totalRows++
+			if opts.StartKey != nil && opts.Keys == nil {
+				cmp := bytes.Compare(iter.Key()[len(prefix):], []byte(*opts.StartKey))
+				if !opts.Descending && cmp < 0 || opts.Descending && cmp > 0 {
+					offset++
+				}
+			}
+		}
+		if err := iter.Error(); err != nil {
+			return levelError(err)
+		}
+		if opts.Keys != nil {
+			result, err = docstore.KeyRows(docReader{d: d, r: snap}, opts)
+			return err
+		}
+		offset += int64(opts.Skip)
+		result, err = d.allDocsRange(snap, opts, limit)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return docstore.NewRows(result, offset, totalRows, updateSeq), nil
+}
+
+// allDocsRange scans the document records from the start key to the end key.
+func (d *db) allDocsRange(snap *leveldb.Snapshot, opts *docstore.AllDocsOptions, limit int) ([]*driver.Row, error) {
+	prefix := key(docPrefix, d.dbName)
+	iter := snap.NewIterator(util.BytesPrefix(prefix), nil)
+	defer iter.Release()
+	var ok bool
+	next := iter.Next
+	switch {
+	case opts.Descending && opts.StartKey != nil:
+		start := append(append([]byte{}, prefix...), *opts.StartKey...)
+		if ok = iter.Seek(start); !ok {
+			ok = iter.Last()
+		} else if bytes.Compare(iter.Key(), start) > 0 {
+			ok = iter.Prev()
+		}
+		next = iter.Prev
+	case opts.Descending:
+		ok = iter.Last()
+		next = iter.Prev
+	case opts.StartKey != nil:
+		ok = iter.Seek(append(append([]byte{}, prefix...), *opts.StartKey...))
+	default:
+		ok = iter.First()
+	}
+	pastEnd := func(id []byte) bool {
+		if opts.EndKey == nil {
+			return false
+		}
+		cmp := bytes.Compare(id, []byte(*opts.EndKey))
+		if opts.Descending {
+			cmp = -cmp
+		}
+		return cmp > 0 || cmp == 0 && !opts.InclusiveEnd
+	}
+	var result []*driver.Row
+	skip := opts.Skip
+	for ; ok; ok = next() {
+		id := iter.Key()[len(prefix):]
+		if pastEnd(id) || limit >= 0 && len(result) >= limit {
+			break
+		}
+		record := &docRecord{}
+		if err := json.Unmarshal(iter.Value(), record); err != nil {
+			return nil, errors.WrapStatus(kivik.StatusInternalServerError, err)
+		}
+		if record.Deleted {
+			continue
+		}
+		if skip > 0 {
+			skip--
+			continue
+		}
+		row, err := d.allDocsRow(snap, string(id), record, opts.IncludeDocs)
+		if err != nil {
+			return nil, err
+		}
+		result = append(result, row)
+	}
+	return result, levelError(iter.Error())
+}
+
+func (d *db) allDocsRow(snap *leveldb.Snapshot, id string, record *docRecord, includeDoc bool) (*driver.Row, error) {
+	row := docstore.AllDocsRow(id, record.Rev, record.Deleted, nil)
+	if includeDoc {
+		rev, err := d.revision(snap, id, record.Rev)
+		if err != nil {
+			return nil, err
+		}
+		row.Doc = rev.Body
+	}
+	return row, nil
+}
@@ -0,0 +1,80 @@
+package leveldb
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"io/ioutil"
+
+	"github.com/syndtr/goleveldb/leveldb"
+
+	"github.com/flimzy/kivik"
+	"github.com/flimzy/kivik/driver"
+	"github.com/flimzy/kivik/driver/internal/docstore"
+	"github.com/flimzy/kivik/errors"
+)
+
+var _ driver.AttachmentMetaer = &db{}
+
+func (d *db) loadAttachment(r reader, docID, rev, filename string) (*docstore.Attachment, error) {
+	att := &docstore.Attachment{}
+	return att, getRecord(r, key(attPrefix, d.dbName, docID, rev, filename), att)
+}
+
+// getAttachment returns the attachment of the revision rev of docID, or of
+// its current revision, if rev is empty.
+func (d *db) getAttachment(ctx context.Context, docID, rev, filename string) (*docstore.Attachment, error) {
+	var att *docstore.Attachment
+	err := d.view(ctx, func(snap *leveldb.Snapshot) error {
+		if rev == "" {
+			doc, err := d.current(snap, docID)
+			if err != nil {
+				return err
+			}
+			if doc.Deleted {
+				return errors.Status(kivik.StatusNotFound, "deleted")
+			}
+			rev = doc.Rev
+		}
+		var err error
+		att, err = d.loadAttachment(snap, docID, rev, filename)
+		return err
+	})
+	return att, err
+}
+
+func (d *db) GetAttachment(ctx context.Context, docID, rev, filename string) (contentType string, md5sum driver.MD5sum, body io.ReadCloser, err error) {
+	att, err := d.getAttachment(ctx, docID, rev, filename)
+	if err != nil {
+		return "", driver.MD5sum{}, nil, err
+	}
+	return att.ContentType, att.MD5sum(), ioutil.NopCloser(bytes.NewReader(att.Data)), nil
+}
+
+func (d *db) GetAttachmentMeta(ctx context.Context, docID, rev, filename string) (contentType string, md5sum driver.MD5sum, err error) {
+	att, err := d.getAttachment(ctx, docID, rev, filename)
+	if err != nil {
+		return "", driver.MD5sum{}, err
+	}
+	return att.ContentType, att.MD5sum(), nil
+}
+
+func (d *db) PutAttachment(ctx context.Context, docID, rev, filename, contentType string, body io.Reader) (newRev string, err error) {
+	data, err := ioutil.ReadAll(body)
+	if err != nil {
+		return "", errors.WrapStatus(kivik.StatusBadRequest, err)
+	}
+	err = d.write(ctx, func(tx *txn) error {
+		newRev, err = docstore.PutAttachment(d.store(tx), docID, rev, filename, contentType, data)
+		return err
+	})
+	return newRev, err
+}
+
+func (d *db) DeleteAttachment(ctx context.Context, docID, rev, filename string) (newRev string, err error) {
+	err = d.write(ctx, func(tx *txn) error {
+		newRev, err = docstore.DeleteAttachment(d.store(tx), docID, rev, filename)
+		return err
+	})
+	return newRev, err
+}
@@ -0,0 +1,40 @@
+package leveldb
+
+import (
+	"context"
+
+	"github.com/flimzy/kivik/driver"
+	"github.com/flimzy/kivik/driver/internal/docstore"
+)
+
+// BulkDocs writes all of docs in a single batch. A document which fails, for
+// instance with a conflict, is reported in its result, and does not prevent
+// the others from being written.
+func (d *db) BulkDocs(ctx context.Context, docs []interface{}) (driver.BulkResults, error) {
+	results := make([]*driver.BulkResult, len(docs))
+	err := d.write(ctx, func(tx *txn) error {
+		for i, doc := range docs {
+			result := &driver.BulkResult{}
+			results[i] = result
+			couchDoc, err := docstore.ToDoc(doc)
+			if err != nil {
+				result.Error = err
+				continue
+			}
+			docID, err := docstore.DocID(couchDoc)
+			if err != nil {
+				return err
+			}
+			result.ID = docID
+			docTx := newTxn(tx.db, tx)
+			if result.Rev, result.Error = docstore.Put(d.store(docTx), docID, couchDoc); result.Error == nil {
+				docTx.merge()
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return docstore.NewBulkResults(results), nil
+}
@@ -0,0 +1,77 @@
+package leveldb
+
+import (
+	"context"
+	"encoding/json"
+	"strconv"
+
+	"github.com/syndtr/goleveldb/leveldb"
+	"github.com/syndtr/goleveldb/leveldb/util"
+
+	"github.com/flimzy/kivik"
+	"github.com/flimzy/kivik/driver"
+	"github.com/flimzy/kivik/driver/internal/docstore"
+	"github.com/flimzy/kivik/errors"
+)
+
+// Changes returns the changes since the requested sequence, as a normal feed,
+// read from a snapshot of the
+// sequence index. The since, limit, include_docs
+// and filter options are supported. Continuous feeds are not.
+func (d *db) Changes(ctx context.Context, opts map[string]interface{}) (driver.Changes, error) {
+	o, err := docstore.ParseChangesOptions("leveldb", opts)
+	if err != nil {
+		return nil, err
+	}
+	var changes []*driver.Change
+	err = d.view(ctx, func(snap *leveldb.Snapshot) error {
+		dbRec, err := d.record(snap)
+		if err != nil {
+			return err
+		}
+		if o.Since < 0 {
+			o.Since = int64(dbRec.UpdateSeq)
+		}
+		iter := snap.NewIterator(&util.Range{
+			Start: seqKey(d.dbName, uint64(o.Since)+1),
+			Limit: util.BytesPrefix(key(seqPrefix, d.dbName)).Limit,
+		}, nil)
+		defer iter.Release()
+		for iter.Next() {
+			if o.Limit > 0 && len(changes) >= o.Limit {
+				break
+			}
+			id := string(iter.Value())
+			record, err := d.current(snap, id)
+			if err != nil {
+				return err
+			}
+			rev, err := d.revision(snap, id, record.Rev)
+			if err != nil {
+				return err
+			}
+			var doc map[string]interface{}
+			if err := json.Unmarshal(rev.Body, &doc); err != nil {
+				return errors.WrapStatus(kivik.StatusInternalServerError, err)
+			}
+			if !o.Filter.Match(id, doc) {
+				continue
+			}
+			change := &driver.Change{
+				ID:      id,
+				Seq:     driver.SequenceID(strconv.FormatUint(record.Seq, 10)),
+				Deleted: record.Deleted,
+				Changes: driver.ChangedRevs{record.Rev},
+			}
+			if o.IncludeDocs {
+				change.Doc = rev.Body
+			}
+			changes = append(changes, change)
+		}
+		return levelError(iter.Error())
+	})
+	if err != nil {
+		return nil, err
+	}
+	return docstore.NewChanges(ctx, changes), nil
+}
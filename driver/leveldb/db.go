@@ -0,0 +1,436 @@
+package leveldb
+
+import (
+	"context"
+	"encoding/json"
+	"strconv"
+	"strings"
+
+	"github.com/syndtr/goleveldb/leveldb"
+	"github.com/syndtr/goleveldb/leveldb/util"
+
+	"github.com/flimzy/kivik"
+	"github.com/flimzy/kivik/driver"
+	"github.com/flimzy/kivik/driver/internal/docstore"
+	"github.com/flimzy/kivik/errors"
+)
+
+var notImplemented = errors.Status(kivik.StatusNotImplemented, "kivik: not supported by leveldb driver")
+
+type db struct {
+	*client
+	dbName string
+}
+
+var _ driver.DB = &db{}
+var _ driver.Rever = &db{}
+
+// docRecord is the record of a document, which points to its current
+// revision.
+type docRecord struct {
+	Rev     string `json:"rev"`
+	Seq     uint64 `json:"seq"`
+	Deleted bool   `json:"deleted,omitempty"`
+}
+
+// revRecord is the record of a revision. Body is nil for revisions removed by
+// compaction.
+type revRecord struct {
+	Parent  string          `json:"parent,omitempty"`
+	Seq     uint64          `json:"seq"`
+	Deleted bool            `json:"deleted,omitempty"`
+	Body    json.RawMessage `json:"body,omitempty"`
+}
+
+// record returns the database's record, which is absent if the database has
+// been destroyed since the db was obtained.
+func (d *db) record(r reader) (*dbRecord, error) {
+	record := &dbRecord{}
+	if err := getRecord(r, dbKey(d.dbName), record); err != nil {
+		if errors.StatusCode(err) == kivik.StatusNotFound {
+			return nil, errors.Status(kivik.StatusNotFound, "database does not exist")
+		}
+		return nil, err
+	}
+	return record, nil
+}
+
+// current returns the record of docID.
+func (d *db) current(r reader, docID string) (*docRecord, error) {
+	record := &docRecord{}
+	return record, getRecord(r, key(docPrefix, d.dbName, docID), record)
+}
+
+// revision returns the record of revision rev of docID.
+func (d *db) revision(r reader, docID, rev string) (*revRecord, error) {
+	record := &revRecord{}
+	return record, getRecord(r, key(revPrefix, d.dbName, docID, rev), record)
+}
+
+func (d *db) Get(ctx context.Context, docID string, opts map[string]interface{}) (json.RawMessage, error) {
+	var body json.RawMessage
+	err := d.view(ctx, func(snap *leveldb.Snapshot) error {
+		if strings.HasPrefix(docID, docstore.LocalPrefix) {
+			var err error
+			body, err = snap.Get(key(localPrefix, d.dbName, docID), nil)
+			return levelError(err)
+		}
+		rev, _ := opts["rev"].(string)
+		if rev == "" {
+			doc, err := d.current(snap, docID)
+			if err != nil {
+				return err
+			}
+			if doc.Deleted {
+				return errors.Status(kivik.StatusNotFound, "deleted")
+			}
+			rev = doc.Rev
+		}
+		record, err := d.revision(snap, docID, rev)
+		if err != nil {
+			return err
+		}
+		if record.Body == nil {
+			// Removed by compaction
+			return errors.Status(kivik.StatusNotFound, "missing")
+		}
+		body = record.Body
+		return nil
+	})
+	return body, err
+}
+
+// Rev returns the current revision of the document, without reading its body.
+func (d *db) Rev(ctx context.Context, docID string) (string, error) {
+	if strings.HasPrefix(docID, docstore.LocalPrefix) {
+		body, err := d.Get(ctx, docID, nil)
+		if err != nil {
+			return "", err
+		}
+		var doc docstore.Doc
+		if err := json.Unmarshal(body, &doc); err != nil {
+			return "", errors.WrapStatus(kivik.StatusInternalServerError, err)
+		}
+		return doc.Rev(), nil
+	}
+	if err := ctx.Err(); err != nil {
+		return "", err
+	}
+	doc, err := d.current(d.db, docID)
+	if err != nil {
+		return "", err
+	}
+	if doc.Deleted {
+		return "", errors.Status(kivik.StatusNotFound, "deleted")
+	}
+	return doc.Rev, nil
+}
+
+func (d *db) CreateDoc(ctx context.Context, doc interface{}) (docID, rev string, err error) {
+	couchDoc, err := docstore.ToDoc(doc)
+	if err != nil {
+		return "", "", err
+	}
+	if id, ok := couchDoc["_id"].(string); ok {
+		docID = id
+	} else if docID, err = docstore.RandomID(); err != nil {
+		return "", "", err
+	}
+	err = d.write(ctx, func(tx *txn) error {
+		rev, err = docstore.Put(d.store(tx), docID, couchDoc)
+		return err
+	})
+	return docID, rev, err
+}
+
+func (d *db) Put(ctx context.Context, docID string, doc interface{}) (rev string, err error) {
+	couchDoc, err := docstore.ToDoc(doc)
+	if err != nil {
+		return "", err
+	}
+	err = d.write(ctx, func(tx *txn) error {
+		rev, err = docstore.Put(d.store(tx), docID, couchDoc)
+		return err
+	})
+	return rev, err
+}
+
+func (d *db) Delete(ctx context.Context, docID, rev string) (newRev string, err error) {
+	if !strings.HasPrefix(docID, docstore.LocalPrefix) {
+		if _, _, err := docstore.ParseRev(rev); err != nil {
+			return "", err
+		}
+	}
+	err = d.write(ctx, func(tx *txn) error {
+		newRev, err = docstore.Put(d.store(tx), docID, docstore.Doc{"_rev": rev, "_deleted": true})
+		return err
+	})
+	return newRev, err
+}
+
+// docReader is the docstore.Reader of the database, within a snapshot or txn.
+type docReader struct {
+	d *db
+	r reader
+}
+
+var _ docstore.Reader = docReader{}
+
+func (r docReader) Current(docID string) (string, bool, error) {
+	record, err := r.d.current(r.r, docID)
+	if errors.StatusCode(err) == kivik.StatusNotFound {
+		return "", false, nil
+	}
+	if err != nil {
+		return "", false, err
+	}
+	return record.Rev, record.Deleted, nil
+}
+
+func (r docReader) Body(docID, rev string) (json.RawMessage, error) {
+	record, err := r.d.revision(r.r, docID, rev)
+	if err != nil {
+		return nil, err
+	}
+	return record.Body, nil
+}
+
+// store is the docstore.Store of the database, within tx.
+type store struct {
+	docReader
+	tx *txn
+}
+
+var _ docstore.Store = &store{}
+
+func (d *db) store(tx *txn) *store {
+	return &store{docReader: docReader{d: d, r: tx}, tx: tx}
+}
+
+func (s *store) Attachment(docID, rev, filename string) (*docstore.Attachment, error) {
+	return s.d.loadAttachment(s.tx, docID, rev, filename)
+}
+
+// WriteRevision increments the update sequence in the database's record, and
+// stores the revision, the document record and its attachments, moving the
+// document's sequence key to the new sequence.
+func (s *store) WriteRevision(docID string, r *docstore.Revision) error {
+	d, tx := s.d, s.tx
+	dbRec, err := d.record(tx)
+	if err != nil {
+		return err
+	}
+	current, err := d.current(tx, docID)
+	exists := err == nil
+	if err != nil && errors.StatusCode(err) != kivik.StatusNotFound {
+		return err
+	}
+	dbRec.UpdateSeq++
+	seq := dbRec.UpdateSeq
+	if err := tx.putRecord(dbKey(d.dbName), dbRec); err != nil {
+		return err
+	}
+	if err := tx.putRecord(key(revPrefix, d.dbName, docID, r.Rev), &revRecord{
+		Parent:  r.Parent,
+		Seq:     seq,
+		Deleted: r.Deleted,
+		Body:    r.Body,
+	}); err != nil {
+		return err
+	}
+	if err := tx.putRecord(key(docPrefix, d.dbName, docID), &docRecord{
+		Rev:     r.Rev,
+		Seq:     seq,
+		Deleted: r.Deleted,
+	}); err != nil {
+		return err
+	}
+	if exists {
+		// Only the latest change to each document appears in the changes feed.
+		tx.delete(seqKey(d.dbName, current.Seq))
+	}
+	tx.put(seqKey(d.dbName, seq), []byte(docID))
+	for _, att := range r.Attachments {
+		if err := tx.putRecord(key(attPrefix, d.dbName, docID, r.Rev, att.Filename), att); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// LocalRev also returns an error if the database has been destroyed, as local
+// documents are stored outside of the database's record.
+func (s *store) LocalRev(docID string) (string, error) {
+	if _, err := s.d.record(s.tx); err != nil {
+		return "", err
+	}
+	var current docstore.Doc
+	if err := getRecord(s.tx, key(localPrefix, s.d.dbName, docID), &current); err != nil && errors.StatusCode(err) != kivik.StatusNotFound {
+		return "", err
+	}
+	return current.Rev(), nil
+}
+
+func (s *store) WriteLocal(docID string, _ int64, doc docstore.Doc) error {
+	k := key(localPrefix, s.d.dbName, docID)
+	if doc.Deleted() {
+		s.tx.delete(k)
+		return nil
+	}
+	return s.tx.putRecord(k, doc)
+}
+
+// Stats scans the document, revision and attachment keys of the database in
+// the snapshot. DiskSize counts every stored revision body and attachment, and
+// ActiveSize and ExternalSize those of the current revisions of undeleted
+// documents.
+func (d *db) Stats(ctx context.Context) (*driver.DBStats, error) {
+	stats := &driver.DBStats{Name: d.dbName}
+	err := d.view(ctx, func(snap *leveldb.Snapshot) error {
+		dbRec, err := d.record(snap)
+		if err != nil {
+			return err
+		}
+		stats.UpdateSeq = strconv.FormatUint(dbRec.UpdateSeq, 10)
+		current := make(map[string]bool)
+		iter := snap.NewIterator(util.BytesPrefix(key(docPrefix, d.dbName)), nil)
+		defer iter.Release()
+		for iter.Next() {
+			record := &docRecord{}
+			if err := json.Unmarshal(iter.Value(), record); err != nil {
+				return errors.WrapStatus(kivik.StatusInternalServerError, err)
+			}
+			if record.Deleted {
+				stats.DeletedCount++
+				continue
+			}
+			stats.DocCount++
+			current[splitKey(iter.Key())[0]+keySeparator+record.Rev] = true
+		}
+		if err := iter.Error(); err != nil {
+			return levelError(err)
+		}
+		revs := snap.NewIterator(util.BytesPrefix(key(revPrefix, d.dbName)), nil)
+		defer revs.Release()
+		for revs.Next() {
+			record := &revRecord{}
+			if err := json.Unmarshal(revs.Value(), record); err != nil {
+				return errors.WrapStatus(kivik.StatusInternalServerError, err)
+			}
+			stats.DiskSize += int64(len(record.Body))
+			if parts := splitKey(revs.Key()); current[parts[0]+keySeparator+parts[1]] {
+				stats.ActiveSize += int64(len(record.Body))
+			}
+		}
+		if err := revs.Error(); err != nil {
+			return levelError(err)
+		}
+		atts := snap.NewIterator(util.BytesPrefix(key(attPrefix, d.dbName)), nil)
+		defer atts.Release()
+		for atts.Next() {
+			att := &docstore.Attachment{}
+			if err := json.Unmarshal(atts.Value(), att); err != nil {
+				return errors.WrapStatus(kivik.StatusInternalServerError, err)
+			}
+			stats.DiskSize += int64(len(att.Data))
+			if parts := splitKey(atts.Key()); current[parts[0]+keySeparator+parts[1]] {
+				stats.ActiveSize += int64(len(att.Data))
+			}
+		}
+		return levelError(atts.Error())
+	})
+	if err != nil {
+		return nil, err
+	}
+	stats.ExternalSize = stats.ActiveSize
+	return stats, nil
+}
+
+// Compact rewrites the records of non-current revisions without their bodies,
+// which keeps the revision history, and deletes their attachment keys.
+func (d *db) Compact(ctx context.Context) error {
+	return d.write(ctx, func(tx *txn) error {
+		if _, err := d.record(tx); err != nil {
+			return err
+		}
+		isCurrent := func(k []byte) (bool, error) {
+			parts := splitKey(k)
+			record, err := d.current(tx, parts[0])
+			if err != nil {
+				return false, err
+			}
+			return record.Rev == parts[1], nil
+		}
+		revs, err := tx.scan(key(revPrefix, d.dbName))
+		if err != nil {
+			return err
+		}
+		for _, k := range revs {
+			if current, err := isCurrent(k); err != nil || current {
+				if err != nil {
+					return err
+				}
+				continue
+			}
+			record := &revRecord{}
+			if err := getRecord(tx, k, record); err != nil {
+				return err
+			}
+			if record.Body == nil {
+				continue
+			}
+			record.Body = nil
+			if err := tx.putRecord(k, record); err != nil {
+				return err
+			}
+		}
+		atts, err := tx.scan(key(attPrefix, d.dbName))
+		if err != nil {
+			return err
+		}
+		for _, k := range atts {
+			current, err := isCurrent(k)
+			if err != nil {
+				return err
+			}
+			if !current {
+				tx.delete(k)
+			}
+		}
+		return nil
+	})
+}
+
+func (d *db) CompactView(_ context.Context, _ string) error {
+	return notImplemented
+}
+
+func (d *db) ViewCleanup(_ context.Context) error {
+	return notImplemented
+}
+
+func (d *db) Query(_ context.Context, _, _ string, _ map[string]interface{}) (driver.Rows, error) {
+	return nil, notImplemented
+}
+
+func (d *db) Security(ctx context.Context) (*driver.Security, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	record, err := d.record(d.db)
+	if err != nil {
+		return nil, err
+	}
+	return record.Security, nil
+}
+
+func (d *db) SetSecurity(ctx context.Context, sec *driver.Security) error {
+	return d.write(ctx, func(tx *txn) error {
+		record, err := d.record(tx)
+		if err != nil {
+			return err
+		}
+		record.Security = sec
+		return tx.putRecord(dbKey(d.dbName), record)
+	})
+}
@@ -0,0 +1,228 @@
+// Package leveldb provides a pure-Go, embedded Kivik driver built on
+// goleveldb, optimized for write-heavy workloads.
+//
+//	import _ "github.com/flimzy/kivik/driver/leveldb"
+//
+//	client, err := kivik.New(ctx, "leveldb", "/path/to/kivik")
+//
+// The DSN is the path of the LevelDB directory. All databases share a single
+// LevelDB key space, in which each key is prefixed by the kind of record it
+// holds, and the name of its database.
+//
+// Concurrent writes are committed together: while one batch is being written,
+// further writes queue, and are then committed as a single LevelDB batch. Each
+// write is applied atomically, and observes the writes queued before it. Reads
+// of AllDocs and the changes feed are served from a snapshot, so are isolated
+// from concurrent writes. Views, Mango queries and continuous changes feeds
+// are not supported.
+package leveldb
+
+import (
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"strings"
+	"sync"
+
+	"github.com/syndtr/goleveldb/leveldb"
+	"github.com/syndtr/goleveldb/leveldb/opt"
+	"github.com/syndtr/goleveldb/leveldb/util"
+
+	"github.com/flimzy/kivik"
+	"github.com/flimzy/kivik/driver"
+	"github.com/flimzy/kivik/driver/common"
+	"github.com/flimzy/kivik/errors"
+)
+
+// Identifying constants
+const (
+	Version = "0.0.1"
+	Vendor  = "Kivik LevelDB Adaptor"
+)
+
+type levelDriver struct{}
+
+var _ driver.Driver = &levelDriver{}
+
+func init() {
+	kivik.Register("leveldb", &levelDriver{})
+}
+
+// Key prefixes, identifying the kind of record held under a key.
+const (
+	dbPrefix     = 'D'
+	docPrefix    = 'd'
+	revPrefix    = 'r'
+	seqPrefix    = 's'
+	localPrefix  = 'l'
+	attPrefix    = 'a'
+	keySeparator = "\x00"
+)
+
+// dataPrefixes are the kinds of record which belong to a database.
+var dataPrefixes = []byte{docPrefix, revPrefix, seqPrefix, localPrefix, attPrefix}
+
+// key returns the key of a record of the given kind, belonging to dbName.
+// Database names may not contain the separator, so the records of each
+// database are contiguous.
+func key(kind byte, dbName string, parts ...string) []byte {
+	return []byte(string(kind) + dbName + keySeparator + strings.Join(parts, keySeparator))
+}
+
+// splitKey returns the parts of a key returned by key, after the database
+// name.
+func splitKey(k []byte) []string {
+	return strings.Split(string(k), keySeparator)[1:]
+}
+
+// seqKey returns the key of a sequence, which sorts in numeric order.
+func seqKey(dbName string, seq uint64) []byte {
+	k := key(seqPrefix, dbName)
+	num := make([]byte, 8)
+	binary.BigEndian.PutUint64(num, seq)
+	return append(k, num...)
+}
+
+func (d *levelDriver) NewClient(_ context.Context, path string) (driver.Client, error) {
+	ldb, err := leveldb.OpenFile(path, nil)
+	if err != nil {
+		return nil, errors.Wrap(err, "kivik: failed to open leveldb database")
+	}
+	return &client{
+		Client: common.NewClient(Version, Vendor),
+		db:     ldb,
+	}, nil
+}
+
+type client struct {
+	*common.Client
+	db *leveldb.DB
+
+	// writeMu is held by the writer committing a batch.
+	writeMu sync.Mutex
+	// queueMu protects queue, the writes awaiting the next batch.
+	queueMu sync.Mutex
+	queue   []*writeReq
+}
+
+var _ driver.Client = &client{}
+
+// dbRecord is the record of a database, under its dbPrefix key.
+type dbRecord struct {
+	Security  *driver.Security `json:"security"`
+	UpdateSeq uint64           `json:"update_seq"`
+}
+
+func (c *client) AllDBs(ctx context.Context, _ map[string]interface{}) ([]string, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	iter := c.db.NewIterator(util.BytesPrefix([]byte{dbPrefix}), nil)
+	defer iter.Release()
+	dbs := []string{}
+	for iter.Next() {
+		dbs = append(dbs, string(iter.Key()[1:]))
+	}
+	return dbs, levelError(iter.Error())
+}
+
+func (c *client) DBExists(ctx context.Context, dbName string, _ map[string]interface{}) (bool, error) {
+	if err := ctx.Err(); err != nil {
+		return false, err
+	}
+	exists, err := c.db.Has(dbKey(dbName), nil)
+	return exists, levelError(err)
+}
+
+func dbKey(dbName string) []byte {
+	return append([]byte{dbPrefix}, dbName...)
+}
+
+func (c *client) CreateDB(ctx context.Context, dbName string, _ map[string]interface{}) error {
+	if !kivik.ValidDBName(dbName) {
+		return errors.NamedStatus(kivik.StatusBadRequest, "illegal_database_name", "invalid database name")
+	}
+	return c.write(ctx, func(tx *txn) error {
+		if _, err := tx.Get(dbKey(dbName), nil); err == nil {
+			return errors.Status(kivik.StatusPreconditionFailed, "database exists")
+		} else if err != leveldb.ErrNotFound {
+			return levelError(err)
+		}
+		return tx.putRecord(dbKey(dbName), &dbRecord{Security: &driver.Security{}})
+	})
+}
+
+func (c *client) DestroyDB(ctx context.Context, dbName string, _ map[string]interface{}) error {
+	return c.write(ctx, func(tx *txn) error {
+		if _, err := tx.Get(dbKey(dbName), nil); err == leveldb.ErrNotFound {
+			return errors.Status(kivik.StatusNotFound, "database does not exist")
+		} else if err != nil {
+			return levelError(err)
+		}
+		tx.delete(dbKey(dbName))
+		for _, kind := range dataPrefixes {
+			keys, err := tx.scan(key(kind, dbName))
+			if err != nil {
+				return err
+			}
+			for _, k := range keys {
+				tx.delete(k)
+			}
+		}
+		return nil
+	})
+}
+
+func (c *client) DB(ctx context.Context, dbName string, _ map[string]interface{}) (driver.DB, error) {
+	exists, err := c.DBExists(ctx, dbName, nil)
+	if err != nil {
+		return nil, err
+	}
+	if !exists {
+		return nil, errors.Status(kivik.StatusNotFound, "database does not exist")
+	}
+	return &db{
+		client: c,
+		dbName: dbName,
+	}, nil
+}
+
+// view calls fn with a snapshot of the database, unless ctx is already done.
+func (c *client) view(ctx context.Context, fn func(*leveldb.Snapshot) error) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	snap, err := c.db.GetSnapshot()
+	if err != nil {
+		return levelError(err)
+	}
+	defer snap.Release()
+	return fn(snap)
+}
+
+// levelError converts an error returned by goleveldb to a kivik error.
+func levelError(err error) error {
+	switch err {
+	case nil:
+		return nil
+	case leveldb.ErrNotFound:
+		return errors.Status(kivik.StatusNotFound, "missing")
+	}
+	return errors.WrapStatus(kivik.StatusInternalServerError, err)
+}
+
+// reader is satisfied by *leveldb.DB, *leveldb.Snapshot and *txn.
+type reader interface {
+	Get(key []byte, ro *opt.ReadOptions) ([]byte, error)
+}
+
+func getRecord(r reader, k []byte, record interface{}) error {
+	value, err := r.Get(k, nil)
+	if err != nil {
+		return levelError(err)
+	}
+	if err := json.Unmarshal(value, record); err != nil {
+		return errors.WrapStatus(kivik.StatusInternalServerError, err)
+	}
+	return nil
+}
@@ -0,0 +1,428 @@
+package leveldb
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/flimzy/diff"
+	"github.com/flimzy/kivik"
+	"github.com/flimzy/kivik/driver"
+)
+
+// setupDB returns a client for a new file in a temporary directory, which the
+// returned function removes, with the database foo.
+func setupDB(t *testing.T) (*client, driver.DB, func()) {
+	dir, err := ioutil.TempDir("", "kivik-leveldb")
+	if err != nil {
+		t.Fatal(err)
+	}
+	c, err := (&levelDriver{}).NewClient(context.Background(), filepath.Join(dir, "kivik"))
+	if err != nil {
+		_ = os.RemoveAll(dir)
+		t.Fatal(err)
+	}
+	cleanup := func() {
+		_ = c.(*client).db.Close()
+		_ = os.RemoveAll(dir)
+	}
+	if err := c.CreateDB(context.Background(), "foo", nil); err != nil {
+		cleanup()
+		t.Fatal(err)
+	}
+	db, err := c.DB(context.Background(), "foo", nil)
+	if err != nil {
+		cleanup()
+		t.Fatal(err)
+	}
+	return c.(*client), db, cleanup
+}
+
+func TestDBs(t *testing.T) {
+	c, _, cleanup := setupDB(t)
+	defer cleanup()
+	ctx := context.Background()
+	if err := c.CreateDB(ctx, "foo", nil); kivik.StatusCode(err) != kivik.StatusPreconditionFailed {
+		t.Errorf("Unexpected error creating existing DB: %v", err)
+	}
+	if err := c.CreateDB(ctx, "Foo", nil); kivik.StatusCode(err) != kivik.StatusBadRequest {
+		t.Errorf("Unexpected error creating invalid DB: %v", err)
+	}
+	if err := c.CreateDB(ctx, "_users", nil); err != nil {
+		t.Fatal(err)
+	}
+	dbs, err := c.AllDBs(ctx, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if d := diff.Interface([]string{"_users", "foo"}, dbs); d != "" {
+		t.Error(d)
+	}
+	if err := c.DestroyDB(ctx, "foo", nil); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.DestroyDB(ctx, "foo", nil); kivik.StatusCode(err) != kivik.StatusNotFound {
+		t.Errorf("Unexpected error destroying missing DB: %v", err)
+	}
+	if _, err := c.DB(ctx, "foo", nil); kivik.StatusCode(err) != kivik.StatusNotFound {
+		t.Errorf("Unexpected error opening missing DB: %v", err)
+	}
+}
+
+func TestDocs(t *testing.T) {
+	_, db, cleanup := setupDB(t)
+	defer cleanup()
+	ctx := context.Background()
+	rev, err := db.Put(ctx, "foo", map[string]string{"a": "b"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(rev, "1-") {
+		t.Errorf("Unexpected rev: %s", rev)
+	}
+	if _, err := db.Put(ctx, "foo", map[string]string{"a": "c"}); kivik.StatusCode(err) != kivik.StatusConflict {
+		t.Errorf("Unexpected error for conflict: %v", err)
+	}
+	rev2, err := db.Put(ctx, "foo", map[string]string{"_rev": rev, "a": "c"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, err := db.Get(ctx, "foo", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := map[string]interface{}{"_id": "foo", "_rev": rev2, "a": "c"}
+	if d := diff.AsJSON(expected, body); d != "" {
+		t.Error(d)
+	}
+	if _, err := db.Get(ctx, "foo", map[string]interface{}{"rev": rev}); err != nil {
+		t.Errorf("Failed to get old revision: %v", err)
+	}
+	if err := db.Compact(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := db.Get(ctx, "foo", map[string]interface{}{"rev": rev}); kivik.StatusCode(err) != kivik.StatusNotFound {
+		t.Errorf("Unexpected error for compacted revision: %v", err)
+	}
+	if current, err := db.(driver.Rever).Rev(ctx, "foo"); err != nil || current != rev2 {
+		t.Errorf("Unexpected Rev result: %s, %v", current, err)
+	}
+	if _, err := db.Delete(ctx, "foo", rev2); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := db.Get(ctx, "foo", nil); kivik.StatusCode(err) != kivik.StatusNotFound {
+		t.Errorf("Unexpected error for deleted doc: %v", err)
+	}
+	if rev, err := db.Put(ctx, "foo", map[string]string{}); err != nil || !strings.HasPrefix(rev, "4-") {
+		t.Errorf("Unexpected result recreating deleted doc: %s, %v", rev, err)
+	}
+	if _, err := db.Put(ctx, "_bar", map[string]string{}); kivik.StatusCode(err) != kivik.StatusBadRequest {
+		t.Errorf("Unexpected error for invalid ID: %v", err)
+	}
+}
+
+func TestLocalDocs(t *testing.T) {
+	_, db, cleanup := setupDB(t)
+	defer cleanup()
+	ctx := context.Background()
+	rev, err := db.Put(ctx, "_local/foo", map[string]string{})
+	if err != nil || rev != "0-1" {
+		t.Fatalf("Unexpected result: %s, %v", rev, err)
+	}
+	if rev, err = db.Put(ctx, "_local/foo", map[string]string{"_rev": rev}); err != nil || rev != "0-2" {
+		t.Fatalf("Unexpected result: %s, %v", rev, err)
+	}
+	changes, err := db.Changes(ctx, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := changes.Next(&driver.Change{}); err != io.EOF {
+		t.Errorf("Expected no changes for local docs, got %v", err)
+	}
+	if _, err := db.Delete(ctx, "_local/foo", rev); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := db.Get(ctx, "_local/foo", nil); kivik.StatusCode(err) != kivik.StatusNotFound {
+		t.Errorf("Unexpected error for deleted local doc: %v", err)
+	}
+}
+
+func readRows(t *testing.T, rows driver.Rows) []string {
+	var ids []string
+	var row driver.Row
+	for {
+		if err := rows.Next(&row); err == io.EOF {
+			return ids
+		} else if err != nil {
+			t.Fatal(err)
+		}
+		ids = append(ids, row.ID)
+	}
+}
+
+func TestAllDocs(t *testing.T) {
+	_, db, cleanup := setupDB(t)
+	defer cleanup()
+	ctx := context.Background()
+	for _, id := range []string{"d", "b", "a", "e", "c"} {
+		if _, err := db.Put(ctx, id, map[string]string{}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	rev, _ := db.(driver.Rever).Rev(ctx, "c")
+	if _, err := db.Delete(ctx, "c", rev); err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name     string
+		opts     map[string]interface{}
+		expected []string
+		offset   int64
+	}{
+		{name: "All", expected: []string{"a", "b", "d", "e"}},
+		{name: "Descending", opts: map[string]interface{}{"descending": true}, expected: []string{"e", "d", "b", "a"}},
+		{name: "Range", opts: map[string]interface{}{"startkey": `"b"`, "endkey": `"d"`}, expected: []string{"b", "d"}, offset: 1},
+		{name: "Exclusive", opts: map[string]interface{}{"startkey": `"b"`, "endkey": `"d"`, "inclusive_end": false}, expected: []string{"b"}, offset: 1},
+		{name: "DescendingRange", opts: map[string]interface{}{"descending": true, "startkey": `"c"`, "endkey": `"a"`}, expected: []string{"b", "a"}, offset: 2},
+		{name: "LimitSkip", opts: map[string]interface{}{"limit": 2, "skip": 1}, expected: []string{"b", "d"}, offset: 1},
+		{name: "Keys", opts: map[string]interface{}{"keys": []string{"e", "x", "c"}}, expected: []string{"e", "c"}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			rows, err := db.AllDocs(ctx, test.opts)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if d := diff.Interface(test.expected, readRows(t, rows)); d != "" {
+				t.Error(d)
+			}
+			if rows.TotalRows() != 4 {
+				t.Errorf("Unexpected total rows: %d", rows.TotalRows())
+			}
+			if rows.Offset() != test.offset {
+				t.Errorf("Unexpected offset: %d", rows.Offset())
+			}
+		})
+	}
+}
+
+func TestChanges(t *testing.T) {
+	_, db, cleanup := setupDB(t)
+	defer cleanup()
+	ctx := context.Background()
+	revs := map[string]string{}
+	for _, id := range []string{"a", "b", "c"} {
+		rev, err := db.Put(ctx, id, map[string]string{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		revs[id] = rev
+	}
+	if _, err := db.Put(ctx, "a", map[string]string{"_rev": revs["a"]}); err != nil {
+		t.Fatal(err)
+	}
+	readChanges := func(opts map[string]interface{}) []string {
+		changes, err := db.Changes(ctx, opts)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var result []string
+		var change driver.Change
+		for {
+			if err := changes.Next(&change); err == io.EOF {
+				return result
+			} else if err != nil {
+				t.Fatal(err)
+			}
+			result = append(result, change.ID+":"+string(change.Seq))
+		}
+	}
+	if d := diff.Interface([]string{"b:2", "c:3", "a:4"}, readChanges(nil)); d != "" {
+		t.Error(d)
+	}
+	if d := diff.Interface([]string{"c:3"}, readChanges(map[string]interface{}{"since": "2", "limit": 1})); d != "" {
+		t.Error(d)
+	}
+	if d := diff.Interface([]string(nil), readChanges(map[string]interface{}{"since": "now"})); d != "" {
+		t.Error(d)
+	}
+	if _, err := db.Changes(ctx, map[string]interface{}{"feed": "continuous"}); kivik.StatusCode(err) != kivik.StatusNotImplemented {
+		t.Errorf("Unexpected error for continuous feed: %v", err)
+	}
+}
+
+func TestAttachments(t *testing.T) {
+	_, db, cleanup := setupDB(t)
+	defer cleanup()
+	ctx := context.Background()
+	rev, err := db.PutAttachment(ctx, "foo", "", "foo.txt", "text/plain", strings.NewReader("foo"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	rev, err = db.Put(ctx, "foo", map[string]interface{}{
+		"_rev": rev,
+		"_attachments": map[string]interface{}{
+			"foo.txt": map[string]interface{}{"stub": true},
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	contentType, _, body, err := db.GetAttachment(ctx, "foo", "", "foo.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, _ := ioutil.ReadAll(body)
+	if contentType != "text/plain" || string(data) != "foo" {
+		t.Errorf("Unexpected attachment: %s, %s", contentType, data)
+	}
+	doc, err := db.Get(ctx, "foo", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var stubs struct {
+		Attachments map[string]map[string]interface{} `json:"_attachments"`
+	}
+	if err := json.Unmarshal(doc, &stubs); err != nil {
+		t.Fatal(err)
+	}
+	expected := map[string]interface{}{
+		"content_type": "text/plain",
+		"digest":       "md5-rL0Y20zC+Fzt72VPzMSk2A==",
+		"length":       3,
+		"revpos":       1,
+		"stub":         true,
+	}
+	if d := diff.AsJSON(expected, stubs.Attachments["foo.txt"]); d != "" {
+		t.Error(d)
+	}
+	if _, err := db.Put(ctx, "foo", map[string]interface{}{
+		"_rev": rev,
+		"_attachments": map[string]interface{}{
+			"bar.txt": map[string]interface{}{"stub": true},
+		},
+	}); kivik.StatusCode(err) != kivik.StatusPreconditionFailed {
+		t.Errorf("Unexpected error for invalid stub: %v", err)
+	}
+	rev, err = db.DeleteAttachment(ctx, "foo", rev, "foo.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := db.(driver.AttachmentMetaer).GetAttachmentMeta(ctx, "foo", "", "foo.txt"); kivik.StatusCode(err) != kivik.StatusNotFound {
+		t.Errorf("Unexpected error for deleted attachment: %v", err)
+	}
+	if _, err := db.DeleteAttachment(ctx, "foo", rev, "foo.txt"); kivik.StatusCode(err) != kivik.StatusNotFound {
+		t.Errorf("Unexpected error deleting missing attachment: %v", err)
+	}
+}
+
+func TestBulkDocs(t *testing.T) {
+	_, db, cleanup := setupDB(t)
+	defer cleanup()
+	ctx := context.Background()
+	if _, err := db.Put(ctx, "b", map[string]string{}); err != nil {
+		t.Fatal(err)
+	}
+	results, err := db.BulkDocs(ctx, []interface{}{
+		map[string]string{"_id": "a"},
+		map[string]string{"_id": "b"},
+		map[string]string{"_id": "c"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var statuses []int
+	var result driver.BulkResult
+	for results.Next(&result) == nil {
+		statuses = append(statuses, kivik.StatusCode(result.Error))
+	}
+	if d := diff.Interface([]int{0, kivik.StatusConflict, 0}, statuses); d != "" {
+		t.Error(d)
+	}
+	stats, err := db.Stats(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stats.DocCount != 3 || stats.UpdateSeq != "3" {
+		t.Errorf("Unexpected stats: %+v", stats)
+	}
+}
+
+func TestSecurity(t *testing.T) {
+	_, db, cleanup := setupDB(t)
+	defer cleanup()
+	ctx := context.Background()
+	sec := &driver.Security{Admins: driver.Members{Names: []string{"bob"}}}
+	if err := db.SetSecurity(ctx, sec); err != nil {
+		t.Fatal(err)
+	}
+	result, err := db.Security(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if d := diff.Interface(sec, result); d != "" {
+		t.Error(d)
+	}
+}
+
+func TestConcurrentWrites(t *testing.T) {
+	_, db, cleanup := setupDB(t)
+	defer cleanup()
+	ctx := context.Background()
+	const writers = 20
+	var wg sync.WaitGroup
+	errs := make(chan error, writers)
+	for i := 0; i < writers; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			// Every writer but the first conflicts on the shared document.
+			if _, err := db.Put(ctx, "shared", map[string]int{"writer": i}); err != nil && kivik.StatusCode(err) != kivik.StatusConflict {
+				errs <- err
+			}
+			if _, err := db.Put(ctx, fmt.Sprintf("doc%02d", i), map[string]int{"writer": i}); err != nil {
+				errs <- err
+			}
+		}(i)
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		t.Error(err)
+	}
+	stats, err := db.Stats(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stats.DocCount != writers+1 || stats.UpdateSeq != strconv.Itoa(writers+1) {
+		t.Errorf("Unexpected stats: %+v", stats)
+	}
+}
+
+func TestBulkDocsDuplicateIDs(t *testing.T) {
+	_, db, cleanup := setupDB(t)
+	defer cleanup()
+	results, err := db.BulkDocs(context.Background(), []interface{}{
+		map[string]string{"_id": "a"},
+		map[string]string{"_id": "a"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var statuses []int
+	var result driver.BulkResult
+	for results.Next(&result) == nil {
+		statuses = append(statuses, kivik.StatusCode(result.Error))
+	}
+	if d := diff.Interface([]int{0, kivik.StatusConflict}, statuses); d != "" {
+		t.Error(d)
+	}
+}
@@ -0,0 +1,184 @@
+package leveldb
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"sort"
+
+	"github.com/syndtr/goleveldb/leveldb"
+	"github.com/syndtr/goleveldb/leveldb/opt"
+	"github.com/syndtr/goleveldb/leveldb/util"
+
+	"github.com/flimzy/kivik"
+	"github.com/flimzy/kivik/errors"
+)
+
+// txn accumulates the writes of a single operation. Reads through a txn
+// observe its own writes, then those of its parent, and finally the committed
+// state of the database. The writes of a txn are only applied to its parent,
+// by merge, if the operation succeeds, so a failed operation leaves no trace.
+type txn struct {
+	db     *leveldb.DB
+	parent *txn
+	keys   []string
+	values map[string][]byte // nil for deleted keys
+}
+
+var _ reader = &txn{}
+
+func newTxn(db *leveldb.DB, parent *txn) *txn {
+	return &txn{db: db, parent: parent, values: make(map[string][]byte)}
+}
+
+// Get returns the value of k, or leveldb.ErrNotFound.
+func (t *txn) Get(k []byte, ro *opt.ReadOptions) ([]byte, error) {
+	for tx := t; tx != nil; tx = tx.parent {
+		if value, ok := tx.values[string(k)]; ok {
+			if value == nil {
+				return nil, leveldb.ErrNotFound
+			}
+			return value, nil
+		}
+	}
+	return t.db.Get(k, ro)
+}
+
+func (t *txn) set(k, value []byte) {
+	if _, ok := t.values[string(k)]; !ok {
+		t.keys = append(t.keys, string(k))
+	}
+	t.values[string(k)] = value
+}
+
+func (t *txn) put(k, value []byte) {
+	t.set(k, append([]byte{}, value...))
+}
+
+func (t *txn) delete(k []byte) {
+	t.set(k, nil)
+}
+
+func (t *txn) putRecord(k []byte, record interface{}) error {
+	value, err := json.Marshal(record)
+	if err != nil {
+		return errors.WrapStatus(kivik.StatusInternalServerError, err)
+	}
+	t.put(k, value)
+	return nil
+}
+
+// merge applies the writes of t to its parent.
+func (t *txn) merge() {
+	for _, k := range t.keys {
+		t.parent.set([]byte(k), t.values[k])
+	}
+}
+
+// batch returns the writes of t as a LevelDB batch.
+func (t *txn) batch() *leveldb.Batch {
+	batch := new(leveldb.Batch)
+	for _, k := range t.keys {
+		if value := t.values[k]; value != nil {
+			batch.Put([]byte(k), value)
+		} else {
+			batch.Delete([]byte(k))
+		}
+	}
+	return batch
+}
+
+// scan returns the keys with the given prefix, in order, as observed by t.
+func (t *txn) scan(prefix []byte) ([][]byte, error) {
+	present := make(map[string]bool)
+	iter := t.db.NewIterator(util.BytesPrefix(prefix), nil)
+	for iter.Next() {
+		present[string(iter.Key())] = true
+	}
+	iter.Release()
+	if err := iter.Error(); err != nil {
+		return nil, levelError(err)
+	}
+	var chain []*txn
+	for tx := t; tx != nil; tx = tx.parent {
+		chain = append(chain, tx)
+	}
+	// Apply the oldest writes first.
+	for i := len(chain) - 1; i >= 0; i-- {
+		for _, k := range chain[i].keys {
+			if bytes.HasPrefix([]byte(k), prefix) {
+				present[k] = chain[i].values[k] != nil
+			}
+		}
+	}
+	keys := make([]string, 0, len(present))
+	for k, ok := range present {
+		if ok {
+			keys = append(keys, k)
+		}
+	}
+	sort.Strings(keys)
+	result := make([][]byte, len(keys))
+	for i, k := range keys {
+		result[i] = []byte(k)
+	}
+	return result, nil
+}
+
+// writeReq is a write awaiting commit.
+type writeReq struct {
+	fn   func(*txn) error
+	done chan error
+}
+
+// write calls fn with a txn, and commits its writes. Writes which arrive while
+// another batch is being committed are queued, and the first of them to obtain
+// the write lock commits the whole queue as a single batch, in the order the
+// writes arrived.
+func (c *client) write(ctx context.Context, fn func(*txn) error) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	req := &writeReq{fn: fn, done: make(chan error, 1)}
+	c.queueMu.Lock()
+	c.queue = append(c.queue, req)
+	c.queueMu.Unlock()
+
+	c.writeMu.Lock()
+	defer c.writeMu.Unlock()
+	select {
+	case err := <-req.done:
+		// Committed by another writer
+		return err
+	default:
+	}
+	c.queueMu.Lock()
+	reqs := c.queue
+	c.queue = nil
+	c.queueMu.Unlock()
+	c.commit(reqs)
+	return <-req.done
+}
+
+// commit runs each of reqs, and writes those which succeed as a single batch.
+func (c *client) commit(reqs []*writeReq) {
+	root := newTxn(c.db, nil)
+	errs := make([]error, len(reqs))
+	for i, req := range reqs {
+		tx := newTxn(c.db, root)
+		if errs[i] = req.fn(tx); errs[i] == nil {
+			tx.merge()
+		}
+	}
+	var err error
+	if len(root.keys) > 0 {
+		err = levelError(c.db.Write(root.batch(), nil))
+	}
+	for i, req := range reqs {
+		if errs[i] != nil {
+			req.done <- errs[i]
+			continue
+		}
+		req.done <- err
+	}
+}
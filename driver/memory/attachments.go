@@ -0,0 +1,180 @@
+package memory
+
+import (
+	"bytes"
+	"context"
+	"crypto/md5"
+	"encoding/base64"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+
+	"github.com/flimzy/kivik"
+	"github.com/flimzy/kivik/authdb"
+	"github.com/flimzy/kivik/driver"
+	"github.com/flimzy/kivik/errors"
+)
+
+var _ driver.AttachmentMetaer = &db{}
+
+// digest returns the CouchDB digest of the attachment's content.
+func (f file) digest() string {
+	sum := md5.Sum(f.Data)
+	return "md5-" + base64.StdEncoding.EncodeToString(sum[:])
+}
+
+// stub returns the attachment's entry in the _attachments field of a
+// document.
+func (f file) stub() map[string]interface{} {
+	return map[string]interface{}{
+		"content_type": f.ContentType,
+		"digest":       f.digest(),
+		"length":       len(f.Data),
+		"revpos":       f.Revpos,
+		"stub":         true,
+	}
+}
+
+// attachments returns the attachments of revision revNum of doc, read from
+// its _attachments field, which it replaces with their stubs. Inline
+// attachments have base64-encoded data, and stubs refer to the attachments of
+// the current revision, last, which is nil for a new or deleted document.
+func attachments(doc couchDoc, last *revision, revNum int64) (map[string]file, error) {
+	atts, ok := doc["_attachments"].(map[string]interface{})
+	if !ok || len(atts) == 0 {
+		delete(doc, "_attachments")
+		return nil, nil
+	}
+	files := make(map[string]file, len(atts))
+	stubs := make(map[string]interface{}, len(atts))
+	for filename, v := range atts {
+		att, _ := v.(map[string]interface{})
+		contentType, _ := att["content_type"].(string)
+		var f file
+		switch data := att["data"].(type) {
+		case string:
+			content, err := base64.StdEncoding.DecodeString(data)
+			if err != nil {
+				return nil, errors.Statusf(kivik.StatusBadRequest, "invalid attachment data for %s", filename)
+			}
+			f = file{ContentType: contentType, Data: content, Revpos: revNum}
+		case nil:
+			var found bool
+			if stub, _ := att["stub"].(bool); stub && last != nil {
+				f, found = last.Attachments[filename]
+			}
+			if !found {
+				return nil, errors.Statusf(kivik.StatusPreconditionFailed, "invalid attachment stub for %s", filename)
+			}
+		default:
+			return nil, errors.Statusf(kivik.StatusBadRequest, "invalid attachment data for %s", filename)
+		}
+		files[filename] = f
+		stubs[filename] = f.stub()
+	}
+	doc["_attachments"] = stubs
+	return files, nil
+}
+
+// attachment returns the named attachment of revision rev of docID, or of its
+// current revision, if rev is empty.
+func (d *db) attachment(docID, rev, filename string) (file, error) {
+	var r *revision
+	var found bool
+	if rev == "" {
+		if r, found = d.db.latestRevision(docID); found && r.Deleted {
+			found = false
+		}
+	} else {
+		r, found = d.db.getRevision(docID, rev)
+	}
+	if !found {
+		return file{}, errors.Status(kivik.StatusNotFound, "missing")
+	}
+	f, ok := r.Attachments[filename]
+	if !ok {
+		return file{}, errors.Status(kivik.StatusNotFound, "Document is missing attachment")
+	}
+	return f, nil
+}
+
+func (d *db) GetAttachment(ctx context.Context, docID, rev, filename string) (contentType string, md5sum driver.MD5sum, body io.ReadCloser, err error) {
+	if err := d.db.faults.inject(ctx, "GetAttachment"); err != nil {
+		return "", driver.MD5sum{}, nil, err
+	}
+	f, err := d.attachment(docID, rev, filename)
+	if err != nil {
+		return "", driver.MD5sum{}, nil, err
+	}
+	return f.ContentType, md5.Sum(f.Data), ioutil.NopCloser(bytes.NewReader(f.Data)), nil
+}
+
+func (d *db) GetAttachmentMeta(ctx context.Context, docID, rev, filename string) (contentType string, md5sum driver.MD5sum, err error) {
+	if err := d.db.faults.inject(ctx, "GetAttachment"); err != nil {
+		return "", driver.MD5sum{}, err
+	}
+	f, err := d.attachment(docID, rev, filename)
+	if err != nil {
+		return "", driver.MD5sum{}, err
+	}
+	return f.ContentType, md5.Sum(f.Data), nil
+}
+
+// currentDoc returns the body of the current revision of docID, to which an
+// attachment is to be added or removed, with rev as the revision to update.
+// If docID does not exist, or is deleted, an empty document is returned.
+func (d *db) currentDoc(docID, rev string) (couchDoc, error) {
+	doc := couchDoc{}
+	if last, ok := d.db.latestRevision(docID); ok && !last.Deleted {
+		if err := json.Unmarshal(last.data, &doc); err != nil {
+			return nil, errors.WrapStatus(kivik.StatusInternalServerError, err)
+		}
+	}
+	doc["_id"] = docID
+	doc["_rev"] = rev
+	return doc, nil
+}
+
+// PutAttachment adds the attachment to revision rev of docID, creating the
+// document if it does not exist. A stale rev is a conflict, as for Put.
+func (d *db) PutAttachment(ctx context.Context, docID, rev, filename, contentType string, body io.Reader) (string, error) {
+	if err := d.db.faults.inject(ctx, "PutAttachment"); err != nil {
+		return "", err
+	}
+	data, err := ioutil.ReadAll(body)
+	if err != nil {
+		return "", errors.WrapStatus(kivik.StatusBadRequest, err)
+	}
+	doc, err := d.currentDoc(docID, rev)
+	if err != nil {
+		return "", err
+	}
+	atts, _ := doc["_attachments"].(map[string]interface{})
+	if atts == nil {
+		atts = make(map[string]interface{})
+	}
+	atts[filename] = map[string]interface{}{
+		"content_type": contentType,
+		"data":         base64.StdEncoding.EncodeToString(data),
+	}
+	doc["_attachments"] = atts
+	user, _ := authdb.FromContext(ctx)
+	return d.put(docID, doc, user)
+}
+
+func (d *db) DeleteAttachment(ctx context.Context, docID, rev, filename string) (string, error) {
+	if err := d.db.faults.inject(ctx, "DeleteAttachment"); err != nil {
+		return "", err
+	}
+	doc, err := d.currentDoc(docID, rev)
+	if err != nil {
+		return "", err
+	}
+	atts, _ := doc["_attachments"].(map[string]interface{})
+	if _, ok := atts[filename]; !ok {
+		return "", errors.Status(kivik.StatusNotFound, "Document is missing attachment")
+	}
+	delete(atts, filename)
+	user, _ := authdb.FromContext(ctx)
+	return d.put(docID, doc, user)
+}
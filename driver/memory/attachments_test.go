@@ -0,0 +1,92 @@
+package memory
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"strings"
+	"testing"
+
+	"github.com/flimzy/diff"
+	"github.com/flimzy/kivik"
+	"github.com/flimzy/kivik/driver"
+	"github.com/flimzy/kivik/errors"
+)
+
+func TestAttachments(t *testing.T) {
+	ctx := context.Background()
+	d := setupDB(t, nil)
+	rev, err := d.PutAttachment(ctx, "foo", "", "foo.txt", "text/plain", strings.NewReader("test content"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	contentType, _, body, err := d.GetAttachment(ctx, "foo", "", "foo.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	content, err := ioutil.ReadAll(body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if contentType != "text/plain" || string(content) != "test content" {
+		t.Errorf("Unexpected attachment %s: %q", contentType, content)
+	}
+	doc, err := d.Get(ctx, "foo", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var result map[string]interface{}
+	if e := json.Unmarshal(doc, &result); e != nil {
+		t.Fatal(e)
+	}
+	expected := map[string]interface{}{
+		"foo.txt": map[string]interface{}{
+			"content_type": "text/plain",
+			"digest":       "md5-lHP90NiApDwht3eNNIchVw==",
+			"length":       12,
+			"revpos":       1,
+			"stub":         true,
+		},
+	}
+	if d := diff.AsJSON(expected, result["_attachments"]); d != "" {
+		t.Errorf("Unexpected stubs:\n%s", d)
+	}
+
+	// A document written with its stubs keeps its attachments.
+	rev2, err := d.Put(ctx, "foo", result)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err = d.(driver.AttachmentMetaer).GetAttachmentMeta(ctx, "foo", rev2, "foo.txt"); err != nil {
+		t.Errorf("Attachment lost by Put: %s", err)
+	}
+
+	if _, err = d.PutAttachment(ctx, "foo", rev, "bar.txt", "text/plain", strings.NewReader("bar")); errors.StatusCode(err) != kivik.StatusConflict {
+		t.Errorf("Expected a conflict for a stale rev, got %v", err)
+	}
+	if _, err = d.DeleteAttachment(ctx, "foo", rev2, "bar.txt"); errors.StatusCode(err) != kivik.StatusNotFound {
+		t.Errorf("Expected Not Found for a missing attachment, got %v", err)
+	}
+	rev3, err := d.DeleteAttachment(ctx, "foo", rev2, "foo.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, _, _, err = d.GetAttachment(ctx, "foo", rev3, "foo.txt"); errors.StatusCode(err) != kivik.StatusNotFound {
+		t.Errorf("Expected Not Found for a deleted attachment, got %v", err)
+	}
+	if _, _, _, err = d.GetAttachment(ctx, "foo", rev, "foo.txt"); err != nil {
+		t.Errorf("Attachment of an earlier revision: %s", err)
+	}
+}
+
+func TestPutInvalidStub(t *testing.T) {
+	d := setupDB(t, nil)
+	_, err := d.Put(context.Background(), "foo", map[string]interface{}{
+		"_attachments": map[string]interface{}{
+			"foo.txt": map[string]interface{}{"stub": true},
+		},
+	})
+	if errors.StatusCode(err) != kivik.StatusPreconditionFailed {
+		t.Errorf("Expected Precondition Failed, got %v", err)
+	}
+}
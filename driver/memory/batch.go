@@ -0,0 +1,51 @@
+package memory
+
+import "sync"
+
+// batchQueue applies batch mode writes asynchronously, in the order in which
+// they were queued.
+type batchQueue struct {
+	mu      sync.Mutex
+	idle    *sync.Cond
+	pending []func()
+	running bool
+}
+
+// add queues fn, starting the queue if necessary.
+func (q *batchQueue) add(fn func()) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.pending = append(q.pending, fn)
+	if !q.running {
+		q.running = true
+		go q.run()
+	}
+}
+
+func (q *batchQueue) run() {
+	q.mu.Lock()
+	for len(q.pending) > 0 {
+		fn := q.pending[0]
+		q.pending = q.pending[1:]
+		q.mu.Unlock()
+		fn()
+		q.mu.Lock()
+	}
+	q.running = false
+	if q.idle != nil {
+		q.idle.Broadcast()
+	}
+	q.mu.Unlock()
+}
+
+// flush blocks until all queued writes have been applied.
+func (q *batchQueue) flush() {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if q.idle == nil {
+		q.idle = sync.NewCond(&q.mu)
+	}
+	for q.running {
+		q.idle.Wait()
+	}
+}
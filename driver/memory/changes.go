@@ -0,0 +1,162 @@
+package memory
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/flimzy/kivik"
+	"github.com/flimzy/kivik/driver"
+	"github.com/flimzy/kivik/errors"
+	"github.com/flimzy/kivik/filter"
+)
+
+// Changes returns the changes since the requested sequence, as a normal feed.
+// The since, limit, include_docs and filter options are supported. Continuous
+// feeds are not.
+func (d *db) Changes(ctx context.Context, opts map[string]interface{}) (driver.Changes, error) {
+	if err := d.db.faults.inject(ctx, "Changes"); err != nil {
+		return nil, err
+	}
+	switch feed := fmt.Sprint(opts["feed"]); feed {
+	case "continuous", "longpoll", "eventsource":
+		return nil, errors.Statusf(kivik.StatusNotImplemented, "kivik: %s feed not supported by memory driver", feed)
+	}
+	f, err := filter.New(opts)
+	if err != nil {
+		return nil, err
+	}
+	since, err := d.sinceOption(opts["since"])
+	if err != nil {
+		return nil, err
+	}
+	limit, err := intOption(opts["limit"])
+	if err != nil {
+		return nil, err
+	}
+	includeDocs := opts["include_docs"] == true || opts["include_docs"] == "true"
+
+	d.db.mu.RLock()
+	defer d.db.mu.RUnlock()
+	var changes []*driver.Change
+	var seqs []int64
+	for docID, doc := range d.db.docs {
+		if strings.HasPrefix(docID, "_local/") {
+			continue
+		}
+		leaf := doc.revs[len(doc.revs)-1]
+		if leaf.Seq <= since {
+			continue
+		}
+		var body map[string]interface{}
+		if err := json.Unmarshal(leaf.data, &body); err != nil {
+			return nil, errors.WrapStatus(kivik.StatusInternalServerError, err)
+		}
+		if !f.Match(docID, body) {
+			continue
+		}
+		change := &driver.Change{
+			ID:      docID,
+			Seq:     driver.SequenceID(strconv.FormatInt(leaf.Seq, 10)),
+			Deleted: leaf.Deleted,
+			Changes: driver.ChangedRevs{fmt.Sprintf("%d-%s", leaf.ID, leaf.Rev)},
+		}
+		if includeDocs {
+			change.Doc = leaf.data
+		}
+		changes = append(changes, change)
+		seqs = append(seqs, leaf.Seq)
+	}
+	sort.Sort(bySeq{changes: changes, seqs: seqs})
+	if limit > 0 && len(changes) > limit {
+		changes = changes[:limit]
+	}
+	return &changesFeed{ctx: ctx, changes: changes}, nil
+}
+
+// sinceOption parses the since option, which may be a number, a string, or
+// "now".
+func (d *db) sinceOption(since interface{}) (int64, error) {
+	var s string
+	switch t := since.(type) {
+	case nil:
+		return 0, nil
+	case int:
+		return int64(t), nil
+	case int64:
+		return t, nil
+	case string:
+		s = t
+	case kivik.SequenceID:
+		s = string(t)
+	case driver.SequenceID:
+		s = string(t)
+	default:
+		return 0, errors.Statusf(kivik.StatusBadRequest, "kivik: invalid since value %v", since)
+	}
+	if s == "now" {
+		d.db.mu.RLock()
+		defer d.db.mu.RUnlock()
+		return d.db.updateSeq, nil
+	}
+	n, ok := kivik.SequenceID(s).Number()
+	if !ok {
+		return 0, errors.Statusf(kivik.StatusBadRequest, "kivik: invalid since value %q", s)
+	}
+	return n, nil
+}
+
+func intOption(value interface{}) (int, error) {
+	switch t := value.(type) {
+	case nil:
+		return 0, nil
+	case int:
+		return t, nil
+	case string:
+		n, err := strconv.Atoi(t)
+		if err != nil {
+			return 0, errors.WrapStatus(kivik.StatusBadRequest, err)
+		}
+		return n, nil
+	}
+	return 0, errors.Statusf(kivik.StatusBadRequest, "kivik: invalid integer %v", value)
+}
+
+type bySeq struct {
+	changes []*driver.Change
+	seqs    []int64
+}
+
+func (s bySeq) Len() int           { return len(s.changes) }
+func (s bySeq) Less(i, j int) bool { return s.seqs[i] < s.seqs[j] }
+func (s bySeq) Swap(i, j int) {
+	s.changes[i], s.changes[j] = s.changes[j], s.changes[i]
+	s.seqs[i], s.seqs[j] = s.seqs[j], s.seqs[i]
+}
+
+type changesFeed struct {
+	ctx     context.Context
+	changes []*driver.Change
+}
+
+var _ driver.Changes = &changesFeed{}
+
+func (c *changesFeed) Next(change *driver.Change) error {
+	if err := c.ctx.Err(); err != nil {
+		return err
+	}
+	if len(c.changes) == 0 {
+		return io.EOF
+	}
+	*change, c.changes = *c.changes[0], c.changes[1:]
+	return nil
+}
+
+func (c *changesFeed) Close() error {
+	c.changes = nil
+	return nil
+}
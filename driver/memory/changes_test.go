@@ -0,0 +1,83 @@
+package memory
+
+import (
+	"testing"
+
+	"golang.org/x/net/context"
+
+	"github.com/flimzy/diff"
+	"github.com/flimzy/kivik/driver"
+)
+
+func TestChanges(t *testing.T) {
+	ctx := context.Background()
+	db := setupDB(t, func(db driver.DB) {
+		for _, id := range []string{"a", "b", "_local/x"} {
+			if _, err := db.Put(ctx, id, map[string]string{"type": id}); err != nil {
+				t.Fatal(err)
+			}
+		}
+		rev, err := db.Put(ctx, "c", map[string]string{"type": "c"})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := db.Delete(ctx, "c", rev); err != nil {
+			t.Fatal(err)
+		}
+	})
+	type change struct {
+		ID      string
+		Seq     driver.SequenceID
+		Deleted bool
+	}
+	tests := []struct {
+		name     string
+		opts     map[string]interface{}
+		expected []change
+	}{
+		{
+			name: "All",
+			opts: map[string]interface{}{},
+			expected: []change{
+				{ID: "a", Seq: "1"},
+				{ID: "b", Seq: "2"},
+				{ID: "c", Seq: "4", Deleted: true},
+			},
+		},
+		{
+			name:     "Since",
+			opts:     map[string]interface{}{"since": "2"},
+			expected: []change{{ID: "c", Seq: "4", Deleted: true}},
+		},
+		{
+			name:     "Limit",
+			opts:     map[string]interface{}{"limit": 1},
+			expected: []change{{ID: "a", Seq: "1"}},
+		},
+		{
+			name:     "Selector",
+			opts:     map[string]interface{}{"filter": "_selector", "selector": map[string]string{"type": "b"}},
+			expected: []change{{ID: "b", Seq: "2"}},
+		},
+		{
+			name: "Now",
+			opts: map[string]interface{}{"since": "now"},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			changes, err := db.Changes(ctx, test.opts)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var result []change
+			var ch driver.Change
+			for changes.Next(&ch) == nil {
+				result = append(result, change{ID: ch.ID, Seq: ch.Seq, Deleted: ch.Deleted})
+			}
+			if d := diff.Interface(test.expected, result); d != "" {
+				t.Error(d)
+			}
+		})
+	}
+}
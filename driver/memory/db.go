@@ -4,11 +4,12 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
-	"io"
 	"regexp"
+	"strconv"
 	"strings"
 
 	"github.com/flimzy/kivik"
+	"github.com/flimzy/kivik/authdb"
 	"github.com/flimzy/kivik/driver"
 	"github.com/flimzy/kivik/errors"
 )
@@ -43,7 +44,10 @@ func (d *db) Query(ctx context.Context, ddoc, view string, opts map[string]inter
 	return nil, notYetImplemented
 }
 
-func (d *db) Get(_ context.Context, docID string, opts map[string]interface{}) (json.RawMessage, error) {
+func (d *db) Get(ctx context.Context, docID string, opts map[string]interface{}) (json.RawMessage, error) {
+	if err := d.db.faults.inject(ctx, "Get"); err != nil {
+		return nil, err
+	}
 	if !d.db.docExists(docID) {
 		return nil, errors.Status(kivik.StatusNotFound, "missing")
 	}
@@ -61,20 +65,41 @@ func (d *db) Get(_ context.Context, docID string, opts map[string]interface{}) (
 }
 
 func (d *db) CreateDoc(ctx context.Context, doc interface{}) (docID, rev string, err error) {
+	return d.CreateDocOpts(ctx, doc, nil)
+}
+
+func (d *db) CreateDocOpts(ctx context.Context, doc interface{}, opts map[string]interface{}) (docID, rev string, err error) {
+	if err := d.db.faults.inject(ctx, "CreateDoc"); err != nil {
+		return "", "", err
+	}
 	couchDoc, err := toCouchDoc(doc)
 	if err != nil {
 		return "", "", err
 	}
 	if id, ok := couchDoc["_id"].(string); ok {
 		docID = id
-	} else {
-		docID = randStr()
+	} else if docID, err = d.db.newDocID(); err != nil {
+		return "", "", err
 	}
-	rev, err = d.Put(ctx, docID, doc)
+	rev, err = d.putOpts(ctx, docID, doc, opts)
 	return docID, rev, err
 }
 
-func (d *db) Put(_ context.Context, docID string, doc interface{}) (rev string, err error) {
+func (d *db) Put(ctx context.Context, docID string, doc interface{}) (rev string, err error) {
+	return d.PutOpts(ctx, docID, doc, nil)
+}
+
+// PutOpts supports the batch=ok option, in which case the write is queued,
+// and applied asynchronously. As with CouchDB, no rev is returned, and the
+// write may fail silently.
+func (d *db) PutOpts(ctx context.Context, docID string, doc interface{}, opts map[string]interface{}) (rev string, err error) {
+	if err := d.db.faults.inject(ctx, "Put"); err != nil {
+		return "", err
+	}
+	return d.putOpts(ctx, docID, doc, opts)
+}
+
+func (d *db) putOpts(ctx context.Context, docID string, doc interface{}, opts map[string]interface{}) (rev string, err error) {
 	isLocal := strings.HasPrefix(docID, "_local/")
 	if !isLocal && docID[0] == '_' && !strings.HasPrefix(docID, "_design/") {
 		return "", errors.Status(kivik.StatusBadRequest, "Only reserved document ids may start with underscore.")
@@ -84,19 +109,67 @@ func (d *db) Put(_ context.Context, docID string, doc interface{}) (rev string,
 		return "", err
 	}
 	couchDoc["_id"] = docID
+	user, _ := authdb.FromContext(ctx)
+	if opts["batch"] == kivik.BatchOK {
+		d.db.batch.add(func() {
+			_, _ = d.put(docID, couchDoc, user)
+		})
+		return "", nil
+	}
+	return d.put(docID, couchDoc, user)
+}
 
-	if last, ok := d.db.latestRevision(docID); ok {
-		if !last.Deleted && couchDoc.Rev() != fmt.Sprintf("%d-%s", last.ID, last.Rev) {
+func (d *db) put(docID string, doc couchDoc, user *authdb.UserContext) (rev string, err error) {
+	d.db.updateMu.Lock()
+	defer d.db.updateMu.Unlock()
+	last, exists := d.db.latestRevision(docID)
+	if exists && !last.Deleted {
+		if doc.Rev() != fmt.Sprintf("%d-%s", last.ID, last.Rev) {
 			return "", errors.Status(kivik.StatusConflict, "document update conflict")
 		}
-		return d.db.addRevision(couchDoc), nil
-	}
-
-	if couchDoc.Rev() != "" {
+	} else if !exists && doc.Rev() != "" {
 		// Rev should not be set for a new document
 		return "", errors.Status(kivik.StatusConflict, "document update conflict")
 	}
-	return d.db.addRevision(couchDoc), nil
+	var current *revision
+	revNum := int64(1)
+	if exists {
+		revNum = last.ID + 1
+		if !last.Deleted {
+			current = last
+		}
+	}
+	var atts map[string]file
+	if !strings.HasPrefix(docID, "_local/") {
+		if atts, err = attachments(doc, current, revNum); err != nil {
+			return "", err
+		}
+	}
+	if d.db.validate != nil {
+		var oldDoc map[string]interface{}
+		if exists && !last.Deleted {
+			if err := json.Unmarshal(last.data, &oldDoc); err != nil {
+				return "", errors.WrapStatus(kivik.StatusInternalServerError, err)
+			}
+		}
+		if err := d.db.validate(doc, oldDoc, user); err != nil {
+			if errors.StatusCode(err) == kivik.StatusInternalServerError {
+				return "", errors.WrapStatus(kivik.StatusForbidden, err)
+			}
+			return "", err
+		}
+	}
+	if d.db.hashPasswords {
+		hashPassword(doc)
+	}
+	if d.db.modifiedBy != "" && user != nil {
+		doc[d.db.modifiedBy] = user.Name
+	}
+	revID, err := d.db.newRevID()
+	if err != nil {
+		return "", err
+	}
+	return d.db.addRevision(doc, revID, atts), nil
 }
 
 var revRE = regexp.MustCompile("^[0-9]+-[a-f0-9]{32}$")
@@ -109,26 +182,53 @@ func (d *db) Delete(ctx context.Context, docID, rev string) (newRev string, err
 	if !strings.HasPrefix(docID, "_local/") && !validRev(rev) {
 		return "", errors.Status(kivik.StatusBadRequest, "Invalid rev format")
 	}
+	if err := d.db.faults.inject(ctx, "Delete"); err != nil {
+		return "", err
+	}
 	if !d.db.docExists(docID) {
 		return "", errors.Status(kivik.StatusNotFound, "missing")
 	}
-	return d.Put(ctx, docID, map[string]interface{}{
+	return d.putOpts(ctx, docID, map[string]interface{}{
 		"_id":      docID,
 		"_rev":     rev,
 		"_deleted": true,
-	})
+	}, nil)
 }
 
-func (d *db) Stats(_ context.Context) (*driver.DBStats, error) {
-	return &driver.DBStats{
-		Name: d.dbName,
-		// DocCount:     0,
-		// DeletedCount: 0,
-		// UpdateSeq:    "",
-		// DiskSize:     0,
-		// ActiveSize:   0,
-		// ExternalSize: 0,
-	}, nil
+// Flush waits for any pending batch mode writes to be applied.
+func (d *db) Flush(_ context.Context) error {
+	d.db.batch.flush()
+	return nil
+}
+
+// Stats reports the number of documents, and their sizes, as the size of
+// their stored JSON. DiskSize includes all stored revisions, and ActiveSize
+// and ExternalSize only the current revisions of undeleted documents.
+func (d *db) Stats(ctx context.Context) (*driver.DBStats, error) {
+	if err := d.db.faults.inject(ctx, "Stats"); err != nil {
+		return nil, err
+	}
+	stats := &driver.DBStats{Name: d.dbName}
+	d.db.mu.RLock()
+	defer d.db.mu.RUnlock()
+	for docID, doc := range d.db.docs {
+		if strings.HasPrefix(docID, "_local/") {
+			continue
+		}
+		for _, rev := range doc.revs {
+			stats.DiskSize += int64(len(rev.data))
+		}
+		leaf := doc.revs[len(doc.revs)-1]
+		if leaf.Deleted {
+			stats.DeletedCount++
+			continue
+		}
+		stats.DocCount++
+		stats.ActiveSize += int64(len(leaf.data))
+	}
+	stats.ExternalSize = stats.ActiveSize
+	stats.UpdateSeq = strconv.FormatInt(d.db.updateSeq, 10)
+	return stats, nil
 }
 
 func (c *client) Compact(_ context.Context) error {
@@ -146,27 +246,7 @@ func (d *db) ViewCleanup(_ context.Context) error {
 	return notYetImplemented
 }
 
-func (d *db) Changes(ctx context.Context, opts map[string]interface{}) (driver.Changes, error) {
-	// FIXME: Unimplemented
-	return nil, notYetImplemented
-}
-
 func (d *db) BulkDocs(_ context.Context, _ []interface{}) (driver.BulkResults, error) {
 	// FIXME: Unimplemented
 	return nil, notYetImplemented
 }
-
-func (d *db) PutAttachment(_ context.Context, _, _, _, _ string, _ io.Reader) (string, error) {
-	// FIXME: Unimplemented
-	return "", notYetImplemented
-}
-
-func (d *db) GetAttachment(ctx context.Context, docID, rev, filename string) (contentType string, md5sum driver.MD5sum, body io.ReadCloser, err error) {
-	// FIXME: Unimplemented
-	return "", driver.MD5sum{}, nil, notYetImplemented
-}
-
-func (d *db) DeleteAttachment(ctx context.Context, docID, rev, filename string) (newRev string, err error) {
-	// FIXME: Unimplemented
-	return "", notYetImplemented
-}
@@ -2,6 +2,7 @@ package memory
 
 import (
 	"encoding/json"
+	"fmt"
 	"strings"
 	"testing"
 
@@ -9,7 +10,9 @@ import (
 
 	"github.com/flimzy/diff"
 	"github.com/flimzy/kivik"
+	"github.com/flimzy/kivik/authdb"
 	"github.com/flimzy/kivik/driver"
+	"github.com/flimzy/kivik/errors"
 )
 
 func TestStats(t *testing.T) {
@@ -29,7 +32,33 @@ func TestStats(t *testing.T) {
 					panic(e)
 				}
 			},
-			Expected: &driver.DBStats{Name: "foo"},
+			Expected: &driver.DBStats{Name: "foo", UpdateSeq: "0"},
+		},
+		{
+			Name:   "Docs",
+			DBName: "foo",
+			Setup: func(c driver.Client) {
+				if e := c.CreateDB(context.Background(), "foo", nil); e != nil {
+					panic(e)
+				}
+				db, err := c.DB(context.Background(), "foo", nil)
+				if err != nil {
+					panic(err)
+				}
+				for _, id := range []string{"a", "_local/c"} {
+					if _, e := db.Put(context.Background(), id, map[string]string{"x": "y"}); e != nil {
+						panic(e)
+					}
+				}
+				rev, err := db.Put(context.Background(), "b", map[string]string{"x": "y"})
+				if err != nil {
+					panic(err)
+				}
+				if _, e := db.Delete(context.Background(), "b", rev); e != nil {
+					panic(e)
+				}
+			},
+			Expected: &driver.DBStats{Name: "foo", DocCount: 1, DeletedCount: 1, UpdateSeq: "3", DiskSize: 197, ActiveSize: 63, ExternalSize: 63},
 		},
 	}
 	for _, test := range tests {
@@ -505,3 +534,174 @@ func TestCreateDoc(t *testing.T) {
 		}(test)
 	}
 }
+
+func TestBatchPut(t *testing.T) {
+	db := setupDB(t, nil).(*db)
+	ctx := context.Background()
+	batch := map[string]interface{}{"batch": kivik.BatchOK}
+	for i := 0; i < 10; i++ {
+		rev, err := db.PutOpts(ctx, fmt.Sprintf("doc%d", i), map[string]int{"n": i}, batch)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if rev != "" {
+			t.Errorf("Unexpected rev for batch write: %s", rev)
+		}
+	}
+	docID, _, err := db.CreateDocOpts(ctx, map[string]string{"_id": "created"}, batch)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = db.Flush(ctx); err != nil {
+		t.Fatal(err)
+	}
+	for _, id := range []string{"doc0", "doc9", docID} {
+		if _, err := db.Get(ctx, id, nil); err != nil {
+			t.Errorf("Failed to get %s after flush: %s", id, err)
+		}
+	}
+}
+
+func TestValidateAndModifiedBy(t *testing.T) {
+	c := setup(t, nil)
+	validate := ValidateFunc(func(newDoc, oldDoc map[string]interface{}, user *authdb.UserContext) error {
+		if user == nil {
+			return errors.Status(kivik.StatusUnauthorized, "must be logged in")
+		}
+		if oldDoc != nil && oldDoc["owner"] != user.Name {
+			return fmt.Errorf("only %s may update", oldDoc["owner"])
+		}
+		return nil
+	})
+	opts := map[string]interface{}{
+		OptionValidate:   validate,
+		OptionModifiedBy: "modified_by",
+	}
+	if err := c.CreateDB(context.Background(), "foo", opts); err != nil {
+		t.Fatal(err)
+	}
+	db, err := c.DB(context.Background(), "foo", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	bob := authdb.NewContext(context.Background(), &authdb.UserContext{Name: "bob"})
+	alice := authdb.NewContext(context.Background(), &authdb.UserContext{Name: "alice"})
+
+	if _, err = db.Put(context.Background(), "foo", map[string]string{"owner": "bob"}); kivik.StatusCode(err) != kivik.StatusUnauthorized {
+		t.Errorf("Anonymous put: expected status %d, got %v", kivik.StatusUnauthorized, err)
+	}
+	rev, err := db.Put(bob, "foo", map[string]string{"owner": "bob"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = db.Put(alice, "foo", map[string]string{"_rev": rev, "owner": "alice"}); kivik.StatusCode(err) != kivik.StatusForbidden {
+		t.Errorf("Put by non-owner: expected status %d, got %v", kivik.StatusForbidden, err)
+	}
+	if _, err = db.Put(bob, "foo", map[string]string{"_rev": rev, "owner": "bob", "foo": "bar"}); err != nil {
+		t.Fatal(err)
+	}
+	row, err := db.Get(context.Background(), "foo", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var doc map[string]interface{}
+	if err := json.Unmarshal(row, &doc); err != nil {
+		t.Fatal(err)
+	}
+	if doc["modified_by"] != "bob" {
+		t.Errorf("Unexpected modified_by: %v", doc["modified_by"])
+	}
+}
+
+func counterIDs(prefix string) kivik.IDGenerator {
+	var n int
+	return kivik.IDGeneratorFunc(func() (string, error) {
+		n++
+		return fmt.Sprintf("%s%0*x", prefix, 32-len(prefix), n), nil
+	})
+}
+
+func TestGenerators(t *testing.T) {
+	run := func() (docID, rev1, rev2 string) {
+		c := setup(t, nil)
+		opts := map[string]interface{}{
+			OptionIDGenerator:  counterIDs("doc"),
+			OptionRevGenerator: counterIDs(""),
+		}
+		if err := c.CreateDB(context.Background(), "foo", opts); err != nil {
+			t.Fatal(err)
+		}
+		db, err := c.DB(context.Background(), "foo", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		docID, rev1, err = db.CreateDoc(context.Background(), map[string]string{"foo": "bar"})
+		if err != nil {
+			t.Fatal(err)
+		}
+		rev2, err = db.Delete(context.Background(), docID, rev1)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return docID, rev1, rev2
+	}
+	expected := []string{
+		"doc00000000000000000000000000001",
+		"1-00000000000000000000000000000001",
+		"2-00000000000000000000000000000002",
+	}
+	for i := 0; i < 2; i++ {
+		docID, rev1, rev2 := run()
+		if d := diff.Interface(expected, []string{docID, rev1, rev2}); d != "" {
+			t.Error(d)
+		}
+	}
+}
+
+func TestInvalidRevGenerator(t *testing.T) {
+	c := setup(t, nil)
+	opts := map[string]interface{}{OptionRevGenerator: counterIDs("xyz")}
+	if err := c.CreateDB(context.Background(), "foo", opts); err != nil {
+		t.Fatal(err)
+	}
+	db, err := c.DB(context.Background(), "foo", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = db.Put(context.Background(), "foo", map[string]string{})
+	if status := kivik.StatusCode(err); status != kivik.StatusInternalServerError {
+		t.Errorf("Unexpected status %d: %v", status, err)
+	}
+}
+
+func TestContextOptions(t *testing.T) {
+	ctx := context.Background()
+	client, err := kivik.New(ctx, "memory", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = client.CreateDB(ctx, "foo"); err != nil {
+		t.Fatal(err)
+	}
+	db, err := client.DB(ctx, "foo", kivik.DefaultOptions(kivik.Options{"w": 2}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Options which Put, CreateDoc and Delete do not take are not passed to
+	// them, rather than requiring the driver to support options.
+	ctx = kivik.WithOptions(ctx, kivik.Options{"stale": "ok"})
+	rev, err := db.Put(ctx, "bar", map[string]string{"foo": "bar"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = db.Delete(ctx, "bar", rev); err != nil {
+		t.Fatal(err)
+	}
+	docID, rev, err := db.CreateDoc(ctx, map[string]string{"foo": "bar"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = db.Delete(ctx, docID, rev); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,94 @@
+package memory
+
+import (
+	"encoding/json"
+	"sort"
+	"time"
+)
+
+// expiry configures the deletion of expired documents, as set by the CreateDB
+// options OptionExpiryField, OptionExpiryInterval and OptionOnExpire.
+type expiry struct {
+	field    string
+	interval time.Duration
+	onExpire func(docID string)
+	// stop is closed when the database is destroyed.
+	stop chan struct{}
+}
+
+// expireLoop deletes the expired documents every interval, until the database
+// is destroyed.
+func (d *database) expireLoop() {
+	ticker := time.NewTicker(d.expiry.interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-d.expiry.stop:
+			return
+		case <-ticker.C:
+			d.expire(d.now())
+		}
+	}
+}
+
+// expire deletes the documents which expired at or before now, and returns
+// the number deleted.
+func (d *database) expire(now time.Time) int {
+	var count int
+	for _, docID := range d.expiredDocs(now) {
+		if !d.expireDoc(docID, now) {
+			continue
+		}
+		count++
+		if d.expiry.onExpire != nil {
+			d.expiry.onExpire(docID)
+		}
+	}
+	return count
+}
+
+func (d *database) expiredDocs(now time.Time) []string {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+	var docIDs []string
+	for docID, doc := range d.docs {
+		last := doc.revs[len(doc.revs)-1]
+		if !last.Deleted && expired(last.data, d.expiry.field, now) {
+			docIDs = append(docIDs, docID)
+		}
+	}
+	sort.Strings(docIDs)
+	return docIDs
+}
+
+// expireDoc deletes docID, if it is still expired once updates are locked,
+// and returns true if it was deleted.
+func (d *database) expireDoc(docID string, now time.Time) bool {
+	d.updateMu.Lock()
+	defer d.updateMu.Unlock()
+	last, ok := d.latestRevision(docID)
+	if !ok || last.Deleted || !expired(last.data, d.expiry.field, now) {
+		return false
+	}
+	revID, err := d.newRevID()
+	if err != nil {
+		return false
+	}
+	d.addRevision(couchDoc{"_id": docID, "_deleted": true}, revID, nil)
+	return true
+}
+
+// expired returns true if the field of the JSON document data holds a time at
+// or before now. Documents without a valid time never expire.
+func expired(data []byte, field string, now time.Time) bool {
+	var doc map[string]json.RawMessage
+	if err := json.Unmarshal(data, &doc); err != nil {
+		return false
+	}
+	var value string
+	if err := json.Unmarshal(doc[field], &value); err != nil {
+		return false
+	}
+	t, err := time.Parse(time.RFC3339, value)
+	return err == nil && !t.After(now)
+}
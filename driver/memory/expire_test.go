@@ -0,0 +1,133 @@
+package memory
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/flimzy/diff"
+	"github.com/flimzy/kivik"
+)
+
+func TestExpire(t *testing.T) {
+	c := setup(t, nil)
+	var mu sync.Mutex
+	var expiredIDs []string
+	opts := map[string]interface{}{
+		OptionExpiryField:    "expires",
+		OptionExpiryInterval: 10 * time.Millisecond,
+		OptionOnExpire: func(docID string) {
+			mu.Lock()
+			expiredIDs = append(expiredIDs, docID)
+			mu.Unlock()
+		},
+	}
+	if err := c.CreateDB(context.Background(), "foo", opts); err != nil {
+		t.Fatal(err)
+	}
+	db, err := c.DB(context.Background(), "foo", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	now := time.Now().UTC()
+	docs := map[string]interface{}{
+		"past":    map[string]string{"expires": now.Add(-time.Minute).Format(time.RFC3339)},
+		"future":  map[string]string{"expires": now.Add(time.Hour).Format(time.RFC3339)},
+		"invalid": map[string]string{"expires": "never"},
+		"none":    map[string]string{},
+	}
+	for docID, doc := range docs {
+		if _, err := db.Put(context.Background(), docID, doc); err != nil {
+			t.Fatal(err)
+		}
+	}
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		if _, err := db.Get(context.Background(), "past", nil); kivik.StatusCode(err) == kivik.StatusNotFound {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("Expired document was not deleted")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	for _, docID := range []string{"future", "invalid", "none"} {
+		if _, err := db.Get(context.Background(), docID, nil); err != nil {
+			t.Errorf("Expected %s to remain, got %s", docID, err)
+		}
+	}
+	mu.Lock()
+	if d := diff.Interface([]string{"past"}, expiredIDs); d != "" {
+		t.Error(d)
+	}
+	mu.Unlock()
+	if err := c.DestroyDB(context.Background(), "foo", nil); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestExpiryOptions(t *testing.T) {
+	tests := []struct {
+		name   string
+		opts   map[string]interface{}
+		status int
+	}{
+		{
+			name:   "InvalidField",
+			opts:   map[string]interface{}{OptionExpiryField: 1},
+			status: kivik.StatusBadRequest,
+		},
+		{
+			name:   "InvalidInterval",
+			opts:   map[string]interface{}{OptionExpiryField: "expires", OptionExpiryInterval: "1m"},
+			status: kivik.StatusBadRequest,
+		},
+		{
+			name:   "InvalidOnExpire",
+			opts:   map[string]interface{}{OptionExpiryField: "expires", OptionOnExpire: func() {}},
+			status: kivik.StatusBadRequest,
+		},
+		{
+			name: "Valid",
+			opts: map[string]interface{}{OptionExpiryField: "expires"},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			_, err := expiryOptions(test.opts)
+			if status := kivik.StatusCode(err); status != test.status {
+				t.Errorf("Unexpected error: %v", err)
+			}
+		})
+	}
+}
+
+func TestExpireClock(t *testing.T) {
+	now := time.Date(2017, 1, 1, 0, 0, 0, 0, time.UTC)
+	c := setup(t, nil)
+	opts := map[string]interface{}{
+		OptionExpiryField: "expires",
+		OptionClock:       func() time.Time { return now },
+	}
+	if err := c.CreateDB(context.Background(), "foo", opts); err != nil {
+		t.Fatal(err)
+	}
+	d, err := c.DB(context.Background(), "foo", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Expired according to the real clock, but not the database's.
+	expires := now.Add(time.Hour).Format(time.RFC3339)
+	if _, err := d.Put(context.Background(), "foo", map[string]string{"expires": expires}); err != nil {
+		t.Fatal(err)
+	}
+	database := d.(*db).db
+	if n := database.expire(database.now()); n != 0 {
+		t.Errorf("Expected no documents to expire, got %d", n)
+	}
+	now = now.Add(2 * time.Hour)
+	if n := database.expire(database.now()); n != 1 {
+		t.Errorf("Expected 1 document to expire, got %d", n)
+	}
+}
@@ -0,0 +1,120 @@
+package memory
+
+import (
+	"context"
+	"math/rand"
+	"sync"
+	"time"
+
+	"github.com/flimzy/kivik"
+	"github.com/flimzy/kivik/errors"
+)
+
+// Fault describes the misbehaviour injected into one operation of a database
+// created with OptionFaults.
+type Fault struct {
+	// Latency is added to each call, before it is applied. The call fails with
+	// the context's error if the context is done in the meantime.
+	Latency time.Duration
+	// Jitter is the maximum random latency added to Latency.
+	Jitter time.Duration
+	// ErrorRate is the probability, from 0 to 1, that a call fails with Error,
+	// without being applied.
+	ErrorRate float64
+	// Error is the injected error. The default is an error with
+	// StatusInternalServerError.
+	Error error
+	// ConflictRate is the probability, from 0 to 1, that a call fails with
+	// StatusConflict, without being applied.
+	ConflictRate float64
+}
+
+// Faults maps the names of database methods to the faults injected into them.
+// Faults may be injected into Get, Put, CreateDoc, Delete, Changes, Stats,
+// Security, SetSecurity, GetAttachment, which also covers GetAttachmentMeta,
+// PutAttachment and DeleteAttachment. The fault with the key "*" applies to
+// any method without its own.
+type Faults map[string]Fault
+
+var errInjected = errors.Status(kivik.StatusInternalServerError, "kivik: injected fault")
+
+// faultInjector injects the faults set by OptionFaults, with random numbers
+// drawn from a source seeded by OptionFaultSeed, so that a sequence of calls
+// misbehaves identically on every run.
+type faultInjector struct {
+	faults Faults
+	mu     sync.Mutex
+	rnd    *rand.Rand
+}
+
+// faultOptions reads the fault injection options given to CreateDB. It returns
+// nil if OptionFaults is not set.
+func faultOptions(options map[string]interface{}) (*faultInjector, error) {
+	v, ok := options[OptionFaults]
+	if !ok {
+		return nil, nil
+	}
+	faults, ok := v.(Faults)
+	if !ok {
+		if m, isMap := v.(map[string]Fault); isMap {
+			faults = m
+		} else {
+			return nil, errors.Statusf(kivik.StatusBadRequest, "kivik: %s must be a memory.Faults", OptionFaults)
+		}
+	}
+	seed := time.Now().UnixNano()
+	if v, ok := options[OptionFaultSeed]; ok {
+		switch t := v.(type) {
+		case int64:
+			seed = t
+		case int:
+			seed = int64(t)
+		default:
+			return nil, errors.Statusf(kivik.StatusBadRequest, "kivik: %s must be an int64", OptionFaultSeed)
+		}
+	}
+	return &faultInjector{
+		faults: faults,
+		rnd:    rand.New(rand.NewSource(seed)),
+	}, nil
+}
+
+// inject applies the fault configured for method, if any, returning the
+// injected error.
+func (f *faultInjector) inject(ctx context.Context, method string) error {
+	if f == nil {
+		return nil
+	}
+	fault, ok := f.faults[method]
+	if !ok {
+		if fault, ok = f.faults["*"]; !ok {
+			return nil
+		}
+	}
+	f.mu.Lock()
+	latency := fault.Latency
+	if fault.Jitter > 0 {
+		latency += time.Duration(f.rnd.Int63n(int64(fault.Jitter)))
+	}
+	roll := f.rnd.Float64()
+	f.mu.Unlock()
+	if latency > 0 {
+		timer := time.NewTimer(latency)
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+			timer.Stop()
+			return ctx.Err()
+		}
+	}
+	switch {
+	case roll < fault.ErrorRate:
+		if fault.Error != nil {
+			return fault.Error
+		}
+		return errInjected
+	case roll < fault.ErrorRate+fault.ConflictRate:
+		return errors.Status(kivik.StatusConflict, "document update conflict")
+	}
+	return nil
+}
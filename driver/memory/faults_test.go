@@ -0,0 +1,158 @@
+package memory
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/flimzy/diff"
+	"github.com/flimzy/kivik"
+	"github.com/flimzy/kivik/driver"
+)
+
+func faultyDB(t *testing.T, faults Faults, seed int64) driver.DB {
+	c := setup(t, nil)
+	opts := map[string]interface{}{
+		OptionFaults:    faults,
+		OptionFaultSeed: seed,
+	}
+	if err := c.CreateDB(context.Background(), "foo", opts); err != nil {
+		t.Fatal(err)
+	}
+	db, err := c.DB(context.Background(), "foo", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return db
+}
+
+func TestFaults(t *testing.T) {
+	custom := errors.New("custom failure")
+	tests := []struct {
+		name   string
+		faults Faults
+		status int
+		err    error
+	}{
+		{
+			name:   "NoFault",
+			faults: Faults{"Get": {ErrorRate: 1}},
+		},
+		{
+			name:   "Error",
+			faults: Faults{"Put": {ErrorRate: 1}},
+			status: kivik.StatusInternalServerError,
+		},
+		{
+			name:   "CustomError",
+			faults: Faults{"Put": {ErrorRate: 1, Error: custom}},
+			err:    custom,
+		},
+		{
+			name:   "Conflict",
+			faults: Faults{"Put": {ConflictRate: 1}},
+			status: kivik.StatusConflict,
+		},
+		{
+			name:   "Default",
+			faults: Faults{"*": {ConflictRate: 1}},
+			status: kivik.StatusConflict,
+		},
+		{
+			name:   "Override",
+			faults: Faults{"*": {ConflictRate: 1}, "Put": {}},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			fdb := faultyDB(t, test.faults, 1)
+			_, err := fdb.Put(context.Background(), "foo", map[string]string{"foo": "bar"})
+			if test.err != nil {
+				if err != test.err {
+					t.Errorf("Unexpected error: %v", err)
+				}
+				return
+			}
+			if status := kivik.StatusCode(err); status != test.status {
+				t.Errorf("Unexpected status %d: %v", status, err)
+			}
+			if err == nil {
+				return
+			}
+			if fdb.(*db).db.docExists("foo") {
+				t.Errorf("Expected the failed write not to be applied")
+			}
+		})
+	}
+}
+
+func TestFaultsDeterministic(t *testing.T) {
+	faults := Faults{"Put": {ErrorRate: 0.3, ConflictRate: 0.3}}
+	run := func() []int {
+		db := faultyDB(t, faults, 42)
+		statuses := make([]int, 20)
+		for i := range statuses {
+			_, err := db.Put(context.Background(), randStr(), map[string]string{})
+			statuses[i] = kivik.StatusCode(err)
+		}
+		return statuses
+	}
+	first := run()
+	if d := diff.Interface(first, run()); d != "" {
+		t.Errorf("Faults differ between runs with the same seed:\n%s", d)
+	}
+}
+
+func TestFaultsLatency(t *testing.T) {
+	db := faultyDB(t, Faults{"Get": {Latency: time.Minute}}, 1)
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if _, err := db.Get(ctx, "foo", nil); err != context.DeadlineExceeded {
+		t.Errorf("Expected the context's error, got %v", err)
+	}
+
+	db = faultyDB(t, Faults{"Get": {Latency: 20 * time.Millisecond}}, 1)
+	start := time.Now()
+	if _, err := db.Get(context.Background(), "foo", nil); kivik.StatusCode(err) != kivik.StatusNotFound {
+		t.Errorf("Unexpected error: %v", err)
+	}
+	if elapsed := time.Since(start); elapsed < 20*time.Millisecond {
+		t.Errorf("Expected a delay of at least 20ms, got %s", elapsed)
+	}
+}
+
+func TestFaultOptions(t *testing.T) {
+	tests := []struct {
+		name string
+		opts map[string]interface{}
+		err  string
+	}{
+		{
+			name: "InvalidFaults",
+			opts: map[string]interface{}{OptionFaults: "foo"},
+			err:  "kivik: faults must be a memory.Faults",
+		},
+		{
+			name: "InvalidSeed",
+			opts: map[string]interface{}{OptionFaults: Faults{}, OptionFaultSeed: "foo"},
+			err:  "kivik: fault_seed must be an int64",
+		},
+		{
+			name: "Map",
+			opts: map[string]interface{}{OptionFaults: map[string]Fault{}},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			_, err := faultOptions(test.opts)
+			var msg string
+			if err != nil {
+				msg = err.Error()
+			}
+			if msg != test.err {
+				t.Errorf("Unexpected error: %s", msg)
+			}
+		})
+	}
+}
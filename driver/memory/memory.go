@@ -4,7 +4,6 @@ package memory
 import (
 	"context"
 	"net/http"
-	"regexp"
 	"sync"
 
 	"github.com/flimzy/kivik"
@@ -28,6 +27,7 @@ type client struct {
 }
 
 var _ driver.Client = &client{}
+var _ driver.OptionValidator = &client{}
 
 // Identifying constants
 const (
@@ -35,14 +35,24 @@ const (
 	Vendor  = "Kivik Memory Adaptor"
 )
 
-func (d *memDriver) NewClient(_ context.Context, name string) (driver.Client, error) {
-	return &client{
+// NewClient returns a new, empty memory store, which contains only the system
+// databases, _users and _replicator.
+func (d *memDriver) NewClient(ctx context.Context, name string) (driver.Client, error) {
+	c := &client{
 		Client: common.NewClient(Version, Vendor),
 		dbs:    make(map[string]*database),
-	}, nil
+	}
+	for _, dbName := range []string{UsersDB, ReplicatorDB} {
+		if err := c.CreateDB(ctx, dbName, nil); err != nil {
+			return nil, err
+		}
+	}
+	return c, nil
 }
 
 func (c *client) AllDBs(_ context.Context, _ map[string]interface{}) ([]string, error) {
+	c.mutex.RLock()
+	defer c.mutex.RUnlock()
 	dbs := make([]string, 0, len(c.dbs))
 	for k := range c.dbs {
 		dbs = append(dbs, k)
@@ -57,27 +67,52 @@ func (c *client) DBExists(_ context.Context, dbName string, _ map[string]interfa
 	return ok, nil
 }
 
-// Copied verbatim from http://docs.couchdb.org/en/2.0.0/api/database/common.html#head--db
-var validDBName = regexp.MustCompile("^[a-z][a-z0-9_$()+/-]*$")
-var validNames = map[string]struct{}{
-	"_users":      struct{}{},
-	"_replicator": struct{}{},
-}
-
 func (c *client) CreateDB(ctx context.Context, dbName string, options map[string]interface{}) error {
 	if exists, _ := c.DBExists(ctx, dbName, options); exists {
 		return errors.Status(http.StatusPreconditionFailed, "database exists")
 	}
-	if _, ok := validNames[dbName]; !ok {
-		if !validDBName.MatchString(dbName) {
-			return errors.Status(kivik.StatusBadRequest, "invalid database name")
-		}
+	if !kivik.ValidDBName(dbName) {
+		return errors.NamedStatus(kivik.StatusBadRequest, "illegal_database_name", "invalid database name")
+	}
+	validate, modifiedBy, err := dbOptions(options)
+	if err != nil {
+		return err
+	}
+	if validate == nil {
+		// The system databases are validated as with CouchDB, unless another
+		// ValidateFunc is provided.
+		validate = systemValidators[dbName]
+	}
+	exp, err := expiryOptions(options)
+	if err != nil {
+		return err
+	}
+	faults, err := faultOptions(options)
+	if err != nil {
+		return err
+	}
+	clock, idGen, revGen, err := generatorOptions(options)
+	if err != nil {
+		return err
 	}
 	c.mutex.Lock()
 	defer c.mutex.Unlock()
-	c.dbs[dbName] = &database{
-		docs:     make(map[string]*document),
-		security: &driver.Security{},
+	d := &database{
+		docs:       make(map[string]*document),
+		security:   &driver.Security{},
+		validate:   validate,
+		modifiedBy: modifiedBy,
+		expiry:     exp,
+		faults:     faults,
+		clock:      clock,
+		idGen:      idGen,
+		revGen:     revGen,
+		// Passwords stored in the _users database are always hashed.
+		hashPasswords: dbName == UsersDB,
+	}
+	c.dbs[dbName] = d
+	if exp != nil {
+		go d.expireLoop()
 	}
 	return nil
 }
@@ -91,17 +126,23 @@ func (c *client) DestroyDB(ctx context.Context, dbName string, options map[strin
 	c.dbs[dbName].mu.Lock()
 	defer c.dbs[dbName].mu.Unlock()
 	c.dbs[dbName].deleted = true // To invalidate any outstanding db handles
+	if exp := c.dbs[dbName].expiry; exp != nil {
+		close(exp.stop)
+	}
 	delete(c.dbs, dbName)
 	return nil
 }
 
-func (c *client) DB(ctx context.Context, dbName string, options map[string]interface{}) (driver.DB, error) {
-	if exists, _ := c.DBExists(ctx, dbName, options); !exists {
+func (c *client) DB(_ context.Context, dbName string, _ map[string]interface{}) (driver.DB, error) {
+	c.mutex.RLock()
+	defer c.mutex.RUnlock()
+	d, ok := c.dbs[dbName]
+	if !ok {
 		return nil, errors.Status(http.StatusNotFound, "database does not exist")
 	}
 	return &db{
 		client: c,
 		dbName: dbName,
-		db:     c.dbs[dbName],
+		db:     d,
 	}, nil
 }
@@ -99,6 +99,16 @@ func TestCreateDB(t *testing.T) {
 		{
 			Name:   "UsersDB",
 			DBName: "_users",
+			Error:  "database exists",
+		},
+		{
+			Name:   "RecreateUsersDB",
+			DBName: "_users",
+			Setup: func(c driver.Client) {
+				if e := c.DestroyDB(context.Background(), "_users", nil); e != nil {
+					panic(e)
+				}
+			},
 		},
 		{
 			Name:   "SystemDB",
@@ -141,8 +151,8 @@ func TestAllDBs(t *testing.T) {
 	}
 	tests := []adTest{
 		{
-			Name:     "NoDBs",
-			Expected: []string{},
+			Name:     "SystemDBs",
+			Expected: []string{"_replicator", "_users"},
 		},
 		{
 			Name: "2DBs",
@@ -154,7 +164,7 @@ func TestAllDBs(t *testing.T) {
 					panic(err)
 				}
 			},
-			Expected: []string{"foo", "bar"},
+			Expected: []string{"_replicator", "_users", "foo", "bar"},
 		},
 	}
 	for _, test := range tests {
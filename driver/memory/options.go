@@ -0,0 +1,148 @@
+package memory
+
+import (
+	"time"
+
+	"github.com/flimzy/kivik"
+	"github.com/flimzy/kivik/authdb"
+	"github.com/flimzy/kivik/driver"
+	"github.com/flimzy/kivik/errors"
+)
+
+// Options which may be passed to CreateDB, to configure the new database.
+const (
+	// OptionValidate sets a ValidateFunc, which is called for every document
+	// update, as a Go equivalent of a design document's validate_doc_update
+	// function.
+	OptionValidate = "validate_doc_update"
+	// OptionModifiedBy names a field in which the name of the user who last
+	// modified each document is recorded. The user is read from the context
+	// passed to Put, with authdb.FromContext, and the field is left unset if
+	// there is none.
+	OptionModifiedBy = "modified_by_field"
+	// OptionExpiryField names a field which holds the time, formatted as with
+	// time.RFC3339, at which each document expires. Expired documents are
+	// deleted by a background job, until the database is destroyed.
+	OptionExpiryField = "expiry_field"
+	// OptionExpiryInterval sets the interval, as a time.Duration, at which
+	// expired documents are deleted. The default is DefaultExpiryInterval.
+	OptionExpiryInterval = "expiry_interval"
+	// OptionOnExpire sets a func(docID string), which is called after each
+	// expired document is deleted.
+	OptionOnExpire = "on_expire"
+	// OptionFaults sets the Faults injected into the database's operations, to
+	// simulate a slow or misbehaving server.
+	OptionFaults = "faults"
+	// OptionFaultSeed sets the int64 seed of the random numbers used to inject
+	// faults, so that tests may reproduce the same faults on every run. The
+	// default seed is the current time.
+	OptionFaultSeed = "fault_seed"
+	// OptionClock sets a func() time.Time, which is used instead of time.Now
+	// to determine which documents have expired.
+	OptionClock = "clock"
+	// OptionIDGenerator sets a kivik.IDGenerator, which generates the IDs of
+	// documents created without one. The default is random IDs.
+	OptionIDGenerator = "id_generator"
+	// OptionRevGenerator sets a kivik.IDGenerator, which generates the part of
+	// new revision IDs following the revision number. Generated IDs must be
+	// 32 lowercase hexadecimal digits. The default is random IDs.
+	OptionRevGenerator = "rev_generator"
+)
+
+// DefaultExpiryInterval is the interval at which expired documents are
+// deleted, if OptionExpiryField is set, and OptionExpiryInterval is not.
+const DefaultExpiryInterval = time.Minute
+
+// supportedOptions are the options accepted by the memory driver, by client
+// or database method. The options of other methods are not validated.
+var supportedOptions = map[string]map[string]driver.OptionType{
+	"CreateDB": {
+		OptionValidate:       driver.OptionAny,
+		OptionModifiedBy:     driver.OptionString,
+		OptionExpiryField:    driver.OptionString,
+		OptionExpiryInterval: driver.OptionAny,
+		OptionOnExpire:       driver.OptionAny,
+		OptionFaults:         driver.OptionAny,
+		OptionFaultSeed:      driver.OptionAny,
+		OptionClock:          driver.OptionAny,
+		OptionIDGenerator:    driver.OptionAny,
+		OptionRevGenerator:   driver.OptionAny,
+	},
+	"Put":       {"batch": driver.OptionString},
+	"CreateDoc": {"batch": driver.OptionString},
+}
+
+// SupportedOptions satisfies the driver.OptionValidator interface, for both
+// the client and, as db embeds client, its databases.
+func (c *client) SupportedOptions(method string) (map[string]driver.OptionType, bool) {
+	opts, ok := supportedOptions[method]
+	return opts, ok
+}
+
+// ValidateFunc validates a document update. oldDoc is nil for a new document,
+// and user is nil if the context carries no user. If an error without a
+// status code is returned, the update is rejected with StatusForbidden.
+type ValidateFunc func(newDoc, oldDoc map[string]interface{}, user *authdb.UserContext) error
+
+// dbOptions reads the database options given to CreateDB.
+func dbOptions(options map[string]interface{}) (validate ValidateFunc, modifiedBy string, err error) {
+	if v, ok := options[OptionValidate]; ok {
+		if validate, ok = v.(ValidateFunc); !ok {
+			if fn, isFunc := v.(func(map[string]interface{}, map[string]interface{}, *authdb.UserContext) error); isFunc {
+				validate = fn
+			} else {
+				return nil, "", errors.Statusf(kivik.StatusBadRequest, "kivik: %s must be a memory.ValidateFunc", OptionValidate)
+			}
+		}
+	}
+	if v, ok := options[OptionModifiedBy]; ok {
+		if modifiedBy, ok = v.(string); !ok {
+			return nil, "", errors.Statusf(kivik.StatusBadRequest, "kivik: %s must be a string", OptionModifiedBy)
+		}
+	}
+	return validate, modifiedBy, nil
+}
+
+// expiryOptions reads the expiry options given to CreateDB. It returns nil if
+// OptionExpiryField is not set.
+func expiryOptions(options map[string]interface{}) (*expiry, error) {
+	v, ok := options[OptionExpiryField]
+	if !ok {
+		return nil, nil
+	}
+	exp := &expiry{interval: DefaultExpiryInterval, stop: make(chan struct{})}
+	if exp.field, ok = v.(string); !ok || exp.field == "" {
+		return nil, errors.Statusf(kivik.StatusBadRequest, "kivik: %s must be a non-empty string", OptionExpiryField)
+	}
+	if v, ok := options[OptionExpiryInterval]; ok {
+		if exp.interval, ok = v.(time.Duration); !ok || exp.interval <= 0 {
+			return nil, errors.Statusf(kivik.StatusBadRequest, "kivik: %s must be a positive time.Duration", OptionExpiryInterval)
+		}
+	}
+	if v, ok := options[OptionOnExpire]; ok {
+		if exp.onExpire, ok = v.(func(string)); !ok {
+			return nil, errors.Statusf(kivik.StatusBadRequest, "kivik: %s must be a func(string)", OptionOnExpire)
+		}
+	}
+	return exp, nil
+}
+
+// generatorOptions reads the clock and generator options given to CreateDB.
+func generatorOptions(options map[string]interface{}) (clock func() time.Time, ids, revs kivik.IDGenerator, err error) {
+	if v, ok := options[OptionClock]; ok {
+		if clock, ok = v.(func() time.Time); !ok {
+			return nil, nil, nil, errors.Statusf(kivik.StatusBadRequest, "kivik: %s must be a func() time.Time", OptionClock)
+		}
+	}
+	if v, ok := options[OptionIDGenerator]; ok {
+		if ids, ok = v.(kivik.IDGenerator); !ok {
+			return nil, nil, nil, errors.Statusf(kivik.StatusBadRequest, "kivik: %s must be a kivik.IDGenerator", OptionIDGenerator)
+		}
+	}
+	if v, ok := options[OptionRevGenerator]; ok {
+		if revs, ok = v.(kivik.IDGenerator); !ok {
+			return nil, nil, nil, errors.Statusf(kivik.StatusBadRequest, "kivik: %s must be a kivik.IDGenerator", OptionRevGenerator)
+		}
+	}
+	return clock, ids, revs, nil
+}
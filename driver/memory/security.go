@@ -21,7 +21,10 @@ func cloneSecurity(in *driver.Security) *driver.Security {
 	}
 }
 
-func (d *db) Security(_ context.Context) (*driver.Security, error) {
+func (d *db) Security(ctx context.Context) (*driver.Security, error) {
+	if err := d.db.faults.inject(ctx, "Security"); err != nil {
+		return nil, err
+	}
 	d.db.mu.RLock()
 	defer d.db.mu.RUnlock()
 	if d.db.deleted {
@@ -30,7 +33,10 @@ func (d *db) Security(_ context.Context) (*driver.Security, error) {
 	return cloneSecurity(d.db.security), nil
 }
 
-func (d *db) SetSecurity(_ context.Context, sec *driver.Security) error {
+func (d *db) SetSecurity(ctx context.Context, sec *driver.Security) error {
+	if err := d.db.faults.inject(ctx, "SetSecurity"); err != nil {
+		return err
+	}
 	d.db.mu.Lock()
 	defer d.db.mu.Unlock()
 	if d.db.deleted {
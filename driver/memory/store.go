@@ -4,6 +4,7 @@ import (
 	"encoding/json"
 	"fmt"
 	"math/rand"
+	"regexp"
 	"strings"
 	"sync"
 	"time"
@@ -16,6 +17,9 @@ import (
 type file struct {
 	ContentType string
 	Data        []byte
+	// Revpos is the number of the revision in which the attachment was last
+	// changed.
+	Revpos int64
 }
 
 type document struct {
@@ -28,6 +32,8 @@ type revision struct {
 	Rev         string
 	Deleted     bool
 	Attachments map[string]file
+	// Seq is the database update sequence of the revision.
+	Seq int64
 }
 
 type database struct {
@@ -36,6 +42,34 @@ type database struct {
 	deleted   bool
 	security  *driver.Security
 	updateSeq int64
+
+	// updateMu serializes document updates, so that conflict detection and
+	// the addition of the new revision happen atomically.
+	updateMu sync.Mutex
+
+	// batch holds the pending batch mode writes.
+	batch batchQueue
+
+	// validate and modifiedBy are set by the CreateDB options OptionValidate
+	// and OptionModifiedBy.
+	validate   ValidateFunc
+	modifiedBy string
+
+	// expiry is set by OptionExpiryField.
+	expiry *expiry
+
+	// faults is set by OptionFaults.
+	faults *faultInjector
+
+	// clock, idGen and revGen are set by OptionClock, OptionIDGenerator and
+	// OptionRevGenerator.
+	clock  func() time.Time
+	idGen  kivik.IDGenerator
+	revGen kivik.IDGenerator
+
+	// hashPasswords is set for the _users database, to replace the plain
+	// text passwords of user documents with their hashes.
+	hashPasswords bool
 }
 
 var rnd *rand.Rand
@@ -106,7 +140,43 @@ func toCouchDoc(i interface{}) (couchDoc, error) {
 	return m, nil
 }
 
-func (d *database) addRevision(doc couchDoc) string {
+// now returns the current time, according to the database's clock.
+func (d *database) now() time.Time {
+	if d.clock != nil {
+		return d.clock()
+	}
+	return time.Now()
+}
+
+// newDocID returns the ID of a new document created without one.
+func (d *database) newDocID() (string, error) {
+	if d.idGen == nil {
+		return randStr(), nil
+	}
+	return d.idGen.NewID()
+}
+
+var revIDRE = regexp.MustCompile("^[a-f0-9]{32}$")
+
+// newRevID returns the part of a new revision ID following the revision
+// number.
+func (d *database) newRevID() (string, error) {
+	if d.revGen == nil {
+		return randStr(), nil
+	}
+	id, err := d.revGen.NewID()
+	if err != nil {
+		return "", err
+	}
+	if !revIDRE.MatchString(id) {
+		return "", errors.Statusf(kivik.StatusInternalServerError, "kivik: invalid generated revision ID: %s", id)
+	}
+	return id, nil
+}
+
+// addRevision adds a new revision of doc, with the given revision ID suffix,
+// which is ignored for local documents, and the attachments atts.
+func (d *database) addRevision(doc couchDoc, revID string, atts map[string]file) string {
 	d.mu.Lock()
 	defer d.mu.Unlock()
 	id, ok := doc["_id"].(string)
@@ -119,21 +189,20 @@ func (d *database) addRevision(doc couchDoc) string {
 			revs: make([]*revision, 0, 1),
 		}
 	}
-	var revID int64
-	var revStr string
+	var revNum int64
+	revStr := revID
 	if isLocal {
-		revID = 1
+		revNum = 1
 		revStr = "0"
 	} else {
 		l := len(d.docs[id].revs)
 		if l == 0 {
-			revID = 1
+			revNum = 1
 		} else {
-			revID = d.docs[id].revs[l-1].ID + 1
+			revNum = d.docs[id].revs[l-1].ID + 1
 		}
-		revStr = randStr()
 	}
-	rev := fmt.Sprintf("%d-%s", revID, revStr)
+	rev := fmt.Sprintf("%d-%s", revNum, revStr)
 	doc["_rev"] = rev
 	data, err := json.Marshal(doc)
 	if err != nil {
@@ -141,14 +210,17 @@ func (d *database) addRevision(doc couchDoc) string {
 	}
 	deleted, _ := doc["_deleted"].(bool)
 	newRev := &revision{
-		data:    data,
-		ID:      revID,
-		Rev:     revStr,
-		Deleted: deleted,
+		data:        data,
+		ID:          revNum,
+		Rev:         revStr,
+		Deleted:     deleted,
+		Attachments: atts,
 	}
 	if isLocal {
 		d.docs[id].revs = []*revision{newRev}
 	} else {
+		d.updateSeq++
+		newRev.Seq = d.updateSeq
 		d.docs[id].revs = append(d.docs[id].revs, newRev)
 	}
 	return rev
@@ -66,14 +66,14 @@ func TestAddRevision(t *testing.T) {
 	d := &database{
 		docs: make(map[string]*document),
 	}
-	r := d.addRevision(couchDoc{"_id": "bar"})
+	r := d.addRevision(couchDoc{"_id": "bar"}, randStr(), nil)
 	if !strings.HasPrefix(r, "1-") {
 		t.Errorf("Expected initial revision to start with '1-', but got '%s'", r)
 	}
 	if len(r) != 34 {
 		t.Errorf("rev (%s) is %d chars long, expected 34", r, len(r))
 	}
-	r = d.addRevision(couchDoc{"_id": "bar"})
+	r = d.addRevision(couchDoc{"_id": "bar"}, randStr(), nil)
 	if !strings.HasPrefix(r, "2-") {
 		t.Errorf("Expected second revision to start with '2-', but got '%s'", r)
 	}
@@ -85,7 +85,7 @@ func TestAddRevision(t *testing.T) {
 			defer func() {
 				i = recover()
 			}()
-			d.addRevision(nil)
+			d.addRevision(nil, randStr(), nil)
 			return nil
 		}()
 		if r == nil {
@@ -97,7 +97,7 @@ func TestAddRevision(t *testing.T) {
 			defer func() {
 				i = recover()
 			}()
-			d.addRevision(couchDoc{"_id": "foo", "invalid": make(chan int)})
+			d.addRevision(couchDoc{"_id": "foo", "invalid": make(chan int)}, randStr(), nil)
 			return nil
 		}()
 		if r == nil {
@@ -110,11 +110,11 @@ func TestAddLocalRevision(t *testing.T) {
 	d := &database{
 		docs: make(map[string]*document),
 	}
-	r := d.addRevision(couchDoc{"_id": "_local/foo"})
+	r := d.addRevision(couchDoc{"_id": "_local/foo"}, randStr(), nil)
 	if r != "1-0" {
 		t.Errorf("Expected local revision, got %s", r)
 	}
-	r = d.addRevision(couchDoc{"_id": "_local/foo"})
+	r = d.addRevision(couchDoc{"_id": "_local/foo"}, randStr(), nil)
 	if r != "1-0" {
 		t.Errorf("Expected local revision, got %s", r)
 	}
@@ -134,8 +134,8 @@ func TestGetRevisionFound(t *testing.T) {
 	d := &database{
 		docs: make(map[string]*document),
 	}
-	r := d.addRevision(map[string]interface{}{"_id": "foo", "a": 1})
-	_ = d.addRevision(map[string]interface{}{"_id": "foo", "a": 2})
+	r := d.addRevision(map[string]interface{}{"_id": "foo", "a": 1}, randStr(), nil)
+	_ = d.addRevision(map[string]interface{}{"_id": "foo", "a": 2}, randStr(), nil)
 	result, found := d.getRevision("foo", r)
 	if !found {
 		t.Errorf("Should have found revision")
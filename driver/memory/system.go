@@ -0,0 +1,185 @@
+package memory
+
+import (
+	"crypto/sha1"
+	"fmt"
+	"strings"
+
+	"golang.org/x/crypto/pbkdf2"
+
+	"github.com/flimzy/kivik"
+	"github.com/flimzy/kivik/authdb"
+	"github.com/flimzy/kivik/errors"
+)
+
+// System database names, which are created with every new client.
+const (
+	UsersDB      = "_users"
+	ReplicatorDB = "_replicator"
+)
+
+const userPrefix = "org.couchdb.user:"
+
+// passwordIterations is the number of PBKDF2 iterations used to hash the
+// passwords of new or updated users, as with CouchDB's default.
+const passwordIterations = 10
+
+// systemValidators are the validation functions of the system databases, as
+// Go equivalents of those CouchDB installs in their _design/_auth documents.
+var systemValidators = map[string]ValidateFunc{
+	UsersDB:      validateUser,
+	ReplicatorDB: validateReplication,
+}
+
+func isAdmin(user *authdb.UserContext) bool {
+	if user == nil {
+		// Without a user in the context, the driver is being used directly,
+		// rather than on behalf of a client, so no authorization applies.
+		return true
+	}
+	for _, role := range user.Roles {
+		if role == "_admin" {
+			return true
+		}
+	}
+	return false
+}
+
+func forbidden(format string, args ...interface{}) error {
+	return errors.Statusf(kivik.StatusForbidden, format, args...)
+}
+
+// validateUser validates updates to the _users database. Documents must
+// describe a user, with an ID of org.couchdb.user:<name>, and users other than
+// admins may only update their own document, and may not change their roles.
+func validateUser(newDoc, oldDoc map[string]interface{}, user *authdb.UserContext) error {
+	id, _ := newDoc["_id"].(string)
+	if strings.HasPrefix(id, "_design/") {
+		if !isAdmin(user) {
+			return forbidden("Only admins may update design documents")
+		}
+		return nil
+	}
+	if deleted, _ := newDoc["_deleted"].(bool); deleted {
+		name, _ := oldDoc["name"].(string)
+		if !isAdmin(user) && user.Name != name {
+			return forbidden("You may only delete your own user document")
+		}
+		return nil
+	}
+	if newDoc["type"] != "user" {
+		return forbidden("doc.type must be user")
+	}
+	name, ok := newDoc["name"].(string)
+	if !ok || name == "" {
+		return forbidden("doc.name must be a non-empty string")
+	}
+	if id != userPrefix+name {
+		return forbidden("Doc ID must be of the form %s<name>", userPrefix)
+	}
+	roles, ok := newDoc["roles"].([]interface{})
+	if !ok {
+		return forbidden("doc.roles must be an array")
+	}
+	for _, role := range roles {
+		if _, ok := role.(string); !ok {
+			return forbidden("doc.roles can only contain strings")
+		}
+	}
+	if p, ok := newDoc["password"]; ok {
+		if _, ok := p.(string); !ok {
+			return forbidden("doc.password must be a string")
+		}
+	}
+	if isAdmin(user) {
+		return nil
+	}
+	if user.Name != name {
+		return forbidden("You may only update your own user document")
+	}
+	var oldRoles []interface{}
+	if oldDoc != nil {
+		oldRoles, _ = oldDoc["roles"].([]interface{})
+	}
+	if fmt.Sprint(roles) != fmt.Sprint(oldRoles) {
+		return forbidden("Only admins may edit roles")
+	}
+	return nil
+}
+
+// hashPassword replaces the plain text password of a user document, if any,
+// with its PBKDF2 hash, in the form read by the usersdb package.
+func hashPassword(doc couchDoc) {
+	password, ok := doc["password"].(string)
+	if !ok {
+		return
+	}
+	delete(doc, "password")
+	salt := randStr()
+	doc["password_scheme"] = authdb.SchemePBKDF2
+	doc["iterations"] = passwordIterations
+	doc["salt"] = salt
+	doc["derived_key"] = fmt.Sprintf("%x", pbkdf2.Key([]byte(password), []byte(salt), passwordIterations, authdb.PBKDF2KeyLength, sha1.New))
+}
+
+// validateReplication validates updates to the _replicator database. Each
+// replication document must name its source and target, and users other than
+// admins may only update replications run on their own behalf.
+func validateReplication(newDoc, oldDoc map[string]interface{}, user *authdb.UserContext) error {
+	id, _ := newDoc["_id"].(string)
+	if strings.HasPrefix(id, "_design/") {
+		if !isAdmin(user) {
+			return forbidden("Only admins may update design documents")
+		}
+		return nil
+	}
+	if !isAdmin(user) {
+		if err := validateReplicationOwner(oldDoc, user); err != nil {
+			return err
+		}
+	}
+	if deleted, _ := newDoc["_deleted"].(bool); deleted {
+		return nil
+	}
+	for _, field := range []string{"source", "target"} {
+		if !validEndpoint(newDoc[field]) {
+			return forbidden("The %s field must be a database name, URL, or an object with a url field", field)
+		}
+	}
+	for field := range newDoc {
+		if strings.HasPrefix(field, "_replication_") {
+			return forbidden("The %s field is reserved for the replicator", field)
+		}
+	}
+	if isAdmin(user) {
+		return nil
+	}
+	return validateReplicationOwner(newDoc, user)
+}
+
+// validateReplicationOwner returns an error if doc names a user_ctx other than
+// that of user.
+func validateReplicationOwner(doc map[string]interface{}, user *authdb.UserContext) error {
+	if doc == nil {
+		return nil
+	}
+	userCtx, ok := doc["user_ctx"].(map[string]interface{})
+	if !ok {
+		return nil
+	}
+	if name, _ := userCtx["name"].(string); name != user.Name {
+		return forbidden("You may only update your own replications")
+	}
+	return nil
+}
+
+func validEndpoint(endpoint interface{}) bool {
+	switch t := endpoint.(type) {
+	case string:
+		return t != ""
+	case map[string]interface{}:
+		url, _ := t["url"].(string)
+		return url != ""
+	}
+	return false
+}
@@ -0,0 +1,218 @@
+package memory
+
+import (
+	"context"
+	"testing"
+
+	"github.com/flimzy/kivik"
+	"github.com/flimzy/kivik/authdb"
+	"github.com/flimzy/kivik/authdb/usersdb"
+	"github.com/flimzy/kivik/errors"
+)
+
+func TestValidateUser(t *testing.T) {
+	admin := &authdb.UserContext{Name: "admin", Roles: []string{"_admin"}}
+	bob := &authdb.UserContext{Name: "bob"}
+	newBob := func() map[string]interface{} {
+		return map[string]interface{}{
+			"_id":   "org.couchdb.user:bob",
+			"name":  "bob",
+			"type":  "user",
+			"roles": []interface{}{},
+		}
+	}
+	tests := []struct {
+		name   string
+		newDoc func() map[string]interface{}
+		oldDoc map[string]interface{}
+		user   *authdb.UserContext
+		status int
+	}{
+		{
+			name:   "Valid",
+			newDoc: newBob,
+			user:   admin,
+		},
+		{
+			name:   "NoUser",
+			newDoc: newBob,
+		},
+		{
+			name: "WrongType",
+			newDoc: func() map[string]interface{} {
+				doc := newBob()
+				doc["type"] = "admin"
+				return doc
+			},
+			status: kivik.StatusForbidden,
+		},
+		{
+			name: "WrongID",
+			newDoc: func() map[string]interface{} {
+				doc := newBob()
+				doc["_id"] = "bob"
+				return doc
+			},
+			status: kivik.StatusForbidden,
+		},
+		{
+			name: "InvalidRoles",
+			newDoc: func() map[string]interface{} {
+				doc := newBob()
+				doc["roles"] = []interface{}{1}
+				return doc
+			},
+			status: kivik.StatusForbidden,
+		},
+		{
+			name:   "OwnDoc",
+			newDoc: newBob,
+			oldDoc: newBob(),
+			user:   bob,
+		},
+		{
+			name:   "OtherUser",
+			newDoc: newBob,
+			user:   &authdb.UserContext{Name: "alice"},
+			status: kivik.StatusForbidden,
+		},
+		{
+			name: "OwnRoles",
+			newDoc: func() map[string]interface{} {
+				doc := newBob()
+				doc["roles"] = []interface{}{"boss"}
+				return doc
+			},
+			oldDoc: newBob(),
+			user:   bob,
+			status: kivik.StatusForbidden,
+		},
+		{
+			name: "DesignDoc",
+			newDoc: func() map[string]interface{} {
+				return map[string]interface{}{"_id": "_design/_auth"}
+			},
+			user:   bob,
+			status: kivik.StatusForbidden,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			err := validateUser(test.newDoc(), test.oldDoc, test.user)
+			if status := errors.StatusCode(err); status != test.status {
+				t.Errorf("Unexpected status %d: %v", status, err)
+			}
+		})
+	}
+}
+
+func TestValidateReplication(t *testing.T) {
+	bob := &authdb.UserContext{Name: "bob"}
+	tests := []struct {
+		name   string
+		newDoc map[string]interface{}
+		oldDoc map[string]interface{}
+		user   *authdb.UserContext
+		status int
+	}{
+		{
+			name: "Valid",
+			newDoc: map[string]interface{}{
+				"source": "foo",
+				"target": map[string]interface{}{"url": "http://example.com/bar"},
+			},
+		},
+		{
+			name:   "NoTarget",
+			newDoc: map[string]interface{}{"source": "foo"},
+			status: kivik.StatusForbidden,
+		},
+		{
+			name: "ReservedField",
+			newDoc: map[string]interface{}{
+				"source":             "foo",
+				"target":             "bar",
+				"_replication_state": "completed",
+			},
+			status: kivik.StatusForbidden,
+		},
+		{
+			name: "OwnReplication",
+			newDoc: map[string]interface{}{
+				"source":   "foo",
+				"target":   "bar",
+				"user_ctx": map[string]interface{}{"name": "bob"},
+			},
+			user: bob,
+		},
+		{
+			name: "OtherUser",
+			newDoc: map[string]interface{}{
+				"source":   "foo",
+				"target":   "bar",
+				"user_ctx": map[string]interface{}{"name": "alice"},
+			},
+			user:   bob,
+			status: kivik.StatusForbidden,
+		},
+		{
+			name:   "DeleteOtherUser",
+			newDoc: map[string]interface{}{"_deleted": true},
+			oldDoc: map[string]interface{}{
+				"user_ctx": map[string]interface{}{"name": "alice"},
+			},
+			user:   bob,
+			status: kivik.StatusForbidden,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			err := validateReplication(test.newDoc, test.oldDoc, test.user)
+			if status := errors.StatusCode(err); status != test.status {
+				t.Errorf("Unexpected status %d: %v", status, err)
+			}
+		})
+	}
+}
+
+func TestUsersDB(t *testing.T) {
+	ctx := context.Background()
+	client, err := kivik.New(ctx, "memory", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	users, err := client.DB(ctx, UsersDB)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = users.Put(ctx, "org.couchdb.user:bob", map[string]interface{}{
+		"name":     "bob",
+		"type":     "user",
+		"roles":    []string{"boss"},
+		"password": "abc123",
+	}); err != nil {
+		t.Fatal(err)
+	}
+	row, err := users.Get(ctx, "org.couchdb.user:bob")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var doc map[string]interface{}
+	if err = row.ScanDoc(&doc); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := doc["password"]; ok {
+		t.Errorf("Expected the password to be hashed")
+	}
+	store := usersdb.New(users)
+	if _, err = store.Validate(ctx, "bob", "wrong"); kivik.StatusCode(err) != kivik.StatusUnauthorized {
+		t.Errorf("Expected status %d for a wrong password, got %v", kivik.StatusUnauthorized, err)
+	}
+	user, err := store.Validate(ctx, "bob", "abc123")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if user.Name != "bob" || len(user.Roles) != 1 || user.Roles[0] != "boss" {
+		t.Errorf("Unexpected user: %v", user)
+	}
+}
@@ -9,8 +9,7 @@ import (
 
 	"github.com/flimzy/kivik/driver"
 	"github.com/flimzy/kivik/driver/pouchdb/bindings"
-	"github.com/gopherjs/gopherjs/js"
-	"github.com/gopherjs/jsbuiltin"
+	"github.com/flimzy/kivik/driver/pouchdb/jsval"
 )
 
 func (d *db) PutAttachment(ctx context.Context, docID, rev, filename, contentType string, body io.Reader) (newRev string, err error) {
@@ -30,7 +29,7 @@ func (d *db) GetAttachment(ctx context.Context, docID, rev, filename string) (cT
 	return
 }
 
-func (d *db) fetchAttachment(ctx context.Context, docID, rev, filename string) (*js.Object, error) {
+func (d *db) fetchAttachment(ctx context.Context, docID, rev, filename string) (jsval.Value, error) {
 	var opts map[string]interface{}
 	if rev != "" {
 		opts["rev"] = rev
@@ -38,9 +37,9 @@ func (d *db) fetchAttachment(ctx context.Context, docID, rev, filename string) (
 	return d.db.GetAttachment(ctx, docID, filename, opts)
 }
 
-func parseAttachment(att *js.Object) (cType string, content io.ReadCloser, err error) {
+func parseAttachment(att jsval.Value) (cType string, content io.ReadCloser, err error) {
 	defer bindings.RecoverError(&err)
-	if jsbuiltin.TypeOf(att.Get("write")) == "function" {
+	if att.Get("write").IsFunction() {
 		// This looks like a Buffer object; we're in Node.js
 		body := att.Call("toString", "binary").String()
 		// It might make sense to wrap the Buffer itself in an io.Reader interface,
@@ -49,35 +48,37 @@ func parseAttachment(att *js.Object) (cType string, content io.ReadCloser, err e
 		return "", ioutil.NopCloser(strings.NewReader(body)), nil
 	}
 	// We're in the browser
-	return att.Get("type").String(), &blobReader{Object: att}, nil
+	return att.Get("type").String(), &blobReader{Value: att, size: att.Get("size").Int()}, nil
 }
 
 type blobReader struct {
-	*js.Object
+	jsval.Value
 	offset int
-	Size   int `js:"size"`
+	size   int
 }
 
 var _ io.ReadCloser = &blobReader{}
 
 func (b *blobReader) Read(p []byte) (n int, err error) {
 	defer bindings.RecoverError(&err)
-	if b.offset >= b.Size {
+	if b.offset >= b.size {
 		return 0, io.EOF
 	}
 	end := b.offset + len(p) + 1 // end is the first byte not included, not the last byte included, so add 1
-	if end > b.Size {
-		end = b.Size
+	if end > b.size {
+		end = b.size
 	}
 	slice := b.Call("slice", b.offset, end)
-	fileReader := js.Global.Get("FileReader").New()
+	fileReader := jsval.Global().Get("FileReader").New()
 	var wg sync.WaitGroup
 	wg.Add(1)
-	fileReader.Set("onload", js.MakeFunc(func(this *js.Object, _ []*js.Object) interface{} {
+	onload := jsval.FuncOf(func(this jsval.Value, _ []jsval.Value) interface{} {
 		defer wg.Done()
-		n = copy(p, js.Global.Get("Uint8Array").New(this.Get("result")).Interface().([]uint8))
+		n = copy(p, jsval.Global().Get("Uint8Array").New(this.Get("result")).Bytes())
 		return nil
-	}))
+	})
+	defer onload.Release()
+	fileReader.Set("onload", onload)
 	fileReader.Call("readAsArrayBuffer", slice)
 	wg.Wait()
 	b.offset += n
@@ -4,21 +4,19 @@ import (
 	"fmt"
 
 	"github.com/flimzy/kivik"
+	"github.com/flimzy/kivik/driver/pouchdb/jsval"
 	"github.com/flimzy/kivik/errors"
-	"github.com/gopherjs/gopherjs/js"
-	"github.com/gopherjs/jsbuiltin"
 )
 
 type pouchError struct {
-	*js.Object
 	Err     string
 	Message string
 	Status  int
 }
 
 // NewPouchError parses a PouchDB error.
-func NewPouchError(o *js.Object) error {
-	if o == nil || o == js.Undefined {
+func NewPouchError(o jsval.Value) error {
+	if !o.Defined() {
 		return nil
 	}
 	status := o.Get("status").Int()
@@ -28,23 +26,23 @@ func NewPouchError(o *js.Object) error {
 
 	var err, msg string
 	switch {
-	case o.Get("reason") != js.Undefined:
+	case !o.Get("reason").IsUndefined():
 		msg = o.Get("reason").String()
-	case o.Get("message") != js.Undefined:
+	case !o.Get("message").IsUndefined():
 		msg = o.Get("message").String()
 	default:
-		if jsbuiltin.InstanceOf(o, js.Global.Get("Error")) {
+		if o.InstanceOf(jsval.Global().Get("Error")) {
 			return errors.Status(status, o.Get("message").String())
 		}
 	}
 	switch {
-	case o.Get("name") != js.Undefined:
+	case !o.Get("name").IsUndefined():
 		err = o.Get("name").String()
-	case o.Get("error") != js.Undefined:
+	case !o.Get("error").IsUndefined():
 		err = o.Get("error").String()
 	}
 
-	if msg == "" && o.Get("errno") != js.Undefined {
+	if msg == "" && !o.Get("errno").IsUndefined() {
 		switch o.Get("errno").String() {
 		case "ECONNREFUSED":
 			msg = "connection refused"
@@ -71,3 +69,15 @@ func (e *pouchError) Error() string {
 func (e *pouchError) StatusCode() int {
 	return e.Status
 }
+
+func (e *pouchError) ErrorName() string {
+	return e.Err
+}
+
+func (e *pouchError) Reason() string {
+	return e.Message
+}
+
+func (e *pouchError) Is(target error) bool {
+	return errors.MatchStatus(e.Status, target)
+}
@@ -3,9 +3,17 @@ package bindings
 import (
 	"testing"
 
-	"github.com/gopherjs/gopherjs/js"
+	"github.com/flimzy/kivik/driver/pouchdb/jsval"
 )
 
+// reconstitutePouchError parses a JSON-encoded PouchDB error, with Error's
+// prototype, as PouchDB errors inherit from Error.
+func reconstitutePouchError(str string) jsval.Value {
+	obj := jsval.Parse(str)
+	jsval.Global().Get("Object").Call("setPrototypeOf", obj, jsval.Global().Get("Error").Get("prototype"))
+	return obj
+}
+
 type statuser interface {
 	StatusCode() int
 }
@@ -13,20 +21,20 @@ type statuser interface {
 func TestNewPouchError(t *testing.T) {
 	type npeTest struct {
 		Name           string
-		Object         *js.Object
+		Object         jsval.Value
 		ExpectedStatus int
 		Expected       string
 	}
 	tests := []npeTest{
 		{
 			Name:     "Null",
-			Object:   nil,
+			Object:   jsval.Undefined(),
 			Expected: "",
 		},
 		{
 			Name: "NameAndReasonNoStatus",
-			Object: func() *js.Object {
-				o := js.Global.Get("Object").New()
+			Object: func() jsval.Value {
+				o := jsval.Global().Get("Object").New()
 				o.Set("reason", "error reason")
 				o.Set("name", "error name")
 				return o
@@ -36,7 +44,7 @@ func TestNewPouchError(t *testing.T) {
 		},
 		{
 			Name: "ECONNREFUSED",
-			Object: js.Global.Call("ReconstitutePouchError", `{
+			Object: reconstitutePouchError(`{
                 "code":    "ECONNREFUSED",
                 "errno":   "ECONNREFUSED",
                 "syscall": "connect",
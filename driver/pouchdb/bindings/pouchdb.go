@@ -1,5 +1,6 @@
-// Package bindings provides minimal GopherJS bindings around the PouchDB
-// library. (https://pouchdb.com/api.html)
+// Package bindings provides minimal bindings around the PouchDB library, which
+// compile both with GopherJS and for WebAssembly.
+// (https://pouchdb.com/api.html)
 package bindings
 
 import (
@@ -7,41 +8,40 @@ import (
 	"context"
 	"encoding/json"
 	"io"
+	"strings"
 	"time"
 
-	"github.com/gopherjs/gopherjs/js"
-	"github.com/gopherjs/jsbuiltin"
-
 	"github.com/flimzy/kivik"
+	"github.com/flimzy/kivik/driver/pouchdb/jsval"
 	"github.com/flimzy/kivik/errors"
 )
 
 // DB is a PouchDB database object.
 type DB struct {
-	*js.Object
+	jsval.Value
 }
 
 // PouchDB represents a PouchDB constructor.
 type PouchDB struct {
-	*js.Object
+	jsval.Value
 }
 
 // GlobalPouchDB returns the global PouchDB object.
 func GlobalPouchDB() *PouchDB {
-	return &PouchDB{Object: js.Global.Get("PouchDB")}
+	return &PouchDB{Value: jsval.Global().Get("PouchDB")}
 }
 
 // Defaults returns a new PouchDB constructor with the specified default options.
 // See https://pouchdb.com/api.html#defaults
 func Defaults(options map[string]interface{}) *PouchDB {
-	return &PouchDB{Object: js.Global.Get("PouchDB").Call("defaults", options)}
+	return &PouchDB{Value: jsval.Global().Get("PouchDB").Call("defaults", options)}
 }
 
 // New creates a database or opens an existing one.
 //
 // See https://pouchdb.com/api.html#create_database
 func (p *PouchDB) New(dbName string, options map[string]interface{}) *DB {
-	return &DB{Object: p.Object.New(dbName, options)}
+	return &DB{Value: p.Value.New(dbName, options)}
 }
 
 // Version returns the version of the currently running PouchDB library.
@@ -49,6 +49,85 @@ func (p *PouchDB) Version() string {
 	return p.Get("version").String()
 }
 
+// IsNode returns true if running in Node.js, rather than in a browser.
+func IsNode() bool {
+	process := jsval.Global().Get("process")
+	return process.Defined() && process.Get("versions").Defined() &&
+		!process.Get("versions").Get("node").IsUndefined()
+}
+
+// LoadAdapter ensures that the named adapter, such as "leveldb" or "idb", is
+// available. When run in Node.js, an adapter which is not loaded is loaded
+// from its pouchdb-adapter-<name> package. An error with status
+// StatusNotImplemented is returned if the adapter is not available.
+//
+// See https://pouchdb.com/adapters.html
+func (p *PouchDB) LoadAdapter(name string) (err error) {
+	defer RecoverError(&err)
+	if p.hasAdapter(name) {
+		return nil
+	}
+	if IsNode() && jsval.Global().Get("require").IsFunction() {
+		func() {
+			// A missing package is reported as an unavailable adapter below.
+			defer func() {
+				if r := recover(); r != nil {
+					if _, ok := jsval.Thrown(r); !ok {
+						panic(r)
+					}
+				}
+			}()
+			p.Call("plugin", jsval.Global().Call("require", "pouchdb-adapter-"+name))
+		}()
+		if p.hasAdapter(name) {
+			return nil
+		}
+	}
+	return errors.Statusf(kivik.StatusNotImplemented, "kivik: PouchDB adapter '%s' not available", name)
+}
+
+func (p *PouchDB) hasAdapter(name string) bool {
+	adapters := p.Get("adapters")
+	return adapters.Defined() && adapters.Get(name).Defined()
+}
+
+var debugPluginNotLoaded = errors.Status(kivik.StatusNotImplemented, "kivik: pouchdb-debug plugin not loaded")
+
+func (p *PouchDB) debug() (jsval.Value, error) {
+	debug := p.Get("debug")
+	if debug.IsUndefined() || !debug.Get("enable").IsFunction() {
+		return jsval.Value{}, debugPluginNotLoaded
+	}
+	return debug, nil
+}
+
+// DebugEnable enables PouchDB's debug logging for the namespaces, a
+// comma-separated list which may include wildcards, such as "*" or
+// "pouchdb:http". A NotImplemented error is returned if the pouchdb-debug
+// plugin is not loaded.
+//
+// See https://pouchdb.com/api.html#debug_mode
+func (p *PouchDB) DebugEnable(namespaces string) (err error) {
+	defer RecoverError(&err)
+	debug, err := p.debug()
+	if err != nil {
+		return err
+	}
+	debug.Call("enable", namespaces)
+	return nil
+}
+
+// DebugDisable disables PouchDB's debug logging.
+func (p *PouchDB) DebugDisable() (err error) {
+	defer RecoverError(&err)
+	debug, err := p.debug()
+	if err != nil {
+		return err
+	}
+	debug.Call("disable")
+	return nil
+}
+
 func setTimeout(ctx context.Context, options map[string]interface{}) map[string]interface{} {
 	if ctx == nil { // Just to be safe
 		return options
@@ -69,41 +148,60 @@ func setTimeout(ctx context.Context, options map[string]interface{}) map[string]
 }
 
 type caller interface {
-	Call(string, ...interface{}) *js.Object
+	Call(string, ...interface{}) jsval.Value
 }
 
 // callBack executes the 'method' of 'o' as a callback, setting result to the
 // callback's return value. An error is returned if either the callback returns
 // an error, or if the context is cancelled. No attempt is made to abort the
 // callback in the case that the context is cancelled.
-func callBack(ctx context.Context, o caller, method string, args ...interface{}) (r *js.Object, e error) {
+func callBack(ctx context.Context, o caller, method string, args ...interface{}) (r jsval.Value, e error) {
 	defer RecoverError(&e)
-	resultCh := make(chan *js.Object)
+	// The channel is buffered, so that the callbacks, which are run from
+	// JavaScript's event loop, never block.
+	resultCh := make(chan jsval.Value, 1)
 	var err error
-	o.Call(method, args...).Call("then", func(r *js.Object) {
-		resultCh <- r
-	}).Call("catch", func(e *js.Object) {
-		err = NewPouchError(e)
+	var then, catch jsval.Func
+	then = jsval.FuncOf(func(_ jsval.Value, args []jsval.Value) interface{} {
+		then.Release()
+		catch.Release()
+		resultCh <- arg(args)
+		return nil
+	})
+	catch = jsval.FuncOf(func(_ jsval.Value, args []jsval.Value) interface{} {
+		then.Release()
+		catch.Release()
+		err = NewPouchError(arg(args))
 		close(resultCh)
+		return nil
 	})
+	o.Call(method, args...).Call("then", then).Call("catch", catch)
 	select {
 	case <-ctx.Done():
-		return nil, ctx.Err()
+		return jsval.Value{}, ctx.Err()
 	case result := <-resultCh:
 		return result, err
 	}
 }
 
+// arg returns the first of args, or undefined.
+func arg(args []jsval.Value) jsval.Value {
+	if len(args) == 0 {
+		return jsval.Undefined()
+	}
+	return args[0]
+}
+
 // AllDBs returns the list of all existing (undeleted) databases.
 func (p *PouchDB) AllDBs(ctx context.Context) ([]string, error) {
-	if jsbuiltin.TypeOf(p.Get("allDbs")) != "function" {
+	if !p.Get("allDbs").IsFunction() {
 		return nil, errors.New("pouchdb-all-dbs plugin not loaded")
 	}
 	result, err := callBack(ctx, p, "allDbs")
 	if err != nil {
 		return nil, err
 	}
-	if result == js.Undefined {
+	if result.IsUndefined() {
 		return nil, nil
 	}
 	allDBs := make([]string, result.Length())
@@ -113,18 +211,52 @@ func (p *PouchDB) AllDBs(ctx context.Context) ([]string, error) {
 	return allDBs, nil
 }
 
+// StorageEstimate is the estimate of the storage used by, and available to,
+// the origin, as returned by the browser's navigator.storage.estimate().
+type StorageEstimate struct {
+	Usage int64
+	Quota int64
+}
+
+// EstimateStorage returns the browser's estimate of the storage used by, and
+// available to, the origin. An error with status StatusNotImplemented is
+// returned if the StorageManager API is not available, as in Node.js.
+//
+// See https://developer.mozilla.org/en-US/docs/Web/API/StorageManager/estimate
+func EstimateStorage(ctx context.Context) (*StorageEstimate, error) {
+	navigator := jsval.Global().Get("navigator")
+	if navigator.IsUndefined() || navigator.Get("storage").IsUndefined() ||
+		!navigator.Get("storage").Get("estimate").IsFunction() {
+		return nil, errors.Status(kivik.StatusNotImplemented, "kivik: storage estimates not supported")
+	}
+	result, err := callBack(ctx, navigator.Get("storage"), "estimate")
+	if err != nil {
+		return nil, err
+	}
+	return &StorageEstimate{
+		Usage: result.Get("usage").Int64(),
+		Quota: result.Get("quota").Int64(),
+	}, nil
+}
+
 // DBInfo is a struct respresenting information about a specific database.
 type DBInfo struct {
-	*js.Object
-	Name      string `js:"db_name"`
-	DocCount  int64  `js:"doc_count"`
-	UpdateSeq string `js:"update_seq"`
+	Name      string
+	DocCount  int64
+	UpdateSeq string
 }
 
 // Info returns info about the database.
 func (db *DB) Info(ctx context.Context) (*DBInfo, error) {
 	result, err := callBack(ctx, db, "info")
-	return &DBInfo{Object: result}, err
+	if err != nil {
+		return &DBInfo{}, err
+	}
+	return &DBInfo{
+		Name:      result.Get("db_name").String(),
+		DocCount:  result.Get("doc_count").Int64(),
+		UpdateSeq: result.Get("update_seq").String(),
+	}, nil
 }
 
 // Put creates a new document or update an existing document.
@@ -154,8 +286,7 @@ func (db *DB) Get(ctx context.Context, docID string, opts map[string]interface{}
 	if err != nil {
 		return nil, err
 	}
-	resultJSON := js.Global.Get("JSON").Call("stringify", result).String()
-	return []byte(resultJSON), err
+	return []byte(jsval.Stringify(result)), err
 }
 
 // Delete marks a document as deleted.
@@ -175,15 +306,60 @@ func (db *DB) Destroy(ctx context.Context, options map[string]interface{}) error
 }
 
 // AllDocs returns a list of all documents in the database.
-func (db *DB) AllDocs(ctx context.Context, options map[string]interface{}) (*js.Object, error) {
+func (db *DB) AllDocs(ctx context.Context, options map[string]interface{}) (jsval.Value, error) {
 	return callBack(ctx, db, "allDocs", setTimeout(ctx, options))
 }
 
 // Query queries a map/reduce function.
-func (db *DB) Query(ctx context.Context, ddoc, view string, options map[string]interface{}) (*js.Object, error) {
+func (db *DB) Query(ctx context.Context, ddoc, view string, options map[string]interface{}) (jsval.Value, error) {
 	return callBack(ctx, db, "query", ddoc+"/"+view, setTimeout(ctx, options))
 }
 
+// QueryTemp queries a temporary view, defined by the JavaScript source of a
+// map function, and optionally of a reduce function, or the name of a built-in
+// reduce function, such as _count.
+//
+// See https://pouchdb.com/api.html#query_database
+func (db *DB) QueryTemp(ctx context.Context, mapSrc, reduceSrc string, options map[string]interface{}) (jsval.Value, error) {
+	mapFn, err := Function(mapSrc)
+	if err != nil {
+		return jsval.Value{}, err
+	}
+	view := jsval.Global().Get("Object").New()
+	view.Set("map", mapFn)
+	switch {
+	case reduceSrc == "":
+	case strings.HasPrefix(reduceSrc, "_"):
+		view.Set("reduce", reduceSrc)
+	default:
+		reduceFn, err := Function(reduceSrc)
+		if err != nil {
+			return jsval.Value{}, err
+		}
+		view.Set("reduce", reduceFn)
+	}
+	return callBack(ctx, db, "query", view, setTimeout(ctx, options))
+}
+
+// Function evaluates the JavaScript source of a function, such as
+// "function(doc) { emit(doc._id); }". An error with status StatusBadRequest is
+// returned if src is not a valid function.
+func Function(src string) (fn jsval.Value, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			if thrown, ok := jsval.Thrown(r); ok {
+				r = thrown.String()
+			}
+			err = errors.Statusf(kivik.StatusBadRequest, "invalid function: %v", r)
+		}
+	}()
+	fn = jsval.Global().Call("eval", "("+src+")")
+	if !fn.IsFunction() {
+		return jsval.Value{}, errors.Status(kivik.StatusBadRequest, "invalid function: not a function")
+	}
+	return fn, nil
+}
+
 var findPluginNotLoaded = errors.Status(kivik.StatusNotImplemented, "kivik: pouchdb-find plugin not loaded")
 
 // Find executes a MongoDB-style find query with the pouchdb-find plugin, if it
@@ -191,13 +367,13 @@ var findPluginNotLoaded = errors.Status(kivik.StatusNotImplemented, "kivik: pouc
 // returned.
 //
 // See https://github.com/pouchdb/pouchdb/tree/master/packages/node_modules/pouchdb-find#dbfindrequest--callback
-func (db *DB) Find(ctx context.Context, query interface{}) (*js.Object, error) {
-	if jsbuiltin.TypeOf(db.Object.Get("find")) != jsbuiltin.TypeFunction {
-		return nil, findPluginNotLoaded
+func (db *DB) Find(ctx context.Context, query interface{}) (jsval.Value, error) {
+	if !db.Value.Get("find").IsFunction() {
+		return jsval.Value{}, findPluginNotLoaded
 	}
 	queryObj, err := Objectify(query)
 	if err != nil {
-		return nil, err
+		return jsval.Value{}, err
 	}
 	return callBack(ctx, db, "find", queryObj)
 }
@@ -235,19 +411,17 @@ func (db *DB) ViewCleanup() error {
 	return err
 }
 
-var jsJSON = js.Global.Get("JSON")
-
 // BulkDocs creates, updates, or deletes docs in bulk.
 // See https://pouchdb.com/api.html#batch_create
-func (db *DB) BulkDocs(ctx context.Context, docs ...interface{}) (result *js.Object, err error) {
+func (db *DB) BulkDocs(ctx context.Context, docs ...interface{}) (result jsval.Value, err error) {
 	defer RecoverError(&err)
-	jsDocs := make([]*js.Object, len(docs))
+	jsDocs := make([]jsval.Value, len(docs))
 	for i, doc := range docs {
 		jsonDoc, err := json.Marshal(doc)
 		if err != nil {
-			return nil, err
+			return jsval.Value{}, err
 		}
-		jsDocs[i] = jsJSON.Call("parse", string(jsonDoc))
+		jsDocs[i] = jsval.Parse(string(jsonDoc))
 	}
 	return callBack(ctx, db, "bulkDocs", jsDocs, setTimeout(ctx, nil))
 }
@@ -255,7 +429,7 @@ func (db *DB) BulkDocs(ctx context.Context, docs ...interface{}) (result *js.Obj
 // Changes returns an event emitter object.
 //
 // See https://pouchdb.com/api.html#changes
-func (db *DB) Changes(ctx context.Context, options map[string]interface{}) (changes *js.Object, e error) {
+func (db *DB) Changes(ctx context.Context, options map[string]interface{}) (changes jsval.Value, e error) {
 	defer RecoverError(&e)
 	return db.Call("changes", setTimeout(ctx, options)), nil
 }
@@ -263,10 +437,10 @@ func (db *DB) Changes(ctx context.Context, options map[string]interface{}) (chan
 // PutAttachment attaches a binary object to a document.
 //
 // See https://pouchdb.com/api.html#save_attachment
-func (db *DB) PutAttachment(ctx context.Context, docID, filename, rev string, body io.Reader, ctype string) (*js.Object, error) {
+func (db *DB) PutAttachment(ctx context.Context, docID, filename, rev string, body io.Reader, ctype string) (jsval.Value, error) {
 	att, err := attachmentObject(ctype, body)
 	if err != nil {
-		return nil, err
+		return jsval.Value{}, err
 	}
 	if rev == "" {
 		return callBack(ctx, db, "putAttachment", docID, filename, att, ctype)
@@ -276,33 +450,35 @@ func (db *DB) PutAttachment(ctx context.Context, docID, filename, rev string, bo
 
 // attachmentObject converts an io.Reader to a JavaScript Buffer in node, or
 // a Blob in the browser
-func attachmentObject(contentType string, content io.Reader) (att *js.Object, err error) {
-	RecoverError(&err)
+func attachmentObject(contentType string, content io.Reader) (att jsval.Value, err error) {
+	defer RecoverError(&err)
 	buf := new(bytes.Buffer)
-	buf.ReadFrom(content)
-	if buffer := js.Global.Get("Buffer"); jsbuiltin.TypeOf(buffer) == "function" {
+	if _, err := buf.ReadFrom(content); err != nil {
+		return jsval.Value{}, err
+	}
+	if buffer := jsval.Global().Get("Buffer"); buffer.IsFunction() {
 		// The Buffer type is supported, so we'll use that
-		return buffer.New(buf.String()), nil
+		return buffer.Call("from", buf.Bytes()), nil
 	}
-	if js.Global.Get("Blob") != js.Undefined {
+	if blob := jsval.Global().Get("Blob"); !blob.IsUndefined() {
 		// We have Blob support, must be in a browser
-		return js.Global.Get("Blob").New([]interface{}{buf.Bytes()}, map[string]string{"type": contentType}), nil
+		return blob.New([]interface{}{buf.Bytes()}, map[string]string{"type": contentType}), nil
 	}
 	// Not sure what to do
-	return nil, errors.New("No Blob or Buffer support?!?")
+	return jsval.Value{}, errors.New("No Blob or Buffer support?!?")
 }
 
 // GetAttachment returns attachment data.
 //
 // See https://pouchdb.com/api.html#get_attachment
-func (db *DB) GetAttachment(ctx context.Context, docID, filename string, options map[string]interface{}) (*js.Object, error) {
+func (db *DB) GetAttachment(ctx context.Context, docID, filename string, options map[string]interface{}) (jsval.Value, error) {
 	return callBack(ctx, db, "getAttachment", docID, filename, setTimeout(ctx, options))
 }
 
 // RemoveAttachment deletes an attachment from a document.
 //
 // See https://pouchdb.com/api.html#delete_attachment
-func (db *DB) RemoveAttachment(ctx context.Context, docID, filename, rev string) (*js.Object, error) {
+func (db *DB) RemoveAttachment(ctx context.Context, docID, filename, rev string) (jsval.Value, error) {
 	return callBack(ctx, db, "removeAttachment", docID, filename, rev)
 }
 
@@ -311,9 +487,9 @@ func (db *DB) RemoveAttachment(ctx context.Context, docID, filename, rev string)
 // NotImplemented error will be returned.
 //
 // See https://github.com/pouchdb/pouchdb/tree/master/packages/node_modules/pouchdb-find#dbcreateindexindex--callback
-func (db *DB) CreateIndex(ctx context.Context, index interface{}) (*js.Object, error) {
-	if jsbuiltin.TypeOf(db.Object.Get("find")) != jsbuiltin.TypeFunction {
-		return nil, findPluginNotLoaded
+func (db *DB) CreateIndex(ctx context.Context, index interface{}) (jsval.Value, error) {
+	if !db.Value.Get("find").IsFunction() {
+		return jsval.Value{}, findPluginNotLoaded
 	}
 	return callBack(ctx, db, "createIndex", index)
 }
@@ -321,9 +497,9 @@ func (db *DB) CreateIndex(ctx context.Context, index interface{}) (*js.Object, e
 // GetIndexes returns the list of currently defined indexes on the database.
 //
 // See https://github.com/pouchdb/pouchdb/tree/master/packages/node_modules/pouchdb-find#dbgetindexescallback
-func (db *DB) GetIndexes(ctx context.Context) (*js.Object, error) {
-	if jsbuiltin.TypeOf(db.Object.Get("find")) != jsbuiltin.TypeFunction {
-		return nil, findPluginNotLoaded
+func (db *DB) GetIndexes(ctx context.Context) (jsval.Value, error) {
+	if !db.Value.Get("find").IsFunction() {
+		return jsval.Value{}, findPluginNotLoaded
 	}
 	return callBack(ctx, db, "getIndexes")
 }
@@ -333,9 +509,9 @@ func (db *DB) GetIndexes(ctx context.Context) (*js.Object, error) {
 // NotImplemeneted error will be returned.
 //
 // See: https://github.com/pouchdb/pouchdb/tree/master/packages/node_modules/pouchdb-find#dbdeleteindexindex--callback
-func (db *DB) DeleteIndex(ctx context.Context, index interface{}) (*js.Object, error) {
-	if jsbuiltin.TypeOf(db.Object.Get("find")) != jsbuiltin.TypeFunction {
-		return nil, findPluginNotLoaded
+func (db *DB) DeleteIndex(ctx context.Context, index interface{}) (jsval.Value, error) {
+	if !db.Value.Get("find").IsFunction() {
+		return jsval.Value{}, findPluginNotLoaded
 	}
 	return callBack(ctx, db, "deleteIndex", index)
 }
@@ -352,7 +528,7 @@ const (
 
 // Replicate initiates a replication.
 // See https://pouchdb.com/api.html#replication
-func (p *PouchDB) Replicate(source, target interface{}, options map[string]interface{}) (result *js.Object, err error) {
+func (p *PouchDB) Replicate(source, target interface{}, options map[string]interface{}) (result jsval.Value, err error) {
 	defer RecoverError(&err)
 	return p.Call("replicate", source, target, options), nil
 }
@@ -0,0 +1,44 @@
+// +build js,wasm
+
+package bindings
+
+import (
+	"github.com/flimzy/kivik/driver/pouchdb/jsval"
+)
+
+// init does for WebAssembly what pouchdb.inc.js does for GopherJS: when run
+// in Node.js, it loads PouchDB and its plugins, if they are not loaded
+// already.
+func init() {
+	global := jsval.Global()
+	require := global.Get("require")
+	if !require.IsFunction() {
+		if global.Get("PouchDB").IsUndefined() {
+			panic(noPouchDB)
+		}
+		return
+	}
+	if global.Get("PouchDB").IsUndefined() &&
+		!try(func() { global.Set("PouchDB", require.Invoke("pouchdb")) }) {
+		panic(noPouchDB)
+	}
+	try(func() { require.Invoke("pouchdb-all-dbs").Invoke(global.Get("PouchDB")) })
+	try(func() { global.Get("PouchDB").Call("plugin", require.Invoke("pouchdb-find")) })
+	try(func() { global.Set("XMLHttpRequest", require.Invoke("xhr2")) })
+}
+
+const noPouchDB = "kivik: pouchdb bindings: Cannot find global PouchDB object. Did you load the PouchDB library?"
+
+// try calls fn, and returns false if it throws a JavaScript exception.
+func try(fn func()) (ok bool) {
+	defer func() {
+		if r := recover(); r != nil {
+			if _, thrown := jsval.Thrown(r); !thrown {
+				panic(r)
+			}
+			ok = false
+		}
+	}()
+	fn()
+	return true
+}
@@ -3,7 +3,7 @@ package bindings
 import (
 	"fmt"
 
-	"github.com/gopherjs/gopherjs/js"
+	"github.com/flimzy/kivik/driver/pouchdb/jsval"
 )
 
 // RecoverError recovers from a thrown JS error. If an error is caught, err
@@ -14,9 +14,11 @@ import (
 //     defer RecoverError(&err)
 func RecoverError(err *error) {
 	if r := recover(); r != nil {
+		if thrown, ok := jsval.Thrown(r); ok {
+			*err = NewPouchError(thrown)
+			return
+		}
 		switch r.(type) {
-		case *js.Object:
-			*err = NewPouchError(r.(*js.Object))
 		case error:
 			// This shouldn't ever happen, but just in case
 			*err = r.(error)
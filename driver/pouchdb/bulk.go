@@ -6,23 +6,12 @@ import (
 	"io"
 
 	"github.com/flimzy/kivik/driver"
+	"github.com/flimzy/kivik/driver/pouchdb/jsval"
 	"github.com/flimzy/kivik/errors"
-	"github.com/gopherjs/gopherjs/js"
 )
 
-type bulkResult struct {
-	*js.Object
-	OK         bool   `js:"ok"`
-	ID         string `js:"id"`
-	Rev        string `js:"rev"`
-	Error      string `js:"name"`
-	StatusCode int    `js:"status"`
-	Reason     string `js:"message"`
-	IsError    bool   `js:"error"`
-}
-
 type bulkResults struct {
-	results *js.Object
+	results jsval.Value
 }
 
 var _ driver.BulkResults = &bulkResults{}
@@ -37,22 +26,21 @@ func (r *bulkResults) Next(update *driver.BulkResult) (err error) {
 			}
 		}
 	}()
-	if r.results == js.Undefined || r.results.Length() == 0 {
+	if !r.results.Defined() || r.results.Length() == 0 {
 		return io.EOF
 	}
-	result := &bulkResult{}
-	result.Object = r.results.Call("shift")
-	update.ID = result.ID
-	update.Rev = result.ID
+	result := r.results.Call("shift")
+	update.ID = result.Get("id").String()
+	update.Rev = result.Get("rev").String()
 	update.Error = nil
-	if result.IsError {
-		update.Error = errors.Status(result.StatusCode, result.Reason)
+	if result.Get("error").Bool() {
+		update.Error = errors.Status(result.Get("status").Int(), result.Get("message").String())
 	}
 	return nil
 }
 
 func (r *bulkResults) Close() error {
-	r.results = nil // Free up memory used by any remaining rows
+	r.results = jsval.Value{} // Free up memory used by any remaining rows
 	return nil
 }
 
@@ -8,37 +8,35 @@ import (
 
 	"github.com/flimzy/kivik/driver"
 	"github.com/flimzy/kivik/driver/pouchdb/bindings"
-	"github.com/gopherjs/gopherjs/js"
+	"github.com/flimzy/kivik/driver/pouchdb/jsval"
 	"github.com/imdario/mergo"
 )
 
 type changesFeed struct {
-	changes *js.Object
+	ctx     context.Context
+	changes jsval.Value
 	feed    <-chan *driver.Change
 	err     error
+	// funcs are the event handlers, released when the feed is closed.
+	funcs []jsval.Func
 }
 
 var _ driver.Changes = &changesFeed{}
 
-type changeRow struct {
-	*js.Object
-	ID      string     `js:"id"`
-	Seq     string     `js:"seq"`
-	Changes *js.Object `js:"changes"`
-	Doc     *js.Object `js:"doc"`
-	Deleted bool       `js:"deleted"`
-}
-
 func (c *changesFeed) Next(row *driver.Change) error {
 	if c.err != nil {
 		return c.err
 	}
-	newRow, ok := <-c.feed
-	if !ok {
-		return io.EOF
+	select {
+	case <-c.ctx.Done():
+		return c.ctx.Err()
+	case newRow, ok := <-c.feed:
+		if !ok {
+			return io.EOF
+		}
+		*row = *newRow
+		return nil
 	}
-	*row = *newRow
-	return nil
 }
 
 func (c *changesFeed) Close() error {
@@ -46,6 +44,28 @@ func (c *changesFeed) Close() error {
 	return nil
 }
 
+// on registers an event handler.
+func (c *changesFeed) on(event string, fn func(info jsval.Value)) {
+	f := jsval.FuncOf(func(_ jsval.Value, args []jsval.Value) interface{} {
+		info := jsval.Undefined()
+		if len(args) > 0 {
+			info = args[0]
+		}
+		fn(info)
+		return nil
+	})
+	c.funcs = append(c.funcs, f)
+	c.changes.Call("on", event, f)
+}
+
+// release releases the event handlers, once the feed has ended.
+func (c *changesFeed) release() {
+	for _, f := range c.funcs {
+		f.Release()
+	}
+	c.funcs = nil
+}
+
 func (d *db) Changes(ctx context.Context, options map[string]interface{}) (driver.Changes, error) {
 	opts := map[string]interface{}{
 		"live":    true,
@@ -61,11 +81,12 @@ func (d *db) Changes(ctx context.Context, options map[string]interface{}) (drive
 
 	feed := make(chan *driver.Change, 32)
 	c := &changesFeed{
+		ctx:     ctx,
 		changes: changes,
 		feed:    feed,
 	}
 
-	changes.Call("on", "change", func(change *changeRow) {
+	c.on("change", func(change jsval.Value) {
 		go func() {
 			defer func() {
 				if r := recover(); r != nil {
@@ -77,28 +98,34 @@ func (d *db) Changes(ctx context.Context, options map[string]interface{}) (drive
 					}
 				}
 			}()
-			changedRevs := make([]string, 0, change.Changes.Length())
-			for i := 0; i < change.Changes.Length(); i++ {
-				changedRevs = append(changedRevs, change.Changes.Index(i).Get("rev").String())
+			changes := change.Get("changes")
+			changedRevs := make([]string, 0, changes.Length())
+			for i := 0; i < changes.Length(); i++ {
+				changedRevs = append(changedRevs, changes.Index(i).Get("rev").String())
 			}
 			var doc json.RawMessage
-			if change.Doc != js.Undefined {
-				doc = json.RawMessage(js.Global.Get("JSON").Call("stringify", change.Doc).String())
+			if d := change.Get("doc"); !d.IsUndefined() {
+				doc = json.RawMessage(jsval.Stringify(d))
 			}
 			row := &driver.Change{
-				ID:      change.ID,
-				Seq:     driver.SequenceID(change.Seq),
-				Deleted: change.Deleted,
+				ID:      change.Get("id").String(),
+				Seq:     driver.SequenceID(change.Get("seq").String()),
+				Deleted: change.Get("deleted").Bool(),
 				Doc:     doc,
 				Changes: changedRevs,
 			}
-			feed <- row
+			select {
+			case feed <- row:
+			case <-ctx.Done():
+				// The feed is no longer being read
+			}
 		}()
 	})
-	changes.Call("on", "complete", func(info *js.Object) {
+	c.on("complete", func(_ jsval.Value) {
+		c.release()
 		close(feed)
 	})
-	changes.Call("on", "error", func(e *js.Object) {
+	c.on("error", func(e jsval.Value) {
 		c.err = bindings.NewPouchError(e)
 	})
 	return c, nil
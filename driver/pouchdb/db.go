@@ -9,8 +9,8 @@ import (
 	"github.com/flimzy/kivik"
 	"github.com/flimzy/kivik/driver"
 	"github.com/flimzy/kivik/driver/pouchdb/bindings"
+	"github.com/flimzy/kivik/driver/pouchdb/jsval"
 	"github.com/flimzy/kivik/errors"
-	"github.com/gopherjs/gopherjs/js"
 )
 
 type db struct {
@@ -29,17 +29,7 @@ func (d *db) AllDocs(ctx context.Context, options map[string]interface{}) (drive
 		return nil, err
 	}
 	return &rows{
-		Object: result,
-	}, nil
-}
-
-func (d *db) Query(ctx context.Context, ddoc, view string, options map[string]interface{}) (driver.Rows, error) {
-	result, err := d.db.Query(ctx, ddoc, view, options)
-	if err != nil {
-		return nil, err
-	}
-	return &rows{
-		Object: result,
+		Value: result,
 	}, nil
 }
 
@@ -52,7 +42,7 @@ func (d *db) CreateDoc(ctx context.Context, doc interface{}) (docID, rev string,
 	if err != nil {
 		return "", "", err
 	}
-	jsDoc := js.Global.Get("JSON").Call("parse", string(jsonDoc))
+	jsDoc := jsval.Parse(string(jsonDoc))
 	return d.db.Post(ctx, jsDoc)
 }
 
@@ -61,8 +51,8 @@ func (d *db) Put(ctx context.Context, docID string, doc interface{}) (rev string
 	if err != nil {
 		return "", err
 	}
-	jsDoc := js.Global.Get("JSON").Call("parse", string(jsonDoc))
-	if id := jsDoc.Get("_id"); id != js.Undefined {
+	jsDoc := jsval.Parse(string(jsonDoc))
+	if id := jsDoc.Get("_id"); !id.IsUndefined() {
 		if id.String() != docID {
 			return "", errors.Status(kivik.StatusBadRequest, "id argument must match _id field in document")
 		}
@@ -5,14 +5,14 @@ import (
 	"testing"
 
 	"github.com/flimzy/kivik"
+	"github.com/flimzy/kivik/driver/pouchdb/jsval"
 	"github.com/flimzy/kivik/errors"
 	"github.com/flimzy/kivik/test/kt"
-	"github.com/gopherjs/gopherjs/js"
 )
 
 func init() {
-	js.Global.Get("PouchDB").Call("defaults", map[string]interface{}{
-		"db": js.Global.Call("require", "memdown"),
+	jsval.Global().Get("PouchDB").Call("defaults", map[string]interface{}{
+		"db": jsval.Global().Call("require", "memdown"),
 	})
 }
 
@@ -0,0 +1,25 @@
+package pouchdb
+
+import (
+	"strings"
+
+	"github.com/flimzy/kivik/driver/pouchdb/bindings"
+)
+
+// EnableDebug enables PouchDB's debug logging, which is written to the
+// console, for the named namespaces, such as "pouchdb:api" or "pouchdb:http".
+// With no namespaces, all of PouchDB's logging is enabled. An error with
+// status StatusNotImplemented is returned if the pouchdb-debug plugin, which
+// is included in the browser build of PouchDB, is not loaded.
+func EnableDebug(namespaces ...string) error {
+	ns := strings.Join(namespaces, ",")
+	if ns == "" {
+		ns = "*"
+	}
+	return bindings.GlobalPouchDB().DebugEnable(ns)
+}
+
+// DisableDebug disables PouchDB's debug logging.
+func DisableDebug() error {
+	return bindings.GlobalPouchDB().DebugDisable()
+}
@@ -6,11 +6,10 @@ import (
 	"io"
 	"strings"
 
-	"github.com/gopherjs/gopherjs/js"
-
 	"github.com/flimzy/kivik"
 	"github.com/flimzy/kivik/driver"
 	"github.com/flimzy/kivik/driver/pouchdb/bindings"
+	"github.com/flimzy/kivik/driver/pouchdb/jsval"
 	"github.com/flimzy/kivik/errors"
 )
 
@@ -18,12 +17,12 @@ var _ driver.Finder = &db{}
 
 // buildIndex merges the ddoc and name into the index structure, as reqiured
 // by the PouchDB-find plugin.
-func buildIndex(ddoc, name string, index interface{}) (*js.Object, error) {
+func buildIndex(ddoc, name string, index interface{}) (jsval.Value, error) {
 	i, err := bindings.Objectify(index)
 	if err != nil {
-		return nil, err
+		return jsval.Value{}, err
 	}
-	o := js.Global.Get("Object").New(i)
+	o := jsval.Global().Get("Object").New(i)
 	if ddoc != "" {
 		o.Set("ddoc", ddoc)
 	}
@@ -52,7 +51,7 @@ func (d *db) GetIndexes(ctx context.Context) (indexes []driver.Index, err error)
 	var final struct {
 		Indexes []driver.Index `json:"indexes"`
 	}
-	err = json.Unmarshal([]byte(js.Global.Get("JSON").Call("stringify", result).String()), &final)
+	err = json.Unmarshal([]byte(jsval.Stringify(result)), &final)
 	return final.Indexes, err
 }
 
@@ -94,12 +93,12 @@ func (d *db) Find(ctx context.Context, query interface{}) (driver.Rows, error) {
 		return nil, err
 	}
 	return &findRows{
-		Object: result,
+		Value: result,
 	}, nil
 }
 
 type findRows struct {
-	*js.Object
+	jsval.Value
 }
 
 var _ driver.Rows = &findRows{}
@@ -108,7 +107,7 @@ func (r *findRows) Offset() int64     { return 0 }
 func (r *findRows) TotalRows() int64  { return 0 }
 func (r *findRows) UpdateSeq() string { return "" }
 func (r *findRows) Warning() string {
-	if w := r.Get("warning"); w != js.Undefined {
+	if w := r.Get("warning"); !w.IsUndefined() {
 		return w.String()
 	}
 	return ""
@@ -121,10 +120,10 @@ func (r *findRows) Close() error {
 
 func (r *findRows) Next(row *driver.Row) (err error) {
 	defer bindings.RecoverError(&err)
-	if r.Get("docs") == js.Undefined || r.Get("docs").Length() == 0 {
+	if r.Get("docs").IsUndefined() || r.Get("docs").Length() == 0 {
 		return io.EOF
 	}
 	next := r.Get("docs").Call("shift")
-	row.Doc = json.RawMessage(jsJSON.Call("stringify", next).String())
+	row.Doc = json.RawMessage(jsval.Stringify(next))
 	return nil
 }
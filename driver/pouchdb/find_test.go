@@ -5,7 +5,8 @@ import (
 	"testing"
 
 	"github.com/flimzy/diff"
-	"github.com/gopherjs/gopherjs/js"
+
+	"github.com/flimzy/kivik/driver/pouchdb/jsval"
 )
 
 func TestBuildIndex(t *testing.T) {
@@ -26,7 +27,7 @@ func TestBuildIndex(t *testing.T) {
 			if err != nil {
 				t.Errorf("Build Index failed: %s", err)
 			}
-			r := js.Global.Get("JSON").Call("stringify", result).String()
+			r := jsval.Stringify(result)
 			if d := diff.JSON([]byte(test.Expected), []byte(r)); d != "" {
 				t.Errorf("BuildIndex result differs:\n%s\n", d)
 			}
@@ -3,5 +3,5 @@
 package pouchdb
 
 func init() {
-	panic("kivik: pouchdb must be compiled with GopherJS")
+	panic("kivik: pouchdb must be compiled with GopherJS, or for WebAssembly")
 }
@@ -0,0 +1,184 @@
+// +build js,!wasm
+
+package jsval
+
+import (
+	"github.com/gopherjs/gopherjs/js"
+	"github.com/gopherjs/jsbuiltin"
+)
+
+// Value is a JavaScript value.
+type Value struct {
+	o *js.Object
+}
+
+// Object returns the *js.Object of v, for use with GopherJS-specific code.
+func (v Value) Object() *js.Object {
+	return v.o
+}
+
+// FromObject returns the Value of o.
+func FromObject(o *js.Object) Value {
+	return wrap(o)
+}
+
+func (v Value) native() interface{} {
+	return v.o
+}
+
+func wrap(o *js.Object) Value {
+	return Value{o: o}
+}
+
+// Global returns the JavaScript global object.
+func Global() Value {
+	return wrap(js.Global)
+}
+
+// Undefined returns the JavaScript value undefined.
+func Undefined() Value {
+	return wrap(js.Undefined)
+}
+
+// IsUndefined returns true if v is undefined.
+func (v Value) IsUndefined() bool {
+	return v.o == js.Undefined
+}
+
+// IsNull returns true if v is null.
+func (v Value) IsNull() bool {
+	return v.o == nil
+}
+
+// Type returns the JavaScript type of v, as returned by typeof.
+func (v Value) Type() string {
+	if v.o == nil {
+		return "object"
+	}
+	return jsbuiltin.TypeOf(v.o)
+}
+
+// InstanceOf returns true if v is an instance of the constructor t.
+func (v Value) InstanceOf(t Value) bool {
+	if v.o == nil || v.o == js.Undefined {
+		return false
+	}
+	return jsbuiltin.InstanceOf(v.o, t.o)
+}
+
+// Get returns the property key of v.
+func (v Value) Get(key string) Value {
+	return wrap(v.o.Get(key))
+}
+
+// Set sets the property key of v to value.
+func (v Value) Set(key string, value interface{}) {
+	v.o.Set(key, native(value))
+}
+
+// Delete deletes the property key of v.
+func (v Value) Delete(key string) {
+	v.o.Delete(key)
+}
+
+// Index returns the element i of the array v.
+func (v Value) Index(i int) Value {
+	return wrap(v.o.Index(i))
+}
+
+// Length returns the length of the array v.
+func (v Value) Length() int {
+	return v.o.Length()
+}
+
+// Call calls the method of v.
+func (v Value) Call(method string, args ...interface{}) Value {
+	return wrap(v.o.Call(method, natives(args)...))
+}
+
+// Invoke calls the function v.
+func (v Value) Invoke(args ...interface{}) Value {
+	return wrap(v.o.Invoke(natives(args)...))
+}
+
+// New calls the constructor v.
+func (v Value) New(args ...interface{}) Value {
+	return wrap(v.o.New(natives(args)...))
+}
+
+// String returns v as a string.
+func (v Value) String() string {
+	return v.o.String()
+}
+
+// Int returns v as an int.
+func (v Value) Int() int {
+	return v.o.Int()
+}
+
+// Int64 returns v as an int64.
+func (v Value) Int64() int64 {
+	return v.o.Int64()
+}
+
+// Float returns v as a float64.
+func (v Value) Float() float64 {
+	return v.o.Float()
+}
+
+// Bool returns v as a bool.
+func (v Value) Bool() bool {
+	return v.o.Bool()
+}
+
+// Truthy returns true if v is considered true by JavaScript.
+func (v Value) Truthy() bool {
+	return v.o != nil && v.o != js.Undefined && v.o.Bool()
+}
+
+// Bytes returns a copy of the contents of v, a Uint8Array.
+func (v Value) Bytes() []byte {
+	b := v.o.Interface().([]byte)
+	return append([]byte(nil), b...)
+}
+
+// Bytes returns a Uint8Array holding a copy of b.
+func Bytes(b []byte) Value {
+	return wrap(js.Global.Get("Uint8Array").New(b))
+}
+
+// Func is a Go function which may be called by JavaScript.
+type Func struct {
+	o *js.Object
+}
+
+// FuncOf returns a Func which calls fn with the value of this, and the
+// arguments of the call.
+func FuncOf(fn func(this Value, args []Value) interface{}) Func {
+	return Func{o: js.MakeFunc(func(this *js.Object, args []*js.Object) interface{} {
+		values := make([]Value, len(args))
+		for i, arg := range args {
+			values[i] = wrap(arg)
+		}
+		return native(fn(wrap(this), values))
+	})}
+}
+
+// Release frees the resources of f, which must not be called afterwards.
+func (f Func) Release() {}
+
+func (f Func) native() interface{} {
+	return f.o
+}
+
+// Thrown returns the JavaScript value thrown by a call, if r, as returned by
+// recover, is one.
+func Thrown(r interface{}) (Value, bool) {
+	switch t := r.(type) {
+	case *js.Error:
+		return wrap(t.Object), true
+	case *js.Object:
+		return wrap(t), true
+	}
+	return Value{}, false
+}
@@ -0,0 +1,126 @@
+// +build js
+
+// Package jsval provides a minimal abstraction over JavaScript values, so that
+// the PouchDB bindings compile both with GopherJS, and with the standard Go
+// compiler for WebAssembly (GOOS=js GOARCH=wasm), by way of syscall/js.
+//
+// Arguments passed to JavaScript, such as those of Call or Set, may be a
+// Value, a Func, nil, a bool, number or string, a []byte, which is copied to a
+// Uint8Array, or a slice or map of those. Any other value is converted by way
+// of its JSON encoding.
+//
+// WebAssembly support requires Go 1.14 or later.
+package jsval
+
+import (
+	"encoding/json"
+	"math"
+	"reflect"
+	"time"
+)
+
+// IsFunction returns true if v is a JavaScript function.
+func (v Value) IsFunction() bool {
+	return v.Type() == "function"
+}
+
+// Defined returns true if v is neither undefined nor null.
+func (v Value) Defined() bool {
+	return !v.IsUndefined() && !v.IsNull()
+}
+
+// Time converts v, a Date or a date string, to a time.Time. The zero time is
+// returned if v is undefined, or not a valid date.
+func (v Value) Time() time.Time {
+	var date Value
+	switch v.Type() {
+	case "string":
+		date = Global().Get("Date").New(v)
+	case "object":
+		if v.IsNull() || !v.Get("getTime").IsFunction() {
+			return time.Time{}
+		}
+		date = v
+	default:
+		return time.Time{}
+	}
+	ms := date.Call("getTime").Float()
+	if math.IsNaN(ms) {
+		return time.Time{}
+	}
+	return time.Unix(0, int64(ms)*int64(time.Millisecond))
+}
+
+// Stringify returns the JSON encoding of v.
+func Stringify(v interface{}) string {
+	return Global().Get("JSON").Call("stringify", v).String()
+}
+
+// Parse parses the JSON encoded data.
+func Parse(data string) Value {
+	return Global().Get("JSON").Call("parse", data)
+}
+
+// native converts x to a value which the underlying implementation passes to
+// JavaScript unchanged.
+func native(x interface{}) interface{} {
+	switch t := x.(type) {
+	case nil:
+		return nil
+	case Value:
+		return t.native()
+	case Func:
+		return t.native()
+	case json.RawMessage:
+		return Parse(string(t)).native()
+	case []byte:
+		return Bytes(t).native()
+	}
+	v := reflect.ValueOf(x)
+	switch v.Kind() {
+	case reflect.Bool:
+		return v.Bool()
+	case reflect.String:
+		return v.String()
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return v.Int()
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return v.Uint()
+	case reflect.Float32, reflect.Float64:
+		return v.Float()
+	case reflect.Slice, reflect.Array:
+		if v.Kind() == reflect.Slice && v.IsNil() {
+			return nil
+		}
+		a := make([]interface{}, v.Len())
+		for i := range a {
+			a[i] = native(v.Index(i).Interface())
+		}
+		return a
+	case reflect.Map:
+		if v.Type().Key().Kind() != reflect.String {
+			break
+		}
+		if v.IsNil() {
+			return nil
+		}
+		m := make(map[string]interface{}, v.Len())
+		for _, k := range v.MapKeys() {
+			m[k.String()] = native(v.MapIndex(k).Interface())
+		}
+		return m
+	}
+	data, err := json.Marshal(x)
+	if err != nil {
+		panic(err)
+	}
+	return Parse(string(data)).native()
+}
+
+func natives(args []interface{}) []interface{} {
+	n := make([]interface{}, len(args))
+	for i, arg := range args {
+		n[i] = native(arg)
+	}
+	return n
+}
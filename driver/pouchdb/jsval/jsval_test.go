@@ -0,0 +1,100 @@
+// +build js
+
+package jsval
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/flimzy/diff"
+)
+
+func TestConversion(t *testing.T) {
+	type doc struct {
+		ID   string `json:"_id"`
+		Tags []string
+	}
+	tests := []struct {
+		name     string
+		value    interface{}
+		expected string
+	}{
+		{name: "Nil", value: nil, expected: `null`},
+		{name: "String", value: "foo", expected: `"foo"`},
+		{name: "Int64", value: int64(42), expected: `42`},
+		{name: "Bool", value: true, expected: `true`},
+		{name: "Bytes", value: []byte{1, 2}, expected: `{"0":1,"1":2}`},
+		{name: "RawMessage", value: json.RawMessage(`{"a":1}`), expected: `{"a":1}`},
+		{name: "Strings", value: []string{"a", "b"}, expected: `["a","b"]`},
+		{name: "StringMap", value: map[string]string{"a": "b"}, expected: `{"a":"b"}`},
+		{name: "Nested", value: map[string]interface{}{"values": []Value{Parse(`{"a":1}`)}}, expected: `{"values":[{"a":1}]}`},
+		{name: "Struct", value: &doc{ID: "foo", Tags: []string{"x"}}, expected: `{"_id":"foo","Tags":["x"]}`},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			result := Stringify(test.value)
+			if d := diff.JSON([]byte(test.expected), []byte(result)); d != "" {
+				t.Error(d)
+			}
+		})
+	}
+}
+
+func TestBytes(t *testing.T) {
+	b := []byte("hello")
+	v := Bytes(b)
+	b[0] = 'j'
+	if result := string(v.Bytes()); result != "hello" {
+		t.Errorf("Unexpected result: %s", result)
+	}
+}
+
+func TestTime(t *testing.T) {
+	expected := time.Date(2017, 5, 16, 8, 26, 31, 0, time.UTC)
+	tests := []struct {
+		name     string
+		value    Value
+		expected time.Time
+	}{
+		{name: "Undefined", value: Undefined()},
+		{name: "String", value: Parse(`"2017-05-16T08:26:31.000Z"`), expected: expected},
+		{name: "Date", value: Global().Get("Date").New("2017-05-16T08:26:31Z"), expected: expected},
+		{name: "Invalid", value: Parse(`"foo"`)},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if result := test.value.Time(); !result.Equal(test.expected) {
+				t.Errorf("Expected %s, got %s", test.expected, result)
+			}
+		})
+	}
+}
+
+func TestThrown(t *testing.T) {
+	var thrown Value
+	func() {
+		defer func() {
+			var ok bool
+			if thrown, ok = Thrown(recover()); !ok {
+				t.Fatal("Expected a JavaScript exception")
+			}
+		}()
+		Global().Call("eval", `throw new TypeError("foo")`)
+	}()
+	if !thrown.InstanceOf(Global().Get("TypeError")) || thrown.Get("message").String() != "foo" {
+		t.Errorf("Unexpected exception: %s", thrown)
+	}
+}
+
+func TestFuncOf(t *testing.T) {
+	f := FuncOf(func(this Value, args []Value) interface{} {
+		return args[0].Int() + args[1].Int()
+	})
+	defer f.Release()
+	obj := Global().Get("Object").New()
+	obj.Set("add", f)
+	if result := obj.Call("add", 1, 2).Int(); result != 3 {
+		t.Errorf("Unexpected result: %d", result)
+	}
+}
@@ -0,0 +1,192 @@
+// +build js,wasm
+
+package jsval
+
+import (
+	"syscall/js"
+)
+
+// Value is a JavaScript value.
+type Value struct {
+	v js.Value
+}
+
+// JSValue returns the syscall/js value of v, for use with WebAssembly-specific
+// code.
+func (v Value) JSValue() js.Value {
+	return v.v
+}
+
+// FromJSValue returns the Value of v.
+func FromJSValue(v js.Value) Value {
+	return wrap(v)
+}
+
+func (v Value) native() interface{} {
+	return v.v
+}
+
+func wrap(v js.Value) Value {
+	return Value{v: v}
+}
+
+// Global returns the JavaScript global object.
+func Global() Value {
+	return wrap(js.Global())
+}
+
+// Undefined returns the JavaScript value undefined.
+func Undefined() Value {
+	return wrap(js.Undefined())
+}
+
+// IsUndefined returns true if v is undefined.
+func (v Value) IsUndefined() bool {
+	return v.v.IsUndefined()
+}
+
+// IsNull returns true if v is null.
+func (v Value) IsNull() bool {
+	return v.v.IsNull()
+}
+
+// Type returns the JavaScript type of v, as returned by typeof.
+func (v Value) Type() string {
+	return v.v.Type().String()
+}
+
+// InstanceOf returns true if v is an instance of the constructor t.
+func (v Value) InstanceOf(t Value) bool {
+	return v.v.InstanceOf(t.v)
+}
+
+// Get returns the property key of v.
+func (v Value) Get(key string) Value {
+	return wrap(v.v.Get(key))
+}
+
+// Set sets the property key of v to value.
+func (v Value) Set(key string, value interface{}) {
+	v.v.Set(key, native(value))
+}
+
+// Delete deletes the property key of v.
+func (v Value) Delete(key string) {
+	v.v.Delete(key)
+}
+
+// Index returns the element i of the array v.
+func (v Value) Index(i int) Value {
+	return wrap(v.v.Index(i))
+}
+
+// Length returns the length of the array v.
+func (v Value) Length() int {
+	return v.v.Length()
+}
+
+// Call calls the method of v.
+func (v Value) Call(method string, args ...interface{}) Value {
+	return wrap(v.v.Call(method, natives(args)...))
+}
+
+// Invoke calls the function v.
+func (v Value) Invoke(args ...interface{}) Value {
+	return wrap(v.v.Invoke(natives(args)...))
+}
+
+// New calls the constructor v.
+func (v Value) New(args ...interface{}) Value {
+	return wrap(v.v.New(natives(args)...))
+}
+
+// String returns v as a string. Unlike syscall/js, which describes values
+// which are not strings, v is converted as by JavaScript's String().
+func (v Value) String() string {
+	if v.v.Type() == js.TypeString {
+		return v.v.String()
+	}
+	return js.Global().Call("String", v.v).String()
+}
+
+// Int returns v as an int.
+func (v Value) Int() int {
+	return int(v.Float())
+}
+
+// Int64 returns v as an int64.
+func (v Value) Int64() int64 {
+	return int64(v.Float())
+}
+
+// Float returns v as a float64. Values which are not numbers are converted as
+// by JavaScript's Number().
+func (v Value) Float() float64 {
+	if v.v.Type() == js.TypeNumber {
+		return v.v.Float()
+	}
+	return js.Global().Call("Number", v.v).Float()
+}
+
+// Bool returns v as a bool.
+func (v Value) Bool() bool {
+	return v.v.Truthy()
+}
+
+// Truthy returns true if v is considered true by JavaScript.
+func (v Value) Truthy() bool {
+	return v.v.Truthy()
+}
+
+// Bytes returns a copy of the contents of v, a Uint8Array.
+func (v Value) Bytes() []byte {
+	b := make([]byte, v.v.Length())
+	js.CopyBytesToGo(b, v.v)
+	return b
+}
+
+// Bytes returns a Uint8Array holding a copy of b.
+func Bytes(b []byte) Value {
+	a := js.Global().Get("Uint8Array").New(len(b))
+	js.CopyBytesToJS(a, b)
+	return wrap(a)
+}
+
+// Func is a Go function which may be called by JavaScript.
+type Func struct {
+	f js.Func
+}
+
+// FuncOf returns a Func which calls fn with the value of this, and the
+// arguments of the call. As JavaScript's event loop is paused while fn runs,
+// fn must not block, other than on other goroutines.
+func FuncOf(fn func(this Value, args []Value) interface{}) Func {
+	return Func{f: js.FuncOf(func(this js.Value, args []js.Value) interface{} {
+		values := make([]Value, len(args))
+		for i, arg := range args {
+			values[i] = wrap(arg)
+		}
+		return native(fn(wrap(this), values))
+	})}
+}
+
+// Release frees the resources of f, which must not be called afterwards.
+func (f Func) Release() {
+	f.f.Release()
+}
+
+func (f Func) native() interface{} {
+	return f.f
+}
+
+// Thrown returns the JavaScript value thrown by a call, if r, as returned by
+// recover, is one.
+func Thrown(r interface{}) (Value, bool) {
+	switch t := r.(type) {
+	case js.Error:
+		return wrap(t.Value), true
+	case *js.Error:
+		return wrap(t.Value), true
+	}
+	return Value{}, false
+}
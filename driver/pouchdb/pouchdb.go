@@ -1,3 +1,6 @@
+// Package pouchdb is a kivik driver for the PouchDB library. It must be
+// compiled with GopherJS, or for WebAssembly (GOOS=js GOARCH=wasm), and run in
+// the browser or in Node.js.
 package pouchdb
 
 import (
@@ -25,17 +28,22 @@ func init() {
 }
 
 // NewClient returns a PouchDB client handle. Provide a dsn only for remote
-// databases. Otherwise specify ""
+// databases, or to select the adapter of local databases. Otherwise specify "".
+//
+// A remote dsn is an http or https URL. Any other dsn selects the adapter of
+// local databases, in the form adapter:prefix, such as "leveldb:" or
+// "leveldb:/var/lib/kivik/" in Node.js, or "idb:" in the browser. The optional
+// prefix is prepended to the names of databases, as by PouchDB's prefix option,
+// to store them in another directory. An adapter which is not loaded is
+// loaded from its pouchdb-adapter-<adapter> package, when run in Node.js.
 func (d *Driver) NewClient(_ context.Context, dsn string) (driver.Client, error) {
-	var u *url.URL
+	u, adapter, prefix, err := parseDSN(dsn)
+	if err != nil {
+		return nil, err
+	}
 	var auth authenticator
 	var user *url.Userinfo
-	if dsn != "" {
-		var err error
-		u, err = url.Parse(dsn)
-		if err != nil {
-			return nil, fmt.Errorf("Invalid DSN URL '%s' provided: %s", dsn, err)
-		}
+	if u != nil {
 		user = u.User
 		u.User = nil
 	}
@@ -45,6 +53,16 @@ func (d *Driver) NewClient(_ context.Context, dsn string) (driver.Client, error)
 		pouch: pouch,
 		opts:  make(map[string]Options),
 	}
+	if adapter != "" {
+		if err := pouch.LoadAdapter(adapter); err != nil {
+			return nil, err
+		}
+		defaults := Options{"adapter": adapter}
+		if prefix != "" {
+			defaults["prefix"] = prefix
+		}
+		client.opts[optionsDefaultKey] = defaults
+	}
 	if user != nil {
 		pass, _ := user.Password()
 		auth = &BasicAuth{
@@ -58,6 +76,29 @@ func (d *Driver) NewClient(_ context.Context, dsn string) (driver.Client, error)
 	return client, nil
 }
 
+// parseDSN returns the URL of a remote dsn, or the adapter and prefix of a
+// local one.
+func parseDSN(dsn string) (remote *url.URL, adapter, prefix string, err error) {
+	if dsn == "" {
+		return nil, "", "", nil
+	}
+	u, err := url.Parse(dsn)
+	if err != nil {
+		return nil, "", "", fmt.Errorf("Invalid DSN URL '%s' provided: %s", dsn, err)
+	}
+	switch u.Scheme {
+	case "http", "https":
+		return u, "", "", nil
+	case "":
+		return nil, "", "", errors.Statusf(kivik.StatusBadRequest, "kivik: no adapter or URL scheme in DSN '%s'", dsn)
+	}
+	prefix = u.Opaque
+	if prefix == "" {
+		prefix = u.Path
+	}
+	return nil, u.Scheme, prefix, nil
+}
+
 type client struct {
 	dsn   *url.URL
 	opts  map[string]Options
@@ -90,6 +131,26 @@ func (c *client) Version(_ context.Context) (*driver.Version, error) {
 	}, nil
 }
 
+var _ driver.DiskUsager = &client{}
+
+// DiskUsage returns the browser's estimate of the storage used by, and
+// available to, local databases. For a remote client, or when the browser
+// provides no estimate, as in Node.js, an error with status
+// StatusNotImplemented is returned.
+func (c *client) DiskUsage(ctx context.Context) (*driver.DiskUsage, error) {
+	if c.isRemote() {
+		return nil, errors.Status(kivik.StatusNotImplemented, "kivik: disk usage not available for remote databases")
+	}
+	estimate, err := bindings.EstimateStorage(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return &driver.DiskUsage{
+		Usage: estimate.Usage,
+		Quota: estimate.Quota,
+	}, nil
+}
+
 func (c *client) dbURL(db string) string {
 	if c.dsn == nil {
 		// No transformation for local databases
@@ -0,0 +1,111 @@
+package pouchdb
+
+import (
+	"context"
+	"encoding/json"
+	"strconv"
+
+	"github.com/flimzy/kivik"
+	"github.com/flimzy/kivik/driver"
+	"github.com/flimzy/kivik/errors"
+)
+
+// Query queries a view. If ddoc is empty, a temporary view is queried, defined
+// by the JavaScript source of its map function, in the "map" option, and
+// optionally of its reduce function, or the name of a built-in reduce
+// function, in the "reduce" option.
+func (d *db) Query(ctx context.Context, ddoc, view string, options map[string]interface{}) (driver.Rows, error) {
+	opts, err := queryOptions(options)
+	if err != nil {
+		return nil, err
+	}
+	if ddoc == "" {
+		return d.queryTemp(ctx, opts)
+	}
+	result, err := d.db.Query(ctx, ddoc, view, opts)
+	if err != nil {
+		return nil, err
+	}
+	return &rows{
+		Value: result,
+	}, nil
+}
+
+func (d *db) queryTemp(ctx context.Context, opts map[string]interface{}) (driver.Rows, error) {
+	mapSrc, ok := opts["map"].(string)
+	if !ok || mapSrc == "" {
+		return nil, errors.Status(kivik.StatusBadRequest, "kivik: map function required for temporary view")
+	}
+	delete(opts, "map")
+	var reduceSrc string
+	// A boolean reduce option, as converted by queryOptions, enables or
+	// disables the reduce function, rather than defining one.
+	if src, ok := opts["reduce"].(string); ok {
+		reduceSrc = src
+		delete(opts, "reduce")
+	}
+	result, err := d.db.QueryTemp(ctx, mapSrc, reduceSrc, opts)
+	if err != nil {
+		return nil, err
+	}
+	return &rows{
+		Value: result,
+	}, nil
+}
+
+var (
+	intOptions  = []string{"limit", "skip", "group_level"}
+	boolOptions = []string{"descending", "include_docs", "inclusive_end", "group", "reduce", "conflicts", "attachments", "binary", "update_seq"}
+	keyOptions  = []string{"key", "keys", "startkey", "endkey", "start_key", "end_key"}
+)
+
+// queryOptions translates CouchDB query options to those understood by
+// PouchDB. Keys, which kivik passes JSON-encoded, are decoded; numeric and
+// boolean options passed as strings are converted; and the CouchDB 2.x update
+// option is translated to PouchDB's stale option.
+func queryOptions(options map[string]interface{}) (map[string]interface{}, error) {
+	opts := make(map[string]interface{}, len(options))
+	for k, v := range options {
+		opts[k] = v
+	}
+	for _, k := range keyOptions {
+		str, ok := opts[k].(string)
+		if !ok {
+			continue
+		}
+		var key interface{}
+		if err := json.Unmarshal([]byte(str), &key); err == nil {
+			opts[k] = key
+		}
+	}
+	for _, k := range intOptions {
+		str, ok := opts[k].(string)
+		if !ok {
+			continue
+		}
+		i, err := strconv.Atoi(str)
+		if err != nil {
+			return nil, errors.Statusf(kivik.StatusBadRequest, "kivik: invalid value for %s: %s", k, str)
+		}
+		opts[k] = i
+	}
+	for _, k := range boolOptions {
+		str, ok := opts[k].(string)
+		if !ok || (str != "true" && str != "false") {
+			continue
+		}
+		opts[k] = str == "true"
+	}
+	if update, ok := opts["update"]; ok {
+		delete(opts, "update")
+		switch update {
+		case false, "false":
+			opts["stale"] = "ok"
+		case "lazy":
+			opts["stale"] = "update_after"
+		}
+	}
+	// PouchDB has no notion of stable shards.
+	delete(opts, "stable")
+	return opts, nil
+}
@@ -0,0 +1,57 @@
+package pouchdb
+
+import (
+	"strconv"
+	"testing"
+
+	"github.com/flimzy/diff"
+)
+
+func TestQueryOptions(t *testing.T) {
+	tests := []struct {
+		Options  map[string]interface{}
+		Expected map[string]interface{}
+		Error    string
+	}{
+		{Options: map[string]interface{}{}, Expected: map[string]interface{}{}},
+		{
+			Options:  map[string]interface{}{"key": `"foo"`, "startkey": `["a",1]`, "endkey": "bar"},
+			Expected: map[string]interface{}{"key": "foo", "startkey": []interface{}{"a", float64(1)}, "endkey": "bar"},
+		},
+		{
+			Options:  map[string]interface{}{"limit": "10", "skip": 2, "descending": "true", "reduce": "false"},
+			Expected: map[string]interface{}{"limit": 10, "skip": 2, "descending": true, "reduce": false},
+		},
+		{
+			Options:  map[string]interface{}{"update": "false", "stable": true},
+			Expected: map[string]interface{}{"stale": "ok"},
+		},
+		{
+			Options:  map[string]interface{}{"update": "lazy"},
+			Expected: map[string]interface{}{"stale": "update_after"},
+		},
+		{
+			Options:  map[string]interface{}{"update": "true"},
+			Expected: map[string]interface{}{},
+		},
+		{
+			Options: map[string]interface{}{"limit": "many"},
+			Error:   "kivik: invalid value for limit: many",
+		},
+	}
+	for i, test := range tests {
+		t.Run(strconv.Itoa(i), func(t *testing.T) {
+			result, err := queryOptions(test.Options)
+			var msg string
+			if err != nil {
+				msg = err.Error()
+			}
+			if msg != test.Error {
+				t.Errorf("Unexpected error: %s", msg)
+			}
+			if d := diff.Interface(test.Expected, result); d != "" {
+				t.Error(d)
+			}
+		})
+	}
+}
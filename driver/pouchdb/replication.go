@@ -8,8 +8,8 @@ import (
 	"github.com/flimzy/kivik"
 	"github.com/flimzy/kivik/driver"
 	"github.com/flimzy/kivik/driver/pouchdb/bindings"
+	"github.com/flimzy/kivik/driver/pouchdb/jsval"
 	"github.com/flimzy/kivik/errors"
-	"github.com/gopherjs/gopherjs/js"
 )
 
 type replication struct {
@@ -29,7 +29,7 @@ type replication struct {
 
 var _ driver.Replication = &replication{}
 
-func (c *client) newReplication(target, source string, rep *js.Object) *replication {
+func (c *client) newReplication(target, source string, rep jsval.Value) *replication {
 	r := &replication{
 		target: target,
 		source: source,
@@ -66,18 +66,18 @@ func (r *replication) Update(ctx context.Context, state *driver.ReplicationInfo)
 	switch event {
 	case bindings.ReplicationEventDenied, bindings.ReplicationEventError:
 		r.state = kivik.ReplicationError
-		r.err = bindings.NewPouchError(info.Object)
+		r.err = bindings.NewPouchError(info.Value)
 	case bindings.ReplicationEventComplete:
 		r.state = kivik.ReplicationComplete
 	case bindings.ReplicationEventPaused, bindings.ReplicationEventChange, bindings.ReplicationEventActive:
 		r.state = kivik.ReplicationStarted
 	}
 	if info != nil {
-		if r.startTime.IsZero() && info.Get("start_time") != js.Undefined && !info.StartTime.IsZero() {
-			r.startTime = info.StartTime
+		if startTime := info.StartTime(); r.startTime.IsZero() && !startTime.IsZero() {
+			r.startTime = startTime
 		}
-		if r.endTime.IsZero() && info.Get("end_time") != js.Undefined && !info.EndTime.IsZero() {
-			r.endTime = info.EndTime
+		if endTime := info.EndTime(); r.endTime.IsZero() && !endTime.IsZero() {
+			r.endTime = endTime
 		}
 	}
 	return nil
@@ -106,12 +106,16 @@ func replicationEndpoint(dsn string, object interface{}) (name string, obj inter
 		return dsn, dsn, nil
 	}
 	switch t := object.(type) {
-	case *js.Object:
+	case jsval.Value:
 		// Assume it's a raw PouchDB object
 		return t.Get("name").String(), t, nil
 	case *bindings.DB:
 		// Unwrap the bare object
-		return t.Object.Get("name").String(), t.Object, nil
+		return t.Value.Get("name").String(), t.Value, nil
+	}
+	if t, ok := jsObject(object); ok {
+		// Assume it's a raw PouchDB object
+		return t.Get("name").String(), t, nil
 	}
 	// Just let it pass through
 	return "<unknown>", obj, nil
@@ -7,17 +7,19 @@ import (
 	"time"
 
 	"github.com/flimzy/kivik/driver/pouchdb/bindings"
-	"github.com/gopherjs/gopherjs/js"
+	"github.com/flimzy/kivik/driver/pouchdb/jsval"
 )
 
 type replicationState struct {
-	*js.Object
-	StartTime        time.Time `js:"start_time"`
-	EndTime          time.Time `js:"end_time"`
-	DocsRead         int64     `js:"docs_read"`
-	DocsWritten      int64     `js:"docs_written"`
-	DocWriteFailures int64     `js:"doc_write_failures"`
-	LastSeq          string    `js:"last_seq"`
+	jsval.Value
+}
+
+func (s *replicationState) StartTime() time.Time {
+	return s.Get("start_time").Time()
+}
+
+func (s *replicationState) EndTime() time.Time {
+	return s.Get("end_time").Time()
 }
 
 type replicationHandler struct {
@@ -27,7 +29,10 @@ type replicationHandler struct {
 	mu       sync.Mutex
 	wg       sync.WaitGroup
 	complete bool
-	obj      *js.Object
+	obj      jsval.Value
+	// funcs are the event handlers, released when the replication is
+	// complete.
+	funcs []jsval.Func
 }
 
 func (r *replicationHandler) Cancel() {
@@ -55,7 +60,7 @@ func (r *replicationHandler) Status() (string, *replicationState, error) {
 	return *event, state, nil
 }
 
-func (r *replicationHandler) handleEvent(event string, info *js.Object) {
+func (r *replicationHandler) handleEvent(event string, info jsval.Value) {
 	if r.complete {
 		panic(fmt.Sprintf("Unexpected replication event after complete. %v %v", event, info))
 	}
@@ -65,14 +70,18 @@ func (r *replicationHandler) handleEvent(event string, info *js.Object) {
 	switch event {
 	case bindings.ReplicationEventDenied, bindings.ReplicationEventError, bindings.ReplicationEventComplete:
 		r.complete = true
+		for _, f := range r.funcs {
+			f.Release()
+		}
+		r.funcs = nil
 	}
-	if info != nil && info != js.Undefined {
-		r.state = &replicationState{Object: info}
+	if info.Defined() {
+		r.state = &replicationState{Value: info}
 	}
 	r.wg.Done()
 }
 
-func newReplicationHandler(rep *js.Object) *replicationHandler {
+func newReplicationHandler(rep jsval.Value) *replicationHandler {
 	r := &replicationHandler{obj: rep}
 	for _, event := range []string{
 		bindings.ReplicationEventChange,
@@ -83,9 +92,16 @@ func newReplicationHandler(rep *js.Object) *replicationHandler {
 		bindings.ReplicationEventError,
 	} {
 		func(e string) {
-			rep.Call("on", e, func(info *js.Object) {
+			f := jsval.FuncOf(func(_ jsval.Value, args []jsval.Value) interface{} {
+				info := jsval.Undefined()
+				if len(args) > 0 {
+					info = args[0]
+				}
 				r.handleEvent(e, info)
+				return nil
 			})
+			r.funcs = append(r.funcs, f)
+			rep.Call("on", e, f)
 		}(event)
 	}
 	r.wg.Add(1)
@@ -0,0 +1,17 @@
+// +build js,!wasm
+
+package pouchdb
+
+import (
+	"github.com/gopherjs/gopherjs/js"
+
+	"github.com/flimzy/kivik/driver/pouchdb/jsval"
+)
+
+// jsObject returns the Value of object, if it is a *js.Object.
+func jsObject(object interface{}) (jsval.Value, bool) {
+	if o, ok := object.(*js.Object); ok {
+		return jsval.FromObject(o), true
+	}
+	return jsval.Value{}, false
+}
@@ -0,0 +1,17 @@
+// +build js,wasm
+
+package pouchdb
+
+import (
+	"syscall/js"
+
+	"github.com/flimzy/kivik/driver/pouchdb/jsval"
+)
+
+// jsObject returns the Value of object, if it is a js.Value.
+func jsObject(object interface{}) (jsval.Value, bool) {
+	if v, ok := object.(js.Value); ok {
+		return jsval.FromJSValue(v), true
+	}
+	return jsval.Value{}, false
+}
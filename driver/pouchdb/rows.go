@@ -4,23 +4,13 @@ import (
 	"encoding/json"
 	"io"
 
-	"github.com/gopherjs/gopherjs/js"
-
 	"github.com/flimzy/kivik/driver"
 	"github.com/flimzy/kivik/driver/pouchdb/bindings"
+	"github.com/flimzy/kivik/driver/pouchdb/jsval"
 )
 
-var jsJSON *js.Object
-
-func init() {
-	jsJSON = js.Global.Get("JSON")
-}
-
 type rows struct {
-	*js.Object
-	Off   int64  `js:"offset"`
-	TRows int64  `js:"total_rows"`
-	USeq  string `js:"update_seq"`
+	jsval.Value
 }
 
 var _ driver.Rows = &rows{}
@@ -32,27 +22,30 @@ func (r *rows) Close() error {
 
 func (r *rows) Next(row *driver.Row) (err error) {
 	defer bindings.RecoverError(&err)
-	if r.Get("rows") == js.Undefined || r.Get("rows").Length() == 0 {
+	if r.Get("rows").IsUndefined() || r.Get("rows").Length() == 0 {
 		return io.EOF
 	}
 	next := r.Get("rows").Call("shift")
 	row.ID = next.Get("id").String()
-	row.Key = json.RawMessage(jsJSON.Call("stringify", next.Get("key")).String())
-	row.Value = json.RawMessage(jsJSON.Call("stringify", next.Get("value")).String())
-	if doc := next.Get("doc"); doc != js.Undefined {
-		row.Doc = json.RawMessage(jsJSON.Call("stringify", doc).String())
+	row.Key = json.RawMessage(jsval.Stringify(next.Get("key")))
+	row.Value = json.RawMessage(jsval.Stringify(next.Get("value")))
+	if doc := next.Get("doc"); !doc.IsUndefined() {
+		row.Doc = json.RawMessage(jsval.Stringify(doc))
 	}
 	return nil
 }
 
 func (r *rows) Offset() int64 {
-	return r.Off
+	return r.Get("offset").Int64()
 }
 
 func (r *rows) TotalRows() int64 {
-	return r.TRows
+	return r.Get("total_rows").Int64()
 }
 
 func (r *rows) UpdateSeq() string {
-	return "" // PouchDB doesn't support this option
+	if r.Get("update_seq").IsUndefined() {
+		return ""
+	}
+	return r.Get("update_seq").String()
 }
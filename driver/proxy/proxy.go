@@ -4,6 +4,7 @@ import (
 	"context"
 	"encoding/json"
 	"io"
+	"io/ioutil"
 
 	"github.com/flimzy/kivik"
 	"github.com/flimzy/kivik/driver"
@@ -69,6 +70,10 @@ type db struct {
 }
 
 var _ driver.DB = &db{}
+var _ driver.OptsDocCreator = &db{}
+var _ driver.OptsPutter = &db{}
+var _ driver.OptsDeleter = &db{}
+var _ driver.BodyGetter = &db{}
 
 func (d *db) AllDocs(ctx context.Context, opts map[string]interface{}) (driver.Rows, error) {
 	kivikRows, err := d.DB.AllDocs(ctx, opts)
@@ -96,10 +101,49 @@ func (d *db) Get(ctx context.Context, id string, opts map[string]interface{}) (j
 	return raw, err
 }
 
+func (d *db) GetBody(ctx context.Context, id string, opts map[string]interface{}) (io.ReadCloser, error) {
+	return d.DB.GetStream(ctx, id, opts)
+}
+
+func (d *db) CreateDoc(ctx context.Context, doc interface{}) (string, string, error) {
+	return d.DB.CreateDoc(ctx, doc)
+}
+
+func (d *db) CreateDocOpts(ctx context.Context, doc interface{}, opts map[string]interface{}) (string, string, error) {
+	return d.DB.CreateDoc(ctx, doc, opts)
+}
+
+func (d *db) Put(ctx context.Context, id string, doc interface{}) (string, error) {
+	return d.DB.Put(ctx, id, doc)
+}
+
+func (d *db) PutOpts(ctx context.Context, id string, doc interface{}, opts map[string]interface{}) (string, error) {
+	return d.DB.Put(ctx, id, doc, opts)
+}
+
+func (d *db) Delete(ctx context.Context, id, rev string) (string, error) {
+	return d.DB.Delete(ctx, id, rev)
+}
+
+func (d *db) DeleteOpts(ctx context.Context, id, rev string, opts map[string]interface{}) (string, error) {
+	return d.DB.Delete(ctx, id, rev, opts)
+}
+
 func (d *db) Stats(ctx context.Context) (*driver.DBStats, error) {
 	i, err := d.DB.Stats(ctx)
-	stats := driver.DBStats(*i)
-	return &stats, err
+	if err != nil {
+		return nil, err
+	}
+	return &driver.DBStats{
+		Name:           i.Name,
+		CompactRunning: i.CompactRunning,
+		DocCount:       i.DocCount,
+		DeletedCount:   i.DeletedCount,
+		UpdateSeq:      string(i.UpdateSeq),
+		DiskSize:       i.DiskSize,
+		ActiveSize:     i.ActiveSize,
+		ExternalSize:   i.ExternalSize,
+	}, nil
 }
 
 func (d *db) Security(ctx context.Context) (*driver.Security, error) {
@@ -131,12 +175,14 @@ func (d *db) BulkDocs(_ context.Context, _ []interface{}) (driver.BulkResults, e
 	return nil, notYetImplemented
 }
 
-func (d *db) PutAttachment(_ context.Context, _, _, _, _ string, _ io.Reader) (string, error) {
-	// FIXME: Unimplemented
-	return "", notYetImplemented
+func (d *db) PutAttachment(ctx context.Context, docID, rev, filename, contentType string, body io.Reader) (string, error) {
+	return d.DB.PutAttachment(ctx, docID, rev, kivik.NewAttachment(filename, contentType, ioutil.NopCloser(body)))
 }
 
 func (d *db) GetAttachment(ctx context.Context, docID, rev, filename string) (contentType string, md5sum driver.MD5sum, body io.ReadCloser, err error) {
-	// FIXME: Unimplemented
-	return "", [16]byte{}, nil, notYetImplemented
+	att, err := d.DB.GetAttachment(ctx, docID, rev, filename)
+	if err != nil {
+		return "", driver.MD5sum{}, nil, err
+	}
+	return att.ContentType, driver.MD5sum(att.MD5), att.ReadCloser, nil
 }
@@ -31,3 +31,7 @@ func (r *rows) Next(row *driver.Row) error {
 	row.Doc = doc
 	return nil
 }
+
+func (r *rows) UpdateSeq() string {
+	return string(r.Rows.UpdateSeq())
+}
@@ -18,6 +18,12 @@ type Row struct {
 	// Doc is the raw, un-decoded JSON document. This is only populated by views
 	// which return docs, such as /_all_docs?include_docs=true.
 	Doc json.RawMessage `json:"doc"`
+	// Raw is the raw JSON of the whole row, as sent by the server, if
+	// available to the driver. Drivers which decode rows from a buffer which
+	// they reuse should set Raw, and the other fields, to slices of the
+	// buffers already held by the Row, as kivik resets them before each call
+	// to Next.
+	Raw json.RawMessage `json:"-"`
 }
 
 // SequenceID is a CouchDB update sequence ID. This is just a string, but has
@@ -57,3 +63,10 @@ type RowsWarner interface {
 	// Warning returns the warning generated by the query, if any.
 	Warning() string
 }
+
+// RowsBookmarker is an optional interface, which allows a rows iterator to
+// return a bookmark, for paginating the results of a /_find query.
+type RowsBookmarker interface {
+	// Bookmark returns the opaque bookmark generated by the query, if any.
+	Bookmark() string
+}
@@ -0,0 +1,106 @@
+// +build go1.8
+
+package sqlite
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/flimzy/kivik/driver"
+	"github.com/flimzy/kivik/driver/internal/docstore"
+)
+
+// AllDocs returns the current revisions of the undeleted documents, in order
+// of document ID, or those named by the keys option, in the order given.
+func (d *db) AllDocs(ctx context.Context, options map[string]interface{}) (driver.Rows, error) {
+	opts, err := docstore.ParseAllDocsOptions(options)
+	if err != nil {
+		return nil, err
+	}
+	var updateSeq string
+	if opts.UpdateSeq {
+		seq, err := d.updateSeq(ctx)
+		if err != nil {
+			return nil, err
+		}
+		updateSeq = strconv.FormatInt(seq, 10)
+	}
+	var offset, totalRows int64
+	err = d.db.QueryRowContext(ctx, `SELECT COUNT(*) FROM kivik_docs WHERE db=? AND NOT deleted`, d.dbName).Scan(&totalRows)
+	if err != nil {
+		return nil, sqlError(err)
+	}
+	if opts.Keys != nil {
+		result, err := docstore.KeyRows(docReader{ctx: ctx, d: d, q: d.db}, opts)
+		return docstore.NewRows(result, offset, totalRows, updateSeq), err
+	}
+	where := []string{"db=?", "NOT deleted"}
+	args := []interface{}{d.dbName}
+	lower, upper := opts.StartKey, opts.EndKey
+	lowerOp, upperOp := ">=", "<"
+	if opts.InclusiveEnd {
+		upperOp = "<="
+	}
+	if opts.Descending {
+		lower, upper = upper, lower
+		lowerOp, upperOp = ">", "<="
+		if opts.InclusiveEnd {
+			lowerOp = ">="
+		}
+	}
+	if lower != nil {
+		where = append(where, "id "+lowerOp+" ?")
+		args = append(args, *lower)
+	}
+	if upper != nil {
+		where = append(where, "id "+upperOp+" ?")
+		args = append(args, *upper)
+	}
+	// offset is the number of documents which precede the start key, in the
+	// requested order.
+	if !opts.Descending && lower != nil {
+		err = d.db.QueryRowContext(ctx, `SELECT COUNT(*) FROM kivik_docs WHERE db=? AND NOT deleted AND id < ?`, d.dbName, *lower).Scan(&offset)
+	}
+	if opts.Descending && upper != nil {
+		err = d.db.QueryRowContext(ctx, `SELECT COUNT(*) FROM kivik_docs WHERE db=? AND NOT deleted AND id > ?`, d.dbName, *upper).Scan(&offset)
+	}
+	if err != nil {
+		return nil, sqlError(err)
+	}
+	offset += int64(opts.Skip)
+	order := "ASC"
+	if opts.Descending {
+		order = "DESC"
+	}
+	limit := -1
+	if _, ok := options["limit"]; ok {
+		limit = opts.Limit
+	}
+	query := fmt.Sprintf(`SELECT id, rev, body FROM kivik_docs WHERE %s ORDER BY id %s LIMIT ? OFFSET ?`, strings.Join(where, " AND "), order)
+	args = append(args, limit, opts.Skip)
+	sqlRows, err := d.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, sqlError(err)
+	}
+	defer func() { _ = sqlRows.Close() }()
+	var result []*driver.Row
+	for sqlRows.Next() {
+		var id, rev, body string
+		if err := sqlRows.Scan(&id, &rev, &body); err != nil {
+			return nil, sqlError(err)
+		}
+		result = append(result, allDocsRow(id, rev, body, opts.IncludeDocs))
+	}
+	return docstore.NewRows(result, offset, totalRows, updateSeq), sqlError(sqlRows.Err())
+}
+
+func allDocsRow(id, rev, body string, includeDoc bool) *driver.Row {
+	var doc json.RawMessage
+	if includeDoc {
+		doc = json.RawMessage(body)
+	}
+	return docstore.AllDocsRow(id, rev, false, doc)
+}
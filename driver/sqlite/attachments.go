@@ -0,0 +1,95 @@
+// +build go1.8
+
+package sqlite
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"io"
+	"io/ioutil"
+
+	"github.com/flimzy/kivik"
+	"github.com/flimzy/kivik/driver"
+	"github.com/flimzy/kivik/driver/internal/docstore"
+	"github.com/flimzy/kivik/errors"
+)
+
+var _ driver.AttachmentMetaer = &db{}
+
+func (d *db) loadAttachment(ctx context.Context, q querier, docID, rev, filename string, withData bool) (*docstore.Attachment, error) {
+	att := &docstore.Attachment{Filename: filename}
+	dest := []interface{}{&att.ContentType, &att.Revpos, &att.Digest}
+	query := `SELECT content_type, revpos, digest`
+	if withData {
+		query += `, data`
+		dest = append(dest, &att.Data)
+	}
+	err := q.QueryRowContext(ctx, query+` FROM kivik_attachments WHERE db=? AND id=? AND rev=? AND filename=?`,
+		d.dbName, docID, rev, filename).Scan(dest...)
+	if err != nil {
+		return nil, sqlError(err)
+	}
+	return att, nil
+}
+
+// currentRev returns the current revision of docID, or the revision rev, if
+// it is not empty.
+func (d *db) currentRev(ctx context.Context, q querier, docID, rev string) (string, error) {
+	if rev != "" {
+		return rev, nil
+	}
+	var deleted bool
+	err := q.QueryRowContext(ctx, `SELECT rev, deleted FROM kivik_docs WHERE db=? AND id=?`, d.dbName, docID).Scan(&rev, &deleted)
+	if err != nil {
+		return "", sqlError(err)
+	}
+	if deleted {
+		return "", errors.Status(kivik.StatusNotFound, "deleted")
+	}
+	return rev, nil
+}
+
+func (d *db) GetAttachment(ctx context.Context, docID, rev, filename string) (contentType string, md5sum driver.MD5sum, body io.ReadCloser, err error) {
+	rev, err = d.currentRev(ctx, d.db, docID, rev)
+	if err != nil {
+		return "", driver.MD5sum{}, nil, err
+	}
+	att, err := d.loadAttachment(ctx, d.db, docID, rev, filename, true)
+	if err != nil {
+		return "", driver.MD5sum{}, nil, err
+	}
+	return att.ContentType, att.MD5sum(), ioutil.NopCloser(bytes.NewReader(att.Data)), nil
+}
+
+func (d *db) GetAttachmentMeta(ctx context.Context, docID, rev, filename string) (contentType string, md5sum driver.MD5sum, err error) {
+	rev, err = d.currentRev(ctx, d.db, docID, rev)
+	if err != nil {
+		return "", driver.MD5sum{}, err
+	}
+	att, err := d.loadAttachment(ctx, d.db, docID, rev, filename, false)
+	if err != nil {
+		return "", driver.MD5sum{}, err
+	}
+	return att.ContentType, att.MD5sum(), nil
+}
+
+func (d *db) PutAttachment(ctx context.Context, docID, rev, filename, contentType string, body io.Reader) (newRev string, err error) {
+	data, err := ioutil.ReadAll(body)
+	if err != nil {
+		return "", errors.WrapStatus(kivik.StatusBadRequest, err)
+	}
+	err = d.tx(ctx, func(tx *sql.Tx) error {
+		newRev, err = docstore.PutAttachment(d.store(ctx, tx), docID, rev, filename, contentType, data)
+		return err
+	})
+	return newRev, err
+}
+
+func (d *db) DeleteAttachment(ctx context.Context, docID, rev, filename string) (newRev string, err error) {
+	err = d.tx(ctx, func(tx *sql.Tx) error {
+		newRev, err = docstore.DeleteAttachment(d.store(ctx, tx), docID, rev, filename)
+		return err
+	})
+	return newRev, err
+}
@@ -0,0 +1,56 @@
+// +build go1.8
+
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+
+	"github.com/flimzy/kivik/driver"
+	"github.com/flimzy/kivik/driver/internal/docstore"
+)
+
+// BulkDocs writes all of docs in a single transaction. A document which fails,
+// for instance with a conflict, is reported in its result, and does not
+// prevent the others from being written.
+func (d *db) BulkDocs(ctx context.Context, docs []interface{}) (driver.BulkResults, error) {
+	results := make([]*driver.BulkResult, len(docs))
+	err := d.tx(ctx, func(tx *sql.Tx) error {
+		for i, doc := range docs {
+			result := &driver.BulkResult{}
+			results[i] = result
+			couchDoc, err := docstore.ToDoc(doc)
+			if err != nil {
+				result.Error = err
+				continue
+			}
+			docID, err := docstore.DocID(couchDoc)
+			if err != nil {
+				return err
+			}
+			result.ID = docID
+			// Each document is written within a savepoint, so that a failure
+			// part way through leaves no trace of that document.
+			if _, err := tx.ExecContext(ctx, `SAVEPOINT bulk_doc`); err != nil {
+				return sqlError(err)
+			}
+			result.Rev, result.Error = docstore.Put(d.store(ctx, tx), docID, couchDoc)
+			if err := ctx.Err(); err != nil {
+				return err
+			}
+			if result.Error != nil {
+				if _, err := tx.ExecContext(ctx, `ROLLBACK TO bulk_doc`); err != nil {
+					return sqlError(err)
+				}
+			}
+			if _, err := tx.ExecContext(ctx, `RELEASE bulk_doc`); err != nil {
+				return sqlError(err)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return docstore.NewBulkResults(results), nil
+}
@@ -0,0 +1,67 @@
+// +build go1.8
+
+package sqlite
+
+import (
+	"context"
+	"encoding/json"
+	"strconv"
+
+	"github.com/flimzy/kivik"
+	"github.com/flimzy/kivik/driver"
+	"github.com/flimzy/kivik/driver/internal/docstore"
+	"github.com/flimzy/kivik/errors"
+)
+
+// Changes returns the changes since the requested sequence, as a normal feed,
+// read from the sequence index of kivik_docs. The since, limit, include_docs
+// and filter options are supported. Continuous feeds are not.
+func (d *db) Changes(ctx context.Context, opts map[string]interface{}) (driver.Changes, error) {
+	o, err := docstore.ParseChangesOptions("sqlite", opts)
+	if err != nil {
+		return nil, err
+	}
+	if o.Since < 0 {
+		if o.Since, err = d.updateSeq(ctx); err != nil {
+			return nil, err
+		}
+	}
+	sqlRows, err := d.db.QueryContext(ctx, `SELECT id, rev, seq, deleted, body FROM kivik_docs WHERE db=? AND seq>? ORDER BY seq`, d.dbName, o.Since)
+	if err != nil {
+		return nil, sqlError(err)
+	}
+	defer func() { _ = sqlRows.Close() }()
+	var changes []*driver.Change
+	for sqlRows.Next() {
+		if o.Limit > 0 && len(changes) >= o.Limit {
+			break
+		}
+		var id, rev, body string
+		var seq int64
+		var deleted bool
+		if err := sqlRows.Scan(&id, &rev, &seq, &deleted, &body); err != nil {
+			return nil, sqlError(err)
+		}
+		var doc map[string]interface{}
+		if err := json.Unmarshal([]byte(body), &doc); err != nil {
+			return nil, errors.WrapStatus(kivik.StatusInternalServerError, err)
+		}
+		if !o.Filter.Match(id, doc) {
+			continue
+		}
+		change := &driver.Change{
+			ID:      id,
+			Seq:     driver.SequenceID(strconv.FormatInt(seq, 10)),
+			Deleted: deleted,
+			Changes: driver.ChangedRevs{rev},
+		}
+		if o.IncludeDocs {
+			change.Doc = json.RawMessage(body)
+		}
+		changes = append(changes, change)
+	}
+	if err := sqlRows.Err(); err != nil {
+		return nil, sqlError(err)
+	}
+	return docstore.NewChanges(ctx, changes), nil
+}
@@ -0,0 +1,337 @@
+// +build go1.8
+
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"strconv"
+	"strings"
+
+	"github.com/flimzy/kivik"
+	"github.com/flimzy/kivik/driver"
+	"github.com/flimzy/kivik/driver/internal/docstore"
+	"github.com/flimzy/kivik/errors"
+)
+
+var notImplemented = errors.Status(kivik.StatusNotImplemented, "kivik: not supported by sqlite driver")
+
+type db struct {
+	*client
+	dbName string
+}
+
+var _ driver.DB = &db{}
+var _ driver.Rever = &db{}
+
+func (d *db) Get(ctx context.Context, docID string, opts map[string]interface{}) (json.RawMessage, error) {
+	if strings.HasPrefix(docID, docstore.LocalPrefix) {
+		var body string
+		err := d.db.QueryRowContext(ctx, `SELECT body FROM kivik_local_docs WHERE db=? AND id=?`, d.dbName, docID).Scan(&body)
+		return json.RawMessage(body), sqlError(err)
+	}
+	if rev, ok := opts["rev"].(string); ok {
+		var body sql.NullString
+		err := d.db.QueryRowContext(ctx, `SELECT body FROM kivik_revs WHERE db=? AND id=? AND rev=?`, d.dbName, docID, rev).Scan(&body)
+		if err != nil {
+			return nil, sqlError(err)
+		}
+		if !body.Valid {
+			// Removed by compaction
+			return nil, errors.Status(kivik.StatusNotFound, "missing")
+		}
+		return json.RawMessage(body.String), nil
+	}
+	var body string
+	var deleted bool
+	err := d.db.QueryRowContext(ctx, `SELECT body, deleted FROM kivik_docs WHERE db=? AND id=?`, d.dbName, docID).Scan(&body, &deleted)
+	if err != nil {
+		return nil, sqlError(err)
+	}
+	if deleted {
+		return nil, errors.Status(kivik.StatusNotFound, "deleted")
+	}
+	return json.RawMessage(body), nil
+}
+
+// Rev returns the current revision of the document, without reading its body.
+func (d *db) Rev(ctx context.Context, docID string) (string, error) {
+	if strings.HasPrefix(docID, docstore.LocalPrefix) {
+		var revNum int64
+		err := d.db.QueryRowContext(ctx, `SELECT rev_num FROM kivik_local_docs WHERE db=? AND id=?`, d.dbName, docID).Scan(&revNum)
+		return docstore.LocalRev(revNum), sqlError(err)
+	}
+	var rev string
+	var deleted bool
+	err := d.db.QueryRowContext(ctx, `SELECT rev, deleted FROM kivik_docs WHERE db=? AND id=?`, d.dbName, docID).Scan(&rev, &deleted)
+	if err != nil {
+		return "", sqlError(err)
+	}
+	if deleted {
+		return "", errors.Status(kivik.StatusNotFound, "deleted")
+	}
+	return rev, nil
+}
+
+func (d *db) CreateDoc(ctx context.Context, doc interface{}) (docID, rev string, err error) {
+	couchDoc, err := docstore.ToDoc(doc)
+	if err != nil {
+		return "", "", err
+	}
+	if id, ok := couchDoc["_id"].(string); ok {
+		docID = id
+	} else if docID, err = docstore.RandomID(); err != nil {
+		return "", "", err
+	}
+	err = d.tx(ctx, func(tx *sql.Tx) error {
+		rev, err = docstore.Put(d.store(ctx, tx), docID, couchDoc)
+		return err
+	})
+	return docID, rev, err
+}
+
+func (d *db) Put(ctx context.Context, docID string, doc interface{}) (rev string, err error) {
+	couchDoc, err := docstore.ToDoc(doc)
+	if err != nil {
+		return "", err
+	}
+	err = d.tx(ctx, func(tx *sql.Tx) error {
+		rev, err = docstore.Put(d.store(ctx, tx), docID, couchDoc)
+		return err
+	})
+	return rev, err
+}
+
+func (d *db) Delete(ctx context.Context, docID, rev string) (newRev string, err error) {
+	if !strings.HasPrefix(docID, docstore.LocalPrefix) {
+		if _, _, err := docstore.ParseRev(rev); err != nil {
+			return "", err
+		}
+	}
+	err = d.tx(ctx, func(tx *sql.Tx) error {
+		newRev, err = docstore.Put(d.store(ctx, tx), docID, docstore.Doc{"_rev": rev, "_deleted": true})
+		return err
+	})
+	return newRev, err
+}
+
+// docReader is the docstore.Reader of the database, through q.
+type docReader struct {
+	ctx context.Context
+	d   *db
+	q   querier
+}
+
+var _ docstore.Reader = docReader{}
+
+func (r docReader) Current(docID string) (string, bool, error) {
+	var rev string
+	var deleted bool
+	err := r.q.QueryRowContext(r.ctx, `SELECT rev, deleted FROM kivik_docs WHERE db=? AND id=?`, r.d.dbName, docID).Scan(&rev, &deleted)
+	if err == sql.ErrNoRows {
+		return "", false, nil
+	}
+	return rev, deleted, sqlError(err)
+}
+
+func (r docReader) Body(docID, rev string) (json.RawMessage, error) {
+	var body sql.NullString
+	err := r.q.QueryRowContext(r.ctx, `SELECT body FROM kivik_revs WHERE db=? AND id=? AND rev=?`, r.d.dbName, docID, rev).Scan(&body)
+	if err != nil {
+		return nil, sqlError(err)
+	}
+	if !body.Valid {
+		// Removed by compaction
+		return nil, errors.Status(kivik.StatusNotFound, "missing")
+	}
+	return json.RawMessage(body.String), nil
+}
+
+// store is the docstore.Store of the database, within tx.
+type store struct {
+	docReader
+	tx *sql.Tx
+}
+
+var _ docstore.Store = &store{}
+
+func (d *db) store(ctx context.Context, tx *sql.Tx) *store {
+	return &store{docReader: docReader{ctx: ctx, d: d, q: tx}, tx: tx}
+}
+
+func (s *store) Attachment(docID, rev, filename string) (*docstore.Attachment, error) {
+	return s.d.loadAttachment(s.ctx, s.tx, docID, rev, filename, true)
+}
+
+// WriteRevision inserts the revision into kivik_revs, and its attachments into
+// kivik_attachments, and replaces the row of the document in kivik_docs, which
+// holds a copy of the current revision's body.
+func (s *store) WriteRevision(docID string, r *docstore.Revision) error {
+	ctx, d, tx := s.ctx, s.d, s.tx
+	seq, err := d.nextSeq(ctx, tx)
+	if err != nil {
+		return err
+	}
+	var parent interface{}
+	if r.Parent != "" {
+		parent = r.Parent
+	}
+	if _, err := tx.ExecContext(ctx, `INSERT INTO kivik_revs (db, id, rev, rev_num, parent, seq, deleted, body) VALUES (?, ?, ?, ?, ?, ?, ?, ?)`,
+		d.dbName, docID, r.Rev, r.Num, parent, seq, r.Deleted, string(r.Body)); err != nil {
+		return sqlError(err)
+	}
+	if _, err := tx.ExecContext(ctx, `INSERT OR REPLACE INTO kivik_docs (db, id, rev, seq, deleted, body) VALUES (?, ?, ?, ?, ?, ?)`,
+		d.dbName, docID, r.Rev, seq, r.Deleted, string(r.Body)); err != nil {
+		return sqlError(err)
+	}
+	for _, att := range r.Attachments {
+		if _, err := tx.ExecContext(ctx, `INSERT INTO kivik_attachments (db, id, rev, filename, content_type, revpos, digest, data) VALUES (?, ?, ?, ?, ?, ?, ?, ?)`,
+			d.dbName, docID, r.Rev, att.Filename, att.ContentType, att.Revpos, att.Digest, att.Data); err != nil {
+			return sqlError(err)
+		}
+	}
+	return nil
+}
+
+func (s *store) LocalRev(docID string) (string, error) {
+	var revNum int64
+	err := s.tx.QueryRowContext(s.ctx, `SELECT rev_num FROM kivik_local_docs WHERE db=? AND id=?`, s.d.dbName, docID).Scan(&revNum)
+	switch {
+	case err == sql.ErrNoRows:
+		return "", nil
+	case err != nil:
+		return "", sqlError(err)
+	}
+	return docstore.LocalRev(revNum), nil
+}
+
+func (s *store) WriteLocal(docID string, revNum int64, doc docstore.Doc) error {
+	if doc.Deleted() {
+		_, err := s.tx.ExecContext(s.ctx, `DELETE FROM kivik_local_docs WHERE db=? AND id=?`, s.d.dbName, docID)
+		return sqlError(err)
+	}
+	body, err := json.Marshal(doc)
+	if err != nil {
+		return errors.WrapStatus(kivik.StatusBadRequest, err)
+	}
+	_, err = s.tx.ExecContext(s.ctx, `INSERT OR REPLACE INTO kivik_local_docs (db, id, rev_num, body) VALUES (?, ?, ?, ?)`,
+		s.d.dbName, docID, revNum, string(body))
+	return sqlError(err)
+}
+
+// nextSeq increments and returns the database's update sequence.
+func (d *db) nextSeq(ctx context.Context, tx *sql.Tx) (int64, error) {
+	result, err := tx.ExecContext(ctx, `UPDATE kivik_dbs SET update_seq=update_seq+1 WHERE name=?`, d.dbName)
+	if err != nil {
+		return 0, sqlError(err)
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		return 0, errors.Status(kivik.StatusNotFound, "database does not exist")
+	}
+	var seq int64
+	err = tx.QueryRowContext(ctx, `SELECT update_seq FROM kivik_dbs WHERE name=?`, d.dbName).Scan(&seq)
+	return seq, sqlError(err)
+}
+
+func (d *db) updateSeq(ctx context.Context) (int64, error) {
+	var seq int64
+	err := d.db.QueryRowContext(ctx, `SELECT update_seq FROM kivik_dbs WHERE name=?`, d.dbName).Scan(&seq)
+	return seq, sqlError(err)
+}
+
+// Stats sums the lengths of the body and data columns. DiskSize covers every
+// row of kivik_revs and kivik_attachments, and ActiveSize and ExternalSize
+// only the current revisions of undeleted documents, through kivik_docs.
+func (d *db) Stats(ctx context.Context) (*driver.DBStats, error) {
+	stats := &driver.DBStats{Name: d.dbName}
+	seq, err := d.updateSeq(ctx)
+	if err != nil {
+		return nil, err
+	}
+	stats.UpdateSeq = strconv.FormatInt(seq, 10)
+	err = d.db.QueryRowContext(ctx, `SELECT
+			COALESCE(SUM(CASE WHEN deleted THEN 0 ELSE 1 END), 0),
+			COALESCE(SUM(CASE WHEN deleted THEN 1 ELSE 0 END), 0),
+			COALESCE(SUM(CASE WHEN deleted THEN 0 ELSE LENGTH(body) END), 0)
+		FROM kivik_docs WHERE db=?`, d.dbName).Scan(&stats.DocCount, &stats.DeletedCount, &stats.ActiveSize)
+	if err != nil {
+		return nil, sqlError(err)
+	}
+	var activeAtts, revsSize, attsSize int64
+	err = d.db.QueryRowContext(ctx, `SELECT COALESCE(SUM(LENGTH(a.data)), 0)
+		FROM kivik_attachments a JOIN kivik_docs d ON a.db=d.db AND a.id=d.id AND a.rev=d.rev
+		WHERE a.db=?`, d.dbName).Scan(&activeAtts)
+	if err != nil {
+		return nil, sqlError(err)
+	}
+	err = d.db.QueryRowContext(ctx, `SELECT COALESCE(SUM(LENGTH(body)), 0) FROM kivik_revs WHERE db=?`, d.dbName).Scan(&revsSize)
+	if err != nil {
+		return nil, sqlError(err)
+	}
+	err = d.db.QueryRowContext(ctx, `SELECT COALESCE(SUM(LENGTH(data)), 0) FROM kivik_attachments WHERE db=?`, d.dbName).Scan(&attsSize)
+	if err != nil {
+		return nil, sqlError(err)
+	}
+	stats.ActiveSize += activeAtts
+	stats.ExternalSize = stats.ActiveSize
+	stats.DiskSize = revsSize + attsSize
+	return stats, nil
+}
+
+// Compact sets the body column of non-current rows of kivik_revs to NULL,
+// keeping the rows for the revision history, and deletes their rows from
+// kivik_attachments.
+func (d *db) Compact(ctx context.Context) error {
+	return d.tx(ctx, func(tx *sql.Tx) error {
+		if _, err := tx.ExecContext(ctx, `UPDATE kivik_revs SET body=NULL WHERE db=? AND NOT EXISTS (
+				SELECT 1 FROM kivik_docs d WHERE d.db=kivik_revs.db AND d.id=kivik_revs.id AND d.rev=kivik_revs.rev
+			)`, d.dbName); err != nil {
+			return sqlError(err)
+		}
+		_, err := tx.ExecContext(ctx, `DELETE FROM kivik_attachments WHERE db=? AND NOT EXISTS (
+				SELECT 1 FROM kivik_docs d WHERE d.db=kivik_attachments.db AND d.id=kivik_attachments.id AND d.rev=kivik_attachments.rev
+			)`, d.dbName)
+		return sqlError(err)
+	})
+}
+
+func (d *db) CompactView(_ context.Context, _ string) error {
+	return notImplemented
+}
+
+func (d *db) ViewCleanup(_ context.Context) error {
+	return notImplemented
+}
+
+func (d *db) Query(_ context.Context, _, _ string, _ map[string]interface{}) (driver.Rows, error) {
+	return nil, notImplemented
+}
+
+func (d *db) Security(ctx context.Context) (*driver.Security, error) {
+	var secJSON string
+	err := d.db.QueryRowContext(ctx, `SELECT security FROM kivik_dbs WHERE name=?`, d.dbName).Scan(&secJSON)
+	if err != nil {
+		return nil, sqlError(err)
+	}
+	sec := &driver.Security{}
+	if err := json.Unmarshal([]byte(secJSON), sec); err != nil {
+		return nil, errors.WrapStatus(kivik.StatusInternalServerError, err)
+	}
+	return sec, nil
+}
+
+func (d *db) SetSecurity(ctx context.Context, sec *driver.Security) error {
+	secJSON, err := json.Marshal(sec)
+	if err != nil {
+		return errors.WrapStatus(kivik.StatusBadRequest, err)
+	}
+	result, err := d.db.ExecContext(ctx, `UPDATE kivik_dbs SET security=? WHERE name=?`, string(secJSON), d.dbName)
+	if err != nil {
+		return sqlError(err)
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		return errors.Status(kivik.StatusNotFound, "missing")
+	}
+	return nil
+}
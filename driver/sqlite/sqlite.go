@@ -0,0 +1,249 @@
+// +build go1.8
+
+// Package sqlite provides a Kivik driver which stores all of its databases in
+// a single SQLite file, by way of database/sql. It offers an embedded, durable
+// and transactional store, for applications which outgrow the memory driver,
+// but do not warrant a CouchDB server.
+//
+// The package does not import a SQLite database/sql driver itself. Import one
+// which registers itself as "sqlite3", such as github.com/mattn/go-sqlite3:
+//
+//	import (
+//		_ "github.com/flimzy/kivik/driver/sqlite"
+//		_ "github.com/mattn/go-sqlite3"
+//	)
+//
+//	client, err := kivik.New(ctx, "sqlite", "/path/to/kivik.db")
+//
+// The DSN is passed to the SQLite driver unchanged. Documents are stored with
+// their full revision history, which Compact prunes to the current revisions,
+// and attachments are stored inline, as blobs. Views, Mango queries and
+// continuous changes feeds are not supported.
+//
+// The driver requires Go 1.8 or later, for the context support of
+// database/sql.
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+
+	"github.com/flimzy/kivik"
+	"github.com/flimzy/kivik/driver"
+	"github.com/flimzy/kivik/driver/common"
+	"github.com/flimzy/kivik/errors"
+)
+
+// Identifying constants
+const (
+	Version = "0.0.1"
+	Vendor  = "Kivik SQLite Adaptor"
+)
+
+// SQLDriverName is the name of the database/sql driver used to open the SQLite
+// file.
+const SQLDriverName = "sqlite3"
+
+type sqliteDriver struct{}
+
+var _ driver.Driver = &sqliteDriver{}
+
+func init() {
+	kivik.Register("sqlite", &sqliteDriver{})
+}
+
+// schema creates the tables, if necessary. Every kivik database shares the
+// same tables, keyed by database name.
+var schema = []string{
+	`CREATE TABLE IF NOT EXISTS kivik_dbs (
+		name TEXT PRIMARY KEY,
+		security TEXT NOT NULL,
+		update_seq INTEGER NOT NULL
+	)`,
+	// kivik_revs holds every revision of every document, linked to its parent
+	// revision, to form the revision tree. body is NULL for revisions
+	// removed by compaction.
+	`CREATE TABLE IF NOT EXISTS kivik_revs (
+		db TEXT NOT NULL,
+		id TEXT NOT NULL,
+		rev TEXT NOT NULL,
+		rev_num INTEGER NOT NULL,
+		parent TEXT,
+		seq INTEGER NOT NULL,
+		deleted INTEGER NOT NULL,
+		body TEXT,
+		PRIMARY KEY (db, id, rev)
+	)`,
+	// kivik_docs holds the current revision of each document, and serves
+	// AllDocs, in document ID order, and the changes feed, in sequence order.
+	`CREATE TABLE IF NOT EXISTS kivik_docs (
+		db TEXT NOT NULL,
+		id TEXT NOT NULL,
+		rev TEXT NOT NULL,
+		seq INTEGER NOT NULL,
+		deleted INTEGER NOT NULL,
+		body TEXT NOT NULL,
+		PRIMARY KEY (db, id)
+	)`,
+	`CREATE INDEX IF NOT EXISTS kivik_docs_seq ON kivik_docs (db, seq)`,
+	`CREATE TABLE IF NOT EXISTS kivik_local_docs (
+		db TEXT NOT NULL,
+		id TEXT NOT NULL,
+		rev_num INTEGER NOT NULL,
+		body TEXT NOT NULL,
+		PRIMARY KEY (db, id)
+	)`,
+	`CREATE TABLE IF NOT EXISTS kivik_attachments (
+		db TEXT NOT NULL,
+		id TEXT NOT NULL,
+		rev TEXT NOT NULL,
+		filename TEXT NOT NULL,
+		content_type TEXT NOT NULL,
+		revpos INTEGER NOT NULL,
+		digest BLOB NOT NULL,
+		data BLOB NOT NULL,
+		PRIMARY KEY (db, id, rev, filename)
+	)`,
+}
+
+func (d *sqliteDriver) NewClient(ctx context.Context, dsn string) (driver.Client, error) {
+	sqlDB, err := sql.Open(SQLDriverName, dsn)
+	if err != nil {
+		return nil, errors.Wrap(err, "kivik: failed to open SQLite database")
+	}
+	// SQLite serializes writes to the file, so a single connection avoids
+	// "database is locked" errors, at no cost in write concurrency.
+	sqlDB.SetMaxOpenConns(1)
+	for _, stmt := range schema {
+		if _, err := sqlDB.ExecContext(ctx, stmt); err != nil {
+			_ = sqlDB.Close()
+			return nil, errors.Wrap(err, "kivik: failed to initialize SQLite database")
+		}
+	}
+	return &client{
+		Client: common.NewClient(Version, Vendor),
+		db:     sqlDB,
+	}, nil
+}
+
+type client struct {
+	*common.Client
+	db *sql.DB
+}
+
+var _ driver.Client = &client{}
+
+// dbTables are the tables holding the contents of each database.
+var dbTables = []string{"kivik_revs", "kivik_docs", "kivik_local_docs", "kivik_attachments"}
+
+func (c *client) AllDBs(ctx context.Context, _ map[string]interface{}) ([]string, error) {
+	rows, err := c.db.QueryContext(ctx, `SELECT name FROM kivik_dbs ORDER BY name`)
+	if err != nil {
+		return nil, sqlError(err)
+	}
+	defer func() { _ = rows.Close() }()
+	dbs := []string{}
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			return nil, sqlError(err)
+		}
+		dbs = append(dbs, name)
+	}
+	return dbs, sqlError(rows.Err())
+}
+
+func (c *client) DBExists(ctx context.Context, dbName string, _ map[string]interface{}) (bool, error) {
+	return dbExists(ctx, c.db, dbName)
+}
+
+// querier is satisfied by both *sql.DB and *sql.Tx.
+type querier interface {
+	ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error)
+	QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error)
+	QueryRowContext(ctx context.Context, query string, args ...interface{}) *sql.Row
+}
+
+func dbExists(ctx context.Context, q querier, dbName string) (bool, error) {
+	var n int
+	err := q.QueryRowContext(ctx, `SELECT COUNT(*) FROM kivik_dbs WHERE name=?`, dbName).Scan(&n)
+	return n > 0, sqlError(err)
+}
+
+func (c *client) CreateDB(ctx context.Context, dbName string, _ map[string]interface{}) error {
+	if !kivik.ValidDBName(dbName) {
+		return errors.NamedStatus(kivik.StatusBadRequest, "illegal_database_name", "invalid database name")
+	}
+	return c.tx(ctx, func(tx *sql.Tx) error {
+		exists, err := dbExists(ctx, tx, dbName)
+		if err != nil {
+			return err
+		}
+		if exists {
+			return errors.Status(kivik.StatusPreconditionFailed, "database exists")
+		}
+		sec, _ := json.Marshal(&driver.Security{})
+		_, err = tx.ExecContext(ctx, `INSERT INTO kivik_dbs (name, security, update_seq) VALUES (?, ?, 0)`, dbName, string(sec))
+		return sqlError(err)
+	})
+}
+
+func (c *client) DestroyDB(ctx context.Context, dbName string, _ map[string]interface{}) error {
+	return c.tx(ctx, func(tx *sql.Tx) error {
+		result, err := tx.ExecContext(ctx, `DELETE FROM kivik_dbs WHERE name=?`, dbName)
+		if err != nil {
+			return sqlError(err)
+		}
+		if n, _ := result.RowsAffected(); n == 0 {
+			return errors.Status(kivik.StatusNotFound, "database does not exist")
+		}
+		for _, table := range dbTables {
+			if _, err := tx.ExecContext(ctx, `DELETE FROM `+table+` WHERE db=?`, dbName); err != nil {
+				return sqlError(err)
+			}
+		}
+		return nil
+	})
+}
+
+func (c *client) DB(ctx context.Context, dbName string, _ map[string]interface{}) (driver.DB, error) {
+	exists, err := c.DBExists(ctx, dbName, nil)
+	if err != nil {
+		return nil, err
+	}
+	if !exists {
+		return nil, errors.Status(kivik.StatusNotFound, "database does not exist")
+	}
+	return &db{
+		client: c,
+		dbName: dbName,
+	}, nil
+}
+
+// tx calls fn within a transaction, which is committed if fn returns nil, and
+// rolled back otherwise.
+func (c *client) tx(ctx context.Context, fn func(*sql.Tx) error) error {
+	tx, err := c.db.BeginTx(ctx, nil)
+	if err != nil {
+		return sqlError(err)
+	}
+	if err := fn(tx); err != nil {
+		_ = tx.Rollback()
+		return err
+	}
+	return sqlError(tx.Commit())
+}
+
+// sqlError converts an error returned by database/sql to a kivik error.
+func sqlError(err error) error {
+	switch err {
+	case nil:
+		return nil
+	case context.Canceled, context.DeadlineExceeded:
+		return err
+	case sql.ErrNoRows:
+		return errors.Status(kivik.StatusNotFound, "missing")
+	}
+	return errors.WrapStatus(kivik.StatusInternalServerError, err)
+}
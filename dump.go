@@ -0,0 +1,225 @@
+package kivik
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"strings"
+
+	"github.com/flimzy/kivik/errors"
+)
+
+// restoreBatchSize is the number of documents restored with each BulkDocs
+// request.
+const restoreBatchSize = 100
+
+// dumpRecord is a single line of a dump. The first record for each database
+// includes its security object, and has no document.
+type dumpRecord struct {
+	DB       string          `json:"db"`
+	Security *Security       `json:"security,omitempty"`
+	Doc      json.RawMessage `json:"doc,omitempty"`
+}
+
+// Dump writes the named databases to w, or all databases except system
+// databases, whose names begin with an underscore, if none are named. Each
+// document is written with its revision history and attachments.
+//
+// The dump is line-delimited JSON, with one object per line. The first line
+// for each database has the fields "db", the name of the database, and
+// "security", its security object, if supported by the driver. It is followed
+// by one line for each document, with the fields "db" and "doc", the document.
+// Deleted documents are not included.
+//
+// Each document is written at the revision listed by AllDocs, so that, where
+// AllDocs reads from a snapshot of the database, as CouchDB does, the dump of
+// each database is a consistent snapshot, unaffected by concurrent updates.
+func (c *Client) Dump(ctx context.Context, w io.Writer, dbs ...string) error {
+	if len(dbs) == 0 {
+		all, err := c.AllDBs(ctx)
+		if err != nil {
+			return err
+		}
+		for _, dbName := range all {
+			if !strings.HasPrefix(dbName, "_") {
+				dbs = append(dbs, dbName)
+			}
+		}
+	}
+	enc := json.NewEncoder(w)
+	for _, dbName := range dbs {
+		if err := c.dumpDB(ctx, enc, dbName); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (c *Client) dumpDB(ctx context.Context, enc *json.Encoder, dbName string) error {
+	db, err := c.DB(ctx, dbName)
+	if err != nil {
+		return err
+	}
+	header := dumpRecord{DB: dbName}
+	header.Security, err = db.Security(ctx)
+	if err != nil && StatusCode(err) != StatusNotImplemented {
+		return err
+	}
+	if err = enc.Encode(header); err != nil {
+		return err
+	}
+	return eachDoc(ctx, db, func(doc json.RawMessage) error {
+		return enc.Encode(dumpRecord{DB: dbName, Doc: doc})
+	})
+}
+
+// eachDoc calls fn with each document of db, with its revision history and
+// attachments, as written by Dump.
+func eachDoc(ctx context.Context, db *DB, fn func(json.RawMessage) error) error {
+	rows, err := db.AllDocs(ctx)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = rows.Close() }()
+	for rows.Next() {
+		opts := Options{"revs": true, "attachments": true}
+		var value struct {
+			Rev string `json:"rev"`
+		}
+		if rows.ScanValue(&value) == nil && value.Rev != "" {
+			opts["rev"] = value.Rev
+		}
+		row, err := db.Get(ctx, rows.ID(), opts)
+		if err != nil {
+			return err
+		}
+		var doc json.RawMessage
+		if err = row.ScanDoc(&doc); err != nil {
+			return err
+		}
+		if err = fn(doc); err != nil {
+			return err
+		}
+	}
+	return rows.Err()
+}
+
+// Restore reads a dump written by Dump from r, creating the databases as
+// necessary. Existing documents are not removed.
+//
+// Documents are restored with their revision histories, using BulkDocs with
+// new_edits=false. If the driver does not support this, only the current
+// revision of each document is restored, replacing any existing revision.
+func (c *Client) Restore(ctx context.Context, r io.Reader) error {
+	dec := json.NewDecoder(r)
+	var db *DB
+	var dbName string
+	var batch []interface{}
+	for {
+		var record dumpRecord
+		err := dec.Decode(&record)
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return errors.WrapStatus(StatusBadRequest, err)
+		}
+		if record.DB != dbName || len(batch) == restoreBatchSize {
+			if err = restoreDocs(ctx, db, batch); err != nil {
+				return err
+			}
+			batch = nil
+		}
+		if db == nil || record.DB != dbName {
+			if db, err = c.restoreDB(ctx, record); err != nil {
+				return err
+			}
+			dbName = record.DB
+		}
+		if record.Doc != nil {
+			batch = append(batch, record.Doc)
+		}
+	}
+	return restoreDocs(ctx, db, batch)
+}
+
+// restoreDB creates the database named in record, if necessary, and restores
+// its security object.
+func (c *Client) restoreDB(ctx context.Context, record dumpRecord) (*DB, error) {
+	if record.DB == "" {
+		return nil, errors.Status(StatusBadRequest, "kivik: dump record has no database name")
+	}
+	exists, err := c.DBExists(ctx, record.DB)
+	if err != nil {
+		return nil, err
+	}
+	if !exists {
+		if err = c.CreateDB(ctx, record.DB); err != nil {
+			return nil, err
+		}
+	}
+	db, err := c.DB(ctx, record.DB)
+	if err != nil {
+		return nil, err
+	}
+	if record.Security != nil {
+		if err = db.SetSecurity(ctx, record.Security); err != nil && StatusCode(err) != StatusNotImplemented {
+			return nil, err
+		}
+	}
+	return db, nil
+}
+
+func restoreDocs(ctx context.Context, db *DB, docs []interface{}) error {
+	if len(docs) == 0 {
+		return nil
+	}
+	results, err := db.BulkDocs(ctx, docs, Options{"new_edits": false})
+	if StatusCode(err) == StatusNotImplemented {
+		return restoreCurrent(ctx, db, docs)
+	}
+	if err != nil {
+		return err
+	}
+	defer func() { _ = results.Close() }()
+	for results.Next() {
+		if err = results.UpdateErr(); err != nil {
+			return errors.Wrapf(err, "restore %s", results.ID())
+		}
+	}
+	return results.Err()
+}
+
+// restoreCurrent restores the current revision of each document, for drivers
+// which cannot restore revision histories.
+func restoreCurrent(ctx context.Context, db *DB, docs []interface{}) error {
+	for _, d := range docs {
+		// BulkDocs may have replaced the raw JSON with its decoded form.
+		raw, err := json.Marshal(d)
+		if err != nil {
+			return errors.WrapStatus(StatusBadRequest, err)
+		}
+		var doc map[string]json.RawMessage
+		if err = json.Unmarshal(raw, &doc); err != nil {
+			return errors.WrapStatus(StatusBadRequest, err)
+		}
+		var docID string
+		if err := json.Unmarshal(doc["_id"], &docID); err != nil || docID == "" {
+			return errors.Status(StatusBadRequest, "kivik: dumped document has no _id")
+		}
+		delete(doc, "_rev")
+		delete(doc, "_revisions")
+		rev, err := db.Rev(ctx, docID)
+		switch {
+		case StatusCode(err) == StatusNotFound:
+		case err != nil:
+			return err
+		default:
+			doc["_rev"], _ = json.Marshal(rev)
+		}
+		if _, err = db.Put(ctx, docID, doc); err != nil {
+			return errors.Wrapf(err, "restore %s", docID)
+		}
+	}
+	return nil
+}
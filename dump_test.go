@@ -0,0 +1,235 @@
+package kivik
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"sort"
+	"testing"
+
+	"github.com/flimzy/diff"
+	"github.com/flimzy/kivik/driver"
+	"github.com/flimzy/kivik/errors"
+)
+
+// dumpClient stores documents as raw JSON, by database and ID.
+type dumpClient struct {
+	driver.Client
+	dbs      map[string]map[string]json.RawMessage
+	security map[string]*driver.Security
+	// bulk enables support for BulkDocs options.
+	bulk bool
+}
+
+func newDumpClient(bulk bool) *dumpClient {
+	return &dumpClient{
+		dbs:      make(map[string]map[string]json.RawMessage),
+		security: make(map[string]*driver.Security),
+		bulk:     bulk,
+	}
+}
+
+func (c *dumpClient) AllDBs(_ context.Context, _ map[string]interface{}) ([]string, error) {
+	var dbs []string
+	for dbName := range c.dbs {
+		dbs = append(dbs, dbName)
+	}
+	sort.Strings(dbs)
+	return dbs, nil
+}
+
+func (c *dumpClient) DBExists(_ context.Context, dbName string, _ map[string]interface{}) (bool, error) {
+	_, ok := c.dbs[dbName]
+	return ok, nil
+}
+
+func (c *dumpClient) CreateDB(_ context.Context, dbName string, _ map[string]interface{}) error {
+	c.dbs[dbName] = make(map[string]json.RawMessage)
+	return nil
+}
+
+func (c *dumpClient) DestroyDB(_ context.Context, dbName string, _ map[string]interface{}) error {
+	delete(c.dbs, dbName)
+	delete(c.security, dbName)
+	return nil
+}
+
+func (c *dumpClient) DB(_ context.Context, dbName string, _ map[string]interface{}) (driver.DB, error) {
+	db := &dumpDB{client: c, name: dbName}
+	if c.bulk {
+		return &dumpBulkDB{dumpDB: db}, nil
+	}
+	return db, nil
+}
+
+type dumpDB struct {
+	dummyDB
+	client *dumpClient
+	name   string
+}
+
+func (db *dumpDB) AllDocs(_ context.Context, _ map[string]interface{}) (driver.Rows, error) {
+	rows := &dumpRows{}
+	for id := range db.client.dbs[db.name] {
+		rows.ids = append(rows.ids, id)
+	}
+	sort.Strings(rows.ids)
+	return rows, nil
+}
+
+func (db *dumpDB) Get(_ context.Context, docID string, _ map[string]interface{}) (json.RawMessage, error) {
+	doc, ok := db.client.dbs[db.name][docID]
+	if !ok {
+		return nil, errors.Status(StatusNotFound, "missing")
+	}
+	return doc, nil
+}
+
+func (db *dumpDB) Put(_ context.Context, docID string, doc interface{}) (string, error) {
+	db.client.dbs[db.name][docID], _ = json.Marshal(doc)
+	return "1-xxx", nil
+}
+
+func (db *dumpDB) Security(_ context.Context) (*driver.Security, error) {
+	return db.client.security[db.name], nil
+}
+
+func (db *dumpDB) SetSecurity(_ context.Context, sec *driver.Security) error {
+	db.client.security[db.name] = sec
+	return nil
+}
+
+type dumpBulkDB struct {
+	*dumpDB
+}
+
+func (db *dumpBulkDB) BulkDocsOpts(_ context.Context, docs []interface{}, opts map[string]interface{}) (driver.BulkResults, error) {
+	if opts["new_edits"] != false {
+		return nil, errors.Status(StatusBadRequest, "new_edits=false expected")
+	}
+	for _, doc := range docs {
+		var meta struct {
+			ID string `json:"_id"`
+		}
+		raw, _ := json.Marshal(doc)
+		_ = json.Unmarshal(raw, &meta)
+		db.client.dbs[db.name][meta.ID] = raw
+	}
+	return &dumpBulkResults{}, nil
+}
+
+type dumpBulkResults struct{}
+
+func (r *dumpBulkResults) Next(_ *driver.BulkResult) error { return io.EOF }
+func (r *dumpBulkResults) Close() error                    { return nil }
+
+type dumpRows struct {
+	ids []string
+	// revs, if set, are the revs listed for each document.
+	revs map[string]string
+}
+
+func (r *dumpRows) Next(row *driver.Row) error {
+	if len(r.ids) == 0 {
+		return io.EOF
+	}
+	row.ID, r.ids = r.ids[0], r.ids[1:]
+	if rev, ok := r.revs[row.ID]; ok {
+		row.Value, _ = json.Marshal(map[string]string{"rev": rev})
+	}
+	return nil
+}
+
+func (r *dumpRows) Close() error      { return nil }
+func (r *dumpRows) UpdateSeq() string { return "" }
+func (r *dumpRows) Offset() int64     { return 0 }
+func (r *dumpRows) TotalRows() int64  { return 0 }
+
+func TestDumpRestore(t *testing.T) {
+	ctx := context.Background()
+	source := newDumpClient(false)
+	source.dbs["foo"] = map[string]json.RawMessage{
+		"a": json.RawMessage(`{"_id":"a","_rev":"2-bbb","_revisions":{"start":2,"ids":["bbb","aaa"]}}`),
+		"b": json.RawMessage(`{"_id":"b","_rev":"1-ccc","_revisions":{"start":1,"ids":["ccc"]},"x":1}`),
+	}
+	source.dbs["_users"] = map[string]json.RawMessage{
+		"x": json.RawMessage(`{"_id":"x"}`),
+	}
+	source.security["foo"] = &driver.Security{Admins: driver.Members{Names: []string{"bob"}}}
+	buf := &bytes.Buffer{}
+	if err := (&Client{driverClient: source}).Dump(ctx, buf); err != nil {
+		t.Fatal(err)
+	}
+	expected := `{"db":"foo","security":{"admins":{"names":["bob"]},"members":{}}}
+{"db":"foo","doc":{"_id":"a","_rev":"2-bbb","_revisions":{"start":2,"ids":["bbb","aaa"]}}}
+{"db":"foo","doc":{"_id":"b","_rev":"1-ccc","_revisions":{"start":1,"ids":["ccc"]},"x":1}}
+`
+	if d := diff.Text(expected, buf.String()); d != "" {
+		t.Fatal(d)
+	}
+
+	t.Run("WithRevisions", func(t *testing.T) {
+		target := newDumpClient(true)
+		if err := (&Client{driverClient: target}).Restore(ctx, bytes.NewReader(buf.Bytes())); err != nil {
+			t.Fatal(err)
+		}
+		if d := diff.AsJSON(source.dbs["foo"], target.dbs["foo"]); d != "" {
+			t.Error(d)
+		}
+		if d := diff.Interface(source.security["foo"], target.security["foo"]); d != "" {
+			t.Error(d)
+		}
+	})
+	t.Run("CurrentRevision", func(t *testing.T) {
+		target := newDumpClient(false)
+		if err := (&Client{driverClient: target}).Restore(ctx, bytes.NewReader(buf.Bytes())); err != nil {
+			t.Fatal(err)
+		}
+		expected := map[string]json.RawMessage{
+			"a": json.RawMessage(`{"_id":"a"}`),
+			"b": json.RawMessage(`{"_id":"b","x":1}`),
+		}
+		if d := diff.AsJSON(expected, target.dbs["foo"]); d != "" {
+			t.Error(d)
+		}
+	})
+	t.Run("Invalid", func(t *testing.T) {
+		target := newDumpClient(true)
+		err := (&Client{driverClient: target}).Restore(ctx, bytes.NewReader([]byte(`{"doc":{}}`)))
+		if StatusCode(err) != StatusBadRequest {
+			t.Errorf("Unexpected error: %v", err)
+		}
+	})
+}
+
+// snapshotDB lists each document at rev 1, and returns rev 1 only if
+// requested, as if each had been updated since the listing.
+type snapshotDB struct {
+	dummyDB
+}
+
+func (db *snapshotDB) AllDocs(_ context.Context, _ map[string]interface{}) (driver.Rows, error) {
+	return &dumpRows{ids: []string{"a"}, revs: map[string]string{"a": "1-xxx"}}, nil
+}
+
+func (db *snapshotDB) Get(_ context.Context, _ string, opts map[string]interface{}) (json.RawMessage, error) {
+	if opts["rev"] == "1-xxx" {
+		return json.RawMessage(`{"_id":"a","_rev":"1-xxx"}`), nil
+	}
+	return json.RawMessage(`{"_id":"a","_rev":"2-yyy"}`), nil
+}
+
+func TestDumpSnapshot(t *testing.T) {
+	var docs []string
+	err := eachDoc(context.Background(), &DB{driverDB: &snapshotDB{}}, func(doc json.RawMessage) error {
+		docs = append(docs, string(doc))
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if d := diff.Interface([]string{`{"_id":"a","_rev":"1-xxx"}`}, docs); d != "" {
+		t.Error(d)
+	}
+}
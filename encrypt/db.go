@@ -0,0 +1,447 @@
+package encrypt
+
+import (
+	"bytes"
+	"context"
+	"crypto/md5"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+
+	"github.com/flimzy/kivik"
+	"github.com/flimzy/kivik/driver"
+	"github.com/flimzy/kivik/errors"
+)
+
+type db struct {
+	db      driver.DB
+	crypter *crypter
+}
+
+var _ driver.DB = &db{}
+var _ driver.Finder = &db{}
+var _ driver.Explainer = &db{}
+var _ driver.AttachmentMetaer = &db{}
+var _ driver.AttachmentCombiner = &db{}
+var _ driver.Rever = &db{}
+var _ driver.DBFlusher = &db{}
+var _ driver.Copier = &db{}
+var _ driver.OptsBulkDocer = &db{}
+var _ driver.OptsPutter = &db{}
+var _ driver.OptsDeleter = &db{}
+var _ driver.Quorumer = &db{}
+var _ driver.OpenRevsGetter = &db{}
+var _ driver.OptsDocCreator = &db{}
+var _ driver.BodyGetter = &db{}
+var _ driver.DesignInfoer = &db{}
+var _ driver.MultipartPutter = &db{}
+var _ driver.OptionValidator = &db{}
+
+func (d *db) Get(ctx context.Context, docID string, opts map[string]interface{}) (json.RawMessage, error) {
+	doc, err := d.db.Get(ctx, docID, opts)
+	if err != nil {
+		return nil, err
+	}
+	return d.crypter.decryptDoc(doc)
+}
+
+func (d *db) CreateDoc(ctx context.Context, doc interface{}) (docID, rev string, err error) {
+	enc, err := d.crypter.encryptDoc("", doc)
+	if err != nil {
+		return "", "", err
+	}
+	return d.db.CreateDoc(ctx, enc)
+}
+
+func (d *db) CreateDocOpts(ctx context.Context, doc interface{}, opts map[string]interface{}) (docID, rev string, err error) {
+	c, ok := d.db.(driver.OptsDocCreator)
+	if !ok {
+		return "", "", notImplemented("OptsDocCreator")
+	}
+	enc, err := d.crypter.encryptDoc("", doc)
+	if err != nil {
+		return "", "", err
+	}
+	return c.CreateDocOpts(ctx, enc, opts)
+}
+
+func (d *db) Put(ctx context.Context, docID string, doc interface{}) (rev string, err error) {
+	enc, err := d.crypter.encryptDoc(docID, doc)
+	if err != nil {
+		return "", err
+	}
+	return d.db.Put(ctx, docID, enc)
+}
+
+func (d *db) PutOpts(ctx context.Context, docID string, doc interface{}, opts map[string]interface{}) (rev string, err error) {
+	p, ok := d.db.(driver.OptsPutter)
+	if !ok {
+		return "", notImplemented("OptsPutter")
+	}
+	enc, err := d.crypter.encryptDoc(docID, doc)
+	if err != nil {
+		return "", err
+	}
+	return p.PutOpts(ctx, docID, enc, opts)
+}
+
+func (d *db) BulkDocs(ctx context.Context, docs []interface{}) (driver.BulkResults, error) {
+	encDocs, err := d.encryptDocs(docs)
+	if err != nil {
+		return nil, err
+	}
+	return d.db.BulkDocs(ctx, encDocs)
+}
+
+func (d *db) BulkDocsOpts(ctx context.Context, docs []interface{}, opts map[string]interface{}) (driver.BulkResults, error) {
+	b, ok := d.db.(driver.OptsBulkDocer)
+	if !ok {
+		return nil, notImplemented("OptsBulkDocer")
+	}
+	encDocs, err := d.encryptDocs(docs)
+	if err != nil {
+		return nil, err
+	}
+	return b.BulkDocsOpts(ctx, encDocs, opts)
+}
+
+func (d *db) encryptDocs(docs []interface{}) ([]interface{}, error) {
+	encDocs := make([]interface{}, len(docs))
+	for i, doc := range docs {
+		enc, err := d.crypter.encryptDoc("", doc)
+		if err != nil {
+			return nil, err
+		}
+		encDocs[i] = enc
+	}
+	return encDocs, nil
+}
+
+func (d *db) AllDocs(ctx context.Context, opts map[string]interface{}) (driver.Rows, error) {
+	rows, err := d.db.AllDocs(ctx, opts)
+	return d.rows(rows, err)
+}
+
+func (d *db) Query(ctx context.Context, ddoc, view string, opts map[string]interface{}) (driver.Rows, error) {
+	rows, err := d.db.Query(ctx, ddoc, view, opts)
+	return d.rows(rows, err)
+}
+
+func (d *db) Find(ctx context.Context, query interface{}) (driver.Rows, error) {
+	f, ok := d.db.(driver.Finder)
+	if !ok {
+		return nil, notImplemented("Finder")
+	}
+	rows, err := f.Find(ctx, query)
+	return d.rows(rows, err)
+}
+
+func (d *db) rows(rows driver.Rows, err error) (driver.Rows, error) {
+	if err != nil {
+		return nil, err
+	}
+	return &decryptRows{Rows: rows, crypter: d.crypter}, nil
+}
+
+// decryptRows decrypts the documents included in a result set. Keys and
+// values, being generated by the server, are returned as is.
+type decryptRows struct {
+	driver.Rows
+	crypter *crypter
+}
+
+var _ driver.RowsWarner = &decryptRows{}
+var _ driver.RowsBookmarker = &decryptRows{}
+
+func (r *decryptRows) Next(row *driver.Row) error {
+	if err := r.Rows.Next(row); err != nil {
+		return err
+	}
+	if len(row.Doc) == 0 {
+		return nil
+	}
+	doc, err := r.crypter.decryptDoc(row.Doc)
+	if err != nil {
+		return err
+	}
+	row.Doc = doc
+	return nil
+}
+
+func (r *decryptRows) Warning() string {
+	if w, ok := r.Rows.(driver.RowsWarner); ok {
+		return w.Warning()
+	}
+	return ""
+}
+
+func (r *decryptRows) Bookmark() string {
+	if b, ok := r.Rows.(driver.RowsBookmarker); ok {
+		return b.Bookmark()
+	}
+	return ""
+}
+
+func (d *db) Changes(ctx context.Context, opts map[string]interface{}) (driver.Changes, error) {
+	changes, err := d.db.Changes(ctx, opts)
+	if err != nil {
+		return nil, err
+	}
+	return &decryptChanges{Changes: changes, crypter: d.crypter}, nil
+}
+
+// decryptChanges decrypts the documents included in a changes feed.
+type decryptChanges struct {
+	driver.Changes
+	crypter *crypter
+}
+
+func (c *decryptChanges) Next(change *driver.Change) error {
+	if err := c.Changes.Next(change); err != nil {
+		return err
+	}
+	if len(change.Doc) == 0 {
+		return nil
+	}
+	doc, err := c.crypter.decryptDoc(change.Doc)
+	if err != nil {
+		return err
+	}
+	change.Doc = doc
+	return nil
+}
+
+func (d *db) PutAttachment(ctx context.Context, docID, rev, filename, contentType string, body io.Reader) (newRev string, err error) {
+	if !d.crypter.attachments || plain(docID) {
+		return d.db.PutAttachment(ctx, docID, rev, filename, contentType, body)
+	}
+	content, err := ioutil.ReadAll(body)
+	if err != nil {
+		return "", errors.WrapStatus(kivik.StatusBadRequest, err)
+	}
+	sealed, err := d.crypter.seal(attachmentLabel(filename), content)
+	if err != nil {
+		return "", err
+	}
+	return d.db.PutAttachment(ctx, docID, rev, filename, contentType, bytes.NewReader(sealed))
+}
+
+func (d *db) GetAttachment(ctx context.Context, docID, rev, filename string) (contentType string, md5sum driver.MD5sum, body io.ReadCloser, err error) {
+	contentType, md5sum, body, err = d.db.GetAttachment(ctx, docID, rev, filename)
+	if err != nil || !d.crypter.attachments || plain(docID) {
+		return contentType, md5sum, body, err
+	}
+	defer func() { _ = body.Close() }()
+	sealed, err := ioutil.ReadAll(body)
+	if err != nil {
+		return "", driver.MD5sum{}, nil, errors.WrapStatus(kivik.StatusInternalServerError, err)
+	}
+	content, err := d.crypter.open(attachmentLabel(filename), sealed)
+	if err != nil {
+		return "", driver.MD5sum{}, nil, err
+	}
+	return contentType, md5.Sum(content), ioutil.NopCloser(bytes.NewReader(content)), nil
+}
+
+// GetAttachmentMeta returns the MD5 sum of the decrypted content, when
+// attachments are encrypted, which requires fetching the attachment.
+func (d *db) GetAttachmentMeta(ctx context.Context, docID, rev, filename string) (contentType string, md5sum driver.MD5sum, err error) {
+	if d.crypter.attachments && !plain(docID) {
+		var body io.ReadCloser
+		contentType, md5sum, body, err = d.GetAttachment(ctx, docID, rev, filename)
+		if err != nil {
+			return "", driver.MD5sum{}, err
+		}
+		return contentType, md5sum, body.Close()
+	}
+	if m, ok := d.db.(driver.AttachmentMetaer); ok {
+		return m.GetAttachmentMeta(ctx, docID, rev, filename)
+	}
+	return "", driver.MD5sum{}, notImplemented("AttachmentMetaer")
+}
+
+func (d *db) DeleteAttachment(ctx context.Context, docID, rev, filename string) (newRev string, err error) {
+	return d.db.DeleteAttachment(ctx, docID, rev, filename)
+}
+
+func (d *db) Delete(ctx context.Context, docID, rev string) (newRev string, err error) {
+	return d.db.Delete(ctx, docID, rev)
+}
+
+func (d *db) DeleteOpts(ctx context.Context, docID, rev string, opts map[string]interface{}) (newRev string, err error) {
+	del, ok := d.db.(driver.OptsDeleter)
+	if !ok {
+		return "", notImplemented("OptsDeleter")
+	}
+	return del.DeleteOpts(ctx, docID, rev, opts)
+}
+
+func (d *db) SupportsQuorum() bool {
+	q, ok := d.db.(driver.Quorumer)
+	return ok && q.SupportsQuorum()
+}
+
+func (d *db) Stats(ctx context.Context) (*driver.DBStats, error) {
+	return d.db.Stats(ctx)
+}
+
+func (d *db) Compact(ctx context.Context) error {
+	return d.db.Compact(ctx)
+}
+
+func (d *db) CompactView(ctx context.Context, ddocID string) error {
+	return d.db.CompactView(ctx, ddocID)
+}
+
+func (d *db) ViewCleanup(ctx context.Context) error {
+	return d.db.ViewCleanup(ctx)
+}
+
+func (d *db) Security(ctx context.Context) (*driver.Security, error) {
+	return d.db.Security(ctx)
+}
+
+func (d *db) SetSecurity(ctx context.Context, security *driver.Security) error {
+	return d.db.SetSecurity(ctx, security)
+}
+
+func (d *db) CreateIndex(ctx context.Context, ddoc, name string, index interface{}) error {
+	if f, ok := d.db.(driver.Finder); ok {
+		return f.CreateIndex(ctx, ddoc, name, index)
+	}
+	return notImplemented("Finder")
+}
+
+func (d *db) GetIndexes(ctx context.Context) ([]driver.Index, error) {
+	if f, ok := d.db.(driver.Finder); ok {
+		return f.GetIndexes(ctx)
+	}
+	return nil, notImplemented("Finder")
+}
+
+func (d *db) DeleteIndex(ctx context.Context, ddoc, name string) error {
+	if f, ok := d.db.(driver.Finder); ok {
+		return f.DeleteIndex(ctx, ddoc, name)
+	}
+	return notImplemented("Finder")
+}
+
+func (d *db) Rev(ctx context.Context, docID string) (rev string, err error) {
+	if r, ok := d.db.(driver.Rever); ok {
+		return r.Rev(ctx, docID)
+	}
+	return "", notImplemented("Rever")
+}
+
+func (d *db) GetOpenRevs(ctx context.Context, docID string, revs []string, opts map[string]interface{}) ([]driver.OpenRev, error) {
+	g, ok := d.db.(driver.OpenRevsGetter)
+	if !ok {
+		return nil, notImplemented("OpenRevsGetter")
+	}
+	openRevs, err := g.GetOpenRevs(ctx, docID, revs, opts)
+	if err != nil {
+		return nil, err
+	}
+	for i, r := range openRevs {
+		if r.Doc == nil {
+			continue
+		}
+		if openRevs[i].Doc, err = d.crypter.decryptDoc(r.Doc); err != nil {
+			return nil, err
+		}
+	}
+	return openRevs, nil
+}
+
+// GetBody returns the decrypted document. As the document must be decrypted,
+// it is read into memory, rather than streamed.
+func (d *db) GetBody(ctx context.Context, docID string, opts map[string]interface{}) (io.ReadCloser, error) {
+	doc, err := d.Get(ctx, docID, opts)
+	if err != nil {
+		return nil, err
+	}
+	return ioutil.NopCloser(bytes.NewReader(doc)), nil
+}
+
+func (d *db) SupportedOptions(method string) (map[string]driver.OptionType, bool) {
+	if v, ok := d.db.(driver.OptionValidator); ok {
+		return v.SupportedOptions(method)
+	}
+	return nil, false
+}
+
+func (d *db) Flush(ctx context.Context) error {
+	if f, ok := d.db.(driver.DBFlusher); ok {
+		return f.Flush(ctx)
+	}
+	return notImplemented("DBFlusher")
+}
+
+func (d *db) Copy(ctx context.Context, targetID, sourceID string, opts map[string]interface{}) (targetRev string, err error) {
+	if c, ok := d.db.(driver.Copier); ok {
+		return c.Copy(ctx, targetID, sourceID, opts)
+	}
+	return "", notImplemented("Copier")
+}
+
+// PutMultipart encrypts the document, and, if attachments are encrypted, the
+// content of each attachment, which is read into memory to be sealed.
+func (d *db) PutMultipart(ctx context.Context, docID string, doc interface{}, atts []driver.MultipartAttachment, opts map[string]interface{}) (rev string, err error) {
+	p, ok := d.db.(driver.MultipartPutter)
+	if !ok {
+		return "", notImplemented("MultipartPutter")
+	}
+	enc, err := d.crypter.encryptDoc(docID, doc)
+	if err != nil {
+		return "", err
+	}
+	if !d.crypter.attachments || plain(docID) {
+		return p.PutMultipart(ctx, docID, enc, atts, opts)
+	}
+	sealedAtts := make([]driver.MultipartAttachment, len(atts))
+	for i, att := range atts {
+		content, err := ioutil.ReadAll(att.Content)
+		if err != nil {
+			return "", errors.WrapStatus(kivik.StatusBadRequest, err)
+		}
+		sealed, err := d.crypter.seal(attachmentLabel(att.Filename), content)
+		if err != nil {
+			return "", err
+		}
+		att.Length = int64(len(sealed))
+		att.Content = bytes.NewReader(sealed)
+		sealedAtts[i] = att
+	}
+	return p.PutMultipart(ctx, docID, enc, sealedAtts, opts)
+}
+
+func (d *db) Explain(ctx context.Context, query interface{}) (*driver.QueryPlan, error) {
+	e, ok := d.db.(driver.Explainer)
+	if !ok {
+		return nil, notImplemented("Explainer")
+	}
+	return e.Explain(ctx, query)
+}
+
+func (d *db) DesignInfo(ctx context.Context, ddoc string) (*driver.DesignInfo, error) {
+	i, ok := d.db.(driver.DesignInfoer)
+	if !ok {
+		return nil, notImplemented("DesignInfoer")
+	}
+	return i.DesignInfo(ctx, ddoc)
+}
+
+// CombineAttachments is rejected with StatusNotImplemented when attachments
+// are encrypted, as each part is sealed separately, so that the concatenation
+// could not be decrypted. The parts remain as separate attachments, each of
+// which is decrypted as it is read.
+func (d *db) CombineAttachments(ctx context.Context, docID, rev, filename, contentType string, parts []string) (newRev string, err error) {
+	if d.crypter.attachments && !plain(docID) {
+		return "", errors.Status(kivik.StatusNotImplemented, "encrypt: encrypted attachments cannot be combined on the server")
+	}
+	c, ok := d.db.(driver.AttachmentCombiner)
+	if !ok {
+		return "", notImplemented("AttachmentCombiner")
+	}
+	return c.CombineAttachments(ctx, docID, rev, filename, contentType, parts)
+}
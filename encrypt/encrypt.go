@@ -0,0 +1,431 @@
+// Package encrypt provides a Kivik driver which wraps another driver, and
+// transparently encrypts document fields and attachments before they are
+// stored, and decrypts them when read. This allows sensitive data to be stored
+// on servers which are shared with, or administered by, others.
+//
+//	encrypt.Register("couch-encrypted", "couch", encrypt.Options{
+//	    Key:    key, // 16, 24 or 32 bytes
+//	    Fields: []string{"ssn", "address"},
+//	})
+//	client, err := kivik.New(context.TODO(), "couch-encrypted", "http://localhost:5984/")
+//
+// Values are encrypted with AES-GCM, and stored as an object of the form:
+//
+//	{"$encrypted": "<base64-encoded nonce and ciphertext>"}
+//
+// Each encrypted value is authenticated with its field name, so values cannot
+// be moved between fields undetected. Fields beginning with an underscore,
+// such as _id and _rev, are never encrypted. Nor are design documents, which
+// the server must read, or local documents, which hold state such as
+// replication checkpoints, nor their attachments.
+//
+// As the server sees only the encrypted values, views, Mango queries and
+// validation functions cannot make use of them. Inline attachments, included
+// in the _attachments field of a document, are not encrypted; use
+// PutAttachment instead.
+package encrypt
+
+import (
+	"bytes"
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/json"
+	"io"
+	"strings"
+
+	"github.com/flimzy/kivik"
+	"github.com/flimzy/kivik/driver"
+	"github.com/flimzy/kivik/errors"
+)
+
+// EncryptedKey is the key of the object which replaces an encrypted value.
+const EncryptedKey = "$encrypted"
+
+// Options configures an encrypting driver.
+type Options struct {
+	// Key is the AES key, which must be 16, 24 or 32 bytes long, to select
+	// AES-128, AES-192 or AES-256.
+	Key []byte
+	// Fields lists the top-level document fields to encrypt. If empty, all
+	// fields are encrypted. Encrypted fields are decrypted when read,
+	// regardless of this setting.
+	Fields []string
+	// Attachments enables encryption of attachments.
+	Attachments bool
+}
+
+type cryptDriver struct {
+	drv     driver.Driver
+	crypter *crypter
+}
+
+var _ driver.Driver = &cryptDriver{}
+
+// New returns a driver which wraps drv, encrypting data as configured by opts.
+// An error is returned if the key is invalid.
+func New(drv driver.Driver, opts Options) (driver.Driver, error) {
+	c, err := newCrypter(opts)
+	if err != nil {
+		return nil, err
+	}
+	return &cryptDriver{drv: drv, crypter: c}, nil
+}
+
+// Register registers an encrypting version of the driver registered as
+// wrapped, under the new name name.
+func Register(name, wrapped string, opts Options) error {
+	drv, ok := kivik.LookupDriver(wrapped)
+	if !ok {
+		return errors.Statusf(kivik.StatusBadRequest, "encrypt: unknown driver %q (forgotten import?)", wrapped)
+	}
+	crypt, err := New(drv, opts)
+	if err != nil {
+		return err
+	}
+	kivik.Register(name, crypt)
+	return nil
+}
+
+func (d *cryptDriver) NewClient(ctx context.Context, dsn string) (driver.Client, error) {
+	c, err := d.drv.NewClient(ctx, dsn)
+	if err != nil {
+		return nil, err
+	}
+	return &client{client: c, crypter: d.crypter}, nil
+}
+
+// crypter encrypts and decrypts values.
+type crypter struct {
+	aead        cipher.AEAD
+	fields      map[string]bool
+	attachments bool
+}
+
+func newCrypter(opts Options) (*crypter, error) {
+	block, err := aes.NewCipher(opts.Key)
+	if err != nil {
+		return nil, errors.WrapStatus(kivik.StatusBadRequest, err)
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, errors.WrapStatus(kivik.StatusBadRequest, err)
+	}
+	c := &crypter{aead: aead, attachments: opts.Attachments}
+	if len(opts.Fields) > 0 {
+		c.fields = make(map[string]bool, len(opts.Fields))
+		for _, field := range opts.Fields {
+			c.fields[field] = true
+		}
+	}
+	return c, nil
+}
+
+// encrypted returns true if the named top-level field should be encrypted.
+func (c *crypter) encrypted(field string) bool {
+	if strings.HasPrefix(field, "_") {
+		return false
+	}
+	return c.fields == nil || c.fields[field]
+}
+
+// seal encrypts plaintext, authenticated with label, prefixed with a random
+// nonce.
+func (c *crypter) seal(label string, plaintext []byte) ([]byte, error) {
+	nonce := make([]byte, c.aead.NonceSize())
+	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
+		return nil, errors.WrapStatus(kivik.StatusInternalServerError, err)
+	}
+	return c.aead.Seal(nonce, nonce, plaintext, []byte(label)), nil
+}
+
+// open decrypts the output of seal.
+func (c *crypter) open(label string, sealed []byte) ([]byte, error) {
+	size := c.aead.NonceSize()
+	if len(sealed) < size {
+		return nil, errors.Status(kivik.StatusInternalServerError, "encrypt: ciphertext too short")
+	}
+	plaintext, err := c.aead.Open(nil, sealed[:size], sealed[size:], []byte(label))
+	if err != nil {
+		return nil, errors.Statusf(kivik.StatusInternalServerError, "encrypt: failed to decrypt %s: %s", label, err)
+	}
+	return plaintext, nil
+}
+
+type encryptedValue struct {
+	Value []byte `json:"$encrypted"`
+}
+
+// plain returns true for the IDs of design and local documents, which are
+// never encrypted.
+func plain(docID string) bool {
+	return strings.HasPrefix(docID, "_design/") || strings.HasPrefix(docID, "_local/")
+}
+
+// encryptDoc returns doc, with the configured fields encrypted. docID is the
+// document's ID, or empty, if it is to be read from the _id field of doc.
+func (c *crypter) encryptDoc(docID string, doc interface{}) (map[string]json.RawMessage, error) {
+	body, err := json.Marshal(doc)
+	if err != nil {
+		return nil, errors.WrapStatus(kivik.StatusBadRequest, err)
+	}
+	var fields map[string]json.RawMessage
+	if err = json.Unmarshal(body, &fields); err != nil {
+		return nil, errors.Status(kivik.StatusBadRequest, "encrypt: document must be a JSON object")
+	}
+	if docID == "" {
+		_ = json.Unmarshal(fields["_id"], &docID)
+	}
+	if plain(docID) {
+		return fields, nil
+	}
+	for name, value := range fields {
+		if !c.encrypted(name) {
+			continue
+		}
+		sealed, err := c.seal(name, value)
+		if err != nil {
+			return nil, err
+		}
+		enc, err := json.Marshal(encryptedValue{Value: sealed})
+		if err != nil {
+			return nil, errors.WrapStatus(kivik.StatusInternalServerError, err)
+		}
+		fields[name] = enc
+	}
+	return fields, nil
+}
+
+var encryptedMarker = []byte(`"` + EncryptedKey + `"`)
+
+// decryptDoc returns doc, with all encrypted fields decrypted.
+func (c *crypter) decryptDoc(doc json.RawMessage) (json.RawMessage, error) {
+	if !bytes.Contains(doc, encryptedMarker) {
+		return doc, nil
+	}
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(doc, &fields); err != nil {
+		return nil, errors.WrapStatus(kivik.StatusInternalServerError, err)
+	}
+	for name, value := range fields {
+		sealed, ok := encryptedField(value)
+		if !ok {
+			continue
+		}
+		plaintext, err := c.open(name, sealed)
+		if err != nil {
+			return nil, err
+		}
+		fields[name] = plaintext
+	}
+	body, err := json.Marshal(fields)
+	if err != nil {
+		return nil, errors.WrapStatus(kivik.StatusInternalServerError, err)
+	}
+	return body, nil
+}
+
+// encryptedField returns the sealed value, if value is an encrypted value.
+func encryptedField(value json.RawMessage) ([]byte, bool) {
+	if !bytes.HasPrefix(bytes.TrimSpace(value), []byte("{")) {
+		return nil, false
+	}
+	var obj map[string]json.RawMessage
+	if err := json.Unmarshal(value, &obj); err != nil || len(obj) != 1 {
+		return nil, false
+	}
+	var enc encryptedValue
+	if _, ok := obj[EncryptedKey]; !ok || json.Unmarshal(value, &enc) != nil {
+		return nil, false
+	}
+	return enc.Value, true
+}
+
+// attachmentLabel is the label used to authenticate an attachment.
+func attachmentLabel(filename string) string {
+	return "_attachments/" + filename
+}
+
+func notImplemented(iface string) error {
+	return errors.Statusf(kivik.StatusNotImplemented, "kivik: driver does not implement %s", iface)
+}
+
+type client struct {
+	client  driver.Client
+	crypter *crypter
+}
+
+var _ driver.Client = &client{}
+var _ driver.ClientReplicator = &client{}
+var _ driver.Authenticator = &client{}
+var _ driver.DBUpdater = &client{}
+var _ driver.PoolStatser = &client{}
+var _ driver.AdminPartyChecker = &client{}
+var _ driver.DiskUsager = &client{}
+var _ driver.Configer = &client{}
+var _ driver.Clusterer = &client{}
+var _ driver.OptionValidator = &client{}
+
+func (c *client) Version(ctx context.Context) (*driver.Version, error) {
+	return c.client.Version(ctx)
+}
+
+func (c *client) AllDBs(ctx context.Context, opts map[string]interface{}) ([]string, error) {
+	return c.client.AllDBs(ctx, opts)
+}
+
+func (c *client) DBExists(ctx context.Context, dbName string, opts map[string]interface{}) (bool, error) {
+	return c.client.DBExists(ctx, dbName, opts)
+}
+
+func (c *client) CreateDB(ctx context.Context, dbName string, opts map[string]interface{}) error {
+	return c.client.CreateDB(ctx, dbName, opts)
+}
+
+func (c *client) DestroyDB(ctx context.Context, dbName string, opts map[string]interface{}) error {
+	return c.client.DestroyDB(ctx, dbName, opts)
+}
+
+func (c *client) DB(ctx context.Context, dbName string, opts map[string]interface{}) (driver.DB, error) {
+	d, err := c.client.DB(ctx, dbName, opts)
+	if err != nil {
+		return nil, err
+	}
+	return &db{db: d, crypter: c.crypter}, nil
+}
+
+func (c *client) Replicate(ctx context.Context, targetDSN, sourceDSN string, opts map[string]interface{}) (driver.Replication, error) {
+	if r, ok := c.client.(driver.ClientReplicator); ok {
+		return r.Replicate(ctx, targetDSN, sourceDSN, opts)
+	}
+	return nil, notImplemented("ClientReplicator")
+}
+
+func (c *client) GetReplications(ctx context.Context, opts map[string]interface{}) ([]driver.Replication, error) {
+	if r, ok := c.client.(driver.ClientReplicator); ok {
+		return r.GetReplications(ctx, opts)
+	}
+	return nil, notImplemented("ClientReplicator")
+}
+
+func (c *client) Authenticate(ctx context.Context, authenticator interface{}) error {
+	if a, ok := c.client.(driver.Authenticator); ok {
+		return a.Authenticate(ctx, authenticator)
+	}
+	return notImplemented("Authenticator")
+}
+
+func (c *client) DBUpdates() (driver.DBUpdates, error) {
+	if u, ok := c.client.(driver.DBUpdater); ok {
+		return u.DBUpdates()
+	}
+	return nil, notImplemented("DBUpdater")
+}
+
+func (c *client) PoolStats() (driver.PoolStats, error) {
+	if s, ok := c.client.(driver.PoolStatser); ok {
+		return s.PoolStats()
+	}
+	return driver.PoolStats{}, notImplemented("PoolStatser")
+}
+
+func (c *client) AdminParty(ctx context.Context) (bool, error) {
+	if a, ok := c.client.(driver.AdminPartyChecker); ok {
+		return a.AdminParty(ctx)
+	}
+	return false, notImplemented("AdminPartyChecker")
+}
+
+func (c *client) DiskUsage(ctx context.Context) (*driver.DiskUsage, error) {
+	u, ok := c.client.(driver.DiskUsager)
+	if !ok {
+		return nil, notImplemented("DiskUsager")
+	}
+	return u.DiskUsage(ctx)
+}
+
+func (c *client) configer() (driver.Configer, error) {
+	if configer, ok := c.client.(driver.Configer); ok {
+		return configer, nil
+	}
+	return nil, notImplemented("Configer")
+}
+
+func (c *client) Config(ctx context.Context, node string) (driver.Config, error) {
+	configer, err := c.configer()
+	if err != nil {
+		return nil, err
+	}
+	return configer.Config(ctx, node)
+}
+
+func (c *client) ConfigSection(ctx context.Context, node, section string) (driver.ConfigSection, error) {
+	configer, err := c.configer()
+	if err != nil {
+		return nil, err
+	}
+	return configer.ConfigSection(ctx, node, section)
+}
+
+func (c *client) ConfigValue(ctx context.Context, node, section, key string) (string, error) {
+	configer, err := c.configer()
+	if err != nil {
+		return "", err
+	}
+	return configer.ConfigValue(ctx, node, section, key)
+}
+
+func (c *client) SetConfigValue(ctx context.Context, node, section, key, value string) (string, error) {
+	configer, err := c.configer()
+	if err != nil {
+		return "", err
+	}
+	return configer.SetConfigValue(ctx, node, section, key, value)
+}
+
+func (c *client) DeleteConfigKey(ctx context.Context, node, section, key string) (string, error) {
+	configer, err := c.configer()
+	if err != nil {
+		return "", err
+	}
+	return configer.DeleteConfigKey(ctx, node, section, key)
+}
+
+func (c *client) clusterer() (driver.Clusterer, error) {
+	if clusterer, ok := c.client.(driver.Clusterer); ok {
+		return clusterer, nil
+	}
+	return nil, notImplemented("Clusterer")
+}
+
+func (c *client) Membership(ctx context.Context) (*driver.Membership, error) {
+	clusterer, err := c.clusterer()
+	if err != nil {
+		return nil, err
+	}
+	return clusterer.Membership(ctx)
+}
+
+func (c *client) AddNode(ctx context.Context, node string) error {
+	clusterer, err := c.clusterer()
+	if err != nil {
+		return err
+	}
+	return clusterer.AddNode(ctx, node)
+}
+
+func (c *client) RemoveNode(ctx context.Context, node string) error {
+	clusterer, err := c.clusterer()
+	if err != nil {
+		return err
+	}
+	return clusterer.RemoveNode(ctx, node)
+}
+
+func (c *client) SupportedOptions(method string) (map[string]driver.OptionType, bool) {
+	if v, ok := c.client.(driver.OptionValidator); ok {
+		return v.SupportedOptions(method)
+	}
+	return nil, false
+}
@@ -0,0 +1,349 @@
+package encrypt
+
+import (
+	"bytes"
+	"context"
+	"crypto/md5"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/flimzy/diff"
+	"github.com/flimzy/kivik"
+	"github.com/flimzy/kivik/driver"
+	_ "github.com/flimzy/kivik/driver/memory"
+)
+
+var testKey = []byte("0123456789abcdef")
+
+func TestNew(t *testing.T) {
+	if _, err := New(nil, Options{Key: []byte("short")}); kivik.StatusCode(err) != kivik.StatusBadRequest {
+		t.Errorf("Unexpected error: %v", err)
+	}
+	if err := Register("foo", "no such driver", Options{Key: testKey}); kivik.StatusCode(err) != kivik.StatusBadRequest {
+		t.Errorf("Unexpected error: %v", err)
+	}
+}
+
+// newTestDBs returns an encrypting DB, and the underlying memory DB.
+func newTestDBs(t *testing.T, opts Options) (driver.DB, driver.DB) {
+	ctx := context.Background()
+	memDriver, _ := kivik.LookupDriver("memory")
+	mem, err := memDriver.NewClient(ctx, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = mem.CreateDB(ctx, "foo", nil); err != nil {
+		t.Fatal(err)
+	}
+	raw, err := mem.DB(ctx, "foo", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	crypter, err := newCrypter(opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c := &client{client: mem, crypter: crypter}
+	enc, err := c.DB(ctx, "foo", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return enc, raw
+}
+
+func TestDocuments(t *testing.T) {
+	type testDoc struct {
+		ID      string            `json:"_id"`
+		Name    string            `json:"name"`
+		SSN     string            `json:"ssn"`
+		Address map[string]string `json:"address,omitempty"`
+	}
+	doc := testDoc{ID: "bar", Name: "Bob", SSN: "123-45-6789", Address: map[string]string{"city": "Paris"}}
+	tests := []struct {
+		name      string
+		opts      Options
+		plaintext []string
+	}{
+		{
+			name:      "AllFields",
+			opts:      Options{Key: testKey},
+			plaintext: []string{"_id", "_rev"},
+		},
+		{
+			name:      "SomeFields",
+			opts:      Options{Key: testKey, Fields: []string{"ssn", "address", "_id"}},
+			plaintext: []string{"_id", "_rev", "name"},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			ctx := context.Background()
+			enc, raw := newTestDBs(t, test.opts)
+			if _, err := enc.Put(ctx, "bar", doc); err != nil {
+				t.Fatal(err)
+			}
+			stored, err := raw.Get(ctx, "bar", nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var fields map[string]json.RawMessage
+			if err = json.Unmarshal(stored, &fields); err != nil {
+				t.Fatal(err)
+			}
+			var plaintext []string
+			for name, value := range fields {
+				if _, ok := encryptedField(value); !ok {
+					plaintext = append(plaintext, name)
+				}
+			}
+			sort.Strings(plaintext)
+			if d := diff.TextSlices(test.plaintext, plaintext); d != "" {
+				t.Errorf("Unexpected plaintext fields:\n%s", d)
+			}
+			if strings.Contains(string(stored), doc.SSN) {
+				t.Errorf("Plaintext stored: %s", stored)
+			}
+			decrypted, err := enc.Get(ctx, "bar", nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var result testDoc
+			if err = json.Unmarshal(decrypted, &result); err != nil {
+				t.Fatal(err)
+			}
+			if d := diff.Interface(doc, result); d != "" {
+				t.Error(d)
+			}
+		})
+	}
+}
+
+// TestPlainDocuments checks that design and local documents are stored
+// unencrypted, even when all fields are encrypted.
+func TestPlainDocuments(t *testing.T) {
+	doc := map[string]interface{}{
+		"language": "javascript",
+		"views":    map[string]interface{}{"v": map[string]string{"map": "function(doc) { emit(doc._id) }"}},
+	}
+	for _, docID := range []string{"_design/foo", "_local/foo"} {
+		t.Run(docID, func(t *testing.T) {
+			ctx := context.Background()
+			enc, raw := newTestDBs(t, Options{Key: testKey, Attachments: true})
+			if _, err := enc.Put(ctx, docID, doc); err != nil {
+				t.Fatal(err)
+			}
+			stored, err := raw.Get(ctx, docID, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var fields map[string]interface{}
+			if err = json.Unmarshal(stored, &fields); err != nil {
+				t.Fatal(err)
+			}
+			delete(fields, "_id")
+			delete(fields, "_rev")
+			if d := diff.AsJSON(doc, fields); d != "" {
+				t.Error(d)
+			}
+		})
+	}
+}
+
+func TestDecryptErrors(t *testing.T) {
+	c, _ := newCrypter(Options{Key: testKey})
+	sealed, err := c.encryptDoc("", map[string]string{"a": "b"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Run("WrongKey", func(t *testing.T) {
+		other, _ := newCrypter(Options{Key: []byte("fedcba9876543210")})
+		doc, _ := json.Marshal(sealed)
+		if _, err := other.decryptDoc(doc); kivik.StatusCode(err) != kivik.StatusInternalServerError {
+			t.Errorf("Unexpected error: %v", err)
+		}
+	})
+	t.Run("MovedField", func(t *testing.T) {
+		doc, _ := json.Marshal(map[string]json.RawMessage{"c": sealed["a"]})
+		if _, err := c.decryptDoc(doc); kivik.StatusCode(err) != kivik.StatusInternalServerError {
+			t.Errorf("Unexpected error: %v", err)
+		}
+	})
+	t.Run("NotObject", func(t *testing.T) {
+		if _, err := c.encryptDoc("", []string{"foo"}); kivik.StatusCode(err) != kivik.StatusBadRequest {
+			t.Errorf("Unexpected error: %v", err)
+		}
+	})
+}
+
+// attDB stores a single attachment.
+type attDB struct {
+	driver.DB
+	content []byte
+}
+
+func (d *attDB) PutAttachment(_ context.Context, _, _, _, _ string, body io.Reader) (string, error) {
+	var err error
+	d.content, err = ioutil.ReadAll(body)
+	return "2-xxx", err
+}
+
+func (d *attDB) GetAttachment(_ context.Context, _, _, _ string) (string, driver.MD5sum, io.ReadCloser, error) {
+	return "text/plain", md5.Sum(d.content), ioutil.NopCloser(bytes.NewReader(d.content)), nil
+}
+
+func TestAttachments(t *testing.T) {
+	ctx := context.Background()
+	content := []byte("secret content")
+	tests := []struct {
+		docID     string
+		opt       bool
+		encrypted bool
+	}{
+		{docID: "foo", opt: true, encrypted: true},
+		{docID: "foo"},
+		{docID: "_design/foo", opt: true},
+	}
+	for _, test := range tests {
+		encrypted := test.encrypted
+		crypter, _ := newCrypter(Options{Key: testKey, Attachments: test.opt})
+		under := &attDB{}
+		d := &db{db: under, crypter: crypter}
+		if _, err := d.PutAttachment(ctx, test.docID, "1-xxx", "foo.txt", "text/plain", bytes.NewReader(content)); err != nil {
+			t.Fatal(err)
+		}
+		if stored := bytes.Equal(under.content, content); stored == encrypted {
+			t.Errorf("Encrypted: %t, stored: %q", encrypted, under.content)
+		}
+		contentType, md5sum, body, err := d.GetAttachment(ctx, test.docID, "", "foo.txt")
+		if err != nil {
+			t.Fatal(err)
+		}
+		result, _ := ioutil.ReadAll(body)
+		if contentType != "text/plain" || md5sum != md5.Sum(content) || !bytes.Equal(result, content) {
+			t.Errorf("Encrypted: %t, unexpected result: %s %x %q", encrypted, contentType, md5sum, result)
+		}
+	}
+}
+
+// multipartDB records the document and attachments passed to PutMultipart.
+type multipartDB struct {
+	driver.DB
+	doc     interface{}
+	content [][]byte
+}
+
+func (db *multipartDB) PutMultipart(_ context.Context, _ string, doc interface{}, atts []driver.MultipartAttachment, _ map[string]interface{}) (string, error) {
+	db.doc = doc
+	for _, att := range atts {
+		content, err := ioutil.ReadAll(att.Content)
+		if err != nil {
+			return "", err
+		}
+		if att.Length != int64(len(content)) {
+			return "", io.ErrUnexpectedEOF
+		}
+		db.content = append(db.content, content)
+	}
+	return "1-x", nil
+}
+
+func TestPutMultipart(t *testing.T) {
+	content := []byte("secret content")
+	crypter, err := newCrypter(Options{Key: testKey, Attachments: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	raw := &multipartDB{}
+	enc := &db{db: raw, crypter: crypter}
+	atts := []driver.MultipartAttachment{{
+		Filename:    "foo.txt",
+		ContentType: "text/plain",
+		Length:      int64(len(content)),
+		Content:     bytes.NewReader(content),
+	}}
+	if _, err = enc.PutMultipart(context.Background(), "foo", map[string]string{"ssn": "123"}, atts, nil); err != nil {
+		t.Fatal(err)
+	}
+	body, err := json.Marshal(raw.doc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(string(body), "123") {
+		t.Errorf("Document stored in plaintext: %s", body)
+	}
+	if len(raw.content) != 1 || bytes.Contains(raw.content[0], content) {
+		t.Fatalf("Attachment stored in plaintext: %q", raw.content)
+	}
+	plaintext, err := crypter.open(attachmentLabel("foo.txt"), raw.content[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(content, plaintext) {
+		t.Errorf("Unexpected content: %q", plaintext)
+	}
+}
+
+// designInfoDB reports the status of any design document's index.
+type designInfoDB struct {
+	driver.DB
+}
+
+func (d *designInfoDB) DesignInfo(_ context.Context, ddoc string) (*driver.DesignInfo, error) {
+	return &driver.DesignInfo{Name: ddoc, Signature: "abc"}, nil
+}
+
+func TestDesignInfo(t *testing.T) {
+	crypter, err := newCrypter(Options{Key: testKey})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The status of an index holds no document content, so is not encrypted.
+	enc := &db{db: &designInfoDB{}, crypter: crypter}
+	info, err := enc.DesignInfo(context.Background(), "foo")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if d := diff.Interface(&driver.DesignInfo{Name: "foo", Signature: "abc"}, info); d != "" {
+		t.Error(d)
+	}
+}
+
+// combiningDB records the attachments combined.
+type combiningDB struct {
+	driver.DB
+	combined []string
+}
+
+func (d *combiningDB) CombineAttachments(_ context.Context, _, _, filename, _ string, _ []string) (string, error) {
+	d.combined = append(d.combined, filename)
+	return "3-xxx", nil
+}
+
+func TestCombineAttachments(t *testing.T) {
+	ctx := context.Background()
+	for _, encrypted := range []bool{true, false} {
+		crypter, _ := newCrypter(Options{Key: testKey, Attachments: encrypted})
+		under := &combiningDB{}
+		d := &db{db: under, crypter: crypter}
+		_, err := d.CombineAttachments(ctx, "foo", "2-xxx", "foo.txt", "text/plain", []string{"foo.txt.part000000"})
+		if encrypted {
+			if kivik.StatusCode(err) != kivik.StatusNotImplemented {
+				t.Errorf("Expected encrypted parts not to be combined, got %v", err)
+			}
+			if len(under.combined) != 0 {
+				t.Errorf("Encrypted parts were combined: %v", under.combined)
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		if d := diff.Interface([]string{"foo.txt"}, under.combined); d != "" {
+			t.Error(d)
+		}
+	}
+}
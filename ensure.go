@@ -0,0 +1,174 @@
+package kivik
+
+import (
+	"context"
+	"reflect"
+	"sort"
+	"strings"
+
+	"github.com/flimzy/kivik/errors"
+)
+
+const designPrefix = "_design/"
+
+// DBSpec declares the desired state of a database, for EnsureDB.
+type DBSpec struct {
+	// Options are passed to CreateDB, if the database does not exist.
+	Options Options
+	// Security, if set, is the database's security object.
+	Security *Security
+	// DesignDocs are the design documents, by ID, with or without the
+	// _design/ prefix. Each is created, or replaced, if its content differs
+	// from that in the database. Fields other than _id and _rev are compared.
+	DesignDocs map[string]interface{}
+	// Indexes are the Mango indexes. Each is created, if no index of the same
+	// name exists in the same design document, or in any design document, if
+	// DesignDoc is empty. To change the definition of an existing index, give
+	// it a new name.
+	Indexes []Index
+	// Docs are seed documents, by ID, which are created if they do not
+	// exist, or have been deleted. Existing documents are never changed, so
+	// that seed data since modified by the application is preserved.
+	Docs map[string]interface{}
+}
+
+// EnsureDB creates the database name, if it does not exist, and converges it
+// to spec, which may be nil, by making only the changes needed, so that it may
+// be called on every start of an application, or as a migration. The database
+// is returned.
+func (c *Client) EnsureDB(ctx context.Context, name string, spec *DBSpec) (*DB, error) {
+	if spec == nil {
+		spec = &DBSpec{}
+	}
+	exists, err := c.DBExists(ctx, name)
+	if err != nil {
+		return nil, err
+	}
+	if !exists {
+		err = c.CreateDB(ctx, name, spec.Options)
+		// The database may have been created concurrently.
+		if err != nil && StatusCode(err) != StatusPreconditionFailed {
+			return nil, err
+		}
+	}
+	db, err := c.DB(ctx, name)
+	if err != nil {
+		return nil, err
+	}
+	if err := ensureSecurity(ctx, db, spec.Security); err != nil {
+		return nil, err
+	}
+	for _, docID := range sortedKeys(spec.DesignDocs) {
+		id := designPrefix + strings.TrimPrefix(docID, designPrefix)
+		if err := ensureDesignDoc(ctx, db, id, spec.DesignDocs[docID]); err != nil {
+			return nil, errors.Wrapf(err, "kivik: ensure %s", id)
+		}
+	}
+	if err := ensureIndexes(ctx, db, spec.Indexes); err != nil {
+		return nil, err
+	}
+	for _, docID := range sortedKeys(spec.Docs) {
+		_, err := db.Put(ctx, docID, spec.Docs[docID])
+		if err != nil && StatusCode(err) != StatusConflict {
+			return nil, errors.Wrapf(err, "kivik: ensure %s", docID)
+		}
+	}
+	return db, nil
+}
+
+func sortedKeys(m map[string]interface{}) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// docContent returns the fields of doc, other than _id and _rev, in the form
+// produced by unmarshaling JSON, for comparison.
+func docContent(doc interface{}) (map[string]interface{}, error) {
+	content, err := jsonFields(doc)
+	if err != nil {
+		return nil, err
+	}
+	delete(content, "_id")
+	delete(content, "_rev")
+	return content, nil
+}
+
+func ensureSecurity(ctx context.Context, db *DB, security *Security) error {
+	if security == nil {
+		return nil
+	}
+	current, err := db.Security(ctx)
+	if err != nil {
+		return err
+	}
+	want, err := docContent(security)
+	if err != nil {
+		return err
+	}
+	if have, _ := docContent(current); reflect.DeepEqual(want, have) {
+		return nil
+	}
+	return db.SetSecurity(ctx, security)
+}
+
+func ensureDesignDoc(ctx context.Context, db *DB, docID string, doc interface{}) error {
+	want, err := docContent(doc)
+	if err != nil {
+		return err
+	}
+	row, err := db.Get(ctx, docID)
+	switch {
+	case StatusCode(err) == StatusNotFound:
+	case err != nil:
+		return err
+	default:
+		var current map[string]interface{}
+		if err := row.ScanDoc(&current); err != nil {
+			return err
+		}
+		rev, _ := current["_rev"].(string)
+		if have, _ := docContent(current); reflect.DeepEqual(want, have) {
+			return nil
+		}
+		want["_rev"] = rev
+	}
+	_, err = db.Put(ctx, docID, want)
+	return err
+}
+
+func ensureIndexes(ctx context.Context, db *DB, indexes []Index) error {
+	if len(indexes) == 0 {
+		return nil
+	}
+	existing, err := db.GetIndexes(ctx)
+	if err != nil {
+		return err
+	}
+	for _, index := range indexes {
+		if hasIndex(existing, index) {
+			continue
+		}
+		ddoc := strings.TrimPrefix(index.DesignDoc, designPrefix)
+		if err := db.CreateIndex(ctx, ddoc, index.Name, index.Definition); err != nil {
+			return errors.Wrapf(err, "kivik: ensure index %s", index.Name)
+		}
+	}
+	return nil
+}
+
+func hasIndex(existing []Index, index Index) bool {
+	ddoc := ""
+	if index.DesignDoc != "" {
+		ddoc = designPrefix + strings.TrimPrefix(index.DesignDoc, designPrefix)
+	}
+	for _, ex := range existing {
+		if ex.Name == index.Name && (ddoc == "" || ex.DesignDoc == ddoc) {
+			return true
+		}
+	}
+	return false
+}
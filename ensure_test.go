@@ -0,0 +1,140 @@
+package kivik
+
+import (
+	"context"
+	"encoding/json"
+	"strconv"
+	"testing"
+
+	"github.com/flimzy/diff"
+	"github.com/flimzy/kivik/driver"
+	"github.com/flimzy/kivik/errors"
+)
+
+// ensureClient is a dumpClient whose databases check revisions, and support
+// indexes.
+type ensureClient struct {
+	*dumpClient
+	indexes []driver.Index
+	writes  []string
+}
+
+func (c *ensureClient) DB(ctx context.Context, dbName string, opts map[string]interface{}) (driver.DB, error) {
+	db, _ := c.dumpClient.DB(ctx, dbName, opts)
+	return &ensureDB{dumpDB: db.(*dumpDB), client: c}, nil
+}
+
+type ensureDB struct {
+	*dumpDB
+	client *ensureClient
+}
+
+var _ driver.Finder = &ensureDB{}
+
+func (db *ensureDB) Put(ctx context.Context, docID string, doc interface{}) (string, error) {
+	var meta struct {
+		Rev string `json:"_rev"`
+	}
+	if existing, ok := db.dumpDB.client.dbs[db.name][docID]; ok {
+		_ = json.Unmarshal(existing, &meta)
+	}
+	body, _ := json.Marshal(doc)
+	var newMeta struct {
+		Rev string `json:"_rev"`
+	}
+	_ = json.Unmarshal(body, &newMeta)
+	if newMeta.Rev != meta.Rev {
+		return "", errors.Status(StatusConflict, "conflict")
+	}
+	n, _ := strconv.Atoi(meta.Rev)
+	rev := strconv.Itoa(n + 1)
+	var fields map[string]interface{}
+	_ = json.Unmarshal(body, &fields)
+	fields["_id"], fields["_rev"] = docID, rev
+	db.dumpDB.client.dbs[db.name][docID], _ = json.Marshal(fields)
+	db.client.writes = append(db.client.writes, docID)
+	return rev, nil
+}
+
+func (db *ensureDB) Security(ctx context.Context) (*driver.Security, error) {
+	if sec, _ := db.dumpDB.Security(ctx); sec != nil {
+		return sec, nil
+	}
+	return &driver.Security{}, nil
+}
+
+func (db *ensureDB) SetSecurity(ctx context.Context, sec *driver.Security) error {
+	db.client.writes = append(db.client.writes, "_security")
+	return db.dumpDB.SetSecurity(ctx, sec)
+}
+
+func (db *ensureDB) Find(_ context.Context, _ interface{}) (driver.Rows, error) {
+	return nil, errors.Status(StatusNotImplemented, "not implemented")
+}
+
+func (db *ensureDB) CreateIndex(_ context.Context, ddoc, name string, _ interface{}) error {
+	db.client.indexes = append(db.client.indexes, driver.Index{DesignDoc: "_design/" + ddoc, Name: name})
+	db.client.writes = append(db.client.writes, "index "+name)
+	return nil
+}
+
+func (db *ensureDB) GetIndexes(_ context.Context) ([]driver.Index, error) {
+	return db.client.indexes, nil
+}
+
+func (db *ensureDB) DeleteIndex(_ context.Context, _, _ string) error {
+	return errors.Status(StatusNotImplemented, "not implemented")
+}
+
+func TestEnsureDB(t *testing.T) {
+	ctx := context.Background()
+	dc := &ensureClient{dumpClient: newDumpClient(false)}
+	client := &Client{driverClient: dc}
+	spec := &DBSpec{
+		Security: &Security{Admins: Members{Names: []string{"bob"}}},
+		DesignDocs: map[string]interface{}{
+			"users": map[string]interface{}{
+				"views": map[string]interface{}{
+					"by_email": map[string]string{"map": "function(doc) { emit(doc.email); }"},
+				},
+			},
+		},
+		Indexes: []Index{{DesignDoc: "idx", Name: "by-age", Definition: map[string]interface{}{"fields": []string{"age"}}}},
+		Docs: map[string]interface{}{
+			"settings": map[string]interface{}{"theme": "light"},
+		},
+	}
+	if _, err := client.EnsureDB(ctx, "app", spec); err != nil {
+		t.Fatal(err)
+	}
+	expected := []string{"_security", "_design/users", "index by-age", "settings"}
+	if d := diff.Interface(expected, dc.writes); d != "" {
+		t.Errorf("Unexpected writes on creation:\n%s", d)
+	}
+
+	// The application modifies the seed document, which must be preserved.
+	dc.dbs["app"]["settings"] = json.RawMessage(`{"_id":"settings","_rev":"1","theme":"dark"}`)
+	dc.writes = nil
+	if _, err := client.EnsureDB(ctx, "app", spec); err != nil {
+		t.Fatal(err)
+	}
+	if len(dc.writes) != 0 {
+		t.Errorf("Unexpected writes for unchanged spec: %v", dc.writes)
+	}
+
+	spec.DesignDocs["_design/users"] = map[string]interface{}{"language": "javascript"}
+	delete(spec.DesignDocs, "users")
+	if _, err := client.EnsureDB(ctx, "app", spec); err != nil {
+		t.Fatal(err)
+	}
+	if d := diff.Interface([]string{"_design/users"}, dc.writes); d != "" {
+		t.Errorf("Unexpected writes for changed design doc:\n%s", d)
+	}
+	expectedDocs := map[string]json.RawMessage{
+		"_design/users": json.RawMessage(`{"_id":"_design/users","_rev":"2","language":"javascript"}`),
+		"settings":      json.RawMessage(`{"_id":"settings","_rev":"1","theme":"dark"}`),
+	}
+	if d := diff.AsJSON(expectedDocs, dc.dbs["app"]); d != "" {
+		t.Error(d)
+	}
+}
@@ -1,5 +1,25 @@
 package kivik
 
+import "github.com/flimzy/kivik/errors"
+
+// Sentinel errors, which compare equal, with the standard library's errors.Is,
+// to any Kivik error with the same status code. They are aliases of the
+// sentinels in the github.com/flimzy/kivik/errors package.
+var (
+	ErrBadRequest          = errors.ErrBadRequest
+	ErrUnauthorized        = errors.ErrUnauthorized
+	ErrForbidden           = errors.ErrForbidden
+	ErrNotFound            = errors.ErrNotFound
+	ErrMethodNotAllowed    = errors.ErrMethodNotAllowed
+	ErrRequestTimeout      = errors.ErrRequestTimeout
+	ErrConflict            = errors.ErrConflict
+	ErrPreconditionFailed  = errors.ErrPreconditionFailed
+	ErrBadContentType      = errors.ErrBadContentType
+	ErrExpectationFailed   = errors.ErrExpectationFailed
+	ErrInternalServerError = errors.ErrInternalServerError
+	ErrNotImplemented      = errors.ErrNotImplemented
+)
+
 type statusCoder interface {
 	StatusCode() int
 }
@@ -48,7 +68,9 @@ func Reason(err error) string {
 		return ""
 	}
 	if r, ok := err.(reasoner); ok {
-		return r.Reason()
+		if reason := r.Reason(); reason != "" {
+			return reason
+		}
 	}
 	return err.Error()
 }
@@ -18,6 +18,7 @@ const (
 // StatusError is an error message bundled with an HTTP status code.
 type StatusError struct {
 	statusCode int
+	name       string
 	message    string
 }
 
@@ -35,6 +36,47 @@ func (se *StatusError) Reason() string {
 	return se.message
 }
 
+// ErrorName returns the error's CouchDB error name, if set with NamedStatus.
+func (se *StatusError) ErrorName() string {
+	return se.name
+}
+
+// Is returns true if target is a *StatusError with the same status code. This
+// allows the sentinel errors to be used with the standard library's errors.Is.
+func (se *StatusError) Is(target error) bool {
+	return MatchStatus(se.statusCode, target)
+}
+
+// Sentinel errors, one for each status commonly returned by Kivik drivers. Any
+// error with the same status compares equal to these with the standard
+// library's errors.Is, so callers may write:
+//
+//	if errors.Is(err, kivik.ErrNotFound) {
+//	    // ...
+//	}
+var (
+	ErrBadRequest          = &StatusError{statusCode: 400, message: "bad request"}
+	ErrUnauthorized        = &StatusError{statusCode: 401, message: "unauthorized"}
+	ErrForbidden           = &StatusError{statusCode: 403, message: "forbidden"}
+	ErrNotFound            = &StatusError{statusCode: 404, message: "not found"}
+	ErrMethodNotAllowed    = &StatusError{statusCode: 405, message: "method not allowed"}
+	ErrRequestTimeout      = &StatusError{statusCode: 408, message: "request timeout"}
+	ErrConflict            = &StatusError{statusCode: 409, message: "conflict"}
+	ErrPreconditionFailed  = &StatusError{statusCode: 412, message: "precondition failed"}
+	ErrBadContentType      = &StatusError{statusCode: 415, message: "bad content type"}
+	ErrExpectationFailed   = &StatusError{statusCode: 417, message: "expectation failed"}
+	ErrInternalServerError = &StatusError{statusCode: 500, message: "internal server error"}
+	ErrNotImplemented      = &StatusError{statusCode: 501, message: "not implemented"}
+)
+
+// MatchStatus returns true if target is a *StatusError, such as one of the
+// sentinel errors, with the status code status. It is intended for use by
+// drivers implementing an Is method on their own error types.
+func MatchStatus(status int, target error) bool {
+	se, ok := target.(*StatusError)
+	return ok && se.statusCode == status
+}
+
 // StatusCoder is an optional error interface, which returns the error's
 // embedded HTTP status code.
 type StatusCoder interface {
@@ -68,6 +110,41 @@ func Reason(err error) string {
 	return ""
 }
 
+// ErrorNamer is an interface for an error that contains a CouchDB error name,
+// such as "not_found" or "conflict".
+type ErrorNamer interface {
+	ErrorName() string
+}
+
+// ErrorName returns the error's CouchDB error name if there is one.
+func ErrorName(err error) string {
+	if err == nil {
+		return ""
+	}
+	if namer, ok := err.(ErrorNamer); ok {
+		return namer.ErrorName()
+	}
+	return ""
+}
+
+// RawResponder is an interface for an error that contains the raw response
+// body returned by the server.
+type RawResponder interface {
+	RawResponse() []byte
+}
+
+// RawResponse returns the raw response body embedded in the error, if there is
+// one.
+func RawResponse(err error) []byte {
+	if err == nil {
+		return nil
+	}
+	if responder, ok := err.(RawResponder); ok {
+		return responder.RawResponse()
+	}
+	return nil
+}
+
 // New is a wrapper around the standard errors.New, to avoid the need for
 // multiple imports.
 func New(msg string) error {
@@ -90,6 +167,17 @@ func Statusf(status int, format string, args ...interface{}) error {
 	}
 }
 
+// NamedStatus returns a new error with the designated HTTP status and CouchDB
+// error name, such as "illegal_database_name", for errors which CouchDB
+// reports with a name other than that of the status.
+func NamedStatus(status int, name, msg string) error {
+	return &StatusError{
+		statusCode: status,
+		name:       name,
+		message:    msg,
+	}
+}
+
 type wrappedError struct {
 	err        error
 	statusCode int
@@ -103,6 +191,20 @@ func (e *wrappedError) StatusCode() int {
 	return e.statusCode
 }
 
+func (e *wrappedError) Is(target error) bool {
+	return MatchStatus(e.statusCode, target)
+}
+
+// Unwrap returns the original error.
+func (e *wrappedError) Unwrap() error {
+	return e.err
+}
+
+// Cause returns the original error, for compatibility with pkg/errors.Cause().
+func (e *wrappedError) Cause() error {
+	return e.err
+}
+
 // WrapStatus bundles an existing error with a status code.
 func WrapStatus(status int, err error) error {
 	if err == nil {
@@ -114,14 +216,43 @@ func WrapStatus(status int, err error) error {
 	}
 }
 
+// withUnwrap adds an Unwrap method to errors created by pkg/errors, which
+// predates the standard library's error wrapping conventions.
+type withUnwrap struct {
+	error
+	cause error
+}
+
+// Unwrap returns the wrapped error.
+func (e *withUnwrap) Unwrap() error {
+	return e.cause
+}
+
+// Cause returns the wrapped error, for compatibility with pkg/errors.Cause().
+func (e *withUnwrap) Cause() error {
+	return e.cause
+}
+
+// Format preserves the formatting, including stack traces, provided by
+// pkg/errors.
+func (e *withUnwrap) Format(s fmt.State, verb rune) {
+	e.error.(fmt.Formatter).Format(s, verb)
+}
+
 // Wrap is a wrapper around pkg/errors.Wrap()
 func Wrap(err error, msg string) error {
-	return errors.Wrap(err, msg)
+	if err == nil {
+		return nil
+	}
+	return &withUnwrap{error: errors.Wrap(err, msg), cause: err}
 }
 
 // Wrapf is a wrapper around pkg/errors.Wrapf()
 func Wrapf(err error, format string, args ...interface{}) error {
-	return errors.Wrapf(err, format, args...)
+	if err == nil {
+		return nil
+	}
+	return &withUnwrap{error: errors.Wrapf(err, format, args...), cause: err}
 }
 
 // Cause is a wrapper around pkg/errors.Cause()
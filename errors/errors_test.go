@@ -40,3 +40,59 @@ func TestErrors(t *testing.T) {
 		}(test)
 	}
 }
+
+type couchError struct{}
+
+func (e couchError) Error() string       { return "Not Found: missing" }
+func (e couchError) ErrorName() string   { return "not_found" }
+func (e couchError) Reason() string      { return "missing" }
+func (e couchError) RawResponse() []byte { return []byte(`{"error":"not_found","reason":"missing"}`) }
+
+func TestCouchErrorFields(t *testing.T) {
+	tests := []struct {
+		Name             string
+		Err              error
+		ExpectedName     string
+		ExpectedReason   string
+		ExpectedResponse string
+	}{
+		{
+			Name: "Nil",
+		},
+		{
+			Name: "Standard",
+			Err:  errors.New("foo"),
+		},
+		{
+			Name:           "StatusError",
+			Err:            Status(404, "missing"),
+			ExpectedReason: "missing",
+		},
+		{
+			Name:           "NamedStatus",
+			Err:            NamedStatus(400, "illegal_database_name", "invalid database name"),
+			ExpectedName:   "illegal_database_name",
+			ExpectedReason: "invalid database name",
+		},
+		{
+			Name:             "CouchError",
+			Err:              couchError{},
+			ExpectedName:     "not_found",
+			ExpectedReason:   "missing",
+			ExpectedResponse: `{"error":"not_found","reason":"missing"}`,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.Name, func(t *testing.T) {
+			if name := ErrorName(test.Err); name != test.ExpectedName {
+				t.Errorf("ErrorName. Expected '%s', Actual '%s'", test.ExpectedName, name)
+			}
+			if reason := Reason(test.Err); reason != test.ExpectedReason {
+				t.Errorf("Reason. Expected '%s', Actual '%s'", test.ExpectedReason, reason)
+			}
+			if resp := string(RawResponse(test.Err)); resp != test.ExpectedResponse {
+				t.Errorf("RawResponse. Expected '%s', Actual '%s'", test.ExpectedResponse, resp)
+			}
+		})
+	}
+}
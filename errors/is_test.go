@@ -0,0 +1,106 @@
+// +build go1.13
+
+package errors
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+)
+
+func TestIs(t *testing.T) {
+	tests := []struct {
+		Name     string
+		Err      error
+		Target   error
+		Expected bool
+	}{
+		{
+			Name:     "Nil",
+			Target:   ErrNotFound,
+			Expected: false,
+		},
+		{
+			Name:     "Sentinel",
+			Err:      ErrNotFound,
+			Target:   ErrNotFound,
+			Expected: true,
+		},
+		{
+			Name:     "SameStatus",
+			Err:      Status(404, "missing"),
+			Target:   ErrNotFound,
+			Expected: true,
+		},
+		{
+			Name:     "DifferentStatus",
+			Err:      Status(409, "conflict"),
+			Target:   ErrNotFound,
+			Expected: false,
+		},
+		{
+			Name:     "NonStatusError",
+			Err:      errors.New("foo"),
+			Target:   ErrInternalServerError,
+			Expected: false,
+		},
+		{
+			Name:     "WrapStatus",
+			Err:      WrapStatus(401, errors.New("bad password")),
+			Target:   ErrUnauthorized,
+			Expected: true,
+		},
+		{
+			Name:     "Wrap",
+			Err:      Wrap(Status(409, "conflict"), "put failed"),
+			Target:   ErrConflict,
+			Expected: true,
+		},
+		{
+			Name:     "Wrapf",
+			Err:      Wrapf(Status(501, "nope"), "%s failed", "thing"),
+			Target:   ErrNotImplemented,
+			Expected: true,
+		},
+		{
+			Name:     "StdlibWrapped",
+			Err:      fmt.Errorf("wrapped: %w", Status(403, "go away")),
+			Target:   ErrForbidden,
+			Expected: true,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.Name, func(t *testing.T) {
+			if result := errors.Is(test.Err, test.Target); result != test.Expected {
+				t.Errorf("Expected %t, got %t", test.Expected, result)
+			}
+		})
+	}
+}
+
+func TestUnwrapOriginal(t *testing.T) {
+	orig := errors.New("original")
+	for _, err := range []error{
+		WrapStatus(500, orig),
+		Wrap(orig, "wrapped"),
+		Wrapf(orig, "wrapped %d", 1),
+	} {
+		if !errors.Is(err, orig) {
+			t.Errorf("%v does not wrap the original error", err)
+		}
+		if cause := Cause(err); cause != orig {
+			t.Errorf("Unexpected cause: %v", cause)
+		}
+	}
+}
+
+func TestAs(t *testing.T) {
+	err := Wrap(Status(409, "conflict"), "put failed")
+	var se *StatusError
+	if !errors.As(err, &se) {
+		t.Fatal("Expected to find a *StatusError")
+	}
+	if se.StatusCode() != 409 {
+		t.Errorf("Unexpected status: %d", se.StatusCode())
+	}
+}
@@ -0,0 +1,74 @@
+package errors
+
+import (
+	"context"
+	"net"
+	"net/url"
+)
+
+// Retryabler is an optional error interface, which allows an error to state
+// explicitly whether the failed operation may be retried.
+type Retryabler interface {
+	Retryable() bool
+}
+
+// Retryable returns true if err represents a transient failure, such that the
+// operation which caused it may reasonably be retried. The following errors
+// are considered retryable:
+//
+//   - network errors, such as refused connections or timeouts
+//   - errors with status 408 (request timeout) or 429 (too many requests)
+//   - errors with a 5xx status, other than 501 (not implemented)
+//
+// Errors which implement the Retryabler interface are classified according to
+// their Retryable method. Cancelled or expired contexts, and all other errors,
+// including those with a 4xx status, are considered permanent. Wrapped errors
+// are inspected until one of the above matches.
+func Retryable(err error) bool {
+	for err != nil {
+		if r, ok := err.(Retryabler); ok {
+			return r.Retryable()
+		}
+		if err == context.Canceled || err == context.DeadlineExceeded {
+			return false
+		}
+		if urlErr, ok := err.(*url.Error); ok {
+			return urlErr.Err != context.Canceled && urlErr.Err != context.DeadlineExceeded
+		}
+		if _, ok := err.(net.Error); ok {
+			return true
+		}
+		if coder, ok := err.(StatusCoder); ok {
+			return retryableStatus(coder.StatusCode())
+		}
+		err = unwrap(err)
+	}
+	return false
+}
+
+func retryableStatus(status int) bool {
+	switch {
+	case status == 408, status == 429:
+		return true
+	case status == 501:
+		return false
+	case status >= 500:
+		return true
+	}
+	return false
+}
+
+// unwrap returns the error wrapped by err, or nil.
+func unwrap(err error) error {
+	switch t := err.(type) {
+	case interface {
+		Unwrap() error
+	}:
+		return t.Unwrap()
+	case interface {
+		Cause() error
+	}:
+		return t.Cause()
+	}
+	return nil
+}
@@ -0,0 +1,62 @@
+package errors
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/url"
+	"testing"
+)
+
+type retryabler bool
+
+func (r retryabler) Error() string   { return "retryabler" }
+func (r retryabler) Retryable() bool { return bool(r) }
+
+func TestRetryable(t *testing.T) {
+	tests := []struct {
+		Name     string
+		Err      error
+		Expected bool
+	}{
+		{Name: "Nil", Err: nil, Expected: false},
+		{Name: "Plain", Err: errors.New("foo"), Expected: false},
+		{Name: "BadRequest", Err: Status(400, "bad"), Expected: false},
+		{Name: "NotFound", Err: Status(404, "missing"), Expected: false},
+		{Name: "Conflict", Err: Status(409, "conflict"), Expected: false},
+		{Name: "RequestTimeout", Err: Status(408, "timeout"), Expected: true},
+		{Name: "TooManyRequests", Err: Status(429, "slow down"), Expected: true},
+		{Name: "InternalServerError", Err: Status(500, "oops"), Expected: true},
+		{Name: "NotImplemented", Err: Status(501, "nope"), Expected: false},
+		{Name: "ServiceUnavailable", Err: Status(503, "later"), Expected: true},
+		{Name: "WrapStatus", Err: WrapStatus(502, errors.New("bad gateway")), Expected: true},
+		{Name: "Wrapped", Err: Wrap(Status(503, "later"), "get failed"), Expected: true},
+		{Name: "WrappedPermanent", Err: Wrap(Status(403, "forbidden"), "get failed"), Expected: false},
+		{Name: "Canceled", Err: context.Canceled, Expected: false},
+		{Name: "DeadlineExceeded", Err: context.DeadlineExceeded, Expected: false},
+		{
+			Name:     "NetworkError",
+			Err:      &net.OpError{Op: "dial", Net: "tcp", Err: errors.New("connection refused")},
+			Expected: true,
+		},
+		{
+			Name:     "URLError",
+			Err:      &url.Error{Op: "Get", URL: "http://localhost/", Err: errors.New("EOF")},
+			Expected: true,
+		},
+		{
+			Name:     "URLErrorCanceled",
+			Err:      &url.Error{Op: "Get", URL: "http://localhost/", Err: context.Canceled},
+			Expected: false,
+		},
+		{Name: "RetryablerTrue", Err: retryabler(true), Expected: true},
+		{Name: "RetryablerFalse", Err: Wrap(retryabler(false), "foo"), Expected: false},
+	}
+	for _, test := range tests {
+		t.Run(test.Name, func(t *testing.T) {
+			if result := Retryable(test.Err); result != test.Expected {
+				t.Errorf("Expected %t, got %t", test.Expected, result)
+			}
+		})
+	}
+}
@@ -0,0 +1,68 @@
+package examples
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/flimzy/kivik"
+)
+
+// Example_changes reads the changes feed of a database, first in full, then
+// from a previously read sequence.
+func Example_changes() {
+	ctx := context.Background()
+	client, err := kivik.New(ctx, "memory", "")
+	if err != nil {
+		panic(err)
+	}
+	if err = client.CreateDB(ctx, "events"); err != nil {
+		panic(err)
+	}
+	db, err := client.DB(ctx, "events")
+	if err != nil {
+		panic(err)
+	}
+	for _, id := range []string{"a", "b"} {
+		if _, err = db.Put(ctx, id, map[string]string{"name": id}); err != nil {
+			panic(err)
+		}
+	}
+
+	changes, err := db.Changes(ctx)
+	if err != nil {
+		panic(err)
+	}
+	var last kivik.SequenceID
+	for changes.Next() {
+		fmt.Println("changed:", changes.ID())
+		last = changes.Seq()
+	}
+	if err = changes.Err(); err != nil {
+		panic(err)
+	}
+
+	if _, err = db.Put(ctx, "c", map[string]string{"name": "c"}); err != nil {
+		panic(err)
+	}
+	changes, err = db.Changes(ctx, kivik.Since(last), kivik.Options{"include_docs": true})
+	if err != nil {
+		panic(err)
+	}
+	defer func() { _ = changes.Close() }()
+	for changes.Next() {
+		var doc struct {
+			Name string `json:"name"`
+		}
+		if err = changes.ScanDoc(&doc); err != nil {
+			panic(err)
+		}
+		fmt.Println("since the last read:", doc.Name)
+	}
+	if err = changes.Err(); err != nil {
+		panic(err)
+	}
+	// Output:
+	// changed: a
+	// changed: b
+	// since the last read: c
+}
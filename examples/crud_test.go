@@ -0,0 +1,117 @@
+package examples
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/flimzy/kivik"
+	_ "github.com/flimzy/kivik/driver/memory" // The memory driver
+)
+
+// generation returns the generation number of rev, such as "1" of "1-abc",
+// as the remainder of a rev differs from run to run.
+func generation(rev string) string {
+	return strings.SplitN(rev, "-", 2)[0]
+}
+
+// Example_crud creates, reads, updates and deletes a document.
+func Example_crud() {
+	ctx := context.Background()
+	client, err := kivik.New(ctx, "memory", "")
+	if err != nil {
+		panic(err)
+	}
+	if err = client.CreateDB(ctx, "animals"); err != nil {
+		panic(err)
+	}
+	db, err := client.DB(ctx, "animals")
+	if err != nil {
+		panic(err)
+	}
+
+	type animal struct {
+		ID    string `json:"_id"`
+		Rev   string `json:"_rev,omitempty"`
+		Sound string `json:"sound"`
+	}
+
+	rev, err := db.Put(ctx, "cow", animal{ID: "cow", Sound: "moo"})
+	if err != nil {
+		panic(err)
+	}
+	fmt.Println("created generation", generation(rev))
+
+	row, err := db.Get(ctx, "cow")
+	if err != nil {
+		panic(err)
+	}
+	var cow animal
+	if err = row.ScanDoc(&cow); err != nil {
+		panic(err)
+	}
+	fmt.Println("the cow says", cow.Sound)
+
+	cow.Sound = "MOO"
+	if rev, err = db.Put(ctx, "cow", cow); err != nil {
+		panic(err)
+	}
+	fmt.Println("updated generation", generation(rev))
+
+	if _, err = db.Delete(ctx, "cow", rev); err != nil {
+		panic(err)
+	}
+	_, err = db.Get(ctx, "cow")
+	fmt.Println("after delete:", kivik.StatusCode(err))
+	// Output:
+	// created generation 1
+	// the cow says moo
+	// updated generation 2
+	// after delete: 404
+}
+
+// Example_update applies a change to a document, retrying if another writer
+// updates it concurrently.
+func Example_update() {
+	ctx := context.Background()
+	client, err := kivik.New(ctx, "memory", "")
+	if err != nil {
+		panic(err)
+	}
+	if err = client.CreateDB(ctx, "counters"); err != nil {
+		panic(err)
+	}
+	db, err := client.DB(ctx, "counters")
+	if err != nil {
+		panic(err)
+	}
+	increment := func(current json.RawMessage) (interface{}, error) {
+		doc := map[string]interface{}{"count": 0.0}
+		if current != nil {
+			if err := json.Unmarshal(current, &doc); err != nil {
+				return nil, err
+			}
+		}
+		doc["count"] = doc["count"].(float64) + 1
+		return doc, nil
+	}
+	for i := 0; i < 3; i++ {
+		if _, err = db.Update(ctx, "visits", increment); err != nil {
+			panic(err)
+		}
+	}
+	var doc struct {
+		Count int `json:"count"`
+	}
+	row, err := db.Get(ctx, "visits")
+	if err != nil {
+		panic(err)
+	}
+	if err = row.ScanDoc(&doc); err != nil {
+		panic(err)
+	}
+	fmt.Println("visits:", doc.Count)
+	// Output:
+	// visits: 3
+}
@@ -0,0 +1,7 @@
+// Package examples contains runnable examples of Kivik's public API, run
+// against the memory driver. Because the examples' output is verified by go
+// test, the patterns they document cannot drift from the API.
+//
+// The memory driver does not evaluate views, so the view examples define and
+// deploy design documents without querying them.
+package examples
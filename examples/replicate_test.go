@@ -0,0 +1,69 @@
+package examples
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/flimzy/kivik"
+	"github.com/flimzy/kivik/replicate"
+)
+
+// Example_replicate replicates one database to another, in Go, and resumes
+// from the checkpoint on the next run.
+func Example_replicate() {
+	ctx := context.Background()
+	client, err := kivik.New(ctx, "memory", "")
+	if err != nil {
+		panic(err)
+	}
+	open := func(name string) *kivik.DB {
+		if err := client.CreateDB(ctx, name); err != nil {
+			panic(err)
+		}
+		db, err := client.DB(ctx, name)
+		if err != nil {
+			panic(err)
+		}
+		return db
+	}
+	source, target := open("source"), open("target")
+	for _, id := range []string{"a", "b", "c"} {
+		if _, err = source.Put(ctx, id, map[string]string{"name": id}); err != nil {
+			panic(err)
+		}
+	}
+
+	r, err := replicate.New(target, source, replicate.Options{ID: "backup"})
+	if err != nil {
+		panic(err)
+	}
+	progress, err := r.Run(ctx)
+	if err != nil {
+		panic(err)
+	}
+	fmt.Println("written:", progress.DocsWritten)
+
+	if _, err = source.Put(ctx, "d", map[string]string{"name": "d"}); err != nil {
+		panic(err)
+	}
+	if progress, err = r.Run(ctx); err != nil {
+		panic(err)
+	}
+	fmt.Println("written on resume:", progress.DocsWritten)
+
+	row, err := target.Get(ctx, "d")
+	if err != nil {
+		panic(err)
+	}
+	var doc struct {
+		Name string `json:"name"`
+	}
+	if err = row.ScanDoc(&doc); err != nil {
+		panic(err)
+	}
+	fmt.Println("replicated:", doc.Name)
+	// Output:
+	// written: 3
+	// written on resume: 1
+	// replicated: d
+}
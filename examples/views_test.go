@@ -0,0 +1,53 @@
+package examples
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/flimzy/kivik"
+	"github.com/flimzy/kivik/design"
+)
+
+// Example_views defines a design document with a view, and deploys it
+// idempotently, so that it may be synchronized on every start of an
+// application.
+func Example_views() {
+	ctx := context.Background()
+	client, err := kivik.New(ctx, "memory", "")
+	if err != nil {
+		panic(err)
+	}
+	if err = client.CreateDB(ctx, "users"); err != nil {
+		panic(err)
+	}
+	db, err := client.DB(ctx, "users")
+	if err != nil {
+		panic(err)
+	}
+	set := &design.Set{
+		Docs: []*design.Doc{
+			{
+				Name: "users",
+				Views: map[string]design.View{
+					"by_email": {Map: `function(doc) { emit(doc.email, null); }`},
+				},
+			},
+		},
+	}
+	for i := 0; i < 2; i++ {
+		results, err := set.Sync(ctx, db)
+		if err != nil {
+			panic(err)
+		}
+		for _, result := range results {
+			fmt.Println(result.ID, result.Action)
+		}
+	}
+
+	// Against a server which evaluates views, the view is then queried with
+	// db.Query(ctx, "users", "by_email", kivik.Options{"key": email}).
+
+	// Output:
+	// _design/users created
+	// _design/users unchanged
+}
@@ -0,0 +1,224 @@
+// Package expire deletes documents once the time held in a TTL field has
+// passed, for databases, such as CouchDB, which have no native expiry.
+//
+//	exp := expire.New(db, expire.Options{Field: "expiresAt"})
+//	if err := exp.EnsureIndex(ctx); err != nil {
+//		return err
+//	}
+//	go exp.Run(ctx)
+//	...
+//	doc["expiresAt"] = expire.Format(time.Now().Add(24 * time.Hour))
+//
+// Expired documents are found with a Mango query on the field, which should
+// be indexed, with EnsureIndex, or with a view which emits the expiry time of
+// each document as its key:
+//
+//	function(doc) { if (doc.expiresAt) { emit(doc.expiresAt, null); } }
+//
+// Times are compared as strings by the database, and so must be formatted
+// with Format, or otherwise as with time.RFC3339 in UTC. The memory driver
+// supports expiry natively, with its OptionExpiryField database option.
+package expire
+
+import (
+	"context"
+	"sync/atomic"
+	"time"
+
+	"github.com/flimzy/kivik"
+)
+
+// DefaultField is the name of the field which holds the expiry time, if none
+// is given in Options.
+const DefaultField = "expiresAt"
+
+// DefaultInterval is the interval at which Run deletes expired documents, if
+// none is given in Options.
+const DefaultInterval = time.Minute
+
+// DefaultBatchSize is the number of expired documents read at once, if none
+// is given in Options.
+const DefaultBatchSize = 100
+
+// Options configures an Expirer.
+type Options struct {
+	// Field is the name of the field which holds the time at which the
+	// document expires. The default is DefaultField.
+	Field string
+	// DesignDoc and View, if set, name a view which emits the expiry time of
+	// each document as its key, to be used instead of a Mango query.
+	DesignDoc, View string
+	// Interval is the interval at which Run deletes expired documents. The
+	// default is DefaultInterval.
+	Interval time.Duration
+	// BatchSize is the number of expired documents read at once. The
+	// default is DefaultBatchSize.
+	BatchSize int
+	// OnError, if set, is called with any error returned by Expire, when
+	// called by Run.
+	OnError func(error)
+}
+
+// Stats are the cumulative metrics of an Expirer.
+type Stats struct {
+	// Runs is the number of calls to Expire.
+	Runs int64
+	// Expired is the number of documents deleted.
+	Expired int64
+	// Errors is the number of calls to Expire which returned an error.
+	Errors int64
+}
+
+// Expirer deletes the expired documents of a database.
+type Expirer struct {
+	db   *kivik.DB
+	opts Options
+
+	runs, expired, errors int64
+}
+
+// New returns an Expirer for db.
+func New(db *kivik.DB, opts Options) *Expirer {
+	if opts.Field == "" {
+		opts.Field = DefaultField
+	}
+	if opts.Interval <= 0 {
+		opts.Interval = DefaultInterval
+	}
+	if opts.BatchSize <= 0 {
+		opts.BatchSize = DefaultBatchSize
+	}
+	return &Expirer{db: db, opts: opts}
+}
+
+// Format formats t as an expiry time.
+func Format(t time.Time) string {
+	return t.UTC().Format(time.RFC3339)
+}
+
+// EnsureIndex creates a Mango index on the expiry field, if it does not
+// already exist.
+func (e *Expirer) EnsureIndex(ctx context.Context) error {
+	return e.db.CreateIndex(ctx, "", "", map[string]interface{}{
+		"fields": []string{e.opts.Field},
+	})
+}
+
+// Stats returns the metrics of e. It is safe to call concurrently with Run.
+func (e *Expirer) Stats() Stats {
+	return Stats{
+		Runs:    atomic.LoadInt64(&e.runs),
+		Expired: atomic.LoadInt64(&e.expired),
+		Errors:  atomic.LoadInt64(&e.errors),
+	}
+}
+
+// Run calls Expire every Interval, starting immediately, until ctx is
+// canceled, and then returns ctx.Err().
+func (e *Expirer) Run(ctx context.Context) error {
+	ticker := time.NewTicker(e.opts.Interval)
+	defer ticker.Stop()
+	for {
+		if _, err := e.Expire(ctx); err != nil && e.opts.OnError != nil && ctx.Err() == nil {
+			e.opts.OnError(err)
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		}
+	}
+}
+
+// Expire deletes the documents which have expired, and returns the number
+// deleted. Documents which are updated or deleted concurrently are skipped.
+func (e *Expirer) Expire(ctx context.Context) (int, error) {
+	atomic.AddInt64(&e.runs, 1)
+	count, err := e.expire(ctx, time.Now())
+	atomic.AddInt64(&e.expired, int64(count))
+	if err != nil {
+		atomic.AddInt64(&e.errors, 1)
+	}
+	return count, err
+}
+
+func (e *Expirer) expire(ctx context.Context, now time.Time) (int, error) {
+	var count int
+	for {
+		docs, more, err := e.expiredDocs(ctx, now)
+		if err != nil {
+			return count, err
+		}
+		var deleted int
+		for _, doc := range docs {
+			if _, err := e.db.Delete(ctx, doc.ID, doc.Rev); err != nil {
+				switch kivik.StatusCode(err) {
+				case kivik.StatusNotFound, kivik.StatusConflict:
+					continue
+				}
+				return count, err
+			}
+			deleted++
+		}
+		count += deleted
+		// Stop once the last batch has been read, or if none of the batch
+		// could be deleted, to avoid reading it again.
+		if !more || deleted == 0 {
+			return count, nil
+		}
+	}
+}
+
+type expiredDoc struct {
+	ID, Rev string
+}
+
+// expiredDocs returns the documents which expired at or before now, from a
+// batch of up to BatchSize results. more is true if the batch was full.
+func (e *Expirer) expiredDocs(ctx context.Context, now time.Time) (docs []expiredDoc, more bool, err error) {
+	var rows *kivik.Rows
+	if e.opts.View != "" {
+		rows, err = e.db.Query(ctx, e.opts.DesignDoc, e.opts.View, kivik.Options{
+			"endkey":       Format(now),
+			"include_docs": true,
+			"limit":        e.opts.BatchSize,
+		})
+	} else {
+		rows, err = e.db.Find(ctx, map[string]interface{}{
+			"selector": map[string]interface{}{
+				e.opts.Field: map[string]interface{}{"$lte": Format(now)},
+			},
+			"limit": e.opts.BatchSize,
+		})
+	}
+	if err != nil {
+		return nil, false, err
+	}
+	defer func() { _ = rows.Close() }()
+	var n int
+	for rows.Next() {
+		n++
+		var doc map[string]interface{}
+		if err := rows.ScanDoc(&doc); err != nil {
+			return nil, false, err
+		}
+		if !expired(doc[e.opts.Field], now) {
+			continue
+		}
+		id, _ := doc["_id"].(string)
+		rev, _ := doc["_rev"].(string)
+		docs = append(docs, expiredDoc{ID: id, Rev: rev})
+	}
+	return docs, n == e.opts.BatchSize, rows.Err()
+}
+
+// expired returns true if value is a time at or before now. As the database
+// compares times as strings, the time is checked again once parsed.
+func expired(value interface{}, now time.Time) bool {
+	s, ok := value.(string)
+	if !ok {
+		return false
+	}
+	t, err := time.Parse(time.RFC3339, s)
+	return err == nil && !t.After(now)
+}
@@ -0,0 +1,192 @@
+package expire
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/flimzy/diff"
+	"github.com/flimzy/kivik"
+	"github.com/flimzy/kivik/driver"
+	"github.com/flimzy/kivik/errors"
+	"github.com/flimzy/kivik/kiviktest"
+)
+
+type fakeDriver struct {
+	db *fakeDB
+}
+
+func (d *fakeDriver) NewClient(_ context.Context, _ string) (driver.Client, error) {
+	return &fakeClient{db: d.db}, nil
+}
+
+type fakeClient struct {
+	driver.Client
+	db *fakeDB
+}
+
+func (c *fakeClient) DB(_ context.Context, _ string, _ map[string]interface{}) (driver.DB, error) {
+	return c.db, nil
+}
+
+// fakeDB holds documents with an "expires" field, and answers both Find and
+// Query by comparing the field to the upper bound as a string, as CouchDB
+// does. It records the queries it receives.
+type fakeDB struct {
+	driver.DB
+	driver.Finder
+	docs    map[string]string
+	queries []interface{}
+}
+
+func (d *fakeDB) rows(bound string, limit int) driver.Rows {
+	var ids []string
+	for id, expires := range d.docs {
+		if expires <= bound {
+			ids = append(ids, id)
+		}
+	}
+	sort.Strings(ids)
+	if len(ids) > limit {
+		ids = ids[:limit]
+	}
+	rows := &fakeRows{}
+	for _, id := range ids {
+		doc, _ := json.Marshal(map[string]string{"_id": id, "_rev": "1-" + id, "expires": d.docs[id]})
+		rows.rows = append(rows.rows, &driver.Row{ID: id, Doc: doc})
+	}
+	return rows
+}
+
+func (d *fakeDB) Find(_ context.Context, query interface{}) (driver.Rows, error) {
+	d.queries = append(d.queries, query)
+	q := query.(map[string]interface{})
+	bound := q["selector"].(map[string]interface{})["expires"].(map[string]interface{})["$lte"].(string)
+	return d.rows(bound, q["limit"].(int)), nil
+}
+
+func (d *fakeDB) Query(_ context.Context, ddoc, view string, opts map[string]interface{}) (driver.Rows, error) {
+	d.queries = append(d.queries, ddoc+"/"+view)
+	return d.rows(opts["endkey"].(string), opts["limit"].(int)), nil
+}
+
+func (d *fakeDB) Delete(_ context.Context, docID, rev string) (string, error) {
+	if _, ok := d.docs[docID]; !ok || rev != "1-"+docID {
+		return "", errors.Status(kivik.StatusConflict, "conflict")
+	}
+	delete(d.docs, docID)
+	return "2-" + docID, nil
+}
+
+type fakeRows struct {
+	driver.Rows
+	rows []*driver.Row
+}
+
+func (r *fakeRows) Next(row *driver.Row) error {
+	if len(r.rows) == 0 {
+		return io.EOF
+	}
+	*row, r.rows = *r.rows[0], r.rows[1:]
+	return nil
+}
+
+func (r *fakeRows) Close() error { return nil }
+
+func newTestDB(t *testing.T, fake *fakeDB) *kivik.DB {
+	return kiviktest.NewDB(t, &fakeDriver{db: fake}, "", "foo")
+}
+
+func TestExpire(t *testing.T) {
+	now := time.Now()
+	newDocs := func() map[string]string {
+		return map[string]string{
+			"a":       Format(now.Add(-time.Hour)),
+			"b":       Format(now.Add(-time.Minute)),
+			"c":       Format(now.Add(-time.Second)),
+			"future":  Format(now.Add(time.Hour)),
+			"invalid": "0000",
+		}
+	}
+	tests := []struct {
+		name    string
+		opts    Options
+		queries int
+	}{
+		{
+			name:    "Find",
+			opts:    Options{Field: "expires"},
+			queries: 1,
+		},
+		{
+			name:    "View",
+			opts:    Options{Field: "expires", DesignDoc: "_design/expiry", View: "expires"},
+			queries: 1,
+		},
+		{
+			name: "Batches",
+			opts: Options{Field: "expires", BatchSize: 2},
+			// Two full batches, and a last one holding only the invalid
+			// document.
+			queries: 3,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			fake := &fakeDB{docs: newDocs()}
+			exp := New(newTestDB(t, fake), test.opts)
+			count, err := exp.Expire(context.Background())
+			if err != nil {
+				t.Fatal(err)
+			}
+			if count != 3 {
+				t.Errorf("Expected 3 expired documents, got %d", count)
+			}
+			if len(fake.queries) != test.queries {
+				t.Errorf("Expected %d queries, got %d", test.queries, len(fake.queries))
+			}
+			var remaining []string
+			for id := range fake.docs {
+				remaining = append(remaining, id)
+			}
+			sort.Strings(remaining)
+			if d := diff.Interface([]string{"future", "invalid"}, remaining); d != "" {
+				t.Error(d)
+			}
+			if d := diff.Interface(Stats{Runs: 1, Expired: 3}, exp.Stats()); d != "" {
+				t.Error(d)
+			}
+		})
+	}
+}
+
+func TestRun(t *testing.T) {
+	fake := &fakeDB{docs: map[string]string{"a": Format(time.Now().Add(-time.Hour))}}
+	exp := New(newTestDB(t, fake), Options{Field: "expires", Interval: time.Millisecond})
+	ctx, cancel := context.WithCancel(context.Background())
+	result := make(chan error, 1)
+	go func() { result <- exp.Run(ctx) }()
+	// Wait for a second run, so that Run is known to repeat, however slowly
+	// it is scheduled. The first run has then completed, while the second
+	// may yet be canceled.
+	deadline := time.After(10 * time.Second)
+	stats := exp.Stats()
+	for stats.Runs < 2 {
+		select {
+		case <-deadline:
+			t.Fatalf("Run did not repeat: %+v", stats)
+		case <-time.After(time.Millisecond):
+		}
+		stats = exp.Stats()
+	}
+	cancel()
+	if err := <-result; err != context.Canceled {
+		t.Errorf("Unexpected error: %v", err)
+	}
+	if stats.Expired != 1 || stats.Errors != 0 {
+		t.Errorf("Unexpected stats: %+v", stats)
+	}
+}
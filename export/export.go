@@ -0,0 +1,328 @@
+// Package export streams the rows of a view, or the documents matched by a
+// Find query, to CSV, NDJSON, or flattened JSON, for loading into analytics
+// tools.
+//
+//	rows, err := db.Query(ctx, "_design/orders", "by_date", kivik.Options{"include_docs": true})
+//	if err != nil {
+//	    return err
+//	}
+//	fields, err := export.ParseFields([]string{"id", "date=key", "total=doc.total"})
+//	if err != nil {
+//	    return err
+//	}
+//	n, err := export.Rows(os.Stdout, rows, export.Options{
+//	    Format: export.CSV,
+//	    Fields: fields,
+//	})
+//
+// Each row is exported as an object with the fields id, key, value and doc,
+// omitting those which are empty, such that a field path of "doc.total"
+// selects the total field of the row's document. For rows returned by Find,
+// only doc is set.
+//
+// Import reverses an export, writing the records of such a file to a database
+// with a BulkWriter, through an optional transformation, and writing the
+// records which are rejected to a file of the same format, to be corrected and
+// imported again.
+//
+//	result, err := export.Import(ctx, db, f, export.ImportOptions{
+//	    Format:     export.CSV,
+//	    InferTypes: true,
+//	    IDFields:   []string{"email"},
+//	    IDPrefix:   "user:",
+//	    Rejects:    rejects,
+//	})
+package export
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/flimzy/kivik"
+	"github.com/flimzy/kivik/errors"
+)
+
+// Format is an export format.
+type Format string
+
+// The supported formats.
+const (
+	// NDJSON writes each row as a line of JSON. Values selected by Fields are
+	// written as they are, including objects and arrays.
+	NDJSON Format = "ndjson"
+	// CSV writes a header of the field names, followed by a record for each
+	// row. Without Fields, the columns are those of the flattened row, as for
+	// Flat. Objects and arrays are written as JSON, and null as an empty
+	// string.
+	CSV Format = "csv"
+	// Flat writes each row as a line of JSON, in which nested objects are
+	// flattened to a single level, with their keys joined by the separator,
+	// and arrays are written as JSON strings, such that each row has scalar
+	// columns, as expected by columnar formats such as Parquet.
+	Flat Format = "flat"
+)
+
+// DefaultSeparator joins the keys of flattened objects, if Options.Separator
+// is empty.
+const DefaultSeparator = "."
+
+// Field maps a value of a row to a column of the output.
+type Field struct {
+	// Name is the name of the column.
+	Name string
+	// Path is the dotted path of the value in the row, such as
+	// "doc.address.city". Numeric elements of the path index arrays, as in
+	// "doc.tags.0".
+	Path string
+}
+
+// ParseFields parses field specifications, of the form "name=path", or
+// "path", in which case the name is the path.
+func ParseFields(specs []string) ([]Field, error) {
+	fields := make([]Field, 0, len(specs))
+	for _, spec := range specs {
+		name, path := spec, spec
+		if i := strings.Index(spec, "="); i >= 0 {
+			name, path = spec[:i], spec[i+1:]
+		}
+		if name == "" || path == "" {
+			return nil, errors.Statusf(kivik.StatusBadRequest, "invalid field %q", spec)
+		}
+		fields = append(fields, Field{Name: name, Path: path})
+	}
+	return fields, nil
+}
+
+// Options configures an export.
+type Options struct {
+	// Format is the output format. If empty, NDJSON is used.
+	Format Format
+	// Fields selects the columns of the output. If empty, NDJSON writes each
+	// whole row, and CSV and Flat write the flattened columns of the row. CSV
+	// then takes its columns from the first row, and writes only those for
+	// each row.
+	Fields []Field
+	// Separator joins the keys of flattened objects. If empty,
+	// DefaultSeparator is used.
+	Separator string
+	// Comma is the CSV field delimiter. If zero, a comma is used.
+	Comma rune
+	// NoHeader disables the CSV header.
+	NoHeader bool
+}
+
+// Rows writes rows to w, in the format of opts, and closes rows. It returns
+// the number of rows written.
+func Rows(w io.Writer, rows *kivik.Rows, opts Options) (int, error) {
+	defer func() { _ = rows.Close() }()
+	if opts.Separator == "" {
+		opts.Separator = DefaultSeparator
+	}
+	var write func(map[string]interface{}) error
+	var flush func() error
+	switch opts.Format {
+	case NDJSON, "":
+		enc := json.NewEncoder(w)
+		write = func(row map[string]interface{}) error {
+			if len(opts.Fields) == 0 {
+				return enc.Encode(row)
+			}
+			return enc.Encode(selectFields(row, opts.Fields))
+		}
+	case Flat:
+		enc := json.NewEncoder(w)
+		write = func(row map[string]interface{}) error {
+			return enc.Encode(flatRow(row, opts))
+		}
+	case CSV:
+		cw := csv.NewWriter(w)
+		if opts.Comma != 0 {
+			cw.Comma = opts.Comma
+		}
+		columns := fieldNames(opts.Fields)
+		write = func(row map[string]interface{}) error {
+			var values map[string]interface{}
+			if len(opts.Fields) > 0 {
+				values = selectFields(row, opts.Fields)
+			} else {
+				values = flatRow(row, opts)
+			}
+			if columns == nil {
+				columns = sortedKeys(values)
+			}
+			if !opts.NoHeader {
+				opts.NoHeader = true
+				if err := cw.Write(columns); err != nil {
+					return err
+				}
+			}
+			record := make([]string, len(columns))
+			for i, column := range columns {
+				record[i] = csvValue(values[column])
+			}
+			return cw.Write(record)
+		}
+		flush = func() error {
+			cw.Flush()
+			return cw.Error()
+		}
+	default:
+		return 0, errors.Statusf(kivik.StatusBadRequest, "unsupported export format %q", opts.Format)
+	}
+	var n int
+	for rows.Next() {
+		row, err := readRow(rows)
+		if err != nil {
+			return n, err
+		}
+		if err := write(row); err != nil {
+			return n, err
+		}
+		n++
+	}
+	if flush != nil {
+		if err := flush(); err != nil {
+			return n, err
+		}
+	}
+	return n, rows.Err()
+}
+
+// readRow returns the current row as an object, decoding numbers as
+// json.Number, so that they are written without loss of precision.
+func readRow(rows *kivik.Rows) (map[string]interface{}, error) {
+	row := make(map[string]interface{})
+	if id := rows.ID(); id != "" {
+		row["id"] = id
+	}
+	if key := rows.Key(); key != "" {
+		v, err := decode([]byte(key))
+		if err != nil {
+			return nil, err
+		}
+		row["key"] = v
+	}
+	for name, scan := range map[string]func(interface{}) error{"value": rows.ScanValue, "doc": rows.ScanDoc} {
+		var raw json.RawMessage
+		if err := scan(&raw); err != nil || len(raw) == 0 {
+			continue
+		}
+		v, err := decode(raw)
+		if err != nil {
+			return nil, err
+		}
+		row[name] = v
+	}
+	return row, nil
+}
+
+// decode decodes a single JSON value, with numbers as json.Number.
+func decode(raw []byte) (interface{}, error) {
+	dec := json.NewDecoder(bytes.NewReader(raw))
+	dec.UseNumber()
+	var v interface{}
+	if err := dec.Decode(&v); err != nil {
+		return nil, errors.WrapStatus(kivik.StatusBadResponse, err)
+	}
+	if _, err := dec.Token(); err != io.EOF {
+		return nil, errors.Status(kivik.StatusBadResponse, "invalid JSON: trailing data")
+	}
+	return v, nil
+}
+
+// lookup returns the value at the dotted path, or nil if there is none.
+func lookup(v interface{}, path string) interface{} {
+	for _, key := range strings.Split(path, ".") {
+		switch t := v.(type) {
+		case map[string]interface{}:
+			v = t[key]
+		case []interface{}:
+			i, err := strconv.Atoi(key)
+			if err != nil || i < 0 || i >= len(t) {
+				return nil
+			}
+			v = t[i]
+		default:
+			return nil
+		}
+	}
+	return v
+}
+
+func selectFields(row map[string]interface{}, fields []Field) map[string]interface{} {
+	result := make(map[string]interface{}, len(fields))
+	for _, field := range fields {
+		result[field.Name] = lookup(row, field.Path)
+	}
+	return result
+}
+
+// flatRow returns the row, or its selected fields, flattened.
+func flatRow(row map[string]interface{}, opts Options) map[string]interface{} {
+	flat := make(map[string]interface{})
+	if len(opts.Fields) == 0 {
+		flatten(flat, "", row, opts.Separator)
+		return flat
+	}
+	for _, field := range opts.Fields {
+		flatten(flat, field.Name, lookup(row, field.Path), opts.Separator)
+	}
+	return flat
+}
+
+func flatten(flat map[string]interface{}, prefix string, v interface{}, sep string) {
+	switch t := v.(type) {
+	case map[string]interface{}:
+		for k, child := range t {
+			if prefix != "" {
+				k = prefix + sep + k
+			}
+			flatten(flat, k, child, sep)
+		}
+	case []interface{}:
+		raw, _ := json.Marshal(t)
+		flat[prefix] = string(raw)
+	default:
+		flat[prefix] = v
+	}
+}
+
+func csvValue(v interface{}) string {
+	switch t := v.(type) {
+	case nil:
+		return ""
+	case string:
+		return t
+	case json.Number:
+		return t.String()
+	case bool:
+		return strconv.FormatBool(t)
+	}
+	raw, _ := json.Marshal(v)
+	return string(raw)
+}
+
+func fieldNames(fields []Field) []string {
+	if len(fields) == 0 {
+		return nil
+	}
+	names := make([]string, len(fields))
+	for i, field := range fields {
+		names[i] = field.Name
+	}
+	return names
+}
+
+func sortedKeys(m map[string]interface{}) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,214 @@
+package export
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"testing"
+
+	"github.com/flimzy/diff"
+	"github.com/flimzy/kivik"
+	"github.com/flimzy/kivik/driver"
+	_ "github.com/flimzy/kivik/driver/memory"
+)
+
+// viewDriver wraps the memory driver, such that every view returns viewRows.
+type viewDriver struct {
+	driver.Driver
+}
+
+func (d *viewDriver) NewClient(ctx context.Context, dsn string) (driver.Client, error) {
+	c, err := d.Driver.NewClient(ctx, dsn)
+	return &viewClient{Client: c}, err
+}
+
+type viewClient struct {
+	driver.Client
+}
+
+func (c *viewClient) DB(ctx context.Context, dbName string, opts map[string]interface{}) (driver.DB, error) {
+	db, err := c.Client.DB(ctx, dbName, opts)
+	return &viewDB{DB: db}, err
+}
+
+type viewDB struct {
+	driver.DB
+}
+
+var viewRows = []string{
+	`{"id":"a","key":["2017",1],"value":1,"doc":{"_id":"a","total":12.50,"customer":{"name":"Bob","city":"Oslo"},"tags":["x","y"]}}`,
+	`{"id":"b","key":["2017",2],"value":2,"doc":{"_id":"b","total":123456789012345678,"customer":{"name":"Alice, Jr.","city":null},"tags":[]}}`,
+}
+
+func (d *viewDB) Query(_ context.Context, _, _ string, _ map[string]interface{}) (driver.Rows, error) {
+	return &sliceRows{input: viewRows}, nil
+}
+
+// BulkDocs emulates BulkDocs with Put, which the memory driver supports.
+func (d *viewDB) BulkDocs(ctx context.Context, docs []interface{}) (driver.BulkResults, error) {
+	results := &bulkResults{}
+	for i, doc := range docs {
+		raw, err := json.Marshal(doc)
+		if err != nil {
+			return nil, err
+		}
+		var stub struct {
+			ID string `json:"_id"`
+		}
+		_ = json.Unmarshal(raw, &stub)
+		if stub.ID == "" {
+			stub.ID = fmt.Sprintf("auto-%d", i)
+		}
+		rev, err := d.DB.Put(ctx, stub.ID, json.RawMessage(raw))
+		results.results = append(results.results, driver.BulkResult{ID: stub.ID, Rev: rev, Error: err})
+	}
+	return results, nil
+}
+
+type bulkResults struct {
+	results []driver.BulkResult
+}
+
+func (r *bulkResults) Next(result *driver.BulkResult) error {
+	if len(r.results) == 0 {
+		return io.EOF
+	}
+	*result = r.results[0]
+	r.results = r.results[1:]
+	return nil
+}
+
+func (r *bulkResults) Close() error { return nil }
+
+type sliceRows struct {
+	input []string
+}
+
+func (r *sliceRows) Next(row *driver.Row) error {
+	if len(r.input) == 0 {
+		return io.EOF
+	}
+	err := json.Unmarshal([]byte(r.input[0]), row)
+	r.input = r.input[1:]
+	return err
+}
+
+func (r *sliceRows) Close() error      { return nil }
+func (r *sliceRows) UpdateSeq() string { return "" }
+func (r *sliceRows) Offset() int64     { return 0 }
+func (r *sliceRows) TotalRows() int64  { return 0 }
+
+func init() {
+	memDriver, _ := kivik.LookupDriver("memory")
+	kivik.Register("export-test", &viewDriver{Driver: memDriver})
+}
+
+func TestParseFields(t *testing.T) {
+	fields, err := ParseFields([]string{"id", "total=doc.total"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []Field{{Name: "id", Path: "id"}, {Name: "total", Path: "doc.total"}}
+	if d := diff.Interface(expected, fields); d != "" {
+		t.Error(d)
+	}
+	if _, err := ParseFields([]string{"total="}); kivik.StatusCode(err) != kivik.StatusBadRequest {
+		t.Errorf("Expected bad request for an empty path, got %v", err)
+	}
+}
+
+func TestRows(t *testing.T) {
+	fields := []Field{
+		{Name: "id", Path: "id"},
+		{Name: "year", Path: "key.0"},
+		{Name: "total", Path: "doc.total"},
+		{Name: "customer", Path: "doc.customer"},
+		{Name: "missing", Path: "doc.missing.field"},
+	}
+	tests := []struct {
+		name     string
+		opts     Options
+		expected string
+		err      string
+	}{
+		{
+			name: "NDJSON",
+			expected: `{"doc":{"_id":"a","customer":{"city":"Oslo","name":"Bob"},"tags":["x","y"],"total":12.50},"id":"a","key":["2017",1],"value":1}
+{"doc":{"_id":"b","customer":{"city":null,"name":"Alice, Jr."},"tags":[],"total":123456789012345678},"id":"b","key":["2017",2],"value":2}
+`,
+		},
+		{
+			name: "NDJSONFields",
+			opts: Options{Fields: fields[:3]},
+			expected: `{"id":"a","total":12.50,"year":"2017"}
+{"id":"b","total":123456789012345678,"year":"2017"}
+`,
+		},
+		{
+			name: "CSV",
+			opts: Options{Format: CSV, Fields: fields},
+			expected: `id,year,total,customer,missing
+a,2017,12.50,"{""city"":""Oslo"",""name"":""Bob""}",
+b,2017,123456789012345678,"{""city"":null,""name"":""Alice, Jr.""}",
+`,
+		},
+		{
+			name: "CSVFlat",
+			opts: Options{Format: CSV, Comma: ';', NoHeader: true, Separator: "_"},
+			expected: `a;Oslo;Bob;"[""x"",""y""]";12.50;a;"[""2017"",1]";1
+b;;Alice, Jr.;[];123456789012345678;b;"[""2017"",2]";2
+`,
+		},
+		{
+			name: "Flat",
+			opts: Options{Format: Flat, Fields: fields[2:4]},
+			expected: `{"customer.city":"Oslo","customer.name":"Bob","total":12.50}
+{"customer.city":null,"customer.name":"Alice, Jr.","total":123456789012345678}
+`,
+		},
+		{
+			name: "UnknownFormat",
+			opts: Options{Format: "parquet"},
+			err:  `unsupported export format "parquet"`,
+		},
+	}
+	client, err := kivik.New(context.Background(), "export-test", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = client.CreateDB(context.Background(), "foo"); err != nil {
+		t.Fatal(err)
+	}
+	db, err := client.DB(context.Background(), "foo")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			rows, err := db.Query(context.Background(), "_design/foo", "bar")
+			if err != nil {
+				t.Fatal(err)
+			}
+			buf := &bytes.Buffer{}
+			n, err := Rows(buf, rows, test.opts)
+			var msg string
+			if err != nil {
+				msg = err.Error()
+			}
+			if msg != test.err {
+				t.Errorf("Unexpected error: %s", msg)
+			}
+			if err != nil {
+				return
+			}
+			if n != 2 {
+				t.Errorf("Expected 2 rows, got %d", n)
+			}
+			if d := diff.Text(test.expected, buf.String()); d != "" {
+				t.Error(d)
+			}
+		})
+	}
+}
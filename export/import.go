@@ -0,0 +1,349 @@
+package export
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"io"
+	"strings"
+	"sync"
+
+	"github.com/flimzy/kivik"
+	"github.com/flimzy/kivik/errors"
+)
+
+// DefaultIDSeparator joins the values of ImportOptions.IDFields, if
+// IDSeparator is empty.
+const DefaultIDSeparator = ":"
+
+// ImportOptions configures an import.
+type ImportOptions struct {
+	// Format is the input format. NDJSON reads a JSON object from each line.
+	// Flat does the same, but splits each key at the separator into nested
+	// objects, as does CSV for its columns. If empty, NDJSON is used.
+	Format Format
+	// Separator splits the keys of Flat and CSV input. If empty,
+	// DefaultSeparator is used.
+	Separator string
+	// Comma is the CSV field delimiter. If zero, a comma is used.
+	Comma rune
+	// Columns names the columns of CSV input which has no header. If empty,
+	// the first record is the header.
+	Columns []string
+	// InferTypes converts CSV values which are JSON numbers, true, false,
+	// objects or arrays, as written by a CSV export, to those types, and omits
+	// empty values. Otherwise, each value is a string.
+	InferTypes bool
+	// Transform, if set, is called with each record, and returns the document
+	// to write, which may be the record, modified, or nil to skip the record.
+	// An error rejects the record.
+	Transform func(record map[string]interface{}) (map[string]interface{}, error)
+	// IDFields, if set, derives the _id of each document without one, after
+	// Transform, from the values at these dotted paths, joined by IDSeparator
+	// and prefixed with IDPrefix. A document missing any of them is rejected.
+	// Documents without an _id are otherwise assigned one by the server.
+	IDFields    []string
+	IDSeparator string
+	IDPrefix    string
+	// Rejects, if set, receives the rejected records, in the input format
+	// with a CSV header, such that they may be corrected and imported again.
+	Rejects io.Writer
+	// OnReject, if set, is called with each rejected record.
+	OnReject func(Reject)
+	// BulkWriter configures the BulkWriter with which documents are written.
+	BulkWriter kivik.BulkWriterOptions
+}
+
+// Reject describes a rejected record.
+type Reject struct {
+	// Record is the line number of NDJSON or Flat input, or the number of the
+	// CSV record, excluding the header.
+	Record int
+	// Err is the reason the record was rejected: because it is invalid, or
+	// was rejected by Transform, or failed to be written.
+	Err error
+}
+
+// ImportResult counts the records of an import.
+type ImportResult struct {
+	Read     int `json:"read"`
+	Written  int `json:"written"`
+	Skipped  int `json:"skipped"`
+	Rejected int `json:"rejected"`
+}
+
+// Import reads records from r, in the format of opts, and writes them to db
+// with a BulkWriter. Invalid records, and those which fail to be written, are
+// rejected, and do not stop the import; an error is returned only if r cannot
+// be read, or ctx is cancelled.
+func Import(ctx context.Context, db *kivik.DB, r io.Reader, opts ImportOptions) (*ImportResult, error) {
+	if opts.Separator == "" {
+		opts.Separator = DefaultSeparator
+	}
+	if opts.IDSeparator == "" {
+		opts.IDSeparator = DefaultIDSeparator
+	}
+	imp := &importer{opts: opts, result: &ImportResult{}}
+	var read func() (*record, error)
+	switch opts.Format {
+	case NDJSON, Flat, "":
+		read = imp.lineReader(r)
+	case CSV:
+		read = imp.csvReader(r)
+	default:
+		return nil, errors.Statusf(kivik.StatusBadRequest, "unsupported import format %q", opts.Format)
+	}
+	w := db.NewBulkWriter(ctx, opts.BulkWriter)
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for res := range w.Results() {
+			rec := res.Doc.(*record)
+			if res.Error != nil {
+				imp.reject(rec, res.Error)
+				continue
+			}
+			imp.mu.Lock()
+			imp.result.Written++
+			imp.mu.Unlock()
+		}
+	}()
+	err := imp.feed(ctx, w, read)
+	_ = w.Close()
+	<-done
+	if err == nil {
+		err = imp.flushRejects()
+	}
+	return imp.result, err
+}
+
+// record is a record of the input, passed to the BulkWriter, which marshals
+// as its document, so that the record of a failed write may be rejected.
+type record struct {
+	n      int
+	line   []byte
+	fields []string
+	doc    map[string]interface{}
+}
+
+func (r *record) MarshalJSON() ([]byte, error) {
+	return json.Marshal(r.doc)
+}
+
+type importer struct {
+	opts    ImportOptions
+	columns []string
+
+	mu         sync.Mutex
+	result     *ImportResult
+	csvRejects *csv.Writer
+}
+
+func (imp *importer) feed(ctx context.Context, w *kivik.BulkWriter, read func() (*record, error)) error {
+	for {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		rec, err := read()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		imp.mu.Lock()
+		imp.result.Read++
+		imp.mu.Unlock()
+		if rec.doc == nil {
+			// An invalid record, already rejected.
+			continue
+		}
+		if imp.opts.Transform != nil {
+			doc, err := imp.opts.Transform(rec.doc)
+			if err != nil {
+				imp.reject(rec, err)
+				continue
+			}
+			if doc == nil {
+				imp.mu.Lock()
+				imp.result.Skipped++
+				imp.mu.Unlock()
+				continue
+			}
+			rec.doc = doc
+		}
+		if err := imp.deriveID(rec.doc); err != nil {
+			imp.reject(rec, err)
+			continue
+		}
+		if err := w.Add(rec); err != nil {
+			return err
+		}
+	}
+}
+
+func (imp *importer) deriveID(doc map[string]interface{}) error {
+	if id, _ := doc["_id"].(string); id != "" || len(imp.opts.IDFields) == 0 {
+		return nil
+	}
+	parts := make([]string, len(imp.opts.IDFields))
+	for i, path := range imp.opts.IDFields {
+		switch v := lookup(doc, path).(type) {
+		case string:
+			parts[i] = v
+		case json.Number:
+			parts[i] = v.String()
+		case nil:
+			return errors.Statusf(kivik.StatusBadRequest, "missing ID field %s", path)
+		default:
+			return errors.Statusf(kivik.StatusBadRequest, "ID field %s is not a string or number", path)
+		}
+	}
+	doc["_id"] = imp.opts.IDPrefix + strings.Join(parts, imp.opts.IDSeparator)
+	return nil
+}
+
+// lineReader returns a function which reads a record from each non-blank line
+// of r. Invalid lines are rejected, and returned without a document.
+func (imp *importer) lineReader(r io.Reader) func() (*record, error) {
+	br := bufio.NewReader(r)
+	var n int
+	return func() (*record, error) {
+		for {
+			line, err := br.ReadBytes('\n')
+			if err != nil && (err != io.EOF || len(line) == 0) {
+				return nil, err
+			}
+			n++
+			line = bytes.TrimSpace(line)
+			if len(line) == 0 {
+				continue
+			}
+			rec := &record{n: n, line: line}
+			v, err := decode(line)
+			if err != nil {
+				imp.reject(rec, errors.WrapStatus(kivik.StatusBadRequest, err))
+				return rec, nil
+			}
+			doc, ok := v.(map[string]interface{})
+			if !ok {
+				imp.reject(rec, errors.Status(kivik.StatusBadRequest, "record is not a JSON object"))
+				return rec, nil
+			}
+			if imp.opts.Format == Flat {
+				flat := doc
+				doc = make(map[string]interface{}, len(flat))
+				for k, v := range flat {
+					unflatten(doc, strings.Split(k, imp.opts.Separator), v)
+				}
+			}
+			rec.doc = doc
+			return rec, nil
+		}
+	}
+}
+
+// csvReader returns a function which reads a record from each CSV record of
+// r. Records with the wrong number of fields are rejected, and returned
+// without a document.
+func (imp *importer) csvReader(r io.Reader) func() (*record, error) {
+	cr := csv.NewReader(r)
+	if imp.opts.Comma != 0 {
+		cr.Comma = imp.opts.Comma
+	}
+	cr.FieldsPerRecord = -1
+	imp.columns = imp.opts.Columns
+	var n int
+	return func() (*record, error) {
+		fields, err := cr.Read()
+		if err != nil {
+			return nil, err
+		}
+		if imp.columns == nil {
+			imp.columns = fields
+			if fields, err = cr.Read(); err != nil {
+				return nil, err
+			}
+		}
+		n++
+		rec := &record{n: n, fields: fields}
+		if len(fields) != len(imp.columns) {
+			imp.reject(rec, errors.Statusf(kivik.StatusBadRequest, "record has %d fields, expected %d", len(fields), len(imp.columns)))
+			return rec, nil
+		}
+		rec.doc = make(map[string]interface{}, len(fields))
+		for i, field := range fields {
+			var v interface{} = field
+			if imp.opts.InferTypes {
+				if field == "" {
+					continue
+				}
+				v = inferType(field)
+			}
+			unflatten(rec.doc, strings.Split(imp.columns[i], imp.opts.Separator), v)
+		}
+		return rec, nil
+	}
+}
+
+// inferType returns the JSON value of field, or field itself if it is not a
+// number, boolean, object or array.
+func inferType(field string) interface{} {
+	switch field[0] {
+	case '{', '[', 't', 'f', '-', '0', '1', '2', '3', '4', '5', '6', '7', '8', '9':
+		if v, err := decode([]byte(field)); err == nil && v != nil {
+			return v
+		}
+	}
+	return field
+}
+
+// unflatten sets the value at path in doc, creating nested objects as
+// required.
+func unflatten(doc map[string]interface{}, path []string, v interface{}) {
+	for _, key := range path[:len(path)-1] {
+		child, ok := doc[key].(map[string]interface{})
+		if !ok {
+			child = make(map[string]interface{})
+			doc[key] = child
+		}
+		doc = child
+	}
+	doc[path[len(path)-1]] = v
+}
+
+// reject counts rec as rejected, and reports it to Rejects and OnReject.
+func (imp *importer) reject(rec *record, err error) {
+	imp.mu.Lock()
+	defer imp.mu.Unlock()
+	imp.result.Rejected++
+	if imp.opts.OnReject != nil {
+		imp.opts.OnReject(Reject{Record: rec.n, Err: err})
+	}
+	if imp.opts.Rejects == nil {
+		return
+	}
+	if rec.fields == nil {
+		_, _ = imp.opts.Rejects.Write(append(rec.line, '\n'))
+		return
+	}
+	if imp.csvRejects == nil {
+		imp.csvRejects = csv.NewWriter(imp.opts.Rejects)
+		imp.csvRejects.Comma = imp.opts.Comma
+		if imp.csvRejects.Comma == 0 {
+			imp.csvRejects.Comma = ','
+		}
+		_ = imp.csvRejects.Write(imp.columns)
+	}
+	_ = imp.csvRejects.Write(rec.fields)
+}
+
+func (imp *importer) flushRejects() error {
+	if imp.csvRejects == nil {
+		return nil
+	}
+	imp.csvRejects.Flush()
+	return imp.csvRejects.Error()
+}
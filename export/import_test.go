@@ -0,0 +1,176 @@
+package export
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/flimzy/diff"
+	"github.com/flimzy/kivik"
+)
+
+func TestImport(t *testing.T) {
+	tests := []struct {
+		name     string
+		input    string
+		opts     ImportOptions
+		result   ImportResult
+		rejects  string
+		records  []int
+		expected map[string]interface{}
+		err      string
+	}{
+		{
+			name: "NDJSON",
+			input: `{"_id":"a","n":1}
+
+{"_id":"b",
+[1,2]
+{"email":"bob@example.com","n":2}
+{"n":3}
+{"_id":"existing"}
+{"_id":"c","skip":true}
+{"_id":"d","reject":true}
+`,
+			opts: ImportOptions{
+				IDFields: []string{"email"},
+				IDPrefix: "user:",
+				Transform: func(record map[string]interface{}) (map[string]interface{}, error) {
+					if record["skip"] == true {
+						return nil, nil
+					}
+					if record["reject"] == true {
+						return nil, errors.New("rejected")
+					}
+					record["imported"] = true
+					return record, nil
+				},
+			},
+			result: ImportResult{Read: 8, Written: 2, Skipped: 1, Rejected: 5},
+			rejects: `{"_id":"b",
+[1,2]
+{"n":3}
+{"_id":"existing"}
+{"_id":"d","reject":true}
+`,
+			records: []int{3, 4, 6, 7, 9},
+			expected: map[string]interface{}{
+				"a":                    map[string]interface{}{"_id": "a", "n": json.Number("1"), "imported": true},
+				"user:bob@example.com": map[string]interface{}{"_id": "user:bob@example.com", "email": "bob@example.com", "n": json.Number("2"), "imported": true},
+			},
+		},
+		{
+			name: "CSV",
+			input: `_id;customer.name;customer.age;tags;note
+a;Bob;30;"[""x""]";
+b;Alice;x;[];"true"
+c;short
+`,
+			opts:    ImportOptions{Format: CSV, Comma: ';', InferTypes: true},
+			result:  ImportResult{Read: 3, Written: 2, Rejected: 1},
+			rejects: "_id;customer.name;customer.age;tags;note\nc;short\n",
+			records: []int{3},
+			expected: map[string]interface{}{
+				"a": map[string]interface{}{"_id": "a", "customer": map[string]interface{}{"name": "Bob", "age": json.Number("30")}, "tags": []interface{}{"x"}},
+				"b": map[string]interface{}{"_id": "b", "customer": map[string]interface{}{"name": "Alice", "age": "x"}, "tags": []interface{}{}, "note": true},
+			},
+		},
+		{
+			name:   "CSVColumns",
+			input:  "1,2017,12\n",
+			opts:   ImportOptions{Format: CSV, Columns: []string{"n", "key_year", "key_month"}, Separator: "_", IDFields: []string{"key.year", "key.month"}},
+			result: ImportResult{Read: 1, Written: 1},
+			expected: map[string]interface{}{
+				"2017:12": map[string]interface{}{"_id": "2017:12", "n": "1", "key": map[string]interface{}{"year": "2017", "month": "12"}},
+			},
+		},
+		{
+			name:   "Flat",
+			input:  `{"_id":"a","customer.name":"Bob","customer.city":null}`,
+			opts:   ImportOptions{Format: Flat},
+			result: ImportResult{Read: 1, Written: 1},
+			expected: map[string]interface{}{
+				"a": map[string]interface{}{"_id": "a", "customer": map[string]interface{}{"name": "Bob", "city": nil}},
+			},
+		},
+		{
+			name: "UnknownFormat",
+			opts: ImportOptions{Format: "parquet"},
+			err:  `unsupported import format "parquet"`,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			ctx := context.Background()
+			client, err := kivik.New(ctx, "export-test", "")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err = client.CreateDB(ctx, "import"); err != nil {
+				t.Fatal(err)
+			}
+			db, err := client.DB(ctx, "import")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if _, err = db.Put(ctx, "existing", map[string]interface{}{}); err != nil {
+				t.Fatal(err)
+			}
+			rejects := &bytes.Buffer{}
+			var records []int
+			test.opts.Rejects = rejects
+			test.opts.OnReject = func(r Reject) {
+				records = append(records, r.Record)
+			}
+			result, err := Import(ctx, db, strings.NewReader(test.input), test.opts)
+			var msg string
+			if err != nil {
+				msg = err.Error()
+			}
+			if msg != test.err {
+				t.Errorf("Unexpected error: %s", msg)
+			}
+			if err != nil {
+				return
+			}
+			if d := diff.Interface(test.result, *result); d != "" {
+				t.Error(d)
+			}
+			// Failed writes are rejected as their results arrive, so the
+			// order of rejects is not deterministic.
+			if d := diff.Interface(sortedLines(test.rejects), sortedLines(rejects.String())); d != "" {
+				t.Error(d)
+			}
+			sort.Ints(records)
+			if d := diff.Interface(test.records, records); d != "" {
+				t.Error(d)
+			}
+			for id, expected := range test.expected {
+				row, err := db.Get(ctx, id)
+				if err != nil {
+					t.Fatalf("Failed to get %s: %s", id, err)
+				}
+				var raw json.RawMessage
+				if err = row.ScanDoc(&raw); err != nil {
+					t.Fatal(err)
+				}
+				v, _ := decode(raw)
+				doc := v.(map[string]interface{})
+				delete(doc, "_rev")
+				if d := diff.Interface(expected, doc); d != "" {
+					t.Errorf("%s: %s", id, d)
+				}
+			}
+		})
+	}
+}
+
+func sortedLines(s string) []string {
+	lines := strings.Split(s, "\n")
+	sort.Strings(lines)
+	return lines
+}
@@ -0,0 +1,159 @@
+// Package filter implements filtering of the changes feed, for drivers and
+// servers which emulate CouchDB, such as the memory driver and the serve
+// package.
+//
+// The built-in filters _doc_ids, _selector and _design are supported, as are
+// Go filter functions registered with Register, in place of the JavaScript
+// filter functions of design documents.
+//
+// See http://docs.couchdb.org/en/2.0.0/api/database/changes.html#filtering
+package filter
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"sync"
+
+	"github.com/flimzy/kivik"
+	"github.com/flimzy/kivik/errors"
+	"github.com/flimzy/kivik/mango"
+)
+
+// Func is a filter function. It reports whether the change to doc is
+// included in the feed. For a deleted document, doc has only the _id, _rev and
+// _deleted fields. query holds the options of the changes request, such as
+// custom query parameters.
+type Func func(doc map[string]interface{}, query map[string]interface{}) bool
+
+var (
+	funcsMu sync.RWMutex
+	funcs   = make(map[string]Func)
+)
+
+// Register makes fn available as the filter name, in the form ddoc/filter,
+// as for the JavaScript filter function filter in the design document
+// _design/ddoc. If Register is called twice with the same name, or if fn is
+// nil, it panics.
+func Register(name string, fn Func) {
+	funcsMu.Lock()
+	defer funcsMu.Unlock()
+	if fn == nil {
+		panic("filter: Register func is nil")
+	}
+	if _, dup := funcs[name]; dup {
+		panic("filter: Register called twice for filter " + name)
+	}
+	funcs[name] = fn
+}
+
+func lookup(name string) (Func, bool) {
+	funcsMu.RLock()
+	defer funcsMu.RUnlock()
+	fn, ok := funcs[name]
+	return fn, ok
+}
+
+// IsOption reports whether the named changes feed option is interpreted by a
+// Filter. Servers which apply the filter themselves should not pass these
+// options on to the driver.
+func IsOption(name string) bool {
+	switch name {
+	case "filter", "doc_ids", "selector":
+		return true
+	}
+	return false
+}
+
+// Filter filters the changes feed.
+type Filter struct {
+	match func(docID string, doc map[string]interface{}) bool
+}
+
+// New returns the filter requested by the changes feed options, or nil if no
+// filter was requested. The filter option is one of _doc_ids, which requires
+// the doc_ids option, _selector, which requires the selector option,
+// _design, or the name of a registered Func.
+//
+// The doc_ids and selector options may be given as values, or as JSON
+// strings, as received in a query string. An error with status
+// StatusBadRequest is returned for invalid options, or StatusNotFound for an
+// unknown filter.
+func New(opts map[string]interface{}) (*Filter, error) {
+	name, _ := opts["filter"].(string)
+	switch name {
+	case "":
+		return nil, nil
+	case "_doc_ids":
+		var docIDs []string
+		if err := decodeOption(opts, "doc_ids", &docIDs); err != nil {
+			return nil, err
+		}
+		ids := make(map[string]bool, len(docIDs))
+		for _, id := range docIDs {
+			ids[id] = true
+		}
+		return &Filter{match: func(docID string, _ map[string]interface{}) bool {
+			return ids[docID]
+		}}, nil
+	case "_selector":
+		var selector map[string]interface{}
+		if err := decodeOption(opts, "selector", &selector); err != nil {
+			return nil, err
+		}
+		matcher, err := mango.NewMatcher(selector)
+		if err != nil {
+			return nil, err
+		}
+		return &Filter{match: func(_ string, doc map[string]interface{}) bool {
+			match, _ := matcher.Match(doc)
+			return match
+		}}, nil
+	case "_design":
+		return &Filter{match: func(docID string, _ map[string]interface{}) bool {
+			return strings.HasPrefix(docID, "_design/")
+		}}, nil
+	case "_view":
+		return nil, errors.Status(kivik.StatusNotImplemented, "filter: _view filter is not supported")
+	}
+	fn, ok := lookup(name)
+	if !ok {
+		return nil, errors.Statusf(kivik.StatusNotFound, "filter: missing filter %s", name)
+	}
+	return &Filter{match: func(_ string, doc map[string]interface{}) bool {
+		return fn(doc, opts)
+	}}, nil
+}
+
+// decodeOption decodes the named option into dest, decoding strings as JSON.
+func decodeOption(opts map[string]interface{}, name string, dest interface{}) error {
+	value, ok := opts[name]
+	if !ok {
+		return errors.Statusf(kivik.StatusBadRequest, "filter: %s option required", name)
+	}
+	var raw []byte
+	switch t := value.(type) {
+	case string:
+		raw = []byte(t)
+	case json.RawMessage:
+		raw = t
+	default:
+		var err error
+		if raw, err = json.Marshal(value); err != nil {
+			return errors.WrapStatus(kivik.StatusBadRequest, err)
+		}
+	}
+	if err := json.Unmarshal(raw, dest); err != nil {
+		return errors.WrapStatus(kivik.StatusBadRequest, fmt.Errorf("filter: invalid %s option: %s", name, err))
+	}
+	return nil
+}
+
+// Match reports whether the change to the document is included in the feed.
+// A nil Filter matches all changes.
+func (f *Filter) Match(docID string, doc map[string]interface{}) bool {
+	if f == nil {
+		return true
+	}
+	return f.match(docID, doc)
+}
@@ -0,0 +1,89 @@
+package filter
+
+import (
+	"testing"
+
+	"github.com/flimzy/diff"
+	"github.com/flimzy/kivik"
+)
+
+func init() {
+	Register("app/important", func(doc map[string]interface{}, query map[string]interface{}) bool {
+		return doc["priority"] == query["priority"]
+	})
+}
+
+func TestFilter(t *testing.T) {
+	docs := map[string]map[string]interface{}{
+		"a":           {"_id": "a", "priority": "high", "n": 1.0},
+		"b":           {"_id": "b", "priority": "low", "n": 2.0},
+		"_design/foo": {"_id": "_design/foo"},
+	}
+	tests := []struct {
+		name     string
+		opts     map[string]interface{}
+		expected []string
+		status   int
+	}{
+		{
+			name:     "None",
+			opts:     map[string]interface{}{},
+			expected: []string{"_design/foo", "a", "b"},
+		},
+		{
+			name:     "DocIDs",
+			opts:     map[string]interface{}{"filter": "_doc_ids", "doc_ids": []string{"b"}},
+			expected: []string{"b"},
+		},
+		{
+			name:     "DocIDsJSON",
+			opts:     map[string]interface{}{"filter": "_doc_ids", "doc_ids": `["a","_design/foo"]`},
+			expected: []string{"_design/foo", "a"},
+		},
+		{
+			name:   "DocIDsMissing",
+			opts:   map[string]interface{}{"filter": "_doc_ids"},
+			status: kivik.StatusBadRequest,
+		},
+		{
+			name:     "Selector",
+			opts:     map[string]interface{}{"filter": "_selector", "selector": `{"n":{"$gt":1}}`},
+			expected: []string{"b"},
+		},
+		{
+			name:     "Design",
+			opts:     map[string]interface{}{"filter": "_design"},
+			expected: []string{"_design/foo"},
+		},
+		{
+			name:     "Registered",
+			opts:     map[string]interface{}{"filter": "app/important", "priority": "high"},
+			expected: []string{"a"},
+		},
+		{
+			name:   "Unknown",
+			opts:   map[string]interface{}{"filter": "app/unknown"},
+			status: kivik.StatusNotFound,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			f, err := New(test.opts)
+			if kivik.StatusCode(err) != test.status {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if err != nil {
+				return
+			}
+			var result []string
+			for _, id := range []string{"_design/foo", "a", "b"} {
+				if f.Match(id, docs[id]) {
+					result = append(result, id)
+				}
+			}
+			if d := diff.Interface(test.expected, result); d != "" {
+				t.Error(d)
+			}
+		})
+	}
+}
@@ -10,15 +10,32 @@ import (
 var findNotImplemented = errors.Status(StatusNotImplemented, "kivik: driver does not support Find interface")
 
 // Find executes a query using the new /_find interface. The query must be
-// JSON-marshalable to a valid query.
+// JSON-marshalable to a valid query. Values of types registered with
+// RegisterKeyEncoder, within a query of maps and slices, are encoded by their
+// KeyEncoder.
 // See http://docs.couchdb.org/en/2.0.0/api/database/find.html#db-find
 func (db *DB) Find(ctx context.Context, query interface{}) (*Rows, error) {
 	if finder, ok := db.driverDB.(driver.Finder); ok {
-		rowsi, err := finder.Find(ctx, query)
+		query, err := EncodeValue(query)
 		if err != nil {
+			return nil, errors.WrapStatus(StatusBadRequest, err)
+		}
+		ctx, cancel := withTimeout(ctx, db.timeouts.Query)
+		result, err := db.invoke(ctx, &Operation{Name: "Find"}, func(ctx context.Context, _ *Operation) (interface{}, error) {
+			return finder.Find(ctx, query)
+		})
+		if err != nil {
+			cancel()
 			return nil, err
 		}
-		return newRows(ctx, rowsi), nil
+		rowsi, ok := result.(driver.Rows)
+		if !ok {
+			cancel()
+			return nil, unexpectedResult("Find", result)
+		}
+		rows := newRows(ctx, rowsi, false)
+		rows.releaseOnClose(cancel)
+		return rows, nil
 	}
 	return nil, findNotImplemented
 }
@@ -28,16 +45,26 @@ func (db *DB) Find(ctx context.Context, query interface{}) (*Rows, error) {
 // index object, as described here:
 // http://docs.couchdb.org/en/2.0.0/api/database/find.html#find-sort
 func (db *DB) CreateIndex(ctx context.Context, ddoc, name string, index interface{}) error {
+	ctx, cancel := withTimeout(ctx, db.timeouts.Write)
+	defer cancel()
 	if finder, ok := db.driverDB.(driver.Finder); ok {
-		return finder.CreateIndex(ctx, ddoc, name, index)
+		_, err := db.invoke(ctx, &Operation{Name: "CreateIndex", DocID: ddoc}, func(ctx context.Context, _ *Operation) (interface{}, error) {
+			return nil, finder.CreateIndex(ctx, ddoc, name, index)
+		})
+		return err
 	}
 	return findNotImplemented
 }
 
 // DeleteIndex deletes the requested index.
 func (db *DB) DeleteIndex(ctx context.Context, ddoc, name string) error {
+	ctx, cancel := withTimeout(ctx, db.timeouts.Write)
+	defer cancel()
 	if finder, ok := db.driverDB.(driver.Finder); ok {
-		return finder.DeleteIndex(ctx, ddoc, name)
+		_, err := db.invoke(ctx, &Operation{Name: "DeleteIndex", DocID: ddoc}, func(ctx context.Context, _ *Operation) (interface{}, error) {
+			return nil, finder.DeleteIndex(ctx, ddoc, name)
+		})
+		return err
 	}
 	return findNotImplemented
 }
@@ -52,8 +79,13 @@ type Index struct {
 
 // GetIndexes returns the indexes defined on the current database.
 func (db *DB) GetIndexes(ctx context.Context) ([]Index, error) {
+	ctx, cancel := withTimeout(ctx, db.timeouts.Read)
+	defer cancel()
 	if finder, ok := db.driverDB.(driver.Finder); ok {
-		dIndexes, err := finder.GetIndexes(ctx)
+		result, err := db.invoke(ctx, &Operation{Name: "GetIndexes"}, func(ctx context.Context, _ *Operation) (interface{}, error) {
+			return finder.GetIndexes(ctx)
+		})
+		dIndexes, _ := result.([]driver.Index)
 		indexes := make([]Index, len(dIndexes))
 		for i, index := range dIndexes {
 			indexes[i] = Index(index)
@@ -62,3 +94,42 @@ func (db *DB) GetIndexes(ctx context.Context) ([]Index, error) {
 	}
 	return nil, findNotImplemented
 }
+
+// QueryPlan is the query plan for a Mango query, as returned by Explain.
+type QueryPlan struct {
+	DBName   string                 `json:"dbname"`
+	Index    map[string]interface{} `json:"index"`
+	Selector map[string]interface{} `json:"selector"`
+	Options  map[string]interface{} `json:"opts"`
+	Limit    int64                  `json:"limit"`
+	Skip     int64                  `json:"skip"`
+	Fields   []interface{}          `json:"fields"`
+	Range    map[string]interface{} `json:"range"`
+}
+
+// Explain returns the query plan for query, which is as for Find, without
+// executing it. The plan names the index which would be used.
+// See http://docs.couchdb.org/en/2.0.0/api/database/find.html#db-explain
+func (db *DB) Explain(ctx context.Context, query interface{}) (*QueryPlan, error) {
+	ctx, cancel := withTimeout(ctx, db.timeouts.Read)
+	defer cancel()
+	if explainer, ok := db.driverDB.(driver.Explainer); ok {
+		query, err := EncodeValue(query)
+		if err != nil {
+			return nil, errors.WrapStatus(StatusBadRequest, err)
+		}
+		result, err := db.invoke(ctx, &Operation{Name: "Explain"}, func(ctx context.Context, _ *Operation) (interface{}, error) {
+			return explainer.Explain(ctx, query)
+		})
+		if err != nil {
+			return nil, err
+		}
+		plan, ok := result.(*driver.QueryPlan)
+		if !ok {
+			return nil, unexpectedResult("Explain", result)
+		}
+		qp := QueryPlan(*plan)
+		return &qp, nil
+	}
+	return nil, errors.Status(StatusNotImplemented, "kivik: driver does not support Explain interface")
+}
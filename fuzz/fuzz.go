@@ -0,0 +1,317 @@
+// Package fuzz provides fuzz functions, compatible with go-fuzz
+// (https://github.com/dvyukov/go-fuzz), which exercise document ID encoding,
+// view key encoding, and option handling across the memory driver, the CouchDB
+// driver's URL building, and the serve endpoints.
+//
+// To run one of the fuzzers:
+//
+//	go-fuzz-build -func DocID github.com/flimzy/kivik/fuzz
+//	go-fuzz -bin fuzz-fuzz.zip -workdir workdir
+//
+// Each function panics when an invariant is violated. The package tests run
+// each function over a corpus of inputs known to be troublesome.
+package fuzz
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync"
+	"unicode/utf8"
+
+	"github.com/flimzy/kivik"
+	"github.com/flimzy/kivik/driver/couchdb/chttp"
+	"github.com/flimzy/kivik/errors"
+	"github.com/flimzy/kivik/serve"
+	"github.com/flimzy/kivik/serve/conf"
+	"github.com/flimzy/kivik/serve/logger"
+	"github.com/spf13/viper"
+
+	// Drivers
+	_ "github.com/flimzy/kivik/driver/couchdb"
+	_ "github.com/flimzy/kivik/driver/memory"
+)
+
+const testDB = "fuzz"
+
+// request is a request received by the fake CouchDB server.
+type request struct {
+	Method string
+	Path   string
+	Query  url.Values
+	Body   []byte
+}
+
+// fakeCouch is a minimal CouchDB stand-in, which records the last request,
+// and responds with a canned success response. Document writes echo back the
+// document ID from the request path.
+type fakeCouch struct {
+	mu   sync.Mutex
+	last request
+	srv  *httptest.Server
+}
+
+func newFakeCouch() *fakeCouch {
+	f := &fakeCouch{}
+	f.srv = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+		req := request{Method: r.Method, Path: r.URL.EscapedPath(), Query: r.URL.Query(), Body: body}
+		f.mu.Lock()
+		f.last = req
+		f.mu.Unlock()
+		w.Header().Set("Content-Type", "application/json")
+		switch {
+		case strings.Contains(r.URL.Path, "/_all_docs"), strings.Contains(r.URL.Path, "/_view/"):
+			_, _ = w.Write([]byte(`{"total_rows":0,"offset":0,"rows":[]}`))
+		default:
+			escaped := strings.TrimPrefix(req.Path, "/"+testDB+"/")
+			docID, _ := decodeDocID(escaped)
+			_ = json.NewEncoder(w).Encode(map[string]interface{}{"ok": true, "id": docID, "rev": "1-abc"})
+		}
+	}))
+	return f
+}
+
+func (f *fakeCouch) lastRequest() request {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.last
+}
+
+var (
+	setupOnce sync.Once
+	memClient *kivik.Client
+	couch     *fakeCouch
+	couchDB   *kivik.DB
+	handler   http.Handler
+)
+
+func setup() {
+	setupOnce.Do(func() {
+		var err error
+		memClient, err = kivik.New(context.Background(), "memory", "")
+		if err != nil {
+			panic(err)
+		}
+		if err = memClient.CreateDB(context.Background(), testDB); err != nil {
+			panic(err)
+		}
+		couch = newFakeCouch()
+		couchClient, err := kivik.New(context.Background(), "couch", couch.srv.URL)
+		if err != nil {
+			panic(err)
+		}
+		if couchDB, err = couchClient.DB(context.Background(), testDB); err != nil {
+			panic(err)
+		}
+		service := &serve.Service{
+			Client:        memClient,
+			Config:        &conf.Conf{Viper: viper.New()},
+			RequestLogger: logger.New(ioutil.Discard),
+		}
+		if handler, err = service.Init(); err != nil {
+			panic(err)
+		}
+	})
+}
+
+// decodeDocID reverses chttp.EncodeDocID.
+func decodeDocID(encoded string) (string, error) {
+	for _, prefix := range []string{"_design/", "_local/"} {
+		if strings.HasPrefix(encoded, prefix) {
+			rest, err := url.QueryUnescape(strings.TrimPrefix(encoded, prefix))
+			return prefix + rest, err
+		}
+	}
+	return url.QueryUnescape(encoded)
+}
+
+// isClientError returns true if err is nil, or carries a 4xx status.
+func isClientError(err error) bool {
+	status := errors.StatusCode(err)
+	return err == nil || (status >= 400 && status < 500)
+}
+
+// DocID treats data as a document ID. It verifies that the ID survives a
+// round trip through the memory driver, and through the CouchDB driver's URL
+// encoding.
+func DocID(data []byte) int {
+	if len(data) == 0 || !utf8.Valid(data) {
+		return -1
+	}
+	setup()
+	docID := string(data)
+
+	encoded := chttp.EncodeDocID(docID)
+	if decoded, err := decodeDocID(encoded); err != nil || decoded != docID {
+		panic(fmt.Sprintf("EncodeDocID(%q) = %q, which decodes to %q (%v)", docID, encoded, decoded, err))
+	}
+
+	db, err := memClient.DB(context.Background(), testDB)
+	if err != nil {
+		panic(err)
+	}
+	doc := map[string]string{"value": docID}
+	rev, err := db.Put(context.Background(), docID, doc)
+	if err != nil {
+		if !isClientError(err) {
+			panic(fmt.Sprintf("memory Put(%q) failed: %s", docID, err))
+		}
+		return 0
+	}
+	row, err := db.Get(context.Background(), docID, kivik.Options{"rev": rev})
+	if err != nil {
+		panic(fmt.Sprintf("memory Get(%q) failed: %s", docID, err))
+	}
+	var result struct {
+		ID    string `json:"_id"`
+		Value string `json:"value"`
+	}
+	if err := row.ScanDoc(&result); err != nil {
+		panic(err)
+	}
+	if result.ID != docID || result.Value != docID {
+		panic(fmt.Sprintf("memory round trip of %q returned %+v", docID, result))
+	}
+
+	if _, err := couchDB.Put(context.Background(), docID, doc); err != nil {
+		panic(fmt.Sprintf("couch Put(%q) failed: %s", docID, err))
+	}
+	req := couch.lastRequest()
+	prefix := "/" + testDB + "/"
+	if req.Method != kivik.MethodPut || !strings.HasPrefix(req.Path, prefix) {
+		panic(fmt.Sprintf("couch Put(%q) sent %s %s", docID, req.Method, req.Path))
+	}
+	if decoded, _ := decodeDocID(strings.TrimPrefix(req.Path, prefix)); decoded != docID {
+		panic(fmt.Sprintf("couch Put(%q) sent path %s", docID, req.Path))
+	}
+	return 1
+}
+
+// ViewKey treats data as a JSON view key. It verifies that valid keys are
+// passed through to the server unaltered.
+func ViewKey(data []byte) int {
+	var key interface{}
+	if err := json.Unmarshal(data, &key); err != nil {
+		return -1
+	}
+	setup()
+	encoded, err := json.Marshal(key)
+	if err != nil {
+		panic(err)
+	}
+	if _, err := couchDB.Query(context.Background(), "ddoc", "view", kivik.Options{"key": string(encoded)}); err != nil {
+		panic(fmt.Sprintf("Query with key %s failed: %s", encoded, err))
+	}
+	var received interface{}
+	if err := json.Unmarshal([]byte(couch.lastRequest().Query.Get("key")), &received); err != nil {
+		panic(fmt.Sprintf("server received invalid key for %s: %s", encoded, err))
+	}
+	if sent, _ := json.Marshal(received); !bytes.Equal(sent, encoded) {
+		panic(fmt.Sprintf("key %s received as %s", encoded, sent))
+	}
+	return 1
+}
+
+// Options treats data as a URL query string, converted to options. It
+// verifies that options are either rejected with an error, or passed to the
+// server unaltered, in the query string, or for keys, in the request body.
+func Options(data []byte) int {
+	values, err := url.ParseQuery(string(data))
+	if err != nil || len(values) == 0 {
+		return -1
+	}
+	setup()
+	opts := kivik.Options{}
+	for key, vals := range values {
+		if len(vals) == 1 {
+			opts[key] = vals[0]
+		} else {
+			opts[key] = vals
+		}
+	}
+	if _, err := couchDB.AllDocs(context.Background(), opts); err != nil {
+		if !isClientError(err) {
+			panic(fmt.Sprintf("AllDocs(%v) failed: %s", opts, err))
+		}
+		return 0
+	}
+	req := couch.lastRequest()
+	received := req.Query
+	for key, vals := range values {
+		if key == "keys" {
+			checkKeys(opts[key], req.Body)
+			continue
+		}
+		if strings.Join(received[key], "\x00") != strings.Join(vals, "\x00") {
+			panic(fmt.Sprintf("option %q sent as %q, received as %q", key, vals, received[key]))
+		}
+	}
+	return 1
+}
+
+// checkKeys verifies that the keys option sent was received unaltered in the
+// request body.
+func checkKeys(sent interface{}, body []byte) {
+	expected, ok := sent.(string)
+	if !ok {
+		encoded, err := json.Marshal(sent)
+		if err != nil {
+			panic(err)
+		}
+		expected = string(encoded)
+	}
+	var received struct {
+		Keys json.RawMessage `json:"keys"`
+	}
+	if err := json.Unmarshal(body, &received); err != nil {
+		panic(fmt.Sprintf("server received invalid keys body %s: %s", body, err))
+	}
+	if string(received.Keys) != expected {
+		panic(fmt.Sprintf("keys %s received as %s", expected, received.Keys))
+	}
+}
+
+var methods = []string{
+	kivik.MethodGet,
+	kivik.MethodHead,
+	kivik.MethodPost,
+	kivik.MethodPut,
+	kivik.MethodDelete,
+	kivik.MethodCopy,
+}
+
+// Serve treats data as an HTTP request against the kivik server, with the
+// first byte selecting the method, and the remainder the request URI and
+// optional body, separated by a newline. It verifies that the server does not
+// panic, nor respond with an internal server error.
+func Serve(data []byte) int {
+	if len(data) < 2 {
+		return -1
+	}
+	setup()
+	method := methods[int(data[0])%len(methods)]
+	parts := bytes.SplitN(data[1:], []byte("\n"), 2)
+	uri := "/" + strings.TrimPrefix(string(parts[0]), "/")
+	if _, err := url.ParseRequestURI(uri); err != nil {
+		return -1
+	}
+	var body []byte
+	if len(parts) > 1 {
+		body = parts[1]
+	}
+	req := httptest.NewRequest(method, "http://localhost"+uri, bytes.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, req)
+	if w.Code >= 500 && w.Code != http.StatusNotImplemented {
+		panic(fmt.Sprintf("%s %s returned %d: %s", method, uri, w.Code, w.Body.String()))
+	}
+	return 1
+}
@@ -0,0 +1,110 @@
+package fuzz
+
+import (
+	"fmt"
+	"testing"
+)
+
+// run calls fn with each input, converting panics to test failures.
+func run(t *testing.T, fn func([]byte) int, inputs []string) {
+	for _, input := range inputs {
+		t.Run(fmt.Sprintf("%q", input), func(t *testing.T) {
+			defer func() {
+				if r := recover(); r != nil {
+					t.Error(r)
+				}
+			}()
+			fn([]byte(input))
+		})
+	}
+}
+
+func TestDocID(t *testing.T) {
+	run(t, DocID, []string{
+		"foo",
+		"foo bar",
+		"foo+bar",
+		"foo/bar",
+		"foo%2Fbar",
+		"100%",
+		"?query=yes",
+		"#fragment",
+		"_design/foo",
+		"_design/foo/bar",
+		"_design/foo bar",
+		"_local/foo",
+		"_local/foo+bar",
+		"_design",
+		"_users",
+		"_",
+		"日本語",
+		"naïve café",
+		"emoji 😀",
+		"\x00",
+		"tab\there",
+		"new\nline",
+		"../../etc/passwd",
+		"%",
+		"a:b",
+	})
+}
+
+func TestViewKey(t *testing.T) {
+	run(t, ViewKey, []string{
+		`"foo"`,
+		`"foo&bar=baz"`,
+		`"100% + 1"`,
+		`null`,
+		`12345678901234567890`,
+		`-0.5e-10`,
+		`true`,
+		`[]`,
+		`{}`,
+		`["a",["b",["c",["d",["e",{"f":[1,2,{"g":null}]}]]]]]`,
+		`{"\u0000":"😀"}`,
+		`"日本語"`,
+	})
+}
+
+func TestOptions(t *testing.T) {
+	run(t, Options, []string{
+		"include_docs=true",
+		"key=%22foo%22",
+		"keys=a&keys=b",
+		"keys=%5B%22a%22%2C%22b%22%5D",
+		"keys=a",
+		"startkey=%5B%22a%22%2C%7B%7D%5D",
+		"limit=-1",
+		"a=%26&b=%3D",
+		"=empty",
+		"empty=",
+		"%00=%00",
+	})
+}
+
+func TestServe(t *testing.T) {
+	run(t, Serve, []string{
+		"\x00/",
+		"\x00/_all_dbs",
+		"\x00/fuzz",
+		"\x00/fuzz/foo",
+		"\x00/fuzz/_design/foo",
+		"\x00/fuzz/%2F",
+		"\x00/fuzz/foo%20bar",
+		"\x00/missing",
+		"\x00/_session",
+		"\x00/_config",
+		"\x01/fuzz",
+		"\x02/_session\n{\"name\":",
+		"\x02/_session\nnot json",
+		"\x03/fuzz/foo\n{\"a\":\"b\"}",
+		"\x03/fuzz/foo\n[1,2,3]",
+		"\x03/fuzz/foo\n",
+		"\x03/Invalid-Name",
+		"\x04/fuzz",
+		"\x05/fuzz/foo",
+		"\x00/fuzz/_all_docs?limit=abc",
+		"\x00/_utils/",
+		"\x00/%zz",
+	})
+}
@@ -0,0 +1,88 @@
+package kivik
+
+import (
+	"strings"
+
+	"golang.org/x/net/context"
+)
+
+// The types of event recorded by the _global_changes database.
+const (
+	GlobalChangeCreated = "created"
+	GlobalChangeUpdated = "updated"
+	GlobalChangeDeleted = "deleted"
+)
+
+// GlobalChanges is an iterator over the changes feed of the _global_changes
+// database of CouchDB 2.x, which records an event for each database created,
+// updated or deleted on the server. Each event is a document with the ID
+// "type:dbname", so that the latest event of each database is reported, with
+// the sequence of the _global_changes database. The methods of Changes, such
+// as Next and Seq, are available, with the database and type of each event.
+type GlobalChanges struct {
+	*Changes
+}
+
+// GlobalChange is an event of the global changes feed, as returned by
+// GlobalChanges.GlobalChange.
+type GlobalChange struct {
+	// DBName is the name of the database.
+	DBName string `json:"db_name"`
+	// Type is the type of the event, such as GlobalChangeUpdated.
+	Type string `json:"type"`
+	// Seq is the update sequence of the event in the _global_changes
+	// database.
+	Seq SequenceID `json:"seq"`
+}
+
+// GlobalChanges returns an iterator over the changes feed of the
+// _global_changes database, with options as for DB.Changes, such as since and
+// feed.
+func (c *Client) GlobalChanges(ctx context.Context, options ...Options) (*GlobalChanges, error) {
+	db, err := c.DB(ctx, GlobalChangesDB)
+	if err != nil {
+		return nil, err
+	}
+	changes, err := db.Changes(ctx, options...)
+	if err != nil {
+		return nil, err
+	}
+	return &GlobalChanges{Changes: changes}, nil
+}
+
+// globalEvent splits the ID of a _global_changes document into the type and
+// database name of the event. ok is false if it is not an event.
+func globalEvent(id string) (eventType, dbName string, ok bool) {
+	parts := strings.SplitN(id, ":", 2)
+	if len(parts) != 2 {
+		return "", "", false
+	}
+	return parts[0], parts[1], true
+}
+
+// DBName returns the name of the database of the current event.
+func (g *GlobalChanges) DBName() string {
+	_, dbName, _ := globalEvent(g.ID())
+	return dbName
+}
+
+// Type returns the type of the current event, such as GlobalChangeUpdated.
+func (g *GlobalChanges) Type() string {
+	eventType, _, _ := globalEvent(g.ID())
+	return eventType
+}
+
+// GlobalChange returns the current event, or nil if there is none, as before
+// the first call to Next, or once the feed is closed, or if the current
+// result is not an event, such as a design document.
+func (g *GlobalChanges) GlobalChange() *GlobalChange {
+	change := g.Change()
+	if change == nil {
+		return nil
+	}
+	eventType, dbName, ok := globalEvent(change.ID)
+	if !ok {
+		return nil
+	}
+	return &GlobalChange{DBName: dbName, Type: eventType, Seq: change.Seq}
+}
@@ -0,0 +1,63 @@
+package kivik
+
+import (
+	"context"
+	"testing"
+
+	"github.com/flimzy/diff"
+	"github.com/flimzy/kivik/driver"
+)
+
+type globalChangesClient struct {
+	driver.Client
+	dbName string
+}
+
+func (c *globalChangesClient) DB(_ context.Context, dbName string, _ map[string]interface{}) (driver.DB, error) {
+	c.dbName = dbName
+	return &globalChangesDB{}, nil
+}
+
+type globalChangesDB struct {
+	dummyDB
+}
+
+func (db *globalChangesDB) Changes(_ context.Context, _ map[string]interface{}) (driver.Changes, error) {
+	return &sliceChanges{input: []string{
+		`{"seq":"1-x","id":"created:foo","changes":[{"rev":"1-a"}]}`,
+		`{"seq":"2-x","id":"_design/foo","changes":[{"rev":"1-b"}]}`,
+		`{"seq":"3-x","id":"updated:foo/bar","changes":[{"rev":"2-c"}]}`,
+	}}, nil
+}
+
+func TestGlobalChanges(t *testing.T) {
+	driverClient := &globalChangesClient{}
+	c := &Client{driverClient: driverClient}
+	changes, err := c.GlobalChanges(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if driverClient.dbName != GlobalChangesDB {
+		t.Errorf("Unexpected database: %s", driverClient.dbName)
+	}
+	var events []*GlobalChange
+	var names []string
+	for changes.Next() {
+		events = append(events, changes.GlobalChange())
+		names = append(names, changes.Type()+" "+changes.DBName())
+	}
+	if err = changes.Err(); err != nil {
+		t.Fatal(err)
+	}
+	expected := []*GlobalChange{
+		{DBName: "foo", Type: GlobalChangeCreated, Seq: "1-x"},
+		nil,
+		{DBName: "foo/bar", Type: GlobalChangeUpdated, Seq: "3-x"},
+	}
+	if d := diff.Interface(expected, events); d != "" {
+		t.Error(d)
+	}
+	if d := diff.Interface([]string{"created foo", " ", "updated foo/bar"}, names); d != "" {
+		t.Error(d)
+	}
+}
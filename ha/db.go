@@ -0,0 +1,431 @@
+package ha
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"sync"
+
+	"github.com/flimzy/kivik/driver"
+)
+
+type db struct {
+	client *client
+	name   string
+	opts   map[string]interface{}
+
+	mu  sync.Mutex
+	dbs map[*endpoint]driver.DB
+}
+
+var _ driver.DB = &db{}
+var _ driver.Finder = &db{}
+var _ driver.Explainer = &db{}
+var _ driver.AttachmentMetaer = &db{}
+var _ driver.AttachmentCombiner = &db{}
+var _ driver.Rever = &db{}
+var _ driver.DBFlusher = &db{}
+var _ driver.Copier = &db{}
+var _ driver.OptsBulkDocer = &db{}
+var _ driver.OptsPutter = &db{}
+var _ driver.OptsDeleter = &db{}
+var _ driver.Quorumer = &db{}
+var _ driver.OpenRevsGetter = &db{}
+var _ driver.OptsDocCreator = &db{}
+var _ driver.BodyGetter = &db{}
+var _ driver.DesignInfoer = &db{}
+var _ driver.MultipartPutter = &db{}
+var _ driver.OptionValidator = &db{}
+
+// endpointDB returns the database handle for e, connecting if necessary.
+func (d *db) endpointDB(ctx context.Context, e *endpoint) (driver.DB, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if edb, ok := d.dbs[e]; ok {
+		return edb, nil
+	}
+	edb, err := e.client.DB(ctx, d.name, d.opts)
+	if err != nil {
+		return nil, err
+	}
+	d.dbs[e] = edb
+	return edb, nil
+}
+
+// do calls fn with the database handle of each candidate endpoint, as with
+// client.do.
+func (d *db) do(ctx context.Context, read bool, fn func(driver.DB) error) error {
+	return d.client.do(read, func(e *endpoint) error {
+		edb, err := d.endpointDB(ctx, e)
+		if err != nil {
+			return err
+		}
+		return fn(edb)
+	})
+}
+
+func (d *db) AllDocs(ctx context.Context, opts map[string]interface{}) (rows driver.Rows, err error) {
+	err = d.do(ctx, true, func(edb driver.DB) error {
+		rows, err = edb.AllDocs(ctx, opts)
+		return err
+	})
+	return rows, err
+}
+
+func (d *db) Query(ctx context.Context, ddoc, view string, opts map[string]interface{}) (rows driver.Rows, err error) {
+	err = d.do(ctx, true, func(edb driver.DB) error {
+		rows, err = edb.Query(ctx, ddoc, view, opts)
+		return err
+	})
+	return rows, err
+}
+
+func (d *db) Get(ctx context.Context, docID string, opts map[string]interface{}) (doc json.RawMessage, err error) {
+	err = d.do(ctx, true, func(edb driver.DB) error {
+		doc, err = edb.Get(ctx, docID, opts)
+		return err
+	})
+	return doc, err
+}
+
+func (d *db) CreateDoc(ctx context.Context, doc interface{}) (docID, rev string, err error) {
+	err = d.do(ctx, false, func(edb driver.DB) error {
+		docID, rev, err = edb.CreateDoc(ctx, doc)
+		return err
+	})
+	return docID, rev, err
+}
+
+func (d *db) CreateDocOpts(ctx context.Context, doc interface{}, opts map[string]interface{}) (docID, rev string, err error) {
+	err = d.do(ctx, false, func(edb driver.DB) error {
+		c, ok := edb.(driver.OptsDocCreator)
+		if !ok {
+			return notImplemented("OptsDocCreator")
+		}
+		docID, rev, err = c.CreateDocOpts(ctx, doc, opts)
+		return err
+	})
+	return docID, rev, err
+}
+
+func (d *db) Put(ctx context.Context, docID string, doc interface{}) (rev string, err error) {
+	err = d.do(ctx, false, func(edb driver.DB) error {
+		rev, err = edb.Put(ctx, docID, doc)
+		return err
+	})
+	return rev, err
+}
+
+func (d *db) PutOpts(ctx context.Context, docID string, doc interface{}, opts map[string]interface{}) (rev string, err error) {
+	err = d.do(ctx, false, func(edb driver.DB) error {
+		p, ok := edb.(driver.OptsPutter)
+		if !ok {
+			return notImplemented("OptsPutter")
+		}
+		rev, err = p.PutOpts(ctx, docID, doc, opts)
+		return err
+	})
+	return rev, err
+}
+
+func (d *db) Delete(ctx context.Context, docID, rev string) (newRev string, err error) {
+	err = d.do(ctx, false, func(edb driver.DB) error {
+		newRev, err = edb.Delete(ctx, docID, rev)
+		return err
+	})
+	return newRev, err
+}
+
+func (d *db) DeleteOpts(ctx context.Context, docID, rev string, opts map[string]interface{}) (newRev string, err error) {
+	err = d.do(ctx, false, func(edb driver.DB) error {
+		del, ok := edb.(driver.OptsDeleter)
+		if !ok {
+			return notImplemented("OptsDeleter")
+		}
+		newRev, err = del.DeleteOpts(ctx, docID, rev, opts)
+		return err
+	})
+	return newRev, err
+}
+
+// SupportsQuorum returns true if the database of every endpoint supports the
+// quorum options, since any endpoint may receive the request.
+func (d *db) SupportsQuorum() bool {
+	for _, e := range d.client.endpoints {
+		edb, err := d.endpointDB(context.Background(), e)
+		if err != nil {
+			return false
+		}
+		if q, ok := edb.(driver.Quorumer); !ok || !q.SupportsQuorum() {
+			return false
+		}
+	}
+	return true
+}
+
+func (d *db) Stats(ctx context.Context) (stats *driver.DBStats, err error) {
+	err = d.do(ctx, true, func(edb driver.DB) error {
+		stats, err = edb.Stats(ctx)
+		return err
+	})
+	return stats, err
+}
+
+func (d *db) Compact(ctx context.Context) error {
+	return d.do(ctx, false, func(edb driver.DB) error {
+		return edb.Compact(ctx)
+	})
+}
+
+func (d *db) CompactView(ctx context.Context, ddocID string) error {
+	return d.do(ctx, false, func(edb driver.DB) error {
+		return edb.CompactView(ctx, ddocID)
+	})
+}
+
+func (d *db) ViewCleanup(ctx context.Context) error {
+	return d.do(ctx, false, func(edb driver.DB) error {
+		return edb.ViewCleanup(ctx)
+	})
+}
+
+func (d *db) Security(ctx context.Context) (sec *driver.Security, err error) {
+	err = d.do(ctx, true, func(edb driver.DB) error {
+		sec, err = edb.Security(ctx)
+		return err
+	})
+	return sec, err
+}
+
+func (d *db) SetSecurity(ctx context.Context, security *driver.Security) error {
+	return d.do(ctx, false, func(edb driver.DB) error {
+		return edb.SetSecurity(ctx, security)
+	})
+}
+
+func (d *db) Changes(ctx context.Context, opts map[string]interface{}) (changes driver.Changes, err error) {
+	err = d.do(ctx, true, func(edb driver.DB) error {
+		changes, err = edb.Changes(ctx, opts)
+		return err
+	})
+	return changes, err
+}
+
+func (d *db) BulkDocs(ctx context.Context, docs []interface{}) (results driver.BulkResults, err error) {
+	err = d.do(ctx, false, func(edb driver.DB) error {
+		results, err = edb.BulkDocs(ctx, docs)
+		return err
+	})
+	return results, err
+}
+
+func (d *db) BulkDocsOpts(ctx context.Context, docs []interface{}, opts map[string]interface{}) (results driver.BulkResults, err error) {
+	err = d.do(ctx, false, func(edb driver.DB) error {
+		b, ok := edb.(driver.OptsBulkDocer)
+		if !ok {
+			return notImplemented("OptsBulkDocer")
+		}
+		results, err = b.BulkDocsOpts(ctx, docs, opts)
+		return err
+	})
+	return results, err
+}
+
+func (d *db) PutAttachment(ctx context.Context, docID, rev, filename, contentType string, body io.Reader) (newRev string, err error) {
+	err = d.do(ctx, false, func(edb driver.DB) error {
+		newRev, err = edb.PutAttachment(ctx, docID, rev, filename, contentType, body)
+		return err
+	})
+	return newRev, err
+}
+
+func (d *db) GetAttachment(ctx context.Context, docID, rev, filename string) (contentType string, md5sum driver.MD5sum, body io.ReadCloser, err error) {
+	err = d.do(ctx, true, func(edb driver.DB) error {
+		contentType, md5sum, body, err = edb.GetAttachment(ctx, docID, rev, filename)
+		return err
+	})
+	return contentType, md5sum, body, err
+}
+
+func (d *db) DeleteAttachment(ctx context.Context, docID, rev, filename string) (newRev string, err error) {
+	err = d.do(ctx, false, func(edb driver.DB) error {
+		newRev, err = edb.DeleteAttachment(ctx, docID, rev, filename)
+		return err
+	})
+	return newRev, err
+}
+
+func (d *db) Find(ctx context.Context, query interface{}) (rows driver.Rows, err error) {
+	err = d.do(ctx, true, func(edb driver.DB) error {
+		f, ok := edb.(driver.Finder)
+		if !ok {
+			return notImplemented("Finder")
+		}
+		rows, err = f.Find(ctx, query)
+		return err
+	})
+	return rows, err
+}
+
+func (d *db) CreateIndex(ctx context.Context, ddoc, name string, index interface{}) error {
+	return d.do(ctx, false, func(edb driver.DB) error {
+		f, ok := edb.(driver.Finder)
+		if !ok {
+			return notImplemented("Finder")
+		}
+		return f.CreateIndex(ctx, ddoc, name, index)
+	})
+}
+
+func (d *db) GetIndexes(ctx context.Context) (indexes []driver.Index, err error) {
+	err = d.do(ctx, true, func(edb driver.DB) error {
+		f, ok := edb.(driver.Finder)
+		if !ok {
+			return notImplemented("Finder")
+		}
+		indexes, err = f.GetIndexes(ctx)
+		return err
+	})
+	return indexes, err
+}
+
+func (d *db) DeleteIndex(ctx context.Context, ddoc, name string) error {
+	return d.do(ctx, false, func(edb driver.DB) error {
+		f, ok := edb.(driver.Finder)
+		if !ok {
+			return notImplemented("Finder")
+		}
+		return f.DeleteIndex(ctx, ddoc, name)
+	})
+}
+
+func (d *db) GetAttachmentMeta(ctx context.Context, docID, rev, filename string) (contentType string, md5sum driver.MD5sum, err error) {
+	err = d.do(ctx, true, func(edb driver.DB) error {
+		m, ok := edb.(driver.AttachmentMetaer)
+		if !ok {
+			return notImplemented("AttachmentMetaer")
+		}
+		contentType, md5sum, err = m.GetAttachmentMeta(ctx, docID, rev, filename)
+		return err
+	})
+	return contentType, md5sum, err
+}
+
+func (d *db) Rev(ctx context.Context, docID string) (rev string, err error) {
+	err = d.do(ctx, true, func(edb driver.DB) error {
+		r, ok := edb.(driver.Rever)
+		if !ok {
+			return notImplemented("Rever")
+		}
+		rev, err = r.Rev(ctx, docID)
+		return err
+	})
+	return rev, err
+}
+
+func (d *db) GetOpenRevs(ctx context.Context, docID string, revs []string, opts map[string]interface{}) (openRevs []driver.OpenRev, err error) {
+	err = d.do(ctx, true, func(edb driver.DB) error {
+		g, ok := edb.(driver.OpenRevsGetter)
+		if !ok {
+			return notImplemented("OpenRevsGetter")
+		}
+		openRevs, err = g.GetOpenRevs(ctx, docID, revs, opts)
+		return err
+	})
+	return openRevs, err
+}
+
+func (d *db) GetBody(ctx context.Context, docID string, opts map[string]interface{}) (body io.ReadCloser, err error) {
+	err = d.do(ctx, true, func(edb driver.DB) error {
+		g, ok := edb.(driver.BodyGetter)
+		if !ok {
+			return notImplemented("BodyGetter")
+		}
+		body, err = g.GetBody(ctx, docID, opts)
+		return err
+	})
+	return body, err
+}
+
+// SupportedOptions returns the options declared by the first endpoint, as
+// all endpoints use the same driver.
+func (d *db) SupportedOptions(method string) (map[string]driver.OptionType, bool) {
+	edb, err := d.endpointDB(context.Background(), d.client.endpoints[0])
+	if err != nil {
+		return nil, false
+	}
+	if v, ok := edb.(driver.OptionValidator); ok {
+		return v.SupportedOptions(method)
+	}
+	return nil, false
+}
+
+func (d *db) Flush(ctx context.Context) error {
+	return d.do(ctx, false, func(edb driver.DB) error {
+		f, ok := edb.(driver.DBFlusher)
+		if !ok {
+			return notImplemented("DBFlusher")
+		}
+		return f.Flush(ctx)
+	})
+}
+
+func (d *db) Copy(ctx context.Context, targetID, sourceID string, opts map[string]interface{}) (targetRev string, err error) {
+	err = d.do(ctx, false, func(edb driver.DB) error {
+		c, ok := edb.(driver.Copier)
+		if !ok {
+			return notImplemented("Copier")
+		}
+		targetRev, err = c.Copy(ctx, targetID, sourceID, opts)
+		return err
+	})
+	return targetRev, err
+}
+
+func (d *db) PutMultipart(ctx context.Context, docID string, doc interface{}, atts []driver.MultipartAttachment, opts map[string]interface{}) (rev string, err error) {
+	err = d.do(ctx, false, func(edb driver.DB) error {
+		p, ok := edb.(driver.MultipartPutter)
+		if !ok {
+			return notImplemented("MultipartPutter")
+		}
+		rev, err = p.PutMultipart(ctx, docID, doc, atts, opts)
+		return err
+	})
+	return rev, err
+}
+
+func (d *db) Explain(ctx context.Context, query interface{}) (plan *driver.QueryPlan, err error) {
+	err = d.do(ctx, true, func(edb driver.DB) error {
+		e, ok := edb.(driver.Explainer)
+		if !ok {
+			return notImplemented("Explainer")
+		}
+		plan, err = e.Explain(ctx, query)
+		return err
+	})
+	return plan, err
+}
+
+func (d *db) DesignInfo(ctx context.Context, ddoc string) (info *driver.DesignInfo, err error) {
+	err = d.do(ctx, true, func(edb driver.DB) error {
+		i, ok := edb.(driver.DesignInfoer)
+		if !ok {
+			return notImplemented("DesignInfoer")
+		}
+		info, err = i.DesignInfo(ctx, ddoc)
+		return err
+	})
+	return info, err
+}
+
+func (d *db) CombineAttachments(ctx context.Context, docID, rev, filename, contentType string, parts []string) (newRev string, err error) {
+	err = d.do(ctx, false, func(edb driver.DB) error {
+		c, ok := edb.(driver.AttachmentCombiner)
+		if !ok {
+			return notImplemented("AttachmentCombiner")
+		}
+		newRev, err = c.CombineAttachments(ctx, docID, rev, filename, contentType, parts)
+		return err
+	})
+	return newRev, err
+}
@@ -0,0 +1,498 @@
+// Package ha provides a Kivik driver which wraps another driver, to connect to
+// several equivalent endpoints, such as the nodes of a CouchDB cluster which
+// is not behind a load balancer, and to fail over between them.
+//
+// The DSN is a comma-separated list of the DSNs of the endpoints, each of
+// which is passed to the wrapped driver. Any commas within an endpoint's DSN
+// must be percent-encoded.
+//
+//	ha.Register("couch-ha", "couch", ha.Options{HealthCheckInterval: 10 * time.Second})
+//	client, err := kivik.New(context.TODO(), "couch-ha", "http://node1:5984/,http://node2:5984/")
+//
+// Requests are sent to the first healthy endpoint, in the order listed. When a
+// request fails because an endpoint cannot be reached, the endpoint is marked
+// unhealthy, and the request is retried with the next endpoint. Only reads are
+// retried after a connection has been established, as the server may already
+// have processed a write. Unhealthy endpoints are tried only once all healthy
+// endpoints have failed, and are marked healthy again when a request or health
+// check succeeds.
+//
+// Iterators, such as the results of a query or the changes feed, are read from
+// the endpoint which served the initial request, and do not fail over.
+package ha
+
+import (
+	"context"
+	"net"
+	"net/url"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/flimzy/kivik"
+	"github.com/flimzy/kivik/driver"
+	"github.com/flimzy/kivik/errors"
+)
+
+// Options configures a failover driver.
+type Options struct {
+	// SplitReads distributes reads among all healthy endpoints, in turn.
+	// Writes are always sent to the first healthy endpoint.
+	SplitReads bool
+	// HealthCheckInterval, if non-zero, enables periodic health checks of all
+	// endpoints, by requesting the server version. Health checks run until the
+	// context passed to kivik.New is canceled.
+	HealthCheckInterval time.Duration
+}
+
+type haDriver struct {
+	drv  driver.Driver
+	opts Options
+}
+
+var _ driver.Driver = &haDriver{}
+
+// New returns a driver which wraps drv, to connect to multiple endpoints.
+func New(drv driver.Driver, opts Options) driver.Driver {
+	return &haDriver{drv: drv, opts: opts}
+}
+
+// Register registers a failover version of the driver registered as wrapped,
+// under the new name name.
+func Register(name, wrapped string, opts Options) error {
+	drv, ok := kivik.LookupDriver(wrapped)
+	if !ok {
+		return errors.Statusf(kivik.StatusBadRequest, "ha: unknown driver %q (forgotten import?)", wrapped)
+	}
+	kivik.Register(name, New(drv, opts))
+	return nil
+}
+
+func (d *haDriver) NewClient(ctx context.Context, dsn string) (driver.Client, error) {
+	c := &client{opts: d.opts}
+	for _, endpointDSN := range strings.Split(dsn, ",") {
+		endpointDSN = strings.TrimSpace(endpointDSN)
+		if endpointDSN == "" {
+			continue
+		}
+		ec, err := d.drv.NewClient(ctx, endpointDSN)
+		if err != nil {
+			return nil, err
+		}
+		c.endpoints = append(c.endpoints, &endpoint{dsn: endpointDSN, client: ec, healthy: 1})
+	}
+	if len(c.endpoints) == 0 {
+		return nil, errors.Status(kivik.StatusBadRequest, "ha: no endpoints in DSN")
+	}
+	if d.opts.HealthCheckInterval > 0 {
+		go c.healthCheck(ctx, d.opts.HealthCheckInterval)
+	}
+	return c, nil
+}
+
+type endpoint struct {
+	dsn     string
+	client  driver.Client
+	healthy int32
+}
+
+func (e *endpoint) isHealthy() bool {
+	return atomic.LoadInt32(&e.healthy) == 1
+}
+
+func (e *endpoint) setHealthy(healthy bool) {
+	var value int32
+	if healthy {
+		value = 1
+	}
+	atomic.StoreInt32(&e.healthy, value)
+}
+
+type client struct {
+	endpoints []*endpoint
+	opts      Options
+	// next is the index of the endpoint to receive the next read, when
+	// SplitReads is enabled.
+	next uint32
+}
+
+var _ driver.Client = &client{}
+var _ driver.ClientReplicator = &client{}
+var _ driver.Authenticator = &client{}
+var _ driver.DBUpdater = &client{}
+var _ driver.PoolStatser = &client{}
+var _ driver.AdminPartyChecker = &client{}
+var _ driver.DiskUsager = &client{}
+var _ driver.Configer = &client{}
+var _ driver.Clusterer = &client{}
+var _ driver.OptionValidator = &client{}
+
+// healthCheck checks the health of each endpoint every interval, until ctx is
+// canceled.
+func (c *client) healthCheck(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		for _, e := range c.endpoints {
+			checkCtx, cancel := context.WithTimeout(ctx, interval)
+			_, err := e.client.Version(checkCtx)
+			cancel()
+			if ctx.Err() != nil {
+				return
+			}
+			e.setHealthy(err == nil)
+		}
+	}
+}
+
+// candidates returns the endpoints in the order they should be tried: healthy
+// endpoints first, then unhealthy ones.
+func (c *client) candidates(read bool) []*endpoint {
+	n := len(c.endpoints)
+	var start int
+	if read && c.opts.SplitReads {
+		start = int(atomic.AddUint32(&c.next, 1)-1) % n
+	}
+	healthy := make([]*endpoint, 0, n)
+	var unhealthy []*endpoint
+	for i := 0; i < n; i++ {
+		e := c.endpoints[(start+i)%n]
+		if e.isHealthy() {
+			healthy = append(healthy, e)
+		} else {
+			unhealthy = append(unhealthy, e)
+		}
+	}
+	return append(healthy, unhealthy...)
+}
+
+// do calls fn with each candidate endpoint in turn, until one succeeds, or
+// fails with an error for which failover is not appropriate.
+func (c *client) do(read bool, fn func(*endpoint) error) error {
+	var err error
+	for _, e := range c.candidates(read) {
+		err = fn(e)
+		if !failover(err, read) {
+			if err == nil {
+				e.setHealthy(true)
+			}
+			return err
+		}
+		e.setHealthy(false)
+	}
+	return err
+}
+
+// failover returns true if err indicates that the endpoint could not be
+// reached, such that the request should be retried with another endpoint.
+// Unless read is true, only errors which occurred while connecting qualify.
+func failover(err error, read bool) bool {
+	for err != nil {
+		switch t := err.(type) {
+		case *url.Error:
+			if t.Err == context.Canceled || t.Err == context.DeadlineExceeded {
+				return false
+			}
+		case *net.OpError:
+			return read || t.Op == "dial"
+		case net.Error:
+			return read
+		}
+		err = cause(err)
+	}
+	return false
+}
+
+// cause returns the error wrapped by err, or nil.
+func cause(err error) error {
+	switch t := err.(type) {
+	case *url.Error:
+		return t.Err
+	case interface {
+		Unwrap() error
+	}:
+		return t.Unwrap()
+	case interface {
+		Cause() error
+	}:
+		return t.Cause()
+	}
+	return nil
+}
+
+func notImplemented(iface string) error {
+	return errors.Statusf(kivik.StatusNotImplemented, "kivik: driver does not implement %s", iface)
+}
+
+func (c *client) Version(ctx context.Context) (version *driver.Version, err error) {
+	err = c.do(true, func(e *endpoint) error {
+		version, err = e.client.Version(ctx)
+		return err
+	})
+	return version, err
+}
+
+func (c *client) AllDBs(ctx context.Context, opts map[string]interface{}) (dbs []string, err error) {
+	err = c.do(true, func(e *endpoint) error {
+		dbs, err = e.client.AllDBs(ctx, opts)
+		return err
+	})
+	return dbs, err
+}
+
+func (c *client) DBExists(ctx context.Context, dbName string, opts map[string]interface{}) (exists bool, err error) {
+	err = c.do(true, func(e *endpoint) error {
+		exists, err = e.client.DBExists(ctx, dbName, opts)
+		return err
+	})
+	return exists, err
+}
+
+func (c *client) CreateDB(ctx context.Context, dbName string, opts map[string]interface{}) error {
+	return c.do(false, func(e *endpoint) error {
+		return e.client.CreateDB(ctx, dbName, opts)
+	})
+}
+
+func (c *client) DestroyDB(ctx context.Context, dbName string, opts map[string]interface{}) error {
+	return c.do(false, func(e *endpoint) error {
+		return e.client.DestroyDB(ctx, dbName, opts)
+	})
+}
+
+func (c *client) DB(_ context.Context, dbName string, opts map[string]interface{}) (driver.DB, error) {
+	return &db{
+		client: c,
+		name:   dbName,
+		opts:   opts,
+		dbs:    make(map[*endpoint]driver.DB),
+	}, nil
+}
+
+func (c *client) Replicate(ctx context.Context, targetDSN, sourceDSN string, opts map[string]interface{}) (rep driver.Replication, err error) {
+	err = c.do(false, func(e *endpoint) error {
+		r, ok := e.client.(driver.ClientReplicator)
+		if !ok {
+			return notImplemented("ClientReplicator")
+		}
+		rep, err = r.Replicate(ctx, targetDSN, sourceDSN, opts)
+		return err
+	})
+	return rep, err
+}
+
+func (c *client) GetReplications(ctx context.Context, opts map[string]interface{}) (reps []driver.Replication, err error) {
+	err = c.do(true, func(e *endpoint) error {
+		r, ok := e.client.(driver.ClientReplicator)
+		if !ok {
+			return notImplemented("ClientReplicator")
+		}
+		reps, err = r.GetReplications(ctx, opts)
+		return err
+	})
+	return reps, err
+}
+
+// Authenticate authenticates with every endpoint, as subsequent requests may
+// be sent to any of them. The first error encountered is returned.
+func (c *client) Authenticate(ctx context.Context, authenticator interface{}) error {
+	for _, e := range c.endpoints {
+		a, ok := e.client.(driver.Authenticator)
+		if !ok {
+			return notImplemented("Authenticator")
+		}
+		if err := a.Authenticate(ctx, authenticator); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (c *client) DBUpdates() (updates driver.DBUpdates, err error) {
+	err = c.do(true, func(e *endpoint) error {
+		u, ok := e.client.(driver.DBUpdater)
+		if !ok {
+			return notImplemented("DBUpdater")
+		}
+		updates, err = u.DBUpdates()
+		return err
+	})
+	return updates, err
+}
+
+// PoolStats returns the sum of the connection pool statistics of the
+// endpoints which report them.
+func (c *client) PoolStats() (driver.PoolStats, error) {
+	var total driver.PoolStats
+	var found bool
+	for _, e := range c.endpoints {
+		s, ok := e.client.(driver.PoolStatser)
+		if !ok {
+			continue
+		}
+		stats, err := s.PoolStats()
+		if err != nil {
+			return driver.PoolStats{}, err
+		}
+		found = true
+		total.OpenConnections += stats.OpenConnections
+		total.IdleConnections += stats.IdleConnections
+		total.InFlight += stats.InFlight
+	}
+	if !found {
+		return driver.PoolStats{}, notImplemented("PoolStatser")
+	}
+	return total, nil
+}
+
+// AdminParty returns true if any endpoint grants admin rights to
+// unauthenticated requests.
+func (c *client) AdminParty(ctx context.Context) (bool, error) {
+	for _, e := range c.endpoints {
+		a, ok := e.client.(driver.AdminPartyChecker)
+		if !ok {
+			return false, notImplemented("AdminPartyChecker")
+		}
+		party, err := a.AdminParty(ctx)
+		if err != nil || party {
+			return party, err
+		}
+	}
+	return false, nil
+}
+
+// DiskUsage returns the disk usage of the first available endpoint.
+func (c *client) DiskUsage(ctx context.Context) (usage *driver.DiskUsage, err error) {
+	err = c.do(true, func(e *endpoint) error {
+		u, ok := e.client.(driver.DiskUsager)
+		if !ok {
+			return notImplemented("DiskUsager")
+		}
+		usage, err = u.DiskUsage(ctx)
+		return err
+	})
+	return usage, err
+}
+
+func configer(e *endpoint) (driver.Configer, error) {
+	if configer, ok := e.client.(driver.Configer); ok {
+		return configer, nil
+	}
+	return nil, notImplemented("Configer")
+}
+
+// Config reads the configuration from the first available endpoint. As the
+// configuration is per server, or per node, an empty node or kivik.LocalNode
+// refers to whichever endpoint serves the request.
+func (c *client) Config(ctx context.Context, node string) (config driver.Config, err error) {
+	err = c.do(true, func(e *endpoint) error {
+		configer, err := configer(e)
+		if err != nil {
+			return err
+		}
+		config, err = configer.Config(ctx, node)
+		return err
+	})
+	return config, err
+}
+
+func (c *client) ConfigSection(ctx context.Context, node, section string) (sec driver.ConfigSection, err error) {
+	err = c.do(true, func(e *endpoint) error {
+		configer, err := configer(e)
+		if err != nil {
+			return err
+		}
+		sec, err = configer.ConfigSection(ctx, node, section)
+		return err
+	})
+	return sec, err
+}
+
+func (c *client) ConfigValue(ctx context.Context, node, section, key string) (value string, err error) {
+	err = c.do(true, func(e *endpoint) error {
+		configer, err := configer(e)
+		if err != nil {
+			return err
+		}
+		value, err = configer.ConfigValue(ctx, node, section, key)
+		return err
+	})
+	return value, err
+}
+
+func (c *client) SetConfigValue(ctx context.Context, node, section, key, value string) (old string, err error) {
+	err = c.do(false, func(e *endpoint) error {
+		configer, err := configer(e)
+		if err != nil {
+			return err
+		}
+		old, err = configer.SetConfigValue(ctx, node, section, key, value)
+		return err
+	})
+	return old, err
+}
+
+func (c *client) DeleteConfigKey(ctx context.Context, node, section, key string) (old string, err error) {
+	err = c.do(false, func(e *endpoint) error {
+		configer, err := configer(e)
+		if err != nil {
+			return err
+		}
+		old, err = configer.DeleteConfigKey(ctx, node, section, key)
+		return err
+	})
+	return old, err
+}
+
+func clusterer(e *endpoint) (driver.Clusterer, error) {
+	if clusterer, ok := e.client.(driver.Clusterer); ok {
+		return clusterer, nil
+	}
+	return nil, notImplemented("Clusterer")
+}
+
+func (c *client) Membership(ctx context.Context) (membership *driver.Membership, err error) {
+	err = c.do(true, func(e *endpoint) error {
+		clusterer, err := clusterer(e)
+		if err != nil {
+			return err
+		}
+		membership, err = clusterer.Membership(ctx)
+		return err
+	})
+	return membership, err
+}
+
+func (c *client) AddNode(ctx context.Context, node string) error {
+	return c.do(false, func(e *endpoint) error {
+		clusterer, err := clusterer(e)
+		if err != nil {
+			return err
+		}
+		return clusterer.AddNode(ctx, node)
+	})
+}
+
+func (c *client) RemoveNode(ctx context.Context, node string) error {
+	return c.do(false, func(e *endpoint) error {
+		clusterer, err := clusterer(e)
+		if err != nil {
+			return err
+		}
+		return clusterer.RemoveNode(ctx, node)
+	})
+}
+
+// SupportedOptions returns the options declared by the first endpoint, as
+// all endpoints use the same driver.
+func (c *client) SupportedOptions(method string) (map[string]driver.OptionType, bool) {
+	if v, ok := c.endpoints[0].client.(driver.OptionValidator); ok {
+		return v.SupportedOptions(method)
+	}
+	return nil, false
+}
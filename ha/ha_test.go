@@ -0,0 +1,281 @@
+package ha
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net"
+	"net/url"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/flimzy/diff"
+	"github.com/flimzy/kivik"
+	"github.com/flimzy/kivik/driver"
+)
+
+// fakeNet simulates a set of endpoints, each identified by its DSN.
+type fakeNet struct {
+	mu sync.Mutex
+	// errs holds the error returned by each endpoint, if any.
+	errs   map[string]error
+	served []string
+}
+
+func (n *fakeNet) serve(dsn string) error {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	if err := n.errs[dsn]; err != nil {
+		return err
+	}
+	n.served = append(n.served, dsn)
+	return nil
+}
+
+func (n *fakeNet) setErr(dsn string, err error) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	n.errs[dsn] = err
+}
+
+// log returns, and resets, the list of endpoints which served requests.
+func (n *fakeNet) log() []string {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	served := n.served
+	n.served = nil
+	return served
+}
+
+func (n *fakeNet) NewClient(_ context.Context, dsn string) (driver.Client, error) {
+	return &fakeClient{net: n, dsn: dsn}, nil
+}
+
+type fakeClient struct {
+	driver.Client
+	net *fakeNet
+	dsn string
+}
+
+func (c *fakeClient) Version(_ context.Context) (*driver.Version, error) {
+	if err := c.net.serve(c.dsn); err != nil {
+		return nil, err
+	}
+	return &driver.Version{Version: c.dsn}, nil
+}
+
+func (c *fakeClient) CreateDB(_ context.Context, _ string, _ map[string]interface{}) error {
+	return c.net.serve(c.dsn)
+}
+
+func (c *fakeClient) DB(_ context.Context, _ string, _ map[string]interface{}) (driver.DB, error) {
+	return &fakeDB{client: c}, nil
+}
+
+type fakeDB struct {
+	driver.DB
+	client *fakeClient
+}
+
+func (d *fakeDB) Get(_ context.Context, docID string, _ map[string]interface{}) (json.RawMessage, error) {
+	if err := d.client.net.serve(d.client.dsn); err != nil {
+		return nil, err
+	}
+	return json.RawMessage(`{"_id":"` + docID + `"}`), nil
+}
+
+func (d *fakeDB) Put(_ context.Context, _ string, _ interface{}) (string, error) {
+	return "1-xxx", d.client.net.serve(d.client.dsn)
+}
+
+func (d *fakeDB) DesignInfo(_ context.Context, ddoc string) (*driver.DesignInfo, error) {
+	if err := d.client.net.serve(d.client.dsn); err != nil {
+		return nil, err
+	}
+	return &driver.DesignInfo{Name: ddoc}, nil
+}
+
+func dialErr(dsn string) error {
+	return &url.Error{Op: "Get", URL: dsn, Err: &net.OpError{Op: "dial", Net: "tcp", Err: errors.New("connection refused")}}
+}
+
+func readErr(dsn string) error {
+	return &url.Error{Op: "Get", URL: dsn, Err: &net.OpError{Op: "read", Net: "tcp", Err: errors.New("connection reset by peer")}}
+}
+
+func newTestClient(t *testing.T, opts Options, dsn string) (*client, *fakeNet) {
+	n := &fakeNet{errs: make(map[string]error)}
+	c, err := New(n, opts).NewClient(context.Background(), dsn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return c.(*client), n
+}
+
+func TestNewClient(t *testing.T) {
+	_, err := New(&fakeNet{}, Options{}).NewClient(context.Background(), " , ")
+	if kivik.StatusCode(err) != kivik.StatusBadRequest {
+		t.Errorf("Unexpected error: %v", err)
+	}
+	c, _ := newTestClient(t, Options{}, "a, b,c")
+	var dsns []string
+	for _, e := range c.endpoints {
+		dsns = append(dsns, e.dsn)
+	}
+	if d := diff.Interface([]string{"a", "b", "c"}, dsns); d != "" {
+		t.Error(d)
+	}
+}
+
+func TestRegister(t *testing.T) {
+	if err := Register("foo", "no such driver", Options{}); kivik.StatusCode(err) != kivik.StatusBadRequest {
+		t.Errorf("Unexpected error: %v", err)
+	}
+}
+
+func TestFailover(t *testing.T) {
+	ctx := context.Background()
+	type step struct {
+		name   string
+		errs   map[string]error
+		do     func(*client) error
+		err    string
+		served []string
+	}
+	version := func(c *client) error {
+		_, err := c.Version(ctx)
+		return err
+	}
+	createDB := func(c *client) error {
+		return c.CreateDB(ctx, "foo", nil)
+	}
+	get := func(c *client) error {
+		db, _ := c.DB(ctx, "foo", nil)
+		_, err := db.Get(ctx, "bar", nil)
+		return err
+	}
+	put := func(c *client) error {
+		db, _ := c.DB(ctx, "foo", nil)
+		_, err := db.Put(ctx, "bar", nil)
+		return err
+	}
+	designInfo := func(c *client) error {
+		db, _ := c.DB(ctx, "foo", nil)
+		_, err := db.(driver.DesignInfoer).DesignInfo(ctx, "bar")
+		return err
+	}
+	tests := []struct {
+		name  string
+		opts  Options
+		steps []step
+	}{
+		{
+			name: "AllHealthy",
+			steps: []step{
+				{name: "Read", do: version, served: []string{"a"}},
+				{name: "Write", do: createDB, served: []string{"a"}},
+				{name: "DBRead", do: get, served: []string{"a"}},
+			},
+		},
+		{
+			name: "Failover",
+			steps: []step{
+				{name: "FirstDown", errs: map[string]error{"a": dialErr("a")}, do: version, served: []string{"b"}},
+				{name: "StillDown", do: createDB, served: []string{"b"}},
+				{name: "Recovered", errs: map[string]error{"a": nil}, do: version, served: []string{"b"}},
+				{name: "SecondDown", errs: map[string]error{"b": dialErr("b")}, do: get, served: []string{"c"}},
+				{name: "LastResort", errs: map[string]error{"c": dialErr("c")}, do: put, served: []string{"a"}},
+			},
+		},
+		{
+			name: "AllDown",
+			steps: []step{
+				{
+					name:   "Read",
+					errs:   map[string]error{"a": dialErr("a"), "b": dialErr("b"), "c": dialErr("c")},
+					do:     version,
+					err:    dialErr("c").Error(),
+					served: nil,
+				},
+				{name: "OneRecovered", errs: map[string]error{"b": nil}, do: version, served: []string{"b"}},
+			},
+		},
+		{
+			name: "ReadErrors",
+			steps: []step{
+				{name: "Read", errs: map[string]error{"a": readErr("a")}, do: get, served: []string{"b"}},
+				{name: "Write", errs: map[string]error{"b": readErr("b")}, do: put, err: readErr("b").Error()},
+			},
+		},
+		{
+			name: "DesignInfo",
+			steps: []step{
+				{name: "Read", do: designInfo, served: []string{"a"}},
+				{name: "ReadError", errs: map[string]error{"a": readErr("a")}, do: designInfo, served: []string{"b"}},
+			},
+		},
+		{
+			name: "ServerError",
+			steps: []step{
+				{name: "NoFailover", errs: map[string]error{"a": errors.New("not found")}, do: get, err: "not found"},
+			},
+		},
+		{
+			name: "SplitReads",
+			opts: Options{SplitReads: true},
+			steps: []step{
+				{name: "Read1", do: version, served: []string{"a"}},
+				{name: "Read2", do: version, served: []string{"b"}},
+				{name: "Write", do: createDB, served: []string{"a"}},
+				{name: "Read3", do: get, served: []string{"c"}},
+				{name: "Read4", do: get, served: []string{"a"}},
+				{name: "Unhealthy", errs: map[string]error{"b": dialErr("b")}, do: version, served: []string{"c"}},
+				{name: "SkipUnhealthy", do: get, served: []string{"c"}},
+			},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			c, n := newTestClient(t, test.opts, "a,b,c")
+			for _, s := range test.steps {
+				for dsn, err := range s.errs {
+					n.setErr(dsn, err)
+				}
+				var msg string
+				if err := s.do(c); err != nil {
+					msg = err.Error()
+				}
+				if msg != s.err {
+					t.Errorf("%s: Unexpected error: %s", s.name, msg)
+				}
+				if d := diff.Interface(s.served, n.log()); d != "" {
+					t.Errorf("%s: %s", s.name, d)
+				}
+			}
+		})
+	}
+}
+
+func TestHealthCheck(t *testing.T) {
+	n := &fakeNet{errs: map[string]error{"a": dialErr("a")}}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	c, err := New(n, Options{HealthCheckInterval: time.Millisecond}).NewClient(ctx, "a,b")
+	if err != nil {
+		t.Fatal(err)
+	}
+	a := c.(*client).endpoints[0]
+	waitFor := func(healthy bool) {
+		deadline := time.Now().Add(time.Second)
+		for a.isHealthy() != healthy {
+			if time.Now().After(deadline) {
+				t.Fatalf("Timed out waiting for healthy = %t", healthy)
+			}
+			time.Sleep(time.Millisecond)
+		}
+	}
+	waitFor(false)
+	n.setErr("a", nil)
+	waitFor(true)
+}
@@ -0,0 +1,119 @@
+package kivik
+
+import (
+	"context"
+
+	"github.com/flimzy/kivik/errors"
+)
+
+// Hooks are functions called around the write operations of a DB, on the
+// client side, regardless of the driver. They may be used to modify documents
+// before they are saved, such as to stamp an updatedAt field or a schema
+// version, to veto writes, or to observe their results. Any of the functions
+// may be nil.
+//
+// Update, Upsert and GetOrCreate save documents with Put, so are also subject
+// to the hooks. Copy, PutAttachment and DeleteAttachment are not.
+type Hooks struct {
+	// BeforePut is called by Put, PutMultipart and CreateDoc, and by BulkDocs
+	// for each document, before the document is passed to the driver. doc
+	// holds the fields of the document, which BeforePut may modify. docID is
+	// the ID of the document, or empty if it has none, as for CreateDoc with
+	// the ID assigned by the server. If BeforePut returns an error, the write
+	// is vetoed, and the error returned.
+	BeforePut func(ctx context.Context, docID string, doc map[string]interface{}) error
+	// AfterPut is called after Put, PutMultipart or CreateDoc, with the
+	// document ID and new rev, or the error of the write.
+	AfterPut func(ctx context.Context, docID, rev string, err error)
+	// BeforeDelete is called by Delete. If it returns an error, the delete is
+	// vetoed, and the error returned.
+	BeforeDelete func(ctx context.Context, docID, rev string) error
+	// AfterDelete is called after Delete, with the new rev of the deleted
+	// document, or the error of the delete.
+	AfterDelete func(ctx context.Context, docID, newRev string, err error)
+}
+
+// AddHooks adds hooks to the DB. Hooks are called in the order in which they
+// were added. AddHooks must not be called concurrently with write operations
+// of the DB.
+func (db *DB) AddHooks(hooks ...Hooks) {
+	db.hooks = append(db.hooks, hooks...)
+}
+
+// AddHooks adds hooks to databases subsequently opened with DB. See
+// DB.AddHooks.
+func (c *Client) AddHooks(hooks ...Hooks) {
+	c.hooks = append(c.hooks, hooks...)
+}
+
+// jsonFields returns the fields of the JSON encoding of doc.
+func jsonFields(doc interface{}) (map[string]interface{}, error) {
+	doc, err := normalizeFromJSON(doc)
+	if err != nil {
+		return nil, err
+	}
+	body, err := JSON().Marshal(doc)
+	if err != nil {
+		return nil, errors.WrapStatus(StatusBadRequest, err)
+	}
+	var fields map[string]interface{}
+	if err := JSON().Unmarshal(body, &fields); err != nil {
+		return nil, errors.WrapStatus(StatusBadRequest, err)
+	}
+	return fields, nil
+}
+
+// beforePut calls the BeforePut hooks for doc, and returns the document to
+// save. If there are no BeforePut hooks, doc is returned unaltered.
+func (db *DB) beforePut(ctx context.Context, docID string, doc interface{}) (interface{}, error) {
+	var fields map[string]interface{}
+	for _, h := range db.hooks {
+		if h.BeforePut == nil {
+			continue
+		}
+		if fields == nil {
+			var err error
+			if fields, err = jsonFields(doc); err != nil {
+				return nil, err
+			}
+			if docID == "" {
+				docID, _ = fields["_id"].(string)
+			}
+		}
+		if err := h.BeforePut(ctx, docID, fields); err != nil {
+			return nil, err
+		}
+	}
+	if fields == nil {
+		return doc, nil
+	}
+	return fields, nil
+}
+
+func (db *DB) afterPut(ctx context.Context, docID, rev string, err error) {
+	for _, h := range db.hooks {
+		if h.AfterPut != nil {
+			h.AfterPut(ctx, docID, rev, err)
+		}
+	}
+}
+
+func (db *DB) beforeDelete(ctx context.Context, docID, rev string) error {
+	for _, h := range db.hooks {
+		if h.BeforeDelete == nil {
+			continue
+		}
+		if err := h.BeforeDelete(ctx, docID, rev); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (db *DB) afterDelete(ctx context.Context, docID, newRev string, err error) {
+	for _, h := range db.hooks {
+		if h.AfterDelete != nil {
+			h.AfterDelete(ctx, docID, newRev, err)
+		}
+	}
+}
@@ -0,0 +1,175 @@
+package kivik
+
+import (
+	"context"
+	"testing"
+
+	"github.com/flimzy/diff"
+	"github.com/flimzy/kivik/driver"
+	"github.com/flimzy/kivik/errors"
+)
+
+// hookDB records the documents and deletes passed to the driver.
+type hookDB struct {
+	dummyDB
+	puts    []interface{}
+	deletes []string
+}
+
+func (db *hookDB) Put(_ context.Context, _ string, doc interface{}) (string, error) {
+	db.puts = append(db.puts, doc)
+	return "1-x", nil
+}
+
+func (db *hookDB) CreateDoc(_ context.Context, doc interface{}) (string, string, error) {
+	db.puts = append(db.puts, doc)
+	return "generated", "1-x", nil
+}
+
+func (db *hookDB) Delete(_ context.Context, docID, _ string) (string, error) {
+	db.deletes = append(db.deletes, docID)
+	return "2-x", nil
+}
+
+func TestHooks(t *testing.T) {
+	var log []string
+	stamp := Hooks{
+		BeforePut: func(_ context.Context, docID string, doc map[string]interface{}) error {
+			log = append(log, "before:"+docID)
+			doc["schema"] = 2
+			return nil
+		},
+		AfterPut: func(_ context.Context, docID, rev string, err error) {
+			log = append(log, "after:"+docID+":"+rev)
+		},
+	}
+	veto := Hooks{
+		BeforePut: func(_ context.Context, docID string, _ map[string]interface{}) error {
+			if docID == "readonly" {
+				return errors.Status(StatusForbidden, "read only")
+			}
+			return nil
+		},
+		BeforeDelete: func(_ context.Context, docID, _ string) error {
+			if docID == "readonly" {
+				return errors.Status(StatusForbidden, "read only")
+			}
+			return nil
+		},
+		AfterDelete: func(_ context.Context, docID, newRev string, _ error) {
+			log = append(log, "deleted:"+docID+":"+newRev)
+		},
+	}
+	driverDB := &hookDB{}
+	client := &Client{}
+	client.AddHooks(stamp)
+	db := &DB{driverDB: driverDB, hooks: append([]Hooks(nil), client.hooks...)}
+	db.AddHooks(veto)
+
+	ctx := context.Background()
+	if _, err := db.Put(ctx, "foo", map[string]string{"_id": "foo", "name": "bar"}); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := db.CreateDoc(ctx, struct {
+		Name string `json:"name"`
+	}{Name: "baz"}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := db.Put(ctx, "readonly", map[string]string{}); StatusCode(err) != StatusForbidden {
+		t.Errorf("Expected vetoed Put, got %v", err)
+	}
+	if _, err := db.Delete(ctx, "readonly", "1-x"); StatusCode(err) != StatusForbidden {
+		t.Errorf("Expected vetoed Delete, got %v", err)
+	}
+	if _, err := db.Delete(ctx, "foo", "1-x"); err != nil {
+		t.Fatal(err)
+	}
+
+	expectedPuts := []interface{}{
+		map[string]interface{}{"_id": "foo", "name": "bar", "schema": 2},
+		map[string]interface{}{"name": "baz", "schema": 2},
+	}
+	if d := diff.Interface(expectedPuts, driverDB.puts); d != "" {
+		t.Errorf("Unexpected puts:\n%s", d)
+	}
+	if d := diff.Interface([]string{"foo"}, driverDB.deletes); d != "" {
+		t.Errorf("Unexpected deletes:\n%s", d)
+	}
+	expectedLog := []string{
+		"before:foo", "after:foo:1-x",
+		"before:", "after:generated:1-x",
+		"before:readonly",
+		"deleted:foo:2-x",
+	}
+	if d := diff.Interface(expectedLog, log); d != "" {
+		t.Errorf("Unexpected hook calls:\n%s", d)
+	}
+}
+
+func TestHooksNoBeforePut(t *testing.T) {
+	driverDB := &hookDB{}
+	db := &DB{driverDB: driverDB}
+	db.AddHooks(Hooks{AfterPut: func(_ context.Context, _, _ string, _ error) {}})
+	doc := map[string]string{"foo": "bar"}
+	if _, err := db.Put(context.Background(), "foo", doc); err != nil {
+		t.Fatal(err)
+	}
+	// Without a BeforePut hook, the document is passed to the driver as is.
+	if d := diff.Interface([]interface{}{doc}, driverDB.puts); d != "" {
+		t.Error(d)
+	}
+}
+
+// multipartHookDB records the documents passed to PutMultipart.
+type multipartHookDB struct {
+	hookDB
+}
+
+func (db *multipartHookDB) PutMultipart(_ context.Context, _ string, doc interface{}, _ []driver.MultipartAttachment, _ map[string]interface{}) (string, error) {
+	db.puts = append(db.puts, doc)
+	return "1-x", nil
+}
+
+func TestPutMultipartHooks(t *testing.T) {
+	var log []string
+	driverDB := &multipartHookDB{}
+	db := &DB{driverDB: driverDB}
+	db.AddHooks(Hooks{
+		BeforePut: func(_ context.Context, docID string, doc map[string]interface{}) error {
+			if docID == "readonly" {
+				return errors.Status(StatusForbidden, "read only")
+			}
+			doc["schema"] = 2
+			return nil
+		},
+		AfterPut: func(_ context.Context, docID, rev string, _ error) {
+			log = append(log, "after:"+docID+":"+rev)
+		},
+	})
+	db.middleware = []Middleware{func(next Invoker) Invoker {
+		return func(ctx context.Context, op *Operation) (interface{}, error) {
+			log = append(log, op.Name+":"+op.DocID)
+			return next(ctx, op)
+		}
+	}}
+	ctx := context.Background()
+	type tagged struct {
+		ID   string `json:"-" kivik:"id"`
+		Name string `json:"name"`
+	}
+	if _, err := db.PutMultipart(ctx, "foo", tagged{ID: "foo", Name: "bar"}, nil); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := db.PutMultipart(ctx, "readonly", map[string]string{}, nil); StatusCode(err) != StatusForbidden {
+		t.Errorf("Expected vetoed PutMultipart, got %v", err)
+	}
+	expectedPuts := []interface{}{
+		map[string]interface{}{"_id": "foo", "name": "bar", "schema": 2},
+	}
+	if d := diff.Interface(expectedPuts, driverDB.puts); d != "" {
+		t.Errorf("Unexpected puts:\n%s", d)
+	}
+	if d := diff.Interface([]string{"PutMultipart:foo", "after:foo:1-x"}, log); d != "" {
+		t.Errorf("Unexpected calls:\n%s", d)
+	}
+}
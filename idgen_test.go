@@ -0,0 +1,101 @@
+package kivik
+
+import (
+	"context"
+	"regexp"
+	"testing"
+
+	"github.com/flimzy/diff"
+)
+
+func TestRandomIDs(t *testing.T) {
+	id, err := RandomIDs().NewID()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !regexp.MustCompile(`^[0-9a-f]{12}4[0-9a-f]{3}[89ab][0-9a-f]{15}$`).MatchString(id) {
+		t.Errorf("Unexpected ID: %s", id)
+	}
+}
+
+func TestSequentialIDs(t *testing.T) {
+	gen := SequentialIDs()
+	var last string
+	for i := 0; i < 1000; i++ {
+		id, err := gen.NewID()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(id) != 32 {
+			t.Fatalf("Unexpected ID length: %s", id)
+		}
+		if id <= last {
+			t.Fatalf("ID %s does not sort after %s", id, last)
+		}
+		last = id
+	}
+}
+
+type createDocDB struct {
+	dummyDB
+	doc interface{}
+}
+
+func (db *createDocDB) CreateDoc(_ context.Context, doc interface{}) (string, string, error) {
+	db.doc = doc
+	return "", "1-xxx", nil
+}
+
+func TestCreateDocIDGenerator(t *testing.T) {
+	gen := PrefixIDs("user:", IDGeneratorFunc(func() (string, error) {
+		return "generated", nil
+	}))
+	tests := []struct {
+		name     string
+		gen      IDGenerator
+		doc      interface{}
+		expected interface{}
+	}{
+		{
+			name:     "NoGenerator",
+			doc:      map[string]string{"foo": "bar"},
+			expected: map[string]string{"foo": "bar"},
+		},
+		{
+			name:     "Generated",
+			gen:      gen,
+			doc:      map[string]string{"foo": "bar"},
+			expected: map[string]interface{}{"_id": "user:generated", "foo": "bar"},
+		},
+		{
+			name:     "JSON",
+			gen:      gen,
+			doc:      []byte(`{"foo":"bar"}`),
+			expected: map[string]interface{}{"_id": "user:generated", "foo": "bar"},
+		},
+		{
+			name:     "HasID",
+			gen:      gen,
+			doc:      map[string]string{"_id": "foo"},
+			expected: map[string]string{"_id": "foo"},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			client := &Client{driverClient: &capsClient{}}
+			client.SetIDGenerator(test.gen)
+			driverDB := &createDocDB{}
+			db, err := client.DB(context.Background(), "foo")
+			if err != nil {
+				t.Fatal(err)
+			}
+			db.driverDB = driverDB
+			if _, _, err := db.CreateDoc(context.Background(), test.doc); err != nil {
+				t.Fatal(err)
+			}
+			if d := diff.Interface(test.expected, driverDB.doc); d != "" {
+				t.Error(d)
+			}
+		})
+	}
+}
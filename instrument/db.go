@@ -0,0 +1,380 @@
+package instrument
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+
+	"github.com/flimzy/kivik/driver"
+)
+
+type db struct {
+	drv  *instrDriver
+	name string
+	db   driver.DB
+}
+
+var _ driver.DB = &db{}
+var _ driver.Finder = &db{}
+var _ driver.Explainer = &db{}
+var _ driver.AttachmentMetaer = &db{}
+var _ driver.AttachmentCombiner = &db{}
+var _ driver.Rever = &db{}
+var _ driver.DBFlusher = &db{}
+var _ driver.Copier = &db{}
+var _ driver.OptsBulkDocer = &db{}
+var _ driver.OptsPutter = &db{}
+var _ driver.OptsDeleter = &db{}
+var _ driver.Quorumer = &db{}
+var _ driver.OpenRevsGetter = &db{}
+var _ driver.OptsDocCreator = &db{}
+var _ driver.BodyGetter = &db{}
+var _ driver.DesignInfoer = &db{}
+var _ driver.MultipartPutter = &db{}
+var _ driver.OptionValidator = &db{}
+
+func (d *db) begin(ctx context.Context, e Event) *op {
+	e.DB = d.name
+	return d.drv.begin(ctx, e)
+}
+
+func (d *db) AllDocs(ctx context.Context, opts map[string]interface{}) (driver.Rows, error) {
+	o := d.begin(ctx, Event{Op: "AllDocs", Options: opts})
+	rows, err := d.db.AllDocs(o.ctx, opts)
+	o.end(err)
+	return rows, err
+}
+
+func (d *db) Query(ctx context.Context, ddoc, view string, opts map[string]interface{}) (driver.Rows, error) {
+	o := d.begin(ctx, Event{Op: "Query", DocID: "_design/" + ddoc, Options: opts})
+	rows, err := d.db.Query(o.ctx, ddoc, view, opts)
+	o.end(err)
+	return rows, err
+}
+
+func (d *db) Get(ctx context.Context, docID string, opts map[string]interface{}) (json.RawMessage, error) {
+	o := d.begin(ctx, Event{Op: "Get", DocID: docID, Options: opts})
+	doc, err := d.db.Get(o.ctx, docID, opts)
+	o.e.ResponseSize = int64(len(doc))
+	o.end(err)
+	return doc, err
+}
+
+func (d *db) CreateDoc(ctx context.Context, doc interface{}) (docID, rev string, err error) {
+	o := d.begin(ctx, Event{Op: "CreateDoc"})
+	docID, rev, err = d.db.CreateDoc(o.ctx, doc)
+	o.e.DocID = docID
+	o.e.RequestSize = payloadSize(doc)
+	o.end(err)
+	return docID, rev, err
+}
+
+func (d *db) CreateDocOpts(ctx context.Context, doc interface{}, opts map[string]interface{}) (docID, rev string, err error) {
+	o := d.begin(ctx, Event{Op: "CreateDoc", Options: opts})
+	err = notImplemented("OptsDocCreator")
+	if c, ok := d.db.(driver.OptsDocCreator); ok {
+		docID, rev, err = c.CreateDocOpts(o.ctx, doc, opts)
+	}
+	o.e.DocID = docID
+	o.e.RequestSize = payloadSize(doc)
+	o.end(err)
+	return docID, rev, err
+}
+
+func (d *db) Put(ctx context.Context, docID string, doc interface{}) (rev string, err error) {
+	o := d.begin(ctx, Event{Op: "Put", DocID: docID})
+	rev, err = d.db.Put(o.ctx, docID, doc)
+	o.e.RequestSize = payloadSize(doc)
+	o.end(err)
+	return rev, err
+}
+
+func (d *db) PutOpts(ctx context.Context, docID string, doc interface{}, opts map[string]interface{}) (rev string, err error) {
+	o := d.begin(ctx, Event{Op: "Put", DocID: docID, Options: opts})
+	err = notImplemented("OptsPutter")
+	if p, ok := d.db.(driver.OptsPutter); ok {
+		rev, err = p.PutOpts(o.ctx, docID, doc, opts)
+	}
+	o.e.RequestSize = payloadSize(doc)
+	o.end(err)
+	return rev, err
+}
+
+func (d *db) Delete(ctx context.Context, docID, rev string) (newRev string, err error) {
+	o := d.begin(ctx, Event{Op: "Delete", DocID: docID})
+	newRev, err = d.db.Delete(o.ctx, docID, rev)
+	o.end(err)
+	return newRev, err
+}
+
+func (d *db) DeleteOpts(ctx context.Context, docID, rev string, opts map[string]interface{}) (newRev string, err error) {
+	o := d.begin(ctx, Event{Op: "Delete", DocID: docID, Options: opts})
+	err = notImplemented("OptsDeleter")
+	if del, ok := d.db.(driver.OptsDeleter); ok {
+		newRev, err = del.DeleteOpts(o.ctx, docID, rev, opts)
+	}
+	o.end(err)
+	return newRev, err
+}
+
+func (d *db) SupportsQuorum() bool {
+	q, ok := d.db.(driver.Quorumer)
+	return ok && q.SupportsQuorum()
+}
+
+func (d *db) Stats(ctx context.Context) (*driver.DBStats, error) {
+	o := d.begin(ctx, Event{Op: "Stats"})
+	stats, err := d.db.Stats(o.ctx)
+	o.end(err)
+	return stats, err
+}
+
+func (d *db) Compact(ctx context.Context) error {
+	o := d.begin(ctx, Event{Op: "Compact"})
+	err := d.db.Compact(o.ctx)
+	o.end(err)
+	return err
+}
+
+func (d *db) CompactView(ctx context.Context, ddocID string) error {
+	o := d.begin(ctx, Event{Op: "CompactView", DocID: ddocID})
+	err := d.db.CompactView(o.ctx, ddocID)
+	o.end(err)
+	return err
+}
+
+func (d *db) ViewCleanup(ctx context.Context) error {
+	o := d.begin(ctx, Event{Op: "ViewCleanup"})
+	err := d.db.ViewCleanup(o.ctx)
+	o.end(err)
+	return err
+}
+
+func (d *db) Security(ctx context.Context) (*driver.Security, error) {
+	o := d.begin(ctx, Event{Op: "Security"})
+	sec, err := d.db.Security(o.ctx)
+	o.end(err)
+	return sec, err
+}
+
+func (d *db) SetSecurity(ctx context.Context, security *driver.Security) error {
+	o := d.begin(ctx, Event{Op: "SetSecurity"})
+	err := d.db.SetSecurity(o.ctx, security)
+	o.end(err)
+	return err
+}
+
+func (d *db) Changes(ctx context.Context, opts map[string]interface{}) (driver.Changes, error) {
+	o := d.begin(ctx, Event{Op: "Changes", Options: opts})
+	changes, err := d.db.Changes(o.ctx, opts)
+	o.end(err)
+	return changes, err
+}
+
+func (d *db) BulkDocs(ctx context.Context, docs []interface{}) (driver.BulkResults, error) {
+	o := d.begin(ctx, Event{Op: "BulkDocs"})
+	results, err := d.db.BulkDocs(o.ctx, docs)
+	o.e.RequestSize = payloadSize(docs)
+	o.end(err)
+	return results, err
+}
+
+func (d *db) BulkDocsOpts(ctx context.Context, docs []interface{}, opts map[string]interface{}) (results driver.BulkResults, err error) {
+	o := d.begin(ctx, Event{Op: "BulkDocs", Options: opts})
+	err = notImplemented("OptsBulkDocer")
+	if b, ok := d.db.(driver.OptsBulkDocer); ok {
+		results, err = b.BulkDocsOpts(o.ctx, docs, opts)
+	}
+	o.e.RequestSize = payloadSize(docs)
+	o.end(err)
+	return results, err
+}
+
+// countingReader counts the bytes read through it.
+type countingReader struct {
+	io.Reader
+	n int64
+}
+
+func (r *countingReader) Read(p []byte) (int, error) {
+	n, err := r.Reader.Read(p)
+	r.n += int64(n)
+	return n, err
+}
+
+func (d *db) PutAttachment(ctx context.Context, docID, rev, filename, contentType string, body io.Reader) (newRev string, err error) {
+	o := d.begin(ctx, Event{Op: "PutAttachment", DocID: docID})
+	counter := &countingReader{Reader: body}
+	newRev, err = d.db.PutAttachment(o.ctx, docID, rev, filename, contentType, counter)
+	o.e.RequestSize = counter.n
+	o.end(err)
+	return newRev, err
+}
+
+func (d *db) GetAttachment(ctx context.Context, docID, rev, filename string) (contentType string, md5sum driver.MD5sum, body io.ReadCloser, err error) {
+	o := d.begin(ctx, Event{Op: "GetAttachment", DocID: docID})
+	contentType, md5sum, body, err = d.db.GetAttachment(o.ctx, docID, rev, filename)
+	o.end(err)
+	return contentType, md5sum, body, err
+}
+
+func (d *db) DeleteAttachment(ctx context.Context, docID, rev, filename string) (newRev string, err error) {
+	o := d.begin(ctx, Event{Op: "DeleteAttachment", DocID: docID})
+	newRev, err = d.db.DeleteAttachment(o.ctx, docID, rev, filename)
+	o.end(err)
+	return newRev, err
+}
+
+func (d *db) Find(ctx context.Context, query interface{}) (driver.Rows, error) {
+	o := d.begin(ctx, Event{Op: "Find", Query: query})
+	var rows driver.Rows
+	err := notImplemented("Finder")
+	if f, ok := d.db.(driver.Finder); ok {
+		rows, err = f.Find(o.ctx, query)
+	}
+	o.end(err)
+	return rows, err
+}
+
+func (d *db) Explain(ctx context.Context, query interface{}) (*driver.QueryPlan, error) {
+	o := d.begin(ctx, Event{Op: "Explain", Query: query})
+	var plan *driver.QueryPlan
+	err := notImplemented("Explainer")
+	if e, ok := d.db.(driver.Explainer); ok {
+		plan, err = e.Explain(o.ctx, query)
+	}
+	o.end(err)
+	return plan, err
+}
+
+func (d *db) CreateIndex(ctx context.Context, ddoc, name string, index interface{}) error {
+	o := d.begin(ctx, Event{Op: "CreateIndex"})
+	err := notImplemented("Finder")
+	if f, ok := d.db.(driver.Finder); ok {
+		err = f.CreateIndex(o.ctx, ddoc, name, index)
+	}
+	o.end(err)
+	return err
+}
+
+func (d *db) GetIndexes(ctx context.Context) ([]driver.Index, error) {
+	o := d.begin(ctx, Event{Op: "GetIndexes"})
+	var indexes []driver.Index
+	err := notImplemented("Finder")
+	if f, ok := d.db.(driver.Finder); ok {
+		indexes, err = f.GetIndexes(o.ctx)
+	}
+	o.end(err)
+	return indexes, err
+}
+
+func (d *db) DeleteIndex(ctx context.Context, ddoc, name string) error {
+	o := d.begin(ctx, Event{Op: "DeleteIndex"})
+	err := notImplemented("Finder")
+	if f, ok := d.db.(driver.Finder); ok {
+		err = f.DeleteIndex(o.ctx, ddoc, name)
+	}
+	o.end(err)
+	return err
+}
+
+func (d *db) GetAttachmentMeta(ctx context.Context, docID, rev, filename string) (contentType string, md5sum driver.MD5sum, err error) {
+	o := d.begin(ctx, Event{Op: "GetAttachmentMeta", DocID: docID})
+	err = notImplemented("AttachmentMetaer")
+	if m, ok := d.db.(driver.AttachmentMetaer); ok {
+		contentType, md5sum, err = m.GetAttachmentMeta(o.ctx, docID, rev, filename)
+	}
+	o.end(err)
+	return contentType, md5sum, err
+}
+
+func (d *db) Rev(ctx context.Context, docID string) (rev string, err error) {
+	o := d.begin(ctx, Event{Op: "Rev", DocID: docID})
+	err = notImplemented("Rever")
+	if r, ok := d.db.(driver.Rever); ok {
+		rev, err = r.Rev(o.ctx, docID)
+	}
+	o.end(err)
+	return rev, err
+}
+
+func (d *db) GetOpenRevs(ctx context.Context, docID string, revs []string, opts map[string]interface{}) (openRevs []driver.OpenRev, err error) {
+	o := d.begin(ctx, Event{Op: "GetOpenRevs", DocID: docID, Options: opts})
+	err = notImplemented("OpenRevsGetter")
+	if g, ok := d.db.(driver.OpenRevsGetter); ok {
+		openRevs, err = g.GetOpenRevs(o.ctx, docID, revs, opts)
+	}
+	o.end(err)
+	return openRevs, err
+}
+
+func (d *db) GetBody(ctx context.Context, docID string, opts map[string]interface{}) (body io.ReadCloser, err error) {
+	o := d.begin(ctx, Event{Op: "GetBody", DocID: docID, Options: opts})
+	err = notImplemented("BodyGetter")
+	if g, ok := d.db.(driver.BodyGetter); ok {
+		body, err = g.GetBody(o.ctx, docID, opts)
+	}
+	o.end(err)
+	return body, err
+}
+
+func (d *db) SupportedOptions(method string) (map[string]driver.OptionType, bool) {
+	if v, ok := d.db.(driver.OptionValidator); ok {
+		return v.SupportedOptions(method)
+	}
+	return nil, false
+}
+
+func (d *db) Flush(ctx context.Context) error {
+	o := d.begin(ctx, Event{Op: "Flush"})
+	err := notImplemented("DBFlusher")
+	if f, ok := d.db.(driver.DBFlusher); ok {
+		err = f.Flush(o.ctx)
+	}
+	o.end(err)
+	return err
+}
+
+func (d *db) Copy(ctx context.Context, targetID, sourceID string, opts map[string]interface{}) (targetRev string, err error) {
+	o := d.begin(ctx, Event{Op: "Copy", DocID: targetID, Options: opts})
+	err = notImplemented("Copier")
+	if c, ok := d.db.(driver.Copier); ok {
+		targetRev, err = c.Copy(o.ctx, targetID, sourceID, opts)
+	}
+	o.end(err)
+	return targetRev, err
+}
+
+func (d *db) PutMultipart(ctx context.Context, docID string, doc interface{}, atts []driver.MultipartAttachment, opts map[string]interface{}) (rev string, err error) {
+	o := d.begin(ctx, Event{Op: "PutMultipart", DocID: docID, Options: opts})
+	err = notImplemented("MultipartPutter")
+	if p, ok := d.db.(driver.MultipartPutter); ok {
+		rev, err = p.PutMultipart(o.ctx, docID, doc, atts, opts)
+	}
+	o.e.RequestSize = payloadSize(doc)
+	for _, att := range atts {
+		o.e.RequestSize += att.Length
+	}
+	o.end(err)
+	return rev, err
+}
+
+func (d *db) DesignInfo(ctx context.Context, ddoc string) (info *driver.DesignInfo, err error) {
+	o := d.begin(ctx, Event{Op: "DesignInfo", DocID: "_design/" + ddoc})
+	err = notImplemented("DesignInfoer")
+	if i, ok := d.db.(driver.DesignInfoer); ok {
+		info, err = i.DesignInfo(o.ctx, ddoc)
+	}
+	o.end(err)
+	return info, err
+}
+
+func (d *db) CombineAttachments(ctx context.Context, docID, rev, filename, contentType string, parts []string) (newRev string, err error) {
+	o := d.begin(ctx, Event{Op: "CombineAttachments", DocID: docID})
+	err = notImplemented("AttachmentCombiner")
+	if c, ok := d.db.(driver.AttachmentCombiner); ok {
+		newRev, err = c.CombineAttachments(o.ctx, docID, rev, filename, contentType, parts)
+	}
+	o.end(err)
+	return newRev, err
+}
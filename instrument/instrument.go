@@ -0,0 +1,406 @@
+// Package instrument provides a Kivik driver which wraps another driver, and
+// reports the latency, outcome and payload size of every operation to one or
+// more sinks, such as a logger or expvar.
+//
+// To instrument a registered driver, register a wrapper under a new name:
+//
+//	instrument.Register("couch-instrumented", "couch", instrument.LogSink(log.New(os.Stderr, "", 0)))
+//	client, err := kivik.New(context.TODO(), "couch-instrumented", "http://localhost:5984/")
+//
+// Other metrics systems, such as Prometheus, may be connected by implementing
+// the Sink interface. To log only slow operations, with their options or
+// query, wrap a sink with SlowSink.
+//
+// The wrapped driver implements all of the optional driver interfaces. Where
+// the underlying driver does not implement an interface, the corresponding
+// methods return a StatusNotImplemented error, just as the kivik package does
+// for unwrapped drivers.
+package instrument
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+
+	"github.com/flimzy/kivik"
+	"github.com/flimzy/kivik/driver"
+	"github.com/flimzy/kivik/errors"
+)
+
+// Event describes a single driver operation.
+type Event struct {
+	// Driver is the name of the instrumented driver.
+	Driver string
+	// Op is the name of the driver method, such as "Get" or "AllDBs".
+	Op string
+	// DB is the database name, for database-level operations.
+	DB string
+	// DocID is the document ID, for single-document operations.
+	DocID string
+	// Options are the options passed to the operation, if any.
+	Options map[string]interface{}
+	// Query is the Mango query, for Find and Explain.
+	Query    interface{}
+	Duration time.Duration
+	Err      error
+	// RequestSize is the size, in bytes, of the document or attachment sent,
+	// where applicable and known.
+	RequestSize int64
+	// ResponseSize is the size, in bytes, of the document received, where
+	// applicable and known.
+	ResponseSize int64
+	// Context is the context passed to the underlying driver, including any
+	// values added by Starters.
+	Context context.Context
+}
+
+// Sink receives the events for instrumented operations. Record may be called
+// concurrently.
+type Sink interface {
+	Record(Event)
+}
+
+// Starter may optionally be implemented by a Sink which needs to be notified
+// before an operation begins, such as to start a tracing span. Start is called
+// with the caller's context and the event, with only Driver, Op, DB and
+// DocID set, and returns the context to pass to the underlying driver. The
+// same Event, with the returned context as its Context, is later passed to
+// Record.
+type Starter interface {
+	Start(ctx context.Context, e Event) context.Context
+}
+
+// SinkFunc is an adapter to allow the use of an ordinary function as a Sink.
+type SinkFunc func(Event)
+
+// Record calls f(e).
+func (f SinkFunc) Record(e Event) {
+	f(e)
+}
+
+type instrDriver struct {
+	name  string
+	drv   driver.Driver
+	sinks []Sink
+}
+
+var _ driver.Driver = &instrDriver{}
+
+// New returns a driver which wraps drv, and reports each operation to sinks.
+// name is reported as the Driver of each event.
+func New(name string, drv driver.Driver, sinks ...Sink) driver.Driver {
+	return &instrDriver{name: name, drv: drv, sinks: sinks}
+}
+
+// Register registers an instrumented version of the driver registered as
+// wrapped, under the new name name.
+func Register(name, wrapped string, sinks ...Sink) error {
+	drv, ok := kivik.LookupDriver(wrapped)
+	if !ok {
+		return errors.Statusf(kivik.StatusBadRequest, "instrument: unknown driver %q (forgotten import?)", wrapped)
+	}
+	kivik.Register(name, New(wrapped, drv, sinks...))
+	return nil
+}
+
+// op is a single operation in progress.
+type op struct {
+	drv   *instrDriver
+	ctx   context.Context
+	start time.Time
+	e     Event
+}
+
+// begin notifies any Starters of the start of an operation. The returned op's
+// ctx should be passed to the underlying driver.
+func (d *instrDriver) begin(ctx context.Context, e Event) *op {
+	e.Driver = d.name
+	for _, sink := range d.sinks {
+		if s, ok := sink.(Starter); ok {
+			ctx = s.Start(ctx, e)
+		}
+	}
+	e.Context = ctx
+	return &op{drv: d, ctx: ctx, start: time.Now(), e: e}
+}
+
+// end reports the completed operation, with the duration since it began, to
+// all sinks.
+func (o *op) end(err error) {
+	o.e.Err = err
+	o.e.Duration = time.Since(o.start)
+	for _, sink := range o.drv.sinks {
+		sink.Record(o.e)
+	}
+}
+
+func (d *instrDriver) NewClient(ctx context.Context, dsn string) (driver.Client, error) {
+	o := d.begin(ctx, Event{Op: "NewClient"})
+	c, err := d.drv.NewClient(o.ctx, dsn)
+	o.end(err)
+	if err != nil {
+		return nil, err
+	}
+	return &client{drv: d, client: c}, nil
+}
+
+func notImplemented(iface string) error {
+	return errors.Statusf(kivik.StatusNotImplemented, "kivik: driver does not implement %s", iface)
+}
+
+// payloadSize returns the size of doc, when marshaled to JSON.
+func payloadSize(doc interface{}) int64 {
+	switch t := doc.(type) {
+	case []byte:
+		return int64(len(t))
+	case json.RawMessage:
+		return int64(len(t))
+	case string:
+		return int64(len(t))
+	}
+	body, err := json.Marshal(doc)
+	if err != nil {
+		return 0
+	}
+	return int64(len(body))
+}
+
+type client struct {
+	drv    *instrDriver
+	client driver.Client
+}
+
+var _ driver.Client = &client{}
+var _ driver.ClientReplicator = &client{}
+var _ driver.Authenticator = &client{}
+var _ driver.DBUpdater = &client{}
+var _ driver.PoolStatser = &client{}
+var _ driver.AdminPartyChecker = &client{}
+var _ driver.DiskUsager = &client{}
+var _ driver.Configer = &client{}
+var _ driver.Clusterer = &client{}
+var _ driver.OptionValidator = &client{}
+
+func (c *client) Version(ctx context.Context) (*driver.Version, error) {
+	o := c.drv.begin(ctx, Event{Op: "Version"})
+	v, err := c.client.Version(o.ctx)
+	o.end(err)
+	return v, err
+}
+
+func (c *client) AllDBs(ctx context.Context, opts map[string]interface{}) ([]string, error) {
+	o := c.drv.begin(ctx, Event{Op: "AllDBs", Options: opts})
+	dbs, err := c.client.AllDBs(o.ctx, opts)
+	o.end(err)
+	return dbs, err
+}
+
+func (c *client) DBExists(ctx context.Context, dbName string, opts map[string]interface{}) (bool, error) {
+	o := c.drv.begin(ctx, Event{Op: "DBExists", DB: dbName, Options: opts})
+	exists, err := c.client.DBExists(o.ctx, dbName, opts)
+	o.end(err)
+	return exists, err
+}
+
+func (c *client) CreateDB(ctx context.Context, dbName string, opts map[string]interface{}) error {
+	o := c.drv.begin(ctx, Event{Op: "CreateDB", DB: dbName, Options: opts})
+	err := c.client.CreateDB(o.ctx, dbName, opts)
+	o.end(err)
+	return err
+}
+
+func (c *client) DestroyDB(ctx context.Context, dbName string, opts map[string]interface{}) error {
+	o := c.drv.begin(ctx, Event{Op: "DestroyDB", DB: dbName, Options: opts})
+	err := c.client.DestroyDB(o.ctx, dbName, opts)
+	o.end(err)
+	return err
+}
+
+func (c *client) DB(ctx context.Context, dbName string, opts map[string]interface{}) (driver.DB, error) {
+	o := c.drv.begin(ctx, Event{Op: "DB", DB: dbName, Options: opts})
+	d, err := c.client.DB(o.ctx, dbName, opts)
+	o.end(err)
+	if err != nil {
+		return nil, err
+	}
+	return &db{drv: c.drv, name: dbName, db: d}, nil
+}
+
+func (c *client) Replicate(ctx context.Context, targetDSN, sourceDSN string, opts map[string]interface{}) (driver.Replication, error) {
+	o := c.drv.begin(ctx, Event{Op: "Replicate", Options: opts})
+	var rep driver.Replication
+	err := notImplemented("ClientReplicator")
+	if r, ok := c.client.(driver.ClientReplicator); ok {
+		rep, err = r.Replicate(o.ctx, targetDSN, sourceDSN, opts)
+	}
+	o.end(err)
+	return rep, err
+}
+
+func (c *client) GetReplications(ctx context.Context, opts map[string]interface{}) ([]driver.Replication, error) {
+	o := c.drv.begin(ctx, Event{Op: "GetReplications", Options: opts})
+	var reps []driver.Replication
+	err := notImplemented("ClientReplicator")
+	if r, ok := c.client.(driver.ClientReplicator); ok {
+		reps, err = r.GetReplications(o.ctx, opts)
+	}
+	o.end(err)
+	return reps, err
+}
+
+func (c *client) Authenticate(ctx context.Context, authenticator interface{}) error {
+	o := c.drv.begin(ctx, Event{Op: "Authenticate"})
+	err := notImplemented("Authenticator")
+	if a, ok := c.client.(driver.Authenticator); ok {
+		err = a.Authenticate(o.ctx, authenticator)
+	}
+	o.end(err)
+	return err
+}
+
+func (c *client) DBUpdates() (driver.DBUpdates, error) {
+	o := c.drv.begin(context.Background(), Event{Op: "DBUpdates"})
+	var updates driver.DBUpdates
+	err := notImplemented("DBUpdater")
+	if u, ok := c.client.(driver.DBUpdater); ok {
+		updates, err = u.DBUpdates()
+	}
+	o.end(err)
+	return updates, err
+}
+
+func (c *client) PoolStats() (driver.PoolStats, error) {
+	if s, ok := c.client.(driver.PoolStatser); ok {
+		return s.PoolStats()
+	}
+	return driver.PoolStats{}, notImplemented("PoolStatser")
+}
+
+func (c *client) AdminParty(ctx context.Context) (bool, error) {
+	o := c.drv.begin(ctx, Event{Op: "AdminParty"})
+	var party bool
+	err := notImplemented("AdminPartyChecker")
+	if a, ok := c.client.(driver.AdminPartyChecker); ok {
+		party, err = a.AdminParty(o.ctx)
+	}
+	o.end(err)
+	return party, err
+}
+
+func (c *client) DiskUsage(ctx context.Context) (*driver.DiskUsage, error) {
+	o := c.drv.begin(ctx, Event{Op: "DiskUsage"})
+	var usage *driver.DiskUsage
+	err := notImplemented("DiskUsager")
+	if u, ok := c.client.(driver.DiskUsager); ok {
+		usage, err = u.DiskUsage(o.ctx)
+	}
+	o.end(err)
+	return usage, err
+}
+
+func (c *client) configer() (driver.Configer, error) {
+	if configer, ok := c.client.(driver.Configer); ok {
+		return configer, nil
+	}
+	return nil, notImplemented("Configer")
+}
+
+func (c *client) Config(ctx context.Context, node string) (driver.Config, error) {
+	o := c.drv.begin(ctx, Event{Op: "Config"})
+	var config driver.Config
+	configer, err := c.configer()
+	if err == nil {
+		config, err = configer.Config(o.ctx, node)
+	}
+	o.end(err)
+	return config, err
+}
+
+func (c *client) ConfigSection(ctx context.Context, node, section string) (driver.ConfigSection, error) {
+	o := c.drv.begin(ctx, Event{Op: "ConfigSection"})
+	var sec driver.ConfigSection
+	configer, err := c.configer()
+	if err == nil {
+		sec, err = configer.ConfigSection(o.ctx, node, section)
+	}
+	o.end(err)
+	return sec, err
+}
+
+func (c *client) ConfigValue(ctx context.Context, node, section, key string) (string, error) {
+	o := c.drv.begin(ctx, Event{Op: "ConfigValue"})
+	var value string
+	configer, err := c.configer()
+	if err == nil {
+		value, err = configer.ConfigValue(o.ctx, node, section, key)
+	}
+	o.end(err)
+	return value, err
+}
+
+func (c *client) SetConfigValue(ctx context.Context, node, section, key, value string) (string, error) {
+	o := c.drv.begin(ctx, Event{Op: "SetConfigValue"})
+	var old string
+	configer, err := c.configer()
+	if err == nil {
+		old, err = configer.SetConfigValue(o.ctx, node, section, key, value)
+	}
+	o.end(err)
+	return old, err
+}
+
+func (c *client) DeleteConfigKey(ctx context.Context, node, section, key string) (string, error) {
+	o := c.drv.begin(ctx, Event{Op: "DeleteConfigKey"})
+	var old string
+	configer, err := c.configer()
+	if err == nil {
+		old, err = configer.DeleteConfigKey(o.ctx, node, section, key)
+	}
+	o.end(err)
+	return old, err
+}
+
+func (c *client) clusterer() (driver.Clusterer, error) {
+	if clusterer, ok := c.client.(driver.Clusterer); ok {
+		return clusterer, nil
+	}
+	return nil, notImplemented("Clusterer")
+}
+
+func (c *client) Membership(ctx context.Context) (*driver.Membership, error) {
+	o := c.drv.begin(ctx, Event{Op: "Membership"})
+	var membership *driver.Membership
+	clusterer, err := c.clusterer()
+	if err == nil {
+		membership, err = clusterer.Membership(o.ctx)
+	}
+	o.end(err)
+	return membership, err
+}
+
+func (c *client) AddNode(ctx context.Context, node string) error {
+	o := c.drv.begin(ctx, Event{Op: "AddNode"})
+	clusterer, err := c.clusterer()
+	if err == nil {
+		err = clusterer.AddNode(o.ctx, node)
+	}
+	o.end(err)
+	return err
+}
+
+func (c *client) RemoveNode(ctx context.Context, node string) error {
+	o := c.drv.begin(ctx, Event{Op: "RemoveNode"})
+	clusterer, err := c.clusterer()
+	if err == nil {
+		err = clusterer.RemoveNode(o.ctx, node)
+	}
+	o.end(err)
+	return err
+}
+
+func (c *client) SupportedOptions(method string) (map[string]driver.OptionType, bool) {
+	if v, ok := c.client.(driver.OptionValidator); ok {
+		return v.SupportedOptions(method)
+	}
+	return nil, false
+}
@@ -0,0 +1,184 @@
+package instrument
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"expvar"
+	"fmt"
+	"log"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/flimzy/diff"
+	"github.com/flimzy/kivik"
+	"github.com/flimzy/kivik/driver"
+	_ "github.com/flimzy/kivik/driver/memory"
+)
+
+type recorder struct {
+	mu     sync.Mutex
+	events []Event
+}
+
+func (r *recorder) Record(e Event) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.events = append(r.events, e)
+}
+
+// summary returns "op db/docID status" for each event.
+func (r *recorder) summary() []string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var lines []string
+	for _, e := range r.events {
+		status := "ok"
+		if e.Err != nil {
+			status = kivik.Reason(e.Err)
+		}
+		if e.Driver != "memory" || e.Duration < 0 {
+			status = "bad event"
+		}
+		lines = append(lines, strings.Join([]string{e.Op, e.DB + "/" + e.DocID, status}, " "))
+	}
+	return lines
+}
+
+var rec = &recorder{}
+
+func init() {
+	if err := Register("memory-test", "memory", rec); err != nil {
+		panic(err)
+	}
+}
+
+func TestRegisterUnknown(t *testing.T) {
+	if err := Register("foo", "no such driver"); kivik.StatusCode(err) != kivik.StatusBadRequest {
+		t.Errorf("Unexpected error: %v", err)
+	}
+}
+
+func TestInstrument(t *testing.T) {
+	rec.mu.Lock()
+	rec.events = nil
+	rec.mu.Unlock()
+	ctx := context.Background()
+	client, err := kivik.New(ctx, "memory-test", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = client.CreateDB(ctx, "foo"); err != nil {
+		t.Fatal(err)
+	}
+	db, err := client.DB(ctx, "foo")
+	if err != nil {
+		t.Fatal(err)
+	}
+	rev, err := db.Put(ctx, "bar", map[string]string{"a": "b"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Rev falls back to Get, since the memory driver does not implement Rever.
+	if _, err = db.Rev(ctx, "bar"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = db.Get(ctx, "missing"); kivik.StatusCode(err) != kivik.StatusNotFound {
+		t.Errorf("Unexpected error: %v", err)
+	}
+	if _, err = db.Delete(ctx, "bar", rev); err != nil {
+		t.Fatal(err)
+	}
+	expected := []string{
+		"NewClient / ok",
+		"CreateDB foo/ ok",
+		"DB foo/ ok",
+		"Put foo/bar ok",
+		"Rev foo/bar kivik: driver does not implement Rever",
+		"Get foo/bar ok",
+		"Get foo/missing missing",
+		"Delete foo/bar ok",
+	}
+	if d := diff.Interface(expected, rec.summary()); d != "" {
+		t.Error(d)
+	}
+	rec.mu.Lock()
+	put, get := rec.events[3], rec.events[5]
+	rec.mu.Unlock()
+	if put.RequestSize != int64(len(`{"a":"b"}`)) {
+		t.Errorf("Unexpected Put request size: %d", put.RequestSize)
+	}
+	if get.ResponseSize == 0 {
+		t.Errorf("Get response size not recorded")
+	}
+}
+
+func TestLogSink(t *testing.T) {
+	buf := &bytes.Buffer{}
+	LogSink(log.New(buf, "", 0)).Record(Event{Driver: "couch", Op: "Get", DB: "foo", DocID: "bar", RequestSize: 0, ResponseSize: 10})
+	expected := "kivik: couch Get foo/bar (0s, sent 0 bytes, received 10 bytes) ok\n"
+	if buf.String() != expected {
+		t.Errorf("Unexpected log output: %s", buf.String())
+	}
+}
+
+func TestSlowSink(t *testing.T) {
+	buf := &bytes.Buffer{}
+	sink := SlowSink(100*time.Millisecond, LogSink(log.New(buf, "", 0)))
+	sink.Record(Event{Driver: "couch", Op: "Get", DB: "foo", DocID: "bar", Duration: 99 * time.Millisecond})
+	sink.Record(Event{Driver: "couch", Op: "AllDocs", DB: "foo", Duration: 100 * time.Millisecond, Options: map[string]interface{}{"limit": 10}})
+	sink.Record(Event{Driver: "couch", Op: "Find", DB: "foo", Duration: time.Second, Query: json.RawMessage(`{"selector":{}}`)})
+	expected := "kivik: couch AllDocs foo (100ms, sent 0 bytes, received 0 bytes) ok options={\"limit\":10}\n" +
+		"kivik: couch Find foo (1s, sent 0 bytes, received 0 bytes) ok query={\"selector\":{}}\n"
+	if d := diff.Text(expected, buf.String()); d != "" {
+		t.Error(d)
+	}
+}
+
+// expvarRuns numbers the runs of TestExpvarSink, as a name may be published
+// only once.
+var expvarRuns int32
+
+func TestExpvarSink(t *testing.T) {
+	name := fmt.Sprintf("kivik_test_%d", atomic.AddInt32(&expvarRuns, 1))
+	sink := ExpvarSink(name)
+	sink.Record(Event{Op: "Get", Duration: 5, ResponseSize: 10})
+	sink.Record(Event{Op: "Get", Duration: 7, Err: kivik.ErrNotFound})
+	expected := `{"Get": {"count": 2, "errors": 1, "nanoseconds": 12, "request_bytes": 0, "response_bytes": 10}}`
+	if d := diff.JSON([]byte(expected), []byte(expvar.Get(name).String())); d != "" {
+		t.Error(d)
+	}
+}
+
+// designInfoDB reports the status of any design document's index.
+type designInfoDB struct {
+	driver.DB
+}
+
+func (d *designInfoDB) DesignInfo(_ context.Context, ddoc string) (*driver.DesignInfo, error) {
+	return &driver.DesignInfo{Name: ddoc}, nil
+}
+
+func TestDesignInfo(t *testing.T) {
+	r := &recorder{}
+	drv := New("memory", nil, r).(*instrDriver)
+	ctx := context.Background()
+	supported := &db{drv: drv, name: "foo", db: &designInfoDB{}}
+	if info, err := supported.DesignInfo(ctx, "bar"); err != nil || info.Name != "bar" {
+		t.Errorf("Unexpected result: %v, %v", info, err)
+	}
+	unsupported := &db{drv: drv, name: "foo", db: struct{ driver.DB }{}}
+	if _, err := unsupported.DesignInfo(ctx, "bar"); kivik.StatusCode(err) != kivik.StatusNotImplemented {
+		t.Errorf("Unexpected error: %v", err)
+	}
+	expected := []string{
+		"DesignInfo foo/_design/bar ok",
+		"DesignInfo foo/_design/bar kivik: driver does not implement DesignInfoer",
+	}
+	if d := diff.Interface(expected, r.summary()); d != "" {
+		t.Error(d)
+	}
+}
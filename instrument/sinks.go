@@ -0,0 +1,99 @@
+package instrument
+
+import (
+	"encoding/json"
+	"expvar"
+	"log"
+	"sync"
+	"time"
+)
+
+// LogSink returns a Sink which logs each event to l. The options and query of
+// the event, if any, are appended as JSON.
+func LogSink(l *log.Logger) Sink {
+	return SinkFunc(func(e Event) {
+		target := e.DB
+		if e.DocID != "" {
+			target += "/" + e.DocID
+		}
+		status := "ok"
+		if e.Err != nil {
+			status = "error: " + e.Err.Error()
+		}
+		var extra string
+		if len(e.Options) > 0 {
+			extra += " options=" + logJSON(e.Options)
+		}
+		if e.Query != nil {
+			extra += " query=" + logJSON(e.Query)
+		}
+		l.Printf("kivik: %s %s %s (%s, sent %d bytes, received %d bytes) %s%s",
+			e.Driver, e.Op, target, e.Duration, e.RequestSize, e.ResponseSize, status, extra)
+	})
+}
+
+func logJSON(v interface{}) string {
+	switch t := v.(type) {
+	case []byte:
+		return string(t)
+	case json.RawMessage:
+		return string(t)
+	case string:
+		return t
+	}
+	body, err := json.Marshal(v)
+	if err != nil {
+		return "?"
+	}
+	return string(body)
+}
+
+// SlowSink returns a Sink which passes to sink only the events of operations
+// which took threshold or longer, to log slow operations, such as unindexed
+// queries, in production:
+//
+//	sink := instrument.SlowSink(500*time.Millisecond, instrument.LogSink(logger))
+//
+// Start is not passed to sink, as whether an operation is slow is not known
+// until it ends.
+func SlowSink(threshold time.Duration, sink Sink) Sink {
+	return SinkFunc(func(e Event) {
+		if e.Duration >= threshold {
+			sink.Record(e)
+		}
+	})
+}
+
+// ExpvarSink returns a Sink which publishes cumulative per-operation metrics
+// as the expvar variable name. For each operation, the following counters
+// are maintained, keyed by operation name:
+//
+//	count           The number of calls
+//	errors          The number of calls which returned an error
+//	nanoseconds     The total duration of all calls
+//	request_bytes   The total request payload size
+//	response_bytes  The total response payload size
+//
+// As with expvar.NewMap, ExpvarSink panics if name is already published.
+func ExpvarSink(name string) Sink {
+	root := expvar.NewMap(name)
+	var mu sync.Mutex
+	ops := make(map[string]*expvar.Map)
+	return SinkFunc(func(e Event) {
+		mu.Lock()
+		op, ok := ops[e.Op]
+		if !ok {
+			op = new(expvar.Map).Init()
+			ops[e.Op] = op
+			root.Set(e.Op, op)
+		}
+		mu.Unlock()
+		op.Add("count", 1)
+		if e.Err != nil {
+			op.Add("errors", 1)
+		}
+		op.Add("nanoseconds", int64(e.Duration))
+		op.Add("request_bytes", e.RequestSize)
+		op.Add("response_bytes", e.ResponseSize)
+	})
+}
@@ -15,6 +15,7 @@ type iterator interface {
 
 type iter struct {
 	feed iterator
+	ctx  context.Context
 
 	mu      sync.RWMutex
 	ready   bool // Set to true once Next() has been called
@@ -49,8 +50,8 @@ func newIterator(ctx context.Context, feed iterator, zeroValue interface{}) *ite
 		feed:   feed,
 		curVal: zeroValue,
 	}
-	ctx, i.cancel = context.WithCancel(ctx)
-	go i.awaitDone(ctx)
+	i.ctx, i.cancel = context.WithCancel(ctx)
+	go i.awaitDone(i.ctx)
 	return i
 }
 
@@ -78,8 +79,17 @@ func (i *iter) next() (doClose, ok bool) {
 		return false, false
 	}
 	i.ready = true
+	if err := i.ctx.Err(); err != nil {
+		i.lasterr = err
+		return true, false
+	}
 	i.lasterr = i.feed.Next(i.curVal)
 	if i.lasterr != nil {
+		// If the context was cancelled during the call to Next, the driver's
+		// error is most likely a consequence, so report the cancellation.
+		if err := i.ctx.Err(); err != nil && i.lasterr != io.EOF {
+			i.lasterr = err
+		}
 		return true, false
 	}
 	return false, true
@@ -143,5 +153,5 @@ func scan(dest interface{}, val json.RawMessage) error {
 		*d = val
 		return nil
 	}
-	return json.Unmarshal(val, dest)
+	return UnmarshalDocument(val, dest)
 }
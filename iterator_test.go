@@ -2,6 +2,7 @@ package kivik
 
 import (
 	"context"
+	"errors"
 	"io"
 	"testing"
 	"time"
@@ -60,3 +61,29 @@ func TestCancelledIterator(t *testing.T) {
 		t.Errorf("Unexpected error: %s", err)
 	}
 }
+
+// blockingFeed blocks in Next until it is unblocked by the cancellation of
+// ctx, as a driver's network read would, and then fails.
+type blockingFeed struct {
+	ctx context.Context
+}
+
+var _ iterator = &blockingFeed{}
+
+func (f *blockingFeed) Close() error { return nil }
+func (f *blockingFeed) Next(_ interface{}) error {
+	<-f.ctx.Done()
+	return errors.New("read on closed body")
+}
+
+func TestIteratorCancelDuringNext(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	iter := newIterator(ctx, &blockingFeed{ctx: ctx}, new(int64))
+	time.AfterFunc(5*time.Millisecond, cancel)
+	if iter.Next() {
+		t.Fatal("Expected Next to fail")
+	}
+	if err := iter.Err(); err != context.Canceled {
+		t.Errorf("Unexpected error: %v", err)
+	}
+}
@@ -0,0 +1,51 @@
+package kivik
+
+import (
+	"encoding/json"
+	"sync/atomic"
+)
+
+// JSONCodec is an implementation of JSON encoding, compatible with
+// encoding/json, such as jsoniter.ConfigCompatibleWithStandardLibrary.
+type JSONCodec interface {
+	Marshal(v interface{}) ([]byte, error)
+	Unmarshal(data []byte, v interface{}) error
+}
+
+type stdJSON struct{}
+
+func (stdJSON) Marshal(v interface{}) ([]byte, error)      { return json.Marshal(v) }
+func (stdJSON) Unmarshal(data []byte, v interface{}) error { return json.Unmarshal(data, v) }
+
+// jsonCodec holds a jsonCodecValue, so that the codec may be read without
+// locking, on every document marshaled or unmarshaled.
+var jsonCodec atomic.Value
+
+type jsonCodecValue struct {
+	JSONCodec
+}
+
+func init() {
+	jsonCodec.Store(jsonCodecValue{stdJSON{}})
+}
+
+// SetJSONCodec replaces encoding/json with codec, for the marshaling and
+// unmarshaling of documents by kivik, such as by Put, BulkDocs, ScanDoc and
+// ScanValue, and by drivers which use JSON. Streaming responses, such as rows
+// and changes feeds, are still split into rows by encoding/json, but each
+// document or value is unmarshaled with codec. If codec is nil, encoding/json
+// is restored. SetJSONCodec is intended to be called during initialization,
+// before any clients are used.
+func SetJSONCodec(codec JSONCodec) {
+	if codec == nil {
+		codec = stdJSON{}
+	}
+	jsonCodec.Store(jsonCodecValue{codec})
+}
+
+// JSON returns the JSONCodec set with SetJSONCodec, or an implementation
+// using encoding/json. Drivers should marshal and unmarshal documents with
+// JSON, so that the codec applies to them.
+func JSON() JSONCodec {
+	return jsonCodec.Load().(jsonCodecValue).JSONCodec
+}
@@ -0,0 +1,51 @@
+package kivik
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+type countingJSON struct {
+	marshals, unmarshals int
+}
+
+func (c *countingJSON) Marshal(v interface{}) ([]byte, error) {
+	c.marshals++
+	return json.Marshal(v)
+}
+
+func (c *countingJSON) Unmarshal(data []byte, v interface{}) error {
+	c.unmarshals++
+	return json.Unmarshal(data, v)
+}
+
+func TestSetJSONCodec(t *testing.T) {
+	codec := &countingJSON{}
+	SetJSONCodec(codec)
+	defer SetJSONCodec(nil)
+
+	if _, err := MarshalDocument(map[string]string{"foo": "bar"}); err != nil {
+		t.Fatal(err)
+	}
+	var doc struct {
+		ID  string `json:"-" kivik:"id"`
+		Foo string `json:"foo"`
+	}
+	if err := scan(&doc, json.RawMessage(`{"_id":"x","foo":"bar"}`)); err != nil {
+		t.Fatal(err)
+	}
+	if doc.ID != "x" || doc.Foo != "bar" {
+		t.Errorf("Unexpected result: %+v", doc)
+	}
+	if codec.marshals != 1 {
+		t.Errorf("Expected 1 marshal, got %d", codec.marshals)
+	}
+	if codec.unmarshals != 3 {
+		t.Errorf("Expected 3 unmarshals, got %d", codec.unmarshals)
+	}
+
+	SetJSONCodec(nil)
+	if _, ok := JSON().(stdJSON); !ok {
+		t.Errorf("Expected encoding/json to be restored, got %T", JSON())
+	}
+}
@@ -3,11 +3,9 @@ package kivik
 import (
 	"context"
 	"encoding/json"
-	"fmt"
 
 	"github.com/flimzy/kivik/driver"
 	"github.com/flimzy/kivik/errors"
-	"github.com/imdario/mergo"
 )
 
 // Client is a client connection handle to a CouchDB-like server.
@@ -15,39 +13,20 @@ type Client struct {
 	dsn          string
 	driverName   string
 	driverClient driver.Client
+	idGenerator  IDGenerator
+	hooks        []Hooks
+	middleware   []Middleware
+	timeouts     Timeouts
+	strict       bool
 }
 
 // Options is a collection of options. The keys and values are backend specific.
 type Options map[string]interface{}
 
-func mergeOptions(otherOpts ...Options) (Options, error) {
-	var options Options
-	for _, opts := range otherOpts {
-		if err := mergo.MergeWithOverwrite(&options, opts); err != nil {
-			return nil, err
-		}
-	}
-	return options, nil
-}
-
 // New creates a new client object specified by its database driver name
 // and a driver-specific data source name.
 func New(ctx context.Context, driverName, dataSourceName string) (*Client, error) {
-	driversMu.RLock()
-	driveri, ok := drivers[driverName]
-	driversMu.RUnlock()
-	if !ok {
-		return nil, fmt.Errorf("kivik: unknown driver %q (forgotten import?)", driverName)
-	}
-	client, err := driveri.NewClient(ctx, dataSourceName)
-	if err != nil {
-		return nil, err
-	}
-	return &Client{
-		dsn:          dataSourceName,
-		driverName:   driverName,
-		driverClient: client,
-	}, nil
+	return defaultRegistry.New(ctx, driverName, dataSourceName)
 }
 
 // Driver returns the name of the driver string used to connect this client.
@@ -66,6 +45,9 @@ type Version struct {
 	Version string
 	// Vendor is the vendor string reported by the server or backend.
 	Vendor string
+	// Features is the list of optional features reported by the server or
+	// backend, such as "scheduler" for CouchDB 2.1's replication scheduler.
+	Features []string
 	// RawResponse is the raw response body returned by the server, useful if
 	// you need additional backend-specific information.
 	//
@@ -76,64 +58,127 @@ type Version struct {
 
 // Version returns version and vendor info about the backend.
 func (c *Client) Version(ctx context.Context) (*Version, error) {
-	ver, err := c.driverClient.Version(ctx)
+	result, err := c.invoke(ctx, &Operation{Name: "Version"}, func(ctx context.Context, _ *Operation) (interface{}, error) {
+		return c.driverClient.Version(ctx)
+	})
 	if err != nil {
 		return nil, err
 	}
+	ver, ok := result.(*driver.Version)
+	if !ok {
+		return nil, unexpectedResult("Version", result)
+	}
 	return &Version{
 		Version:     ver.Version,
 		Vendor:      ver.Vendor,
+		Features:    ver.Features,
 		RawResponse: ver.RawResponse,
 	}, nil
 }
 
+// HasFeature returns true if the server or backend reports the feature.
+func (v *Version) HasFeature(feature string) bool {
+	for _, f := range v.Features {
+		if f == feature {
+			return true
+		}
+	}
+	return false
+}
+
 // DB returns a handle to the requested database. Any options parameters
-// passed are merged, with later values taking precidence.
+// passed are merged, with later values taking precidence. Options set with
+// DefaultOptions are used by the methods of the DB, rather than passed to the
+// driver. Options attached to ctx with WithOptions are also passed to the
+// driver, but do not become defaults of the DB.
 func (c *Client) DB(ctx context.Context, dbName string, options ...Options) (*DB, error) {
+	if ctxOpts := contextOptions(ctx); ctxOpts != nil {
+		options = append([]Options{applicableOptions(c.driverClient, "DB", ctxOpts)}, options...)
+	}
 	opts, err := mergeOptions(options...)
 	if err != nil {
 		return nil, err
 	}
-	db, err := c.driverClient.DB(ctx, dbName, opts)
+	defaults := takeDefaults(opts)
+	if err := validateOptions(c.driverClient, "DB", opts); err != nil {
+		return nil, err
+	}
+	op := &Operation{Name: "DB", DB: dbName, Options: opts}
+	result, err := c.invoke(ctx, op, func(ctx context.Context, op *Operation) (interface{}, error) {
+		return c.driverClient.DB(ctx, op.DB, op.Options)
+	})
+	db, ok := result.(driver.DB)
+	if err == nil && !ok {
+		return nil, unexpectedResult("DB", result)
+	}
 	return &DB{
-		driverDB: db,
+		driverDB:    db,
+		name:        op.DB,
+		idGenerator: c.idGenerator,
+		hooks:       append([]Hooks(nil), c.hooks...),
+		middleware:  append([]Middleware(nil), c.middleware...),
+		defaults:    defaults,
+		timeouts:    c.timeouts,
+		strict:      c.strict,
 	}, err
 }
 
 // AllDBs returns a list of all databases.
 func (c *Client) AllDBs(ctx context.Context, options ...Options) ([]string, error) {
-	opts, err := mergeOptions(options...)
+	ctx, cancel := withTimeout(ctx, c.timeouts.Read)
+	defer cancel()
+	opts, err := c.options(ctx, "AllDBs", options...)
 	if err != nil {
 		return nil, err
 	}
-	return c.driverClient.AllDBs(ctx, opts)
+	result, err := c.invoke(ctx, &Operation{Name: "AllDBs", Options: opts}, func(ctx context.Context, op *Operation) (interface{}, error) {
+		return c.driverClient.AllDBs(ctx, op.Options)
+	})
+	dbs, _ := result.([]string)
+	return dbs, err
 }
 
 // DBExists returns true if the specified database exists.
 func (c *Client) DBExists(ctx context.Context, dbName string, options ...Options) (bool, error) {
-	opts, err := mergeOptions(options...)
+	ctx, cancel := withTimeout(ctx, c.timeouts.Read)
+	defer cancel()
+	opts, err := c.options(ctx, "DBExists", options...)
 	if err != nil {
 		return false, err
 	}
-	return c.driverClient.DBExists(ctx, dbName, opts)
+	result, err := c.invoke(ctx, &Operation{Name: "DBExists", DB: dbName, Options: opts}, func(ctx context.Context, op *Operation) (interface{}, error) {
+		return c.driverClient.DBExists(ctx, op.DB, op.Options)
+	})
+	exists, _ := result.(bool)
+	return exists, err
 }
 
 // CreateDB creates a DB of the requested name.
 func (c *Client) CreateDB(ctx context.Context, dbName string, options ...Options) error {
-	opts, err := mergeOptions(options...)
+	ctx, cancel := withTimeout(ctx, c.timeouts.Write)
+	defer cancel()
+	opts, err := c.options(ctx, "CreateDB", options...)
 	if err != nil {
 		return err
 	}
-	return c.driverClient.CreateDB(ctx, dbName, opts)
+	_, err = c.invoke(ctx, &Operation{Name: "CreateDB", DB: dbName, Options: opts}, func(ctx context.Context, op *Operation) (interface{}, error) {
+		return nil, c.driverClient.CreateDB(ctx, op.DB, op.Options)
+	})
+	return err
 }
 
 // DestroyDB deletes the requested DB.
 func (c *Client) DestroyDB(ctx context.Context, dbName string, options ...Options) error {
-	opts, err := mergeOptions(options...)
+	ctx, cancel := withTimeout(ctx, c.timeouts.Write)
+	defer cancel()
+	opts, err := c.options(ctx, "DestroyDB", options...)
 	if err != nil {
 		return err
 	}
-	return c.driverClient.DestroyDB(ctx, dbName, opts)
+	_, err = c.invoke(ctx, &Operation{Name: "DestroyDB", DB: dbName, Options: opts}, func(ctx context.Context, op *Operation) (interface{}, error) {
+		return nil, c.driverClient.DestroyDB(ctx, op.DB, op.Options)
+	})
+	return err
 }
 
 // Authenticate authenticates the client with the passed authenticator, which
@@ -141,7 +186,10 @@ func (c *Client) DestroyDB(ctx context.Context, dbName string, options ...Option
 // error will be returned.
 func (c *Client) Authenticate(ctx context.Context, a interface{}) error {
 	if auth, ok := c.driverClient.(driver.Authenticator); ok {
-		return auth.Authenticate(ctx, a)
+		_, err := c.invoke(ctx, &Operation{Name: "Authenticate"}, func(ctx context.Context, _ *Operation) (interface{}, error) {
+			return nil, auth.Authenticate(ctx, a)
+		})
+		return err
 	}
 	return errors.Status(StatusNotImplemented, "kivik: driver does not support authentication")
 }
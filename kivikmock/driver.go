@@ -0,0 +1,213 @@
+package kivikmock
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"sync"
+
+	"github.com/flimzy/kivik"
+	"github.com/flimzy/kivik/driver"
+	"github.com/flimzy/kivik/errors"
+)
+
+type mockDriver struct {
+	mu    sync.Mutex
+	count int
+	mocks map[string]*Mock
+}
+
+var _ driver.Driver = &mockDriver{}
+
+func (d *mockDriver) NewClient(_ context.Context, dsn string) (driver.Client, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	m, ok := d.mocks[dsn]
+	if !ok {
+		return nil, errors.Statusf(kivik.StatusBadRequest, "kivikmock: no mock for DSN '%s'; use kivikmock.New()", dsn)
+	}
+	return &client{mock: m}, nil
+}
+
+type client struct {
+	mock *Mock
+}
+
+var _ driver.Client = &client{}
+
+func (c *client) Version(_ context.Context) (*driver.Version, error) {
+	return &driver.Version{
+		Version:     "0.0.0",
+		Vendor:      "Kivik Mock",
+		RawResponse: json.RawMessage(`{"couchdb":"Welcome","version":"0.0.0","vendor":{"name":"Kivik Mock"}}`),
+	}, nil
+}
+
+func (c *client) AllDBs(_ context.Context, _ map[string]interface{}) ([]string, error) {
+	e, err := c.mock.match("AllDBs()", func(e expectation) bool {
+		_, ok := e.(*ExpectedAllDBs)
+		return ok
+	})
+	if err != nil {
+		return nil, err
+	}
+	exp := e.(*ExpectedAllDBs)
+	return exp.result, exp.err
+}
+
+func (c *client) DBExists(_ context.Context, dbName string, _ map[string]interface{}) (bool, error) {
+	e, err := c.mock.match(fmt.Sprintf("DBExists(%q)", dbName), func(e expectation) bool {
+		exp, ok := e.(*ExpectedDBExists)
+		return ok && exp.dbName == dbName
+	})
+	if err != nil {
+		return false, err
+	}
+	exp := e.(*ExpectedDBExists)
+	return exp.exists, exp.err
+}
+
+func (c *client) CreateDB(_ context.Context, dbName string, _ map[string]interface{}) error {
+	e, err := c.mock.match(fmt.Sprintf("CreateDB(%q)", dbName), func(e expectation) bool {
+		exp, ok := e.(*ExpectedCreateDB)
+		return ok && exp.dbName == dbName
+	})
+	if err != nil {
+		return err
+	}
+	return e.(*ExpectedCreateDB).err
+}
+
+func (c *client) DestroyDB(_ context.Context, dbName string, _ map[string]interface{}) error {
+	e, err := c.mock.match(fmt.Sprintf("DestroyDB(%q)", dbName), func(e expectation) bool {
+		exp, ok := e.(*ExpectedDestroyDB)
+		return ok && exp.dbName == dbName
+	})
+	if err != nil {
+		return err
+	}
+	return e.(*ExpectedDestroyDB).err
+}
+
+// DB always succeeds, as obtaining a database handle is not an operation
+// which may be mocked.
+func (c *client) DB(_ context.Context, dbName string, _ map[string]interface{}) (driver.DB, error) {
+	return &db{mock: c.mock, dbName: dbName}, nil
+}
+
+type db struct {
+	mock   *Mock
+	dbName string
+}
+
+var _ driver.DB = &db{}
+
+func notSupported(method string) error {
+	return errors.Statusf(kivik.StatusNotImplemented, "kivikmock: %s is not supported", method)
+}
+
+func (d *db) Get(_ context.Context, docID string, _ map[string]interface{}) (json.RawMessage, error) {
+	e, err := d.mock.match(fmt.Sprintf("Get(%q, %q)", d.dbName, docID), func(e expectation) bool {
+		exp, ok := e.(*ExpectedGet)
+		return ok && exp.dbName == d.dbName && exp.docID == docID
+	})
+	if err != nil {
+		return nil, err
+	}
+	exp := e.(*ExpectedGet)
+	if exp.err != nil {
+		return nil, exp.err
+	}
+	return toJSON(exp.doc)
+}
+
+func (d *db) Put(_ context.Context, docID string, doc interface{}) (string, error) {
+	e, err := d.mock.match(fmt.Sprintf("Put(%q, %q)", d.dbName, docID), func(e expectation) bool {
+		exp, ok := e.(*ExpectedPut)
+		return ok && exp.dbName == d.dbName && exp.docID == docID &&
+			(!exp.hasDoc || jsonEqual(exp.doc, doc))
+	})
+	if err != nil {
+		return "", err
+	}
+	exp := e.(*ExpectedPut)
+	return exp.rev, exp.err
+}
+
+func (d *db) CreateDoc(_ context.Context, doc interface{}) (string, string, error) {
+	e, err := d.mock.match(fmt.Sprintf("CreateDoc(%q)", d.dbName), func(e expectation) bool {
+		exp, ok := e.(*ExpectedCreateDoc)
+		return ok && exp.dbName == d.dbName && (!exp.hasDoc || jsonEqual(exp.doc, doc))
+	})
+	if err != nil {
+		return "", "", err
+	}
+	exp := e.(*ExpectedCreateDoc)
+	return exp.docID, exp.rev, exp.err
+}
+
+func (d *db) Delete(_ context.Context, docID, rev string) (string, error) {
+	e, err := d.mock.match(fmt.Sprintf("Delete(%q, %q)", d.dbName, docID), func(e expectation) bool {
+		exp, ok := e.(*ExpectedDelete)
+		return ok && exp.dbName == d.dbName && exp.docID == docID &&
+			(exp.rev == "" || exp.rev == rev)
+	})
+	if err != nil {
+		return "", err
+	}
+	exp := e.(*ExpectedDelete)
+	return exp.newRev, exp.err
+}
+
+func (d *db) AllDocs(_ context.Context, _ map[string]interface{}) (driver.Rows, error) {
+	return nil, notSupported("AllDocs")
+}
+
+func (d *db) Query(_ context.Context, _, _ string, _ map[string]interface{}) (driver.Rows, error) {
+	return nil, notSupported("Query")
+}
+
+func (d *db) Stats(_ context.Context) (*driver.DBStats, error) {
+	return &driver.DBStats{}, notSupported("Stats")
+}
+
+func (d *db) Compact(_ context.Context) error {
+	return notSupported("Compact")
+}
+
+func (d *db) CompactView(_ context.Context, _ string) error {
+	return notSupported("CompactView")
+}
+
+func (d *db) ViewCleanup(_ context.Context) error {
+	return notSupported("ViewCleanup")
+}
+
+func (d *db) Security(_ context.Context) (*driver.Security, error) {
+	return nil, notSupported("Security")
+}
+
+func (d *db) SetSecurity(_ context.Context, _ *driver.Security) error {
+	return notSupported("SetSecurity")
+}
+
+func (d *db) Changes(_ context.Context, _ map[string]interface{}) (driver.Changes, error) {
+	return nil, notSupported("Changes")
+}
+
+func (d *db) BulkDocs(_ context.Context, _ []interface{}) (driver.BulkResults, error) {
+	return nil, notSupported("BulkDocs")
+}
+
+func (d *db) PutAttachment(_ context.Context, _, _, _, _ string, _ io.Reader) (string, error) {
+	return "", notSupported("PutAttachment")
+}
+
+func (d *db) GetAttachment(_ context.Context, _, _, _ string) (string, driver.MD5sum, io.ReadCloser, error) {
+	return "", driver.MD5sum{}, nil, notSupported("GetAttachment")
+}
+
+func (d *db) DeleteAttachment(_ context.Context, _, _, _ string) (string, error) {
+	return "", notSupported("DeleteAttachment")
+}
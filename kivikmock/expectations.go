@@ -0,0 +1,290 @@
+package kivikmock
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+)
+
+type expectation interface {
+	met() bool
+	fulfill()
+	String() string
+}
+
+type commonExpectation struct {
+	dbName    string
+	err       error
+	triggered bool
+}
+
+func (e *commonExpectation) met() bool { return e.triggered }
+func (e *commonExpectation) fulfill()  { e.triggered = true }
+
+// ExpectedAllDBs represents an expected call to AllDBs.
+type ExpectedAllDBs struct {
+	commonExpectation
+	result []string
+}
+
+// ExpectAllDBs registers an expected call to AllDBs.
+func (m *Mock) ExpectAllDBs() *ExpectedAllDBs {
+	e := &ExpectedAllDBs{}
+	m.expect(e)
+	return e
+}
+
+// WillReturn sets the databases to be returned.
+func (e *ExpectedAllDBs) WillReturn(dbNames []string) *ExpectedAllDBs {
+	e.result = dbNames
+	return e
+}
+
+// WillReturnError sets the error to be returned.
+func (e *ExpectedAllDBs) WillReturnError(err error) *ExpectedAllDBs {
+	e.err = err
+	return e
+}
+
+func (e *ExpectedAllDBs) String() string { return "AllDBs()" }
+
+// ExpectedDBExists represents an expected call to DBExists.
+type ExpectedDBExists struct {
+	commonExpectation
+	exists bool
+}
+
+// ExpectDBExists registers an expected call to DBExists.
+func (m *Mock) ExpectDBExists(dbName string) *ExpectedDBExists {
+	e := &ExpectedDBExists{commonExpectation: commonExpectation{dbName: dbName}}
+	m.expect(e)
+	return e
+}
+
+// WillReturn sets the result to be returned.
+func (e *ExpectedDBExists) WillReturn(exists bool) *ExpectedDBExists {
+	e.exists = exists
+	return e
+}
+
+// WillReturnError sets the error to be returned.
+func (e *ExpectedDBExists) WillReturnError(err error) *ExpectedDBExists {
+	e.err = err
+	return e
+}
+
+func (e *ExpectedDBExists) String() string { return fmt.Sprintf("DBExists(%q)", e.dbName) }
+
+// ExpectedCreateDB represents an expected call to CreateDB.
+type ExpectedCreateDB struct {
+	commonExpectation
+}
+
+// ExpectCreateDB registers an expected call to CreateDB.
+func (m *Mock) ExpectCreateDB(dbName string) *ExpectedCreateDB {
+	e := &ExpectedCreateDB{commonExpectation: commonExpectation{dbName: dbName}}
+	m.expect(e)
+	return e
+}
+
+// WillReturnError sets the error to be returned.
+func (e *ExpectedCreateDB) WillReturnError(err error) *ExpectedCreateDB {
+	e.err = err
+	return e
+}
+
+func (e *ExpectedCreateDB) String() string { return fmt.Sprintf("CreateDB(%q)", e.dbName) }
+
+// ExpectedDestroyDB represents an expected call to DestroyDB.
+type ExpectedDestroyDB struct {
+	commonExpectation
+}
+
+// ExpectDestroyDB registers an expected call to DestroyDB.
+func (m *Mock) ExpectDestroyDB(dbName string) *ExpectedDestroyDB {
+	e := &ExpectedDestroyDB{commonExpectation: commonExpectation{dbName: dbName}}
+	m.expect(e)
+	return e
+}
+
+// WillReturnError sets the error to be returned.
+func (e *ExpectedDestroyDB) WillReturnError(err error) *ExpectedDestroyDB {
+	e.err = err
+	return e
+}
+
+func (e *ExpectedDestroyDB) String() string { return fmt.Sprintf("DestroyDB(%q)", e.dbName) }
+
+// ExpectedGet represents an expected call to Get.
+type ExpectedGet struct {
+	commonExpectation
+	docID string
+	doc   interface{}
+}
+
+// ExpectGet registers an expected call to Get for the document docID in the
+// database dbName.
+func (m *Mock) ExpectGet(dbName, docID string) *ExpectedGet {
+	e := &ExpectedGet{commonExpectation: commonExpectation{dbName: dbName}, docID: docID}
+	m.expect(e)
+	return e
+}
+
+// WillReturn sets the document to be returned. doc may be any value which can
+// be marshaled to JSON, or a raw JSON string as a []byte or json.RawMessage.
+func (e *ExpectedGet) WillReturn(doc interface{}) *ExpectedGet {
+	e.doc = doc
+	return e
+}
+
+// WillReturnError sets the error to be returned.
+func (e *ExpectedGet) WillReturnError(err error) *ExpectedGet {
+	e.err = err
+	return e
+}
+
+func (e *ExpectedGet) String() string { return fmt.Sprintf("Get(%q, %q)", e.dbName, e.docID) }
+
+// ExpectedPut represents an expected call to Put.
+type ExpectedPut struct {
+	commonExpectation
+	docID  string
+	doc    interface{}
+	hasDoc bool
+	rev    string
+}
+
+// ExpectPut registers an expected call to Put for the document docID in the
+// database dbName.
+func (m *Mock) ExpectPut(dbName, docID string) *ExpectedPut {
+	e := &ExpectedPut{commonExpectation: commonExpectation{dbName: dbName}, docID: docID}
+	m.expect(e)
+	return e
+}
+
+// WithDoc restricts the expectation to calls with a document which is
+// equivalent to doc, when both are marshaled to JSON.
+func (e *ExpectedPut) WithDoc(doc interface{}) *ExpectedPut {
+	e.doc = doc
+	e.hasDoc = true
+	return e
+}
+
+// WillReturn sets the revision to be returned.
+func (e *ExpectedPut) WillReturn(rev string) *ExpectedPut {
+	e.rev = rev
+	return e
+}
+
+// WillReturnError sets the error to be returned.
+func (e *ExpectedPut) WillReturnError(err error) *ExpectedPut {
+	e.err = err
+	return e
+}
+
+func (e *ExpectedPut) String() string { return fmt.Sprintf("Put(%q, %q)", e.dbName, e.docID) }
+
+// ExpectedCreateDoc represents an expected call to CreateDoc.
+type ExpectedCreateDoc struct {
+	commonExpectation
+	doc    interface{}
+	hasDoc bool
+	docID  string
+	rev    string
+}
+
+// ExpectCreateDoc registers an expected call to CreateDoc in the database
+// dbName.
+func (m *Mock) ExpectCreateDoc(dbName string) *ExpectedCreateDoc {
+	e := &ExpectedCreateDoc{commonExpectation: commonExpectation{dbName: dbName}}
+	m.expect(e)
+	return e
+}
+
+// WithDoc restricts the expectation to calls with a document which is
+// equivalent to doc, when both are marshaled to JSON.
+func (e *ExpectedCreateDoc) WithDoc(doc interface{}) *ExpectedCreateDoc {
+	e.doc = doc
+	e.hasDoc = true
+	return e
+}
+
+// WillReturn sets the document ID and revision to be returned.
+func (e *ExpectedCreateDoc) WillReturn(docID, rev string) *ExpectedCreateDoc {
+	e.docID = docID
+	e.rev = rev
+	return e
+}
+
+// WillReturnError sets the error to be returned.
+func (e *ExpectedCreateDoc) WillReturnError(err error) *ExpectedCreateDoc {
+	e.err = err
+	return e
+}
+
+func (e *ExpectedCreateDoc) String() string { return fmt.Sprintf("CreateDoc(%q)", e.dbName) }
+
+// ExpectedDelete represents an expected call to Delete.
+type ExpectedDelete struct {
+	commonExpectation
+	docID  string
+	rev    string
+	newRev string
+}
+
+// ExpectDelete registers an expected call to Delete for the document docID in
+// the database dbName.
+func (m *Mock) ExpectDelete(dbName, docID string) *ExpectedDelete {
+	e := &ExpectedDelete{commonExpectation: commonExpectation{dbName: dbName}, docID: docID}
+	m.expect(e)
+	return e
+}
+
+// WithRev restricts the expectation to calls with the revision rev.
+func (e *ExpectedDelete) WithRev(rev string) *ExpectedDelete {
+	e.rev = rev
+	return e
+}
+
+// WillReturn sets the new revision to be returned.
+func (e *ExpectedDelete) WillReturn(newRev string) *ExpectedDelete {
+	e.newRev = newRev
+	return e
+}
+
+// WillReturnError sets the error to be returned.
+func (e *ExpectedDelete) WillReturnError(err error) *ExpectedDelete {
+	e.err = err
+	return e
+}
+
+func (e *ExpectedDelete) String() string { return fmt.Sprintf("Delete(%q, %q)", e.dbName, e.docID) }
+
+// toJSON marshals i to JSON, passing through raw JSON values unaltered.
+func toJSON(i interface{}) (json.RawMessage, error) {
+	switch t := i.(type) {
+	case []byte:
+		return t, nil
+	case json.RawMessage:
+		return t, nil
+	}
+	return json.Marshal(i)
+}
+
+// jsonEqual returns true if a and b are equivalent when marshaled to JSON.
+func jsonEqual(a, b interface{}) bool {
+	var aVal, bVal interface{}
+	for _, v := range []struct {
+		in  interface{}
+		out *interface{}
+	}{{a, &aVal}, {b, &bVal}} {
+		raw, err := toJSON(v.in)
+		if err != nil {
+			return false
+		}
+		if err := json.Unmarshal(raw, v.out); err != nil {
+			return false
+		}
+	}
+	return reflect.DeepEqual(aVal, bVal)
+}
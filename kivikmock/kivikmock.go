@@ -0,0 +1,116 @@
+// Package kivikmock provides a mock Kivik driver, for unit testing code which
+// uses Kivik, without the need for a live backend.
+//
+// Expectations are registered on a Mock, then the code under test is run
+// against the accompanying *kivik.Client. Each call to the client is matched
+// against the registered expectations, and the configured result returned:
+//
+//	client, mock, err := kivikmock.New()
+//	if err != nil {
+//		t.Fatal(err)
+//	}
+//	mock.ExpectGet("users", "bob").WillReturn(map[string]string{"name": "Bob"})
+//	mock.ExpectPut("users", "bob").WillReturnError(errors.Status(kivik.StatusConflict, "conflict"))
+//
+//	// Run the code under test with client
+//
+//	if err := mock.ExpectationsWereMet(); err != nil {
+//		t.Error(err)
+//	}
+//
+// By default, expectations must be met in the order in which they were
+// registered. See MatchExpectationsInOrder.
+package kivikmock
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+
+	"github.com/flimzy/kivik"
+	"github.com/flimzy/kivik/errors"
+)
+
+// DriverName is the name under which the mock driver is registered.
+const DriverName = "kivikmock"
+
+var drv = &mockDriver{mocks: make(map[string]*Mock)}
+
+func init() {
+	kivik.Register(DriverName, drv)
+}
+
+// Mock holds the expectations for a single mock client.
+type Mock struct {
+	mu       sync.Mutex
+	expected []expectation
+	ordered  bool
+}
+
+// New returns a new client connected to the mock driver, and the Mock used to
+// register expectations for it.
+func New() (*kivik.Client, *Mock, error) {
+	m := &Mock{ordered: true}
+	drv.mu.Lock()
+	drv.count++
+	dsn := fmt.Sprintf("kivikmock_%d", drv.count)
+	drv.mocks[dsn] = m
+	drv.mu.Unlock()
+	client, err := kivik.New(context.Background(), DriverName, dsn)
+	if err != nil {
+		return nil, nil, err
+	}
+	return client, m, nil
+}
+
+// MatchExpectationsInOrder sets whether expectations must be met in the order
+// in which they were registered. The default is true.
+func (m *Mock) MatchExpectationsInOrder(ordered bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.ordered = ordered
+}
+
+// ExpectationsWereMet returns an error if any registered expectation has not
+// been met.
+func (m *Mock) ExpectationsWereMet() error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var unmet []string
+	for _, e := range m.expected {
+		if !e.met() {
+			unmet = append(unmet, e.String())
+		}
+	}
+	if len(unmet) > 0 {
+		return errors.Errorf("there are unmet expectations:\n\t%s", strings.Join(unmet, "\n\t"))
+	}
+	return nil
+}
+
+func (m *Mock) expect(e expectation) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.expected = append(m.expected, e)
+}
+
+// match finds the expectation matching the call, and marks it as met. call is
+// the description of the call, used in error messages.
+func (m *Mock) match(call string, fn func(expectation) bool) (expectation, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, e := range m.expected {
+		if e.met() {
+			continue
+		}
+		if fn(e) {
+			e.fulfill()
+			return e, nil
+		}
+		if m.ordered {
+			return nil, errors.Errorf("kivikmock: call to %s was not expected, next expectation is %s", call, e)
+		}
+	}
+	return nil, errors.Errorf("kivikmock: call to %s was not expected", call)
+}
@@ -0,0 +1,164 @@
+package kivikmock
+
+import (
+	"context"
+	"testing"
+
+	"github.com/flimzy/diff"
+	"github.com/flimzy/kivik"
+	"github.com/flimzy/kivik/errors"
+)
+
+func TestGet(t *testing.T) {
+	client, mock, err := New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	mock.ExpectGet("foo", "bar").WillReturn(map[string]string{"_id": "bar", "_rev": "1-xxx"})
+	mock.ExpectGet("foo", "baz").WillReturnError(errors.Status(kivik.StatusNotFound, "missing"))
+	db, err := client.DB(context.Background(), "foo")
+	if err != nil {
+		t.Fatal(err)
+	}
+	row, err := db.Get(context.Background(), "bar")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var doc map[string]string
+	if err := row.ScanDoc(&doc); err != nil {
+		t.Fatal(err)
+	}
+	if d := diff.Interface(map[string]string{"_id": "bar", "_rev": "1-xxx"}, doc); d != "" {
+		t.Error(d)
+	}
+	if _, err := db.Get(context.Background(), "baz"); errors.StatusCode(err) != kivik.StatusNotFound {
+		t.Errorf("Expected Not Found, got %v", err)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestPut(t *testing.T) {
+	tests := []struct {
+		name   string
+		expect func(*Mock)
+		doc    interface{}
+		rev    string
+		err    string
+	}{
+		{
+			name: "Success",
+			expect: func(m *Mock) {
+				m.ExpectPut("foo", "bar").WillReturn("1-xxx")
+			},
+			doc: map[string]string{"a": "b"},
+			rev: "1-xxx",
+		},
+		{
+			name: "MatchingDoc",
+			expect: func(m *Mock) {
+				m.ExpectPut("foo", "bar").WithDoc([]byte(`{"a":"b"}`)).WillReturn("1-xxx")
+			},
+			doc: []byte(`{"a":"b"}`),
+			rev: "1-xxx",
+		},
+		{
+			name: "MismatchedDoc",
+			expect: func(m *Mock) {
+				m.ExpectPut("foo", "bar").WithDoc(map[string]string{"a": "c"})
+			},
+			doc: map[string]string{"a": "b"},
+			err: `kivikmock: call to Put("foo", "bar") was not expected, next expectation is Put("foo", "bar")`,
+		},
+		{
+			name: "Error",
+			expect: func(m *Mock) {
+				m.ExpectPut("foo", "bar").WillReturnError(errors.New("boom"))
+			},
+			doc: map[string]string{"a": "b"},
+			err: "boom",
+		},
+		{
+			name:   "Unexpected",
+			expect: func(_ *Mock) {},
+			doc:    map[string]string{"a": "b"},
+			err:    `kivikmock: call to Put("foo", "bar") was not expected`,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			client, mock, err := New()
+			if err != nil {
+				t.Fatal(err)
+			}
+			test.expect(mock)
+			db, _ := client.DB(context.Background(), "foo")
+			rev, err := db.Put(context.Background(), "bar", test.doc)
+			var msg string
+			if err != nil {
+				msg = err.Error()
+			}
+			if msg != test.err {
+				t.Errorf("Unexpected error: %s", msg)
+			}
+			if rev != test.rev {
+				t.Errorf("Unexpected rev: %s", rev)
+			}
+		})
+	}
+}
+
+func TestOrder(t *testing.T) {
+	t.Run("Ordered", func(t *testing.T) {
+		client, mock, _ := New()
+		mock.ExpectCreateDB("foo")
+		mock.ExpectDestroyDB("foo")
+		if err := client.DestroyDB(context.Background(), "foo"); err == nil {
+			t.Error("Expected out-of-order call to fail")
+		}
+	})
+	t.Run("Unordered", func(t *testing.T) {
+		client, mock, _ := New()
+		mock.MatchExpectationsInOrder(false)
+		mock.ExpectCreateDB("foo")
+		mock.ExpectDestroyDB("foo")
+		if err := client.DestroyDB(context.Background(), "foo"); err != nil {
+			t.Error(err)
+		}
+		if err := client.CreateDB(context.Background(), "foo"); err != nil {
+			t.Error(err)
+		}
+		if err := mock.ExpectationsWereMet(); err != nil {
+			t.Error(err)
+		}
+	})
+}
+
+func TestExpectationsWereMet(t *testing.T) {
+	client, mock, _ := New()
+	mock.ExpectAllDBs().WillReturn([]string{"foo"})
+	mock.ExpectDBExists("foo").WillReturn(true)
+	mock.ExpectDelete("foo", "bar").WithRev("1-xxx").WillReturn("2-xxx")
+	dbs, err := client.AllDBs(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if d := diff.Interface([]string{"foo"}, dbs); d != "" {
+		t.Error(d)
+	}
+	if exists, _ := client.DBExists(context.Background(), "foo"); !exists {
+		t.Error("Expected db to exist")
+	}
+	expected := "there are unmet expectations:\n\tDelete(\"foo\", \"bar\")"
+	if err := mock.ExpectationsWereMet(); err == nil || err.Error() != expected {
+		t.Errorf("Unexpected result: %v", err)
+	}
+}
+
+func TestUnknownDSN(t *testing.T) {
+	_, err := kivik.New(context.Background(), DriverName, "foo")
+	if errors.StatusCode(err) != kivik.StatusBadRequest {
+		t.Errorf("Expected Bad Request, got %v", err)
+	}
+}
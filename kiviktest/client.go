@@ -0,0 +1,30 @@
+package kiviktest
+
+import (
+	"context"
+	"testing"
+
+	"github.com/flimzy/kivik"
+	"github.com/flimzy/kivik/driver"
+)
+
+// NewClient returns a client of drv, connected to dsn, or fails t. As drv is
+// not registered, tests, such as those of wrapping drivers, may create as
+// many clients as required, and may be run repeatedly with go test -count.
+func NewClient(t *testing.T, drv driver.Driver, dsn string) *kivik.Client {
+	client, err := kivik.NewClientFromDriver(context.Background(), drv, dsn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return client
+}
+
+// NewDB returns the named database of a client of drv, connected to dsn, or
+// fails t.
+func NewDB(t *testing.T, drv driver.Driver, dsn, dbName string) *kivik.DB {
+	db, err := NewClient(t, drv, dsn).DB(context.Background(), dbName)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return db
+}
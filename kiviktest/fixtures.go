@@ -0,0 +1,205 @@
+// Package kiviktest provides utilities for testing applications which use
+// Kivik.
+package kiviktest
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"mime"
+	"net/http"
+	"os"
+	"path"
+	"sort"
+	"strings"
+	"text/template"
+
+	"github.com/flimzy/kivik"
+	"github.com/flimzy/kivik/errors"
+)
+
+// attachmentsSuffix is appended to a document's file name, without the .json
+// extension, to name the directory containing its attachments.
+const attachmentsSuffix = ".attachments"
+
+// Loader loads fixtures into a database.
+//
+// Fixtures are read from a file system, such as a directory, with http.Dir, or
+// a file system embedded in the test binary. Each file with the extension
+// .json contains a single document. The document's ID is its _id field, if
+// set, or otherwise the path of the file, without the extension, so that
+// _design/foo.json contains the design document _design/foo. Attachments are
+// read from the directory with the name of the document's file, without the
+// extension, plus ".attachments", so that the attachments for foo.json are in
+// foo.attachments/. Other files are ignored.
+//
+// Each document, and each file name, is executed as a text/template with
+// Data, allowing, for example, unique document IDs for each test run.
+type Loader struct {
+	// Data is passed to each template.
+	Data interface{}
+	// Funcs are added to the functions available to templates.
+	Funcs template.FuncMap
+}
+
+// LoadFixtures loads the fixtures in fs into db. See Loader for details.
+func LoadFixtures(ctx context.Context, db *kivik.DB, fs http.FileSystem) (*Fixtures, error) {
+	return (&Loader{}).Load(ctx, db, fs)
+}
+
+// Fixtures are the documents loaded by a Loader.
+type Fixtures struct {
+	db *kivik.DB
+	// IDs lists the IDs of the documents loaded, in the order in which they
+	// were loaded.
+	IDs []string
+}
+
+// Load loads the fixtures in fs into db. If an error occurs, the documents
+// loaded so far are returned, along with the error, so that they may be
+// cleaned up.
+func (l *Loader) Load(ctx context.Context, db *kivik.DB, fs http.FileSystem) (*Fixtures, error) {
+	fixtures := &Fixtures{db: db}
+	err := l.loadDir(ctx, fixtures, fs, "/")
+	return fixtures, err
+}
+
+func (l *Loader) loadDir(ctx context.Context, fixtures *Fixtures, fs http.FileSystem, dir string) error {
+	infos, err := readDir(fs, dir)
+	if err != nil {
+		return err
+	}
+	for _, info := range infos {
+		name := path.Join(dir, info.Name())
+		switch {
+		case info.IsDir() && strings.HasSuffix(name, attachmentsSuffix):
+			// Loaded with the document
+		case info.IsDir():
+			if err := l.loadDir(ctx, fixtures, fs, name); err != nil {
+				return err
+			}
+		case path.Ext(name) == ".json":
+			if err := l.loadDoc(ctx, fixtures, fs, name); err != nil {
+				return errors.Wrapf(err, "fixture %s", name)
+			}
+		}
+	}
+	return nil
+}
+
+func readDir(fs http.FileSystem, dir string) ([]os.FileInfo, error) {
+	f, err := fs.Open(dir)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = f.Close() }()
+	infos, err := f.Readdir(-1)
+	if err != nil {
+		return nil, err
+	}
+	sort.Sort(byName(infos))
+	return infos, nil
+}
+
+type byName []os.FileInfo
+
+func (n byName) Len() int           { return len(n) }
+func (n byName) Swap(i, j int)      { n[i], n[j] = n[j], n[i] }
+func (n byName) Less(i, j int) bool { return n[i].Name() < n[j].Name() }
+
+func (l *Loader) execute(name, text string) ([]byte, error) {
+	tmpl, err := template.New(name).Funcs(l.Funcs).Parse(text)
+	if err != nil {
+		return nil, err
+	}
+	buf := &bytes.Buffer{}
+	if err := tmpl.Execute(buf, l.Data); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func readFile(fs http.FileSystem, name string) ([]byte, error) {
+	f, err := fs.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = f.Close() }()
+	return ioutil.ReadAll(f)
+}
+
+func (l *Loader) loadDoc(ctx context.Context, fixtures *Fixtures, fs http.FileSystem, name string) error {
+	content, err := readFile(fs, name)
+	if err != nil {
+		return err
+	}
+	if content, err = l.execute(name, string(content)); err != nil {
+		return err
+	}
+	var doc map[string]interface{}
+	if err = json.Unmarshal(content, &doc); err != nil {
+		return errors.WrapStatus(kivik.StatusBadRequest, err)
+	}
+	base := strings.TrimSuffix(name, ".json")
+	docID, _ := doc["_id"].(string)
+	if docID == "" {
+		id, e := l.execute(name, strings.TrimPrefix(base, "/"))
+		if e != nil {
+			return e
+		}
+		docID = string(id)
+	}
+	rev, err := fixtures.db.Put(ctx, docID, doc)
+	if err != nil {
+		return err
+	}
+	fixtures.IDs = append(fixtures.IDs, docID)
+	return l.loadAttachments(ctx, fixtures, fs, base+attachmentsSuffix, docID, rev)
+}
+
+func (l *Loader) loadAttachments(ctx context.Context, fixtures *Fixtures, fs http.FileSystem, dir, docID, rev string) error {
+	infos, err := readDir(fs, dir)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	for _, info := range infos {
+		if info.IsDir() {
+			continue
+		}
+		content, err := readFile(fs, path.Join(dir, info.Name()))
+		if err != nil {
+			return err
+		}
+		contentType := mime.TypeByExtension(path.Ext(info.Name()))
+		if contentType == "" {
+			contentType = "application/octet-stream"
+		}
+		att := kivik.NewAttachment(info.Name(), contentType, ioutil.NopCloser(bytes.NewReader(content)))
+		if rev, err = fixtures.db.PutAttachment(ctx, docID, rev, att); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Cleanup deletes the documents loaded. Documents which no longer exist are
+// ignored.
+func (f *Fixtures) Cleanup(ctx context.Context) error {
+	for _, docID := range f.IDs {
+		rev, err := f.db.Rev(ctx, docID)
+		if kivik.StatusCode(err) == kivik.StatusNotFound {
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		if _, err = f.db.Delete(ctx, docID, rev); err != nil {
+			return err
+		}
+	}
+	return nil
+}
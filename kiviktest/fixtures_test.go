@@ -0,0 +1,116 @@
+package kiviktest
+
+import (
+	"context"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"testing"
+
+	"github.com/flimzy/diff"
+	"github.com/flimzy/kivik"
+	"github.com/flimzy/kivik/driver"
+	_ "github.com/flimzy/kivik/driver/memory"
+)
+
+// attDriver wraps the memory driver, recording attachments.
+type attDriver struct {
+	driver.Driver
+}
+
+func (d *attDriver) NewClient(ctx context.Context, dsn string) (driver.Client, error) {
+	c, err := d.Driver.NewClient(ctx, dsn)
+	return &attClient{Client: c}, err
+}
+
+type attClient struct {
+	driver.Client
+}
+
+func (c *attClient) DB(ctx context.Context, dbName string, opts map[string]interface{}) (driver.DB, error) {
+	db, err := c.Client.DB(ctx, dbName, opts)
+	return &attDB{DB: db}, err
+}
+
+type attDB struct {
+	driver.DB
+}
+
+// attachments records the attachments stored, as docID/filename: content.
+var attachments = map[string]string{}
+
+func (d *attDB) PutAttachment(ctx context.Context, docID, rev, filename, contentType string, body io.Reader) (string, error) {
+	content, err := ioutil.ReadAll(body)
+	if err != nil {
+		return "", err
+	}
+	attachments[docID+"/"+filename+" "+contentType] = string(content)
+	return rev, nil
+}
+
+func init() {
+	memDriver, _ := kivik.LookupDriver("memory")
+	kivik.Register("kiviktest-fixtures", &attDriver{Driver: memDriver})
+}
+
+func TestLoadFixtures(t *testing.T) {
+	ctx := context.Background()
+	client, err := kivik.New(ctx, "kiviktest-fixtures", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = client.CreateDB(ctx, "foo"); err != nil {
+		t.Fatal(err)
+	}
+	db, err := client.DB(ctx, "foo")
+	if err != nil {
+		t.Fatal(err)
+	}
+	loader := &Loader{Data: map[string]string{"Prefix": "test1-"}}
+	fixtures, err := loader.Load(ctx, db, http.Dir("testdata/fixtures"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	expectedIDs := []string{"_design/users", "alice", "test1-user:bob"}
+	if d := diff.TextSlices(expectedIDs, fixtures.IDs); d != "" {
+		t.Errorf("Unexpected IDs:\n%s", d)
+	}
+	row, err := db.Get(ctx, "test1-user:bob")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var doc struct {
+		Name string `json:"name"`
+	}
+	if err = row.ScanDoc(&doc); err != nil {
+		t.Fatal(err)
+	}
+	if doc.Name != "Bob" {
+		t.Errorf("Unexpected name: %s", doc.Name)
+	}
+	expectedAtts := map[string]string{
+		"test1-user:bob/hello.html text/html; charset=utf-8": "<p>Hello, world</p>\n",
+	}
+	if d := diff.Interface(expectedAtts, attachments); d != "" {
+		t.Error(d)
+	}
+
+	if err = fixtures.Cleanup(ctx); err != nil {
+		t.Fatal(err)
+	}
+	for _, docID := range expectedIDs {
+		if _, err := db.Get(ctx, docID); kivik.StatusCode(err) != kivik.StatusNotFound {
+			t.Errorf("Expected %s to be deleted: %v", docID, err)
+		}
+	}
+}
+
+func TestLoadFixturesInvalid(t *testing.T) {
+	ctx := context.Background()
+	client, _ := kivik.New(ctx, "memory", "")
+	_ = client.CreateDB(ctx, "foo")
+	db, _ := client.DB(ctx, "foo")
+	if _, err := LoadFixtures(ctx, db, http.Dir("testdata/nonexistent")); err == nil {
+		t.Error("Expected an error for a missing directory")
+	}
+}
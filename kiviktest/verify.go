@@ -0,0 +1,227 @@
+package kiviktest
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"testing"
+
+	"github.com/flimzy/kivik"
+	"github.com/flimzy/kivik/errors"
+	"github.com/flimzy/kivik/test"
+	"github.com/flimzy/kivik/test/kt"
+)
+
+// Feature names an optional area of functionality, exercised by one or more
+// tests of the conformance suite.
+type Feature string
+
+// The features which a driver may declare unsupported.
+const (
+	FeatureAllDocs            Feature = "all_docs"
+	FeatureAttachments        Feature = "attachments"
+	FeatureBulkDocs           Feature = "bulk_docs"
+	FeatureChanges            Feature = "changes"
+	FeatureContinuousChanges  Feature = "continuous_changes"
+	FeatureCompact            Feature = "compact"
+	FeatureCopy               Feature = "copy"
+	FeatureDBUpdates          Feature = "db_updates"
+	FeatureFlush              Feature = "flush"
+	FeatureMango              Feature = "mango"
+	FeatureReplication        Feature = "replication"
+	FeatureSecurity           Feature = "security"
+	FeatureSession            Feature = "session"
+	FeatureStats              Feature = "stats"
+	FeatureViews              Feature = "views"
+	FeatureConcurrentChanges  Feature = "concurrent_changes"
+	FeatureIteratorCancelling Feature = "iterator_cancelling"
+)
+
+// featureTests maps each feature to the tests which are skipped if it is
+// unsupported.
+var featureTests = map[Feature][]string{
+	FeatureAllDocs:            {"AllDocs", "IteratorCancel/RW/Admin/AllDocs"},
+	FeatureAttachments:        {"GetAttachment", "GetAttachmentMeta", "PutAttachment", "DeleteAttachment", "AttachmentRoundTrip"},
+	FeatureBulkDocs:           {"BulkDocs"},
+	FeatureChanges:            {"Changes", "ChangesFeed", "IteratorCancel/RW/Admin/Changes", "Concurrency/RW/Admin/ChangesConsumers"},
+	FeatureContinuousChanges:  {"ChangesFeed", "Concurrency/RW/Admin/ChangesConsumers"},
+	FeatureCompact:            {"Compact"},
+	FeatureCopy:               {"Copy"},
+	FeatureDBUpdates:          {"DBUpdates"},
+	FeatureFlush:              {"Flush"},
+	FeatureMango:              {"Find", "CreateIndex", "GetIndexes", "DeleteIndex", "Mango"},
+	FeatureReplication:        {"Replicate", "GetReplications"},
+	FeatureSecurity:           {"Security", "SetSecurity"},
+	FeatureSession:            {"Session"},
+	FeatureStats:              {"Stats"},
+	FeatureViews:              {"Query", "ViewCleanup"},
+	FeatureConcurrentChanges:  {"Concurrency/RW/Admin/ChangesConsumers"},
+	FeatureIteratorCancelling: {"IteratorCancel"},
+}
+
+// Manifest declares what a driver under verification supports, and how it
+// differs from the defaults the conformance suite expects. The zero value
+// declares a driver which supports everything, and creates no databases of
+// its own.
+type Manifest struct {
+	// DSN is passed to kivik.New.
+	DSN string `json:"dsn"`
+	// ReadOnly disables the tests which write to the driver.
+	ReadOnly bool `json:"read_only"`
+	// Unsupported lists the features whose tests are skipped.
+	Unsupported []Feature `json:"unsupported"`
+	// SystemDBs lists the databases which exist in a new client, such as
+	// _users.
+	SystemDBs []string `json:"system_dbs"`
+	// Config holds suite configuration entries, which override the defaults.
+	// See the test/kt package for their meaning.
+	Config map[string]interface{} `json:"config"`
+}
+
+// ManifestFile is the file from which Verify reads the manifest, relative to
+// the directory of the package under test.
+var ManifestFile = filepath.Join("testdata", "kiviktest.json")
+
+// ReadManifest reads a manifest from a JSON file.
+func ReadManifest(path string) (*Manifest, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	m := &Manifest{}
+	if err := json.Unmarshal(data, m); err != nil {
+		return nil, errors.Wrapf(err, "kiviktest: invalid manifest %s", path)
+	}
+	for _, feature := range m.Unsupported {
+		if _, ok := featureTests[feature]; !ok {
+			return nil, errors.Errorf("kiviktest: unknown feature %q in manifest %s", feature, path)
+		}
+	}
+	return m, nil
+}
+
+// Verify runs the conformance suite against the named driver, which must be
+// registered, as described by the manifest in ManifestFile, if it exists. This
+// allows out-of-tree drivers to certify their compatibility with a single
+// test:
+//
+//	func TestConformance(t *testing.T) {
+//		kiviktest.Verify(t, "mydriver")
+//	}
+func Verify(t *testing.T, driverName string) {
+	m, err := ReadManifest(ManifestFile)
+	if os.IsNotExist(errors.Cause(err)) {
+		m, err = &Manifest{}, nil
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	VerifyManifest(t, driverName, m)
+}
+
+// VerifyManifest runs the conformance suite against the named driver, as
+// described by m.
+func VerifyManifest(t *testing.T, driverName string, m *Manifest) {
+	client, err := kivik.New(context.Background(), driverName, m.DSN)
+	if err != nil {
+		t.Fatalf("Failed to connect to %s driver: %s", driverName, err)
+	}
+	clients := &kt.Context{
+		RW:    !m.ReadOnly,
+		Admin: client,
+	}
+	test.RunSuite(clients, "verify-"+driverName, m.suiteConfig(), t)
+}
+
+// suiteConfig returns the suite configuration for the manifest.
+func (m *Manifest) suiteConfig() kt.SuiteConfig {
+	systemDBs := append([]string{}, m.SystemDBs...)
+	sort.Strings(systemDBs)
+	conf := kt.SuiteConfig{
+		"AllDBs.expected": systemDBs,
+
+		"CreateDB/RW/NoAuth.status":         kivik.StatusUnauthorized,
+		"CreateDB/RW/Admin/Recreate.status": kivik.StatusPreconditionFailed,
+
+		"DBExists/Admin.databases":       []string{"chicken"},
+		"DBExists/Admin/chicken.exists":  false,
+		"DBExists/RW/group/Admin.exists": true,
+
+		"DestroyDB/RW/Admin/NonExistantDB.status": kivik.StatusNotFound,
+
+		"Version.version":        `.*`,
+		"Version.vendor":         `.*`,
+		"Version.vendor_version": `.*`,
+
+		"Get/RW/group/Admin/bogus.status": kivik.StatusNotFound,
+		"Rev/RW/group/Admin/bogus.status": kivik.StatusNotFound,
+
+		"Put/RW/Admin/group/LeadingUnderscoreInID.status": kivik.StatusBadRequest,
+		"Put/RW/Admin/group/Conflict.status":              kivik.StatusConflict,
+
+		"Delete/RW/Admin/group/MissingDoc.status":       kivik.StatusNotFound,
+		"Delete/RW/Admin/group/InvalidRevFormat.status": kivik.StatusBadRequest,
+		"Delete/RW/Admin/group/WrongRev.status":         kivik.StatusConflict,
+
+		"Security.databases":            []string{"chicken", "_duck"},
+		"Security/Admin/chicken.status": kivik.StatusNotFound,
+		"Security/Admin/_duck.status":   kivik.StatusNotFound,
+
+		"SetSecurity/RW/Admin/NotExists.status": kivik.StatusNotFound,
+	}
+	for _, feature := range m.Unsupported {
+		for _, name := range featureTests[feature] {
+			conf[name+".skip"] = true
+		}
+	}
+	if m.unsupported(FeatureContinuousChanges) {
+		conf["IteratorCancel/RW/Admin/Changes.feed"] = "normal"
+	}
+	for key, value := range m.Config {
+		conf[key] = configValue(value)
+	}
+	return conf
+}
+
+func (m *Manifest) unsupported(feature Feature) bool {
+	for _, f := range m.Unsupported {
+		if f == feature {
+			return true
+		}
+	}
+	return false
+}
+
+// configValue converts values decoded from JSON to the types expected by
+// kt.SuiteConfig: whole numbers to int, and arrays to []string or []int.
+func configValue(value interface{}) interface{} {
+	switch t := value.(type) {
+	case float64:
+		if t == float64(int(t)) {
+			return int(t)
+		}
+	case []interface{}:
+		strs := make([]string, 0, len(t))
+		ints := make([]int, 0, len(t))
+		for _, v := range t {
+			switch e := configValue(v).(type) {
+			case string:
+				strs = append(strs, e)
+			case int:
+				ints = append(ints, e)
+			default:
+				return value
+			}
+		}
+		switch {
+		case len(strs) == len(t):
+			return strs
+		case len(ints) == len(t):
+			return ints
+		}
+	}
+	return value
+}
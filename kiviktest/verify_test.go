@@ -0,0 +1,93 @@
+package kiviktest
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+
+	"github.com/flimzy/diff"
+)
+
+func TestVerify(t *testing.T) {
+	Verify(t, "memory")
+}
+
+func TestReadManifest(t *testing.T) {
+	tests := []struct {
+		name     string
+		manifest string
+		expected *Manifest
+		err      string
+	}{
+		{
+			name:     "invalid JSON",
+			manifest: `{"dsn":`,
+			err:      "kiviktest: invalid manifest",
+		},
+		{
+			name:     "unknown feature",
+			manifest: `{"unsupported":["teleportation"]}`,
+			err:      `kiviktest: unknown feature "teleportation"`,
+		},
+		{
+			name:     "valid",
+			manifest: `{"dsn":"foo","read_only":true,"unsupported":["views"],"config":{"AllDBs.expected":["_users"]}}`,
+			expected: &Manifest{
+				DSN:         "foo",
+				ReadOnly:    true,
+				Unsupported: []Feature{FeatureViews},
+				Config:      map[string]interface{}{"AllDBs.expected": []interface{}{"_users"}},
+			},
+		},
+	}
+	dir, err := ioutil.TempDir("", "kiviktest")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = os.RemoveAll(dir) }()
+	for i, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			path := filepath.Join(dir, strconv.Itoa(i)+".json")
+			if err := ioutil.WriteFile(path, []byte(test.manifest), 0644); err != nil {
+				t.Fatal(err)
+			}
+			m, err := ReadManifest(path)
+			var msg string
+			if err != nil {
+				msg = err.Error()
+			}
+			if len(msg) < len(test.err) || msg[:len(test.err)] != test.err {
+				t.Errorf("Unexpected error: %s", msg)
+			}
+			if d := diff.Interface(test.expected, m); d != "" {
+				t.Error(d)
+			}
+		})
+	}
+}
+
+func TestConfigValue(t *testing.T) {
+	tests := []struct {
+		name     string
+		value    interface{}
+		expected interface{}
+	}{
+		{name: "string", value: "foo", expected: "foo"},
+		{name: "bool", value: true, expected: true},
+		{name: "integer", value: float64(404), expected: 404},
+		{name: "float", value: 1.5, expected: 1.5},
+		{name: "strings", value: []interface{}{"a", "b"}, expected: []string{"a", "b"}},
+		{name: "ints", value: []interface{}{float64(1), float64(2)}, expected: []int{1, 2}},
+		{name: "mixed", value: []interface{}{"a", float64(2)}, expected: []interface{}{"a", float64(2)}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			result := configValue(test.value)
+			if d := diff.Interface(test.expected, result); d != "" {
+				t.Error(d)
+			}
+		})
+	}
+}
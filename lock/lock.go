@@ -0,0 +1,318 @@
+// Package lock provides lease-based locks, and leader election, for
+// coordinating workers which share a database, such as several instances of a
+// service consuming the same changes feed.
+//
+//	locker := lock.New(db, lock.Options{TTL: 15 * time.Second})
+//	err := locker.Elect(ctx, "indexer", func(ctx context.Context, token int64) error {
+//	    // This worker is the leader, until ctx is canceled.
+//	    return consume(ctx, token)
+//	})
+//
+// Each lock is a document, which is claimed with a rev-guarded Put, so that
+// only one of several workers racing for a lock succeeds. A lock is a lease,
+// which expires after TTL unless renewed, and is renewed automatically while
+// held, so that the lock is released if its holder crashes. Leases depend on
+// the clocks of the workers being roughly synchronized.
+//
+// Because a holder may stall, and lose its lease without noticing, each
+// acquisition of a lock is given a fencing token, which is greater than that
+// of any previous holder. Writes made on behalf of the holder may include the
+// token, so that the resources they update can reject writes with a stale
+// one.
+package lock
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/flimzy/kivik"
+	"github.com/flimzy/kivik/errors"
+)
+
+// Defaults for Options.
+const (
+	DefaultTTL    = 15 * time.Second
+	DefaultPrefix = "lock:"
+)
+
+// ErrLocked is returned by TryAcquire when the lock is held by another owner.
+var ErrLocked = errors.Status(kivik.StatusConflict, "lock: held by another owner")
+
+// ErrLost is returned by Renew and Release when the lease has been lost, so
+// that the lock may be held by another owner.
+var ErrLost = errors.Status(kivik.StatusConflict, "lock: lease lost")
+
+// Options configures a Locker.
+type Options struct {
+	// Owner identifies the holder of the locks. Defaults to a random ID, which
+	// is unique to the Locker.
+	Owner string
+	// TTL is the duration of a lease. Defaults to DefaultTTL.
+	TTL time.Duration
+	// RenewInterval is the interval at which held leases are renewed.
+	// Defaults to a third of TTL.
+	RenewInterval time.Duration
+	// RetryInterval is the interval at which Acquire and Elect retry a held
+	// lock. Defaults to RenewInterval.
+	RetryInterval time.Duration
+	// Prefix is prepended to the name of a lock, to form the ID of its
+	// document. Defaults to DefaultPrefix.
+	Prefix string
+}
+
+// Locker acquires locks stored in a database.
+type Locker struct {
+	db   *kivik.DB
+	opts Options
+	// now is replaced in tests.
+	now func() time.Time
+}
+
+// lockDoc is the stored lock document.
+type lockDoc struct {
+	Rev   string `json:"_rev,omitempty"`
+	Owner string `json:"owner"`
+	// Token is incremented by each acquisition.
+	Token   int64     `json:"token"`
+	Expires time.Time `json:"expires"`
+}
+
+// New returns a Locker for the locks stored in db.
+func New(db *kivik.DB, opts Options) *Locker {
+	if opts.Owner == "" {
+		opts.Owner, _ = kivik.RandomIDs().NewID()
+	}
+	if opts.TTL <= 0 {
+		opts.TTL = DefaultTTL
+	}
+	if opts.RenewInterval <= 0 {
+		opts.RenewInterval = opts.TTL / 3
+	}
+	if opts.RetryInterval <= 0 {
+		opts.RetryInterval = opts.RenewInterval
+	}
+	if opts.Prefix == "" {
+		opts.Prefix = DefaultPrefix
+	}
+	return &Locker{db: db, opts: opts, now: time.Now}
+}
+
+// Owner returns the owner ID of the locks acquired by l.
+func (l *Locker) Owner() string {
+	return l.opts.Owner
+}
+
+// TryAcquire acquires the named lock, if it is free, or its lease has
+// expired, and returns ErrLocked otherwise. The lease is renewed until the
+// lock is released, or lost.
+func (l *Locker) TryAcquire(ctx context.Context, name string) (*Lock, error) {
+	docID := l.opts.Prefix + name
+	var doc lockDoc
+	row, err := l.db.Get(ctx, docID)
+	switch {
+	case kivik.StatusCode(err) == kivik.StatusNotFound:
+	case err != nil:
+		return nil, err
+	default:
+		if err := row.ScanDoc(&doc); err != nil {
+			return nil, err
+		}
+	}
+	now := l.now()
+	if doc.Owner != "" && doc.Owner != l.opts.Owner && doc.Expires.After(now) {
+		return nil, ErrLocked
+	}
+	doc.Owner = l.opts.Owner
+	doc.Token++
+	doc.Expires = now.Add(l.opts.TTL).UTC()
+	rev, err := l.db.Put(ctx, docID, doc)
+	if kivik.StatusCode(err) == kivik.StatusConflict {
+		return nil, ErrLocked
+	}
+	if err != nil {
+		return nil, err
+	}
+	doc.Rev = rev
+	lk := &Lock{
+		locker: l,
+		name:   name,
+		docID:  docID,
+		doc:    doc,
+		lost:   make(chan struct{}),
+		stop:   make(chan struct{}),
+		done:   make(chan struct{}),
+	}
+	go lk.renewLoop()
+	return lk, nil
+}
+
+// Acquire waits until the named lock is acquired, or ctx is canceled.
+func (l *Locker) Acquire(ctx context.Context, name string) (*Lock, error) {
+	for {
+		lk, err := l.TryAcquire(ctx, name)
+		if err != ErrLocked {
+			return lk, err
+		}
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-time.After(l.opts.RetryInterval):
+		}
+	}
+}
+
+// Elect campaigns for leadership, as the holder of the named lock, and calls
+// lead each time it is elected, with a context which is canceled if the lease
+// is lost, and the fencing token of the lease. When lead returns, the lock is
+// released, and the campaign continues, until ctx is canceled. Elect returns
+// ctx.Err(), or the first error returned by lead or by the database.
+func (l *Locker) Elect(ctx context.Context, name string, lead func(ctx context.Context, token int64) error) error {
+	for {
+		lk, err := l.Acquire(ctx, name)
+		if err != nil {
+			return err
+		}
+		leaderCtx, cancel := context.WithCancel(ctx)
+		go func() {
+			select {
+			case <-lk.Lost():
+				cancel()
+			case <-leaderCtx.Done():
+			}
+		}()
+		err = lead(leaderCtx, lk.Token())
+		cancel()
+		if releaseErr := lk.Release(context.Background()); err == nil && releaseErr != ErrLost {
+			err = releaseErr
+		}
+		if err != nil {
+			return err
+		}
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+	}
+}
+
+// Lock is a held lock.
+type Lock struct {
+	locker *Locker
+	name   string
+	docID  string
+
+	mu  sync.Mutex
+	doc lockDoc
+
+	lostOnce sync.Once
+	lost     chan struct{}
+	stopOnce sync.Once
+	stop     chan struct{}
+	done     chan struct{}
+}
+
+// Name returns the name of the lock.
+func (lk *Lock) Name() string {
+	return lk.name
+}
+
+// Token returns the fencing token of the lease.
+func (lk *Lock) Token() int64 {
+	lk.mu.Lock()
+	defer lk.mu.Unlock()
+	return lk.doc.Token
+}
+
+// Expires returns the time at which the lease expires, unless renewed.
+func (lk *Lock) Expires() time.Time {
+	lk.mu.Lock()
+	defer lk.mu.Unlock()
+	return lk.doc.Expires
+}
+
+// Lost returns a channel which is closed if the lease is lost, because it
+// could not be renewed before it expired, or was taken by another owner, and
+// when the lock is released.
+func (lk *Lock) Lost() <-chan struct{} {
+	return lk.lost
+}
+
+func (lk *Lock) markLost() {
+	lk.lostOnce.Do(func() { close(lk.lost) })
+}
+
+// Renew extends the lease by TTL from now. It is called automatically every
+// RenewInterval, until the lock is released or lost.
+func (lk *Lock) Renew(ctx context.Context) error {
+	lk.mu.Lock()
+	defer lk.mu.Unlock()
+	select {
+	case <-lk.lost:
+		return ErrLost
+	default:
+	}
+	now := lk.locker.now()
+	if !lk.doc.Expires.After(now) {
+		lk.markLost()
+		return ErrLost
+	}
+	doc := lk.doc
+	doc.Expires = now.Add(lk.locker.opts.TTL).UTC()
+	return lk.put(ctx, doc)
+}
+
+// put writes doc, guarded by the revision of the lease, and records it.
+// lk.mu must be held.
+func (lk *Lock) put(ctx context.Context, doc lockDoc) error {
+	rev, err := lk.locker.db.Put(ctx, lk.docID, doc)
+	if kivik.StatusCode(err) == kivik.StatusConflict {
+		lk.markLost()
+		return ErrLost
+	}
+	if err != nil {
+		return err
+	}
+	doc.Rev = rev
+	lk.doc = doc
+	return nil
+}
+
+func (lk *Lock) renewLoop() {
+	defer close(lk.done)
+	ticker := time.NewTicker(lk.locker.opts.RenewInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-lk.stop:
+			return
+		case <-lk.lost:
+			return
+		case <-ticker.C:
+		}
+		// Other errors are retried at the next tick, until the lease
+		// expires.
+		_ = lk.Renew(context.Background())
+	}
+}
+
+// Release stops the renewal of the lease, and frees the lock. It returns
+// ErrLost if the lease had already been lost.
+func (lk *Lock) Release(ctx context.Context) error {
+	lk.stopOnce.Do(func() { close(lk.stop) })
+	<-lk.done
+	lk.mu.Lock()
+	defer lk.mu.Unlock()
+	select {
+	case <-lk.lost:
+		return ErrLost
+	default:
+	}
+	// The document is kept, with its token, so that the tokens of later
+	// holders remain greater.
+	doc := lk.doc
+	doc.Owner = ""
+	doc.Expires = time.Time{}
+	err := lk.put(ctx, doc)
+	lk.markLost()
+	return err
+}
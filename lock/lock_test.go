@@ -0,0 +1,181 @@
+package lock
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/flimzy/kivik"
+	_ "github.com/flimzy/kivik/driver/memory"
+)
+
+func newTestDB(t *testing.T) *kivik.DB {
+	client, err := kivik.New(context.Background(), "memory", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := client.CreateDB(context.Background(), "locks"); err != nil {
+		t.Fatal(err)
+	}
+	db, err := client.DB(context.Background(), "locks")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return db
+}
+
+// clock is a settable clock, shared by the lockers of a test.
+type clock struct {
+	mu  sync.Mutex
+	now time.Time
+}
+
+func (c *clock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.now
+}
+
+func (c *clock) Advance(d time.Duration) {
+	c.mu.Lock()
+	c.now = c.now.Add(d)
+	c.mu.Unlock()
+}
+
+func newTestLocker(db *kivik.DB, owner string, c *clock) *Locker {
+	// The renew interval is long enough that the lease is not renewed during
+	// the tests, unless done explicitly.
+	l := New(db, Options{Owner: owner, TTL: time.Minute, RenewInterval: time.Hour})
+	l.now = c.Now
+	return l
+}
+
+func TestLock(t *testing.T) {
+	ctx := context.Background()
+	db := newTestDB(t)
+	c := &clock{now: time.Date(2017, 1, 1, 0, 0, 0, 0, time.UTC)}
+	alice := newTestLocker(db, "alice", c)
+	bob := newTestLocker(db, "bob", c)
+
+	lk, err := alice.TryAcquire(ctx, "job")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if lk.Token() != 1 {
+		t.Errorf("Expected token 1, got %d", lk.Token())
+	}
+	if _, err := bob.TryAcquire(ctx, "job"); err != ErrLocked {
+		t.Errorf("Expected ErrLocked, got %v", err)
+	}
+	if _, err := bob.TryAcquire(ctx, "other"); err != nil {
+		t.Errorf("Expected an independent lock to be free, got %s", err)
+	}
+
+	c.Advance(30 * time.Second)
+	if err := lk.Renew(ctx); err != nil {
+		t.Fatal(err)
+	}
+	c.Advance(45 * time.Second)
+	if _, err := bob.TryAcquire(ctx, "job"); err != ErrLocked {
+		t.Errorf("Expected a renewed lease to be held, got %v", err)
+	}
+
+	// Once the lease expires, bob may take the lock, with a greater token,
+	// and alice's lease is lost.
+	c.Advance(time.Minute)
+	bobLock, err := bob.TryAcquire(ctx, "job")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bobLock.Token() != 2 {
+		t.Errorf("Expected token 2, got %d", bobLock.Token())
+	}
+	if err := lk.Renew(ctx); err != ErrLost {
+		t.Errorf("Expected ErrLost, got %v", err)
+	}
+	select {
+	case <-lk.Lost():
+	default:
+		t.Error("Expected the lost channel to be closed")
+	}
+	if err := lk.Release(ctx); err != ErrLost {
+		t.Errorf("Expected ErrLost releasing a lost lock, got %v", err)
+	}
+
+	if err := bobLock.Release(ctx); err != nil {
+		t.Fatal(err)
+	}
+	lk, err = alice.TryAcquire(ctx, "job")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if lk.Token() != 3 {
+		t.Errorf("Expected token 3, got %d", lk.Token())
+	}
+	_ = lk.Release(ctx)
+}
+
+func TestAutomaticRenewal(t *testing.T) {
+	ctx := context.Background()
+	db := newTestDB(t)
+	l := New(db, Options{TTL: time.Hour, RenewInterval: time.Millisecond})
+	lk, err := l.TryAcquire(ctx, "job")
+	if err != nil {
+		t.Fatal(err)
+	}
+	expires := lk.Expires()
+	deadline := time.Now().Add(5 * time.Second)
+	for !lk.Expires().After(expires) {
+		if time.Now().After(deadline) {
+			t.Fatal("Lease was not renewed")
+		}
+		time.Sleep(time.Millisecond)
+	}
+	if err := lk.Release(ctx); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestElect(t *testing.T) {
+	db := newTestDB(t)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	var mu sync.Mutex
+	var leaders int
+	var tokens []int64
+	var wg sync.WaitGroup
+	for i := 0; i < 3; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			l := New(db, Options{TTL: time.Second, RetryInterval: time.Millisecond})
+			_ = l.Elect(ctx, "leader", func(_ context.Context, token int64) error {
+				mu.Lock()
+				leaders++
+				if leaders > 1 {
+					t.Error("More than one leader")
+				}
+				tokens = append(tokens, token)
+				mu.Unlock()
+				time.Sleep(5 * time.Millisecond)
+				mu.Lock()
+				leaders--
+				mu.Unlock()
+				return nil
+			})
+		}()
+	}
+	time.Sleep(100 * time.Millisecond)
+	cancel()
+	wg.Wait()
+	if len(tokens) < 2 {
+		t.Fatalf("Expected leadership to pass between workers, got tokens %v", tokens)
+	}
+	for i := 1; i < len(tokens); i++ {
+		if tokens[i] <= tokens[i-1] {
+			t.Errorf("Expected increasing tokens, got %v", tokens)
+			break
+		}
+	}
+}
@@ -0,0 +1,263 @@
+// Package maintain compacts databases whose files have grown too large for
+// the data they hold, during configured maintenance windows.
+//
+//	night, _ := maintain.ParseWindow("01:00-05:00")
+//	m := maintain.New(client, maintain.Options{
+//		Threshold: 2,
+//		Windows:   []maintain.Window{night},
+//	})
+//	go m.Run(ctx)
+//
+// The size of each database is read with Stats. A database is compacted once
+// its disk size is Threshold times its active size, and then the views of
+// each of its design documents are compacted, and unused view indexes are
+// removed with ViewCleanup.
+package maintain
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/flimzy/kivik"
+	"github.com/flimzy/kivik/errors"
+)
+
+// DefaultThreshold is the ratio of disk size to active size at which a
+// database is compacted, if none is given in Options.
+const DefaultThreshold = 2
+
+// DefaultInterval is the interval at which Run checks databases, if none is
+// given in Options.
+const DefaultInterval = time.Hour
+
+// Window is a daily period, in local time, during which maintenance may run.
+// Start and End are offsets from midnight. If End is before Start, the window
+// spans midnight.
+type Window struct {
+	Start, End time.Duration
+}
+
+// ParseWindow parses a window of the form "HH:MM-HH:MM", such as
+// "22:30-04:00".
+func ParseWindow(s string) (Window, error) {
+	parts := strings.Split(s, "-")
+	if len(parts) != 2 {
+		return Window{}, errors.Statusf(kivik.StatusBadRequest, "maintain: invalid window %q", s)
+	}
+	var w Window
+	for i, dest := range []*time.Duration{&w.Start, &w.End} {
+		t, err := time.Parse("15:04", strings.TrimSpace(parts[i]))
+		if err != nil {
+			return Window{}, errors.WrapStatus(kivik.StatusBadRequest, err)
+		}
+		*dest = time.Duration(t.Hour())*time.Hour + time.Duration(t.Minute())*time.Minute
+	}
+	return w, nil
+}
+
+// Contains returns true if t falls within the window.
+func (w Window) Contains(t time.Time) bool {
+	midnight := time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, t.Location())
+	offset := t.Sub(midnight)
+	if w.End < w.Start {
+		return offset >= w.Start || offset < w.End
+	}
+	return offset >= w.Start && offset < w.End
+}
+
+func (w Window) String() string {
+	return fmt.Sprintf("%02d:%02d-%02d:%02d",
+		int(w.Start/time.Hour), int(w.Start%time.Hour/time.Minute),
+		int(w.End/time.Hour), int(w.End%time.Hour/time.Minute))
+}
+
+// Options configures a Maintainer.
+type Options struct {
+	// DBs are the names of the databases to maintain. The default is all
+	// databases.
+	DBs []string
+	// Threshold is the ratio of disk size to active size at which a
+	// database is compacted. The default is DefaultThreshold.
+	Threshold float64
+	// MinDiskSize is the disk size, in bytes, below which a database is
+	// never compacted.
+	MinDiskSize int64
+	// Windows are the periods during which Run maintains databases. The
+	// default is at any time.
+	Windows []Window
+	// Interval is the interval at which Run checks databases. The default
+	// is DefaultInterval.
+	Interval time.Duration
+	// DryRun, if true, causes the databases which need compaction to be
+	// reported, but not compacted.
+	DryRun bool
+	// OnError, if set, is called with any error returned by Maintain, when
+	// called by Run.
+	OnError func(error)
+	// OnCompact, if set, is called with each database compacted, when
+	// called by Run.
+	OnCompact func(Action)
+}
+
+// Action describes a database which was compacted.
+type Action struct {
+	DB         string
+	DiskSize   int64
+	ActiveSize int64
+	// Views are the design documents whose views were compacted.
+	Views []string
+}
+
+// Ratio returns the ratio of disk size to active size before compaction.
+func (a Action) Ratio() float64 {
+	if a.ActiveSize == 0 {
+		return 0
+	}
+	return float64(a.DiskSize) / float64(a.ActiveSize)
+}
+
+// Maintainer compacts the databases of a client.
+type Maintainer struct {
+	client *kivik.Client
+	opts   Options
+}
+
+// New returns a Maintainer for client.
+func New(client *kivik.Client, opts Options) *Maintainer {
+	if opts.Threshold <= 0 {
+		opts.Threshold = DefaultThreshold
+	}
+	if opts.Interval <= 0 {
+		opts.Interval = DefaultInterval
+	}
+	return &Maintainer{client: client, opts: opts}
+}
+
+// InWindow returns true if t falls within one of the maintenance windows, or
+// if none are configured.
+func (m *Maintainer) InWindow(t time.Time) bool {
+	if len(m.opts.Windows) == 0 {
+		return true
+	}
+	for _, w := range m.opts.Windows {
+		if w.Contains(t) {
+			return true
+		}
+	}
+	return false
+}
+
+// Run calls Maintain every Interval, starting immediately, while within a
+// maintenance window, until ctx is canceled, and then returns ctx.Err().
+func (m *Maintainer) Run(ctx context.Context) error {
+	ticker := time.NewTicker(m.opts.Interval)
+	defer ticker.Stop()
+	for {
+		if m.InWindow(time.Now()) {
+			actions, err := m.Maintain(ctx)
+			if err != nil && m.opts.OnError != nil && ctx.Err() == nil {
+				m.opts.OnError(err)
+			}
+			if m.opts.OnCompact != nil {
+				for _, action := range actions {
+					m.opts.OnCompact(action)
+				}
+			}
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		}
+	}
+}
+
+// Maintain compacts each database which needs it, regardless of the
+// maintenance windows, and returns those compacted. A database already being
+// compacted is skipped. An error maintaining one database does not prevent
+// the others being maintained; the first error is returned.
+func (m *Maintainer) Maintain(ctx context.Context) ([]Action, error) {
+	dbNames := m.opts.DBs
+	if len(dbNames) == 0 {
+		var err error
+		if dbNames, err = m.client.AllDBs(ctx); err != nil {
+			return nil, err
+		}
+	}
+	var actions []Action
+	var firstErr error
+	for _, dbName := range dbNames {
+		action, err := m.maintain(ctx, dbName)
+		if err != nil {
+			if firstErr == nil {
+				firstErr = errors.WrapStatus(kivik.StatusCode(err), errors.Wrapf(err, "maintain: %s", dbName))
+			}
+			continue
+		}
+		if action != nil {
+			actions = append(actions, *action)
+		}
+	}
+	return actions, firstErr
+}
+
+// maintain compacts dbName, if it needs it, and returns the action taken, or
+// nil.
+func (m *Maintainer) maintain(ctx context.Context, dbName string) (*Action, error) {
+	db, err := m.client.DB(ctx, dbName)
+	if err != nil {
+		return nil, err
+	}
+	stats, err := db.Stats(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if stats.CompactRunning || stats.DiskSize < m.opts.MinDiskSize || stats.DiskSize == 0 {
+		return nil, nil
+	}
+	if stats.ActiveSize > 0 && float64(stats.DiskSize)/float64(stats.ActiveSize) < m.opts.Threshold {
+		return nil, nil
+	}
+	action := &Action{DB: dbName, DiskSize: stats.DiskSize, ActiveSize: stats.ActiveSize}
+	if action.Views, err = designDocs(ctx, db); err != nil {
+		return nil, err
+	}
+	if m.opts.DryRun {
+		return action, nil
+	}
+	if err := db.Compact(ctx); err != nil {
+		return nil, err
+	}
+	for _, ddoc := range action.Views {
+		if err := db.CompactView(ctx, ddoc); err != nil {
+			return nil, err
+		}
+	}
+	if err := db.ViewCleanup(ctx); err != nil {
+		return nil, err
+	}
+	return action, nil
+}
+
+// designDocs returns the names of the design documents of db, without the
+// _design/ prefix, or none if the driver cannot list them.
+func designDocs(ctx context.Context, db *kivik.DB) ([]string, error) {
+	rows, err := db.AllDocs(ctx, kivik.Options{
+		"startkey": "_design/",
+		"endkey":   "_design0",
+	})
+	if kivik.StatusCode(err) == kivik.StatusNotImplemented {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = rows.Close() }()
+	var ddocs []string
+	for rows.Next() {
+		ddocs = append(ddocs, strings.TrimPrefix(rows.ID(), "_design/"))
+	}
+	return ddocs, rows.Err()
+}
@@ -0,0 +1,180 @@
+package maintain
+
+import (
+	"context"
+	"io"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/flimzy/diff"
+	"github.com/flimzy/kivik"
+	"github.com/flimzy/kivik/driver"
+	"github.com/flimzy/kivik/kiviktest"
+)
+
+type fakeDriver struct {
+	dbs map[string]*fakeDB
+}
+
+func (d *fakeDriver) NewClient(_ context.Context, _ string) (driver.Client, error) {
+	return &fakeClient{dbs: d.dbs}, nil
+}
+
+type fakeClient struct {
+	driver.Client
+	dbs map[string]*fakeDB
+}
+
+func (c *fakeClient) AllDBs(_ context.Context, _ map[string]interface{}) ([]string, error) {
+	names := make([]string, 0, len(c.dbs))
+	for name := range c.dbs {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names, nil
+}
+
+func (c *fakeClient) DB(_ context.Context, dbName string, _ map[string]interface{}) (driver.DB, error) {
+	return c.dbs[dbName], nil
+}
+
+// fakeDB reports fixed stats, lists its design documents, and records the
+// maintenance calls it receives.
+type fakeDB struct {
+	driver.DB
+	stats driver.DBStats
+	ddocs []string
+	calls []string
+}
+
+func (d *fakeDB) Stats(_ context.Context) (*driver.DBStats, error) {
+	stats := d.stats
+	return &stats, nil
+}
+
+func (d *fakeDB) AllDocs(_ context.Context, _ map[string]interface{}) (driver.Rows, error) {
+	rows := &fakeRows{}
+	for _, ddoc := range d.ddocs {
+		rows.rows = append(rows.rows, &driver.Row{ID: "_design/" + ddoc})
+	}
+	return rows, nil
+}
+
+func (d *fakeDB) Compact(_ context.Context) error {
+	d.calls = append(d.calls, "Compact")
+	return nil
+}
+
+func (d *fakeDB) CompactView(_ context.Context, ddocID string) error {
+	d.calls = append(d.calls, "CompactView "+ddocID)
+	return nil
+}
+
+func (d *fakeDB) ViewCleanup(_ context.Context) error {
+	d.calls = append(d.calls, "ViewCleanup")
+	return nil
+}
+
+type fakeRows struct {
+	driver.Rows
+	rows []*driver.Row
+}
+
+func (r *fakeRows) Next(row *driver.Row) error {
+	if len(r.rows) == 0 {
+		return io.EOF
+	}
+	*row, r.rows = *r.rows[0], r.rows[1:]
+	return nil
+}
+
+func (r *fakeRows) Close() error { return nil }
+
+func TestWindow(t *testing.T) {
+	day := time.Date(2017, 6, 1, 0, 0, 0, 0, time.Local)
+	tests := []struct {
+		window   string
+		at       time.Duration
+		expected bool
+	}{
+		{window: "01:00-05:00", at: 3 * time.Hour, expected: true},
+		{window: "01:00-05:00", at: 5 * time.Hour},
+		{window: "01:00-05:00", at: 30 * time.Minute},
+		{window: "22:30-04:00", at: 23 * time.Hour, expected: true},
+		{window: "22:30-04:00", at: time.Hour, expected: true},
+		{window: "22:30-04:00", at: 12 * time.Hour},
+	}
+	for _, test := range tests {
+		w, err := ParseWindow(test.window)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if w.String() != test.window {
+			t.Errorf("Expected %s to format as itself, got %s", test.window, w)
+		}
+		if result := w.Contains(day.Add(test.at)); result != test.expected {
+			t.Errorf("%s at %s: expected %t, got %t", test.window, test.at, test.expected, result)
+		}
+	}
+	for _, invalid := range []string{"", "01:00", "1am-2am"} {
+		if _, err := ParseWindow(invalid); kivik.StatusCode(err) != kivik.StatusBadRequest {
+			t.Errorf("Expected %q to be invalid, got %v", invalid, err)
+		}
+	}
+}
+
+func TestMaintain(t *testing.T) {
+	newDBs := func() map[string]*fakeDB {
+		return map[string]*fakeDB{
+			"bloated": {stats: driver.DBStats{DiskSize: 3000, ActiveSize: 1000}, ddocs: []string{"a", "b"}},
+			"compact": {stats: driver.DBStats{DiskSize: 1200, ActiveSize: 1000}},
+			"running": {stats: driver.DBStats{DiskSize: 3000, ActiveSize: 1000, CompactRunning: true}},
+			"tiny":    {stats: driver.DBStats{DiskSize: 30, ActiveSize: 10}},
+		}
+	}
+	tests := []struct {
+		name     string
+		opts     Options
+		expected []Action
+		calls    []string
+	}{
+		{
+			name:     "Default",
+			expected: []Action{{DB: "bloated", DiskSize: 3000, ActiveSize: 1000, Views: []string{"a", "b"}}, {DB: "tiny", DiskSize: 30, ActiveSize: 10}},
+			calls:    []string{"Compact", "CompactView a", "CompactView b", "ViewCleanup"},
+		},
+		{
+			name:     "MinDiskSize",
+			opts:     Options{MinDiskSize: 100},
+			expected: []Action{{DB: "bloated", DiskSize: 3000, ActiveSize: 1000, Views: []string{"a", "b"}}},
+			calls:    []string{"Compact", "CompactView a", "CompactView b", "ViewCleanup"},
+		},
+		{
+			name:     "Threshold",
+			opts:     Options{Threshold: 1.1, DBs: []string{"compact"}},
+			expected: []Action{{DB: "compact", DiskSize: 1200, ActiveSize: 1000}},
+		},
+		{
+			name:     "DryRun",
+			opts:     Options{DryRun: true, DBs: []string{"bloated"}},
+			expected: []Action{{DB: "bloated", DiskSize: 3000, ActiveSize: 1000, Views: []string{"a", "b"}}},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			dbs := newDBs()
+			client := kiviktest.NewClient(t, &fakeDriver{dbs: dbs}, "")
+			actions, err := New(client, test.opts).Maintain(context.Background())
+			if err != nil {
+				t.Fatal(err)
+			}
+			if d := diff.Interface(test.expected, actions); d != "" {
+				t.Error(d)
+			}
+			if d := diff.Interface(test.calls, dbs["bloated"].calls); d != "" {
+				t.Errorf("Unexpected calls:\n%s", d)
+			}
+		})
+	}
+}
@@ -0,0 +1,202 @@
+package mango
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"sort"
+	"strings"
+
+	"github.com/flimzy/kivik"
+	"github.com/flimzy/kivik/errors"
+)
+
+// QueryUsage reports the index chosen by the server for one query.
+type QueryUsage struct {
+	// Query is the query, as given to Advise.
+	Query interface{} `json:"query"`
+	// DesignDoc, Index and Type identify the index chosen.
+	DesignDoc string `json:"ddoc,omitempty"`
+	Index     string `json:"index"`
+	Type      string `json:"type"`
+	// FullScan is true if no index matched the query, so that every document
+	// of the database would be read.
+	FullScan bool `json:"full_scan"`
+}
+
+// Suggestion is an index which would serve queries which otherwise require a
+// full scan.
+type Suggestion struct {
+	// Fields are the fields to index, in order, suitable for the "fields" of
+	// an index passed to kivik.DB.CreateIndex.
+	Fields []string `json:"fields"`
+	// Queries are the positions, from 0, of the queries which would use it.
+	Queries []int `json:"queries"`
+}
+
+// Report is the result of Advise.
+type Report struct {
+	Queries []QueryUsage `json:"queries"`
+	// Unused lists the indexes of the database not chosen for any query,
+	// other than the special _all_docs index.
+	Unused []kivik.Index `json:"unused"`
+	// Suggestions lists the indexes which would serve the queries which
+	// require a full scan.
+	Suggestions []Suggestion `json:"suggestions"`
+}
+
+// OK returns true if every query uses an index, and every index is used, as
+// may be required by a CI check.
+func (r *Report) OK() bool {
+	return len(r.Unused) == 0 && len(r.Suggestions) == 0
+}
+
+// Advise asks the server to explain each of queries, which are as for
+// kivik.DB.Find, and cross-references the plans with the indexes of db, to
+// report the indexes which are unused, and suggest those which are missing.
+// The queries are typically a record of those made by an application, and
+// may be read with ReadQueries.
+func Advise(ctx context.Context, db *kivik.DB, queries []interface{}) (*Report, error) {
+	indexes, err := db.GetIndexes(ctx)
+	if err != nil {
+		return nil, err
+	}
+	report := &Report{
+		Queries:     make([]QueryUsage, len(queries)),
+		Unused:      []kivik.Index{},
+		Suggestions: []Suggestion{},
+	}
+	used := make(map[string]bool)
+	suggested := make(map[string]int)
+	for i, query := range queries {
+		plan, err := db.Explain(ctx, query)
+		if err != nil {
+			return nil, errors.Wrapf(err, "mango: explain query %d", i)
+		}
+		usage := QueryUsage{Query: query}
+		usage.DesignDoc, _ = plan.Index["ddoc"].(string)
+		usage.Index, _ = plan.Index["name"].(string)
+		usage.Type, _ = plan.Index["type"].(string)
+		usage.FullScan = usage.Type == "special"
+		report.Queries[i] = usage
+		used[indexKey(usage.DesignDoc, usage.Index)] = true
+		if !usage.FullScan {
+			continue
+		}
+		fields := suggestFields(plan)
+		if len(fields) == 0 {
+			continue
+		}
+		key := strings.Join(fields, "\x00")
+		if j, ok := suggested[key]; ok {
+			report.Suggestions[j].Queries = append(report.Suggestions[j].Queries, i)
+			continue
+		}
+		suggested[key] = len(report.Suggestions)
+		report.Suggestions = append(report.Suggestions, Suggestion{Fields: fields, Queries: []int{i}})
+	}
+	for _, index := range indexes {
+		if index.Type != "special" && !used[indexKey(index.DesignDoc, index.Name)] {
+			report.Unused = append(report.Unused, index)
+		}
+	}
+	return report, nil
+}
+
+func indexKey(ddoc, name string) string {
+	return strings.TrimPrefix(ddoc, "_design/") + "/" + name
+}
+
+// suggestFields returns the fields of an index for the query of plan: the sort
+// fields, which must come first, followed by the other fields of the selector,
+// in alphabetical order.
+func suggestFields(plan *kivik.QueryPlan) []string {
+	var fields []string
+	seen := make(map[string]bool)
+	add := func(field string) {
+		if !seen[field] {
+			seen[field] = true
+			fields = append(fields, field)
+		}
+	}
+	if sortSpec, ok := plan.Options["sort"].([]interface{}); ok {
+		for _, s := range sortSpec {
+			switch t := s.(type) {
+			case string:
+				add(t)
+			case map[string]interface{}:
+				for field := range t {
+					add(field)
+				}
+			}
+		}
+	}
+	selected := selectorFields("", plan.Selector)
+	sort.Strings(selected)
+	for _, field := range selected {
+		add(field)
+	}
+	return fields
+}
+
+// selectorFields returns the fields compared by selector, descending into
+// $and. Fields under other combination operators, such as $or, cannot be
+// served by a single index, and are omitted.
+func selectorFields(prefix string, selector map[string]interface{}) []string {
+	var fields []string
+	for key, value := range selector {
+		if key == "$and" {
+			conds, _ := value.([]interface{})
+			for _, cond := range conds {
+				if c, ok := cond.(map[string]interface{}); ok {
+					fields = append(fields, selectorFields(prefix, c)...)
+				}
+			}
+			continue
+		}
+		if strings.HasPrefix(key, "$") {
+			continue
+		}
+		field := prefix + key
+		if sub, ok := value.(map[string]interface{}); ok && !isOperators(sub) {
+			fields = append(fields, selectorFields(field+".", sub)...)
+			continue
+		}
+		fields = append(fields, field)
+	}
+	return fields
+}
+
+// isOperators returns true if every key of m is an operator, such as $gt.
+func isOperators(m map[string]interface{}) bool {
+	for key := range m {
+		if !strings.HasPrefix(key, "$") {
+			return false
+		}
+	}
+	return len(m) > 0
+}
+
+// ReadQueries reads queries from r, as line-delimited JSON, with one query
+// per line, such as may be logged by an application. Blank lines are ignored.
+func ReadQueries(r io.Reader) ([]interface{}, error) {
+	var queries []interface{}
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(nil, 1024*1024)
+	var line int
+	for scanner.Scan() {
+		line++
+		data := bytes.TrimSpace(scanner.Bytes())
+		if len(data) == 0 {
+			continue
+		}
+		var query map[string]interface{}
+		if err := json.Unmarshal(data, &query); err != nil {
+			return nil, errors.WrapStatus(kivik.StatusBadRequest, errors.Wrapf(err, "mango: line %d", line))
+		}
+		queries = append(queries, query)
+	}
+	return queries, scanner.Err()
+}
@@ -0,0 +1,136 @@
+package mango
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/flimzy/diff"
+	"github.com/flimzy/kivik"
+	"github.com/flimzy/kivik/driver"
+	"github.com/flimzy/kivik/kiviktest"
+)
+
+// explainDriver provides databases with indexes, and a query planner which
+// chooses the first index whose first field is in the selector. Other methods
+// are not implemented.
+type explainDriver struct {
+	indexes []driver.Index
+}
+
+func (d *explainDriver) NewClient(_ context.Context, _ string) (driver.Client, error) {
+	return &explainClient{indexes: d.indexes}, nil
+}
+
+type explainClient struct {
+	driver.Client
+	indexes []driver.Index
+}
+
+func (c *explainClient) DB(_ context.Context, _ string, _ map[string]interface{}) (driver.DB, error) {
+	return &explainDB{indexes: c.indexes}, nil
+}
+
+type explainDB struct {
+	driver.DB
+	indexes []driver.Index
+}
+
+var _ driver.Finder = &explainDB{}
+var _ driver.Explainer = &explainDB{}
+
+func (d *explainDB) Find(_ context.Context, _ interface{}) (driver.Rows, error) {
+	return nil, nil
+}
+
+func (d *explainDB) CreateIndex(_ context.Context, _, _ string, _ interface{}) error {
+	return nil
+}
+
+func (d *explainDB) GetIndexes(_ context.Context) ([]driver.Index, error) {
+	return d.indexes, nil
+}
+
+func (d *explainDB) DeleteIndex(_ context.Context, _, _ string) error {
+	return nil
+}
+
+func (d *explainDB) Explain(_ context.Context, query interface{}) (*driver.QueryPlan, error) {
+	q := query.(map[string]interface{})
+	selector, _ := q["selector"].(map[string]interface{})
+	plan := &driver.QueryPlan{
+		Index:    map[string]interface{}{"ddoc": nil, "name": "_all_docs", "type": "special"},
+		Selector: selector,
+		Options:  map[string]interface{}{"sort": q["sort"]},
+	}
+	for _, index := range d.indexes {
+		def, _ := index.Definition.(map[string]interface{})
+		fields, _ := def["fields"].([]interface{})
+		if len(fields) == 0 {
+			continue
+		}
+		field, _ := fields[0].(string)
+		if _, ok := selector[field]; ok {
+			plan.Index = map[string]interface{}{"ddoc": index.DesignDoc, "name": index.Name, "type": index.Type}
+			break
+		}
+	}
+	return plan, nil
+}
+
+func TestAdvise(t *testing.T) {
+	indexes := []driver.Index{
+		{Name: "_all_docs", Type: "special", Definition: map[string]interface{}{"fields": []interface{}{map[string]interface{}{"_id": "asc"}}}},
+		{DesignDoc: "_design/a", Name: "by-type", Type: "json", Definition: map[string]interface{}{"fields": []interface{}{"type"}}},
+		{DesignDoc: "_design/b", Name: "by-age", Type: "json", Definition: map[string]interface{}{"fields": []interface{}{"age"}}},
+	}
+	db := kiviktest.NewDB(t, &explainDriver{indexes: indexes}, "", "foo")
+	queries, err := ReadQueries(strings.NewReader(`{"selector":{"type":"user"}}
+
+{"selector":{"$and":[{"name":{"$eq":"bob"}},{"address":{"city":"Paris"}}]},"sort":[{"name":"asc"}]}
+{"selector":{"name":"alice","address.city":{"$gt":"A"}},"sort":["name"]}
+{"selector":{"$or":[{"a":1},{"b":2}]}}
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	report, err := Advise(context.Background(), db, queries)
+	if err != nil {
+		t.Fatal(err)
+	}
+	usage := make([]string, len(report.Queries))
+	for i, q := range report.Queries {
+		usage[i] = q.DesignDoc + " " + q.Index
+		if q.FullScan {
+			usage[i] += " (full scan)"
+		}
+	}
+	expectedUsage := []string{
+		"_design/a by-type",
+		" _all_docs (full scan)",
+		" _all_docs (full scan)",
+		" _all_docs (full scan)",
+	}
+	if d := diff.Interface(expectedUsage, usage); d != "" {
+		t.Errorf("Unexpected usage:\n%s", d)
+	}
+	if d := diff.Interface([]kivik.Index{kivik.Index(indexes[2])}, report.Unused); d != "" {
+		t.Errorf("Unexpected unused indexes:\n%s", d)
+	}
+	expectedSuggestions := []Suggestion{
+		{Fields: []string{"name", "address.city"}, Queries: []int{1, 2}},
+	}
+	if d := diff.Interface(expectedSuggestions, report.Suggestions); d != "" {
+		t.Errorf("Unexpected suggestions:\n%s", d)
+	}
+	if report.OK() {
+		t.Error("Expected report not to be OK")
+	}
+}
+
+func TestReadQueriesInvalid(t *testing.T) {
+	_, err := ReadQueries(strings.NewReader("{}\n{\n"))
+	if status := kivik.StatusCode(err); status != kivik.StatusBadRequest {
+		t.Errorf("Expected status %d, got %d (%v)", kivik.StatusBadRequest, status, err)
+	}
+}
@@ -0,0 +1,276 @@
+// Package mango provides a builder for Mango queries, as used by the CouchDB
+// 2.0 /_find endpoint.
+//
+// Queries are built by combining field conditions:
+//
+//	query := mango.Field("age").Gt(21).
+//	    And(mango.Field("type").Eq("user")).
+//	    Sort("age").
+//	    Fields("name")
+//	rows, err := db.Find(context.TODO(), query)
+//
+// Both *Selector and *Query marshal to JSON, so either may be passed directly
+// to kivik.DB.Find.
+//
+// See http://docs.couchdb.org/en/2.0.0/api/database/find.html
+package mango
+
+import (
+	"encoding/json"
+
+	"github.com/flimzy/kivik"
+)
+
+// FieldRef refers to a document field, and is used to build conditions on
+// that field. Nested fields may be referenced with dot notation, such as
+// "address.city".
+type FieldRef struct {
+	name string
+}
+
+// Field returns a reference to the named field.
+func Field(name string) FieldRef {
+	return FieldRef{name: name}
+}
+
+func (f FieldRef) op(op string, value interface{}) *Selector {
+	return &Selector{expr: map[string]interface{}{
+		f.name: map[string]interface{}{op: value},
+	}}
+}
+
+// Eq matches documents where the field is equal to value.
+func (f FieldRef) Eq(value interface{}) *Selector { return f.op("$eq", value) }
+
+// Ne matches documents where the field is not equal to value.
+func (f FieldRef) Ne(value interface{}) *Selector { return f.op("$ne", value) }
+
+// Gt matches documents where the field is greater than value.
+func (f FieldRef) Gt(value interface{}) *Selector { return f.op("$gt", value) }
+
+// Gte matches documents where the field is greater than or equal to value.
+func (f FieldRef) Gte(value interface{}) *Selector { return f.op("$gte", value) }
+
+// Lt matches documents where the field is less than value.
+func (f FieldRef) Lt(value interface{}) *Selector { return f.op("$lt", value) }
+
+// Lte matches documents where the field is less than or equal to value.
+func (f FieldRef) Lte(value interface{}) *Selector { return f.op("$lte", value) }
+
+// Exists matches documents where the field exists, or does not exist if
+// exists is false.
+func (f FieldRef) Exists(exists bool) *Selector { return f.op("$exists", exists) }
+
+// Type matches documents where the field is of the given JSON type: one of
+// "null", "boolean", "number", "string", "array" or "object".
+func (f FieldRef) Type(jsonType string) *Selector { return f.op("$type", jsonType) }
+
+// In matches documents where the field is equal to one of values.
+func (f FieldRef) In(values ...interface{}) *Selector { return f.op("$in", nonNil(values)) }
+
+// Nin matches documents where the field is equal to none of values.
+func (f FieldRef) Nin(values ...interface{}) *Selector { return f.op("$nin", nonNil(values)) }
+
+// All matches documents where the field is an array containing all of values.
+func (f FieldRef) All(values ...interface{}) *Selector { return f.op("$all", nonNil(values)) }
+
+// Size matches documents where the field is an array of the given length.
+func (f FieldRef) Size(length int) *Selector { return f.op("$size", length) }
+
+// Mod matches documents where the field is an integer, which when divided by
+// divisor leaves remainder.
+func (f FieldRef) Mod(divisor, remainder int) *Selector {
+	return f.op("$mod", []int{divisor, remainder})
+}
+
+// Regex matches documents where the field is a string matching the regular
+// expression pattern.
+func (f FieldRef) Regex(pattern string) *Selector { return f.op("$regex", pattern) }
+
+// ElemMatch matches documents where the field is an array, at least one
+// element of which matches sel.
+func (f FieldRef) ElemMatch(sel *Selector) *Selector { return f.op("$elemMatch", sel) }
+
+// AllMatch matches documents where the field is an array, all elements of
+// which match sel.
+func (f FieldRef) AllMatch(sel *Selector) *Selector { return f.op("$allMatch", sel) }
+
+func nonNil(values []interface{}) []interface{} {
+	if values == nil {
+		return []interface{}{}
+	}
+	return values
+}
+
+// Selector is a Mango selector expression.
+type Selector struct {
+	expr map[string]interface{}
+}
+
+var _ json.Marshaler = &Selector{}
+
+// MarshalJSON satisfies the json.Marshaler interface. An empty selector
+// marshals as {}, which matches all documents. Values of types registered
+// with kivik.RegisterKeyEncoder are encoded by their KeyEncoder.
+func (s *Selector) MarshalJSON() ([]byte, error) {
+	if s == nil || s.expr == nil {
+		return []byte("{}"), nil
+	}
+	expr, err := kivik.EncodeValue(s.expr)
+	if err != nil {
+		return nil, err
+	}
+	return json.Marshal(expr)
+}
+
+// combine returns a selector combining s and others with the logical operator
+// op. Nested uses of the same operator are flattened.
+func (s *Selector) combine(op string, others []*Selector) *Selector {
+	var terms []*Selector
+	for _, sel := range append([]*Selector{s}, others...) {
+		if sel == nil {
+			continue
+		}
+		if nested, ok := sel.expr[op].([]*Selector); ok && len(sel.expr) == 1 {
+			terms = append(terms, nested...)
+			continue
+		}
+		terms = append(terms, sel)
+	}
+	return &Selector{expr: map[string]interface{}{op: terms}}
+}
+
+// And returns a selector matching documents which match s and all of others.
+func (s *Selector) And(others ...*Selector) *Selector { return s.combine("$and", others) }
+
+// Or returns a selector matching documents which match s or any of others.
+func (s *Selector) Or(others ...*Selector) *Selector { return s.combine("$or", others) }
+
+// Nor returns a selector matching documents which match neither s nor any of
+// others.
+func (s *Selector) Nor(others ...*Selector) *Selector { return s.combine("$nor", others) }
+
+// And returns a selector matching documents which match all of sels.
+func And(sels ...*Selector) *Selector { return (*Selector)(nil).combine("$and", sels) }
+
+// Or returns a selector matching documents which match any of sels.
+func Or(sels ...*Selector) *Selector { return (*Selector)(nil).combine("$or", sels) }
+
+// Nor returns a selector matching documents which match none of sels.
+func Nor(sels ...*Selector) *Selector { return (*Selector)(nil).combine("$nor", sels) }
+
+// Not returns a selector matching documents which do not match sel.
+func Not(sel *Selector) *Selector {
+	return &Selector{expr: map[string]interface{}{"$not": sel}}
+}
+
+// Query returns a query using s as its selector.
+func (s *Selector) Query() *Query { return &Query{selector: s} }
+
+// Sort returns a query using s as its selector, sorted by fields in ascending
+// order. See Query.Sort.
+func (s *Selector) Sort(fields ...string) *Query { return s.Query().Sort(fields...) }
+
+// SortDesc returns a query using s as its selector, sorted by fields in
+// descending order. See Query.SortDesc.
+func (s *Selector) SortDesc(fields ...string) *Query { return s.Query().SortDesc(fields...) }
+
+// Fields returns a query using s as its selector, which returns only fields.
+// See Query.Fields.
+func (s *Selector) Fields(fields ...string) *Query { return s.Query().Fields(fields...) }
+
+// Limit returns a query using s as its selector, with a limit. See
+// Query.Limit.
+func (s *Selector) Limit(limit int) *Query { return s.Query().Limit(limit) }
+
+// Query is a complete /_find query.
+type Query struct {
+	selector *Selector
+	sort     []interface{}
+	fields   []string
+	limit    int
+	skip     int
+	useIndex []string
+	bookmark string
+}
+
+var _ json.Marshaler = &Query{}
+
+// Sort appends fields, in ascending order, to the query's sort order.
+func (q *Query) Sort(fields ...string) *Query {
+	for _, field := range fields {
+		q.sort = append(q.sort, map[string]string{field: "asc"})
+	}
+	return q
+}
+
+// SortDesc appends fields, in descending order, to the query's sort order.
+func (q *Query) SortDesc(fields ...string) *Query {
+	for _, field := range fields {
+		q.sort = append(q.sort, map[string]string{field: "desc"})
+	}
+	return q
+}
+
+// Fields restricts the fields returned for each document to fields.
+func (q *Query) Fields(fields ...string) *Query {
+	q.fields = append(q.fields, fields...)
+	return q
+}
+
+// Limit sets the maximum number of results returned.
+func (q *Query) Limit(limit int) *Query {
+	q.limit = limit
+	return q
+}
+
+// Skip sets the number of results to skip.
+func (q *Query) Skip(skip int) *Query {
+	q.skip = skip
+	return q
+}
+
+// UseIndex instructs the query to use a specific index, identified by its
+// design document, and optionally its name.
+func (q *Query) UseIndex(ddoc string, name ...string) *Query {
+	q.useIndex = append([]string{ddoc}, name...)
+	return q
+}
+
+// Bookmark sets the bookmark, returned by a previous query, from which to
+// continue paging.
+func (q *Query) Bookmark(bookmark string) *Query {
+	q.bookmark = bookmark
+	return q
+}
+
+// MarshalJSON satisfies the json.Marshaler interface.
+func (q *Query) MarshalJSON() ([]byte, error) {
+	body := struct {
+		Selector *Selector     `json:"selector"`
+		Sort     []interface{} `json:"sort,omitempty"`
+		Fields   []string      `json:"fields,omitempty"`
+		Limit    int           `json:"limit,omitempty"`
+		Skip     int           `json:"skip,omitempty"`
+		UseIndex interface{}   `json:"use_index,omitempty"`
+		Bookmark string        `json:"bookmark,omitempty"`
+	}{
+		Selector: q.selector,
+		Sort:     q.sort,
+		Fields:   q.fields,
+		Limit:    q.limit,
+		Skip:     q.skip,
+		Bookmark: q.bookmark,
+	}
+	if body.Selector == nil {
+		body.Selector = &Selector{}
+	}
+	switch len(q.useIndex) {
+	case 0:
+	case 1:
+		body.UseIndex = q.useIndex[0]
+	default:
+		body.UseIndex = q.useIndex[:2]
+	}
+	return json.Marshal(body)
+}
@@ -0,0 +1,108 @@
+package mango
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/flimzy/diff"
+)
+
+func TestMarshal(t *testing.T) {
+	tests := []struct {
+		name     string
+		input    json.Marshaler
+		expected string
+	}{
+		{
+			name:     "EmptySelector",
+			input:    &Selector{},
+			expected: `{}`,
+		},
+		{
+			name:     "Eq",
+			input:    Field("type").Eq("user"),
+			expected: `{"type":{"$eq":"user"}}`,
+		},
+		{
+			name:     "NestedField",
+			input:    Field("address.city").Ne("Paris"),
+			expected: `{"address.city":{"$ne":"Paris"}}`,
+		},
+		{
+			name:     "In",
+			input:    Field("age").In(1, 2, 3),
+			expected: `{"age":{"$in":[1,2,3]}}`,
+		},
+		{
+			name:     "EmptyNin",
+			input:    Field("age").Nin(),
+			expected: `{"age":{"$nin":[]}}`,
+		},
+		{
+			name:     "Mod",
+			input:    Field("n").Mod(4, 1),
+			expected: `{"n":{"$mod":[4,1]}}`,
+		},
+		{
+			name:     "ElemMatch",
+			input:    Field("tags").ElemMatch(Field("name").Regex("^go")),
+			expected: `{"tags":{"$elemMatch":{"name":{"$regex":"^go"}}}}`,
+		},
+		{
+			name:     "And",
+			input:    Field("age").Gt(21).And(Field("type").Eq("user")),
+			expected: `{"$and":[{"age":{"$gt":21}},{"type":{"$eq":"user"}}]}`,
+		},
+		{
+			name:     "FlattenedAnd",
+			input:    Field("a").Eq(1).And(Field("b").Eq(2)).And(Field("c").Eq(3)),
+			expected: `{"$and":[{"a":{"$eq":1}},{"b":{"$eq":2}},{"c":{"$eq":3}}]}`,
+		},
+		{
+			name:     "MixedOperators",
+			input:    Field("a").Eq(1).Or(Field("b").Eq(2)).And(Field("c").Exists(true)),
+			expected: `{"$and":[{"$or":[{"a":{"$eq":1}},{"b":{"$eq":2}}]},{"c":{"$exists":true}}]}`,
+		},
+		{
+			name:     "PackageOr",
+			input:    Or(Field("a").Lt(1), Field("a").Gte(10)),
+			expected: `{"$or":[{"a":{"$lt":1}},{"a":{"$gte":10}}]}`,
+		},
+		{
+			name:     "Not",
+			input:    Not(Field("a").Type("string")),
+			expected: `{"$not":{"a":{"$type":"string"}}}`,
+		},
+		{
+			name:     "Query",
+			input:    Field("age").Gt(21).And(Field("type").Eq("user")).Sort("age").Fields("name"),
+			expected: `{"selector":{"$and":[{"age":{"$gt":21}},{"type":{"$eq":"user"}}]},"sort":[{"age":"asc"}],"fields":["name"]}`,
+		},
+		{
+			name:     "FullQuery",
+			input:    Field("age").Lte(65).SortDesc("age").Limit(10).Skip(20).UseIndex("_design/ages", "by-age").Bookmark("xyz"),
+			expected: `{"selector":{"age":{"$lte":65}},"sort":[{"age":"desc"}],"limit":10,"skip":20,"use_index":["_design/ages","by-age"],"bookmark":"xyz"}`,
+		},
+		{
+			name:     "UseIndexDDocOnly",
+			input:    Field("size").Size(3).Query().UseIndex("_design/sizes"),
+			expected: `{"selector":{"size":{"$size":3}},"use_index":"_design/sizes"}`,
+		},
+		{
+			name:     "NilSelectorQuery",
+			input:    (*Selector)(nil).Limit(5),
+			expected: `{"selector":{},"limit":5}`,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			result, err := json.Marshal(test.input)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if d := diff.JSON([]byte(test.expected), result); d != "" {
+				t.Error(d)
+			}
+		})
+	}
+}
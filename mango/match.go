@@ -0,0 +1,442 @@
+package mango
+
+import (
+	"encoding/json"
+	"math"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/flimzy/kivik"
+	"github.com/flimzy/kivik/errors"
+)
+
+// Matcher evaluates a selector against documents in memory, for use where a
+// server is not available to do so, such as in tests, or when filtering
+// documents received from the changes feed.
+//
+// Values are compared according to CouchDB's view collation, except that
+// strings are compared by their byte values, rather than with the ICU
+// collation algorithm.
+type Matcher struct {
+	match matchFunc
+}
+
+// matchFunc reports whether value matches. present is false if value is a
+// missing field.
+type matchFunc func(value interface{}, present bool) bool
+
+// NewMatcher parses selector, which may be a *Selector, or any value which
+// marshals to a JSON selector object, such as a map or json.RawMessage. An
+// error with status StatusBadRequest is returned for an invalid selector.
+func NewMatcher(selector interface{}) (*Matcher, error) {
+	var expr interface{}
+	if err := normalize(selector, &expr); err != nil {
+		return nil, err
+	}
+	obj, ok := expr.(map[string]interface{})
+	if !ok {
+		return nil, errors.Status(kivik.StatusBadRequest, "mango: selector must be an object")
+	}
+	match, err := compile(obj)
+	if err != nil {
+		return nil, err
+	}
+	return &Matcher{match: match}, nil
+}
+
+// Match reports whether doc matches the selector. doc may be any value which
+// marshals to a JSON object, including json.RawMessage.
+func (m *Matcher) Match(doc interface{}) (bool, error) {
+	var value interface{}
+	if err := normalize(doc, &value); err != nil {
+		return false, err
+	}
+	return m.match(value, true), nil
+}
+
+// Match reports whether doc matches selector. When matching many documents,
+// use NewMatcher to parse the selector only once.
+func Match(selector, doc interface{}) (bool, error) {
+	m, err := NewMatcher(selector)
+	if err != nil {
+		return false, err
+	}
+	return m.Match(doc)
+}
+
+// normalize converts v to its generic JSON representation, as produced by
+// json.Unmarshal.
+func normalize(v interface{}, dest *interface{}) error {
+	var raw []byte
+	switch t := v.(type) {
+	case json.RawMessage:
+		raw = t
+	case []byte:
+		raw = t
+	default:
+		var err error
+		if raw, err = json.Marshal(v); err != nil {
+			return errors.WrapStatus(kivik.StatusBadRequest, err)
+		}
+	}
+	if err := json.Unmarshal(raw, dest); err != nil {
+		return errors.WrapStatus(kivik.StatusBadRequest, err)
+	}
+	return nil
+}
+
+// compile compiles a selector object, which may contain both field names and
+// operators. Multiple entries are combined with an implicit $and.
+func compile(expr map[string]interface{}) (matchFunc, error) {
+	terms := make([]matchFunc, 0, len(expr))
+	for key, arg := range expr {
+		var term matchFunc
+		var err error
+		if strings.HasPrefix(key, "$") {
+			term, err = compileOperator(key, arg)
+		} else {
+			term, err = compileField(key, arg)
+		}
+		if err != nil {
+			return nil, err
+		}
+		terms = append(terms, term)
+	}
+	return func(value interface{}, present bool) bool {
+		for _, term := range terms {
+			if !term(value, present) {
+				return false
+			}
+		}
+		return true
+	}, nil
+}
+
+// compileValue compiles the argument for a field: either a nested selector,
+// or a value which the field must equal.
+func compileValue(arg interface{}) (matchFunc, error) {
+	if obj, ok := arg.(map[string]interface{}); ok {
+		return compile(obj)
+	}
+	return func(value interface{}, present bool) bool {
+		return present && collate(value, arg) == 0
+	}, nil
+}
+
+// compileField compiles a condition on the field name, which may refer to a
+// nested field with dot notation.
+func compileField(name string, arg interface{}) (matchFunc, error) {
+	match, err := compileValue(arg)
+	if err != nil {
+		return nil, err
+	}
+	path := strings.Split(name, ".")
+	return func(value interface{}, present bool) bool {
+		for _, key := range path {
+			obj, ok := value.(map[string]interface{})
+			if !present || !ok {
+				return match(nil, false)
+			}
+			value, present = obj[key]
+		}
+		return match(value, present)
+	}, nil
+}
+
+func compileSelectors(op string, arg interface{}) ([]matchFunc, error) {
+	list, ok := arg.([]interface{})
+	if !ok {
+		return nil, errors.Statusf(kivik.StatusBadRequest, "mango: %s requires an array", op)
+	}
+	terms := make([]matchFunc, len(list))
+	for i, item := range list {
+		obj, ok := item.(map[string]interface{})
+		if !ok {
+			return nil, errors.Statusf(kivik.StatusBadRequest, "mango: %s requires an array of selectors", op)
+		}
+		term, err := compile(obj)
+		if err != nil {
+			return nil, err
+		}
+		terms[i] = term
+	}
+	return terms, nil
+}
+
+func compileOperator(op string, arg interface{}) (matchFunc, error) {
+	switch op {
+	case "$and", "$or", "$nor":
+		terms, err := compileSelectors(op, arg)
+		if err != nil {
+			return nil, err
+		}
+		return func(value interface{}, present bool) bool {
+			for _, term := range terms {
+				matched := term(value, present)
+				switch {
+				case op == "$and" && !matched:
+					return false
+				case op == "$or" && matched:
+					return true
+				case op == "$nor" && matched:
+					return false
+				}
+			}
+			return op != "$or"
+		}, nil
+	case "$not":
+		obj, ok := arg.(map[string]interface{})
+		if !ok {
+			return nil, errors.Status(kivik.StatusBadRequest, "mango: $not requires a selector")
+		}
+		term, err := compile(obj)
+		if err != nil {
+			return nil, err
+		}
+		return func(value interface{}, present bool) bool {
+			return !term(value, present)
+		}, nil
+	case "$elemMatch", "$allMatch":
+		obj, ok := arg.(map[string]interface{})
+		if !ok {
+			return nil, errors.Statusf(kivik.StatusBadRequest, "mango: %s requires a selector", op)
+		}
+		term, err := compile(obj)
+		if err != nil {
+			return nil, err
+		}
+		return func(value interface{}, present bool) bool {
+			list, ok := value.([]interface{})
+			if !ok || len(list) == 0 {
+				return false
+			}
+			for _, item := range list {
+				matched := term(item, true)
+				if op == "$elemMatch" && matched {
+					return true
+				}
+				if op == "$allMatch" && !matched {
+					return false
+				}
+			}
+			return op == "$allMatch"
+		}, nil
+	case "$exists":
+		exists, ok := arg.(bool)
+		if !ok {
+			return nil, errors.Status(kivik.StatusBadRequest, "mango: $exists requires a boolean")
+		}
+		return func(_ interface{}, present bool) bool {
+			return present == exists
+		}, nil
+	}
+	cond, err := compileCondition(op, arg)
+	if err != nil {
+		return nil, err
+	}
+	return func(value interface{}, present bool) bool {
+		return present && cond(value)
+	}, nil
+}
+
+// compileCondition compiles a condition operator which matches only present
+// fields.
+func compileCondition(op string, arg interface{}) (func(interface{}) bool, error) {
+	switch op {
+	case "$eq":
+		return func(v interface{}) bool { return collate(v, arg) == 0 }, nil
+	case "$ne":
+		return func(v interface{}) bool { return collate(v, arg) != 0 }, nil
+	case "$lt":
+		return func(v interface{}) bool { return collate(v, arg) < 0 }, nil
+	case "$lte":
+		return func(v interface{}) bool { return collate(v, arg) <= 0 }, nil
+	case "$gt":
+		return func(v interface{}) bool { return collate(v, arg) > 0 }, nil
+	case "$gte":
+		return func(v interface{}) bool { return collate(v, arg) >= 0 }, nil
+	case "$type":
+		jsonType, ok := arg.(string)
+		if !ok {
+			return nil, errors.Status(kivik.StatusBadRequest, "mango: $type requires a string")
+		}
+		return func(v interface{}) bool { return typeName(v) == jsonType }, nil
+	case "$in", "$nin", "$all":
+		list, ok := arg.([]interface{})
+		if !ok {
+			return nil, errors.Statusf(kivik.StatusBadRequest, "mango: %s requires an array", op)
+		}
+		return func(v interface{}) bool {
+			switch op {
+			case "$in":
+				return contains(list, v)
+			case "$nin":
+				return !contains(list, v)
+			}
+			values, ok := v.([]interface{})
+			if !ok {
+				return false
+			}
+			for _, item := range list {
+				if !contains(values, item) {
+					return false
+				}
+			}
+			return true
+		}, nil
+	case "$size":
+		size, ok := integer(arg)
+		if !ok {
+			return nil, errors.Status(kivik.StatusBadRequest, "mango: $size requires an integer")
+		}
+		return func(v interface{}) bool {
+			list, ok := v.([]interface{})
+			return ok && int64(len(list)) == size
+		}, nil
+	case "$mod":
+		list, ok := arg.([]interface{})
+		if !ok || len(list) != 2 {
+			return nil, errors.Status(kivik.StatusBadRequest, "mango: $mod requires [divisor, remainder]")
+		}
+		divisor, ok1 := integer(list[0])
+		remainder, ok2 := integer(list[1])
+		if !ok1 || !ok2 || divisor == 0 {
+			return nil, errors.Status(kivik.StatusBadRequest, "mango: $mod requires a non-zero integer divisor and an integer remainder")
+		}
+		return func(v interface{}) bool {
+			n, ok := integer(v)
+			return ok && n%divisor == remainder
+		}, nil
+	case "$regex":
+		pattern, ok := arg.(string)
+		if !ok {
+			return nil, errors.Status(kivik.StatusBadRequest, "mango: $regex requires a string")
+		}
+		re, err := regexp.Compile(pattern)
+		if err != nil {
+			return nil, errors.WrapStatus(kivik.StatusBadRequest, err)
+		}
+		return func(v interface{}) bool {
+			s, ok := v.(string)
+			return ok && re.MatchString(s)
+		}, nil
+	}
+	return nil, errors.Statusf(kivik.StatusBadRequest, "mango: unknown operator %s", op)
+}
+
+func contains(list []interface{}, v interface{}) bool {
+	for _, item := range list {
+		if collate(item, v) == 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// integer returns v as an integer, if it is an integral number.
+func integer(v interface{}) (int64, bool) {
+	f, ok := v.(float64)
+	if !ok || f != math.Trunc(f) {
+		return 0, false
+	}
+	return int64(f), true
+}
+
+func typeName(v interface{}) string {
+	switch v.(type) {
+	case nil:
+		return "null"
+	case bool:
+		return "boolean"
+	case float64:
+		return "number"
+	case string:
+		return "string"
+	case []interface{}:
+		return "array"
+	}
+	return "object"
+}
+
+// collationRank returns the relative order of the type of v, in CouchDB's
+// view collation.
+func collationRank(v interface{}) int {
+	switch t := v.(type) {
+	case nil:
+		return 0
+	case bool:
+		if t {
+			return 2
+		}
+		return 1
+	case float64:
+		return 3
+	case string:
+		return 4
+	case []interface{}:
+		return 5
+	}
+	return 6
+}
+
+// collate compares a and b, returning -1, 0 or 1.
+func collate(a, b interface{}) int {
+	rankA, rankB := collationRank(a), collationRank(b)
+	if rankA != rankB {
+		return compareInts(rankA, rankB)
+	}
+	switch t := a.(type) {
+	case float64:
+		u := b.(float64)
+		switch {
+		case t < u:
+			return -1
+		case t > u:
+			return 1
+		}
+		return 0
+	case string:
+		return strings.Compare(t, b.(string))
+	case []interface{}:
+		u := b.([]interface{})
+		for i := 0; i < len(t) && i < len(u); i++ {
+			if c := collate(t[i], u[i]); c != 0 {
+				return c
+			}
+		}
+		return compareInts(len(t), len(u))
+	case map[string]interface{}:
+		u := b.(map[string]interface{})
+		keysA, keysB := sortedKeys(t), sortedKeys(u)
+		for i := 0; i < len(keysA) && i < len(keysB); i++ {
+			if c := strings.Compare(keysA[i], keysB[i]); c != 0 {
+				return c
+			}
+			if c := collate(t[keysA[i]], u[keysB[i]]); c != 0 {
+				return c
+			}
+		}
+		return compareInts(len(keysA), len(keysB))
+	}
+	return 0
+}
+
+func compareInts(a, b int) int {
+	switch {
+	case a < b:
+		return -1
+	case a > b:
+		return 1
+	}
+	return 0
+}
+
+func sortedKeys(m map[string]interface{}) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
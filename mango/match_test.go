@@ -0,0 +1,105 @@
+package mango
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/flimzy/kivik"
+)
+
+func TestMatch(t *testing.T) {
+	doc := json.RawMessage(`{
+		"_id": "foo",
+		"name": "Bob",
+		"age": 42,
+		"active": true,
+		"manager": null,
+		"tags": ["a", "b", "c"],
+		"scores": [3, 7, 9],
+		"address": {"city": "Paris", "zip": "75001"},
+		"pets": [{"type": "cat", "name": "Tom"}, {"type": "dog", "name": "Rex"}]
+	}`)
+	tests := []struct {
+		name     string
+		selector interface{}
+		expected bool
+	}{
+		{name: "Empty", selector: &Selector{}, expected: true},
+		{name: "ImplicitEq", selector: map[string]interface{}{"name": "Bob"}, expected: true},
+		{name: "ImplicitEqFalse", selector: map[string]interface{}{"name": "Alice"}, expected: false},
+		{name: "Eq", selector: Field("age").Eq(42), expected: true},
+		{name: "Ne", selector: Field("age").Ne(42), expected: false},
+		{name: "NeMissing", selector: Field("missing").Ne(42), expected: false},
+		{name: "Gt", selector: Field("age").Gt(40), expected: true},
+		{name: "Gte", selector: Field("age").Gte(42), expected: true},
+		{name: "Lt", selector: Field("age").Lt(42), expected: false},
+		{name: "Lte", selector: Field("age").Lte(42), expected: true},
+		{name: "CollationAcrossTypes", selector: Field("name").Gt(1000), expected: true},
+		{name: "NullCollatesFirst", selector: Field("manager").Lt(false), expected: true},
+		{name: "NestedField", selector: Field("address.city").Eq("Paris"), expected: true},
+		{name: "NestedSelector", selector: map[string]interface{}{"address": map[string]interface{}{"zip": "75001"}}, expected: true},
+		{name: "NestedMissing", selector: Field("name.first").Exists(true), expected: false},
+		{name: "Exists", selector: Field("manager").Exists(true), expected: true},
+		{name: "NotExists", selector: Field("missing").Exists(false), expected: true},
+		{name: "TypeNull", selector: Field("manager").Type("null"), expected: true},
+		{name: "TypeArray", selector: Field("tags").Type("array"), expected: true},
+		{name: "TypeObject", selector: Field("address").Type("object"), expected: true},
+		{name: "In", selector: Field("name").In("Alice", "Bob"), expected: true},
+		{name: "Nin", selector: Field("name").Nin("Alice", "Bob"), expected: false},
+		{name: "All", selector: Field("tags").All("a", "c"), expected: true},
+		{name: "AllMissingValue", selector: Field("tags").All("a", "d"), expected: false},
+		{name: "Size", selector: Field("tags").Size(3), expected: true},
+		{name: "SizeNotArray", selector: Field("name").Size(3), expected: false},
+		{name: "Mod", selector: Field("age").Mod(10, 2), expected: true},
+		{name: "Regex", selector: Field("name").Regex("^B"), expected: true},
+		{name: "RegexNotString", selector: Field("age").Regex("4"), expected: false},
+		{name: "ElemMatch", selector: Field("pets").ElemMatch(Field("type").Eq("dog")), expected: true},
+		{name: "ElemMatchScalar", selector: Field("scores").ElemMatch(&Selector{expr: map[string]interface{}{"$gt": 8}}), expected: true},
+		{name: "AllMatch", selector: Field("scores").AllMatch(&Selector{expr: map[string]interface{}{"$gt": 2}}), expected: true},
+		{name: "AllMatchFalse", selector: Field("scores").AllMatch(&Selector{expr: map[string]interface{}{"$gt": 3}}), expected: false},
+		{name: "And", selector: Field("age").Gt(40).And(Field("active").Eq(true)), expected: true},
+		{name: "AndFalse", selector: Field("age").Gt(40).And(Field("active").Eq(false)), expected: false},
+		{name: "Or", selector: Field("age").Lt(40).Or(Field("active").Eq(true)), expected: true},
+		{name: "Nor", selector: Nor(Field("age").Lt(40), Field("active").Eq(false)), expected: true},
+		{name: "Not", selector: Not(Field("age").Lt(40)), expected: true},
+		{name: "NotMissing", selector: Not(Field("missing").Eq(1)), expected: true},
+		{name: "ImplicitAnd", selector: json.RawMessage(`{"name": "Bob", "age": {"$gt": 50}}`), expected: false},
+		{name: "EqArray", selector: Field("tags").Eq([]string{"a", "b", "c"}), expected: true},
+		{name: "EqObject", selector: Field("address").Eq(map[string]string{"zip": "75001", "city": "Paris"}), expected: true},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			result, err := Match(test.selector, doc)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if result != test.expected {
+				t.Errorf("Expected %t, got %t", test.expected, result)
+			}
+		})
+	}
+}
+
+func TestMatchErrors(t *testing.T) {
+	tests := []struct {
+		name     string
+		selector string
+	}{
+		{name: "NotObject", selector: `[]`},
+		{name: "InvalidJSON", selector: `{`},
+		{name: "UnknownOperator", selector: `{"a": {"$foo": 1}}`},
+		{name: "AndNotArray", selector: `{"$and": {}}`},
+		{name: "InNotArray", selector: `{"a": {"$in": 1}}`},
+		{name: "ExistsNotBool", selector: `{"a": {"$exists": 1}}`},
+		{name: "ModZero", selector: `{"a": {"$mod": [0, 1]}}`},
+		{name: "InvalidRegex", selector: `{"a": {"$regex": "("}}`},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			_, err := NewMatcher(json.RawMessage(test.selector))
+			if kivik.StatusCode(err) != kivik.StatusBadRequest {
+				t.Errorf("Unexpected error: %v", err)
+			}
+		})
+	}
+}
@@ -0,0 +1,67 @@
+package kivik
+
+import (
+	"context"
+	"net/http"
+	"strings"
+)
+
+// ResultMetadata holds the metadata of the response to an operation, as
+// reported by drivers which communicate with a server, for debugging and audit
+// logging. When an operation makes several requests, such as when a request is
+// retried, the metadata of the last response is kept.
+//
+// A ResultMetadata must not be shared by concurrent operations.
+type ResultMetadata struct {
+	// StatusCode is the raw HTTP status code of the response.
+	StatusCode int
+	// ETag is the value of the ETag header, without quotes. For document
+	// requests, this is the document revision.
+	ETag string
+	// RequestID is the value of the X-Couch-Request-ID header.
+	RequestID string
+	// ContentLength is the length of the response body, or -1 if unknown.
+	ContentLength int64
+	// Header holds all response headers.
+	Header http.Header
+}
+
+type metadataKey struct{}
+
+// WithResultMetadata returns a derived context and a ResultMetadata, which is
+// populated by the driver when the context is passed to an operation.
+//
+//	ctx, meta := kivik.WithResultMetadata(context.TODO())
+//	rev, err := db.Put(ctx, docID, doc)
+//	log.Printf("request %s: %d", meta.RequestID, meta.StatusCode)
+//
+// Drivers which have no response metadata to report, such as the memory
+// driver, leave it empty.
+func WithResultMetadata(ctx context.Context) (context.Context, *ResultMetadata) {
+	meta := &ResultMetadata{}
+	return context.WithValue(ctx, metadataKey{}, meta), meta
+}
+
+// ResultMetadataFromContext returns the ResultMetadata stored in ctx by
+// WithResultMetadata, or nil. It is meant for use by drivers.
+func ResultMetadataFromContext(ctx context.Context) *ResultMetadata {
+	if ctx == nil {
+		return nil
+	}
+	meta, _ := ctx.Value(metadataKey{}).(*ResultMetadata)
+	return meta
+}
+
+// RecordResponse stores the metadata of res in the ResultMetadata in ctx, if
+// any. It is meant for use by drivers which make HTTP requests.
+func RecordResponse(ctx context.Context, res *http.Response) {
+	meta := ResultMetadataFromContext(ctx)
+	if meta == nil || res == nil {
+		return
+	}
+	meta.StatusCode = res.StatusCode
+	meta.ETag = strings.Trim(res.Header.Get("ETag"), `"`)
+	meta.RequestID = res.Header.Get("X-Couch-Request-ID")
+	meta.ContentLength = res.ContentLength
+	meta.Header = res.Header
+}
@@ -0,0 +1,37 @@
+package kivik
+
+import (
+	"context"
+	"net/http"
+	"testing"
+
+	"github.com/flimzy/diff"
+)
+
+func TestRecordResponse(t *testing.T) {
+	t.Run("NoMetadata", func(t *testing.T) {
+		// Must not panic
+		RecordResponse(context.Background(), &http.Response{StatusCode: 200})
+		if meta := ResultMetadataFromContext(context.Background()); meta != nil {
+			t.Errorf("Unexpected metadata: %v", meta)
+		}
+	})
+	t.Run("Recorded", func(t *testing.T) {
+		ctx, meta := WithResultMetadata(context.Background())
+		header := http.Header{
+			"Etag":               []string{`"2-xyz"`},
+			"X-Couch-Request-Id": []string{"abc"},
+		}
+		RecordResponse(ctx, &http.Response{StatusCode: 202, Header: header, ContentLength: -1})
+		expected := &ResultMetadata{
+			StatusCode:    202,
+			ETag:          "2-xyz",
+			RequestID:     "abc",
+			ContentLength: -1,
+			Header:        header,
+		}
+		if d := diff.Interface(expected, meta); d != "" {
+			t.Error(d)
+		}
+	})
+}
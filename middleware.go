@@ -0,0 +1,89 @@
+package kivik
+
+import (
+	"context"
+
+	"github.com/flimzy/kivik/errors"
+)
+
+// Operation describes a call to the driver, made by a method of a Client or a
+// DB.
+type Operation struct {
+	// Name is the name of the method, such as "AllDBs" or "Get".
+	Name string
+	// DB is the name of the database, for the methods of a DB, and for DB,
+	// DBExists, CreateDB and DestroyDB. For the operations of a Client,
+	// middleware may change it before calling the next Invoker, as to prefix
+	// the names of a tenant's databases.
+	DB string
+	// DocID is the ID of the document, for single-document operations. For
+	// CreateDoc, it is set to the ID of the new document once the driver
+	// returns.
+	DocID string
+	// Options are the options passed to the driver, after those of the DB's
+	// defaults and of the context are merged. Middleware may modify or replace
+	// them before calling the next Invoker. They may be nil.
+	Options Options
+}
+
+// Invoker performs an operation, and returns its result, which is the value
+// returned by the driver: for example, []string for AllDBs, bool for
+// DBExists, driver.DB for DB, json.RawMessage for Get, io.ReadCloser for
+// GetStream, []driver.OpenRev for GetOpenRevs, driver.Rows for AllDocs, Query
+// and Find, driver.Changes for Changes, driver.BulkResults for BulkDocs,
+// *driver.DesignInfo for DesignInfo, *Attachment for GetAttachment and
+// GetAttachmentMeta, and the new rev for Put, PutMultipart, CreateDoc, Delete,
+// Copy, PutAttachment, CombineAttachments and DeleteAttachment. The result is
+// nil for operations which return only an error, such as CreateDB and
+// Compact.
+type Invoker func(ctx context.Context, op *Operation) (interface{}, error)
+
+// Middleware wraps the Invoker of every operation of a Client, and of its
+// databases. It may be used for cross-cutting concerns, regardless of the
+// driver: to log operations for audit, to inject options, such as those
+// identifying a tenant, to fail fast while a circuit breaker is open, or to
+// return cached results. Middleware which returns a result without calling
+// next must return a result of the type returned by the driver, as described
+// for Invoker; a result of another type is returned to the caller as an
+// error with status StatusInternalServerError.
+//
+// Middleware wraps the driver calls of the Client methods Version, DB,
+// AllDBs, DBExists, CreateDB, DestroyDB and Authenticate, and of the DB
+// methods which read or write documents, attachments, views, indexes,
+// changes, security objects and stats, including GetStream, GetOpenRevs,
+// DesignInfo and the attachment calls of PutChunkedAttachment. Where an
+// operation is emulated with others, as Copy is with Get and Put if the driver
+// does not support it, or GetRevisions is with Get, the middleware wraps each
+// of those too.
+type Middleware func(next Invoker) Invoker
+
+// Use adds middleware to the client, which wraps its operations, and those of
+// databases subsequently opened with DB. The middleware added first is the
+// outermost. Use must not be called concurrently with other methods of the
+// client.
+func (c *Client) Use(mw ...Middleware) {
+	c.middleware = append(c.middleware, mw...)
+}
+
+// invoke calls fn with op, through mw.
+func invoke(ctx context.Context, mw []Middleware, op *Operation, fn Invoker) (interface{}, error) {
+	for i := len(mw) - 1; i >= 0; i-- {
+		fn = mw[i](fn)
+	}
+	return fn(ctx, op)
+}
+
+func (c *Client) invoke(ctx context.Context, op *Operation, fn Invoker) (interface{}, error) {
+	return invoke(ctx, c.middleware, op, fn)
+}
+
+func (db *DB) invoke(ctx context.Context, op *Operation, fn Invoker) (interface{}, error) {
+	op.DB = db.name
+	return invoke(ctx, db.middleware, op, fn)
+}
+
+// unexpectedResult returns the error for a result of op which is not of the
+// type returned by the driver, as may be returned by middleware.
+func unexpectedResult(op string, result interface{}) error {
+	return errors.Statusf(StatusInternalServerError, "kivik: unexpected result %T of %s from middleware", result, op)
+}
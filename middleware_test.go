@@ -0,0 +1,274 @@
+package kivik
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"testing"
+
+	"github.com/flimzy/diff"
+	"github.com/flimzy/kivik/errors"
+)
+
+func TestMiddleware(t *testing.T) {
+	var log []string
+	audit := func(name string) Middleware {
+		return func(next Invoker) Invoker {
+			return func(ctx context.Context, op *Operation) (interface{}, error) {
+				log = append(log, name+":"+op.Name+":"+op.DB+":"+op.DocID)
+				result, err := next(ctx, op)
+				if err != nil {
+					log = append(log, name+":"+op.Name+":"+errors.Reason(err))
+				}
+				return result, err
+			}
+		}
+	}
+	tenant := func(next Invoker) Invoker {
+		return func(ctx context.Context, op *Operation) (interface{}, error) {
+			switch op.Name {
+			case "DB", "CreateDB", "DBExists":
+				op.DB = "acme_" + op.DB
+			}
+			return next(ctx, op)
+		}
+	}
+	cache := func(next Invoker) Invoker {
+		return func(ctx context.Context, op *Operation) (interface{}, error) {
+			if op.Name == "Get" && op.DocID == "cached" {
+				return json.RawMessage(`{"_id":"cached","cached":true}`), nil
+			}
+			return next(ctx, op)
+		}
+	}
+	breaker := func(next Invoker) Invoker {
+		return func(ctx context.Context, op *Operation) (interface{}, error) {
+			if op.Name == "Put" && op.DocID == "tripped" {
+				return nil, errors.Status(http.StatusServiceUnavailable, "circuit open")
+			}
+			return next(ctx, op)
+		}
+	}
+	driverClient := newDumpClient(false)
+	client := &Client{driverClient: driverClient}
+	client.Use(audit("outer"), tenant, audit("inner"), cache, breaker)
+
+	ctx := context.Background()
+	if err := client.CreateDB(ctx, "foo"); err != nil {
+		t.Fatal(err)
+	}
+	if exists, err := client.DBExists(ctx, "foo"); err != nil || !exists {
+		t.Fatalf("Expected foo to exist, got %t, %v", exists, err)
+	}
+	db, err := client.DB(ctx, "foo")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := db.Put(ctx, "bar", map[string]string{"name": "bar"}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := db.Put(ctx, "tripped", map[string]string{}); StatusCode(err) != http.StatusServiceUnavailable {
+		t.Errorf("Expected the breaker's error, got %v", err)
+	}
+	row, err := db.Get(ctx, "cached")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var doc map[string]interface{}
+	if err := row.ScanDoc(&doc); err != nil {
+		t.Fatal(err)
+	}
+	if d := diff.Interface(map[string]interface{}{"_id": "cached", "cached": true}, doc); d != "" {
+		t.Errorf("Unexpected cached doc:\n%s", d)
+	}
+	dbs, err := client.AllDBs(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if d := diff.Interface([]string{"acme_foo"}, dbs); d != "" {
+		t.Errorf("Unexpected databases:\n%s", d)
+	}
+
+	expected := []string{
+		"outer:CreateDB:foo:", "inner:CreateDB:acme_foo:",
+		"outer:DBExists:foo:", "inner:DBExists:acme_foo:",
+		"outer:DB:foo:", "inner:DB:acme_foo:",
+		"outer:Put:acme_foo:bar", "inner:Put:acme_foo:bar",
+		"outer:Put:acme_foo:tripped", "inner:Put:acme_foo:tripped",
+		"inner:Put:circuit open", "outer:Put:circuit open",
+		"outer:Get:acme_foo:cached", "inner:Get:acme_foo:cached",
+		"outer:AllDBs::", "inner:AllDBs::",
+	}
+	if d := diff.Interface(expected, log); d != "" {
+		t.Errorf("Unexpected operations:\n%s", d)
+	}
+}
+
+func TestMiddlewareOptions(t *testing.T) {
+	driverDB := &defaultsDB{opts: make(map[string]map[string]interface{})}
+	client := &Client{driverClient: &defaultsClient{db: driverDB}}
+	client.Use(func(next Invoker) Invoker {
+		return func(ctx context.Context, op *Operation) (interface{}, error) {
+			if op.Name == "Get" {
+				op.Options = Options{"rev": "1-tenant"}
+			}
+			return next(ctx, op)
+		}
+	})
+	db, err := client.DB(context.Background(), "foo")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := db.Get(context.Background(), "bar"); err != nil {
+		t.Fatal(err)
+	}
+	if d := diff.Interface(map[string]interface{}{"rev": "1-tenant"}, driverDB.opts["Get"]); d != "" {
+		t.Error(d)
+	}
+}
+
+func TestMiddlewareCreateDocID(t *testing.T) {
+	var created string
+	db := &DB{
+		driverDB: &hookDB{},
+		middleware: []Middleware{func(next Invoker) Invoker {
+			return func(ctx context.Context, op *Operation) (interface{}, error) {
+				result, err := next(ctx, op)
+				created = op.DocID + "@" + result.(string)
+				return result, err
+			}
+		}},
+	}
+	docID, rev, err := db.CreateDoc(context.Background(), map[string]string{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if docID != "generated" || rev != "1-x" {
+		t.Errorf("Unexpected result: %s, %s", docID, rev)
+	}
+	if created != "generated@1-x" {
+		t.Errorf("Unexpected middleware result: %s", created)
+	}
+}
+
+func TestMiddlewareDocumentOperations(t *testing.T) {
+	var log []string
+	mw := []Middleware{func(next Invoker) Invoker {
+		return func(ctx context.Context, op *Operation) (interface{}, error) {
+			log = append(log, op.Name+":"+op.DocID)
+			return next(ctx, op)
+		}
+	}}
+	ctx := context.Background()
+	body, err := (&DB{driverDB: &bodyGetterDB{}, middleware: mw}).GetStream(ctx, "foo")
+	if err != nil {
+		t.Fatal(err)
+	}
+	_ = body.Close()
+	if _, err = (&DB{driverDB: &openRevsDB{&revsDB{}}, middleware: mw}).GetOpenRevs(ctx, "foo", []string{"1-a"}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = (&DB{driverDB: &designInfoDB{}, middleware: mw}).DesignInfo(ctx, "foo"); err != nil {
+		t.Fatal(err)
+	}
+	expected := []string{"GetStream:foo", "GetOpenRevs:foo", "DesignInfo:_design/foo"}
+	if d := diff.Interface(expected, log); d != "" {
+		t.Errorf("Unexpected operations:\n%s", d)
+	}
+}
+
+func TestMiddlewareUnexpectedResult(t *testing.T) {
+	db := &DB{
+		driverDB: &designInfoDB{},
+		middleware: []Middleware{func(_ Invoker) Invoker {
+			return func(_ context.Context, _ *Operation) (interface{}, error) {
+				return "unexpected", nil
+			}
+		}},
+	}
+	ctx := context.Background()
+	tests := []struct {
+		name string
+		call func() error
+	}{
+		{
+			name: "GetStream",
+			call: func() error { _, err := db.GetStream(ctx, "foo"); return err },
+		},
+		{
+			name: "DesignInfo",
+			call: func() error { _, err := db.DesignInfo(ctx, "foo"); return err },
+		},
+		{
+			name: "GetAttachment",
+			call: func() error { _, err := db.GetAttachment(ctx, "foo", "", "bar.txt"); return err },
+		},
+		{
+			name: "GetAttachmentMeta",
+			call: func() error { _, err := db.GetAttachmentMeta(ctx, "foo", "", "bar.txt"); return err },
+		},
+		{
+			name: "Stats",
+			call: func() error { _, err := db.Stats(ctx); return err },
+		},
+		{
+			name: "Security",
+			call: func() error { _, err := db.Security(ctx); return err },
+		},
+		{
+			name: "AllDocs",
+			call: func() error { _, err := db.AllDocs(ctx); return err },
+		},
+		{
+			name: "Get",
+			call: func() error { _, err := db.Get(ctx, "foo"); return err },
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if err := test.call(); StatusCode(err) != StatusInternalServerError {
+				t.Errorf("Expected an internal server error, got %v", err)
+			}
+		})
+	}
+}
+
+func TestMiddlewareNilResult(t *testing.T) {
+	db := &DB{
+		driverDB: &dummyDB{},
+		middleware: []Middleware{func(_ Invoker) Invoker {
+			return func(_ context.Context, _ *Operation) (interface{}, error) {
+				return nil, nil
+			}
+		}},
+	}
+	ctx := context.Background()
+	tests := []struct {
+		name string
+		call func() error
+	}{
+		{
+			name: "AllDocs",
+			call: func() error { _, err := db.AllDocs(ctx); return err },
+		},
+		{
+			name: "Query",
+			call: func() error { _, err := db.Query(ctx, "foo", "bar"); return err },
+		},
+		{
+			name: "Changes",
+			call: func() error { _, err := db.Changes(ctx); return err },
+		},
+		{
+			name: "BulkDocs",
+			call: func() error { _, err := db.BulkDocs(ctx, []interface{}{map[string]string{"_id": "foo"}}); return err },
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if err := test.call(); StatusCode(err) != StatusInternalServerError {
+				t.Errorf("Expected an internal server error, got %v", err)
+			}
+		})
+	}
+}
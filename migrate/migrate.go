@@ -0,0 +1,225 @@
+// Package migrate copies databases from one client to another, which may use a
+// different driver. This may be used to copy a CouchDB server to the memory
+// driver for tests, or to move data between versions of CouchDB.
+//
+//	err := migrate.Copy(ctx, source, target, migrate.Options{
+//	    Progress: func(p migrate.Progress) {
+//	        saveCheckpoint(p)
+//	    },
+//	})
+//
+// Each document is copied with its attachments, including design documents,
+// along with each database's security object. Only the current revision of each
+// document is copied, so revision histories and conflicts are not preserved,
+// and deleted and local documents are not copied. A document which already
+// exists in the target database is overwritten.
+//
+// An interrupted migration may be resumed by passing the last Progress reported
+// as Options.Resume.
+//
+// The package also migrates the schema of a database, with a Runner, which
+// applies ordered Go migrations, recording those applied in a local document
+// of the database, so that each is applied once.
+//
+//	runner, err := migrate.NewRunner([]migrate.Migration{
+//	    {ID: "0001_add_status", Up: func(ctx context.Context, db *kivik.DB) error {
+//	        _, err := migrate.TransformDocs(ctx, db, func(doc map[string]interface{}) (bool, error) {
+//	            if _, ok := doc["status"]; ok {
+//	                return false, nil
+//	            }
+//	            doc["status"] = "active"
+//	            return true, nil
+//	        })
+//	        return err
+//	    }},
+//	}, migrate.RunnerOptions{})
+//	applied, err := runner.Run(ctx, db)
+package migrate
+
+import (
+	"context"
+	"encoding/json"
+	"sort"
+	"strings"
+
+	"github.com/flimzy/kivik"
+	"github.com/flimzy/kivik/errors"
+)
+
+// Options configures a migration.
+type Options struct {
+	// DBs lists the databases to copy. By default, all databases are copied,
+	// except for system databases, whose names begin with an underscore.
+	DBs []string
+	// Progress, if set, is called after each document is copied, and after
+	// each database is completed.
+	Progress func(Progress)
+	// Resume resumes an interrupted migration from the last progress reported.
+	Resume *Progress
+	// SkipSecurity disables copying security objects.
+	SkipSecurity bool
+}
+
+// Progress reports the progress of a migration.
+type Progress struct {
+	// DB is the database being copied.
+	DB string `json:"db"`
+	// DocID is the ID of the last document copied, or empty if no documents
+	// have yet been copied from DB.
+	DocID string `json:"doc_id,omitempty"`
+	// Docs is the number of documents copied from DB.
+	Docs int `json:"docs"`
+	// Done is true once DB has been completely copied.
+	Done bool `json:"done,omitempty"`
+}
+
+// Copy copies databases from source to target, creating them if necessary.
+// Databases are copied in order of name.
+func Copy(ctx context.Context, source, target *kivik.Client, opts Options) error {
+	dbNames := opts.DBs
+	if dbNames == nil {
+		all, err := source.AllDBs(ctx)
+		if err != nil {
+			return err
+		}
+		for _, dbName := range all {
+			if !strings.HasPrefix(dbName, "_") {
+				dbNames = append(dbNames, dbName)
+			}
+		}
+	}
+	dbNames = append([]string{}, dbNames...)
+	sort.Strings(dbNames)
+	for _, dbName := range dbNames {
+		resume := opts.Resume
+		if resume != nil {
+			if dbName < resume.DB || (dbName == resume.DB && resume.Done) {
+				continue
+			}
+			if dbName > resume.DB {
+				resume = nil
+			}
+		}
+		if err := copyDB(ctx, source, target, dbName, resume, opts); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func copyDB(ctx context.Context, source, target *kivik.Client, dbName string, resume *Progress, opts Options) error {
+	exists, err := target.DBExists(ctx, dbName)
+	if err != nil {
+		return err
+	}
+	if !exists {
+		if err = target.CreateDB(ctx, dbName); err != nil {
+			return err
+		}
+	}
+	sourceDB, err := source.DB(ctx, dbName)
+	if err != nil {
+		return err
+	}
+	targetDB, err := target.DB(ctx, dbName)
+	if err != nil {
+		return err
+	}
+	if !opts.SkipSecurity && resume == nil {
+		if err = copySecurity(ctx, sourceDB, targetDB); err != nil {
+			return err
+		}
+	}
+	progress := Progress{DB: dbName}
+	if resume != nil {
+		progress = *resume
+	}
+	return CopyDB(ctx, sourceDB, targetDB, progress, opts.Progress)
+}
+
+// copySecurity copies the security object, unless either driver does not
+// support security objects.
+func copySecurity(ctx context.Context, source, target *kivik.DB) error {
+	sec, err := source.Security(ctx)
+	if kivik.StatusCode(err) == kivik.StatusNotImplemented {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	err = target.SetSecurity(ctx, sec)
+	if kivik.StatusCode(err) == kivik.StatusNotImplemented {
+		return nil
+	}
+	return err
+}
+
+// CopyDB copies the documents of the database source to target, beginning
+// after progress.DocID, if set. Progress, if not nil, is called after each
+// document is copied, and once all documents have been copied.
+func CopyDB(ctx context.Context, source, target *kivik.DB, progress Progress, report func(Progress)) error {
+	viewOpts := kivik.ViewOptions{}
+	if progress.DocID != "" {
+		viewOpts.StartKey = progress.DocID
+	}
+	allDocsOpts, err := viewOpts.Options()
+	if err != nil {
+		return err
+	}
+	rows, err := source.AllDocs(ctx, allDocsOpts)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = rows.Close() }()
+	for rows.Next() {
+		if err = ctx.Err(); err != nil {
+			return err
+		}
+		docID := rows.ID()
+		if docID == progress.DocID {
+			// The start key is inclusive.
+			continue
+		}
+		if err = copyDoc(ctx, source, target, docID); err != nil {
+			return errors.Wrapf(err, "copy %s", docID)
+		}
+		progress.DocID = docID
+		progress.Docs++
+		if report != nil {
+			report(progress)
+		}
+	}
+	if err = rows.Err(); err != nil {
+		return err
+	}
+	progress.Done = true
+	if report != nil {
+		report(progress)
+	}
+	return nil
+}
+
+// copyDoc copies the current revision of a document, with its attachments.
+func copyDoc(ctx context.Context, source, target *kivik.DB, docID string) error {
+	row, err := source.Get(ctx, docID, kivik.Options{"attachments": true})
+	if err != nil {
+		return err
+	}
+	var doc map[string]json.RawMessage
+	if err = row.ScanDoc(&doc); err != nil {
+		return err
+	}
+	delete(doc, "_rev")
+	delete(doc, "_revisions")
+	delete(doc, "_conflicts")
+	rev, err := target.Rev(ctx, docID)
+	switch {
+	case kivik.StatusCode(err) == kivik.StatusNotFound:
+	case err != nil:
+		return err
+	default:
+		doc["_rev"], _ = json.Marshal(rev)
+	}
+	_, err = target.Put(ctx, docID, doc)
+	return err
+}
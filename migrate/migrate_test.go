@@ -0,0 +1,208 @@
+package migrate
+
+import (
+	"context"
+	"io"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/flimzy/diff"
+	"github.com/flimzy/kivik"
+	"github.com/flimzy/kivik/driver"
+	_ "github.com/flimzy/kivik/driver/memory"
+)
+
+// listDriver wraps the memory driver, adding support for AllDocs.
+type listDriver struct {
+	driver.Driver
+}
+
+func (d *listDriver) NewClient(ctx context.Context, dsn string) (driver.Client, error) {
+	c, err := d.Driver.NewClient(ctx, dsn)
+	return &listClient{Client: c, ids: make(map[string]map[string]struct{})}, err
+}
+
+type listClient struct {
+	driver.Client
+	mu  sync.Mutex
+	ids map[string]map[string]struct{}
+}
+
+func (c *listClient) DB(ctx context.Context, dbName string, opts map[string]interface{}) (driver.DB, error) {
+	db, err := c.Client.DB(ctx, dbName, opts)
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.ids[dbName] == nil {
+		c.ids[dbName] = make(map[string]struct{})
+	}
+	return &listDB{DB: db, client: c, ids: c.ids[dbName]}, err
+}
+
+type listDB struct {
+	driver.DB
+	client *listClient
+	ids    map[string]struct{}
+}
+
+func (d *listDB) Put(ctx context.Context, docID string, doc interface{}) (string, error) {
+	rev, err := d.DB.Put(ctx, docID, doc)
+	// Local documents are not included in AllDocs.
+	if err == nil && !strings.HasPrefix(docID, "_local/") {
+		d.client.mu.Lock()
+		d.ids[docID] = struct{}{}
+		d.client.mu.Unlock()
+	}
+	return rev, err
+}
+
+func (d *listDB) AllDocs(_ context.Context, opts map[string]interface{}) (driver.Rows, error) {
+	d.client.mu.Lock()
+	defer d.client.mu.Unlock()
+	startKey, _ := opts["startkey"].(string)
+	rows := &listRows{}
+	for id := range d.ids {
+		if startKey == "" || `"`+id+`"` >= startKey {
+			rows.ids = append(rows.ids, id)
+		}
+	}
+	sort.Strings(rows.ids)
+	return rows, nil
+}
+
+type listRows struct {
+	ids []string
+}
+
+func (r *listRows) Next(row *driver.Row) error {
+	if len(r.ids) == 0 {
+		return io.EOF
+	}
+	row.ID, r.ids = r.ids[0], r.ids[1:]
+	return nil
+}
+
+func (r *listRows) Close() error      { return nil }
+func (r *listRows) UpdateSeq() string { return "" }
+func (r *listRows) Offset() int64     { return 0 }
+func (r *listRows) TotalRows() int64  { return 0 }
+
+func init() {
+	memDriver, _ := kivik.LookupDriver("memory")
+	kivik.Register("migrate-test", &listDriver{Driver: memDriver})
+}
+
+func newClient(t *testing.T) *kivik.Client {
+	client, err := kivik.New(context.Background(), "migrate-test", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return client
+}
+
+func TestCopy(t *testing.T) {
+	ctx := context.Background()
+	source, target := newClient(t), newClient(t)
+	docs := map[string][]string{
+		"bar":    {"a", "b", "c"},
+		"foo":    {"_design/foo", "x"},
+		"_users": {"org.couchdb.user:bob"},
+	}
+	for dbName, ids := range docs {
+		// The memory driver creates the system databases itself.
+		if dbName != "_users" {
+			if err := source.CreateDB(ctx, dbName); err != nil {
+				t.Fatal(err)
+			}
+		}
+		db, _ := source.DB(ctx, dbName)
+		for _, id := range ids {
+			doc := map[string]interface{}{"db": dbName}
+			if dbName == "_users" {
+				doc["type"], doc["name"], doc["roles"] = "user", "bob", []string{}
+			}
+			if _, err := db.Put(ctx, id, doc); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	sourceFoo, _ := source.DB(ctx, "foo")
+	sec := &kivik.Security{Admins: kivik.Members{Names: []string{"bob"}}}
+	if err := sourceFoo.SetSecurity(ctx, sec); err != nil {
+		t.Fatal(err)
+	}
+	// Existing documents in the target are overwritten.
+	if err := target.CreateDB(ctx, "bar"); err != nil {
+		t.Fatal(err)
+	}
+	targetBar, _ := target.DB(ctx, "bar")
+	if _, err := targetBar.Put(ctx, "b", map[string]string{"db": "old"}); err != nil {
+		t.Fatal(err)
+	}
+
+	var reported []Progress
+	interrupt := func(p Progress) {
+		reported = append(reported, p)
+	}
+	// Interrupt the migration after the second document.
+	ctx2, cancel := context.WithCancel(ctx)
+	err := Copy(ctx2, source, target, Options{Progress: func(p Progress) {
+		interrupt(p)
+		if len(reported) == 2 {
+			cancel()
+		}
+	}})
+	if err == nil {
+		t.Fatal("Expected the canceled migration to fail")
+	}
+	resume := reported[len(reported)-1]
+	err = Copy(ctx, source, target, Options{Resume: &resume, Progress: interrupt})
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []Progress{
+		{DB: "bar", DocID: "a", Docs: 1},
+		{DB: "bar", DocID: "b", Docs: 2},
+		{DB: "bar", DocID: "c", Docs: 3},
+		{DB: "bar", DocID: "c", Docs: 3, Done: true},
+		{DB: "foo", DocID: "_design/foo", Docs: 1},
+		{DB: "foo", DocID: "x", Docs: 2},
+		{DB: "foo", DocID: "x", Docs: 2, Done: true},
+	}
+	if d := diff.Interface(expected, reported); d != "" {
+		t.Error(d)
+	}
+
+	targetUsers, _ := target.DB(ctx, "_users")
+	if _, err := targetUsers.Get(ctx, "org.couchdb.user:bob"); kivik.StatusCode(err) != kivik.StatusNotFound {
+		t.Errorf("Expected system database not to be copied")
+	}
+	delete(docs, "_users")
+	for dbName, ids := range docs {
+		db, _ := target.DB(ctx, dbName)
+		for _, id := range ids {
+			row, err := db.Get(ctx, id)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var doc struct {
+				DB string `json:"db"`
+			}
+			if err = row.ScanDoc(&doc); err != nil {
+				t.Fatal(err)
+			}
+			if doc.DB != dbName {
+				t.Errorf("Unexpected %s/%s: %s", dbName, id, doc.DB)
+			}
+		}
+	}
+	targetFoo, _ := target.DB(ctx, "foo")
+	targetSec, err := targetFoo.Security(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if d := diff.Interface(sec, targetSec); d != "" {
+		t.Error(d)
+	}
+}
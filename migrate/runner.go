@@ -0,0 +1,219 @@
+package migrate
+
+import (
+	"context"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/flimzy/kivik"
+	"github.com/flimzy/kivik/errors"
+)
+
+// DefaultLogID is the ID of the local document in which a Runner records the
+// migrations applied to a database, if no LogID is given in RunnerOptions.
+const DefaultLogID = "_local/migrations"
+
+// Migration is a single change to a database, such as transforming its
+// documents, or rebuilding its indexes.
+type Migration struct {
+	// ID identifies the migration. Migrations are applied in order of ID, so
+	// IDs are best prefixed with a number or date, as in "0002_add_email".
+	ID string
+	// Up applies the migration to db. A migration is recorded as applied only
+	// once Up returns successfully, so Up is run again after a failure, and
+	// should be safe to repeat.
+	Up func(ctx context.Context, db *kivik.DB) error
+}
+
+// RunnerOptions configures a Runner.
+type RunnerOptions struct {
+	// LogID is the ID of the local document in which the migrations applied
+	// are recorded. Defaults to DefaultLogID.
+	LogID string
+	// DryRun, if true, causes Run to report the migrations which would be
+	// applied, without applying them.
+	DryRun bool
+	// Progress, if set, is called before and after each migration is applied.
+	Progress func(RunProgress)
+}
+
+// RunProgress reports the progress of Run.
+type RunProgress struct {
+	// ID is the ID of the migration.
+	ID string
+	// Index is the position of the migration among those pending, from 0.
+	Index int
+	// Pending is the number of migrations pending when Run was called.
+	Pending int
+	// Done is false before the migration is applied, and true after.
+	Done bool
+}
+
+// Runner applies migrations to databases, recording those applied in a local
+// document of each database, so that each migration is applied only once.
+type Runner struct {
+	migrations []Migration
+	opts       RunnerOptions
+	// now is replaced in tests.
+	now func() time.Time
+}
+
+// NewRunner returns a Runner for migrations, which must have unique, non-empty
+// IDs.
+func NewRunner(migrations []Migration, opts RunnerOptions) (*Runner, error) {
+	if opts.LogID == "" {
+		opts.LogID = DefaultLogID
+	}
+	if !strings.HasPrefix(opts.LogID, "_local/") {
+		return nil, errors.Statusf(kivik.StatusBadRequest, "migrate: log ID %s is not a local document", opts.LogID)
+	}
+	sorted := append([]Migration{}, migrations...)
+	sort.Sort(byID(sorted))
+	for i, m := range sorted {
+		if m.ID == "" || m.Up == nil {
+			return nil, errors.Status(kivik.StatusBadRequest, "migrate: migrations must have an ID and Up")
+		}
+		if i > 0 && sorted[i-1].ID == m.ID {
+			return nil, errors.Statusf(kivik.StatusBadRequest, "migrate: duplicate migration %s", m.ID)
+		}
+	}
+	return &Runner{migrations: sorted, opts: opts, now: time.Now}, nil
+}
+
+type byID []Migration
+
+func (m byID) Len() int           { return len(m) }
+func (m byID) Less(i, j int) bool { return m[i].ID < m[j].ID }
+func (m byID) Swap(i, j int)      { m[i], m[j] = m[j], m[i] }
+
+// migrationLog is the local document which records the migrations applied.
+type migrationLog struct {
+	Rev     string         `json:"_rev,omitempty"`
+	Applied []appliedEntry `json:"applied"`
+}
+
+type appliedEntry struct {
+	ID        string    `json:"id"`
+	AppliedAt time.Time `json:"applied_at"`
+}
+
+func (r *Runner) readLog(ctx context.Context, db *kivik.DB) (*migrationLog, error) {
+	log := &migrationLog{}
+	row, err := db.Get(ctx, r.opts.LogID)
+	if kivik.StatusCode(err) == kivik.StatusNotFound {
+		return log, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return log, row.ScanDoc(log)
+}
+
+func (r *Runner) pending(log *migrationLog) []Migration {
+	applied := make(map[string]bool, len(log.Applied))
+	for _, entry := range log.Applied {
+		applied[entry.ID] = true
+	}
+	var pending []Migration
+	for _, m := range r.migrations {
+		if !applied[m.ID] {
+			pending = append(pending, m)
+		}
+	}
+	return pending
+}
+
+// Pending returns the IDs of the migrations not yet applied to db, in the
+// order in which they would be applied.
+func (r *Runner) Pending(ctx context.Context, db *kivik.DB) ([]string, error) {
+	log, err := r.readLog(ctx, db)
+	if err != nil {
+		return nil, err
+	}
+	return migrationIDs(r.pending(log)), nil
+}
+
+func migrationIDs(migrations []Migration) []string {
+	ids := make([]string, len(migrations))
+	for i, m := range migrations {
+		ids[i] = m.ID
+	}
+	return ids
+}
+
+// Run applies the migrations not yet applied to db, in order, and returns the
+// IDs of those applied, or with DryRun, of those which would be. Run stops at
+// the first migration which fails. If another Runner applies a migration to db
+// concurrently, recording it fails with StatusConflict.
+func (r *Runner) Run(ctx context.Context, db *kivik.DB) ([]string, error) {
+	log, err := r.readLog(ctx, db)
+	if err != nil {
+		return nil, err
+	}
+	pending := r.pending(log)
+	if r.opts.DryRun {
+		return migrationIDs(pending), nil
+	}
+	applied := make([]string, 0, len(pending))
+	for i, m := range pending {
+		progress := RunProgress{ID: m.ID, Index: i, Pending: len(pending)}
+		r.report(progress)
+		if err := m.Up(ctx, db); err != nil {
+			return applied, errors.Wrapf(err, "migrate: %s", m.ID)
+		}
+		log.Applied = append(log.Applied, appliedEntry{ID: m.ID, AppliedAt: r.now().UTC()})
+		if log.Rev, err = db.Put(ctx, r.opts.LogID, log); err != nil {
+			return applied, errors.Wrapf(err, "migrate: record %s", m.ID)
+		}
+		applied = append(applied, m.ID)
+		progress.Done = true
+		r.report(progress)
+	}
+	return applied, nil
+}
+
+func (r *Runner) report(progress RunProgress) {
+	if r.opts.Progress != nil {
+		r.opts.Progress(progress)
+	}
+}
+
+// TransformDocs calls fn with each document of db, other than design
+// documents, and saves each document for which fn returns true, having
+// modified it. The number of documents saved is returned. It is intended for
+// use by migrations.
+func TransformDocs(ctx context.Context, db *kivik.DB, fn func(doc map[string]interface{}) (bool, error)) (int, error) {
+	rows, err := db.AllDocs(ctx)
+	if err != nil {
+		return 0, err
+	}
+	defer func() { _ = rows.Close() }()
+	var saved int
+	for rows.Next() {
+		docID := rows.ID()
+		if strings.HasPrefix(docID, "_design/") {
+			continue
+		}
+		row, err := db.Get(ctx, docID)
+		if err != nil {
+			return saved, errors.Wrapf(err, "transform %s", docID)
+		}
+		var doc map[string]interface{}
+		if err = row.ScanDoc(&doc); err != nil {
+			return saved, errors.Wrapf(err, "transform %s", docID)
+		}
+		changed, err := fn(doc)
+		if err != nil {
+			return saved, errors.Wrapf(err, "transform %s", docID)
+		}
+		if !changed {
+			continue
+		}
+		if _, err = db.Put(ctx, docID, doc); err != nil {
+			return saved, errors.Wrapf(err, "transform %s", docID)
+		}
+		saved++
+	}
+	return saved, rows.Err()
+}
@@ -0,0 +1,161 @@
+package migrate
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/flimzy/diff"
+	"github.com/flimzy/kivik"
+)
+
+func TestRunner(t *testing.T) {
+	ctx := context.Background()
+	client := newClient(t)
+	if err := client.CreateDB(ctx, "app"); err != nil {
+		t.Fatal(err)
+	}
+	db, _ := client.DB(ctx, "app")
+	for _, id := range []string{"a", "b", "_design/x"} {
+		if _, err := db.Put(ctx, id, map[string]interface{}{"n": 1}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	var ran []string
+	migrations := []Migration{
+		{ID: "0002_double", Up: func(ctx context.Context, db *kivik.DB) error {
+			ran = append(ran, "0002_double")
+			_, err := TransformDocs(ctx, db, func(doc map[string]interface{}) (bool, error) {
+				doc["n"] = doc["n"].(float64) * 2
+				return true, nil
+			})
+			return err
+		}},
+		{ID: "0001_status", Up: func(ctx context.Context, db *kivik.DB) error {
+			ran = append(ran, "0001_status")
+			n, err := TransformDocs(ctx, db, func(doc map[string]interface{}) (bool, error) {
+				if doc["_id"] == "b" {
+					return false, nil
+				}
+				doc["status"] = "active"
+				return true, nil
+			})
+			if err == nil && n != 1 {
+				err = errors.New("expected 1 document to be transformed")
+			}
+			return err
+		}},
+	}
+
+	dryRun, err := NewRunner(migrations, RunnerOptions{DryRun: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	pending, err := dryRun.Run(ctx, db)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if d := diff.Interface([]string{"0001_status", "0002_double"}, pending); d != "" {
+		t.Errorf("Unexpected dry run:\n%s", d)
+	}
+	if len(ran) != 0 {
+		t.Fatalf("Dry run applied migrations: %v", ran)
+	}
+
+	// Only the first migration is given to this runner, as if the second were
+	// added by a later release.
+	var progress []RunProgress
+	runner, err := NewRunner(migrations[1:], RunnerOptions{Progress: func(p RunProgress) {
+		progress = append(progress, p)
+	}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	runner.now = func() time.Time { return time.Date(2017, 1, 1, 0, 0, 0, 0, time.UTC) }
+	applied, err := runner.Run(ctx, db)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if d := diff.Interface([]string{"0001_status"}, applied); d != "" {
+		t.Error(d)
+	}
+	expectedProgress := []RunProgress{
+		{ID: "0001_status", Pending: 1},
+		{ID: "0001_status", Pending: 1, Done: true},
+	}
+	if d := diff.Interface(expectedProgress, progress); d != "" {
+		t.Error(d)
+	}
+	log, err := runner.readLog(ctx, db)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expectedLog := []appliedEntry{{ID: "0001_status", AppliedAt: runner.now()}}
+	if d := diff.Interface(expectedLog, log.Applied); d != "" {
+		t.Error(d)
+	}
+
+	runner, _ = NewRunner(migrations, RunnerOptions{})
+	applied, err = runner.Run(ctx, db)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if d := diff.Interface([]string{"0002_double"}, applied); d != "" {
+		t.Error(d)
+	}
+	if pending, err := runner.Pending(ctx, db); err != nil || len(pending) != 0 {
+		t.Errorf("Expected no pending migrations, got %v, %v", pending, err)
+	}
+	if applied, err = runner.Run(ctx, db); err != nil || len(applied) != 0 {
+		t.Errorf("Expected no migrations to be applied again, got %v, %v", applied, err)
+	}
+	if d := diff.Interface([]string{"0001_status", "0002_double"}, ran); d != "" {
+		t.Error(d)
+	}
+
+	expected := map[string]map[string]interface{}{
+		"a":         {"n": 2.0, "status": "active"},
+		"b":         {"n": 2.0},
+		"_design/x": {"n": 1.0},
+	}
+	for id, want := range expected {
+		row, err := db.Get(ctx, id)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var doc map[string]interface{}
+		if err := row.ScanDoc(&doc); err != nil {
+			t.Fatal(err)
+		}
+		delete(doc, "_id")
+		delete(doc, "_rev")
+		if d := diff.Interface(want, doc); d != "" {
+			t.Errorf("%s: %s", id, d)
+		}
+	}
+}
+
+func TestNewRunner(t *testing.T) {
+	up := func(_ context.Context, _ *kivik.DB) error { return nil }
+	tests := []struct {
+		name       string
+		migrations []Migration
+		opts       RunnerOptions
+		status     int
+	}{
+		{name: "duplicate", migrations: []Migration{{ID: "1", Up: up}, {ID: "1", Up: up}}, status: kivik.StatusBadRequest},
+		{name: "no ID", migrations: []Migration{{Up: up}}, status: kivik.StatusBadRequest},
+		{name: "no Up", migrations: []Migration{{ID: "1"}}, status: kivik.StatusBadRequest},
+		{name: "non-local log", migrations: []Migration{{ID: "1", Up: up}}, opts: RunnerOptions{LogID: "migrations"}, status: kivik.StatusBadRequest},
+		{name: "valid", migrations: []Migration{{ID: "2", Up: up}, {ID: "1", Up: up}}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			_, err := NewRunner(test.migrations, test.opts)
+			if status := kivik.StatusCode(err); status != test.status {
+				t.Errorf("Expected status %d, got %d (%v)", test.status, status, err)
+			}
+		})
+	}
+}
@@ -0,0 +1,314 @@
+// Package notify provides a hub which follows a database's changes feed, and
+// distributes the changes to any number of subscribers within the process.
+// This allows many parts of an application to be notified of changes, with
+// only a single changes feed open to the server.
+//
+//	hub, err := notify.New(ctx, db, notify.Options{IncludeDocs: true})
+//	sub, err := hub.Subscribe(notify.Filter{IDPrefix: "user:"})
+//	for event := range sub.Events() {
+//	    fmt.Println(event.ID)
+//	}
+//
+// The hub keeps the most recent events, so that a subscriber which has fallen
+// behind, or restarted, may resume without missing any changes, by subscribing
+// with Since set to the last sequence it received.
+package notify
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+	"sync"
+
+	"github.com/flimzy/kivik"
+	"github.com/flimzy/kivik/errors"
+	"github.com/flimzy/kivik/mango"
+)
+
+// Defaults for Options.
+const (
+	DefaultReplaySize = 1000
+	DefaultBufferSize = 100
+)
+
+// Event is a single change to a document.
+type Event struct {
+	ID      string
+	Seq     string
+	Deleted bool
+	// Revs lists the leaf revisions of the document.
+	Revs []string
+	// Doc is the document, if Options.IncludeDocs is set.
+	Doc json.RawMessage
+}
+
+// Options configures a Hub.
+type Options struct {
+	// Since is the sequence from which to begin following the changes feed.
+	// Defaults to "now".
+	Since string
+	// IncludeDocs includes the document with each event. This is required to
+	// filter by selector.
+	IncludeDocs bool
+	// ReplaySize is the number of recent events retained for replay. Defaults
+	// to DefaultReplaySize.
+	ReplaySize int
+	// BufferSize is the number of events buffered for each subscriber.
+	// Defaults to DefaultBufferSize.
+	BufferSize int
+}
+
+// Filter selects the events delivered to a subscriber. All non-zero criteria
+// must match.
+type Filter struct {
+	// IDPrefix selects documents whose IDs begin with the prefix.
+	IDPrefix string
+	// Selector is a Mango selector, such as a *mango.Selector, selecting
+	// documents by content. Deleted documents never match a selector.
+	Selector interface{}
+	// Since, if set, replays the retained events which followed the event with
+	// this sequence, before any new events.
+	Since string
+}
+
+// Errors returned by the subscription's Err method.
+var (
+	// ErrSlowSubscriber is returned when a subscription is closed because it
+	// did not keep up with the changes feed. The subscriber may resubscribe
+	// with Since set to the last sequence received.
+	ErrSlowSubscriber = errors.New("notify: subscriber too slow")
+	// ErrClosed is returned when the hub is closed.
+	ErrClosed = errors.New("notify: hub closed")
+)
+
+// Hub follows a changes feed, and distributes events to subscribers.
+type Hub struct {
+	changes *kivik.Changes
+	opts    Options
+	cancel  func()
+	done    chan struct{}
+
+	mu      sync.Mutex
+	closing bool
+	subs    map[*Subscription]struct{}
+	replay  []Event
+	err     error
+}
+
+// New opens the changes feed of db, and returns a hub which distributes its
+// events. The feed is followed until ctx is canceled, or Close is called.
+func New(ctx context.Context, db *kivik.DB, opts Options) (*Hub, error) {
+	if opts.Since == "" {
+		opts.Since = "now"
+	}
+	if opts.ReplaySize <= 0 {
+		opts.ReplaySize = DefaultReplaySize
+	}
+	if opts.BufferSize <= 0 {
+		opts.BufferSize = DefaultBufferSize
+	}
+	changesOpts := kivik.Options{
+		"feed":  "continuous",
+		"since": opts.Since,
+	}
+	if opts.IncludeDocs {
+		changesOpts["include_docs"] = true
+	}
+	// The feed is stopped by canceling its context, as an iterator cannot be
+	// closed while a call to Next is blocked.
+	ctx, cancel := context.WithCancel(ctx)
+	changes, err := db.Changes(ctx, changesOpts)
+	if err != nil {
+		cancel()
+		return nil, err
+	}
+	h := &Hub{
+		changes: changes,
+		opts:    opts,
+		cancel:  cancel,
+		done:    make(chan struct{}),
+		subs:    make(map[*Subscription]struct{}),
+	}
+	go h.run()
+	return h, nil
+}
+
+func (h *Hub) run() {
+	defer close(h.done)
+	defer h.cancel()
+	for h.changes.Next() {
+		event := Event{
+			ID:      h.changes.ID(),
+			Seq:     string(h.changes.Seq()),
+			Deleted: h.changes.Deleted(),
+			Revs:    h.changes.Changes(),
+		}
+		if h.opts.IncludeDocs {
+			var doc json.RawMessage
+			if err := h.changes.ScanDoc(&doc); err == nil && string(doc) != "null" {
+				event.Doc = doc
+			}
+		}
+		h.publish(event)
+	}
+	_ = h.changes.Close()
+	err := h.changes.Err()
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if err == nil || h.closing {
+		err = ErrClosed
+	}
+	h.err = err
+	for sub := range h.subs {
+		sub.close(err)
+	}
+	h.subs = nil
+}
+
+func (h *Hub) publish(event Event) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.replay = append(h.replay, event)
+	if len(h.replay) > h.opts.ReplaySize {
+		h.replay = h.replay[len(h.replay)-h.opts.ReplaySize:]
+	}
+	for sub := range h.subs {
+		if !sub.matches(event) {
+			continue
+		}
+		select {
+		case sub.events <- event:
+		default:
+			delete(h.subs, sub)
+			sub.close(ErrSlowSubscriber)
+		}
+	}
+}
+
+// Err returns the error which ended the changes feed, or ErrClosed if it was
+// closed without error. It returns nil while the feed remains open.
+func (h *Hub) Err() error {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return h.err
+}
+
+// Close closes the changes feed, and all subscriptions, and waits for the hub
+// to stop.
+func (h *Hub) Close() error {
+	h.mu.Lock()
+	h.closing = true
+	h.mu.Unlock()
+	h.cancel()
+	<-h.done
+	return nil
+}
+
+// Subscribe returns a new subscription to events matching filter. An error
+// with status StatusBadRequest is returned if the filter is invalid, if it
+// includes a selector but the hub does not include documents, or if the
+// requested sequence is no longer retained for replay.
+func (h *Hub) Subscribe(filter Filter) (*Subscription, error) {
+	sub := &Subscription{filter: filter}
+	if filter.Selector != nil {
+		if !h.opts.IncludeDocs {
+			return nil, errors.Status(kivik.StatusBadRequest, "notify: selector filters require IncludeDocs")
+		}
+		matcher, err := mango.NewMatcher(filter.Selector)
+		if err != nil {
+			return nil, err
+		}
+		sub.matcher = matcher
+	}
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.subs == nil {
+		return nil, h.err
+	}
+	var replay []Event
+	if filter.Since != "" {
+		i := len(h.replay) - 1
+		for ; i >= 0; i-- {
+			if h.replay[i].Seq == filter.Since {
+				break
+			}
+		}
+		if i < 0 {
+			return nil, errors.Statusf(kivik.StatusBadRequest, "notify: sequence %q is not available for replay", filter.Since)
+		}
+		for _, event := range h.replay[i+1:] {
+			if sub.matches(event) {
+				replay = append(replay, event)
+			}
+		}
+	}
+	sub.events = make(chan Event, len(replay)+h.opts.BufferSize)
+	for _, event := range replay {
+		sub.events <- event
+	}
+	sub.hub = h
+	h.subs[sub] = struct{}{}
+	return sub, nil
+}
+
+// Subscription receives the events matching a filter.
+type Subscription struct {
+	hub     *Hub
+	filter  Filter
+	matcher *mango.Matcher
+	events  chan Event
+
+	// The remaining fields are protected by the hub's mutex.
+	closed bool
+	err    error
+}
+
+// Events returns the channel on which events are delivered. The channel is
+// closed when the subscription ends; Err then returns the reason.
+func (s *Subscription) Events() <-chan Event {
+	return s.events
+}
+
+// Err returns the reason the subscription ended, or nil if it was closed by
+// calling Close, or is still active.
+func (s *Subscription) Err() error {
+	s.hub.mu.Lock()
+	defer s.hub.mu.Unlock()
+	return s.err
+}
+
+// Close ends the subscription. Calling Close more than once has no effect.
+func (s *Subscription) Close() error {
+	s.hub.mu.Lock()
+	defer s.hub.mu.Unlock()
+	if s.hub.subs != nil {
+		delete(s.hub.subs, s)
+	}
+	s.close(nil)
+	return nil
+}
+
+// close closes the events channel, recording err. It must be called with the
+// hub's mutex held.
+func (s *Subscription) close(err error) {
+	if s.closed {
+		return
+	}
+	s.closed = true
+	s.err = err
+	close(s.events)
+}
+
+func (s *Subscription) matches(event Event) bool {
+	if !strings.HasPrefix(event.ID, s.filter.IDPrefix) {
+		return false
+	}
+	if s.matcher == nil {
+		return true
+	}
+	if event.Deleted || event.Doc == nil {
+		return false
+	}
+	matched, err := s.matcher.Match(event.Doc)
+	return err == nil && matched
+}
@@ -0,0 +1,211 @@
+package notify
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/flimzy/diff"
+	"github.com/flimzy/kivik"
+	"github.com/flimzy/kivik/driver"
+	"github.com/flimzy/kivik/mango"
+)
+
+// feedDriver serves a changes feed from a channel, shared by all clients.
+type feedDriver struct {
+	feed chan *driver.Change
+	opts chan map[string]interface{}
+}
+
+func (d *feedDriver) NewClient(_ context.Context, _ string) (driver.Client, error) {
+	return &feedClient{drv: d}, nil
+}
+
+type feedClient struct {
+	driver.Client
+	drv *feedDriver
+}
+
+func (c *feedClient) DB(_ context.Context, _ string, _ map[string]interface{}) (driver.DB, error) {
+	return &feedDB{drv: c.drv}, nil
+}
+
+type feedDB struct {
+	driver.DB
+	drv *feedDriver
+}
+
+func (d *feedDB) Changes(ctx context.Context, opts map[string]interface{}) (driver.Changes, error) {
+	d.drv.opts <- opts
+	return &feedChanges{ctx: ctx, feed: d.drv.feed}, nil
+}
+
+type feedChanges struct {
+	ctx  context.Context
+	feed chan *driver.Change
+}
+
+func (c *feedChanges) Next(change *driver.Change) error {
+	select {
+	case <-c.ctx.Done():
+		return c.ctx.Err()
+	case ch := <-c.feed:
+		*change = *ch
+		return nil
+	}
+}
+
+func (c *feedChanges) Close() error { return nil }
+
+var testDriver = &feedDriver{
+	feed: make(chan *driver.Change),
+	opts: make(chan map[string]interface{}, 1),
+}
+
+func init() {
+	kivik.Register("notify-test", testDriver)
+}
+
+func newTestHub(t *testing.T, opts Options) *Hub {
+	client, err := kivik.New(context.Background(), "notify-test", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	db, err := client.DB(context.Background(), "foo")
+	if err != nil {
+		t.Fatal(err)
+	}
+	hub, err := New(context.Background(), db, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	<-testDriver.opts
+	return hub
+}
+
+func change(seq int, id string, doc string) *driver.Change {
+	c := &driver.Change{ID: id, Seq: driver.SequenceID(fmt.Sprintf("%d-x", seq)), Changes: []string{"1-xxx"}}
+	if doc != "" {
+		c.Doc = json.RawMessage(doc)
+	}
+	return c
+}
+
+// next returns the ID of the next event from sub, or "" if sub is closed.
+func next(t *testing.T, sub *Subscription) string {
+	select {
+	case event, ok := <-sub.Events():
+		if !ok {
+			return ""
+		}
+		return event.ID
+	case <-time.After(time.Second):
+		t.Fatal("Timed out waiting for event")
+	}
+	return ""
+}
+
+func TestHub(t *testing.T) {
+	hub := newTestHub(t, Options{IncludeDocs: true})
+	all, err := hub.Subscribe(Filter{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	users, err := hub.Subscribe(Filter{IDPrefix: "user:"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	admins, err := hub.Subscribe(Filter{IDPrefix: "user:", Selector: mango.Field("admin").Eq(true)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	testDriver.feed <- change(1, "user:alice", `{"_id":"user:alice","admin":true}`)
+	testDriver.feed <- change(2, "user:bob", `{"_id":"user:bob","admin":false}`)
+	testDriver.feed <- change(3, "post:1", `{"_id":"post:1","admin":true}`)
+
+	var results []string
+	for i := 0; i < 3; i++ {
+		results = append(results, next(t, all))
+	}
+	for i := 0; i < 2; i++ {
+		results = append(results, next(t, users))
+	}
+	results = append(results, next(t, admins))
+	expected := []string{"user:alice", "user:bob", "post:1", "user:alice", "user:bob", "user:alice"}
+	if d := diff.TextSlices(expected, results); d != "" {
+		t.Error(d)
+	}
+
+	t.Run("Replay", func(t *testing.T) {
+		replay, err := hub.Subscribe(Filter{Since: "1-x"})
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer func() { _ = replay.Close() }()
+		for _, id := range []string{"user:bob", "post:1"} {
+			if result := next(t, replay); result != id {
+				t.Errorf("Expected %s, got %s", id, result)
+			}
+		}
+	})
+	t.Run("ReplayUnavailable", func(t *testing.T) {
+		if _, err := hub.Subscribe(Filter{Since: "0-x"}); kivik.StatusCode(err) != kivik.StatusBadRequest {
+			t.Errorf("Unexpected error: %v", err)
+		}
+	})
+	t.Run("Unsubscribe", func(t *testing.T) {
+		if err := users.Close(); err != nil {
+			t.Fatal(err)
+		}
+		if id := next(t, users); id != "" {
+			t.Errorf("Unexpected event %s", id)
+		}
+		if err := users.Err(); err != nil {
+			t.Errorf("Unexpected error: %s", err)
+		}
+	})
+
+	if err := hub.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if id := next(t, all); id != "" {
+		t.Errorf("Unexpected event %s", id)
+	}
+	if err := all.Err(); err != ErrClosed {
+		t.Errorf("Unexpected error: %v", err)
+	}
+	if _, err := hub.Subscribe(Filter{}); err != ErrClosed {
+		t.Errorf("Unexpected error: %v", err)
+	}
+}
+
+func TestSlowSubscriber(t *testing.T) {
+	hub := newTestHub(t, Options{BufferSize: 1})
+	defer func() { _ = hub.Close() }()
+	sub, err := hub.Subscribe(Filter{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	testDriver.feed <- change(1, "a", "")
+	testDriver.feed <- change(2, "b", "")
+	testDriver.feed <- change(3, "c", "")
+	if id := next(t, sub); id != "a" {
+		t.Errorf("Unexpected event %s", id)
+	}
+	if id := next(t, sub); id != "" {
+		t.Errorf("Unexpected event %s", id)
+	}
+	if err := sub.Err(); err != ErrSlowSubscriber {
+		t.Errorf("Unexpected error: %v", err)
+	}
+}
+
+func TestSelectorRequiresDocs(t *testing.T) {
+	hub := newTestHub(t, Options{})
+	defer func() { _ = hub.Close() }()
+	if _, err := hub.Subscribe(Filter{Selector: mango.Field("a").Eq(1)}); kivik.StatusCode(err) != kivik.StatusBadRequest {
+		t.Errorf("Unexpected error: %v", err)
+	}
+}
@@ -0,0 +1,107 @@
+package kivik
+
+import (
+	"context"
+	"encoding/json"
+
+	"github.com/flimzy/kivik/driver"
+	"github.com/flimzy/kivik/errors"
+)
+
+// OpenRev is a single revision of a document, as returned by GetOpenRevs.
+type OpenRev struct {
+	// Rev is the revision.
+	Rev string
+	// Missing is true if the revision does not exist, or its body has been
+	// removed by compaction.
+	Missing bool
+	doc     json.RawMessage
+}
+
+// ScanDoc unmarshals the document at the revision into dest. An error with
+// status StatusNotFound is returned if the revision is missing.
+func (r *OpenRev) ScanDoc(dest interface{}) error {
+	if r.Missing {
+		return errors.Statusf(StatusNotFound, "kivik: revision %s is missing", r.Rev)
+	}
+	return scan(dest, r.doc)
+}
+
+// GetOpenRevs fetches the requested revisions of a document, in the order
+// requested, including revisions in conflict. If revs is nil, all leaf
+// revisions are returned, including deleted leaves if supported by the driver.
+// Requested revisions which do not exist are returned with Missing set.
+//
+// If the driver does not support fetching multiple revisions, each is fetched
+// with Get, and the leaf revisions are those listed in the _conflicts field of
+// the current revision.
+//
+// See http://docs.couchdb.org/en/2.0.0/api/document/common.html#get--db-docid
+func (db *DB) GetOpenRevs(ctx context.Context, docID string, revs []string, options ...Options) ([]*OpenRev, error) {
+	ctx, cancel := withTimeout(ctx, db.timeouts.Read)
+	defer cancel()
+	opts, err := db.options(ctx, "GetOpenRevs", options...)
+	if err != nil {
+		return nil, err
+	}
+	if getter, ok := db.driverDB.(driver.OpenRevsGetter); ok {
+		result, err := db.invoke(ctx, &Operation{Name: "GetOpenRevs", DocID: docID, Options: opts}, func(ctx context.Context, op *Operation) (interface{}, error) {
+			return getter.GetOpenRevs(ctx, docID, revs, op.Options)
+		})
+		if errors.StatusCode(err) != StatusNotImplemented {
+			if err != nil {
+				return nil, err
+			}
+			openRevs, ok := result.([]driver.OpenRev)
+			if !ok {
+				return nil, unexpectedResult("GetOpenRevs", result)
+			}
+			result := make([]*OpenRev, len(openRevs))
+			for i, r := range openRevs {
+				result[i] = &OpenRev{Rev: r.Rev, Missing: r.Doc == nil, doc: r.Doc}
+			}
+			return result, nil
+		}
+	}
+	if revs == nil {
+		if revs, err = db.leafRevs(ctx, docID); err != nil {
+			return nil, err
+		}
+	}
+	result := make([]*OpenRev, 0, len(revs))
+	for _, rev := range revs {
+		revOpts := Options{"rev": rev}
+		for key, value := range opts {
+			revOpts[key] = value
+		}
+		openRev := &OpenRev{Rev: rev}
+		row, err := db.Get(ctx, docID, revOpts)
+		switch {
+		case StatusCode(err) == StatusNotFound:
+			openRev.Missing = true
+		case err != nil:
+			return nil, err
+		default:
+			openRev.doc = row.doc
+		}
+		result = append(result, openRev)
+	}
+	return result, nil
+}
+
+// leafRevs returns the current revision of a document and those in conflict
+// with it.
+func (db *DB) leafRevs(ctx context.Context, docID string) ([]string, error) {
+	row, err := db.Get(ctx, docID, Options{"conflicts": true})
+	if err != nil {
+		return nil, err
+	}
+	var doc struct {
+		Rev       string   `json:"_rev"`
+		Conflicts []string `json:"_conflicts"`
+	}
+	if err = row.ScanDoc(&doc); err != nil {
+		return nil, err
+	}
+	return append([]string{doc.Rev}, doc.Conflicts...), nil
+}
@@ -0,0 +1,110 @@
+package kivik
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+
+	"github.com/flimzy/diff"
+	"github.com/flimzy/kivik/driver"
+	"github.com/flimzy/kivik/errors"
+)
+
+// revsDB stores the revisions of a single document, the first of which is
+// current.
+type revsDB struct {
+	dummyDB
+	revs []string
+}
+
+func (db *revsDB) Get(_ context.Context, _ string, opts map[string]interface{}) (json.RawMessage, error) {
+	rev, _ := opts["rev"].(string)
+	if rev == "" {
+		doc := map[string]interface{}{"_rev": db.revs[0]}
+		if opts["conflicts"] == true {
+			doc["_conflicts"] = db.revs[1:]
+		}
+		return json.Marshal(doc)
+	}
+	for _, r := range db.revs {
+		if r == rev {
+			return json.Marshal(map[string]string{"_rev": rev})
+		}
+	}
+	return nil, errors.Status(StatusNotFound, "missing")
+}
+
+type openRevsDB struct {
+	*revsDB
+}
+
+func (db *openRevsDB) GetOpenRevs(_ context.Context, _ string, revs []string, _ map[string]interface{}) ([]driver.OpenRev, error) {
+	var result []driver.OpenRev
+	for _, rev := range revs {
+		result = append(result, driver.OpenRev{Rev: rev})
+	}
+	return result, nil
+}
+
+func TestGetOpenRevs(t *testing.T) {
+	type openRev struct {
+		Rev     string
+		Missing bool
+		DocRev  string
+	}
+	base := &revsDB{revs: []string{"2-bbb", "2-ccc"}}
+	tests := []struct {
+		name     string
+		db       driver.DB
+		revs     []string
+		expected []openRev
+	}{
+		{
+			name: "EmulatedAll",
+			db:   base,
+			expected: []openRev{
+				{Rev: "2-bbb", DocRev: "2-bbb"},
+				{Rev: "2-ccc", DocRev: "2-ccc"},
+			},
+		},
+		{
+			name: "EmulatedRevs",
+			db:   base,
+			revs: []string{"2-ccc", "1-aaa"},
+			expected: []openRev{
+				{Rev: "2-ccc", DocRev: "2-ccc"},
+				{Rev: "1-aaa", Missing: true},
+			},
+		},
+		{
+			name: "Driver",
+			db:   &openRevsDB{base},
+			revs: []string{"3-ddd"},
+			expected: []openRev{
+				{Rev: "3-ddd", Missing: true},
+			},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			db := &DB{driverDB: test.db}
+			openRevs, err := db.GetOpenRevs(context.Background(), "foo", test.revs)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var result []openRev
+			for _, r := range openRevs {
+				var doc struct {
+					Rev string `json:"_rev"`
+				}
+				if err := r.ScanDoc(&doc); err != nil && !r.Missing {
+					t.Fatal(err)
+				}
+				result = append(result, openRev{Rev: r.Rev, Missing: r.Missing, DocRev: doc.Rev})
+			}
+			if d := diff.Interface(test.expected, result); d != "" {
+				t.Error(d)
+			}
+		})
+	}
+}
@@ -0,0 +1,100 @@
+package kivik
+
+import "reflect"
+
+// mergeOptions merges otherOpts into a new Options, with later values
+// overwriting earlier ones. Nil values are ignored, and nested maps are merged
+// with those of the same key. The result is never one of otherOpts, so may be
+// modified by the caller. mergeOptions is called by every method which takes
+// options, so it avoids allocating where it can: nil is returned if there are
+// no options, and a single Options is copied without merging.
+func mergeOptions(otherOpts ...Options) (Options, error) {
+	var size, count int
+	var last Options
+	for _, opts := range otherOpts {
+		if len(opts) > 0 {
+			size += len(opts)
+			count++
+			last = opts
+		}
+	}
+	switch count {
+	case 0:
+		return nil, nil
+	case 1:
+		options := make(Options, len(last))
+		for key, value := range last {
+			if !isNilValue(value) {
+				options[key] = value
+			}
+		}
+		return options, nil
+	}
+	options := make(Options, size)
+	for _, opts := range otherOpts {
+		for key, value := range opts {
+			if isNilValue(value) {
+				continue
+			}
+			if existing, ok := options[key]; ok {
+				if merged, ok := mergeMaps(existing, value); ok {
+					options[key] = merged
+					continue
+				}
+			}
+			options[key] = value
+		}
+	}
+	return options, nil
+}
+
+// mergeMaps returns the merge of two nested option maps, without modifying
+// either, and true, or false if either is not a map.
+func mergeMaps(dst, src interface{}) (interface{}, bool) {
+	d, ok := asMap(dst)
+	if !ok {
+		return nil, false
+	}
+	s, ok := asMap(src)
+	if !ok {
+		return nil, false
+	}
+	merged, _ := mergeOptions(d, s)
+	if _, isOptions := src.(Options); isOptions {
+		return merged, true
+	}
+	return map[string]interface{}(merged), true
+}
+
+func asMap(i interface{}) (Options, bool) {
+	switch t := i.(type) {
+	case Options:
+		return t, true
+	case map[string]interface{}:
+		return Options(t), true
+	}
+	return nil, false
+}
+
+// isNilValue returns true if i is nil, or a nil map, slice, pointer,
+// function, channel or interface.
+func isNilValue(i interface{}) bool {
+	if i == nil {
+		return true
+	}
+	switch t := i.(type) {
+	case string, bool, int, int64, float64:
+		// Avoid reflection for the most common option types.
+		return false
+	case map[string]interface{}:
+		return t == nil
+	case []string:
+		return t == nil
+	}
+	v := reflect.ValueOf(i)
+	switch v.Kind() {
+	case reflect.Map, reflect.Slice, reflect.Ptr, reflect.Func, reflect.Chan, reflect.Interface:
+		return v.IsNil()
+	}
+	return false
+}
@@ -0,0 +1,99 @@
+package kivik
+
+import (
+	"testing"
+
+	"github.com/flimzy/diff"
+)
+
+func TestMergeOptions(t *testing.T) {
+	tests := []struct {
+		name     string
+		options  []Options
+		expected Options
+	}{
+		{
+			name: "None",
+		},
+		{
+			name:    "Empty",
+			options: []Options{{}, nil},
+		},
+		{
+			name:     "Single",
+			options:  []Options{nil, {"foo": "bar", "baz": nil}},
+			expected: Options{"foo": "bar"},
+		},
+		{
+			name: "Overwrite",
+			options: []Options{
+				{"foo": "bar", "limit": 1},
+				{"limit": 2, "skip": 3},
+			},
+			expected: Options{"foo": "bar", "limit": 2, "skip": 3},
+		},
+		{
+			name: "NilIgnored",
+			options: []Options{
+				{"foo": "bar", "keys": []string{"a"}},
+				{"foo": nil, "keys": []string(nil)},
+			},
+			expected: Options{"foo": "bar", "keys": []string{"a"}},
+		},
+		{
+			name: "NestedMaps",
+			options: []Options{
+				{"query": map[string]interface{}{"a": 1, "b": 2}},
+				{"query": map[string]interface{}{"b": 3}},
+			},
+			expected: Options{"query": map[string]interface{}{"a": 1, "b": 3}},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			result, err := mergeOptions(test.options...)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if d := diff.Interface(test.expected, result); d != "" {
+				t.Error(d)
+			}
+		})
+	}
+}
+
+func TestMergeOptionsCopies(t *testing.T) {
+	nested := map[string]interface{}{"a": 1}
+	opts := Options{"foo": "bar", "query": nested}
+	result, _ := mergeOptions(opts)
+	result["foo"] = "baz"
+	result, _ = mergeOptions(opts, Options{"query": map[string]interface{}{"a": 2}})
+	result["query"].(map[string]interface{})["b"] = 3
+	if opts["foo"] != "bar" || len(nested) != 1 || nested["a"] != 1 {
+		t.Errorf("Input options were modified: %v", opts)
+	}
+}
+
+func BenchmarkMergeOptions(b *testing.B) {
+	benchmarks := []struct {
+		name    string
+		options []Options
+	}{
+		{name: "None"},
+		{name: "Single", options: []Options{{"include_docs": true, "limit": 10}}},
+		{name: "Multiple", options: []Options{
+			{"include_docs": true, "limit": 10},
+			{"startkey": `"a"`, "endkey": `"b"`},
+		}},
+	}
+	for _, bm := range benchmarks {
+		b.Run(bm.name, func(b *testing.B) {
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				if _, err := mergeOptions(bm.options...); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
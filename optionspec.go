@@ -0,0 +1,140 @@
+package kivik
+
+import (
+	"context"
+	"math"
+	"reflect"
+	"strings"
+
+	"github.com/flimzy/kivik/driver"
+	"github.com/flimzy/kivik/errors"
+)
+
+var optionTypeNames = map[driver.OptionType]string{
+	driver.OptionString:      "string",
+	driver.OptionBool:        "bool",
+	driver.OptionInt:         "integer",
+	driver.OptionStringSlice: "[]string",
+}
+
+// options merges the options of ctx and options, and validates them against
+// those supported by method, if declared by the driver.
+func (c *Client) options(ctx context.Context, method string, options ...Options) (Options, error) {
+	if ctxOpts := contextOptions(ctx); ctxOpts != nil {
+		options = append([]Options{applicableOptions(c.driverClient, method, ctxOpts)}, options...)
+	}
+	opts, err := mergeOptions(options...)
+	if err != nil {
+		return nil, err
+	}
+	return opts, validateOptions(c.driverClient, method, opts)
+}
+
+// options merges the DB's defaults, the options of ctx and options, and
+// validates them against those supported by method, if declared by the driver.
+func (db *DB) options(ctx context.Context, method string, options ...Options) (Options, error) {
+	if ctxOpts := contextOptions(ctx); ctxOpts != nil {
+		options = append([]Options{applicableOptions(db.driverDB, method, ctxOpts)}, options...)
+	}
+	if db.defaults != nil {
+		options = append([]Options{db.defaults.forMethod(db.driverDB, method)}, options...)
+	}
+	opts, err := mergeOptions(options...)
+	if err != nil {
+		return nil, err
+	}
+	return opts, validateOptions(db.driverDB, method, opts)
+}
+
+// applicableOptions returns those of opts which are supported by method, if
+// declared by i, as with driver.OptionValidator. If i declares no options for
+// method, opts are returned if the method takes options, and otherwise only
+// those consumed by kivik, so that context and default options never require
+// an optional interface, such as driver.OptsDeleter, which i lacks.
+func applicableOptions(i interface{}, method string, opts Options) Options {
+	var supported map[string]driver.OptionType
+	declared := false
+	if validator, ok := i.(driver.OptionValidator); ok {
+		supported, declared = validator.SupportedOptions(method)
+	}
+	if !declared && takesOptions(i, method) {
+		return opts
+	}
+	result := make(Options, len(opts))
+	for key, value := range opts {
+		if _, ok := supported[key]; ok || strings.HasPrefix(key, clientOptionPrefix) {
+			result[key] = value
+		}
+	}
+	return result
+}
+
+// takesOptions returns false if options passed to method require an optional
+// interface which i does not implement.
+func takesOptions(i interface{}, method string) bool {
+	var ok bool
+	switch method {
+	case "Put":
+		_, ok = i.(driver.OptsPutter)
+	case "Delete":
+		_, ok = i.(driver.OptsDeleter)
+	case "CreateDoc":
+		_, ok = i.(driver.OptsDocCreator)
+	case "BulkDocs":
+		_, ok = i.(driver.OptsBulkDocer)
+	default:
+		ok = true
+	}
+	return ok
+}
+
+// validateOptions validates opts, if i implements driver.OptionValidator.
+func validateOptions(i interface{}, method string, opts Options) error {
+	validator, ok := i.(driver.OptionValidator)
+	if !ok || len(opts) == 0 {
+		return nil
+	}
+	supported, ok := validator.SupportedOptions(method)
+	if !ok {
+		return nil
+	}
+	for key, value := range opts {
+		if strings.HasPrefix(key, clientOptionPrefix) {
+			// Consumed by kivik, rather than the driver.
+			continue
+		}
+		optType, ok := supported[key]
+		if !ok {
+			return errors.Statusf(StatusBadRequest, "kivik: unsupported option '%s' for %s", key, method)
+		}
+		if !isOptionType(value, optType) {
+			return errors.Statusf(StatusBadRequest, "kivik: option '%s' for %s must be of type %s, not %T", key, method, optionTypeNames[optType], value)
+		}
+	}
+	return nil
+}
+
+func isOptionType(value interface{}, optType driver.OptionType) bool {
+	switch optType {
+	case driver.OptionString:
+		_, ok := value.(string)
+		return ok
+	case driver.OptionBool:
+		_, ok := value.(bool)
+		return ok
+	case driver.OptionInt:
+		if f, ok := value.(float64); ok {
+			return f == math.Trunc(f)
+		}
+		switch reflect.ValueOf(value).Kind() {
+		case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+			reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+			return true
+		}
+		return false
+	case driver.OptionStringSlice:
+		_, ok := value.([]string)
+		return ok
+	}
+	return true
+}
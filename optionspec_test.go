@@ -0,0 +1,83 @@
+package kivik
+
+import (
+	"context"
+	"testing"
+
+	"github.com/flimzy/kivik/driver"
+)
+
+type validatorDB struct {
+	revsInfoDB
+}
+
+var _ driver.OptionValidator = &validatorDB{}
+
+func (db *validatorDB) SupportedOptions(method string) (map[string]driver.OptionType, bool) {
+	if method != "Get" {
+		return nil, false
+	}
+	return map[string]driver.OptionType{
+		"rev":       driver.OptionString,
+		"conflicts": driver.OptionBool,
+		"limit":     driver.OptionInt,
+		"keys":      driver.OptionStringSlice,
+		"any":       driver.OptionAny,
+	}, true
+}
+
+func TestValidateOptions(t *testing.T) {
+	tests := []struct {
+		name    string
+		options Options
+		status  int
+	}{
+		{
+			name: "NoOptions",
+		},
+		{
+			name: "Valid",
+			options: Options{
+				"rev":       "1-xxx",
+				"conflicts": true,
+				"limit":     int64(10),
+				"keys":      []string{"a"},
+				"any":       struct{}{},
+			},
+		},
+		{
+			name:    "JSONInteger",
+			options: Options{"limit": float64(10)},
+		},
+		{
+			name:    "Fraction",
+			options: Options{"limit": 1.5},
+			status:  StatusBadRequest,
+		},
+		{
+			name:    "Unknown",
+			options: Options{"revs": true},
+			status:  StatusBadRequest,
+		},
+		{
+			name:    "Mistyped",
+			options: Options{"conflicts": "true"},
+			status:  StatusBadRequest,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			db := &DB{driverDB: &validatorDB{revsInfoDB{doc: `{}`}}}
+			_, err := db.Get(context.Background(), "foo", test.options)
+			if StatusCode(err) != test.status {
+				t.Errorf("Unexpected error: %v", err)
+			}
+		})
+	}
+	t.Run("Undeclared", func(t *testing.T) {
+		db := &DB{driverDB: &validatorDB{}}
+		if _, err := db.AllDocs(context.Background(), Options{"foo": "bar"}); err != nil {
+			t.Errorf("Unexpected error: %s", err)
+		}
+	})
+}
@@ -0,0 +1,327 @@
+// Package outbox provides offline tolerance for writes to a remote database.
+//
+// Writes are sent to the remote database when it can be reached. Otherwise
+// they are recorded in a local queue database, such as one provided by the
+// memory driver, and replayed in order by Sync once the remote database can be
+// reached again. While any writes remain queued, new writes are queued behind
+// them, so that the order of writes is preserved.
+//
+//	local, _ := kivik.New(ctx, "memory", "")
+//	_ = local.CreateDB(ctx, "outbox")
+//	queue, _ := local.DB(ctx, "outbox")
+//	ob, err := outbox.New(ctx, remote, queue, outbox.Options{})
+//	rev, err := ob.Put(ctx, "foo", doc) // rev is empty if the write was queued
+//	...
+//	conflicts, err := ob.Sync(ctx)
+//
+// A queued write cannot return the new revision of the document, so to update
+// the same document again while offline, the caller passes the last revision
+// it knows, as though the queued write had not happened. When the writes are
+// replayed, such a write is rebased onto the revision created by the previous
+// write to the document.
+//
+// Writes which the remote database rejects on replay, usually with
+// StatusConflict because the document was changed by another client, are
+// removed from the queue and reported to the caller of Sync.
+package outbox
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/url"
+	"sync"
+	"time"
+
+	"github.com/flimzy/kivik"
+	"github.com/flimzy/kivik/errors"
+)
+
+// Write operations.
+const (
+	OpPut    = "put"
+	OpDelete = "delete"
+)
+
+// stateID is the ID of the queue document which records the queue's bounds.
+const stateID = "outbox"
+
+// Options configures an Outbox.
+type Options struct {
+	// Unreachable reports whether err means the remote database could not be
+	// reached, so that the write should be queued. Defaults to IsUnreachable.
+	Unreachable func(error) bool
+}
+
+// Write is a queued write.
+type Write struct {
+	// Seq is the position of the write in the queue.
+	Seq int64
+	// Op is OpPut or OpDelete.
+	Op    string
+	DocID string
+	// Rev is the revision on which the write is based.
+	Rev string
+	// Doc is the document, for OpPut.
+	Doc json.RawMessage
+}
+
+// Conflict is a queued write which was rejected by the remote database.
+type Conflict struct {
+	Write
+	// Err is the error returned by the remote database.
+	Err error
+}
+
+// Outbox sends writes to a remote database, queueing them while it cannot be
+// reached.
+type Outbox struct {
+	remote *kivik.DB
+	queue  *kivik.DB
+	opts   Options
+
+	mu    sync.Mutex
+	state state
+}
+
+// state is the queue document with ID stateID. Writes First to Next-1 are
+// queued.
+type state struct {
+	Rev   string `json:"_rev,omitempty"`
+	First int64  `json:"first"`
+	Next  int64  `json:"next"`
+	// Rebase maps document IDs to the last replayed write for the document.
+	Rebase map[string]rebase `json:"rebase,omitempty"`
+}
+
+// rebase records that the write based on From created revision To.
+type rebase struct {
+	From string `json:"from"`
+	To   string `json:"to"`
+}
+
+// entry is the queue document for a single write.
+type entry struct {
+	Rev   string          `json:"_rev,omitempty"`
+	Op    string          `json:"op"`
+	DocID string          `json:"doc_id"`
+	Base  string          `json:"base_rev,omitempty"`
+	Doc   json.RawMessage `json:"doc,omitempty"`
+}
+
+func entryID(seq int64) string {
+	return fmt.Sprintf("outbox:%016d", seq)
+}
+
+// New returns an outbox which sends writes to remote, and queues them in
+// queue. Any writes already queued in queue are retained.
+func New(ctx context.Context, remote, queue *kivik.DB, opts Options) (*Outbox, error) {
+	if opts.Unreachable == nil {
+		opts.Unreachable = IsUnreachable
+	}
+	o := &Outbox{remote: remote, queue: queue, opts: opts}
+	row, err := queue.Get(ctx, stateID)
+	if kivik.StatusCode(err) == kivik.StatusNotFound {
+		return o, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := row.ScanDoc(&o.state); err != nil {
+		return nil, err
+	}
+	return o, nil
+}
+
+// Pending returns the number of queued writes.
+func (o *Outbox) Pending() int {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	return int(o.state.Next - o.state.First)
+}
+
+// Put creates or updates a document, as kivik.DB.Put. If the write was queued,
+// rev is empty.
+func (o *Outbox) Put(ctx context.Context, docID string, doc interface{}) (rev string, err error) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	if o.state.Next == o.state.First {
+		rev, err = o.remote.Put(ctx, docID, doc)
+		if err == nil || !o.opts.Unreachable(err) {
+			return rev, err
+		}
+	}
+	body, err := json.Marshal(doc)
+	if err != nil {
+		return "", errors.WrapStatus(kivik.StatusBadRequest, err)
+	}
+	var meta struct {
+		Rev string `json:"_rev"`
+	}
+	if err := json.Unmarshal(body, &meta); err != nil {
+		return "", errors.WrapStatus(kivik.StatusBadRequest, err)
+	}
+	return "", o.enqueue(ctx, &entry{Op: OpPut, DocID: docID, Base: meta.Rev, Doc: body})
+}
+
+// Delete marks a document as deleted, as kivik.DB.Delete. If the write was
+// queued, newRev is empty.
+func (o *Outbox) Delete(ctx context.Context, docID, rev string) (newRev string, err error) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	if o.state.Next == o.state.First {
+		newRev, err = o.remote.Delete(ctx, docID, rev)
+		if err == nil || !o.opts.Unreachable(err) {
+			return newRev, err
+		}
+	}
+	return "", o.enqueue(ctx, &entry{Op: OpDelete, DocID: docID, Base: rev})
+}
+
+func (o *Outbox) enqueue(ctx context.Context, e *entry) error {
+	if _, err := o.queue.Put(ctx, entryID(o.state.Next), e); err != nil {
+		return err
+	}
+	next := o.state
+	next.Next++
+	return o.saveState(ctx, next)
+}
+
+func (o *Outbox) saveState(ctx context.Context, next state) error {
+	rev, err := o.queue.Put(ctx, stateID, next)
+	if err != nil {
+		return err
+	}
+	next.Rev = rev
+	o.state = next
+	return nil
+}
+
+// Sync replays the queued writes to the remote database, in order. Writes
+// rejected by the remote database are removed from the queue and returned as
+// conflicts. If the remote database cannot be reached, Sync stops, leaving the
+// remaining writes queued, and returns the error along with any conflicts
+// found so far.
+func (o *Outbox) Sync(ctx context.Context) ([]*Conflict, error) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	var conflicts []*Conflict
+	for o.state.First < o.state.Next {
+		seq := o.state.First
+		row, err := o.queue.Get(ctx, entryID(seq))
+		if err != nil {
+			return conflicts, err
+		}
+		e := &entry{}
+		if err = row.ScanDoc(e); err != nil {
+			return conflicts, err
+		}
+		rev, err := o.replay(ctx, e)
+		if err != nil && o.opts.Unreachable(err) {
+			return conflicts, err
+		}
+		next := o.state
+		next.First++
+		if err != nil {
+			conflicts = append(conflicts, &Conflict{
+				Write: Write{Seq: seq, Op: e.Op, DocID: e.DocID, Rev: e.Base, Doc: e.Doc},
+				Err:   err,
+			})
+		} else {
+			next.Rebase = make(map[string]rebase, len(o.state.Rebase)+1)
+			for docID, r := range o.state.Rebase {
+				next.Rebase[docID] = r
+			}
+			next.Rebase[e.DocID] = rebase{From: e.Base, To: rev}
+		}
+		if next.First == next.Next {
+			next.Rebase = nil
+		}
+		if err = o.saveState(ctx, next); err != nil {
+			return conflicts, err
+		}
+		if _, err = o.queue.Delete(ctx, entryID(seq), e.Rev); err != nil {
+			return conflicts, err
+		}
+	}
+	return conflicts, nil
+}
+
+// replay sends a queued write to the remote database.
+func (o *Outbox) replay(ctx context.Context, e *entry) (string, error) {
+	base := e.Base
+	if r, ok := o.state.Rebase[e.DocID]; ok && r.From == base {
+		base = r.To
+	}
+	if e.Op == OpDelete {
+		return o.remote.Delete(ctx, e.DocID, base)
+	}
+	doc := e.Doc
+	if base != e.Base {
+		var fields map[string]json.RawMessage
+		if err := json.Unmarshal(doc, &fields); err != nil {
+			return "", errors.WrapStatus(kivik.StatusBadRequest, err)
+		}
+		fields["_rev"], _ = json.Marshal(base)
+		doc, _ = json.Marshal(fields)
+	}
+	return o.remote.Put(ctx, e.DocID, doc)
+}
+
+// Run calls Sync every interval while any writes are queued, until ctx is
+// canceled. Conflicts are passed to handle, which may be nil.
+func (o *Outbox) Run(ctx context.Context, interval time.Duration, handle func([]*Conflict)) error {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		}
+		if o.Pending() == 0 {
+			continue
+		}
+		conflicts, _ := o.Sync(ctx)
+		if len(conflicts) > 0 && handle != nil {
+			handle(conflicts)
+		}
+	}
+}
+
+// IsUnreachable reports whether err is a network error, indicating that the
+// server could not be reached. A write which failed with a network error after
+// the request was sent may nonetheless have been applied by the server, in
+// which case its replay is likely to be reported as a conflict.
+func IsUnreachable(err error) bool {
+	for err != nil {
+		switch t := err.(type) {
+		case *url.Error:
+			if t.Err == context.Canceled || t.Err == context.DeadlineExceeded {
+				return false
+			}
+		case net.Error:
+			return true
+		}
+		err = cause(err)
+	}
+	return false
+}
+
+// cause returns the error wrapped by err, or nil.
+func cause(err error) error {
+	switch t := err.(type) {
+	case *url.Error:
+		return t.Err
+	case interface {
+		Unwrap() error
+	}:
+		return t.Unwrap()
+	case interface {
+		Cause() error
+	}:
+		return t.Cause()
+	}
+	return nil
+}
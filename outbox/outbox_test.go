@@ -0,0 +1,206 @@
+package outbox
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/url"
+	"sync/atomic"
+	"testing"
+
+	"github.com/flimzy/diff"
+	"github.com/flimzy/kivik"
+	"github.com/flimzy/kivik/driver"
+	_ "github.com/flimzy/kivik/driver/memory"
+)
+
+// offline is set to 1 while the test remote cannot be reached.
+var offline int32
+
+var errRefused = &net.OpError{Op: "dial", Net: "tcp", Err: errors.New("connection refused")}
+
+// flakyDriver wraps the memory driver, failing writes while offline.
+type flakyDriver struct {
+	driver.Driver
+}
+
+func (d *flakyDriver) NewClient(ctx context.Context, dsn string) (driver.Client, error) {
+	c, err := d.Driver.NewClient(ctx, dsn)
+	return &flakyClient{Client: c}, err
+}
+
+type flakyClient struct {
+	driver.Client
+}
+
+func (c *flakyClient) DB(ctx context.Context, dbName string, opts map[string]interface{}) (driver.DB, error) {
+	db, err := c.Client.DB(ctx, dbName, opts)
+	return &flakyDB{DB: db}, err
+}
+
+type flakyDB struct {
+	driver.DB
+}
+
+func (d *flakyDB) Put(ctx context.Context, docID string, doc interface{}) (string, error) {
+	if atomic.LoadInt32(&offline) == 1 {
+		return "", errRefused
+	}
+	return d.DB.Put(ctx, docID, doc)
+}
+
+func (d *flakyDB) Delete(ctx context.Context, docID, rev string) (string, error) {
+	if atomic.LoadInt32(&offline) == 1 {
+		return "", errRefused
+	}
+	return d.DB.Delete(ctx, docID, rev)
+}
+
+func init() {
+	memDriver, _ := kivik.LookupDriver("memory")
+	kivik.Register("outbox-test", &flakyDriver{Driver: memDriver})
+}
+
+func newDB(t *testing.T, driverName string) *kivik.DB {
+	ctx := context.Background()
+	client, err := kivik.New(ctx, driverName, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = client.CreateDB(ctx, "foo"); err != nil {
+		t.Fatal(err)
+	}
+	db, err := client.DB(ctx, "foo")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return db
+}
+
+func getName(t *testing.T, db *kivik.DB, docID string) string {
+	row, err := db.Get(context.Background(), docID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var doc struct {
+		Name string `json:"name"`
+	}
+	if err = row.ScanDoc(&doc); err != nil {
+		t.Fatal(err)
+	}
+	return doc.Name
+}
+
+func TestOutbox(t *testing.T) {
+	ctx := context.Background()
+	atomic.StoreInt32(&offline, 0)
+	remote := newDB(t, "outbox-test")
+	queue := newDB(t, "memory")
+	ob, err := New(ctx, remote, queue, Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	fooRev, err := ob.Put(ctx, "foo", map[string]string{"name": "online"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fooRev == "" {
+		t.Fatal("Expected a revision for an online write")
+	}
+	barRev, err := remote.Put(ctx, "bar", map[string]string{"name": "bar"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = remote.Put(ctx, "baz", map[string]string{"name": "baz"}); err != nil {
+		t.Fatal(err)
+	}
+
+	atomic.StoreInt32(&offline, 1)
+	if rev, err := ob.Put(ctx, "foo", map[string]string{"_rev": fooRev, "name": "offline 1"}); err != nil || rev != "" {
+		t.Fatalf("Unexpected result: %q, %v", rev, err)
+	}
+	// The second update is based on the same revision as the first, and so
+	// must be rebased on replay.
+	if _, err = ob.Put(ctx, "foo", map[string]string{"_rev": fooRev, "name": "offline 2"}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = ob.Delete(ctx, "bar", barRev); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = ob.Put(ctx, "baz", map[string]string{"name": "conflict"}); err != nil {
+		t.Fatal(err)
+	}
+	if pending := ob.Pending(); pending != 4 {
+		t.Errorf("Expected 4 pending writes, got %d", pending)
+	}
+	if _, err = ob.Sync(ctx); err != errRefused {
+		t.Errorf("Unexpected error: %v", err)
+	}
+
+	// A new outbox resumes the queue.
+	ob, err = New(ctx, remote, queue, Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if pending := ob.Pending(); pending != 4 {
+		t.Errorf("Expected 4 pending writes, got %d", pending)
+	}
+
+	atomic.StoreInt32(&offline, 0)
+	// Writes made while others are queued are queued behind them.
+	if rev, err := ob.Put(ctx, "qux", map[string]string{"name": "qux"}); err != nil || rev != "" {
+		t.Fatalf("Unexpected result: %q, %v", rev, err)
+	}
+	conflicts, err := ob.Sync(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(conflicts) != 1 {
+		t.Fatalf("Expected 1 conflict, got %d", len(conflicts))
+	}
+	expected := Write{Seq: 3, Op: OpPut, DocID: "baz", Doc: []byte(`{"name":"conflict"}`)}
+	if d := diff.Interface(expected, conflicts[0].Write); d != "" {
+		t.Error(d)
+	}
+	if kivik.StatusCode(conflicts[0].Err) != kivik.StatusConflict {
+		t.Errorf("Unexpected error: %v", conflicts[0].Err)
+	}
+	if pending := ob.Pending(); pending != 0 {
+		t.Errorf("Expected no pending writes, got %d", pending)
+	}
+
+	if name := getName(t, remote, "foo"); name != "offline 2" {
+		t.Errorf("Unexpected foo: %s", name)
+	}
+	if name := getName(t, remote, "qux"); name != "qux" {
+		t.Errorf("Unexpected qux: %s", name)
+	}
+	if _, err = remote.Get(ctx, "bar"); kivik.StatusCode(err) != kivik.StatusNotFound {
+		t.Errorf("Unexpected error: %v", err)
+	}
+	if _, err = queue.Get(ctx, entryID(0)); kivik.StatusCode(err) != kivik.StatusNotFound {
+		t.Errorf("Expected replayed write to be removed from the queue: %v", err)
+	}
+}
+
+func TestIsUnreachable(t *testing.T) {
+	tests := []struct {
+		name     string
+		err      error
+		expected bool
+	}{
+		{name: "Nil", err: nil, expected: false},
+		{name: "Status", err: errors.New("foo"), expected: false},
+		{name: "Dial", err: errRefused, expected: true},
+		{name: "URL", err: &url.Error{Op: "Get", URL: "http://foo/", Err: errRefused}, expected: true},
+		{name: "Canceled", err: &url.Error{Op: "Get", URL: "http://foo/", Err: context.Canceled}, expected: false},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if result := IsUnreachable(test.err); result != test.expected {
+				t.Errorf("Expected %t, got %t", test.expected, result)
+			}
+		})
+	}
+}
@@ -0,0 +1,142 @@
+package kivik
+
+import (
+	"encoding/base64"
+	"encoding/json"
+
+	"github.com/flimzy/kivik/errors"
+)
+
+// Page is a page of query results, as read by ReadPage, in a form suitable
+// for returning from a web API, such as:
+//
+//	{"items":[...],"next":"eyJrZXkiOiJmb28iLCJpZCI6ImZvbyJ9","total":42}
+type Page struct {
+	// Items are the raw JSON results of the page, as returned by Rows.Raw:
+	// the rows of AllDocs and Query, or the documents of Find.
+	Items []json.RawMessage `json:"items"`
+	// Next is the cursor of the next page, to pass to PageOptions or
+	// FindPageQuery, or empty if this is the last page.
+	Next string `json:"next,omitempty"`
+	// Total is the total number of rows of the view, if reported by the
+	// query. It is not reported by Find.
+	Total *int64 `json:"total,omitempty"`
+}
+
+// pageCursor is the decoded form of a cursor. Cursors of views hold the key
+// and document ID of the first row of the next page; those of Find hold the
+// bookmark returned by the server.
+type pageCursor struct {
+	Key      json.RawMessage `json:"key,omitempty"`
+	ID       string          `json:"id,omitempty"`
+	Bookmark string          `json:"bookmark,omitempty"`
+}
+
+func (c *pageCursor) encode() (string, error) {
+	raw, err := json.Marshal(c)
+	if err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(raw), nil
+}
+
+func decodeCursor(cursor string) (*pageCursor, error) {
+	raw, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return nil, errors.Status(StatusBadRequest, "kivik: invalid page cursor")
+	}
+	c := &pageCursor{}
+	if err := json.Unmarshal(raw, c); err != nil {
+		return nil, errors.Status(StatusBadRequest, "kivik: invalid page cursor")
+	}
+	return c, nil
+}
+
+// PageOptions returns the options for AllDocs or Query to fetch the page of
+// size results starting at cursor, as returned by ReadPage in Page.Next, or
+// the first page if cursor is empty. One more row than size is requested, to
+// find the start of the next page. The options may be combined with others,
+// such as include_docs or descending, which must be the same for each page.
+func PageOptions(cursor string, size int) (Options, error) {
+	opts := Options{"limit": size + 1}
+	if cursor == "" {
+		return opts, nil
+	}
+	c, err := decodeCursor(cursor)
+	if err != nil {
+		return nil, err
+	}
+	if len(c.Key) == 0 {
+		return nil, errors.Status(StatusBadRequest, "kivik: page cursor is not for a view")
+	}
+	opts["startkey"] = string(c.Key)
+	opts["startkey_docid"] = c.ID
+	return opts, nil
+}
+
+// FindPageQuery returns a copy of the Find query, with the limit and bookmark
+// set to fetch the page of size results starting at cursor, as returned by
+// ReadPage in Page.Next, or the first page if cursor is empty.
+func FindPageQuery(query map[string]interface{}, cursor string, size int) (map[string]interface{}, error) {
+	result := make(map[string]interface{}, len(query)+2)
+	for k, v := range query {
+		result[k] = v
+	}
+	result["limit"] = size
+	delete(result, "bookmark")
+	if cursor == "" {
+		return result, nil
+	}
+	c, err := decodeCursor(cursor)
+	if err != nil {
+		return nil, err
+	}
+	if c.Bookmark == "" {
+		return nil, errors.Status(StatusBadRequest, "kivik: page cursor is not for Find")
+	}
+	result["bookmark"] = c.Bookmark
+	return result, nil
+}
+
+// ReadPage reads up to size results from rows, which it closes, as a Page.
+// rows should be the result of a query with the options of PageOptions, or
+// the query of FindPageQuery. For views, the cursor of the next page is set
+// if rows has a row beyond size. For Find, which cannot tell whether more
+// results remain, it is set from the bookmark whenever the page is full, so
+// the last page may be empty.
+func ReadPage(rows *Rows, size int) (*Page, error) {
+	defer func() { _ = rows.Close() }()
+	page := &Page{Items: make([]json.RawMessage, 0, size)}
+	var next *pageCursor
+	for rows.Next() {
+		if len(page.Items) == size {
+			var key json.RawMessage
+			if err := rows.ScanKey(&key); err != nil {
+				return nil, err
+			}
+			if len(key) > 0 {
+				next = &pageCursor{Key: append(json.RawMessage(nil), key...), ID: rows.ID()}
+			}
+			break
+		}
+		page.Items = append(page.Items, append(json.RawMessage(nil), rows.Raw()...))
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	if next == nil && len(page.Items) == size {
+		if bookmark := rows.Bookmark(); bookmark != "" {
+			next = &pageCursor{Bookmark: bookmark}
+		}
+	}
+	if next != nil {
+		var err error
+		if page.Next, err = next.encode(); err != nil {
+			return nil, err
+		}
+	}
+	if total := rows.TotalRows(); total > 0 {
+		page.Total = &total
+	}
+	return page, nil
+}
@@ -0,0 +1,153 @@
+package kivik
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+
+	"github.com/flimzy/diff"
+)
+
+type totalRows struct {
+	*sliceRows
+	total    int64
+	bookmark string
+}
+
+func (r *totalRows) TotalRows() int64 { return r.total }
+func (r *totalRows) Bookmark() string { return r.bookmark }
+
+func TestReadPage(t *testing.T) {
+	tests := []struct {
+		name     string
+		input    []string
+		total    int64
+		bookmark string
+		size     int
+		expected string
+		next     *pageCursor
+	}{
+		{
+			name:     "LastPage",
+			input:    []string{`{"id":"a","key":"a","value":1}`},
+			total:    3,
+			size:     2,
+			expected: `{"items":[{"id":"a","key":"a","value":1}],"total":3}`,
+		},
+		{
+			name: "NextPage",
+			input: []string{
+				`{"id":"a","key":["x",1],"value":1}`,
+				`{"id":"b","key":["x",2],"value":2}`,
+				`{"id":"c","key":["x",3],"value":3}`,
+			},
+			total:    3,
+			size:     2,
+			expected: `{"items":[{"id":"a","key":["x",1],"value":1},{"id":"b","key":["x",2],"value":2}],"total":3}`,
+			next:     &pageCursor{Key: json.RawMessage(`["x",3]`), ID: "c"},
+		},
+		{
+			name:     "Find",
+			input:    []string{`{"doc":{"_id":"a"}}`, `{"doc":{"_id":"b"}}`},
+			bookmark: "g1AAAA",
+			size:     2,
+			expected: `{"items":[{"doc":{"_id":"a"}},{"doc":{"_id":"b"}}]}`,
+			next:     &pageCursor{Bookmark: "g1AAAA"},
+		},
+		{
+			name:     "FindLastPage",
+			input:    []string{`{"doc":{"_id":"a"}}`},
+			bookmark: "g1AAAA",
+			size:     2,
+			expected: `{"items":[{"doc":{"_id":"a"}}]}`,
+		},
+		{
+			name:     "Empty",
+			size:     2,
+			expected: `{"items":[]}`,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			rows := newRows(context.Background(), &totalRows{
+				sliceRows: &sliceRows{input: test.input, raw: true},
+				total:     test.total,
+				bookmark:  test.bookmark,
+			}, false)
+			page, err := ReadPage(rows, test.size)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var next *pageCursor
+			if page.Next != "" {
+				if next, err = decodeCursor(page.Next); err != nil {
+					t.Fatal(err)
+				}
+				page.Next = ""
+			}
+			if d := diff.Interface(test.next, next); d != "" {
+				t.Errorf("Next:\n%s", d)
+			}
+			result, err := json.Marshal(page)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if d := diff.JSON([]byte(test.expected), result); d != "" {
+				t.Error(d)
+			}
+		})
+	}
+}
+
+func TestPageOptions(t *testing.T) {
+	viewCursor, _ := (&pageCursor{Key: json.RawMessage(`"c"`), ID: "c"}).encode()
+	findCursor, _ := (&pageCursor{Bookmark: "g1AAAA"}).encode()
+	tests := []struct {
+		name     string
+		cursor   string
+		expected Options
+		status   int
+	}{
+		{name: "FirstPage", expected: Options{"limit": 11}},
+		{name: "NextPage", cursor: viewCursor, expected: Options{"limit": 11, "startkey": `"c"`, "startkey_docid": "c"}},
+		{name: "Invalid", cursor: "!!!", status: StatusBadRequest},
+		{name: "FindCursor", cursor: findCursor, status: StatusBadRequest},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			opts, err := PageOptions(test.cursor, 10)
+			if status := StatusCode(err); status != test.status {
+				t.Fatalf("Expected status %d, got %d: %v", test.status, status, err)
+			}
+			if d := diff.Interface(test.expected, opts); d != "" {
+				t.Error(d)
+			}
+		})
+	}
+}
+
+func TestFindPageQuery(t *testing.T) {
+	query := map[string]interface{}{"selector": map[string]interface{}{}, "bookmark": "old"}
+	findCursor, _ := (&pageCursor{Bookmark: "g1AAAA"}).encode()
+	viewCursor, _ := (&pageCursor{Key: json.RawMessage(`"c"`), ID: "c"}).encode()
+	result, err := FindPageQuery(query, "", 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if d := diff.Interface(map[string]interface{}{"selector": map[string]interface{}{}, "limit": 10}, result); d != "" {
+		t.Error(d)
+	}
+	result, err = FindPageQuery(query, findCursor, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if d := diff.Interface(map[string]interface{}{"selector": map[string]interface{}{}, "limit": 10, "bookmark": "g1AAAA"}, result); d != "" {
+		t.Error(d)
+	}
+	if _, err := FindPageQuery(query, viewCursor, 10); StatusCode(err) != StatusBadRequest {
+		t.Errorf("Expected a view cursor to be rejected, got %v", err)
+	}
+	if query["bookmark"] != "old" {
+		t.Errorf("Expected the query to be unmodified")
+	}
+}
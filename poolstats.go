@@ -0,0 +1,37 @@
+package kivik
+
+import (
+	"github.com/flimzy/kivik/driver"
+	"github.com/flimzy/kivik/errors"
+)
+
+// PoolStats reports the state of a client's connection pool.
+type PoolStats struct {
+	// OpenConnections is the number of open connections to the server,
+	// including idle ones.
+	OpenConnections int
+	// IdleConnections is the number of open connections not in use.
+	IdleConnections int
+	// InFlight is the number of requests in progress, including those waiting
+	// for a connection.
+	InFlight int
+}
+
+// PoolStats returns the state of the client's connection pool. An error with
+// status StatusNotImplemented is returned if the driver does not maintain a
+// connection pool.
+func (c *Client) PoolStats() (*PoolStats, error) {
+	statser, ok := c.driverClient.(driver.PoolStatser)
+	if !ok {
+		return nil, errors.Status(StatusNotImplemented, "kivik: driver does not support connection pool statistics")
+	}
+	stats, err := statser.PoolStats()
+	if err != nil {
+		return nil, err
+	}
+	return &PoolStats{
+		OpenConnections: stats.OpenConnections,
+		IdleConnections: stats.IdleConnections,
+		InFlight:        stats.InFlight,
+	}, nil
+}
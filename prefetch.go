@@ -0,0 +1,98 @@
+package kivik
+
+import (
+	"context"
+	"reflect"
+	"sync"
+)
+
+const prefetchOption = "kivik_prefetch"
+
+// Prefetch returns options for Query, AllDocs and Changes, which cause up to n
+// results to be read ahead from the driver in the background, while the
+// caller processes the current one. This hides the latency of reading each
+// result, such as on high-latency connections, where, with the CouchDB
+// driver, the next network read is then in progress while the current row is
+// processed. The results read ahead are held in memory, so n should be small.
+//
+// As each result read ahead requires its own buffers, Prefetch overrides
+// ReuseBuffers. Metadata of the query which the driver reads after the last
+// row, such as the UpdateSeq of a view, is only valid once Next has returned
+// false.
+func Prefetch(n int) Options {
+	return Options{prefetchOption: n}
+}
+
+// prefetch removes the Prefetch option from opts, and returns its value, or 0
+// if it was not set.
+func prefetch(opts Options) int {
+	n, _ := opts[prefetchOption].(int)
+	delete(opts, prefetchOption)
+	return n
+}
+
+// prefetchResult is a result read ahead from the feed.
+type prefetchResult struct {
+	val interface{}
+	err error
+}
+
+// prefetcher reads results from feed in the background, up to n ahead of
+// Next.
+type prefetcher struct {
+	ctx     context.Context
+	feed    iterator
+	results chan prefetchResult
+	stop    chan struct{}
+	once    sync.Once
+}
+
+var _ iterator = &prefetcher{}
+
+// newPrefetcher returns an iterator which reads up to n results ahead from
+// feed. newVal returns a new, empty result, which must be a pointer.
+func newPrefetcher(ctx context.Context, feed iterator, n int, newVal func() interface{}) *prefetcher {
+	p := &prefetcher{
+		ctx:     ctx,
+		feed:    feed,
+		results: make(chan prefetchResult, n),
+		stop:    make(chan struct{}),
+	}
+	go p.run(newVal)
+	return p
+}
+
+func (p *prefetcher) run(newVal func() interface{}) {
+	for {
+		val := newVal()
+		err := p.feed.Next(val)
+		select {
+		case p.results <- prefetchResult{val: val, err: err}:
+		case <-p.stop:
+			return
+		}
+		if err != nil {
+			return
+		}
+	}
+}
+
+func (p *prefetcher) Next(i interface{}) error {
+	select {
+	case result := <-p.results:
+		if result.err != nil {
+			return result.err
+		}
+		reflect.ValueOf(i).Elem().Set(reflect.ValueOf(result.val).Elem())
+		return nil
+	case <-p.ctx.Done():
+		return p.ctx.Err()
+	}
+}
+
+// Close stops reading ahead, and closes the feed, which is expected to cause
+// any read in progress to return.
+func (p *prefetcher) Close() error {
+	p.once.Do(func() { close(p.stop) })
+	return p.feed.Close()
+}
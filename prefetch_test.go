@@ -0,0 +1,80 @@
+package kivik
+
+import (
+	"context"
+	"runtime"
+	"sync/atomic"
+	"testing"
+
+	"github.com/flimzy/diff"
+	"github.com/flimzy/kivik/driver"
+)
+
+// countingRows counts the rows read from sliceRows.
+type countingRows struct {
+	*sliceRows
+	reads int32
+}
+
+func (r *countingRows) Next(row *driver.Row) error {
+	atomic.AddInt32(&r.reads, 1)
+	return r.sliceRows.Next(row)
+}
+
+// prefetchDB returns rows from AllDocs, recording the options passed.
+type prefetchDB struct {
+	*dummyDB
+	rows driver.Rows
+	opts map[string]interface{}
+}
+
+func (db *prefetchDB) AllDocs(_ context.Context, opts map[string]interface{}) (driver.Rows, error) {
+	db.opts = opts
+	return db.rows, nil
+}
+
+func TestPrefetch(t *testing.T) {
+	rowsi := &countingRows{sliceRows: &sliceRows{input: []string{
+		`{"id":"a"}`, `{"id":"b"}`, `{"id":"c"}`, `{"id":"d"}`, `{"id":"e"}`,
+	}}}
+	driverDB := &prefetchDB{rows: rowsi}
+	db := &DB{driverDB: driverDB}
+	rows, err := db.AllDocs(context.Background(), Prefetch(2), Options{"limit": 5})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if d := diff.Interface(map[string]interface{}{"limit": 5}, driverDB.opts); d != "" {
+		t.Errorf("Unexpected options passed to the driver:\n%s", d)
+	}
+	// Two rows are buffered, and a third is read and waiting to be buffered.
+	for atomic.LoadInt32(&rowsi.reads) < 3 {
+		runtime.Gosched()
+	}
+	var ids []string
+	for rows.Next() {
+		ids = append(ids, rows.ID())
+	}
+	if err := rows.Err(); err != nil {
+		t.Fatal(err)
+	}
+	if d := diff.Interface([]string{"a", "b", "c", "d", "e"}, ids); d != "" {
+		t.Error(d)
+	}
+}
+
+func TestPrefetchClose(t *testing.T) {
+	rowsi := &sliceRows{input: []string{`{"id":"a"}`, `{"id":"b"}`, `{"id":"c"}`}}
+	rows := newPrefetchRows(context.Background(), rowsi, 1)
+	if !rows.Next() || rows.ID() != "a" {
+		t.Fatalf("Unexpected first row: %v", rows.Err())
+	}
+	if err := rows.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if rows.Next() {
+		t.Error("Expected no rows after Close")
+	}
+	if err := rows.Err(); err != nil {
+		t.Error(err)
+	}
+}
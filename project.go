@@ -0,0 +1,134 @@
+package kivik
+
+import (
+	"encoding/json"
+	"strings"
+
+	"github.com/flimzy/kivik/driver"
+	"github.com/flimzy/kivik/errors"
+)
+
+const projectOption = "kivik_project"
+
+// Project returns options for Get, and for AllDocs and Query with
+// include_docs, which strip each fetched document down to the fields at the
+// dotted paths, such as "address.city", as with the fields of a Mango query.
+// Fields missing from a document are omitted. The projection is done
+// client-side, as each document is read, so that only the projected fields are
+// retained, which reduces the memory used by large documents when only a few
+// of their fields are needed. For Find, use ProjectQuery, which projects
+// documents server-side.
+func Project(fields ...string) Options {
+	return Options{projectOption: fields}
+}
+
+// projection removes the Project option from opts, and returns its fields, or
+// nil if it was not set.
+func projection(opts Options) []string {
+	fields, _ := opts[projectOption].([]string)
+	delete(opts, projectOption)
+	return fields
+}
+
+// ProjectQuery returns query, a Mango query for Find, with its fields set to
+// fields, so that the server returns only those fields of each document. The
+// query must marshal to a JSON object.
+func ProjectQuery(query interface{}, fields ...string) (map[string]interface{}, error) {
+	var q map[string]interface{}
+	switch t := query.(type) {
+	case map[string]interface{}:
+		q = make(map[string]interface{}, len(t)+1)
+		for k, v := range t {
+			q[k] = v
+		}
+	default:
+		raw, err := json.Marshal(query)
+		if err != nil {
+			return nil, errors.WrapStatus(StatusBadRequest, err)
+		}
+		if err := json.Unmarshal(raw, &q); err != nil || q == nil {
+			return nil, errors.Status(StatusBadRequest, "kivik: query must be a JSON object")
+		}
+	}
+	q["fields"] = fields
+	return q, nil
+}
+
+// ProjectDoc returns doc, stripped down to the fields at the dotted paths, as
+// with the Project option.
+func ProjectDoc(doc json.RawMessage, fields ...string) (json.RawMessage, error) {
+	var src map[string]json.RawMessage
+	if err := json.Unmarshal(doc, &src); err != nil {
+		return nil, errors.WrapStatus(StatusBadResponse, err)
+	}
+	dst := make(map[string]interface{})
+	for _, field := range fields {
+		projectField(dst, src, strings.Split(field, "."))
+	}
+	return json.Marshal(dst)
+}
+
+// projectField copies the value at path, if any, from src to dst. Objects are
+// decoded only as deep as the path, so that other values are copied as they
+// are.
+func projectField(dst map[string]interface{}, src map[string]json.RawMessage, path []string) {
+	value, ok := src[path[0]]
+	if !ok {
+		return
+	}
+	if len(path) == 1 {
+		dst[path[0]] = value
+		return
+	}
+	if _, ok := dst[path[0]].(json.RawMessage); ok {
+		// The whole value is already projected.
+		return
+	}
+	var child map[string]json.RawMessage
+	if err := json.Unmarshal(value, &child); err != nil || child == nil {
+		// Not an object, so it has no field at the rest of the path.
+		return
+	}
+	next, ok := dst[path[0]].(map[string]interface{})
+	if !ok {
+		next = make(map[string]interface{})
+	}
+	projectField(next, child, path[1:])
+	if len(next) > 0 {
+		dst[path[0]] = next
+	}
+}
+
+// projectedRows projects the document of each row.
+type projectedRows struct {
+	driver.Rows
+	fields []string
+}
+
+var _ driver.Rows = &projectedRows{}
+
+func (r *projectedRows) Next(row *driver.Row) error {
+	if err := r.Rows.Next(row); err != nil {
+		return err
+	}
+	if len(row.Doc) == 0 || string(row.Doc) == "null" {
+		return nil
+	}
+	doc, err := ProjectDoc(row.Doc, r.fields...)
+	if err != nil {
+		return err
+	}
+	// The raw row holds the whole document, so is rebuilt from the projected
+	// one when needed.
+	row.Doc, row.Raw = doc, nil
+	return nil
+}
+
+// projectRows returns rowsi, projecting the document of each row if fields is
+// not nil.
+func projectRows(rowsi driver.Rows, fields []string) driver.Rows {
+	if fields == nil || rowsi == nil {
+		return rowsi
+	}
+	return &projectedRows{Rows: rowsi, fields: fields}
+}
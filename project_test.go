@@ -0,0 +1,154 @@
+package kivik
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+
+	"github.com/flimzy/diff"
+	"github.com/flimzy/kivik/driver"
+)
+
+const projectTestDoc = `{"_id":"foo","_rev":"1-x","name":"Bob","address":{"city":"Oslo","zip":"0150","geo":{"lat":59.9}},"tags":["a","b"],"n":12345678901234567890}`
+
+func TestProjectDoc(t *testing.T) {
+	tests := []struct {
+		name     string
+		doc      string
+		fields   []string
+		expected string
+		status   int
+	}{
+		{
+			name:     "TopLevel",
+			doc:      projectTestDoc,
+			fields:   []string{"_id", "name", "n"},
+			expected: `{"_id":"foo","name":"Bob","n":12345678901234567890}`,
+		},
+		{
+			name:     "Nested",
+			doc:      projectTestDoc,
+			fields:   []string{"address.city", "address.geo.lat", "tags"},
+			expected: `{"address":{"city":"Oslo","geo":{"lat":59.9}},"tags":["a","b"]}`,
+		},
+		{
+			name:     "Missing",
+			doc:      projectTestDoc,
+			fields:   []string{"missing", "address.missing", "name.first", "tags.0"},
+			expected: `{}`,
+		},
+		{
+			name:     "Overlapping",
+			doc:      projectTestDoc,
+			fields:   []string{"address", "address.city"},
+			expected: `{"address":{"city":"Oslo","zip":"0150","geo":{"lat":59.9}}}`,
+		},
+		{
+			name:   "Invalid",
+			doc:    `[1]`,
+			fields: []string{"name"},
+			status: StatusBadResponse,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			result, err := ProjectDoc(json.RawMessage(test.doc), test.fields...)
+			if status := StatusCode(err); status != test.status {
+				t.Errorf("Unexpected error: %v", err)
+			}
+			if err != nil {
+				return
+			}
+			if d := diff.JSON([]byte(test.expected), result); d != "" {
+				t.Error(d)
+			}
+		})
+	}
+}
+
+func TestProjectQuery(t *testing.T) {
+	selector := map[string]interface{}{"selector": map[string]interface{}{"type": "user"}, "fields": []string{"x"}}
+	q, err := ProjectQuery(selector, "_id", "name")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if d := diff.AsJSON(map[string]interface{}{"selector": map[string]interface{}{"type": "user"}, "fields": []string{"_id", "name"}}, q); d != "" {
+		t.Error(d)
+	}
+	if fields := selector["fields"].([]string); fields[0] != "x" {
+		t.Errorf("The original query was modified")
+	}
+	q, err = ProjectQuery(json.RawMessage(`{"selector":{}}`), "name")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if d := diff.AsJSON(map[string]interface{}{"selector": map[string]interface{}{}, "fields": []string{"name"}}, q); d != "" {
+		t.Error(d)
+	}
+	if _, err = ProjectQuery("foo", "name"); StatusCode(err) != StatusBadRequest {
+		t.Errorf("Expected bad request for a query which is not an object, got %v", err)
+	}
+}
+
+type projectDB struct {
+	dummyDB
+	opts map[string]interface{}
+}
+
+func (db *projectDB) Get(_ context.Context, _ string, opts map[string]interface{}) (json.RawMessage, error) {
+	db.opts = opts
+	return json.RawMessage(projectTestDoc), nil
+}
+
+func (db *projectDB) AllDocs(_ context.Context, opts map[string]interface{}) (driver.Rows, error) {
+	db.opts = opts
+	return &sliceRows{rows: &rows{}, input: []string{
+		`{"id":"foo","key":"foo","value":{"rev":"1-x"},"doc":` + projectTestDoc + `}`,
+		`{"id":"bar","key":"bar","value":{"rev":"1-y"}}`,
+	}}, nil
+}
+
+func TestProject(t *testing.T) {
+	ctx := context.Background()
+	driverDB := &projectDB{}
+	db := &DB{driverDB: driverDB}
+	row, err := db.Get(ctx, "foo", Project("name", "address.city"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var doc json.RawMessage
+	if err = row.ScanDoc(&doc); err != nil {
+		t.Fatal(err)
+	}
+	if d := diff.JSON([]byte(`{"name":"Bob","address":{"city":"Oslo"}}`), doc); d != "" {
+		t.Error(d)
+	}
+	if _, ok := driverDB.opts[projectOption]; ok {
+		t.Errorf("The Project option was passed to the driver")
+	}
+	if _, err = db.Get(ctx, "foo", Project("name"), Options{"open_revs": "all"}); StatusCode(err) != StatusBadRequest {
+		t.Errorf("Expected bad request with open_revs, got %v", err)
+	}
+
+	rows, err := db.AllDocs(ctx, Project("_id", "tags"), Options{"include_docs": true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := driverDB.opts[projectOption]; ok {
+		t.Errorf("The Project option was passed to the driver")
+	}
+	var raws []string
+	for rows.Next() {
+		raws = append(raws, string(rows.Raw()))
+	}
+	if err = rows.Err(); err != nil {
+		t.Fatal(err)
+	}
+	expected := []string{
+		`{"id":"foo","key":"foo","value":{"rev":"1-x"},"doc":{"_id":"foo","tags":["a","b"]}}`,
+		`{"id":"bar","key":"bar","value":{"rev":"1-y"}}`,
+	}
+	if d := diff.Interface(expected, raws); d != "" {
+		t.Error(d)
+	}
+}
@@ -15,6 +15,11 @@ type Proxy struct {
 	// StrictMethods will reject any non-standard CouchDB methods immediately,
 	// rather than relaying to the CouchDB server.
 	StrictMethods bool
+	// Rewrite, if set, is called with each outgoing request, after its URL
+	// has been directed to the server, and may modify it, such as to rename
+	// databases or add headers. Responses may be modified by setting
+	// ModifyResponse of the ReverseProxy.
+	Rewrite func(*http.Request)
 }
 
 var _ http.Handler = &Proxy{}
@@ -35,6 +40,7 @@ func New(serverURL string) (*Proxy, error) {
 	if target.RawQuery != "" {
 		return nil, errors.New("proxy URL must not contain query parameters")
 	}
+	p := &Proxy{}
 	director := func(req *http.Request) {
 		req.URL.Scheme = target.Scheme
 		req.URL.Host = target.Host
@@ -43,12 +49,14 @@ func New(serverURL string) (*Proxy, error) {
 			// explicitly disable User-Agent so it's not set to default value
 			req.Header.Set("User-Agent", "")
 		}
+		if p.Rewrite != nil {
+			p.Rewrite(req)
+		}
+	}
+	p.ReverseProxy = &httputil.ReverseProxy{
+		Director: director,
 	}
-	return &Proxy{
-		ReverseProxy: &httputil.ReverseProxy{
-			Director: director,
-		},
-	}, nil
+	return p, nil
 }
 
 // Any other methods are rejected immediately, if StrictMethods is true.
@@ -231,3 +231,21 @@ func TestSingleJoiningSlash(t *testing.T) {
 		}(test)
 	}
 }
+
+func TestRewrite(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintf(w, "%s %s", r.URL.Path, r.Header.Get("X-Rewritten"))
+	}))
+	defer server.Close()
+	p := mustNew(t, server.URL)
+	p.Rewrite = func(r *http.Request) {
+		r.URL.Path = "/renamed" + r.URL.Path
+		r.Header.Set("X-Rewritten", "yes")
+	}
+	w := httptest.NewRecorder()
+	p.ServeHTTP(w, httptest.NewRequest("GET", "/foo", nil))
+	expected := "/renamed/foo yes"
+	if body := w.Body.String(); body != expected {
+		t.Errorf("Expected %q, got %q", expected, body)
+	}
+}
@@ -0,0 +1,329 @@
+// Package queue implements a reliable task queue, stored as documents in any
+// kivik database, for deployments too small to justify a message broker.
+//
+//	q := queue.New(db, queue.Options{Name: "email"})
+//	id, err := q.Enqueue(ctx, message)
+//	...
+//	task, err := q.Claim(ctx)
+//	if kivik.StatusCode(err) == kivik.StatusNotFound {
+//	    // The queue is empty.
+//	}
+//	if err := send(task.Payload); err != nil {
+//	    return q.Fail(ctx, task, err)
+//	}
+//	return q.Complete(ctx, task)
+//
+// A task is claimed by updating its document with a rev-guarded Put, so that
+// when several workers race for the same task, only one succeeds. A claim
+// lasts for the visibility timeout, after which the task may be claimed
+// again, if the worker has neither completed nor failed it, as when the
+// worker has crashed. A task which has been attempted MaxAttempts times is
+// moved to the dead-letter state, where it remains until requeued or deleted.
+//
+// Tasks are found with Find, where the driver supports it, and otherwise by
+// reading the changes feed, so an index on the queue and state fields is
+// recommended for large queues.
+package queue
+
+import (
+	"context"
+	"encoding/json"
+	"sort"
+	"time"
+
+	"github.com/flimzy/kivik"
+	"github.com/flimzy/kivik/errors"
+	"github.com/flimzy/kivik/mango"
+)
+
+// Task states.
+const (
+	StateReady   = "ready"
+	StateClaimed = "claimed"
+	StateDead    = "dead"
+)
+
+// Defaults for Options.
+const (
+	DefaultName              = "default"
+	DefaultVisibilityTimeout = 30 * time.Second
+	DefaultMaxAttempts       = 5
+)
+
+// ErrEmpty is returned by Claim when no task is available.
+var ErrEmpty = errors.Status(kivik.StatusNotFound, "queue: no task available")
+
+// errLost is returned when the task document has been updated by another
+// worker, after the claim expired.
+var errLost = errors.Status(kivik.StatusConflict, "queue: claim lost")
+
+// Options configures a Queue.
+type Options struct {
+	// Name identifies the queue, so that several queues may share a
+	// database. Defaults to DefaultName.
+	Name string
+	// VisibilityTimeout is how long a claim lasts. Defaults to
+	// DefaultVisibilityTimeout.
+	VisibilityTimeout time.Duration
+	// MaxAttempts is the number of times a task is claimed before it is
+	// dead-lettered. Defaults to DefaultMaxAttempts.
+	MaxAttempts int
+	// RetryDelay is the delay before a failed task may be claimed again.
+	RetryDelay time.Duration
+}
+
+// Task is a queued task, as stored in the database.
+type Task struct {
+	ID      string          `json:"_id"`
+	Rev     string          `json:"_rev,omitempty"`
+	Queue   string          `json:"queue"`
+	State   string          `json:"state"`
+	Payload json.RawMessage `json:"payload"`
+	// Attempts is the number of times the task has been claimed.
+	Attempts int `json:"attempts"`
+	// VisibleAt is the time after which the task may be claimed.
+	VisibleAt time.Time `json:"visible_at"`
+	Created   time.Time `json:"created"`
+	// Error is the error reported by the last failed attempt, if any.
+	Error string `json:"error,omitempty"`
+}
+
+// Queue is a task queue.
+type Queue struct {
+	db   *kivik.DB
+	opts Options
+	// now is replaced in tests.
+	now func() time.Time
+}
+
+// New returns the queue named by opts, stored in db.
+func New(db *kivik.DB, opts Options) *Queue {
+	if opts.Name == "" {
+		opts.Name = DefaultName
+	}
+	if opts.VisibilityTimeout <= 0 {
+		opts.VisibilityTimeout = DefaultVisibilityTimeout
+	}
+	if opts.MaxAttempts <= 0 {
+		opts.MaxAttempts = DefaultMaxAttempts
+	}
+	return &Queue{db: db, opts: opts, now: time.Now}
+}
+
+// Enqueue adds a task with payload, which must marshal to JSON, and returns
+// its ID.
+func (q *Queue) Enqueue(ctx context.Context, payload interface{}) (string, error) {
+	return q.EnqueueAt(ctx, payload, q.now())
+}
+
+// EnqueueAt adds a task which may not be claimed before at.
+func (q *Queue) EnqueueAt(ctx context.Context, payload interface{}, at time.Time) (string, error) {
+	body, err := kivik.JSON().Marshal(payload)
+	if err != nil {
+		return "", errors.WrapStatus(kivik.StatusBadRequest, err)
+	}
+	id, err := kivik.RandomIDs().NewID()
+	if err != nil {
+		return "", err
+	}
+	task := &Task{
+		ID:        id,
+		Queue:     q.opts.Name,
+		State:     StateReady,
+		Payload:   body,
+		VisibleAt: at.UTC(),
+		Created:   q.now().UTC(),
+	}
+	if _, err := q.db.Put(ctx, id, task); err != nil {
+		return "", err
+	}
+	return id, nil
+}
+
+// Claim claims the next available task, which must then be passed to
+// Complete, Fail or Extend before the visibility timeout expires. It returns
+// ErrEmpty if no task is available.
+func (q *Queue) Claim(ctx context.Context) (*Task, error) {
+	tasks, err := q.tasks(ctx, StateReady, StateClaimed)
+	if err != nil {
+		return nil, err
+	}
+	now := q.now()
+	for _, task := range tasks {
+		if task.VisibleAt.After(now) {
+			continue
+		}
+		if task.Attempts >= q.opts.MaxAttempts {
+			// The last attempt's claim expired.
+			task.State = StateDead
+			if task.Error == "" {
+				task.Error = "visibility timeout expired"
+			}
+			_ = q.update(ctx, task)
+			continue
+		}
+		task.State = StateClaimed
+		task.Attempts++
+		task.VisibleAt = now.Add(q.opts.VisibilityTimeout).UTC()
+		switch err := q.update(ctx, task); {
+		case err == nil:
+			return task, nil
+		case err == errLost:
+			// Another worker claimed the task first.
+			continue
+		default:
+			return nil, err
+		}
+	}
+	return nil, ErrEmpty
+}
+
+// Complete removes a claimed task from the queue. It returns a StatusConflict
+// error if the claim had expired, and the task was claimed by another worker.
+func (q *Queue) Complete(ctx context.Context, task *Task) error {
+	rev, err := q.db.Delete(ctx, task.ID, task.Rev)
+	if kivik.StatusCode(err) == kivik.StatusConflict {
+		return errLost
+	}
+	if err != nil {
+		return err
+	}
+	task.Rev = rev
+	return nil
+}
+
+// Fail returns a claimed task to the queue, recording cause, to be claimed
+// again after RetryDelay, or dead-letters it if it has been attempted
+// MaxAttempts times.
+func (q *Queue) Fail(ctx context.Context, task *Task, cause error) error {
+	if cause != nil {
+		task.Error = cause.Error()
+	}
+	if task.Attempts >= q.opts.MaxAttempts {
+		task.State = StateDead
+	} else {
+		task.State = StateReady
+		task.VisibleAt = q.now().Add(q.opts.RetryDelay).UTC()
+	}
+	return q.update(ctx, task)
+}
+
+// Extend extends the claim of a task by d from now, for tasks which take
+// longer than the visibility timeout to process. As with Complete, it returns
+// a StatusConflict error if the claim was lost.
+func (q *Queue) Extend(ctx context.Context, task *Task, d time.Duration) error {
+	task.VisibleAt = q.now().Add(d).UTC()
+	return q.update(ctx, task)
+}
+
+// DeadLetters returns the dead-lettered tasks.
+func (q *Queue) DeadLetters(ctx context.Context) ([]*Task, error) {
+	return q.tasks(ctx, StateDead)
+}
+
+// Requeue returns a dead-lettered task to the queue, with its attempts reset.
+func (q *Queue) Requeue(ctx context.Context, task *Task) error {
+	task.State = StateReady
+	task.Attempts = 0
+	task.VisibleAt = q.now().UTC()
+	return q.update(ctx, task)
+}
+
+// update writes task, guarded by its revision, and updates the revision.
+func (q *Queue) update(ctx context.Context, task *Task) error {
+	rev, err := q.db.Put(ctx, task.ID, task)
+	if kivik.StatusCode(err) == kivik.StatusConflict {
+		return errLost
+	}
+	if err != nil {
+		return err
+	}
+	task.Rev = rev
+	return nil
+}
+
+// tasks returns the tasks of the queue in the given states, ordered by
+// VisibleAt, and then by creation time.
+func (q *Queue) tasks(ctx context.Context, states ...string) ([]*Task, error) {
+	values := make([]interface{}, len(states))
+	for i, state := range states {
+		values[i] = state
+	}
+	selector := mango.And(
+		mango.Field("queue").Eq(q.opts.Name),
+		mango.Field("state").In(values...),
+	)
+	tasks, err := q.find(ctx, selector)
+	if kivik.StatusCode(err) == kivik.StatusNotImplemented {
+		tasks, err = q.scanChanges(ctx, selector)
+	}
+	if err != nil {
+		return nil, err
+	}
+	sort.Sort(byVisibility(tasks))
+	return tasks, nil
+}
+
+func (q *Queue) find(ctx context.Context, selector *mango.Selector) ([]*Task, error) {
+	rows, err := q.db.Find(ctx, map[string]interface{}{"selector": selector})
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = rows.Close() }()
+	var tasks []*Task
+	for rows.Next() {
+		task := &Task{}
+		if err := rows.ScanDoc(task); err != nil {
+			return nil, err
+		}
+		tasks = append(tasks, task)
+	}
+	return tasks, rows.Err()
+}
+
+// scanChanges reads the tasks which match selector from the changes feed,
+// for drivers which do not support Find.
+func (q *Queue) scanChanges(ctx context.Context, selector *mango.Selector) ([]*Task, error) {
+	matcher, err := mango.NewMatcher(selector)
+	if err != nil {
+		return nil, err
+	}
+	changes, err := q.db.Changes(ctx, kivik.Options{"include_docs": true})
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = changes.Close() }()
+	var tasks []*Task
+	for changes.Next() {
+		if changes.Deleted() {
+			continue
+		}
+		var doc map[string]interface{}
+		if err := changes.ScanDoc(&doc); err != nil {
+			return nil, err
+		}
+		if ok, _ := matcher.Match(doc); !ok {
+			continue
+		}
+		task := &Task{}
+		if err := changes.ScanDoc(task); err != nil {
+			return nil, err
+		}
+		tasks = append(tasks, task)
+	}
+	return tasks, changes.Err()
+}
+
+type byVisibility []*Task
+
+func (t byVisibility) Len() int      { return len(t) }
+func (t byVisibility) Swap(i, j int) { t[i], t[j] = t[j], t[i] }
+func (t byVisibility) Less(i, j int) bool {
+	if !t[i].VisibleAt.Equal(t[j].VisibleAt) {
+		return t[i].VisibleAt.Before(t[j].VisibleAt)
+	}
+	if !t[i].Created.Equal(t[j].Created) {
+		return t[i].Created.Before(t[j].Created)
+	}
+	return t[i].ID < t[j].ID
+}
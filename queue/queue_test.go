@@ -0,0 +1,155 @@
+package queue
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/flimzy/kivik"
+	_ "github.com/flimzy/kivik/driver/memory"
+)
+
+// newTestQueue returns a queue in a new memory database, with a clock which
+// is advanced by the returned function.
+func newTestQueue(t *testing.T, opts Options) (*Queue, func(time.Duration)) {
+	client, err := kivik.New(context.Background(), "memory", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := client.CreateDB(context.Background(), "tasks"); err != nil {
+		t.Fatal(err)
+	}
+	db, err := client.DB(context.Background(), "tasks")
+	if err != nil {
+		t.Fatal(err)
+	}
+	q := New(db, opts)
+	now := time.Date(2017, 1, 1, 0, 0, 0, 0, time.UTC)
+	q.now = func() time.Time { return now }
+	return q, func(d time.Duration) { now = now.Add(d) }
+}
+
+func TestQueue(t *testing.T) {
+	ctx := context.Background()
+	q, advance := newTestQueue(t, Options{})
+	first, err := q.Enqueue(ctx, "first")
+	if err != nil {
+		t.Fatal(err)
+	}
+	advance(time.Second)
+	if _, err := q.Enqueue(ctx, "second"); err != nil {
+		t.Fatal(err)
+	}
+	task, err := q.Claim(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if task.ID != first || string(task.Payload) != `"first"` || task.Attempts != 1 {
+		t.Errorf("Unexpected task: %+v", task)
+	}
+	if err := q.Complete(ctx, task); err != nil {
+		t.Fatal(err)
+	}
+	task, err = q.Claim(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(task.Payload) != `"second"` {
+		t.Errorf("Unexpected task: %+v", task)
+	}
+	if _, err := q.Claim(ctx); err != ErrEmpty {
+		t.Errorf("Expected ErrEmpty while the task is claimed, got %v", err)
+	}
+}
+
+func TestVisibilityTimeout(t *testing.T) {
+	ctx := context.Background()
+	q, advance := newTestQueue(t, Options{VisibilityTimeout: time.Minute, MaxAttempts: 2})
+	if _, err := q.Enqueue(ctx, "task"); err != nil {
+		t.Fatal(err)
+	}
+	lost, err := q.Claim(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	advance(2 * time.Minute)
+	task, err := q.Claim(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if task.Attempts != 2 {
+		t.Errorf("Expected a second attempt, got %d", task.Attempts)
+	}
+	if err := q.Complete(ctx, lost); kivik.StatusCode(err) != kivik.StatusConflict {
+		t.Errorf("Expected a conflict for an expired claim, got %v", err)
+	}
+
+	// The second claim expires too, and with no attempts left, the task is
+	// dead-lettered.
+	advance(2 * time.Minute)
+	if _, err := q.Claim(ctx); err != ErrEmpty {
+		t.Errorf("Expected ErrEmpty, got %v", err)
+	}
+	dead, err := q.DeadLetters(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(dead) != 1 || dead[0].ID != task.ID {
+		t.Fatalf("Unexpected dead letters: %v", dead)
+	}
+	if err := q.Requeue(ctx, dead[0]); err != nil {
+		t.Fatal(err)
+	}
+	if task, err = q.Claim(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if task.Attempts != 1 {
+		t.Errorf("Expected attempts to be reset, got %d", task.Attempts)
+	}
+}
+
+func TestFail(t *testing.T) {
+	ctx := context.Background()
+	q, advance := newTestQueue(t, Options{MaxAttempts: 2, RetryDelay: time.Minute})
+	if _, err := q.Enqueue(ctx, "task"); err != nil {
+		t.Fatal(err)
+	}
+	task, err := q.Claim(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := q.Fail(ctx, task, errors.New("oops")); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := q.Claim(ctx); err != ErrEmpty {
+		t.Errorf("Expected ErrEmpty before the retry delay, got %v", err)
+	}
+	advance(time.Minute)
+	if task, err = q.Claim(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if err := q.Fail(ctx, task, errors.New("oops again")); err != nil {
+		t.Fatal(err)
+	}
+	dead, err := q.DeadLetters(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(dead) != 1 || dead[0].Error != "oops again" {
+		t.Errorf("Unexpected dead letters: %v", dead)
+	}
+}
+
+func TestNames(t *testing.T) {
+	ctx := context.Background()
+	q, _ := newTestQueue(t, Options{Name: "a"})
+	other := New(q.db, Options{Name: "b"})
+	other.now = q.now
+	if _, err := q.Enqueue(ctx, "task"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := other.Claim(ctx); err != ErrEmpty {
+		t.Errorf("Expected ErrEmpty from another queue, got %v", err)
+	}
+}
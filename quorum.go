@@ -0,0 +1,63 @@
+package kivik
+
+import (
+	"github.com/flimzy/kivik/driver"
+	"github.com/flimzy/kivik/errors"
+)
+
+// Quorum is the CouchDB 2.x read and write quorum for a document request: the
+// number of copies of the document which must be read, or written, before the
+// server responds. Zero values are omitted, so that the server's default is
+// used.
+//
+// Quorum options are supported by Get, Put, Delete and BulkDocs. Drivers
+// which do not support them return StatusNotImplemented, rather than ignoring
+// them.
+//
+// See http://docs.couchdb.org/en/2.0.0/cluster/theory.html
+type Quorum struct {
+	// R is the read quorum, used by Get.
+	R int
+	// W is the write quorum, used by Put, Delete and BulkDocs.
+	W int
+}
+
+// Options returns the quorum as Options. An error is returned if R or W is
+// negative.
+func (q Quorum) Options() (Options, error) {
+	opts := Options{}
+	for name, value := range map[string]int{"r": q.R, "w": q.W} {
+		if value < 0 {
+			return nil, errors.Statusf(StatusBadRequest, "kivik: invalid quorum %s=%d", name, value)
+		}
+		if value > 0 {
+			opts[name] = value
+		}
+	}
+	return opts, nil
+}
+
+// checkQuorum validates the quorum options, r and w, if present, and ensures
+// that db supports them.
+func checkQuorum(db driver.DB, opts Options) error {
+	var found bool
+	for _, name := range []string{"r", "w"} {
+		value, ok := opts[name]
+		if !ok {
+			continue
+		}
+		if n, isInt := value.(int); !isInt || n < 1 {
+			return errors.Statusf(StatusBadRequest, "kivik: invalid quorum %s=%v", name, value)
+		}
+		found = true
+	}
+	if found && !supportsQuorum(db) {
+		return errors.Status(StatusNotImplemented, "kivik: driver does not support quorum options")
+	}
+	return nil
+}
+
+func supportsQuorum(db driver.DB) bool {
+	q, ok := db.(driver.Quorumer)
+	return ok && q.SupportsQuorum()
+}
@@ -0,0 +1,111 @@
+package kivik
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+
+	"github.com/flimzy/diff"
+)
+
+func TestQuorumOptions(t *testing.T) {
+	tests := []struct {
+		name     string
+		quorum   Quorum
+		expected Options
+		status   int
+	}{
+		{
+			name:     "Default",
+			expected: Options{},
+		},
+		{
+			name:     "ReadWrite",
+			quorum:   Quorum{R: 1, W: 3},
+			expected: Options{"r": 1, "w": 3},
+		},
+		{
+			name:   "Negative",
+			quorum: Quorum{W: -1},
+			status: StatusBadRequest,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			opts, err := test.quorum.Options()
+			if StatusCode(err) != test.status {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if d := diff.Interface(test.expected, opts); d != "" {
+				t.Error(d)
+			}
+		})
+	}
+}
+
+// quorumDB records the options passed to it.
+type quorumDB struct {
+	dummyDB
+	opts map[string]interface{}
+}
+
+func (db *quorumDB) SupportsQuorum() bool { return true }
+
+func (db *quorumDB) Get(_ context.Context, _ string, opts map[string]interface{}) (json.RawMessage, error) {
+	db.opts = opts
+	return json.RawMessage(`{}`), nil
+}
+
+func (db *quorumDB) PutOpts(_ context.Context, _ string, _ interface{}, opts map[string]interface{}) (string, error) {
+	db.opts = opts
+	return "1-xxx", nil
+}
+
+func (db *quorumDB) DeleteOpts(_ context.Context, _, _ string, opts map[string]interface{}) (string, error) {
+	db.opts = opts
+	return "2-xxx", nil
+}
+
+func TestQuorum(t *testing.T) {
+	ctx := context.Background()
+	calls := map[string]func(*DB, Options) error{
+		"Get": func(db *DB, opts Options) error {
+			_, err := db.Get(ctx, "foo", opts)
+			return err
+		},
+		"Put": func(db *DB, opts Options) error {
+			_, err := db.Put(ctx, "foo", map[string]string{}, opts)
+			return err
+		},
+		"Delete": func(db *DB, opts Options) error {
+			_, err := db.Delete(ctx, "foo", "1-xxx", opts)
+			return err
+		},
+	}
+	for name, call := range calls {
+		t.Run(name, func(t *testing.T) {
+			t.Run("NotSupported", func(t *testing.T) {
+				err := call(&DB{driverDB: &dummyDB{}}, Options{"w": 2})
+				if StatusCode(err) != StatusNotImplemented {
+					t.Errorf("Expected NotImplemented, got %v", err)
+				}
+			})
+			t.Run("Invalid", func(t *testing.T) {
+				err := call(&DB{driverDB: &quorumDB{}}, Options{"r": "2"})
+				if StatusCode(err) != StatusBadRequest {
+					t.Errorf("Expected BadRequest, got %v", err)
+				}
+			})
+			t.Run("Supported", func(t *testing.T) {
+				driverDB := &quorumDB{}
+				opts, _ := Quorum{R: 2, W: 2}.Options()
+				if err := call(&DB{driverDB: driverDB}, opts); err != nil {
+					t.Fatal(err)
+				}
+				if d := diff.Interface(map[string]interface{}{"r": 2, "w": 2}, driverDB.opts); d != "" {
+					t.Error(d)
+				}
+			})
+		})
+	}
+}
@@ -0,0 +1,223 @@
+package readonly
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+
+	"github.com/flimzy/kivik/driver"
+)
+
+type db struct {
+	db driver.DB
+}
+
+var _ driver.DB = &db{}
+var _ driver.Finder = &db{}
+var _ driver.Explainer = &db{}
+var _ driver.AttachmentMetaer = &db{}
+var _ driver.AttachmentCombiner = &db{}
+var _ driver.Rever = &db{}
+var _ driver.DBFlusher = &db{}
+var _ driver.Copier = &db{}
+var _ driver.OptsBulkDocer = &db{}
+var _ driver.OptsPutter = &db{}
+var _ driver.OptsDeleter = &db{}
+var _ driver.Quorumer = &db{}
+var _ driver.OpenRevsGetter = &db{}
+var _ driver.OptsDocCreator = &db{}
+var _ driver.BodyGetter = &db{}
+var _ driver.DesignInfoer = &db{}
+var _ driver.MultipartPutter = &db{}
+var _ driver.OptionValidator = &db{}
+
+func (d *db) AllDocs(ctx context.Context, opts map[string]interface{}) (driver.Rows, error) {
+	return d.db.AllDocs(ctx, opts)
+}
+
+func (d *db) Query(ctx context.Context, ddoc, view string, opts map[string]interface{}) (driver.Rows, error) {
+	return d.db.Query(ctx, ddoc, view, opts)
+}
+
+func (d *db) Get(ctx context.Context, docID string, opts map[string]interface{}) (json.RawMessage, error) {
+	return d.db.Get(ctx, docID, opts)
+}
+
+func (d *db) CreateDoc(_ context.Context, _ interface{}) (string, string, error) {
+	return "", "", errReadOnly
+}
+
+func (d *db) CreateDocOpts(_ context.Context, _ interface{}, _ map[string]interface{}) (string, string, error) {
+	return "", "", errReadOnly
+}
+
+func (d *db) Put(_ context.Context, _ string, _ interface{}) (string, error) {
+	return "", errReadOnly
+}
+
+func (d *db) PutOpts(_ context.Context, _ string, _ interface{}, _ map[string]interface{}) (string, error) {
+	return "", errReadOnly
+}
+
+func (d *db) Delete(_ context.Context, _, _ string) (string, error) {
+	return "", errReadOnly
+}
+
+func (d *db) DeleteOpts(_ context.Context, _, _ string, _ map[string]interface{}) (string, error) {
+	return "", errReadOnly
+}
+
+func (d *db) BulkDocs(_ context.Context, _ []interface{}) (driver.BulkResults, error) {
+	return nil, errReadOnly
+}
+
+func (d *db) BulkDocsOpts(_ context.Context, _ []interface{}, _ map[string]interface{}) (driver.BulkResults, error) {
+	return nil, errReadOnly
+}
+
+func (d *db) Copy(_ context.Context, _, _ string, _ map[string]interface{}) (string, error) {
+	return "", errReadOnly
+}
+
+func (d *db) PutAttachment(_ context.Context, _, _, _, _ string, _ io.Reader) (string, error) {
+	return "", errReadOnly
+}
+
+func (d *db) GetAttachment(ctx context.Context, docID, rev, filename string) (string, driver.MD5sum, io.ReadCloser, error) {
+	return d.db.GetAttachment(ctx, docID, rev, filename)
+}
+
+func (d *db) DeleteAttachment(_ context.Context, _, _, _ string) (string, error) {
+	return "", errReadOnly
+}
+
+func (d *db) Stats(ctx context.Context) (*driver.DBStats, error) {
+	return d.db.Stats(ctx)
+}
+
+func (d *db) Compact(_ context.Context) error {
+	return errReadOnly
+}
+
+func (d *db) CompactView(_ context.Context, _ string) error {
+	return errReadOnly
+}
+
+func (d *db) ViewCleanup(_ context.Context) error {
+	return errReadOnly
+}
+
+func (d *db) Security(ctx context.Context) (*driver.Security, error) {
+	return d.db.Security(ctx)
+}
+
+func (d *db) SetSecurity(_ context.Context, _ *driver.Security) error {
+	return errReadOnly
+}
+
+func (d *db) Changes(ctx context.Context, opts map[string]interface{}) (driver.Changes, error) {
+	return d.db.Changes(ctx, opts)
+}
+
+func (d *db) Find(ctx context.Context, query interface{}) (driver.Rows, error) {
+	f, ok := d.db.(driver.Finder)
+	if !ok {
+		return nil, notImplemented("Finder")
+	}
+	return f.Find(ctx, query)
+}
+
+func (d *db) CreateIndex(_ context.Context, _, _ string, _ interface{}) error {
+	return errReadOnly
+}
+
+func (d *db) GetIndexes(ctx context.Context) ([]driver.Index, error) {
+	f, ok := d.db.(driver.Finder)
+	if !ok {
+		return nil, notImplemented("Finder")
+	}
+	return f.GetIndexes(ctx)
+}
+
+func (d *db) DeleteIndex(_ context.Context, _, _ string) error {
+	return errReadOnly
+}
+
+func (d *db) GetAttachmentMeta(ctx context.Context, docID, rev, filename string) (string, driver.MD5sum, error) {
+	m, ok := d.db.(driver.AttachmentMetaer)
+	if !ok {
+		return "", driver.MD5sum{}, notImplemented("AttachmentMetaer")
+	}
+	return m.GetAttachmentMeta(ctx, docID, rev, filename)
+}
+
+func (d *db) Rev(ctx context.Context, docID string) (string, error) {
+	r, ok := d.db.(driver.Rever)
+	if !ok {
+		return "", notImplemented("Rever")
+	}
+	return r.Rev(ctx, docID)
+}
+
+// Flush is passed to the wrapped driver, as it only ensures that data already
+// written is persisted.
+func (d *db) Flush(ctx context.Context) error {
+	f, ok := d.db.(driver.DBFlusher)
+	if !ok {
+		return notImplemented("DBFlusher")
+	}
+	return f.Flush(ctx)
+}
+
+func (d *db) GetOpenRevs(ctx context.Context, docID string, revs []string, opts map[string]interface{}) ([]driver.OpenRev, error) {
+	g, ok := d.db.(driver.OpenRevsGetter)
+	if !ok {
+		return nil, notImplemented("OpenRevsGetter")
+	}
+	return g.GetOpenRevs(ctx, docID, revs, opts)
+}
+
+func (d *db) GetBody(ctx context.Context, docID string, opts map[string]interface{}) (io.ReadCloser, error) {
+	g, ok := d.db.(driver.BodyGetter)
+	if !ok {
+		return nil, notImplemented("BodyGetter")
+	}
+	return g.GetBody(ctx, docID, opts)
+}
+
+// SupportsQuorum reports whether the wrapped DB honors the read quorum.
+func (d *db) SupportsQuorum() bool {
+	q, ok := d.db.(driver.Quorumer)
+	return ok && q.SupportsQuorum()
+}
+
+func (d *db) SupportedOptions(method string) (map[string]driver.OptionType, bool) {
+	if v, ok := d.db.(driver.OptionValidator); ok {
+		return v.SupportedOptions(method)
+	}
+	return nil, false
+}
+
+func (d *db) PutMultipart(_ context.Context, _ string, _ interface{}, _ []driver.MultipartAttachment, _ map[string]interface{}) (string, error) {
+	return "", errReadOnly
+}
+
+func (d *db) Explain(ctx context.Context, query interface{}) (*driver.QueryPlan, error) {
+	e, ok := d.db.(driver.Explainer)
+	if !ok {
+		return nil, notImplemented("Explainer")
+	}
+	return e.Explain(ctx, query)
+}
+
+func (d *db) DesignInfo(ctx context.Context, ddoc string) (*driver.DesignInfo, error) {
+	i, ok := d.db.(driver.DesignInfoer)
+	if !ok {
+		return nil, notImplemented("DesignInfoer")
+	}
+	return i.DesignInfo(ctx, ddoc)
+}
+
+func (d *db) CombineAttachments(_ context.Context, _, _, _, _ string, _ []string) (string, error) {
+	return "", errReadOnly
+}
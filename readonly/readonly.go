@@ -0,0 +1,235 @@
+// Package readonly provides a Kivik driver which wraps another driver, and
+// rejects every operation which would modify data, unconditionally, with a
+// StatusForbidden error. This allows a client to be handed to code, such as a
+// dashboard or reporting job, which must never write, regardless of the
+// permissions of the credentials it uses.
+//
+//	readonly.Register("couch-readonly", "couch")
+//	client, err := kivik.New(context.TODO(), "couch-readonly", "http://localhost:5984/")
+//
+// Reads, including queries, the changes feed, and the reading of
+// configuration and replications, are passed to the wrapped driver. The
+// wrapped driver implements all of the optional driver interfaces. Where the
+// underlying driver does not implement an interface, the corresponding read
+// methods return a StatusNotImplemented error.
+package readonly
+
+import (
+	"context"
+
+	"github.com/flimzy/kivik"
+	"github.com/flimzy/kivik/driver"
+	"github.com/flimzy/kivik/errors"
+)
+
+type readOnlyDriver struct {
+	drv driver.Driver
+}
+
+var _ driver.Driver = &readOnlyDriver{}
+
+// New returns a driver which wraps drv, and rejects writes.
+func New(drv driver.Driver) driver.Driver {
+	return &readOnlyDriver{drv: drv}
+}
+
+// Register registers a read-only version of the driver registered as
+// wrapped, under the new name name.
+func Register(name, wrapped string) error {
+	drv, ok := kivik.LookupDriver(wrapped)
+	if !ok {
+		return errors.Statusf(kivik.StatusBadRequest, "readonly: unknown driver %q (forgotten import?)", wrapped)
+	}
+	kivik.Register(name, New(drv))
+	return nil
+}
+
+func (d *readOnlyDriver) NewClient(ctx context.Context, dsn string) (driver.Client, error) {
+	c, err := d.drv.NewClient(ctx, dsn)
+	if err != nil {
+		return nil, err
+	}
+	return &client{client: c}, nil
+}
+
+// errReadOnly is returned by all operations which would modify data.
+var errReadOnly = errors.Status(kivik.StatusForbidden, "readonly: client is read-only")
+
+func notImplemented(iface string) error {
+	return errors.Statusf(kivik.StatusNotImplemented, "kivik: driver does not implement %s", iface)
+}
+
+type client struct {
+	client driver.Client
+}
+
+var _ driver.Client = &client{}
+var _ driver.ClientReplicator = &client{}
+var _ driver.Authenticator = &client{}
+var _ driver.DBUpdater = &client{}
+var _ driver.PoolStatser = &client{}
+var _ driver.AdminPartyChecker = &client{}
+var _ driver.DiskUsager = &client{}
+var _ driver.Configer = &client{}
+var _ driver.Clusterer = &client{}
+var _ driver.OptionValidator = &client{}
+
+func (c *client) Version(ctx context.Context) (*driver.Version, error) {
+	return c.client.Version(ctx)
+}
+
+func (c *client) AllDBs(ctx context.Context, opts map[string]interface{}) ([]string, error) {
+	return c.client.AllDBs(ctx, opts)
+}
+
+func (c *client) DBExists(ctx context.Context, dbName string, opts map[string]interface{}) (bool, error) {
+	return c.client.DBExists(ctx, dbName, opts)
+}
+
+func (c *client) CreateDB(_ context.Context, _ string, _ map[string]interface{}) error {
+	return errReadOnly
+}
+
+func (c *client) DestroyDB(_ context.Context, _ string, _ map[string]interface{}) error {
+	return errReadOnly
+}
+
+func (c *client) DB(ctx context.Context, dbName string, opts map[string]interface{}) (driver.DB, error) {
+	d, err := c.client.DB(ctx, dbName, opts)
+	if err != nil {
+		return nil, err
+	}
+	return &db{db: d}, nil
+}
+
+func (c *client) Replicate(_ context.Context, _, _ string, _ map[string]interface{}) (driver.Replication, error) {
+	return nil, errReadOnly
+}
+
+// GetReplications returns the replications, which cannot be deleted.
+func (c *client) GetReplications(ctx context.Context, opts map[string]interface{}) ([]driver.Replication, error) {
+	r, ok := c.client.(driver.ClientReplicator)
+	if !ok {
+		return nil, notImplemented("ClientReplicator")
+	}
+	reps, err := r.GetReplications(ctx, opts)
+	if err != nil {
+		return nil, err
+	}
+	for i, rep := range reps {
+		reps[i] = &replication{Replication: rep}
+	}
+	return reps, nil
+}
+
+type replication struct {
+	driver.Replication
+}
+
+func (r *replication) Delete(_ context.Context) error {
+	return errReadOnly
+}
+
+// Authenticate is passed to the wrapped driver, as authenticating does not
+// modify data.
+func (c *client) Authenticate(ctx context.Context, authenticator interface{}) error {
+	a, ok := c.client.(driver.Authenticator)
+	if !ok {
+		return notImplemented("Authenticator")
+	}
+	return a.Authenticate(ctx, authenticator)
+}
+
+func (c *client) DBUpdates() (driver.DBUpdates, error) {
+	u, ok := c.client.(driver.DBUpdater)
+	if !ok {
+		return nil, notImplemented("DBUpdater")
+	}
+	return u.DBUpdates()
+}
+
+func (c *client) PoolStats() (driver.PoolStats, error) {
+	s, ok := c.client.(driver.PoolStatser)
+	if !ok {
+		return driver.PoolStats{}, notImplemented("PoolStatser")
+	}
+	return s.PoolStats()
+}
+
+func (c *client) AdminParty(ctx context.Context) (bool, error) {
+	a, ok := c.client.(driver.AdminPartyChecker)
+	if !ok {
+		return false, notImplemented("AdminPartyChecker")
+	}
+	return a.AdminParty(ctx)
+}
+
+func (c *client) DiskUsage(ctx context.Context) (*driver.DiskUsage, error) {
+	u, ok := c.client.(driver.DiskUsager)
+	if !ok {
+		return nil, notImplemented("DiskUsager")
+	}
+	return u.DiskUsage(ctx)
+}
+
+func (c *client) configer() (driver.Configer, error) {
+	if configer, ok := c.client.(driver.Configer); ok {
+		return configer, nil
+	}
+	return nil, notImplemented("Configer")
+}
+
+func (c *client) Config(ctx context.Context, node string) (driver.Config, error) {
+	configer, err := c.configer()
+	if err != nil {
+		return nil, err
+	}
+	return configer.Config(ctx, node)
+}
+
+func (c *client) ConfigSection(ctx context.Context, node, section string) (driver.ConfigSection, error) {
+	configer, err := c.configer()
+	if err != nil {
+		return nil, err
+	}
+	return configer.ConfigSection(ctx, node, section)
+}
+
+func (c *client) ConfigValue(ctx context.Context, node, section, key string) (string, error) {
+	configer, err := c.configer()
+	if err != nil {
+		return "", err
+	}
+	return configer.ConfigValue(ctx, node, section, key)
+}
+
+func (c *client) SetConfigValue(_ context.Context, _, _, _, _ string) (string, error) {
+	return "", errReadOnly
+}
+
+func (c *client) DeleteConfigKey(_ context.Context, _, _, _ string) (string, error) {
+	return "", errReadOnly
+}
+
+func (c *client) Membership(ctx context.Context) (*driver.Membership, error) {
+	clusterer, ok := c.client.(driver.Clusterer)
+	if !ok {
+		return nil, notImplemented("Clusterer")
+	}
+	return clusterer.Membership(ctx)
+}
+
+func (c *client) AddNode(_ context.Context, _ string) error {
+	return errReadOnly
+}
+
+func (c *client) RemoveNode(_ context.Context, _ string) error {
+	return errReadOnly
+}
+
+func (c *client) SupportedOptions(method string) (map[string]driver.OptionType, bool) {
+	if v, ok := c.client.(driver.OptionValidator); ok {
+		return v.SupportedOptions(method)
+	}
+	return nil, false
+}
@@ -0,0 +1,145 @@
+package readonly
+
+import (
+	"context"
+	"testing"
+
+	"github.com/flimzy/kivik"
+	"github.com/flimzy/kivik/driver"
+	_ "github.com/flimzy/kivik/driver/memory"
+	"github.com/flimzy/kivik/kiviktest"
+)
+
+// existingClient is a driver which returns a client already created, so
+// that data may be written before it is wrapped.
+type existingClient struct {
+	client driver.Client
+}
+
+func (d *existingClient) NewClient(_ context.Context, _ string) (driver.Client, error) {
+	return d.client, nil
+}
+
+func newTestClient(t *testing.T) *kivik.Client {
+	ctx := context.Background()
+	memDriver, _ := kivik.LookupDriver("memory")
+	mem, err := memDriver.NewClient(ctx, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = mem.CreateDB(ctx, "foo", nil); err != nil {
+		t.Fatal(err)
+	}
+	memDB, err := mem.DB(ctx, "foo", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = memDB.Put(ctx, "bar", map[string]interface{}{"_id": "bar"}); err != nil {
+		t.Fatal(err)
+	}
+	return kiviktest.NewClient(t, New(&existingClient{client: mem}), "")
+}
+
+func TestReads(t *testing.T) {
+	ctx := context.Background()
+	client := newTestClient(t)
+	if exists, err := client.DBExists(ctx, "foo"); err != nil || !exists {
+		t.Fatalf("Expected foo to exist, got %t, %v", exists, err)
+	}
+	db, err := client.DB(ctx, "foo")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := db.Get(ctx, "bar"); err != nil {
+		t.Errorf("Get failed: %s", err)
+	}
+	if _, err := db.Security(ctx); err != nil {
+		t.Errorf("Security failed: %s", err)
+	}
+}
+
+func TestWrites(t *testing.T) {
+	ctx := context.Background()
+	client := newTestClient(t)
+	db, err := client.DB(ctx, "foo")
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name string
+		fn   func() error
+	}{
+		{"CreateDB", func() error { return client.CreateDB(ctx, "baz") }},
+		{"DestroyDB", func() error { return client.DestroyDB(ctx, "foo") }},
+		{"Put", func() error {
+			_, err := db.Put(ctx, "baz", map[string]interface{}{})
+			return err
+		}},
+		{"CreateDoc", func() error {
+			_, _, err := db.CreateDoc(ctx, map[string]interface{}{})
+			return err
+		}},
+		{"Delete", func() error {
+			_, err := db.Delete(ctx, "bar", "1-xxx")
+			return err
+		}},
+		{"PutMultipart", func() error {
+			_, err := db.PutMultipart(ctx, "baz", map[string]interface{}{}, nil)
+			return err
+		}},
+		{"BulkDocs", func() error {
+			_, err := db.BulkDocs(ctx, []interface{}{map[string]interface{}{}})
+			return err
+		}},
+		{"Compact", func() error { return db.Compact(ctx) }},
+		{"SetSecurity", func() error { return db.SetSecurity(ctx, &kivik.Security{}) }},
+		{"CreateIndex", func() error { return db.CreateIndex(ctx, "", "", `{}`) }},
+		{"SetConfigValue", func() error {
+			_, err := client.SetConfigValue(ctx, kivik.LocalNode, "foo", "bar", "baz")
+			return err
+		}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if status := kivik.StatusCode(test.fn()); status != kivik.StatusForbidden {
+				t.Errorf("Expected status %d, got %d", kivik.StatusForbidden, status)
+			}
+		})
+	}
+	if _, err := db.Get(ctx, "bar"); err != nil {
+		t.Errorf("Document was modified: %s", err)
+	}
+}
+
+func TestCombineAttachments(t *testing.T) {
+	// The parts could only have been uploaded without the read-only driver,
+	// but their recombination is rejected all the same.
+	if _, err := (&db{}).CombineAttachments(context.Background(), "bar", "2-xxx", "foo.txt", "text/plain", []string{"foo.txt.part000000"}); kivik.StatusCode(err) != kivik.StatusForbidden {
+		t.Errorf("Unexpected error: %v", err)
+	}
+}
+
+// designInfoDB reports the status of any design document's index.
+type designInfoDB struct {
+	driver.DB
+}
+
+func (d *designInfoDB) DesignInfo(_ context.Context, ddoc string) (*driver.DesignInfo, error) {
+	return &driver.DesignInfo{Name: ddoc}, nil
+}
+
+func TestDesignInfo(t *testing.T) {
+	ctx := context.Background()
+	if _, err := (&db{db: &designInfoDB{}}).DesignInfo(ctx, "foo"); err != nil {
+		t.Errorf("DesignInfo failed: %s", err)
+	}
+	client := newTestClient(t)
+	db, err := client.DB(ctx, "foo")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The memory driver does not report the status of indexes.
+	if _, err := db.DesignInfo(ctx, "foo"); kivik.StatusCode(err) != kivik.StatusNotImplemented {
+		t.Errorf("Unexpected error: %v", err)
+	}
+}
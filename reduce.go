@@ -0,0 +1,63 @@
+package kivik
+
+import (
+	"math"
+	"reflect"
+)
+
+// ReduceStats is the result of the built-in _stats reduce function.
+type ReduceStats struct {
+	Sum    float64 `json:"sum"`
+	Count  int64   `json:"count"`
+	Min    float64 `json:"min"`
+	Max    float64 `json:"max"`
+	SumSqr float64 `json:"sumsqr"`
+}
+
+// Mean returns the mean of the reduced values, or NaN if there were none.
+func (s *ReduceStats) Mean() float64 {
+	if s.Count == 0 {
+		return math.NaN()
+	}
+	return s.Sum / float64(s.Count)
+}
+
+// combine adds the values summarized by o to s.
+func (s *ReduceStats) combine(o *ReduceStats) {
+	if s.Count == 0 {
+		*s = *o
+		return
+	}
+	if o.Count == 0 {
+		return
+	}
+	s.Sum += o.Sum
+	s.Count += o.Count
+	s.SumSqr += o.SumSqr
+	s.Min = math.Min(s.Min, o.Min)
+	s.Max = math.Max(s.Max, o.Max)
+}
+
+// SumFloat64 reads the remaining rows of a reduced view, as with the built-in
+// _sum or _count reduce functions, and returns the sum of their values, and
+// closes r. For an ungrouped reduce, there is a single row, so this is its
+// value. As with All, no more than MaxRows rows are read.
+func (r *Rows) SumFloat64() (float64, error) {
+	var sum float64
+	err := r.collect(reflect.TypeOf(sum), func(v reflect.Value) {
+		sum += v.Elem().Float()
+	})
+	return sum, err
+}
+
+// ReduceStats reads the remaining rows of a view reduced with the built-in
+// _stats function, and returns their combined statistics, and closes r. For
+// an ungrouped reduce, these are the statistics of its single row. To read
+// the statistics of each group, use Map with a map[string]ReduceStats.
+func (r *Rows) ReduceStats() (*ReduceStats, error) {
+	stats := &ReduceStats{}
+	err := r.collect(reflect.TypeOf(*stats), func(v reflect.Value) {
+		stats.combine(v.Interface().(*ReduceStats))
+	})
+	return stats, err
+}
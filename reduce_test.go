@@ -0,0 +1,84 @@
+package kivik
+
+import (
+	"context"
+	"math"
+	"testing"
+
+	"github.com/flimzy/diff"
+)
+
+func TestSumFloat64(t *testing.T) {
+	r := newRows(context.Background(), &sliceRows{input: []string{
+		`{"key":"a","value":1.5}`,
+		`{"key":"b","value":2}`,
+	}}, false)
+	sum, err := r.SumFloat64()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if sum != 3.5 {
+		t.Errorf("Expected 3.5, got %v", sum)
+	}
+}
+
+func TestReduceStats(t *testing.T) {
+	tests := []struct {
+		name     string
+		input    []string
+		expected *ReduceStats
+	}{
+		{
+			name:     "Ungrouped",
+			input:    []string{`{"key":null,"value":{"sum":6,"count":3,"min":1,"max":3,"sumsqr":14}}`},
+			expected: &ReduceStats{Sum: 6, Count: 3, Min: 1, Max: 3, SumSqr: 14},
+		},
+		{
+			name: "Grouped",
+			input: []string{
+				`{"key":"a","value":{"sum":3,"count":2,"min":1,"max":2,"sumsqr":5}}`,
+				`{"key":"b","value":{"sum":10,"count":2,"min":4,"max":6,"sumsqr":52}}`,
+			},
+			expected: &ReduceStats{Sum: 13, Count: 4, Min: 1, Max: 6, SumSqr: 57},
+		},
+		{
+			name:     "Empty",
+			expected: &ReduceStats{},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			r := newRows(context.Background(), &sliceRows{input: test.input}, false)
+			stats, err := r.ReduceStats()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if d := diff.Interface(test.expected, stats); d != "" {
+				t.Error(d)
+			}
+		})
+	}
+}
+
+func TestReduceStatsMean(t *testing.T) {
+	if mean := (&ReduceStats{Sum: 6, Count: 4}).Mean(); mean != 1.5 {
+		t.Errorf("Expected 1.5, got %v", mean)
+	}
+	if mean := (&ReduceStats{}).Mean(); !math.IsNaN(mean) {
+		t.Errorf("Expected NaN, got %v", mean)
+	}
+}
+
+func TestMapGroupedStats(t *testing.T) {
+	r := newRows(context.Background(), &sliceRows{input: []string{
+		`{"key":"a","value":{"sum":3,"count":2,"min":1,"max":2,"sumsqr":5}}`,
+	}}, false)
+	var stats map[string]ReduceStats
+	if err := r.Map(&stats); err != nil {
+		t.Fatal(err)
+	}
+	expected := map[string]ReduceStats{"a": {Sum: 3, Count: 2, Min: 1, Max: 2, SumSqr: 5}}
+	if d := diff.Interface(expected, stats); d != "" {
+		t.Error(d)
+	}
+}
@@ -1,26 +1,138 @@
 package kivik
 
 import (
+	"context"
+	"fmt"
 	"sync"
 
 	"github.com/flimzy/kivik/driver"
 )
 
-var (
-	driversMu sync.RWMutex
-	drivers   = make(map[string]driver.Driver)
-)
+// Registry is a set of database drivers, registered by name. The package
+// level functions, such as Register and New, use a global Registry, with
+// which drivers register themselves when imported. A separate Registry may be
+// created, per test or per application module, to avoid depending on global
+// state.
+type Registry struct {
+	mu      sync.RWMutex
+	drivers map[string]driver.Driver
+}
+
+// NewRegistry returns a new, empty Registry.
+func NewRegistry() *Registry {
+	return &Registry{drivers: make(map[string]driver.Driver)}
+}
+
+var defaultRegistry = NewRegistry()
 
 // Register makes a database driver available by the provided name. If Register
 // is called twice with the same name or if driver is nil, it panics.
-func Register(name string, driver driver.Driver) {
-	driversMu.Lock()
-	defer driversMu.Unlock()
+func (r *Registry) Register(name string, driver driver.Driver) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
 	if driver == nil {
 		panic("kivik: Register driver is nil")
 	}
-	if _, dup := drivers[name]; dup {
+	if _, dup := r.drivers[name]; dup {
 		panic("kivk: Register called twice for driver " + name)
 	}
-	drivers[name] = driver
+	r.drivers[name] = driver
+}
+
+// Lookup returns the database driver registered by the provided name, and
+// true, or nil and false if no such driver is registered.
+func (r *Registry) Lookup(name string) (driver.Driver, bool) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	drv, ok := r.drivers[name]
+	return drv, ok
+}
+
+// Unregister removes the driver registered by the provided name, if any.
+// Clients already created with the driver are not affected.
+func (r *Registry) Unregister(name string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	delete(r.drivers, name)
+}
+
+// Replace registers driver by the provided name, replacing any driver already
+// registered by that name, and returns a function which restores the previous
+// registration. Replace panics if driver is nil.
+func (r *Registry) Replace(name string, driver driver.Driver) (restore func()) {
+	if driver == nil {
+		panic("kivik: Replace driver is nil")
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	prev, hadPrev := r.drivers[name]
+	r.drivers[name] = driver
+	return func() {
+		r.mu.Lock()
+		defer r.mu.Unlock()
+		if hadPrev {
+			r.drivers[name] = prev
+			return
+		}
+		delete(r.drivers, name)
+	}
+}
+
+// New creates a new client object specified by the name of a driver in the
+// registry, and a driver-specific data source name.
+func (r *Registry) New(ctx context.Context, driverName, dataSourceName string) (*Client, error) {
+	driveri, ok := r.Lookup(driverName)
+	if !ok {
+		return nil, fmt.Errorf("kivik: unknown driver %q (forgotten import?)", driverName)
+	}
+	client, err := NewClientFromDriver(ctx, driveri, dataSourceName)
+	if err != nil {
+		return nil, err
+	}
+	client.driverName = driverName
+	return client, nil
+}
+
+// NewClientFromDriver creates a new client object with driver, which need not
+// be registered, and a driver-specific data source name. The Driver method of
+// the client returns an empty string.
+func NewClientFromDriver(ctx context.Context, driver driver.Driver, dataSourceName string) (*Client, error) {
+	client, err := driver.NewClient(ctx, dataSourceName)
+	if err != nil {
+		return nil, err
+	}
+	return &Client{
+		dsn:          dataSourceName,
+		driverClient: client,
+	}, nil
+}
+
+// Register makes a database driver available by the provided name. If Register
+// is called twice with the same name or if driver is nil, it panics.
+func Register(name string, driver driver.Driver) {
+	defaultRegistry.Register(name, driver)
+}
+
+// LookupDriver returns the database driver registered by the provided name,
+// and true, or nil and false if no such driver is registered.
+func LookupDriver(name string) (driver.Driver, bool) {
+	return defaultRegistry.Lookup(name)
+}
+
+// Unregister removes the driver registered by the provided name, if any. It is
+// intended for tests, which register mock drivers. Clients already created
+// with the driver are not affected.
+func Unregister(name string) {
+	defaultRegistry.Unregister(name)
+}
+
+// Replace registers driver by the provided name, replacing any driver already
+// registered by that name, and returns a function which restores the previous
+// registration. It is intended for tests, which swap in mock drivers:
+//
+//	defer kivik.Replace("couch", mockDriver)()
+//
+// Replace panics if driver is nil.
+func Replace(name string, driver driver.Driver) (restore func()) {
+	return defaultRegistry.Replace(name, driver)
 }
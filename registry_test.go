@@ -0,0 +1,81 @@
+package kivik
+
+import (
+	"context"
+	"testing"
+
+	"github.com/flimzy/kivik/driver"
+)
+
+type registryDriver struct {
+	name string
+}
+
+func (d *registryDriver) NewClient(_ context.Context, _ string) (driver.Client, error) {
+	return nil, nil
+}
+
+func TestReplace(t *testing.T) {
+	const name = "kivik_test_replace"
+	orig := &registryDriver{name: "orig"}
+	Register(name, orig)
+	defer Unregister(name)
+
+	restore := Replace(name, &registryDriver{name: "mock"})
+	if drv, _ := LookupDriver(name); drv.(*registryDriver).name != "mock" {
+		t.Errorf("Expected the mock driver, got %v", drv)
+	}
+	restore()
+	if drv, _ := LookupDriver(name); drv != orig {
+		t.Errorf("Expected the original driver to be restored, got %v", drv)
+	}
+
+	Unregister(name)
+	if _, ok := LookupDriver(name); ok {
+		t.Error("Expected the driver to be unregistered")
+	}
+	restore = Replace(name, orig)
+	restore()
+	if _, ok := LookupDriver(name); ok {
+		t.Error("Expected restore to unregister a driver which was not previously registered")
+	}
+	// Registering again, after Unregister, must not panic.
+	Register(name, orig)
+}
+
+func TestRegistry(t *testing.T) {
+	const name = "kivik_test_registry"
+	r := NewRegistry()
+	drv := &registryDriver{name: "local"}
+	r.Register(name, drv)
+	if found, ok := r.Lookup(name); !ok || found != drv {
+		t.Errorf("Expected the driver to be registered, got %v", found)
+	}
+	if _, ok := LookupDriver(name); ok {
+		t.Error("Expected the driver not to be registered globally")
+	}
+	client, err := r.New(context.Background(), name, "dsn")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if client.Driver() != name || client.DSN() != "dsn" {
+		t.Errorf("Unexpected client driver %q, DSN %q", client.Driver(), client.DSN())
+	}
+	if _, err := New(context.Background(), name, "dsn"); err == nil {
+		t.Error("Expected the global registry not to know the driver")
+	}
+	r.Unregister(name)
+	if _, err := r.New(context.Background(), name, "dsn"); err == nil {
+		t.Error("Expected an error for an unregistered driver")
+	}
+}
+
+func TestNewClientFromDriver(t *testing.T) {
+	client, err := NewClientFromDriver(context.Background(), &registryDriver{}, "dsn")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if client.Driver() != "" || client.DSN() != "dsn" {
+		t.Errorf("Unexpected client driver %q, DSN %q", client.Driver(), client.DSN())
+	}
+}
@@ -0,0 +1,146 @@
+package replicate
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+
+	"github.com/flimzy/kivik"
+	"github.com/flimzy/kivik/errors"
+)
+
+// stubs returns the fields of doc, and the attachment stubs of its
+// _attachments field.
+func stubs(doc json.RawMessage) (map[string]json.RawMessage, map[string]map[string]interface{}, error) {
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(doc, &fields); err != nil {
+		return nil, nil, errors.WrapStatus(kivik.StatusBadResponse, err)
+	}
+	var atts map[string]map[string]interface{}
+	if raw, ok := fields["_attachments"]; ok {
+		if err := json.Unmarshal(raw, &atts); err != nil {
+			return nil, nil, errors.WrapStatus(kivik.StatusBadResponse, err)
+		}
+	}
+	for filename, att := range atts {
+		if stub, _ := att["stub"].(bool); !stub {
+			delete(atts, filename)
+		}
+	}
+	return fields, atts, nil
+}
+
+// writeAttachments writes a document whose attachments are stubs, with the
+// attachments' content fetched from the source, and returns true. If the
+// document has no stubs, it returns false, and the document is not written.
+func (r *Replicator) writeAttachments(ctx context.Context, docID, rev string, doc json.RawMessage, p *Progress) (bool, error) {
+	fields, atts, err := stubs(doc)
+	if err != nil || len(atts) == 0 {
+		return false, err
+	}
+	err = r.streamAttachments(ctx, docID, rev, fields, atts)
+	if kivik.StatusCode(err) == kivik.StatusNotImplemented {
+		var inline json.RawMessage
+		if inline, err = r.inlineAttachments(ctx, docID, rev, fields, atts); err != nil {
+			return false, err
+		}
+		return true, r.write(ctx, []json.RawMessage{inline}, p)
+	}
+	switch {
+	case err == nil:
+		p.DocsWritten++
+	case docFailure(err):
+		p.DocWriteFailures++
+	default:
+		return false, err
+	}
+	return true, nil
+}
+
+// streamAttachments writes a document to the target with a multipart
+// request, with new_edits=false, streaming each attachment from the source.
+func (r *Replicator) streamAttachments(ctx context.Context, docID, rev string, fields map[string]json.RawMessage, stubs map[string]map[string]interface{}) error {
+	atts := make([]*kivik.Attachment, 0, len(stubs))
+	for filename, stub := range stubs {
+		contentType, _ := stub["content_type"].(string)
+		length, _ := stub["length"].(float64)
+		content := &sourceAttachment{ctx: ctx, db: r.source, docID: docID, rev: rev, filename: filename}
+		atts = append(atts, &kivik.Attachment{
+			ReadCloser:  content,
+			Filename:    filename,
+			ContentType: contentType,
+			Length:      int64(length),
+		})
+	}
+	defer func() {
+		for _, att := range atts {
+			_ = att.Close()
+		}
+	}()
+	_, err := r.target.PutMultipart(ctx, docID, fields, atts, kivik.Options{"new_edits": false})
+	return err
+}
+
+// sourceAttachment reads an attachment from the source, which is fetched on
+// the first Read, so that a document's attachments are fetched one at a time,
+// as they are sent.
+type sourceAttachment struct {
+	ctx                  context.Context
+	db                   *kivik.DB
+	docID, rev, filename string
+	body                 io.ReadCloser
+}
+
+func (a *sourceAttachment) Read(p []byte) (int, error) {
+	if a.body == nil {
+		att, err := a.db.GetAttachment(a.ctx, a.docID, a.rev, a.filename)
+		if err != nil {
+			return 0, err
+		}
+		att.VerifyMD5()
+		a.body = att
+	}
+	return a.body.Read(p)
+}
+
+func (a *sourceAttachment) Close() error {
+	if a.body == nil {
+		return nil
+	}
+	return a.body.Close()
+}
+
+// inlineAttachments returns the document, with its attachment stubs replaced
+// by their content, fetched from the source, for targets which do not support
+// multipart requests.
+func (r *Replicator) inlineAttachments(ctx context.Context, docID, rev string, fields map[string]json.RawMessage, stubs map[string]map[string]interface{}) (json.RawMessage, error) {
+	var all map[string]json.RawMessage
+	if err := json.Unmarshal(fields["_attachments"], &all); err != nil {
+		return nil, errors.WrapStatus(kivik.StatusBadResponse, err)
+	}
+	for filename, att := range stubs {
+		content, err := r.source.GetAttachment(ctx, docID, rev, filename)
+		if err != nil {
+			return nil, err
+		}
+		data, err := ioutil.ReadAll(content)
+		_ = content.Close()
+		if err != nil {
+			return nil, err
+		}
+		delete(att, "stub")
+		delete(att, "length")
+		att["data"] = base64.StdEncoding.EncodeToString(data)
+		if all[filename], err = json.Marshal(att); err != nil {
+			return nil, err
+		}
+	}
+	raw, err := json.Marshal(all)
+	if err != nil {
+		return nil, err
+	}
+	fields["_attachments"] = raw
+	return json.Marshal(fields)
+}
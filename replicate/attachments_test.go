@@ -0,0 +1,121 @@
+package replicate
+
+import (
+	"context"
+	"crypto/md5"
+	"encoding/json"
+	"errors"
+	"io"
+	"io/ioutil"
+	"strings"
+	"testing"
+
+	"github.com/flimzy/diff"
+	"github.com/flimzy/kivik/driver"
+	"github.com/flimzy/kivik/kiviktest"
+)
+
+// attDB is a source which serves the attachment foo.txt of doc, and a target
+// which records the attachments of PutMultipart.
+type attDB struct {
+	driver.DB
+	doc  json.RawMessage
+	atts map[string]string
+}
+
+func (db *attDB) GetAttachment(_ context.Context, _, _, filename string) (string, driver.MD5sum, io.ReadCloser, error) {
+	return "text/plain", md5.Sum([]byte("content of " + filename)), ioutil.NopCloser(strings.NewReader("content of " + filename)), nil
+}
+
+func (db *attDB) PutMultipart(_ context.Context, _ string, doc interface{}, atts []driver.MultipartAttachment, options map[string]interface{}) (string, error) {
+	if options["new_edits"] != false {
+		return "", errors.New("expected new_edits=false")
+	}
+	var err error
+	if db.doc, err = json.Marshal(doc); err != nil {
+		return "", err
+	}
+	db.atts = make(map[string]string)
+	for _, att := range atts {
+		content, err := ioutil.ReadAll(att.Content)
+		if err != nil {
+			return "", err
+		}
+		db.atts[att.Filename] = string(content)
+	}
+	return "1-xxx", nil
+}
+
+type attClient struct {
+	driver.Client
+	dbs map[string]*attDB
+}
+
+func (c *attClient) DB(_ context.Context, dbName string, _ map[string]interface{}) (driver.DB, error) {
+	return c.dbs[dbName], nil
+}
+
+type attDriver struct {
+	client *attClient
+}
+
+func (d *attDriver) NewClient(_ context.Context, _ string) (driver.Client, error) {
+	return d.client, nil
+}
+
+func TestWriteAttachments(t *testing.T) {
+	ctx := context.Background()
+	target := &attDB{}
+	client := kiviktest.NewClient(t, &attDriver{client: &attClient{dbs: map[string]*attDB{"source": {}, "target": target}}}, "")
+	sourceDB, err := client.DB(ctx, "source")
+	if err != nil {
+		t.Fatal(err)
+	}
+	targetDB, err := client.DB(ctx, "target")
+	if err != nil {
+		t.Fatal(err)
+	}
+	r, err := New(targetDB, sourceDB, Options{ID: "test", Attachments: AttachmentsSeparate})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	p := &Progress{}
+	written, err := r.writeAttachments(ctx, "doc", "1-xxx", json.RawMessage(`{"_id":"doc","_rev":"1-xxx"}`), p)
+	if err != nil || written {
+		t.Errorf("Expected a document without attachments not to be written: %v", err)
+	}
+	doc := json.RawMessage(`{"_id":"doc","_rev":"1-xxx","_attachments":{
+		"a.txt":{"stub":true,"content_type":"text/plain","length":13},
+		"b.txt":{"stub":true,"content_type":"text/plain","length":13}
+	}}`)
+	written, err = r.writeAttachments(ctx, "doc", "1-xxx", doc, p)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !written || p.DocsWritten != 1 {
+		t.Errorf("Expected the document to be written: %+v", p)
+	}
+	expected := map[string]string{"a.txt": "content of a.txt", "b.txt": "content of b.txt"}
+	if d := diff.Interface(expected, target.atts); d != "" {
+		t.Error(d)
+	}
+
+	t.Run("Inline", func(t *testing.T) {
+		fields, atts, err := stubs(doc)
+		if err != nil {
+			t.Fatal(err)
+		}
+		inline, err := r.inlineAttachments(ctx, "doc", "1-xxx", fields, atts)
+		if err != nil {
+			t.Fatal(err)
+		}
+		expected := `{"_id":"doc","_rev":"1-xxx","_attachments":{
+			"a.txt":{"content_type":"text/plain","data":"Y29udGVudCBvZiBhLnR4dA=="},
+			"b.txt":{"content_type":"text/plain","data":"Y29udGVudCBvZiBiLnR4dA=="}
+		}}`
+		if d := diff.JSON([]byte(expected), inline); d != "" {
+			t.Error(d)
+		}
+	})
+}
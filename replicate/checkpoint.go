@@ -0,0 +1,148 @@
+package replicate
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+
+	"github.com/flimzy/kivik"
+	"github.com/flimzy/kivik/errors"
+)
+
+// checkpoint is the _local document which records the progress of a
+// replication, in both the source and the target.
+type checkpoint struct {
+	Rev           string `json:"_rev,omitempty"`
+	SessionID     string `json:"session_id"`
+	SourceLastSeq string `json:"source_last_seq"`
+}
+
+// checkpointer reads and writes the checkpoints of a replication.
+type checkpointer struct {
+	target, source *kivik.DB
+	docID          string
+	sessionID      string
+	// since is the sequence from which to resume.
+	since string
+	// targetRev and sourceRev are the current revisions of the checkpoints.
+	targetRev, sourceRev string
+	// sourceReadOnly is true if checkpoints cannot be stored in the source,
+	// so that the target's checkpoint is trusted alone.
+	sourceReadOnly bool
+}
+
+// readOnly returns true if err means that the database does not allow the
+// replication to read or write its checkpoint.
+func readOnly(err error) bool {
+	switch kivik.StatusCode(err) {
+	case kivik.StatusUnauthorized, kivik.StatusForbidden, kivik.StatusNotImplemented:
+		return true
+	}
+	return false
+}
+
+func newSessionID() (string, error) {
+	id := make([]byte, 16)
+	if _, err := rand.Read(id); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(id), nil
+}
+
+// newCheckpointer reads the checkpoints of the replication, to find the
+// sequence from which to resume. The replication restarts from the beginning
+// unless both checkpoints exist and belong to the same session.
+func (r *Replicator) newCheckpointer(ctx context.Context) (*checkpointer, error) {
+	sessionID, err := newSessionID()
+	if err != nil {
+		return nil, err
+	}
+	cp := &checkpointer{
+		target:    r.target,
+		source:    r.source,
+		docID:     "_local/replicate-" + r.opts.ID,
+		sessionID: sessionID,
+	}
+	targetCP, err := readCheckpoint(ctx, r.target, cp.docID)
+	if err != nil {
+		return nil, err
+	}
+	sourceCP, err := readCheckpoint(ctx, r.source, cp.docID)
+	if readOnly(err) {
+		cp.sourceReadOnly = true
+	} else if err != nil {
+		return nil, err
+	}
+	if targetCP == nil {
+		if sourceCP != nil {
+			cp.sourceRev = sourceCP.Rev
+		}
+		return cp, nil
+	}
+	cp.targetRev = targetCP.Rev
+	switch {
+	case cp.sourceReadOnly:
+		cp.since = targetCP.SourceLastSeq
+	case sourceCP != nil:
+		cp.sourceRev = sourceCP.Rev
+		if sourceCP.SessionID == targetCP.SessionID {
+			cp.since = targetCP.SourceLastSeq
+		}
+	}
+	return cp, nil
+}
+
+// readCheckpoint returns the checkpoint docID of db, or nil if it does not
+// exist.
+func readCheckpoint(ctx context.Context, db *kivik.DB, docID string) (*checkpoint, error) {
+	row, err := db.Get(ctx, docID)
+	if kivik.StatusCode(err) == kivik.StatusNotFound {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	cp := &checkpoint{}
+	if err := row.ScanDoc(cp); err != nil {
+		return nil, err
+	}
+	return cp, nil
+}
+
+// save records seq in the checkpoints of the target and, unless it is
+// read-only, the source.
+func (cp *checkpointer) save(ctx context.Context, seq string) error {
+	rev, err := writeCheckpoint(ctx, cp.target, cp.docID, cp.targetRev, cp.sessionID, seq)
+	if err != nil {
+		return errors.Wrap(err, "replicate: target checkpoint")
+	}
+	cp.targetRev = rev
+	if cp.sourceReadOnly {
+		return nil
+	}
+	rev, err = writeCheckpoint(ctx, cp.source, cp.docID, cp.sourceRev, cp.sessionID, seq)
+	if readOnly(err) {
+		cp.sourceReadOnly = true
+		return nil
+	}
+	if err != nil {
+		return errors.Wrap(err, "replicate: source checkpoint")
+	}
+	cp.sourceRev = rev
+	return nil
+}
+
+// writeCheckpoint writes a checkpoint, replacing revision rev, and returns its
+// new revision. If rev is stale, as when two replications with the same ID
+// run at once, the checkpoint is overwritten.
+func writeCheckpoint(ctx context.Context, db *kivik.DB, docID, rev, sessionID, seq string) (string, error) {
+	doc := &checkpoint{Rev: rev, SessionID: sessionID, SourceLastSeq: seq}
+	newRev, err := db.Put(ctx, docID, doc)
+	if kivik.StatusCode(err) != kivik.StatusConflict {
+		return newRev, err
+	}
+	if doc.Rev, err = db.Rev(ctx, docID); err != nil && kivik.StatusCode(err) != kivik.StatusNotFound {
+		return "", err
+	}
+	return db.Put(ctx, docID, doc)
+}
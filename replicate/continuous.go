@@ -0,0 +1,247 @@
+package replicate
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/flimzy/kivik"
+	"github.com/flimzy/kivik/errors"
+)
+
+// Defaults for the options of continuous replications.
+const (
+	DefaultPollInterval  = 5 * time.Second
+	DefaultRetryInterval = 5 * time.Second
+)
+
+// Replication is a continuous replication, as returned by Start.
+type Replication struct {
+	r      *Replicator
+	cancel context.CancelFunc
+	errs   chan error
+	done   chan struct{}
+
+	mu       sync.Mutex
+	progress Progress
+	paused   bool
+	// stop interrupts the current pass, when paused.
+	stop context.CancelFunc
+	// resume is closed when the replication is resumed.
+	resume chan struct{}
+	err    error
+}
+
+// Start begins a continuous replication, which follows the changes feed of
+// the source, and replicates each change as it arrives, until canceled, or
+// until ctx is done. Checkpoints are made every CheckpointInterval, so that a
+// replication started again with the same ID resumes from the last of them.
+//
+// If the source does not support continuous changes feeds, its changes are
+// polled every PollInterval. Retryable errors, as reported by errors.Retryable,
+// are sent to Errors, and the replication is retried after RetryInterval, from
+// the last checkpoint. Any other error stops the replication.
+func (r *Replicator) Start(ctx context.Context) *Replication {
+	ctx, cancel := context.WithCancel(ctx)
+	rep := &Replication{
+		r:      r,
+		cancel: cancel,
+		errs:   make(chan error, 1),
+		done:   make(chan struct{}),
+	}
+	go rep.run(ctx)
+	return rep
+}
+
+// Progress returns the progress of the replication, since it was started.
+func (rep *Replication) Progress() Progress {
+	rep.mu.Lock()
+	defer rep.mu.Unlock()
+	return rep.progress
+}
+
+// Pause checkpoints and suspends the replication, until Resume is called.
+func (rep *Replication) Pause() {
+	rep.mu.Lock()
+	defer rep.mu.Unlock()
+	if rep.paused {
+		return
+	}
+	rep.paused = true
+	rep.resume = make(chan struct{})
+	if rep.stop != nil {
+		rep.stop()
+	}
+}
+
+// Resume continues a paused replication, from its last checkpoint.
+func (rep *Replication) Resume() {
+	rep.mu.Lock()
+	defer rep.mu.Unlock()
+	if !rep.paused {
+		return
+	}
+	rep.paused = false
+	close(rep.resume)
+}
+
+// Paused returns true if the replication is paused.
+func (rep *Replication) Paused() bool {
+	rep.mu.Lock()
+	defer rep.mu.Unlock()
+	return rep.paused
+}
+
+// Cancel checkpoints and stops the replication. It returns once the
+// replication has stopped.
+func (rep *Replication) Cancel() {
+	rep.cancel()
+	<-rep.done
+}
+
+// Errors returns a channel which receives the errors which interrupt the
+// replication. It is closed when the replication stops. An error is dropped
+// if the previous one has not been received.
+func (rep *Replication) Errors() <-chan error {
+	return rep.errs
+}
+
+// Done returns a channel which is closed when the replication stops.
+func (rep *Replication) Done() <-chan struct{} {
+	return rep.done
+}
+
+// Err returns the error which stopped the replication, or nil if it is
+// running, or was canceled.
+func (rep *Replication) Err() error {
+	rep.mu.Lock()
+	defer rep.mu.Unlock()
+	return rep.err
+}
+
+func (rep *Replication) sendErr(err error) {
+	select {
+	case rep.errs <- err:
+	default:
+	}
+}
+
+// report records the progress of a pass, which starts from base.
+func (rep *Replication) report(base Progress) func(*Progress) {
+	return func(p *Progress) {
+		progress := Progress{
+			DocsRead:         base.DocsRead + p.DocsRead,
+			DocsWritten:      base.DocsWritten + p.DocsWritten,
+			DocWriteFailures: base.DocWriteFailures + p.DocWriteFailures,
+			MissingChecked:   base.MissingChecked + p.MissingChecked,
+			MissingFound:     base.MissingFound + p.MissingFound,
+			CheckpointedSeq:  p.CheckpointedSeq,
+		}
+		rep.mu.Lock()
+		rep.progress = progress
+		rep.mu.Unlock()
+		rep.r.report(&progress)
+	}
+}
+
+// wait waits for d, or until the replication is resumed after a pause, or
+// canceled. It returns false if it was canceled.
+func (rep *Replication) wait(ctx context.Context, d time.Duration) bool {
+	rep.mu.Lock()
+	paused, resume := rep.paused, rep.resume
+	rep.mu.Unlock()
+	if paused {
+		select {
+		case <-resume:
+			return true
+		case <-ctx.Done():
+			return false
+		}
+	}
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
+
+// pass runs the replication until the feed ends, it fails, or it is paused
+// or canceled. It returns true if the feed was polled.
+func (rep *Replication) pass(ctx context.Context, cp *checkpointer) (polled bool, err error) {
+	rep.mu.Lock()
+	if rep.paused {
+		rep.mu.Unlock()
+		return false, nil
+	}
+	ctx, rep.stop = context.WithCancel(ctx)
+	base := rep.progress
+	rep.mu.Unlock()
+	defer func() {
+		rep.mu.Lock()
+		rep.stop()
+		rep.stop = nil
+		rep.mu.Unlock()
+	}()
+
+	r := rep.r
+	changes, err := r.source.Changes(ctx, r.changesOptions(cp, true))
+	if kivik.StatusCode(err) == kivik.StatusNotImplemented {
+		polled = true
+		changes, err = r.source.Changes(ctx, r.changesOptions(cp, false))
+	}
+	if err != nil {
+		return polled, err
+	}
+	progress := &Progress{CheckpointedSeq: cp.since}
+	err = r.run(ctx, cp, changes, progress, rep.report(base))
+	if ctx.Err() != nil {
+		// Paused or canceled.
+		return polled, nil
+	}
+	return polled, err
+}
+
+func (rep *Replication) run(ctx context.Context) {
+	defer close(rep.done)
+	defer close(rep.errs)
+	r := rep.r
+	var cp *checkpointer
+	for {
+		var err error
+		var polled bool
+		if cp == nil {
+			cp, err = r.newCheckpointer(ctx)
+			if cp != nil {
+				rep.mu.Lock()
+				rep.progress.CheckpointedSeq = cp.since
+				rep.mu.Unlock()
+			}
+		}
+		if err == nil {
+			polled, err = rep.pass(ctx, cp)
+		}
+		if ctx.Err() != nil {
+			return
+		}
+		delay := time.Duration(0)
+		switch {
+		case err != nil && !errors.Retryable(err):
+			rep.mu.Lock()
+			rep.err = err
+			rep.mu.Unlock()
+			rep.sendErr(err)
+			return
+		case err != nil:
+			rep.sendErr(err)
+			delay = r.opts.RetryInterval
+		case polled:
+			delay = r.opts.PollInterval
+		}
+		if !rep.wait(ctx, delay) {
+			return
+		}
+	}
+}
@@ -0,0 +1,488 @@
+package replicate
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"path"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/flimzy/kivik"
+	"github.com/flimzy/kivik/errors"
+)
+
+// Direction is the direction of a sync profile's replications.
+type Direction string
+
+// Directions
+const (
+	// Push replicates the local databases to the remote ones.
+	Push Direction = "push"
+	// Pull replicates the remote databases to the local ones.
+	Pull Direction = "pull"
+	// Both replicates in both directions, so that both databases hold the
+	// changes made to either.
+	Both Direction = "both"
+)
+
+// DefaultReconcileInterval is the default interval at which a Runner lists
+// the databases matched by its profiles.
+const DefaultReconcileInterval = time.Minute
+
+// Profile declares the replications of a set of databases, between a local
+// and a remote server.
+type Profile struct {
+	// Name identifies the profile, and so the checkpoints of its
+	// replications. It is required.
+	Name string `json:"name"`
+	// Databases are the names of the databases replicated, which may be
+	// patterns, as for path.Match, such as "userdb-*". Patterns match the
+	// databases of the source, or of the local server for Both.
+	Databases []string `json:"databases"`
+	// Direction defaults to Push.
+	Direction Direction `json:"direction,omitempty"`
+	// Filter contains the options of the source's changes feed, by which the
+	// documents replicated are filtered, as for Options.ChangesOptions.
+	Filter kivik.Options `json:"filter,omitempty"`
+	// Continuous replicates changes as they are made. Otherwise, the
+	// databases are replicated every Interval.
+	Continuous bool `json:"continuous,omitempty"`
+	// Interval is the schedule of a profile which is not continuous, such as
+	// "15m" in JSON. If zero, the databases are replicated once.
+	Interval time.Duration `json:"-"`
+	// CreateTarget creates target databases which do not exist.
+	CreateTarget bool `json:"create_target,omitempty"`
+	// Options tunes the replications. Its ID is set by the Runner.
+	Options Options `json:"-"`
+}
+
+// UnmarshalJSON decodes a profile, with its interval as a duration string,
+// and the tuning options batch_size and workers.
+func (p *Profile) UnmarshalJSON(data []byte) error {
+	type profile Profile
+	var doc struct {
+		*profile
+		Interval  string `json:"interval"`
+		BatchSize int    `json:"batch_size"`
+		Workers   int    `json:"workers"`
+	}
+	doc.profile = (*profile)(p)
+	if err := json.Unmarshal(data, &doc); err != nil {
+		return err
+	}
+	if doc.Interval != "" {
+		interval, err := time.ParseDuration(doc.Interval)
+		if err != nil {
+			return err
+		}
+		p.Interval = interval
+	}
+	p.Options.BatchSize = doc.BatchSize
+	p.Options.Workers = doc.Workers
+	return nil
+}
+
+// ReadProfiles decodes a JSON array of profiles, such as:
+//
+//	[{
+//	    "name": "users",
+//	    "databases": ["userdb-*"],
+//	    "direction": "both",
+//	    "continuous": true
+//	}, {
+//	    "name": "reports",
+//	    "databases": ["reports"],
+//	    "direction": "pull",
+//	    "filter": {"filter": "_selector", "selector": {"public": true}},
+//	    "interval": "1h"
+//	}]
+func ReadProfiles(r io.Reader) ([]Profile, error) {
+	var profiles []Profile
+	if err := json.NewDecoder(r).Decode(&profiles); err != nil {
+		return nil, errors.WrapStatus(kivik.StatusBadRequest, err)
+	}
+	return profiles, nil
+}
+
+// Runner runs the replications declared by a set of profiles, so that the
+// databases they match are kept in sync.
+type Runner struct {
+	local, remote *kivik.Client
+	profiles      []Profile
+	// ReconcileInterval is the interval at which the databases matched by
+	// patterns are listed, to start and stop replications as databases are
+	// created and destroyed. Defaults to DefaultReconcileInterval.
+	ReconcileInterval time.Duration
+	// OnError, if set, is called with the errors of the replications.
+	OnError func(task Task, err error)
+
+	mu    sync.Mutex
+	tasks map[Task]*taskState
+}
+
+// Task identifies a replication of a Runner.
+type Task struct {
+	Profile   string
+	DB        string
+	Direction Direction
+}
+
+// id returns the replication ID of the task.
+func (t Task) id() string {
+	return "profile-" + t.Profile + "-" + string(t.Direction) + "-" + t.DB
+}
+
+// TaskStatus is the status of a replication of a Runner.
+type TaskStatus struct {
+	Task
+	// LastRun is the time the last replication finished, or zero.
+	LastRun time.Time
+	// Progress is the progress of the last replication, or of the current
+	// continuous replication.
+	Progress Progress
+	// Err is the error of the last replication, if it failed.
+	Err error
+}
+
+type taskState struct {
+	status TaskStatus
+	cancel context.CancelFunc
+	done   chan struct{}
+}
+
+// NewRunner returns a Runner of profiles, between the local and remote
+// servers.
+func NewRunner(local, remote *kivik.Client, profiles []Profile) (*Runner, error) {
+	names := make(map[string]bool)
+	for i := range profiles {
+		p := &profiles[i]
+		if p.Name == "" {
+			return nil, errors.Status(kivik.StatusBadRequest, "replicate: profile name is required")
+		}
+		if names[p.Name] {
+			return nil, errors.Statusf(kivik.StatusBadRequest, "replicate: duplicate profile %s", p.Name)
+		}
+		names[p.Name] = true
+		switch p.Direction {
+		case "":
+			p.Direction = Push
+		case Push, Pull, Both:
+		default:
+			return nil, errors.Statusf(kivik.StatusBadRequest, "replicate: invalid direction %q for profile %s", p.Direction, p.Name)
+		}
+		for _, pattern := range p.Databases {
+			if _, err := path.Match(pattern, ""); err != nil {
+				return nil, errors.Statusf(kivik.StatusBadRequest, "replicate: invalid database pattern %q for profile %s", pattern, p.Name)
+			}
+		}
+	}
+	return &Runner{
+		local:             local,
+		remote:            remote,
+		profiles:          profiles,
+		ReconcileInterval: DefaultReconcileInterval,
+		tasks:             make(map[Task]*taskState),
+	}, nil
+}
+
+// Run runs the profiles' replications until ctx is done. The databases
+// matched are listed every ReconcileInterval, and replications are started
+// for new databases, and stopped for those which no longer exist. Errors
+// listing databases are reported to OnError, as are those of the
+// replications, which are retried by their schedules. Run returns when ctx is
+// done, once the replications have stopped.
+func (r *Runner) Run(ctx context.Context) error {
+	interval := r.ReconcileInterval
+	if interval <= 0 {
+		interval = DefaultReconcileInterval
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		r.reconcile(ctx)
+		select {
+		case <-ctx.Done():
+			r.stopAll()
+			return ctx.Err()
+		case <-ticker.C:
+		}
+	}
+}
+
+// Status returns the status of each replication, ordered by profile,
+// database and direction.
+func (r *Runner) Status() []TaskStatus {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	statuses := make([]TaskStatus, 0, len(r.tasks))
+	for _, state := range r.tasks {
+		statuses = append(statuses, state.status)
+	}
+	sort.Sort(byTask(statuses))
+	return statuses
+}
+
+type byTask []TaskStatus
+
+func (s byTask) Len() int      { return len(s) }
+func (s byTask) Swap(i, j int) { s[i], s[j] = s[j], s[i] }
+func (s byTask) Less(i, j int) bool {
+	a, b := s[i].Task, s[j].Task
+	if a.Profile != b.Profile {
+		return a.Profile < b.Profile
+	}
+	if a.DB != b.DB {
+		return a.DB < b.DB
+	}
+	return a.Direction < b.Direction
+}
+
+func (r *Runner) reportErr(task Task, err error) {
+	if r.OnError != nil {
+		r.OnError(task, err)
+	}
+}
+
+// reconcile starts the replications of the databases now matched, and stops
+// those of databases no longer matched.
+func (r *Runner) reconcile(ctx context.Context) {
+	wanted := make(map[Task]*Profile)
+	for i := range r.profiles {
+		p := &r.profiles[i]
+		dbs, err := r.matchDBs(ctx, p)
+		if err != nil {
+			r.reportErr(Task{Profile: p.Name, Direction: p.Direction}, err)
+			// Leave the profile's replications as they are.
+			r.mu.Lock()
+			for task := range r.tasks {
+				if task.Profile == p.Name {
+					wanted[task] = p
+				}
+			}
+			r.mu.Unlock()
+			continue
+		}
+		for _, dbName := range dbs {
+			for _, dir := range directions(p.Direction) {
+				wanted[Task{Profile: p.Name, DB: dbName, Direction: dir}] = p
+			}
+		}
+	}
+	var stopped []*taskState
+	r.mu.Lock()
+	for task, state := range r.tasks {
+		if wanted[task] == nil {
+			stopped = append(stopped, state)
+			delete(r.tasks, task)
+		}
+	}
+	for task, p := range wanted {
+		if _, ok := r.tasks[task]; !ok {
+			r.start(ctx, task, p)
+		}
+	}
+	r.mu.Unlock()
+	stop(stopped)
+}
+
+// stop stops tasks, and waits for them to finish. As tasks update their
+// status, r.mu must not be held.
+func stop(tasks []*taskState) {
+	for _, state := range tasks {
+		state.cancel()
+	}
+	for _, state := range tasks {
+		<-state.done
+	}
+}
+
+func directions(dir Direction) []Direction {
+	if dir == Both {
+		return []Direction{Push, Pull}
+	}
+	return []Direction{dir}
+}
+
+// matchDBs returns the databases matched by the patterns of p, on the
+// source server, or the local server for Both. Names which are not patterns
+// are matched whether they exist or not.
+func (r *Runner) matchDBs(ctx context.Context, p *Profile) ([]string, error) {
+	var all []string
+	seen := make(map[string]bool)
+	var dbs []string
+	for _, pattern := range p.Databases {
+		if !hasMeta(pattern) {
+			if !seen[pattern] {
+				seen[pattern] = true
+				dbs = append(dbs, pattern)
+			}
+			continue
+		}
+		if all == nil {
+			client := r.local
+			if p.Direction == Pull {
+				client = r.remote
+			}
+			var err error
+			if all, err = client.AllDBs(ctx); err != nil {
+				return nil, err
+			}
+		}
+		for _, dbName := range all {
+			if ok, _ := path.Match(pattern, dbName); ok && !seen[dbName] {
+				seen[dbName] = true
+				dbs = append(dbs, dbName)
+			}
+		}
+	}
+	return dbs, nil
+}
+
+func hasMeta(pattern string) bool {
+	for _, c := range pattern {
+		switch c {
+		case '*', '?', '[', '\\':
+			return true
+		}
+	}
+	return false
+}
+
+// start starts the replication of task, in a goroutine. r.mu must be held.
+func (r *Runner) start(ctx context.Context, task Task, p *Profile) {
+	ctx, cancel := context.WithCancel(ctx)
+	state := &taskState{
+		status: TaskStatus{Task: task},
+		cancel: cancel,
+		done:   make(chan struct{}),
+	}
+	r.tasks[task] = state
+	go func() {
+		defer close(state.done)
+		r.runTask(ctx, state, p)
+	}()
+}
+
+func (r *Runner) stopAll() {
+	var stopped []*taskState
+	r.mu.Lock()
+	for task, state := range r.tasks {
+		stopped = append(stopped, state)
+		delete(r.tasks, task)
+	}
+	r.mu.Unlock()
+	stop(stopped)
+}
+
+// update applies fn to the status of a task.
+func (r *Runner) update(state *taskState, fn func(*TaskStatus)) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	fn(&state.status)
+}
+
+// runTask runs a replication continuously, or on the profile's schedule,
+// until ctx is done.
+func (r *Runner) runTask(ctx context.Context, state *taskState, p *Profile) {
+	task := state.status.Task
+	for {
+		rep, err := r.replicator(ctx, task, p)
+		if err == nil && p.Continuous {
+			err = r.runContinuous(ctx, state, rep)
+		} else if err == nil {
+			var progress *Progress
+			progress, err = rep.Run(ctx)
+			if ctx.Err() != nil {
+				return
+			}
+			r.update(state, func(s *TaskStatus) {
+				if progress != nil {
+					s.Progress = *progress
+				}
+			})
+		}
+		if ctx.Err() != nil {
+			return
+		}
+		r.update(state, func(s *TaskStatus) {
+			s.LastRun = time.Now()
+			s.Err = err
+		})
+		if err != nil {
+			r.reportErr(task, err)
+		}
+		interval := p.Interval
+		if p.Continuous {
+			// Retry a failed continuous replication.
+			interval = p.Options.RetryInterval
+			if interval <= 0 {
+				interval = DefaultRetryInterval
+			}
+		} else if interval <= 0 {
+			return
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(interval):
+		}
+	}
+}
+
+// runContinuous runs a continuous replication until it stops, or ctx is
+// done, recording its progress.
+func (r *Runner) runContinuous(ctx context.Context, state *taskState, rep *Replicator) error {
+	opts := rep.opts
+	progress := opts.Progress
+	rep.opts.Progress = func(p Progress) {
+		r.update(state, func(s *TaskStatus) { s.Progress = p })
+		if progress != nil {
+			progress(p)
+		}
+	}
+	replication := rep.Start(ctx)
+	for err := range replication.Errors() {
+		if ctx.Err() == nil && replication.Err() == nil {
+			// A retryable error.
+			r.update(state, func(s *TaskStatus) { s.Err = err })
+			r.reportErr(state.status.Task, err)
+		}
+	}
+	<-replication.Done()
+	return replication.Err()
+}
+
+// replicator returns the Replicator of task.
+func (r *Runner) replicator(ctx context.Context, task Task, p *Profile) (*Replicator, error) {
+	sourceClient, targetClient := r.local, r.remote
+	if task.Direction == Pull {
+		sourceClient, targetClient = r.remote, r.local
+	}
+	if p.CreateTarget {
+		exists, err := targetClient.DBExists(ctx, task.DB)
+		if err != nil {
+			return nil, err
+		}
+		if !exists {
+			if err := targetClient.CreateDB(ctx, task.DB); err != nil && kivik.StatusCode(err) != kivik.StatusPreconditionFailed {
+				return nil, err
+			}
+		}
+	}
+	source, err := sourceClient.DB(ctx, task.DB)
+	if err != nil {
+		return nil, err
+	}
+	target, err := targetClient.DB(ctx, task.DB)
+	if err != nil {
+		return nil, err
+	}
+	opts := p.Options
+	opts.ID = task.id()
+	if len(p.Filter) > 0 {
+		opts.ChangesOptions = p.Filter
+	}
+	return New(target, source, opts)
+}
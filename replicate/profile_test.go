@@ -0,0 +1,176 @@
+package replicate
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/flimzy/diff"
+	"github.com/flimzy/kivik"
+)
+
+func TestReadProfiles(t *testing.T) {
+	profiles, err := ReadProfiles(strings.NewReader(`[{
+		"name": "reports",
+		"databases": ["reports", "logs-*"],
+		"direction": "pull",
+		"filter": {"filter": "_doc_ids", "doc_ids": ["a"]},
+		"interval": "1h",
+		"batch_size": 10,
+		"create_target": true
+	}]`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []Profile{{
+		Name:         "reports",
+		Databases:    []string{"reports", "logs-*"},
+		Direction:    Pull,
+		Filter:       kivik.Options{"filter": "_doc_ids", "doc_ids": []interface{}{"a"}},
+		Interval:     time.Hour,
+		CreateTarget: true,
+		Options:      Options{BatchSize: 10},
+	}}
+	if d := diff.Interface(expected, profiles); d != "" {
+		t.Error(d)
+	}
+	if _, err := ReadProfiles(strings.NewReader(`[{"name": "x", "interval": "often"}]`)); kivik.StatusCode(err) != kivik.StatusBadRequest {
+		t.Errorf("Expected a 400 error for an invalid interval, got %v", err)
+	}
+}
+
+func TestNewRunner(t *testing.T) {
+	tests := []struct {
+		name     string
+		profiles []Profile
+		status   int
+	}{
+		{name: "NoName", profiles: []Profile{{}}, status: kivik.StatusBadRequest},
+		{name: "Duplicate", profiles: []Profile{{Name: "a"}, {Name: "a"}}, status: kivik.StatusBadRequest},
+		{name: "InvalidDirection", profiles: []Profile{{Name: "a", Direction: "sideways"}}, status: kivik.StatusBadRequest},
+		{name: "InvalidPattern", profiles: []Profile{{Name: "a", Databases: []string{"["}}}, status: kivik.StatusBadRequest},
+		{name: "Valid", profiles: []Profile{{Name: "a", Databases: []string{"foo-*"}}}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			runner, err := NewRunner(nil, nil, test.profiles)
+			if kivik.StatusCode(err) != test.status && (test.status != 0 || err != nil) {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if err == nil && runner.profiles[0].Direction != Push {
+				t.Errorf("Expected the direction to default to push")
+			}
+		})
+	}
+}
+
+func TestRunner(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	newClient := func() *kivik.Client {
+		client, err := kivik.New(ctx, "memory", "")
+		if err != nil {
+			t.Fatal(err)
+		}
+		return client
+	}
+	local, remote := newClient(), newClient()
+	put := func(client *kivik.Client, dbName, docID string) {
+		db, err := client.DB(ctx, dbName)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := db.Put(ctx, docID, map[string]string{}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	exists := func(client *kivik.Client, dbName, docID string) func() bool {
+		return func() bool {
+			db, err := client.DB(ctx, dbName)
+			if err != nil {
+				return false
+			}
+			_, err = db.Get(ctx, docID)
+			return err == nil
+		}
+	}
+	for _, dbName := range []string{"user-a", "user-b", "other"} {
+		if err := local.CreateDB(ctx, dbName); err != nil {
+			t.Fatal(err)
+		}
+		put(local, dbName, "doc")
+	}
+	if err := remote.CreateDB(ctx, "reports"); err != nil {
+		t.Fatal(err)
+	}
+	put(remote, "reports", "public")
+	put(remote, "reports", "private")
+
+	runner, err := NewRunner(local, remote, []Profile{
+		{
+			Name:         "users",
+			Databases:    []string{"user-*"},
+			Continuous:   true,
+			CreateTarget: true,
+			Options:      Options{PollInterval: 10 * time.Millisecond},
+		},
+		{
+			Name:         "reports",
+			Databases:    []string{"reports"},
+			Direction:    Pull,
+			Filter:       kivik.Options{"filter": "_doc_ids", "doc_ids": []string{"public"}},
+			CreateTarget: true,
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	runner.ReconcileInterval = 20 * time.Millisecond
+	done := make(chan error)
+	go func() { done <- runner.Run(ctx) }()
+
+	waitFor(t, "user-a", exists(remote, "user-a", "doc"))
+	waitFor(t, "user-b", exists(remote, "user-b", "doc"))
+	waitFor(t, "reports", exists(local, "reports", "public"))
+	if exists(remote, "other", "doc")() {
+		t.Error("Expected other not to be replicated")
+	}
+	if exists(local, "reports", "private")() {
+		t.Error("Expected the filtered document not to be replicated")
+	}
+
+	// A new database is replicated once listed, and changes continuously.
+	if err := local.CreateDB(ctx, "user-c"); err != nil {
+		t.Fatal(err)
+	}
+	put(local, "user-c", "doc")
+	waitFor(t, "user-c", exists(remote, "user-c", "doc"))
+	put(local, "user-a", "new")
+	waitFor(t, "user-a change", exists(remote, "user-a", "new"))
+
+	var tasks []Task
+	for _, status := range runner.Status() {
+		if status.Err != nil {
+			t.Errorf("%+v failed: %s", status.Task, status.Err)
+		}
+		tasks = append(tasks, status.Task)
+	}
+	expected := []Task{
+		{Profile: "reports", DB: "reports", Direction: Pull},
+		{Profile: "users", DB: "user-a", Direction: Push},
+		{Profile: "users", DB: "user-b", Direction: Push},
+		{Profile: "users", DB: "user-c", Direction: Push},
+	}
+	if d := diff.Interface(expected, tasks); d != "" {
+		t.Error(d)
+	}
+
+	cancel()
+	if err := <-done; err != context.Canceled {
+		t.Errorf("Unexpected error: %v", err)
+	}
+	if len(runner.Status()) != 0 {
+		t.Error("Expected the replications to be stopped")
+	}
+}
@@ -0,0 +1,525 @@
+// Package replicate implements the CouchDB replication protocol in Go, to
+// replicate between any two kivik databases, whatever their drivers, such as
+// from a CouchDB server to a memory database.
+//
+//	r, err := replicate.New(target, source, replicate.Options{ID: "backup"})
+//	if err != nil {
+//	    return err
+//	}
+//	progress, err := r.Run(ctx)
+//
+// The changes of the source are read in batches, and the revisions missing
+// from the target are fetched, with their histories, and written with
+// BulkDocs and new_edits=false, so that the target holds the same revisions,
+// including conflicts. Batches are processed concurrently, by Workers.
+//
+// Progress is recorded in checkpoints, which are _local documents in both
+// databases, so that an interrupted replication resumes from the last
+// checkpoint. If the source cannot store checkpoints, as when it is read-only,
+// the target's checkpoint is trusted alone.
+//
+// Run replicates the changes made since the last checkpoint, and returns.
+// Start runs a continuous replication, which follows the source's changes
+// until it is canceled, and may be paused and resumed.
+//
+// If the target does not support new_edits=false, each document is instead
+// written as a new revision of the target's document, as by kivik's Restore,
+// so that revision histories and conflicts are not replicated.
+package replicate
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+
+	"github.com/flimzy/kivik"
+	"github.com/flimzy/kivik/errors"
+)
+
+// AttachmentMode selects how attachments are fetched from the source.
+type AttachmentMode int
+
+const (
+	// AttachmentsInline fetches attachments with their documents, and writes
+	// them in batches, which is faster, but holds a batch's attachments in
+	// memory.
+	AttachmentsInline AttachmentMode = iota
+	// AttachmentsSeparate fetches documents with attachment stubs, and each
+	// attachment separately, and writes documents with attachments one at a
+	// time. If the target supports multipart requests, the attachments are
+	// streamed from the source to the target, so that they are never held in
+	// memory. Otherwise, memory use is limited to one document's attachments.
+	AttachmentsSeparate
+)
+
+// Defaults for Options.
+const (
+	DefaultBatchSize          = 100
+	DefaultWorkers            = 4
+	DefaultCheckpointInterval = 5 * time.Second
+)
+
+// Options configures a replication.
+type Options struct {
+	// ID identifies the replication, for its checkpoints, which are stored
+	// as _local/replicate-<ID>. It is required.
+	ID string
+	// BatchSize is the number of changes processed, and of documents
+	// written, at a time. Defaults to DefaultBatchSize.
+	BatchSize int
+	// Workers is the number of batches processed concurrently. Defaults to
+	// DefaultWorkers.
+	Workers int
+	// CheckpointInterval is the minimum interval between checkpoints. A
+	// checkpoint is also recorded when the replication finishes, or fails.
+	// Defaults to DefaultCheckpointInterval.
+	CheckpointInterval time.Duration
+	// Attachments selects how attachments are fetched. Defaults to
+	// AttachmentsInline.
+	Attachments AttachmentMode
+	// PollInterval is the interval between reads of the changes of a source
+	// which does not support continuous feeds, by a continuous replication.
+	// Defaults to DefaultPollInterval.
+	PollInterval time.Duration
+	// RetryInterval is the delay before a continuous replication is retried
+	// after a retryable error. Defaults to DefaultRetryInterval.
+	RetryInterval time.Duration
+	// ChangesOptions are passed to the source's changes feed, to filter the
+	// documents replicated, such as {"filter": "_doc_ids", "doc_ids": ids},
+	// or {"filter": "_selector", "selector": selector}.
+	ChangesOptions kivik.Options
+	// Progress, if set, is called after each batch, and each checkpoint,
+	// with the progress of the replication. Calls are not concurrent.
+	Progress func(Progress)
+}
+
+// Progress reports the progress of a replication.
+type Progress struct {
+	// DocsRead is the number of document revisions read from the source.
+	DocsRead int64
+	// DocsWritten is the number of document revisions written to the
+	// target.
+	DocsWritten int64
+	// DocWriteFailures is the number of document revisions which the target
+	// refused, such as by validation.
+	DocWriteFailures int64
+	// MissingChecked is the number of revisions checked against the target.
+	MissingChecked int64
+	// MissingFound is the number of revisions missing from the target.
+	MissingFound int64
+	// CheckpointedSeq is the source sequence of the last checkpoint.
+	CheckpointedSeq string
+}
+
+func (p *Progress) add(b *batch) {
+	p.DocsRead += b.progress.DocsRead
+	p.DocsWritten += b.progress.DocsWritten
+	p.DocWriteFailures += b.progress.DocWriteFailures
+	p.MissingChecked += b.progress.MissingChecked
+	p.MissingFound += b.progress.MissingFound
+}
+
+// Replicator replicates a source database to a target.
+type Replicator struct {
+	target, source *kivik.DB
+	opts           Options
+	// now is replaced in tests.
+	now func() time.Time
+}
+
+// New returns a Replicator from source to target. Like Client.Replicate, it
+// takes the target first.
+func New(target, source *kivik.DB, opts Options) (*Replicator, error) {
+	if opts.ID == "" {
+		return nil, errors.Status(kivik.StatusBadRequest, "replicate: ID is required")
+	}
+	if opts.BatchSize <= 0 {
+		opts.BatchSize = DefaultBatchSize
+	}
+	if opts.Workers <= 0 {
+		opts.Workers = DefaultWorkers
+	}
+	if opts.CheckpointInterval <= 0 {
+		opts.CheckpointInterval = DefaultCheckpointInterval
+	}
+	if opts.PollInterval <= 0 {
+		opts.PollInterval = DefaultPollInterval
+	}
+	if opts.RetryInterval <= 0 {
+		opts.RetryInterval = DefaultRetryInterval
+	}
+	return &Replicator{target: target, source: source, opts: opts, now: time.Now}, nil
+}
+
+// change is a change read from the source.
+type change struct {
+	id   string
+	revs []string
+}
+
+// batch is a batch of changes, numbered in the order read.
+type batch struct {
+	n        int
+	changes  []change
+	lastSeq  string
+	progress Progress
+	err      error
+}
+
+// Run replicates the changes made to the source since the last checkpoint,
+// and returns the progress of the replication. If the replication fails, the
+// progress up to the failure is checkpointed, and returned with the error.
+func (r *Replicator) Run(ctx context.Context) (*Progress, error) {
+	cp, err := r.newCheckpointer(ctx)
+	if err != nil {
+		return nil, err
+	}
+	progress := &Progress{CheckpointedSeq: cp.since}
+	changes, err := r.source.Changes(ctx, r.changesOptions(cp, false))
+	if err != nil {
+		return progress, err
+	}
+	return progress, r.run(ctx, cp, changes, progress, r.report)
+}
+
+// changesOptions returns the options of the source changes feed, from the
+// last checkpoint.
+func (r *Replicator) changesOptions(cp *checkpointer, continuous bool) kivik.Options {
+	opts := kivik.Options{"style": "all_docs"}
+	for key, value := range r.opts.ChangesOptions {
+		opts[key] = value
+	}
+	if cp.since != "" {
+		opts["since"] = cp.since
+	}
+	if continuous {
+		opts["feed"] = "continuous"
+	}
+	return opts
+}
+
+// run replicates the changes read from changes, updating progress, and
+// calling report after each batch and checkpoint.
+func (r *Replicator) run(ctx context.Context, cp *checkpointer, changes *kivik.Changes, progress *Progress, report func(*Progress)) error {
+	defer func() { _ = changes.Close() }()
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	batches := make(chan *batch)
+	results := make(chan *batch)
+	readErr := make(chan error, 1)
+	go func() {
+		defer close(batches)
+		readErr <- r.readChanges(ctx, changes, batches)
+	}()
+	done := make(chan struct{})
+	for i := 0; i < r.opts.Workers; i++ {
+		go func() {
+			for b := range batches {
+				b.err = r.process(ctx, b)
+				results <- b
+			}
+			done <- struct{}{}
+		}()
+	}
+	go func() {
+		for i := 0; i < r.opts.Workers; i++ {
+			<-done
+		}
+		close(results)
+	}()
+
+	// Batches may finish out of order, so the checkpoint is the last
+	// sequence of the longest run of completed batches.
+	completed := make(map[int]*batch)
+	next := 0
+	lastSeq := cp.since
+	lastCheckpoint := r.now()
+	var runErr error
+	// checkpoint saves lastSeq, if not yet saved, and returns true if it was.
+	checkpoint := func(ctx context.Context) bool {
+		if lastSeq == progress.CheckpointedSeq {
+			return false
+		}
+		if err := cp.save(ctx, lastSeq); err != nil {
+			if runErr == nil {
+				runErr = err
+				cancel()
+			}
+			return false
+		}
+		progress.CheckpointedSeq = lastSeq
+		lastCheckpoint = r.now()
+		return true
+	}
+	// A continuous feed may stay idle after a batch, so checkpoints are also
+	// made on a timer.
+	ticker := time.NewTicker(r.opts.CheckpointInterval)
+	defer ticker.Stop()
+loop:
+	for {
+		select {
+		case <-ticker.C:
+			if runErr == nil && r.now().Sub(lastCheckpoint) >= r.opts.CheckpointInterval && checkpoint(ctx) {
+				report(progress)
+			}
+		case b, ok := <-results:
+			if !ok {
+				break loop
+			}
+			if b.err != nil {
+				if runErr == nil {
+					runErr = b.err
+					cancel()
+				}
+				continue
+			}
+			progress.add(b)
+			completed[b.n] = b
+			for completed[next] != nil {
+				lastSeq = completed[next].lastSeq
+				delete(completed, next)
+				next++
+			}
+			if runErr == nil && r.now().Sub(lastCheckpoint) >= r.opts.CheckpointInterval {
+				checkpoint(ctx)
+			}
+			report(progress)
+		}
+	}
+	if err := <-readErr; err != nil && runErr == nil {
+		runErr = err
+	}
+	// The context may have been canceled, by the caller or the failure.
+	if checkpoint(context.Background()) {
+		report(progress)
+	}
+	cp.since = progress.CheckpointedSeq
+	return runErr
+}
+
+func (r *Replicator) report(p *Progress) {
+	if r.opts.Progress != nil {
+		r.opts.Progress(*p)
+	}
+}
+
+// batchWait is how long a partial batch waits for more changes, before it is
+// processed, so that the changes of a continuous feed are not held while the
+// feed is idle.
+var batchWait = 100 * time.Millisecond
+
+// readChanges reads the changes feed into batches.
+func (r *Replicator) readChanges(ctx context.Context, changes *kivik.Changes, batches chan<- *batch) error {
+	type seqChange struct {
+		change
+		seq string
+	}
+	feed := make(chan seqChange)
+	go func() {
+		defer close(feed)
+		for changes.Next() {
+			select {
+			case feed <- seqChange{change{id: changes.ID(), revs: changes.Changes()}, string(changes.Seq())}:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	b := &batch{}
+	send := func() bool {
+		select {
+		case batches <- b:
+			b = &batch{n: b.n + 1}
+			return true
+		case <-ctx.Done():
+			return false
+		}
+	}
+	timer := time.NewTimer(batchWait)
+	defer timer.Stop()
+	for {
+		select {
+		case c, ok := <-feed:
+			if !ok {
+				if ctx.Err() != nil {
+					return ctx.Err()
+				}
+				if err := changes.Err(); err != nil {
+					return err
+				}
+				if len(b.changes) > 0 && !send() {
+					return ctx.Err()
+				}
+				return nil
+			}
+			if len(b.changes) == 0 {
+				timer.Reset(batchWait)
+			}
+			b.changes = append(b.changes, c.change)
+			b.lastSeq = c.seq
+			if len(b.changes) == r.opts.BatchSize && !send() {
+				return ctx.Err()
+			}
+		case <-timer.C:
+			if len(b.changes) > 0 && !send() {
+				return ctx.Err()
+			}
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+// process replicates the revisions of a batch which are missing from the
+// target.
+func (r *Replicator) process(ctx context.Context, b *batch) error {
+	var docs []json.RawMessage
+	for _, c := range b.changes {
+		missing, err := r.missingRevs(ctx, c)
+		if err != nil {
+			return err
+		}
+		b.progress.MissingChecked += int64(len(c.revs))
+		b.progress.MissingFound += int64(len(missing))
+		if len(missing) == 0 {
+			continue
+		}
+		revs, err := r.source.GetOpenRevs(ctx, c.id, missing, kivik.Options{
+			"revs":        true,
+			"attachments": r.opts.Attachments == AttachmentsInline,
+		})
+		if err != nil {
+			return err
+		}
+		for _, rev := range revs {
+			if rev.Missing {
+				// The revision was replaced since the change was read,
+				// and is replicated with a later change.
+				continue
+			}
+			var doc json.RawMessage
+			if err := rev.ScanDoc(&doc); err != nil {
+				return err
+			}
+			b.progress.DocsRead++
+			if r.opts.Attachments == AttachmentsSeparate {
+				written, err := r.writeAttachments(ctx, c.id, rev.Rev, doc, &b.progress)
+				if err != nil {
+					return err
+				}
+				if written {
+					continue
+				}
+			}
+			docs = append(docs, doc)
+		}
+	}
+	return r.write(ctx, docs, &b.progress)
+}
+
+// missingRevs returns the revisions of a change which the target lacks.
+func (r *Replicator) missingRevs(ctx context.Context, c change) ([]string, error) {
+	revs, err := r.target.GetOpenRevs(ctx, c.id, c.revs)
+	if kivik.StatusCode(err) == kivik.StatusNotFound {
+		return c.revs, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var missing []string
+	for _, rev := range revs {
+		if rev.Missing {
+			missing = append(missing, rev.Rev)
+		}
+	}
+	return missing, nil
+}
+
+// docFailure returns true if err is the target's refusal of a single
+// document, which is counted, rather than failing the replication.
+func docFailure(err error) bool {
+	switch kivik.StatusCode(err) {
+	case kivik.StatusBadRequest, kivik.StatusUnauthorized, kivik.StatusForbidden, kivik.StatusConflict:
+		return true
+	}
+	return false
+}
+
+// write writes docs to the target, with new_edits=false.
+func (r *Replicator) write(ctx context.Context, docs []json.RawMessage, p *Progress) error {
+	if len(docs) == 0 {
+		return nil
+	}
+	bulk := make([]interface{}, len(docs))
+	for i, doc := range docs {
+		bulk[i] = doc
+	}
+	results, err := r.target.BulkDocs(ctx, bulk, kivik.Options{"new_edits": false})
+	if kivik.StatusCode(err) == kivik.StatusNotImplemented {
+		return r.writeCurrent(ctx, docs, p)
+	}
+	if err != nil {
+		return err
+	}
+	defer func() { _ = results.Close() }()
+	// With new_edits=false, CouchDB reports only the failures.
+	failures := 0
+	for results.Next() {
+		if err := results.UpdateErr(); err != nil {
+			failures++
+		}
+	}
+	if err := results.Err(); err != nil {
+		return err
+	}
+	p.DocWriteFailures += int64(failures)
+	p.DocsWritten += int64(len(docs) - failures)
+	return nil
+}
+
+// writeCurrent writes each document as a new revision of the target's
+// current revision, for targets which do not support new_edits=false.
+func (r *Replicator) writeCurrent(ctx context.Context, docs []json.RawMessage, p *Progress) error {
+	for _, raw := range docs {
+		var doc map[string]json.RawMessage
+		if err := json.Unmarshal(raw, &doc); err != nil {
+			return errors.WrapStatus(kivik.StatusBadResponse, err)
+		}
+		var docID string
+		if err := json.Unmarshal(doc["_id"], &docID); err != nil || docID == "" {
+			return errors.Status(kivik.StatusBadResponse, "replicate: document has no _id")
+		}
+		var deleted bool
+		_ = json.Unmarshal(doc["_deleted"], &deleted)
+		delete(doc, "_rev")
+		delete(doc, "_revisions")
+		rev, err := r.target.Rev(ctx, docID)
+		switch {
+		case kivik.StatusCode(err) == kivik.StatusNotFound:
+			rev = ""
+		case err != nil:
+			return err
+		}
+		switch {
+		case deleted && rev == "":
+			// Already deleted, or never replicated.
+			continue
+		case deleted:
+			_, err = r.target.Delete(ctx, docID, rev)
+		default:
+			if rev != "" {
+				doc["_rev"], _ = json.Marshal(rev)
+			}
+			_, err = r.target.Put(ctx, docID, doc)
+		}
+		switch {
+		case err == nil:
+			p.DocsWritten++
+		case docFailure(err):
+			p.DocWriteFailures++
+		default:
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,285 @@
+package replicate
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/flimzy/kivik"
+	"github.com/flimzy/kivik/driver"
+	_ "github.com/flimzy/kivik/driver/memory"
+	"github.com/flimzy/kivik/errors"
+	"github.com/flimzy/kivik/kiviktest"
+)
+
+func newDBs(t *testing.T) (target, source *kivik.DB) {
+	client, err := kivik.New(context.Background(), "memory", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{"target", "source"} {
+		if err := client.CreateDB(context.Background(), name); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if target, err = client.DB(context.Background(), "target"); err != nil {
+		t.Fatal(err)
+	}
+	if source, err = client.DB(context.Background(), "source"); err != nil {
+		t.Fatal(err)
+	}
+	return target, source
+}
+
+func TestNew(t *testing.T) {
+	_, err := New(nil, nil, Options{})
+	if kivik.StatusCode(err) != kivik.StatusBadRequest {
+		t.Errorf("Expected a 400 error for a missing ID, got %v", err)
+	}
+	r, err := New(nil, nil, Options{ID: "foo"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if r.opts.BatchSize != DefaultBatchSize || r.opts.Workers != DefaultWorkers || r.opts.CheckpointInterval != DefaultCheckpointInterval {
+		t.Errorf("Unexpected defaults: %+v", r.opts)
+	}
+}
+
+func TestRun(t *testing.T) {
+	ctx := context.Background()
+	target, source := newDBs(t)
+	for _, id := range []string{"a", "b", "c", "d", "e"} {
+		if _, err := source.Put(ctx, id, map[string]string{"value": id}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	var reports []Progress
+	opts := Options{
+		ID:        "test",
+		BatchSize: 2,
+		Workers:   2,
+		Progress:  func(p Progress) { reports = append(reports, p) },
+	}
+	r, err := New(target, source, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	progress, err := r.Run(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if progress.DocsRead != 5 || progress.DocsWritten != 5 || progress.MissingFound != 5 {
+		t.Errorf("Unexpected progress: %+v", progress)
+	}
+	if progress.CheckpointedSeq == "" {
+		t.Error("Expected a checkpoint")
+	}
+	if len(reports) < 3 {
+		t.Errorf("Expected a report per batch, got %d", len(reports))
+	}
+	for _, id := range []string{"a", "e"} {
+		row, err := target.Get(ctx, id)
+		if err != nil {
+			t.Fatalf("%s was not replicated: %s", id, err)
+		}
+		var doc map[string]interface{}
+		if err := row.ScanDoc(&doc); err != nil {
+			t.Fatal(err)
+		}
+		if doc["value"] != id {
+			t.Errorf("Unexpected document: %v", doc)
+		}
+	}
+
+	t.Run("Resume", func(t *testing.T) {
+		rev, err := source.Rev(ctx, "a")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := source.Delete(ctx, "a", rev); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := source.Put(ctx, "f", map[string]string{"value": "f"}); err != nil {
+			t.Fatal(err)
+		}
+		r, err := New(target, source, Options{ID: "test"})
+		if err != nil {
+			t.Fatal(err)
+		}
+		progress, err := r.Run(ctx)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if progress.DocsRead != 2 || progress.DocsWritten != 2 {
+			t.Errorf("Expected only the new changes to be replicated: %+v", progress)
+		}
+		if _, err := target.Get(ctx, "a"); kivik.StatusCode(err) != kivik.StatusNotFound {
+			t.Errorf("Expected the deletion to be replicated, got %v", err)
+		}
+		if _, err := target.Get(ctx, "f"); err != nil {
+			t.Errorf("f was not replicated: %s", err)
+		}
+	})
+
+	t.Run("NewID", func(t *testing.T) {
+		r, err := New(target, source, Options{ID: "other", Attachments: AttachmentsSeparate})
+		if err != nil {
+			t.Fatal(err)
+		}
+		progress, err := r.Run(ctx)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if progress.MissingChecked != 6 {
+			t.Errorf("Expected a new ID to restart from the beginning: %+v", progress)
+		}
+	})
+}
+
+func TestCheckpointInterval(t *testing.T) {
+	ctx := context.Background()
+	target, source := newDBs(t)
+	for _, id := range []string{"a", "b", "c", "d"} {
+		if _, err := source.Put(ctx, id, map[string]string{}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	var checkpoints []string
+	r, err := New(target, source, Options{
+		ID:        "test",
+		BatchSize: 1,
+		Workers:   1,
+		Progress: func(p Progress) {
+			if n := len(checkpoints); n == 0 || checkpoints[n-1] != p.CheckpointedSeq {
+				checkpoints = append(checkpoints, p.CheckpointedSeq)
+			}
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Each call advances the clock by an hour, so that every batch is
+	// checkpointed.
+	now := time.Now()
+	r.now = func() time.Time {
+		now = now.Add(time.Hour)
+		return now
+	}
+	if _, err := r.Run(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if len(checkpoints) != 4 {
+		t.Errorf("Expected a checkpoint per batch, got %v", checkpoints)
+	}
+}
+
+// waitFor polls cond until it is true, or fails the test after a second.
+func waitFor(t *testing.T, desc string, cond func() bool) {
+	deadline := time.Now().Add(time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatalf("Timed out waiting for %s", desc)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func TestStart(t *testing.T) {
+	ctx := context.Background()
+	target, source := newDBs(t)
+	if _, err := source.Put(ctx, "a", map[string]string{}); err != nil {
+		t.Fatal(err)
+	}
+	r, err := New(target, source, Options{ID: "test", PollInterval: 10 * time.Millisecond})
+	if err != nil {
+		t.Fatal(err)
+	}
+	rep := r.Start(ctx)
+	exists := func(id string) func() bool {
+		return func() bool {
+			_, err := target.Get(ctx, id)
+			return err == nil
+		}
+	}
+	waitFor(t, "a", exists("a"))
+	if _, err := source.Put(ctx, "b", map[string]string{}); err != nil {
+		t.Fatal(err)
+	}
+	waitFor(t, "b", exists("b"))
+
+	rep.Pause()
+	if !rep.Paused() {
+		t.Error("Expected the replication to be paused")
+	}
+	progress := rep.Progress()
+	if progress.DocsWritten != 2 || progress.CheckpointedSeq == "" {
+		t.Errorf("Unexpected progress: %+v", progress)
+	}
+	if _, err := source.Put(ctx, "c", map[string]string{}); err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(50 * time.Millisecond)
+	if exists("c")() {
+		t.Error("Expected c not to be replicated while paused")
+	}
+	rep.Resume()
+	waitFor(t, "c", exists("c"))
+
+	rep.Cancel()
+	if err := rep.Err(); err != nil {
+		t.Errorf("Unexpected error: %s", err)
+	}
+	if _, ok := <-rep.Errors(); ok {
+		t.Error("Expected the error channel to be closed")
+	}
+}
+
+// failDB is a source whose changes feed fails.
+type failDB struct {
+	driver.DB
+}
+
+func (db *failDB) Get(_ context.Context, _ string, _ map[string]interface{}) (json.RawMessage, error) {
+	return nil, errors.Status(kivik.StatusNotFound, "missing")
+}
+
+func (db *failDB) Changes(_ context.Context, _ map[string]interface{}) (driver.Changes, error) {
+	return nil, errors.Status(kivik.StatusForbidden, "forbidden")
+}
+
+type failClient struct {
+	driver.Client
+}
+
+func (c *failClient) DB(_ context.Context, _ string, _ map[string]interface{}) (driver.DB, error) {
+	return &failDB{}, nil
+}
+
+type failDriver struct{}
+
+func (d *failDriver) NewClient(_ context.Context, _ string) (driver.Client, error) {
+	return &failClient{}, nil
+}
+
+func TestStartFailure(t *testing.T) {
+	ctx := context.Background()
+	source := kiviktest.NewDB(t, &failDriver{}, "", "source")
+	target, _ := newDBs(t)
+	r, err := New(target, source, Options{ID: "test"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	rep := r.Start(ctx)
+	select {
+	case <-rep.Done():
+	case <-time.After(time.Second):
+		t.Fatal("Expected the replication to stop")
+	}
+	if kivik.StatusCode(rep.Err()) != kivik.StatusForbidden {
+		t.Errorf("Unexpected error: %v", rep.Err())
+	}
+	if err := <-rep.Errors(); err == nil {
+		t.Error("Expected the error to be sent")
+	}
+}
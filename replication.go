@@ -139,7 +139,7 @@ func (r *Replication) Update(ctx context.Context) error {
 // "conflicts" and "update_seq" are ignored.
 func (c *Client) GetReplications(ctx context.Context, options ...Options) ([]*Replication, error) {
 	if replicator, ok := c.driverClient.(driver.ClientReplicator); ok {
-		opts, err := mergeOptions(options...)
+		opts, err := c.options(ctx, "GetReplications", options...)
 		if err != nil {
 			return nil, err
 		}
@@ -159,7 +159,7 @@ func (c *Client) GetReplications(ctx context.Context, options ...Options) ([]*Re
 // Replicate initiates a replication from source to target.
 func (c *Client) Replicate(ctx context.Context, targetDSN, sourceDSN string, options ...Options) (*Replication, error) {
 	if replicator, ok := c.driverClient.(driver.ClientReplicator); ok {
-		opts, err := mergeOptions(options...)
+		opts, err := c.options(ctx, "Replicate", options...)
 		if err != nil {
 			return nil, err
 		}
@@ -0,0 +1,198 @@
+package kivik
+
+import (
+	"context"
+	"encoding/base64"
+	"net/url"
+	"strings"
+
+	"github.com/flimzy/kivik/errors"
+)
+
+// ReplicationSchema selects the form of the _replicator documents built by
+// ReplicationDoc, which differs between major versions of CouchDB.
+type ReplicationSchema int
+
+// The replication schemas.
+const (
+	// ReplicationSchemaAuto uses, with Client.ReplicateDoc, the schema of the
+	// server's version, as reported by Client.Version, and otherwise that of
+	// CouchDB 2.x.
+	ReplicationSchemaAuto ReplicationSchema = iota
+	// ReplicationSchemaCouch1 is the schema of CouchDB 1.x, which does not
+	// support selectors or since_seq.
+	ReplicationSchemaCouch1
+	// ReplicationSchemaCouch2 is the schema of CouchDB 2.x and later.
+	ReplicationSchemaCouch2
+)
+
+// ReplicationSchemaFor returns the replication schema of the server version
+// ver.
+func ReplicationSchemaFor(ver *Version) ReplicationSchema {
+	if ver != nil && strings.HasPrefix(ver.Version, "1.") {
+		return ReplicationSchemaCouch1
+	}
+	return ReplicationSchemaCouch2
+}
+
+// ReplicationEndpoint is the source or target of a replication.
+type ReplicationEndpoint struct {
+	// URL is the URL of the database, or, for a database of the server on
+	// which the replication runs, its name. Credentials in the URL are used
+	// if Username is empty.
+	URL string
+	// Username and Password, if set, are sent with Basic auth, rather than in
+	// the URL, so that they are not reported with the URL.
+	Username string
+	Password string
+	// Headers are additional HTTP headers sent with each request.
+	Headers map[string]string
+}
+
+// MarshalJSON marshals the endpoint as its URL, or, with credentials or
+// headers, as an object of the URL and headers.
+func (e ReplicationEndpoint) MarshalJSON() ([]byte, error) {
+	epURL, username, password := e.URL, e.Username, e.Password
+	if u, err := url.Parse(e.URL); err == nil && u.User != nil {
+		if username == "" {
+			username = u.User.Username()
+			password, _ = u.User.Password()
+		}
+		u.User = nil
+		epURL = u.String()
+	}
+	if username == "" && len(e.Headers) == 0 {
+		return JSON().Marshal(epURL)
+	}
+	headers := make(map[string]string, len(e.Headers)+1)
+	for k, v := range e.Headers {
+		headers[k] = v
+	}
+	if username != "" {
+		headers["Authorization"] = "Basic " + base64.StdEncoding.EncodeToString([]byte(username+":"+password))
+	}
+	return JSON().Marshal(map[string]interface{}{
+		"url":     epURL,
+		"headers": headers,
+	})
+}
+
+// ReplicationUserCtx is the user context of a replication.
+type ReplicationUserCtx struct {
+	Name  string   `json:"name"`
+	Roles []string `json:"roles"`
+}
+
+// ReplicationDoc builds a _replicator document, for Client.ReplicateDoc, or
+// as options for Client.Replicate.
+type ReplicationDoc struct {
+	// ID is the document ID. If empty, one is assigned by the server.
+	ID     string
+	Source ReplicationEndpoint
+	Target ReplicationEndpoint
+	// Continuous keeps the replication running, to replicate changes as they
+	// are made.
+	Continuous bool
+	// CreateTarget creates the target database, if it does not exist.
+	CreateTarget bool
+	// Selector, a Mango selector, replicates only the matching documents. It
+	// requires CouchDB 2.x.
+	Selector interface{}
+	// Filter, a filter function such as "ddoc/filter", replicates only the
+	// documents it passes, with QueryParams.
+	Filter      string
+	QueryParams map[string]interface{}
+	// DocIDs replicates only the documents with these IDs.
+	DocIDs []string
+	// SinceSeq starts the replication from this sequence of the source. It
+	// requires CouchDB 2.x.
+	SinceSeq string
+	// UserCtx is the user context of the replication, for CouchDB 1.x. With
+	// CouchDB 2.x, a replication runs as the user who created the document,
+	// so UserCtx is omitted.
+	UserCtx *ReplicationUserCtx
+	// Schema is the form of the document.
+	Schema ReplicationSchema
+}
+
+// Options returns the fields of the document, in the form of its schema, as
+// options for Client.Replicate.
+func (d *ReplicationDoc) Options() (Options, error) {
+	if d.Source.URL == "" || d.Target.URL == "" {
+		return nil, errors.Status(StatusBadRequest, "kivik: replication source and target are required")
+	}
+	var filters int
+	for _, set := range []bool{d.Selector != nil, d.Filter != "", len(d.DocIDs) > 0} {
+		if set {
+			filters++
+		}
+	}
+	if filters > 1 {
+		return nil, errors.Status(StatusBadRequest, "kivik: only one of selector, filter and doc IDs may be set")
+	}
+	opts := Options{
+		"source": d.Source,
+		"target": d.Target,
+	}
+	if d.ID != "" {
+		opts["_id"] = d.ID
+	}
+	if d.Continuous {
+		opts["continuous"] = true
+	}
+	if d.CreateTarget {
+		opts["create_target"] = true
+	}
+	if d.Filter != "" {
+		opts["filter"] = d.Filter
+		if len(d.QueryParams) > 0 {
+			opts["query_params"] = d.QueryParams
+		}
+	}
+	if len(d.DocIDs) > 0 {
+		opts["doc_ids"] = d.DocIDs
+	}
+	switch d.Schema {
+	case ReplicationSchemaCouch1:
+		if d.Selector != nil {
+			return nil, errors.Status(StatusBadRequest, "kivik: replication selectors require CouchDB 2.x")
+		}
+		if d.SinceSeq != "" {
+			return nil, errors.Status(StatusBadRequest, "kivik: replication since_seq requires CouchDB 2.x")
+		}
+		if d.UserCtx != nil {
+			opts["user_ctx"] = d.UserCtx
+		}
+	case ReplicationSchemaAuto, ReplicationSchemaCouch2:
+		if d.Selector != nil {
+			opts["selector"] = d.Selector
+		}
+		if d.SinceSeq != "" {
+			opts["since_seq"] = d.SinceSeq
+		}
+	default:
+		return nil, errors.Statusf(StatusBadRequest, "kivik: invalid replication schema %d", d.Schema)
+	}
+	return opts, nil
+}
+
+// ReplicateDoc initiates the replication described by doc, with the
+// replication schema of the server's version, if its Schema is
+// ReplicationSchemaAuto. options, passed to Replicate, override the fields of
+// doc.
+func (c *Client) ReplicateDoc(ctx context.Context, doc *ReplicationDoc, options ...Options) (*Replication, error) {
+	if doc.Schema == ReplicationSchemaAuto {
+		ver, err := c.Version(ctx)
+		if err != nil {
+			return nil, err
+		}
+		d := *doc
+		d.Schema = ReplicationSchemaFor(ver)
+		doc = &d
+	}
+	opts, err := doc.Options()
+	if err != nil {
+		return nil, err
+	}
+	return c.Replicate(ctx, doc.Target.URL, doc.Source.URL, append([]Options{opts}, options...)...)
+}
@@ -0,0 +1,48 @@
+package kivik
+
+import (
+	"context"
+
+	"github.com/flimzy/kivik/errors"
+)
+
+// Revision statuses, as reported by GetRevisions.
+const (
+	// RevisionAvailable indicates that the revision's body is available.
+	RevisionAvailable = "available"
+	// RevisionMissing indicates that the revision's body has been removed by
+	// compaction, or was never replicated.
+	RevisionMissing = "missing"
+	// RevisionDeleted indicates that the revision is a deletion.
+	RevisionDeleted = "deleted"
+)
+
+// RevisionInfo is a single revision in a document's history.
+type RevisionInfo struct {
+	Rev string `json:"rev"`
+	// Status is one of RevisionAvailable, RevisionMissing or RevisionDeleted.
+	Status string `json:"status"`
+}
+
+// GetRevisions returns the revision history of the current revision of a
+// document, newest first, with the status of each revision.
+//
+// See http://docs.couchdb.org/en/2.0.0/api/document/common.html#obtaining-an-extended-revision-history
+func (db *DB) GetRevisions(ctx context.Context, docID string) ([]RevisionInfo, error) {
+	ctx, cancel := withTimeout(ctx, db.timeouts.Read)
+	defer cancel()
+	row, err := db.Get(ctx, docID, Options{"revs_info": true})
+	if err != nil {
+		return nil, err
+	}
+	var doc struct {
+		RevsInfo []RevisionInfo `json:"_revs_info"`
+	}
+	if err = row.ScanDoc(&doc); err != nil {
+		return nil, err
+	}
+	if doc.RevsInfo == nil {
+		return nil, errors.Status(StatusNotImplemented, "kivik: driver does not support revs_info")
+	}
+	return doc.RevsInfo, nil
+}
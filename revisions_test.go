@@ -0,0 +1,54 @@
+package kivik
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+
+	"github.com/flimzy/diff"
+)
+
+type revsInfoDB struct {
+	dummyDB
+	doc string
+}
+
+func (db *revsInfoDB) Get(_ context.Context, _ string, _ map[string]interface{}) (json.RawMessage, error) {
+	return json.RawMessage(db.doc), nil
+}
+
+func TestGetRevisions(t *testing.T) {
+	tests := []struct {
+		name     string
+		doc      string
+		expected []RevisionInfo
+		status   int
+	}{
+		{
+			name: "RevsInfo",
+			doc:  `{"_id":"foo","_rev":"3-ccc","_revs_info":[{"rev":"3-ccc","status":"available"},{"rev":"2-bbb","status":"missing"},{"rev":"1-aaa","status":"missing"}]}`,
+			expected: []RevisionInfo{
+				{Rev: "3-ccc", Status: RevisionAvailable},
+				{Rev: "2-bbb", Status: RevisionMissing},
+				{Rev: "1-aaa", Status: RevisionMissing},
+			},
+		},
+		{
+			name:   "NotSupported",
+			doc:    `{"_id":"foo","_rev":"3-ccc"}`,
+			status: StatusNotImplemented,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			db := &DB{driverDB: &revsInfoDB{doc: test.doc}}
+			revs, err := db.GetRevisions(context.Background(), "foo")
+			if StatusCode(err) != test.status {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if d := diff.Interface(test.expected, revs); d != "" {
+				t.Error(d)
+			}
+		})
+	}
+}
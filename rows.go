@@ -2,6 +2,8 @@ package kivik
 
 import (
 	"context"
+	"encoding/json"
+	"reflect"
 	"strings"
 
 	"github.com/flimzy/kivik/driver"
@@ -11,7 +13,8 @@ import (
 // Rows is an iterator over a a multi-value query.
 type Rows struct {
 	*iter
-	rowsi driver.Rows
+	rowsi   driver.Rows
+	maxRows int
 }
 
 // Next prepares the next result value for reading. It returns true on success
@@ -36,15 +39,55 @@ func (r *Rows) Close() error {
 	return r.iter.Close()
 }
 
-type rowsIterator struct{ driver.Rows }
+const reuseBuffersOption = "kivik_reuse_buffers"
+
+// ReuseBuffers returns options for Query and AllDocs, which allow the buffers
+// holding each row to be reused for the next row, rather than reallocated.
+// This reduces allocations when reading many rows, but means that the values
+// returned by Raw, and scanned into *json.RawMessage, are only valid until
+// the next call to Next or Close, even with drivers which would otherwise
+// allocate them anew. Values must be copied if they are to be retained.
+func ReuseBuffers() Options {
+	return Options{reuseBuffersOption: true}
+}
+
+// reuseBuffers removes the ReuseBuffers option from opts, and reports whether
+// it was set.
+func reuseBuffers(opts Options) bool {
+	reuse, _ := opts[reuseBuffersOption].(bool)
+	delete(opts, reuseBuffersOption)
+	return reuse
+}
+
+type rowsIterator struct {
+	driver.Rows
+	reuse bool
+}
 
 var _ iterator = &rowsIterator{}
 
-func (r *rowsIterator) Next(i interface{}) error { return r.Rows.Next(i.(*driver.Row)) }
+func (r *rowsIterator) Next(i interface{}) error {
+	row := i.(*driver.Row)
+	if r.reuse {
+		*row = driver.Row{Key: row.Key[:0], Value: row.Value[:0], Doc: row.Doc[:0], Raw: row.Raw[:0]}
+	} else {
+		*row = driver.Row{}
+	}
+	return r.Rows.Next(row)
+}
+
+func newRows(ctx context.Context, rowsi driver.Rows, reuse bool) *Rows {
+	return &Rows{
+		iter:  newIterator(ctx, &rowsIterator{Rows: rowsi, reuse: reuse}, &driver.Row{}),
+		rowsi: rowsi,
+	}
+}
 
-func newRows(ctx context.Context, rowsi driver.Rows) *Rows {
+// newPrefetchRows returns Rows which read up to n rows ahead from rowsi.
+func newPrefetchRows(ctx context.Context, rowsi driver.Rows, n int) *Rows {
+	feed := newPrefetcher(ctx, &rowsIterator{Rows: rowsi}, n, func() interface{} { return &driver.Row{} })
 	return &Rows{
-		iter:  newIterator(ctx, &rowsIterator{rowsi}, &driver.Row{}),
+		iter:  newIterator(ctx, feed, &driver.Row{}),
 		rowsi: rowsi,
 	}
 }
@@ -81,7 +124,7 @@ func (r *Rows) ScanDoc(dest interface{}) error {
 	}
 	defer runlock()
 	doc := r.curVal.(*driver.Row).Doc
-	if doc == nil {
+	if len(doc) == 0 {
 		return errors.Status(StatusBadRequest, "kivik: doc is nil; does the query include docs?")
 	}
 	return scan(dest, doc)
@@ -98,6 +141,43 @@ func (r *Rows) ScanKey(dest interface{}) error {
 	return scan(dest, r.curVal.(*driver.Row).Key)
 }
 
+// rawRow is the form in which a row is returned by Raw, if the driver does
+// not provide the raw JSON of rows.
+type rawRow struct {
+	ID    string          `json:"id,omitempty"`
+	Key   json.RawMessage `json:"key,omitempty"`
+	Value json.RawMessage `json:"value,omitempty"`
+	Doc   json.RawMessage `json:"doc,omitempty"`
+}
+
+// Raw returns the raw JSON of the current row, as sent by the server, such as
+// {"id":"foo","key":"foo","value":{"rev":"1-xxx"}}, or the document for
+// results of Find. This allows rows to be forwarded verbatim, as by proxies
+// and exporters, without decoding them. The slice must not be modified, and
+// is only valid until the next call to Next or Close. For drivers which do
+// not provide the raw JSON, it is assembled from the fields of the row.
+func (r *Rows) Raw() json.RawMessage {
+	runlock, err := r.rlock()
+	if err != nil {
+		return nil
+	}
+	defer runlock()
+	row := r.curVal.(*driver.Row)
+	if len(row.Raw) > 0 {
+		return row.Raw
+	}
+	raw, err := json.Marshal(rawRow{
+		ID:    row.ID,
+		Key:   row.Key,
+		Value: row.Value,
+		Doc:   row.Doc,
+	})
+	if err != nil {
+		return nil
+	}
+	return raw
+}
+
 // ID returns the ID of the current result.
 func (r *Rows) ID() string {
 	runlock, err := r.rlock()
@@ -138,8 +218,8 @@ func (r *Rows) TotalRows() int64 {
 
 // UpdateSeq returns the sequence id of the underlying database the view
 // reflects, if requested in the query.
-func (r *Rows) UpdateSeq() string {
-	return r.rowsi.UpdateSeq()
+func (r *Rows) UpdateSeq() SequenceID {
+	return SequenceID(r.rowsi.UpdateSeq())
 }
 
 // Warning returns a warning generated by the query, if any. This value is only
@@ -151,3 +231,115 @@ func (r *Rows) Warning() string {
 	}
 	return ""
 }
+
+// Bookmark returns the paging bookmark, if one was provided with the result
+// set. This is intended for use with the Mango /_find interface, with CouchDB
+// 2.1.1 and later. Pass the bookmark as the "bookmark" field of a subsequent
+// query to fetch the next page of results. This value is only guaranteed to
+// be set after all result rows have been enumerated through by Next.
+func (r *Rows) Bookmark() string {
+	if b, ok := r.rowsi.(driver.RowsBookmarker); ok {
+		return b.Bookmark()
+	}
+	return ""
+}
+
+// DefaultMaxRows is the maximum number of rows read by All and Map, unless set
+// otherwise with MaxRows.
+const DefaultMaxRows = 10000
+
+// MaxRows sets the maximum number of rows read by All and Map, as a safeguard
+// against unexpectedly large results, and returns r. If n is zero,
+// DefaultMaxRows applies. If n is negative, there is no limit.
+func (r *Rows) MaxRows(n int) *Rows {
+	r.maxRows = n
+	return r
+}
+
+// scanRow scans the doc of the current row into dest, if the row includes
+// one, and otherwise the value.
+func (r *Rows) scanRow(dest interface{}) error {
+	runlock, err := r.rlock()
+	if err != nil {
+		return err
+	}
+	defer runlock()
+	row := r.curVal.(*driver.Row)
+	if len(row.Doc) > 0 {
+		return scan(dest, row.Doc)
+	}
+	return scan(dest, row.Value)
+}
+
+// collect reads the remaining rows, calling fn with each row, decoded into a
+// new value of type elem, as a pointer, and then closes r.
+func (r *Rows) collect(elem reflect.Type, fn func(v reflect.Value)) error {
+	defer func() { _ = r.Close() }()
+	max := r.maxRows
+	if max == 0 {
+		max = DefaultMaxRows
+	}
+	var n int
+	for r.Next() {
+		if n++; max > 0 && n > max {
+			return errors.Statusf(StatusBadRequest, "kivik: more than %d rows; use MaxRows to raise the limit, or Next to iterate", max)
+		}
+		v := reflect.New(elem)
+		if err := r.scanRow(v.Interface()); err != nil {
+			return err
+		}
+		fn(v)
+	}
+	return r.Err()
+}
+
+// All reads the remaining rows into dest, which must be a pointer to a slice,
+// and closes r. The doc of each row is decoded, for results which include
+// documents, and otherwise the value. The rows are appended to any already
+// in the slice. If there are more than MaxRows rows, All returns an error,
+// with the rows up to the limit appended.
+//
+//	var docs []MyDoc
+//	err := rows.All(&docs)
+func (r *Rows) All(dest interface{}) error {
+	ptr := reflect.ValueOf(dest)
+	if ptr.Kind() != reflect.Ptr || ptr.IsNil() || ptr.Elem().Kind() != reflect.Slice {
+		_ = r.Close()
+		return errors.Status(StatusBadRequest, "kivik: All requires a pointer to a slice")
+	}
+	slice := ptr.Elem()
+	return r.collect(slice.Type().Elem(), func(v reflect.Value) {
+		slice.Set(reflect.Append(slice, v.Elem()))
+	})
+}
+
+// Map reads the remaining rows into dest, which must be a pointer to a map
+// with string keys, and closes r. Each row is keyed by its document ID, or,
+// for rows without one, such as those of a grouped reduce, by its key, as
+// returned by Key. Values are decoded as for All. If dest points to a nil
+// map, a new map is allocated.
+//
+//	var docs map[string]MyDoc
+//	err := rows.Map(&docs)
+//
+//	var counts map[string]int // Grouped by a string key
+//	err := rows.Map(&counts)
+func (r *Rows) Map(dest interface{}) error {
+	ptr := reflect.ValueOf(dest)
+	if ptr.Kind() != reflect.Ptr || ptr.IsNil() || ptr.Elem().Kind() != reflect.Map || ptr.Elem().Type().Key().Kind() != reflect.String {
+		_ = r.Close()
+		return errors.Status(StatusBadRequest, "kivik: Map requires a pointer to a map with string keys")
+	}
+	m := ptr.Elem()
+	if m.IsNil() {
+		m.Set(reflect.MakeMap(m.Type()))
+	}
+	keyType := m.Type().Key()
+	return r.collect(m.Type().Elem(), func(v reflect.Value) {
+		key := r.ID()
+		if key == "" {
+			key = r.Key()
+		}
+		m.SetMapIndex(reflect.ValueOf(key).Convert(keyType), v.Elem())
+	})
+}
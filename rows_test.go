@@ -1,8 +1,11 @@
 package kivik
 
 import (
+	"encoding/json"
+	"io"
 	"testing"
 
+	"github.com/flimzy/diff"
 	"golang.org/x/net/context"
 
 	"github.com/flimzy/kivik/driver"
@@ -28,17 +31,223 @@ func (r *wrows) Warning() string { return "test warning" }
 
 func TestWarning(t *testing.T) {
 	t.Run("Warner", func(t *testing.T) {
-		r := newRows(context.Background(), &wrows{})
+		r := newRows(context.Background(), &wrows{}, false)
 		expected := "test warning"
 		if w := r.Warning(); w != expected {
 			t.Errorf("Warning\nExpected: %s\n  Actual: %s", expected, w)
 		}
 	})
 	t.Run("NonWarner", func(t *testing.T) {
-		r := newRows(context.Background(), &rows{})
+		r := newRows(context.Background(), &rows{}, false)
 		expected := ""
 		if w := r.Warning(); w != expected {
 			t.Errorf("Warning\nExpected: %s\n  Actual: %s", expected, w)
 		}
 	})
 }
+
+type brows struct {
+	*rows
+}
+
+var _ driver.RowsBookmarker = &brows{}
+
+func (r *brows) Bookmark() string { return "test bookmark" }
+
+func TestBookmark(t *testing.T) {
+	t.Run("Bookmarker", func(t *testing.T) {
+		r := newRows(context.Background(), &brows{}, false)
+		expected := "test bookmark"
+		if b := r.Bookmark(); b != expected {
+			t.Errorf("Bookmark\nExpected: %s\n  Actual: %s", expected, b)
+		}
+	})
+	t.Run("NonBookmarker", func(t *testing.T) {
+		r := newRows(context.Background(), &rows{}, false)
+		expected := ""
+		if b := r.Bookmark(); b != expected {
+			t.Errorf("Bookmark\nExpected: %s\n  Actual: %s", expected, b)
+		}
+	})
+}
+
+// sliceRows returns each of its rows, decoding them into the buffers of the
+// *driver.Row, as a reusing driver would.
+type sliceRows struct {
+	*rows
+	input []string
+	raw   bool
+}
+
+func (r *sliceRows) Next(row *driver.Row) error {
+	if len(r.input) == 0 {
+		return io.EOF
+	}
+	next := r.input[0]
+	r.input = r.input[1:]
+	if r.raw {
+		row.Raw = append(row.Raw, next...)
+	}
+	return json.Unmarshal([]byte(next), row)
+}
+
+func TestRaw(t *testing.T) {
+	input := []string{
+		`{"id":"a","key":"a","value":{"rev":"1-xxx"}}`,
+		`{"id":"b","key":"b","value":{"rev":"2-yyy"}}`,
+	}
+	tests := []struct {
+		name     string
+		raw      bool
+		reuse    bool
+		expected []string
+	}{
+		{
+			name:     "Assembled",
+			expected: []string{`{"id":"a","key":"a","value":{"rev":"1-xxx"}}`, `{"id":"b","key":"b","value":{"rev":"2-yyy"}}`},
+		},
+		{
+			name:     "FromDriver",
+			raw:      true,
+			expected: input,
+		},
+		{
+			name:     "ReuseBuffers",
+			raw:      true,
+			reuse:    true,
+			expected: input,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			r := newRows(context.Background(), &sliceRows{input: append([]string(nil), input...), raw: test.raw}, test.reuse)
+			var result []string
+			var first json.RawMessage
+			for r.Next() {
+				raw := r.Raw()
+				if first == nil {
+					first = raw
+				}
+				result = append(result, string(raw))
+			}
+			if err := r.Err(); err != nil {
+				t.Fatal(err)
+			}
+			if d := diff.Interface(test.expected, result); d != "" {
+				t.Error(d)
+			}
+			if reused := string(first) == input[1]; reused != test.reuse {
+				t.Errorf("Expected buffer reuse to be %t, got %t", test.reuse, reused)
+			}
+		})
+	}
+}
+
+func TestScanDocReusedEmpty(t *testing.T) {
+	r := newRows(context.Background(), &sliceRows{input: []string{
+		`{"id":"a","doc":{"_id":"a"}}`,
+		`{"id":"b"}`,
+	}}, true)
+	r.Next()
+	r.Next()
+	var doc interface{}
+	if err := r.ScanDoc(&doc); StatusCode(err) != StatusBadRequest {
+		t.Errorf("Expected a missing doc error, got %v", err)
+	}
+}
+
+func TestAll(t *testing.T) {
+	type doc struct {
+		ID   string `json:"_id"`
+		Name string `json:"name"`
+	}
+	input := []string{
+		`{"id":"a","doc":{"_id":"a","name":"Alice"}}`,
+		`{"id":"b","doc":{"_id":"b","name":"Bob"}}`,
+	}
+	tests := []struct {
+		name     string
+		input    []string
+		maxRows  int
+		dest     interface{}
+		expected interface{}
+		status   int
+	}{
+		{
+			name:     "Docs",
+			input:    input,
+			dest:     &[]doc{},
+			expected: &[]doc{{ID: "a", Name: "Alice"}, {ID: "b", Name: "Bob"}},
+		},
+		{
+			name:     "Pointers",
+			input:    input,
+			dest:     &[]*doc{},
+			expected: &[]*doc{{ID: "a", Name: "Alice"}, {ID: "b", Name: "Bob"}},
+		},
+		{
+			name:     "Values",
+			input:    []string{`{"id":"a","key":"a","value":1}`, `{"id":"b","key":"b","value":2}`},
+			dest:     &[]int{},
+			expected: &[]int{1, 2},
+		},
+		{
+			name:     "TooManyRows",
+			input:    input,
+			maxRows:  1,
+			dest:     &[]doc{},
+			expected: &[]doc{{ID: "a", Name: "Alice"}},
+			status:   StatusBadRequest,
+		},
+		{
+			name:     "NotASlice",
+			input:    input,
+			dest:     &map[string]doc{},
+			expected: &map[string]doc{},
+			status:   StatusBadRequest,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			r := newRows(context.Background(), &sliceRows{input: test.input}, false)
+			err := r.MaxRows(test.maxRows).All(test.dest)
+			if status := StatusCode(err); status != test.status {
+				t.Errorf("Unexpected error: %v", err)
+			}
+			if d := diff.Interface(test.expected, test.dest); d != "" {
+				t.Error(d)
+			}
+		})
+	}
+}
+
+func TestMap(t *testing.T) {
+	tests := []struct {
+		name     string
+		input    []string
+		expected map[string]int
+	}{
+		{
+			name:     "ByID",
+			input:    []string{`{"id":"a","key":"x","value":1}`, `{"id":"b","key":"y","value":2}`},
+			expected: map[string]int{"a": 1, "b": 2},
+		},
+		{
+			name:     "ByKey",
+			input:    []string{`{"key":"x","value":1}`, `{"key":"y","value":2}`},
+			expected: map[string]int{"x": 1, "y": 2},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			r := newRows(context.Background(), &sliceRows{input: test.input}, false)
+			var result map[string]int
+			if err := r.Map(&result); err != nil {
+				t.Fatal(err)
+			}
+			if d := diff.Interface(test.expected, result); d != "" {
+				t.Error(d)
+			}
+		})
+	}
+}
@@ -0,0 +1,300 @@
+package schema
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"math"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/flimzy/kivik"
+	"github.com/flimzy/kivik/errors"
+)
+
+// Schema is a compiled JSON Schema.
+type Schema struct {
+	types                []string
+	required             []string
+	properties           map[string]*Schema
+	additionalProperties *Schema
+	noAdditional         bool
+	items                *Schema
+	enum                 []json.RawMessage
+	minimum, maximum     *float64
+	minLength, maxLength *int
+	minItems, maxItems   *int
+	pattern              *regexp.Regexp
+}
+
+type rawSchema struct {
+	Type                 json.RawMessage            `json:"type"`
+	Required             []string                   `json:"required"`
+	Properties           map[string]json.RawMessage `json:"properties"`
+	AdditionalProperties json.RawMessage            `json:"additionalProperties"`
+	Items                json.RawMessage            `json:"items"`
+	Enum                 []json.RawMessage          `json:"enum"`
+	Minimum              *float64                   `json:"minimum"`
+	Maximum              *float64                   `json:"maximum"`
+	MinLength            *int                       `json:"minLength"`
+	MaxLength            *int                       `json:"maxLength"`
+	MinItems             *int                       `json:"minItems"`
+	MaxItems             *int                       `json:"maxItems"`
+	Pattern              string                     `json:"pattern"`
+}
+
+// Compile compiles a JSON Schema. The validation keywords type, required,
+// properties, additionalProperties, items (a single schema), enum, minimum,
+// maximum, minLength, maxLength, minItems, maxItems and pattern are
+// supported. Other keywords, such as $schema, title and description, are
+// ignored. An error with status kivik.StatusBadRequest is returned for an
+// invalid schema.
+func Compile(schema []byte) (*Schema, error) {
+	s, err := compile(schema)
+	if err != nil {
+		return nil, errors.WrapStatus(kivik.StatusBadRequest, fmt.Errorf("schema: %s", err))
+	}
+	return s, nil
+}
+
+func compile(schema []byte) (*Schema, error) {
+	var raw rawSchema
+	if err := json.Unmarshal(schema, &raw); err != nil {
+		return nil, err
+	}
+	s := &Schema{
+		required:  raw.Required,
+		enum:      raw.Enum,
+		minimum:   raw.Minimum,
+		maximum:   raw.Maximum,
+		minLength: raw.MinLength,
+		maxLength: raw.MaxLength,
+		minItems:  raw.MinItems,
+		maxItems:  raw.MaxItems,
+	}
+	if len(raw.Type) > 0 {
+		if raw.Type[0] == '"' {
+			var t string
+			if err := json.Unmarshal(raw.Type, &t); err != nil {
+				return nil, err
+			}
+			s.types = []string{t}
+		} else if err := json.Unmarshal(raw.Type, &s.types); err != nil {
+			return nil, err
+		}
+		for _, t := range s.types {
+			switch t {
+			case "object", "array", "string", "number", "integer", "boolean", "null":
+			default:
+				return nil, fmt.Errorf("unknown type %q", t)
+			}
+		}
+	}
+	if len(raw.Properties) > 0 {
+		s.properties = make(map[string]*Schema, len(raw.Properties))
+		for name, prop := range raw.Properties {
+			sub, err := compile(prop)
+			if err != nil {
+				return nil, fmt.Errorf("property %s: %s", name, err)
+			}
+			s.properties[name] = sub
+		}
+	}
+	switch ap := bytes.TrimSpace(raw.AdditionalProperties); {
+	case len(ap) == 0, string(ap) == "true":
+	case string(ap) == "false":
+		s.noAdditional = true
+	default:
+		sub, err := compile(ap)
+		if err != nil {
+			return nil, fmt.Errorf("additionalProperties: %s", err)
+		}
+		s.additionalProperties = sub
+	}
+	if len(raw.Items) > 0 {
+		sub, err := compile(raw.Items)
+		if err != nil {
+			return nil, fmt.Errorf("items: %s", err)
+		}
+		s.items = sub
+	}
+	if raw.Pattern != "" {
+		re, err := regexp.Compile(raw.Pattern)
+		if err != nil {
+			return nil, err
+		}
+		s.pattern = re
+	}
+	return s, nil
+}
+
+// Validate validates the JSON value v, such as a document decoded into a
+// map[string]interface{}, and returns the failures, if any.
+func (s *Schema) Validate(v interface{}) []FieldError {
+	var errs []FieldError
+	s.validate("", v, &errs)
+	return errs
+}
+
+func (s *Schema) validate(path string, v interface{}, errs *[]FieldError) {
+	fail := func(format string, args ...interface{}) {
+		*errs = append(*errs, FieldError{Path: path, Message: fmt.Sprintf(format, args...)})
+	}
+	if len(s.types) > 0 && !s.matchesType(v) {
+		fail("expected %s, got %s", strings.Join(s.types, " or "), typeOf(v))
+		return
+	}
+	if len(s.enum) > 0 && !s.inEnum(v) {
+		fail("value is not one of the allowed values")
+	}
+	switch t := v.(type) {
+	case map[string]interface{}:
+		s.validateObject(path, t, errs)
+	case []interface{}:
+		if s.minItems != nil && len(t) < *s.minItems {
+			fail("expected at least %d items", *s.minItems)
+		}
+		if s.maxItems != nil && len(t) > *s.maxItems {
+			fail("expected at most %d items", *s.maxItems)
+		}
+		if s.items != nil {
+			for i, item := range t {
+				s.items.validate(path+"/"+strconv.Itoa(i), item, errs)
+			}
+		}
+	case string:
+		length := utf8.RuneCountInString(t)
+		if s.minLength != nil && length < *s.minLength {
+			fail("expected at least %d characters", *s.minLength)
+		}
+		if s.maxLength != nil && length > *s.maxLength {
+			fail("expected at most %d characters", *s.maxLength)
+		}
+		if s.pattern != nil && !s.pattern.MatchString(t) {
+			fail("does not match pattern %s", s.pattern)
+		}
+	default:
+		if n, ok := toFloat(v); ok {
+			if s.minimum != nil && n < *s.minimum {
+				fail("must be at least %v", *s.minimum)
+			}
+			if s.maximum != nil && n > *s.maximum {
+				fail("must be at most %v", *s.maximum)
+			}
+		}
+	}
+}
+
+func (s *Schema) validateObject(path string, obj map[string]interface{}, errs *[]FieldError) {
+	for _, name := range s.required {
+		if _, ok := obj[name]; !ok {
+			*errs = append(*errs, FieldError{Path: path + "/" + escape(name), Message: "required field is missing"})
+		}
+	}
+	names := make([]string, 0, len(obj))
+	for name := range obj {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		fieldPath := path + "/" + escape(name)
+		if prop, ok := s.properties[name]; ok {
+			prop.validate(fieldPath, obj[name], errs)
+			continue
+		}
+		if strings.HasPrefix(name, "_") && path == "" {
+			// Special CouchDB fields, such as _id and _rev, are always allowed.
+			continue
+		}
+		switch {
+		case s.noAdditional:
+			*errs = append(*errs, FieldError{Path: fieldPath, Message: "unexpected field"})
+		case s.additionalProperties != nil:
+			s.additionalProperties.validate(fieldPath, obj[name], errs)
+		}
+	}
+}
+
+// escape escapes a JSON Pointer reference token.
+func escape(name string) string {
+	return strings.Replace(strings.Replace(name, "~", "~0", -1), "/", "~1", -1)
+}
+
+func (s *Schema) matchesType(v interface{}) bool {
+	actual := typeOf(v)
+	for _, t := range s.types {
+		if t == actual || (t == "number" && actual == "integer") {
+			return true
+		}
+	}
+	return false
+}
+
+func (s *Schema) inEnum(v interface{}) bool {
+	value, err := json.Marshal(v)
+	if err != nil {
+		return false
+	}
+	for _, allowed := range s.enum {
+		var a interface{}
+		if err := json.Unmarshal(allowed, &a); err != nil {
+			continue
+		}
+		canonical, _ := json.Marshal(a)
+		if bytes.Equal(value, canonical) {
+			return true
+		}
+	}
+	return false
+}
+
+// typeOf returns the JSON Schema type of v.
+func typeOf(v interface{}) string {
+	switch v.(type) {
+	case nil:
+		return "null"
+	case bool:
+		return "boolean"
+	case string:
+		return "string"
+	case map[string]interface{}:
+		return "object"
+	case []interface{}:
+		return "array"
+	}
+	if n, ok := toFloat(v); ok {
+		if n == math.Trunc(n) && !math.IsInf(n, 0) {
+			return "integer"
+		}
+		return "number"
+	}
+	return fmt.Sprintf("%T", v)
+}
+
+func toFloat(v interface{}) (float64, bool) {
+	switch t := v.(type) {
+	case float64:
+		return t, true
+	case float32:
+		return float64(t), true
+	case int:
+		return float64(t), true
+	case int64:
+		return float64(t), true
+	case int32:
+		return float64(t), true
+	case uint:
+		return float64(t), true
+	case uint64:
+		return float64(t), true
+	case uint32:
+		return float64(t), true
+	case json.Number:
+		n, err := t.Float64()
+		return n, err == nil
+	}
+	return 0, false
+}
@@ -0,0 +1,156 @@
+// Package schema validates documents before they are written, by the value of
+// a type field, with JSON Schemas or Go validator functions.
+//
+//	validator := schema.New("type")
+//	err := validator.RegisterSchema("user", []byte(`{
+//	    "type": "object",
+//	    "required": ["name"],
+//	    "properties": {"name": {"type": "string", "minLength": 1}}
+//	}`))
+//	db.AddHooks(validator.Hooks())
+//	_, err = db.Put(ctx, "bob", map[string]interface{}{"type": "user"})
+//	// err is a *schema.ValidationError, with status kivik.StatusBadRequest
+//
+// The validator is applied through the BeforePut hook of kivik.Hooks, so it
+// validates documents written with Put, CreateDoc, BulkDocs, and the methods
+// built upon them, with any driver. Documents without a registered type, and
+// deleted documents, are not validated.
+package schema
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+
+	"github.com/flimzy/kivik"
+)
+
+// DefaultTypeField is the name of the field which holds the document type,
+// if none is given to New.
+const DefaultTypeField = "type"
+
+// FieldError describes a single validation failure.
+type FieldError struct {
+	// Path is the JSON Pointer to the invalid value, such as "/address/city",
+	// or empty for the document itself.
+	Path string `json:"path"`
+	// Message describes the failure.
+	Message string `json:"message"`
+}
+
+func (e FieldError) String() string {
+	if e.Path == "" {
+		return e.Message
+	}
+	return e.Path + ": " + e.Message
+}
+
+// ValidationError is returned when a document fails validation. Its status
+// is kivik.StatusBadRequest.
+type ValidationError struct {
+	DocID  string
+	Type   string
+	Errors []FieldError
+}
+
+var _ error = &ValidationError{}
+
+func (e *ValidationError) Error() string {
+	msgs := make([]string, len(e.Errors))
+	for i, fe := range e.Errors {
+		msgs[i] = fe.String()
+	}
+	return fmt.Sprintf("schema: invalid %s document %q: %s", e.Type, e.DocID, strings.Join(msgs, "; "))
+}
+
+// StatusCode returns kivik.StatusBadRequest.
+func (e *ValidationError) StatusCode() int {
+	return kivik.StatusBadRequest
+}
+
+// Func is a Go validator function. It may return a *ValidationError, or
+// any other error, which is converted to a ValidationError with that error's
+// message.
+type Func func(doc map[string]interface{}) error
+
+// Validator validates documents by type.
+type Validator struct {
+	typeField string
+	mu        sync.RWMutex
+	funcs     map[string]Func
+}
+
+// New returns a Validator which reads the document type from typeField, or
+// DefaultTypeField if typeField is empty.
+func New(typeField string) *Validator {
+	if typeField == "" {
+		typeField = DefaultTypeField
+	}
+	return &Validator{
+		typeField: typeField,
+		funcs:     make(map[string]Func),
+	}
+}
+
+// Register registers fn to validate documents of docType, replacing any
+// validator already registered for the type.
+func (v *Validator) Register(docType string, fn Func) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	v.funcs[docType] = fn
+}
+
+// RegisterSchema compiles the JSON Schema, and registers it to validate
+// documents of docType. See Compile for the supported keywords.
+func (v *Validator) RegisterSchema(docType string, schema []byte) error {
+	s, err := Compile(schema)
+	if err != nil {
+		return err
+	}
+	v.Register(docType, func(doc map[string]interface{}) error {
+		if errs := s.Validate(doc); len(errs) > 0 {
+			return &ValidationError{Errors: errs}
+		}
+		return nil
+	})
+	return nil
+}
+
+// Validate validates doc, with the validator registered for its type. nil is
+// returned if the document is valid, has no registered type, or is deleted.
+func (v *Validator) Validate(docID string, doc map[string]interface{}) error {
+	if deleted, _ := doc["_deleted"].(bool); deleted {
+		return nil
+	}
+	docType, _ := doc[v.typeField].(string)
+	v.mu.RLock()
+	fn, ok := v.funcs[docType]
+	v.mu.RUnlock()
+	if !ok {
+		return nil
+	}
+	if docID == "" {
+		docID, _ = doc["_id"].(string)
+	}
+	err := fn(doc)
+	if err == nil {
+		return nil
+	}
+	verr, ok := err.(*ValidationError)
+	if !ok {
+		verr = &ValidationError{Errors: []FieldError{{Message: err.Error()}}}
+	}
+	verr.DocID = docID
+	verr.Type = docType
+	return verr
+}
+
+// Hooks returns the hooks which apply the validator to the writes of a DB.
+func (v *Validator) Hooks() kivik.Hooks {
+	return kivik.Hooks{
+		BeforePut: func(_ context.Context, docID string, doc map[string]interface{}) error {
+			return v.Validate(docID, doc)
+		},
+	}
+}
@@ -0,0 +1,172 @@
+package schema
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/flimzy/diff"
+	"github.com/flimzy/kivik"
+	_ "github.com/flimzy/kivik/driver/memory"
+)
+
+const userSchema = `{
+	"$schema": "http://json-schema.org/draft-04/schema#",
+	"type": "object",
+	"required": ["name", "age"],
+	"additionalProperties": false,
+	"properties": {
+		"type": {"enum": ["user"]},
+		"name": {"type": "string", "minLength": 1, "maxLength": 10},
+		"age": {"type": "integer", "minimum": 0, "maximum": 150},
+		"email": {"type": "string", "pattern": "^[^@]+@[^@]+$"},
+		"tags": {"type": "array", "maxItems": 2, "items": {"type": "string"}},
+		"address": {
+			"type": "object",
+			"additionalProperties": {"type": "string"}
+		}
+	}
+}`
+
+func TestSchemaValidate(t *testing.T) {
+	s, err := Compile([]byte(userSchema))
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name     string
+		doc      map[string]interface{}
+		expected []FieldError
+	}{
+		{
+			name: "Valid",
+			doc: map[string]interface{}{
+				"_id": "bob", "_rev": "1-x", "type": "user", "name": "Bob", "age": float64(42),
+				"email": "bob@example.com", "tags": []interface{}{"a", "b"},
+				"address": map[string]interface{}{"city": "Berlin"},
+			},
+		},
+		{
+			name: "GoInt",
+			doc:  map[string]interface{}{"name": "Bob", "age": 42},
+		},
+		{
+			name: "Missing",
+			doc:  map[string]interface{}{"name": "Bob"},
+			expected: []FieldError{
+				{Path: "/age", Message: "required field is missing"},
+			},
+		},
+		{
+			name: "Invalid",
+			doc: map[string]interface{}{
+				"type": "admin", "name": "", "age": 1.5, "email": "bob",
+				"tags":    []interface{}{"a", 2, "c"},
+				"address": map[string]interface{}{"city": 1},
+				"extra":   true,
+			},
+			expected: []FieldError{
+				{Path: "/address/city", Message: "expected string, got integer"},
+				{Path: "/age", Message: "expected integer, got number"},
+				{Path: "/email", Message: "does not match pattern ^[^@]+@[^@]+$"},
+				{Path: "/extra", Message: "unexpected field"},
+				{Path: "/name", Message: "expected at least 1 characters"},
+				{Path: "/tags", Message: "expected at most 2 items"},
+				{Path: "/tags/1", Message: "expected string, got integer"},
+				{Path: "/type", Message: "value is not one of the allowed values"},
+			},
+		},
+		{
+			name: "Range",
+			doc:  map[string]interface{}{"name": "Bob", "age": float64(200)},
+			expected: []FieldError{
+				{Path: "/age", Message: "must be at most 150"},
+			},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			errs := s.Validate(test.doc)
+			if d := diff.Interface(test.expected, errs); d != "" {
+				t.Error(d)
+			}
+		})
+	}
+}
+
+func TestCompileErrors(t *testing.T) {
+	tests := map[string]string{
+		"InvalidJSON": `{`,
+		"UnknownType": `{"type":"foo"}`,
+		"BadPattern":  `{"pattern":"("}`,
+		"BadProperty": `{"properties":{"foo":{"type":1}}}`,
+	}
+	for name, schema := range tests {
+		t.Run(name, func(t *testing.T) {
+			_, err := Compile([]byte(schema))
+			if kivik.StatusCode(err) != kivik.StatusBadRequest {
+				t.Errorf("Expected 400, got %v", err)
+			}
+		})
+	}
+}
+
+func TestValidatorHooks(t *testing.T) {
+	ctx := context.Background()
+	client, err := kivik.New(ctx, "memory", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = client.CreateDB(ctx, "schema"); err != nil {
+		t.Fatal(err)
+	}
+	db, err := client.DB(ctx, "schema")
+	if err != nil {
+		t.Fatal(err)
+	}
+	v := New("")
+	if err = v.RegisterSchema("user", []byte(userSchema)); err != nil {
+		t.Fatal(err)
+	}
+	v.Register("note", func(doc map[string]interface{}) error {
+		if _, ok := doc["text"].(string); !ok {
+			return errors.New("a note needs text")
+		}
+		return nil
+	})
+	db.AddHooks(v.Hooks())
+
+	if _, err = db.Put(ctx, "bob", map[string]interface{}{"type": "user", "name": "Bob", "age": 42}); err != nil {
+		t.Errorf("Valid document rejected: %s", err)
+	}
+	if _, err = db.Put(ctx, "other", map[string]interface{}{"type": "other"}); err != nil {
+		t.Errorf("Unregistered type rejected: %s", err)
+	}
+	_, err = db.Put(ctx, "alice", map[string]interface{}{"type": "user", "name": "Alice"})
+	verr, ok := err.(*ValidationError)
+	if !ok {
+		t.Fatalf("Expected a ValidationError, got %T: %v", err, err)
+	}
+	expected := &ValidationError{
+		DocID:  "alice",
+		Type:   "user",
+		Errors: []FieldError{{Path: "/age", Message: "required field is missing"}},
+	}
+	if d := diff.Interface(expected, verr); d != "" {
+		t.Error(d)
+	}
+	if status := kivik.StatusCode(err); status != kivik.StatusBadRequest {
+		t.Errorf("Unexpected status: %d", status)
+	}
+	_, err = db.BulkDocs(ctx, []interface{}{
+		map[string]interface{}{"_id": "n1", "type": "note", "text": "hi"},
+		map[string]interface{}{"_id": "n2", "type": "note"},
+	})
+	expectedMsg := `schema: invalid note document "n2": a note needs text`
+	if err == nil || err.Error() != expectedMsg {
+		t.Errorf("Expected %q, got %v", expectedMsg, err)
+	}
+	if _, err := db.Get(ctx, "alice"); kivik.StatusCode(err) != kivik.StatusNotFound {
+		t.Errorf("Invalid document was saved")
+	}
+}
@@ -0,0 +1,92 @@
+package kivik
+
+import (
+	"bytes"
+	"encoding/json"
+	"strconv"
+	"strings"
+)
+
+// SequenceID is a CouchDB update sequence ID, as returned by the changes feed,
+// and with database statistics, and as accepted by the since option of the
+// changes feed.
+//
+// CouchDB 1.x uses integers for sequence IDs, while CouchDB 2.x uses opaque
+// strings, which begin with an integer followed by a hyphen. SequenceID
+// accepts either form when unmarshaling JSON, so that application code need
+// not depend on the server version.
+type SequenceID string
+
+// UnmarshalJSON satisfies the json.Unmarshaler interface. Strings are decoded;
+// numbers, and any other JSON values, are stored as raw JSON.
+func (id *SequenceID) UnmarshalJSON(data []byte) error {
+	data = bytes.TrimSpace(data)
+	if len(data) > 0 && data[0] == '"' {
+		var s string
+		if err := json.Unmarshal(data, &s); err != nil {
+			return err
+		}
+		*id = SequenceID(s)
+		return nil
+	}
+	*id = SequenceID(data)
+	return nil
+}
+
+// Number returns the integer sequence number of a CouchDB 1.x sequence ID, or
+// the integer prefix of a CouchDB 2.x sequence ID. ok is false if the sequence
+// ID does not begin with an integer, as is the case for "now".
+func (id SequenceID) Number() (n int64, ok bool) {
+	prefix := string(id)
+	if i := strings.IndexByte(prefix, '-'); i > 0 {
+		prefix = prefix[:i]
+	}
+	n, err := strconv.ParseInt(prefix, 10, 64)
+	return n, err == nil
+}
+
+// Compare returns -1, 0 or 1 if id is before, the same as, or after other,
+// and whether the sequence IDs could be ordered. Identical sequence IDs are
+// always equal. Otherwise, sequence IDs are ordered by Number. Distinct
+// sequence IDs with the same number, or without a number, cannot be ordered.
+//
+// The numeric prefix of a CouchDB 2.x sequence ID is the sum of the sequences
+// of the database's shards, so the ordering of sequence IDs from different
+// nodes of a cluster is approximate.
+func (id SequenceID) Compare(other SequenceID) (result int, ok bool) {
+	if id == other {
+		return 0, true
+	}
+	a, okA := id.Number()
+	b, okB := other.Number()
+	if !okA || !okB || a == b {
+		return 0, false
+	}
+	if a < b {
+		return -1, true
+	}
+	return 1, true
+}
+
+// SinceNow is the value of the since option which starts a changes feed at
+// the current update sequence, so that only later changes are returned.
+const SinceNow SequenceID = "now"
+
+// Since returns the options to start a changes feed after the sequence ID id,
+// as returned by Changes.Seq or DB.UpdateSeq, for use with DB.Changes:
+//
+//	changes, err := db.Changes(ctx, kivik.Since(seq))
+//
+// Integer sequence IDs, as used by CouchDB 1.x, PouchDB and the memory driver,
+// are passed as integers, as some drivers require. Others are passed as
+// strings. An empty sequence ID, as returned by drivers which do not report
+// sequences, returns no options, so that the feed starts from the beginning.
+func Since(id SequenceID) Options {
+	if id == "" {
+		return Options{}
+	}
+	if n, err := strconv.ParseInt(string(id), 10, 64); err == nil {
+		return Options{"since": n}
+	}
+	return Options{"since": string(id)}
+}
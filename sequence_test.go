@@ -0,0 +1,126 @@
+package kivik
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+
+	"github.com/flimzy/diff"
+	"github.com/flimzy/kivik/driver"
+)
+
+func TestSequenceIDUnmarshalJSON(t *testing.T) {
+	tests := []struct {
+		name     string
+		input    string
+		expected SequenceID
+	}{
+		{name: "Couch1", input: `123`, expected: "123"},
+		{name: "Couch2", input: `"123-g1AAAABteJzLYWBgYMpgTmHgz8tPSTV0"`, expected: "123-g1AAAABteJzLYWBgYMpgTmHgz8tPSTV0"},
+		{name: "Escaped", input: `"1-A"`, expected: "1-A"},
+		{name: "Array", input: `[1, "abc"]`, expected: `[1, "abc"]`},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var result struct {
+				Seq SequenceID `json:"seq"`
+			}
+			if err := json.Unmarshal([]byte(`{"seq":`+test.input+`}`), &result); err != nil {
+				t.Fatal(err)
+			}
+			if result.Seq != test.expected {
+				t.Errorf("Expected %q, got %q", test.expected, result.Seq)
+			}
+		})
+	}
+}
+
+func TestSequenceIDCompare(t *testing.T) {
+	tests := []struct {
+		name     string
+		a, b     SequenceID
+		expected int
+		ok       bool
+	}{
+		{name: "Couch1Before", a: "9", b: "10", expected: -1, ok: true},
+		{name: "Couch1After", a: "10", b: "9", expected: 1, ok: true},
+		{name: "Identical", a: "3-abc", b: "3-abc", expected: 0, ok: true},
+		{name: "Couch2Before", a: "3-abc", b: "12-abc", expected: -1, ok: true},
+		{name: "Couch2SameNumber", a: "3-abc", b: "3-def", expected: 0, ok: false},
+		{name: "Now", a: "now", b: "3-abc", expected: 0, ok: false},
+		{name: "Mixed", a: "4", b: "3-abc", expected: 1, ok: true},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			result, ok := test.a.Compare(test.b)
+			if result != test.expected || ok != test.ok {
+				t.Errorf("Expected %d, %t; got %d, %t", test.expected, test.ok, result, ok)
+			}
+		})
+	}
+}
+
+func TestSince(t *testing.T) {
+	tests := []struct {
+		name     string
+		id       SequenceID
+		expected Options
+	}{
+		{name: "Empty", id: "", expected: Options{}},
+		{name: "Couch1", id: "12", expected: Options{"since": int64(12)}},
+		{name: "Couch2", id: "12-abc", expected: Options{"since": "12-abc"}},
+		{name: "Now", id: SinceNow, expected: Options{"since": "now"}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if d := diff.Interface(test.expected, Since(test.id)); d != "" {
+				t.Error(d)
+			}
+		})
+	}
+}
+
+// seqDB reports updateSeq, and records the options of Changes.
+type seqDB struct {
+	*dummyDB
+	updateSeq string
+	opts      map[string]interface{}
+}
+
+func (db *seqDB) Stats(_ context.Context) (*driver.DBStats, error) {
+	return &driver.DBStats{UpdateSeq: db.updateSeq}, nil
+}
+
+func (db *seqDB) Changes(_ context.Context, opts map[string]interface{}) (driver.Changes, error) {
+	db.opts = opts
+	return &sliceChanges{}, nil
+}
+
+func TestChangesNow(t *testing.T) {
+	tests := []struct {
+		name      string
+		updateSeq string
+		seq       SequenceID
+		opts      map[string]interface{}
+	}{
+		{name: "Couch1", updateSeq: "5", seq: "5", opts: map[string]interface{}{"since": int64(5), "feed": "continuous"}},
+		{name: "Couch2", updateSeq: "5-abc", seq: "5-abc", opts: map[string]interface{}{"since": "5-abc", "feed": "continuous"}},
+		{name: "Unreported", seq: SinceNow, opts: map[string]interface{}{"since": "now", "feed": "continuous"}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			driverDB := &seqDB{updateSeq: test.updateSeq}
+			db := &DB{driverDB: driverDB}
+			_, seq, err := db.ChangesNow(context.Background(), Options{"feed": "continuous", "since": "0"})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if seq != test.seq {
+				t.Errorf("Unexpected seq %q", seq)
+			}
+			if d := diff.Interface(test.opts, driverDB.opts); d != "" {
+				t.Error(d)
+			}
+		})
+	}
+}
@@ -0,0 +1,337 @@
+package serve
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/flimzy/kivik"
+	"github.com/flimzy/kivik/errors"
+	"github.com/flimzy/kivik/serve/conf"
+	"github.com/flimzy/kivik/serve/logger"
+)
+
+// adminPrefix is the path under which the runtime management endpoints are
+// served.
+const adminPrefix = "_kivik"
+
+// ActiveFeed describes a changes feed being served, as reported by
+// GET /_kivik/feeds.
+type ActiveFeed struct {
+	DB         string    `json:"db_name"`
+	Feed       string    `json:"feed"`
+	Username   string    `json:"username,omitempty"`
+	RemoteAddr string    `json:"remote_addr"`
+	Started    time.Time `json:"started"`
+}
+
+// ActiveReplication describes a replication, as reported by
+// GET /_kivik/replications.
+type ActiveReplication struct {
+	ID          string    `json:"replication_id"`
+	Source      string    `json:"source"`
+	Target      string    `json:"target"`
+	State       string    `json:"state"`
+	DocsRead    int64     `json:"docs_read"`
+	DocsWritten int64     `json:"docs_written"`
+	StartTime   time.Time `json:"start_time"`
+}
+
+// IdleSessionCloser is an optional interface which may be satisfied by an
+// auth.Handler which stores sessions server-side, to close those which have
+// not been used for longer than idle, as requested by
+// DELETE /_kivik/sessions?idle=duration.
+type IdleSessionCloser interface {
+	// CloseIdleSessions closes the sessions not used since before, and
+	// returns the number closed.
+	CloseIdleSessions(ctx context.Context, before time.Time) (int, error)
+}
+
+// adminHandler serves the runtime management endpoints to server admins:
+//
+//   - GET /_kivik/feeds lists the changes feeds being served.
+//   - GET /_kivik/replications lists the replications of the client.
+//   - DELETE /_kivik/sessions?idle=duration closes the sessions not used
+//     for duration, such as "30m", of each auth handler which implements
+//     IdleSessionCloser.
+//   - POST /_kivik/config/_reload reloads ConfigFile.
+//   - GET and PUT /_kivik/maintenance report and set maintenance mode, as
+//     {"enabled":true}.
+//   - GET /_kivik/dbs reports the stats of every database, and
+//     GET /_kivik/dbs/{db} those of one.
+//   - GET /_kivik/housekeeping reports the housekeeping schedule and the
+//     results of the last run, and POST /_kivik/housekeeping runs it now.
+//
+// It also records the changes feeds being served, and, in maintenance mode,
+// refuses writes with 503 Service Unavailable.
+func adminHandler(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		s := GetService(r)
+		parts := strings.Split(strings.TrimPrefix(r.URL.Path, "/"), "/")
+		if parts[0] == adminPrefix {
+			user := MustGetSession(r.Context()).User
+			switch {
+			case user == nil:
+				reportError(w, errors.Status(kivik.StatusUnauthorized, "You are not a server admin."))
+			case !isAdmin(user):
+				reportError(w, errors.Status(kivik.StatusForbidden, "You are not a server admin."))
+			default:
+				result, err := s.serveAdmin(r, parts[1:])
+				reportAdmin(w, result, err)
+			}
+			return
+		}
+		if s.Maintenance() && isWrite(r.Method, parts) {
+			w.Header().Set("Retry-After", "60")
+			reportError(w, errors.Status(http.StatusServiceUnavailable, "The server is in maintenance mode."))
+			return
+		}
+		if len(parts) == 2 && parts[1] == "_changes" {
+			defer s.trackFeed(r, parts[0])()
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+func reportAdmin(w http.ResponseWriter, result interface{}, err error) {
+	if err != nil {
+		reportError(w, err)
+		return
+	}
+	w.Header().Set("Content-Type", typeJSON)
+	_ = json.NewEncoder(w).Encode(result)
+}
+
+var errAdminNotFound = errors.Status(kivik.StatusNotFound, "missing")
+
+func (s *Service) serveAdmin(r *http.Request, parts []string) (interface{}, error) {
+	ctx := r.Context()
+	route := r.Method + " " + strings.Join(parts, "/")
+	switch {
+	case route == "GET feeds":
+		return s.ActiveFeeds(), nil
+	case route == "GET replications":
+		return s.activeReplications(ctx)
+	case route == "DELETE sessions":
+		idle, err := time.ParseDuration(r.URL.Query().Get("idle"))
+		if err != nil {
+			return nil, errors.WrapStatus(kivik.StatusBadRequest, err)
+		}
+		closed, err := s.CloseIdleSessions(ctx, idle)
+		if err != nil {
+			return nil, err
+		}
+		return map[string]interface{}{"ok": true, "closed": closed}, nil
+	case route == "POST config/_reload":
+		if err := s.ReloadConfig(); err != nil {
+			return nil, err
+		}
+		return map[string]bool{"ok": true}, nil
+	case route == "GET maintenance":
+		return map[string]bool{"enabled": s.Maintenance()}, nil
+	case route == "PUT maintenance":
+		var body struct {
+			Enabled bool `json:"enabled"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+			return nil, errors.WrapStatus(kivik.StatusBadRequest, err)
+		}
+		s.SetMaintenance(body.Enabled)
+		return map[string]bool{"ok": true, "enabled": body.Enabled}, nil
+	case route == "GET housekeeping":
+		return s.Housekeeping(), nil
+	case route == "POST housekeeping":
+		return s.Housekeep(ctx), nil
+	case route == "GET dbs":
+		return s.allDBStats(ctx)
+	case r.Method == http.MethodGet && len(parts) == 2 && parts[0] == "dbs":
+		dbName, err := url.QueryUnescape(parts[1])
+		if err != nil {
+			return nil, errors.WrapStatus(kivik.StatusBadRequest, err)
+		}
+		return s.dbStats(ctx, dbName)
+	}
+	return nil, errAdminNotFound
+}
+
+// isWrite returns true if the request, with the path split into segments, may
+// modify the server's data.
+func isWrite(method string, parts []string) bool {
+	switch method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions:
+		return false
+	}
+	if parts[0] == "_session" {
+		return false
+	}
+	if method == http.MethodPost && len(parts) > 1 {
+		switch parts[1] {
+		case "_all_docs", "_find", "_explain", "_changes", "_bulk_get", "_revs_diff", "_missing_revs":
+			return false
+		case "_design":
+			return len(parts) < 4 || parts[3] != "_view"
+		}
+	}
+	return true
+}
+
+// Maintenance returns true if the service is in maintenance mode.
+func (s *Service) Maintenance() bool {
+	return atomic.LoadInt32(&s.maintenance) == 1
+}
+
+// SetMaintenance enables or disables maintenance mode, in which requests
+// which may modify data are refused with 503 Service Unavailable, while reads
+// and the admin endpoints continue to be served.
+func (s *Service) SetMaintenance(enabled bool) {
+	var v int32
+	if enabled {
+		v = 1
+	}
+	if atomic.SwapInt32(&s.maintenance, v) != v {
+		s.logger().Log(logger.LevelInfo, "Maintenance mode changed", logger.Fields{"enabled": enabled})
+	}
+}
+
+// trackFeed records the changes feed requested by r, until the returned
+// function is called.
+func (s *Service) trackFeed(r *http.Request, db string) (done func()) {
+	feed := &ActiveFeed{
+		DB:         db,
+		Feed:       r.URL.Query().Get("feed"),
+		RemoteAddr: remoteAddr(r),
+		Started:    s.Now(),
+	}
+	if unescaped, err := url.QueryUnescape(db); err == nil {
+		feed.DB = unescaped
+	}
+	if feed.Feed == "" {
+		feed.Feed = "normal"
+	}
+	if user := MustGetSession(r.Context()).User; user != nil {
+		feed.Username = user.Name
+	}
+	s.feedsMU.Lock()
+	if s.feeds == nil {
+		s.feeds = make(map[*ActiveFeed]struct{})
+	}
+	s.feeds[feed] = struct{}{}
+	s.feedsMU.Unlock()
+	return func() {
+		s.feedsMU.Lock()
+		delete(s.feeds, feed)
+		s.feedsMU.Unlock()
+	}
+}
+
+// ActiveFeeds returns the changes feeds being served, oldest first.
+func (s *Service) ActiveFeeds() []ActiveFeed {
+	s.feedsMU.Lock()
+	feeds := make([]ActiveFeed, 0, len(s.feeds))
+	for feed := range s.feeds {
+		feeds = append(feeds, *feed)
+	}
+	s.feedsMU.Unlock()
+	sort.Sort(feedsByStart(feeds))
+	return feeds
+}
+
+type feedsByStart []ActiveFeed
+
+func (f feedsByStart) Len() int           { return len(f) }
+func (f feedsByStart) Swap(i, j int)      { f[i], f[j] = f[j], f[i] }
+func (f feedsByStart) Less(i, j int) bool { return f[i].Started.Before(f[j].Started) }
+
+func (s *Service) activeReplications(ctx context.Context) ([]ActiveReplication, error) {
+	reps, err := s.Client.GetReplications(ctx)
+	if err != nil {
+		return nil, err
+	}
+	result := make([]ActiveReplication, len(reps))
+	for i, rep := range reps {
+		result[i] = ActiveReplication{
+			ID:          rep.ReplicationID(),
+			Source:      rep.Source,
+			Target:      rep.Target,
+			State:       string(rep.State()),
+			DocsRead:    rep.DocsRead(),
+			DocsWritten: rep.DocsWritten(),
+			StartTime:   rep.StartTime(),
+		}
+	}
+	return result, nil
+}
+
+// CloseIdleSessions closes the sessions, of each auth handler which
+// implements IdleSessionCloser, which have not been used for longer than
+// idle, and returns the number closed.
+func (s *Service) CloseIdleSessions(ctx context.Context, idle time.Duration) (int, error) {
+	before := s.Now().Add(-idle)
+	var closed int
+	for _, name := range s.authHandlerNames {
+		closer, ok := s.authHandlers[name].(IdleSessionCloser)
+		if !ok {
+			continue
+		}
+		n, err := closer.CloseIdleSessions(ctx, before)
+		closed += n
+		if err != nil {
+			return closed, err
+		}
+	}
+	return closed, nil
+}
+
+// ReloadConfig reads ConfigFile again, replacing the configuration. It fails
+// if the configuration was given directly, as Config.
+func (s *Service) ReloadConfig() error {
+	if s.Config != nil {
+		return errors.Status(kivik.StatusBadRequest, "The configuration was not loaded from a file.")
+	}
+	c, err := conf.Load(s.ConfigFile)
+	if err != nil {
+		s.logger().Log(logger.LevelError, "Failed to reload config", logger.Fields{
+			logger.FieldConfigFile: s.ConfigFile,
+			logger.FieldError:      err,
+		})
+		return err
+	}
+	s.confMU.Lock()
+	s.conf = c
+	s.confMU.Unlock()
+	s.logger().Log(logger.LevelInfo, "Reloaded config", logger.Fields{logger.FieldConfigFile: s.ConfigFile})
+	return nil
+}
+
+func (s *Service) dbStats(ctx context.Context, dbName string) (*kivik.DBStats, error) {
+	db, err := s.Client.DB(ctx, dbName)
+	if err != nil {
+		return nil, err
+	}
+	return db.Stats(ctx)
+}
+
+func (s *Service) allDBStats(ctx context.Context) ([]*kivik.DBStats, error) {
+	dbNames, err := s.Client.AllDBs(ctx)
+	if err != nil {
+		return nil, err
+	}
+	sort.Strings(dbNames)
+	result := make([]*kivik.DBStats, 0, len(dbNames))
+	for _, dbName := range dbNames {
+		stats, err := s.dbStats(ctx, dbName)
+		if err != nil {
+			return nil, err
+		}
+		if stats.Name == "" {
+			stats.Name = dbName
+		}
+		result = append(result, stats)
+	}
+	return result, nil
+}
@@ -0,0 +1,127 @@
+package serve
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/flimzy/diff"
+	"github.com/flimzy/kivik"
+	"github.com/flimzy/kivik/auth"
+	"github.com/flimzy/kivik/authdb"
+	_ "github.com/flimzy/kivik/driver/memory"
+	"github.com/flimzy/kivik/serve/conf"
+)
+
+func TestIsWrite(t *testing.T) {
+	tests := []struct {
+		method   string
+		path     string
+		expected bool
+	}{
+		{method: "GET", path: "foo/bar"},
+		{method: "HEAD", path: "foo"},
+		{method: "POST", path: "_session"},
+		{method: "POST", path: "foo/_find"},
+		{method: "POST", path: "foo/_all_docs"},
+		{method: "POST", path: "foo/_design/bar/_view/baz"},
+		{method: "POST", path: "foo/_design/bar/_update/baz", expected: true},
+		{method: "POST", path: "foo", expected: true},
+		{method: "PUT", path: "foo", expected: true},
+		{method: "DELETE", path: "foo/bar", expected: true},
+		{method: "POST", path: "_replicate", expected: true},
+	}
+	for _, test := range tests {
+		if result := isWrite(test.method, strings.Split(test.path, "/")); result != test.expected {
+			t.Errorf("%s %s: expected %t, got %t", test.method, test.path, test.expected, result)
+		}
+	}
+}
+
+func TestAdminHandler(t *testing.T) {
+	ctx := context.Background()
+	client, err := kivik.New(ctx, "memory", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := client.CreateDB(ctx, "foo"); err != nil {
+		t.Fatal(err)
+	}
+	s := &Service{Client: client, Config: conf.New()}
+	bob := &authdb.UserContext{Name: "bob"}
+	admin := &authdb.UserContext{Name: "admin", Roles: []string{"_admin"}}
+
+	var feeds []ActiveFeed
+	next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		feeds = s.ActiveFeeds()
+		w.WriteHeader(http.StatusOK)
+	})
+	request := func(user *authdb.UserContext, method, path, body string) *httptest.ResponseRecorder {
+		session := &auth.Session{User: user}
+		req := httptest.NewRequest(method, path, strings.NewReader(body))
+		ctx := context.WithValue(req.Context(), ServiceContextKey, s)
+		ctx = context.WithValue(ctx, SessionKey, &session)
+		w := httptest.NewRecorder()
+		adminHandler(next).ServeHTTP(w, req.WithContext(ctx))
+		return w
+	}
+
+	steps := []struct {
+		name   string
+		user   *authdb.UserContext
+		method string
+		path   string
+		body   string
+		status int
+	}{
+		{name: "Anonymous", method: "GET", path: "/_kivik/feeds", status: http.StatusUnauthorized},
+		{name: "NotAdmin", user: bob, method: "GET", path: "/_kivik/feeds", status: http.StatusForbidden},
+		{name: "Unknown", user: admin, method: "GET", path: "/_kivik/foo", status: http.StatusNotFound},
+		{name: "Reload", user: admin, method: "POST", path: "/_kivik/config/_reload", status: http.StatusBadRequest},
+		{name: "InvalidIdle", user: admin, method: "DELETE", path: "/_kivik/sessions?idle=x", status: http.StatusBadRequest},
+		{name: "CloseSessions", user: admin, method: "DELETE", path: "/_kivik/sessions?idle=10m", status: http.StatusOK},
+		{name: "Write", user: bob, method: "PUT", path: "/foo/a", status: http.StatusOK},
+		{name: "Maintenance", user: admin, method: "PUT", path: "/_kivik/maintenance", body: `{"enabled":true}`, status: http.StatusOK},
+		{name: "MaintenanceWrite", user: admin, method: "PUT", path: "/foo/a", status: http.StatusServiceUnavailable},
+		{name: "MaintenanceRead", user: bob, method: "GET", path: "/foo/a", status: http.StatusOK},
+		{name: "DBStats", user: admin, method: "GET", path: "/_kivik/dbs/foo", status: http.StatusOK},
+		{name: "MissingDBStats", user: admin, method: "GET", path: "/_kivik/dbs/bar", status: http.StatusNotFound},
+		{name: "Housekeep", user: admin, method: "POST", path: "/_kivik/housekeeping", status: http.StatusOK},
+		{name: "Housekeeping", user: admin, method: "GET", path: "/_kivik/housekeeping", status: http.StatusOK},
+	}
+	for _, step := range steps {
+		if w := request(step.user, step.method, step.path, step.body); w.Code != step.status {
+			t.Errorf("%s: unexpected status %d: %s", step.name, w.Code, w.Body.String())
+		}
+	}
+
+	w := request(admin, "GET", "/_kivik/maintenance", "")
+	if d := diff.JSON([]byte(`{"enabled":true}`), w.Body.Bytes()); d != "" {
+		t.Error(d)
+	}
+	s.SetMaintenance(false)
+
+	w = request(admin, "GET", "/_kivik/dbs", "")
+	var stats []kivik.DBStats
+	if err := json.NewDecoder(w.Body).Decode(&stats); err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	for _, st := range stats {
+		names = append(names, st.Name)
+	}
+	if d := diff.Interface([]string{"_replicator", "_users", "foo"}, names); d != "" {
+		t.Error(d)
+	}
+
+	request(bob, "GET", "/foo/_changes?feed=continuous", "")
+	if len(feeds) != 1 || feeds[0].DB != "foo" || feeds[0].Feed != "continuous" || feeds[0].Username != "bob" {
+		t.Errorf("Unexpected active feeds during the request: %+v", feeds)
+	}
+	if active := s.ActiveFeeds(); len(active) != 0 {
+		t.Errorf("Expected no active feeds after the request, got %+v", active)
+	}
+}
@@ -1,10 +1,16 @@
 package serve
 
 import (
+	"net"
 	"net/http"
+	"time"
 
+	"github.com/flimzy/kivik"
 	"github.com/flimzy/kivik/auth"
 	"github.com/flimzy/kivik/authdb"
+	"github.com/flimzy/kivik/errors"
+	"github.com/flimzy/kivik/serve/logger"
+	"github.com/flimzy/kivik/serve/stats"
 )
 
 type doneWriter struct {
@@ -28,6 +34,10 @@ func authHandler(next http.Handler) http.Handler {
 		s := GetService(r)
 		session, err := s.validate(dw, r)
 		if err != nil {
+			s.logger().Log(logger.LevelWarn, "Authentication error", logger.Fields{
+				logger.FieldRemoteAddr: remoteAddr(r),
+				logger.FieldError:      err,
+			})
 			reportError(w, err)
 			return
 		}
@@ -37,6 +47,9 @@ func authHandler(next http.Handler) http.Handler {
 			// The auth handler already responded to the request
 			return
 		}
+		if session.User != nil {
+			r = r.WithContext(authdb.NewContext(r.Context(), session.User))
+		}
 		next.ServeHTTP(w, r)
 	})
 }
@@ -51,16 +64,26 @@ func (s *Service) validate(w http.ResponseWriter, r *http.Request) (*auth.Sessio
 	for methodName, handler := range s.authHandlers {
 		uCtx, err := handler.Authenticate(w, r)
 		if err != nil {
+			s.countAuth(methodName, stats.ResultFailure)
 			return nil, err
 		}
 		if uCtx != nil {
+			s.countAuth(methodName, stats.ResultSuccess)
 			return s.createSession(methodName, uCtx), nil
 		}
 	}
 	// None of the auth methods succeeded, so return unauthorized
+	s.countAuth("", stats.ResultNone)
 	return s.createSession("", nil), nil
 }
 
+func (s *Service) countAuth(method, result string) {
+	s.stats().Count(stats.MetricAuthAttempts, stats.Labels{
+		stats.LabelAuthMethod: method,
+		stats.LabelResult:     result,
+	}, 1)
+}
+
 func (s *Service) createSession(method string, user *authdb.UserContext) *auth.Session {
 	return &auth.Session{
 		AuthMethod: method,
@@ -69,3 +92,50 @@ func (s *Service) createSession(method string, user *authdb.UserContext) *auth.S
 		User:       user,
 	}
 }
+
+// remoteAddr returns the host portion of the request's remote address.
+func remoteAddr(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+// ValidateUser validates the username and password against the UserStore.
+// If LoginThrottle is configured, attempts against locked accounts or client
+// addresses are refused, and failed attempts are recorded and delayed. Auth
+// handlers which accept a password should use this method, rather than
+// calling UserStore.Validate directly.
+func (s *Service) ValidateUser(r *http.Request, username, password string) (*authdb.UserContext, error) {
+	t := s.LoginThrottle
+	if t == nil {
+		return s.UserStore.Validate(r.Context(), username, password)
+	}
+	addr := remoteAddr(r)
+	if err := t.Check(username, addr); err != nil {
+		s.logger().Log(logger.LevelWarn, "Login refused by throttle", logger.Fields{
+			logger.FieldUsername:   username,
+			logger.FieldRemoteAddr: addr,
+		})
+		return nil, err
+	}
+	user, err := s.UserStore.Validate(r.Context(), username, password)
+	if err != nil {
+		if errors.StatusCode(err) == kivik.StatusUnauthorized {
+			s.logger().Log(logger.LevelInfo, "Login failed", logger.Fields{
+				logger.FieldUsername:   username,
+				logger.FieldRemoteAddr: addr,
+			})
+			if delay := t.Failure(username, addr); delay > 0 {
+				select {
+				case <-time.After(delay):
+				case <-r.Context().Done():
+				}
+			}
+		}
+		return nil, err
+	}
+	t.Success(username, addr)
+	return user, nil
+}
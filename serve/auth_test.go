@@ -0,0 +1,69 @@
+package serve
+
+import (
+	"context"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/flimzy/kivik"
+	"github.com/flimzy/kivik/auth"
+	"github.com/flimzy/kivik/auth/throttle"
+	"github.com/flimzy/kivik/authdb"
+	"github.com/flimzy/kivik/errors"
+	"github.com/flimzy/kivik/serve/conf"
+	"github.com/flimzy/kivik/serve/stats"
+)
+
+type testStore struct{}
+
+var _ authdb.UserStore = &testStore{}
+
+func (s *testStore) Validate(ctx context.Context, username, password string) (*authdb.UserContext, error) {
+	if password != "abc123" {
+		return nil, errors.Status(kivik.StatusUnauthorized, "unauthorized")
+	}
+	return s.UserCtx(ctx, username)
+}
+
+func (s *testStore) UserCtx(_ context.Context, username string) (*authdb.UserContext, error) {
+	return &authdb.UserContext{Name: username}, nil
+}
+
+func TestValidateUser(t *testing.T) {
+	s := &Service{
+		UserStore:     &testStore{},
+		LoginThrottle: &throttle.Throttle{MaxAttempts: 2},
+	}
+	req := httptest.NewRequest("POST", "/_session", nil)
+	if _, err := s.ValidateUser(req, "bob", "abc123"); err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+	for i := 0; i < 2; i++ {
+		if _, err := s.ValidateUser(req, "bob", "wrong"); errors.StatusCode(err) != kivik.StatusUnauthorized {
+			t.Errorf("Expected 401, got %v", err)
+		}
+	}
+	if _, err := s.ValidateUser(req, "bob", "abc123"); errors.StatusCode(err) != kivik.StatusForbidden {
+		t.Errorf("Expected locked account, got %v", err)
+	}
+	if stats := s.LoginThrottle.Stats(); stats.Failures != 2 || stats.Rejected != 1 {
+		t.Errorf("Unexpected stats: %+v", stats)
+	}
+}
+
+func TestValidateStats(t *testing.T) {
+	c := stats.NewMemory()
+	s := &Service{
+		AuthHandlers: []auth.Handler{&testAuthHandler{}},
+		UserStore:    &testStore{},
+		Stats:        c,
+		Config:       conf.New(),
+	}
+	s.authHandlersSetup()
+	if _, err := s.validate(httptest.NewRecorder(), httptest.NewRequest("GET", "/", nil)); err != nil {
+		t.Fatal(err)
+	}
+	if n := c.Counter(stats.MetricAuthAttempts, stats.Labels{stats.LabelAuthMethod: "", stats.LabelResult: stats.ResultNone}); n != 1 {
+		t.Errorf("Expected 1 unauthenticated attempt, got %d", n)
+	}
+}
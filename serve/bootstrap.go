@@ -0,0 +1,85 @@
+package serve
+
+import (
+	"context"
+	"sort"
+
+	"github.com/flimzy/kivik"
+	"github.com/flimzy/kivik/errors"
+	"github.com/flimzy/kivik/serve/logger"
+)
+
+// Bootstrap creates the databases required by the service, if they do not
+// exist: the system databases (kivik.SystemDBs), if couchdb.create_system_dbs
+// is true, and the application databases of Databases and of the databases
+// config section, which are converged to their specs, such as their security
+// objects, with kivik.Client.EnsureDB. A database declared by both is
+// bootstrapped by its spec in Databases. In the config, such as:
+//
+//	[databases.orders]
+//	admins = ["alice"]
+//	admin_roles = ["ops"]
+//	members = []
+//	member_roles = ["staff"]
+//
+// a database whose section has none of these keys is only created.
+//
+// Bootstrap is called by Init, which fails if it does.
+func (s *Service) Bootstrap(ctx context.Context) error {
+	if s.Conf().GetBool("couchdb.create_system_dbs") {
+		for _, name := range kivik.SystemDBs {
+			if err := s.bootstrapDB(ctx, name, nil); err != nil {
+				return err
+			}
+		}
+	}
+	specs := s.confDatabases()
+	for name, spec := range s.Databases {
+		specs[name] = spec
+	}
+	names := make([]string, 0, len(specs))
+	for name := range specs {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		if err := s.bootstrapDB(ctx, name, specs[name]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *Service) bootstrapDB(ctx context.Context, name string, spec *kivik.DBSpec) error {
+	if _, err := s.Client.EnsureDB(ctx, name, spec); err != nil {
+		s.logger().Log(logger.LevelError, "Failed to bootstrap database", logger.Fields{
+			logger.FieldDB:    name,
+			logger.FieldError: err,
+		})
+		return errors.Wrapf(err, "bootstrap %s", name)
+	}
+	s.logger().Log(logger.LevelInfo, "Bootstrapped database", logger.Fields{logger.FieldDB: name})
+	return nil
+}
+
+// confDatabases returns the specs of the databases declared in the databases
+// config section.
+func (s *Service) confDatabases() map[string]*kivik.DBSpec {
+	c := s.Conf()
+	specs := make(map[string]*kivik.DBSpec)
+	for name := range c.GetStringMap("databases") {
+		key := "databases." + name + "."
+		spec := &kivik.DBSpec{}
+		for _, field := range []string{"admins", "admin_roles", "members", "member_roles"} {
+			if c.IsSet(key + field) {
+				spec.Security = &kivik.Security{
+					Admins:  kivik.Members{Names: c.GetStringSlice(key + "admins"), Roles: c.GetStringSlice(key + "admin_roles")},
+					Members: kivik.Members{Names: c.GetStringSlice(key + "members"), Roles: c.GetStringSlice(key + "member_roles")},
+				}
+				break
+			}
+		}
+		specs[name] = spec
+	}
+	return specs
+}
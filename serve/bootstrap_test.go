@@ -0,0 +1,82 @@
+package serve
+
+import (
+	"context"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/flimzy/diff"
+	"github.com/flimzy/kivik"
+	_ "github.com/flimzy/kivik/driver/memory"
+	"github.com/flimzy/kivik/serve/conf"
+	"github.com/spf13/viper"
+)
+
+func TestBootstrap(t *testing.T) {
+	ctx := context.Background()
+	client, err := kivik.New(ctx, "memory", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	v := viper.New()
+	v.SetConfigType("toml")
+	err = v.ReadConfig(strings.NewReader(`
+[couchdb]
+create_system_dbs = true
+
+[databases.orders]
+admins = ["alice"]
+member_roles = ["staff"]
+
+[databases.logs]
+
+[databases.invoices]
+admins = ["ignored"]
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := &Service{
+		Client: client,
+		Config: &conf.Conf{Viper: v},
+		Databases: map[string]*kivik.DBSpec{
+			"invoices": {Security: &kivik.Security{Members: kivik.Members{Names: []string{"bob"}}}},
+			"foo/bar":  nil,
+		},
+	}
+	if _, err = s.Init(); err != nil {
+		t.Fatal(err)
+	}
+	// Bootstrapping again changes nothing.
+	if err = s.Bootstrap(ctx); err != nil {
+		t.Fatal(err)
+	}
+	dbs, err := client.AllDBs(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sort.Strings(dbs)
+	expected := []string{"_global_changes", "_replicator", "_users", "foo/bar", "invoices", "logs", "orders"}
+	if d := diff.Interface(expected, dbs); d != "" {
+		t.Error(d)
+	}
+	securities := map[string]*kivik.Security{
+		"orders":   {Admins: kivik.Members{Names: []string{"alice"}}, Members: kivik.Members{Roles: []string{"staff"}}},
+		"invoices": {Members: kivik.Members{Names: []string{"bob"}}},
+		"logs":     {},
+	}
+	for name, expected := range securities {
+		db, err := client.DB(ctx, name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		sec, err := db.Security(ctx)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if d := diff.AsJSON(expected, sec); d != "" {
+			t.Errorf("%s: %s", name, d)
+		}
+	}
+}
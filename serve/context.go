@@ -55,3 +55,10 @@ func GetService(r *http.Request) *Service {
 	service := r.Context().Value(ServiceContextKey).(*Service)
 	return service
 }
+
+// ServiceFromContext returns the Kivik service serving the request whose
+// context is ctx, or nil if there is none.
+func ServiceFromContext(ctx context.Context) *Service {
+	service, _ := ctx.Value(ServiceContextKey).(*Service)
+	return service
+}
@@ -1,19 +1,188 @@
 package couchserver
 
 import (
+	"context"
 	"encoding/json"
 	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/flimzy/kivik"
+	"github.com/flimzy/kivik/auth"
+	"github.com/flimzy/kivik/authdb"
+	"github.com/flimzy/kivik/errors"
 )
 
-// GetAllDBs handles GET /_all_dbs
+// allDBsQuery holds the query parameters of GET /_all_dbs.
+type allDBsQuery struct {
+	startKey, endKey string
+	descending       bool
+	limit, skip      int
+}
+
+func parseAllDBsQuery(query url.Values) (*allDBsQuery, error) {
+	q := &allDBsQuery{limit: -1}
+	var err error
+	if q.startKey, err = keyParam(query, "startkey", "start_key"); err != nil {
+		return nil, err
+	}
+	if q.endKey, err = keyParam(query, "endkey", "end_key"); err != nil {
+		return nil, err
+	}
+	if v := query.Get("descending"); v != "" {
+		if q.descending, err = strconv.ParseBool(v); err != nil {
+			return nil, errors.Statusf(kivik.StatusBadRequest, "Invalid descending: %s", v)
+		}
+	}
+	for name, dest := range map[string]*int{"limit": &q.limit, "skip": &q.skip} {
+		v := query.Get(name)
+		if v == "" {
+			continue
+		}
+		if *dest, err = strconv.Atoi(v); err != nil || *dest < 0 {
+			return nil, errors.Statusf(kivik.StatusBadRequest, "Invalid %s: %s", name, v)
+		}
+	}
+	return q, nil
+}
+
+// keyParam returns the value of the first of the named query parameters which
+// is set, as a JSON string, such as "foo", including the quotes. For leniency,
+// an unquoted value is used as is.
+func keyParam(query url.Values, names ...string) (string, error) {
+	for _, name := range names {
+		v := query.Get(name)
+		if v == "" {
+			continue
+		}
+		if !strings.HasPrefix(v, `"`) {
+			return v, nil
+		}
+		var key string
+		if err := json.Unmarshal([]byte(v), &key); err != nil {
+			return "", errors.Statusf(kivik.StatusBadRequest, "Invalid %s: %s", name, v)
+		}
+		return key, nil
+	}
+	return "", nil
+}
+
+// inRange returns true if dbName is between the start and end keys, in the
+// direction of the query.
+func (q *allDBsQuery) inRange(dbName string) bool {
+	if q.descending {
+		return (q.startKey == "" || dbName <= q.startKey) && (q.endKey == "" || dbName >= q.endKey)
+	}
+	return (q.startKey == "" || dbName >= q.startKey) && (q.endKey == "" || dbName <= q.endKey)
+}
+
+// GetAllDBs handles GET /_all_dbs, with the startkey, endkey, descending,
+// limit and skip parameters. Server admins are shown every database; other
+// users, and anonymous requests, only those which they may read, according
+// to their security documents.
 func (h *Handler) GetAllDBs() http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
+		q, err := parseAllDBsQuery(r.URL.Query())
+		if err != nil {
+			h.HandleError(w, err)
+			return
+		}
 		allDBs, err := h.Client.AllDBs(r.Context())
 		if err != nil {
 			h.HandleError(w, err)
 			return
 		}
+		if q.descending {
+			sort.Sort(sort.Reverse(sort.StringSlice(allDBs)))
+		} else {
+			sort.Strings(allDBs)
+		}
+		user := h.sessionUser(r)
+		result := make([]string, 0, len(allDBs))
+		skipped := 0
+		for _, dbName := range allDBs {
+			if q.limit >= 0 && len(result) >= q.limit {
+				break
+			}
+			if !q.inRange(dbName) {
+				continue
+			}
+			readable, err := h.canRead(r.Context(), user, dbName)
+			if err != nil {
+				h.HandleError(w, err)
+				return
+			}
+			if !readable {
+				continue
+			}
+			if skipped < q.skip {
+				skipped++
+				continue
+			}
+			result = append(result, dbName)
+		}
 		w.Header().Set("Content-Type", typeJSON)
-		h.HandleError(w, json.NewEncoder(w).Encode(allDBs))
+		h.HandleError(w, json.NewEncoder(w).Encode(result))
+	}
+}
+
+// sessionUser returns the user of the request's session, or nil for an
+// anonymous request.
+func (h *Handler) sessionUser(r *http.Request) *authdb.UserContext {
+	if s, ok := r.Context().Value(h.SessionKey).(**auth.Session); ok && *s != nil {
+		return (*s).User
+	}
+	return nil
+}
+
+// canRead returns true if user, which may be nil, may read the database
+// dbName. Server admins may read every database. Otherwise, as with CouchDB,
+// a database whose security document has no members is public, and one with
+// members may be read by its admins and members, by name or role. Databases
+// whose driver does not support security documents are public.
+func (h *Handler) canRead(ctx context.Context, user *authdb.UserContext, dbName string) (bool, error) {
+	if user != nil && hasRole(user, "_admin") {
+		return true, nil
+	}
+	db, err := h.Client.DB(ctx, dbName)
+	if err != nil {
+		return false, err
+	}
+	sec, err := db.Security(ctx)
+	if kivik.StatusCode(err) == kivik.StatusNotImplemented {
+		return true, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	if len(sec.Members.Names) == 0 && len(sec.Members.Roles) == 0 {
+		return true, nil
+	}
+	if user == nil {
+		return false, nil
+	}
+	for _, members := range []kivik.Members{sec.Admins, sec.Members} {
+		for _, name := range members.Names {
+			if name == user.Name {
+				return true, nil
+			}
+		}
+		for _, role := range members.Roles {
+			if hasRole(user, role) {
+				return true, nil
+			}
+		}
+	}
+	return false, nil
+}
+
+func hasRole(user *authdb.UserContext, role string) bool {
+	for _, r := range user.Roles {
+		if r == role {
+			return true
+		}
 	}
+	return false
 }
@@ -2,28 +2,73 @@ package couchserver
 
 import (
 	"context"
+	"net/http"
 	"net/http/httptest"
 	"testing"
 
 	"github.com/flimzy/diff"
 	"github.com/flimzy/kivik"
+	"github.com/flimzy/kivik/authdb"
 	_ "github.com/flimzy/kivik/driver/memory"
 )
 
 func TestAllDBs(t *testing.T) {
-	client, err := kivik.New(context.Background(), "memory", "")
+	ctx := context.Background()
+	client, err := kivik.New(ctx, "memory", "")
 	if err != nil {
 		panic(err)
 	}
-	h := &Handler{Client: client}
-	handler := h.GetAllDBs()
-	w := httptest.NewRecorder()
-	req := httptest.NewRequest("GET", "/_all_dbs", nil)
-	handler(w, req)
-	resp := w.Result()
-	defer resp.Body.Close()
-	expected := []string{}
-	if d := diff.AsJSON(expected, resp.Body); d != "" {
-		t.Error(d)
+	for _, dbName := range []string{"a", "b", "c", "private"} {
+		if err := client.CreateDB(ctx, dbName); err != nil {
+			t.Fatal(err)
+		}
+	}
+	db, err := client.DB(ctx, "private")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := db.SetSecurity(ctx, &kivik.Security{Members: kivik.Members{Names: []string{"bob"}, Roles: []string{"staff"}}}); err != nil {
+		t.Fatal(err)
+	}
+	admin := &authdb.UserContext{Name: "admin", Roles: []string{"_admin"}}
+	tests := []struct {
+		name     string
+		user     *authdb.UserContext
+		query    string
+		status   int
+		expected []string
+	}{
+		{name: "Admin", user: admin, expected: []string{"_replicator", "_users", "a", "b", "c", "private"}},
+		{name: "Anonymous", expected: []string{"_replicator", "_users", "a", "b", "c"}},
+		{name: "Member", user: &authdb.UserContext{Name: "bob"}, expected: []string{"_replicator", "_users", "a", "b", "c", "private"}},
+		{name: "Role", user: &authdb.UserContext{Name: "carol", Roles: []string{"staff"}}, query: "?startkey=%22c%22", expected: []string{"c", "private"}},
+		{name: "NotMember", user: &authdb.UserContext{Name: "dave"}, query: "?start_key=%22c%22", expected: []string{"c"}},
+		{name: "Range", user: admin, query: "?startkey=%22a%22&endkey=%22b%22", expected: []string{"a", "b"}},
+		{name: "Descending", user: admin, query: "?descending=true&startkey=%22b%22&limit=2", expected: []string{"b", "a"}},
+		{name: "SkipLimit", query: "?skip=2&limit=2", expected: []string{"a", "b"}},
+		{name: "SkipFiltered", query: "?startkey=%22c%22&skip=1", expected: []string{}},
+		{name: "ZeroLimit", user: admin, query: "?limit=0", expected: []string{}},
+		{name: "InvalidLimit", query: "?limit=x", status: http.StatusBadRequest},
+		{name: "InvalidKey", query: "?startkey=%22a", status: http.StatusBadRequest},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			h := &Handler{Client: client, SessionKey: sessionKey{}}
+			w := httptest.NewRecorder()
+			h.GetAllDBs()(w, withSession(httptest.NewRequest("GET", "/_all_dbs"+test.query, nil), test.user))
+			status := test.status
+			if status == 0 {
+				status = http.StatusOK
+			}
+			if w.Code != status {
+				t.Fatalf("Unexpected status %d: %s", w.Code, w.Body.String())
+			}
+			if status != http.StatusOK {
+				return
+			}
+			if d := diff.AsJSON(test.expected, w.Body); d != "" {
+				t.Error(d)
+			}
+		})
 	}
 }
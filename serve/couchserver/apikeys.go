@@ -0,0 +1,102 @@
+package couchserver
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/pressly/chi"
+
+	"github.com/flimzy/kivik"
+	"github.com/flimzy/kivik/auth"
+	"github.com/flimzy/kivik/errors"
+)
+
+// requireAdmin returns an error unless the request's session belongs to a
+// server admin.
+func (h *Handler) requireAdmin(r *http.Request) error {
+	s, ok := r.Context().Value(h.SessionKey).(**auth.Session)
+	if !ok || *s == nil || (*s).User == nil {
+		return errors.Status(kivik.StatusUnauthorized, "You are not authorized to access this db.")
+	}
+	for _, role := range (*s).User.Roles {
+		if role == "_admin" {
+			return nil
+		}
+	}
+	return errors.Status(kivik.StatusForbidden, "You are not a server admin.")
+}
+
+func (h *Handler) apiKeysAdmin(r *http.Request) error {
+	if err := h.requireAdmin(r); err != nil {
+		return err
+	}
+	if h.APIKeys == nil {
+		return errors.Status(kivik.StatusNotImplemented, "api keys not configured")
+	}
+	return nil
+}
+
+// GetAPIKeys handles GET /_api_keys
+func (h *Handler) GetAPIKeys() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if err := h.apiKeysAdmin(r); err != nil {
+			h.HandleError(w, err)
+			return
+		}
+		keys, err := h.APIKeys.List(r.Context())
+		if err != nil {
+			h.HandleError(w, err)
+			return
+		}
+		w.Header().Set("Content-Type", typeJSON)
+		h.HandleError(w, json.NewEncoder(w).Encode(keys))
+	}
+}
+
+// PostAPIKey handles POST /_api_keys
+func (h *Handler) PostAPIKey() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if err := h.apiKeysAdmin(r); err != nil {
+			h.HandleError(w, err)
+			return
+		}
+		var req struct {
+			Name  string   `json:"name"`
+			Roles []string `json:"roles"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			h.HandleError(w, errors.WrapStatus(kivik.StatusBadRequest, err))
+			return
+		}
+		token, key, err := h.APIKeys.Create(r.Context(), req.Name, req.Roles)
+		if err != nil {
+			h.HandleError(w, err)
+			return
+		}
+		w.Header().Set("Content-Type", typeJSON)
+		w.WriteHeader(kivik.StatusCreated)
+		h.HandleError(w, json.NewEncoder(w).Encode(map[string]interface{}{
+			"ok":    true,
+			"token": token,
+			"key":   key,
+		}))
+	}
+}
+
+// DeleteAPIKey handles DELETE /_api_keys/{key}
+func (h *Handler) DeleteAPIKey() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if err := h.apiKeysAdmin(r); err != nil {
+			h.HandleError(w, err)
+			return
+		}
+		if err := h.APIKeys.Revoke(r.Context(), chi.URLParam(r, "key")); err != nil {
+			h.HandleError(w, err)
+			return
+		}
+		w.Header().Set("Content-Type", typeJSON)
+		h.HandleError(w, json.NewEncoder(w).Encode(map[string]interface{}{
+			"ok": true,
+		}))
+	}
+}
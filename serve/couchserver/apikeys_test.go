@@ -0,0 +1,118 @@
+package couchserver
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/pressly/chi"
+
+	"github.com/flimzy/diff"
+	"github.com/flimzy/kivik/auth"
+	"github.com/flimzy/kivik/auth/apikey"
+	"github.com/flimzy/kivik/authdb"
+)
+
+type sessionKey struct{}
+
+func withSession(r *http.Request, user *authdb.UserContext) *http.Request {
+	session := &auth.Session{User: user}
+	return r.WithContext(context.WithValue(r.Context(), sessionKey{}, &session))
+}
+
+func TestAPIKeysAccess(t *testing.T) {
+	tests := []struct {
+		name   string
+		store  apikey.Store
+		user   *authdb.UserContext
+		status int
+	}{
+		{
+			name:   "NoUser",
+			store:  apikey.NewMemoryStore(),
+			status: http.StatusUnauthorized,
+		},
+		{
+			name:   "NotAdmin",
+			store:  apikey.NewMemoryStore(),
+			user:   &authdb.UserContext{Name: "bob"},
+			status: http.StatusForbidden,
+		},
+		{
+			name:   "NoStore",
+			user:   &authdb.UserContext{Name: "admin", Roles: []string{"_admin"}},
+			status: http.StatusNotImplemented,
+		},
+		{
+			name:   "Admin",
+			store:  apikey.NewMemoryStore(),
+			user:   &authdb.UserContext{Name: "admin", Roles: []string{"_admin"}},
+			status: http.StatusOK,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			h := &Handler{APIKeys: test.store, SessionKey: sessionKey{}}
+			w := httptest.NewRecorder()
+			req := withSession(httptest.NewRequest("GET", "/_api_keys", nil), test.user)
+			h.GetAPIKeys()(w, req)
+			if w.Code != test.status {
+				t.Errorf("Unexpected status: %d", w.Code)
+			}
+		})
+	}
+}
+
+func TestAPIKeysLifecycle(t *testing.T) {
+	store := apikey.NewMemoryStore()
+	h := &Handler{APIKeys: store, SessionKey: sessionKey{}}
+	admin := &authdb.UserContext{Name: "admin", Roles: []string{"_admin"}}
+	router := chi.NewRouter()
+	router.Mount("/", h.Main())
+
+	w := httptest.NewRecorder()
+	body := strings.NewReader(`{"name":"bob","roles":["foo"]}`)
+	router.ServeHTTP(w, withSession(httptest.NewRequest("POST", "/_api_keys", body), admin))
+	if w.Code != http.StatusCreated {
+		t.Fatalf("Unexpected status: %d", w.Code)
+	}
+	var created struct {
+		Token string      `json:"token"`
+		Key   *apikey.Key `json:"key"`
+	}
+	if err := json.NewDecoder(w.Body).Decode(&created); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := store.Lookup(context.Background(), created.Token); err != nil {
+		t.Errorf("Created token not found: %s", err)
+	}
+
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, withSession(httptest.NewRequest("GET", "/_api_keys", nil), admin))
+	expected := []map[string]interface{}{
+		{
+			"id":      created.Key.ID,
+			"name":    "bob",
+			"roles":   []string{"foo"},
+			"created": created.Key.Created,
+		},
+	}
+	if d := diff.AsJSON(expected, w.Body); d != "" {
+		t.Error(d)
+	}
+
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, withSession(httptest.NewRequest("DELETE", "/_api_keys/"+created.Key.ID, nil), admin))
+	if d := diff.AsJSON(map[string]bool{"ok": true}, w.Body); d != "" {
+		t.Error(d)
+	}
+
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, withSession(httptest.NewRequest("DELETE", "/_api_keys/"+created.Key.ID, nil), admin))
+	if w.Code != http.StatusNotFound {
+		t.Errorf("Unexpected status for second delete: %d", w.Code)
+	}
+}
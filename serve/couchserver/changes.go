@@ -0,0 +1,265 @@
+package couchserver
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/flimzy/kivik"
+	"github.com/flimzy/kivik/errors"
+	"github.com/flimzy/kivik/filter"
+)
+
+type changeRev struct {
+	Rev string `json:"rev"`
+}
+
+type changeResult struct {
+	Seq     kivik.SequenceID `json:"seq"`
+	ID      string           `json:"id"`
+	Changes []changeRev      `json:"changes"`
+	Deleted bool             `json:"deleted,omitempty"`
+	Doc     json.RawMessage  `json:"doc,omitempty"`
+}
+
+// changesOptions returns the options of a changes request, read from the
+// query string and, for POST requests, the JSON body.
+func changesOptions(r *http.Request) (kivik.Options, error) {
+	opts := kivik.Options{}
+	for key, value := range firstValues(r.URL.Query()) {
+		opts[key] = value
+	}
+	if r.Method == http.MethodPost && r.ContentLength != 0 {
+		var body map[string]interface{}
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+			return nil, errors.WrapStatus(kivik.StatusBadRequest, err)
+		}
+		for key, value := range body {
+			opts[key] = value
+		}
+	}
+	return opts, nil
+}
+
+// Changes handles GET and POST /{db}/_changes. The normal and eventsource
+// feeds are supported. Filters are applied by the server, with the filter
+// package, so that registered Go filter functions may be used with any driver.
+func (h *Handler) Changes() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		h.HandleError(w, h.changes(w, r))
+	}
+}
+
+// changesRequest is a parsed changes request.
+type changesRequest struct {
+	filter      *filter.Filter
+	includeDocs bool
+	limit       int
+	// driverOpts are the options passed to the driver.
+	driverOpts kivik.Options
+}
+
+func newChangesRequest(opts kivik.Options) (*changesRequest, error) {
+	f, err := filter.New(opts)
+	if err != nil {
+		return nil, err
+	}
+	req := &changesRequest{
+		filter:      f,
+		includeDocs: opts["include_docs"] == "true" || opts["include_docs"] == true,
+		driverOpts:  kivik.Options{},
+	}
+	if l, ok := opts["limit"].(string); ok {
+		if req.limit, err = strconv.Atoi(l); err != nil {
+			return nil, errors.WrapStatus(kivik.StatusBadRequest, err)
+		}
+	}
+	for key, value := range opts {
+		if !filter.IsOption(key) && key != "limit" {
+			req.driverOpts[key] = value
+		}
+	}
+	if f != nil {
+		req.driverOpts["include_docs"] = true
+	} else if req.limit > 0 {
+		req.driverOpts["limit"] = opts["limit"]
+	}
+	return req, nil
+}
+
+// result returns the current change of changes, or nil if it does not match
+// the filter.
+func (req *changesRequest) result(changes *kivik.Changes) (*changeResult, error) {
+	result := &changeResult{
+		Seq:     changes.Seq(),
+		ID:      changes.ID(),
+		Deleted: changes.Deleted(),
+	}
+	for _, rev := range changes.Changes() {
+		result.Changes = append(result.Changes, changeRev{Rev: rev})
+	}
+	if req.filter != nil || req.includeDocs {
+		if err := changes.ScanDoc(&result.Doc); err != nil {
+			return nil, err
+		}
+	}
+	if req.filter != nil {
+		var doc map[string]interface{}
+		if err := json.Unmarshal(result.Doc, &doc); err != nil {
+			return nil, errors.WrapStatus(kivik.StatusInternalServerError, err)
+		}
+		if !req.filter.Match(result.ID, doc) {
+			return nil, nil
+		}
+		if !req.includeDocs {
+			result.Doc = nil
+		}
+	}
+	return result, nil
+}
+
+func (h *Handler) changes(w http.ResponseWriter, r *http.Request) error {
+	opts, err := changesOptions(r)
+	if err != nil {
+		return err
+	}
+	switch feed, _ := opts["feed"].(string); feed {
+	case "", "normal":
+	case "eventsource":
+		return h.eventSource(w, r, opts)
+	default:
+		return errors.Statusf(kivik.StatusNotImplemented, "%s feed not supported", feed)
+	}
+	req, err := newChangesRequest(opts)
+	if err != nil {
+		return err
+	}
+	db, err := h.Client.DB(r.Context(), DB(r))
+	if err != nil {
+		return err
+	}
+	changes, err := db.Changes(r.Context(), req.driverOpts)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = changes.Close() }()
+	results := []changeResult{}
+	var lastSeq kivik.SequenceID
+	for (req.limit <= 0 || len(results) < req.limit) && changes.Next() {
+		lastSeq = changes.Seq()
+		result, err := req.result(changes)
+		if err != nil {
+			return err
+		}
+		if result != nil {
+			results = append(results, *result)
+		}
+	}
+	if err = changes.Err(); err != nil {
+		return err
+	}
+	w.Header().Set("Content-Type", typeJSON)
+	return json.NewEncoder(w).Encode(map[string]interface{}{
+		"results":  results,
+		"last_seq": lastSeq,
+		"pending":  0,
+	})
+}
+
+// defaultChangesPollInterval is used if ChangesPollInterval is unset.
+const defaultChangesPollInterval = time.Second
+
+func (h *Handler) changesPollInterval() time.Duration {
+	if h.ChangesPollInterval > 0 {
+		return h.ChangesPollInterval
+	}
+	return defaultChangesPollInterval
+}
+
+// changesFeed is a changes feed opened for streaming.
+type changesFeed struct {
+	db      *kivik.DB
+	req     *changesRequest
+	changes *kivik.Changes
+	// poll is true if the driver does not support continuous feeds, so the
+	// feed is a normal feed, repeated every ChangesPollInterval.
+	poll bool
+}
+
+// openChangesFeed opens a continuous changes feed of the request's database,
+// or a normal feed, to be polled, if the driver does not support continuous
+// feeds.
+func (h *Handler) openChangesFeed(ctx context.Context, r *http.Request, opts kivik.Options) (*changesFeed, error) {
+	req, err := newChangesRequest(opts)
+	if err != nil {
+		return nil, err
+	}
+	db, err := h.Client.DB(ctx, DB(r))
+	if err != nil {
+		return nil, err
+	}
+	req.driverOpts["feed"] = "continuous"
+	changes, err := db.Changes(ctx, req.driverOpts)
+	poll := kivik.StatusCode(err) == kivik.StatusNotImplemented
+	if poll {
+		req.driverOpts["feed"] = "normal"
+		changes, err = db.Changes(ctx, req.driverOpts)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &changesFeed{db: db, req: req, changes: changes, poll: poll}, nil
+}
+
+// lastSeq returns the sequence of the last change read from the feed. It
+// must not be called while streamChanges is running.
+func (f *changesFeed) lastSeq() kivik.SequenceID {
+	seq, _ := f.req.driverOpts["since"].(string)
+	return kivik.SequenceID(seq)
+}
+
+// streamChanges sends the changes of feed which match its request to
+// results, until ctx is cancelled, or the feed ends. Polled feeds are
+// repeated from the last sequence received every ChangesPollInterval.
+func (h *Handler) streamChanges(ctx context.Context, feed *changesFeed, results chan<- *changeResult) error {
+	changes := feed.changes
+	for {
+		for changes.Next() {
+			feed.req.driverOpts["since"] = string(changes.Seq())
+			result, err := feed.req.result(changes)
+			if err != nil {
+				_ = changes.Close()
+				return err
+			}
+			if result == nil {
+				continue
+			}
+			select {
+			case results <- result:
+			case <-ctx.Done():
+				_ = changes.Close()
+				return nil
+			}
+		}
+		if err := changes.Err(); err != nil {
+			return err
+		}
+		if err := changes.Close(); err != nil {
+			return err
+		}
+		if !feed.poll {
+			return nil
+		}
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-time.After(h.changesPollInterval()):
+		}
+		var err error
+		if changes, err = feed.db.Changes(ctx, feed.req.driverOpts); err != nil {
+			return err
+		}
+	}
+}
@@ -0,0 +1,223 @@
+package couchserver
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/flimzy/diff"
+	"github.com/flimzy/kivik"
+	"github.com/flimzy/kivik/filter"
+)
+
+func init() {
+	filter.Register("serve/even", func(doc map[string]interface{}, _ map[string]interface{}) bool {
+		n, _ := doc["n"].(float64)
+		return int(n)%2 == 0
+	})
+}
+
+func TestChanges(t *testing.T) {
+	ctx := context.Background()
+	client, err := kivik.New(ctx, "memory", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = client.CreateDB(ctx, "changes"); err != nil {
+		t.Fatal(err)
+	}
+	db, err := client.DB(ctx, "changes")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, id := range []string{"a", "b", "c", "d"} {
+		if _, err = db.Put(ctx, id, map[string]int{"n": i}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	h := &Handler{Client: client}
+	type result struct {
+		ID  string `json:"id"`
+		Seq string `json:"seq"`
+	}
+	tests := []struct {
+		name     string
+		method   string
+		path     string
+		body     string
+		expected []result
+		lastSeq  string
+	}{
+		{
+			name:     "GoFilter",
+			method:   "GET",
+			path:     "/changes/_changes?filter=serve/even",
+			expected: []result{{ID: "a", Seq: "1"}, {ID: "c", Seq: "3"}},
+			lastSeq:  "4",
+		},
+		{
+			name:     "GoFilterLimit",
+			method:   "GET",
+			path:     "/changes/_changes?filter=serve/even&limit=1",
+			expected: []result{{ID: "a", Seq: "1"}},
+			lastSeq:  "1",
+		},
+		{
+			name:     "DocIDs",
+			method:   "POST",
+			path:     "/changes/_changes?filter=_doc_ids",
+			body:     `{"doc_ids":["b","d"]}`,
+			expected: []result{{ID: "b", Seq: "2"}, {ID: "d", Seq: "4"}},
+			lastSeq:  "4",
+		},
+		{
+			name:     "Selector",
+			method:   "POST",
+			path:     "/changes/_changes?filter=_selector",
+			body:     `{"selector":{"n":{"$gte":3}}}`,
+			expected: []result{{ID: "d", Seq: "4"}},
+			lastSeq:  "4",
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			req := httptest.NewRequest(test.method, test.path, strings.NewReader(test.body))
+			h.Main().ServeHTTP(w, req)
+			resp := w.Result()
+			defer resp.Body.Close()
+			var body struct {
+				Results []result `json:"results"`
+				LastSeq string   `json:"last_seq"`
+			}
+			if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+				t.Fatal(err)
+			}
+			if d := diff.Interface(test.expected, body.Results); d != "" {
+				t.Error(d)
+			}
+			if body.LastSeq != test.lastSeq {
+				t.Errorf("Unexpected last_seq: %s", body.LastSeq)
+			}
+		})
+	}
+}
+
+func TestEventSource(t *testing.T) {
+	ctx := context.Background()
+	client, err := kivik.New(ctx, "memory", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = client.CreateDB(ctx, "events"); err != nil {
+		t.Fatal(err)
+	}
+	db, err := client.DB(ctx, "events")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, id := range []string{"a", "b", "c", "d"} {
+		if _, err = db.Put(ctx, id, map[string]int{"n": i}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	h := &Handler{Client: client, ChangesPollInterval: 10 * time.Millisecond}
+	server := httptest.NewServer(h.Main())
+	defer server.Close()
+
+	// events reads the frames of an eventsource feed, as id: data pairs, or
+	// the event name for named events, until the feed ends or stop returns
+	// true.
+	events := func(t *testing.T, query, lastEventID string, stop func([]string) bool) []string {
+		req, _ := http.NewRequest("GET", server.URL+"/events/_changes?feed=eventsource&"+query, nil)
+		if lastEventID != "" {
+			req.Header.Set("Last-Event-ID", lastEventID)
+		}
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer resp.Body.Close()
+		if ct := resp.Header.Get("Content-Type"); ct != "text/event-stream" {
+			t.Fatalf("Unexpected Content-Type: %s", ct)
+		}
+		var result []string
+		var frame struct{ id, data, event string }
+		scanner := bufio.NewScanner(resp.Body)
+		for scanner.Scan() {
+			line := scanner.Text()
+			switch {
+			case strings.HasPrefix(line, "id: "):
+				frame.id = strings.TrimPrefix(line, "id: ")
+			case strings.HasPrefix(line, "data: "):
+				frame.data = strings.TrimPrefix(line, "data: ")
+			case strings.HasPrefix(line, "event: "):
+				frame.event = strings.TrimPrefix(line, "event: ")
+			case line == "":
+				if frame.event != "" {
+					result = append(result, frame.event)
+				} else {
+					var change struct {
+						ID string `json:"id"`
+					}
+					if err := json.Unmarshal([]byte(frame.data), &change); err != nil {
+						t.Fatal(err)
+					}
+					result = append(result, frame.id+": "+change.ID)
+				}
+				frame.id, frame.data, frame.event = "", "", ""
+				if stop != nil && stop(result) {
+					return result
+				}
+			}
+		}
+		return result
+	}
+
+	t.Run("Limit", func(t *testing.T) {
+		result := events(t, "limit=2", "", nil)
+		if d := diff.Interface([]string{"1: a", "2: b"}, result); d != "" {
+			t.Error(d)
+		}
+	})
+	t.Run("LastEventID", func(t *testing.T) {
+		result := events(t, "since=0&limit=2", "2", nil)
+		if d := diff.Interface([]string{"3: c", "4: d"}, result); d != "" {
+			t.Error(d)
+		}
+	})
+	t.Run("Filter", func(t *testing.T) {
+		result := events(t, "filter=serve/even&limit=2", "", nil)
+		if d := diff.Interface([]string{"1: a", "3: c"}, result); d != "" {
+			t.Error(d)
+		}
+	})
+	t.Run("Heartbeat", func(t *testing.T) {
+		result := events(t, "heartbeat=10", "4", func(result []string) bool { return len(result) > 0 })
+		if d := diff.Interface([]string{"heartbeat"}, result); d != "" {
+			t.Error(d)
+		}
+	})
+	t.Run("Poll", func(t *testing.T) {
+		go func() {
+			time.Sleep(50 * time.Millisecond)
+			_, _ = db.Put(ctx, "e", map[string]int{"n": 4})
+		}()
+		result := events(t, "limit=1", "4", nil)
+		if d := diff.Interface([]string{"5: e"}, result); d != "" {
+			t.Error(d)
+		}
+	})
+	t.Run("InvalidHeartbeat", func(t *testing.T) {
+		w := httptest.NewRecorder()
+		h.Main().ServeHTTP(w, httptest.NewRequest("GET", "/events/_changes?feed=eventsource&heartbeat=x", nil))
+		if w.Code != http.StatusBadRequest {
+			t.Errorf("Expected status %d, got %d", http.StatusBadRequest, w.Code)
+		}
+	})
+}
@@ -1,12 +1,16 @@
 package couchserver
 
 import (
-	"log"
 	"net/http"
+	"strings"
+	"time"
 
 	"github.com/pressly/chi"
 
 	"github.com/flimzy/kivik"
+	"github.com/flimzy/kivik/auth/apikey"
+	"github.com/flimzy/kivik/auth/throttle"
+	"github.com/flimzy/kivik/serve/logger"
 )
 
 const (
@@ -28,11 +32,60 @@ type Handler struct {
 	// VendorVersion is the vendor version to report. If unset, defaults to the
 	// kivik.VendorVersion constant.
 	VendorVersion string
-	Logger        *log.Logger
+	// UUID is the server instance UUID to report. Replication clients, such
+	// as PouchDB, use it to identify the server in the IDs of replication
+	// checkpoints, so it should be stable across restarts. If unset, no UUID
+	// is reported.
+	UUID string
+	// Features are the optional CouchDB features to report. They are always
+	// reported as an array, which may be empty, as CouchDB 2.x clients
+	// expect.
+	Features []string
+	// ChangesPollInterval is the interval at which eventsource changes feeds
+	// poll the database, if the driver does not support continuous feeds. If
+	// unset, defaults to one second.
+	ChangesPollInterval time.Duration
+	// Logger receives log messages, such as failures to send responses. If
+	// unset, messages are discarded.
+	Logger logger.Logger
 	// Favicon is the path to a favicon.ico to serve.
 	Favicon string
 	// SessionKey is a temporary solution to avoid import cycles. Soon I will move the key to another package.
 	SessionKey interface{}
+	// APIKeys is the API key store managed by the /_api_keys endpoints. If
+	// unset, these endpoints return 501 Not Implemented.
+	APIKeys apikey.Store
+	// Throttle is the login throttle whose counters are reported to server
+	// admins by /_stats.
+	Throttle *throttle.Throttle
+	// Metrics, if set, serves the server's statistics in the Prometheus text
+	// format at /_node/_local/_prometheus.
+	Metrics http.Handler
+	// Designs holds the Go show, list and update functions, by design
+	// document ID, such as "_design/foo", for design documents of that ID in
+	// any database.
+	Designs map[string]*Design
+	// JSEngine, if set, executes the JavaScript show, list and update
+	// functions of design documents, for which there is no function in
+	// Designs.
+	JSEngine JSEngine
+	// Upstream, if set, serves the requests which the handler does not, such
+	// as a *proxy.Proxy which forwards them to a CouchDB server. The handler
+	// then acts as a reverse proxy, which intercepts only the endpoints it
+	// implements, and the databases in LocalDBs.
+	Upstream http.Handler
+	// LocalDBs, if Upstream is set, are the names of the databases served
+	// by Client. Requests for all other databases are passed to Upstream. If
+	// nil, all databases are served by Client, and only requests for
+	// endpoints which the handler does not implement are passed to Upstream.
+	LocalDBs []string
+}
+
+func (h *Handler) logger() logger.Logger {
+	if h.Logger == nil {
+		return logger.Discard
+	}
+	return h.Logger
 }
 
 // CompatVersion is the default CouchDB compatibility provided by this package.
@@ -57,23 +110,93 @@ func (h *Handler) vendor() (compatVer, vend, ver string) {
 	return compatVer, vend, ver
 }
 
-// Main returns an http.Handler to handle all CouchDB endpoints.
+// Main returns an http.Handler to handle all CouchDB endpoints. OPTIONS
+// requests are answered for every route, with an Allow header listing its
+// methods, and requests with another method receive 405 Method Not Allowed,
+// unless Upstream is set.
 func (h *Handler) Main() http.Handler {
 	r := chi.NewRouter()
+	if h.Upstream != nil {
+		r.Use(h.forwardDBs)
+		r.NotFound(h.Upstream.ServeHTTP)
+		r.MethodNotAllowed(h.Upstream.ServeHTTP)
+	}
 	r.Get("/", h.GetRoot())
 	r.Get("/favicon.ico", h.GetFavicon())
 	r.Get("/_all_dbs", h.GetAllDBs())
 	r.Put("/:db", h.PutDB())
 	r.Head("/:db", h.HeadDB())
+	r.Delete("/:db", h.DeleteDB())
 	r.Post("/:db/_ensure_full_commit", h.Flush())
+	r.Get("/:db/_changes", h.Changes())
+	r.Get("/:db/_dump", h.GetDump())
+	r.Post("/:db/_changes", h.Changes())
+	r.Get("/:db/_changes/ws", h.ChangesWebSocket())
+	r.Get("/:db/_design/:ddoc/_show/:func", h.Show())
+	r.Post("/:db/_design/:ddoc/_show/:func", h.Show())
+	r.Get("/:db/_design/:ddoc/_show/:func/:docid", h.Show())
+	r.Post("/:db/_design/:ddoc/_show/:func/:docid", h.Show())
+	r.Get("/:db/_design/:ddoc/_list/:func/:view", h.List())
+	r.Post("/:db/_design/:ddoc/_list/:func/:view", h.List())
+	r.Get("/:db/_design/:ddoc/_list/:func/:viewddoc/:view", h.List())
+	r.Post("/:db/_design/:ddoc/_list/:func/:viewddoc/:view", h.List())
+	r.Post("/:db/_design/:ddoc/_update/:func", h.Update())
+	r.Put("/:db/_design/:ddoc/_update/:func/:docid", h.Update())
+	r.Handle("/:db/_design/:ddoc/_rewrite", h.Rewrite(r))
+	r.Handle("/:db/_design/:ddoc/_rewrite/*", h.Rewrite(r))
+	for _, path := range []string{"/:db/:docid", "/:db/_design/:ddoc", "/:db/_local/:localid"} {
+		r.Get(path, h.GetDoc())
+		r.Head(path, h.GetDoc())
+		r.Put(path, h.PutDoc())
+		r.Delete(path, h.DeleteDoc())
+	}
+	for _, path := range []string{"/:db/:docid/*", "/:db/_design/:ddoc/*"} {
+		r.Get(path, h.GetAttachment())
+		r.Head(path, h.GetAttachment())
+		r.Put(path, h.PutAttachment())
+		r.Delete(path, h.DeleteAttachment())
+	}
 	r.Get("/_session", h.GetSession())
+	r.Get("/_stats", h.GetStats())
+	r.Get("/_node/_local/_prometheus", h.GetPrometheus())
+	r.Get("/_api_keys", h.GetAPIKeys())
+	r.Post("/_api_keys", h.PostAPIKey())
+	r.Delete("/_api_keys/:key", h.DeleteAPIKey())
+	allowed := allowedMethods(r)
+	for pattern, methods := range allowed {
+		r.Options(pattern, h.Options(methods))
+	}
+	if h.Upstream == nil {
+		r.MethodNotAllowed(h.methodNotAllowed(allowed))
+	}
 	return r
 }
 
+// forwardDBs passes requests for databases not in LocalDBs to Upstream.
+func (h *Handler) forwardDBs(next http.Handler) http.Handler {
+	if h.LocalDBs == nil {
+		return next
+	}
+	local := make(map[string]bool, len(h.LocalDBs))
+	for _, db := range h.LocalDBs {
+		local[db] = true
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		db := strings.SplitN(strings.TrimPrefix(r.URL.Path, "/"), "/", 2)[0]
+		if db != "" && !strings.HasPrefix(db, "_") && !local[db] {
+			h.Upstream.ServeHTTP(w, r)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
 type serverInfo struct {
-	CouchDB string     `json:"couchdb"`
-	Version string     `json:"version"`
-	Vendor  vendorInfo `json:"vendor"`
+	CouchDB  string     `json:"couchdb"`
+	Version  string     `json:"version"`
+	UUID     string     `json:"uuid,omitempty"`
+	Features []string   `json:"features"`
+	Vendor   vendorInfo `json:"vendor"`
 }
 
 type vendorInfo struct {
@@ -1,6 +1,9 @@
 package couchserver
 
 import (
+	"context"
+	"net/http"
+	"net/http/httptest"
 	"testing"
 
 	"github.com/flimzy/kivik"
@@ -39,3 +42,45 @@ func TestVendor(t *testing.T) {
 		}
 	})
 }
+
+func TestUpstream(t *testing.T) {
+	upstream := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("X-Upstream", "true")
+		w.WriteHeader(http.StatusTeapot)
+	})
+	client, err := kivik.New(context.Background(), "memory", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name     string
+		localDBs []string
+		method   string
+		path     string
+		upstream bool
+	}{
+		{name: "Root", method: "GET", path: "/"},
+		{name: "Unimplemented", method: "GET", path: "/_active_tasks", upstream: true},
+		{name: "MethodNotAllowed", method: "DELETE", path: "/_session", upstream: true},
+		{name: "AllDBsLocal", method: "HEAD", path: "/foo"},
+		{name: "LocalDB", localDBs: []string{"foo"}, method: "HEAD", path: "/foo"},
+		{name: "RemoteDB", localDBs: []string{"foo"}, method: "HEAD", path: "/bar", upstream: true},
+		{name: "PlusLocalDB", localDBs: []string{"a+b"}, method: "HEAD", path: "/a+b"},
+		{name: "EscapedRemoteDB", localDBs: []string{"foo"}, method: "HEAD", path: "/a%2Fb/doc", upstream: true},
+		{name: "SystemEndpoint", localDBs: []string{"foo"}, method: "GET", path: "/"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			h := &Handler{
+				Client:   client,
+				Upstream: upstream,
+				LocalDBs: test.localDBs,
+			}
+			w := httptest.NewRecorder()
+			h.Main().ServeHTTP(w, httptest.NewRequest(test.method, test.path, nil))
+			if forwarded := w.Header().Get("X-Upstream") == "true"; forwarded != test.upstream {
+				t.Errorf("Expected forwarding to be %t, got %t (status %d)", test.upstream, forwarded, w.Code)
+			}
+		})
+	}
+}
@@ -3,6 +3,9 @@ package couchserver
 import (
 	"encoding/json"
 	"net/http"
+
+	"github.com/flimzy/kivik"
+	"github.com/flimzy/kivik/errors"
 )
 
 // PutDB handles PUT /{db}
@@ -18,6 +21,25 @@ func (h *Handler) PutDB() http.HandlerFunc {
 	}
 }
 
+// DeleteDB handles DELETE /{db}, for server admins, and for the database's
+// admins, such as the user who created it, when database quotas are enabled.
+func (h *Handler) DeleteDB() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if err := h.requireDBAdmin(r, DB(r)); err != nil {
+			h.HandleError(w, err)
+			return
+		}
+		if err := h.Client.DestroyDB(r.Context(), DB(r)); err != nil {
+			h.HandleError(w, err)
+			return
+		}
+		w.Header().Set("Content-Type", typeJSON)
+		h.HandleError(w, json.NewEncoder(w).Encode(map[string]interface{}{
+			"ok": true,
+		}))
+	}
+}
+
 // HeadDB handles HEAD /{db}
 func (h *Handler) HeadDB() http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
@@ -53,3 +75,34 @@ func (h *Handler) Flush() http.HandlerFunc {
 		}))
 	}
 }
+
+// requireDBAdmin returns an error unless the request's session belongs to a
+// server admin, or to an admin of the database dbName, by name or role.
+func (h *Handler) requireDBAdmin(r *http.Request, dbName string) error {
+	user := h.sessionUser(r)
+	if user == nil {
+		return errors.Status(kivik.StatusUnauthorized, "You are not authorized to access this db.")
+	}
+	if hasRole(user, "_admin") {
+		return nil
+	}
+	db, err := h.Client.DB(r.Context(), dbName)
+	if err != nil {
+		return err
+	}
+	sec, err := db.Security(r.Context())
+	if err != nil {
+		return err
+	}
+	for _, name := range sec.Admins.Names {
+		if name == user.Name {
+			return nil
+		}
+	}
+	for _, role := range sec.Admins.Roles {
+		if hasRole(user, role) {
+			return nil
+		}
+	}
+	return errors.Status(kivik.StatusForbidden, "You are not a db or server admin.")
+}
@@ -8,6 +8,7 @@ import (
 
 	"github.com/flimzy/diff"
 	"github.com/flimzy/kivik"
+	"github.com/flimzy/kivik/authdb"
 )
 
 func TestPutDB(t *testing.T) {
@@ -66,3 +67,43 @@ func TestHeadDB(t *testing.T) {
 func TestFlush(t *testing.T) {
 	// TODO
 }
+
+func TestDeleteDB(t *testing.T) {
+	client, err := kivik.New(context.Background(), "memory", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, dbName := range []string{"foo", "owned"} {
+		if err := client.CreateDB(context.Background(), dbName); err != nil {
+			t.Fatal(err)
+		}
+	}
+	owned, err := client.DB(context.Background(), "owned")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := owned.SetSecurity(context.Background(), &kivik.Security{Admins: kivik.Members{Names: []string{"bob"}}}); err != nil {
+		t.Fatal(err)
+	}
+	h := &Handler{Client: client, SessionKey: sessionKey{}}
+	admin := &authdb.UserContext{Name: "admin", Roles: []string{"_admin"}}
+	tests := []struct {
+		name   string
+		user   *authdb.UserContext
+		path   string
+		status int
+	}{
+		{name: "NoUser", path: "/foo", status: http.StatusUnauthorized},
+		{name: "NotAdmin", user: &authdb.UserContext{Name: "bob"}, path: "/foo", status: http.StatusForbidden},
+		{name: "DBAdmin", user: &authdb.UserContext{Name: "bob"}, path: "/owned", status: http.StatusOK},
+		{name: "Admin", user: admin, path: "/foo", status: http.StatusOK},
+		{name: "Missing", user: admin, path: "/foo", status: http.StatusNotFound},
+	}
+	for _, test := range tests {
+		w := httptest.NewRecorder()
+		h.Main().ServeHTTP(w, withSession(httptest.NewRequest("DELETE", test.path, nil), test.user))
+		if w.Code != test.status {
+			t.Errorf("%s: unexpected status %d: %s", test.name, w.Code, w.Body.String())
+		}
+	}
+}
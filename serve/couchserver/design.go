@@ -0,0 +1,335 @@
+package couchserver
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"strings"
+
+	"github.com/pressly/chi"
+
+	"github.com/flimzy/kivik"
+	"github.com/flimzy/kivik/auth"
+	"github.com/flimzy/kivik/authdb"
+	"github.com/flimzy/kivik/errors"
+)
+
+// Request is the request object passed to show, list and update functions.
+//
+// See http://docs.couchdb.org/en/2.0.0/json-structure.html#request-object
+type Request struct {
+	Method  string              `json:"method"`
+	Path    []string            `json:"path"`
+	Query   map[string]string   `json:"query"`
+	Headers map[string]string   `json:"headers"`
+	Body    string              `json:"body"`
+	Form    map[string]string   `json:"form"`
+	ID      string              `json:"id,omitempty"`
+	UserCtx *authdb.UserContext `json:"userCtx"`
+}
+
+// Response is the response returned by show and update functions.
+//
+// See http://docs.couchdb.org/en/2.0.0/json-structure.html#response-object
+type Response struct {
+	// Code is the HTTP status code. If zero, 200 is used, or 201 when an
+	// update function saves a document.
+	Code    int
+	Headers map[string]string
+	// Body is sent as is, with the content type text/html, unless set in
+	// Headers.
+	Body string
+	// JSON, if not nil, is sent instead of Body, encoded as JSON.
+	JSON interface{}
+}
+
+// ShowFunc is a show function. doc is nil if no document ID was requested, or
+// the document does not exist.
+type ShowFunc func(doc map[string]interface{}, req *Request) (*Response, error)
+
+// ListFunc is a list function, which writes the response for the rows of a
+// view to w.
+type ListFunc func(w http.ResponseWriter, rows *kivik.Rows, req *Request) error
+
+// UpdateFunc is an update function. doc is nil if no document ID was
+// requested, or the document does not exist. If newDoc is not nil, it is
+// saved.
+type UpdateFunc func(doc map[string]interface{}, req *Request) (newDoc map[string]interface{}, resp *Response, err error)
+
+// Design holds the Go implementations of the show, list and update functions
+// of a design document, by function name.
+type Design struct {
+	Shows   map[string]ShowFunc
+	Lists   map[string]ListFunc
+	Updates map[string]UpdateFunc
+}
+
+// JSEngine compiles the JavaScript show, list and update functions stored in
+// design documents. It is used for functions with no Go implementation.
+type JSEngine interface {
+	CompileShow(source string) (ShowFunc, error)
+	CompileList(source string) (ListFunc, error)
+	CompileUpdate(source string) (UpdateFunc, error)
+}
+
+func designDocID(r *http.Request) string {
+	return "_design/" + chi.URLParam(r, "ddoc")
+}
+
+// designSource returns the source of the named function of the requested
+// design document, for the JSEngine.
+func (h *Handler) designSource(r *http.Request, db *kivik.DB, field, name string) (string, error) {
+	if h.JSEngine == nil {
+		return "", errors.Statusf(kivik.StatusNotFound, "missing %s function %s", field, name)
+	}
+	row, err := db.Get(r.Context(), designDocID(r))
+	if err != nil {
+		return "", err
+	}
+	var ddoc map[string]interface{}
+	if err = row.ScanDoc(&ddoc); err != nil {
+		return "", err
+	}
+	funcs, _ := ddoc[field].(map[string]interface{})
+	source, ok := funcs[name].(string)
+	if !ok {
+		return "", errors.Statusf(kivik.StatusNotFound, "missing %s function %s", field, name)
+	}
+	return source, nil
+}
+
+func (h *Handler) showFunc(r *http.Request, db *kivik.DB, name string) (ShowFunc, error) {
+	if design, ok := h.Designs[designDocID(r)]; ok {
+		if fn, ok := design.Shows[name]; ok {
+			return fn, nil
+		}
+	}
+	source, err := h.designSource(r, db, "shows", name)
+	if err != nil {
+		return nil, err
+	}
+	return h.JSEngine.CompileShow(source)
+}
+
+func (h *Handler) listFunc(r *http.Request, db *kivik.DB, name string) (ListFunc, error) {
+	if design, ok := h.Designs[designDocID(r)]; ok {
+		if fn, ok := design.Lists[name]; ok {
+			return fn, nil
+		}
+	}
+	source, err := h.designSource(r, db, "lists", name)
+	if err != nil {
+		return nil, err
+	}
+	return h.JSEngine.CompileList(source)
+}
+
+func (h *Handler) updateFunc(r *http.Request, db *kivik.DB, name string) (UpdateFunc, error) {
+	if design, ok := h.Designs[designDocID(r)]; ok {
+		if fn, ok := design.Updates[name]; ok {
+			return fn, nil
+		}
+	}
+	source, err := h.designSource(r, db, "updates", name)
+	if err != nil {
+		return nil, err
+	}
+	return h.JSEngine.CompileUpdate(source)
+}
+
+// newRequest builds the request object for a design document function.
+func (h *Handler) newRequest(r *http.Request, docID string) (*Request, error) {
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		return nil, errors.WrapStatus(kivik.StatusBadRequest, err)
+	}
+	req := &Request{
+		Method:  r.Method,
+		Path:    strings.Split(strings.Trim(r.URL.Path, "/"), "/"),
+		Query:   firstValues(r.URL.Query()),
+		Headers: firstValues(r.Header),
+		Body:    string(body),
+		Form:    map[string]string{},
+		ID:      docID,
+	}
+	if strings.HasPrefix(r.Header.Get("Content-Type"), typeForm) {
+		r.Body = ioutil.NopCloser(strings.NewReader(req.Body))
+		if err := r.ParseForm(); err != nil {
+			return nil, errors.WrapStatus(kivik.StatusBadRequest, err)
+		}
+		req.Form = firstValues(r.PostForm)
+	}
+	if s, ok := r.Context().Value(h.SessionKey).(**auth.Session); ok && *s != nil {
+		req.UserCtx = (*s).User
+	}
+	return req, nil
+}
+
+func firstValues(values map[string][]string) map[string]string {
+	result := make(map[string]string, len(values))
+	for key, v := range values {
+		if len(v) > 0 {
+			result[key] = v[0]
+		}
+	}
+	return result
+}
+
+// getDoc fetches the requested document, returning nil if it does not exist.
+func getDoc(r *http.Request, db *kivik.DB, docID string) (map[string]interface{}, error) {
+	if docID == "" {
+		return nil, nil
+	}
+	row, err := db.Get(r.Context(), docID)
+	if kivik.StatusCode(err) == kivik.StatusNotFound {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var doc map[string]interface{}
+	err = row.ScanDoc(&doc)
+	return doc, err
+}
+
+func writeResponse(w http.ResponseWriter, resp *Response, code int) error {
+	if resp == nil {
+		resp = &Response{}
+	}
+	for key, value := range resp.Headers {
+		w.Header().Set(key, value)
+	}
+	if resp.Code != 0 {
+		code = resp.Code
+	}
+	if resp.JSON != nil {
+		w.Header().Set("Content-Type", typeJSON)
+		w.WriteHeader(code)
+		return json.NewEncoder(w).Encode(resp.JSON)
+	}
+	if w.Header().Get("Content-Type") == "" {
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	}
+	w.WriteHeader(code)
+	_, err := w.Write([]byte(resp.Body))
+	return err
+}
+
+// Show handles GET and POST /{db}/_design/{ddoc}/_show/{func}[/{docid}]
+func (h *Handler) Show() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		h.HandleError(w, h.show(w, r))
+	}
+}
+
+func (h *Handler) show(w http.ResponseWriter, r *http.Request) error {
+	db, err := h.Client.DB(r.Context(), DB(r))
+	if err != nil {
+		return err
+	}
+	fn, err := h.showFunc(r, db, chi.URLParam(r, "func"))
+	if err != nil {
+		return err
+	}
+	docID := chi.URLParam(r, "docid")
+	doc, err := getDoc(r, db, docID)
+	if err != nil {
+		return err
+	}
+	req, err := h.newRequest(r, docID)
+	if err != nil {
+		return err
+	}
+	resp, err := fn(doc, req)
+	if err != nil {
+		return err
+	}
+	return writeResponse(w, resp, http.StatusOK)
+}
+
+// List handles GET and POST /{db}/_design/{ddoc}/_list/{func}/[{ddoc}/]{view}
+func (h *Handler) List() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		h.HandleError(w, h.list(w, r))
+	}
+}
+
+func (h *Handler) list(w http.ResponseWriter, r *http.Request) error {
+	db, err := h.Client.DB(r.Context(), DB(r))
+	if err != nil {
+		return err
+	}
+	fn, err := h.listFunc(r, db, chi.URLParam(r, "func"))
+	if err != nil {
+		return err
+	}
+	viewDDoc := chi.URLParam(r, "viewddoc")
+	if viewDDoc == "" {
+		viewDDoc = chi.URLParam(r, "ddoc")
+	}
+	req, err := h.newRequest(r, "")
+	if err != nil {
+		return err
+	}
+	opts := kivik.Options{}
+	for key, value := range req.Query {
+		opts[key] = value
+	}
+	rows, err := db.Query(r.Context(), viewDDoc, chi.URLParam(r, "view"), opts)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = rows.Close() }()
+	return fn(w, rows, req)
+}
+
+// Update handles POST /{db}/_design/{ddoc}/_update/{func} and
+// PUT /{db}/_design/{ddoc}/_update/{func}/{docid}
+func (h *Handler) Update() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		h.HandleError(w, h.update(w, r))
+	}
+}
+
+func (h *Handler) update(w http.ResponseWriter, r *http.Request) error {
+	db, err := h.Client.DB(r.Context(), DB(r))
+	if err != nil {
+		return err
+	}
+	fn, err := h.updateFunc(r, db, chi.URLParam(r, "func"))
+	if err != nil {
+		return err
+	}
+	docID := chi.URLParam(r, "docid")
+	doc, err := getDoc(r, db, docID)
+	if err != nil {
+		return err
+	}
+	req, err := h.newRequest(r, docID)
+	if err != nil {
+		return err
+	}
+	newDoc, resp, err := fn(doc, req)
+	if err != nil {
+		return err
+	}
+	if newDoc == nil {
+		return writeResponse(w, resp, http.StatusOK)
+	}
+	id, _ := newDoc["_id"].(string)
+	if id == "" {
+		id = docID
+	}
+	var rev string
+	if id == "" {
+		id, rev, err = db.CreateDoc(r.Context(), newDoc)
+	} else {
+		rev, err = db.Put(r.Context(), id, newDoc)
+	}
+	if err != nil {
+		return err
+	}
+	w.Header().Set("X-Couch-Id", id)
+	w.Header().Set("X-Couch-Update-NewRev", rev)
+	return writeResponse(w, resp, http.StatusCreated)
+}
@@ -0,0 +1,160 @@
+package couchserver
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/flimzy/kivik"
+)
+
+type testEngine struct{}
+
+var _ JSEngine = &testEngine{}
+
+func (e *testEngine) CompileShow(source string) (ShowFunc, error) {
+	return func(_ map[string]interface{}, _ *Request) (*Response, error) {
+		return &Response{Body: "compiled: " + source}, nil
+	}, nil
+}
+
+func (e *testEngine) CompileList(_ string) (ListFunc, error) {
+	return nil, fmt.Errorf("not supported")
+}
+
+func (e *testEngine) CompileUpdate(_ string) (UpdateFunc, error) {
+	return nil, fmt.Errorf("not supported")
+}
+
+func TestDesignFunctions(t *testing.T) {
+	ctx := context.Background()
+	client, err := kivik.New(ctx, "memory", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = client.CreateDB(ctx, "designs"); err != nil {
+		t.Fatal(err)
+	}
+	db, err := client.DB(ctx, "designs")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = db.Put(ctx, "bob", map[string]string{"name": "Bob"}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = db.Put(ctx, "_design/app", map[string]interface{}{
+		"shows": map[string]string{"js": "function(doc, req) {}"},
+	}); err != nil {
+		t.Fatal(err)
+	}
+	h := &Handler{
+		Client: client,
+		Designs: map[string]*Design{
+			"_design/app": {
+				Shows: map[string]ShowFunc{
+					"hello": func(doc map[string]interface{}, req *Request) (*Response, error) {
+						if doc == nil {
+							return &Response{Code: http.StatusNotFound, Body: "nobody"}, nil
+						}
+						return &Response{Body: fmt.Sprintf("Hello, %s%s", doc["name"], req.Query["punct"])}, nil
+					},
+				},
+				Updates: map[string]UpdateFunc{
+					"rename": func(doc map[string]interface{}, req *Request) (map[string]interface{}, *Response, error) {
+						if doc == nil {
+							doc = map[string]interface{}{}
+						}
+						doc["name"] = req.Form["name"]
+						return doc, &Response{JSON: map[string]string{"renamed": req.Form["name"]}}, nil
+					},
+				},
+			},
+		},
+		JSEngine: &testEngine{},
+	}
+	tests := []struct {
+		name        string
+		method      string
+		path        string
+		contentType string
+		body        string
+		status      int
+		expected    string
+	}{
+		{
+			name:     "Show",
+			method:   "GET",
+			path:     "/designs/_design/app/_show/hello/bob?punct=!",
+			status:   http.StatusOK,
+			expected: "Hello, Bob!",
+		},
+		{
+			name:     "ShowMissingDoc",
+			method:   "GET",
+			path:     "/designs/_design/app/_show/hello/alice",
+			status:   http.StatusNotFound,
+			expected: "nobody",
+		},
+		{
+			name:     "ShowJS",
+			method:   "GET",
+			path:     "/designs/_design/app/_show/js",
+			status:   http.StatusOK,
+			expected: "compiled: function(doc, req) {}",
+		},
+		{
+			name:   "ShowMissingFunc",
+			method: "GET",
+			path:   "/designs/_design/app/_show/missing",
+			status: http.StatusNotFound,
+		},
+		{
+			name:        "Update",
+			method:      "PUT",
+			path:        "/designs/_design/app/_update/rename/carol",
+			contentType: typeForm,
+			body:        "name=Carol",
+			status:      http.StatusCreated,
+			expected:    `{"renamed":"Carol"}` + "\n",
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			req := httptest.NewRequest(test.method, test.path, strings.NewReader(test.body))
+			if test.contentType != "" {
+				req.Header.Set("Content-Type", test.contentType)
+			}
+			h.Main().ServeHTTP(w, req)
+			resp := w.Result()
+			defer resp.Body.Close()
+			if resp.StatusCode != test.status {
+				t.Errorf("Unexpected status: %s", resp.Status)
+			}
+			if test.expected == "" {
+				return
+			}
+			body, _ := ioutil.ReadAll(resp.Body)
+			if string(body) != test.expected {
+				t.Errorf("Unexpected body: %s", body)
+			}
+		})
+	}
+	row, err := db.Get(ctx, "carol")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var carol struct {
+		Name string `json:"name"`
+	}
+	if err = row.ScanDoc(&carol); err != nil {
+		t.Fatal(err)
+	}
+	if carol.Name != "Carol" {
+		t.Errorf("Update not saved: %v", carol)
+	}
+}
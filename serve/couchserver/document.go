@@ -0,0 +1,346 @@
+package couchserver
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/pressly/chi"
+
+	"github.com/flimzy/kivik"
+	"github.com/flimzy/kivik/errors"
+)
+
+// docID returns the requested document ID, including the _design/ or _local/
+// prefix, for the routes of design and local documents.
+func docID(r *http.Request) string {
+	if ddoc := chi.URLParam(r, "ddoc"); ddoc != "" {
+		return "_design/" + ddoc
+	}
+	if local := chi.URLParam(r, "localid"); local != "" {
+		return "_local/" + local
+	}
+	return chi.URLParam(r, "docid")
+}
+
+// etag returns the quoted value of an ETag header.
+func etag(value string) string {
+	return `"` + value + `"`
+}
+
+// etagMatch returns true if the If-None-Match or If-Match header value lists
+// tag, or is "*". Weak tags are compared as strong ones.
+func etagMatch(header, tag string) bool {
+	for _, value := range strings.Split(header, ",") {
+		value = strings.TrimPrefix(strings.TrimSpace(value), "W/")
+		if value == "*" || value == tag {
+			return true
+		}
+	}
+	return false
+}
+
+// notModified writes a 304 Not Modified response, and returns true, if the
+// request's If-None-Match header matches tag.
+func notModified(w http.ResponseWriter, r *http.Request, tag string) bool {
+	if match := r.Header.Get("If-None-Match"); match == "" || !etagMatch(match, tag) {
+		return false
+	}
+	w.WriteHeader(http.StatusNotModified)
+	return true
+}
+
+// dbEndpoints are the CouchDB database endpoints, other than documents, which
+// the handler's routes do not serve.
+var dbEndpoints = map[string]bool{
+	"_all_docs":     true,
+	"_bulk_docs":    true,
+	"_bulk_get":     true,
+	"_compact":      true,
+	"_design_docs":  true,
+	"_explain":      true,
+	"_find":         true,
+	"_index":        true,
+	"_local_docs":   true,
+	"_missing_revs": true,
+	"_purge":        true,
+	"_revs_diff":    true,
+	"_revs_limit":   true,
+	"_security":     true,
+	"_view_cleanup": true,
+}
+
+// reservedDoc handles requests for document IDs which begin with an
+// underscore, but match none of the handler's routes, such as /{db}/_all_docs.
+// They are passed to Upstream, if set. It returns true if the request was
+// handled.
+func (h *Handler) reservedDoc(w http.ResponseWriter, r *http.Request) bool {
+	id := chi.URLParam(r, "docid")
+	if !strings.HasPrefix(id, "_") {
+		return false
+	}
+	if h.Upstream != nil {
+		h.Upstream.ServeHTTP(w, r)
+		return true
+	}
+	h.HandleError(w, h.reservedDocError(r, id))
+	return true
+}
+
+// reservedDocError returns the error of a request for the reserved document
+// ID id: Not Found if the database does not exist, as for any other request,
+// Not Implemented for the endpoints of dbEndpoints, and Bad Request otherwise.
+func (h *Handler) reservedDocError(r *http.Request, id string) error {
+	exists, err := h.Client.DBExists(r.Context(), DB(r))
+	if err != nil {
+		return err
+	}
+	if !exists {
+		return errors.Status(kivik.StatusNotFound, "Database does not exist.")
+	}
+	if dbEndpoints[id] {
+		return errors.Statusf(kivik.StatusNotImplemented, "%s is not implemented", id)
+	}
+	return errors.Status(kivik.StatusBadRequest, "Only reserved document ids may start with underscore.")
+}
+
+// docRev returns the revision of a write, from the rev query parameter or
+// the If-Match header, which must agree if both are set.
+func docRev(r *http.Request) (string, error) {
+	rev := r.URL.Query().Get("rev")
+	match := strings.Trim(r.Header.Get("If-Match"), `"`)
+	if rev != "" && match != "" && rev != match {
+		return "", errors.Status(kivik.StatusBadRequest, "Document rev and etag have different values.")
+	}
+	if rev == "" {
+		rev = match
+	}
+	return rev, nil
+}
+
+// GetDoc handles GET and HEAD /{db}/{docid}. The response's ETag is the
+// document's revision, and a request with a matching If-None-Match header
+// receives 304 Not Modified.
+func (h *Handler) GetDoc() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if h.reservedDoc(w, r) {
+			return
+		}
+		h.HandleError(w, h.getDoc(w, r))
+	}
+}
+
+func (h *Handler) getDoc(w http.ResponseWriter, r *http.Request) error {
+	db, err := h.Client.DB(r.Context(), DB(r))
+	if err != nil {
+		return err
+	}
+	opts := kivik.Options{}
+	for key, value := range firstValues(r.URL.Query()) {
+		opts[key] = value
+	}
+	row, err := db.Get(r.Context(), docID(r), opts)
+	if err != nil {
+		return err
+	}
+	var doc json.RawMessage
+	if err = row.ScanDoc(&doc); err != nil {
+		return err
+	}
+	var meta struct {
+		Rev string `json:"_rev"`
+	}
+	if err = json.Unmarshal(doc, &meta); err != nil {
+		return errors.WrapStatus(kivik.StatusInternalServerError, err)
+	}
+	tag := etag(meta.Rev)
+	w.Header().Set("ETag", tag)
+	if notModified(w, r, tag) {
+		return nil
+	}
+	w.Header().Set("Content-Type", typeJSON)
+	if r.Method == http.MethodHead {
+		return nil
+	}
+	_, err = w.Write(doc)
+	return err
+}
+
+// PutDoc handles PUT /{db}/{docid}. The revision being updated may be given
+// by the document's _rev field, the rev query parameter, or the If-Match
+// header, which must agree. The response's ETag is the new revision.
+func (h *Handler) PutDoc() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if h.reservedDoc(w, r) {
+			return
+		}
+		h.HandleError(w, h.putDoc(w, r))
+	}
+}
+
+func (h *Handler) putDoc(w http.ResponseWriter, r *http.Request) error {
+	db, err := h.Client.DB(r.Context(), DB(r))
+	if err != nil {
+		return err
+	}
+	rev, err := docRev(r)
+	if err != nil {
+		return err
+	}
+	var doc map[string]interface{}
+	if err = json.NewDecoder(r.Body).Decode(&doc); err != nil {
+		if kivik.StatusCode(err) == kivik.StatusRequestEntityTooLarge {
+			return err
+		}
+		return errors.WrapStatus(kivik.StatusBadRequest, err)
+	}
+	if rev != "" {
+		if bodyRev, _ := doc["_rev"].(string); bodyRev != "" && bodyRev != rev {
+			return errors.Status(kivik.StatusBadRequest, "Document rev and etag have different values.")
+		}
+		doc["_rev"] = rev
+	}
+	id := docID(r)
+	newRev, err := db.Put(r.Context(), id, doc)
+	if err != nil {
+		return err
+	}
+	return writeDocResult(w, http.StatusCreated, id, newRev)
+}
+
+// DeleteDoc handles DELETE /{db}/{docid}. The revision being deleted is given
+// by the rev query parameter, or the If-Match header.
+func (h *Handler) DeleteDoc() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if h.reservedDoc(w, r) {
+			return
+		}
+		h.HandleError(w, h.deleteDoc(w, r))
+	}
+}
+
+func (h *Handler) deleteDoc(w http.ResponseWriter, r *http.Request) error {
+	db, err := h.Client.DB(r.Context(), DB(r))
+	if err != nil {
+		return err
+	}
+	rev, err := docRev(r)
+	if err != nil {
+		return err
+	}
+	id := docID(r)
+	newRev, err := db.Delete(r.Context(), id, rev)
+	if err != nil {
+		return err
+	}
+	return writeDocResult(w, http.StatusOK, id, newRev)
+}
+
+func writeDocResult(w http.ResponseWriter, status int, id, rev string) error {
+	w.Header().Set("Content-Type", typeJSON)
+	w.Header().Set("ETag", etag(rev))
+	w.WriteHeader(status)
+	return json.NewEncoder(w).Encode(map[string]interface{}{
+		"ok":  true,
+		"id":  id,
+		"rev": rev,
+	})
+}
+
+// GetAttachment handles GET and HEAD /{db}/{docid}/{attname}. The response's
+// ETag is the base64-encoded MD5 digest of the attachment, and a request with
+// a matching If-None-Match header receives 304 Not Modified.
+func (h *Handler) GetAttachment() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if h.reservedDoc(w, r) {
+			return
+		}
+		h.HandleError(w, h.getAttachment(w, r))
+	}
+}
+
+func (h *Handler) getAttachment(w http.ResponseWriter, r *http.Request) error {
+	db, err := h.Client.DB(r.Context(), DB(r))
+	if err != nil {
+		return err
+	}
+	att, err := db.GetAttachment(r.Context(), docID(r), r.URL.Query().Get("rev"), chi.URLParam(r, "*"))
+	if err != nil {
+		return err
+	}
+	defer func() { _ = att.Close() }()
+	digest := base64.StdEncoding.EncodeToString(att.MD5[:])
+	tag := etag(digest)
+	w.Header().Set("ETag", tag)
+	if notModified(w, r, tag) {
+		return nil
+	}
+	w.Header().Set("Content-Type", att.ContentType)
+	w.Header().Set("Content-MD5", digest)
+	if r.Method == http.MethodHead {
+		return nil
+	}
+	_, err = io.Copy(w, att)
+	return err
+}
+
+// PutAttachment handles PUT /{db}/{docid}/{attname}. The request body is the
+// attachment's content, of the request's Content-Type, and the revision being
+// updated is given as for PutDoc. The document is created, if it does not
+// exist.
+func (h *Handler) PutAttachment() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if h.reservedDoc(w, r) {
+			return
+		}
+		h.HandleError(w, h.putAttachment(w, r))
+	}
+}
+
+func (h *Handler) putAttachment(w http.ResponseWriter, r *http.Request) error {
+	db, err := h.Client.DB(r.Context(), DB(r))
+	if err != nil {
+		return err
+	}
+	rev, err := docRev(r)
+	if err != nil {
+		return err
+	}
+	id := docID(r)
+	att := kivik.NewAttachment(chi.URLParam(r, "*"), r.Header.Get("Content-Type"), r.Body)
+	newRev, err := db.PutAttachment(r.Context(), id, rev, att)
+	if err != nil {
+		return err
+	}
+	return writeDocResult(w, http.StatusCreated, id, newRev)
+}
+
+// DeleteAttachment handles DELETE /{db}/{docid}/{attname}. The revision being
+// updated is given by the rev query parameter, or the If-Match header.
+func (h *Handler) DeleteAttachment() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if h.reservedDoc(w, r) {
+			return
+		}
+		h.HandleError(w, h.deleteAttachment(w, r))
+	}
+}
+
+func (h *Handler) deleteAttachment(w http.ResponseWriter, r *http.Request) error {
+	db, err := h.Client.DB(r.Context(), DB(r))
+	if err != nil {
+		return err
+	}
+	rev, err := docRev(r)
+	if err != nil {
+		return err
+	}
+	id := docID(r)
+	newRev, err := db.DeleteAttachment(r.Context(), id, rev, chi.URLParam(r, "*"))
+	if err != nil {
+		return err
+	}
+	return writeDocResult(w, http.StatusOK, id, newRev)
+}
@@ -0,0 +1,221 @@
+package couchserver
+
+import (
+	"bytes"
+	"context"
+	"crypto/md5"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/flimzy/kivik"
+	"github.com/flimzy/kivik/driver"
+	"github.com/flimzy/kivik/errors"
+	"github.com/flimzy/kivik/kiviktest"
+)
+
+func TestDocuments(t *testing.T) {
+	client, err := kivik.New(context.Background(), "memory", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := client.CreateDB(context.Background(), "foo"); err != nil {
+		t.Fatal(err)
+	}
+	handler := (&Handler{Client: client}).Main()
+	request := func(method, path, body string, headers map[string]string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, strings.NewReader(body))
+		for key, value := range headers {
+			req.Header.Set(key, value)
+		}
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, req)
+		return w
+	}
+
+	w := request("PUT", "/foo/bar", `{"a":1}`, nil)
+	if w.Code != http.StatusCreated {
+		t.Fatalf("Unexpected status %d: %s", w.Code, w.Body.String())
+	}
+	var result struct {
+		Rev string `json:"rev"`
+	}
+	if err := json.NewDecoder(w.Body).Decode(&result); err != nil {
+		t.Fatal(err)
+	}
+	tag := `"` + result.Rev + `"`
+	if w.Header().Get("ETag") != tag {
+		t.Errorf("Unexpected ETag %q for rev %s", w.Header().Get("ETag"), result.Rev)
+	}
+
+	tests := []struct {
+		name    string
+		method  string
+		path    string
+		body    string
+		headers map[string]string
+		status  int
+	}{
+		{name: "Get", method: "GET", path: "/foo/bar", status: http.StatusOK},
+		{name: "Head", method: "HEAD", path: "/foo/bar", status: http.StatusOK},
+		{name: "NotModified", method: "GET", path: "/foo/bar", headers: map[string]string{"If-None-Match": tag}, status: http.StatusNotModified},
+		{name: "NotModifiedList", method: "GET", path: "/foo/bar", headers: map[string]string{"If-None-Match": `"1-xxx", W/` + tag}, status: http.StatusNotModified},
+		{name: "Modified", method: "GET", path: "/foo/bar", headers: map[string]string{"If-None-Match": `"1-xxx"`}, status: http.StatusOK},
+		{name: "Missing", method: "GET", path: "/foo/baz", status: http.StatusNotFound},
+		{name: "Reserved", method: "GET", path: "/foo/_bogus", status: http.StatusBadRequest},
+		{name: "Endpoint", method: "GET", path: "/foo/_all_docs", status: http.StatusNotImplemented},
+		{name: "EndpointMissingDB", method: "GET", path: "/bar/_all_docs", status: http.StatusNotFound},
+		{name: "StaleIfMatch", method: "PUT", path: "/foo/bar", body: `{}`, headers: map[string]string{"If-Match": `"1-xxx"`}, status: http.StatusConflict},
+		{name: "MismatchedRevs", method: "PUT", path: "/foo/bar?rev=1-xxx", body: `{}`, headers: map[string]string{"If-Match": tag}, status: http.StatusBadRequest},
+		{name: "MismatchedBody", method: "PUT", path: "/foo/bar", body: `{"_rev":"1-xxx"}`, headers: map[string]string{"If-Match": tag}, status: http.StatusBadRequest},
+		{name: "InvalidJSON", method: "PUT", path: "/foo/bar", body: `{`, status: http.StatusBadRequest},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			w := request(test.method, test.path, test.body, test.headers)
+			if w.Code != test.status {
+				t.Errorf("Unexpected status %d: %s", w.Code, w.Body.String())
+			}
+			if w.Code == http.StatusOK && w.Header().Get("ETag") != tag {
+				t.Errorf("Unexpected ETag: %q", w.Header().Get("ETag"))
+			}
+		})
+	}
+
+	w = request("PUT", "/foo/bar", `{"a":2}`, map[string]string{"If-Match": tag})
+	if w.Code != http.StatusCreated {
+		t.Fatalf("Unexpected status %d: %s", w.Code, w.Body.String())
+	}
+	newTag := w.Header().Get("ETag")
+	if newTag == tag {
+		t.Error("Expected a new ETag")
+	}
+	if w := request("GET", "/foo/bar", "", map[string]string{"If-None-Match": tag}); w.Code != http.StatusOK {
+		t.Errorf("Expected the old ETag not to match, got status %d", w.Code)
+	}
+	if w := request("DELETE", "/foo/bar", "", map[string]string{"If-Match": newTag}); w.Code != http.StatusOK {
+		t.Errorf("Unexpected status %d: %s", w.Code, w.Body.String())
+	}
+
+	w = request("PUT", "/foo/_design/baz", `{}`, nil)
+	if w.Code != http.StatusCreated {
+		t.Fatalf("Unexpected status %d: %s", w.Code, w.Body.String())
+	}
+	if w := request("GET", "/foo/_design/baz", "", nil); w.Code != http.StatusOK {
+		t.Errorf("Unexpected status %d for a design doc: %s", w.Code, w.Body.String())
+	}
+}
+
+func TestReservedUpstream(t *testing.T) {
+	upstream := http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.WriteHeader(http.StatusTeapot)
+	})
+	handler := (&Handler{Upstream: upstream}).Main()
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest("GET", "/foo/_all_docs", nil))
+	if w.Code != http.StatusTeapot {
+		t.Errorf("Expected the request to be passed upstream, got %d", w.Code)
+	}
+}
+
+type attDriver struct{}
+
+var _ driver.Driver = &attDriver{}
+
+func (d *attDriver) NewClient(_ context.Context, _ string) (driver.Client, error) {
+	return &attClient{}, nil
+}
+
+type attClient struct {
+	driver.Client
+}
+
+func (c *attClient) DB(_ context.Context, _ string, _ map[string]interface{}) (driver.DB, error) {
+	return &attDB{}, nil
+}
+
+type attDB struct {
+	driver.DB
+}
+
+func (db *attDB) GetAttachment(_ context.Context, docID, _, filename string) (string, driver.MD5sum, io.ReadCloser, error) {
+	if docID != "doc" || filename != "dir/file.txt" {
+		return "", driver.MD5sum{}, nil, errors.Status(kivik.StatusNotFound, "Document is missing attachment")
+	}
+	return "text/plain", md5.Sum([]byte("content")), ioutil.NopCloser(bytes.NewBufferString("content")), nil
+}
+
+func TestGetAttachment(t *testing.T) {
+	client := kiviktest.NewClient(t, &attDriver{}, "")
+	handler := (&Handler{Client: client}).Main()
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest("GET", "/foo/doc/dir/file.txt", nil))
+	if w.Code != http.StatusOK || w.Body.String() != "content" {
+		t.Fatalf("Unexpected response %d: %s", w.Code, w.Body.String())
+	}
+	tag := w.Header().Get("ETag")
+	if tag != `"mgNkuembtIDdJeHwKEyFVQ=="` {
+		t.Errorf("Unexpected ETag: %s", tag)
+	}
+	if ct := w.Header().Get("Content-Type"); ct != "text/plain" {
+		t.Errorf("Unexpected Content-Type: %s", ct)
+	}
+	req := httptest.NewRequest("GET", "/foo/doc/dir/file.txt", nil)
+	req.Header.Set("If-None-Match", tag)
+	w = httptest.NewRecorder()
+	handler.ServeHTTP(w, req)
+	if w.Code != http.StatusNotModified || w.Body.Len() != 0 {
+		t.Errorf("Unexpected response %d: %s", w.Code, w.Body.String())
+	}
+	w = httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest("GET", "/foo/doc/other.txt", nil))
+	if w.Code != http.StatusNotFound {
+		t.Errorf("Unexpected status for a missing attachment: %d", w.Code)
+	}
+}
+
+func TestAttachmentWrites(t *testing.T) {
+	client, err := kivik.New(context.Background(), "memory", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := client.CreateDB(context.Background(), "foo"); err != nil {
+		t.Fatal(err)
+	}
+	handler := (&Handler{Client: client}).Main()
+	request := func(method, path, body string, headers map[string]string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, strings.NewReader(body))
+		for key, value := range headers {
+			req.Header.Set(key, value)
+		}
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, req)
+		return w
+	}
+
+	w := request("PUT", "/foo/doc/dir/file.txt", "content", map[string]string{"Content-Type": "text/plain"})
+	if w.Code != http.StatusCreated {
+		t.Fatalf("Unexpected status %d: %s", w.Code, w.Body.String())
+	}
+	tag := w.Header().Get("ETag")
+	w = request("GET", "/foo/doc/dir/file.txt", "", nil)
+	if w.Code != http.StatusOK || w.Body.String() != "content" {
+		t.Fatalf("Unexpected response %d: %s", w.Code, w.Body.String())
+	}
+	if ct := w.Header().Get("Content-Type"); ct != "text/plain" {
+		t.Errorf("Unexpected Content-Type: %s", ct)
+	}
+	if w := request("PUT", "/foo/doc/other.txt", "other", nil); w.Code != http.StatusConflict {
+		t.Errorf("Expected a conflict without a rev, got %d: %s", w.Code, w.Body.String())
+	}
+	if w := request("DELETE", "/foo/doc/dir/file.txt", "", map[string]string{"If-Match": tag}); w.Code != http.StatusOK {
+		t.Fatalf("Unexpected status %d: %s", w.Code, w.Body.String())
+	}
+	if w := request("GET", "/foo/doc/dir/file.txt", "", nil); w.Code != http.StatusNotFound {
+		t.Errorf("Unexpected status for a deleted attachment: %d", w.Code)
+	}
+}
@@ -0,0 +1,47 @@
+package couchserver
+
+import (
+	"net/http"
+
+	"github.com/flimzy/kivik"
+	"github.com/flimzy/kivik/errors"
+	"github.com/flimzy/kivik/serve/logger"
+)
+
+// typeNDJSON is the content type of a dump, in which each line is a JSON
+// object.
+const typeNDJSON = "application/x-ndjson"
+
+// GetDump handles GET /{db}/_dump, which streams the database to server
+// admins, in the format written by kivik.Client.Dump, and read by Restore:
+//
+//	curl -u admin:pass http://localhost:5984/foo/_dump > foo.ndjson
+func (h *Handler) GetDump() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if err := h.requireAdmin(r); err != nil {
+			h.HandleError(w, err)
+			return
+		}
+		dbName := DB(r)
+		exists, err := h.Client.DBExists(r.Context(), dbName)
+		if err != nil {
+			h.HandleError(w, err)
+			return
+		}
+		if !exists {
+			h.HandleError(w, errors.Status(kivik.StatusNotFound, "Database does not exist."))
+			return
+		}
+		w.Header().Set("Content-Type", typeNDJSON)
+		w.Header().Set("Content-Disposition", `attachment; filename="`+dbName+`.ndjson"`)
+		// Once the dump has begun, an error can no longer be reported with
+		// the status, so the response is cut short, leaving an incomplete
+		// final line.
+		if err := h.Client.Dump(r.Context(), w, dbName); err != nil {
+			h.logger().Log(logger.LevelError, "Dump failed", logger.Fields{
+				logger.FieldDB:    dbName,
+				logger.FieldError: err,
+			})
+		}
+	}
+}
@@ -0,0 +1,114 @@
+package couchserver
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/flimzy/diff"
+	"github.com/flimzy/kivik"
+	"github.com/flimzy/kivik/authdb"
+	"github.com/flimzy/kivik/driver"
+	"github.com/flimzy/kivik/errors"
+)
+
+// dumpDriver serves a single database, foo, with one document.
+type dumpDriver struct{}
+
+func (d *dumpDriver) NewClient(_ context.Context, _ string) (driver.Client, error) {
+	return &dumpClient{}, nil
+}
+
+type dumpClient struct {
+	driver.Client
+}
+
+func (c *dumpClient) DBExists(_ context.Context, dbName string, _ map[string]interface{}) (bool, error) {
+	return dbName == "foo", nil
+}
+
+func (c *dumpClient) DB(_ context.Context, _ string, _ map[string]interface{}) (driver.DB, error) {
+	return &dumpDB{}, nil
+}
+
+type dumpDB struct {
+	driver.DB
+}
+
+func (db *dumpDB) Security(_ context.Context) (*driver.Security, error) {
+	return nil, errors.Status(kivik.StatusNotImplemented, "not implemented")
+}
+
+func (db *dumpDB) AllDocs(_ context.Context, _ map[string]interface{}) (driver.Rows, error) {
+	return &dumpRows{ids: []string{"a"}}, nil
+}
+
+func (db *dumpDB) Get(_ context.Context, docID string, _ map[string]interface{}) (json.RawMessage, error) {
+	return json.RawMessage(`{"_id":"` + docID + `","_rev":"1-xxx"}`), nil
+}
+
+type dumpRows struct {
+	driver.Rows
+	ids []string
+}
+
+func (r *dumpRows) Next(row *driver.Row) error {
+	if len(r.ids) == 0 {
+		return io.EOF
+	}
+	row.ID, r.ids = r.ids[0], r.ids[1:]
+	row.Value = json.RawMessage(`{"rev":"1-xxx"}`)
+	return nil
+}
+
+func (r *dumpRows) Close() error { return nil }
+
+func TestGetDump(t *testing.T) {
+	client, err := kivik.NewClientFromDriver(context.Background(), &dumpDriver{}, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	admin := &authdb.UserContext{Name: "admin", Roles: []string{"_admin"}}
+	tests := []struct {
+		name     string
+		user     *authdb.UserContext
+		path     string
+		status   int
+		expected string
+	}{
+		{name: "NoUser", path: "/foo/_dump", status: http.StatusUnauthorized},
+		{name: "NotAdmin", user: &authdb.UserContext{Name: "bob"}, path: "/foo/_dump", status: http.StatusForbidden},
+		{name: "NotFound", user: admin, path: "/bar/_dump", status: http.StatusNotFound},
+		{
+			name:   "Admin",
+			user:   admin,
+			path:   "/foo/_dump",
+			status: http.StatusOK,
+			expected: `{"db":"foo"}
+{"db":"foo","doc":{"_id":"a","_rev":"1-xxx"}}
+`,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			h := &Handler{Client: client, SessionKey: sessionKey{}}
+			w := httptest.NewRecorder()
+			h.Main().ServeHTTP(w, withSession(httptest.NewRequest("GET", test.path, nil), test.user))
+			if w.Code != test.status {
+				t.Fatalf("Unexpected status %d: %s", w.Code, w.Body.String())
+			}
+			if test.status != http.StatusOK {
+				return
+			}
+			if ct := w.Header().Get("Content-Type"); ct != typeNDJSON {
+				t.Errorf("Unexpected content type %s", ct)
+			}
+			if d := diff.Text(test.expected, w.Body.String()); d != "" {
+				t.Error(d)
+			}
+		})
+	}
+}
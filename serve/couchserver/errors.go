@@ -2,26 +2,32 @@ package couchserver
 
 import (
 	"encoding/json"
-	"fmt"
 	"net/http"
+	"strings"
 
 	"github.com/flimzy/kivik"
+	"github.com/flimzy/kivik/errors"
+	"github.com/flimzy/kivik/serve/logger"
 )
 
+// errorNames maps the statuses for which CouchDB's error name differs from
+// the status text.
+var errorNames = map[int]string{
+	kivik.StatusRequestEntityTooLarge: "too_large",
+	kivik.StatusBadContentType:        "bad_content_type",
+}
+
+// errorDescription returns the CouchDB error name for status, such as
+// "not_found" for 404, or "unknown_error" for an unknown status.
 func errorDescription(status int) string {
-	switch status {
-	case 401:
-		return "unauthorized"
-	case 400:
-		return "bad_request"
-	case 404:
-		return "not_found"
-	case 500:
-		return "internal_server_error" // TODO: Validate that this is normative
-	case 501:
-		return "not_implemented" // Non-standard
+	if name, ok := errorNames[status]; ok {
+		return name
 	}
-	panic(fmt.Sprintf("unknown status %d", status))
+	text := http.StatusText(status)
+	if text == "" {
+		return "unknown_error"
+	}
+	return strings.Replace(strings.ToLower(text), " ", "_", -1)
 }
 
 type couchError struct {
@@ -29,18 +35,34 @@ type couchError struct {
 	Reason string `json:"reason"`
 }
 
+// WriteError writes err to w as CouchDB does: with the status of err, and a
+// JSON object of its error name and reason, such as
+// {"error":"not_found","reason":"missing"}. The name is that of err, if it
+// implements errors.ErrorNamer, or else that of the status. An error without
+// a status is reported as 500 Internal Server Error.
+func WriteError(w http.ResponseWriter, err error) error {
+	status := kivik.StatusCode(err)
+	if status == 0 {
+		status = kivik.StatusInternalServerError
+	}
+	name := errors.ErrorName(err)
+	if name == "" {
+		name = errorDescription(status)
+	}
+	w.Header().Set("Content-Type", typeJSON)
+	w.WriteHeader(status)
+	return json.NewEncoder(w).Encode(couchError{
+		Error:  name,
+		Reason: kivik.Reason(err),
+	})
+}
+
 // HandleError returns a CouchDB-formatted error. It does nothing if err is nil.
 func (h *Handler) HandleError(w http.ResponseWriter, err error) {
 	if err == nil {
 		return
 	}
-	status := kivik.StatusCode(err)
-	w.WriteHeader(status)
-	wErr := json.NewEncoder(w).Encode(couchError{
-		Error:  errorDescription(status),
-		Reason: kivik.Reason(err),
-	})
-	if wErr != nil {
-		h.Logger.Printf("Failed to send send error: %s", wErr)
+	if wErr := WriteError(w, err); wErr != nil {
+		h.logger().Log(logger.LevelError, "Failed to send error", logger.Fields{logger.FieldError: wErr})
 	}
 }
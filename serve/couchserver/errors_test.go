@@ -10,6 +10,10 @@ import (
 	"testing"
 
 	"github.com/flimzy/diff"
+
+	"github.com/flimzy/kivik"
+	kerrors "github.com/flimzy/kivik/errors"
+	"github.com/flimzy/kivik/serve/logger"
 )
 
 type reasonError int
@@ -18,6 +22,10 @@ func (e reasonError) Error() string   { return "test error" }
 func (e reasonError) StatusCode() int { return 404 }
 func (e reasonError) Reason() string  { return "it ain't there" }
 
+type namedError struct{ reasonError }
+
+func (e namedError) ErrorName() string { return "missing_doc" }
+
 func TestHandleError(t *testing.T) {
 	h := Handler{}
 	type eTest struct {
@@ -46,6 +54,14 @@ func TestHandleError(t *testing.T) {
 				"reason": "it ain't there",
 			},
 		},
+		{
+			Name: "NamedError",
+			Err:  namedError{},
+			Expected: map[string]string{
+				"error":  "missing_doc",
+				"reason": "it ain't there",
+			},
+		},
 	}
 	for _, test := range tests {
 		func(test eTest) {
@@ -62,6 +78,96 @@ func TestHandleError(t *testing.T) {
 	}
 }
 
+func TestErrorDescription(t *testing.T) {
+	tests := []struct {
+		status   int
+		expected string
+	}{
+		{kivik.StatusBadRequest, "bad_request"},
+		{kivik.StatusNotFound, "not_found"},
+		{kivik.StatusResourceNotAllowed, "method_not_allowed"},
+		{http.StatusNotAcceptable, "not_acceptable"},
+		{kivik.StatusRequestEntityTooLarge, "too_large"},
+		{kivik.StatusBadContentType, "bad_content_type"},
+		{kivik.StatusRequestedRangeNotSatisfiable, "requested_range_not_satisfiable"},
+		{kivik.StatusExpectationFailed, "expectation_failed"},
+		{kivik.StatusInternalServerError, "internal_server_error"},
+		{kivik.StatusNotImplemented, "not_implemented"},
+		{http.StatusServiceUnavailable, "service_unavailable"},
+		{599, "unknown_error"},
+	}
+	for _, test := range tests {
+		if name := errorDescription(test.status); name != test.expected {
+			t.Errorf("%d: Expected %s, got %s", test.status, test.expected, name)
+		}
+	}
+}
+
+func TestWriteError(t *testing.T) {
+	tests := []struct {
+		name     string
+		err      error
+		status   int
+		expected interface{}
+	}{
+		{
+			name:   "Status",
+			err:    kerrors.Status(kivik.StatusNotFound, "missing"),
+			status: kivik.StatusNotFound,
+			expected: map[string]string{
+				"error":  "not_found",
+				"reason": "missing",
+			},
+		},
+		{
+			name:   "Unavailable",
+			err:    kerrors.Status(http.StatusServiceUnavailable, "maintenance mode"),
+			status: http.StatusServiceUnavailable,
+			expected: map[string]string{
+				"error":  "service_unavailable",
+				"reason": "maintenance mode",
+			},
+		},
+		{
+			name:   "Wrapped",
+			err:    kerrors.WrapStatus(kivik.StatusBadContentType, errors.New("expected JSON")),
+			status: kivik.StatusBadContentType,
+			expected: map[string]string{
+				"error":  "bad_content_type",
+				"reason": "expected JSON",
+			},
+		},
+		{
+			name:   "NoStatus",
+			err:    errors.New("test error"),
+			status: kivik.StatusInternalServerError,
+			expected: map[string]string{
+				"error":  "internal_server_error",
+				"reason": "test error",
+			},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			if err := WriteError(w, test.err); err != nil {
+				t.Fatal(err)
+			}
+			resp := w.Result()
+			defer func() { _ = resp.Body.Close() }()
+			if resp.StatusCode != test.status {
+				t.Errorf("Expected status %d, got %d", test.status, resp.StatusCode)
+			}
+			if ct := resp.Header.Get("Content-Type"); ct != typeJSON {
+				t.Errorf("Unexpected Content-Type: %s", ct)
+			}
+			if d := diff.AsJSON(test.expected, resp.Body); d != "" {
+				t.Error(d)
+			}
+		})
+	}
+}
+
 type errorResponseWriter struct {
 	http.ResponseWriter
 }
@@ -77,12 +183,12 @@ type fileResponseWriter struct {
 func TestHandleErrorFailure(t *testing.T) {
 	logBuf := &bytes.Buffer{}
 	h := &Handler{
-		Logger: log.New(logBuf, "", 0),
+		Logger: logger.NewStdLogger(log.New(logBuf, "", 0), logger.LevelDebug),
 	}
 	w := httptest.NewRecorder()
 	h.HandleError(&errorResponseWriter{w}, errors.New("test error"))
 
-	expected := "Failed to send send error: unusual write error\n"
+	expected := "[error] Failed to send error error=\"unusual write error\"\n"
 	if expected != logBuf.String() {
 		t.Errorf("Expected: %s\n  Actual: %s", expected, logBuf.String())
 	}
@@ -0,0 +1,101 @@
+package couchserver
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/flimzy/kivik"
+	"github.com/flimzy/kivik/errors"
+	"github.com/flimzy/kivik/serve/logger"
+)
+
+// defaultHeartbeat is the interval between heartbeat events of an
+// eventsource feed, unless set by the heartbeat option.
+const defaultHeartbeat = 60 * time.Second
+
+// eventSource streams changes as server-sent events, for browser EventSource
+// clients, as CouchDB's eventsource feed. The id of each event is the
+// sequence of the change, so that a reconnecting client resumes after the
+// last change it received, by the Last-Event-ID header, which takes
+// precedence over since. The driver's continuous feed is used if supported;
+// otherwise, the database is polled with normal feeds, every
+// ChangesPollInterval. The feed ends when the client disconnects, or after
+// limit changes.
+func (h *Handler) eventSource(w http.ResponseWriter, r *http.Request, opts kivik.Options) error {
+	if id := r.Header.Get("Last-Event-ID"); id != "" {
+		opts["since"] = id
+	}
+	heartbeat := defaultHeartbeat
+	if hb, ok := opts["heartbeat"].(string); ok && hb != "true" {
+		ms, err := strconv.Atoi(hb)
+		if err != nil || ms <= 0 {
+			return errors.Statusf(kivik.StatusBadRequest, "invalid heartbeat: %s", hb)
+		}
+		heartbeat = time.Duration(ms) * time.Millisecond
+	}
+	delete(opts, "heartbeat")
+	delete(opts, "feed")
+	ctx, cancel := context.WithCancel(r.Context())
+	defer cancel()
+	feed, err := h.openChangesFeed(ctx, r, opts)
+	if err != nil {
+		return err
+	}
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.WriteHeader(http.StatusOK)
+	flusher, _ := w.(http.Flusher)
+	send := func(frame string) error {
+		if _, err := fmt.Fprint(w, frame); err != nil {
+			return err
+		}
+		if flusher != nil {
+			flusher.Flush()
+		}
+		return nil
+	}
+	if flusher != nil {
+		flusher.Flush()
+	}
+
+	results := make(chan *changeResult)
+	done := make(chan error, 1)
+	go func() {
+		done <- h.streamChanges(ctx, feed, results)
+	}()
+	ticker := time.NewTicker(heartbeat)
+	defer ticker.Stop()
+	var sent int
+	for {
+		var frame string
+		select {
+		case <-ctx.Done():
+			return nil
+		case err := <-done:
+			if err != nil && ctx.Err() == nil {
+				h.logger().Log(logger.LevelError, "Failed to read changes feed", logger.Fields{logger.FieldError: err})
+			}
+			return nil
+		case <-ticker.C:
+			frame = "event: heartbeat\ndata: \n\n"
+		case result := <-results:
+			data, err := json.Marshal(result)
+			if err != nil {
+				return nil
+			}
+			frame = fmt.Sprintf("data: %s\nid: %s\n\n", data, result.Seq)
+			sent++
+		}
+		if err := send(frame); err != nil {
+			return nil
+		}
+		if feed.req.limit > 0 && sent >= feed.req.limit {
+			return nil
+		}
+	}
+}
@@ -0,0 +1,128 @@
+package couchserver
+
+import (
+	"net/http"
+	"sort"
+	"strings"
+
+	"github.com/pressly/chi"
+
+	"github.com/flimzy/kivik"
+	"github.com/flimzy/kivik/errors"
+)
+
+// allowedMethods returns the methods of each route of r, including OPTIONS,
+// by pattern. Routes which accept any method, such as _rewrite, are omitted.
+func allowedMethods(r chi.Routes) map[string][]string {
+	allowed := make(map[string][]string)
+	for _, route := range r.Routes() {
+		if _, ok := route.Handlers["*"]; ok {
+			continue
+		}
+		methods := []string{http.MethodOptions}
+		for method := range route.Handlers {
+			if method != http.MethodOptions {
+				methods = append(methods, method)
+			}
+		}
+		sort.Strings(methods)
+		allowed[route.Pattern] = methods
+	}
+	return allowed
+}
+
+// Options handles OPTIONS for a route with the given methods, with an Allow
+// header listing them.
+func (h *Handler) Options(methods []string) http.HandlerFunc {
+	allow := strings.Join(methods, ", ")
+	return func(w http.ResponseWriter, _ *http.Request) {
+		w.Header().Set("Allow", allow)
+		w.WriteHeader(http.StatusOK)
+	}
+}
+
+// methodNotAllowed responds with 405 Method Not Allowed, and an Allow header,
+// to a request with a method not supported by the matching route, or with
+// 404 Not Found if no route matches.
+func (h *Handler) methodNotAllowed(allowed map[string][]string) http.HandlerFunc {
+	patterns := make([]string, 0, len(allowed))
+	for pattern := range allowed {
+		patterns = append(patterns, pattern)
+	}
+	return func(w http.ResponseWriter, r *http.Request) {
+		// chi does not look up the route of methods it does not know, such
+		// as COPY.
+		pattern := chi.RouteContext(r.Context()).RoutePattern
+		if pattern == "" {
+			pattern = matchRoute(patterns, r.URL.Path)
+		}
+		methods, ok := allowed[pattern]
+		if !ok {
+			h.HandleError(w, errors.Status(kivik.StatusNotFound, "missing"))
+			return
+		}
+		w.Header().Set("Allow", strings.Join(methods, ", "))
+		h.HandleError(w, errors.Statusf(kivik.StatusResourceNotAllowed, "Only %s allowed", strings.Join(methods, ",")))
+	}
+}
+
+// matchRoute returns the pattern which matches path, preferring, as chi does,
+// static segments over parameters, and parameters over catch-alls.
+func matchRoute(patterns []string, path string) string {
+	var best []string
+	var bestPattern string
+	segments := strings.Split(path, "/")
+	for _, pattern := range patterns {
+		parts := strings.Split(pattern, "/")
+		if !matchSegments(parts, segments) {
+			continue
+		}
+		if best == nil || moreSpecific(parts, best) {
+			best, bestPattern = parts, pattern
+		}
+	}
+	return bestPattern
+}
+
+func matchSegments(parts, segments []string) bool {
+	for i, part := range parts {
+		if i >= len(segments) {
+			return false
+		}
+		if part == "*" {
+			return true
+		}
+		if strings.HasPrefix(part, ":") {
+			if segments[i] == "" {
+				return false
+			}
+			continue
+		}
+		if part != segments[i] {
+			return false
+		}
+	}
+	return len(parts) == len(segments)
+}
+
+// segmentType orders the segments of a pattern by precedence.
+func segmentType(part string) int {
+	switch {
+	case part == "*":
+		return 2
+	case strings.HasPrefix(part, ":"):
+		return 1
+	}
+	return 0
+}
+
+// moreSpecific returns true if a takes precedence over b, where both match
+// the same path.
+func moreSpecific(a, b []string) bool {
+	for i := 0; i < len(a) && i < len(b); i++ {
+		if ta, tb := segmentType(a[i]), segmentType(b[i]); ta != tb {
+			return ta < tb
+		}
+	}
+	return false
+}
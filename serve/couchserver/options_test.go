@@ -0,0 +1,64 @@
+package couchserver
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/flimzy/kivik"
+)
+
+func TestAllowedMethods(t *testing.T) {
+	client, err := kivik.New(context.Background(), "memory", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	handler := (&Handler{Client: client}).Main()
+	tests := []struct {
+		name   string
+		method string
+		path   string
+		status int
+		allow  string
+	}{
+		{name: "Root", method: "OPTIONS", path: "/", status: http.StatusOK, allow: "GET, OPTIONS"},
+		{name: "DB", method: "OPTIONS", path: "/foo", status: http.StatusOK, allow: "DELETE, HEAD, OPTIONS, PUT"},
+		{name: "Doc", method: "OPTIONS", path: "/foo/bar", status: http.StatusOK, allow: "DELETE, GET, HEAD, OPTIONS, PUT"},
+		{name: "Changes", method: "OPTIONS", path: "/foo/_changes", status: http.StatusOK, allow: "GET, OPTIONS, POST"},
+		{name: "WrongMethod", method: "POST", path: "/_all_dbs", status: http.StatusMethodNotAllowed, allow: "GET, OPTIONS"},
+		{name: "UnknownMethod", method: "COPY", path: "/foo/_changes", status: http.StatusMethodNotAllowed, allow: "GET, OPTIONS, POST"},
+		{name: "UnknownMethodDoc", method: "COPY", path: "/foo/bar", status: http.StatusMethodNotAllowed, allow: "DELETE, GET, HEAD, OPTIONS, PUT"},
+		{name: "Attachment", method: "COPY", path: "/foo/bar/baz/_qux", status: http.StatusMethodNotAllowed, allow: "DELETE, GET, HEAD, OPTIONS, PUT"},
+		{name: "NoRoute", method: "COPY", path: "/foo/", status: http.StatusNotFound},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			handler.ServeHTTP(w, httptest.NewRequest(test.method, test.path, nil))
+			if w.Code != test.status {
+				t.Errorf("Unexpected status %d: %s", w.Code, w.Body.String())
+			}
+			if allow := w.Header().Get("Allow"); allow != test.allow {
+				t.Errorf("Unexpected Allow header: %q", allow)
+			}
+		})
+	}
+}
+
+func TestMatchRoute(t *testing.T) {
+	patterns := []string{"/:db", "/:db/:docid", "/:db/_changes", "/:db/:docid/*", "/_all_dbs"}
+	tests := map[string]string{
+		"/foo":           "/:db",
+		"/_all_dbs":      "/_all_dbs",
+		"/foo/_changes":  "/:db/_changes",
+		"/foo/bar":       "/:db/:docid",
+		"/foo/bar/a/b/c": "/:db/:docid/*",
+		"/":              "",
+	}
+	for path, expected := range tests {
+		if result := matchRoute(patterns, path); result != expected {
+			t.Errorf("%s: expected %q, got %q", path, expected, result)
+		}
+	}
+}
@@ -0,0 +1,212 @@
+package couchserver
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"path"
+	"strings"
+
+	"github.com/pressly/chi"
+
+	"github.com/flimzy/kivik"
+	"github.com/flimzy/kivik/errors"
+)
+
+// maxRewrites limits the number of nested rewrites of a single request, to
+// prevent rules from looping.
+const maxRewrites = 100
+
+type rewriteDepthKey struct{}
+
+// rewriteRule is a single rule of a design document's rewrites array.
+//
+// See http://docs.couchdb.org/en/2.0.0/api/ddoc/rewrites.html
+type rewriteRule struct {
+	From   string                 `json:"from"`
+	To     string                 `json:"to"`
+	Method string                 `json:"method"`
+	Query  map[string]interface{} `json:"query"`
+}
+
+func splitPath(p string) []string {
+	p = strings.Trim(p, "/")
+	if p == "" {
+		return nil
+	}
+	return strings.Split(p, "/")
+}
+
+// match matches the request method and path segments against the rule,
+// adding the variables bound by the rule's from pattern to vars. The segments
+// matched by a trailing * are bound to "*".
+func (rule *rewriteRule) match(method string, segments []string, vars map[string]string) bool {
+	if rule.Method != "" && rule.Method != "*" && !strings.EqualFold(rule.Method, method) {
+		return false
+	}
+	from := splitPath(rule.From)
+	for i, seg := range from {
+		if seg == "*" {
+			vars["*"] = strings.Join(segments[i:], "/")
+			return true
+		}
+		if i >= len(segments) {
+			return false
+		}
+		if strings.HasPrefix(seg, ":") {
+			vars[seg[1:]] = segments[i]
+			continue
+		}
+		if seg != segments[i] {
+			return false
+		}
+	}
+	return len(from) == len(segments)
+}
+
+// substitute replaces s with the variable it names, if any.
+func substitute(s string, vars map[string]string) string {
+	if s == "*" {
+		return vars["*"]
+	}
+	if strings.HasPrefix(s, ":") {
+		if value, ok := vars[s[1:]]; ok {
+			return value
+		}
+	}
+	return s
+}
+
+// substituteJSON replaces the variables in all strings within a JSON value.
+func substituteJSON(i interface{}, vars map[string]string) interface{} {
+	switch t := i.(type) {
+	case string:
+		return substitute(t, vars)
+	case []interface{}:
+		result := make([]interface{}, len(t))
+		for j, v := range t {
+			result[j] = substituteJSON(v, vars)
+		}
+		return result
+	case map[string]interface{}:
+		result := make(map[string]interface{}, len(t))
+		for k, v := range t {
+			result[k] = substituteJSON(v, vars)
+		}
+		return result
+	}
+	return i
+}
+
+// target returns the rewritten path, relative to the design document, and
+// query.
+func (rule *rewriteRule) target(vars map[string]string) (string, url.Values, error) {
+	to := splitPath(rule.To)
+	for i, seg := range to {
+		to[i] = substitute(seg, vars)
+	}
+	query := url.Values{}
+	for key, value := range rule.Query {
+		value = substituteJSON(value, vars)
+		if s, ok := value.(string); ok {
+			query.Set(key, s)
+			continue
+		}
+		encoded, err := json.Marshal(value)
+		if err != nil {
+			return "", nil, errors.WrapStatus(kivik.StatusInternalServerError, err)
+		}
+		query.Set(key, string(encoded))
+	}
+	return strings.Join(to, "/"), query, nil
+}
+
+// Rewrite handles /{db}/_design/{ddoc}/_rewrite/{path}, by rewriting the
+// request according to the design document's rewrites, and passing it to
+// router.
+func (h *Handler) Rewrite(router http.Handler) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		r, err := h.rewrite(r)
+		if err != nil {
+			h.HandleError(w, err)
+			return
+		}
+		router.ServeHTTP(w, r)
+	}
+}
+
+func (h *Handler) rewrite(r *http.Request) (*http.Request, error) {
+	depth, _ := r.Context().Value(rewriteDepthKey{}).(int)
+	if depth >= maxRewrites {
+		return nil, errors.Status(kivik.StatusBadRequest, "too many nested rewrites")
+	}
+	rules, err := h.rewriteRules(r)
+	if err != nil {
+		return nil, err
+	}
+	segments := splitPath(chi.URLParam(r, "*"))
+	query := r.URL.Query()
+	for _, rule := range rules {
+		vars := firstValues(query)
+		if !rule.match(r.Method, segments, vars) {
+			continue
+		}
+		to, ruleQuery, err := rule.target(vars)
+		if err != nil {
+			return nil, err
+		}
+		for key, values := range query {
+			if _, ok := ruleQuery[key]; !ok {
+				ruleQuery[key] = values
+			}
+		}
+		dbPath := "/" + DB(r)
+		target := path.Join(dbPath, designDocID(r), to)
+		if target != dbPath && !strings.HasPrefix(target, dbPath+"/") {
+			return nil, errors.Status(kivik.StatusForbidden, "rewrite target is outside of the database")
+		}
+		u := *r.URL
+		u.Path = target
+		u.RawPath = ""
+		u.RawQuery = ruleQuery.Encode()
+		ctx := context.WithValue(r.Context(), rewriteDepthKey{}, depth+1)
+		// A fresh routing context, so that the rewritten path is routed from
+		// the root.
+		ctx = context.WithValue(ctx, chi.RouteCtxKey, chi.NewRouteContext())
+		rewritten := r.WithContext(ctx)
+		rewritten.URL = &u
+		return rewritten, nil
+	}
+	return nil, errors.Status(kivik.StatusNotFound, "no rewrite rule matched")
+}
+
+func (h *Handler) rewriteRules(r *http.Request) ([]*rewriteRule, error) {
+	db, err := h.Client.DB(r.Context(), DB(r))
+	if err != nil {
+		return nil, err
+	}
+	row, err := db.Get(r.Context(), designDocID(r))
+	if err != nil {
+		return nil, err
+	}
+	var ddoc struct {
+		Rewrites json.RawMessage `json:"rewrites"`
+	}
+	if err = row.ScanDoc(&ddoc); err != nil {
+		return nil, err
+	}
+	raw := bytes.TrimSpace(ddoc.Rewrites)
+	if len(raw) == 0 {
+		return nil, errors.Status(kivik.StatusNotFound, "rewrites not defined")
+	}
+	if raw[0] == '"' {
+		return nil, errors.Status(kivik.StatusNotImplemented, "rewrite functions are not supported")
+	}
+	var rules []*rewriteRule
+	if err = json.Unmarshal(raw, &rules); err != nil {
+		return nil, errors.WrapStatus(kivik.StatusBadRequest, err)
+	}
+	return rules, nil
+}
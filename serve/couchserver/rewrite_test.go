@@ -0,0 +1,153 @@
+package couchserver
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/flimzy/diff"
+	"github.com/flimzy/kivik"
+)
+
+func TestRewriteRuleMatch(t *testing.T) {
+	tests := []struct {
+		name     string
+		rule     rewriteRule
+		method   string
+		path     string
+		match    bool
+		expected map[string]string
+	}{
+		{
+			name:     "Literal",
+			rule:     rewriteRule{From: "/about"},
+			path:     "about",
+			match:    true,
+			expected: map[string]string{},
+		},
+		{
+			name:     "Variable",
+			rule:     rewriteRule{From: "/users/:id"},
+			path:     "users/bob",
+			match:    true,
+			expected: map[string]string{"id": "bob"},
+		},
+		{
+			name:     "CatchAll",
+			rule:     rewriteRule{From: "/static/*"},
+			path:     "static/css/app.css",
+			match:    true,
+			expected: map[string]string{"*": "css/app.css"},
+		},
+		{
+			name:     "TooShort",
+			rule:     rewriteRule{From: "/users/:id"},
+			path:     "users",
+			expected: map[string]string{},
+		},
+		{
+			name:     "WrongMethod",
+			rule:     rewriteRule{From: "/about", Method: "POST"},
+			method:   "GET",
+			path:     "about",
+			expected: map[string]string{},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			vars := map[string]string{}
+			if match := test.rule.match(test.method, splitPath(test.path), vars); match != test.match {
+				t.Errorf("Unexpected match result: %t", match)
+			}
+			if d := diff.Interface(test.expected, vars); d != "" {
+				t.Error(d)
+			}
+		})
+	}
+}
+
+func TestRewrite(t *testing.T) {
+	ctx := context.Background()
+	client, err := kivik.New(ctx, "memory", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = client.CreateDB(ctx, "rewrites"); err != nil {
+		t.Fatal(err)
+	}
+	db, err := client.DB(ctx, "rewrites")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = db.Put(ctx, "_design/app", map[string]interface{}{
+		"rewrites": []map[string]interface{}{
+			{"from": "/users/:id", "to": "_show/user/:id", "query": map[string]interface{}{"greeting": ":greet"}},
+			{"from": "/loop", "to": "_rewrite/loop"},
+			{"from": "/escape", "to": "../../../other"},
+		},
+	}); err != nil {
+		t.Fatal(err)
+	}
+	h := &Handler{
+		Client: client,
+		Designs: map[string]*Design{
+			"_design/app": {
+				Shows: map[string]ShowFunc{
+					"user": func(_ map[string]interface{}, req *Request) (*Response, error) {
+						return &Response{Body: fmt.Sprintf("%s, %s", req.Query["greeting"], req.ID)}, nil
+					},
+				},
+			},
+		},
+	}
+	tests := []struct {
+		name     string
+		path     string
+		status   int
+		expected string
+	}{
+		{
+			name:     "Show",
+			path:     "/rewrites/_design/app/_rewrite/users/bob?greet=Hi",
+			status:   http.StatusOK,
+			expected: "Hi, bob",
+		},
+		{
+			name:   "NoMatch",
+			path:   "/rewrites/_design/app/_rewrite/nothing",
+			status: http.StatusNotFound,
+		},
+		{
+			name:   "Loop",
+			path:   "/rewrites/_design/app/_rewrite/loop",
+			status: http.StatusBadRequest,
+		},
+		{
+			name:   "Escape",
+			path:   "/rewrites/_design/app/_rewrite/escape",
+			status: http.StatusForbidden,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			req := httptest.NewRequest("GET", test.path, nil)
+			h.Main().ServeHTTP(w, req)
+			resp := w.Result()
+			defer resp.Body.Close()
+			if resp.StatusCode != test.status {
+				t.Errorf("Unexpected status: %s", resp.Status)
+			}
+			if test.expected == "" {
+				return
+			}
+			body, _ := ioutil.ReadAll(resp.Body)
+			if string(body) != test.expected {
+				t.Errorf("Unexpected body: %s", body)
+			}
+		})
+	}
+}
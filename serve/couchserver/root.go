@@ -9,10 +9,16 @@ import (
 func (h *Handler) GetRoot() http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		compatVer, vendName, vendVers := h.vendor()
+		features := h.Features
+		if features == nil {
+			features = []string{}
+		}
 		w.Header().Set("Content-Type", typeJSON)
 		h.HandleError(w, json.NewEncoder(w).Encode(serverInfo{
-			CouchDB: "Välkommen",
-			Version: compatVer,
+			CouchDB:  "Välkommen",
+			Version:  compatVer,
+			UUID:     h.UUID,
+			Features: features,
 			Vendor: vendorInfo{
 				Name:    vendName,
 				Version: vendVers,
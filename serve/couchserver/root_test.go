@@ -5,29 +5,59 @@ import (
 	"testing"
 
 	"github.com/flimzy/diff"
+	"github.com/flimzy/kivik"
 )
 
 func TestGetRoot(t *testing.T) {
-	h := Handler{
-		CompatVersion: "1.6.1",
-		Vendor:        "Acme",
-		VendorVersion: "10.0",
-	}
-	w := httptest.NewRecorder()
-	req := httptest.NewRequest("GET", "/", nil)
-	handler := h.GetRoot()
-	handler(w, req)
-	resp := w.Result()
-	defer resp.Body.Close()
-	expected := map[string]interface{}{
-		"couchdb": "Välkommen",
-		"version": "1.6.1",
-		"vendor": map[string]string{
-			"version": "10.0",
-			"name":    "Acme",
+	tests := []struct {
+		name     string
+		h        Handler
+		expected map[string]interface{}
+	}{
+		{
+			name: "Defaults",
+			expected: map[string]interface{}{
+				"couchdb":  "Välkommen",
+				"version":  CompatVersion,
+				"features": []string{},
+				"vendor": map[string]string{
+					"version": kivik.KivikVersion,
+					"name":    "Kivik",
+				},
+			},
+		},
+		{
+			name: "Custom",
+			h: Handler{
+				CompatVersion: "2.1.1",
+				Vendor:        "Acme",
+				VendorVersion: "10.0",
+				UUID:          "0f3bb1a5a4a4fb1bcbe3d9bc4d5e37c0",
+				Features:      []string{"scheduler"},
+			},
+			expected: map[string]interface{}{
+				"couchdb":  "Välkommen",
+				"version":  "2.1.1",
+				"uuid":     "0f3bb1a5a4a4fb1bcbe3d9bc4d5e37c0",
+				"features": []string{"scheduler"},
+				"vendor": map[string]string{
+					"version": "10.0",
+					"name":    "Acme",
+				},
+			},
 		},
 	}
-	if d := diff.AsJSON(expected, resp.Body); d != "" {
-		t.Error(d)
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			req := httptest.NewRequest("GET", "/", nil)
+			handler := test.h.GetRoot()
+			handler(w, req)
+			resp := w.Result()
+			defer resp.Body.Close()
+			if d := diff.AsJSON(test.expected, resp.Body); d != "" {
+				t.Error(d)
+			}
+		})
 	}
 }
@@ -0,0 +1,48 @@
+package couchserver
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/flimzy/kivik"
+	"github.com/flimzy/kivik/errors"
+)
+
+type stat struct {
+	Value int64  `json:"value"`
+	Type  string `json:"type"`
+	Desc  string `json:"desc"`
+}
+
+// GetStats handles GET /_stats, which is restricted to server admins.
+func (h *Handler) GetStats() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if err := h.requireAdmin(r); err != nil {
+			h.HandleError(w, err)
+			return
+		}
+		stats := map[string]interface{}{}
+		if h.Throttle != nil {
+			s := h.Throttle.Stats()
+			stats["couch_httpd_auth"] = map[string]stat{
+				"failed_attempts": {Value: s.Failures, Type: "counter", Desc: "number of failed authentication attempts"},
+				"lockouts":        {Value: s.Lockouts, Type: "counter", Desc: "number of account lockouts triggered"},
+				"rejected":        {Value: s.Rejected, Type: "counter", Desc: "number of authentication attempts refused due to a lockout"},
+				"locked":          {Value: int64(s.Locked), Type: "gauge", Desc: "number of user names and addresses currently locked"},
+			}
+		}
+		w.Header().Set("Content-Type", typeJSON)
+		h.HandleError(w, json.NewEncoder(w).Encode(stats))
+	}
+}
+
+// GetPrometheus handles GET /_node/_local/_prometheus
+func (h *Handler) GetPrometheus() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if h.Metrics == nil {
+			h.HandleError(w, errors.Status(kivik.StatusNotImplemented, "Prometheus metrics are not enabled"))
+			return
+		}
+		h.Metrics.ServeHTTP(w, r)
+	}
+}
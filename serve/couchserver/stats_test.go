@@ -0,0 +1,85 @@
+package couchserver
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/flimzy/diff"
+	"github.com/flimzy/kivik/auth/throttle"
+	"github.com/flimzy/kivik/authdb"
+	"github.com/flimzy/kivik/serve/stats"
+)
+
+func TestGetStats(t *testing.T) {
+	admin := &authdb.UserContext{Name: "admin", Roles: []string{"_admin"}}
+	t.Run("Access", func(t *testing.T) {
+		tests := []struct {
+			name   string
+			user   *authdb.UserContext
+			status int
+		}{
+			{name: "NoUser", status: http.StatusUnauthorized},
+			{name: "NotAdmin", user: &authdb.UserContext{Name: "bob"}, status: http.StatusForbidden},
+			{name: "Admin", user: admin, status: http.StatusOK},
+		}
+		for _, test := range tests {
+			t.Run(test.name, func(t *testing.T) {
+				h := &Handler{SessionKey: sessionKey{}}
+				w := httptest.NewRecorder()
+				h.GetStats()(w, withSession(httptest.NewRequest("GET", "/_stats", nil), test.user))
+				if w.Code != test.status {
+					t.Errorf("Unexpected status: %d", w.Code)
+				}
+			})
+		}
+	})
+	t.Run("NoThrottle", func(t *testing.T) {
+		h := &Handler{SessionKey: sessionKey{}}
+		w := httptest.NewRecorder()
+		h.GetStats()(w, withSession(httptest.NewRequest("GET", "/_stats", nil), admin))
+		if d := diff.AsJSON(map[string]interface{}{}, w.Body); d != "" {
+			t.Error(d)
+		}
+	})
+	t.Run("Throttle", func(t *testing.T) {
+		th := &throttle.Throttle{}
+		th.Failure("bob", "")
+		h := &Handler{Throttle: th, SessionKey: sessionKey{}}
+		w := httptest.NewRecorder()
+		h.GetStats()(w, withSession(httptest.NewRequest("GET", "/_stats", nil), admin))
+		expected := map[string]interface{}{
+			"couch_httpd_auth": map[string]interface{}{
+				"failed_attempts": stat{Value: 1, Type: "counter", Desc: "number of failed authentication attempts"},
+				"lockouts":        stat{Value: 0, Type: "counter", Desc: "number of account lockouts triggered"},
+				"rejected":        stat{Value: 0, Type: "counter", Desc: "number of authentication attempts refused due to a lockout"},
+				"locked":          stat{Value: 0, Type: "gauge", Desc: "number of user names and addresses currently locked"},
+			},
+		}
+		if d := diff.AsJSON(expected, w.Body); d != "" {
+			t.Error(d)
+		}
+	})
+}
+
+func TestGetPrometheus(t *testing.T) {
+	t.Run("Disabled", func(t *testing.T) {
+		h := &Handler{}
+		w := httptest.NewRecorder()
+		h.GetPrometheus()(w, httptest.NewRequest("GET", "/_node/_local/_prometheus", nil))
+		if w.Code != http.StatusNotImplemented {
+			t.Errorf("Expected 501, got %d", w.Code)
+		}
+	})
+	t.Run("Enabled", func(t *testing.T) {
+		p := stats.NewPrometheus()
+		p.Count("kivik_test_total", nil, 1)
+		h := &Handler{Metrics: p}
+		w := httptest.NewRecorder()
+		h.GetPrometheus()(w, httptest.NewRequest("GET", "/_node/_local/_prometheus", nil))
+		expected := "# TYPE kivik_test_total counter\nkivik_test_total 1\n"
+		if d := diff.Text(expected, w.Body.String()); d != "" {
+			t.Error(d)
+		}
+	})
+}
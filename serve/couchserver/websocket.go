@@ -0,0 +1,112 @@
+package couchserver
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+
+	"golang.org/x/net/websocket"
+
+	"github.com/flimzy/kivik"
+	"github.com/flimzy/kivik/errors"
+	"github.com/flimzy/kivik/serve/logger"
+)
+
+// ChangesWebSocket handles GET /{db}/_changes/ws, an experimental transport
+// for kivik clients, which streams changes over a WebSocket. It accepts the
+// query options of GET /{db}/_changes, and sends each change as a text
+// message, in the form of a line of a continuous feed. If the feed ends, as
+// after limit changes, a final message reports the last_seq, and the
+// connection is closed. Connections from browsers are accepted only from the
+// server's own origin.
+func (h *Handler) ChangesWebSocket() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		h.HandleError(w, h.changesWebSocket(w, r))
+	}
+}
+
+func (h *Handler) changesWebSocket(w http.ResponseWriter, r *http.Request) error {
+	opts, err := changesOptions(r)
+	if err != nil {
+		return err
+	}
+	delete(opts, "feed")
+	delete(opts, "heartbeat")
+	ctx, cancel := context.WithCancel(r.Context())
+	defer cancel()
+	// The feed is opened before the handshake, so that invalid requests are
+	// reported with the usual error response.
+	feed, err := h.openChangesFeed(ctx, r, opts)
+	if err != nil {
+		return err
+	}
+	var started bool
+	websocket.Server{
+		Handshake: checkWebSocketOrigin,
+		Handler: func(ws *websocket.Conn) {
+			started = true
+			h.streamWebSocket(ctx, cancel, ws, feed)
+		},
+	}.ServeHTTP(w, r)
+	if !started {
+		_ = feed.changes.Close()
+	}
+	return nil
+}
+
+func (h *Handler) streamWebSocket(ctx context.Context, cancel func(), ws *websocket.Conn, feed *changesFeed) {
+	defer func() { _ = ws.Close() }()
+	go func() {
+		// The client sends nothing, so reads end only when it disconnects.
+		_, _ = io.Copy(ioutil.Discard, ws)
+		cancel()
+	}()
+	results := make(chan *changeResult)
+	done := make(chan error, 1)
+	go func() {
+		done <- h.streamChanges(ctx, feed, results)
+	}()
+	enc := json.NewEncoder(ws)
+	var sent int
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case err := <-done:
+			if err != nil {
+				if ctx.Err() == nil {
+					h.logger().Log(logger.LevelError, "Failed to read changes feed", logger.Fields{logger.FieldError: err})
+				}
+				return
+			}
+			_ = enc.Encode(map[string]interface{}{"last_seq": feed.lastSeq()})
+			return
+		case result := <-results:
+			if err := enc.Encode(result); err != nil {
+				return
+			}
+			sent++
+			if feed.req.limit > 0 && sent >= feed.req.limit {
+				_ = enc.Encode(map[string]interface{}{"last_seq": result.Seq})
+				return
+			}
+		}
+	}
+}
+
+// checkWebSocketOrigin accepts connections without an Origin header, from
+// clients other than browsers, and those from the server's own origin, so that
+// other sites cannot open feeds with a browser's credentials.
+func checkWebSocketOrigin(_ *websocket.Config, r *http.Request) error {
+	origin := r.Header.Get("Origin")
+	if origin == "" {
+		return nil
+	}
+	if u, err := url.Parse(origin); err == nil && u.Host == r.Host {
+		return nil
+	}
+	return errors.Status(kivik.StatusForbidden, "cross-origin WebSocket connection refused")
+}
@@ -0,0 +1,113 @@
+package couchserver
+
+import (
+	"context"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"golang.org/x/net/websocket"
+
+	"github.com/flimzy/diff"
+	"github.com/flimzy/kivik"
+	_ "github.com/flimzy/kivik/driver/couchdb"
+)
+
+func TestChangesWebSocket(t *testing.T) {
+	ctx := context.Background()
+	backend, err := kivik.New(ctx, "memory", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = backend.CreateDB(ctx, "ws"); err != nil {
+		t.Fatal(err)
+	}
+	backendDB, err := backend.DB(ctx, "ws")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, id := range []string{"a", "b", "c"} {
+		if _, err = backendDB.Put(ctx, id, map[string]int{"n": i}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	h := &Handler{Client: backend, ChangesPollInterval: 10 * time.Millisecond}
+	server := httptest.NewServer(h.Main())
+	defer server.Close()
+	client, err := kivik.New(ctx, "couch", server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	db, err := client.DB(ctx, "ws")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// read returns the IDs of the next n changes of a websocket feed, or all
+	// of them if n is 0.
+	read := func(t *testing.T, n int, opts kivik.Options) []string {
+		opts["feed"] = "websocket"
+		changes, err := db.Changes(ctx, opts)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer func() { _ = changes.Close() }()
+		var ids []string
+		for (n == 0 || len(ids) < n) && changes.Next() {
+			ids = append(ids, changes.ID())
+		}
+		if err := changes.Err(); err != nil {
+			t.Fatal(err)
+		}
+		return ids
+	}
+
+	t.Run("Limit", func(t *testing.T) {
+		ids := read(t, 0, kivik.Options{"since": "0", "limit": 2})
+		if d := diff.Interface([]string{"a", "b"}, ids); d != "" {
+			t.Error(d)
+		}
+	})
+	t.Run("Filter", func(t *testing.T) {
+		ids := read(t, 2, kivik.Options{"since": "0", "filter": "serve/even"})
+		if d := diff.Interface([]string{"a", "c"}, ids); d != "" {
+			t.Error(d)
+		}
+	})
+	t.Run("Poll", func(t *testing.T) {
+		go func() {
+			time.Sleep(50 * time.Millisecond)
+			_, _ = backendDB.Put(ctx, "d", map[string]int{"n": 3})
+		}()
+		ids := read(t, 1, kivik.Options{"since": "3"})
+		if d := diff.Interface([]string{"d"}, ids); d != "" {
+			t.Error(d)
+		}
+	})
+	t.Run("InvalidOption", func(t *testing.T) {
+		_, err := db.Changes(ctx, kivik.Options{"feed": "websocket", "limit": "x"})
+		if status := kivik.StatusCode(err); status != kivik.StatusBadRequest {
+			t.Errorf("Expected status %d, got %d: %v", kivik.StatusBadRequest, status, err)
+		}
+	})
+	t.Run("CrossOrigin", func(t *testing.T) {
+		location := "ws" + strings.TrimPrefix(server.URL, "http") + "/ws/_changes/ws"
+		if _, err := websocket.Dial(location, "", "http://example.com"); err == nil {
+			t.Error("Expected a cross-origin connection to be refused")
+		}
+		ws, err := websocket.Dial(location+"?since=0&limit=1", "", server.URL)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer func() { _ = ws.Close() }()
+		var change struct {
+			ID string `json:"id"`
+		}
+		if err := websocket.JSON.Receive(ws, &change); err != nil {
+			t.Fatal(err)
+		}
+		if change.ID != "a" {
+			t.Errorf("Unexpected change: %s", change.ID)
+		}
+	})
+}
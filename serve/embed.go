@@ -0,0 +1,96 @@
+package serve
+
+import (
+	"net/http"
+
+	"github.com/flimzy/kivik"
+	"github.com/flimzy/kivik/auth"
+	"github.com/flimzy/kivik/authdb"
+	"github.com/flimzy/kivik/errors"
+	"github.com/flimzy/kivik/serve/conf"
+	"github.com/flimzy/kivik/serve/logger"
+)
+
+// Option configures the Service of a handler returned by NewHandler.
+type Option func(*embedding)
+
+type embedding struct {
+	service *Service
+	prefix  string
+}
+
+// WithClient sets the client of the backend to serve. It is required.
+func WithClient(client *kivik.Client) Option {
+	return func(e *embedding) { e.service.Client = client }
+}
+
+// WithAuth sets the auth handlers, and the user store with which they
+// authenticate users. Without them, the handler is an admin party.
+func WithAuth(store authdb.UserStore, handlers ...auth.Handler) Option {
+	return func(e *embedding) {
+		e.service.UserStore = store
+		e.service.AuthHandlers = append(e.service.AuthHandlers, handlers...)
+	}
+}
+
+// WithConfig sets the config. If unset, an empty config is used, rather than
+// one loaded from a config file, as by Service.Start.
+func WithConfig(c *conf.Conf) Option {
+	return func(e *embedding) { e.service.Config = c }
+}
+
+// WithLogger sets the logger of the server's log messages, and, if set, of
+// each request.
+func WithLogger(l logger.Logger, requests logger.RequestLogger) Option {
+	return func(e *embedding) {
+		e.service.Logger = l
+		e.service.RequestLogger = requests
+	}
+}
+
+// WithPrefix mounts the handler under prefix, such as "/couchdb", as with
+// Mux.Mount, so that it may be registered with an application's mux for that
+// prefix, without stripping it.
+func WithPrefix(prefix string) Option {
+	return func(e *embedding) { e.prefix = prefix }
+}
+
+// WithService applies fn to the Service, to set any of its fields not
+// covered by another Option.
+func WithService(fn func(*Service)) Option {
+	return func(e *embedding) { fn(e.service) }
+}
+
+// NewHandler returns a handler which serves the CouchDB API of a Service
+// configured by opts, so that it may be embedded in an application's HTTP
+// server:
+//
+//	handler, err := serve.NewHandler(
+//	    serve.WithClient(client),
+//	    serve.WithAuth(store, &basic.HTTPBasicAuth{}),
+//	    serve.WithPrefix("/couchdb"),
+//	)
+//	if err != nil {
+//	    return err
+//	}
+//	mux.Handle("/couchdb/", handler)
+func NewHandler(opts ...Option) (http.Handler, error) {
+	e := &embedding{service: &Service{}}
+	for _, opt := range opts {
+		opt(e)
+	}
+	if e.service.Client == nil {
+		return nil, errors.Status(kivik.StatusBadRequest, "serve: a client is required")
+	}
+	if e.service.Config == nil {
+		e.service.Config = conf.New()
+	}
+	if e.prefix == "" || e.prefix == "/" {
+		return e.service.Init()
+	}
+	mux := &Mux{}
+	if err := mux.Mount(e.prefix, e.service); err != nil {
+		return nil, err
+	}
+	return mux.Init()
+}
@@ -0,0 +1,66 @@
+package serve
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/flimzy/diff"
+	"github.com/flimzy/kivik"
+	_ "github.com/flimzy/kivik/driver/memory"
+)
+
+func TestNewHandler(t *testing.T) {
+	if _, err := NewHandler(); kivik.StatusCode(err) != kivik.StatusBadRequest {
+		t.Errorf("Expected bad request without a client, got %v", err)
+	}
+	ctx := context.Background()
+	client, err := kivik.New(ctx, "memory", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = client.CreateDB(ctx, "foo"); err != nil {
+		t.Fatal(err)
+	}
+	handler, err := NewHandler(
+		WithClient(client),
+		WithPrefix("/couchdb"),
+		WithService(func(s *Service) { s.VendorName = "embedded" }),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	mux := http.NewServeMux()
+	mux.Handle("/couchdb/", handler)
+	mux.HandleFunc("/app", func(w http.ResponseWriter, _ *http.Request) {
+		_, _ = w.Write([]byte("app"))
+	})
+	get := func(path string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		mux.ServeHTTP(w, httptest.NewRequest("GET", path, nil))
+		return w
+	}
+	var root struct {
+		Vendor struct {
+			Name string `json:"name"`
+		} `json:"vendor"`
+	}
+	if err = json.Unmarshal(get("/couchdb/").Body.Bytes(), &root); err != nil {
+		t.Fatal(err)
+	}
+	if root.Vendor.Name != "embedded" {
+		t.Errorf("Unexpected vendor: %s", root.Vendor.Name)
+	}
+	var dbs []string
+	if err = json.Unmarshal(get("/couchdb/_all_dbs").Body.Bytes(), &dbs); err != nil {
+		t.Fatal(err)
+	}
+	if d := diff.Interface([]string{"_replicator", "_users", "foo"}, dbs); d != "" {
+		t.Error(d)
+	}
+	if body := get("/app").Body.String(); body != "app" {
+		t.Errorf("Unexpected response of the application: %s", body)
+	}
+}
@@ -0,0 +1,136 @@
+package serve
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/flimzy/kivik"
+	"github.com/flimzy/kivik/serve/logger"
+)
+
+// DefaultHousekeepingInterval is the default interval between housekeeping
+// runs, used if housekeeping.interval is unset.
+const DefaultHousekeepingInterval = time.Hour
+
+// ExpiredSessionPurger is an optional interface which may be satisfied by an
+// auth.Handler which stores sessions server-side, to remove those which have
+// expired during housekeeping.
+type ExpiredSessionPurger interface {
+	// PurgeExpiredSessions removes the sessions which expired before now,
+	// and returns the number removed.
+	PurgeExpiredSessions(ctx context.Context, now time.Time) (int, error)
+}
+
+// HousekeepingRun reports the results of a housekeeping run.
+type HousekeepingRun struct {
+	Started  time.Time `json:"started"`
+	Finished time.Time `json:"finished"`
+	// SessionsPurged is the number of expired sessions removed.
+	SessionsPurged int `json:"sessions_purged"`
+	// ViewsCleaned are the databases whose orphaned view indexes were
+	// cleaned up.
+	ViewsCleaned []string `json:"views_cleaned"`
+	// Errors are the failures of the run, which does not stop at the first.
+	Errors []string `json:"errors,omitempty"`
+}
+
+// HousekeepingStatus reports the schedule and last results of housekeeping,
+// as by GET /_kivik/housekeeping.
+type HousekeepingStatus struct {
+	Enabled  bool             `json:"enabled"`
+	Interval string           `json:"interval,omitempty"`
+	NextRun  *time.Time       `json:"next_run,omitempty"`
+	LastRun  *HousekeepingRun `json:"last_run,omitempty"`
+}
+
+// housekeepingSetup starts periodic housekeeping, if enabled by
+// housekeeping.enable.
+func (s *Service) housekeepingSetup() {
+	if !s.Conf().GetBool("housekeeping.enable") {
+		return
+	}
+	interval := s.Conf().GetDuration("housekeeping.interval")
+	if interval <= 0 {
+		interval = DefaultHousekeepingInterval
+	}
+	s.housekeepingMU.Lock()
+	s.housekeeping.Enabled = true
+	s.housekeeping.Interval = interval.String()
+	s.housekeepingMU.Unlock()
+	go func() {
+		for {
+			s.Housekeep(context.Background())
+			next := s.Now().Add(interval)
+			s.housekeepingMU.Lock()
+			s.housekeeping.NextRun = &next
+			s.housekeepingMU.Unlock()
+			time.Sleep(interval)
+		}
+	}()
+}
+
+// Housekeep purges the expired sessions of each auth handler which
+// implements ExpiredSessionPurger, and cleans up the view indexes of every
+// database which are no longer used by any design document, such as those of
+// deleted design documents. Failures are logged, and reported in the result,
+// rather than stopping the run.
+//
+// Housekeep is called periodically, every housekeeping.interval, when
+// housekeeping.enable is true, and by POST /_kivik/housekeeping.
+func (s *Service) Housekeep(ctx context.Context) *HousekeepingRun {
+	run := &HousekeepingRun{Started: s.Now(), ViewsCleaned: []string{}}
+	fail := func(msg string, err error) {
+		run.Errors = append(run.Errors, fmt.Sprintf("%s: %s", msg, err))
+		s.logger().Log(logger.LevelError, msg, logger.Fields{logger.FieldError: err})
+	}
+	now := s.Now()
+	for _, name := range s.authHandlerNames {
+		purger, ok := s.authHandlers[name].(ExpiredSessionPurger)
+		if !ok {
+			continue
+		}
+		n, err := purger.PurgeExpiredSessions(ctx, now)
+		run.SessionsPurged += n
+		if err != nil {
+			fail("Failed to purge expired "+name+" sessions", err)
+		}
+	}
+	dbNames, err := s.Client.AllDBs(ctx)
+	if err != nil {
+		fail("Failed to list databases for view cleanup", err)
+	}
+	sort.Strings(dbNames)
+	for _, dbName := range dbNames {
+		db, err := s.Client.DB(ctx, dbName)
+		if err == nil {
+			err = db.ViewCleanup(ctx)
+		}
+		switch {
+		case kivik.StatusCode(err) == kivik.StatusNotImplemented:
+		case err != nil:
+			fail("Failed to clean up the view indexes of "+dbName, err)
+		default:
+			run.ViewsCleaned = append(run.ViewsCleaned, dbName)
+		}
+	}
+	run.Finished = s.Now()
+	s.logger().Log(logger.LevelInfo, "Housekeeping complete", logger.Fields{
+		"sessions_purged": run.SessionsPurged,
+		"views_cleaned":   len(run.ViewsCleaned),
+		"errors":          len(run.Errors),
+	})
+	s.housekeepingMU.Lock()
+	s.housekeeping.LastRun = run
+	s.housekeepingMU.Unlock()
+	return run
+}
+
+// Housekeeping returns the schedule of periodic housekeeping, and the results
+// of the last run.
+func (s *Service) Housekeeping() HousekeepingStatus {
+	s.housekeepingMU.Lock()
+	defer s.housekeepingMU.Unlock()
+	return s.housekeeping
+}
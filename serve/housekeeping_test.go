@@ -0,0 +1,91 @@
+package serve
+
+import (
+	"context"
+	"net/http"
+	"runtime"
+	"testing"
+	"time"
+
+	"github.com/flimzy/kivik"
+	"github.com/flimzy/kivik/auth"
+	"github.com/flimzy/kivik/authdb"
+	"github.com/flimzy/kivik/serve/conf"
+)
+
+// purgingAuth is an auth handler which stores expiry times of sessions.
+type purgingAuth struct {
+	expires []time.Time
+}
+
+func (a *purgingAuth) MethodName() string { return "purging" }
+
+func (a *purgingAuth) Authenticate(_ http.ResponseWriter, _ *http.Request) (*authdb.UserContext, error) {
+	return nil, nil
+}
+
+func (a *purgingAuth) PurgeExpiredSessions(_ context.Context, now time.Time) (int, error) {
+	var kept []time.Time
+	for _, expires := range a.expires {
+		if expires.After(now) {
+			kept = append(kept, expires)
+		}
+	}
+	purged := len(a.expires) - len(kept)
+	a.expires = kept
+	return purged, nil
+}
+
+func TestHousekeep(t *testing.T) {
+	ctx := context.Background()
+	client, err := kivik.New(ctx, "memory", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	now := time.Date(2017, 1, 1, 0, 0, 0, 0, time.UTC)
+	a := &purgingAuth{expires: []time.Time{now.Add(-time.Hour), now.Add(-time.Minute), now.Add(time.Hour)}}
+	s := &Service{
+		Client:       client,
+		Config:       conf.New(),
+		AuthHandlers: []auth.Handler{a},
+		Clock:        func() time.Time { return now },
+	}
+	s.authHandlersSetup()
+	run := s.Housekeep(ctx)
+	if run.SessionsPurged != 2 {
+		t.Errorf("Expected 2 sessions purged, got %d", run.SessionsPurged)
+	}
+	if len(a.expires) != 1 {
+		t.Errorf("Expected 1 session to remain, got %d", len(a.expires))
+	}
+	// The memory driver does not support view cleanup, which is skipped.
+	if len(run.ViewsCleaned) != 0 || len(run.Errors) != 0 {
+		t.Errorf("Unexpected view cleanup results: %v, %v", run.ViewsCleaned, run.Errors)
+	}
+	if status := s.Housekeeping(); status.LastRun != run || status.Enabled {
+		t.Errorf("Unexpected status: %+v", status)
+	}
+}
+
+func TestHousekeepingSchedule(t *testing.T) {
+	client, err := kivik.New(context.Background(), "memory", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	c := conf.New()
+	c.Set("housekeeping.enable", true)
+	c.Set("housekeeping.interval", "1h")
+	s := &Service{Client: client, Config: c}
+	s.housekeepingSetup()
+	deadline := time.Now().Add(5 * time.Second)
+	for s.Housekeeping().NextRun == nil {
+		if time.Now().After(deadline) {
+			t.Fatal("Housekeeping did not run")
+		}
+		runtime.Gosched()
+	}
+	status := s.Housekeeping()
+	if !status.Enabled || status.Interval != "1h0m0s" || status.LastRun == nil {
+		t.Errorf("Unexpected status: %+v", status)
+	}
+}
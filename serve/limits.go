@@ -0,0 +1,95 @@
+package serve
+
+import (
+	"io"
+	"net/http"
+
+	"github.com/flimzy/kivik"
+	"github.com/flimzy/kivik/errors"
+)
+
+// DefaultMaxRequestSize is the default value of httpd.max_http_request_size,
+// the maximum size of a request body, in bytes, as in CouchDB.
+const DefaultMaxRequestSize = 4294967296
+
+// errTooLarge is returned when reading a request body larger than
+// httpd.max_http_request_size.
+var errTooLarge = errors.Status(kivik.StatusRequestEntityTooLarge, "Request entity too large")
+
+// maxRequestSize returns the configured maximum request body size.
+func (s *Service) maxRequestSize() int64 {
+	if !s.Conf().IsSet("httpd.max_http_request_size") {
+		return DefaultMaxRequestSize
+	}
+	return s.Conf().GetInt64("httpd.max_http_request_size")
+}
+
+// bodyLimitHandler refuses requests with a body larger than
+// httpd.max_http_request_size with 413 Request Entity Too Large. A request
+// which declares a larger Content-Length is refused before its body is read.
+// Otherwise, the body is limited, so that reading beyond the limit fails with
+// the same status, and the connection is closed. A size of 0 or less disables
+// the limit.
+func bodyLimitHandler(s *Service) func(http.Handler) http.Handler {
+	limit := s.maxRequestSize()
+	return func(next http.Handler) http.Handler {
+		if limit <= 0 {
+			return next
+		}
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.ContentLength > limit {
+				w.Header().Set("Connection", "close")
+				reportError(w, errTooLarge)
+				return
+			}
+			if r.Body != nil {
+				r.Body = &limitedBody{ReadCloser: http.MaxBytesReader(w, r.Body, limit)}
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// limitedBody replaces the error returned by an http.MaxBytesReader with
+// errTooLarge, so that handlers report the appropriate status.
+type limitedBody struct {
+	io.ReadCloser
+	tooLarge bool
+}
+
+func (b *limitedBody) Read(p []byte) (int, error) {
+	if b.tooLarge {
+		return 0, errTooLarge
+	}
+	n, err := b.ReadCloser.Read(p)
+	if err != nil && err != io.EOF {
+		// The error returned by MaxBytesReader has no exported type.
+		if err.Error() == "http: request body too large" {
+			b.tooLarge = true
+			err = errTooLarge
+		}
+	}
+	return n, err
+}
+
+// HTTPServer returns an http.Server which serves handler, as returned by Init,
+// at addr, with the timeouts set by the config, as durations such as "30s":
+//
+//   - httpd.read_timeout limits the time to read a request, including its
+//     body, so that a slow client cannot hold a connection indefinitely.
+//   - httpd.write_timeout limits the time to write a response. As it also
+//     limits continuous changes feeds, it is unset by default.
+//   - httpd.header_timeout limits the time to read the request headers.
+//     Defaults to DefaultHeaderTimeout. Requires Go 1.8.
+//   - httpd.idle_timeout limits the time an idle keep-alive connection is
+//     kept open. Requires Go 1.8.
+func (s *Service) HTTPServer(addr string, handler http.Handler) *http.Server {
+	server := &http.Server{
+		Addr:         addr,
+		Handler:      handler,
+		ReadTimeout:  s.Conf().GetDuration("httpd.read_timeout"),
+		WriteTimeout: s.Conf().GetDuration("httpd.write_timeout"),
+	}
+	s.setServerTimeouts(server)
+	return server
+}
@@ -0,0 +1,55 @@
+package serve
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/flimzy/kivik"
+	"github.com/flimzy/kivik/serve/conf"
+)
+
+func TestBodyLimitHandler(t *testing.T) {
+	c := conf.New()
+	c.Set("httpd.max_http_request_size", 10)
+	s := &Service{Config: c}
+	next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if _, err := ioutil.ReadAll(r.Body); err != nil {
+			reportError(w, err)
+		}
+	})
+	tests := []struct {
+		name   string
+		body   string
+		length int64
+		status int
+	}{
+		{name: "Small", body: "0123456789", length: 10, status: http.StatusOK},
+		{name: "ContentLength", body: "0123456789x", length: 11, status: kivik.StatusRequestEntityTooLarge},
+		{name: "Chunked", body: strings.Repeat("x", 100), length: -1, status: kivik.StatusRequestEntityTooLarge},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			req := httptest.NewRequest("POST", "/foo/_bulk_docs", strings.NewReader(test.body))
+			req.ContentLength = test.length
+			w := httptest.NewRecorder()
+			bodyLimitHandler(s)(next).ServeHTTP(w, req)
+			if w.Code != test.status {
+				t.Errorf("Unexpected status %d: %s", w.Code, w.Body.String())
+			}
+		})
+	}
+}
+
+func TestHTTPServer(t *testing.T) {
+	c := conf.New()
+	c.Set("httpd.read_timeout", "30s")
+	s := &Service{Config: c}
+	server := s.HTTPServer(":5984", http.NotFoundHandler())
+	if server.Addr != ":5984" || server.ReadTimeout != 30*time.Second || server.WriteTimeout != 0 {
+		t.Errorf("Unexpected server: %+v", server)
+	}
+}
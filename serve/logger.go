@@ -1,10 +1,17 @@
 package serve
 
 import (
+	"bufio"
+	"errors"
+	"net"
 	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
 	"time"
 
 	"github.com/flimzy/kivik/serve/logger"
+	"github.com/flimzy/kivik/serve/stats"
 )
 
 type statusWriter struct {
@@ -24,6 +31,26 @@ func (w *statusWriter) Write(b []byte) (int, error) {
 	return n, err
 }
 
+// Flush flushes the underlying ResponseWriter, if it is an http.Flusher, so
+// that streamed responses, such as eventsource changes feeds, are not held
+// back by the logger.
+func (w *statusWriter) Flush() {
+	if flusher, ok := w.ResponseWriter.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
+
+// Hijack hijacks the connection of the underlying ResponseWriter, if it is an
+// http.Hijacker, as for WebSocket changes feeds.
+func (w *statusWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	hijacker, ok := w.ResponseWriter.(http.Hijacker)
+	if !ok {
+		return nil, nil, errors.New("connection does not support hijacking")
+	}
+	w.status = http.StatusSwitchingProtocols
+	return hijacker.Hijack()
+}
+
 func loggerMiddleware(rlog logger.RequestLogger) func(http.Handler) http.Handler {
 	return func(next http.Handler) http.Handler {
 		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
@@ -45,3 +72,62 @@ func loggerMiddleware(rlog logger.RequestLogger) func(http.Handler) http.Handler
 		})
 	}
 }
+
+// slowRequestHandler logs, at LevelWarn, each request which takes longer than
+// log.slow_request_threshold, such as "500ms", with its method, path,
+// database, elapsed time and query options, to help find unindexed queries,
+// or patterns of many small requests. A threshold of 0, the default, disables
+// the log.
+func slowRequestHandler(s *Service) func(http.Handler) http.Handler {
+	threshold := s.Conf().GetDuration("log.slow_request_threshold")
+	return func(next http.Handler) http.Handler {
+		if threshold <= 0 {
+			return next
+		}
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			start := time.Now()
+			next.ServeHTTP(w, r)
+			elapsed := time.Since(start)
+			if elapsed < threshold {
+				return
+			}
+			db := strings.SplitN(strings.TrimPrefix(r.URL.Path, "/"), "/", 2)[0]
+			if unescaped, err := url.QueryUnescape(db); err == nil {
+				db = unescaped
+			}
+			if strings.HasPrefix(db, "_") {
+				db = ""
+			}
+			options := make(map[string]string)
+			for key, values := range r.URL.Query() {
+				options[key] = strings.Join(values, ",")
+			}
+			s.logger().Log(logger.LevelWarn, "Slow request", logger.Fields{
+				logger.FieldMethod:      r.Method,
+				logger.FieldPath:        r.URL.Path,
+				logger.FieldDB:          db,
+				logger.FieldElapsedTime: elapsed,
+				logger.FieldOptions:     options,
+			})
+		})
+	}
+}
+
+func statsMiddleware(c stats.Collector) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			start := time.Now()
+			sw := &statusWriter{ResponseWriter: w}
+			next.ServeHTTP(sw, r)
+			status := sw.status
+			if status == 0 {
+				status = http.StatusOK
+			}
+			c.Count(stats.MetricRequests, stats.Labels{
+				stats.LabelMethod: r.Method,
+				stats.LabelStatus: strconv.Itoa(status),
+			}, 1)
+			c.Observe(stats.MetricRequestDuration, stats.Labels{stats.LabelMethod: r.Method}, time.Since(start).Seconds())
+		})
+	}
+}
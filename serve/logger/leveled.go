@@ -0,0 +1,146 @@
+package logger
+
+import (
+	"bytes"
+	"fmt"
+	"log"
+	"os"
+	"sort"
+	"strings"
+)
+
+// Level is the severity of a log message.
+type Level int
+
+// Log levels, in increasing order of severity.
+const (
+	LevelDebug Level = iota
+	LevelInfo
+	LevelWarn
+	LevelError
+)
+
+func (l Level) String() string {
+	switch l {
+	case LevelDebug:
+		return "debug"
+	case LevelInfo:
+		return "info"
+	case LevelWarn:
+		return "warn"
+	case LevelError:
+		return "error"
+	}
+	return fmt.Sprintf("level(%d)", int(l))
+}
+
+// Pre-defined fields of server log messages.
+const (
+	FieldError      = "error"
+	FieldRemoteAddr = "remote_addr"
+	FieldAuthMethod = "auth_method"
+	FieldConfigFile = "config_file"
+	FieldAddress    = "address"
+	FieldMethod     = "method"
+	FieldPath       = "path"
+	FieldDB         = "db"
+	FieldOptions    = "options"
+)
+
+// Logger is a leveled, structured logger for the messages of the server, as
+// opposed to the per-request log of a RequestLogger. fields may be nil.
+type Logger interface {
+	Log(level Level, msg string, fields Fields)
+}
+
+// LoggerFunc is an adaptor to allow the use of an ordinary function as a
+// Logger. It may be used to adapt loggers for which no adaptor is provided,
+// such as logrus:
+//
+//	logger.LoggerFunc(func(level logger.Level, msg string, fields logger.Fields) {
+//		entry := log.WithFields(logrus.Fields(fields))
+//		switch level {
+//		case logger.LevelDebug:
+//			entry.Debug(msg)
+//		...
+//		}
+//	})
+type LoggerFunc func(level Level, msg string, fields Fields)
+
+var _ Logger = LoggerFunc(nil)
+
+// Log calls fn(level, msg, fields).
+func (fn LoggerFunc) Log(level Level, msg string, fields Fields) {
+	fn(level, msg, fields)
+}
+
+type stdLogger struct {
+	l        *log.Logger
+	minLevel Level
+}
+
+// NewStdLogger returns a Logger which writes messages of minLevel or above to
+// l, in the form:
+//
+//	[warn] message key1=value1 key2=value2
+//
+// with fields sorted by key.
+func NewStdLogger(l *log.Logger, minLevel Level) Logger {
+	return &stdLogger{l: l, minLevel: minLevel}
+}
+
+// DefaultServerLogger logs messages of LevelInfo and above to stderr.
+var DefaultServerLogger = NewStdLogger(log.New(os.Stderr, "", log.LstdFlags), LevelInfo)
+
+func (s *stdLogger) Log(level Level, msg string, fields Fields) {
+	if level < s.minLevel {
+		return
+	}
+	buf := &bytes.Buffer{}
+	fmt.Fprintf(buf, "[%s] %s", level, msg)
+	keys := make([]string, 0, len(fields))
+	for key := range fields {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		value := fmt.Sprintf("%v", fields[key])
+		if value == "" || strings.ContainsAny(value, " \t\n\"=") {
+			value = fmt.Sprintf("%q", value)
+		}
+		fmt.Fprintf(buf, " %s=%s", key, value)
+	}
+	s.l.Print(buf.String())
+}
+
+// SugaredLogger is the interface of structured loggers which take fields as
+// alternating keys and values, such as zap's *SugaredLogger.
+type SugaredLogger interface {
+	Debugw(msg string, keysAndValues ...interface{})
+	Infow(msg string, keysAndValues ...interface{})
+	Warnw(msg string, keysAndValues ...interface{})
+	Errorw(msg string, keysAndValues ...interface{})
+}
+
+// NewSugaredLogger returns a Logger which writes to l.
+func NewSugaredLogger(l SugaredLogger) Logger {
+	return LoggerFunc(func(level Level, msg string, fields Fields) {
+		kv := make([]interface{}, 0, 2*len(fields))
+		for key, value := range fields {
+			kv = append(kv, key, value)
+		}
+		switch level {
+		case LevelDebug:
+			l.Debugw(msg, kv...)
+		case LevelInfo:
+			l.Infow(msg, kv...)
+		case LevelWarn:
+			l.Warnw(msg, kv...)
+		default:
+			l.Errorw(msg, kv...)
+		}
+	})
+}
+
+// Discard is a Logger which discards all messages.
+var Discard Logger = LoggerFunc(func(Level, string, Fields) {})
@@ -0,0 +1,84 @@
+package logger
+
+import (
+	"bytes"
+	"errors"
+	"log"
+	"testing"
+
+	"github.com/flimzy/diff"
+)
+
+func TestStdLogger(t *testing.T) {
+	tests := []struct {
+		name     string
+		level    Level
+		msg      string
+		fields   Fields
+		expected string
+	}{
+		{
+			name:     "NoFields",
+			level:    LevelWarn,
+			msg:      "foo",
+			expected: "[warn] foo\n",
+		},
+		{
+			name:     "BelowMinimum",
+			level:    LevelDebug,
+			msg:      "foo",
+			expected: "",
+		},
+		{
+			name:  "Fields",
+			level: LevelError,
+			msg:   "Failed",
+			fields: Fields{
+				"b":     123,
+				"a":     "bar",
+				"error": errors.New("some error"),
+				"empty": "",
+			},
+			expected: `[error] Failed a=bar b=123 empty="" error="some error"` + "\n",
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			buf := &bytes.Buffer{}
+			l := NewStdLogger(log.New(buf, "", 0), LevelInfo)
+			l.Log(test.level, test.msg, test.fields)
+			if d := diff.Text(test.expected, buf.String()); d != "" {
+				t.Error(d)
+			}
+		})
+	}
+}
+
+type sugared struct {
+	calls []string
+}
+
+func (s *sugared) log(level, msg string, kv []interface{}) {
+	s.calls = append(s.calls, level+" "+msg)
+	for _, v := range kv {
+		s.calls = append(s.calls, v.(string))
+	}
+}
+
+func (s *sugared) Debugw(msg string, kv ...interface{}) { s.log("debug", msg, kv) }
+func (s *sugared) Infow(msg string, kv ...interface{})  { s.log("info", msg, kv) }
+func (s *sugared) Warnw(msg string, kv ...interface{})  { s.log("warn", msg, kv) }
+func (s *sugared) Errorw(msg string, kv ...interface{}) { s.log("error", msg, kv) }
+
+func TestSugaredLogger(t *testing.T) {
+	s := &sugared{}
+	l := NewSugaredLogger(s)
+	l.Log(LevelDebug, "one", nil)
+	l.Log(LevelInfo, "two", nil)
+	l.Log(LevelWarn, "three", Fields{"key": "value"})
+	l.Log(LevelError, "four", nil)
+	expected := []string{"debug one", "info two", "warn three", "key", "value", "error four"}
+	if d := diff.Interface(expected, s.calls); d != "" {
+		t.Error(d)
+	}
+}
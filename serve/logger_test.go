@@ -7,10 +7,14 @@ import (
 	"net/http/httptest"
 	"regexp"
 	"testing"
+	"time"
 
+	"github.com/flimzy/diff"
 	"github.com/flimzy/kivik/auth"
 	"github.com/flimzy/kivik/authdb"
+	"github.com/flimzy/kivik/serve/conf"
 	"github.com/flimzy/kivik/serve/logger"
+	"github.com/flimzy/kivik/serve/stats"
 )
 
 func TestLogger(t *testing.T) {
@@ -54,3 +58,61 @@ func TestLoggerNoAuth(t *testing.T) {
 		t.Errorf("Log does not match. Got:\n%s\n", buf.String())
 	}
 }
+
+func TestStatsMiddleware(t *testing.T) {
+	c := stats.NewMemory()
+	mw := statsMiddleware(c)
+	for _, status := range []int{0, http.StatusNotFound, http.StatusNotFound} {
+		status := status
+		h := mw(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+			if status != 0 {
+				w.WriteHeader(status)
+			}
+		}))
+		h.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/foo", nil))
+	}
+	if n := c.Counter(stats.MetricRequests, stats.Labels{stats.LabelMethod: "GET", stats.LabelStatus: "200"}); n != 1 {
+		t.Errorf("Expected 1 200 response, got %d", n)
+	}
+	if n := c.Counter(stats.MetricRequests, stats.Labels{stats.LabelMethod: "GET", stats.LabelStatus: "404"}); n != 2 {
+		t.Errorf("Expected 2 404 responses, got %d", n)
+	}
+	if n := c.Histogram(stats.MetricRequestDuration, stats.Labels{stats.LabelMethod: "GET"}).Count; n != 3 {
+		t.Errorf("Expected 3 observed durations, got %d", n)
+	}
+}
+
+func TestSlowRequestHandler(t *testing.T) {
+	c := conf.New()
+	c.Set("log.slow_request_threshold", "10ms")
+	var entries []logger.Fields
+	s := &Service{Config: c, Logger: logger.LoggerFunc(func(level logger.Level, msg string, fields logger.Fields) {
+		if level == logger.LevelWarn && msg == "Slow request" {
+			entries = append(entries, fields)
+		}
+	})}
+	h := slowRequestHandler(s)(http.HandlerFunc(func(_ http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/foo/_find" {
+			time.Sleep(10 * time.Millisecond)
+		}
+	}))
+	h.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/foo/bar", nil))
+	h.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("POST", "/foo/_find?limit=5", nil))
+	if len(entries) != 1 {
+		t.Fatalf("Expected 1 slow request, got %d", len(entries))
+	}
+	entry := entries[0]
+	if entry.GetDuration(logger.FieldElapsedTime) < 10*time.Millisecond {
+		t.Errorf("Unexpected elapsed time: %s", entry.GetDuration(logger.FieldElapsedTime))
+	}
+	delete(entry, logger.FieldElapsedTime)
+	expected := logger.Fields{
+		logger.FieldMethod:  "POST",
+		logger.FieldPath:    "/foo/_find",
+		logger.FieldDB:      "foo",
+		logger.FieldOptions: map[string]string{"limit": "5"},
+	}
+	if d := diff.Interface(expected, entry); d != "" {
+		t.Error(d)
+	}
+}
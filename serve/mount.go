@@ -0,0 +1,115 @@
+package serve
+
+import (
+	"context"
+	"net/http"
+	"sort"
+	"strings"
+
+	"github.com/flimzy/kivik"
+	"github.com/flimzy/kivik/errors"
+)
+
+// MountContextKey is a context key used to access the path prefix under which
+// the Service handling the request is mounted by a Mux.
+var MountContextKey = &contextKey{"mount"}
+
+// Mux serves several Services under distinct path prefixes, such that a
+// single server may act as a gateway to several backends. Each Service has
+// its own Client, and so its own driver, and its own auth handlers, user
+// store and config:
+//
+//	mux := &serve.Mux{}
+//	mux.Mount("/cache", &serve.Service{Client: memoryClient})
+//	mux.Mount("/data", &serve.Service{Client: couchClient, AuthHandlers: ...})
+//	handler, err := mux.Init()
+//
+// A request for /data/foo/bar is served by the second Service as a request
+// for /foo/bar. The prefix is stripped from the request URL, and may be read
+// with MountPath.
+type Mux struct {
+	mounts []mount
+}
+
+type mount struct {
+	prefix  string
+	service *Service
+	handler http.Handler
+}
+
+// Mount mounts s under prefix, which must begin with a slash, such as
+// "/cache". A Service mounted under "/" serves all requests not matched by
+// another prefix. An error is returned if the prefix is invalid, or already
+// mounted.
+func (m *Mux) Mount(prefix string, s *Service) error {
+	if !strings.HasPrefix(prefix, "/") {
+		return errors.Statusf(kivik.StatusBadRequest, "mount prefix %q must begin with /", prefix)
+	}
+	prefix = strings.TrimSuffix(prefix, "/")
+	for _, mnt := range m.mounts {
+		if mnt.prefix == prefix {
+			return errors.Statusf(kivik.StatusConflict, "a service is already mounted at %q", prefix+"/")
+		}
+	}
+	m.mounts = append(m.mounts, mount{prefix: prefix, service: s})
+	return nil
+}
+
+// Init initializes each mounted Service, and returns the handler which serves
+// them all.
+func (m *Mux) Init() (http.Handler, error) {
+	mounts := make([]mount, len(m.mounts))
+	copy(mounts, m.mounts)
+	for i, mnt := range mounts {
+		handler, err := mnt.service.Init()
+		if err != nil {
+			return nil, errors.Wrapf(err, "init service at %s/", mnt.prefix)
+		}
+		mounts[i].handler = handler
+	}
+	// Match the longest prefixes first.
+	sort.Sort(byPrefixLength(mounts))
+	return &muxHandler{mounts: mounts}, nil
+}
+
+type byPrefixLength []mount
+
+func (m byPrefixLength) Len() int           { return len(m) }
+func (m byPrefixLength) Less(i, j int) bool { return len(m[i].prefix) > len(m[j].prefix) }
+func (m byPrefixLength) Swap(i, j int)      { m[i], m[j] = m[j], m[i] }
+
+type muxHandler struct {
+	mounts []mount
+}
+
+func (h *muxHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	for _, mnt := range h.mounts {
+		path := r.URL.Path
+		if mnt.prefix != "" {
+			if path != mnt.prefix && !strings.HasPrefix(path, mnt.prefix+"/") {
+				continue
+			}
+			path = strings.TrimPrefix(path, mnt.prefix)
+			if path == "" {
+				path = "/"
+			}
+		}
+		ctx := context.WithValue(r.Context(), MountContextKey, mnt.prefix)
+		r2 := r.WithContext(ctx)
+		u := *r.URL
+		u.Path = path
+		u.RawPath = ""
+		r2.URL = &u
+		mnt.handler.ServeHTTP(w, r2)
+		return
+	}
+	reportError(w, errors.Status(kivik.StatusNotFound, "no service is mounted at this path"))
+}
+
+// MountPath returns the path at which the Service handling r is mounted, such
+// as "/data/", or "/" if it is not mounted by a Mux. Handlers which set
+// cookies or redirect should scope them to this path.
+func MountPath(r *http.Request) string {
+	prefix, _ := r.Context().Value(MountContextKey).(string)
+	return prefix + "/"
+}
@@ -0,0 +1,86 @@
+package serve
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/flimzy/kivik"
+	"github.com/flimzy/kivik/serve/conf"
+)
+
+func TestMux(t *testing.T) {
+	mux := &Mux{}
+	for prefix, vendor := range map[string]string{
+		"/cache":     "cache",
+		"/cache/hot": "hot",
+		"/data/":     "data",
+	} {
+		if err := mux.Mount(prefix, &Service{Config: conf.New(), VendorName: vendor}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := mux.Mount("/data", &Service{}); kivik.StatusCode(err) != kivik.StatusConflict {
+		t.Errorf("Expected a conflict for a duplicate prefix, got %v", err)
+	}
+	if err := mux.Mount("data", &Service{}); kivik.StatusCode(err) != kivik.StatusBadRequest {
+		t.Errorf("Expected an error for a relative prefix, got %v", err)
+	}
+	handler, err := mux.Init()
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		path   string
+		status int
+		vendor string
+	}{
+		{path: "/cache", status: http.StatusOK, vendor: "cache"},
+		{path: "/cache/", status: http.StatusOK, vendor: "cache"},
+		{path: "/cache/hot/", status: http.StatusOK, vendor: "hot"},
+		{path: "/data/", status: http.StatusOK, vendor: "data"},
+		{path: "/database/", status: http.StatusNotFound},
+		{path: "/", status: http.StatusNotFound},
+	}
+	for _, test := range tests {
+		t.Run(test.path, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			handler.ServeHTTP(w, httptest.NewRequest("GET", test.path, nil))
+			if w.Code != test.status {
+				t.Fatalf("Expected status %d, got %d: %s", test.status, w.Code, w.Body.String())
+			}
+			if test.vendor == "" {
+				return
+			}
+			var root struct {
+				Vendor struct {
+					Name string `json:"name"`
+				} `json:"vendor"`
+			}
+			if err := json.Unmarshal(w.Body.Bytes(), &root); err != nil {
+				t.Fatal(err)
+			}
+			if root.Vendor.Name != test.vendor {
+				t.Errorf("Expected vendor %s, got %s", test.vendor, root.Vendor.Name)
+			}
+		})
+	}
+}
+
+func TestMountPath(t *testing.T) {
+	mux := &muxHandler{mounts: []mount{{
+		prefix: "/data",
+		handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			_, _ = w.Write([]byte(MountPath(r) + " " + r.URL.Path))
+		}),
+	}}}
+	w := httptest.NewRecorder()
+	mux.ServeHTTP(w, httptest.NewRequest("GET", "/data/foo", nil))
+	if body := w.Body.String(); body != "/data/ /foo" {
+		t.Errorf("Unexpected result: %s", body)
+	}
+	if path := MountPath(httptest.NewRequest("GET", "/foo", nil)); path != "/" {
+		t.Errorf("Expected / for an unmounted request, got %s", path)
+	}
+}
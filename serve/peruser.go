@@ -0,0 +1,128 @@
+package serve
+
+import (
+	"context"
+	"encoding/hex"
+	"strings"
+	"time"
+
+	"github.com/flimzy/kivik"
+	"github.com/flimzy/kivik/serve/logger"
+)
+
+// Defaults for the couch_peruser config settings.
+const (
+	DefaultUserDBPrefix     = "userdb-"
+	DefaultPerUserInterval  = 10 * time.Second
+	defaultAuthenticationDB = "_users"
+)
+
+const userDocPrefix = "org.couchdb.user:"
+
+// UserDBName returns the name of the private database of the named user, as
+// created by the couch_peruser config settings: prefix followed by the
+// hex-encoded user name.
+func UserDBName(prefix, username string) string {
+	return prefix + hex.EncodeToString([]byte(username))
+}
+
+// perUserSetup starts the provisioning of private user databases, if enabled
+// by couch_peruser.enable.
+func (s *Service) perUserSetup() {
+	if !s.Conf().GetBool("couch_peruser.enable") {
+		return
+	}
+	interval := s.Conf().GetDuration("couch_peruser.interval")
+	if interval <= 0 {
+		interval = DefaultPerUserInterval
+	}
+	go func() {
+		for {
+			if err := s.SyncUserDBs(context.Background()); err != nil {
+				s.logger().Log(logger.LevelError, "Failed to provision user databases", logger.Fields{
+					logger.FieldError: err,
+				})
+			}
+			time.Sleep(interval)
+		}
+	}()
+}
+
+// SyncUserDBs reads the changes to the authentication database since the last
+// call, and creates a private database for each new user, of which the user is
+// the only member and admin. If couch_peruser.delete_dbs is true, the
+// databases of deleted users are destroyed. Databases are named by UserDBName,
+// with the prefix set by couch_peruser.database_prefix, which defaults to
+// DefaultUserDBPrefix.
+//
+// SyncUserDBs is called periodically, every couch_peruser.interval, when
+// couch_peruser.enable is true.
+func (s *Service) SyncUserDBs(ctx context.Context) error {
+	s.perUserMU.Lock()
+	defer s.perUserMU.Unlock()
+	usersDB := s.Conf().GetString("couch_httpd_auth.authentication_db")
+	if usersDB == "" {
+		usersDB = defaultAuthenticationDB
+	}
+	prefix := s.Conf().GetString("couch_peruser.database_prefix")
+	if prefix == "" {
+		prefix = DefaultUserDBPrefix
+	}
+	deleteDBs := s.Conf().GetBool("couch_peruser.delete_dbs")
+
+	db, err := s.Client.DB(ctx, usersDB)
+	if err != nil {
+		return err
+	}
+	opts := kivik.Options{}
+	if s.perUserSeq != "" {
+		opts["since"] = s.perUserSeq
+	}
+	changes, err := db.Changes(ctx, opts)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = changes.Close() }()
+	for changes.Next() {
+		if !strings.HasPrefix(changes.ID(), userDocPrefix) {
+			s.perUserSeq = string(changes.Seq())
+			continue
+		}
+		username := strings.TrimPrefix(changes.ID(), userDocPrefix)
+		dbName := UserDBName(prefix, username)
+		if changes.Deleted() {
+			if deleteDBs {
+				err = s.Client.DestroyDB(ctx, dbName)
+				if kivik.StatusCode(err) == kivik.StatusNotFound {
+					err = nil
+				}
+			}
+		} else {
+			err = s.createUserDB(ctx, dbName, username)
+		}
+		if err != nil {
+			return err
+		}
+		s.perUserSeq = string(changes.Seq())
+	}
+	return changes.Err()
+}
+
+// createUserDB creates the private database of the named user, if it does not
+// already exist. The security object of an existing database is left
+// unchanged.
+func (s *Service) createUserDB(ctx context.Context, dbName, username string) error {
+	err := s.Client.CreateDB(ctx, dbName)
+	if kivik.StatusCode(err) == kivik.StatusPreconditionFailed {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	db, err := s.Client.DB(ctx, dbName)
+	if err != nil {
+		return err
+	}
+	members := kivik.Members{Names: []string{username}}
+	return db.SetSecurity(ctx, &kivik.Security{Admins: members, Members: members})
+}
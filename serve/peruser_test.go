@@ -0,0 +1,81 @@
+package serve
+
+import (
+	"context"
+	"testing"
+
+	"github.com/flimzy/diff"
+	"github.com/flimzy/kivik"
+	_ "github.com/flimzy/kivik/driver/memory"
+	"github.com/flimzy/kivik/serve/conf"
+)
+
+func TestUserDBName(t *testing.T) {
+	if name := UserDBName("userdb-", "bob"); name != "userdb-626f62" {
+		t.Errorf("Unexpected name: %s", name)
+	}
+}
+
+func TestSyncUserDBs(t *testing.T) {
+	ctx := context.Background()
+	client, err := kivik.New(ctx, "memory", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	users, err := client.DB(ctx, "_users")
+	if err != nil {
+		t.Fatal(err)
+	}
+	c := conf.New()
+	c.Set("couch_peruser.delete_dbs", true)
+	s := &Service{Client: client, Config: c}
+
+	rev, err := users.Put(ctx, "org.couchdb.user:bob", map[string]interface{}{
+		"name":  "bob",
+		"type":  "user",
+		"roles": []string{},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := users.Put(ctx, "_design/auth", map[string]string{}); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.SyncUserDBs(ctx); err != nil {
+		t.Fatal(err)
+	}
+	db, err := client.DB(ctx, "userdb-626f62")
+	if err != nil {
+		t.Fatal(err)
+	}
+	sec, err := db.Security(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	members := kivik.Members{Names: []string{"bob"}}
+	if d := diff.Interface(&kivik.Security{Admins: members, Members: members}, sec); d != "" {
+		t.Error(d)
+	}
+
+	// Changes already processed are not processed again, so that the
+	// database's security object may be changed.
+	if err := db.SetSecurity(ctx, &kivik.Security{}); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.SyncUserDBs(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if sec, _ := db.Security(ctx); len(sec.Admins.Names) != 0 {
+		t.Errorf("Expected the security object to be unchanged, got %v", sec)
+	}
+
+	if _, err := users.Delete(ctx, "org.couchdb.user:bob", rev); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.SyncUserDBs(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if exists, _ := client.DBExists(ctx, "userdb-626f62"); exists {
+		t.Error("Expected the user database to be destroyed")
+	}
+}
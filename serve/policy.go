@@ -0,0 +1,43 @@
+package serve
+
+import (
+	"net/http"
+
+	"github.com/flimzy/kivik"
+	"github.com/flimzy/kivik/auth/policy"
+	"github.com/flimzy/kivik/errors"
+)
+
+// policySetup loads the authorization policy from the config, if it was not
+// set explicitly.
+func (s *Service) policySetup() error {
+	if s.Policy != nil || !s.Conf().IsSet("policy.rules") {
+		return nil
+	}
+	p, err := policy.Parse(s.Conf().GetStringSlice("policy.rules"))
+	if err != nil {
+		return errors.Wrap(err, "policy.rules")
+	}
+	s.Policy = p
+	return nil
+}
+
+// policyHandler enforces the authorization policy, if any, for the
+// authenticated session.
+func policyHandler(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		s := GetService(r)
+		if s.Policy != nil {
+			user := MustGetSession(r.Context()).User
+			if !s.Policy.Allowed(user, r.Method, r.URL.Path) {
+				if user == nil {
+					reportError(w, errors.Status(kivik.StatusUnauthorized, "You are not authorized to access this resource."))
+					return
+				}
+				reportError(w, errors.Status(kivik.StatusForbidden, "You are not allowed to access this resource."))
+				return
+			}
+		}
+		next.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,61 @@
+package serve
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/flimzy/kivik/auth"
+	"github.com/flimzy/kivik/auth/policy"
+	"github.com/flimzy/kivik/authdb"
+	"github.com/flimzy/kivik/serve/conf"
+	"github.com/spf13/viper"
+)
+
+func TestPolicySetup(t *testing.T) {
+	s := &Service{Config: &conf.Conf{Viper: viper.New()}}
+	s.Conf().Set("policy.rules", []string{"deny * * /foo"})
+	if err := s.policySetup(); err != nil {
+		t.Fatal(err)
+	}
+	if s.Policy == nil || len(s.Policy.Rules) != 1 {
+		t.Errorf("Unexpected policy: %v", s.Policy)
+	}
+	s = &Service{Config: &conf.Conf{Viper: viper.New()}}
+	s.Conf().Set("policy.rules", []string{"bogus"})
+	if err := s.policySetup(); err == nil {
+		t.Error("Expected an error for an invalid rule")
+	}
+}
+
+func TestPolicyHandler(t *testing.T) {
+	p, err := policy.Parse([]string{"deny * PUT /foo/*"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := &Service{Policy: p}
+	tests := []struct {
+		name   string
+		user   *authdb.UserContext
+		method string
+		status int
+	}{
+		{name: "Allowed", method: "GET", status: http.StatusOK},
+		{name: "Anonymous", method: "PUT", status: http.StatusUnauthorized},
+		{name: "Authenticated", user: &authdb.UserContext{Name: "bob"}, method: "PUT", status: http.StatusForbidden},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			session := &auth.Session{User: test.user}
+			req := httptest.NewRequest(test.method, "/foo/bar", nil)
+			ctx := context.WithValue(req.Context(), ServiceContextKey, s)
+			ctx = context.WithValue(ctx, SessionKey, &session)
+			w := httptest.NewRecorder()
+			policyHandler(http.HandlerFunc(func(_ http.ResponseWriter, _ *http.Request) {})).ServeHTTP(w, req.WithContext(ctx))
+			if w.Code != test.status {
+				t.Errorf("Unexpected status: %d", w.Code)
+			}
+		})
+	}
+}
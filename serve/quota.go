@@ -0,0 +1,312 @@
+package serve
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"strings"
+
+	"github.com/flimzy/kivik"
+	"github.com/flimzy/kivik/authdb"
+	"github.com/flimzy/kivik/errors"
+	"github.com/flimzy/kivik/serve/logger"
+)
+
+// Quota usage, as reported by GET /_quota and GET /{db}/_quota. A limit of 0
+// means there is no limit.
+type (
+	// UserQuota reports the number of databases owned by a user.
+	UserQuota struct {
+		Name         string `json:"name"`
+		Databases    int    `json:"databases"`
+		MaxDatabases int    `json:"max_databases"`
+	}
+	// DBQuota reports the number of documents in a database, and its size.
+	DBQuota struct {
+		DB       string `json:"db_name"`
+		DocCount int64  `json:"doc_count"`
+		MaxDocs  int64  `json:"max_docs"`
+		DiskSize int64  `json:"disk_size"`
+		MaxSize  int64  `json:"max_size"`
+	}
+)
+
+// quotaHandler enforces the quotas set by the quota config settings, for
+// users other than server admins:
+//
+//   - quota.max_docs limits the number of documents in a database.
+//   - quota.max_size limits the disk size of a database, in bytes.
+//   - quota.max_dbs_per_user limits the number of databases a user may
+//     create. The owner of each database created by a user is recorded in
+//     the owners database, named by quota.owners_db, which defaults to
+//     DefaultOwnersDB, and which only server admins may access. The owner is
+//     also made an admin of the database.
+//
+// Once a database reaches max_docs, writes to it are refused with 403
+// Forbidden, and once it reaches max_size, with 507 Insufficient Storage,
+// until documents are deleted. Deletions are always allowed. The usage is
+// reported by GET /_quota, for the user, and GET /{db}/_quota.
+func quotaHandler(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		s := GetService(r)
+		user := MustGetSession(r.Context()).User
+		parts := strings.SplitN(strings.TrimPrefix(r.URL.Path, "/"), "/", 3)
+		db := parts[0]
+		switch {
+		case db == s.ownersDB() && !isAdmin(user):
+			reportError(w, errors.Status(kivik.StatusForbidden, "You are not a server admin."))
+			return
+		case r.Method == http.MethodGet && len(parts) == 1 && db == "_quota":
+			quota, err := s.userQuota(r.Context(), user)
+			reportQuota(w, quota, err)
+			return
+		case r.Method == http.MethodGet && len(parts) == 2 && parts[1] == "_quota":
+			quota, err := s.dbQuota(r.Context(), db)
+			reportQuota(w, quota, err)
+			return
+		case isAdmin(user):
+		case r.Method == http.MethodPut && len(parts) == 1 && db != "" && !strings.HasPrefix(db, "_"):
+			if err := s.checkDBQuota(r.Context(), user); err != nil {
+				reportError(w, err)
+				return
+			}
+			sw := &statusWriter{ResponseWriter: w}
+			next.ServeHTTP(sw, r)
+			if user != nil && sw.status < http.StatusMultipleChoices && s.Conf().GetInt("quota.max_dbs_per_user") > 0 {
+				s.setOwner(r.Context(), db, user.Name)
+			}
+			return
+		case isDocWrite(r.Method, parts):
+			if err := s.checkDocQuota(r.Context(), db); err != nil {
+				reportError(w, err)
+				return
+			}
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+func isAdmin(user *authdb.UserContext) bool {
+	if user == nil {
+		return false
+	}
+	for _, role := range user.Roles {
+		if role == "_admin" {
+			return true
+		}
+	}
+	return false
+}
+
+// isDocWrite returns true if the request, with the path split into the
+// database, and up to two further segments, may create or update documents.
+func isDocWrite(method string, parts []string) bool {
+	if parts[0] == "" {
+		return false
+	}
+	switch method {
+	case http.MethodPost:
+		if len(parts) == 1 {
+			return true
+		}
+		if parts[1] == "_bulk_docs" {
+			return true
+		}
+		return parts[1] == "_design" && len(parts) == 3 && strings.Contains(parts[2], "/_update/")
+	case http.MethodPut:
+		return len(parts) > 1 && parts[1] != "_security" && parts[1] != "_revs_limit"
+	case "COPY":
+		return len(parts) > 1
+	}
+	return false
+}
+
+func reportQuota(w http.ResponseWriter, quota interface{}, err error) {
+	if err != nil {
+		reportError(w, err)
+		return
+	}
+	w.Header().Set("Content-Type", typeJSON)
+	_ = json.NewEncoder(w).Encode(quota)
+}
+
+func (s *Service) userQuota(ctx context.Context, user *authdb.UserContext) (*UserQuota, error) {
+	if user == nil || user.Name == "" {
+		return nil, errors.Status(kivik.StatusUnauthorized, "You are not authorized to access this resource.")
+	}
+	owned, err := s.ownedDBs(ctx, user.Name)
+	if err != nil {
+		return nil, err
+	}
+	return &UserQuota{
+		Name:         user.Name,
+		Databases:    owned,
+		MaxDatabases: s.Conf().GetInt("quota.max_dbs_per_user"),
+	}, nil
+}
+
+func (s *Service) dbQuota(ctx context.Context, dbName string) (*DBQuota, error) {
+	db, err := s.Client.DB(ctx, dbName)
+	if err != nil {
+		return nil, err
+	}
+	stats, err := db.Stats(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return &DBQuota{
+		DB:       dbName,
+		DocCount: stats.DocCount,
+		MaxDocs:  s.Conf().GetInt64("quota.max_docs"),
+		DiskSize: stats.DiskSize,
+		MaxSize:  s.Conf().GetInt64("quota.max_size"),
+	}, nil
+}
+
+func (s *Service) checkDocQuota(ctx context.Context, dbName string) error {
+	if !s.Conf().IsSet("quota.max_docs") && !s.Conf().IsSet("quota.max_size") {
+		return nil
+	}
+	quota, err := s.dbQuota(ctx, dbName)
+	if kivik.StatusCode(err) == kivik.StatusNotFound {
+		// Let the handler report the missing database.
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if quota.MaxDocs > 0 && quota.DocCount >= quota.MaxDocs {
+		return errors.Statusf(kivik.StatusForbidden, "Database %s has reached its quota of %d documents.", dbName, quota.MaxDocs)
+	}
+	if quota.MaxSize > 0 && quota.DiskSize >= quota.MaxSize {
+		return errors.Statusf(http.StatusInsufficientStorage, "Database %s has reached its quota of %d bytes.", dbName, quota.MaxSize)
+	}
+	return nil
+}
+
+func (s *Service) checkDBQuota(ctx context.Context, user *authdb.UserContext) error {
+	limit := s.Conf().GetInt("quota.max_dbs_per_user")
+	if limit <= 0 || user == nil {
+		return nil
+	}
+	owned, err := s.ownedDBs(ctx, user.Name)
+	if err != nil {
+		return err
+	}
+	if owned >= limit {
+		return errors.Statusf(kivik.StatusForbidden, "You have reached your quota of %d databases.", limit)
+	}
+	return nil
+}
+
+// DefaultOwnersDB is the default name of the database in which the owners of
+// the databases created by users are recorded, as set by quota.owners_db.
+const DefaultOwnersDB = "kivik_owners"
+
+// dbOwner is the document recording the owner of a database, identified by
+// the name of the database.
+type dbOwner struct {
+	ID    string `json:"_id"`
+	Rev   string `json:"_rev,omitempty"`
+	Owner string `json:"owner"`
+}
+
+func (s *Service) ownersDB() string {
+	if name := s.Conf().GetString("quota.owners_db"); name != "" {
+		return name
+	}
+	return DefaultOwnersDB
+}
+
+// ownedDBs returns the number of existing databases recorded as owned by the
+// named user.
+func (s *Service) ownedDBs(ctx context.Context, name string) (int, error) {
+	owners, err := s.Client.DB(ctx, s.ownersDB())
+	if kivik.StatusCode(err) == kivik.StatusNotFound {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+	dbNames, err := s.Client.AllDBs(ctx)
+	if err != nil {
+		return 0, err
+	}
+	var owned int
+	for _, dbName := range dbNames {
+		doc, err := getOwner(ctx, owners, dbName)
+		if err != nil {
+			return 0, err
+		}
+		if doc.Owner == name {
+			owned++
+		}
+	}
+	return owned, nil
+}
+
+// getOwner returns the owner document of the named database, which is empty
+// if no owner is recorded.
+func getOwner(ctx context.Context, owners *kivik.DB, dbName string) (*dbOwner, error) {
+	doc := &dbOwner{ID: dbName}
+	row, err := owners.Get(ctx, dbName)
+	if kivik.StatusCode(err) == kivik.StatusNotFound {
+		return doc, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := row.ScanDoc(doc); err != nil {
+		return nil, err
+	}
+	return doc, nil
+}
+
+// setOwner records the named user as the owner of a newly created database,
+// so that it counts towards the user's quota, and makes the user its admin.
+func (s *Service) setOwner(ctx context.Context, dbName, name string) {
+	err := s.recordOwner(ctx, dbName, name)
+	if err == nil {
+		var db *kivik.DB
+		if db, err = s.Client.DB(ctx, dbName); err == nil {
+			err = db.SetSecurity(ctx, &kivik.Security{Admins: kivik.Members{Names: []string{name}}})
+		}
+	}
+	if err != nil {
+		s.logger().Log(logger.LevelError, "Failed to set database owner", logger.Fields{
+			logger.FieldError: err,
+		})
+	}
+}
+
+// recordOwner records the owner of a database in the owners database, which
+// is created, for server admins only, if it does not exist.
+func (s *Service) recordOwner(ctx context.Context, dbName, name string) error {
+	ownersDB := s.ownersDB()
+	exists, err := s.Client.DBExists(ctx, ownersDB)
+	if err != nil {
+		return err
+	}
+	if !exists {
+		if err := s.Client.CreateDB(ctx, ownersDB); err != nil && kivik.StatusCode(err) != kivik.StatusPreconditionFailed {
+			return err
+		}
+	}
+	owners, err := s.Client.DB(ctx, ownersDB)
+	if err != nil {
+		return err
+	}
+	if !exists {
+		adminsOnly := kivik.Members{Roles: []string{"_admin"}}
+		if err := owners.SetSecurity(ctx, &kivik.Security{Admins: adminsOnly, Members: adminsOnly}); err != nil {
+			return err
+		}
+	}
+	doc, err := getOwner(ctx, owners, dbName)
+	if err != nil {
+		return err
+	}
+	doc.Owner = name
+	_, err = owners.Put(ctx, dbName, doc)
+	return err
+}
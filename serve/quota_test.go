@@ -0,0 +1,170 @@
+package serve
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/flimzy/diff"
+	"github.com/flimzy/kivik"
+	"github.com/flimzy/kivik/auth"
+	"github.com/flimzy/kivik/authdb"
+	_ "github.com/flimzy/kivik/driver/memory"
+	"github.com/flimzy/kivik/serve/conf"
+)
+
+func TestIsDocWrite(t *testing.T) {
+	tests := []struct {
+		method   string
+		path     []string
+		expected bool
+	}{
+		{method: "POST", path: []string{"foo"}, expected: true},
+		{method: "POST", path: []string{"foo", "_bulk_docs"}, expected: true},
+		{method: "POST", path: []string{"foo", "_find"}, expected: false},
+		{method: "POST", path: []string{"foo", "_design", "bar/_update/baz"}, expected: true},
+		{method: "POST", path: []string{"foo", "_design", "bar/_view/baz"}, expected: false},
+		{method: "PUT", path: []string{"foo", "bar"}, expected: true},
+		{method: "PUT", path: []string{"foo", "_security"}, expected: false},
+		{method: "PUT", path: []string{"foo"}, expected: false},
+		{method: "COPY", path: []string{"foo", "bar"}, expected: true},
+		{method: "DELETE", path: []string{"foo", "bar"}, expected: false},
+		{method: "GET", path: []string{"foo", "bar"}, expected: false},
+	}
+	for _, test := range tests {
+		if result := isDocWrite(test.method, test.path); result != test.expected {
+			t.Errorf("%s %v: expected %t, got %t", test.method, test.path, test.expected, result)
+		}
+	}
+}
+
+func TestQuotaHandler(t *testing.T) {
+	ctx := context.Background()
+	client, err := kivik.New(ctx, "memory", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	c := conf.New()
+	c.Set("quota.max_docs", 1)
+	c.Set("quota.max_dbs_per_user", 1)
+	s := &Service{Client: client, Config: c}
+	bob := &authdb.UserContext{Name: "bob"}
+	admin := &authdb.UserContext{Name: "admin", Roles: []string{"_admin"}}
+
+	// next creates the database, or a document, as the handler would.
+	next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var err error
+		if r.URL.Path == "/foo" || r.URL.Path == "/bar" {
+			err = client.CreateDB(r.Context(), r.URL.Path[1:])
+		} else {
+			var db *kivik.DB
+			if db, err = client.DB(r.Context(), "foo"); err == nil {
+				_, err = db.Put(r.Context(), r.URL.Path[5:], map[string]string{})
+			}
+		}
+		if err != nil {
+			reportError(w, err)
+		}
+	})
+	request := func(user *authdb.UserContext, method, path string) *httptest.ResponseRecorder {
+		session := &auth.Session{User: user}
+		req := httptest.NewRequest(method, path, nil)
+		ctx := context.WithValue(req.Context(), ServiceContextKey, s)
+		ctx = context.WithValue(ctx, SessionKey, &session)
+		w := httptest.NewRecorder()
+		quotaHandler(next).ServeHTTP(w, req.WithContext(ctx))
+		return w
+	}
+
+	steps := []struct {
+		name   string
+		user   *authdb.UserContext
+		method string
+		path   string
+		status int
+	}{
+		{name: "CreateDB", user: bob, method: "PUT", path: "/foo", status: http.StatusOK},
+		{name: "DBQuota", user: bob, method: "PUT", path: "/bar", status: http.StatusForbidden},
+		{name: "CreateDoc", user: bob, method: "PUT", path: "/foo/a", status: http.StatusOK},
+		{name: "DocQuota", user: bob, method: "PUT", path: "/foo/b", status: http.StatusForbidden},
+		{name: "Admin", user: admin, method: "PUT", path: "/foo/c", status: http.StatusOK},
+	}
+	for _, step := range steps {
+		if w := request(step.user, step.method, step.path); w.Code != step.status {
+			t.Errorf("%s: unexpected status %d: %s", step.name, w.Code, w.Body.String())
+		}
+	}
+
+	w := request(bob, "GET", "/_quota")
+	var userQuota UserQuota
+	if err := json.NewDecoder(w.Body).Decode(&userQuota); err != nil {
+		t.Fatal(err)
+	}
+	if d := diff.Interface(UserQuota{Name: "bob", Databases: 1, MaxDatabases: 1}, userQuota); d != "" {
+		t.Error(d)
+	}
+	w = request(bob, "GET", "/foo/_quota")
+	var dbQuota DBQuota
+	if err := json.NewDecoder(w.Body).Decode(&dbQuota); err != nil {
+		t.Fatal(err)
+	}
+	if dbQuota.DocCount != 2 || dbQuota.MaxDocs != 1 {
+		t.Errorf("Unexpected database quota: %+v", dbQuota)
+	}
+	if w := request(nil, "GET", "/_quota"); w.Code != http.StatusUnauthorized {
+		t.Errorf("Unexpected status for an anonymous user: %d", w.Code)
+	}
+
+	// Ownership is not derived from the security object, which the owner may
+	// edit.
+	db, err := client.DB(ctx, "foo")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := db.SetSecurity(ctx, &kivik.Security{}); err != nil {
+		t.Fatal(err)
+	}
+	if w := request(bob, "PUT", "/bar"); w.Code != http.StatusForbidden {
+		t.Errorf("Unexpected status after leaving the admins: %d", w.Code)
+	}
+	if w := request(bob, "GET", "/"+DefaultOwnersDB); w.Code != http.StatusForbidden {
+		t.Errorf("Unexpected status for the owners database: %d", w.Code)
+	}
+}
+
+func TestSizeQuota(t *testing.T) {
+	for _, dbName := range []string{"foo", "a+b"} {
+		t.Run(dbName, func(t *testing.T) {
+			ctx := context.Background()
+			client, err := kivik.New(ctx, "memory", "")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := client.CreateDB(ctx, dbName); err != nil {
+				t.Fatal(err)
+			}
+			db, err := client.DB(ctx, dbName)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if _, err := db.Put(ctx, "a", map[string]string{"x": "y"}); err != nil {
+				t.Fatal(err)
+			}
+			c := conf.New()
+			c.Set("quota.max_size", 10)
+			s := &Service{Client: client, Config: c}
+			session := &auth.Session{User: &authdb.UserContext{Name: "bob"}}
+			req := httptest.NewRequest("POST", "/"+dbName, nil)
+			req = req.WithContext(context.WithValue(context.WithValue(req.Context(), ServiceContextKey, s), SessionKey, &session))
+			w := httptest.NewRecorder()
+			quotaHandler(http.HandlerFunc(func(_ http.ResponseWriter, _ *http.Request) {
+				t.Error("Expected the write to be refused")
+			})).ServeHTTP(w, req)
+			if w.Code != http.StatusInsufficientStorage {
+				t.Errorf("Unexpected status: %d", w.Code)
+			}
+		})
+	}
+}
@@ -1,9 +1,7 @@
 package serve
 
 import (
-	"fmt"
 	"net/http"
-	"os"
 
 	"github.com/NYTimes/gziphandler"
 	"github.com/justinas/alice"
@@ -15,10 +13,22 @@ import (
 func (s *Service) setupRoutes() (http.Handler, error) {
 	h := couchserver.Handler{
 		Client:        s.Client,
+		CompatVersion: s.compatVersion(),
+		UUID:          s.Conf().GetString("couchdb.uuid"),
 		Vendor:        s.VendorName,
 		VendorVersion: s.VendorVersion,
 		Favicon:       s.Favicon,
 		SessionKey:    SessionKey,
+		APIKeys:       s.APIKeys,
+		Throttle:      s.LoginThrottle,
+		Designs:       s.Designs,
+		JSEngine:      s.JSEngine,
+		Upstream:      s.Upstream,
+		LocalDBs:      s.LocalDBs,
+		Logger:        s.logger(),
+	}
+	if metrics, ok := s.Stats.(http.Handler); ok {
+		h.Metrics = metrics
 	}
 
 	rlog := s.RequestLogger
@@ -27,11 +37,17 @@ func (s *Service) setupRoutes() (http.Handler, error) {
 	}
 
 	return alice.New(
+		statsMiddleware(s.stats()),
+		slowRequestHandler(s),
+		bodyLimitHandler(s),
 		setContext(s),
 		setSession(),
 		loggerMiddleware(rlog),
 		gzipHandler(s),
 		authHandler,
+		policyHandler,
+		adminHandler,
+		quotaHandler,
 	).Then(h.Main()), nil
 }
 
@@ -42,11 +58,14 @@ func gzipHandler(s *Service) func(http.Handler) http.Handler {
 	}
 	gzipHandler, err := gziphandler.NewGzipLevelHandler(int(level))
 	if err != nil {
-		fmt.Fprintf(os.Stderr, "invalid httpd.compression_level %d\n", level)
+		s.logger().Log(logger.LevelError, "Invalid httpd.compression_level", logger.Fields{
+			"compression_level": level,
+			logger.FieldError:   err,
+		})
 		return func(h http.Handler) http.Handler {
 			return h
 		}
 	}
-	fmt.Fprintf(os.Stderr, "Enabling gzip compression, level %d\n", level)
+	s.logger().Log(logger.LevelInfo, "Enabling gzip compression", logger.Fields{"compression_level": level})
 	return gzipHandler
 }
@@ -2,20 +2,24 @@ package serve
 
 import (
 	"context"
-	"encoding/json"
 	"fmt"
 	"net/http"
-	"os"
 	"strconv"
 	"strings"
 	"sync"
+	"time"
 
 	"github.com/flimzy/kivik"
 	"github.com/flimzy/kivik/auth"
+	"github.com/flimzy/kivik/auth/apikey"
+	"github.com/flimzy/kivik/auth/policy"
+	"github.com/flimzy/kivik/auth/throttle"
 	"github.com/flimzy/kivik/authdb"
 	"github.com/flimzy/kivik/errors"
 	"github.com/flimzy/kivik/serve/conf"
+	"github.com/flimzy/kivik/serve/couchserver"
 	"github.com/flimzy/kivik/serve/logger"
+	"github.com/flimzy/kivik/serve/stats"
 )
 
 // Service defines a CouchDB-like service to serve. You will define one of these
@@ -31,6 +35,16 @@ type Service struct {
 	// handlers are configured, the server will operate as a PERPETUAL
 	// ADMIN PARTY!
 	AuthHandlers []auth.Handler
+	// APIKeys is the store of API keys, managed by the /_api_keys admin
+	// endpoints. To authenticate requests with these keys, also add an
+	// apikey.Auth handler to AuthHandlers.
+	APIKeys apikey.Store
+	// LoginThrottle, if set, tracks failed login attempts, and temporarily
+	// locks out offending user names and client addresses.
+	LoginThrottle *throttle.Throttle
+	// Policy is the authorization policy evaluated after authentication. If
+	// unset, rules are read from the policy.rules config setting.
+	Policy *policy.Policy
 	// CompatVersion is the compatibility version to report to clients. Defaults
 	// to 1.6.1.
 	CompatVersion string
@@ -43,8 +57,38 @@ type Service struct {
 	// Favicon is the path to a file to serve as favicon.ico. If unset, a default
 	// image is used.
 	Favicon string
+	// Designs holds Go implementations of design document show, list and
+	// update functions, by design document ID. See couchserver.Handler.
+	Designs map[string]*couchserver.Design
+	// JSEngine, if set, executes JavaScript design document functions.
+	JSEngine couchserver.JSEngine
+	// Upstream, if set, receives the requests which the service does not
+	// handle itself, such as a *proxy.Proxy to a CouchDB server, after
+	// authentication and authorization. See couchserver.Handler.
+	Upstream http.Handler
+	// LocalDBs, if Upstream is set, are the databases served by Client,
+	// rather than Upstream. See couchserver.Handler.
+	LocalDBs []string
 	// RequestLogger receives logging information for each request.
 	RequestLogger logger.RequestLogger
+	// Logger receives the server's log messages, such as startup, config
+	// and authentication events. Defaults to logger.DefaultServerLogger.
+	Logger logger.Logger
+	// Stats receives the server's statistics, such as request counts and
+	// latencies, and authentication attempts. If it is also an http.Handler,
+	// such as *stats.Prometheus, it is served at
+	// /_node/_local/_prometheus. If unset, statistics are discarded.
+	Stats stats.Collector
+	// Clock returns the current time, which is used to timestamp and expire
+	// sessions. Defaults to time.Now. Tests may set a fixed clock, for
+	// reproducible session cookies and expiries.
+	Clock func() time.Time
+	// IDGenerator generates session IDs. If unset, random IDs are used.
+	IDGenerator kivik.IDGenerator
+	// Databases are the application databases, by name, which are created at
+	// startup, if they do not exist, and converged to their specs. See
+	// Bootstrap.
+	Databases map[string]*kivik.DBSpec
 
 	// ConfigFile is the path to a config file to read during startup.
 	ConfigFile string
@@ -60,6 +104,21 @@ type Service struct {
 	// use.
 	authHandlers     map[string]auth.Handler
 	authHandlerNames []string
+
+	// perUserSeq is the sequence of the authentication database to which
+	// SyncUserDBs has provisioned user databases.
+	perUserSeq string
+	perUserMU  sync.Mutex
+
+	// feeds are the changes feeds being served.
+	feeds   map[*ActiveFeed]struct{}
+	feedsMU sync.Mutex
+	// maintenance is 1 in maintenance mode.
+	maintenance int32
+
+	// housekeeping is the schedule and last results of housekeeping.
+	housekeeping   HousekeepingStatus
+	housekeepingMU sync.Mutex
 }
 
 // Init initializes a configured server. This is automatically called when
@@ -70,12 +129,53 @@ func (s *Service) Init() (http.Handler, error) {
 	if err := s.loadConf(); err != nil {
 		return nil, err
 	}
+	if err := s.policySetup(); err != nil {
+		return nil, err
+	}
+	if s.AdminParty() && s.Conf().IsSet("httpd.allow_admin_party") && !s.Conf().GetBool("httpd.allow_admin_party") {
+		return nil, errors.New("admin party is disallowed by httpd.allow_admin_party; configure AuthHandlers and a UserStore")
+	}
 	if !s.Conf().IsSet("couch_httpd_auth.secret") {
-		fmt.Fprintf(os.Stderr, "couch_httpd_auth.secret is not set. This is insecure!\n")
+		s.logger().Log(logger.LevelWarn, "couch_httpd_auth.secret is not set. This is insecure!", nil)
+	}
+	if err := s.uuidSetup(); err != nil {
+		return nil, err
+	}
+	if err := s.Bootstrap(context.Background()); err != nil {
+		return nil, err
 	}
+	s.perUserSetup()
+	s.housekeepingSetup()
 	return s.setupRoutes()
 }
 
+// DefaultCompatVersion is the CouchDB compatibility version reported to
+// clients, if CompatVersion is unset.
+const DefaultCompatVersion = "1.6.1"
+
+func (s *Service) compatVersion() string {
+	if s.CompatVersion == "" {
+		return DefaultCompatVersion
+	}
+	return s.CompatVersion
+}
+
+// uuidSetup generates the server instance UUID, reported by GET /, if it is
+// not set by couchdb.uuid. A generated UUID lasts only as long as the
+// process, so couchdb.uuid should be set for replication checkpoints to
+// survive restarts.
+func (s *Service) uuidSetup() error {
+	if s.Conf().GetString("couchdb.uuid") != "" {
+		return nil
+	}
+	uuid, err := kivik.RandomIDs().NewID()
+	if err != nil {
+		return err
+	}
+	s.Conf().Set("couchdb.uuid", uuid)
+	return nil
+}
+
 func (s *Service) loadConf() error {
 	s.confMU.Lock()
 	defer s.confMU.Unlock()
@@ -85,12 +185,33 @@ func (s *Service) loadConf() error {
 	}
 	c, err := conf.Load(s.ConfigFile)
 	if err != nil {
+		s.logger().Log(logger.LevelError, "Failed to load config", logger.Fields{
+			logger.FieldConfigFile: s.ConfigFile,
+			logger.FieldError:      err,
+		})
 		return err
 	}
+	if s.ConfigFile != "" {
+		s.logger().Log(logger.LevelInfo, "Loaded config", logger.Fields{logger.FieldConfigFile: s.ConfigFile})
+	}
 	s.conf = c
 	return nil
 }
 
+func (s *Service) stats() stats.Collector {
+	if s.Stats == nil {
+		return stats.Discard
+	}
+	return s.Stats
+}
+
+func (s *Service) logger() logger.Logger {
+	if s.Logger == nil {
+		return logger.DefaultServerLogger
+	}
+	return s.Logger
+}
+
 // Conf returns the initialized server configuration.
 func (s *Service) Conf() *conf.Conf {
 	s.confMU.RLock()
@@ -115,13 +236,13 @@ func (s *Service) Start() error {
 		s.Conf().GetString("httpd.bind_address"),
 		s.Conf().GetInt("httpd.port"),
 	)
-	fmt.Fprintf(os.Stderr, "Listening on %s\n", addr)
-	return http.ListenAndServe(addr, server)
+	s.logger().Log(logger.LevelInfo, "Listening", logger.Fields{logger.FieldAddress: addr})
+	return s.HTTPServer(addr, server).ListenAndServe()
 }
 
 func (s *Service) authHandlersSetup() {
 	if s.AuthHandlers == nil || len(s.AuthHandlers) == 0 {
-		fmt.Fprintf(os.Stderr, "No AuthHandler specified! Welcome to the PERPETUAL ADMIN PARTY!\n")
+		s.logger().Log(logger.LevelWarn, "No AuthHandler specified! Welcome to the PERPETUAL ADMIN PARTY!", nil)
 	}
 	s.authHandlers = make(map[string]auth.Handler)
 	s.authHandlerNames = make([]string, 0, len(s.AuthHandlers))
@@ -138,6 +259,18 @@ func (s *Service) authHandlersSetup() {
 	}
 }
 
+// AdminParty returns true if the service grants admin rights without valid
+// credentials, because no AuthHandlers or no UserStore are configured. If the
+// httpd.allow_admin_party config setting is false, Init refuses to start
+// such a service.
+func (s *Service) AdminParty() bool {
+	if len(s.AuthHandlers) == 0 || s.UserStore == nil {
+		return true
+	}
+	_, party := s.UserStore.(*perpetualAdminParty)
+	return party
+}
+
 type perpetualAdminParty struct{}
 
 var _ authdb.UserStore = &perpetualAdminParty{}
@@ -153,6 +286,14 @@ func (p *perpetualAdminParty) UserCtx(_ context.Context, username string) (*auth
 	}, nil
 }
 
+// Now returns the current time, according to s.Clock.
+func (s *Service) Now() time.Time {
+	if s.Clock != nil {
+		return s.Clock()
+	}
+	return time.Now()
+}
+
 // Bind sets the HTTP daemon bind address and port.
 func (s *Service) Bind(addr string) error {
 	port := addr[strings.LastIndex(addr, ":")+1:]
@@ -180,22 +321,7 @@ func (h handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
+// reportError sends err to the client as a CouchDB error response.
 func reportError(w http.ResponseWriter, err error) {
-	w.Header().Add("Content-Type", typeJSON)
-	status := errors.StatusCode(err)
-	if status == 0 {
-		status = 500
-	}
-	w.WriteHeader(status)
-	short := err.Error()
-	reason := errors.Reason(err)
-	if reason == "" {
-		reason = short
-	} else {
-		short = strings.ToLower(http.StatusText(status))
-	}
-	json.NewEncoder(w).Encode(map[string]interface{}{
-		"error":  short,
-		"reason": reason,
-	})
+	_ = couchserver.WriteError(w, err)
 }
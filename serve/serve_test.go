@@ -1,8 +1,14 @@
 package serve
 
 import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
 	"testing"
 
+	"github.com/flimzy/kivik/auth"
+	"github.com/flimzy/kivik/authdb"
 	"github.com/flimzy/kivik/serve/conf"
 	"github.com/spf13/viper"
 )
@@ -21,3 +27,111 @@ func TestBind(t *testing.T) {
 		t.Errorf("Port is '%d', expected '9000'", port)
 	}
 }
+
+type testAuthHandler struct{}
+
+var _ auth.Handler = &testAuthHandler{}
+
+func (h *testAuthHandler) MethodName() string { return "test" }
+
+func (h *testAuthHandler) Authenticate(_ http.ResponseWriter, _ *http.Request) (*authdb.UserContext, error) {
+	return nil, nil
+}
+
+func TestAdminParty(t *testing.T) {
+	tests := []struct {
+		name     string
+		service  *Service
+		expected bool
+	}{
+		{
+			name:     "NoAuthHandlers",
+			service:  &Service{UserStore: &testStore{}},
+			expected: true,
+		},
+		{
+			name:     "NoUserStore",
+			service:  &Service{AuthHandlers: []auth.Handler{&testAuthHandler{}}},
+			expected: true,
+		},
+		{
+			name:     "PerpetualAdminParty",
+			service:  &Service{AuthHandlers: []auth.Handler{&testAuthHandler{}}, UserStore: &perpetualAdminParty{}},
+			expected: true,
+		},
+		{
+			name:     "Secured",
+			service:  &Service{AuthHandlers: []auth.Handler{&testAuthHandler{}}, UserStore: &testStore{}},
+			expected: false,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if party := test.service.AdminParty(); party != test.expected {
+				t.Errorf("Expected %t, got %t", test.expected, party)
+			}
+		})
+	}
+}
+
+func TestInitDisallowAdminParty(t *testing.T) {
+	c := conf.New()
+	c.Set("httpd.allow_admin_party", false)
+	s := &Service{Config: c}
+	if _, err := s.Init(); err == nil {
+		t.Error("Expected Init to refuse an admin party")
+	}
+}
+
+func TestRootVersion(t *testing.T) {
+	type root struct {
+		Version  string   `json:"version"`
+		UUID     string   `json:"uuid"`
+		Features []string `json:"features"`
+	}
+	get := func(t *testing.T, handler http.Handler) root {
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, httptest.NewRequest("GET", "/", nil))
+		var r root
+		if err := json.Unmarshal(w.Body.Bytes(), &r); err != nil {
+			t.Fatal(err)
+		}
+		return r
+	}
+	t.Run("Defaults", func(t *testing.T) {
+		s := &Service{Config: conf.New()}
+		handler, err := s.Init()
+		if err != nil {
+			t.Fatal(err)
+		}
+		r := get(t, handler)
+		if r.Version != DefaultCompatVersion {
+			t.Errorf("Expected version %s, got %s", DefaultCompatVersion, r.Version)
+		}
+		if !regexp.MustCompile("^[0-9a-f]{32}$").MatchString(r.UUID) {
+			t.Errorf("Unexpected generated UUID: %q", r.UUID)
+		}
+		if r.Features == nil {
+			t.Error("Expected a features array")
+		}
+		if uuid := get(t, handler).UUID; uuid != r.UUID {
+			t.Errorf("UUID changed from %s to %s", r.UUID, uuid)
+		}
+	})
+	t.Run("Configured", func(t *testing.T) {
+		c := conf.New()
+		c.Set("couchdb.uuid", "0f3bb1a5a4a4fb1bcbe3d9bc4d5e37c0")
+		s := &Service{Config: c, CompatVersion: "2.1.1"}
+		handler, err := s.Init()
+		if err != nil {
+			t.Fatal(err)
+		}
+		r := get(t, handler)
+		if r.Version != "2.1.1" {
+			t.Errorf("Expected version 2.1.1, got %s", r.Version)
+		}
+		if r.UUID != "0f3bb1a5a4a4fb1bcbe3d9bc4d5e37c0" {
+			t.Errorf("Unexpected UUID: %s", r.UUID)
+		}
+	})
+}
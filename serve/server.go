@@ -0,0 +1,19 @@
+// +build go1.8
+
+package serve
+
+import (
+	"net/http"
+	"time"
+)
+
+// DefaultHeaderTimeout is the default value of httpd.header_timeout.
+const DefaultHeaderTimeout = 10 * time.Second
+
+func (s *Service) setServerTimeouts(server *http.Server) {
+	server.ReadHeaderTimeout = DefaultHeaderTimeout
+	if s.Conf().IsSet("httpd.header_timeout") {
+		server.ReadHeaderTimeout = s.Conf().GetDuration("httpd.header_timeout")
+	}
+	server.IdleTimeout = s.Conf().GetDuration("httpd.idle_timeout")
+}
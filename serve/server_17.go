@@ -0,0 +1,16 @@
+// +build go1.7,!go1.8
+
+package serve
+
+import (
+	"net/http"
+	"time"
+)
+
+// DefaultHeaderTimeout is the default value of httpd.header_timeout, which
+// requires Go 1.8.
+const DefaultHeaderTimeout = 10 * time.Second
+
+// setServerTimeouts ignores httpd.header_timeout and httpd.idle_timeout, which
+// are not supported by http.Server before Go 1.8.
+func (s *Service) setServerTimeouts(_ *http.Server) {}
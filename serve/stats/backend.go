@@ -0,0 +1,20 @@
+package stats
+
+import "github.com/flimzy/kivik/instrument"
+
+// BackendSink returns an instrument.Sink which reports each call to the
+// backend driver to c, as MetricBackendCalls and MetricBackendDuration. To
+// collect backend statistics, serve a client of an instrumented driver:
+//
+//	instrument.Register("couch-stats", "couch", stats.BackendSink(collector))
+//	client, err := kivik.New(ctx, "couch-stats", dsn)
+func BackendSink(c Collector) instrument.Sink {
+	return instrument.SinkFunc(func(e instrument.Event) {
+		result := ResultSuccess
+		if e.Err != nil {
+			result = ResultFailure
+		}
+		c.Count(MetricBackendCalls, Labels{LabelOp: e.Op, LabelResult: result}, 1)
+		c.Observe(MetricBackendDuration, Labels{LabelOp: e.Op}, e.Duration.Seconds())
+	})
+}
@@ -0,0 +1,73 @@
+package stats
+
+import (
+	"math"
+	"sync"
+)
+
+// Summary summarizes the values observed by a histogram.
+type Summary struct {
+	Count int64
+	Sum   float64
+	Min   float64
+	Max   float64
+}
+
+// Memory is a Collector which holds statistics in memory, for inspection by
+// the application or by tests.
+type Memory struct {
+	mu       sync.RWMutex
+	counters map[string]int64
+	summary  map[string]*Summary
+}
+
+var _ Collector = &Memory{}
+
+// NewMemory returns a new, empty, in-memory Collector.
+func NewMemory() *Memory {
+	return &Memory{
+		counters: make(map[string]int64),
+		summary:  make(map[string]*Summary),
+	}
+}
+
+// Count satisfies the Collector interface.
+func (m *Memory) Count(name string, labels Labels, delta int64) {
+	key := series(name, labels)
+	m.mu.Lock()
+	m.counters[key] += delta
+	m.mu.Unlock()
+}
+
+// Observe satisfies the Collector interface.
+func (m *Memory) Observe(name string, labels Labels, value float64) {
+	key := series(name, labels)
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	s, ok := m.summary[key]
+	if !ok {
+		s = &Summary{Min: math.Inf(1), Max: math.Inf(-1)}
+		m.summary[key] = s
+	}
+	s.Count++
+	s.Sum += value
+	s.Min = math.Min(s.Min, value)
+	s.Max = math.Max(s.Max, value)
+}
+
+// Counter returns the value of the counter name with labels.
+func (m *Memory) Counter(name string, labels Labels) int64 {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return m.counters[series(name, labels)]
+}
+
+// Histogram returns the summary of the histogram name with labels.
+func (m *Memory) Histogram(name string, labels Labels) Summary {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	if s, ok := m.summary[series(name, labels)]; ok {
+		return *s
+	}
+	return Summary{}
+}
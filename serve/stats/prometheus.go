@@ -0,0 +1,171 @@
+package stats
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"sync"
+)
+
+// DefaultBuckets are the default upper bounds of Prometheus histogram
+// buckets, suited to latencies in seconds.
+var DefaultBuckets = []float64{.005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10}
+
+// Prometheus is a Collector which exposes the statistics in the Prometheus
+// text exposition format, when served as an http.Handler.
+type Prometheus struct {
+	buckets []float64
+
+	mu         sync.Mutex
+	counters   map[string]*promCounter
+	histograms map[string]*promHistogram
+}
+
+var _ Collector = &Prometheus{}
+var _ http.Handler = &Prometheus{}
+
+type promCounter struct {
+	name, labels string
+	value        int64
+}
+
+type promHistogram struct {
+	name, labels string
+	counts       []int64
+	count        int64
+	sum          float64
+}
+
+// NewPrometheus returns a new Prometheus Collector, with histograms of the
+// given bucket upper bounds, or DefaultBuckets if none are given.
+func NewPrometheus(buckets ...float64) *Prometheus {
+	if len(buckets) == 0 {
+		buckets = DefaultBuckets
+	}
+	buckets = append([]float64(nil), buckets...)
+	sort.Float64s(buckets)
+	return &Prometheus{
+		buckets:    buckets,
+		counters:   make(map[string]*promCounter),
+		histograms: make(map[string]*promHistogram),
+	}
+}
+
+// labelString returns the labels of a series, without the braces.
+func labelString(name string, labels Labels) string {
+	s := series(name, labels)
+	if s == name {
+		return ""
+	}
+	return s[len(name)+1 : len(s)-1]
+}
+
+// Count satisfies the Collector interface.
+func (p *Prometheus) Count(name string, labels Labels, delta int64) {
+	key := series(name, labels)
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	c, ok := p.counters[key]
+	if !ok {
+		c = &promCounter{name: name, labels: labelString(name, labels)}
+		p.counters[key] = c
+	}
+	c.value += delta
+}
+
+// Observe satisfies the Collector interface.
+func (p *Prometheus) Observe(name string, labels Labels, value float64) {
+	key := series(name, labels)
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	h, ok := p.histograms[key]
+	if !ok {
+		h = &promHistogram{
+			name:   name,
+			labels: labelString(name, labels),
+			counts: make([]int64, len(p.buckets)),
+		}
+		p.histograms[key] = h
+	}
+	for i, bound := range p.buckets {
+		if value <= bound {
+			h.counts[i]++
+		}
+	}
+	h.count++
+	h.sum += value
+}
+
+// ServeHTTP writes the statistics in the Prometheus text format.
+func (p *Prometheus) ServeHTTP(w http.ResponseWriter, _ *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+	bw := bufio.NewWriter(w)
+	p.write(bw)
+	_ = bw.Flush()
+}
+
+// withLabel returns labels, with an additional label appended.
+func withLabel(labels, extra string) string {
+	if labels == "" {
+		return extra
+	}
+	return labels + "," + extra
+}
+
+func formatFloat(f float64) string {
+	return strconv.FormatFloat(f, 'g', -1, 64)
+}
+
+func (p *Prometheus) write(w *bufio.Writer) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	keys := make([]string, 0, len(p.counters))
+	for key := range p.counters {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	var lastName string
+	for _, key := range keys {
+		c := p.counters[key]
+		if c.name != lastName {
+			fmt.Fprintf(w, "# TYPE %s counter\n", c.name)
+			lastName = c.name
+		}
+		fmt.Fprintf(w, "%s %d\n", key, c.value)
+	}
+	keys = keys[:0]
+	for key := range p.histograms {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	lastName = ""
+	for _, key := range keys {
+		h := p.histograms[key]
+		if h.name != lastName {
+			fmt.Fprintf(w, "# TYPE %s histogram\n", h.name)
+			lastName = h.name
+		}
+		for i, bound := range p.buckets {
+			fmt.Fprintf(w, "%s_bucket{%s} %d\n", h.name, withLabel(h.labels, `le="`+formatFloat(bound)+`"`), h.counts[i])
+		}
+		fmt.Fprintf(w, "%s_bucket{%s} %d\n", h.name, withLabel(h.labels, `le="+Inf"`), h.count)
+		suffix := ""
+		if h.labels != "" {
+			suffix = "{" + h.labels + "}"
+		}
+		fmt.Fprintf(w, "%s_sum%s %s\n", h.name, suffix, formatFloat(h.sum))
+		fmt.Fprintf(w, "%s_count%s %d\n", h.name, suffix, h.count)
+	}
+}
+
+// String returns the statistics in the Prometheus text format.
+func (p *Prometheus) String() string {
+	var buf bytes.Buffer
+	bw := bufio.NewWriter(&buf)
+	p.write(bw)
+	_ = bw.Flush()
+	return buf.String()
+}
@@ -0,0 +1,94 @@
+// Package stats defines the interface through which the server reports its
+// statistics, such as request counts and latencies, so that operators may
+// choose their metrics stack. An in-memory Collector, and a Collector which
+// exposes the statistics in the Prometheus text format, are provided.
+package stats
+
+import (
+	"bytes"
+	"sort"
+	"strconv"
+)
+
+// Metrics reported by the server.
+const (
+	// MetricRequests counts HTTP requests, labeled by LabelMethod and
+	// LabelStatus.
+	MetricRequests = "kivik_httpd_requests_total"
+	// MetricRequestDuration observes the duration of HTTP requests, in
+	// seconds, labeled by LabelMethod.
+	MetricRequestDuration = "kivik_httpd_request_duration_seconds"
+	// MetricAuthAttempts counts authentication attempts, labeled by
+	// LabelAuthMethod and LabelResult.
+	MetricAuthAttempts = "kivik_auth_attempts_total"
+	// MetricBackendCalls counts calls to the backend driver, labeled by
+	// LabelOp and LabelResult.
+	MetricBackendCalls = "kivik_backend_calls_total"
+	// MetricBackendDuration observes the duration of calls to the backend
+	// driver, in seconds, labeled by LabelOp.
+	MetricBackendDuration = "kivik_backend_call_duration_seconds"
+)
+
+// Labels of the metrics reported by the server.
+const (
+	LabelMethod     = "method"
+	LabelStatus     = "status"
+	LabelAuthMethod = "auth_method"
+	LabelResult     = "result"
+	LabelOp         = "op"
+)
+
+// Values of LabelResult.
+const (
+	ResultSuccess = "success"
+	ResultFailure = "failure"
+	// ResultNone is the result of an authentication attempt for which no auth
+	// handler found credentials.
+	ResultNone = "none"
+)
+
+// Labels qualify a metric, such as by HTTP method.
+type Labels map[string]string
+
+// Collector receives the server's statistics. Its methods may be called
+// concurrently.
+type Collector interface {
+	// Count adds delta to the counter name.
+	Count(name string, labels Labels, delta int64)
+	// Observe records value in the histogram name.
+	Observe(name string, labels Labels, value float64)
+}
+
+type discard struct{}
+
+func (discard) Count(_ string, _ Labels, _ int64)     {}
+func (discard) Observe(_ string, _ Labels, _ float64) {}
+
+// Discard is a Collector which discards all statistics.
+var Discard Collector = discard{}
+
+// series returns the name and labels of a metric as a single string, in the
+// Prometheus form name{label="value",...}, with labels sorted by name.
+func series(name string, labels Labels) string {
+	if len(labels) == 0 {
+		return name
+	}
+	keys := make([]string, 0, len(labels))
+	for key := range labels {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	var buf bytes.Buffer
+	buf.WriteString(name)
+	buf.WriteByte('{')
+	for i, key := range keys {
+		if i > 0 {
+			buf.WriteByte(',')
+		}
+		buf.WriteString(key)
+		buf.WriteByte('=')
+		buf.WriteString(strconv.Quote(labels[key]))
+	}
+	buf.WriteByte('}')
+	return buf.String()
+}
@@ -0,0 +1,92 @@
+package stats
+
+import (
+	"errors"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/flimzy/diff"
+	"github.com/flimzy/kivik/instrument"
+)
+
+func TestSeries(t *testing.T) {
+	tests := []struct {
+		labels   Labels
+		expected string
+	}{
+		{expected: "foo"},
+		{labels: Labels{"b": "2", "a": `say "hi"`}, expected: `foo{a="say \"hi\"",b="2"}`},
+	}
+	for _, test := range tests {
+		if s := series("foo", test.labels); s != test.expected {
+			t.Errorf("Expected %s, got %s", test.expected, s)
+		}
+	}
+}
+
+func TestMemory(t *testing.T) {
+	m := NewMemory()
+	labels := Labels{LabelMethod: "GET"}
+	m.Count("requests", labels, 1)
+	m.Count("requests", Labels{LabelMethod: "GET"}, 2)
+	m.Count("requests", Labels{LabelMethod: "PUT"}, 1)
+	m.Observe("duration", labels, 0.5)
+	m.Observe("duration", labels, 1.5)
+	if n := m.Counter("requests", labels); n != 3 {
+		t.Errorf("Expected 3, got %d", n)
+	}
+	expected := Summary{Count: 2, Sum: 2, Min: 0.5, Max: 1.5}
+	if d := diff.Interface(expected, m.Histogram("duration", labels)); d != "" {
+		t.Error(d)
+	}
+	if d := diff.Interface(Summary{}, m.Histogram("duration", nil)); d != "" {
+		t.Error(d)
+	}
+}
+
+func TestPrometheus(t *testing.T) {
+	p := NewPrometheus(1, 0.1)
+	p.Count("kivik_requests_total", Labels{LabelMethod: "GET"}, 2)
+	p.Count("kivik_requests_total", Labels{LabelMethod: "PUT"}, 1)
+	p.Count("kivik_errors_total", nil, 1)
+	p.Observe("kivik_duration_seconds", nil, 0.05)
+	p.Observe("kivik_duration_seconds", nil, 0.5)
+	p.Observe("kivik_duration_seconds", nil, 5)
+	w := httptest.NewRecorder()
+	p.ServeHTTP(w, httptest.NewRequest("GET", "/_node/_local/_prometheus", nil))
+	expected := `# TYPE kivik_errors_total counter
+kivik_errors_total 1
+# TYPE kivik_requests_total counter
+kivik_requests_total{method="GET"} 2
+kivik_requests_total{method="PUT"} 1
+# TYPE kivik_duration_seconds histogram
+kivik_duration_seconds_bucket{le="0.1"} 1
+kivik_duration_seconds_bucket{le="1"} 2
+kivik_duration_seconds_bucket{le="+Inf"} 3
+kivik_duration_seconds_sum 5.55
+kivik_duration_seconds_count 3
+`
+	if d := diff.Text(expected, w.Body.String()); d != "" {
+		t.Error(d)
+	}
+	if ct := w.Header().Get("Content-Type"); ct != "text/plain; version=0.0.4" {
+		t.Errorf("Unexpected content type: %s", ct)
+	}
+}
+
+func TestBackendSink(t *testing.T) {
+	m := NewMemory()
+	sink := BackendSink(m)
+	sink.Record(instrument.Event{Op: "Get", Duration: time.Second})
+	sink.Record(instrument.Event{Op: "Get", Err: errors.New("not found")})
+	if n := m.Counter(MetricBackendCalls, Labels{LabelOp: "Get", LabelResult: ResultSuccess}); n != 1 {
+		t.Errorf("Expected 1 successful call, got %d", n)
+	}
+	if n := m.Counter(MetricBackendCalls, Labels{LabelOp: "Get", LabelResult: ResultFailure}); n != 1 {
+		t.Errorf("Expected 1 failed call, got %d", n)
+	}
+	if s := m.Histogram(MetricBackendDuration, Labels{LabelOp: "Get"}); s.Count != 2 || s.Sum != 1 {
+		t.Errorf("Unexpected durations: %+v", s)
+	}
+}
@@ -0,0 +1,98 @@
+package shard
+
+import (
+	"encoding/json"
+	"sort"
+	"strings"
+)
+
+// collateJSON compares the view keys a and b, returning -1, 0 or 1, in the
+// order of CouchDB's view collation: null, false, true, numbers, strings,
+// arrays, then objects. Strings are compared by code point, rather than by
+// the server's Unicode collation, which is sufficient to merge the results
+// of keys which compare equal or differ in their first characters.
+func collateJSON(a, b json.RawMessage) int {
+	var x, y interface{}
+	_ = json.Unmarshal(a, &x)
+	_ = json.Unmarshal(b, &y)
+	return collate(x, y)
+}
+
+func collationRank(v interface{}) int {
+	switch t := v.(type) {
+	case nil:
+		return 0
+	case bool:
+		if t {
+			return 2
+		}
+		return 1
+	case float64:
+		return 3
+	case string:
+		return 4
+	case []interface{}:
+		return 5
+	}
+	return 6
+}
+
+func collate(a, b interface{}) int {
+	rankA, rankB := collationRank(a), collationRank(b)
+	if rankA != rankB {
+		return compareInts(rankA, rankB)
+	}
+	switch t := a.(type) {
+	case float64:
+		u := b.(float64)
+		switch {
+		case t < u:
+			return -1
+		case t > u:
+			return 1
+		}
+		return 0
+	case string:
+		return strings.Compare(t, b.(string))
+	case []interface{}:
+		u := b.([]interface{})
+		for i := 0; i < len(t) && i < len(u); i++ {
+			if c := collate(t[i], u[i]); c != 0 {
+				return c
+			}
+		}
+		return compareInts(len(t), len(u))
+	case map[string]interface{}:
+		u := b.(map[string]interface{})
+		keysA, keysB := sortedKeys(t), sortedKeys(u)
+		for i := 0; i < len(keysA) && i < len(keysB); i++ {
+			if c := strings.Compare(keysA[i], keysB[i]); c != 0 {
+				return c
+			}
+			if c := collate(t[keysA[i]], u[keysB[i]]); c != 0 {
+				return c
+			}
+		}
+		return compareInts(len(keysA), len(keysB))
+	}
+	return 0
+}
+
+func compareInts(a, b int) int {
+	switch {
+	case a < b:
+		return -1
+	case a > b:
+		return 1
+	}
+	return 0
+}
+
+func sortedKeys(m map[string]interface{}) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
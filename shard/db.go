@@ -0,0 +1,604 @@
+package shard
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/flimzy/kivik"
+	"github.com/flimzy/kivik/driver"
+	"github.com/flimzy/kivik/errors"
+)
+
+type db struct {
+	client *client
+	shards []driver.DB
+}
+
+var _ driver.DB = &db{}
+var _ driver.Explainer = &db{}
+var _ driver.AttachmentMetaer = &db{}
+var _ driver.AttachmentCombiner = &db{}
+var _ driver.Rever = &db{}
+var _ driver.DBFlusher = &db{}
+var _ driver.Copier = &db{}
+var _ driver.OptsBulkDocer = &db{}
+var _ driver.OptsPutter = &db{}
+var _ driver.OptsDeleter = &db{}
+var _ driver.Quorumer = &db{}
+var _ driver.OpenRevsGetter = &db{}
+var _ driver.OptsDocCreator = &db{}
+var _ driver.BodyGetter = &db{}
+var _ driver.DesignInfoer = &db{}
+var _ driver.MultipartPutter = &db{}
+var _ driver.OptionValidator = &db{}
+
+// shard returns the shard from which docID is read.
+func (d *db) shard(docID string) driver.DB {
+	if isDesignDoc(docID) {
+		return d.shards[0]
+	}
+	return d.shards[d.client.shardFor(docID)]
+}
+
+// write calls fn with the shard which holds docID, and rev. For a design
+// document, fn is then called with every other shard, and the current
+// revision of the document on that shard, as revisions differ between shards,
+// or skipped for shards without the document, if existing is true. The
+// revision returned by the first shard is returned. If the write fails on
+// another shard once the first has been written, the failures are reported
+// with StatusInternalServerError, along with the first shard's revision.
+func (d *db) write(ctx context.Context, docID, rev string, existing bool, fn func(sdb driver.DB, rev string) (string, error)) (string, error) {
+	if !isDesignDoc(docID) {
+		return fn(d.shard(docID), rev)
+	}
+	first, err := fn(d.shards[0], rev)
+	if err != nil {
+		return "", err
+	}
+	var failures []string
+	for i, sdb := range d.shards[1:] {
+		current, err := shardRev(ctx, sdb, docID)
+		if err == nil && (current != "" || !existing) {
+			_, err = fn(sdb, current)
+		}
+		if err != nil {
+			failures = append(failures, fmt.Sprintf("shard %d: %s", i+1, err))
+		}
+	}
+	if len(failures) > 0 {
+		return first, errors.Statusf(kivik.StatusInternalServerError, "shard: %s written to the first shard only: %s", docID, strings.Join(failures, "; "))
+	}
+	return first, nil
+}
+
+// put calls fn with the shard which holds docID, and doc, or, as for write,
+// with every shard for a design document, and a copy of doc with the shard's
+// revision. Revisions are not replaced if opts disable new_edits, as the
+// revisions are then those of the replicated document.
+func (d *db) put(ctx context.Context, docID string, doc interface{}, opts map[string]interface{}, fn func(sdb driver.DB, doc interface{}) (string, error)) (string, error) {
+	if !isDesignDoc(docID) || !newEdits(opts) {
+		return d.write(ctx, docID, "", false, func(sdb driver.DB, _ string) (string, error) {
+			return fn(sdb, doc)
+		})
+	}
+	fields, err := docFields(doc)
+	if err != nil {
+		return "", err
+	}
+	rev, _ := fields["_rev"].(string)
+	return d.write(ctx, docID, rev, false, func(sdb driver.DB, rev string) (string, error) {
+		return fn(sdb, withRev(fields, rev))
+	})
+}
+
+// shardRev returns the current revision of docID on sdb, or an empty string
+// if sdb has no such document.
+func shardRev(ctx context.Context, sdb driver.DB, docID string) (string, error) {
+	var rev string
+	var err error
+	if r, ok := sdb.(driver.Rever); ok {
+		rev, err = r.Rev(ctx, docID)
+	} else {
+		var doc json.RawMessage
+		if doc, err = sdb.Get(ctx, docID, nil); err == nil {
+			var fields struct {
+				Rev string `json:"_rev"`
+			}
+			err = json.Unmarshal(doc, &fields)
+			rev = fields.Rev
+		}
+	}
+	if errors.StatusCode(err) == kivik.StatusNotFound {
+		return "", nil
+	}
+	return rev, err
+}
+
+// newEdits returns false if opts disable new_edits.
+func newEdits(opts map[string]interface{}) bool {
+	return opts["new_edits"] != false && opts["new_edits"] != "false"
+}
+
+// withRev returns a copy of the fields of a document, with rev as its _rev, or
+// without _rev, if rev is empty.
+func withRev(fields map[string]interface{}, rev string) map[string]interface{} {
+	doc := make(map[string]interface{}, len(fields)+1)
+	for k, v := range fields {
+		doc[k] = v
+	}
+	delete(doc, "_rev")
+	if rev != "" {
+		doc["_rev"] = rev
+	}
+	return doc
+}
+
+// each calls fn with every shard, and returns the first error encountered.
+func (d *db) each(fn func(driver.DB) error) error {
+	for _, sdb := range d.shards {
+		if err := fn(sdb); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// docFields returns the fields of doc.
+func docFields(doc interface{}) (map[string]interface{}, error) {
+	fields, ok := doc.(map[string]interface{})
+	if ok {
+		return fields, nil
+	}
+	body, err := kivik.JSON().Marshal(doc)
+	if err != nil {
+		return nil, errors.WrapStatus(kivik.StatusBadRequest, err)
+	}
+	if err := kivik.JSON().Unmarshal(body, &fields); err != nil {
+		return nil, errors.WrapStatus(kivik.StatusBadRequest, err)
+	}
+	return fields, nil
+}
+
+// withDocID returns the ID of doc, and doc. If doc has no _id, a random ID is
+// generated, and a copy of doc which includes it is returned, as the ID must
+// be known to select the shard.
+func withDocID(doc interface{}) (string, interface{}, error) {
+	fields, err := docFields(doc)
+	if err != nil {
+		return "", nil, err
+	}
+	if docID, _ := fields["_id"].(string); docID != "" {
+		return docID, doc, nil
+	}
+	docID, err := kivik.RandomIDs().NewID()
+	if err != nil {
+		return "", nil, err
+	}
+	withID := make(map[string]interface{}, len(fields)+1)
+	for k, v := range fields {
+		withID[k] = v
+	}
+	withID["_id"] = docID
+	return docID, withID, nil
+}
+
+func (d *db) Get(ctx context.Context, docID string, opts map[string]interface{}) (json.RawMessage, error) {
+	return d.shard(docID).Get(ctx, docID, opts)
+}
+
+// CreateDoc stores doc with its _id, or a random ID, as the shard is chosen
+// by the ID.
+func (d *db) CreateDoc(ctx context.Context, doc interface{}) (docID, rev string, err error) {
+	docID, doc, err = withDocID(doc)
+	if err != nil {
+		return "", "", err
+	}
+	rev, err = d.Put(ctx, docID, doc)
+	return docID, rev, err
+}
+
+func (d *db) CreateDocOpts(ctx context.Context, doc interface{}, opts map[string]interface{}) (docID, rev string, err error) {
+	docID, doc, err = withDocID(doc)
+	if err != nil {
+		return "", "", err
+	}
+	rev, err = d.PutOpts(ctx, docID, doc, opts)
+	return docID, rev, err
+}
+
+func (d *db) Put(ctx context.Context, docID string, doc interface{}) (string, error) {
+	return d.put(ctx, docID, doc, nil, func(sdb driver.DB, doc interface{}) (string, error) {
+		return sdb.Put(ctx, docID, doc)
+	})
+}
+
+func (d *db) PutOpts(ctx context.Context, docID string, doc interface{}, opts map[string]interface{}) (string, error) {
+	return d.put(ctx, docID, doc, opts, func(sdb driver.DB, doc interface{}) (string, error) {
+		p, ok := sdb.(driver.OptsPutter)
+		if !ok {
+			return "", notImplemented("OptsPutter")
+		}
+		return p.PutOpts(ctx, docID, doc, opts)
+	})
+}
+
+func (d *db) Delete(ctx context.Context, docID, rev string) (string, error) {
+	return d.write(ctx, docID, rev, true, func(sdb driver.DB, rev string) (string, error) {
+		return sdb.Delete(ctx, docID, rev)
+	})
+}
+
+func (d *db) DeleteOpts(ctx context.Context, docID, rev string, opts map[string]interface{}) (string, error) {
+	return d.write(ctx, docID, rev, true, func(sdb driver.DB, rev string) (string, error) {
+		del, ok := sdb.(driver.OptsDeleter)
+		if !ok {
+			return "", notImplemented("OptsDeleter")
+		}
+		return del.DeleteOpts(ctx, docID, rev, opts)
+	})
+}
+
+func (d *db) PutAttachment(ctx context.Context, docID, rev, filename, contentType string, body io.Reader) (string, error) {
+	if isDesignDoc(docID) {
+		return "", errors.Status(kivik.StatusNotImplemented, "shard: attachments to design documents are not supported")
+	}
+	return d.shard(docID).PutAttachment(ctx, docID, rev, filename, contentType, body)
+}
+
+func (d *db) GetAttachment(ctx context.Context, docID, rev, filename string) (contentType string, md5sum driver.MD5sum, body io.ReadCloser, err error) {
+	return d.shard(docID).GetAttachment(ctx, docID, rev, filename)
+}
+
+func (d *db) GetAttachmentMeta(ctx context.Context, docID, rev, filename string) (contentType string, md5sum driver.MD5sum, err error) {
+	m, ok := d.shard(docID).(driver.AttachmentMetaer)
+	if !ok {
+		return "", driver.MD5sum{}, notImplemented("AttachmentMetaer")
+	}
+	return m.GetAttachmentMeta(ctx, docID, rev, filename)
+}
+
+func (d *db) DeleteAttachment(ctx context.Context, docID, rev, filename string) (string, error) {
+	return d.write(ctx, docID, rev, true, func(sdb driver.DB, rev string) (string, error) {
+		return sdb.DeleteAttachment(ctx, docID, rev, filename)
+	})
+}
+
+func (d *db) Rev(ctx context.Context, docID string) (string, error) {
+	r, ok := d.shard(docID).(driver.Rever)
+	if !ok {
+		return "", notImplemented("Rever")
+	}
+	return r.Rev(ctx, docID)
+}
+
+func (d *db) GetBody(ctx context.Context, docID string, opts map[string]interface{}) (io.ReadCloser, error) {
+	g, ok := d.shard(docID).(driver.BodyGetter)
+	if !ok {
+		return nil, notImplemented("BodyGetter")
+	}
+	return g.GetBody(ctx, docID, opts)
+}
+
+func (d *db) GetOpenRevs(ctx context.Context, docID string, revs []string, opts map[string]interface{}) ([]driver.OpenRev, error) {
+	g, ok := d.shard(docID).(driver.OpenRevsGetter)
+	if !ok {
+		return nil, notImplemented("OpenRevsGetter")
+	}
+	return g.GetOpenRevs(ctx, docID, revs, opts)
+}
+
+// Copy copies the document within its shard, if the target is stored on the
+// same shard. Otherwise StatusNotImplemented is returned, so that the copy is
+// emulated by reading and writing the document.
+func (d *db) Copy(ctx context.Context, targetID, sourceID string, opts map[string]interface{}) (string, error) {
+	if isDesignDoc(targetID) || d.shard(targetID) != d.shard(sourceID) {
+		return "", errors.Status(kivik.StatusNotImplemented, "shard: copy between shards")
+	}
+	c, ok := d.shard(sourceID).(driver.Copier)
+	if !ok {
+		return "", notImplemented("Copier")
+	}
+	return c.Copy(ctx, targetID, sourceID, opts)
+}
+
+func (d *db) BulkDocs(ctx context.Context, docs []interface{}) (driver.BulkResults, error) {
+	return d.bulkDocs(ctx, docs, nil, func(sdb driver.DB, docs []interface{}) (driver.BulkResults, error) {
+		return sdb.BulkDocs(ctx, docs)
+	})
+}
+
+func (d *db) BulkDocsOpts(ctx context.Context, docs []interface{}, opts map[string]interface{}) (driver.BulkResults, error) {
+	return d.bulkDocs(ctx, docs, opts, func(sdb driver.DB, docs []interface{}) (driver.BulkResults, error) {
+		b, ok := sdb.(driver.OptsBulkDocer)
+		if !ok {
+			return nil, notImplemented("OptsBulkDocer")
+		}
+		return b.BulkDocsOpts(ctx, docs, opts)
+	})
+}
+
+// bulkIndex is the index within the documents of BulkDocs of a document sent
+// to a shard. copy is true for the copies of design documents sent to the
+// shards other than the first, whose results are only reported if they fail.
+type bulkIndex struct {
+	index int
+	copy  bool
+}
+
+// bulkDocs partitions docs by shard, calls fn with each shard's documents,
+// and returns the results in the order of docs. Design documents are written
+// to the first shard, then, as for put, if they were written, copies with the
+// revision of each other shard are written to the other shards.
+func (d *db) bulkDocs(ctx context.Context, docs []interface{}, opts map[string]interface{}, fn func(driver.DB, []interface{}) (driver.BulkResults, error)) (driver.BulkResults, error) {
+	shardDocs := make([][]interface{}, len(d.shards))
+	indexes := make([][]bulkIndex, len(d.shards))
+	// designs are the indexes within docs of the design documents, and
+	// designDocs and designIDs the documents, with their IDs.
+	var designs []int
+	designDocs := make(map[int]interface{})
+	designIDs := make(map[int]string)
+	for i, doc := range docs {
+		docID, doc, err := withDocID(doc)
+		if err != nil {
+			return nil, err
+		}
+		s := 0
+		if isDesignDoc(docID) {
+			designs = append(designs, i)
+			designDocs[i], designIDs[i] = doc, docID
+		} else {
+			s = d.client.shardFor(docID)
+		}
+		shardDocs[s] = append(shardDocs[s], doc)
+		indexes[s] = append(indexes[s], bulkIndex{index: i})
+	}
+	results := make([]driver.BulkResult, len(docs))
+	for s, sdb := range d.shards {
+		if s > 0 {
+			for _, i := range designs {
+				if results[i].Error != nil {
+					continue
+				}
+				doc, ok, err := designCopy(ctx, sdb, designIDs[i], designDocs[i], opts)
+				if err != nil {
+					return nil, err
+				}
+				if ok {
+					shardDocs[s] = append(shardDocs[s], doc)
+					indexes[s] = append(indexes[s], bulkIndex{index: i, copy: true})
+				}
+			}
+		}
+		if len(shardDocs[s]) == 0 {
+			continue
+		}
+		if err := readBulkResults(s, sdb, shardDocs[s], indexes[s], results, fn); err != nil {
+			return nil, err
+		}
+	}
+	return &bulkResults{results: results}, nil
+}
+
+// designCopy returns the copy of the design document doc to be written to
+// sdb, with the revision of sdb, unless opts disable new_edits. ok is false
+// for a deletion of a document which sdb does not have.
+func designCopy(ctx context.Context, sdb driver.DB, docID string, doc interface{}, opts map[string]interface{}) (shardDoc interface{}, ok bool, err error) {
+	if !newEdits(opts) {
+		return doc, true, nil
+	}
+	fields, err := docFields(doc)
+	if err != nil {
+		return nil, false, err
+	}
+	current, err := shardRev(ctx, sdb, docID)
+	if err != nil {
+		return nil, false, err
+	}
+	if current == "" && fields["_deleted"] == true {
+		return nil, false, nil
+	}
+	return withRev(fields, current), true, nil
+}
+
+func readBulkResults(shard int, sdb driver.DB, docs []interface{}, indexes []bulkIndex, results []driver.BulkResult, fn func(driver.DB, []interface{}) (driver.BulkResults, error)) error {
+	br, err := fn(sdb, docs)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = br.Close() }()
+	for _, index := range indexes {
+		var result driver.BulkResult
+		if err := br.Next(&result); err != nil {
+			if err == io.EOF {
+				return errors.Status(kivik.StatusBadResponse, "shard: too few results from BulkDocs")
+			}
+			return err
+		}
+		switch {
+		case !index.copy:
+			results[index.index] = result
+		case result.Error != nil && results[index.index].Error == nil:
+			results[index.index].Error = errors.Statusf(kivik.StatusInternalServerError, "shard: %s written to the first shard only: shard %d: %s", result.ID, shard, result.Error)
+		}
+	}
+	return nil
+}
+
+type bulkResults struct {
+	results []driver.BulkResult
+}
+
+var _ driver.BulkResults = &bulkResults{}
+
+func (r *bulkResults) Next(result *driver.BulkResult) error {
+	if len(r.results) == 0 {
+		return io.EOF
+	}
+	*result, r.results = r.results[0], r.results[1:]
+	return nil
+}
+
+func (r *bulkResults) Close() error {
+	r.results = nil
+	return nil
+}
+
+// Stats returns the sums of the statistics of the shards.
+func (d *db) Stats(ctx context.Context) (*driver.DBStats, error) {
+	total := &driver.DBStats{}
+	seqs := make([]string, len(d.shards))
+	for i, sdb := range d.shards {
+		stats, err := sdb.Stats(ctx)
+		if err != nil {
+			return nil, err
+		}
+		if i == 0 {
+			total.Name = stats.Name
+		}
+		total.CompactRunning = total.CompactRunning || stats.CompactRunning
+		total.DocCount += stats.DocCount
+		total.DeletedCount += stats.DeletedCount
+		total.DiskSize += stats.DiskSize
+		total.ActiveSize += stats.ActiveSize
+		total.ExternalSize += stats.ExternalSize
+		seqs[i] = stats.UpdateSeq
+	}
+	total.UpdateSeq = encodeSeq(seqs)
+	return total, nil
+}
+
+func (d *db) Compact(ctx context.Context) error {
+	return d.each(func(sdb driver.DB) error {
+		return sdb.Compact(ctx)
+	})
+}
+
+func (d *db) CompactView(ctx context.Context, ddocID string) error {
+	return d.each(func(sdb driver.DB) error {
+		return sdb.CompactView(ctx, ddocID)
+	})
+}
+
+func (d *db) ViewCleanup(ctx context.Context) error {
+	return d.each(func(sdb driver.DB) error {
+		return sdb.ViewCleanup(ctx)
+	})
+}
+
+func (d *db) Flush(ctx context.Context) error {
+	return d.each(func(sdb driver.DB) error {
+		f, ok := sdb.(driver.DBFlusher)
+		if !ok {
+			return notImplemented("DBFlusher")
+		}
+		return f.Flush(ctx)
+	})
+}
+
+// Security returns the security document of the first shard, as it is set on
+// every shard.
+func (d *db) Security(ctx context.Context) (*driver.Security, error) {
+	return d.shards[0].Security(ctx)
+}
+
+func (d *db) SetSecurity(ctx context.Context, security *driver.Security) error {
+	return d.each(func(sdb driver.DB) error {
+		return sdb.SetSecurity(ctx, security)
+	})
+}
+
+// SupportsQuorum returns true if every shard supports quorum options.
+func (d *db) SupportsQuorum() bool {
+	for _, sdb := range d.shards {
+		q, ok := sdb.(driver.Quorumer)
+		if !ok || !q.SupportsQuorum() {
+			return false
+		}
+	}
+	return true
+}
+
+// SupportedOptions returns the options declared by the first shard.
+func (d *db) SupportedOptions(method string) (map[string]driver.OptionType, bool) {
+	if v, ok := d.shards[0].(driver.OptionValidator); ok {
+		return v.SupportedOptions(method)
+	}
+	return nil, false
+}
+
+// PutMultipart stores the document on its shard. As the content of the
+// attachments can only be read once, design documents, which are written to
+// every shard, are only supported without attachments.
+func (d *db) PutMultipart(ctx context.Context, docID string, doc interface{}, atts []driver.MultipartAttachment, opts map[string]interface{}) (string, error) {
+	if isDesignDoc(docID) && len(atts) > 0 {
+		return "", errors.Status(kivik.StatusNotImplemented, "shard: attachments to design documents are not supported")
+	}
+	return d.put(ctx, docID, doc, opts, func(sdb driver.DB, doc interface{}) (string, error) {
+		p, ok := sdb.(driver.MultipartPutter)
+		if !ok {
+			return "", notImplemented("MultipartPutter")
+		}
+		return p.PutMultipart(ctx, docID, doc, atts, opts)
+	})
+}
+
+// Explain returns the query plan of the first shard, as indexes, being
+// design documents, are created on every shard.
+func (d *db) Explain(ctx context.Context, query interface{}) (*driver.QueryPlan, error) {
+	e, ok := d.shards[0].(driver.Explainer)
+	if !ok {
+		return nil, notImplemented("Explainer")
+	}
+	return e.Explain(ctx, query)
+}
+
+// DesignInfo returns the combined status of the view indexes of the shards:
+// the sizes are summed, an updater or compaction is reported as running if it
+// runs on any shard, and the sequence IDs combine those of every shard, as
+// for Stats, so that UpdateSeq may be compared with the UpdateSeq of Stats.
+func (d *db) DesignInfo(ctx context.Context, ddoc string) (*driver.DesignInfo, error) {
+	total := &driver.DesignInfo{}
+	updateSeqs := make([]string, len(d.shards))
+	purgeSeqs := make([]string, len(d.shards))
+	for i, sdb := range d.shards {
+		infoer, ok := sdb.(driver.DesignInfoer)
+		if !ok {
+			return nil, notImplemented("DesignInfoer")
+		}
+		info, err := infoer.DesignInfo(ctx, ddoc)
+		if err != nil {
+			return nil, err
+		}
+		if i == 0 {
+			total.Name = info.Name
+			total.Language = info.Language
+			total.Signature = info.Signature
+		}
+		total.CompactRunning = total.CompactRunning || info.CompactRunning
+		total.UpdaterRunning = total.UpdaterRunning || info.UpdaterRunning
+		total.WaitingCommit = total.WaitingCommit || info.WaitingCommit
+		total.WaitingClients += info.WaitingClients
+		total.DiskSize += info.DiskSize
+		total.ActiveSize += info.ActiveSize
+		total.ExternalSize += info.ExternalSize
+		updateSeqs[i] = info.UpdateSeq
+		purgeSeqs[i] = info.PurgeSeq
+	}
+	total.UpdateSeq = encodeSeq(updateSeqs)
+	total.PurgeSeq = encodeSeq(purgeSeqs)
+	return total, nil
+}
+
+func (d *db) CombineAttachments(ctx context.Context, docID, rev, filename, contentType string, parts []string) (string, error) {
+	if isDesignDoc(docID) {
+		return "", errors.Status(kivik.StatusNotImplemented, "shard: attachments to design documents are not supported")
+	}
+	c, ok := d.shard(docID).(driver.AttachmentCombiner)
+	if !ok {
+		return "", notImplemented("AttachmentCombiner")
+	}
+	return c.CombineAttachments(ctx, docID, rev, filename, contentType, parts)
+}
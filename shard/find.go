@@ -0,0 +1,256 @@
+package shard
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+
+	"github.com/flimzy/kivik"
+	"github.com/flimzy/kivik/driver"
+	"github.com/flimzy/kivik/errors"
+)
+
+var _ driver.Finder = &db{}
+
+// defaultFindLimit is the limit of Find, if the query sets none, as with
+// CouchDB.
+const defaultFindLimit = 25
+
+// Find queries every shard, and merges the results in the order of the sort
+// fields of the query, or, without a sort, in the order of the shards. The
+// skip and limit fields are applied to the merged results. As the merge reads
+// the sort fields from the documents, they must be included in any fields of
+// the query. Bookmarks, which are specific to a shard, are not supported.
+func (d *db) Find(ctx context.Context, query interface{}) (driver.Rows, error) {
+	q, err := findQuery(query)
+	if err != nil {
+		return nil, err
+	}
+	if _, ok := q["bookmark"]; ok {
+		return nil, errors.Status(kivik.StatusNotImplemented, "shard: bookmarks are not supported")
+	}
+	skip, err := intOption(q, "skip")
+	if err != nil {
+		return nil, err
+	}
+	if skip < 0 {
+		skip = 0
+	}
+	limit, err := intOption(q, "limit")
+	if err != nil {
+		return nil, err
+	}
+	if limit < 0 {
+		limit = defaultFindLimit
+	}
+	sort, err := sortFields(q["sort"])
+	if err != nil {
+		return nil, err
+	}
+	if err := checkSortFields(sort, q["fields"]); err != nil {
+		return nil, err
+	}
+	shardQuery := make(map[string]interface{}, len(q))
+	for k, v := range q {
+		shardQuery[k] = v
+	}
+	delete(shardQuery, "skip")
+	shardQuery["limit"] = limit + skip
+	m := &mergedRows{
+		limit: limit,
+		skip:  skip,
+		less:  sortOrder(sort),
+	}
+	for _, sdb := range d.shards {
+		f, ok := sdb.(driver.Finder)
+		if !ok {
+			_ = m.Close()
+			return nil, notImplemented("Finder")
+		}
+		rows, err := f.Find(ctx, shardQuery)
+		if err != nil {
+			_ = m.Close()
+			return nil, err
+		}
+		m.sources = append(m.sources, rows)
+	}
+	return &findRows{mergedRows: m}, nil
+}
+
+// CreateIndex creates the index on every shard, as for design documents.
+func (d *db) CreateIndex(ctx context.Context, ddoc, name string, index interface{}) error {
+	return d.each(func(sdb driver.DB) error {
+		f, ok := sdb.(driver.Finder)
+		if !ok {
+			return notImplemented("Finder")
+		}
+		return f.CreateIndex(ctx, ddoc, name, index)
+	})
+}
+
+// GetIndexes returns the indexes of the first shard, as they are created on
+// every shard.
+func (d *db) GetIndexes(ctx context.Context) ([]driver.Index, error) {
+	f, ok := d.shards[0].(driver.Finder)
+	if !ok {
+		return nil, notImplemented("Finder")
+	}
+	return f.GetIndexes(ctx)
+}
+
+func (d *db) DeleteIndex(ctx context.Context, ddoc, name string) error {
+	return d.each(func(sdb driver.DB) error {
+		f, ok := sdb.(driver.Finder)
+		if !ok {
+			return notImplemented("Finder")
+		}
+		return f.DeleteIndex(ctx, ddoc, name)
+	})
+}
+
+// findQuery decodes a query, which may be JSON, as a string, []byte or
+// json.RawMessage, or any value which marshals to a JSON object.
+func findQuery(query interface{}) (map[string]interface{}, error) {
+	var body []byte
+	switch t := query.(type) {
+	case string:
+		body = []byte(t)
+	case []byte:
+		body = t
+	case json.RawMessage:
+		body = t
+	default:
+		var err error
+		if body, err = json.Marshal(query); err != nil {
+			return nil, errors.WrapStatus(kivik.StatusBadRequest, err)
+		}
+	}
+	var q map[string]interface{}
+	if err := json.Unmarshal(body, &q); err != nil {
+		return nil, errors.WrapStatus(kivik.StatusBadRequest, err)
+	}
+	return q, nil
+}
+
+type sortField struct {
+	name       string
+	descending bool
+}
+
+// sortFields decodes the sort field of a query, a list of field names, or of
+// objects which map a field name to "asc" or "desc".
+func sortFields(sort interface{}) ([]sortField, error) {
+	if sort == nil {
+		return nil, nil
+	}
+	list, ok := sort.([]interface{})
+	if !ok {
+		return nil, errors.Status(kivik.StatusBadRequest, "shard: invalid sort")
+	}
+	fields := make([]sortField, 0, len(list))
+	for _, item := range list {
+		switch t := item.(type) {
+		case string:
+			fields = append(fields, sortField{name: t})
+			continue
+		case map[string]interface{}:
+			if len(t) != 1 {
+				break
+			}
+			var valid bool
+			for name, dir := range t {
+				if dir == "asc" || dir == "desc" {
+					fields = append(fields, sortField{name: name, descending: dir == "desc"})
+					valid = true
+				}
+			}
+			if valid {
+				continue
+			}
+		}
+		return nil, errors.Statusf(kivik.StatusBadRequest, "shard: invalid sort field %v", item)
+	}
+	return fields, nil
+}
+
+// checkSortFields returns an error if the fields of a query do not include
+// every sort field, as they are read from the documents to merge the results.
+func checkSortFields(sort []sortField, fields interface{}) error {
+	if fields == nil {
+		return nil
+	}
+	list, _ := fields.([]interface{})
+	for _, field := range sort {
+		var found bool
+		for _, f := range list {
+			name, _ := f.(string)
+			if field.name == name || strings.HasPrefix(field.name, name+".") {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return errors.Statusf(kivik.StatusNotImplemented, "shard: sort field %s must be included in fields", field.name)
+		}
+	}
+	return nil
+}
+
+// sortOrder returns the order of the results of a query with the sort fields
+// sort. Without sort fields, the results are returned in the order of the
+// shards.
+func sortOrder(sort []sortField) func(a, b *driver.Row) bool {
+	return func(a, b *driver.Row) bool {
+		if len(sort) == 0 {
+			return false
+		}
+		var docA, docB map[string]interface{}
+		_ = json.Unmarshal(a.Doc, &docA)
+		_ = json.Unmarshal(b.Doc, &docB)
+		for _, field := range sort {
+			c := collate(fieldValue(docA, field.name), fieldValue(docB, field.name))
+			if c == 0 {
+				continue
+			}
+			if field.descending {
+				return c > 0
+			}
+			return c < 0
+		}
+		return false
+	}
+}
+
+// fieldValue returns the value of the named field of doc, the name of a
+// nested field being separated by dots, or nil if doc has no such field.
+func fieldValue(doc map[string]interface{}, name string) interface{} {
+	var value interface{} = doc
+	for _, part := range strings.Split(name, ".") {
+		obj, ok := value.(map[string]interface{})
+		if !ok {
+			return nil
+		}
+		value = obj[part]
+	}
+	return value
+}
+
+// findRows are the merged results of Find.
+type findRows struct {
+	*mergedRows
+}
+
+var _ driver.RowsWarner = &findRows{}
+
+// Warning returns the first warning of the shards, as the shards have the
+// same indexes.
+func (r *findRows) Warning() string {
+	for _, rows := range r.sources {
+		if w, ok := rows.(driver.RowsWarner); ok {
+			if warning := w.Warning(); warning != "" {
+				return warning
+			}
+		}
+	}
+	return ""
+}
@@ -0,0 +1,533 @@
+package shard
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"strconv"
+	"strings"
+
+	"github.com/flimzy/kivik"
+	"github.com/flimzy/kivik/driver"
+	"github.com/flimzy/kivik/errors"
+)
+
+func (d *db) AllDocs(ctx context.Context, opts map[string]interface{}) (driver.Rows, error) {
+	return d.query(opts, true, func(sdb driver.DB, opts map[string]interface{}) (driver.Rows, error) {
+		return sdb.AllDocs(ctx, opts)
+	})
+}
+
+func (d *db) Query(ctx context.Context, ddoc, view string, opts map[string]interface{}) (driver.Rows, error) {
+	return d.query(opts, false, func(sdb driver.DB, opts map[string]interface{}) (driver.Rows, error) {
+		return sdb.Query(ctx, ddoc, view, opts)
+	})
+}
+
+// query queries every shard with fn, and merges the results. The skip and
+// limit options are applied to the merged results.
+func (d *db) query(opts map[string]interface{}, allDocs bool, fn func(driver.DB, map[string]interface{}) (driver.Rows, error)) (driver.Rows, error) {
+	skip, err := intOption(opts, "skip")
+	if err != nil {
+		return nil, err
+	}
+	if skip < 0 {
+		skip = 0
+	}
+	limit, err := intOption(opts, "limit")
+	if err != nil {
+		return nil, err
+	}
+	shardOpts := make(map[string]interface{}, len(opts))
+	for k, v := range opts {
+		shardOpts[k] = v
+	}
+	delete(shardOpts, "skip")
+	if limit >= 0 {
+		shardOpts["limit"] = limit + skip
+	}
+	if keys, ok := opts["keys"]; ok {
+		return d.queryKeys(keys, shardOpts, allDocs, skip, limit, fn)
+	}
+	m := &mergedRows{
+		limit:  limit,
+		skip:   skip,
+		offset: int64(skip),
+		less:   keyOrder(allDocs, boolOption(opts, "descending")),
+		views:  !allDocs,
+	}
+	for _, sdb := range d.shards {
+		rows, err := fn(sdb, shardOpts)
+		if err != nil {
+			_ = m.Close()
+			return nil, err
+		}
+		m.sources = append(m.sources, rows)
+	}
+	return m, nil
+}
+
+// queryKeys queries every shard for keys, and returns the rows in the order
+// of keys. For AllDocs, only the keys held by each shard are requested.
+func (d *db) queryKeys(keys interface{}, opts map[string]interface{}, allDocs bool, skip, limit int, fn func(driver.DB, map[string]interface{}) (driver.Rows, error)) (driver.Rows, error) {
+	rawKeys, encoded, err := decodeKeys(keys)
+	if err != nil {
+		return nil, err
+	}
+	shardKeys := make([][]json.RawMessage, len(d.shards))
+	for _, key := range rawKeys {
+		if !allDocs {
+			for s := range d.shards {
+				shardKeys[s] = append(shardKeys[s], key)
+			}
+			continue
+		}
+		var docID string
+		if err := json.Unmarshal(key, &docID); err != nil {
+			return nil, errors.Statusf(kivik.StatusBadRequest, "shard: invalid document ID %s in keys", key)
+		}
+		s := 0
+		if !isDesignDoc(docID) {
+			s = d.client.shardFor(docID)
+		}
+		shardKeys[s] = append(shardKeys[s], key)
+	}
+	result := &bufferedRows{}
+	byKey := make(map[string][]*driver.Row)
+	seqs := make([]string, len(d.shards))
+	for s, sdb := range d.shards {
+		if len(shardKeys[s]) == 0 {
+			continue
+		}
+		keyOpts := make(map[string]interface{}, len(opts))
+		for k, v := range opts {
+			keyOpts[k] = v
+		}
+		delete(keyOpts, "limit")
+		keyOpts["keys"] = encodeKeys(shardKeys[s], encoded)
+		rows, err := fn(sdb, keyOpts)
+		if err != nil {
+			return nil, err
+		}
+		err = readRows(rows, func(row *driver.Row) {
+			key := canonicalJSON(row.Key)
+			byKey[key] = append(byKey[key], row)
+		})
+		if err != nil {
+			return nil, err
+		}
+		result.totalRows += rows.TotalRows()
+		seqs[s] = rows.UpdateSeq()
+	}
+	for _, key := range rawKeys {
+		canonical := canonicalJSON(key)
+		result.rows = append(result.rows, byKey[canonical]...)
+		// A key given more than once is returned only once by each shard.
+		delete(byKey, canonical)
+	}
+	result.updateSeq = combinedSeq(seqs)
+	result.offset = int64(skip)
+	if skip > len(result.rows) {
+		skip = len(result.rows)
+	}
+	result.rows = result.rows[skip:]
+	if limit >= 0 && limit < len(result.rows) {
+		result.rows = result.rows[:limit]
+	}
+	return result, nil
+}
+
+// decodeKeys decodes the keys option, which may be a JSON array, as encoded
+// by kivik.EncodeKey, or a slice of keys. encoded is true in the first case.
+func decodeKeys(keys interface{}) (rawKeys []json.RawMessage, encoded bool, err error) {
+	var body []byte
+	if s, ok := keys.(string); ok {
+		body, encoded = []byte(s), true
+	} else if body, err = json.Marshal(keys); err != nil {
+		return nil, false, errors.WrapStatus(kivik.StatusBadRequest, err)
+	}
+	if err := json.Unmarshal(body, &rawKeys); err != nil {
+		return nil, false, errors.WrapStatus(kivik.StatusBadRequest, err)
+	}
+	return rawKeys, encoded, nil
+}
+
+// encodeKeys encodes keys in the same form as the keys option from which they
+// were decoded.
+func encodeKeys(keys []json.RawMessage, encoded bool) interface{} {
+	if !encoded {
+		result := make([]interface{}, len(keys))
+		for i, key := range keys {
+			result[i] = key
+		}
+		return result
+	}
+	body, _ := json.Marshal(keys)
+	return string(body)
+}
+
+// canonicalJSON returns the compacted form of value, so that equal keys
+// compare equal.
+func canonicalJSON(value json.RawMessage) string {
+	var buf bytes.Buffer
+	if err := json.Compact(&buf, value); err != nil {
+		return string(value)
+	}
+	return buf.String()
+}
+
+// readRows calls fn with each row of rows, then closes rows.
+func readRows(rows driver.Rows, fn func(*driver.Row)) error {
+	defer func() { _ = rows.Close() }()
+	for {
+		row := &driver.Row{}
+		if err := rows.Next(row); err != nil {
+			if err == io.EOF {
+				return nil
+			}
+			return err
+		}
+		fn(row)
+	}
+}
+
+// intOption returns the named integer option, or -1 if it is unset.
+func intOption(opts map[string]interface{}, name string) (int, error) {
+	switch t := opts[name].(type) {
+	case nil:
+		return -1, nil
+	case int:
+		return t, nil
+	case int64:
+		return int(t), nil
+	case float64:
+		if t == float64(int(t)) {
+			return int(t), nil
+		}
+	case string:
+		if n, err := strconv.Atoi(t); err == nil {
+			return n, nil
+		}
+	}
+	return 0, errors.Statusf(kivik.StatusBadRequest, "shard: invalid %s value %v", name, opts[name])
+}
+
+func boolOption(opts map[string]interface{}, name string) bool {
+	return opts[name] == true || opts[name] == "true"
+}
+
+// mergedRows merges the sorted results of the shards.
+type mergedRows struct {
+	sources []driver.Rows
+	heads   []*driver.Row
+	started bool
+	skip    int
+	limit   int
+	// offset is the skip option, which is added to the offsets of the
+	// shards.
+	offset int64
+	// less returns true if row a is returned before row b.
+	less func(a, b *driver.Row) bool
+	// views is true for the results of a view, whose rows without a
+	// document ID are reduced.
+	views bool
+}
+
+var _ driver.Rows = &mergedRows{}
+
+func (r *mergedRows) advance(i int) error {
+	r.heads[i] = nil
+	row := &driver.Row{}
+	if err := r.sources[i].Next(row); err != nil {
+		if err == io.EOF {
+			return nil
+		}
+		return err
+	}
+	if r.views && row.ID == "" {
+		return errors.Status(kivik.StatusNotImplemented, "shard: reduced view results cannot be merged")
+	}
+	r.heads[i] = row
+	return nil
+}
+
+// keyOrder returns the order of the rows of AllDocs, or of a view, which
+// are sorted by key, then by document ID.
+func keyOrder(allDocs, descending bool) func(a, b *driver.Row) bool {
+	return func(a, b *driver.Row) bool {
+		var c int
+		if !allDocs {
+			c = collateJSON(a.Key, b.Key)
+		}
+		if c == 0 {
+			c = strings.Compare(a.ID, b.ID)
+		}
+		if descending {
+			return c > 0
+		}
+		return c < 0
+	}
+}
+
+func (r *mergedRows) Next(row *driver.Row) error {
+	if !r.started {
+		r.started = true
+		r.heads = make([]*driver.Row, len(r.sources))
+		for i := range r.sources {
+			if err := r.advance(i); err != nil {
+				return err
+			}
+		}
+	}
+	for {
+		if r.limit == 0 {
+			return io.EOF
+		}
+		next := -1
+		for i, head := range r.heads {
+			if head != nil && (next < 0 || r.less(head, r.heads[next])) {
+				next = i
+			}
+		}
+		if next < 0 {
+			return io.EOF
+		}
+		head := r.heads[next]
+		if err := r.advance(next); err != nil {
+			return err
+		}
+		if r.skip > 0 {
+			r.skip--
+			continue
+		}
+		if r.limit > 0 {
+			r.limit--
+		}
+		*row = *head
+		return nil
+	}
+}
+
+func (r *mergedRows) Close() error {
+	var err error
+	for _, rows := range r.sources {
+		if e := rows.Close(); e != nil && err == nil {
+			err = e
+		}
+	}
+	return err
+}
+
+// UpdateSeq combines the update sequences of the shards.
+func (r *mergedRows) UpdateSeq() string {
+	seqs := make([]string, len(r.sources))
+	for i, rows := range r.sources {
+		seqs[i] = rows.UpdateSeq()
+	}
+	return combinedSeq(seqs)
+}
+
+// Offset returns the sum of the offsets of the shards, plus the number of
+// rows skipped.
+func (r *mergedRows) Offset() int64 {
+	var offset int64
+	for _, rows := range r.sources {
+		offset += rows.Offset()
+	}
+	return offset + r.offset
+}
+
+// TotalRows returns the sum of the total rows of the shards.
+func (r *mergedRows) TotalRows() int64 {
+	var total int64
+	for _, rows := range r.sources {
+		total += rows.TotalRows()
+	}
+	return total
+}
+
+// combinedSeq returns the combined sequence of seqs, or an empty string if
+// no shard returned a sequence.
+func combinedSeq(seqs []string) string {
+	for _, seq := range seqs {
+		if seq != "" {
+			return encodeSeq(seqs)
+		}
+	}
+	return ""
+}
+
+type bufferedRows struct {
+	rows      []*driver.Row
+	offset    int64
+	totalRows int64
+	updateSeq string
+}
+
+var _ driver.Rows = &bufferedRows{}
+
+func (r *bufferedRows) Next(row *driver.Row) error {
+	if len(r.rows) == 0 {
+		return io.EOF
+	}
+	*row, r.rows = *r.rows[0], r.rows[1:]
+	return nil
+}
+
+func (r *bufferedRows) Close() error {
+	r.rows = nil
+	return nil
+}
+
+func (r *bufferedRows) UpdateSeq() string { return r.updateSeq }
+func (r *bufferedRows) Offset() int64     { return r.offset }
+func (r *bufferedRows) TotalRows() int64  { return r.totalRows }
+
+// Changes interleaves the changes feeds of the shards. The since option may
+// be a sequence ID returned by a previous feed, or a value, such as "now",
+// which is passed to every shard.
+func (d *db) Changes(ctx context.Context, opts map[string]interface{}) (driver.Changes, error) {
+	limit, err := intOption(opts, "limit")
+	if err != nil {
+		return nil, err
+	}
+	seqs := make([]string, len(d.shards))
+	shardOpts := make([]map[string]interface{}, len(d.shards))
+	for i := range d.shards {
+		shardOpts[i] = make(map[string]interface{}, len(opts))
+		for k, v := range opts {
+			shardOpts[i][k] = v
+		}
+	}
+	if since, ok := sinceOption(opts["since"]); ok {
+		if seqs, err = decodeSeq(since, len(d.shards)); err != nil {
+			return nil, err
+		}
+		for i, seq := range seqs {
+			shardOpts[i]["since"] = seq
+		}
+	}
+	ctx, cancel := context.WithCancel(ctx)
+	c := &changes{
+		cancel:  cancel,
+		seqs:    seqs,
+		limit:   limit,
+		results: make(chan shardChange),
+		done:    make(chan struct{}),
+		running: len(d.shards),
+	}
+	for i, sdb := range d.shards {
+		feed, err := sdb.Changes(ctx, shardOpts[i])
+		if err != nil {
+			_ = c.Close()
+			return nil, err
+		}
+		c.feeds = append(c.feeds, feed)
+	}
+	for i, feed := range c.feeds {
+		go c.read(i, feed)
+	}
+	return c, nil
+}
+
+// sinceOption returns the since option, if it is a combined sequence ID,
+// rather than a value to be passed to every shard, such as "now" or 0.
+func sinceOption(since interface{}) (string, bool) {
+	var s string
+	switch t := since.(type) {
+	case string:
+		s = t
+	case kivik.SequenceID:
+		s = string(t)
+	case driver.SequenceID:
+		s = string(t)
+	default:
+		return "", false
+	}
+	if s == "" || s == "now" || s == "0" {
+		return "", false
+	}
+	return s, true
+}
+
+type shardChange struct {
+	shard  int
+	change *driver.Change
+	err    error
+}
+
+type changes struct {
+	cancel  context.CancelFunc
+	feeds   []driver.Changes
+	results chan shardChange
+	done    chan struct{}
+	closed  bool
+	// running is the number of feeds not yet finished.
+	running int
+	err     error
+	seqs    []string
+	limit   int
+}
+
+var _ driver.Changes = &changes{}
+
+// read sends the changes of feed to c.results, until the feed ends, or c is
+// closed.
+func (c *changes) read(shard int, feed driver.Changes) {
+	for {
+		change := &driver.Change{}
+		err := feed.Next(change)
+		select {
+		case c.results <- shardChange{shard: shard, change: change, err: err}:
+		case <-c.done:
+			return
+		}
+		if err != nil {
+			return
+		}
+	}
+}
+
+func (c *changes) Next(change *driver.Change) error {
+	for {
+		if c.err != nil {
+			return c.err
+		}
+		if c.limit == 0 || c.running == 0 {
+			return io.EOF
+		}
+		result := <-c.results
+		if result.err == io.EOF {
+			c.running--
+			continue
+		}
+		if result.err != nil {
+			c.err = result.err
+			continue
+		}
+		if c.limit > 0 {
+			c.limit--
+		}
+		c.seqs[result.shard] = string(result.change.Seq)
+		*change = *result.change
+		change.Seq = driver.SequenceID(encodeSeq(c.seqs))
+		return nil
+	}
+}
+
+func (c *changes) Close() error {
+	if c.closed {
+		return nil
+	}
+	c.closed = true
+	close(c.done)
+	c.cancel()
+	var err error
+	for _, feed := range c.feeds {
+		if e := feed.Close(); e != nil && err == nil {
+			err = e
+		}
+	}
+	return err
+}
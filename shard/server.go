@@ -0,0 +1,298 @@
+package shard
+
+import (
+	"context"
+	"io"
+
+	"github.com/flimzy/kivik"
+	"github.com/flimzy/kivik/driver"
+	"github.com/flimzy/kivik/errors"
+)
+
+var _ driver.DiskUsager = &client{}
+var _ driver.AdminPartyChecker = &client{}
+var _ driver.Configer = &client{}
+var _ driver.Clusterer = &client{}
+var _ driver.ClientReplicator = &client{}
+var _ driver.DBUpdater = &client{}
+
+// DiskUsage returns the sums of the disk usage and quotas of the shards.
+func (c *client) DiskUsage(ctx context.Context) (*driver.DiskUsage, error) {
+	total := &driver.DiskUsage{}
+	for _, sc := range c.shards {
+		u, ok := sc.(driver.DiskUsager)
+		if !ok {
+			return nil, notImplemented("DiskUsager")
+		}
+		usage, err := u.DiskUsage(ctx)
+		if err != nil {
+			return nil, err
+		}
+		total.Usage += usage.Usage
+		total.Quota += usage.Quota
+	}
+	return total, nil
+}
+
+// AdminParty returns true if any shard grants admin rights to unauthenticated
+// requests, as the documents it holds are then unprotected.
+func (c *client) AdminParty(ctx context.Context) (bool, error) {
+	for _, sc := range c.shards {
+		a, ok := sc.(driver.AdminPartyChecker)
+		if !ok {
+			return false, notImplemented("AdminPartyChecker")
+		}
+		party, err := a.AdminParty(ctx)
+		if err != nil || party {
+			return party, err
+		}
+	}
+	return false, nil
+}
+
+func configer(sc driver.Client) (driver.Configer, error) {
+	if configer, ok := sc.(driver.Configer); ok {
+		return configer, nil
+	}
+	return nil, notImplemented("Configer")
+}
+
+// Config returns the configuration of the first shard. The configuration is
+// expected to be the same on every shard, as changes made through the client
+// are made to every shard.
+func (c *client) Config(ctx context.Context, node string) (driver.Config, error) {
+	configer, err := configer(c.shards[0])
+	if err != nil {
+		return nil, err
+	}
+	return configer.Config(ctx, node)
+}
+
+func (c *client) ConfigSection(ctx context.Context, node, section string) (driver.ConfigSection, error) {
+	configer, err := configer(c.shards[0])
+	if err != nil {
+		return nil, err
+	}
+	return configer.ConfigSection(ctx, node, section)
+}
+
+func (c *client) ConfigValue(ctx context.Context, node, section, key string) (string, error) {
+	configer, err := configer(c.shards[0])
+	if err != nil {
+		return "", err
+	}
+	return configer.ConfigValue(ctx, node, section, key)
+}
+
+// SetConfigValue sets the value on every shard, and returns the previous value
+// of the first.
+func (c *client) SetConfigValue(ctx context.Context, node, section, key, value string) (string, error) {
+	return c.eachConfiger(func(configer driver.Configer) (string, error) {
+		return configer.SetConfigValue(ctx, node, section, key, value)
+	})
+}
+
+// DeleteConfigKey deletes the key on every shard, and returns the previous
+// value of the first.
+func (c *client) DeleteConfigKey(ctx context.Context, node, section, key string) (string, error) {
+	return c.eachConfiger(func(configer driver.Configer) (string, error) {
+		return configer.DeleteConfigKey(ctx, node, section, key)
+	})
+}
+
+// eachConfiger calls fn with every shard, and returns the value returned for
+// the first, or the first error encountered.
+func (c *client) eachConfiger(fn func(driver.Configer) (string, error)) (string, error) {
+	var first string
+	for i, sc := range c.shards {
+		configer, err := configer(sc)
+		if err != nil {
+			return "", err
+		}
+		value, err := fn(configer)
+		if err != nil {
+			return "", err
+		}
+		if i == 0 {
+			first = value
+		}
+	}
+	return first, nil
+}
+
+// Membership returns the nodes of the clusters of every shard, each listed
+// once.
+func (c *client) Membership(ctx context.Context) (*driver.Membership, error) {
+	total := &driver.Membership{}
+	allNodes := make(map[string]bool)
+	clusterNodes := make(map[string]bool)
+	for _, sc := range c.shards {
+		cl, ok := sc.(driver.Clusterer)
+		if !ok {
+			return nil, notImplemented("Clusterer")
+		}
+		membership, err := cl.Membership(ctx)
+		if err != nil {
+			return nil, err
+		}
+		total.AllNodes = appendNew(total.AllNodes, allNodes, membership.AllNodes)
+		total.ClusterNodes = appendNew(total.ClusterNodes, clusterNodes, membership.ClusterNodes)
+	}
+	return total, nil
+}
+
+// appendNew appends to nodes those of add which are not in seen, and adds
+// them to seen.
+func appendNew(nodes []string, seen map[string]bool, add []string) []string {
+	for _, node := range add {
+		if !seen[node] {
+			seen[node] = true
+			nodes = append(nodes, node)
+		}
+	}
+	return nodes
+}
+
+// AddNode is not supported, as a node joins the cluster of a single shard,
+// which cannot be chosen through the client.
+func (c *client) AddNode(_ context.Context, _ string) error {
+	return errors.Status(kivik.StatusNotImplemented, "shard: nodes cannot be added to a sharded cluster")
+}
+
+// RemoveNode is not supported, for the same reason as AddNode.
+func (c *client) RemoveNode(_ context.Context, _ string) error {
+	return errors.Status(kivik.StatusNotImplemented, "shard: nodes cannot be removed from a sharded cluster")
+}
+
+// Replicate is not supported, as a replication is run by a single server,
+// which holds only its shard of the source or target, and would not partition
+// the documents it writes among the shards.
+func (c *client) Replicate(_ context.Context, _, _ string, _ map[string]interface{}) (driver.Replication, error) {
+	return nil, errors.Status(kivik.StatusNotImplemented, "shard: replication of sharded databases is not supported")
+}
+
+// GetReplications returns the replications of every shard, such as those
+// created directly on a shard's server.
+func (c *client) GetReplications(ctx context.Context, opts map[string]interface{}) ([]driver.Replication, error) {
+	var reps []driver.Replication
+	for _, sc := range c.shards {
+		r, ok := sc.(driver.ClientReplicator)
+		if !ok {
+			return nil, notImplemented("ClientReplicator")
+		}
+		shardReps, err := r.GetReplications(ctx, opts)
+		if err != nil {
+			return nil, err
+		}
+		reps = append(reps, shardReps...)
+	}
+	return reps, nil
+}
+
+// DBUpdates interleaves the database updates of the shards, with sequence IDs
+// which combine the sequence of every shard, as for Changes. As databases are
+// created and destroyed on every shard, only the first shard's created and
+// deleted events are reported.
+func (c *client) DBUpdates() (driver.DBUpdates, error) {
+	u := &dbUpdates{
+		seqs:    make([]string, len(c.shards)),
+		results: make(chan shardUpdate),
+		done:    make(chan struct{}),
+		running: len(c.shards),
+	}
+	for _, sc := range c.shards {
+		updater, ok := sc.(driver.DBUpdater)
+		if !ok {
+			_ = u.Close()
+			return nil, notImplemented("DBUpdater")
+		}
+		feed, err := updater.DBUpdates()
+		if err != nil {
+			_ = u.Close()
+			return nil, err
+		}
+		u.feeds = append(u.feeds, feed)
+	}
+	for i, feed := range u.feeds {
+		go u.read(i, feed)
+	}
+	return u, nil
+}
+
+type shardUpdate struct {
+	shard  int
+	update *driver.DBUpdate
+	err    error
+}
+
+type dbUpdates struct {
+	feeds   []driver.DBUpdates
+	results chan shardUpdate
+	done    chan struct{}
+	closed  bool
+	// running is the number of feeds not yet finished.
+	running int
+	err     error
+	seqs    []string
+}
+
+var _ driver.DBUpdates = &dbUpdates{}
+
+// read sends the updates of feed to u.results, until the feed ends, or u is
+// closed.
+func (u *dbUpdates) read(shard int, feed driver.DBUpdates) {
+	for {
+		update := &driver.DBUpdate{}
+		err := feed.Next(update)
+		select {
+		case u.results <- shardUpdate{shard: shard, update: update, err: err}:
+		case <-u.done:
+			return
+		}
+		if err != nil {
+			return
+		}
+	}
+}
+
+func (u *dbUpdates) Next(update *driver.DBUpdate) error {
+	for {
+		if u.err != nil {
+			return u.err
+		}
+		if u.running == 0 {
+			return io.EOF
+		}
+		result := <-u.results
+		if result.err == io.EOF {
+			u.running--
+			continue
+		}
+		if result.err != nil {
+			u.err = result.err
+			continue
+		}
+		u.seqs[result.shard] = result.update.Seq
+		if result.shard > 0 && (result.update.Type == "created" || result.update.Type == "deleted") {
+			continue
+		}
+		*update = *result.update
+		update.Seq = encodeSeq(u.seqs)
+		return nil
+	}
+}
+
+func (u *dbUpdates) Close() error {
+	if u.closed {
+		return nil
+	}
+	u.closed = true
+	close(u.done)
+	var err error
+	for _, feed := range u.feeds {
+		if e := feed.Close(); e != nil && err == nil {
+			err = e
+		}
+	}
+	return err
+}
@@ -0,0 +1,259 @@
+// Package shard provides a Kivik driver which wraps another driver, to
+// partition the documents of each database among several databases, such as
+// those of several CouchDB servers, by a hash of the document ID.
+//
+// The DSN is a comma-separated list of the DSNs of the shards, each of which
+// is passed to the wrapped driver. Any commas within a shard's DSN must be
+// percent-encoded. The order of the shards determines where documents are
+// stored, so must not change once documents have been written.
+//
+//	shard.Register("couch-sharded", "couch", shard.Options{})
+//	client, err := kivik.New(context.TODO(), "couch-sharded", "http://couch1:5984/,http://couch2:5984/")
+//
+// Reads and writes of a single document are sent to the shard which holds
+// it. Design documents are written to every shard, so that views may be
+// queried, and read from the first. The revision given by the caller is that
+// of the first shard, and the copies on the other shards are written with
+// their own revisions. If a copy cannot be written, once the first shard has
+// been, the error reports which shards failed. Databases are created and
+// destroyed on every shard.
+//
+// The results of AllDocs and Query are merged in key order, and the skip and
+// limit options are applied to the merged results. The results of reduce
+// views cannot be merged, and are rejected with StatusNotImplemented. The
+// changes feeds of the shards are interleaved in the order the changes are
+// received, with sequence IDs which combine the sequence of every shard, and
+// which may be passed as the since option, as for a CouchDB 2.x cluster.
+//
+// Find queries every shard, and merges the results in the order of the sort
+// fields of the query. Mango indexes, like design documents, are created on
+// every shard. Bookmarks cannot be merged, and are rejected with
+// StatusNotImplemented.
+//
+// Server-level requests are sent to every shard: disk usage is summed, the
+// cluster membership lists the nodes of every shard, and the database update
+// feeds are interleaved. Configuration is read from the first shard, and
+// written to every shard. Replications of every shard are listed, but new
+// replications, and the addition and removal of cluster nodes, which would
+// each concern a single shard, are rejected with StatusNotImplemented.
+package shard
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"hash/fnv"
+	"strings"
+
+	"github.com/flimzy/kivik"
+	"github.com/flimzy/kivik/driver"
+	"github.com/flimzy/kivik/errors"
+)
+
+// Options configures a sharding driver.
+type Options struct {
+	// Hash returns the hash of a document ID, which, modulo the number of
+	// shards, selects the shard which holds the document. The default is the
+	// 32-bit FNV-1a hash of the ID.
+	Hash func(docID string) uint32
+}
+
+// FNV is the default hash, the 32-bit FNV-1a hash of the document ID.
+func FNV(docID string) uint32 {
+	h := fnv.New32a()
+	_, _ = h.Write([]byte(docID))
+	return h.Sum32()
+}
+
+type shardDriver struct {
+	drv  driver.Driver
+	opts Options
+}
+
+var _ driver.Driver = &shardDriver{}
+
+// New returns a driver which wraps drv, to partition documents among several
+// shards.
+func New(drv driver.Driver, opts Options) driver.Driver {
+	if opts.Hash == nil {
+		opts.Hash = FNV
+	}
+	return &shardDriver{drv: drv, opts: opts}
+}
+
+// Register registers a sharding version of the driver registered as wrapped,
+// under the new name name.
+func Register(name, wrapped string, opts Options) error {
+	drv, ok := kivik.LookupDriver(wrapped)
+	if !ok {
+		return errors.Statusf(kivik.StatusBadRequest, "shard: unknown driver %q (forgotten import?)", wrapped)
+	}
+	kivik.Register(name, New(drv, opts))
+	return nil
+}
+
+func (d *shardDriver) NewClient(ctx context.Context, dsn string) (driver.Client, error) {
+	c := &client{hash: d.opts.Hash}
+	for _, shardDSN := range strings.Split(dsn, ",") {
+		shardDSN = strings.TrimSpace(shardDSN)
+		if shardDSN == "" {
+			continue
+		}
+		sc, err := d.drv.NewClient(ctx, shardDSN)
+		if err != nil {
+			return nil, err
+		}
+		c.shards = append(c.shards, sc)
+	}
+	if len(c.shards) == 0 {
+		return nil, errors.Status(kivik.StatusBadRequest, "shard: no shards in DSN")
+	}
+	return c, nil
+}
+
+type client struct {
+	shards []driver.Client
+	hash   func(string) uint32
+}
+
+var _ driver.Client = &client{}
+var _ driver.Authenticator = &client{}
+var _ driver.PoolStatser = &client{}
+var _ driver.OptionValidator = &client{}
+
+func notImplemented(iface string) error {
+	return errors.Statusf(kivik.StatusNotImplemented, "kivik: driver does not implement %s", iface)
+}
+
+// Version returns the version of the first shard.
+func (c *client) Version(ctx context.Context) (*driver.Version, error) {
+	return c.shards[0].Version(ctx)
+}
+
+// AllDBs returns the databases of the first shard, as databases are created
+// on every shard.
+func (c *client) AllDBs(ctx context.Context, opts map[string]interface{}) ([]string, error) {
+	return c.shards[0].AllDBs(ctx, opts)
+}
+
+// DBExists returns true if the database exists on every shard.
+func (c *client) DBExists(ctx context.Context, dbName string, opts map[string]interface{}) (bool, error) {
+	for _, sc := range c.shards {
+		exists, err := sc.DBExists(ctx, dbName, opts)
+		if err != nil || !exists {
+			return false, err
+		}
+	}
+	return true, nil
+}
+
+func (c *client) CreateDB(ctx context.Context, dbName string, opts map[string]interface{}) error {
+	for _, sc := range c.shards {
+		if err := sc.CreateDB(ctx, dbName, opts); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (c *client) DestroyDB(ctx context.Context, dbName string, opts map[string]interface{}) error {
+	for _, sc := range c.shards {
+		if err := sc.DestroyDB(ctx, dbName, opts); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (c *client) DB(ctx context.Context, dbName string, opts map[string]interface{}) (driver.DB, error) {
+	d := &db{client: c, shards: make([]driver.DB, len(c.shards))}
+	for i, sc := range c.shards {
+		sdb, err := sc.DB(ctx, dbName, opts)
+		if err != nil {
+			return nil, err
+		}
+		d.shards[i] = sdb
+	}
+	return d, nil
+}
+
+// Authenticate authenticates with every shard. The first error encountered is
+// returned.
+func (c *client) Authenticate(ctx context.Context, authenticator interface{}) error {
+	for _, sc := range c.shards {
+		a, ok := sc.(driver.Authenticator)
+		if !ok {
+			return notImplemented("Authenticator")
+		}
+		if err := a.Authenticate(ctx, authenticator); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// PoolStats returns the sum of the connection pool statistics of the shards
+// which report them.
+func (c *client) PoolStats() (driver.PoolStats, error) {
+	var total driver.PoolStats
+	var found bool
+	for _, sc := range c.shards {
+		s, ok := sc.(driver.PoolStatser)
+		if !ok {
+			continue
+		}
+		stats, err := s.PoolStats()
+		if err != nil {
+			return driver.PoolStats{}, err
+		}
+		found = true
+		total.OpenConnections += stats.OpenConnections
+		total.IdleConnections += stats.IdleConnections
+		total.InFlight += stats.InFlight
+	}
+	if !found {
+		return driver.PoolStats{}, notImplemented("PoolStatser")
+	}
+	return total, nil
+}
+
+// SupportedOptions returns the options declared by the first shard, as all
+// shards use the same driver.
+func (c *client) SupportedOptions(method string) (map[string]driver.OptionType, bool) {
+	if v, ok := c.shards[0].(driver.OptionValidator); ok {
+		return v.SupportedOptions(method)
+	}
+	return nil, false
+}
+
+// isDesignDoc returns true for the IDs of design documents, which are written
+// to every shard.
+func isDesignDoc(docID string) bool {
+	return strings.HasPrefix(docID, "_design/")
+}
+
+// shardFor returns the index of the shard which holds docID.
+func (c *client) shardFor(docID string) int {
+	return int(c.hash(docID) % uint32(len(c.shards)))
+}
+
+// encodeSeq combines the sequence IDs of the shards into a single, opaque
+// sequence ID.
+func encodeSeq(seqs []string) string {
+	body, _ := json.Marshal(seqs)
+	return base64.RawURLEncoding.EncodeToString(body)
+}
+
+// decodeSeq splits a sequence ID returned by encodeSeq into the sequence IDs
+// of n shards.
+func decodeSeq(seq string, n int) ([]string, error) {
+	body, err := base64.RawURLEncoding.DecodeString(seq)
+	if err != nil {
+		return nil, errors.Statusf(kivik.StatusBadRequest, "shard: invalid sequence ID %q", seq)
+	}
+	var seqs []string
+	if err := json.Unmarshal(body, &seqs); err != nil || len(seqs) != n {
+		return nil, errors.Statusf(kivik.StatusBadRequest, "shard: invalid sequence ID %q", seq)
+	}
+	return seqs, nil
+}
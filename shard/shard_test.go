@@ -0,0 +1,695 @@
+package shard
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"sync"
+	"testing"
+
+	"github.com/flimzy/diff"
+	"github.com/flimzy/kivik"
+	"github.com/flimzy/kivik/driver"
+	_ "github.com/flimzy/kivik/driver/memory"
+	"github.com/flimzy/kivik/errors"
+	"github.com/flimzy/kivik/kiviktest"
+)
+
+// fakeDriver holds one fakeDB per DSN.
+type fakeDriver struct {
+	mu  sync.Mutex
+	dbs map[string]*fakeDB
+}
+
+func (d *fakeDriver) NewClient(_ context.Context, dsn string) (driver.Client, error) {
+	return &fakeClient{drv: d, dsn: dsn}, nil
+}
+
+func (d *fakeDriver) db(dsn string) *fakeDB {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.dbs[dsn] == nil {
+		d.dbs[dsn] = &fakeDB{docs: map[string]json.RawMessage{}}
+	}
+	return d.dbs[dsn]
+}
+
+type fakeClient struct {
+	driver.Client
+	drv *fakeDriver
+	dsn string
+}
+
+func (c *fakeClient) DiskUsage(_ context.Context) (*driver.DiskUsage, error) {
+	return &driver.DiskUsage{Usage: 10, Quota: 100}, nil
+}
+
+func (c *fakeClient) Membership(_ context.Context) (*driver.Membership, error) {
+	return &driver.Membership{
+		AllNodes:     []string{"node@" + c.dsn, "shared"},
+		ClusterNodes: []string{"node@" + c.dsn},
+	}, nil
+}
+
+func (c *fakeClient) AddNode(_ context.Context, _ string) error    { return nil }
+func (c *fakeClient) RemoveNode(_ context.Context, _ string) error { return nil }
+
+func (c *fakeClient) DBUpdates() (driver.DBUpdates, error) {
+	return &fakeUpdates{updates: []driver.DBUpdate{
+		{DBName: "new", Type: "created", Seq: "1"},
+		{DBName: "db_" + c.dsn, Type: "updated", Seq: "2"},
+	}}, nil
+}
+
+type fakeUpdates struct {
+	updates []driver.DBUpdate
+}
+
+func (u *fakeUpdates) Next(update *driver.DBUpdate) error {
+	if len(u.updates) == 0 {
+		return io.EOF
+	}
+	*update, u.updates = u.updates[0], u.updates[1:]
+	return nil
+}
+
+func (u *fakeUpdates) Close() error { return nil }
+
+func (c *fakeClient) DB(_ context.Context, _ string, _ map[string]interface{}) (driver.DB, error) {
+	return c.drv.db(c.dsn), nil
+}
+
+// fakeDB stores documents in memory, with revisions which depend only on the
+// document content, as with CouchDB.
+type fakeDB struct {
+	driver.DB
+	mu      sync.Mutex
+	docs    map[string]json.RawMessage
+	changes []driver.Change
+}
+
+func (d *fakeDB) Put(_ context.Context, docID string, doc interface{}) (string, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	body, err := json.Marshal(doc)
+	if err != nil {
+		return "", err
+	}
+	d.docs[docID] = body
+	rev := fmt.Sprintf("1-%d", len(body))
+	d.changes = append(d.changes, driver.Change{
+		ID:      docID,
+		Seq:     driver.SequenceID(fmt.Sprintf("%d", len(d.changes)+1)),
+		Changes: driver.ChangedRevs{rev},
+	})
+	return rev, nil
+}
+
+func (d *fakeDB) Get(_ context.Context, docID string, _ map[string]interface{}) (json.RawMessage, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	doc, ok := d.docs[docID]
+	if !ok {
+		return nil, errors.Statusf(kivik.StatusNotFound, "%s not found", docID)
+	}
+	return doc, nil
+}
+
+func (d *fakeDB) BulkDocs(ctx context.Context, docs []interface{}) (driver.BulkResults, error) {
+	var results []driver.BulkResult
+	for _, doc := range docs {
+		docID := doc.(map[string]interface{})["_id"].(string)
+		rev, err := d.Put(ctx, docID, doc)
+		results = append(results, driver.BulkResult{ID: docID, Rev: rev, Error: err})
+	}
+	return &bulkResults{results: results}, nil
+}
+
+func (d *fakeDB) AllDocs(_ context.Context, opts map[string]interface{}) (driver.Rows, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	var ids []string
+	if keys, ok := opts["keys"]; ok {
+		raw, _, err := decodeKeys(keys)
+		if err != nil {
+			return nil, err
+		}
+		for _, key := range raw {
+			var id string
+			_ = json.Unmarshal(key, &id)
+			ids = append(ids, id)
+		}
+	} else {
+		for id := range d.docs {
+			ids = append(ids, id)
+		}
+		sort.Strings(ids)
+		if opts["descending"] == true {
+			sort.Sort(sort.Reverse(sort.StringSlice(ids)))
+		}
+		if limit, ok := opts["limit"].(int); ok && limit < len(ids) {
+			ids = ids[:limit]
+		}
+	}
+	var rows []*driver.Row
+	for _, id := range ids {
+		key, _ := json.Marshal(id)
+		rows = append(rows, &driver.Row{ID: id, Key: key, Value: json.RawMessage(`{}`)})
+	}
+	return &bufferedRows{rows: rows, totalRows: int64(len(d.docs))}, nil
+}
+
+func (d *fakeDB) Changes(_ context.Context, opts map[string]interface{}) (driver.Changes, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	var since int
+	if s, ok := opts["since"].(string); ok {
+		_, _ = fmt.Sscan(s, &since)
+	}
+	var changes []*driver.Change
+	for i := since; i < len(d.changes); i++ {
+		change := d.changes[i]
+		changes = append(changes, &change)
+	}
+	return &fakeChanges{changes: changes}, nil
+}
+
+// DesignInfo reports the number of documents of the shard as the size and
+// update sequence of the index.
+func (d *fakeDB) DesignInfo(_ context.Context, ddoc string) (*driver.DesignInfo, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	n := len(d.docs)
+	return &driver.DesignInfo{
+		Name:           ddoc,
+		UpdaterRunning: n == 0,
+		DiskSize:       int64(n),
+		UpdateSeq:      fmt.Sprintf("%d-x", n),
+	}, nil
+}
+
+// Find returns the documents of the shard, in the order of the n field, up to
+// the limit of the query.
+func (d *fakeDB) Find(_ context.Context, query interface{}) (driver.Rows, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	q := query.(map[string]interface{})
+	if _, ok := q["skip"]; ok {
+		return nil, fmt.Errorf("skip sent to shard")
+	}
+	type numbered struct {
+		N int `json:"n"`
+	}
+	var docs []json.RawMessage
+	for _, doc := range d.docs {
+		docs = append(docs, doc)
+	}
+	n := func(doc json.RawMessage) int {
+		var x numbered
+		_ = json.Unmarshal(doc, &x)
+		return x.N
+	}
+	sort.Sort(byN{docs: docs, n: n})
+	if body, _ := json.Marshal(q["sort"]); string(body) == `[{"n":"desc"}]` {
+		sort.Sort(sort.Reverse(byN{docs: docs, n: n}))
+	}
+	if limit := q["limit"].(int); limit < len(docs) {
+		docs = docs[:limit]
+	}
+	var rows []*driver.Row
+	for _, doc := range docs {
+		rows = append(rows, &driver.Row{Doc: doc})
+	}
+	return &bufferedRows{rows: rows}, nil
+}
+
+func (d *fakeDB) CreateIndex(_ context.Context, _, _ string, _ interface{}) error {
+	return nil
+}
+
+func (d *fakeDB) GetIndexes(_ context.Context) ([]driver.Index, error) {
+	return nil, nil
+}
+
+func (d *fakeDB) DeleteIndex(_ context.Context, _, _ string) error {
+	return nil
+}
+
+type byN struct {
+	docs []json.RawMessage
+	n    func(json.RawMessage) int
+}
+
+func (s byN) Len() int           { return len(s.docs) }
+func (s byN) Less(i, j int) bool { return s.n(s.docs[i]) < s.n(s.docs[j]) }
+func (s byN) Swap(i, j int)      { s.docs[i], s.docs[j] = s.docs[j], s.docs[i] }
+
+type fakeChanges struct {
+	changes []*driver.Change
+}
+
+func (c *fakeChanges) Next(change *driver.Change) error {
+	if len(c.changes) == 0 {
+		return io.EOF
+	}
+	*change, c.changes = *c.changes[0], c.changes[1:]
+	return nil
+}
+
+func (c *fakeChanges) Close() error { return nil }
+
+const testDSN = "a,b,c"
+
+func newTestDB(t *testing.T) (*kivik.DB, *fakeDriver) {
+	drv := &fakeDriver{dbs: map[string]*fakeDB{}}
+	return kiviktest.NewDB(t, New(drv, Options{}), testDSN, "test"), drv
+}
+
+// shardOf returns the DSN of the shard which should hold docID.
+func shardOf(docID string) string {
+	return []string{"a", "b", "c"}[FNV(docID)%3]
+}
+
+func TestPutGet(t *testing.T) {
+	db, drv := newTestDB(t)
+	ctx := context.Background()
+	for i := 0; i < 20; i++ {
+		docID := fmt.Sprintf("doc%02d", i)
+		if _, err := db.Put(ctx, docID, map[string]interface{}{"n": i}); err != nil {
+			t.Fatal(err)
+		}
+		if _, ok := drv.db(shardOf(docID)).docs[docID]; !ok {
+			t.Errorf("%s not stored on shard %s", docID, shardOf(docID))
+		}
+		var doc struct {
+			N int `json:"n"`
+		}
+		row, err := db.Get(ctx, docID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := row.ScanDoc(&doc); err != nil {
+			t.Fatal(err)
+		}
+		if doc.N != i {
+			t.Errorf("Expected %d, got %d", i, doc.N)
+		}
+	}
+	if _, err := db.Put(ctx, "_design/foo", map[string]interface{}{}); err != nil {
+		t.Fatal(err)
+	}
+	for dsn, sdb := range drv.dbs {
+		if _, ok := sdb.docs["_design/foo"]; !ok {
+			t.Errorf("Design document not stored on shard %s", dsn)
+		}
+	}
+}
+
+func TestCreateDoc(t *testing.T) {
+	db, drv := newTestDB(t)
+	docID, _, err := db.CreateDoc(context.Background(), map[string]interface{}{"foo": "bar"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if docID == "" {
+		t.Fatal("Expected a generated ID")
+	}
+	if _, ok := drv.db(shardOf(docID)).docs[docID]; !ok {
+		t.Errorf("%s not stored on shard %s", docID, shardOf(docID))
+	}
+}
+
+func TestBulkDocs(t *testing.T) {
+	db, drv := newTestDB(t)
+	var docs []interface{}
+	var expected []string
+	for i := 0; i < 10; i++ {
+		docID := fmt.Sprintf("doc%d", i)
+		docs = append(docs, map[string]interface{}{"_id": docID})
+		expected = append(expected, docID)
+	}
+	results, err := db.BulkDocs(context.Background(), docs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var ids []string
+	for results.Next() {
+		ids = append(ids, results.ID())
+	}
+	if d := diff.Interface(expected, ids); d != "" {
+		t.Error(d)
+	}
+	for _, docID := range expected {
+		if _, ok := drv.db(shardOf(docID)).docs[docID]; !ok {
+			t.Errorf("%s not stored on shard %s", docID, shardOf(docID))
+		}
+	}
+}
+
+func allDocIDs(t *testing.T, db *kivik.DB, opts kivik.Options) []string {
+	rows, err := db.AllDocs(context.Background(), opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var ids []string
+	for rows.Next() {
+		ids = append(ids, rows.ID())
+	}
+	if err := rows.Err(); err != nil {
+		t.Fatal(err)
+	}
+	return ids
+}
+
+func TestAllDocs(t *testing.T) {
+	db, _ := newTestDB(t)
+	for i := 0; i < 10; i++ {
+		if _, err := db.Put(context.Background(), fmt.Sprintf("doc%d", i), map[string]interface{}{}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	tests := []struct {
+		name     string
+		opts     kivik.Options
+		expected []string
+	}{
+		{
+			name:     "All",
+			expected: []string{"doc0", "doc1", "doc2", "doc3", "doc4", "doc5", "doc6", "doc7", "doc8", "doc9"},
+		},
+		{
+			name:     "SkipLimit",
+			opts:     kivik.Options{"skip": 2, "limit": 3},
+			expected: []string{"doc2", "doc3", "doc4"},
+		},
+		{
+			name:     "Descending",
+			opts:     kivik.Options{"descending": true, "limit": 3},
+			expected: []string{"doc9", "doc8", "doc7"},
+		},
+		{
+			name:     "Keys",
+			opts:     kivik.Options{"keys": []string{"doc7", "doc1", "doc4"}},
+			expected: []string{"doc7", "doc1", "doc4"},
+		},
+		{
+			name:     "EncodedKeys",
+			opts:     kivik.Options{"keys": `["doc3","doc0"]`, "limit": 1},
+			expected: []string{"doc3"},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if d := diff.Interface(test.expected, allDocIDs(t, db, test.opts)); d != "" {
+				t.Error(d)
+			}
+		})
+	}
+}
+
+func changedIDs(t *testing.T, db *kivik.DB, opts kivik.Options) (ids []string, lastSeq string) {
+	changes, err := db.Changes(context.Background(), opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for changes.Next() {
+		ids = append(ids, changes.ID())
+		lastSeq = string(changes.Seq())
+	}
+	if err := changes.Err(); err != nil {
+		t.Fatal(err)
+	}
+	sort.Strings(ids)
+	return ids, lastSeq
+}
+
+func TestChanges(t *testing.T) {
+	db, _ := newTestDB(t)
+	put := func(ids ...string) {
+		for _, id := range ids {
+			if _, err := db.Put(context.Background(), id, map[string]interface{}{}); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	put("a", "b", "c", "d", "e")
+	ids, seq := changedIDs(t, db, nil)
+	if d := diff.Interface([]string{"a", "b", "c", "d", "e"}, ids); d != "" {
+		t.Error(d)
+	}
+	put("f", "g")
+	ids, _ = changedIDs(t, db, kivik.Options{"since": seq})
+	if d := diff.Interface([]string{"f", "g"}, ids); d != "" {
+		t.Error(d)
+	}
+	if ids, _ = changedIDs(t, db, kivik.Options{"limit": 3}); len(ids) != 3 {
+		t.Errorf("Expected 3 changes, got %d", len(ids))
+	}
+}
+
+func TestInvalidSince(t *testing.T) {
+	db, _ := newTestDB(t)
+	_, err := db.Changes(context.Background(), kivik.Options{"since": "invalid"})
+	if kivik.StatusCode(err) != kivik.StatusBadRequest {
+		t.Errorf("Expected status 400, got %v", err)
+	}
+}
+
+func TestDesignInfo(t *testing.T) {
+	db, drv := newTestDB(t)
+	ctx := context.Background()
+	if _, err := db.Put(ctx, "_design/foo", map[string]interface{}{}); err != nil {
+		t.Fatal(err)
+	}
+	docID := "doc00"
+	if _, err := db.Put(ctx, docID, map[string]interface{}{}); err != nil {
+		t.Fatal(err)
+	}
+	info, err := db.DesignInfo(ctx, "_design/foo")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Name != "foo" || info.DiskSize != 4 || info.UpdaterRunning {
+		t.Errorf("Unexpected info: %+v", info)
+	}
+	seqs, err := decodeSeq(string(info.UpdateSeq), 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var expected []string
+	for _, dsn := range []string{"a", "b", "c"} {
+		expected = append(expected, fmt.Sprintf("%d-x", len(drv.db(dsn).docs)))
+	}
+	if d := diff.Interface(expected, seqs); d != "" {
+		t.Error(d)
+	}
+}
+
+func TestCollateJSON(t *testing.T) {
+	keys := []string{`null`, `false`, `true`, `1`, `2`, `"a"`, `"b"`, `["a"]`, `["a",1]`, `{"a":1}`}
+	for i := range keys {
+		for j := range keys {
+			expected := compareInts(i, j)
+			if c := collateJSON(json.RawMessage(keys[i]), json.RawMessage(keys[j])); c != expected {
+				t.Errorf("collate(%s, %s): expected %d, got %d", keys[i], keys[j], expected, c)
+			}
+		}
+	}
+}
+
+func TestFind(t *testing.T) {
+	db, _ := newTestDB(t)
+	ctx := context.Background()
+	for i := 0; i < 20; i++ {
+		docID := fmt.Sprintf("doc%02d", i)
+		if _, err := db.Put(ctx, docID, map[string]interface{}{"n": i}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	tests := []struct {
+		name     string
+		query    string
+		expected []int
+		status   int
+	}{
+		{
+			name:     "sorted",
+			query:    `{"selector":{},"sort":["n"],"skip":3,"limit":5}`,
+			expected: []int{3, 4, 5, 6, 7},
+		},
+		{
+			name:     "descending",
+			query:    `{"selector":{},"sort":[{"n":"desc"}],"limit":2}`,
+			expected: []int{19, 18},
+		},
+		{
+			name:     "default limit",
+			query:    `{"selector":{},"sort":["n"],"skip":18}`,
+			expected: []int{18, 19},
+		},
+		{
+			name:   "sort field not in fields",
+			query:  `{"selector":{},"sort":["n"],"fields":["_id"]}`,
+			status: kivik.StatusNotImplemented,
+		},
+		{
+			name:   "bookmark",
+			query:  `{"selector":{},"bookmark":"x"}`,
+			status: kivik.StatusNotImplemented,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			rows, err := db.Find(ctx, test.query)
+			if status := kivik.StatusCode(err); status != test.status {
+				t.Fatalf("Unexpected status %d: %s", status, err)
+			}
+			if err != nil {
+				return
+			}
+			defer func() { _ = rows.Close() }()
+			var result []int
+			for rows.Next() {
+				var doc struct {
+					N int `json:"n"`
+				}
+				if err := rows.ScanDoc(&doc); err != nil {
+					t.Fatal(err)
+				}
+				result = append(result, doc.N)
+			}
+			if err := rows.Err(); err != nil {
+				t.Fatal(err)
+			}
+			if d := diff.Interface(test.expected, result); d != "" {
+				t.Error(d)
+			}
+		})
+	}
+}
+
+func newTestClient(t *testing.T) *client {
+	drv := &fakeDriver{dbs: map[string]*fakeDB{}}
+	c, err := New(drv, Options{}).NewClient(context.Background(), testDSN)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return c.(*client)
+}
+
+func TestServer(t *testing.T) {
+	c := newTestClient(t)
+	ctx := context.Background()
+	usage, err := c.DiskUsage(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if d := diff.Interface(&driver.DiskUsage{Usage: 30, Quota: 300}, usage); d != "" {
+		t.Error(d)
+	}
+	membership, err := c.Membership(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := &driver.Membership{
+		AllNodes:     []string{"node@a", "shared", "node@b", "node@c"},
+		ClusterNodes: []string{"node@a", "node@b", "node@c"},
+	}
+	if d := diff.Interface(expected, membership); d != "" {
+		t.Error(d)
+	}
+	if err := c.AddNode(ctx, "foo"); kivik.StatusCode(err) != kivik.StatusNotImplemented {
+		t.Errorf("Unexpected AddNode error: %v", err)
+	}
+	if _, err := c.Replicate(ctx, "foo", "bar", nil); kivik.StatusCode(err) != kivik.StatusNotImplemented {
+		t.Errorf("Unexpected Replicate error: %v", err)
+	}
+	if _, err := c.Config(ctx, "_local"); kivik.StatusCode(err) != kivik.StatusNotImplemented {
+		t.Errorf("Unexpected Config error: %v", err)
+	}
+}
+
+func TestDBUpdates(t *testing.T) {
+	c := newTestClient(t)
+	updates, err := c.DBUpdates()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = updates.Close() }()
+	var result []string
+	for {
+		update := &driver.DBUpdate{}
+		if err := updates.Next(update); err != nil {
+			if err == io.EOF {
+				break
+			}
+			t.Fatal(err)
+		}
+		result = append(result, update.Type+" "+update.DBName)
+	}
+	sort.Strings(result)
+	expected := []string{"created new", "updated db_a", "updated db_b", "updated db_c"}
+	if d := diff.Interface(expected, result); d != "" {
+		t.Error(d)
+	}
+}
+
+// TestUpdateDesignDoc updates and deletes a design document on shards whose
+// revisions are random, and so differ between shards.
+func TestUpdateDesignDoc(t *testing.T) {
+	ctx := context.Background()
+	memory, _ := kivik.LookupDriver("memory")
+	dc, err := New(memory, Options{}).NewClient(ctx, "a,b")
+	if err != nil {
+		t.Fatal(err)
+	}
+	c := dc.(*client)
+	if err = c.CreateDB(ctx, "foo", nil); err != nil {
+		t.Fatal(err)
+	}
+	ddb, err := c.DB(ctx, "foo", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	d := ddb.(*db)
+	const docID = "_design/x"
+	rev, err := d.Put(ctx, docID, map[string]interface{}{"n": 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rev, err = d.Put(ctx, docID, map[string]interface{}{"_rev": rev, "n": 2}); err != nil {
+		t.Fatal(err)
+	}
+	rev2, err := d.Put(ctx, docID, map[string]interface{}{"_rev": rev, "n": 3})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, sdb := range d.shards {
+		doc, err := sdb.Get(ctx, docID, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var fields struct {
+			N int `json:"n"`
+		}
+		if err = json.Unmarshal(doc, &fields); err != nil {
+			t.Fatal(err)
+		}
+		if fields.N != 3 {
+			t.Errorf("Shard %d holds revision %d", i, fields.N)
+		}
+	}
+	if _, err = d.Put(ctx, docID, map[string]interface{}{"_rev": rev, "n": 4}); kivik.StatusCode(err) != kivik.StatusConflict {
+		t.Errorf("Expected a conflict, got %v", err)
+	}
+	if _, err = d.Delete(ctx, docID, rev2); err != nil {
+		t.Fatal(err)
+	}
+	for i, sdb := range d.shards {
+		if _, err := sdb.Get(ctx, docID, nil); kivik.StatusCode(err) != kivik.StatusNotFound {
+			t.Errorf("Shard %d: expected the document to be deleted, got %v", i, err)
+		}
+	}
+}
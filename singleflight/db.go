@@ -0,0 +1,365 @@
+package singleflight
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+
+	"github.com/flimzy/kivik/driver"
+)
+
+type db struct {
+	db    driver.DB
+	name  string
+	group *group
+}
+
+var _ driver.DB = &db{}
+var _ driver.Finder = &db{}
+var _ driver.Explainer = &db{}
+var _ driver.AttachmentMetaer = &db{}
+var _ driver.AttachmentCombiner = &db{}
+var _ driver.Rever = &db{}
+var _ driver.DBFlusher = &db{}
+var _ driver.Copier = &db{}
+var _ driver.OptsBulkDocer = &db{}
+var _ driver.OptsPutter = &db{}
+var _ driver.OptsDeleter = &db{}
+var _ driver.Quorumer = &db{}
+var _ driver.OpenRevsGetter = &db{}
+var _ driver.OptsDocCreator = &db{}
+var _ driver.BodyGetter = &db{}
+var _ driver.DesignInfoer = &db{}
+var _ driver.MultipartPutter = &db{}
+var _ driver.OptionValidator = &db{}
+
+func (d *db) Get(ctx context.Context, docID string, opts map[string]interface{}) (json.RawMessage, error) {
+	key, ok := callKey("Get", d.name, []string{docID}, opts)
+	if !ok {
+		return d.db.Get(ctx, docID, opts)
+	}
+	doc, err := d.group.do(ctx, key, func(ctx context.Context) (interface{}, error) {
+		return d.db.Get(ctx, docID, opts)
+	})
+	if err != nil {
+		return nil, err
+	}
+	// Each caller gets its own copy, which it may modify.
+	return append(json.RawMessage(nil), doc.(json.RawMessage)...), nil
+}
+
+func (d *db) Query(ctx context.Context, ddoc, view string, opts map[string]interface{}) (driver.Rows, error) {
+	key, ok := callKey("Query", d.name, []string{ddoc, view}, opts)
+	if !ok {
+		return d.db.Query(ctx, ddoc, view, opts)
+	}
+	return d.sharedRows(ctx, key, func(ctx context.Context) (driver.Rows, error) {
+		return d.db.Query(ctx, ddoc, view, opts)
+	})
+}
+
+func (d *db) AllDocs(ctx context.Context, opts map[string]interface{}) (driver.Rows, error) {
+	key, ok := callKey("AllDocs", d.name, nil, opts)
+	if !ok {
+		return d.db.AllDocs(ctx, opts)
+	}
+	return d.sharedRows(ctx, key, func(ctx context.Context) (driver.Rows, error) {
+		return d.db.AllDocs(ctx, opts)
+	})
+}
+
+// sharedRows coalesces a query, whose rows are read into memory, so that each
+// caller may iterate over them.
+func (d *db) sharedRows(ctx context.Context, key string, fn func(context.Context) (driver.Rows, error)) (driver.Rows, error) {
+	result, err := d.group.do(ctx, key, func(ctx context.Context) (interface{}, error) {
+		rows, err := fn(ctx)
+		if err != nil {
+			return nil, err
+		}
+		return readRows(rows), nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &sharedRows{rowsResult: result.(*rowsResult)}, nil
+}
+
+// rowsResult is a complete, buffered result set.
+type rowsResult struct {
+	rows      []driver.Row
+	updateSeq string
+	offset    int64
+	totalRows int64
+	// err is the error, if any, which interrupted reading the rows.
+	err error
+}
+
+// readRows reads and closes rows.
+func readRows(rows driver.Rows) *rowsResult {
+	defer func() { _ = rows.Close() }()
+	result := &rowsResult{}
+	for {
+		var row driver.Row
+		if err := rows.Next(&row); err != nil {
+			if err != io.EOF {
+				result.err = err
+			}
+			break
+		}
+		result.rows = append(result.rows, row)
+	}
+	result.updateSeq = rows.UpdateSeq()
+	result.offset = rows.Offset()
+	result.totalRows = rows.TotalRows()
+	return result
+}
+
+// sharedRows iterates over a rowsResult, which may be shared with other
+// iterators.
+type sharedRows struct {
+	*rowsResult
+	i int
+}
+
+var _ driver.Rows = &sharedRows{}
+
+func (r *sharedRows) Next(row *driver.Row) error {
+	if r.i >= len(r.rows) {
+		if r.err != nil {
+			return r.err
+		}
+		return io.EOF
+	}
+	*row = r.rows[r.i]
+	r.i++
+	return nil
+}
+
+func (r *sharedRows) Close() error {
+	r.i = len(r.rows)
+	return nil
+}
+
+func (r *sharedRows) UpdateSeq() string { return r.updateSeq }
+func (r *sharedRows) Offset() int64     { return r.offset }
+func (r *sharedRows) TotalRows() int64  { return r.totalRows }
+
+func (d *db) CreateDoc(ctx context.Context, doc interface{}) (string, string, error) {
+	return d.db.CreateDoc(ctx, doc)
+}
+
+func (d *db) CreateDocOpts(ctx context.Context, doc interface{}, opts map[string]interface{}) (string, string, error) {
+	c, ok := d.db.(driver.OptsDocCreator)
+	if !ok {
+		return "", "", notImplemented("OptsDocCreator")
+	}
+	return c.CreateDocOpts(ctx, doc, opts)
+}
+
+func (d *db) Put(ctx context.Context, docID string, doc interface{}) (string, error) {
+	return d.db.Put(ctx, docID, doc)
+}
+
+func (d *db) PutOpts(ctx context.Context, docID string, doc interface{}, opts map[string]interface{}) (string, error) {
+	p, ok := d.db.(driver.OptsPutter)
+	if !ok {
+		return "", notImplemented("OptsPutter")
+	}
+	return p.PutOpts(ctx, docID, doc, opts)
+}
+
+func (d *db) Delete(ctx context.Context, docID, rev string) (string, error) {
+	return d.db.Delete(ctx, docID, rev)
+}
+
+func (d *db) DeleteOpts(ctx context.Context, docID, rev string, opts map[string]interface{}) (string, error) {
+	del, ok := d.db.(driver.OptsDeleter)
+	if !ok {
+		return "", notImplemented("OptsDeleter")
+	}
+	return del.DeleteOpts(ctx, docID, rev, opts)
+}
+
+func (d *db) BulkDocs(ctx context.Context, docs []interface{}) (driver.BulkResults, error) {
+	return d.db.BulkDocs(ctx, docs)
+}
+
+func (d *db) BulkDocsOpts(ctx context.Context, docs []interface{}, opts map[string]interface{}) (driver.BulkResults, error) {
+	b, ok := d.db.(driver.OptsBulkDocer)
+	if !ok {
+		return nil, notImplemented("OptsBulkDocer")
+	}
+	return b.BulkDocsOpts(ctx, docs, opts)
+}
+
+func (d *db) Copy(ctx context.Context, targetID, sourceID string, opts map[string]interface{}) (string, error) {
+	c, ok := d.db.(driver.Copier)
+	if !ok {
+		return "", notImplemented("Copier")
+	}
+	return c.Copy(ctx, targetID, sourceID, opts)
+}
+
+func (d *db) PutAttachment(ctx context.Context, docID, rev, filename, contentType string, body io.Reader) (string, error) {
+	return d.db.PutAttachment(ctx, docID, rev, filename, contentType, body)
+}
+
+func (d *db) GetAttachment(ctx context.Context, docID, rev, filename string) (string, driver.MD5sum, io.ReadCloser, error) {
+	return d.db.GetAttachment(ctx, docID, rev, filename)
+}
+
+func (d *db) DeleteAttachment(ctx context.Context, docID, rev, filename string) (string, error) {
+	return d.db.DeleteAttachment(ctx, docID, rev, filename)
+}
+
+func (d *db) Stats(ctx context.Context) (*driver.DBStats, error) {
+	return d.db.Stats(ctx)
+}
+
+func (d *db) Compact(ctx context.Context) error {
+	return d.db.Compact(ctx)
+}
+
+func (d *db) CompactView(ctx context.Context, ddocID string) error {
+	return d.db.CompactView(ctx, ddocID)
+}
+
+func (d *db) ViewCleanup(ctx context.Context) error {
+	return d.db.ViewCleanup(ctx)
+}
+
+func (d *db) Security(ctx context.Context) (*driver.Security, error) {
+	return d.db.Security(ctx)
+}
+
+func (d *db) SetSecurity(ctx context.Context, security *driver.Security) error {
+	return d.db.SetSecurity(ctx, security)
+}
+
+func (d *db) Changes(ctx context.Context, opts map[string]interface{}) (driver.Changes, error) {
+	return d.db.Changes(ctx, opts)
+}
+
+func (d *db) finder() (driver.Finder, error) {
+	if f, ok := d.db.(driver.Finder); ok {
+		return f, nil
+	}
+	return nil, notImplemented("Finder")
+}
+
+func (d *db) Find(ctx context.Context, query interface{}) (driver.Rows, error) {
+	f, err := d.finder()
+	if err != nil {
+		return nil, err
+	}
+	return f.Find(ctx, query)
+}
+
+func (d *db) Explain(ctx context.Context, query interface{}) (*driver.QueryPlan, error) {
+	e, ok := d.db.(driver.Explainer)
+	if !ok {
+		return nil, notImplemented("Explainer")
+	}
+	return e.Explain(ctx, query)
+}
+
+func (d *db) CreateIndex(ctx context.Context, ddoc, name string, index interface{}) error {
+	f, err := d.finder()
+	if err != nil {
+		return err
+	}
+	return f.CreateIndex(ctx, ddoc, name, index)
+}
+
+func (d *db) GetIndexes(ctx context.Context) ([]driver.Index, error) {
+	f, err := d.finder()
+	if err != nil {
+		return nil, err
+	}
+	return f.GetIndexes(ctx)
+}
+
+func (d *db) DeleteIndex(ctx context.Context, ddoc, name string) error {
+	f, err := d.finder()
+	if err != nil {
+		return err
+	}
+	return f.DeleteIndex(ctx, ddoc, name)
+}
+
+func (d *db) GetAttachmentMeta(ctx context.Context, docID, rev, filename string) (string, driver.MD5sum, error) {
+	m, ok := d.db.(driver.AttachmentMetaer)
+	if !ok {
+		return "", driver.MD5sum{}, notImplemented("AttachmentMetaer")
+	}
+	return m.GetAttachmentMeta(ctx, docID, rev, filename)
+}
+
+func (d *db) Rev(ctx context.Context, docID string) (string, error) {
+	r, ok := d.db.(driver.Rever)
+	if !ok {
+		return "", notImplemented("Rever")
+	}
+	return r.Rev(ctx, docID)
+}
+
+func (d *db) Flush(ctx context.Context) error {
+	f, ok := d.db.(driver.DBFlusher)
+	if !ok {
+		return notImplemented("DBFlusher")
+	}
+	return f.Flush(ctx)
+}
+
+func (d *db) GetOpenRevs(ctx context.Context, docID string, revs []string, opts map[string]interface{}) ([]driver.OpenRev, error) {
+	g, ok := d.db.(driver.OpenRevsGetter)
+	if !ok {
+		return nil, notImplemented("OpenRevsGetter")
+	}
+	return g.GetOpenRevs(ctx, docID, revs, opts)
+}
+
+func (d *db) GetBody(ctx context.Context, docID string, opts map[string]interface{}) (io.ReadCloser, error) {
+	g, ok := d.db.(driver.BodyGetter)
+	if !ok {
+		return nil, notImplemented("BodyGetter")
+	}
+	return g.GetBody(ctx, docID, opts)
+}
+
+// SupportsQuorum reports whether the wrapped DB honors the read quorum.
+func (d *db) SupportsQuorum() bool {
+	q, ok := d.db.(driver.Quorumer)
+	return ok && q.SupportsQuorum()
+}
+
+func (d *db) SupportedOptions(method string) (map[string]driver.OptionType, bool) {
+	if v, ok := d.db.(driver.OptionValidator); ok {
+		return v.SupportedOptions(method)
+	}
+	return nil, false
+}
+
+func (d *db) PutMultipart(ctx context.Context, docID string, doc interface{}, atts []driver.MultipartAttachment, opts map[string]interface{}) (string, error) {
+	p, ok := d.db.(driver.MultipartPutter)
+	if !ok {
+		return "", notImplemented("MultipartPutter")
+	}
+	return p.PutMultipart(ctx, docID, doc, atts, opts)
+}
+
+func (d *db) DesignInfo(ctx context.Context, ddoc string) (*driver.DesignInfo, error) {
+	i, ok := d.db.(driver.DesignInfoer)
+	if !ok {
+		return nil, notImplemented("DesignInfoer")
+	}
+	return i.DesignInfo(ctx, ddoc)
+}
+
+func (d *db) CombineAttachments(ctx context.Context, docID, rev, filename, contentType string, parts []string) (newRev string, err error) {
+	c, ok := d.db.(driver.AttachmentCombiner)
+	if !ok {
+		return "", notImplemented("AttachmentCombiner")
+	}
+	return c.CombineAttachments(ctx, docID, rev, filename, contentType, parts)
+}
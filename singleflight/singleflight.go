@@ -0,0 +1,311 @@
+// Package singleflight provides a Kivik driver which wraps another driver, and
+// coalesces identical concurrent reads, so that, when many callers request the
+// same hot document or view at once, only one request is made to the wrapped
+// driver, and its result is shared.
+//
+//	singleflight.Register("couch-sf", "couch")
+//	client, err := kivik.New(context.TODO(), "couch-sf", "http://localhost:5984/")
+//
+// Calls to Get, Query and AllDocs are coalesced when they are made through the
+// same client, for the same database, with the same arguments and options,
+// while an identical call is in progress. Nothing is cached, so a call made
+// after the shared request completes makes a new request. The rows of a
+// shared query are read into memory, so that each caller may iterate over
+// them, which makes coalescing unsuitable for very large results.
+//
+// The shared request is made with the context of the first caller. If it is
+// canceled, the other callers make their own requests, and each caller stops
+// waiting if its own context is canceled.
+//
+// The wrapped driver implements all of the optional driver interfaces. Where
+// the underlying driver does not implement an interface, the corresponding
+// methods return a StatusNotImplemented error.
+package singleflight
+
+import (
+	"context"
+	"encoding/json"
+	"sync"
+
+	"github.com/flimzy/kivik"
+	"github.com/flimzy/kivik/driver"
+	"github.com/flimzy/kivik/errors"
+)
+
+type sfDriver struct {
+	drv driver.Driver
+}
+
+var _ driver.Driver = &sfDriver{}
+
+// New returns a driver which wraps drv, and coalesces identical concurrent
+// reads.
+func New(drv driver.Driver) driver.Driver {
+	return &sfDriver{drv: drv}
+}
+
+// Register registers a coalescing version of the driver registered as wrapped,
+// under the new name name.
+func Register(name, wrapped string) error {
+	drv, ok := kivik.LookupDriver(wrapped)
+	if !ok {
+		return errors.Statusf(kivik.StatusBadRequest, "singleflight: unknown driver %q (forgotten import?)", wrapped)
+	}
+	kivik.Register(name, New(drv))
+	return nil
+}
+
+func (d *sfDriver) NewClient(ctx context.Context, dsn string) (driver.Client, error) {
+	c, err := d.drv.NewClient(ctx, dsn)
+	if err != nil {
+		return nil, err
+	}
+	return &client{client: c, group: &group{calls: make(map[string]*call)}}, nil
+}
+
+func notImplemented(iface string) error {
+	return errors.Statusf(kivik.StatusNotImplemented, "kivik: driver does not implement %s", iface)
+}
+
+// call is a request in progress, or completed, whose result is shared.
+type call struct {
+	ctx  context.Context
+	done chan struct{}
+	val  interface{}
+	err  error
+	// dups is the number of callers waiting for the result.
+	dups int
+}
+
+// group tracks the requests in progress, by key.
+type group struct {
+	mu    sync.Mutex
+	calls map[string]*call
+}
+
+// do calls fn, unless a call with the same key is in progress, in which case
+// its result is awaited instead. The result of fn must be safe to share.
+func (g *group) do(ctx context.Context, key string, fn func(context.Context) (interface{}, error)) (interface{}, error) {
+	g.mu.Lock()
+	if c, ok := g.calls[key]; ok {
+		c.dups++
+		g.mu.Unlock()
+		select {
+		case <-c.done:
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+		// If the first caller gave up, its error is not ours.
+		if c.err != nil && c.ctx.Err() != nil && ctx.Err() == nil {
+			return fn(ctx)
+		}
+		return c.val, c.err
+	}
+	c := &call{ctx: ctx, done: make(chan struct{})}
+	g.calls[key] = c
+	g.mu.Unlock()
+
+	c.val, c.err = fn(ctx)
+	g.mu.Lock()
+	delete(g.calls, key)
+	g.mu.Unlock()
+	close(c.done)
+	return c.val, c.err
+}
+
+// callKey returns the key of an operation, or false if opts cannot be encoded,
+// in which case the call is not coalesced.
+func callKey(op, dbName string, args []string, opts map[string]interface{}) (string, bool) {
+	encoded, err := json.Marshal(struct {
+		Op   string                 `json:"op"`
+		DB   string                 `json:"db"`
+		Args []string               `json:"args"`
+		Opts map[string]interface{} `json:"opts"`
+	}{op, dbName, args, opts})
+	return string(encoded), err == nil
+}
+
+type client struct {
+	client driver.Client
+	group  *group
+}
+
+var _ driver.Client = &client{}
+var _ driver.ClientReplicator = &client{}
+var _ driver.Authenticator = &client{}
+var _ driver.DBUpdater = &client{}
+var _ driver.PoolStatser = &client{}
+var _ driver.AdminPartyChecker = &client{}
+var _ driver.DiskUsager = &client{}
+var _ driver.Configer = &client{}
+var _ driver.Clusterer = &client{}
+var _ driver.OptionValidator = &client{}
+
+func (c *client) Version(ctx context.Context) (*driver.Version, error) {
+	return c.client.Version(ctx)
+}
+
+func (c *client) AllDBs(ctx context.Context, opts map[string]interface{}) ([]string, error) {
+	return c.client.AllDBs(ctx, opts)
+}
+
+func (c *client) DBExists(ctx context.Context, dbName string, opts map[string]interface{}) (bool, error) {
+	return c.client.DBExists(ctx, dbName, opts)
+}
+
+func (c *client) CreateDB(ctx context.Context, dbName string, opts map[string]interface{}) error {
+	return c.client.CreateDB(ctx, dbName, opts)
+}
+
+func (c *client) DestroyDB(ctx context.Context, dbName string, opts map[string]interface{}) error {
+	return c.client.DestroyDB(ctx, dbName, opts)
+}
+
+func (c *client) DB(ctx context.Context, dbName string, opts map[string]interface{}) (driver.DB, error) {
+	d, err := c.client.DB(ctx, dbName, opts)
+	if err != nil {
+		return nil, err
+	}
+	return &db{db: d, name: dbName, group: c.group}, nil
+}
+
+func (c *client) Replicate(ctx context.Context, targetDSN, sourceDSN string, opts map[string]interface{}) (driver.Replication, error) {
+	r, ok := c.client.(driver.ClientReplicator)
+	if !ok {
+		return nil, notImplemented("ClientReplicator")
+	}
+	return r.Replicate(ctx, targetDSN, sourceDSN, opts)
+}
+
+func (c *client) GetReplications(ctx context.Context, opts map[string]interface{}) ([]driver.Replication, error) {
+	r, ok := c.client.(driver.ClientReplicator)
+	if !ok {
+		return nil, notImplemented("ClientReplicator")
+	}
+	return r.GetReplications(ctx, opts)
+}
+
+func (c *client) Authenticate(ctx context.Context, authenticator interface{}) error {
+	a, ok := c.client.(driver.Authenticator)
+	if !ok {
+		return notImplemented("Authenticator")
+	}
+	return a.Authenticate(ctx, authenticator)
+}
+
+func (c *client) DBUpdates() (driver.DBUpdates, error) {
+	u, ok := c.client.(driver.DBUpdater)
+	if !ok {
+		return nil, notImplemented("DBUpdater")
+	}
+	return u.DBUpdates()
+}
+
+func (c *client) PoolStats() (driver.PoolStats, error) {
+	s, ok := c.client.(driver.PoolStatser)
+	if !ok {
+		return driver.PoolStats{}, notImplemented("PoolStatser")
+	}
+	return s.PoolStats()
+}
+
+func (c *client) AdminParty(ctx context.Context) (bool, error) {
+	a, ok := c.client.(driver.AdminPartyChecker)
+	if !ok {
+		return false, notImplemented("AdminPartyChecker")
+	}
+	return a.AdminParty(ctx)
+}
+
+func (c *client) DiskUsage(ctx context.Context) (*driver.DiskUsage, error) {
+	u, ok := c.client.(driver.DiskUsager)
+	if !ok {
+		return nil, notImplemented("DiskUsager")
+	}
+	return u.DiskUsage(ctx)
+}
+
+func (c *client) configer() (driver.Configer, error) {
+	if configer, ok := c.client.(driver.Configer); ok {
+		return configer, nil
+	}
+	return nil, notImplemented("Configer")
+}
+
+func (c *client) Config(ctx context.Context, node string) (driver.Config, error) {
+	configer, err := c.configer()
+	if err != nil {
+		return nil, err
+	}
+	return configer.Config(ctx, node)
+}
+
+func (c *client) ConfigSection(ctx context.Context, node, section string) (driver.ConfigSection, error) {
+	configer, err := c.configer()
+	if err != nil {
+		return nil, err
+	}
+	return configer.ConfigSection(ctx, node, section)
+}
+
+func (c *client) ConfigValue(ctx context.Context, node, section, key string) (string, error) {
+	configer, err := c.configer()
+	if err != nil {
+		return "", err
+	}
+	return configer.ConfigValue(ctx, node, section, key)
+}
+
+func (c *client) SetConfigValue(ctx context.Context, node, section, key, value string) (string, error) {
+	configer, err := c.configer()
+	if err != nil {
+		return "", err
+	}
+	return configer.SetConfigValue(ctx, node, section, key, value)
+}
+
+func (c *client) DeleteConfigKey(ctx context.Context, node, section, key string) (string, error) {
+	configer, err := c.configer()
+	if err != nil {
+		return "", err
+	}
+	return configer.DeleteConfigKey(ctx, node, section, key)
+}
+
+func (c *client) clusterer() (driver.Clusterer, error) {
+	if clusterer, ok := c.client.(driver.Clusterer); ok {
+		return clusterer, nil
+	}
+	return nil, notImplemented("Clusterer")
+}
+
+func (c *client) Membership(ctx context.Context) (*driver.Membership, error) {
+	clusterer, err := c.clusterer()
+	if err != nil {
+		return nil, err
+	}
+	return clusterer.Membership(ctx)
+}
+
+func (c *client) AddNode(ctx context.Context, node string) error {
+	clusterer, err := c.clusterer()
+	if err != nil {
+		return err
+	}
+	return clusterer.AddNode(ctx, node)
+}
+
+func (c *client) RemoveNode(ctx context.Context, node string) error {
+	clusterer, err := c.clusterer()
+	if err != nil {
+		return err
+	}
+	return clusterer.RemoveNode(ctx, node)
+}
+
+func (c *client) SupportedOptions(method string) (map[string]driver.OptionType, bool) {
+	if v, ok := c.client.(driver.OptionValidator); ok {
+		return v.SupportedOptions(method)
+	}
+	return nil, false
+}
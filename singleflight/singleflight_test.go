@@ -0,0 +1,239 @@
+package singleflight
+
+import (
+	"context"
+	"encoding/json"
+	"runtime"
+	"sync"
+	"sync/atomic"
+	"testing"
+
+	"github.com/flimzy/diff"
+	"github.com/flimzy/kivik"
+	"github.com/flimzy/kivik/driver"
+	_ "github.com/flimzy/kivik/driver/memory"
+)
+
+// blockingDriver wraps the memory driver, counting the calls to Get, and
+// holding each until release is closed.
+type blockingDriver struct {
+	driver.Driver
+	calls   int32
+	release chan struct{}
+}
+
+func (d *blockingDriver) NewClient(ctx context.Context, dsn string) (driver.Client, error) {
+	c, err := d.Driver.NewClient(ctx, dsn)
+	return &blockingClient{Client: c, drv: d}, err
+}
+
+type blockingClient struct {
+	driver.Client
+	drv *blockingDriver
+}
+
+func (c *blockingClient) DB(ctx context.Context, dbName string, opts map[string]interface{}) (driver.DB, error) {
+	db, err := c.Client.DB(ctx, dbName, opts)
+	return &blockingDB{DB: db, drv: c.drv}, err
+}
+
+type blockingDB struct {
+	driver.DB
+	drv *blockingDriver
+}
+
+func (d *blockingDB) Get(ctx context.Context, docID string, opts map[string]interface{}) (json.RawMessage, error) {
+	atomic.AddInt32(&d.drv.calls, 1)
+	select {
+	case <-d.drv.release:
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+	return d.DB.Get(ctx, docID, opts)
+}
+
+// waitForDups waits until n callers are waiting for the call with key.
+func waitForDups(g *group, key string, n int) {
+	for {
+		g.mu.Lock()
+		c, ok := g.calls[key]
+		done := ok && c.dups >= n
+		g.mu.Unlock()
+		if done {
+			return
+		}
+		runtime.Gosched()
+	}
+}
+
+func TestGroupDo(t *testing.T) {
+	g := &group{calls: make(map[string]*call)}
+	release := make(chan struct{})
+	var calls int32
+	fn := func(_ context.Context) (interface{}, error) {
+		atomic.AddInt32(&calls, 1)
+		<-release
+		return "result", nil
+	}
+	const callers = 5
+	results := make([]interface{}, callers)
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		results[0], _ = g.do(context.Background(), "key", fn)
+	}()
+	for {
+		g.mu.Lock()
+		_, started := g.calls["key"]
+		g.mu.Unlock()
+		if started {
+			break
+		}
+		runtime.Gosched()
+	}
+	for i := 1; i < callers; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			results[i], _ = g.do(context.Background(), "key", fn)
+		}(i)
+	}
+	waitForDups(g, "key", callers-1)
+	close(release)
+	wg.Wait()
+	if calls != 1 {
+		t.Errorf("Expected 1 call, got %d", calls)
+	}
+	expected := []interface{}{"result", "result", "result", "result", "result"}
+	if d := diff.Interface(expected, results); d != "" {
+		t.Error(d)
+	}
+	if _, err := g.do(context.Background(), "key", fn); err != nil || calls != 2 {
+		t.Errorf("Expected a new call after completion, got %d calls, %v", calls, err)
+	}
+}
+
+func TestGroupDoLeaderCanceled(t *testing.T) {
+	g := &group{calls: make(map[string]*call)}
+	ctx, cancel := context.WithCancel(context.Background())
+	var calls int32
+	fn := func(ctx context.Context) (interface{}, error) {
+		if atomic.AddInt32(&calls, 1) == 1 {
+			<-ctx.Done()
+			return nil, ctx.Err()
+		}
+		return "result", nil
+	}
+	var leaderErr error
+	done := make(chan struct{})
+	go func() {
+		_, leaderErr = g.do(ctx, "key", fn)
+		close(done)
+	}()
+	for atomic.LoadInt32(&calls) == 0 {
+		runtime.Gosched()
+	}
+	var result interface{}
+	var err error
+	followerDone := make(chan struct{})
+	go func() {
+		result, err = g.do(context.Background(), "key", fn)
+		close(followerDone)
+	}()
+	waitForDups(g, "key", 1)
+	cancel()
+	<-done
+	<-followerDone
+	if leaderErr != context.Canceled {
+		t.Errorf("Expected the leader to be canceled, got %v", leaderErr)
+	}
+	if err != nil || result != "result" {
+		t.Errorf("Expected the follower to make its own call, got %v, %v", result, err)
+	}
+}
+
+func TestGet(t *testing.T) {
+	memDriver, _ := kivik.LookupDriver("memory")
+	drv := &blockingDriver{Driver: memDriver, release: make(chan struct{})}
+	c, err := New(drv).NewClient(context.Background(), "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = c.CreateDB(context.Background(), "foo", nil); err != nil {
+		t.Fatal(err)
+	}
+	d, err := c.DB(context.Background(), "foo", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = d.Put(context.Background(), "bar", map[string]string{"a": "b"}); err != nil {
+		t.Fatal(err)
+	}
+	const callers = 5
+	docs := make([]string, callers)
+	var wg sync.WaitGroup
+	get := func(i int) {
+		defer wg.Done()
+		doc, err := d.Get(context.Background(), "bar", nil)
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		var fields map[string]interface{}
+		if err := json.Unmarshal(doc, &fields); err != nil {
+			t.Error(err)
+		}
+		docs[i], _ = fields["a"].(string)
+	}
+	wg.Add(1)
+	go get(0)
+	for atomic.LoadInt32(&drv.calls) == 0 {
+		runtime.Gosched()
+	}
+	for i := 1; i < callers; i++ {
+		wg.Add(1)
+		go get(i)
+	}
+	key, _ := callKey("Get", "foo", []string{"bar"}, nil)
+	waitForDups(c.(*client).group, key, callers-1)
+	close(drv.release)
+	wg.Wait()
+	if calls := atomic.LoadInt32(&drv.calls); calls != 1 {
+		t.Errorf("Expected 1 call to the wrapped driver, got %d", calls)
+	}
+	if d := diff.Interface([]string{"b", "b", "b", "b", "b"}, docs); d != "" {
+		t.Error(d)
+	}
+	if _, err := d.Get(context.Background(), "baz", nil); kivik.StatusCode(err) != kivik.StatusNotFound {
+		t.Errorf("Expected a missing document to be not found, got %v", err)
+	}
+}
+
+// designInfoDB counts the calls to DesignInfo.
+type designInfoDB struct {
+	driver.DB
+	calls int32
+}
+
+func (d *designInfoDB) DesignInfo(_ context.Context, ddoc string) (*driver.DesignInfo, error) {
+	atomic.AddInt32(&d.calls, 1)
+	return &driver.DesignInfo{Name: ddoc}, nil
+}
+
+func TestDesignInfo(t *testing.T) {
+	under := &designInfoDB{}
+	d := &db{db: under, name: "foo", group: &group{calls: make(map[string]*call)}}
+	for i := 0; i < 2; i++ {
+		info, err := d.DesignInfo(context.Background(), "bar")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if info.Name != "bar" {
+			t.Errorf("Unexpected name: %s", info.Name)
+		}
+	}
+	if calls := atomic.LoadInt32(&under.calls); calls != 2 {
+		t.Errorf("Expected 2 calls, got %d", calls)
+	}
+}
@@ -0,0 +1,48 @@
+package kivik
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"io/ioutil"
+
+	"github.com/flimzy/kivik/driver"
+)
+
+// GetStream fetches the requested document, as for Get, and returns its raw
+// JSON as a stream, so that a large document may be copied to a file or
+// proxied, without first being read into memory. The caller must close the
+// returned body.
+//
+// If the driver does not support streaming, the document is read with Get,
+// and returned from memory.
+func (db *DB) GetStream(ctx context.Context, docID string, options ...Options) (io.ReadCloser, error) {
+	opts, err := db.options(ctx, "Get", options...)
+	if err != nil {
+		return nil, err
+	}
+	if err = checkQuorum(db.driverDB, opts); err != nil {
+		return nil, err
+	}
+	ctx, cancel := withTimeout(ctx, db.timeouts.Read)
+	result, err := db.invoke(ctx, &Operation{Name: "GetStream", DocID: docID, Options: opts}, func(ctx context.Context, op *Operation) (interface{}, error) {
+		if getter, ok := db.driverDB.(driver.BodyGetter); ok {
+			return getter.GetBody(ctx, docID, op.Options)
+		}
+		doc, err := db.driverDB.Get(ctx, docID, op.Options)
+		if err != nil {
+			return nil, err
+		}
+		return ioutil.NopCloser(bytes.NewReader(doc)), nil
+	})
+	if err != nil {
+		cancel()
+		return nil, err
+	}
+	body, ok := result.(io.ReadCloser)
+	if !ok {
+		cancel()
+		return nil, unexpectedResult("GetStream", result)
+	}
+	return &cancelCloser{ReadCloser: body, cancel: cancel}, nil
+}
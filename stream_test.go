@@ -0,0 +1,57 @@
+package kivik
+
+import (
+	"context"
+	"io"
+	"io/ioutil"
+	"strings"
+	"testing"
+
+	"github.com/flimzy/kivik/driver"
+)
+
+type bodyGetterDB struct {
+	revsInfoDB
+}
+
+var _ driver.BodyGetter = &bodyGetterDB{}
+
+func (db *bodyGetterDB) GetBody(_ context.Context, _ string, _ map[string]interface{}) (io.ReadCloser, error) {
+	return ioutil.NopCloser(strings.NewReader(`{"_id":"foo","streamed":true}`)), nil
+}
+
+func TestGetStream(t *testing.T) {
+	tests := []struct {
+		name     string
+		db       driver.DB
+		expected string
+	}{
+		{
+			name:     "Emulated",
+			db:       &revsInfoDB{doc: `{"_id":"foo"}`},
+			expected: `{"_id":"foo"}`,
+		},
+		{
+			name:     "BodyGetter",
+			db:       &bodyGetterDB{},
+			expected: `{"_id":"foo","streamed":true}`,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			db := &DB{driverDB: test.db}
+			body, err := db.GetStream(context.Background(), "foo")
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer body.Close()
+			result, err := ioutil.ReadAll(body)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(result) != test.expected {
+				t.Errorf("Unexpected body: %s", result)
+			}
+		})
+	}
+}
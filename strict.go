@@ -0,0 +1,130 @@
+package kivik
+
+import (
+	"bytes"
+	"encoding/json"
+	"strconv"
+	"strings"
+
+	"github.com/flimzy/kivik/driver"
+	"github.com/flimzy/kivik/errors"
+)
+
+// SetStrict enables or disables strict mode for the client, and for databases
+// subsequently opened with DB. In strict mode, responses from the driver are
+// validated against the shapes which CouchDB guarantees, such as well-formed
+// revs, documents whose _id and _rev match the request, and non-negative
+// database statistics, and a response which fails validation is returned as
+// an error with status StatusBadResponse, describing the problem. This is
+// intended to catch buggy or non-conformant drivers and proxies early, rather
+// than letting malformed data propagate. Strict mode is disabled by default.
+func (c *Client) SetStrict(strict bool) {
+	c.strict = strict
+}
+
+// Strict returns true if strict mode was enabled with SetStrict.
+func (c *Client) Strict() bool {
+	return c.strict
+}
+
+func strictErrorf(format string, args ...interface{}) error {
+	return errors.Statusf(StatusBadResponse, "kivik: strict mode: "+format, args...)
+}
+
+// validRev returns true if rev is of the form N-suffix, where N is a positive
+// integer, or zero for local documents, which CouchDB does not version.
+func validRev(docID, rev string) bool {
+	parts := strings.SplitN(rev, "-", 2)
+	if len(parts) != 2 || parts[1] == "" {
+		return false
+	}
+	n, err := strconv.ParseUint(parts[0], 10, 64)
+	if err != nil {
+		return false
+	}
+	return n > 0 || strings.HasPrefix(docID, "_local/")
+}
+
+// checkRev validates the rev returned by method for docID, when no error was
+// returned, in strict mode.
+func (db *DB) checkRev(method, docID, rev string, err error) (string, error) {
+	if !db.strict || err != nil {
+		return rev, err
+	}
+	if !validRev(docID, rev) {
+		return "", strictErrorf("%s returned an invalid rev %q for document %q", method, rev, docID)
+	}
+	return rev, nil
+}
+
+// checkDoc validates the document returned by Get for docID in strict mode. It
+// must be a JSON object, whose _id is docID, and whose _rev is valid, and
+// matches the requested rev, if any. Responses to open_revs requests, which
+// are not a single document, are not validated.
+func (db *DB) checkDoc(docID string, opts Options, doc json.RawMessage) error {
+	if !db.strict {
+		return nil
+	}
+	if _, ok := opts["open_revs"]; ok {
+		return nil
+	}
+	if !bytes.HasPrefix(bytes.TrimSpace(doc), []byte("{")) {
+		return strictErrorf("Get returned a response for document %q which is not a JSON object", docID)
+	}
+	var meta struct {
+		ID  string `json:"_id"`
+		Rev string `json:"_rev"`
+	}
+	if err := json.Unmarshal(doc, &meta); err != nil {
+		return strictErrorf("Get returned an invalid document for %q: %s", docID, err)
+	}
+	if meta.ID != docID {
+		return strictErrorf("Get returned document %q for %q", meta.ID, docID)
+	}
+	if !validRev(docID, meta.Rev) {
+		return strictErrorf("Get returned an invalid rev %q for document %q", meta.Rev, docID)
+	}
+	if rev, ok := opts["rev"].(string); ok && rev != meta.Rev {
+		return strictErrorf("Get returned rev %q of document %q, but rev %q was requested", meta.Rev, docID, rev)
+	}
+	return nil
+}
+
+// checkStats validates the database statistics returned by Stats in strict
+// mode.
+func (db *DB) checkStats(stats *driver.DBStats) error {
+	if !db.strict {
+		return nil
+	}
+	if stats == nil {
+		return strictErrorf("Stats returned no statistics")
+	}
+	for name, value := range map[string]int64{
+		"DocCount":     stats.DocCount,
+		"DeletedCount": stats.DeletedCount,
+		"DiskSize":     stats.DiskSize,
+		"ActiveSize":   stats.ActiveSize,
+		"ExternalSize": stats.ExternalSize,
+	} {
+		if value < 0 {
+			return strictErrorf("Stats returned a negative %s: %d", name, value)
+		}
+	}
+	return nil
+}
+
+// strictBulkResults validates the rev of each successful bulk result, ending
+// iteration with an error at the first which is invalid.
+type strictBulkResults struct {
+	driver.BulkResults
+}
+
+func (r *strictBulkResults) Next(result *driver.BulkResult) error {
+	if err := r.BulkResults.Next(result); err != nil {
+		return err
+	}
+	if result.Error == nil && !validRev(result.ID, result.Rev) {
+		return strictErrorf("BulkDocs returned an invalid rev %q for document %q", result.Rev, result.ID)
+	}
+	return nil
+}
@@ -0,0 +1,178 @@
+package kivik
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+
+	"github.com/flimzy/kivik/driver"
+)
+
+type strictDB struct {
+	driver.DB
+	doc   json.RawMessage
+	rev   string
+	stats *driver.DBStats
+}
+
+func (db *strictDB) Get(_ context.Context, _ string, _ map[string]interface{}) (json.RawMessage, error) {
+	return db.doc, nil
+}
+
+func (db *strictDB) Put(_ context.Context, _ string, _ interface{}) (string, error) {
+	return db.rev, nil
+}
+
+func (db *strictDB) Delete(_ context.Context, _, _ string) (string, error) {
+	return db.rev, nil
+}
+
+func (db *strictDB) Stats(_ context.Context) (*driver.DBStats, error) {
+	return db.stats, nil
+}
+
+func TestValidRev(t *testing.T) {
+	tests := []struct {
+		docID, rev string
+		expected   bool
+	}{
+		{docID: "foo", rev: "1-967a00dff5e02add41819138abb3284d", expected: true},
+		{docID: "foo", rev: "12-x", expected: true},
+		{docID: "foo", rev: "", expected: false},
+		{docID: "foo", rev: "1", expected: false},
+		{docID: "foo", rev: "1-", expected: false},
+		{docID: "foo", rev: "x-abc", expected: false},
+		{docID: "foo", rev: "-1-abc", expected: false},
+		{docID: "foo", rev: "0-1", expected: false},
+		{docID: "_local/foo", rev: "0-1", expected: true},
+	}
+	for _, test := range tests {
+		t.Run(test.docID+"/"+test.rev, func(t *testing.T) {
+			if result := validRev(test.docID, test.rev); result != test.expected {
+				t.Errorf("Expected %t, got %t", test.expected, result)
+			}
+		})
+	}
+}
+
+func TestStrict(t *testing.T) {
+	tests := []struct {
+		name    string
+		lenient bool
+		db      *strictDB
+		call    func(*DB) error
+		err     string
+	}{
+		{
+			name: "GetValid",
+			db:   &strictDB{doc: json.RawMessage(`{"_id":"foo","_rev":"1-xxx"}`)},
+			call: func(db *DB) error { _, err := db.Get(context.Background(), "foo"); return err },
+		},
+		{
+			name: "GetNotObject",
+			db:   &strictDB{doc: json.RawMessage(`null`)},
+			call: func(db *DB) error { _, err := db.Get(context.Background(), "foo"); return err },
+			err:  `kivik: strict mode: Get returned a response for document "foo" which is not a JSON object`,
+		},
+		{
+			name: "GetWrongID",
+			db:   &strictDB{doc: json.RawMessage(`{"_id":"bar","_rev":"1-xxx"}`)},
+			call: func(db *DB) error { _, err := db.Get(context.Background(), "foo"); return err },
+			err:  `kivik: strict mode: Get returned document "bar" for "foo"`,
+		},
+		{
+			name: "GetMissingRev",
+			db:   &strictDB{doc: json.RawMessage(`{"_id":"foo"}`)},
+			call: func(db *DB) error { _, err := db.Get(context.Background(), "foo"); return err },
+			err:  `kivik: strict mode: Get returned an invalid rev "" for document "foo"`,
+		},
+		{
+			name: "GetWrongRev",
+			db:   &strictDB{doc: json.RawMessage(`{"_id":"foo","_rev":"2-yyy"}`)},
+			call: func(db *DB) error {
+				_, err := db.Get(context.Background(), "foo", Options{"rev": "1-xxx"})
+				return err
+			},
+			err: `kivik: strict mode: Get returned rev "2-yyy" of document "foo", but rev "1-xxx" was requested`,
+		},
+		{
+			name:    "NotStrict",
+			lenient: true,
+			db:      &strictDB{doc: json.RawMessage(`{"_id":"bar"}`), rev: "bogus"},
+			call: func(db *DB) error {
+				if _, err := db.Get(context.Background(), "foo"); err != nil {
+					return err
+				}
+				_, err := db.Put(context.Background(), "foo", map[string]string{})
+				return err
+			},
+		},
+		{
+			name: "PutInvalidRev",
+			db:   &strictDB{rev: "bogus"},
+			call: func(db *DB) error { _, err := db.Put(context.Background(), "foo", map[string]string{}); return err },
+			err:  `kivik: strict mode: Put returned an invalid rev "bogus" for document "foo"`,
+		},
+		{
+			name: "PutLocal",
+			db:   &strictDB{rev: "0-1"},
+			call: func(db *DB) error {
+				_, err := db.Put(context.Background(), "_local/foo", map[string]string{})
+				return err
+			},
+		},
+		{
+			name: "DeleteInvalidRev",
+			db:   &strictDB{rev: ""},
+			call: func(db *DB) error { _, err := db.Delete(context.Background(), "foo", "1-xxx"); return err },
+			err:  `kivik: strict mode: Delete returned an invalid rev "" for document "foo"`,
+		},
+		{
+			name: "StatsNegative",
+			db:   &strictDB{stats: &driver.DBStats{DocCount: -1}},
+			call: func(db *DB) error { _, err := db.Stats(context.Background()); return err },
+			err:  "kivik: strict mode: Stats returned a negative DocCount: -1",
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			client, err := NewClientFromDriver(context.Background(), &strictDriver{db: test.db}, "")
+			if err != nil {
+				t.Fatal(err)
+			}
+			client.SetStrict(!test.lenient)
+			db, err := client.DB(context.Background(), "foo")
+			if err != nil {
+				t.Fatal(err)
+			}
+			err = test.call(db)
+			var msg string
+			if err != nil {
+				msg = err.Error()
+				if status := StatusCode(err); status != StatusBadResponse {
+					t.Errorf("Expected status %d, got %d", StatusBadResponse, status)
+				}
+			}
+			if msg != test.err {
+				t.Errorf("Unexpected error: %s", msg)
+			}
+		})
+	}
+}
+
+type strictDriver struct {
+	db *strictDB
+}
+
+func (d *strictDriver) NewClient(_ context.Context, _ string) (driver.Client, error) {
+	return &strictClient{db: d.db}, nil
+}
+
+type strictClient struct {
+	driver.Client
+	db *strictDB
+}
+
+func (c *strictClient) DB(_ context.Context, _ string, _ map[string]interface{}) (driver.DB, error) {
+	return c.db, nil
+}
@@ -0,0 +1,260 @@
+package tenant
+
+import (
+	"context"
+	"strings"
+
+	"github.com/flimzy/kivik"
+	"github.com/flimzy/kivik/driver"
+	"github.com/flimzy/kivik/errors"
+)
+
+type client struct {
+	client driver.Client
+	opts   Options
+	// tenant is that of the context passed to NewClient, if hasTenant.
+	tenant    string
+	hasTenant bool
+}
+
+var _ driver.Client = &client{}
+var _ driver.ClientReplicator = &client{}
+var _ driver.Authenticator = &client{}
+var _ driver.DBUpdater = &client{}
+var _ driver.PoolStatser = &client{}
+var _ driver.AdminPartyChecker = &client{}
+var _ driver.DiskUsager = &client{}
+var _ driver.Configer = &client{}
+var _ driver.Clusterer = &client{}
+var _ driver.OptionValidator = &client{}
+
+func notImplemented(iface string) error {
+	return errors.Statusf(kivik.StatusNotImplemented, "kivik: driver does not implement %s", iface)
+}
+
+func (c *client) Version(ctx context.Context) (*driver.Version, error) {
+	return c.client.Version(ctx)
+}
+
+// AllDBs returns the databases of the tenant, without the prefix.
+func (c *client) AllDBs(ctx context.Context, opts map[string]interface{}) ([]string, error) {
+	prefix, err := c.prefix(ctx)
+	if err != nil {
+		return nil, err
+	}
+	all, err := c.client.AllDBs(ctx, opts)
+	if err != nil || prefix == "" {
+		return all, err
+	}
+	dbs := make([]string, 0, len(all))
+	for _, dbName := range all {
+		if strings.HasPrefix(dbName, prefix) {
+			dbs = append(dbs, strings.TrimPrefix(dbName, prefix))
+		}
+	}
+	return dbs, nil
+}
+
+func (c *client) DBExists(ctx context.Context, dbName string, opts map[string]interface{}) (bool, error) {
+	name, err := c.dbName(ctx, dbName)
+	if err != nil {
+		return false, err
+	}
+	return c.client.DBExists(ctx, name, opts)
+}
+
+func (c *client) CreateDB(ctx context.Context, dbName string, opts map[string]interface{}) error {
+	name, err := c.dbName(ctx, dbName)
+	if err != nil {
+		return err
+	}
+	return c.client.CreateDB(ctx, name, opts)
+}
+
+func (c *client) DestroyDB(ctx context.Context, dbName string, opts map[string]interface{}) error {
+	name, err := c.dbName(ctx, dbName)
+	if err != nil {
+		return err
+	}
+	return c.client.DestroyDB(ctx, name, opts)
+}
+
+func (c *client) DB(ctx context.Context, dbName string, opts map[string]interface{}) (driver.DB, error) {
+	prefix, err := c.prefix(ctx)
+	if err != nil {
+		return nil, err
+	}
+	d, err := c.client.DB(ctx, prefix+dbName, opts)
+	if err != nil {
+		return nil, err
+	}
+	return &db{db: d, prefix: prefix}, nil
+}
+
+func (c *client) Replicate(ctx context.Context, targetDSN, sourceDSN string, opts map[string]interface{}) (driver.Replication, error) {
+	r, ok := c.client.(driver.ClientReplicator)
+	if !ok {
+		return nil, notImplemented("ClientReplicator")
+	}
+	return r.Replicate(ctx, targetDSN, sourceDSN, opts)
+}
+
+func (c *client) GetReplications(ctx context.Context, opts map[string]interface{}) ([]driver.Replication, error) {
+	r, ok := c.client.(driver.ClientReplicator)
+	if !ok {
+		return nil, notImplemented("ClientReplicator")
+	}
+	return r.GetReplications(ctx, opts)
+}
+
+func (c *client) Authenticate(ctx context.Context, authenticator interface{}) error {
+	a, ok := c.client.(driver.Authenticator)
+	if !ok {
+		return notImplemented("Authenticator")
+	}
+	return a.Authenticate(ctx, authenticator)
+}
+
+func (c *client) DBUpdates() (driver.DBUpdates, error) {
+	u, ok := c.client.(driver.DBUpdater)
+	if !ok {
+		return nil, notImplemented("DBUpdater")
+	}
+	prefix, err := c.tenantPrefix(c.tenant, c.hasTenant)
+	if err != nil {
+		return nil, err
+	}
+	updates, err := u.DBUpdates()
+	if err != nil || prefix == "" {
+		return updates, err
+	}
+	return &dbUpdates{DBUpdates: updates, prefix: prefix}, nil
+}
+
+// dbUpdates skips the updates of the databases of other tenants, and removes
+// the prefix from the names of the rest.
+type dbUpdates struct {
+	driver.DBUpdates
+	prefix string
+}
+
+func (u *dbUpdates) Next(update *driver.DBUpdate) error {
+	for {
+		if err := u.DBUpdates.Next(update); err != nil {
+			return err
+		}
+		if strings.HasPrefix(update.DBName, u.prefix) {
+			update.DBName = strings.TrimPrefix(update.DBName, u.prefix)
+			return nil
+		}
+	}
+}
+
+func (c *client) PoolStats() (driver.PoolStats, error) {
+	s, ok := c.client.(driver.PoolStatser)
+	if !ok {
+		return driver.PoolStats{}, notImplemented("PoolStatser")
+	}
+	return s.PoolStats()
+}
+
+func (c *client) AdminParty(ctx context.Context) (bool, error) {
+	a, ok := c.client.(driver.AdminPartyChecker)
+	if !ok {
+		return false, notImplemented("AdminPartyChecker")
+	}
+	return a.AdminParty(ctx)
+}
+
+func (c *client) DiskUsage(ctx context.Context) (*driver.DiskUsage, error) {
+	u, ok := c.client.(driver.DiskUsager)
+	if !ok {
+		return nil, notImplemented("DiskUsager")
+	}
+	return u.DiskUsage(ctx)
+}
+
+func (c *client) configer() (driver.Configer, error) {
+	if configer, ok := c.client.(driver.Configer); ok {
+		return configer, nil
+	}
+	return nil, notImplemented("Configer")
+}
+
+func (c *client) Config(ctx context.Context, node string) (driver.Config, error) {
+	configer, err := c.configer()
+	if err != nil {
+		return nil, err
+	}
+	return configer.Config(ctx, node)
+}
+
+func (c *client) ConfigSection(ctx context.Context, node, section string) (driver.ConfigSection, error) {
+	configer, err := c.configer()
+	if err != nil {
+		return nil, err
+	}
+	return configer.ConfigSection(ctx, node, section)
+}
+
+func (c *client) ConfigValue(ctx context.Context, node, section, key string) (string, error) {
+	configer, err := c.configer()
+	if err != nil {
+		return "", err
+	}
+	return configer.ConfigValue(ctx, node, section, key)
+}
+
+func (c *client) SetConfigValue(ctx context.Context, node, section, key, value string) (string, error) {
+	configer, err := c.configer()
+	if err != nil {
+		return "", err
+	}
+	return configer.SetConfigValue(ctx, node, section, key, value)
+}
+
+func (c *client) DeleteConfigKey(ctx context.Context, node, section, key string) (string, error) {
+	configer, err := c.configer()
+	if err != nil {
+		return "", err
+	}
+	return configer.DeleteConfigKey(ctx, node, section, key)
+}
+
+func (c *client) clusterer() (driver.Clusterer, error) {
+	if clusterer, ok := c.client.(driver.Clusterer); ok {
+		return clusterer, nil
+	}
+	return nil, notImplemented("Clusterer")
+}
+
+func (c *client) Membership(ctx context.Context) (*driver.Membership, error) {
+	clusterer, err := c.clusterer()
+	if err != nil {
+		return nil, err
+	}
+	return clusterer.Membership(ctx)
+}
+
+func (c *client) AddNode(ctx context.Context, node string) error {
+	clusterer, err := c.clusterer()
+	if err != nil {
+		return err
+	}
+	return clusterer.AddNode(ctx, node)
+}
+
+func (c *client) RemoveNode(ctx context.Context, node string) error {
+	clusterer, err := c.clusterer()
+	if err != nil {
+		return err
+	}
+	return clusterer.RemoveNode(ctx, node)
+}
+
+func (c *client) SupportedOptions(method string) (map[string]driver.OptionType, bool) {
+	if v, ok := c.client.(driver.OptionValidator); ok {
+		return v.SupportedOptions(method)
+	}
+	return nil, false
+}
@@ -0,0 +1,273 @@
+package tenant
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"strings"
+
+	"github.com/flimzy/kivik/driver"
+)
+
+type db struct {
+	db     driver.DB
+	prefix string
+}
+
+var _ driver.DB = &db{}
+var _ driver.Finder = &db{}
+var _ driver.Explainer = &db{}
+var _ driver.AttachmentMetaer = &db{}
+var _ driver.AttachmentCombiner = &db{}
+var _ driver.Rever = &db{}
+var _ driver.DBFlusher = &db{}
+var _ driver.Copier = &db{}
+var _ driver.OptsBulkDocer = &db{}
+var _ driver.OptsPutter = &db{}
+var _ driver.OptsDeleter = &db{}
+var _ driver.Quorumer = &db{}
+var _ driver.OpenRevsGetter = &db{}
+var _ driver.OptsDocCreator = &db{}
+var _ driver.BodyGetter = &db{}
+var _ driver.DesignInfoer = &db{}
+var _ driver.MultipartPutter = &db{}
+var _ driver.OptionValidator = &db{}
+
+func (d *db) AllDocs(ctx context.Context, opts map[string]interface{}) (driver.Rows, error) {
+	return d.db.AllDocs(ctx, opts)
+}
+
+func (d *db) Query(ctx context.Context, ddoc, view string, opts map[string]interface{}) (driver.Rows, error) {
+	return d.db.Query(ctx, ddoc, view, opts)
+}
+
+func (d *db) Get(ctx context.Context, docID string, opts map[string]interface{}) (json.RawMessage, error) {
+	return d.db.Get(ctx, docID, opts)
+}
+
+func (d *db) CreateDoc(ctx context.Context, doc interface{}) (string, string, error) {
+	return d.db.CreateDoc(ctx, doc)
+}
+
+func (d *db) CreateDocOpts(ctx context.Context, doc interface{}, opts map[string]interface{}) (string, string, error) {
+	c, ok := d.db.(driver.OptsDocCreator)
+	if !ok {
+		return "", "", notImplemented("OptsDocCreator")
+	}
+	return c.CreateDocOpts(ctx, doc, opts)
+}
+
+func (d *db) Put(ctx context.Context, docID string, doc interface{}) (string, error) {
+	return d.db.Put(ctx, docID, doc)
+}
+
+func (d *db) PutOpts(ctx context.Context, docID string, doc interface{}, opts map[string]interface{}) (string, error) {
+	p, ok := d.db.(driver.OptsPutter)
+	if !ok {
+		return "", notImplemented("OptsPutter")
+	}
+	return p.PutOpts(ctx, docID, doc, opts)
+}
+
+func (d *db) Delete(ctx context.Context, docID, rev string) (string, error) {
+	return d.db.Delete(ctx, docID, rev)
+}
+
+func (d *db) DeleteOpts(ctx context.Context, docID, rev string, opts map[string]interface{}) (string, error) {
+	del, ok := d.db.(driver.OptsDeleter)
+	if !ok {
+		return "", notImplemented("OptsDeleter")
+	}
+	return del.DeleteOpts(ctx, docID, rev, opts)
+}
+
+func (d *db) BulkDocs(ctx context.Context, docs []interface{}) (driver.BulkResults, error) {
+	return d.db.BulkDocs(ctx, docs)
+}
+
+func (d *db) BulkDocsOpts(ctx context.Context, docs []interface{}, opts map[string]interface{}) (driver.BulkResults, error) {
+	b, ok := d.db.(driver.OptsBulkDocer)
+	if !ok {
+		return nil, notImplemented("OptsBulkDocer")
+	}
+	return b.BulkDocsOpts(ctx, docs, opts)
+}
+
+func (d *db) Copy(ctx context.Context, targetID, sourceID string, opts map[string]interface{}) (string, error) {
+	c, ok := d.db.(driver.Copier)
+	if !ok {
+		return "", notImplemented("Copier")
+	}
+	return c.Copy(ctx, targetID, sourceID, opts)
+}
+
+func (d *db) PutAttachment(ctx context.Context, docID, rev, filename, contentType string, body io.Reader) (string, error) {
+	return d.db.PutAttachment(ctx, docID, rev, filename, contentType, body)
+}
+
+func (d *db) GetAttachment(ctx context.Context, docID, rev, filename string) (string, driver.MD5sum, io.ReadCloser, error) {
+	return d.db.GetAttachment(ctx, docID, rev, filename)
+}
+
+func (d *db) DeleteAttachment(ctx context.Context, docID, rev, filename string) (string, error) {
+	return d.db.DeleteAttachment(ctx, docID, rev, filename)
+}
+
+// Stats returns the stats of the database, with its name unprefixed.
+func (d *db) Stats(ctx context.Context) (*driver.DBStats, error) {
+	stats, err := d.db.Stats(ctx)
+	if err != nil {
+		return nil, err
+	}
+	unprefixed := *stats
+	unprefixed.Name = strings.TrimPrefix(stats.Name, d.prefix)
+	return &unprefixed, nil
+}
+
+func (d *db) Compact(ctx context.Context) error {
+	return d.db.Compact(ctx)
+}
+
+func (d *db) CompactView(ctx context.Context, ddocID string) error {
+	return d.db.CompactView(ctx, ddocID)
+}
+
+func (d *db) ViewCleanup(ctx context.Context) error {
+	return d.db.ViewCleanup(ctx)
+}
+
+func (d *db) Security(ctx context.Context) (*driver.Security, error) {
+	return d.db.Security(ctx)
+}
+
+func (d *db) SetSecurity(ctx context.Context, security *driver.Security) error {
+	return d.db.SetSecurity(ctx, security)
+}
+
+func (d *db) Changes(ctx context.Context, opts map[string]interface{}) (driver.Changes, error) {
+	return d.db.Changes(ctx, opts)
+}
+
+func (d *db) Find(ctx context.Context, query interface{}) (driver.Rows, error) {
+	f, ok := d.db.(driver.Finder)
+	if !ok {
+		return nil, notImplemented("Finder")
+	}
+	return f.Find(ctx, query)
+}
+
+func (d *db) CreateIndex(ctx context.Context, ddoc, name string, index interface{}) error {
+	f, ok := d.db.(driver.Finder)
+	if !ok {
+		return notImplemented("Finder")
+	}
+	return f.CreateIndex(ctx, ddoc, name, index)
+}
+
+func (d *db) GetIndexes(ctx context.Context) ([]driver.Index, error) {
+	f, ok := d.db.(driver.Finder)
+	if !ok {
+		return nil, notImplemented("Finder")
+	}
+	return f.GetIndexes(ctx)
+}
+
+func (d *db) DeleteIndex(ctx context.Context, ddoc, name string) error {
+	f, ok := d.db.(driver.Finder)
+	if !ok {
+		return notImplemented("Finder")
+	}
+	return f.DeleteIndex(ctx, ddoc, name)
+}
+
+func (d *db) GetAttachmentMeta(ctx context.Context, docID, rev, filename string) (string, driver.MD5sum, error) {
+	m, ok := d.db.(driver.AttachmentMetaer)
+	if !ok {
+		return "", driver.MD5sum{}, notImplemented("AttachmentMetaer")
+	}
+	return m.GetAttachmentMeta(ctx, docID, rev, filename)
+}
+
+func (d *db) Rev(ctx context.Context, docID string) (string, error) {
+	r, ok := d.db.(driver.Rever)
+	if !ok {
+		return "", notImplemented("Rever")
+	}
+	return r.Rev(ctx, docID)
+}
+
+func (d *db) Flush(ctx context.Context) error {
+	f, ok := d.db.(driver.DBFlusher)
+	if !ok {
+		return notImplemented("DBFlusher")
+	}
+	return f.Flush(ctx)
+}
+
+func (d *db) GetOpenRevs(ctx context.Context, docID string, revs []string, opts map[string]interface{}) ([]driver.OpenRev, error) {
+	g, ok := d.db.(driver.OpenRevsGetter)
+	if !ok {
+		return nil, notImplemented("OpenRevsGetter")
+	}
+	return g.GetOpenRevs(ctx, docID, revs, opts)
+}
+
+func (d *db) GetBody(ctx context.Context, docID string, opts map[string]interface{}) (io.ReadCloser, error) {
+	g, ok := d.db.(driver.BodyGetter)
+	if !ok {
+		return nil, notImplemented("BodyGetter")
+	}
+	return g.GetBody(ctx, docID, opts)
+}
+
+// SupportsQuorum reports whether the wrapped DB honors the read quorum.
+func (d *db) SupportsQuorum() bool {
+	q, ok := d.db.(driver.Quorumer)
+	return ok && q.SupportsQuorum()
+}
+
+func (d *db) SupportedOptions(method string) (map[string]driver.OptionType, bool) {
+	if v, ok := d.db.(driver.OptionValidator); ok {
+		return v.SupportedOptions(method)
+	}
+	return nil, false
+}
+
+func (d *db) PutMultipart(ctx context.Context, docID string, doc interface{}, atts []driver.MultipartAttachment, opts map[string]interface{}) (string, error) {
+	p, ok := d.db.(driver.MultipartPutter)
+	if !ok {
+		return "", notImplemented("MultipartPutter")
+	}
+	return p.PutMultipart(ctx, docID, doc, atts, opts)
+}
+
+// Explain returns the query plan, with the database name unprefixed.
+func (d *db) Explain(ctx context.Context, query interface{}) (*driver.QueryPlan, error) {
+	e, ok := d.db.(driver.Explainer)
+	if !ok {
+		return nil, notImplemented("Explainer")
+	}
+	plan, err := e.Explain(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	unprefixed := *plan
+	unprefixed.DBName = strings.TrimPrefix(plan.DBName, d.prefix)
+	return &unprefixed, nil
+}
+
+func (d *db) DesignInfo(ctx context.Context, ddoc string) (*driver.DesignInfo, error) {
+	i, ok := d.db.(driver.DesignInfoer)
+	if !ok {
+		return nil, notImplemented("DesignInfoer")
+	}
+	return i.DesignInfo(ctx, ddoc)
+}
+
+func (d *db) CombineAttachments(ctx context.Context, docID, rev, filename, contentType string, parts []string) (newRev string, err error) {
+	c, ok := d.db.(driver.AttachmentCombiner)
+	if !ok {
+		return "", notImplemented("AttachmentCombiner")
+	}
+	return c.CombineAttachments(ctx, docID, rev, filename, contentType, parts)
+}
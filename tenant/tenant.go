@@ -0,0 +1,133 @@
+// Package tenant provides a Kivik driver which wraps another driver, to give
+// each tenant of a multi-tenant application its own namespace of databases.
+// The names of databases are prefixed with the tenant taken from the context,
+// and the separator, so that with the tenant acme, the database orders is
+// stored as acme$orders.
+//
+//	tenant.Register("couch-tenant", "couch", tenant.Options{})
+//	client, err := kivik.New(context.TODO(), "couch-tenant", "http://localhost:5984/")
+//	...
+//	ctx = tenant.WithTenant(ctx, "acme")
+//	db, err := client.DB(ctx, "orders") // acme$orders
+//
+// AllDBs returns only the databases of the tenant, without the prefix, and
+// the names in DB stats are likewise unprefixed. The tenant for a call is
+// taken from its context, or, if it has none, from the context passed to
+// kivik.New. The DB updates feed, which takes no context, is that of the
+// tenant of the context passed to kivik.New, and excludes the databases of
+// other tenants.
+//
+// The source and target of Replicate, being DSNs, are passed unchanged to the
+// wrapped driver.
+package tenant
+
+import (
+	"context"
+	"strings"
+
+	"github.com/flimzy/kivik"
+	"github.com/flimzy/kivik/driver"
+	"github.com/flimzy/kivik/errors"
+)
+
+// DefaultSeparator separates the tenant from the name of the database, if no
+// Separator is given in Options. It is valid in CouchDB database names, but not
+// at their start.
+const DefaultSeparator = "$"
+
+// Options configures a tenant driver.
+type Options struct {
+	// Separator is placed between the tenant and the database name. Tenants
+	// may not contain it. The default is DefaultSeparator.
+	Separator string
+	// AllowNoTenant permits calls without a tenant, which then see the
+	// databases of the wrapped driver unchanged, as for an administrator.
+	// Otherwise, such calls fail with StatusForbidden.
+	AllowNoTenant bool
+}
+
+type tenantKey struct{}
+
+// WithTenant returns a copy of ctx, for which database names are prefixed
+// with tenant.
+func WithTenant(ctx context.Context, tenant string) context.Context {
+	return context.WithValue(ctx, tenantKey{}, tenant)
+}
+
+// FromContext returns the tenant of ctx, and whether it has one.
+func FromContext(ctx context.Context) (string, bool) {
+	tenant, ok := ctx.Value(tenantKey{}).(string)
+	return tenant, ok
+}
+
+var errNoTenant = errors.Status(kivik.StatusForbidden, "tenant: no tenant in context")
+
+type tenantDriver struct {
+	drv  driver.Driver
+	opts Options
+}
+
+var _ driver.Driver = &tenantDriver{}
+
+// New returns a driver which wraps drv, prefixing database names with the
+// tenant of the context.
+func New(drv driver.Driver, opts Options) driver.Driver {
+	if opts.Separator == "" {
+		opts.Separator = DefaultSeparator
+	}
+	return &tenantDriver{drv: drv, opts: opts}
+}
+
+// Register registers a tenant version of the driver registered as wrapped,
+// under the new name name.
+func Register(name, wrapped string, opts Options) error {
+	drv, ok := kivik.LookupDriver(wrapped)
+	if !ok {
+		return errors.Statusf(kivik.StatusBadRequest, "tenant: unknown driver %q (forgotten import?)", wrapped)
+	}
+	kivik.Register(name, New(drv, opts))
+	return nil
+}
+
+func (d *tenantDriver) NewClient(ctx context.Context, dsn string) (driver.Client, error) {
+	c, err := d.drv.NewClient(ctx, dsn)
+	if err != nil {
+		return nil, err
+	}
+	tenant, hasTenant := FromContext(ctx)
+	return &client{
+		client:    c,
+		opts:      d.opts,
+		tenant:    tenant,
+		hasTenant: hasTenant,
+	}, nil
+}
+
+// prefix returns the prefix of the database names for ctx, which is empty
+// for calls without a tenant, if they are allowed.
+func (c *client) prefix(ctx context.Context) (string, error) {
+	tenant, ok := FromContext(ctx)
+	if !ok {
+		tenant, ok = c.tenant, c.hasTenant
+	}
+	return c.tenantPrefix(tenant, ok)
+}
+
+func (c *client) tenantPrefix(tenant string, ok bool) (string, error) {
+	if !ok {
+		if c.opts.AllowNoTenant {
+			return "", nil
+		}
+		return "", errNoTenant
+	}
+	if tenant == "" || strings.Contains(tenant, c.opts.Separator) {
+		return "", errors.Statusf(kivik.StatusBadRequest, "tenant: invalid tenant %q", tenant)
+	}
+	return tenant + c.opts.Separator, nil
+}
+
+// dbName returns the name of dbName in the wrapped driver, for ctx.
+func (c *client) dbName(ctx context.Context, dbName string) (string, error) {
+	prefix, err := c.prefix(ctx)
+	return prefix + dbName, err
+}
@@ -0,0 +1,231 @@
+package tenant
+
+import (
+	"context"
+	"io"
+	"sort"
+	"testing"
+
+	"github.com/flimzy/diff"
+	"github.com/flimzy/kivik"
+	"github.com/flimzy/kivik/driver"
+	_ "github.com/flimzy/kivik/driver/memory"
+	"github.com/flimzy/kivik/errors"
+)
+
+// existingClient is a driver which returns a client already created, so
+// that it may be inspected after it is wrapped.
+type existingClient struct {
+	client driver.Client
+}
+
+func (d *existingClient) NewClient(_ context.Context, _ string) (driver.Client, error) {
+	return d.client, nil
+}
+
+// updatesClient adds a DB updates feed to a client.
+type updatesClient struct {
+	driver.Client
+	updates []driver.DBUpdate
+}
+
+func (c *updatesClient) DBUpdates() (driver.DBUpdates, error) {
+	return &updates{updates: c.updates}, nil
+}
+
+type updates struct {
+	updates []driver.DBUpdate
+}
+
+func (u *updates) Next(update *driver.DBUpdate) error {
+	if len(u.updates) == 0 {
+		return io.EOF
+	}
+	*update = u.updates[0]
+	u.updates = u.updates[1:]
+	return nil
+}
+
+func (u *updates) Close() error { return nil }
+
+func newTestClient(ctx context.Context, t *testing.T, opts Options) (*kivik.Client, driver.Client) {
+	memDriver, _ := kivik.LookupDriver("memory")
+	mem, err := memDriver.NewClient(context.Background(), "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	client, err := kivik.NewClientFromDriver(ctx, New(&existingClient{client: mem}, opts), "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return client, mem
+}
+
+func TestTenants(t *testing.T) {
+	client, mem := newTestClient(context.Background(), t, Options{})
+	acme := WithTenant(context.Background(), "acme")
+	initech := WithTenant(context.Background(), "initech")
+	for _, ctx := range []context.Context{acme, initech} {
+		if err := client.CreateDB(ctx, "orders"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := client.CreateDB(acme, "invoices"); err != nil {
+		t.Fatal(err)
+	}
+
+	dbs, err := client.AllDBs(acme)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sort.Strings(dbs)
+	if d := diff.Interface([]string{"invoices", "orders"}, dbs); d != "" {
+		t.Errorf("Unexpected databases for acme:\n%s", d)
+	}
+	if exists, err := client.DBExists(initech, "invoices"); err != nil || exists {
+		t.Errorf("Expected initech invoices not to exist, got %t, %v", exists, err)
+	}
+	all, err := mem.AllDBs(context.Background(), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sort.Strings(all)
+	expected := []string{"_replicator", "_users", "acme$invoices", "acme$orders", "initech$orders"}
+	if d := diff.Interface(expected, all); d != "" {
+		t.Errorf("Unexpected databases in wrapped driver:\n%s", d)
+	}
+
+	db, err := client.DB(acme, "orders")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := db.Put(acme, "foo", map[string]interface{}{"a": 1}); err != nil {
+		t.Fatal(err)
+	}
+	stats, err := db.Stats(acme)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stats.Name != "orders" || stats.DocCount != 1 {
+		t.Errorf("Unexpected stats: %+v", stats)
+	}
+	memDB, err := mem.DB(context.Background(), "initech$orders", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := memDB.Get(context.Background(), "foo", nil); errors.StatusCode(err) != kivik.StatusNotFound {
+		t.Errorf("Expected foo to be missing from initech orders, got %v", err)
+	}
+
+	if err := client.DestroyDB(acme, "orders"); err != nil {
+		t.Fatal(err)
+	}
+	if exists, err := client.DBExists(initech, "orders"); err != nil || !exists {
+		t.Errorf("Expected initech orders to exist, got %t, %v", exists, err)
+	}
+}
+
+func TestNoTenant(t *testing.T) {
+	ctx := context.Background()
+	t.Run("Forbidden", func(t *testing.T) {
+		client, _ := newTestClient(ctx, t, Options{})
+		_, err := client.AllDBs(ctx)
+		if status := errors.StatusCode(err); status != kivik.StatusForbidden {
+			t.Errorf("Expected status %d, got %d (%v)", kivik.StatusForbidden, status, err)
+		}
+		err = client.CreateDB(WithTenant(ctx, "a$b"), "foo")
+		if status := errors.StatusCode(err); status != kivik.StatusBadRequest {
+			t.Errorf("Expected status %d for invalid tenant, got %d (%v)", kivik.StatusBadRequest, status, err)
+		}
+	})
+	t.Run("Allowed", func(t *testing.T) {
+		client, _ := newTestClient(ctx, t, Options{AllowNoTenant: true, Separator: "-"})
+		if err := client.CreateDB(WithTenant(ctx, "acme"), "orders"); err != nil {
+			t.Fatal(err)
+		}
+		dbs, err := client.AllDBs(ctx)
+		if err != nil {
+			t.Fatal(err)
+		}
+		sort.Strings(dbs)
+		if d := diff.Interface([]string{"_replicator", "_users", "acme-orders"}, dbs); d != "" {
+			t.Error(d)
+		}
+	})
+	t.Run("ClientTenant", func(t *testing.T) {
+		client, _ := newTestClient(WithTenant(ctx, "acme"), t, Options{})
+		if err := client.CreateDB(ctx, "orders"); err != nil {
+			t.Fatal(err)
+		}
+		dbs, err := client.AllDBs(ctx)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if d := diff.Interface([]string{"orders"}, dbs); d != "" {
+			t.Error(d)
+		}
+	})
+}
+
+func TestDBUpdates(t *testing.T) {
+	upd := &updatesClient{updates: []driver.DBUpdate{
+		{DBName: "acme$orders", Type: "created", Seq: "1"},
+		{DBName: "initech$orders", Type: "created", Seq: "2"},
+		{DBName: "acme$orders", Type: "updated", Seq: "3"},
+	}}
+	client, err := kivik.NewClientFromDriver(WithTenant(context.Background(), "acme"), New(&existingClient{client: upd}, Options{}), "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	updates, err := client.DBUpdates()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var result []string
+	for updates.Next() {
+		result = append(result, updates.DBName()+" "+updates.Type()+" "+updates.Seq())
+	}
+	if err := updates.Err(); err != nil {
+		t.Fatal(err)
+	}
+	if d := diff.Interface([]string{"orders created 1", "orders updated 3"}, result); d != "" {
+		t.Error(d)
+	}
+}
+
+// explainDB returns a query plan naming its database, and the status of any
+// design document.
+type explainDB struct {
+	driver.DB
+	name string
+}
+
+func (db *explainDB) Explain(_ context.Context, _ interface{}) (*driver.QueryPlan, error) {
+	return &driver.QueryPlan{DBName: db.name}, nil
+}
+
+func TestExplain(t *testing.T) {
+	d := &db{db: &explainDB{name: "acme_orders"}, prefix: "acme_"}
+	plan, err := d.Explain(context.Background(), `{"selector":{}}`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if plan.DBName != "orders" {
+		t.Errorf("Unexpected database name: %s", plan.DBName)
+	}
+}
+
+func (db *explainDB) DesignInfo(_ context.Context, ddoc string) (*driver.DesignInfo, error) {
+	return &driver.DesignInfo{Name: ddoc}, nil
+}
+
+func TestDesignInfo(t *testing.T) {
+	d := &db{db: &explainDB{name: "acme_orders"}, prefix: "acme_"}
+	info, err := d.DesignInfo(context.Background(), "foo")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Name != "foo" {
+		t.Errorf("Unexpected name: %s", info.Name)
+	}
+}
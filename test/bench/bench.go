@@ -0,0 +1,206 @@
+// Package bench provides a driver-agnostic benchmark suite, to track the
+// performance of Kivik drivers over time.
+//
+// Benchmarks are run against a *kivik.Client, so any registered driver may be
+// benchmarked. Results are reported as Result values, which may be written as
+// JSON for consumption by other tools.
+package bench
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"regexp"
+	"sort"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/flimzy/kivik"
+	"github.com/flimzy/kivik/errors"
+	"github.com/flimzy/kivik/test/kt"
+)
+
+// DefaultN is the number of iterations run per benchmark, when Options.N is
+// unset.
+const DefaultN = 100
+
+// B is passed to each benchmark function, to manage timing and to provide
+// access to the database under test.
+type B struct {
+	// N is the number of iterations the benchmark should perform.
+	N int
+	// DB is a freshly-created, empty database, destroyed after the benchmark
+	// completes.
+	DB *kivik.DB
+	// Context is the context under which the benchmark is run.
+	Context context.Context
+
+	bytes   int64
+	start   time.Time
+	elapsed time.Duration
+	timerOn bool
+}
+
+// StartTimer starts timing the benchmark. It is called automatically before
+// the benchmark function is called.
+func (b *B) StartTimer() {
+	if !b.timerOn {
+		b.start = time.Now()
+		b.timerOn = true
+	}
+}
+
+// StopTimer stops timing the benchmark. This may be used to exclude setup from
+// the measurement.
+func (b *B) StopTimer() {
+	if b.timerOn {
+		b.elapsed += time.Since(b.start)
+		b.timerOn = false
+	}
+}
+
+// ResetTimer zeroes the elapsed benchmark time.
+func (b *B) ResetTimer() {
+	if b.timerOn {
+		b.start = time.Now()
+	}
+	b.elapsed = 0
+}
+
+// SetBytes records the number of bytes processed in a single iteration, for
+// throughput reporting.
+func (b *B) SetBytes(n int64) {
+	b.bytes = n
+}
+
+// Func is a benchmark function. It should perform b.N iterations of the
+// operation being measured.
+type Func func(b *B) error
+
+var benchmarks = make(map[string]Func)
+
+// Register registers a benchmark. It panics if a benchmark by the same name is
+// already registered.
+func Register(name string, fn Func) {
+	if _, dup := benchmarks[name]; dup {
+		panic("bench: Register called twice for benchmark " + name)
+	}
+	benchmarks[name] = fn
+}
+
+// Result is the result of a single benchmark.
+type Result struct {
+	Name   string `json:"name"`
+	Driver string `json:"driver"`
+	// N is the number of iterations performed.
+	N int `json:"n"`
+	// NsPerOp is the mean duration of a single iteration, in nanoseconds.
+	NsPerOp int64 `json:"ns_per_op"`
+	// OpsPerSec is the number of iterations per second.
+	OpsPerSec float64 `json:"ops_per_sec"`
+	// MBPerSec is the throughput, for benchmarks which call SetBytes.
+	MBPerSec float64 `json:"mb_per_sec,omitempty"`
+	// Skipped is set to the reason the benchmark was skipped, if the driver
+	// does not support the benchmarked operation.
+	Skipped string `json:"skipped,omitempty"`
+	// Error is set if the benchmark failed.
+	Error string `json:"error,omitempty"`
+}
+
+// Options configures a benchmark run.
+type Options struct {
+	// N is the number of iterations per benchmark. Defaults to DefaultN.
+	N int
+	// Match, if set, is a regular expression which limits the benchmarks run
+	// to those with matching names.
+	Match string
+	// DBOptions are passed to CreateDB, DB and DestroyDB.
+	DBOptions kivik.Options
+}
+
+// Run runs the registered benchmarks against client, in name order.
+func Run(ctx context.Context, client *kivik.Client, opts Options) ([]Result, error) {
+	if opts.N <= 0 {
+		opts.N = DefaultN
+	}
+	var re *regexp.Regexp
+	if opts.Match != "" {
+		var err error
+		if re, err = regexp.Compile(opts.Match); err != nil {
+			return nil, errors.WrapStatus(kivik.StatusBadRequest, err)
+		}
+	}
+	names := make([]string, 0, len(benchmarks))
+	for name := range benchmarks {
+		if re == nil || re.MatchString(name) {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	results := make([]Result, 0, len(names))
+	for _, name := range names {
+		result, err := runBenchmark(ctx, client, name, benchmarks[name], opts)
+		if err != nil {
+			return results, err
+		}
+		results = append(results, result)
+	}
+	return results, nil
+}
+
+func runBenchmark(ctx context.Context, client *kivik.Client, name string, fn Func, opts Options) (Result, error) {
+	result := Result{Name: name, Driver: client.Driver()}
+	dbName := fmt.Sprintf("%sbench_%s$%016x", kt.TestDBPrefix, strings.ToLower(name), time.Now().UnixNano())
+	if err := client.CreateDB(ctx, dbName, opts.DBOptions); err != nil {
+		return result, err
+	}
+	defer client.DestroyDB(context.Background(), dbName, opts.DBOptions)
+	db, err := client.DB(ctx, dbName, opts.DBOptions)
+	if err != nil {
+		return result, err
+	}
+	b := &B{N: opts.N, DB: db, Context: ctx}
+	b.StartTimer()
+	err = fn(b)
+	b.StopTimer()
+	switch {
+	case errors.StatusCode(err) == kivik.StatusNotImplemented:
+		result.Skipped = err.Error()
+		return result, nil
+	case err != nil:
+		result.Error = err.Error()
+		return result, nil
+	}
+	result.N = b.N
+	result.NsPerOp = b.elapsed.Nanoseconds() / int64(b.N)
+	if b.elapsed > 0 {
+		result.OpsPerSec = float64(b.N) / b.elapsed.Seconds()
+		if b.bytes > 0 {
+			result.MBPerSec = float64(b.bytes*int64(b.N)) / 1e6 / b.elapsed.Seconds()
+		}
+	}
+	return result, nil
+}
+
+// WriteJSON writes results to w as a JSON array.
+func WriteJSON(w io.Writer, results []Result) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(results)
+}
+
+// WriteText writes results to w as a human-readable table.
+func WriteText(w io.Writer, results []Result) error {
+	tw := tabwriter.NewWriter(w, 0, 8, 2, ' ', 0)
+	fmt.Fprintf(tw, "NAME\tN\tNS/OP\tOPS/SEC\tMB/SEC\tNOTE\n")
+	for _, r := range results {
+		note := r.Skipped
+		if r.Error != "" {
+			note = "ERROR: " + r.Error
+		}
+		fmt.Fprintf(tw, "%s\t%d\t%d\t%.2f\t%.2f\t%s\n", r.Name, r.N, r.NsPerOp, r.OpsPerSec, r.MBPerSec, note)
+	}
+	return tw.Flush()
+}
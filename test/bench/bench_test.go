@@ -0,0 +1,176 @@
+package bench
+
+import (
+	"bytes"
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/flimzy/diff"
+	"github.com/flimzy/kivik"
+	_ "github.com/flimzy/kivik/driver/bolt"
+	_ "github.com/flimzy/kivik/driver/leveldb"
+	_ "github.com/flimzy/kivik/driver/memory"
+)
+
+func TestRun(t *testing.T) {
+	client, err := kivik.New(context.Background(), "memory", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	results, err := Run(context.Background(), client, Options{N: 3})
+	if err != nil {
+		t.Fatal(err)
+	}
+	summary := make(map[string]string)
+	for _, r := range results {
+		switch {
+		case r.Error != "":
+			summary[r.Name] = "error"
+		case r.Skipped != "":
+			summary[r.Name] = "skipped"
+		default:
+			summary[r.Name] = "ok"
+			if r.N != 3 {
+				t.Errorf("%s: Expected N=3, got %d", r.Name, r.N)
+			}
+		}
+		if r.Driver != "memory" {
+			t.Errorf("%s: Unexpected driver %s", r.Name, r.Driver)
+		}
+	}
+	expected := map[string]string{
+		"AllDocsScan":          "skipped",
+		"AttachmentThroughput": "ok",
+		"BulkInsert":           "skipped",
+		"DocWrites":            "ok",
+		"ViewQuery":            "skipped",
+	}
+	if d := diff.Interface(expected, summary); d != "" {
+		t.Error(d)
+	}
+}
+
+// TestEmbeddedDrivers runs the suite against each of the embedded drivers, so
+// that their results may be compared.
+func TestEmbeddedDrivers(t *testing.T) {
+	dir, err := ioutil.TempDir("", "kivik-bench")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = os.RemoveAll(dir) }()
+	tests := []struct {
+		driver   string
+		dsn      string
+		expected map[string]string
+	}{
+		{
+			driver: "memory",
+			expected: map[string]string{
+				"AllDocsScan":          "skipped",
+				"AttachmentThroughput": "ok",
+				"BulkInsert":           "skipped",
+				"DocWrites":            "ok",
+				"ViewQuery":            "skipped",
+			},
+		},
+		{
+			driver: "bolt",
+			dsn:    filepath.Join(dir, "kivik.bolt"),
+			expected: map[string]string{
+				"AllDocsScan":          "ok",
+				"AttachmentThroughput": "ok",
+				"BulkInsert":           "ok",
+				"DocWrites":            "ok",
+				"ViewQuery":            "skipped",
+			},
+		},
+		{
+			driver: "leveldb",
+			dsn:    filepath.Join(dir, "kivik.leveldb"),
+			expected: map[string]string{
+				"AllDocsScan":          "ok",
+				"AttachmentThroughput": "ok",
+				"BulkInsert":           "ok",
+				"DocWrites":            "ok",
+				"ViewQuery":            "skipped",
+			},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.driver, func(t *testing.T) {
+			client, err := kivik.New(context.Background(), test.driver, test.dsn)
+			if err != nil {
+				t.Fatal(err)
+			}
+			results, err := Run(context.Background(), client, Options{N: 2})
+			if err != nil {
+				t.Fatal(err)
+			}
+			summary := make(map[string]string)
+			for _, r := range results {
+				switch {
+				case r.Error != "":
+					summary[r.Name] = "error: " + r.Error
+				case r.Skipped != "":
+					summary[r.Name] = "skipped"
+				default:
+					summary[r.Name] = "ok"
+				}
+			}
+			if d := diff.Interface(test.expected, summary); d != "" {
+				t.Error(d)
+			}
+		})
+	}
+}
+
+func TestRunMatch(t *testing.T) {
+	client, err := kivik.New(context.Background(), "memory", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	results, err := Run(context.Background(), client, Options{N: 1, Match: "^Doc"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(results) != 1 || results[0].Name != "DocWrites" {
+		t.Errorf("Unexpected results: %v", results)
+	}
+	if _, err := Run(context.Background(), client, Options{Match: "("}); kivik.StatusCode(err) != kivik.StatusBadRequest {
+		t.Errorf("Expected Bad Request for invalid pattern, got %v", err)
+	}
+}
+
+func TestWriteJSON(t *testing.T) {
+	results := []Result{
+		{Name: "DocWrites", Driver: "memory", N: 10, NsPerOp: 1000, OpsPerSec: 1000000},
+		{Name: "BulkInsert", Driver: "memory", Skipped: "not yet implemented"},
+	}
+	buf := &bytes.Buffer{}
+	if err := WriteJSON(buf, results); err != nil {
+		t.Fatal(err)
+	}
+	expected := `[{"name":"DocWrites","driver":"memory","n":10,"ns_per_op":1000,"ops_per_sec":1000000},
+		{"name":"BulkInsert","driver":"memory","n":0,"ns_per_op":0,"ops_per_sec":0,"skipped":"not yet implemented"}]`
+	if d := diff.JSON([]byte(expected), buf.Bytes()); d != "" {
+		t.Error(d)
+	}
+}
+
+func TestWriteText(t *testing.T) {
+	results := []Result{
+		{Name: "DocWrites", N: 10, NsPerOp: 1000, OpsPerSec: 1000000},
+		{Name: "BulkInsert", Error: "boom"},
+	}
+	buf := &bytes.Buffer{}
+	if err := WriteText(buf, results); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(buf.String(), "ERROR: boom") {
+		t.Errorf("Error not reported:\n%s", buf.String())
+	}
+}
@@ -0,0 +1,170 @@
+package bench
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+
+	"github.com/flimzy/kivik"
+	"github.com/flimzy/kivik/errors"
+)
+
+// Sizes used by the standard benchmarks.
+const (
+	bulkBatchSize  = 100
+	scanDocs       = 100
+	attachmentSize = 64 * 1024
+	viewDocs       = 100
+)
+
+func init() {
+	Register("DocWrites", benchDocWrites)
+	Register("BulkInsert", benchBulkInsert)
+	Register("AllDocsScan", benchAllDocsScan)
+	Register("AttachmentThroughput", benchAttachmentThroughput)
+	Register("ViewQuery", benchViewQuery)
+}
+
+type benchDoc struct {
+	ID    string `json:"_id,omitempty"`
+	Value int    `json:"value"`
+	Name  string `json:"name"`
+}
+
+func newBenchDoc(i int) benchDoc {
+	return benchDoc{Value: i, Name: fmt.Sprintf("Document %d", i)}
+}
+
+// seed creates n documents, outside of the timed portion of the benchmark.
+func seed(b *B, n int) error {
+	b.StopTimer()
+	defer b.StartTimer()
+	for i := 0; i < n; i++ {
+		if _, err := b.DB.Put(b.Context, fmt.Sprintf("seed%06d", i), newBenchDoc(i)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// benchDocWrites measures the creation of individual documents.
+func benchDocWrites(b *B) error {
+	for i := 0; i < b.N; i++ {
+		if _, err := b.DB.Put(b.Context, fmt.Sprintf("doc%06d", i), newBenchDoc(i)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// benchBulkInsert measures the creation of documents in batches of
+// bulkBatchSize.
+func benchBulkInsert(b *B) error {
+	for i := 0; i < b.N; i++ {
+		docs := make([]interface{}, bulkBatchSize)
+		for j := range docs {
+			doc := newBenchDoc(j)
+			doc.ID = fmt.Sprintf("bulk%06d-%03d", i, j)
+			docs[j] = doc
+		}
+		results, err := b.DB.BulkDocs(b.Context, docs)
+		if err != nil {
+			return err
+		}
+		for results.Next() {
+			if err := results.UpdateErr(); err != nil {
+				return err
+			}
+		}
+		if err := results.Err(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// benchAllDocsScan measures a full read of _all_docs, with documents, over a
+// database of scanDocs documents.
+func benchAllDocsScan(b *B) error {
+	if err := seed(b, scanDocs); err != nil {
+		return err
+	}
+	for i := 0; i < b.N; i++ {
+		rows, err := b.DB.AllDocs(b.Context, kivik.Options{"include_docs": true})
+		if err != nil {
+			return err
+		}
+		var count int
+		for rows.Next() {
+			var doc benchDoc
+			if err := rows.ScanDoc(&doc); err != nil {
+				return err
+			}
+			count++
+		}
+		if err := rows.Err(); err != nil {
+			return err
+		}
+		if count != scanDocs {
+			return errors.Errorf("expected %d rows, got %d", scanDocs, count)
+		}
+	}
+	return nil
+}
+
+// benchAttachmentThroughput measures the upload of attachmentSize-byte
+// attachments.
+func benchAttachmentThroughput(b *B) error {
+	content := make([]byte, attachmentSize)
+	for i := range content {
+		content[i] = byte(i % 251)
+	}
+	b.SetBytes(attachmentSize)
+	for i := 0; i < b.N; i++ {
+		att := kivik.NewAttachment("data.bin", "application/octet-stream", ioutil.NopCloser(bytes.NewReader(content)))
+		if _, err := b.DB.PutAttachment(b.Context, fmt.Sprintf("att%06d", i), "", att); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// benchViewQuery measures the latency of a simple view query, against an
+// already-built index over viewDocs documents.
+func benchViewQuery(b *B) error {
+	if err := seed(b, viewDocs); err != nil {
+		return err
+	}
+	b.StopTimer()
+	ddoc := map[string]interface{}{
+		"views": map[string]interface{}{
+			"byValue": map[string]string{
+				"map": "function(doc) { emit(doc.value, null); }",
+			},
+		},
+	}
+	if _, err := b.DB.Put(b.Context, "_design/bench", ddoc); err != nil {
+		return err
+	}
+	// Query once to build the index.
+	if err := queryView(b); err != nil {
+		return err
+	}
+	b.StartTimer()
+	for i := 0; i < b.N; i++ {
+		if err := queryView(b); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func queryView(b *B) error {
+	rows, err := b.DB.Query(b.Context, "bench", "byValue", kivik.Options{"limit": 10})
+	if err != nil {
+		return err
+	}
+	for rows.Next() {
+	}
+	return rows.Err()
+}
@@ -0,0 +1,88 @@
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"strings"
+
+	"github.com/flimzy/kivik"
+	"github.com/flimzy/kivik/driver/couchdb/chttp"
+	"github.com/flimzy/kivik/test/kt"
+)
+
+func init() {
+	kt.Register("ErrorFormat", errorFormat)
+}
+
+type errorRequest struct {
+	name, method, path string
+}
+
+// errorFormat checks the wire format of error responses, which must match
+// CouchDB's: a JSON object of error and reason strings, with the configured
+// status and error name, and, if configured, reason.
+func errorFormat(ctx *kt.Context) {
+	ctx.RunAdmin(func(ctx *kt.Context) {
+		for _, req := range []errorRequest{
+			{"MissingDB", kivik.MethodGet, "/chicken"},
+			{"MissingDoc", kivik.MethodGet, "/_users/chicken"},
+			{"InvalidDBName", kivik.MethodPut, "/_chicken"},
+		} {
+			testErrorFormat(ctx, ctx.CHTTPAdmin, req)
+		}
+	})
+	ctx.RunNoAuth(func(ctx *kt.Context) {
+		for _, req := range []errorRequest{
+			{"DestroyDB", kivik.MethodDelete, "/chicken"},
+		} {
+			testErrorFormat(ctx, ctx.CHTTPNoAuth, req)
+		}
+	})
+}
+
+func testErrorFormat(ctx *kt.Context, client *chttp.Client, req errorRequest) {
+	ctx.Run(req.name, func(ctx *kt.Context) {
+		ctx.Parallel()
+		if client == nil {
+			ctx.Skipf("No CHTTP client")
+		}
+		resp, err := client.DoReq(context.Background(), req.method, req.path, nil)
+		if err != nil {
+			ctx.Fatalf("Request failed: %s", err)
+		}
+		defer func() { _ = resp.Body.Close() }()
+		if status := ctx.MustInt("status"); resp.StatusCode != status {
+			ctx.Errorf("Expected status %d, got %d", status, resp.StatusCode)
+		}
+		if ct := resp.Header.Get("Content-Type"); !strings.HasPrefix(ct, "application/json") && !strings.HasPrefix(ct, "text/plain") {
+			ctx.Errorf("Unexpected Content-Type: %s", ct)
+		}
+		body, err := ioutil.ReadAll(resp.Body)
+		if err != nil {
+			ctx.Fatalf("Failed to read response: %s", err)
+		}
+		var fields map[string]interface{}
+		if err := json.Unmarshal(body, &fields); err != nil {
+			ctx.Fatalf("Response is not a JSON object: %s", body)
+		}
+		for key := range fields {
+			if key != "error" && key != "reason" {
+				ctx.Errorf("Unexpected field '%s' in %s", key, body)
+			}
+		}
+		name, _ := fields["error"].(string)
+		if expected := ctx.MustString("error"); name != expected {
+			ctx.Errorf("Expected error '%s', got '%s'", expected, name)
+		}
+		reason, ok := fields["reason"].(string)
+		if !ok {
+			ctx.Errorf("Missing reason in %s", body)
+		}
+		if ctx.IsSet("reason") {
+			if expected := ctx.String("reason"); reason != expected {
+				ctx.Errorf("Expected reason '%s', got '%s'", expected, reason)
+			}
+		}
+	})
+}
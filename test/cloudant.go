@@ -53,6 +53,8 @@ func init() {
 		"DBExists/RW/group/Admin.exists":  true,
 		"DBExists/RW/group/NoAuth.status": kivik.StatusUnauthorized,
 
+		"ErrorFormat.skip": true, // FIXME: Configure for Cloudant
+
 		"Log/Admin.status":              kivik.StatusForbidden,
 		"Log/NoAuth.status":             kivik.StatusUnauthorized,
 		"Log/Admin/Offset-1000.status":  kivik.StatusBadRequest,
@@ -168,6 +170,12 @@ func init() {
 		"DeleteAttachment/RW/group/Admin/NoDoc.status":  kivik.StatusInternalServerError,
 		"DeleteAttachment/RW/group/NoAuth/NoDoc.status": kivik.StatusUnauthorized,
 
+		"AttachmentRoundTrip/RW/group/NoAuth.status": kivik.StatusUnauthorized,
+		"ChangesFeed/RW/group/NoAuth.status":         kivik.StatusUnauthorized,
+
+		"Mango/RW/group/NoAuth.status":                kivik.StatusUnauthorized,
+		"Mango/RW/group/Admin/NoIndexWarning.warning": "no matching index found, create an index to optimize query time",
+
 		"Put/RW/Admin/group/LeadingUnderscoreInID.status": kivik.StatusBadRequest,
 		"Put/RW/Admin/group/Conflict.status":              kivik.StatusConflict,
 		"Put/RW/NoAuth/group.status":                      kivik.StatusUnauthorized,
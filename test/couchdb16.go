@@ -30,6 +30,8 @@ func init() {
 		"GetIndexes.skip":    true,                       // Couchdb 1.6 doesn't support the find interface
 		"DeleteIndex.skip":   true,                       // Couchdb 1.6 doesn't support the find interface
 
+		"Mango.status": kivik.StatusNotImplemented, // Couchdb 1.6 doesn't support the find interface
+
 		"DBExists.databases":              []string{"_users", "chicken", "_duck"},
 		"DBExists/Admin/_users.exists":    true,
 		"DBExists/Admin/chicken.exists":   false,
@@ -40,6 +42,18 @@ func init() {
 		"DBExists/RW/group/Admin.exists":  true,
 		"DBExists/RW/group/NoAuth.exists": true,
 
+		"ErrorFormat/Admin/MissingDB.status":     kivik.StatusNotFound,
+		"ErrorFormat/Admin/MissingDB.error":      "not_found",
+		"ErrorFormat/Admin/MissingDB.reason":     "no_db_file",
+		"ErrorFormat/Admin/MissingDoc.status":    kivik.StatusNotFound,
+		"ErrorFormat/Admin/MissingDoc.error":     "not_found",
+		"ErrorFormat/Admin/MissingDoc.reason":    "missing",
+		"ErrorFormat/Admin/InvalidDBName.status": kivik.StatusBadRequest,
+		"ErrorFormat/Admin/InvalidDBName.error":  "illegal_database_name",
+		"ErrorFormat/NoAuth/DestroyDB.status":    kivik.StatusUnauthorized,
+		"ErrorFormat/NoAuth/DestroyDB.error":     "unauthorized",
+		"ErrorFormat/NoAuth/DestroyDB.reason":    "You are not a server admin.",
+
 		"Log/NoAuth.status":                   kivik.StatusUnauthorized,
 		"Log/NoAuth/Offset-1000.status":       kivik.StatusBadRequest,
 		"Log/Admin/Offset-1000.status":        kivik.StatusBadRequest,
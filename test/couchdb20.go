@@ -31,6 +31,11 @@ func init() {
 		"Find/RW/group/Admin/Warning.warning":  "no matching index found, create an index to optimize query time",
 		"Find/RW/group/NoAuth/Warning.warning": "no matching index found, create an index to optimize query time",
 
+		"Mango/RW/group/Admin/NoIndexWarning.warning":  "no matching index found, create an index to optimize query time",
+		"Mango/RW/group/NoAuth/NoIndexWarning.warning": "no matching index found, create an index to optimize query time",
+		"Mango/RW/group/Admin/Bookmark.skip":           true, // Bookmarks were added in CouchDB 2.1
+		"Mango/RW/group/NoAuth/Bookmark.skip":          true, // Bookmarks were added in CouchDB 2.1
+
 		"DBExists.databases":              []string{"_users", "chicken", "_duck"},
 		"DBExists/Admin/_users.exists":    true,
 		"DBExists/Admin/chicken.exists":   false,
@@ -41,6 +46,18 @@ func init() {
 		"DBExists/RW/group/Admin.exists":  true,
 		"DBExists/RW/group/NoAuth.exists": true,
 
+		"ErrorFormat/Admin/MissingDB.status":     kivik.StatusNotFound,
+		"ErrorFormat/Admin/MissingDB.error":      "not_found",
+		"ErrorFormat/Admin/MissingDB.reason":     "Database does not exist.",
+		"ErrorFormat/Admin/MissingDoc.status":    kivik.StatusNotFound,
+		"ErrorFormat/Admin/MissingDoc.error":     "not_found",
+		"ErrorFormat/Admin/MissingDoc.reason":    "missing",
+		"ErrorFormat/Admin/InvalidDBName.status": kivik.StatusBadRequest,
+		"ErrorFormat/Admin/InvalidDBName.error":  "illegal_database_name",
+		"ErrorFormat/NoAuth/DestroyDB.status":    kivik.StatusUnauthorized,
+		"ErrorFormat/NoAuth/DestroyDB.error":     "unauthorized",
+		"ErrorFormat/NoAuth/DestroyDB.reason":    "You are not a server admin.",
+
 		"Log.skip": true, // This was removed in CouchDB 2.0
 
 		"Version.version":        `^2\.0\.0$`,
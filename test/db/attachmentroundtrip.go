@@ -0,0 +1,247 @@
+package db
+
+import (
+	"bytes"
+	"context"
+	"crypto/md5"
+	"io"
+	"io/ioutil"
+	"strconv"
+	"strings"
+
+	"github.com/flimzy/kivik"
+	"github.com/flimzy/kivik/errors"
+	"github.com/flimzy/kivik/test/kt"
+)
+
+func init() {
+	kt.Register("AttachmentRoundTrip", attachmentRoundTrip)
+}
+
+// defaultLargeAttachmentSize is the size of the streamed attachment used by
+// the Large test, unless overridden by the `size` config key.
+const defaultLargeAttachmentSize = 4 * 1024 * 1024
+
+func attachmentRoundTrip(ctx *kt.Context) {
+	ctx.RunRW(func(ctx *kt.Context) {
+		dbname := ctx.TestDB()
+		defer ctx.Admin.DestroyDB(context.Background(), dbname, ctx.Options("db"))
+		ctx.Run("group", func(ctx *kt.Context) {
+			ctx.RunAdmin(func(ctx *kt.Context) {
+				ctx.Parallel()
+				testAttachmentRoundTrip(ctx, ctx.Admin, dbname)
+			})
+			ctx.RunNoAuth(func(ctx *kt.Context) {
+				ctx.Parallel()
+				testAttachmentRoundTrip(ctx, ctx.NoAuth, dbname)
+			})
+		})
+	})
+}
+
+func testAttachmentRoundTrip(ctx *kt.Context, client *kivik.Client, dbname string) {
+	db, err := client.DB(context.Background(), dbname, ctx.Options("db"))
+	if !ctx.IsExpectedSuccess(err) {
+		return
+	}
+	ctx.Run("PutGetDelete", func(ctx *kt.Context) {
+		ctx.Parallel()
+		docID := ctx.TestDBName()
+		var rev string
+		err := kt.Retry(func() error {
+			var e error
+			rev, e = db.PutAttachment(context.Background(), docID, "", kivik.NewAttachment("foo.txt", "text/plain", stringReadCloser("test content")))
+			return e
+		})
+		if !ctx.IsExpectedSuccess(err) {
+			return
+		}
+		att, err := db.GetAttachment(context.Background(), docID, rev, "foo.txt")
+		if err != nil {
+			ctx.Fatalf("Failed to get attachment: %s", err)
+		}
+		checkAttachmentContent(ctx, att, []byte("test content"))
+		rev, err = db.DeleteAttachment(context.Background(), docID, rev, "foo.txt")
+		if err != nil {
+			ctx.Fatalf("Failed to delete attachment: %s", err)
+		}
+		_, err = db.GetAttachment(context.Background(), docID, rev, "foo.txt")
+		if status := errors.StatusCode(err); status != kivik.StatusNotFound {
+			ctx.Errorf("Expected Not Found for deleted attachment, got %d/%s", status, err)
+		}
+	})
+	ctx.Run("ContentType", func(ctx *kt.Context) {
+		ctx.Parallel()
+		docID := ctx.TestDBName()
+		const contentType = "application/x-kivik-test"
+		var rev string
+		err := kt.Retry(func() error {
+			var e error
+			rev, e = db.PutAttachment(context.Background(), docID, "", kivik.NewAttachment("foo.bin", contentType, stringReadCloser("binary content")))
+			return e
+		})
+		if !ctx.IsExpectedSuccess(err) {
+			return
+		}
+		att, err := db.GetAttachment(context.Background(), docID, rev, "foo.bin")
+		if err != nil {
+			ctx.Fatalf("Failed to get attachment: %s", err)
+		}
+		if client.Driver() != "pouch" {
+			if att.ContentType != contentType {
+				ctx.Errorf("Content-Type: Expected %s, Actual %s", contentType, att.ContentType)
+			}
+		}
+		meta, err := db.GetAttachmentMeta(context.Background(), docID, rev, "foo.bin")
+		if err != nil {
+			ctx.Fatalf("Failed to get attachment meta: %s", err)
+		}
+		if meta.ContentType != contentType {
+			ctx.Errorf("Meta Content-Type: Expected %s, Actual %s", contentType, meta.ContentType)
+		}
+	})
+	ctx.Run("Stub", func(ctx *kt.Context) {
+		ctx.Parallel()
+		docID := ctx.TestDBName()
+		content := "stub content"
+		var rev string
+		err := kt.Retry(func() error {
+			var e error
+			rev, e = db.PutAttachment(context.Background(), docID, "", kivik.NewAttachment("foo.txt", "text/plain", stringReadCloser(content)))
+			return e
+		})
+		if !ctx.IsExpectedSuccess(err) {
+			return
+		}
+		row, err := db.Get(context.Background(), docID, kivik.Options{"rev": rev})
+		if err != nil {
+			ctx.Fatalf("Failed to get doc: %s", err)
+		}
+		var doc struct {
+			Attachments map[string]struct {
+				ContentType string `json:"content_type"`
+				Stub        bool   `json:"stub"`
+				Length      int64  `json:"length"`
+				Digest      string `json:"digest"`
+			} `json:"_attachments"`
+		}
+		if err := row.ScanDoc(&doc); err != nil {
+			ctx.Fatalf("Failed to scan doc: %s", err)
+		}
+		stub, ok := doc.Attachments["foo.txt"]
+		if !ok {
+			ctx.Fatalf("Attachment stub missing from document")
+		}
+		if !stub.Stub {
+			ctx.Errorf("Attachment not reported as a stub")
+		}
+		if stub.ContentType != "text/plain" {
+			ctx.Errorf("Stub Content-Type: Expected text/plain, Actual %s", stub.ContentType)
+		}
+		if stub.Length != int64(len(content)) {
+			ctx.Errorf("Stub length: Expected %d, Actual %d", len(content), stub.Length)
+		}
+		if !strings.HasPrefix(stub.Digest, "md5-") {
+			ctx.Errorf("Unexpected stub digest: %s", stub.Digest)
+		}
+	})
+	ctx.Run("Large", func(ctx *kt.Context) {
+		ctx.Parallel()
+		size := ctx.Int("size")
+		if size == 0 {
+			size = defaultLargeAttachmentSize
+		}
+		docID := ctx.TestDBName()
+		expected := md5.New()
+		var rev string
+		err := kt.Retry(func() error {
+			expected.Reset()
+			r, w := io.Pipe()
+			go func() {
+				_, e := io.Copy(io.MultiWriter(w, expected), io.LimitReader(patternReader{}, int64(size)))
+				w.CloseWithError(e)
+			}()
+			var e error
+			rev, e = db.PutAttachment(context.Background(), docID, "", kivik.NewAttachment("large.bin", "application/octet-stream", r))
+			return e
+		})
+		if !ctx.IsExpectedSuccess(err) {
+			return
+		}
+		att, err := db.GetAttachment(context.Background(), docID, rev, "large.bin")
+		if err != nil {
+			ctx.Fatalf("Failed to get attachment: %s", err)
+		}
+		defer att.Close()
+		actual := md5.New()
+		n, err := io.Copy(actual, att)
+		if err != nil {
+			ctx.Fatalf("Failed to read attachment: %s", err)
+		}
+		if n != int64(size) {
+			ctx.Errorf("Size: Expected %d, Actual %d", size, n)
+		}
+		if !bytes.Equal(expected.Sum(nil), actual.Sum(nil)) {
+			ctx.Errorf("Retrieved attachment content differs from the original")
+		}
+	})
+	ctx.Run("Revs", func(ctx *kt.Context) {
+		ctx.Parallel()
+		docID := ctx.TestDBName()
+		var rev1 string
+		err := kt.Retry(func() error {
+			var e error
+			rev1, e = db.PutAttachment(context.Background(), docID, "", kivik.NewAttachment("foo.txt", "text/plain", stringReadCloser("one")))
+			return e
+		})
+		if !ctx.IsExpectedSuccess(err) {
+			return
+		}
+		rev2, err := db.PutAttachment(context.Background(), docID, rev1, kivik.NewAttachment("foo.txt", "text/plain", stringReadCloser("two")))
+		if err != nil {
+			ctx.Fatalf("Failed to update attachment: %s", err)
+		}
+		if revGeneration(rev2) != revGeneration(rev1)+1 {
+			ctx.Errorf("Expected rev generation to increase by 1: %s -> %s", rev1, rev2)
+		}
+		_, err = db.PutAttachment(context.Background(), docID, rev1, kivik.NewAttachment("foo.txt", "text/plain", stringReadCloser("three")))
+		if status := errors.StatusCode(err); status != kivik.StatusConflict {
+			ctx.Errorf("Expected Conflict for stale rev, got %d/%s", status, err)
+		}
+		rev3, err := db.DeleteAttachment(context.Background(), docID, rev2, "foo.txt")
+		if err != nil {
+			ctx.Fatalf("Failed to delete attachment: %s", err)
+		}
+		if revGeneration(rev3) != revGeneration(rev2)+1 {
+			ctx.Errorf("Expected rev generation to increase by 1: %s -> %s", rev2, rev3)
+		}
+	})
+}
+
+func checkAttachmentContent(ctx *kt.Context, att *kivik.Attachment, expected []byte) {
+	defer att.Close()
+	content, err := ioutil.ReadAll(att)
+	if err != nil {
+		ctx.Fatalf("Failed to read attachment: %s", err)
+	}
+	if !bytes.Equal(expected, content) {
+		ctx.Errorf("Content: Expected %q, Actual %q", expected, content)
+	}
+}
+
+// revGeneration returns the numeric prefix of a rev, or 0 if it cannot be
+// parsed.
+func revGeneration(rev string) int {
+	gen, _ := strconv.Atoi(strings.SplitN(rev, "-", 2)[0])
+	return gen
+}
+
+// patternReader produces an endless, deterministic stream of bytes.
+type patternReader struct{}
+
+func (patternReader) Read(p []byte) (int, error) {
+	for i := range p {
+		p[i] = byte(i % 251)
+	}
+	return len(p), nil
+}
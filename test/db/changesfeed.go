@@ -0,0 +1,230 @@
+package db
+
+import (
+	"context"
+	"encoding/json"
+	"sync"
+	"time"
+
+	"github.com/flimzy/kivik"
+	"github.com/flimzy/kivik/test/kt"
+)
+
+func init() {
+	kt.Register("ChangesFeed", changesFeed)
+}
+
+func changesFeed(ctx *kt.Context) {
+	ctx.RunRW(func(ctx *kt.Context) {
+		ctx.Run("group", func(ctx *kt.Context) {
+			ctx.RunAdmin(func(ctx *kt.Context) {
+				ctx.Parallel()
+				testChangesFeed(ctx, ctx.Admin)
+			})
+			ctx.RunNoAuth(func(ctx *kt.Context) {
+				ctx.Parallel()
+				testChangesFeed(ctx, ctx.NoAuth)
+			})
+		})
+	})
+}
+
+type feedChange struct {
+	ID      string
+	Seq     string
+	Deleted bool
+	Changes []string
+	Doc     json.RawMessage
+}
+
+// readChanges reads up to max changes from the feed, or until the feed
+// terminates. It fails the test if neither happens within maxWait. If max is
+// reached, the feed is closed.
+func readChanges(ctx *kt.Context, changes *kivik.Changes, max int) []feedChange {
+	var mu sync.Mutex
+	results := make([]feedChange, 0, max)
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for changes.Next() {
+			ch := feedChange{
+				ID:      changes.ID(),
+				Seq:     string(changes.Seq()),
+				Deleted: changes.Deleted(),
+				Changes: changes.Changes(),
+			}
+			_ = changes.ScanDoc(&ch.Doc)
+			mu.Lock()
+			results = append(results, ch)
+			count := len(results)
+			mu.Unlock()
+			if count >= max {
+				_ = changes.Close()
+			}
+		}
+	}()
+	timer := time.NewTimer(maxWait)
+	defer timer.Stop()
+	select {
+	case <-done:
+	case <-timer.C:
+		// Close may block until a pending read returns, so don't wait for it.
+		go func() { _ = changes.Close() }()
+		ctx.Errorf("Failed to read %d changes in %s", max, maxWait)
+		mu.Lock()
+		defer mu.Unlock()
+		return append([]feedChange{}, results...)
+	}
+	if err := changes.Err(); err != nil {
+		ctx.Errorf("Iteration failed: %s", err)
+	}
+	return results
+}
+
+func testChangesFeed(ctx *kt.Context, client *kivik.Client) {
+	dbname := ctx.TestDB()
+	defer ctx.Admin.DestroyDB(context.Background(), dbname, ctx.Options("db"))
+	adb, err := ctx.Admin.DB(context.Background(), dbname, ctx.Options("db"))
+	if err != nil {
+		ctx.Fatalf("Failed to open admin db: %s", err)
+	}
+	db, err := client.DB(context.Background(), dbname, ctx.Options("db"))
+	if !ctx.IsExpectedSuccess(err) {
+		return
+	}
+	// Seed the database: create two docs, update the first, delete the second.
+	aRev, err := adb.Put(context.Background(), "a", map[string]string{"value": "one"})
+	if err != nil {
+		ctx.Fatalf("Failed to create doc: %s", err)
+	}
+	bRev, err := adb.Put(context.Background(), "b", map[string]string{"value": "two"})
+	if err != nil {
+		ctx.Fatalf("Failed to create doc: %s", err)
+	}
+	if aRev, err = adb.Put(context.Background(), "a", map[string]string{"_rev": aRev, "value": "three"}); err != nil {
+		ctx.Fatalf("Failed to update doc: %s", err)
+	}
+	if bRev, err = adb.Delete(context.Background(), "b", bRev); err != nil {
+		ctx.Fatalf("Failed to delete doc: %s", err)
+	}
+
+	var firstSeq string
+	ctx.Run("Since0", func(ctx *kt.Context) {
+		changes, err := db.Changes(context.Background(), kivik.Options{"since": "0"})
+		if !ctx.IsExpectedSuccess(err) {
+			return
+		}
+		results := readChanges(ctx, changes, 2)
+		if len(results) != 2 {
+			ctx.Fatalf("Expected 2 changes, got %d", len(results))
+		}
+		byID := make(map[string]feedChange)
+		for _, ch := range results {
+			byID[ch.ID] = ch
+		}
+		if a := byID["a"]; a.Deleted || len(a.Changes) == 0 || a.Changes[0] != aRev {
+			ctx.Errorf("Unexpected change for doc a: %+v", a)
+		}
+		if b := byID["b"]; !b.Deleted || len(b.Changes) == 0 || b.Changes[0] != bRev {
+			ctx.Errorf("Unexpected change for doc b: %+v", b)
+		}
+		firstSeq = results[0].Seq
+	})
+	ctx.Run("SinceSeq", func(ctx *kt.Context) {
+		if firstSeq == "" {
+			ctx.Skipf("No sequence available from Since0")
+		}
+		changes, err := db.Changes(context.Background(), kivik.Options{"since": firstSeq})
+		if !ctx.IsExpectedSuccess(err) {
+			return
+		}
+		results := readChanges(ctx, changes, 1)
+		if len(results) != 1 {
+			ctx.Fatalf("Expected 1 change, got %d", len(results))
+		}
+		if results[0].Seq == firstSeq {
+			ctx.Errorf("Change at seq %s should not have been included", firstSeq)
+		}
+	})
+	ctx.Run("IncludeDocs", func(ctx *kt.Context) {
+		changes, err := db.Changes(context.Background(), kivik.Options{"since": "0", "include_docs": true})
+		if !ctx.IsExpectedSuccess(err) {
+			return
+		}
+		for _, ch := range readChanges(ctx, changes, 2) {
+			var doc struct {
+				ID      string `json:"_id"`
+				Deleted bool   `json:"_deleted"`
+				Value   string `json:"value"`
+			}
+			if err := json.Unmarshal(ch.Doc, &doc); err != nil {
+				ctx.Errorf("Failed to decode doc for %s: %s", ch.ID, err)
+				continue
+			}
+			if doc.ID != ch.ID {
+				ctx.Errorf("Doc ID %q does not match change ID %q", doc.ID, ch.ID)
+			}
+			switch ch.ID {
+			case "a":
+				if doc.Value != "three" {
+					ctx.Errorf("Expected latest doc value 'three', got '%s'", doc.Value)
+				}
+			case "b":
+				if !doc.Deleted {
+					ctx.Errorf("Expected deleted doc to be flagged _deleted")
+				}
+			}
+		}
+	})
+	ctx.Run("Limit", func(ctx *kt.Context) {
+		changes, err := db.Changes(context.Background(), kivik.Options{"since": "0", "limit": 1})
+		if !ctx.IsExpectedSuccess(err) {
+			return
+		}
+		// Ask for more than the limit, to ensure the feed terminates on its own.
+		if results := readChanges(ctx, changes, 2); len(results) != 1 {
+			ctx.Errorf("Expected 1 change, got %d", len(results))
+		}
+	})
+	ctx.Run("Continuous", func(ctx *kt.Context) {
+		changes, err := db.Changes(context.Background(), kivik.Options{"feed": "continuous", "since": "now"})
+		if !ctx.IsExpectedSuccess(err) {
+			return
+		}
+		rev, err := adb.Put(context.Background(), "c", map[string]string{"value": "four"})
+		if err != nil {
+			_ = changes.Close()
+			ctx.Fatalf("Failed to create doc: %s", err)
+		}
+		results := readChanges(ctx, changes, 1)
+		if len(results) != 1 {
+			ctx.Fatalf("Expected 1 change, got %d", len(results))
+		}
+		if results[0].ID != "c" || len(results[0].Changes) == 0 || results[0].Changes[0] != rev {
+			ctx.Errorf("Unexpected change: %+v", results[0])
+		}
+	})
+	ctx.Run("Cancel", func(ctx *kt.Context) {
+		cx, cancel := context.WithCancel(context.Background())
+		changes, err := db.Changes(cx, kivik.Options{"feed": "continuous", "since": "now"})
+		if !ctx.IsExpectedSuccess(err) {
+			cancel()
+			return
+		}
+		done := make(chan struct{})
+		go func() {
+			defer close(done)
+			for changes.Next() {
+			}
+		}()
+		cancel()
+		timer := time.NewTimer(maxWait)
+		defer timer.Stop()
+		select {
+		case <-done:
+		case <-timer.C:
+			go func() { _ = changes.Close() }()
+			ctx.Errorf("Feed not terminated within %s of cancellation", maxWait)
+		}
+	})
+}
@@ -0,0 +1,236 @@
+package db
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"testing"
+
+	"github.com/flimzy/kivik"
+	"github.com/flimzy/kivik/errors"
+	"github.com/flimzy/kivik/test/kt"
+)
+
+func init() {
+	kt.Register("Concurrency", concurrency)
+}
+
+// defaultWorkers is the number of concurrent goroutines used by each
+// concurrency test, unless overridden by the `workers` config key.
+const defaultWorkers = 10
+
+func concurrency(ctx *kt.Context) {
+	if testing.Short() {
+		ctx.Skipf("Skipping concurrency tests in short mode")
+	}
+	ctx.RunRW(func(ctx *kt.Context) {
+		ctx.RunAdmin(func(ctx *kt.Context) {
+			testConcurrency(ctx, ctx.Admin)
+		})
+	})
+}
+
+func workers(ctx *kt.Context) int {
+	if n := ctx.Int("workers"); n > 0 {
+		return n
+	}
+	return defaultWorkers
+}
+
+// runWorkers calls fn concurrently from n goroutines, and returns the
+// resulting errors, indexed by worker.
+func runWorkers(n int, fn func(i int) error) []error {
+	errs := make([]error, n)
+	start := make(chan struct{})
+	var wg sync.WaitGroup
+	for i := 0; i < n; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			<-start
+			errs[i] = fn(i)
+		}(i)
+	}
+	close(start)
+	wg.Wait()
+	return errs
+}
+
+// countResults returns the number of successes and conflicts in errs. Any
+// other error fails the test.
+func countResults(ctx *kt.Context, errs []error) (successes, conflicts int) {
+	for _, err := range errs {
+		switch errors.StatusCode(err) {
+		case 0:
+			successes++
+		case kivik.StatusConflict:
+			conflicts++
+		default:
+			ctx.Errorf("Unexpected error: %s", err)
+		}
+	}
+	return successes, conflicts
+}
+
+func testConcurrency(ctx *kt.Context, client *kivik.Client) {
+	n := workers(ctx)
+	dbname := ctx.TestDB()
+	defer ctx.Admin.DestroyDB(context.Background(), dbname, ctx.Options("db"))
+	db, err := client.DB(context.Background(), dbname, ctx.Options("db"))
+	if !ctx.IsExpectedSuccess(err) {
+		return
+	}
+	ctx.Run("group", func(ctx *kt.Context) {
+		ctx.Run("SameDocCreate", func(ctx *kt.Context) {
+			ctx.Parallel()
+			docID := ctx.TestDBName()
+			revs := make([]string, n)
+			errs := runWorkers(n, func(i int) error {
+				var e error
+				revs[i], e = db.Put(context.Background(), docID, map[string]int{"worker": i})
+				return e
+			})
+			successes, conflicts := countResults(ctx, errs)
+			if successes != 1 || conflicts != n-1 {
+				ctx.Errorf("Expected 1 success and %d conflicts, got %d and %d", n-1, successes, conflicts)
+			}
+			for i, err := range errs {
+				if err != nil {
+					continue
+				}
+				if revGeneration(revs[i]) != 1 {
+					ctx.Errorf("Expected a first-generation rev, got %s", revs[i])
+				}
+			}
+		})
+		ctx.Run("SameDocUpdate", func(ctx *kt.Context) {
+			ctx.Parallel()
+			docID := ctx.TestDBName()
+			rev, err := db.Put(context.Background(), docID, map[string]int{"worker": -1})
+			if err != nil {
+				ctx.Fatalf("Failed to create doc: %s", err)
+			}
+			errs := runWorkers(n, func(i int) error {
+				_, e := db.Put(context.Background(), docID, map[string]interface{}{"_rev": rev, "worker": i})
+				return e
+			})
+			successes, conflicts := countResults(ctx, errs)
+			if successes != 1 || conflicts != n-1 {
+				ctx.Errorf("Expected 1 success and %d conflicts, got %d and %d", n-1, successes, conflicts)
+			}
+			var winner int
+			for i, err := range errs {
+				if err == nil {
+					winner = i
+				}
+			}
+			row, err := db.Get(context.Background(), docID)
+			if err != nil {
+				ctx.Fatalf("Failed to fetch doc: %s", err)
+			}
+			var doc struct {
+				Rev    string `json:"_rev"`
+				Worker int    `json:"worker"`
+			}
+			if err := row.ScanDoc(&doc); err != nil {
+				ctx.Fatalf("Failed to scan doc: %s", err)
+			}
+			if doc.Worker != winner {
+				ctx.Errorf("Expected the update from worker %d to win, found %d", winner, doc.Worker)
+			}
+			if revGeneration(doc.Rev) != 2 {
+				ctx.Errorf("Expected a second-generation rev, got %s", doc.Rev)
+			}
+		})
+		ctx.Run("DistinctDocs", func(ctx *kt.Context) {
+			ctx.Parallel()
+			prefix := ctx.TestDBName()
+			errs := runWorkers(n, func(i int) error {
+				_, e := db.Put(context.Background(), fmt.Sprintf("%s-%02d", prefix, i), map[string]int{"worker": i})
+				return e
+			})
+			for _, err := range errs {
+				if err != nil {
+					ctx.Errorf("Failed to create doc: %s", err)
+				}
+			}
+			for i := 0; i < n; i++ {
+				if _, err := db.Get(context.Background(), fmt.Sprintf("%s-%02d", prefix, i)); err != nil {
+					ctx.Errorf("Failed to fetch doc %d: %s", i, err)
+				}
+			}
+		})
+		ctx.Run("CreateDestroy", func(ctx *kt.Context) {
+			ctx.Parallel()
+			names := make([]string, n)
+			for i := range names {
+				names[i] = ctx.TestDBName()
+			}
+			errs := runWorkers(n, func(i int) error {
+				if e := client.CreateDB(context.Background(), names[i], ctx.Options("db")); e != nil {
+					return e
+				}
+				d, e := client.DB(context.Background(), names[i], ctx.Options("db"))
+				if e != nil {
+					return e
+				}
+				if _, e = d.Put(context.Background(), "doc", map[string]int{"worker": i}); e != nil {
+					return e
+				}
+				return client.DestroyDB(context.Background(), names[i], ctx.Options("db"))
+			})
+			for i, err := range errs {
+				if err != nil {
+					ctx.Errorf("Worker %d failed: %s", i, err)
+				}
+			}
+			for _, name := range names {
+				exists, err := client.DBExists(context.Background(), name, ctx.Options("db"))
+				if err != nil {
+					ctx.Errorf("Failed to check for %s: %s", name, err)
+					continue
+				}
+				if exists {
+					ctx.Errorf("Database %s still exists after destruction", name)
+					_ = client.DestroyDB(context.Background(), name, ctx.Options("db"))
+				}
+			}
+		})
+	})
+	ctx.Run("ChangesConsumers", func(ctx *kt.Context) {
+		// Run after the group above, so that the doc count is stable. Check for
+		// expected failure before starting the consumers.
+		changes, err := db.Changes(context.Background(), kivik.Options{"since": "0"})
+		if !ctx.IsExpectedSuccess(err) {
+			return
+		}
+		_ = changes.Close()
+		rows, err := db.AllDocs(context.Background())
+		if err != nil {
+			ctx.Fatalf("Failed to count docs: %s", err)
+		}
+		var count int
+		for rows.Next() {
+			count++
+		}
+		if err := rows.Err(); err != nil {
+			ctx.Fatalf("Iteration failed: %s", err)
+		}
+		var wg sync.WaitGroup
+		for i := 0; i < n; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				changes, err := db.Changes(context.Background(), kivik.Options{"since": "0"})
+				if err != nil {
+					ctx.Errorf("Failed to open changes feed: %s", err)
+					return
+				}
+				if results := readChanges(ctx, changes, count); len(results) != count {
+					ctx.Errorf("Expected %d changes, got %d", count, len(results))
+				}
+			}()
+		}
+		wg.Wait()
+	})
+}
@@ -0,0 +1,100 @@
+package db
+
+import (
+	"context"
+	"fmt"
+	"runtime"
+	"time"
+
+	"github.com/flimzy/kivik"
+	"github.com/flimzy/kivik/test/kt"
+)
+
+func init() {
+	kt.Register("IteratorCancel", iteratorCancel)
+}
+
+// iterator is the common interface of Rows and Changes.
+type iterator interface {
+	Next() bool
+	Err() error
+	Close() error
+}
+
+func iteratorCancel(ctx *kt.Context) {
+	ctx.RunRW(func(ctx *kt.Context) {
+		ctx.RunAdmin(func(ctx *kt.Context) {
+			testIteratorCancel(ctx, ctx.Admin)
+		})
+	})
+}
+
+func testIteratorCancel(ctx *kt.Context, client *kivik.Client) {
+	dbname := ctx.TestDB()
+	defer ctx.Admin.DestroyDB(context.Background(), dbname, ctx.Options("db"))
+	db, err := client.DB(context.Background(), dbname, ctx.Options("db"))
+	if err != nil {
+		ctx.Fatalf("Failed to connect to db: %s", err)
+	}
+	for i := 0; i < 5; i++ {
+		if _, err := db.Put(context.Background(), fmt.Sprintf("doc%d", i), map[string]int{"i": i}); err != nil {
+			ctx.Fatalf("Failed to create doc: %s", err)
+		}
+	}
+	ctx.Run("AllDocs", func(ctx *kt.Context) {
+		checkIteratorCancel(ctx, func(c context.Context) (iterator, error) {
+			return db.AllDocs(c)
+		})
+	})
+	ctx.Run("Changes", func(ctx *kt.Context) {
+		feed := ctx.String("feed")
+		if feed == "" {
+			feed = "continuous"
+		}
+		checkIteratorCancel(ctx, func(c context.Context) (iterator, error) {
+			return db.Changes(c, kivik.Options{"feed": feed, "since": 0})
+		})
+	})
+}
+
+// checkIteratorCancel cancels the context of the iterator returned by open,
+// after reading the first result, and checks that iteration stops with the
+// context's error, and that no goroutines are left running.
+func checkIteratorCancel(ctx *kt.Context, open func(context.Context) (iterator, error)) {
+	before := runtime.NumGoroutine()
+	c, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	it, err := open(c)
+	if !ctx.IsExpectedSuccess(err) {
+		return
+	}
+	if !it.Next() {
+		ctx.Fatalf("Expected a result before cancellation: %v", it.Err())
+	}
+	cancel()
+	done := make(chan struct{})
+	go func() {
+		for it.Next() {
+		}
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(maxWait):
+		ctx.Fatalf("Iteration did not stop within %s of cancellation", maxWait)
+	}
+	if err := it.Err(); err != context.Canceled {
+		ctx.Errorf("Expected %v, got %v", context.Canceled, err)
+	}
+	if err := it.Close(); err != nil {
+		ctx.Errorf("Failed to close iterator: %s", err)
+	}
+	deadline := time.Now().Add(maxWait)
+	for runtime.NumGoroutine() > before {
+		if time.Now().After(deadline) {
+			ctx.Errorf("%d goroutines leaked after cancellation", runtime.NumGoroutine()-before)
+			return
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
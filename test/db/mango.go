@@ -0,0 +1,196 @@
+package db
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/flimzy/diff"
+	"github.com/flimzy/kivik"
+	"github.com/flimzy/kivik/test/kt"
+)
+
+func init() {
+	kt.Register("Mango", mango)
+}
+
+// mangoDocs is the number of documents seeded for the Mango tests. Doc i has
+// ID "doc%02d", age i, and is in group "even" or "odd".
+const mangoDocs = 10
+
+func mangoDocID(i int) string {
+	return fmt.Sprintf("doc%02d", i)
+}
+
+func mango(ctx *kt.Context) {
+	ctx.RunRW(func(ctx *kt.Context) {
+		dbname := ctx.TestDB()
+		defer ctx.Admin.DestroyDB(context.Background(), dbname, ctx.Options("db"))
+		adb, err := ctx.Admin.DB(context.Background(), dbname, ctx.Options("db"))
+		if err != nil {
+			ctx.Fatalf("Failed to open db: %s", err)
+		}
+		for i := 0; i < mangoDocs; i++ {
+			group := "even"
+			if i%2 == 1 {
+				group = "odd"
+			}
+			doc := map[string]interface{}{
+				"name":  fmt.Sprintf("Person %d", i),
+				"age":   i,
+				"group": group,
+			}
+			if _, err := adb.Put(context.Background(), mangoDocID(i), doc); err != nil {
+				ctx.Fatalf("Failed to create doc: %s", err)
+			}
+		}
+		err = adb.CreateIndex(context.Background(), "mango", "age", `{"fields":["age"]}`)
+		if !ctx.IsExpectedSuccess(err) {
+			return
+		}
+		ctx.Run("group", func(ctx *kt.Context) {
+			ctx.RunAdmin(func(ctx *kt.Context) {
+				ctx.Parallel()
+				testMango(ctx, ctx.Admin, dbname)
+			})
+			ctx.RunNoAuth(func(ctx *kt.Context) {
+				ctx.Parallel()
+				testMango(ctx, ctx.NoAuth, dbname)
+			})
+		})
+	})
+}
+
+// findDocs runs the query, and returns the resulting documents, and the rows
+// iterator, for inspection of metadata.
+func findDocs(ctx *kt.Context, db *kivik.DB, query interface{}) ([]map[string]interface{}, *kivik.Rows, bool) {
+	rows, err := db.Find(context.Background(), query)
+	if !ctx.IsExpectedSuccess(err) {
+		return nil, nil, false
+	}
+	docs := make([]map[string]interface{}, 0)
+	for rows.Next() {
+		var doc map[string]interface{}
+		if err := rows.ScanDoc(&doc); err != nil {
+			ctx.Errorf("Failed to scan doc: %s", err)
+			continue
+		}
+		docs = append(docs, doc)
+	}
+	if err := rows.Err(); err != nil {
+		ctx.Errorf("Iteration failed: %s", err)
+		return nil, nil, false
+	}
+	return docs, rows, true
+}
+
+func docIDs(docs []map[string]interface{}) []string {
+	ids := make([]string, len(docs))
+	for i, doc := range docs {
+		ids[i], _ = doc["_id"].(string)
+	}
+	return ids
+}
+
+func testMango(ctx *kt.Context, client *kivik.Client, dbname string) {
+	db, err := client.DB(context.Background(), dbname, ctx.Options("db"))
+	if !ctx.IsExpectedSuccess(err) {
+		return
+	}
+	ctx.Run("Selector", func(ctx *kt.Context) {
+		ctx.Parallel()
+		docs, _, ok := findDocs(ctx, db, `{"selector":{"age":{"$gte":5}},"sort":["age"]}`)
+		if !ok {
+			return
+		}
+		expected := []string{"doc05", "doc06", "doc07", "doc08", "doc09"}
+		if d := diff.TextSlices(expected, docIDs(docs)); d != "" {
+			ctx.Errorf("Unexpected document IDs returned:\n%s\n", d)
+		}
+	})
+	ctx.Run("CombinedSelector", func(ctx *kt.Context) {
+		ctx.Parallel()
+		docs, _, ok := findDocs(ctx, db, `{"selector":{"age":{"$lt":6},"group":"odd"},"sort":["age"]}`)
+		if !ok {
+			return
+		}
+		expected := []string{"doc01", "doc03", "doc05"}
+		if d := diff.TextSlices(expected, docIDs(docs)); d != "" {
+			ctx.Errorf("Unexpected document IDs returned:\n%s\n", d)
+		}
+	})
+	ctx.Run("Sort", func(ctx *kt.Context) {
+		ctx.Parallel()
+		docs, _, ok := findDocs(ctx, db, `{"selector":{"age":{"$gt":null}},"sort":[{"age":"desc"}],"limit":3}`)
+		if !ok {
+			return
+		}
+		expected := []string{"doc09", "doc08", "doc07"}
+		if d := diff.TextSlices(expected, docIDs(docs)); d != "" {
+			ctx.Errorf("Unexpected document IDs returned:\n%s\n", d)
+		}
+	})
+	ctx.Run("Fields", func(ctx *kt.Context) {
+		ctx.Parallel()
+		docs, _, ok := findDocs(ctx, db, `{"selector":{"age":3},"fields":["_id","name"]}`)
+		if !ok {
+			return
+		}
+		expected := []map[string]interface{}{
+			{"_id": "doc03", "name": "Person 3"},
+		}
+		if d := diff.AsJSON(expected, docs); d != "" {
+			ctx.Errorf("Unexpected projection:\n%s\n", d)
+		}
+	})
+	ctx.Run("Bookmark", func(ctx *kt.Context) {
+		ctx.Parallel()
+		query := map[string]interface{}{
+			"selector": map[string]interface{}{"age": map[string]interface{}{"$gt": nil}},
+			"limit":    4,
+		}
+		seen := make(map[string]bool)
+		for page := 0; page < 4; page++ {
+			docs, rows, ok := findDocs(ctx, db, query)
+			if !ok {
+				return
+			}
+			for _, id := range docIDs(docs) {
+				if seen[id] {
+					ctx.Errorf("Document %s returned on more than one page", id)
+				}
+				seen[id] = true
+			}
+			if len(docs) == 0 {
+				break
+			}
+			bookmark := rows.Bookmark()
+			if bookmark == "" {
+				ctx.Fatalf("No bookmark returned")
+			}
+			query["bookmark"] = bookmark
+		}
+		if len(seen) != mangoDocs {
+			ctx.Errorf("Expected to page through %d docs, saw %d", mangoDocs, len(seen))
+		}
+	})
+	ctx.Run("IndexSelection", func(ctx *kt.Context) {
+		ctx.Parallel()
+		_, rows, ok := findDocs(ctx, db, `{"selector":{"age":{"$gt":7}},"use_index":["mango","age"]}`)
+		if !ok {
+			return
+		}
+		if w := rows.Warning(); w != "" {
+			ctx.Errorf("Unexpected warning when using an index: %s", w)
+		}
+	})
+	ctx.Run("NoIndexWarning", func(ctx *kt.Context) {
+		ctx.Parallel()
+		_, rows, ok := findDocs(ctx, db, `{"selector":{"name":"Person 4"}}`)
+		if !ok {
+			return
+		}
+		if w := ctx.String("warning"); w != rows.Warning() {
+			ctx.Errorf("Warning:\nExpected: %s\n  Actual: %s", w, rows.Warning())
+		}
+	})
+}
@@ -5,14 +5,18 @@ import (
 	"github.com/flimzy/kivik/test/kt"
 )
 
+// fsManifest declares the features of the filesystem driver.
+var fsManifest = kt.Manifest{
+	// FIXME: Update as the driver implements them.
+}
+
 func init() {
-	RegisterSuite(SuiteKivikFS, kt.SuiteConfig{
+	RegisterSuite(SuiteKivikFS, fsManifest.Apply(kt.SuiteConfig{
 		"AllDBs.expected": []string{},
 
 		"CreateDB/RW/NoAuth.status":         kivik.StatusUnauthorized,
 		"CreateDB/RW/Admin/Recreate.status": kivik.StatusPreconditionFailed,
 
-		"AllDocs.skip": true, // FIXME: Not yet implemented
 		// "AllDocs/Admin.databases":  []string{"foo"},
 		// "AllDocs/Admin/foo.status": kivik.StatusNotFound,
 
@@ -29,33 +33,9 @@ func init() {
 		"Version.vendor":         "Kivik",
 		"Version.vendor_version": `^0\.0\.1$`,
 
-		// Replications not to be implemented
-		"GetReplications.skip": true,
-		"Replicate.skip":       true,
-
-		"Get.skip":               true,                       // FIXME: Unimplemented
-		"Flush.skip":             true,                       // FIXME: Unimplemented
-		"Delete.skip":            true,                       // FIXME: Unimplemented
-		"Stats.skip":             true,                       // FIXME: Unimplemented
-		"CreateDoc.skip":         true,                       // FIXME: Unimplemented
-		"Compact.skip":           true,                       // FIXME: Unimplemented
-		"Security.skip":          true,                       // FIXME: Unimplemented
-		"DBUpdates.status":       kivik.StatusNotImplemented, // FIXME: Unimplemented
-		"Changes.skip":           true,                       // FIXME: Unimplemented
-		"Copy.skip":              true,                       // FIXME: Unimplemented, depends on Get/Put or Copy
-		"BulkDocs.skip":          true,                       // FIXME: Unimplemented
-		"GetAttachment.skip":     true,                       // FIXME: Unimplemented
-		"GetAttachmentMeta.skip": true,                       // FIXME: Unimplemented
-		"PutAttachment.skip":     true,                       // FIXME: Unimplemented
-		"DeleteAttachment.skip":  true,                       // FIXME: Unimplemented
-		"Query.skip":             true,                       // FIXME: Unimplemented
-		"Find.skip":              true,                       // FIXME: Unimplemented
-		"CreateIndex.skip":       true,                       // FIXME: Unimplemented
-		"GetIndexes.skip":        true,                       // FIXME: Unimplemented
-		"DeleteIndex.skip":       true,                       // FIXME: Unimplemented
-		"Put.skip":               true,                       // FIXME: Unimplemented
-		"SetSecurity.skip":       true,                       // FIXME: Unimplemented
-		"ViewCleanup.skip":       true,                       // FIXME: Unimplemented
-		"Rev.skip":               true,                       // FIXME: Unimplemented
-	})
+		"DBUpdates.status": kivik.StatusNotImplemented, // FIXME: Unimplemented
+
+		"Concurrency.skip":    true, // FIXME: Unimplemented
+		"IteratorCancel.skip": true, // FIXME: Unimplemented
+	}))
 }
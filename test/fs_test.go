@@ -30,5 +30,6 @@ func TestFS(t *testing.T) {
 		RW:    true,
 		Admin: client,
 	}
+	checkManifest(t, clients, fsManifest)
 	runTests(clients, SuiteKivikFS, t)
 }
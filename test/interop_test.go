@@ -0,0 +1,132 @@
+// +build !js
+
+package test
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"testing"
+
+	"github.com/flimzy/kivik"
+)
+
+func TestReplicationInterop(t *testing.T) {
+	backends := make([]*InteropBackend, 0, 4)
+	for _, couch := range []struct {
+		name, env string
+	}{
+		{"couch16", "KIVIK_TEST_DSN_COUCH16"},
+		{"couch20", "KIVIK_TEST_DSN_COUCH20"},
+	} {
+		dsn := os.Getenv(couch.env)
+		if dsn == "" {
+			t.Logf("%s not set; excluding %s from interop tests", couch.env, couch.name)
+			continue
+		}
+		client, err := kivik.New(context.Background(), "couch", dsn)
+		if err != nil {
+			t.Fatalf("Failed to connect to %s: %s", couch.name, err)
+		}
+		backends = append(backends, &InteropBackend{
+			Name:       couch.name,
+			Client:     client,
+			Prefix:     dsn,
+			Replicator: true,
+		})
+	}
+
+	memClient, err := kivik.New(context.Background(), "memory", "")
+	if err != nil {
+		t.Fatalf("Failed to connect to memory driver: %s", err)
+	}
+	backends = append(backends, &InteropBackend{
+		Name:   "memory",
+		Client: memClient,
+	})
+
+	dsn, closeFn := newKivikServer(t)
+	defer closeFn()
+	serverClient, err := kivik.New(context.Background(), "couch", dsn)
+	if err != nil {
+		t.Fatalf("Failed to connect to kivik server: %s", err)
+	}
+	backends = append(backends, &InteropBackend{
+		Name:   "kivikServer",
+		Client: serverClient,
+		Prefix: dsn,
+	})
+
+	RunInteropTests(backends, t)
+}
+
+// replicationRootFields are the fields of the server root which replication
+// clients read to identify a peer.
+var replicationRootFields = []string{"couchdb", "version", "uuid", "features", "vendor"}
+
+// TestRootInterop verifies that the kivik server's root endpoint reports each
+// field used by replication clients which a real CouchDB reports, with the
+// same JSON type.
+func TestRootInterop(t *testing.T) {
+	dsn, closeFn := newKivikServer(t)
+	defer closeFn()
+	kivikRoot := serverRoot(t, dsn)
+	var tested bool
+	for _, couch := range []struct {
+		name, env string
+	}{
+		{"couch16", "KIVIK_TEST_DSN_COUCH16"},
+		{"couch20", "KIVIK_TEST_DSN_COUCH20"},
+	} {
+		couchDSN := os.Getenv(couch.env)
+		if couchDSN == "" {
+			continue
+		}
+		tested = true
+		t.Run(couch.name, func(t *testing.T) {
+			couchRoot := serverRoot(t, couchDSN)
+			for _, field := range replicationRootFields {
+				expected, ok := couchRoot[field]
+				if !ok {
+					continue
+				}
+				if got, want := jsonKind(kivikRoot[field]), jsonKind(expected); got != want {
+					t.Errorf("%s: kivik server reports %s, %s reports %s", field, got, couch.name, want)
+				}
+			}
+		})
+	}
+	if !tested {
+		t.Skip("Neither KIVIK_TEST_DSN_COUCH16 nor KIVIK_TEST_DSN_COUCH20 is set")
+	}
+}
+
+func serverRoot(t *testing.T, dsn string) map[string]interface{} {
+	client, err := kivik.New(context.Background(), "couch", dsn)
+	if err != nil {
+		t.Fatalf("Failed to connect to %s: %s", dsn, err)
+	}
+	version, err := client.Version(context.Background())
+	if err != nil {
+		t.Fatalf("Failed to fetch server root: %s", err)
+	}
+	var root map[string]interface{}
+	if err := json.Unmarshal(version.RawResponse, &root); err != nil {
+		t.Fatalf("Failed to decode server root: %s", err)
+	}
+	return root
+}
+
+func jsonKind(v interface{}) string {
+	switch v.(type) {
+	case nil:
+		return "nothing"
+	case map[string]interface{}:
+		return "an object"
+	case []interface{}:
+		return "an array"
+	default:
+		return fmt.Sprintf("a %T", v)
+	}
+}
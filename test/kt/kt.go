@@ -30,6 +30,8 @@ type Context struct {
 	Config SuiteConfig
 	// T is the *testing.T value
 	T *testing.T
+	// Recorder, if set, records the result of each test.
+	Recorder *Recorder
 }
 
 // Child returns a shallow copy of itself with a new t.
@@ -42,6 +44,7 @@ func (c *Context) Child(t *testing.T) *Context {
 		CHTTPNoAuth: c.CHTTPNoAuth,
 		Config:      c.Config,
 		T:           t,
+		Recorder:    c.Recorder,
 	}
 }
 
@@ -157,6 +160,9 @@ func (c *Context) IsSet(key string) bool {
 func (c *Context) Run(name string, fn testFunc) {
 	c.T.Run(name, func(t *testing.T) {
 		ctx := c.Child(t)
+		if ctx.Recorder != nil {
+			defer ctx.Recorder.record(t)
+		}
 		ctx.Skip()
 		fn(ctx)
 	})
@@ -0,0 +1,124 @@
+package kt
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/flimzy/kivik"
+)
+
+// Manifest declares the features supported by the driver or server under
+// test. The tests of each unsupported feature are skipped, as if by a ".skip"
+// key in the suite config, so that suite configs need only describe how the
+// supported features behave.
+type Manifest struct {
+	// Docs is true if single documents may be read and written, with Get,
+	// Put, CreateDoc, Delete and Rev.
+	Docs bool
+	// AllDocs is true if AllDocs is supported.
+	AllDocs bool
+	// BulkDocs is true if BulkDocs is supported.
+	BulkDocs bool
+	// Copy is true if Copy is supported.
+	Copy bool
+	// Attachments is true if attachments may be read and written.
+	Attachments bool
+	// Changes is true if changes feeds are supported.
+	Changes bool
+	// Views is true if views may be queried, and their indexes cleaned up.
+	Views bool
+	// Mango is true if Mango queries and indexes are supported.
+	Mango bool
+	// Security is true if security objects may be read and written.
+	Security bool
+	// Stats is true if database stats are reported.
+	Stats bool
+	// Compact is true if databases may be compacted.
+	Compact bool
+	// Flush is true if databases may be flushed.
+	Flush bool
+	// Replication is true if the client may perform replications.
+	Replication bool
+	// Auth is true if sessions may be created and read.
+	Auth bool
+}
+
+// manifestTests maps each feature of a Manifest to the tests which depend on
+// it.
+var manifestTests = []struct {
+	supported func(Manifest) bool
+	tests     []string
+}{
+	{func(m Manifest) bool { return m.Docs }, []string{"Get", "Put", "CreateDoc", "Delete", "Rev"}},
+	{func(m Manifest) bool { return m.AllDocs }, []string{"AllDocs"}},
+	{func(m Manifest) bool { return m.BulkDocs }, []string{"BulkDocs"}},
+	{func(m Manifest) bool { return m.Copy }, []string{"Copy"}},
+	{func(m Manifest) bool { return m.Attachments }, []string{"GetAttachment", "GetAttachmentMeta", "PutAttachment", "DeleteAttachment", "AttachmentRoundTrip"}},
+	{func(m Manifest) bool { return m.Changes }, []string{"Changes", "ChangesFeed"}},
+	{func(m Manifest) bool { return m.Views }, []string{"Query", "ViewCleanup"}},
+	{func(m Manifest) bool { return m.Mango }, []string{"Find", "CreateIndex", "GetIndexes", "DeleteIndex", "Mango"}},
+	{func(m Manifest) bool { return m.Security }, []string{"Security", "SetSecurity"}},
+	{func(m Manifest) bool { return m.Stats }, []string{"Stats"}},
+	{func(m Manifest) bool { return m.Compact }, []string{"Compact"}},
+	{func(m Manifest) bool { return m.Flush }, []string{"Flush"}},
+	{func(m Manifest) bool { return m.Replication }, []string{"GetReplications", "Replicate"}},
+	{func(m Manifest) bool { return m.Auth }, []string{"Session"}},
+}
+
+// Skips returns the names of the tests skipped by the manifest, in order.
+func (m Manifest) Skips() []string {
+	var skips []string
+	for _, feature := range manifestTests {
+		if !feature.supported(m) {
+			skips = append(skips, feature.tests...)
+		}
+	}
+	sort.Strings(skips)
+	return skips
+}
+
+// Apply returns a copy of conf, with the tests of the unsupported features
+// skipped. A ".skip" key already set in conf takes precedence.
+func (m Manifest) Apply(conf SuiteConfig) SuiteConfig {
+	result := make(SuiteConfig, len(conf))
+	for k, v := range conf {
+		result[k] = v
+	}
+	for _, test := range m.Skips() {
+		if _, ok := result[test+".skip"]; !ok {
+			result[test+".skip"] = true
+		}
+	}
+	return result
+}
+
+// Check returns an error if the manifest disagrees with the optional
+// interfaces implemented by the driver, as reported by Client.Capabilities
+// for a database, for the features which require one.
+func (m Manifest) Check(caps kivik.Capabilities) error {
+	var problems []string
+	for _, feature := range []struct {
+		name, iface string
+		supported   bool
+	}{
+		{"Mango", "Finder", m.Mango},
+		{"Flush", "DBFlusher", m.Flush},
+		{"Replication", "ClientReplicator", m.Replication},
+	} {
+		if feature.supported != caps[feature.iface] {
+			problems = append(problems, fmt.Sprintf("%s is %t, but %s is %s", feature.name, feature.supported, feature.iface, implemented(caps[feature.iface])))
+		}
+	}
+	if len(problems) > 0 {
+		return fmt.Errorf("manifest does not match driver: %s", strings.Join(problems, "; "))
+	}
+	return nil
+}
+
+func implemented(ok bool) string {
+	if ok {
+		return "implemented"
+	}
+	return "not implemented"
+}
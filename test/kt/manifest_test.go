@@ -0,0 +1,45 @@
+package kt
+
+import (
+	"testing"
+
+	"github.com/flimzy/diff"
+	"github.com/flimzy/kivik"
+)
+
+func TestManifestApply(t *testing.T) {
+	m := Manifest{Docs: true, AllDocs: true, BulkDocs: true, Copy: true, Attachments: true,
+		Changes: true, Views: true, Security: true, Stats: true, Compact: true, Flush: true, Auth: true}
+	conf := SuiteConfig{
+		"Find.skip":       false,
+		"Version.version": "1.6.1",
+	}
+	expected := SuiteConfig{
+		"Find.skip":            false,
+		"Version.version":      "1.6.1",
+		"CreateIndex.skip":     true,
+		"DeleteIndex.skip":     true,
+		"GetIndexes.skip":      true,
+		"Mango.skip":           true,
+		"GetReplications.skip": true,
+		"Replicate.skip":       true,
+	}
+	if d := diff.Interface(expected, m.Apply(conf)); d != "" {
+		t.Error(d)
+	}
+	if _, ok := conf["Mango.skip"]; ok {
+		t.Error("Apply modified its argument")
+	}
+}
+
+func TestManifestCheck(t *testing.T) {
+	caps := kivik.Capabilities{"Finder": true, "DBFlusher": false}
+	if err := (Manifest{Mango: true}).Check(caps); err != nil {
+		t.Errorf("Unexpected error: %s", err)
+	}
+	expected := "manifest does not match driver: Mango is false, but Finder is implemented; Flush is true, but DBFlusher is not implemented"
+	err := (Manifest{Flush: true}).Check(caps)
+	if err == nil || err.Error() != expected {
+		t.Errorf("Unexpected error: %v", err)
+	}
+}
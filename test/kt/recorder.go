@@ -0,0 +1,56 @@
+package kt
+
+import (
+	"sort"
+	"sync"
+	"testing"
+)
+
+// Test result statuses.
+const (
+	StatusPass = "pass"
+	StatusFail = "fail"
+	StatusSkip = "skip"
+)
+
+// Result is the outcome of a single test.
+type Result struct {
+	Name   string `json:"name"`
+	Status string `json:"status"`
+}
+
+// Recorder collects the results of the tests run through a Context. The zero
+// value is ready to use.
+type Recorder struct {
+	mu      sync.Mutex
+	results []Result
+}
+
+func (r *Recorder) record(t *testing.T) {
+	status := StatusPass
+	switch {
+	case t.Failed():
+		status = StatusFail
+	case t.Skipped():
+		status = StatusSkip
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.results = append(r.results, Result{Name: name(t), Status: status})
+}
+
+type resultList []Result
+
+func (l resultList) Len() int           { return len(l) }
+func (l resultList) Less(i, j int) bool { return l[i].Name < l[j].Name }
+func (l resultList) Swap(i, j int)      { l[i], l[j] = l[j], l[i] }
+
+// Results returns the recorded results, sorted by test name.
+func (r *Recorder) Results() []Result {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	results := make([]Result, len(r.results))
+	copy(results, r.results)
+	sort.Sort(resultList(results))
+	return results
+}
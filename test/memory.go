@@ -5,18 +5,21 @@ import (
 	"github.com/flimzy/kivik/test/kt"
 )
 
-func init() {
-	RegisterSuite(SuiteKivikMemory, kt.SuiteConfig{
-		// Unsupported features
-		"Flush.skip": true,
+// memoryManifest declares the features of the memory driver.
+var memoryManifest = kt.Manifest{
+	Docs:        true,
+	Attachments: true,
+	Security:    true,
+	Flush:       true,
+}
 
-		"AllDBs.expected": []string{"_users"},
+func init() {
+	RegisterSuite(SuiteKivikMemory, memoryManifest.Apply(kt.SuiteConfig{
+		"AllDBs.expected": []string{"_replicator", "_users"},
 
 		"CreateDB/RW/NoAuth.status":         kivik.StatusUnauthorized,
 		"CreateDB/RW/Admin/Recreate.status": kivik.StatusPreconditionFailed,
 
-		"AllDocs.skip": true, // FIXME: Unimplemented
-
 		"DBExists/Admin.databases":       []string{"chicken"},
 		"DBExists/Admin/chicken.exists":  false,
 		"DBExists/RW/group/Admin.exists": true,
@@ -30,10 +33,6 @@ func init() {
 		"Version.vendor":         `^Kivik Memory Adaptor$`,
 		"Version.vendor_version": `^0\.0\.1$`,
 
-		// Replications not to be implemented
-		"GetReplications.skip": true,
-		"Replicate.skip":       true,
-
 		"Get/RW/group/Admin/bogus.status": kivik.StatusNotFound,
 
 		"Rev/RW/group/Admin/bogus.status": kivik.StatusNotFound,
@@ -49,24 +48,22 @@ func init() {
 		"Security/Admin/chicken.status": kivik.StatusNotFound,
 		"Security/Admin/_duck.status":   kivik.StatusNotFound,
 
-		"SetSecurity/RW/Admin/NotExists.status": kivik.StatusNotFound,
-
-		"Stats.skip":             true,                       // FIXME: Unimplemented
-		"Compact.skip":           true,                       // FIXME: Unimplemented
-		"DBUpdates.status":       kivik.StatusNotImplemented, // FIXME: Unimplemented
-		"Changes.skip":           true,                       // FIXME: Unimplemented
-		"Copy.skip":              true,                       // FIXME: Unimplemented, depends on Get/Put or Copy
-		"BulkDocs.skip":          true,                       // FIXME: Unimplemented
-		"GetAttachment.skip":     true,                       // FIXME: Unimplemented
-		"GetAttachmentMeta.skip": true,                       // FIXME: Unimplemented
-		"PutAttachment.skip":     true,                       // FIXME: Unimplemented
-		"DeleteAttachment.skip":  true,                       // FIXME: Unimplemented
-		"Query.skip":             true,                       // FIXME: Unimplemented
-		"Find.skip":              true,                       // FIXME: Unimplemented
-		"CreateIndex.skip":       true,                       // FIXME: Unimplemented
-		"GetIndexes.skip":        true,                       // FIXME: Unimplemented
-		"DeleteIndex.skip":       true,                       // FIXME: Unimplemented
-		"SetSecurity.skip":       true,                       // FIXME: Unimplemented
-		"ViewCleanup.skip":       true,                       // FIXME: Unimplemented
-	})
+		"SetSecurity/RW/Admin/NotExists.skip": true, // DB fails for missing databases, before SetSecurity
+
+		"Flush.databases":            []string{"chicken"},
+		"Flush/Admin/chicken.status": kivik.StatusNotFound,
+
+		"GetAttachment/RW/group/Admin/foo/NotFound.status":     kivik.StatusNotFound,
+		"GetAttachmentMeta/RW/group/Admin/foo/NotFound.status": kivik.StatusNotFound,
+		"PutAttachment/RW/group/Admin/Conflict.status":         kivik.StatusConflict,
+		"DeleteAttachment/RW/group/Admin/NotFound.status":      kivik.StatusNotFound,
+		"DeleteAttachment/RW/group/Admin/NoDoc.status":         kivik.StatusNotFound,
+
+		"DBUpdates.status": kivik.StatusNotImplemented, // FIXME: Unimplemented
+
+		"Concurrency/RW/Admin/ChangesConsumers.skip": true, // FIXME: Counts the documents with AllDocs, which is unimplemented
+
+		"IteratorCancel/RW/Admin/AllDocs.status": kivik.StatusNotImplemented, // FIXME: Unimplemented
+		"IteratorCancel/RW/Admin/Changes.feed":   "normal",
+	}))
 }
@@ -19,8 +19,21 @@ func TestMemory(t *testing.T) {
 		RW:    true,
 		Admin: client,
 	}
-	if err := client.CreateDB(context.Background(), "_users"); err != nil {
-		t.Fatal(err)
-	}
+	checkManifest(t, clients, memoryManifest)
 	runTests(clients, SuiteKivikMemory, t)
 }
+
+// checkManifest verifies that the manifest of a suite matches the
+// capabilities of the driver under test.
+func checkManifest(t *testing.T, ctx *kt.Context, manifest kt.Manifest) {
+	t.Run("Manifest", func(t *testing.T) {
+		ctx.T = t
+		caps, err := suiteCapabilities(ctx)
+		if err != nil {
+			t.Fatalf("Failed to detect driver capabilities: %s", err)
+		}
+		if err := manifest.Check(caps); err != nil {
+			t.Error(err)
+		}
+	})
+}
@@ -4,19 +4,20 @@ package test
 
 import (
 	"context"
+	"io/ioutil"
+	"os"
 	"testing"
 
-	"github.com/gopherjs/gopherjs/js"
-
 	"github.com/flimzy/kivik"
 	_ "github.com/flimzy/kivik/driver/pouchdb"
 	"github.com/flimzy/kivik/driver/pouchdb/bindings"
+	"github.com/flimzy/kivik/driver/pouchdb/jsval"
 	"github.com/flimzy/kivik/test/kt"
 )
 
 func init() {
 	bindings.GlobalPouchDB().Call("defaults", map[string]interface{}{
-		"db": js.Global.Call("require", "memdown"),
+		"db": jsval.Global().Call("require", "memdown"),
 	})
 }
 
@@ -33,6 +34,55 @@ func TestPouchLocal(t *testing.T) {
 	runTests(clients, SuitePouchLocal, t)
 }
 
+// TestPouchNode runs the local tests in Node.js, with databases stored in a
+// temporary directory by the leveldb adapter.
+func TestPouchNode(t *testing.T) {
+	if !bindings.IsNode() {
+		t.Skip("Not running in Node.js; skipping tests")
+	}
+	dir, err := ioutil.TempDir("", "kivik-pouchdb")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	client, err := kivik.New(context.Background(), "pouch", "leveldb:"+dir+"/")
+	if err != nil {
+		t.Skipf("leveldb adapter not available; skipping tests: %s", err)
+	}
+	clients := &kt.Context{
+		RW:    true,
+		Admin: client,
+	}
+	runTests(clients, SuitePouchNode, t)
+}
+
 func TestPouchRemote(t *testing.T) {
 	doTest(SuitePouchRemote, "KIVIK_TEST_DSN_COUCH20", t)
 }
+
+func TestReplicationInterop(t *testing.T) {
+	local, err := kivik.New(context.Background(), "pouch", "")
+	if err != nil {
+		t.Fatalf("Failed to connect to PouchDB driver: %s", err)
+	}
+	backends := []*InteropBackend{
+		{
+			Name:       "pouch",
+			Client:     local,
+			Replicator: true,
+		},
+	}
+	if dsn := os.Getenv("KIVIK_TEST_DSN_COUCH20"); dsn != "" {
+		remote, err := kivik.New(context.Background(), "pouch", dsn)
+		if err != nil {
+			t.Fatalf("Failed to connect to couch20: %s", err)
+		}
+		backends = append(backends, &InteropBackend{
+			Name:       "couch20",
+			Client:     remote,
+			Prefix:     dsn,
+			Replicator: true,
+		})
+	}
+	RunInteropTests(backends, t)
+}
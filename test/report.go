@@ -0,0 +1,147 @@
+package test
+
+import (
+	"context"
+	"encoding/json"
+	"html/template"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/flimzy/kivik"
+	"github.com/flimzy/kivik/test/kt"
+)
+
+// reportDir is the directory to which conformance reports are written. If
+// empty, no reports are written. It defaults to the value of the
+// KIVIK_TEST_REPORT environment variable.
+var reportDir = os.Getenv("KIVIK_TEST_REPORT")
+
+// Report is a conformance report for a single test suite run.
+type Report struct {
+	Suite     string    `json:"suite"`
+	Driver    string    `json:"driver"`
+	Generated time.Time `json:"generated"`
+	// Capabilities lists the optional driver interfaces, and whether they are
+	// implemented.
+	Capabilities kivik.Capabilities `json:"capabilities"`
+	Summary      ReportSummary      `json:"summary"`
+	Results      []kt.Result        `json:"results"`
+}
+
+// ReportSummary counts the tests in a report, by status.
+type ReportSummary struct {
+	Pass int `json:"pass"`
+	Fail int `json:"fail"`
+	Skip int `json:"skip"`
+}
+
+// NewReport builds a report from the results collected by rec.
+func NewReport(suite string, client *kivik.Client, caps kivik.Capabilities, rec *kt.Recorder) *Report {
+	r := &Report{
+		Suite:        suite,
+		Driver:       client.Driver(),
+		Generated:    time.Now().UTC(),
+		Capabilities: caps,
+		Results:      rec.Results(),
+	}
+	for _, result := range r.Results {
+		switch result.Status {
+		case kt.StatusPass:
+			r.Summary.Pass++
+		case kt.StatusFail:
+			r.Summary.Fail++
+		case kt.StatusSkip:
+			r.Summary.Skip++
+		}
+	}
+	return r
+}
+
+// WriteJSON writes the report to w as JSON.
+func (r *Report) WriteJSON(w io.Writer) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(r)
+}
+
+var reportTmpl = template.Must(template.New("report").Funcs(template.FuncMap{
+	"depth": func(name string) int { return strings.Count(name, "/") },
+}).Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>Kivik conformance: {{ .Suite }}</title>
+<style>
+body { font-family: sans-serif; }
+table { border-collapse: collapse; margin-bottom: 2em; }
+td, th { border: 1px solid #ccc; padding: 2px 8px; text-align: left; }
+.pass, .true { background: #cfc; }
+.fail { background: #fcc; }
+.skip, .false { background: #eee; }
+</style>
+</head>
+<body>
+<h1>Kivik conformance: {{ .Suite }} ({{ .Driver }} driver)</h1>
+<p>Generated {{ .Generated.Format "2006-01-02 15:04:05 MST" }}.
+{{ .Summary.Pass }} passed, {{ .Summary.Fail }} failed, {{ .Summary.Skip }} skipped.</p>
+<h2>Optional interfaces</h2>
+<table>
+<tr><th>Interface</th><th>Implemented</th></tr>
+{{- range $name, $ok := .Capabilities }}
+<tr><td>{{ $name }}</td><td class="{{ $ok }}">{{ if $ok }}yes{{ else }}no{{ end }}</td></tr>
+{{- end }}
+</table>
+<h2>Tests</h2>
+<table>
+<tr><th>Test</th><th>Status</th></tr>
+{{- range .Results }}
+<tr><td style="padding-left: {{ depth .Name }}em">{{ .Name }}</td><td class="{{ .Status }}">{{ .Status }}</td></tr>
+{{- end }}
+</table>
+</body>
+</html>
+`))
+
+// WriteHTML writes the report to w as an HTML document.
+func (r *Report) WriteHTML(w io.Writer) error {
+	return reportTmpl.Execute(w, r)
+}
+
+// writeReport writes the JSON and HTML versions of the report to dir.
+func writeReport(dir string, r *Report) error {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+	for ext, write := range map[string]func(io.Writer) error{
+		".json": r.WriteJSON,
+		".html": r.WriteHTML,
+	} {
+		f, err := os.Create(filepath.Join(dir, r.Suite+ext))
+		if err != nil {
+			return err
+		}
+		if err := write(f); err != nil {
+			_ = f.Close()
+			return err
+		}
+		if err := f.Close(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// suiteCapabilities returns the capabilities of the client's driver. For
+// read-write runs, a temporary database is created to inspect database-level
+// interfaces.
+func suiteCapabilities(ctx *kt.Context) (kivik.Capabilities, error) {
+	dbName := ctx.TestDBName()
+	if !ctx.RW || ctx.Admin.CreateDB(context.Background(), dbName) != nil {
+		return ctx.Admin.Capabilities(context.Background(), "")
+	}
+	defer ctx.Admin.DestroyDB(context.Background(), dbName)
+	return ctx.Admin.Capabilities(context.Background(), dbName)
+}
@@ -0,0 +1,56 @@
+package test
+
+import (
+	"bytes"
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/flimzy/diff"
+	"github.com/flimzy/kivik"
+	_ "github.com/flimzy/kivik/driver/memory"
+	"github.com/flimzy/kivik/test/kt"
+)
+
+func TestReport(t *testing.T) {
+	client, err := kivik.New(context.Background(), "memory", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	rec := &kt.Recorder{}
+	ctx := &kt.Context{T: t, Recorder: rec, Config: kt.SuiteConfig{"Skipped.skip": true}}
+	ctx.Run("Passed", func(_ *kt.Context) {})
+	ctx.Run("Skipped", func(_ *kt.Context) {})
+	r := NewReport("test", client, kivik.Capabilities{"Finder": false}, rec)
+	r.Generated = time.Date(2017, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	buf := &bytes.Buffer{}
+	if err := r.WriteJSON(buf); err != nil {
+		t.Fatal(err)
+	}
+	expected := `{
+		"suite": "test",
+		"driver": "memory",
+		"generated": "2017-01-01T00:00:00Z",
+		"capabilities": {"Finder": false},
+		"summary": {"pass": 1, "fail": 0, "skip": 1},
+		"results": [
+			{"name": "Passed", "status": "pass"},
+			{"name": "Skipped", "status": "skip"}
+		]
+	}`
+	if d := diff.JSON([]byte(expected), buf.Bytes()); d != "" {
+		t.Error(d)
+	}
+
+	buf.Reset()
+	if err := r.WriteHTML(buf); err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{`<td class="pass">pass</td>`, `<td class="skip">skip</td>`, `<td class="false">no</td>`} {
+		if !strings.Contains(buf.String(), want) {
+			t.Errorf("HTML report does not contain %s", want)
+		}
+	}
+}
@@ -7,48 +7,83 @@ import (
 	"github.com/flimzy/kivik/test/kt"
 )
 
+// serverManifest declares the features of the kivik server.
+var serverManifest = kt.Manifest{
+	AllDocs:     true,
+	Attachments: true,
+	Flush:       true,
+	Auth:        true,
+	// FIXME: Update as the server implements document reads and writes,
+	// security, stats, compaction, changes feeds, views, Mango queries and
+	// replications.
+}
+
 func init() {
-	RegisterSuite(SuiteKivikServer, kt.SuiteConfig{
-		"AllDBs.expected": []string{},
-		"AllDBs/RW.skip":  true, // FIXME: Enable this when it's possible to delete DB from the server
+	RegisterSuite(SuiteKivikServer, serverManifest.Apply(kt.SuiteConfig{
+		"AllDBs.expected": []string{"_replicator", "_users"},
 
-		"CreateDB/RW.skip": true, // FIXME: Update when the server can destroy databases
-		// "CreateDB/NoAuth.status":         http.StatusUnauthorized,
-		// "CreateDB/Admin/Recreate.status": http.StatusPreconditionFailed,
+		"CreateDB/RW/Admin/Recreate.status":  kivik.StatusPreconditionFailed,
+		"CreateDB/RW/NoAuth/Recreate.status": kivik.StatusPreconditionFailed,
 
-		"DestroyDB.skip": true, // FIXME: Update when the server can destroy databases
+		"DestroyDB/RW/NoAuth.status":              kivik.StatusUnauthorized,
+		"DestroyDB/RW/Admin/NonExistantDB.status": kivik.StatusNotFound,
 
 		"AllDocs/Admin.databases":   []string{"foo"},
 		"AllDocs/Admin/foo.status":  http.StatusNotFound,
-		"AllDocs/RW.skip":           true, // FIXME: Update when the server can destroy databases
 		"AllDocs/NoAuth.databases":  []string{"foo"},
 		"AllDocs/NoAuth/foo.status": http.StatusNotFound,
-
-		"DBExists.databases":            []string{"chicken"},
-		"DBExists/Admin/chicken.exists": false,
-		"DBExists/RW.skip":              true, // FIXME: Update when the server can destroy databases
-		// "DBExists/RW/Admin.exists":      true,
-		"DBExists/NoAuth.skip": true, // TODO
+		"AllDocs/RW.skip":           true, // FIXME: Update when the server handles escaped document IDs
+
+		"GetAttachment/RW/group/Admin/foo/NotFound.status":      kivik.StatusNotFound,
+		"GetAttachment/RW/group/NoAuth/foo/NotFound.status":     kivik.StatusNotFound,
+		"GetAttachmentMeta/RW/group/Admin/foo/NotFound.status":  kivik.StatusNotFound,
+		"GetAttachmentMeta/RW/group/NoAuth/foo/NotFound.status": kivik.StatusNotFound,
+
+		"PutAttachment/RW/group/Admin/Update.skip":           true, // FIXME: Update when the server handles POST /{db}
+		"PutAttachment/RW/group/Admin/Conflict.skip":         true, // FIXME: Update when the server handles POST /{db}
+		"PutAttachment/RW/group/Admin/UpdateDesignDoc.skip":  true, // FIXME: Update when the server handles escaped document IDs
+		"PutAttachment/RW/group/NoAuth/Update.skip":          true, // FIXME: Update when the server handles POST /{db}
+		"PutAttachment/RW/group/NoAuth/Conflict.skip":        true, // FIXME: Update when the server handles POST /{db}
+		"PutAttachment/RW/group/NoAuth/UpdateDesignDoc.skip": true, // FIXME: Update when the server handles escaped document IDs
+
+		"DeleteAttachment/RW/group/Admin/NoDoc.status":    kivik.StatusNotFound,
+		"DeleteAttachment/RW/group/NoAuth/NoDoc.status":   kivik.StatusNotFound,
+		"DeleteAttachment/RW/group/Admin/foo.txt.skip":    true, // FIXME: Update when the server handles escaped document IDs
+		"DeleteAttachment/RW/group/Admin/NotFound.skip":   true, // FIXME: Update when the server handles escaped document IDs
+		"DeleteAttachment/RW/group/Admin/DesignDoc.skip":  true, // FIXME: Update when the server handles escaped document IDs
+		"DeleteAttachment/RW/group/NoAuth/foo.txt.skip":   true, // FIXME: Update when the server handles escaped document IDs
+		"DeleteAttachment/RW/group/NoAuth/NotFound.skip":  true, // FIXME: Update when the server handles escaped document IDs
+		"DeleteAttachment/RW/group/NoAuth/DesignDoc.skip": true, // FIXME: Update when the server handles escaped document IDs
+
+		"DBExists.databases":              []string{"chicken"},
+		"DBExists/Admin/chicken.exists":   false,
+		"DBExists/RW/group/Admin.exists":  true,
+		"DBExists/RW/group/NoAuth.exists": true,
+		"DBExists/NoAuth.skip":            true, // TODO
+
+		"ErrorFormat/Admin/MissingDB.status":     kivik.StatusResourceNotAllowed, // FIXME: Update when the server handles GET /{db}
+		"ErrorFormat/Admin/MissingDB.error":      "method_not_allowed",
+		"ErrorFormat/Admin/MissingDoc.status":    kivik.StatusNotFound,
+		"ErrorFormat/Admin/MissingDoc.error":     "not_found",
+		"ErrorFormat/Admin/MissingDoc.reason":    "missing",
+		"ErrorFormat/Admin/InvalidDBName.status": kivik.StatusBadRequest,
+		"ErrorFormat/Admin/InvalidDBName.error":  "illegal_database_name",
+		"ErrorFormat/NoAuth/DestroyDB.status":    kivik.StatusUnauthorized,
+		"ErrorFormat/NoAuth/DestroyDB.error":     "unauthorized",
 
 		"Log/Admin/Offset-1000.status":        http.StatusBadRequest,
 		"Log/Admin/HTTP/TextBytes.status":     http.StatusBadRequest,
 		"Log/Admin/HTTP/NegativeBytes.status": http.StatusBadRequest,
 		"Log/NoAuth/Offset-1000.status":       http.StatusBadRequest,
 
-		"Version.version":        `^0\.0\.0$`,
+		"Version.version":        `^1\.6\.1$`,
 		"Version.vendor":         "Kivik",
 		"Version.vendor_version": `^0\.0\.1$`,
 
-		"Get.skip": true, // FIXME: Fix this when we can delete database
-
-		"Put.skip": true, // FIXME: Fix this when we can write docs
-
 		"Flush.databases":                     []string{"chicken"},
 		"Flush/Admin/chicken/DoFlush.status":  kivik.StatusNotFound, // FIXME: Update when implemented
 		"Flush/NoAuth/chicken/DoFlush.status": kivik.StatusNotFound, // FIXME: Update when implemented
 
-		"Delete.skip": true, // FIXME: Fix this when we can delete docs.
-
 		"Session/Get/Admin.info.authentication_handlers":  "default,cookie",
 		"Session/Get/Admin.info.authentication_db":        "",
 		"Session/Get/Admin.info.authenticated":            "cookie",
@@ -79,27 +114,9 @@ func init() {
 		"Session/Post/GoodCredsJSONRedirEmpty.status":                 kivik.StatusBadRequest,
 		"Session/Post/GoodCredsJSONRedirSchemaless.status":            kivik.StatusBadRequest,
 
-		"Stats.skip":             true, // FIXME: Unimplemented
-		"CreateDoc.skip":         true, // FIXME: Unimplemented
-		"Compact.skip":           true, // FIXME: Unimplemented
-		"ViewCleanup.skip":       true, // FIXME: Unimplemented
-		"Security.skip":          true, // FIXME: Unimplemented
-		"SetSecurity.skip":       true, // FIXME: Unimplemented
-		"Rev.skip":               true, // FIXME: When Get works
-		"DBUpdates.skip":         true, // FIXME: Unimplemented
-		"Changes.skip":           true, // FIXME: Unimplemented
-		"Copy.skip":              true, // FIXME: Unimplemented, depends on Get/Put or Copy
-		"BulkDocs.skip":          true, // FIXME: Unimplemented
-		"GetAttachment.skip":     true, // FIXME: Unimplemented
-		"GetAttachmentMeta.skip": true, // FIXME: Unimplemented
-		"PutAttachment.skip":     true, // FIXME: Unimplemented
-		"DeleteAttachment.skip":  true, // FIXME: Unimplemented
-		"Query.skip":             true, // FIXME: Unimplemented
-		"Find.skip":              true, // FIXME: Unimplemented
-		"CreateIndex.skip":       true, // FIXME: Unimplemented
-		"GetIndexes.skip":        true, // FIXME: Unimplemented
-		"DeleteIndex.skip":       true, // FIXME: Unimplemented
-		"GetReplications.skip":   true, // FIXME: Unimplemented
-		"Replicate.skip":         true, // FIXME: Unimplemented
-	})
+		"DBUpdates.skip": true, // FIXME: Unimplemented
+
+		"Concurrency.skip":    true, // FIXME: Update when the server handles escaped document IDs
+		"IteratorCancel.skip": true, // FIXME: Unimplemented
+	}))
 }
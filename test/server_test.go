@@ -20,17 +20,26 @@ import (
 	"github.com/spf13/viper"
 )
 
-type customDriver struct {
-	driver.Client
+func init() {
+	kivik.Register("custom", customDriver{})
 }
 
-func (cd customDriver) NewClient(_ context.Context, _ string) (driver.Client, error) {
-	return cd, nil
+// customDriver serves a new memory backend for each client, through the proxy
+// driver.
+type customDriver struct{}
+
+func (cd customDriver) NewClient(ctx context.Context, _ string) (driver.Client, error) {
+	memClient, err := kivik.New(ctx, "memory", "")
+	if err != nil {
+		return nil, err
+	}
+	return proxy.NewClient(memClient), nil
 }
 
-func TestServer(t *testing.T) {
-	memClient, _ := kivik.New(context.Background(), "memory", "")
-	kivik.Register("custom", customDriver{proxy.NewClient(memClient)})
+// newKivikServer starts a kivik server backed by the memory driver, and
+// returns a DSN for it with admin/abc123 credentials. The returned function
+// shuts down the server.
+func newKivikServer(t *testing.T) (dsn string, closeFn func()) {
 	backend, err := kivik.New(context.Background(), "custom", "")
 	if err != nil {
 		t.Fatalf("Failed to connect to custom driver: %s", err)
@@ -51,11 +60,16 @@ func TestServer(t *testing.T) {
 		t.Fatalf("Failed to initialize server: %s\n", err)
 	}
 	server := httptest.NewServer(handler)
-	defer server.Close()
 
-	dsn, _ := url.Parse(server.URL)
-	dsn.User = url.UserPassword("admin", "abc123")
-	clients, err := connectClients("couch", dsn.String(), t)
+	parsed, _ := url.Parse(server.URL)
+	parsed.User = url.UserPassword("admin", "abc123")
+	return parsed.String(), server.Close
+}
+
+func TestServer(t *testing.T) {
+	dsn, closeFn := newKivikServer(t)
+	defer closeFn()
+	clients, err := connectClients("couch", dsn, t)
 	if err != nil {
 		t.Fatalf("Failed to initialize client: %s", err)
 	}
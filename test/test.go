@@ -27,6 +27,7 @@ const (
 	SuiteAuto        = "auto"
 	SuitePouchLocal  = "pouch"
 	SuitePouchRemote = "pouchRemote"
+	SuitePouchNode   = "pouchNode"
 	SuiteCouch16     = "couch16"
 	SuiteCouch20     = "couch20"
 	SuiteCloudant    = "cloudant"
@@ -39,6 +40,7 @@ const (
 var AllSuites = []string{
 	SuitePouchLocal,
 	SuitePouchRemote,
+	SuitePouchNode,
 	SuiteCouch16,
 	SuiteCouch20,
 	SuiteKivikMemory,
@@ -50,6 +52,7 @@ var AllSuites = []string{
 var driverMap = map[string]string{
 	SuitePouchLocal:  "pouch",
 	SuitePouchRemote: "pouch",
+	SuitePouchNode:   "pouch",
 	SuiteCouch16:     "couch",
 	SuiteCouch20:     "couch",
 	SuiteCloudant:    "couch",
@@ -75,6 +78,9 @@ type Options struct {
 	Match   string
 	Suites  []string
 	Cleanup bool
+	// Report, if set, is a directory to which a JSON and HTML conformance
+	// report is written for each suite.
+	Report string
 }
 
 // CleanupTests attempts to clean up any stray test databases created by a
@@ -289,6 +295,9 @@ func RunTests(opts Options) {
 		}
 		os.Exit(0)
 	}
+	if opts.Report != "" {
+		reportDir = opts.Report
+	}
 	flag.Set("test.run", opts.Match)
 	if opts.Verbose {
 		flag.Set("test.v", "true")
@@ -338,6 +347,15 @@ func Test(driver, dsn string, testSuites []string, rw bool, t *testing.T) {
 	}
 }
 
+// RunSuite runs the suite with the given configuration against the clients,
+// for drivers which have no suite registered, such as those of third parties.
+// The tests of unsupported features may be skipped by building conf with
+// kt.Manifest.Apply.
+func RunSuite(clients *kt.Context, suite string, conf kt.SuiteConfig, t *testing.T) {
+	RegisterSuite(suite, conf)
+	runTests(clients, suite, t)
+}
+
 func runTests(ctx *kt.Context, suite string, t *testing.T) {
 	ctx.T = t
 	conf, ok := suites[suite]
@@ -345,6 +363,18 @@ func runTests(ctx *kt.Context, suite string, t *testing.T) {
 		ctx.Skipf("No configuration found for suite '%s'", suite)
 	}
 	ctx.Config = conf
+	if reportDir != "" {
+		ctx.Recorder = &kt.Recorder{}
+		defer func() {
+			caps, err := suiteCapabilities(ctx)
+			if err != nil {
+				t.Errorf("Failed to detect driver capabilities: %s", err)
+			}
+			if err := writeReport(reportDir, NewReport(suite, ctx.Admin, caps, ctx.Recorder)); err != nil {
+				t.Errorf("Failed to write conformance report: %s", err)
+			}
+		}()
+	}
 	// This is run as a sub-test so configuration will work nicely.
 	ctx.Run("PreCleanup", func(ctx *kt.Context) {
 		ctx.RunAdmin(func(ctx *kt.Context) {
@@ -0,0 +1,81 @@
+package kivik
+
+import (
+	"context"
+	"io"
+	"time"
+)
+
+// Timeouts are the default timeouts of each class of operation, applied to
+// calls whose context has no deadline, so that callers passing
+// context.Background() do not wait indefinitely. A deadline on the context
+// passed to a call always takes precedence. A zero value means no default
+// timeout, which is the default for every class.
+type Timeouts struct {
+	// Read applies to reads of documents, attachments and database metadata,
+	// such as Get, GetStream, Rev, GetAttachment, Stats and Security, and to
+	// Client.AllDBs and Client.DBExists. For GetStream and GetAttachment, it
+	// applies until the content is closed.
+	Read time.Duration
+	// Write applies to modifications, such as Put, CreateDoc, Delete,
+	// BulkDocs, PutAttachment and SetSecurity, and to Client.CreateDB and
+	// Client.DestroyDB.
+	Write time.Duration
+	// Query applies to AllDocs, Query and Find, until the Rows are closed.
+	Query time.Duration
+	// Changes applies to Changes, until the feed is closed.
+	Changes time.Duration
+}
+
+// SetTimeouts sets the default timeouts of the client's operations, and of
+// those on databases subsequently opened with DB.
+func (c *Client) SetTimeouts(timeouts Timeouts) {
+	c.timeouts = timeouts
+}
+
+// Timeouts returns the default timeouts set with SetTimeouts.
+func (c *Client) Timeouts() Timeouts {
+	return c.timeouts
+}
+
+var noCancel context.CancelFunc = func() {}
+
+// withTimeout returns ctx with a timeout of d, unless d is zero or ctx
+// already has a deadline, in which case ctx is returned unchanged.
+func withTimeout(ctx context.Context, d time.Duration) (context.Context, context.CancelFunc) {
+	if d <= 0 {
+		return ctx, noCancel
+	}
+	if _, ok := ctx.Deadline(); ok {
+		return ctx, noCancel
+	}
+	return context.WithTimeout(ctx, d)
+}
+
+// cancelCloser calls cancel when the wrapped ReadCloser is closed, to release
+// the context of a default timeout with the content read from it.
+type cancelCloser struct {
+	io.ReadCloser
+	cancel context.CancelFunc
+}
+
+func (c *cancelCloser) Close() error {
+	defer c.cancel()
+	return c.ReadCloser.Close()
+}
+
+// releaseOnClose arranges for cancel to be called when the iterator is
+// closed, or immediately if it already is.
+func (i *iter) releaseOnClose(cancel context.CancelFunc) {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	if i.closed {
+		cancel()
+		return
+	}
+	prev := i.cancel
+	i.cancel = func() {
+		prev()
+		cancel()
+	}
+}
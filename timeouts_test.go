@@ -0,0 +1,212 @@
+package kivik
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/flimzy/kivik/driver"
+)
+
+type timeoutsDriver struct {
+	db *timeoutsDB
+}
+
+func (d *timeoutsDriver) NewClient(_ context.Context, _ string) (driver.Client, error) {
+	return &timeoutsClient{db: d.db}, nil
+}
+
+type timeoutsClient struct {
+	driver.Client
+	db *timeoutsDB
+}
+
+func (c *timeoutsClient) DB(_ context.Context, _ string, _ map[string]interface{}) (driver.DB, error) {
+	return c.db, nil
+}
+
+// timeoutsDB records the time remaining before the deadline of the context of
+// each call, or zero if it has none.
+type timeoutsDB struct {
+	driver.DB
+	remaining time.Duration
+	ctx       context.Context
+}
+
+func (db *timeoutsDB) record(ctx context.Context) {
+	db.ctx = ctx
+	db.remaining = 0
+	if deadline, ok := ctx.Deadline(); ok {
+		db.remaining = deadline.Sub(time.Now())
+	}
+}
+
+func (db *timeoutsDB) Get(ctx context.Context, _ string, _ map[string]interface{}) (json.RawMessage, error) {
+	db.record(ctx)
+	return json.RawMessage(`{}`), nil
+}
+
+func (db *timeoutsDB) Put(ctx context.Context, _ string, _ interface{}) (string, error) {
+	db.record(ctx)
+	return "1-xxx", nil
+}
+
+func (db *timeoutsDB) AllDocs(ctx context.Context, _ map[string]interface{}) (driver.Rows, error) {
+	db.record(ctx)
+	return &timeoutsRows{}, nil
+}
+
+func (db *timeoutsDB) GetAttachment(ctx context.Context, _, _, _ string) (string, driver.MD5sum, io.ReadCloser, error) {
+	db.record(ctx)
+	return "text/plain", driver.MD5sum{}, ioutil.NopCloser(strings.NewReader("x")), nil
+}
+
+func (db *timeoutsDB) BulkDocs(ctx context.Context, _ []interface{}) (driver.BulkResults, error) {
+	db.record(ctx)
+	return &timeoutsBulkResults{}, nil
+}
+
+type timeoutsBulkResults struct{}
+
+func (r *timeoutsBulkResults) Next(_ *driver.BulkResult) error { return io.EOF }
+func (r *timeoutsBulkResults) Close() error                    { return nil }
+
+type timeoutsRows struct {
+	driver.Rows
+}
+
+func (r *timeoutsRows) Next(_ *driver.Row) error { return io.EOF }
+func (r *timeoutsRows) Close() error             { return nil }
+
+func TestTimeouts(t *testing.T) {
+	timeouts := Timeouts{Read: time.Minute, Write: 2 * time.Minute, Query: 3 * time.Minute}
+	tests := []struct {
+		name     string
+		timeouts Timeouts
+		ctx      func() (context.Context, context.CancelFunc)
+		call     func(*DB, context.Context) error
+		expected time.Duration
+	}{
+		{
+			name:     "NoTimeouts",
+			call:     func(db *DB, ctx context.Context) error { _, err := db.Get(ctx, "foo"); return err },
+			expected: 0,
+		},
+		{
+			name:     "Read",
+			timeouts: timeouts,
+			call:     func(db *DB, ctx context.Context) error { _, err := db.Get(ctx, "foo"); return err },
+			expected: time.Minute,
+		},
+		{
+			name:     "Write",
+			timeouts: timeouts,
+			call:     func(db *DB, ctx context.Context) error { _, err := db.Put(ctx, "foo", map[string]string{}); return err },
+			expected: 2 * time.Minute,
+		},
+		{
+			name:     "Query",
+			timeouts: timeouts,
+			call: func(db *DB, ctx context.Context) error {
+				rows, err := db.AllDocs(ctx)
+				if err != nil {
+					return err
+				}
+				return rows.Close()
+			},
+			expected: 3 * time.Minute,
+		},
+		{
+			name:     "ContextDeadline",
+			timeouts: timeouts,
+			ctx: func() (context.Context, context.CancelFunc) {
+				return context.WithTimeout(context.Background(), 10*time.Minute)
+			},
+			call:     func(db *DB, ctx context.Context) error { _, err := db.Get(ctx, "foo"); return err },
+			expected: 10 * time.Minute,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			driverDB := &timeoutsDB{}
+			client, err := NewClientFromDriver(context.Background(), &timeoutsDriver{db: driverDB}, "")
+			if err != nil {
+				t.Fatal(err)
+			}
+			client.SetTimeouts(test.timeouts)
+			db, err := client.DB(context.Background(), "foo")
+			if err != nil {
+				t.Fatal(err)
+			}
+			ctx, cancel := context.Background(), context.CancelFunc(func() {})
+			if test.ctx != nil {
+				ctx, cancel = test.ctx()
+			}
+			defer cancel()
+			if err := test.call(db, ctx); err != nil {
+				t.Fatal(err)
+			}
+			if test.expected == 0 {
+				if driverDB.remaining != 0 {
+					t.Errorf("Expected no deadline, got %s remaining", driverDB.remaining)
+				}
+				return
+			}
+			if driverDB.remaining > test.expected || driverDB.remaining < test.expected-time.Second {
+				t.Errorf("Expected a deadline in %s, got %s", test.expected, driverDB.remaining)
+			}
+		})
+	}
+}
+
+func TestTimeoutsStream(t *testing.T) {
+	driverDB := &timeoutsDB{}
+	client, err := NewClientFromDriver(context.Background(), &timeoutsDriver{db: driverDB}, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	client.SetTimeouts(Timeouts{Read: time.Minute})
+	db, err := client.DB(context.Background(), "foo")
+	if err != nil {
+		t.Fatal(err)
+	}
+	att, err := db.GetAttachment(context.Background(), "foo", "", "bar.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := driverDB.ctx.Err(); err != nil {
+		t.Fatalf("Expected the context to remain open until the content is closed, got %s", err)
+	}
+	_ = att.Close()
+	if err := driverDB.ctx.Err(); err != context.Canceled {
+		t.Errorf("Expected the context to be released on close, got %v", err)
+	}
+}
+
+func TestTimeoutsBulkDocs(t *testing.T) {
+	driverDB := &timeoutsDB{}
+	client, err := NewClientFromDriver(context.Background(), &timeoutsDriver{db: driverDB}, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	client.SetTimeouts(Timeouts{Write: time.Minute})
+	db, err := client.DB(context.Background(), "foo")
+	if err != nil {
+		t.Fatal(err)
+	}
+	results, err := db.BulkDocs(context.Background(), []interface{}{map[string]string{"_id": "foo"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := driverDB.ctx.Err(); err != nil {
+		t.Fatalf("Expected the context to remain open until the results are closed, got %s", err)
+	}
+	_ = results.Close()
+	if err := driverDB.ctx.Err(); err != context.Canceled {
+		t.Errorf("Expected the context to be released on close, got %v", err)
+	}
+}
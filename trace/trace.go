@@ -0,0 +1,136 @@
+// Package trace provides distributed tracing for Kivik operations, with
+// adaptors for tracing systems such as OpenTracing or OpenCensus supplied by
+// implementing the Tracer interface.
+//
+// A span is started for each Client and DB operation of a traced driver, as a
+// child of any span in the caller's context, and is tagged with the database
+// name and document ID. Drivers which make HTTP requests, such as the CouchDB
+// driver, call Inject to propagate the span to the server.
+//
+//	trace.Register("couch-traced", "couch", myTracer)
+//	client, err := kivik.New(context.TODO(), "couch-traced", "http://localhost:5984/")
+package trace
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+
+	"github.com/flimzy/kivik/instrument"
+)
+
+// Span tags set by Kivik. These follow the OpenTracing semantic conventions
+// where applicable.
+const (
+	TagComponent   = "component"
+	TagError       = "error"
+	TagDriver      = "kivik.driver"
+	TagDBInstance  = "db.instance"
+	TagDocID       = "kivik.doc_id"
+	TagHTTPMethod  = "http.method"
+	TagHTTPURL     = "http.url"
+	TagPeerAddress = "peer.address"
+)
+
+// Span is a single traced operation.
+type Span interface {
+	// SetTag sets a tag on the span.
+	SetTag(key string, value interface{})
+	// Finish completes the span.
+	Finish()
+}
+
+// Tracer is an adaptor for a tracing system.
+type Tracer interface {
+	// StartSpan starts a new span, as a child of any span in ctx, and returns
+	// a derived context containing the new span.
+	StartSpan(ctx context.Context, operationName string) (context.Context, Span)
+	// Inject adds the headers necessary to propagate the span in ctx, if any,
+	// to header.
+	Inject(ctx context.Context, header http.Header)
+}
+
+type contextKey struct{ name string }
+
+var (
+	tracerKey = &contextKey{"tracer"}
+	spanKey   = &contextKey{"span"}
+)
+
+// NewSink returns an instrument.Sink which starts a span with tracer for each
+// operation, named "kivik." followed by the operation name, such as
+// "kivik.Get". The tracer is stored in the context passed to the underlying
+// driver, for use by Inject.
+func NewSink(tracer Tracer) instrument.Sink {
+	return &sink{tracer: tracer}
+}
+
+type sink struct {
+	tracer Tracer
+}
+
+var _ instrument.Starter = &sink{}
+
+func (s *sink) Start(ctx context.Context, e instrument.Event) context.Context {
+	ctx, span := s.tracer.StartSpan(ctx, "kivik."+e.Op)
+	span.SetTag(TagComponent, "kivik")
+	span.SetTag(TagDriver, e.Driver)
+	if e.DB != "" {
+		span.SetTag(TagDBInstance, e.DB)
+	}
+	if e.DocID != "" {
+		span.SetTag(TagDocID, e.DocID)
+	}
+	ctx = context.WithValue(ctx, tracerKey, s.tracer)
+	return context.WithValue(ctx, spanKey, span)
+}
+
+func (s *sink) Record(e instrument.Event) {
+	span, ok := spanFromContext(e.Context)
+	if !ok {
+		return
+	}
+	if e.Err != nil {
+		span.SetTag(TagError, true)
+	}
+	span.Finish()
+}
+
+// Register registers a traced version of the driver registered as wrapped,
+// under the new name name. Any additional sinks are also reported to, as with
+// instrument.Register.
+func Register(name, wrapped string, tracer Tracer, sinks ...instrument.Sink) error {
+	return instrument.Register(name, wrapped, append([]instrument.Sink{NewSink(tracer)}, sinks...)...)
+}
+
+func spanFromContext(ctx context.Context) (Span, bool) {
+	if ctx == nil {
+		return nil, false
+	}
+	span, ok := ctx.Value(spanKey).(Span)
+	return span, ok
+}
+
+// Inject propagates the span in ctx, if any, to req, and tags the span with
+// the request's method and endpoint. Credentials are never included in the
+// tags. If ctx contains no span, Inject does nothing.
+func Inject(ctx context.Context, req *http.Request) {
+	span, ok := spanFromContext(ctx)
+	if !ok {
+		return
+	}
+	tracer, ok := ctx.Value(tracerKey).(Tracer)
+	if !ok {
+		return
+	}
+	tracer.Inject(ctx, req.Header)
+	span.SetTag(TagHTTPMethod, req.Method)
+	endpoint := url.URL{
+		Scheme:  req.URL.Scheme,
+		Host:    req.URL.Host,
+		Path:    req.URL.Path,
+		RawPath: req.URL.RawPath,
+	}
+	span.SetTag(TagHTTPURL, endpoint.String())
+	span.SetTag(TagPeerAddress, req.URL.Host)
+}
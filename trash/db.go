@@ -0,0 +1,510 @@
+package trash
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"strconv"
+	"time"
+
+	"github.com/flimzy/kivik"
+	"github.com/flimzy/kivik/driver"
+	"github.com/flimzy/kivik/errors"
+)
+
+type db struct {
+	db    driver.DB
+	field string
+}
+
+var _ driver.DB = &db{}
+var _ driver.Finder = &db{}
+var _ driver.Explainer = &db{}
+var _ driver.AttachmentMetaer = &db{}
+var _ driver.AttachmentCombiner = &db{}
+var _ driver.Rever = &db{}
+var _ driver.DBFlusher = &db{}
+var _ driver.Copier = &db{}
+var _ driver.OptsBulkDocer = &db{}
+var _ driver.OptsPutter = &db{}
+var _ driver.OptsDeleter = &db{}
+var _ driver.Quorumer = &db{}
+var _ driver.OpenRevsGetter = &db{}
+var _ driver.OptsDocCreator = &db{}
+var _ driver.BodyGetter = &db{}
+var _ driver.DesignInfoer = &db{}
+var _ driver.MultipartPutter = &db{}
+var _ driver.OptionValidator = &db{}
+
+var errTrashed = errors.Status(kivik.StatusNotFound, "deleted")
+
+// AllDocs hides trashed documents. As the documents must be read to find
+// them, include_docs is always passed to the wrapped driver, and skip and
+// limit are applied to the filtered rows.
+func (d *db) AllDocs(ctx context.Context, opts map[string]interface{}) (driver.Rows, error) {
+	if bypassed(ctx) {
+		return d.db.AllDocs(ctx, opts)
+	}
+	skip, err := intOption(opts, "skip")
+	if err != nil {
+		return nil, err
+	}
+	limit, err := intOption(opts, "limit")
+	if err != nil {
+		return nil, err
+	}
+	includeDocs := opts["include_docs"] == true || opts["include_docs"] == "true"
+	allOpts := make(map[string]interface{}, len(opts)+1)
+	for k, v := range opts {
+		allOpts[k] = v
+	}
+	allOpts["include_docs"] = true
+	delete(allOpts, "skip")
+	delete(allOpts, "limit")
+	rows, err := d.db.AllDocs(ctx, allOpts)
+	if err != nil {
+		return nil, err
+	}
+	return &filteredRows{
+		Rows:        rows,
+		field:       d.field,
+		skip:        skip,
+		limit:       limit,
+		includeDocs: includeDocs,
+	}, nil
+}
+
+// intOption returns the named integer option, or -1 if it is unset.
+func intOption(opts map[string]interface{}, name string) (int, error) {
+	switch t := opts[name].(type) {
+	case nil:
+		return -1, nil
+	case int:
+		return t, nil
+	case int64:
+		return int(t), nil
+	case float64:
+		if t == float64(int(t)) {
+			return int(t), nil
+		}
+	case string:
+		if n, err := strconv.Atoi(t); err == nil {
+			return n, nil
+		}
+	}
+	return 0, errors.Statusf(kivik.StatusBadRequest, "trash: invalid %s value %v", name, opts[name])
+}
+
+// filteredRows skips the trashed documents of Rows.
+type filteredRows struct {
+	driver.Rows
+	field       string
+	skip, limit int
+	includeDocs bool
+}
+
+var _ driver.Rows = &filteredRows{}
+
+func (r *filteredRows) Next(row *driver.Row) error {
+	for {
+		if r.limit == 0 {
+			return io.EOF
+		}
+		if err := r.Rows.Next(row); err != nil {
+			return err
+		}
+		if _, trashed := trashedAt(row.Doc, r.field); trashed {
+			continue
+		}
+		if r.skip > 0 {
+			r.skip--
+			continue
+		}
+		if r.limit > 0 {
+			r.limit--
+		}
+		if !r.includeDocs {
+			row.Doc = nil
+			row.Raw = nil
+		}
+		return nil
+	}
+}
+
+func (d *db) Query(ctx context.Context, ddoc, view string, opts map[string]interface{}) (driver.Rows, error) {
+	return d.db.Query(ctx, ddoc, view, opts)
+}
+
+func (d *db) Get(ctx context.Context, docID string, opts map[string]interface{}) (json.RawMessage, error) {
+	doc, err := d.db.Get(ctx, docID, opts)
+	if err != nil {
+		return nil, err
+	}
+	if !bypassed(ctx) {
+		if _, trashed := trashedAt(doc, d.field); trashed {
+			return nil, errTrashed
+		}
+	}
+	return doc, nil
+}
+
+func (d *db) CreateDoc(ctx context.Context, doc interface{}) (string, string, error) {
+	return d.db.CreateDoc(ctx, doc)
+}
+
+func (d *db) CreateDocOpts(ctx context.Context, doc interface{}, opts map[string]interface{}) (string, string, error) {
+	c, ok := d.db.(driver.OptsDocCreator)
+	if !ok {
+		return "", "", notImplemented("OptsDocCreator")
+	}
+	return c.CreateDocOpts(ctx, doc, opts)
+}
+
+func (d *db) Put(ctx context.Context, docID string, doc interface{}) (string, error) {
+	return d.db.Put(ctx, docID, doc)
+}
+
+func (d *db) PutOpts(ctx context.Context, docID string, doc interface{}, opts map[string]interface{}) (string, error) {
+	p, ok := d.db.(driver.OptsPutter)
+	if !ok {
+		return "", notImplemented("OptsPutter")
+	}
+	return p.PutOpts(ctx, docID, doc, opts)
+}
+
+// trash returns the current version of docID, with the deletion field set,
+// and _rev set to rev, ready to be written in place of a delete.
+func (d *db) trash(ctx context.Context, docID, rev string) (map[string]interface{}, error) {
+	body, err := d.Get(ctx, docID, nil)
+	if err != nil {
+		return nil, err
+	}
+	var doc map[string]interface{}
+	if err := json.Unmarshal(body, &doc); err != nil {
+		return nil, err
+	}
+	doc[d.field] = time.Now().UTC().Format(time.RFC3339Nano)
+	doc["_rev"] = rev
+	return doc, nil
+}
+
+// Delete moves the document to the trash, unless the context was returned
+// by Bypass.
+func (d *db) Delete(ctx context.Context, docID, rev string) (string, error) {
+	if bypassed(ctx) {
+		return d.db.Delete(ctx, docID, rev)
+	}
+	doc, err := d.trash(ctx, docID, rev)
+	if err != nil {
+		return "", err
+	}
+	return d.db.Put(ctx, docID, doc)
+}
+
+func (d *db) DeleteOpts(ctx context.Context, docID, rev string, opts map[string]interface{}) (string, error) {
+	del, ok := d.db.(driver.OptsDeleter)
+	if !ok {
+		return "", notImplemented("OptsDeleter")
+	}
+	if bypassed(ctx) {
+		return del.DeleteOpts(ctx, docID, rev, opts)
+	}
+	doc, err := d.trash(ctx, docID, rev)
+	if err != nil {
+		return "", err
+	}
+	if p, ok := d.db.(driver.OptsPutter); ok {
+		return p.PutOpts(ctx, docID, doc, opts)
+	}
+	return d.db.Put(ctx, docID, doc)
+}
+
+func (d *db) BulkDocs(ctx context.Context, docs []interface{}) (driver.BulkResults, error) {
+	return d.db.BulkDocs(ctx, d.trashBulk(ctx, docs))
+}
+
+func (d *db) BulkDocsOpts(ctx context.Context, docs []interface{}, opts map[string]interface{}) (driver.BulkResults, error) {
+	b, ok := d.db.(driver.OptsBulkDocer)
+	if !ok {
+		return nil, notImplemented("OptsBulkDocer")
+	}
+	return b.BulkDocsOpts(ctx, d.trashBulk(ctx, docs), opts)
+}
+
+// trashBulk returns a copy of docs, in which each document with _deleted set
+// is replaced by its trashed version. Documents which cannot be read are
+// passed on unchanged, so that the error is reported in the results.
+func (d *db) trashBulk(ctx context.Context, docs []interface{}) []interface{} {
+	if bypassed(ctx) {
+		return docs
+	}
+	result := make([]interface{}, len(docs))
+	for i, doc := range docs {
+		result[i] = doc
+		body, err := kivik.JSON().Marshal(doc)
+		if err != nil {
+			continue
+		}
+		var meta struct {
+			ID      string `json:"_id"`
+			Rev     string `json:"_rev"`
+			Deleted bool   `json:"_deleted"`
+		}
+		if err := json.Unmarshal(body, &meta); err != nil || !meta.Deleted || meta.ID == "" {
+			continue
+		}
+		if trashed, err := d.trash(ctx, meta.ID, meta.Rev); err == nil {
+			result[i] = trashed
+		}
+	}
+	return result
+}
+
+// Copy returns a not found error if the source document is trashed.
+func (d *db) Copy(ctx context.Context, targetID, sourceID string, opts map[string]interface{}) (string, error) {
+	c, ok := d.db.(driver.Copier)
+	if !ok {
+		return "", notImplemented("Copier")
+	}
+	if !bypassed(ctx) {
+		if _, err := d.Get(ctx, sourceID, nil); err != nil {
+			return "", err
+		}
+	}
+	return c.Copy(ctx, targetID, sourceID, opts)
+}
+
+func (d *db) PutAttachment(ctx context.Context, docID, rev, filename, contentType string, body io.Reader) (string, error) {
+	return d.db.PutAttachment(ctx, docID, rev, filename, contentType, body)
+}
+
+func (d *db) GetAttachment(ctx context.Context, docID, rev, filename string) (string, driver.MD5sum, io.ReadCloser, error) {
+	return d.db.GetAttachment(ctx, docID, rev, filename)
+}
+
+func (d *db) DeleteAttachment(ctx context.Context, docID, rev, filename string) (string, error) {
+	return d.db.DeleteAttachment(ctx, docID, rev, filename)
+}
+
+func (d *db) Stats(ctx context.Context) (*driver.DBStats, error) {
+	return d.db.Stats(ctx)
+}
+
+func (d *db) Compact(ctx context.Context) error {
+	return d.db.Compact(ctx)
+}
+
+func (d *db) CompactView(ctx context.Context, ddocID string) error {
+	return d.db.CompactView(ctx, ddocID)
+}
+
+func (d *db) ViewCleanup(ctx context.Context) error {
+	return d.db.ViewCleanup(ctx)
+}
+
+func (d *db) Security(ctx context.Context) (*driver.Security, error) {
+	return d.db.Security(ctx)
+}
+
+func (d *db) SetSecurity(ctx context.Context, security *driver.Security) error {
+	return d.db.SetSecurity(ctx, security)
+}
+
+func (d *db) Changes(ctx context.Context, opts map[string]interface{}) (driver.Changes, error) {
+	return d.db.Changes(ctx, opts)
+}
+
+func (d *db) finder() (driver.Finder, error) {
+	if f, ok := d.db.(driver.Finder); ok {
+		return f, nil
+	}
+	return nil, notImplemented("Finder")
+}
+
+// Find adds a condition to the selector of query, to exclude trashed
+// documents.
+func (d *db) Find(ctx context.Context, query interface{}) (driver.Rows, error) {
+	f, err := d.finder()
+	if err != nil {
+		return nil, err
+	}
+	if bypassed(ctx) {
+		return f.Find(ctx, query)
+	}
+	q, err := d.excludeTrashed(query)
+	if err != nil {
+		return nil, err
+	}
+	return f.Find(ctx, q)
+}
+
+// excludeTrashed returns query, which may be a string, a []byte, a
+// json.RawMessage, or any value which marshals to JSON, as a map with the
+// selector extended to exclude trashed documents.
+func (d *db) excludeTrashed(query interface{}) (map[string]interface{}, error) {
+	var body []byte
+	switch t := query.(type) {
+	case string:
+		body = []byte(t)
+	case []byte:
+		body = t
+	case json.RawMessage:
+		body = t
+	default:
+		var err error
+		if body, err = kivik.JSON().Marshal(query); err != nil {
+			return nil, err
+		}
+	}
+	var q map[string]interface{}
+	if err := json.Unmarshal(body, &q); err != nil {
+		return nil, errors.WrapStatus(kivik.StatusBadRequest, err)
+	}
+	notTrashed := map[string]interface{}{
+		d.field: map[string]interface{}{"$exists": false},
+	}
+	if selector, ok := q["selector"]; ok {
+		q["selector"] = map[string]interface{}{
+			"$and": []interface{}{selector, notTrashed},
+		}
+	} else {
+		q["selector"] = notTrashed
+	}
+	return q, nil
+}
+
+func (d *db) CreateIndex(ctx context.Context, ddoc, name string, index interface{}) error {
+	f, err := d.finder()
+	if err != nil {
+		return err
+	}
+	return f.CreateIndex(ctx, ddoc, name, index)
+}
+
+func (d *db) GetIndexes(ctx context.Context) ([]driver.Index, error) {
+	f, err := d.finder()
+	if err != nil {
+		return nil, err
+	}
+	return f.GetIndexes(ctx)
+}
+
+func (d *db) DeleteIndex(ctx context.Context, ddoc, name string) error {
+	f, err := d.finder()
+	if err != nil {
+		return err
+	}
+	return f.DeleteIndex(ctx, ddoc, name)
+}
+
+func (d *db) GetAttachmentMeta(ctx context.Context, docID, rev, filename string) (string, driver.MD5sum, error) {
+	m, ok := d.db.(driver.AttachmentMetaer)
+	if !ok {
+		return "", driver.MD5sum{}, notImplemented("AttachmentMetaer")
+	}
+	return m.GetAttachmentMeta(ctx, docID, rev, filename)
+}
+
+func (d *db) Rev(ctx context.Context, docID string) (string, error) {
+	r, ok := d.db.(driver.Rever)
+	if !ok {
+		return "", notImplemented("Rever")
+	}
+	if !bypassed(ctx) {
+		if _, err := d.Get(ctx, docID, nil); err != nil {
+			return "", err
+		}
+	}
+	return r.Rev(ctx, docID)
+}
+
+func (d *db) Flush(ctx context.Context) error {
+	f, ok := d.db.(driver.DBFlusher)
+	if !ok {
+		return notImplemented("DBFlusher")
+	}
+	return f.Flush(ctx)
+}
+
+func (d *db) GetOpenRevs(ctx context.Context, docID string, revs []string, opts map[string]interface{}) ([]driver.OpenRev, error) {
+	g, ok := d.db.(driver.OpenRevsGetter)
+	if !ok {
+		return nil, notImplemented("OpenRevsGetter")
+	}
+	return g.GetOpenRevs(ctx, docID, revs, opts)
+}
+
+func (d *db) GetBody(ctx context.Context, docID string, opts map[string]interface{}) (io.ReadCloser, error) {
+	g, ok := d.db.(driver.BodyGetter)
+	if !ok {
+		return nil, notImplemented("BodyGetter")
+	}
+	body, err := g.GetBody(ctx, docID, opts)
+	if err != nil || bypassed(ctx) {
+		return body, err
+	}
+	defer func() { _ = body.Close() }()
+	doc, err := ioutil.ReadAll(body)
+	if err != nil {
+		return nil, err
+	}
+	if _, trashed := trashedAt(doc, d.field); trashed {
+		return nil, errTrashed
+	}
+	return ioutil.NopCloser(bytes.NewReader(doc)), nil
+}
+
+func (d *db) SupportsQuorum() bool {
+	q, ok := d.db.(driver.Quorumer)
+	return ok && q.SupportsQuorum()
+}
+
+func (d *db) SupportedOptions(method string) (map[string]driver.OptionType, bool) {
+	if v, ok := d.db.(driver.OptionValidator); ok {
+		return v.SupportedOptions(method)
+	}
+	return nil, false
+}
+
+func (d *db) PutMultipart(ctx context.Context, docID string, doc interface{}, atts []driver.MultipartAttachment, opts map[string]interface{}) (string, error) {
+	p, ok := d.db.(driver.MultipartPutter)
+	if !ok {
+		return "", notImplemented("MultipartPutter")
+	}
+	return p.PutMultipart(ctx, docID, doc, atts, opts)
+}
+
+// Explain returns the plan of the query, with the condition added by Find to
+// exclude trashed documents.
+func (d *db) Explain(ctx context.Context, query interface{}) (*driver.QueryPlan, error) {
+	e, ok := d.db.(driver.Explainer)
+	if !ok {
+		return nil, notImplemented("Explainer")
+	}
+	if bypassed(ctx) {
+		return e.Explain(ctx, query)
+	}
+	q, err := d.excludeTrashed(query)
+	if err != nil {
+		return nil, err
+	}
+	return e.Explain(ctx, q)
+}
+
+func (d *db) DesignInfo(ctx context.Context, ddoc string) (*driver.DesignInfo, error) {
+	i, ok := d.db.(driver.DesignInfoer)
+	if !ok {
+		return nil, notImplemented("DesignInfoer")
+	}
+	return i.DesignInfo(ctx, ddoc)
+}
+
+func (d *db) CombineAttachments(ctx context.Context, docID, rev, filename, contentType string, parts []string) (newRev string, err error) {
+	c, ok := d.db.(driver.AttachmentCombiner)
+	if !ok {
+		return "", notImplemented("AttachmentCombiner")
+	}
+	return c.CombineAttachments(ctx, docID, rev, filename, contentType, parts)
+}
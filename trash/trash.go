@@ -0,0 +1,245 @@
+// Package trash provides a Kivik driver which wraps another driver, to make
+// deletes reversible. Deleting a document sets a field, deletedAt by default,
+// to the time of deletion, instead of deleting it, and such documents are
+// hidden from Get, AllDocs and Find, until they are restored with Undelete.
+//
+//	trash.Register("couch-trash", "couch", trash.Options{TTL: 30 * 24 * time.Hour})
+//	client, err := kivik.New(context.TODO(), "couch-trash", "http://localhost:5984/")
+//
+// If a TTL is set, trashed documents are deleted permanently, by a
+// background job, once they have been in the trash for longer than the TTL.
+// The job runs until the context passed to kivik.New is canceled.
+//
+// Documents deleted with BulkDocs, by setting _deleted, are also moved to the
+// trash. Views, and the changes feed, are not filtered, so views should not
+// emit documents which have the deletedAt field, where that matters. To read
+// trashed documents, or to delete documents permanently, pass a context
+// returned by Bypass.
+package trash
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"time"
+
+	"github.com/flimzy/kivik"
+	"github.com/flimzy/kivik/driver"
+	"github.com/flimzy/kivik/errors"
+)
+
+// DefaultField is the name of the field which holds the time of deletion, if
+// none is given in Options.
+const DefaultField = "deletedAt"
+
+// DefaultPurgeInterval is the interval at which trashed documents are
+// purged, if TTL is set, and PurgeInterval is not.
+const DefaultPurgeInterval = time.Hour
+
+// Options configures a trash driver.
+type Options struct {
+	// Field is the name of the field set to the time of deletion, formatted
+	// as with time.RFC3339Nano, in UTC. The default is DefaultField.
+	Field string
+	// TTL, if non-zero, is the time after which trashed documents are
+	// deleted permanently.
+	TTL time.Duration
+	// PurgeInterval is the interval at which the databases are searched for
+	// documents to delete permanently. The default is DefaultPurgeInterval.
+	PurgeInterval time.Duration
+	// Databases, if not empty, lists the databases which are purged.
+	// Otherwise, all databases, other than system databases whose names start
+	// with an underscore, are purged.
+	Databases []string
+	// OnPurgeError, if set, is called with any error encountered while
+	// purging a database.
+	OnPurgeError func(dbName string, err error)
+}
+
+type bypassKey struct{}
+
+// Bypass returns a copy of ctx which disables the trash, for operations
+// performed with it. Trashed documents may then be read, and deletes are
+// permanent.
+func Bypass(ctx context.Context) context.Context {
+	return context.WithValue(ctx, bypassKey{}, true)
+}
+
+func bypassed(ctx context.Context) bool {
+	bypass, _ := ctx.Value(bypassKey{}).(bool)
+	return bypass
+}
+
+// Undelete restores the trashed document docID of db, by removing the
+// deletedAt field, or field, if not empty. The new revision is returned.
+func Undelete(ctx context.Context, db *kivik.DB, docID, field string) (string, error) {
+	if field == "" {
+		field = DefaultField
+	}
+	ctx = Bypass(ctx)
+	row, err := db.Get(ctx, docID)
+	if err != nil {
+		return "", err
+	}
+	var doc map[string]interface{}
+	if err := row.ScanDoc(&doc); err != nil {
+		return "", err
+	}
+	if _, ok := doc[field]; !ok {
+		return "", errors.Statusf(kivik.StatusBadRequest, "trash: document %q is not deleted", docID)
+	}
+	delete(doc, field)
+	return db.Put(ctx, docID, doc)
+}
+
+type trashDriver struct {
+	drv  driver.Driver
+	opts Options
+}
+
+var _ driver.Driver = &trashDriver{}
+
+// New returns a driver which wraps drv, to move deleted documents to the
+// trash.
+func New(drv driver.Driver, opts Options) driver.Driver {
+	if opts.Field == "" {
+		opts.Field = DefaultField
+	}
+	if opts.PurgeInterval <= 0 {
+		opts.PurgeInterval = DefaultPurgeInterval
+	}
+	return &trashDriver{drv: drv, opts: opts}
+}
+
+// Register registers a trash version of the driver registered as wrapped,
+// under the new name name.
+func Register(name, wrapped string, opts Options) error {
+	drv, ok := kivik.LookupDriver(wrapped)
+	if !ok {
+		return errors.Statusf(kivik.StatusBadRequest, "trash: unknown driver %q (forgotten import?)", wrapped)
+	}
+	kivik.Register(name, New(drv, opts))
+	return nil
+}
+
+func (d *trashDriver) NewClient(ctx context.Context, dsn string) (driver.Client, error) {
+	c, err := d.drv.NewClient(ctx, dsn)
+	if err != nil {
+		return nil, err
+	}
+	tc := &client{client: c, opts: d.opts}
+	if d.opts.TTL > 0 {
+		go tc.purgeLoop(ctx)
+	}
+	return tc, nil
+}
+
+// purgeLoop purges the databases every PurgeInterval, until ctx is canceled.
+func (c *client) purgeLoop(ctx context.Context) {
+	ticker := time.NewTicker(c.opts.PurgeInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		c.purgeAll(ctx, time.Now().Add(-c.opts.TTL))
+	}
+}
+
+// purgeAll permanently deletes the documents trashed before cutoff from each
+// database.
+func (c *client) purgeAll(ctx context.Context, cutoff time.Time) {
+	dbNames := c.opts.Databases
+	if len(dbNames) == 0 {
+		all, err := c.client.AllDBs(ctx, nil)
+		if err != nil {
+			c.purgeError("", err)
+			return
+		}
+		for _, name := range all {
+			if name != "" && name[0] != '_' {
+				dbNames = append(dbNames, name)
+			}
+		}
+	}
+	for _, name := range dbNames {
+		if ctx.Err() != nil {
+			return
+		}
+		d, err := c.client.DB(ctx, name, nil)
+		if err == nil {
+			err = purge(ctx, d, c.opts.Field, cutoff)
+		}
+		if err != nil {
+			c.purgeError(name, err)
+		}
+	}
+}
+
+func (c *client) purgeError(dbName string, err error) {
+	if c.opts.OnPurgeError != nil {
+		c.opts.OnPurgeError(dbName, err)
+	}
+}
+
+// purge permanently deletes the documents of d trashed before cutoff.
+func purge(ctx context.Context, d driver.DB, field string, cutoff time.Time) error {
+	rows, err := d.AllDocs(ctx, map[string]interface{}{"include_docs": true})
+	if err != nil {
+		return err
+	}
+	defer func() { _ = rows.Close() }()
+	type expired struct{ id, rev string }
+	var docs []expired
+	for {
+		var row driver.Row
+		if err := rows.Next(&row); err != nil {
+			if err == io.EOF {
+				break
+			}
+			return err
+		}
+		deletedAt, ok := trashedAt(row.Doc, field)
+		if !ok || deletedAt.IsZero() || !deletedAt.Before(cutoff) {
+			continue
+		}
+		var doc struct {
+			Rev string `json:"_rev"`
+		}
+		if err := json.Unmarshal(row.Doc, &doc); err != nil {
+			return err
+		}
+		docs = append(docs, expired{id: row.ID, rev: doc.Rev})
+	}
+	for _, doc := range docs {
+		if _, err := d.Delete(ctx, doc.id, doc.rev); err != nil && kivik.StatusCode(err) != kivik.StatusConflict {
+			return err
+		}
+	}
+	return nil
+}
+
+// trashedAt returns the time at which doc was trashed, if it was. The time
+// is zero if the field is not a valid time.
+func trashedAt(doc json.RawMessage, field string) (time.Time, bool) {
+	if len(doc) == 0 {
+		return time.Time{}, false
+	}
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(doc, &fields); err != nil {
+		return time.Time{}, false
+	}
+	value, ok := fields[field]
+	if !ok {
+		return time.Time{}, false
+	}
+	var s string
+	if err := json.Unmarshal(value, &s); err != nil {
+		// A field of any other type still marks the document as deleted.
+		return time.Time{}, true
+	}
+	t, _ := time.Parse(time.RFC3339Nano, s)
+	return t, true
+}
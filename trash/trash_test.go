@@ -0,0 +1,348 @@
+package trash
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/flimzy/diff"
+	"github.com/flimzy/kivik"
+	"github.com/flimzy/kivik/driver"
+	"github.com/flimzy/kivik/errors"
+	"github.com/flimzy/kivik/kiviktest"
+)
+
+type fakeDriver struct {
+	db *fakeDB
+}
+
+func (d *fakeDriver) NewClient(_ context.Context, _ string) (driver.Client, error) {
+	return &fakeClient{db: d.db}, nil
+}
+
+type fakeClient struct {
+	driver.Client
+	db *fakeDB
+}
+
+func (c *fakeClient) DB(_ context.Context, _ string, _ map[string]interface{}) (driver.DB, error) {
+	return c.db, nil
+}
+
+// fakeDB stores documents in memory, checking revisions as CouchDB does, and
+// records the last query passed to Find or Explain.
+type fakeDB struct {
+	driver.DB
+	driver.Finder
+	mu    sync.Mutex
+	docs  map[string]map[string]interface{}
+	query interface{}
+}
+
+func newFakeDB() *fakeDB {
+	return &fakeDB{docs: map[string]map[string]interface{}{}}
+}
+
+func (d *fakeDB) Put(_ context.Context, docID string, doc interface{}) (string, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	body, err := json.Marshal(doc)
+	if err != nil {
+		return "", err
+	}
+	var m map[string]interface{}
+	if err := json.Unmarshal(body, &m); err != nil {
+		return "", err
+	}
+	gen := 1
+	if old, ok := d.docs[docID]; ok {
+		if m["_rev"] != old["_rev"] {
+			return "", errors.Status(kivik.StatusConflict, "conflict")
+		}
+		_, _ = fmt.Sscanf(old["_rev"].(string), "%d-", &gen)
+		gen++
+	}
+	rev := fmt.Sprintf("%d-x", gen)
+	m["_id"] = docID
+	m["_rev"] = rev
+	d.docs[docID] = m
+	return rev, nil
+}
+
+func (d *fakeDB) Get(_ context.Context, docID string, _ map[string]interface{}) (json.RawMessage, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	doc, ok := d.docs[docID]
+	if !ok {
+		return nil, errors.Status(kivik.StatusNotFound, "missing")
+	}
+	return json.Marshal(doc)
+}
+
+func (d *fakeDB) Delete(_ context.Context, docID, rev string) (string, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	doc, ok := d.docs[docID]
+	if !ok {
+		return "", errors.Status(kivik.StatusNotFound, "missing")
+	}
+	if doc["_rev"] != rev {
+		return "", errors.Status(kivik.StatusConflict, "conflict")
+	}
+	delete(d.docs, docID)
+	return "", nil
+}
+
+func (d *fakeDB) BulkDocs(ctx context.Context, docs []interface{}) (driver.BulkResults, error) {
+	results := &bulkResults{}
+	for _, doc := range docs {
+		docID := doc.(map[string]interface{})["_id"].(string)
+		rev, err := d.Put(ctx, docID, doc)
+		results.results = append(results.results, driver.BulkResult{ID: docID, Rev: rev, Error: err})
+	}
+	return results, nil
+}
+
+type bulkResults struct {
+	results []driver.BulkResult
+}
+
+func (r *bulkResults) Next(result *driver.BulkResult) error {
+	if len(r.results) == 0 {
+		return io.EOF
+	}
+	*result, r.results = r.results[0], r.results[1:]
+	return nil
+}
+
+func (r *bulkResults) Close() error { return nil }
+
+func (d *fakeDB) AllDocs(_ context.Context, opts map[string]interface{}) (driver.Rows, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	ids := make([]string, 0, len(d.docs))
+	for id := range d.docs {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	rows := &fakeRows{}
+	for _, id := range ids {
+		row := &driver.Row{ID: id}
+		if opts["include_docs"] == true {
+			row.Doc, _ = json.Marshal(d.docs[id])
+		}
+		rows.rows = append(rows.rows, row)
+	}
+	return rows, nil
+}
+
+func (d *fakeDB) Find(_ context.Context, query interface{}) (driver.Rows, error) {
+	d.query = query
+	return &fakeRows{}, nil
+}
+
+func (d *fakeDB) Explain(_ context.Context, query interface{}) (*driver.QueryPlan, error) {
+	d.query = query
+	return &driver.QueryPlan{}, nil
+}
+
+func (d *fakeDB) DesignInfo(_ context.Context, ddoc string) (*driver.DesignInfo, error) {
+	return &driver.DesignInfo{Name: ddoc}, nil
+}
+
+type fakeRows struct {
+	driver.Rows
+	rows []*driver.Row
+}
+
+func (r *fakeRows) Next(row *driver.Row) error {
+	if len(r.rows) == 0 {
+		return io.EOF
+	}
+	*row, r.rows = *r.rows[0], r.rows[1:]
+	return nil
+}
+
+func (r *fakeRows) Close() error { return nil }
+
+func newTestDB(t *testing.T, fake *fakeDB) *kivik.DB {
+	return kiviktest.NewDB(t, New(&fakeDriver{db: fake}, Options{}), "", "foo")
+}
+
+func allDocIDs(t *testing.T, db *kivik.DB, opts kivik.Options) []string {
+	rows, err := db.AllDocs(context.Background(), opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var ids []string
+	for rows.Next() {
+		ids = append(ids, rows.ID())
+	}
+	if err := rows.Err(); err != nil {
+		t.Fatal(err)
+	}
+	return ids
+}
+
+func TestTrash(t *testing.T) {
+	fake := newFakeDB()
+	db := newTestDB(t, fake)
+	ctx := context.Background()
+	var rev string
+	for _, id := range []string{"a", "b", "c", "d"} {
+		var err error
+		if rev, err = db.Put(ctx, id, map[string]interface{}{"name": id}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, err := db.Delete(ctx, "b", rev); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := fake.docs["b"][DefaultField]; !ok {
+		t.Errorf("Expected b to be moved to the trash, got %v", fake.docs["b"])
+	}
+	if _, err := db.Get(ctx, "b"); kivik.StatusCode(err) != kivik.StatusNotFound {
+		t.Errorf("Expected the trashed document to be hidden, got %v", err)
+	}
+	if _, err := db.Get(Bypass(ctx), "b"); err != nil {
+		t.Errorf("Expected the trashed document to be read with Bypass, got %s", err)
+	}
+	if d := diff.Interface([]string{"a", "c", "d"}, allDocIDs(t, db, nil)); d != "" {
+		t.Error(d)
+	}
+	if d := diff.Interface([]string{"c"}, allDocIDs(t, db, kivik.Options{"skip": 1, "limit": 1})); d != "" {
+		t.Error(d)
+	}
+
+	if _, err := Undelete(ctx, db, "b", ""); err != nil {
+		t.Fatal(err)
+	}
+	if d := diff.Interface([]string{"a", "b", "c", "d"}, allDocIDs(t, db, nil)); d != "" {
+		t.Error(d)
+	}
+	if _, err := Undelete(ctx, db, "b", ""); kivik.StatusCode(err) != kivik.StatusBadRequest {
+		t.Errorf("Expected a bad request error for an untrashed document, got %v", err)
+	}
+
+	if _, err := db.Delete(Bypass(ctx), "d", rev); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := fake.docs["d"]; ok {
+		t.Error("Expected d to be deleted permanently")
+	}
+}
+
+func TestBulkDocs(t *testing.T) {
+	fake := newFakeDB()
+	db := newTestDB(t, fake)
+	ctx := context.Background()
+	rev, err := db.Put(ctx, "a", map[string]interface{}{"name": "a"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	results, err := db.BulkDocs(ctx, []interface{}{
+		map[string]interface{}{"_id": "a", "_rev": rev, "_deleted": true},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for results.Next() {
+		if err := results.UpdateErr(); err != nil {
+			t.Error(err)
+		}
+	}
+	_ = results.Close()
+	if fake.docs["a"]["name"] != "a" || fake.docs["a"][DefaultField] == nil {
+		t.Errorf("Expected a to be moved to the trash, got %v", fake.docs["a"])
+	}
+}
+
+func TestFind(t *testing.T) {
+	fake := newFakeDB()
+	db := newTestDB(t, fake)
+	for _, query := range []interface{}{
+		`{"selector":{"name":"bob"}}`,
+		map[string]interface{}{"selector": map[string]interface{}{"name": "bob"}},
+	} {
+		rows, err := db.Find(context.Background(), query)
+		if err != nil {
+			t.Fatal(err)
+		}
+		_ = rows.Close()
+		expected := map[string]interface{}{
+			"selector": map[string]interface{}{
+				"$and": []interface{}{
+					map[string]interface{}{"name": "bob"},
+					map[string]interface{}{DefaultField: map[string]interface{}{"$exists": false}},
+				},
+			},
+		}
+		if d := diff.AsJSON(expected, fake.query); d != "" {
+			t.Error(d)
+		}
+	}
+}
+
+func TestExplain(t *testing.T) {
+	fake := newFakeDB()
+	db := newTestDB(t, fake)
+	if _, err := db.Explain(context.Background(), `{"selector":{"name":"bob"}}`); err != nil {
+		t.Fatal(err)
+	}
+	expected := map[string]interface{}{
+		"selector": map[string]interface{}{
+			"$and": []interface{}{
+				map[string]interface{}{"name": "bob"},
+				map[string]interface{}{DefaultField: map[string]interface{}{"$exists": false}},
+			},
+		},
+	}
+	if d := diff.AsJSON(expected, fake.query); d != "" {
+		t.Error(d)
+	}
+}
+
+func TestDesignInfo(t *testing.T) {
+	db := newTestDB(t, newFakeDB())
+	info, err := db.DesignInfo(context.Background(), "_design/foo")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Name != "foo" {
+		t.Errorf("Unexpected name: %s", info.Name)
+	}
+}
+
+func TestPurge(t *testing.T) {
+	fake := newFakeDB()
+	ctx := context.Background()
+	now := time.Now().UTC()
+	for id, deletedAt := range map[string]interface{}{
+		"old":     now.Add(-2 * time.Hour).Format(time.RFC3339Nano),
+		"recent":  now.Add(-time.Minute).Format(time.RFC3339Nano),
+		"invalid": "yesterday",
+	} {
+		if _, err := fake.Put(ctx, id, map[string]interface{}{DefaultField: deletedAt}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, err := fake.Put(ctx, "live", map[string]interface{}{}); err != nil {
+		t.Fatal(err)
+	}
+	if err := purge(ctx, fake, DefaultField, now.Add(-time.Hour)); err != nil {
+		t.Fatal(err)
+	}
+	var ids []string
+	for id := range fake.docs {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	if d := diff.Interface([]string{"invalid", "live", "recent"}, ids); d != "" {
+		t.Error(d)
+	}
+}
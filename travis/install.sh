@@ -86,6 +86,9 @@ case "$1" in
         setup_couch20
         generate
     ;;
+    "wasm")
+        npm install
+    ;;
     "linter")
         go get -u gopkg.in/alecthomas/gometalinter.v1
         gometalinter.v1 --install
@@ -0,0 +1,142 @@
+package kivik
+
+import (
+	"context"
+	"encoding/json"
+
+	"github.com/flimzy/kivik/errors"
+)
+
+// DefaultUpdateRetries is the number of times Update retries after a
+// conflict, unless overridden by UpdateRetries.
+const DefaultUpdateRetries = 10
+
+const updateRetriesOption = "kivik_update_retries"
+
+// UpdateRetries returns options which set the number of times Update retries
+// after a conflict.
+func UpdateRetries(n int) Options {
+	return Options{updateRetriesOption: n}
+}
+
+// UpdateFunc is called by Update with the current JSON of the document, or
+// nil if it does not exist, and returns the updated document. If it returns a
+// nil document, the document is not updated.
+type UpdateFunc func(doc json.RawMessage) (interface{}, error)
+
+// Update applies fn to the current version of the document, and saves the
+// result, as the common read-modify-write pattern. The revision of the
+// document read is set on the updated document, so fn need not preserve it.
+// If the save fails with a conflict, because the document was modified
+// concurrently, the document is read again, and fn reapplied, up to
+// DefaultUpdateRetries times, or as set with UpdateRetries. fn must therefore
+// be safe to call more than once.
+//
+// Other options are passed to both Get and Put. Batch mode is not supported,
+// as it does not report conflicts. The new rev is returned, or if fn returned
+// a nil document, the current one.
+func (db *DB) Update(ctx context.Context, docID string, fn UpdateFunc, options ...Options) (rev string, err error) {
+	opts, err := mergeOptions(options...)
+	if err != nil {
+		return "", err
+	}
+	retries := DefaultUpdateRetries
+	if value, ok := opts[updateRetriesOption]; ok {
+		n, isInt := value.(int)
+		if !isInt || n < 0 {
+			return "", errors.Statusf(StatusBadRequest, "kivik: invalid update retries %v", value)
+		}
+		retries = n
+		delete(opts, updateRetriesOption)
+	}
+	if _, ok := opts["batch"]; ok {
+		return "", errors.Status(StatusBadRequest, "kivik: batch mode is not supported by Update")
+	}
+	for attempt := 0; ; attempt++ {
+		rev, err = db.update(ctx, docID, fn, opts)
+		if StatusCode(err) != StatusConflict || attempt >= retries {
+			return rev, err
+		}
+	}
+}
+
+func (db *DB) update(ctx context.Context, docID string, fn UpdateFunc, opts Options) (string, error) {
+	var current json.RawMessage
+	var currentRev string
+	row, err := db.Get(ctx, docID, opts)
+	switch StatusCode(err) {
+	case 0:
+		if err = row.ScanDoc(&current); err != nil {
+			return "", err
+		}
+		var meta struct {
+			Rev string `json:"_rev"`
+		}
+		if err = json.Unmarshal(current, &meta); err != nil {
+			return "", errors.WrapStatus(StatusInternalServerError, err)
+		}
+		currentRev = meta.Rev
+	case StatusNotFound:
+	default:
+		return "", err
+	}
+	newDoc, err := fn(current)
+	if err != nil {
+		return "", err
+	}
+	if newDoc == nil {
+		return currentRev, nil
+	}
+	doc, err := withRev(newDoc, currentRev)
+	if err != nil {
+		return "", err
+	}
+	return db.Put(ctx, docID, doc, opts)
+}
+
+// withRev returns doc, as a map, with its _rev set to rev, or removed if rev
+// is empty.
+func withRev(doc interface{}, rev string) (map[string]interface{}, error) {
+	doc, err := marshalTagged(doc)
+	if err != nil {
+		return nil, err
+	}
+	fields, err := jsonFields(doc)
+	if err != nil {
+		return nil, err
+	}
+	if rev == "" {
+		delete(fields, "_rev")
+	} else {
+		fields["_rev"] = rev
+	}
+	return fields, nil
+}
+
+// Upsert saves doc as docID, whether or not the document exists, overwriting
+// any current version. The current rev is looked up, and the save retried if
+// it conflicts with a concurrent update, as for Update. The new rev is
+// returned.
+func (db *DB) Upsert(ctx context.Context, docID string, doc interface{}, options ...Options) (rev string, err error) {
+	return db.Update(ctx, docID, func(_ json.RawMessage) (interface{}, error) {
+		return doc, nil
+	}, options...)
+}
+
+// GetOrCreate fetches the document into dest, as for Row.ScanDoc. If the
+// document does not exist, it is first created from defaultDoc. If it is
+// created concurrently by another client, that version is returned.
+func (db *DB) GetOrCreate(ctx context.Context, docID string, defaultDoc, dest interface{}) error {
+	row, err := db.Get(ctx, docID)
+	if StatusCode(err) == StatusNotFound {
+		_, err = db.Put(ctx, docID, defaultDoc)
+		if err != nil && StatusCode(err) != StatusConflict {
+			return err
+		}
+		row, err = db.Get(ctx, docID)
+	}
+	if err != nil {
+		return err
+	}
+	return row.ScanDoc(dest)
+}
@@ -0,0 +1,185 @@
+package kivik
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"testing"
+
+	"github.com/flimzy/diff"
+	"github.com/flimzy/kivik/errors"
+)
+
+// updateDB stores a single document. The first conflicts Puts fail with a
+// conflict, after the document is modified concurrently.
+type updateDB struct {
+	dummyDB
+	doc       map[string]interface{}
+	gen       int
+	conflicts int
+}
+
+func (db *updateDB) Get(_ context.Context, _ string, _ map[string]interface{}) (json.RawMessage, error) {
+	if db.doc == nil {
+		return nil, errors.Status(StatusNotFound, "missing")
+	}
+	return json.Marshal(db.doc)
+}
+
+func (db *updateDB) Put(_ context.Context, _ string, doc interface{}) (string, error) {
+	newDoc := doc.(map[string]interface{})
+	if db.conflicts > 0 {
+		db.conflicts--
+		db.gen++
+		db.doc["_rev"] = fmt.Sprintf("%d-x", db.gen)
+		db.doc["count"] = db.doc["count"].(float64) + 1
+	}
+	var rev string
+	if db.doc != nil {
+		rev, _ = db.doc["_rev"].(string)
+	}
+	if newRev, _ := newDoc["_rev"].(string); newRev != rev {
+		return "", errors.Status(StatusConflict, "conflict")
+	}
+	db.gen++
+	newDoc["_rev"] = fmt.Sprintf("%d-x", db.gen)
+	db.doc = newDoc
+	return newDoc["_rev"].(string), nil
+}
+
+func increment(doc json.RawMessage) (interface{}, error) {
+	var d struct {
+		Count int `json:"count"`
+	}
+	if doc != nil {
+		if err := json.Unmarshal(doc, &d); err != nil {
+			return nil, err
+		}
+	}
+	d.Count++
+	return d, nil
+}
+
+func TestUpdate(t *testing.T) {
+	tests := []struct {
+		name      string
+		doc       map[string]interface{}
+		conflicts int
+		options   Options
+		fn        UpdateFunc
+		rev       string
+		expected  map[string]interface{}
+		status    int
+	}{
+		{
+			name:     "Create",
+			fn:       increment,
+			rev:      "1-x",
+			expected: map[string]interface{}{"_rev": "1-x", "count": 1},
+		},
+		{
+			name:     "Update",
+			doc:      map[string]interface{}{"_rev": "1-x", "count": 1.0},
+			fn:       increment,
+			rev:      "2-x",
+			expected: map[string]interface{}{"_rev": "2-x", "count": 2},
+		},
+		{
+			name:      "RetryOnConflict",
+			doc:       map[string]interface{}{"_rev": "1-x", "count": 1.0},
+			conflicts: 2,
+			fn:        increment,
+			rev:       "4-x",
+			expected:  map[string]interface{}{"_rev": "4-x", "count": 4},
+		},
+		{
+			name:      "TooManyConflicts",
+			doc:       map[string]interface{}{"_rev": "1-x", "count": 1.0},
+			conflicts: 2,
+			options:   UpdateRetries(1),
+			fn:        increment,
+			expected:  map[string]interface{}{"_rev": "3-x", "count": 3.0},
+			status:    StatusConflict,
+		},
+		{
+			name: "NoChange",
+			doc:  map[string]interface{}{"_rev": "1-x", "count": 1.0},
+			fn: func(_ json.RawMessage) (interface{}, error) {
+				return nil, nil
+			},
+			rev:      "1-x",
+			expected: map[string]interface{}{"_rev": "1-x", "count": 1.0},
+		},
+		{
+			name:    "Batch",
+			options: Batch(),
+			fn:      increment,
+			status:  StatusBadRequest,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			driverDB := &updateDB{doc: test.doc, gen: 1, conflicts: test.conflicts}
+			if test.doc == nil {
+				driverDB.gen = 0
+			}
+			db := &DB{driverDB: driverDB}
+			rev, err := db.Update(context.Background(), "foo", test.fn, test.options)
+			if StatusCode(err) != test.status {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if rev != test.rev {
+				t.Errorf("Unexpected rev: %s", rev)
+			}
+			if d := diff.AsJSON(test.expected, driverDB.doc); d != "" {
+				t.Error(d)
+			}
+		})
+	}
+}
+
+func TestUpsert(t *testing.T) {
+	driverDB := &updateDB{doc: map[string]interface{}{"_rev": "1-x", "count": 1.0}, gen: 1, conflicts: 1}
+	db := &DB{driverDB: driverDB}
+	rev, err := db.Upsert(context.Background(), "foo", map[string]interface{}{"count": 10})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rev != "3-x" {
+		t.Errorf("Unexpected rev: %s", rev)
+	}
+	expected := map[string]interface{}{"_rev": "3-x", "count": 10}
+	if d := diff.AsJSON(expected, driverDB.doc); d != "" {
+		t.Error(d)
+	}
+}
+
+func TestGetOrCreate(t *testing.T) {
+	tests := []struct {
+		name     string
+		doc      map[string]interface{}
+		expected map[string]interface{}
+	}{
+		{
+			name:     "Exists",
+			doc:      map[string]interface{}{"_rev": "1-x", "count": 5.0},
+			expected: map[string]interface{}{"_rev": "1-x", "count": 5},
+		},
+		{
+			name:     "Created",
+			expected: map[string]interface{}{"_rev": "1-x", "count": 0},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			db := &DB{driverDB: &updateDB{doc: test.doc}}
+			var result map[string]interface{}
+			if err := db.GetOrCreate(context.Background(), "foo", map[string]interface{}{"count": 0}, &result); err != nil {
+				t.Fatal(err)
+			}
+			if d := diff.AsJSON(test.expected, result); d != "" {
+				t.Error(d)
+			}
+		})
+	}
+}
@@ -0,0 +1,149 @@
+package kivik
+
+import (
+	"encoding/json"
+
+	"github.com/flimzy/kivik/errors"
+)
+
+// Values for the Stale field of ViewOptions.
+const (
+	// StaleOK returns results from the existing index, without updating it.
+	StaleOK = "ok"
+	// StaleUpdateAfter returns results from the existing index, then updates
+	// it.
+	StaleUpdateAfter = "update_after"
+)
+
+// Values for the Update field of ViewOptions. The update option was added in
+// CouchDB 2.1, and supersedes stale.
+const (
+	UpdateTrue  = "true"
+	UpdateFalse = "false"
+	UpdateLazy  = "lazy"
+)
+
+// MaxKey sorts after all other values in CouchDB's view collation, making it
+// useful as the final element of a complex end key. For example, to select all
+// rows with keys beginning with "foo":
+//
+//	kivik.ViewOptions{
+//	    StartKey: []interface{}{"foo"},
+//	    EndKey:   []interface{}{"foo", kivik.MaxKey},
+//	}
+var MaxKey = struct{}{}
+
+// EncodeKey returns the JSON encoding of a view key, as expected by the key,
+// startkey and endkey options. Values of types registered with
+// RegisterKeyEncoder are encoded by their KeyEncoder.
+func EncodeKey(key interface{}) (string, error) {
+	key, err := EncodeValue(key)
+	if err != nil {
+		return "", errors.WrapStatus(StatusBadRequest, err)
+	}
+	body, err := json.Marshal(key)
+	if err != nil {
+		return "", errors.WrapStatus(StatusBadRequest, err)
+	}
+	return string(body), nil
+}
+
+// ViewOptions are the typed options for Query and AllDocs. Keys are JSON
+// encoded automatically; use the Options method to convert them to Options.
+//
+// Nil key fields are omitted. To query for a null key, use
+// json.RawMessage("null").
+type ViewOptions struct {
+	Key      interface{}
+	Keys     []interface{}
+	StartKey interface{}
+	EndKey   interface{}
+	// StartKeyDocID and EndKeyDocID restrict the range of rows with equal keys
+	// by document ID.
+	StartKeyDocID string
+	EndKeyDocID   string
+	// InclusiveEnd, if set to false, excludes rows matching EndKey. The server
+	// default is true.
+	InclusiveEnd *bool
+	Descending   bool
+	IncludeDocs  bool
+	Conflicts    bool
+	Limit        int
+	Skip         int
+	// Reduce, if set to false, disables the reduce function. The server
+	// default is true, for views which have one.
+	Reduce     *bool
+	Group      bool
+	GroupLevel int
+	// Stale is one of StaleOK or StaleUpdateAfter.
+	Stale string
+	// Update is one of UpdateTrue, UpdateFalse or UpdateLazy.
+	Update    string
+	UpdateSeq bool
+}
+
+// Options returns the options as Options, suitable for passing to Query or
+// AllDocs. An error is returned if any key cannot be encoded to JSON.
+func (o ViewOptions) Options() (Options, error) {
+	opts := Options{}
+	for name, key := range map[string]interface{}{
+		"key":      o.Key,
+		"startkey": o.StartKey,
+		"endkey":   o.EndKey,
+	} {
+		if key == nil {
+			continue
+		}
+		encoded, err := EncodeKey(key)
+		if err != nil {
+			return nil, err
+		}
+		opts[name] = encoded
+	}
+	if o.Keys != nil {
+		encoded, err := EncodeKey(o.Keys)
+		if err != nil {
+			return nil, err
+		}
+		opts["keys"] = encoded
+	}
+	for name, value := range map[string]string{
+		"startkey_docid": o.StartKeyDocID,
+		"endkey_docid":   o.EndKeyDocID,
+		"stale":          o.Stale,
+		"update":         o.Update,
+	} {
+		if value != "" {
+			opts[name] = value
+		}
+	}
+	for name, value := range map[string]bool{
+		"descending":   o.Descending,
+		"include_docs": o.IncludeDocs,
+		"conflicts":    o.Conflicts,
+		"group":        o.Group,
+		"update_seq":   o.UpdateSeq,
+	} {
+		if value {
+			opts[name] = true
+		}
+	}
+	for name, value := range map[string]*bool{
+		"inclusive_end": o.InclusiveEnd,
+		"reduce":        o.Reduce,
+	} {
+		if value != nil {
+			opts[name] = *value
+		}
+	}
+	for name, value := range map[string]int{
+		"limit":       o.Limit,
+		"skip":        o.Skip,
+		"group_level": o.GroupLevel,
+	} {
+		if value > 0 {
+			opts[name] = value
+		}
+	}
+	return opts, nil
+}
@@ -0,0 +1,121 @@
+package kivik
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/flimzy/diff"
+)
+
+func TestViewOptions(t *testing.T) {
+	no := false
+	tests := []struct {
+		name     string
+		opts     ViewOptions
+		expected Options
+		status   int
+		err      string
+	}{
+		{
+			name:     "Empty",
+			expected: Options{},
+		},
+		{
+			name:     "StringKey",
+			opts:     ViewOptions{Key: "foo"},
+			expected: Options{"key": `"foo"`},
+		},
+		{
+			name:     "NullKey",
+			opts:     ViewOptions{Key: json.RawMessage("null")},
+			expected: Options{"key": "null"},
+		},
+		{
+			name: "ComplexRange",
+			opts: ViewOptions{
+				StartKey:     []interface{}{"foo", 1},
+				EndKey:       []interface{}{"foo", MaxKey},
+				InclusiveEnd: &no,
+			},
+			expected: Options{
+				"startkey":      `["foo",1]`,
+				"endkey":        `["foo",{}]`,
+				"inclusive_end": false,
+			},
+		},
+		{
+			name:     "Keys",
+			opts:     ViewOptions{Keys: []interface{}{"a", 2, []string{"c"}}},
+			expected: Options{"keys": `["a",2,["c"]]`},
+		},
+		{
+			name: "EverythingElse",
+			opts: ViewOptions{
+				StartKeyDocID: "a",
+				EndKeyDocID:   "z",
+				Descending:    true,
+				IncludeDocs:   true,
+				Conflicts:     true,
+				Limit:         10,
+				Skip:          5,
+				Reduce:        &no,
+				Group:         true,
+				GroupLevel:    2,
+				Stale:         StaleUpdateAfter,
+				Update:        UpdateLazy,
+				UpdateSeq:     true,
+			},
+			expected: Options{
+				"startkey_docid": "a",
+				"endkey_docid":   "z",
+				"descending":     true,
+				"include_docs":   true,
+				"conflicts":      true,
+				"limit":          10,
+				"skip":           5,
+				"reduce":         false,
+				"group":          true,
+				"group_level":    2,
+				"stale":          "update_after",
+				"update":         "lazy",
+				"update_seq":     true,
+			},
+		},
+		{
+			name:   "InvalidKey",
+			opts:   ViewOptions{EndKey: make(chan int)},
+			status: StatusBadRequest,
+			err:    "json: unsupported type: chan int",
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			opts, err := test.opts.Options()
+			var msg string
+			var status int
+			if err != nil {
+				msg = err.Error()
+				status = StatusCode(err)
+			}
+			if msg != test.err || status != test.status {
+				t.Errorf("Unexpected error: %d %s", status, msg)
+			}
+			if err != nil {
+				return
+			}
+			if d := diff.Interface(test.expected, opts); d != "" {
+				t.Error(d)
+			}
+		})
+	}
+}
+
+func TestEncodeKey(t *testing.T) {
+	key, err := EncodeKey([]interface{}{"foo", 1.5, nil, MaxKey})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expected := `["foo",1.5,null,{}]`; key != expected {
+		t.Errorf("Expected %s, got %s", expected, key)
+	}
+}
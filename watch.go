@@ -0,0 +1,131 @@
+package kivik
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"time"
+
+	"github.com/flimzy/kivik/driver"
+)
+
+// DefaultWatchInterval is the interval at which WatchDoc polls the database,
+// if the driver does not support continuous changes feeds, unless set
+// otherwise with WatchInterval.
+const DefaultWatchInterval = time.Second
+
+const watchIntervalOption = "kivik_watch_interval"
+
+// WatchInterval returns options for WatchDoc, which set the interval at which
+// the database is polled, if the driver does not support continuous changes
+// feeds.
+func WatchInterval(d time.Duration) Options {
+	return Options{watchIntervalOption: d}
+}
+
+// WatchDoc returns a feed of the revisions of the document docID as it
+// changes: its current revision, if it exists, followed by each subsequent
+// change, until ctx is cancelled or the feed is closed. This is useful to
+// follow configuration documents, or presence records. The feed is a
+// continuous changes feed, filtered to the document by the _doc_ids filter,
+// so that the server sends only the changes to the document, with
+// include_docs, so that each revision may be read with Changes.ScanDoc.
+// options may override these, such as with Since(SinceNow), to receive only
+// subsequent changes.
+//
+// If the driver does not support continuous feeds, the database is instead
+// polled with normal feeds, every DefaultWatchInterval, or the interval set
+// with WatchInterval.
+func (db *DB) WatchDoc(ctx context.Context, docID string, options ...Options) (*Changes, error) {
+	docIDs, err := json.Marshal([]string{docID})
+	if err != nil {
+		return nil, err
+	}
+	options = append([]Options{{
+		"feed":         "continuous",
+		"since":        "0",
+		"filter":       "_doc_ids",
+		"doc_ids":      string(docIDs),
+		"include_docs": true,
+	}}, options...)
+	opts, err := db.options(ctx, "Changes", options...)
+	if err != nil {
+		return nil, err
+	}
+	interval := DefaultWatchInterval
+	if d, ok := opts[watchIntervalOption].(time.Duration); ok && d > 0 {
+		interval = d
+	}
+	delete(opts, watchIntervalOption)
+	changes, err := db.Changes(ctx, opts)
+	if StatusCode(err) != StatusNotImplemented || opts["feed"] != "continuous" {
+		return changes, err
+	}
+	opts["feed"] = "normal"
+	_ = prefetch(opts)
+	ctx, cancel := withTimeout(ctx, db.timeouts.Changes)
+	feed := &pollChanges{ctx: ctx, db: db.driverDB, opts: opts, interval: interval}
+	// The first poll is made now, so that errors are returned by WatchDoc.
+	if err := feed.poll(); err != nil {
+		cancel()
+		return nil, err
+	}
+	changes = newChanges(ctx, feed)
+	changes.releaseOnClose(cancel)
+	return changes, nil
+}
+
+// pollChanges emulates a continuous changes feed by polling with normal
+// feeds, each from the last sequence received.
+type pollChanges struct {
+	ctx      context.Context
+	db       driver.DB
+	opts     Options
+	interval time.Duration
+	feed     driver.Changes
+}
+
+var _ driver.Changes = &pollChanges{}
+
+func (p *pollChanges) poll() error {
+	feed, err := p.db.Changes(p.ctx, p.opts)
+	if err != nil {
+		return err
+	}
+	p.feed = feed
+	return nil
+}
+
+func (p *pollChanges) Next(change *driver.Change) error {
+	for {
+		if p.feed == nil {
+			select {
+			case <-p.ctx.Done():
+				return p.ctx.Err()
+			case <-time.After(p.interval):
+			}
+			if err := p.poll(); err != nil {
+				return err
+			}
+		}
+		err := p.feed.Next(change)
+		if err == nil {
+			p.opts["since"] = string(change.Seq)
+			return nil
+		}
+		if err != io.EOF {
+			return err
+		}
+		if err := p.feed.Close(); err != nil {
+			return err
+		}
+		p.feed = nil
+	}
+}
+
+func (p *pollChanges) Close() error {
+	if p.feed == nil {
+		return nil
+	}
+	return p.feed.Close()
+}
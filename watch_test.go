@@ -0,0 +1,152 @@
+package kivik
+
+import (
+	"context"
+	"io"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/flimzy/diff"
+	"github.com/flimzy/kivik/driver"
+	"github.com/flimzy/kivik/errors"
+)
+
+// watchDB serves normal changes feeds of its changes, and refuses continuous
+// feeds unless continuous is set, in which case it records the options.
+type watchDB struct {
+	driver.DB
+	continuous bool
+	mu         sync.Mutex
+	changes    []*driver.Change
+	opts       map[string]interface{}
+}
+
+func (db *watchDB) add(id, rev string) {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	seq := strconv.Itoa(len(db.changes) + 1)
+	db.changes = append(db.changes, &driver.Change{ID: id, Seq: driver.SequenceID(seq), Changes: driver.ChangedRevs{rev}})
+}
+
+func (db *watchDB) Changes(_ context.Context, opts map[string]interface{}) (driver.Changes, error) {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	db.opts = opts
+	if opts["feed"] == "continuous" {
+		if db.continuous {
+			return &watchChanges{}, nil
+		}
+		return nil, errors.Status(StatusNotImplemented, "continuous feeds not supported")
+	}
+	since, _ := strconv.Atoi(opts["since"].(string))
+	feed := &watchChanges{}
+	for _, change := range db.changes[since:] {
+		if change.ID == "foo" {
+			feed.changes = append(feed.changes, change)
+		}
+	}
+	return feed, nil
+}
+
+type watchChanges struct {
+	changes []*driver.Change
+}
+
+func (c *watchChanges) Next(change *driver.Change) error {
+	if len(c.changes) == 0 {
+		return io.EOF
+	}
+	*change = *c.changes[0]
+	c.changes = c.changes[1:]
+	return nil
+}
+
+func (c *watchChanges) Close() error { return nil }
+
+func newWatchDB(t *testing.T, driverDB *watchDB) *DB {
+	client, err := NewClientFromDriver(context.Background(), &watchDriver{db: driverDB}, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	db, err := client.DB(context.Background(), "foo")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return db
+}
+
+type watchDriver struct {
+	db *watchDB
+}
+
+func (d *watchDriver) NewClient(_ context.Context, _ string) (driver.Client, error) {
+	return &watchClient{db: d.db}, nil
+}
+
+type watchClient struct {
+	driver.Client
+	db *watchDB
+}
+
+func (c *watchClient) DB(_ context.Context, _ string, _ map[string]interface{}) (driver.DB, error) {
+	return c.db, nil
+}
+
+func TestWatchDoc(t *testing.T) {
+	driverDB := &watchDB{continuous: true}
+	db := newWatchDB(t, driverDB)
+	changes, err := db.WatchDoc(context.Background(), "foo", Options{"heartbeat": 1000})
+	if err != nil {
+		t.Fatal(err)
+	}
+	_ = changes.Close()
+	expected := map[string]interface{}{
+		"feed":         "continuous",
+		"since":        "0",
+		"filter":       "_doc_ids",
+		"doc_ids":      `["foo"]`,
+		"include_docs": true,
+		"heartbeat":    1000,
+	}
+	if d := diff.Interface(expected, driverDB.opts); d != "" {
+		t.Error(d)
+	}
+}
+
+func TestWatchDocPolling(t *testing.T) {
+	driverDB := &watchDB{}
+	driverDB.add("foo", "1-a")
+	driverDB.add("bar", "1-b")
+	db := newWatchDB(t, driverDB)
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	changes, err := db.WatchDoc(ctx, "foo", WatchInterval(time.Millisecond))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = changes.Close() }()
+	var revs []string
+	for changes.Next() {
+		revs = append(revs, changes.Changes()...)
+		if len(revs) == 1 {
+			driverDB.add("bar", "2-b")
+			driverDB.add("foo", "2-a")
+		}
+		if len(revs) == 2 {
+			break
+		}
+	}
+	if err := changes.Err(); err != nil {
+		t.Fatal(err)
+	}
+	if d := diff.Interface([]string{"1-a", "2-a"}, revs); d != "" {
+		t.Error(d)
+	}
+	driverDB.mu.Lock()
+	defer driverDB.mu.Unlock()
+	if feed := driverDB.opts["feed"]; feed != "normal" {
+		t.Errorf("Expected polling with normal feeds, got %v", feed)
+	}
+}